@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/sections"
+)
+
+// anchorSections gives the headings of the document's pages stable anchors,
+// so readers can link to a section. Headings and sections the author gave
+// an id keep it.
+func anchorSections(pkg *builtPackage, verbose bool) error {
+	var pages []string
+	for path, resource := range pkg.manifest.Resources {
+		if strings.HasPrefix(path, "content/") && strings.HasPrefix(resource.Type, "text/html") && pkg.files[path] != nil {
+			pages = append(pages, path)
+		}
+	}
+	sort.Strings(pages)
+
+	total := 0
+	for _, path := range pages {
+		page, added := sections.Anchor(pkg.files[path])
+		if added == 0 {
+			continue
+		}
+		pkg.setResource(path, page, pkg.manifest.Resources[path].Type)
+		total += added
+		if verbose {
+			fmt.Printf("    Anchored %d sections in %s\n", added, path)
+		}
+	}
+	if verbose && total > 0 {
+		fmt.Printf("  Added %d section anchors\n", total)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/anonymize"
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+// anonymizeOptions configures building a double-blind review copy
+type anonymizeOptions struct {
+	// Enabled builds a review copy
+	Enabled bool
+	// PatternsFile lists further identifying strings as regular expressions
+	PatternsFile string
+	// MappingFile receives the sealed mapping; by default it is written next
+	// to the document
+	MappingFile string
+	// KeyFile holds the passphrase sealing the mapping
+	KeyFile string
+}
+
+// mappingPath returns where the sealed mapping of a review copy is written
+func (o anonymizeOptions) mappingPath(outputFile string) string {
+	if o.MappingFile != "" {
+		return o.MappingFile
+	}
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + anonymize.Extension
+}
+
+// check reports missing settings before the build starts
+func (o anonymizeOptions) check() error {
+	if !o.Enabled {
+		return nil
+	}
+	if o.KeyFile == "" {
+		return fmt.Errorf("anonymizing requires a passphrase file to seal the identity mapping (--mapping-key)")
+	}
+	if _, err := os.Stat(o.KeyFile); os.IsNotExist(err) {
+		return fmt.Errorf("mapping key file does not exist: %s", o.KeyFile)
+	}
+	if o.PatternsFile != "" {
+		if _, err := anonymize.LoadPatterns(o.PatternsFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anonymizeDocument turns the package into a double-blind review copy and
+// writes the sealed mapping that restores its identity
+func anonymizeDocument(pkg *builtPackage, outputFile string, opts anonymizeOptions, verbose bool) error {
+	passphrase, err := os.ReadFile(opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read mapping key: %v", err)
+	}
+	var patterns []*regexp.Regexp
+	if opts.PatternsFile != "" {
+		if patterns, err = anonymize.LoadPatterns(opts.PatternsFile); err != nil {
+			return err
+		}
+	}
+
+	mapping, report, err := anonymize.Anonymize(pkg.files, pkg.manifest, patterns)
+	if err != nil {
+		return err
+	}
+	sealed, err := anonymize.Seal(mapping, strings.TrimRight(string(passphrase), "\r\n"))
+	if err != nil {
+		return fmt.Errorf("failed to seal identity mapping: %v", err)
+	}
+
+	mappingFile := opts.mappingPath(outputFile)
+	if err := atomicfile.WriteFile(mappingFile, sealed, 0600); err != nil {
+		return fmt.Errorf("failed to write identity mapping: %v", err)
+	}
+
+	replaced := 0
+	for _, count := range report.Replacements {
+		replaced += count
+	}
+	fmt.Printf("  Removed %d acknowledgments and identifying sections, replaced %d identifying strings in %d files\n",
+		report.Sections, replaced, len(report.Files))
+	if verbose {
+		matches := make([]string, 0, len(report.Replacements))
+		for match := range report.Replacements {
+			matches = append(matches, match)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			fmt.Printf("    %q: %d\n", match, report.Replacements[match])
+		}
+		for _, path := range report.Files {
+			fmt.Printf("    Anonymized: %s\n", path)
+		}
+	}
+	fmt.Printf("  Sealed identity mapping: %s (keep it until review ends)\n", mappingFile)
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/attestation"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/sbom"
+)
+
+// attestationOptions configures the signed provenance written next to the
+// package
+type attestationOptions struct {
+	Enabled bool
+	// File is where the attestation is written, by default the package
+	// name with .intoto.jsonl
+	File string
+}
+
+// path returns where the attestation of outputFile is written
+func (o attestationOptions) path(outputFile string) string {
+	if o.File != "" {
+		return o.File
+	}
+	return outputFile + attestation.Extension
+}
+
+// buildRecord collects what a build attestation records while the build
+// runs
+type buildRecord struct {
+	inputDir     string
+	reproducible bool
+	// parameters are the options the build was run with
+	parameters map[string]interface{}
+	// inputs are the files besides the source tree the build read, by name
+	inputs map[string]string
+	steps  []string
+	// started is set when the first step runs
+	started time.Time
+	// source is the source tree as the first step found it, before the
+	// build adds generated files to it
+	source []*attestation.SourceFile
+}
+
+// attestSteps records the steps of a build and adds a final step signing
+// its provenance with keyFile
+func attestSteps(steps []buildStep, record *buildRecord, outputFile, keyFile string, opts attestationOptions, verbose bool) []buildStep {
+	first := steps[0].fn
+	steps[0].fn = func() error {
+		record.started = buildTime(record.reproducible)
+		if err := record.hashSource(); err != nil {
+			return err
+		}
+		return first()
+	}
+	record.steps = nil
+	for _, step := range steps {
+		record.steps = append(record.steps, step.name)
+	}
+	return append(steps, buildStep{"Writing build attestation", func() error {
+		return writeAttestation(outputFile, keyFile, opts, record, verbose)
+	}})
+}
+
+// hashSource records the files of the source tree and their hashes
+func (r *buildRecord) hashSource() error {
+	sources, err := hashSources(r.inputDir, integrity.NewResourceHasher(integrity.SHA256))
+	if err != nil {
+		return err
+	}
+	r.source = make([]*attestation.SourceFile, len(sources))
+	for i, source := range sources {
+		r.source[i] = &attestation.SourceFile{Path: source.relPath, SHA256: source.hash}
+	}
+	return nil
+}
+
+// writeAttestation signs an in-toto statement that outputFile was built
+// from the source tree and inputs of record, with its parameters, steps and
+// environment, and writes it next to the package
+func writeAttestation(outputFile, keyFile string, opts attestationOptions, record *buildRecord, verbose bool) error {
+	sm := integrity.NewSignatureManager()
+	privateKey, err := sm.LoadPrivateKeyPEM(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load private key: %v", err)
+	}
+	pkg, err := os.ReadFile(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to read package: %v", err)
+	}
+
+	dependencies := []*attestation.ResourceDescriptor{{
+		Name:   "source",
+		Digest: map[string]string{"sha256": attestation.TreeDigest(record.source)},
+	}}
+	for _, name := range []string{"manifest", "anonymize-patterns", "advisories", "build-config"} {
+		path := record.inputs[name]
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		dependencies = append(dependencies, &attestation.ResourceDescriptor{
+			Name:   name,
+			Digest: map[string]string{"sha256": attestation.Digest(data)},
+		})
+	}
+
+	environment := map[string]interface{}{
+		"go":     runtime.Version(),
+		"goos":   runtime.GOOS,
+		"goarch": runtime.GOARCH,
+	}
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		environment["SOURCE_DATE_EPOCH"] = epoch
+	}
+	versions := make(map[string]string)
+	for _, tool := range sbom.Toolchain() {
+		versions[tool.Name] = tool.Version
+	}
+
+	started, finished := record.started, buildTime(record.reproducible)
+	if started.IsZero() {
+		started = finished
+	}
+	runDetails := &attestation.RunDetails{
+		Builder:  &attestation.Builder{ID: attestation.BuilderID, Version: versions},
+		Metadata: &attestation.RunMetadata{StartedOn: &started, FinishedOn: &finished},
+	}
+	if files, err := container.NewZIPContainer().ExtractToMemory(outputFile); err == nil && files[sbom.Entry] != nil {
+		runDetails.Byproducts = append(runDetails.Byproducts, &attestation.ResourceDescriptor{
+			Name:   sbom.Entry,
+			Digest: map[string]string{"sha256": attestation.Digest(files[sbom.Entry])},
+		})
+	}
+
+	statement := attestation.NewStatement(filepath.Base(outputFile), pkg, &attestation.Provenance{
+		BuildDefinition: &attestation.BuildDefinition{
+			BuildType:          attestation.BuildType,
+			ExternalParameters: record.parameters,
+			InternalParameters: map[string]interface{}{
+				"steps":       record.steps,
+				"environment": environment,
+			},
+			ResolvedDependencies: dependencies,
+		},
+		RunDetails: runDetails,
+	})
+	envelope, err := attestation.Sign(statement, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign attestation: %v", err)
+	}
+	data, err := attestation.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	attestationFile := opts.path(outputFile)
+	if err := atomicfile.WriteFile(attestationFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write attestation: %v", err)
+	}
+
+	if verbose {
+		fmt.Printf("  Source tree: sha256:%s (%d files)\n", dependencies[0].Digest["sha256"], len(record.source))
+		fmt.Printf("  Package: sha256:%s\n", statement.Subject[0].Digest["sha256"])
+	}
+	fmt.Printf("  Attestation written to %s\n", attestationFile)
+	return nil
+}
@@ -1,14 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"crypto"
+	"image"
+	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/liv-format/liv/pkg/anonymize"
+	"github.com/liv-format/liv/pkg/attestation"
 	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
 	"github.com/liv-format/liv/pkg/integrity"
 	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/ogimage"
+	"github.com/liv-format/liv/pkg/printstyle"
+	"github.com/liv-format/liv/pkg/sbom"
+	"github.com/liv-format/liv/pkg/verification"
+	"github.com/spf13/cobra"
 )
 
 // TestBuilderFunctions tests the builder functions directly
@@ -180,13 +193,13 @@ func testScanSourceFiles(t *testing.T, testDir string) {
 
 func testProcessAssets(t *testing.T, testDir string) {
 	// Test processing assets
-	err := processAssets(testDir, true, true)
+	err := processAssets(testDir, true, true, true)
 	if err != nil {
 		t.Errorf("processAssets failed: %v", err)
 	}
 
 	// Test without compression
-	err = processAssets(testDir, false, false)
+	err = processAssets(testDir, false, false, false)
 	if err != nil {
 		t.Errorf("processAssets without compression failed: %v", err)
 	}
@@ -194,7 +207,7 @@ func testProcessAssets(t *testing.T, testDir string) {
 
 func testGenerateManifest(t *testing.T, testDir string) {
 	// Test generating manifest
-	err := generateManifest(testDir, "", true)
+	err := generateManifest(testDir, "", nil, true, true)
 	if err != nil {
 		t.Errorf("generateManifest failed: %v", err)
 	}
@@ -235,16 +248,20 @@ func testGenerateManifest(t *testing.T, testDir string) {
 
 func testCreatePackage(t *testing.T, testDir string) {
 	// First generate manifest
-	err := generateManifest(testDir, "", false)
+	err := generateManifest(testDir, "", nil, true, false)
 	if err != nil {
 		t.Fatalf("Failed to generate manifest for package test: %v", err)
 	}
 
 	// Test creating package
 	outputFile := filepath.Join(testDir, "test-package.liv")
-	err = createPackage(testDir, outputFile, true)
+	pkg := &builtPackage{}
+	err = createPackage(pkg, testDir, outputFile, nil, true)
 	if err != nil {
-		t.Errorf("createPackage failed: %v", err)
+		t.Fatalf("createPackage failed: %v", err)
+	}
+	if err := pkg.write(outputFile, false, true); err != nil {
+		t.Errorf("Failed to write package: %v", err)
 	}
 
 	// Check that package was created
@@ -275,23 +292,27 @@ func testCreatePackage(t *testing.T, testDir string) {
 
 func testSignDocument(t *testing.T, testDir string) {
 	// First create a document to sign
-	err := generateManifest(testDir, "", false)
+	err := generateManifest(testDir, "", nil, true, false)
 	if err != nil {
 		t.Fatalf("Failed to generate manifest for sign test: %v", err)
 	}
 
 	outputFile := filepath.Join(testDir, "test-sign.liv")
-	err = createPackage(testDir, outputFile, false)
+	pkg := &builtPackage{}
+	err = createPackage(pkg, testDir, outputFile, nil, false)
 	if err != nil {
 		t.Fatalf("Failed to create package for sign test: %v", err)
 	}
 
 	// Test signing document
 	keyPath := filepath.Join(testDir, "test-key.pem")
-	err = signDocument(outputFile, keyPath, true)
+	err = signDocument(pkg, keyPath, true, true)
 	if err != nil {
 		t.Errorf("signDocument failed: %v", err)
 	}
+	if err := pkg.write(outputFile, true, false); err != nil {
+		t.Fatalf("Failed to write signed package: %v", err)
+	}
 
 	// Verify the document was signed
 	zipContainer := container.NewZIPContainer()
@@ -319,7 +340,7 @@ func testSignDocument(t *testing.T, testDir string) {
 	}
 
 	// Test signing with nonexistent key
-	err = signDocument(outputFile, "nonexistent.pem", false)
+	err = signDocument(pkg, "nonexistent.pem", true, false)
 	if err == nil {
 		t.Error("Expected error for nonexistent key file, but signing succeeded")
 	}
@@ -332,7 +353,7 @@ func testCompleteBuilderWorkflow(t *testing.T, testDir string) {
 	keyPath := filepath.Join(testDir, "test-key.pem")
 
 	// Test complete workflow using runBuilder function
-	err := runBuilder(testDir, outputFile, "", true, true, keyPath, true)
+	err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, Sign: true, KeyFile: keyPath, Verbose: true})
 	if err != nil {
 		t.Errorf("Complete builder workflow failed: %v", err)
 	}
@@ -469,7 +490,7 @@ func TestBuilderHelperFunctions(t *testing.T) {
 // TestBuilderErrorHandling tests error conditions
 func TestBuilderErrorHandling(t *testing.T) {
 	t.Run("InvalidInputDirectory", func(t *testing.T) {
-		err := runBuilder("nonexistent-directory", "output.liv", "", false, false, "", false)
+		err := runBuilder(buildOptions{InputDir: "nonexistent-directory", OutputFile: "output.liv", ImageVariants: true, Reproducible: true})
 		if err == nil {
 			t.Error("Expected error for nonexistent input directory")
 		}
@@ -479,7 +500,7 @@ func TestBuilderErrorHandling(t *testing.T) {
 		testDir := setupBuilderTestDir(t)
 		defer os.RemoveAll(testDir)
 
-		err := runBuilder(testDir, "output.liv", "", false, true, "", false)
+		err := runBuilder(buildOptions{InputDir: testDir, OutputFile: "output.liv", ImageVariants: true, Reproducible: true, Sign: true})
 		if err == nil {
 			t.Error("Expected error for signing without key file")
 		}
@@ -489,9 +510,1006 @@ func TestBuilderErrorHandling(t *testing.T) {
 		testDir := setupBuilderTestDir(t)
 		defer os.RemoveAll(testDir)
 
-		err := runBuilder(testDir, "output.liv", "", false, true, "nonexistent.pem", false)
+		err := runBuilder(buildOptions{InputDir: testDir, OutputFile: "output.liv", ImageVariants: true, Reproducible: true, Sign: true, KeyFile: "nonexistent.pem"})
 		if err == nil {
 			t.Error("Expected error for signing with nonexistent key file")
 		}
 	})
-}
\ No newline at end of file
+}
+
+// TestAssetLicensePolicy tests that strict asset license policies block builds unless waived
+func TestAssetLicensePolicy(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// Minimal TrueType font with only an OS/2 table whose fsType forbids embedding
+	font := make([]byte, 28+78)
+	copy(font[0:4], "\x00\x01\x00\x00")
+	font[5] = 1
+	copy(font[12:16], "OS/2")
+	font[23] = 28
+	font[27] = 78
+	font[28+9] = 0x02
+
+	fontDir := filepath.Join(testDir, "assets", "fonts")
+	if err := os.MkdirAll(fontDir, 0755); err != nil {
+		t.Fatalf("Failed to create font directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(fontDir, "restricted.ttf"), font, 0644); err != nil {
+		t.Fatalf("Failed to write font: %v", err)
+	}
+
+	outputFile := filepath.Join(testDir, "licensed.liv")
+
+	err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "strict"})
+	if err == nil {
+		t.Fatal("Expected strict policy to block a restricted font")
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Error("Expected blocked build to leave no output")
+	}
+
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "warn"}); err != nil {
+		t.Errorf("Expected warn policy to succeed: %v", err)
+	}
+
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "strict", Waiver: "Font licensed for embedding under contract"}); err != nil {
+		t.Fatalf("Expected waived build to succeed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if parsedManifest.Compliance == nil || len(parsedManifest.Compliance.Waivers) != 1 {
+		t.Fatal("Expected the waiver to be recorded in the manifest")
+	}
+	waiver := parsedManifest.Compliance.Waivers[0]
+	if waiver.Assets[0] != "assets/fonts/restricted.ttf" || waiver.Reason != "Font licensed for embedding under contract" {
+		t.Errorf("Unexpected waiver: %+v", waiver)
+	}
+}
+
+func TestBuildRendersPreviewCard(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	// The output is written inside the input directory, as with "liv build -i . -o doc.liv"
+	outputFile := filepath.Join(testDir, "preview.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	card, exists := files[ogimage.Entry]
+	if !exists {
+		t.Fatal("Expected the preview card in the package")
+	}
+	if _, exists := files["preview.liv"]; exists {
+		t.Error("The package must not contain itself")
+	}
+
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	resource := parsedManifest.Resources[ogimage.Entry]
+	if resource == nil || resource.Type != "image/png" || resource.Size != int64(len(card)) {
+		t.Errorf("Expected the preview card in the manifest, got %+v", resource)
+	}
+	if resource != nil && resource.Hash != integrity.NewResourceHasher(integrity.SHA256).HashBytes(card) {
+		t.Error("Preview card hash does not match its content")
+	}
+}
+
+func TestBuildGeneratesPrintStylesheet(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	page := `<html><head><title>Print</title></head><body><h1>Sales</h1>
+<table><thead><tr><th>Quarter</th><th>Sales</th></tr></thead><tbody><tr><td>Q1</td><td>10</td></tr></tbody></table></body></html>`
+	if err := os.WriteFile(filepath.Join(testDir, "content", "index.html"), []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+	custom := manifest.NewManifestBuilder()
+	custom.CreateDefaultMetadata("Print", "Test Author").CreateDefaultSecurityPolicy()
+	custom.AddResource("content/index.html", &core.Resource{
+		Hash: integrity.NewResourceHasher(integrity.SHA256).HashBytes([]byte(page)),
+		Size: int64(len(page)),
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	custom.SetPrintSettings(&core.PrintSettings{PageSize: "Letter", Margin: "20mm"})
+	manifestFile := filepath.Join(t.TempDir(), "custom.json")
+	if err := custom.SaveToFile(manifestFile); err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "print.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, ManifestFile: manifestFile, Compress: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	css := string(files[printstyle.Entry])
+	for _, rule := range []string{"size: Letter;", "margin: 20mm;", "display: table-header-group;"} {
+		if !strings.Contains(css, rule) {
+			t.Errorf("Expected %q in the print stylesheet:\n%s", rule, css)
+		}
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if parsedManifest.Print == nil || parsedManifest.Print.Stylesheet != printstyle.Entry || parsedManifest.Print.PageSize != "Letter" {
+		t.Errorf("Expected the print hints in the manifest, got %+v", parsedManifest.Print)
+	}
+	if resource := parsedManifest.Resources[printstyle.Entry]; resource == nil || resource.Hash != integrity.NewResourceHasher(integrity.SHA256).HashBytes([]byte(css)) {
+		t.Errorf("Expected the print stylesheet in the manifest, got %+v", resource)
+	}
+
+	// A stylesheet the author wrote is kept
+	authored := "@page { size: A5; }"
+	if err := os.WriteFile(filepath.Join(testDir, filepath.FromSlash(printstyle.Entry)), []byte(authored), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, ManifestFile: manifestFile, Compress: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	files, err = container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	if string(files[printstyle.Entry]) != authored {
+		t.Errorf("Expected the author's print stylesheet, got %s", files[printstyle.Entry])
+	}
+}
+
+func TestBuildGeneratesImageVariants(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	photo := image.NewRGBA(image.Rect(0, 0, 1000, 600))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, photo); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(testDir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "assets", "photo.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(testDir, "variants.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	for _, entry := range []string{"assets/photo-480w.png", "assets/photo-960w.png"} {
+		if _, exists := files[entry]; !exists {
+			t.Errorf("Expected %s in the package", entry)
+		}
+	}
+	if _, exists := files["assets/photo-1440w.png"]; exists {
+		t.Error("Images must not be scaled up")
+	}
+
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	found := parsedManifest.Resources["assets/photo.png"].Variants
+	if len(found) != 2 || found[0].Path != "assets/photo-480w.png" || found[0].Width != 480 || found[1].Width != 960 {
+		t.Errorf("Expected two width variants in the manifest, got %v", found)
+	}
+}
+
+func TestBuildGeneratesSBOM(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	outputFile := filepath.Join(testDir, "inventory.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	data, exists := files[sbom.Entry]
+	if !exists {
+		t.Fatal("Expected the SBOM in the package")
+	}
+	bom, err := sbom.Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse SBOM: %v", err)
+	}
+	if mismatches := sbom.Verify(bom, files); len(mismatches) != 0 {
+		t.Errorf("Expected the SBOM to match the package, %s differs", mismatches[0].Path)
+	}
+	// The verification descriptor is written after the SBOM
+	delete(files, verification.Entry)
+	if len(bom.Components) != len(files)-2 || bom.Metadata.Tools == nil {
+		t.Errorf("Expected every packaged file and the toolchain to be listed, got %d components for %d files", len(bom.Components), len(files))
+	}
+
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if resource := parsedManifest.Resources[sbom.Entry]; resource == nil || resource.Hash != integrity.NewResourceHasher(integrity.SHA256).HashBytes(data) {
+		t.Errorf("Expected the SBOM in the manifest, got %+v", resource)
+	}
+}
+
+func TestBuildChecksVulnerableComponents(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	script := "/*! jQuery v3.4.1 | (c) JS Foundation and other contributors | jquery.org/license */\n!function(e,t){}"
+	if err := os.WriteFile(filepath.Join(testDir, "content", "scripts", "jquery.min.js"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	feedFile := filepath.Join(t.TempDir(), "advisories.json")
+	feed := `{"advisories": [{"id": "CVE-2020-11022", "package": "jquery", "versions": ">=1.2.0 <3.5.0", "severity": "medium", "summary": "XSS in htmlPrefilter"}]}`
+	if err := os.WriteFile(feedFile, []byte(feed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "vulnerable.liv")
+	strict := vulnerabilityOptions{FeedFile: feedFile, Policy: "strict"}
+	err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Vulnerabilities: strict})
+	if err == nil || !strings.Contains(err.Error(), "1 components match advisories") {
+		t.Fatalf("Expected the strict policy to fail the build, got %v", err)
+	}
+	if fileExists(outputFile) {
+		t.Error("Expected the package to be removed")
+	}
+
+	warn := vulnerabilityOptions{FeedFile: feedFile, Policy: "warn"}
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Vulnerabilities: warn}); err != nil {
+		t.Fatalf("Expected the warn policy to build, got %v", err)
+	}
+
+	invalid := vulnerabilityOptions{FeedFile: feedFile, Policy: "lenient"}
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Vulnerabilities: invalid}); err == nil {
+		t.Error("Expected an unknown policy to be refused")
+	}
+}
+
+func TestHashSources(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	if err := os.WriteFile(filepath.Join(testDir, ".hidden"), []byte("skipped"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := hashSources(testDir, integrity.NewResourceHasher(integrity.SHA256))
+	if err != nil {
+		t.Fatalf("hashSources() failed: %v", err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("Expected the source files to be listed")
+	}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	for i, source := range sources {
+		if source.relPath == ".hidden" {
+			t.Errorf("Expected hidden files to be skipped")
+		}
+		if i > 0 && sources[i-1].path >= source.path {
+			t.Errorf("Expected files in walk order, got %s after %s", source.path, sources[i-1].path)
+		}
+		if expected, _ := hasher.HashFile(source.path); source.hash != expected {
+			t.Errorf("Hash of %s is %s, expected %s", source.relPath, source.hash, expected)
+		}
+	}
+
+	// Unchanged files are not read again
+	fileHashes.rehashed()
+	if _, err := hashSources(testDir, integrity.NewResourceHasher(integrity.SHA256)); err != nil {
+		t.Fatal(err)
+	}
+	if n := fileHashes.rehashed(); n != 0 {
+		t.Errorf("Expected cached hashes to be reused, but %d files were hashed", n)
+	}
+}
+
+func TestWatchRebuildsChangedFiles(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	outputFile := filepath.Join(testDir, "watched.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	fileHashes.rehashed()
+
+	// Generated files and the output do not count as source changes
+	before, err := snapshotSources(testDir, outputFile)
+	if err != nil {
+		t.Fatalf("Failed to snapshot sources: %v", err)
+	}
+	for path := range before {
+		if rel, _ := filepath.Rel(testDir, path); rel == "manifest.json" || rel == "watched.liv" || filepath.ToSlash(rel) == ogimage.Entry || filepath.ToSlash(rel) == printstyle.Entry {
+			t.Errorf("Generated file %s is watched", rel)
+		}
+	}
+
+	stage := newSourceStage(testDir)
+	defer stage.remove()
+	steps := buildSteps(stage, buildOptions{OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "off"})
+	rebuilt := make(chan []string, 4)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- watchSources(testDir, outputFile, 20*time.Millisecond, func(changed []string) error {
+			err := rebuild(steps)
+			rebuilt <- changed
+			return err
+		}, stop)
+	}()
+
+	// Let the watcher take its first snapshot before editing
+	time.Sleep(50 * time.Millisecond)
+	cssPath := filepath.Join(testDir, "content", "styles", "main.css")
+	if err := os.WriteFile(cssPath, []byte("body { color: rebeccapurple; }"), 0644); err != nil {
+		t.Fatalf("Failed to edit stylesheet: %v", err)
+	}
+
+	select {
+	case changed := <-rebuilt:
+		if len(changed) != 1 || changed[0] != cssPath {
+			t.Errorf("Expected only the stylesheet to change, got %v", changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a rebuild")
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("watchSources() failed: %v", err)
+	}
+
+	// Only the edited file is hashed again, besides the manifest, preview card,
+	// print stylesheet and package the build writes into the input directory
+	if n := fileHashes.rehashed(); n > 5 {
+		t.Errorf("Expected an incremental rebuild, but %d files were hashed", n)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	if got := string(files["content/styles/main.css"]); !strings.Contains(got, "rebeccapurple") {
+		t.Errorf("Package was not rebuilt, stylesheet is %q", got)
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if resource := parsedManifest.Resources["content/styles/main.css"]; resource == nil || resource.Hash != integrity.NewResourceHasher(integrity.SHA256).HashBytes(files["content/styles/main.css"]) {
+		t.Errorf("Manifest hash does not match the edited stylesheet: %+v", resource)
+	}
+}
+
+func TestBuildAnonymized(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	page := `<html><head><title>Folding</title></head><body><h1>Folding</h1>
+<p>As Carberry et al. showed, folding is slow. See https://lab.example.org/carberry.</p>
+<h2>Acknowledgments</h2><p>We thank our colleagues.</p></body></html>`
+	if err := os.WriteFile(filepath.Join(testDir, "content", "index.html"), []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+	custom := manifest.NewManifestBuilder()
+	custom.CreateDefaultMetadata("Folding", "Josiah Carberry").CreateDefaultSecurityPolicy()
+	custom.GetManifest().Metadata.Authors = []*core.AuthorInfo{{Name: "Josiah Carberry", Affiliation: "Brown University"}}
+	custom.AddResource("content/index.html", &core.Resource{
+		Hash: integrity.NewResourceHasher(integrity.SHA256).HashBytes([]byte(page)),
+		Size: int64(len(page)),
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	manifestFile := filepath.Join(t.TempDir(), "custom.json")
+	if err := custom.SaveToFile(manifestFile); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "mapping.key")
+	if err := os.WriteFile(keyFile, []byte("review-2024\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	patternsFile := filepath.Join(t.TempDir(), "patterns.txt")
+	if err := os.WriteFile(patternsFile, []byte(`lab\.example\.org/\S*`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "review.liv")
+	review := anonymizeOptions{Enabled: true, PatternsFile: patternsFile, KeyFile: keyFile}
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Review: anonymizeOptions{Enabled: true}}); err == nil {
+		t.Errorf("Expected anonymizing without a mapping key to fail")
+	}
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, ManifestFile: manifestFile, Compress: true, Reproducible: true, AssetPolicy: "off", Review: review}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	for path, data := range files {
+		for _, identifying := range []string{"Carberry", "Brown University", "lab.example.org", "We thank"} {
+			if strings.Contains(string(data), identifying) {
+				t.Errorf("Expected %q to be removed from %s", identifying, path)
+			}
+		}
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if parsedManifest.Metadata.Author != anonymize.AnonymousAuthor {
+		t.Errorf("Expected an anonymous byline, got %q", parsedManifest.Metadata.Author)
+	}
+	if resource := parsedManifest.Resources["content/index.html"]; resource == nil || resource.Hash != integrity.NewResourceHasher(integrity.SHA256).HashBytes(files["content/index.html"]) {
+		t.Errorf("Manifest hash does not match the anonymized page: %+v", resource)
+	}
+
+	sealed, err := os.ReadFile(strings.TrimSuffix(outputFile, ".liv") + anonymize.Extension)
+	if err != nil {
+		t.Fatalf("Expected the sealed mapping next to the document: %v", err)
+	}
+	mapping, err := anonymize.Unseal(sealed, "review-2024")
+	if err != nil {
+		t.Fatalf("Failed to unseal mapping: %v", err)
+	}
+	if err := anonymize.Restore(files, parsedManifest, mapping); err != nil {
+		t.Fatalf("Failed to restore identity: %v", err)
+	}
+	if string(files["content/index.html"]) != page || parsedManifest.Metadata.Author != "Josiah Carberry" {
+		t.Errorf("Expected the identity to be restored")
+	}
+}
+
+func TestReproducibleBuild(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	build := func() []byte {
+		outputFile := filepath.Join(t.TempDir(), "document.liv")
+		if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, ImageVariants: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		data, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := build()
+
+	// The same sources checked out later, as on another machine, next to the
+	// manifest the first build wrote
+	later := time.Now().Add(time.Hour)
+	filepath.Walk(testDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			os.Chtimes(path, later, later)
+		}
+		return nil
+	})
+	if second := build(); !bytes.Equal(first, second) {
+		t.Errorf("Expected two builds of the same sources to be identical")
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	data := build()
+	files, err := container.NewZIPContainer().ExtractFromReaderToMemory(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if !parsedManifest.Metadata.Modified.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected the manifest to record SOURCE_DATE_EPOCH, got %v", parsedManifest.Metadata.Modified)
+	}
+	if _, listed := parsedManifest.Resources["manifest.json"]; listed {
+		t.Errorf("Expected the manifest not to list itself")
+	}
+}
+
+func TestBuildOptimizesAssets(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	configFile := filepath.Join(t.TempDir(), "liv-build.json")
+	if err := os.WriteFile(configFile, []byte(`{"optimize": {"exclude": ["main.js"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(filepath.Join(testDir, "content", "scripts", "main.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "optimized.liv")
+	optimization := optimizeOptions{Stages: "minify", ConfigFile: configFile}
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Optimization: optimization}); err != nil {
+		t.Fatalf("runBuilder() failed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract package: %v", err)
+	}
+	if css := string(files["content/styles/main.css"]); strings.Contains(css, "\n") || !strings.HasPrefix(css, "body{font-family:Arial,sans-serif;") {
+		t.Errorf("Expected the stylesheet to be minified, got %q", css)
+	}
+	if !bytes.Equal(files["content/scripts/main.js"], original) {
+		t.Errorf("Expected the excluded script to be left alone")
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	if resource := parsedManifest.Resources["content/styles/main.css"]; resource.Hash != hasher.HashBytes(files["content/styles/main.css"]) {
+		t.Errorf("Expected the manifest to record the minified stylesheet")
+	}
+
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Optimization: optimizeOptions{Stages: "avif"}}); err == nil {
+		t.Error("Expected AVIF renditions to be refused")
+	}
+}
+
+func TestBuildWritesAttestation(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	keyFile := filepath.Join(testDir, "test-key.pem")
+	source, _, err := attestation.HashTree(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "attested.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, KeyFile: keyFile, AssetPolicy: "off", Attest: attestationOptions{Enabled: true}}); err != nil {
+		t.Fatalf("runBuilder() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile + attestation.Extension)
+	if err != nil {
+		t.Fatalf("Expected an attestation next to the package: %v", err)
+	}
+	envelopes, err := attestation.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := integrity.NewSignatureManager().LoadPrivateKeyPEM(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, err := attestation.Verify(envelopes[0], []crypto.PublicKey{privateKey.Public()})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	pkg, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := statement.CheckSubject(pkg); err != nil {
+		t.Errorf("Expected the attestation to cover the package: %v", err)
+	}
+	if dependency := statement.Dependency("source"); dependency == nil || dependency.Digest["sha256"] != source {
+		t.Errorf("Expected the source tree as it was before the build, got %+v", dependency)
+	}
+	steps, _ := statement.Predicate.BuildDefinition.InternalParameters["steps"].([]interface{})
+	if len(steps) == 0 || steps[0] != "Scanning source files" || steps[len(steps)-1] != "Writing package" {
+		t.Errorf("Unexpected steps %v", steps)
+	}
+	if metadata := statement.Predicate.RunDetails.Metadata; metadata == nil || !metadata.StartedOn.Equal(buildTime(true)) {
+		t.Errorf("Expected reproducible builds to record the fixed build time")
+	}
+
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Attest: attestationOptions{Enabled: true}}); err == nil {
+		t.Error("Expected an attestation without a key to be refused")
+	}
+}
+
+func TestBuildWithProjectFile(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	os.MkdirAll(filepath.Join(testDir, "drafts"), 0755)
+	os.WriteFile(filepath.Join(testDir, "drafts", "notes.html"), []byte("<p>unfinished</p>"), 0644)
+	projectYAML := "metadata:\n  title: Annual Report\nfeatures:\n  audio: true\nexclude: [drafts]\nbuild:\n  compress: false\n  asset_policy: strict\n"
+	if err := os.WriteFile(filepath.Join(testDir, "liv.yaml"), []byte(projectYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	proj, err := loadProject(testDir, "")
+	if err != nil || proj == nil {
+		t.Fatalf("Expected the project file to be found: %v", err)
+	}
+
+	// Flags set on the command line win over the file
+	var compress bool
+	var assetPolicy string
+	cmd := &cobra.Command{}
+	cmd.Flags().BoolVar(&compress, "compress", true, "")
+	cmd.Flags().StringVar(&assetPolicy, "asset-policy", "warn", "")
+	cmd.Flags().Set("asset-policy", "off")
+	if err := applyProject(cmd, proj, &optimizeOptions{}); err != nil {
+		t.Fatalf("applyProject() failed: %v", err)
+	}
+	if compress || assetPolicy != "off" {
+		t.Errorf("Expected compress from the file and the asset policy from the flag, got %v and %s", compress, assetPolicy)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "project.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: compress, Reproducible: true, AssetPolicy: assetPolicy, Project: proj}); err != nil {
+		t.Fatalf("runBuilder() failed: %v", err)
+	}
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract package: %v", err)
+	}
+	if files["drafts/notes.html"] != nil || files["liv.yaml"] != nil {
+		t.Errorf("Expected excluded paths and the project file to be left out of the package")
+	}
+	if files["content/index.html"] == nil {
+		t.Errorf("Expected the content to be packaged")
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if parsedManifest.Metadata.Title != "Annual Report" || !parsedManifest.Features.Audio {
+		t.Errorf("Expected the metadata and features of the project file, got %q %+v", parsedManifest.Metadata.Title, parsedManifest.Features)
+	}
+	if parsedManifest.Resources["drafts/notes.html"] != nil || parsedManifest.Resources["liv.yaml"] != nil {
+		t.Errorf("Expected the manifest not to list left out files")
+	}
+}
+
+func TestBuildWritesVerificationDescriptor(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	keyFile := filepath.Join(testDir, "test-key.pem")
+
+	outputFile := filepath.Join(t.TempDir(), "verifiable.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, Sign: true, KeyFile: keyFile, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("runBuilder() failed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	descriptor, problems, err := verification.Verify(files)
+	if err != nil {
+		t.Fatalf("Expected a verification descriptor in the package: %v", err)
+	}
+	if len(problems) != 0 || len(descriptor.Files) != len(files)-1 {
+		t.Errorf("Expected the descriptor to cover every other file: %v", problems)
+	}
+	privateKey, err := integrity.NewSignatureManager().LoadPrivateKeyPEM(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descriptor.Signatures) != 1 || descriptor.Signatures[0].KeyID != integrity.NewSignatureManager().KeyID(privateKey.Public()) {
+		t.Errorf("Expected the descriptor to be signed with the build key, got %+v", descriptor.Signatures)
+	}
+}
+
+func TestBuildAppliesTheme(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	if err := os.WriteFile(filepath.Join(testDir, "liv.yaml"), []byte("theme: corporate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	proj, err := loadProject(testDir, "")
+	if err != nil {
+		t.Fatalf("Expected the project file to load: %v", err)
+	}
+	var theme string
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(&theme, "theme", "", "")
+	if err := applyProject(cmd, proj, &optimizeOptions{}); err != nil || theme != "corporate" {
+		t.Fatalf("Expected the theme of the project file, got %q: %v", theme, err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "themed.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Theme: theme, Project: proj}); err != nil {
+		t.Fatalf("runBuilder() failed: %v", err)
+	}
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	page := string(files["content/index.html"])
+	if !strings.Contains(page, `class="theme-band"`) || !strings.Contains(page, "This is a test document for builder testing.") || !strings.Contains(page, `href="../assets/themes/corporate/styles/theme.css"`) {
+		t.Errorf("Expected the page wrapped in the theme layout, got:\n%s", page)
+	}
+	if files["assets/themes/corporate/styles/theme.css"] == nil {
+		t.Errorf("Expected the theme stylesheet in the package")
+	}
+
+	// The manifest follows the themed page, so the package verifies
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	for _, path := range []string{"content/index.html", "assets/themes/corporate/styles/theme.css"} {
+		if resource := parsedManifest.Resources[path]; resource == nil || resource.Hash != hasher.HashBytes(files[path]) {
+			t.Errorf("Expected the manifest to list %s with its themed hash", path)
+		}
+	}
+
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off", Theme: "no-such-theme"}); err == nil {
+		t.Errorf("Expected an unknown theme to be refused")
+	}
+}
+
+func TestBuildValidatesInteractiveSpec(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	specPath := filepath.Join(testDir, "content", "interactive.json")
+	outputFile := filepath.Join(t.TempDir(), "interactive.liv")
+	build := func() error {
+		return runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off"})
+	}
+
+	os.WriteFile(specPath, []byte(`{"animations": [{"id": "intro", "target": "h1", "duration": "1s", "keyframes": []}], "charts": [{"id": "c", "type": "bar", "target": "#c", "data": "sales"}]}`), 0644)
+	err := build()
+	if err == nil || !strings.Contains(err.Error(), "Validating content") || !strings.Contains(err.Error(), "content/interactive.json is invalid") {
+		t.Fatalf("Expected the malformed spec to fail the build, got %v", err)
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Errorf("Expected no package to be written")
+	}
+
+	os.MkdirAll(filepath.Join(testDir, "assets", "data"), 0755)
+	os.WriteFile(filepath.Join(testDir, "assets", "data", "sales.csv"), []byte("quarter,total\nQ1,10\n"), 0644)
+	os.WriteFile(specPath, []byte(`{"animations": [{"id": "intro", "target": "h1", "keyframes": [{"offset": 0, "styles": {"opacity": "0"}}, {"offset": 1, "styles": {"opacity": "1"}}]}],
+		"triggers": [{"on": "load", "animation": "intro"}],
+		"data": [{"id": "sales", "src": "assets/data/sales.csv"}],
+		"charts": [{"id": "c", "type": "bar", "target": "#c", "data": "sales", "x": "quarter", "y": "total"}]}`), 0644)
+	if err := build(); err != nil {
+		t.Fatalf("Expected a valid spec to build: %v", err)
+	}
+}
+
+func TestBuildRendersChartSnapshots(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	os.MkdirAll(filepath.Join(testDir, "content", "static"), 0755)
+	os.WriteFile(filepath.Join(testDir, "content", "static", "fallback.html"), []byte(`<html><body><h1>Report</h1><div id="sales"></div></body></html>`), 0644)
+	os.WriteFile(filepath.Join(testDir, "content", "interactive.json"), []byte(`{
+		"data": [{"id": "sales", "values": [{"quarter": "Q1", "total": 10}, {"quarter": "Q2", "total": 14}]}],
+		"charts": [
+			{"id": "sales", "type": "bar", "target": "#sales", "data": "sales", "x": "quarter", "y": "total", "title": "Sales"},
+			{"id": "trend", "type": "line", "target": "#trend", "data": "sales", "x": "quarter", "y": "total"}
+		]}`), 0644)
+
+	outputFile := filepath.Join(t.TempDir(), "charts.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("runBuilder() failed: %v", err)
+	}
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	for _, path := range []string{"assets/charts/sales.svg", "assets/charts/trend.svg"} {
+		if !strings.HasPrefix(string(files[path]), "<svg") {
+			t.Errorf("Expected a snapshot at %s", path)
+		}
+	}
+
+	// The targeted chart is placed in its element, the other at the end
+	page := string(files["content/static/fallback.html"])
+	if !strings.Contains(page, `<div id="sales"><img src="../../assets/charts/sales.svg" alt="Sales"></div>`) ||
+		!strings.Contains(page, `<figure class="liv-chart"><img src="../../assets/charts/trend.svg" alt="Chart trend"><figcaption>Chart trend</figcaption></figure>`+"\n</body>") {
+		t.Errorf("Expected the snapshots in the fallback page, got:\n%s", page)
+	}
+
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	for _, path := range []string{"assets/charts/sales.svg", "content/static/fallback.html"} {
+		if resource := parsedManifest.Resources[path]; resource == nil || resource.Hash != hasher.HashBytes(files[path]) {
+			t.Errorf("Expected the manifest to list %s with its hash", path)
+		}
+	}
+}
+
+func TestBuildValidatesDataFiles(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	dataPath := filepath.Join(testDir, "assets", "data", "sales.csv")
+	os.MkdirAll(filepath.Dir(dataPath), 0755)
+	sales := []byte("region,units\nNorth,12\nSouth,3\n")
+	if err := os.WriteFile(dataPath, sales, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	custom := manifest.NewManifestBuilder()
+	custom.CreateDefaultMetadata("Sales", "Test Author").CreateDefaultSecurityPolicy()
+	page, err := os.ReadFile(filepath.Join(testDir, "content", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom.AddResource("content/index.html", &core.Resource{
+		Hash: integrity.NewResourceHasher(integrity.SHA256).HashBytes(page),
+		Size: int64(len(page)),
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	custom.AddResource("assets/data/sales.csv", &core.Resource{
+		Hash: integrity.NewResourceHasher(integrity.SHA256).HashBytes(sales),
+		Size: int64(len(sales)),
+		Type: "text/csv",
+		Path: "assets/data/sales.csv",
+	})
+	custom.SetData(map[string]*core.DataAsset{"sales": {Path: "assets/data/sales.csv", Schema: &core.DataSchema{Fields: []*core.DataField{
+		{Name: "region", Type: "string", Required: true},
+		{Name: "units", Type: "integer"},
+	}}}})
+	manifestFile := filepath.Join(t.TempDir(), "custom.json")
+	if err := custom.SaveToFile(manifestFile); err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "sales.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, ManifestFile: manifestFile, Compress: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if asset := parsedManifest.Data["sales"]; asset == nil || asset.Path != "assets/data/sales.csv" || len(asset.Schema.Fields) != 2 {
+		t.Errorf("Expected the data declaration in the manifest, got %+v", parsedManifest.Data)
+	}
+
+	// Rows that do not follow the schema fail the build
+	if err := os.WriteFile(dataPath, []byte("region,units\nNorth,12.5\n,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, ManifestFile: manifestFile, Compress: true, Reproducible: true, AssetPolicy: "off"})
+	if err == nil || !strings.Contains(err.Error(), "Validating data files") || !strings.Contains(err.Error(), "2 errors") {
+		t.Errorf("Expected the build to fail on invalid data, got %v", err)
+	}
+}
+
+func TestBuildNormalizesPaths(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+	os.MkdirAll(filepath.Join(testDir, "assets", "images"), 0755)
+	if err := os.WriteFile(filepath.Join(testDir, "assets", "images", "Logo.PNG"), []byte("logo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A name with backslashes, as archives made on Windows may extract
+	if err := os.WriteFile(filepath.Join(testDir, `assets\images\icon.png`), []byte("icon"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	page := `<!DOCTYPE html><html><head><title>Paths</title></head><body><img src="../assets/images/Logo.PNG"></body></html>`
+	if err := os.WriteFile(filepath.Join(testDir, "content", "index.html"), []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A reference relative to the page, next to text that only contains a
+	// renamed path
+	os.MkdirAll(filepath.Join(testDir, "content", "gallery"), 0755)
+	if err := os.WriteFile(filepath.Join(testDir, "content", "gallery", "Photo.JPG"), []byte("photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gallery := `<!DOCTYPE html><html><head><title>Gallery</title></head><body><img src="Photo.JPG" alt="myPhoto.JPG"></body></html>`
+	if err := os.WriteFile(filepath.Join(testDir, "content", "gallery", "page.html"), []byte(gallery), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Hidden directories are not staged
+	os.MkdirAll(filepath.Join(testDir, ".git", "objects"), 0755)
+	if err := os.WriteFile(filepath.Join(testDir, ".git", "objects", "ab12"), []byte("object"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := snapshotSources(testDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "paths.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	for _, path := range []string{"assets/images/Logo.png", "assets/images/icon.png"} {
+		if _, exists := files[path]; !exists {
+			t.Errorf("Expected %s in the package", path)
+		}
+	}
+	if !strings.Contains(string(files["content/index.html"]), "../assets/images/Logo.png") {
+		t.Errorf("Expected the reference to the renamed file to be rewritten, got %s", files["content/index.html"])
+	}
+	if page := string(files["content/gallery/page.html"]); !strings.Contains(page, `src="Photo.jpg"`) || !strings.Contains(page, `alt="myPhoto.JPG"`) {
+		t.Errorf("Expected only the relative reference to be rewritten, got %s", page)
+	}
+	if _, exists := files[".git/objects/ab12"]; exists {
+		t.Error("Expected the hidden directory to be left out")
+	}
+
+	// The sources are built from a copy and left as they were
+	for _, source := range []string{"assets/images/Logo.PNG", `assets\images\icon.png`, "content/gallery/Photo.JPG"} {
+		if !fileExists(filepath.Join(testDir, filepath.FromSlash(source))) {
+			t.Errorf("Expected source %s kept", source)
+		}
+	}
+	after, err := snapshotSources(testDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, state := range before {
+		if after[path] != state {
+			t.Errorf("Expected source %s unchanged", path)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(testDir, "content", "index.html")); string(data) != page {
+		t.Errorf("Expected the source page unchanged, got %s", data)
+	}
+
+	if err := os.WriteFile(filepath.Join(testDir, "assets", "images", "logo.png"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, Reproducible: true, AssetPolicy: "off"})
+	if err == nil || !strings.Contains(err.Error(), "differ only in case") {
+		t.Errorf("Expected files differing only in case to fail the build, got %v", err)
+	}
+}
+
+func TestBuildAnchorsSections(t *testing.T) {
+	testDir := setupBuilderTestDir(t)
+	defer os.RemoveAll(testDir)
+
+	outputFile := filepath.Join(t.TempDir(), "anchored.liv")
+	if err := runBuilder(buildOptions{InputDir: testDir, OutputFile: outputFile, Compress: true, AssetPolicy: "off"}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to extract document: %v", err)
+	}
+	page := files["content/index.html"]
+	if !strings.Contains(string(page), `<h1 id="builder-test-document">`) {
+		t.Errorf("Expected the heading anchored, got %s", page)
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if resource := parsedManifest.Resources["content/index.html"]; resource == nil || resource.Hash != integrity.NewResourceHasher(integrity.SHA256).HashBytes(page) {
+		t.Errorf("Manifest hash does not match the anchored page: %+v", resource)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/charts"
+	"github.com/liv-format/liv/pkg/interactive"
+)
+
+// fallbackEntry is the static page shown without scripts and exported to PDF
+const fallbackEntry = "content/static/fallback.html"
+
+// renderChartSnapshots renders the charts of the interactive spec as SVG
+// snapshots under assets/charts/ and places them in the static fallback, in
+// the element each chart targets or, failing that, at the end of the page.
+// Charts that cannot be rendered are reported and left to the document's
+// scripts.
+func renderChartSnapshots(pkg *builtPackage, verbose bool) error {
+	data, exists := pkg.files[interactive.SpecPath]
+	if !exists {
+		return nil
+	}
+	spec, result := interactive.Parse(data, nil)
+	if !result.IsValid {
+		return fmt.Errorf("invalid %s: %s", interactive.SpecPath, strings.Join(result.Errors, "; "))
+	}
+	if len(spec.Charts) == 0 {
+		return nil
+	}
+
+	snapshots, errs := charts.Render(spec, func(entry string) ([]byte, error) {
+		if data, exists := pkg.files[entry]; exists {
+			return data, nil
+		}
+		return nil, fmt.Errorf("entry not found: %s", entry)
+	})
+	for _, err := range errs {
+		fmt.Printf("  ⚠ No snapshot of %v\n", err)
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	for _, snapshot := range snapshots {
+		pkg.setResource(snapshot.Path, snapshot.SVG, "image/svg+xml")
+		if verbose {
+			fmt.Printf("    Rendered %s chart %s: %s\n", snapshot.Chart.Type, snapshot.Chart.ID, snapshot.Path)
+		}
+	}
+
+	if page, exists := pkg.files[fallbackEntry]; exists {
+		pkg.setResource(fallbackEntry, embedSnapshots(page, fallbackEntry, snapshots), "text/html")
+		if verbose {
+			fmt.Printf("  Placed %d chart snapshots in %s\n", len(snapshots), fallbackEntry)
+		}
+	}
+	return nil
+}
+
+// embedSnapshots places an image of each snapshot in the element of the page
+// its chart targets. Snapshots without a place are added as figures at the
+// end of the page's body.
+func embedSnapshots(page []byte, entry string, snapshots []*charts.Snapshot) []byte {
+	root := strings.Repeat("../", strings.Count(entry, "/"))
+	var figures strings.Builder
+	for _, snapshot := range snapshots {
+		alt := snapshot.Chart.Title
+		if alt == "" {
+			alt = "Chart " + snapshot.Chart.ID
+		}
+		img := fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(root+snapshot.Path), html.EscapeString(alt))
+		var placed bool
+		if page, placed = charts.Embed(page, snapshot.Chart.Target, img); !placed {
+			fmt.Fprintf(&figures, "<figure class=\"liv-chart\">%s<figcaption>%s</figcaption></figure>\n", img, html.EscapeString(alt))
+		}
+	}
+	if figures.Len() == 0 {
+		return page
+	}
+	lower := strings.ToLower(string(page))
+	if end := strings.LastIndex(lower, "</body>"); end >= 0 {
+		return []byte(string(page[:end]) + figures.String() + string(page[end:]))
+	}
+	return append(page, figures.String()...)
+}
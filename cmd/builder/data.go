@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/datasets"
+)
+
+// maxDataErrors is how many data problems a build prints
+const maxDataErrors = 20
+
+// validateDataFiles checks the data files the generated manifest declares
+// against their schemas, printing each row that does not follow its schema.
+// Documents without data pass.
+func validateDataFiles(inputDir string, verbose bool) error {
+	data, err := os.ReadFile(filepath.Join(inputDir, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %v", err)
+	}
+	var m core.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	if len(m.Data) == 0 {
+		return nil
+	}
+
+	errs := datasets.Validate(&m, func(entry string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(inputDir, filepath.FromSlash(entry)))
+	})
+	for i, err := range errs {
+		if i == maxDataErrors {
+			fmt.Printf("  ✗ and %d more\n", len(errs)-i)
+			break
+		}
+		fmt.Printf("  ✗ %s\n", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("data files do not follow their schemas (%d errors)", len(errs))
+	}
+
+	if verbose {
+		for name, asset := range m.Data {
+			fmt.Printf("  Data %s: %s, %d fields\n", name, asset.Path, len(asset.Schema.Fields))
+		}
+	}
+	return nil
+}
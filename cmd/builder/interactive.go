@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/liv-format/liv/pkg/interactive"
+)
+
+// validateInteractiveSpec checks content/interactive.json against the
+// interactive spec schema and the files it refers to, printing each problem
+// with the path of the offending value. Documents without a spec pass.
+func validateInteractiveSpec(inputDir string, verbose bool) error {
+	data, err := os.ReadFile(filepath.Join(inputDir, filepath.FromSlash(interactive.SpecPath)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", interactive.SpecPath, err)
+	}
+
+	exists := func(p string) bool {
+		return fileExists(filepath.Join(inputDir, filepath.FromSlash(p)))
+	}
+	spec, result := interactive.Parse(data, exists)
+	for _, err := range result.Errors {
+		fmt.Printf("  ✗ %s: %s\n", interactive.SpecPath, err)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Printf("  ⚠ %s: %s\n", interactive.SpecPath, warning)
+	}
+	if !result.IsValid {
+		return fmt.Errorf("%s is invalid (%d errors)", interactive.SpecPath, len(result.Errors))
+	}
+
+	if verbose {
+		fmt.Printf("  Interactive spec: %d animations, %d triggers, %d data sources, %d bindings, %d charts\n",
+			len(spec.Animations), len(spec.Triggers), len(spec.Data), len(spec.Bindings), len(spec.Charts))
+	}
+	return nil
+}
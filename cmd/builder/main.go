@@ -1,28 +1,41 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"image"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/compliance"
 	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/encryption"
 	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/interactive"
+	"github.com/liv-format/liv/pkg/log"
 	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/ogimage"
+	"github.com/liv-format/liv/pkg/optimize"
+	"github.com/liv-format/liv/pkg/printstyle"
+	"github.com/liv-format/liv/pkg/project"
+	"github.com/liv-format/liv/pkg/templates"
+	"github.com/liv-format/liv/pkg/variants"
 )
 
 func main() {
 	var (
-		inputDir     string
-		outputFile   string
-		manifestFile string
-		compress     bool
-		sign         bool
-		keyFile      string
-		verbose      bool
+		opts        buildOptions
+		backup      bool
+		watch       bool
+		interval    time.Duration
+		logging     log.Config
+		projectFile string
 	)
 
 	rootCmd := &cobra.Command{
@@ -31,17 +44,82 @@ func main() {
 		Long: `LIV Builder creates Live Interactive Visual documents from source files.
 It packages content, assets, and metadata into a secure, portable .liv file.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runBuilder(inputDir, outputFile, manifestFile, compress, sign, keyFile, verbose)
+			if opts.Verbose && !cmd.Flags().Changed("log-level") {
+				logging.Level = "debug"
+			}
+			logger, err := log.Setup(logging)
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+			
+			opts.Project, err = loadProject(opts.InputDir, projectFile)
+			if err != nil {
+				return err
+			}
+			if opts.Project != nil {
+				if err := applyProject(cmd, opts.Project, &opts.Optimization); err != nil {
+					return err
+				}
+			}
+			
+			// The build steps rewrite the package one after another, so
+			// the document being replaced is kept before the first
+			if backup {
+				if err := atomicfile.Backup(opts.OutputFile); err != nil {
+					return fmt.Errorf("failed to back up %s: %v", opts.OutputFile, err)
+				}
+			}
+			
+			err = runBuilder(opts)
+			if !watch {
+				return err
+			}
+			if err != nil {
+				log.Error("Build failed", "error", err)
+			}
+			stage := newSourceStage(opts.InputDir)
+			defer stage.remove()
+			opts.Verbose = false
+			steps := buildSteps(stage, opts)
+			return watchBuild(opts.InputDir, opts.OutputFile, interval, func() error {
+				return rebuild(steps)
+			})
 		},
 	}
 
-	rootCmd.Flags().StringVarP(&inputDir, "input", "i", "", "Input directory containing source files (required)")
-	rootCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output LIV file path (required)")
-	rootCmd.Flags().StringVarP(&manifestFile, "manifest", "m", "", "Custom manifest file (optional)")
-	rootCmd.Flags().BoolVarP(&compress, "compress", "c", true, "Compress assets")
-	rootCmd.Flags().BoolVarP(&sign, "sign", "s", false, "Sign the document")
-	rootCmd.Flags().StringVarP(&keyFile, "key", "k", "", "Private key file for signing")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	rootCmd.Flags().StringVarP(&opts.InputDir, "input", "i", "", "Input directory containing source files (required)")
+	rootCmd.Flags().StringVarP(&opts.OutputFile, "output", "o", "", "Output LIV file path (required)")
+	rootCmd.Flags().StringVarP(&opts.ManifestFile, "manifest", "m", "", "Custom manifest file (optional)")
+	rootCmd.Flags().BoolVarP(&opts.Compress, "compress", "c", true, "Compress assets")
+	rootCmd.Flags().BoolVar(&opts.ImageVariants, "image-variants", true, "Generate narrower variants of PNG and JPEG images for small screens and slow connections")
+	rootCmd.Flags().BoolVar(&opts.Reproducible, "reproducible", true, "Record fixed timestamps (SOURCE_DATE_EPOCH if set) and a fixed entry order, so builds of the same sources are identical")
+	rootCmd.Flags().BoolVar(&backup, "backup", false, "Keep the document the build replaces as <output>.bak")
+	rootCmd.Flags().BoolVarP(&opts.Sign, "sign", "s", false, "Sign the document")
+	rootCmd.Flags().StringVarP(&opts.KeyFile, "key", "k", "", "Private key file for signing")
+	rootCmd.Flags().StringVar(&opts.SectionKeys, "section-keys", "", "JSON file mapping confidential section IDs to their keys")
+	rootCmd.Flags().StringVar(&opts.AssetPolicy, "asset-policy", "warn", "Asset license policy: off, warn or strict")
+	rootCmd.Flags().StringVar(&opts.Waiver, "license-waiver", "", "Reason for overriding a failed asset license check (recorded in the manifest)")
+	rootCmd.Flags().BoolVar(&opts.Review.Enabled, "anonymize", false, "Build a double-blind review copy without author metadata, acknowledgments or identifying strings")
+	rootCmd.Flags().StringVar(&opts.Review.PatternsFile, "anonymize-patterns", "", "File of further identifying strings to remove, one regular expression per line")
+	rootCmd.Flags().StringVar(&opts.Review.MappingFile, "mapping", "", "Where to write the sealed identity mapping (default: the output name with .livmap)")
+	rootCmd.Flags().StringVar(&opts.Review.KeyFile, "mapping-key", "", "File holding the passphrase that seals the identity mapping")
+	rootCmd.Flags().StringVar(&opts.Vulnerabilities.FeedFile, "advisories", "", "JSON deny-list of vulnerable JS libraries and WASM modules to check the document against")
+	rootCmd.Flags().StringVar(&opts.Vulnerabilities.Policy, "vulnerability-policy", "strict", "Vulnerability policy when --advisories is given: off, warn or strict")
+	rootCmd.Flags().StringVar(&opts.Optimization.Stages, "optimize", "", "Optimize assets: all, or a comma-separated list of images, webp, minify and fonts")
+	rootCmd.Flags().Lookup("optimize").NoOptDefVal = "all"
+	rootCmd.Flags().IntVar(&opts.Optimization.Quality, "optimize-quality", optimize.DefaultQuality, "JPEG quality images are recompressed to when optimizing")
+	rootCmd.Flags().StringVar(&opts.Optimization.ConfigFile, "build-config", "", "JSON build config opting assets out of optimization")
+	rootCmd.Flags().BoolVar(&opts.Attest.Enabled, "attest", false, "Write a signed in-toto attestation of the build's inputs, steps and environment (requires --key)")
+	rootCmd.Flags().StringVar(&opts.Attest.File, "attestation", "", "Where to write the build attestation (default: the output name with .intoto.jsonl)")
+	rootCmd.Flags().StringVar(&opts.Theme, "theme", "", "Theme applied to the content: a built-in theme, one in ~/.liv/themes or a theme directory")
+	rootCmd.Flags().StringVar(&projectFile, "project", "", "Project file (default: liv.yaml, liv.yml or liv.json in the input directory); flags override its values")
+	rootCmd.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "Verbose output")
+	rootCmd.Flags().BoolVarP(&watch, "watch", "w", false, "Rebuild the document when its source files change")
+	rootCmd.Flags().DurationVar(&interval, "watch-interval", DefaultWatchInterval, "How often to check for changes in watch mode")
+	rootCmd.Flags().StringVar(&logging.Level, "log-level", "info", "Level of warnings and errors logged (debug, info, warn, error); --verbose sets debug")
+	rootCmd.Flags().StringVar(&logging.Format, "log-format", "text", "Log format (text, json)")
+	rootCmd.Flags().StringVar(&logging.Output, "log-output", "stderr", "Comma-separated log sinks: stderr, stdout, syslog, syslog://host:port, syslog+tcp://host:port or a file path")
 
 	rootCmd.MarkFlagRequired("input")
 	rootCmd.MarkFlagRequired("output")
@@ -52,56 +130,99 @@ It packages content, assets, and metadata into a secure, portable .liv file.`,
 	}
 }
 
-func runBuilder(inputDir, outputFile, manifestFile string, compress, sign bool, keyFile string, verbose bool) error {
+// buildOptions are the settings of a build, set from the command line flags
+// and the project file
+type buildOptions struct {
+	InputDir     string
+	OutputFile   string
+	ManifestFile string
+	// Compress and ImageVariants control asset processing
+	Compress      bool
+	ImageVariants bool
+	// Reproducible records fixed timestamps and entry order
+	Reproducible bool
+	// Sign signs the document with the private key in KeyFile
+	Sign    bool
+	KeyFile string
+	// SectionKeys is a JSON file mapping confidential section IDs to keys
+	SectionKeys string
+	// AssetPolicy is the asset license policy, and Waiver the reason
+	// recorded when a failed license check is overridden
+	AssetPolicy     string
+	Waiver          string
+	Review          anonymizeOptions
+	Vulnerabilities vulnerabilityOptions
+	Optimization    optimizeOptions
+	Attest          attestationOptions
+	Theme           string
+	// Project is the loaded project file, if any
+	Project *project.Project
+	Verbose bool
+}
+
+func runBuilder(opts buildOptions) error {
 	fmt.Printf("LIV Document Builder\n")
 	fmt.Printf("====================\n\n")
 	
-	if verbose {
-		fmt.Printf("Input directory: %s\n", inputDir)
-		fmt.Printf("Output file: %s\n", outputFile)
-		fmt.Printf("Manifest file: %s\n", manifestFile)
-		fmt.Printf("Compress assets: %v\n", compress)
-		fmt.Printf("Sign document: %v\n", sign)
-		if keyFile != "" {
-			fmt.Printf("Key file: %s\n", keyFile)
+	if opts.Verbose {
+		fmt.Printf("Input directory: %s\n", opts.InputDir)
+		fmt.Printf("Output file: %s\n", opts.OutputFile)
+		fmt.Printf("Manifest file: %s\n", opts.ManifestFile)
+		fmt.Printf("Compress assets: %v\n", opts.Compress)
+		fmt.Printf("Sign document: %v\n", opts.Sign)
+		if opts.Project != nil {
+			fmt.Printf("Project file: %s\n", opts.Project.File)
+		}
+		if opts.Theme != "" {
+			fmt.Printf("Theme: %s\n", opts.Theme)
+		}
+		if opts.KeyFile != "" {
+			fmt.Printf("Key file: %s\n", opts.KeyFile)
 		}
 		fmt.Println()
 	}
 	
 	// Validate input directory exists
-	if _, err := os.Stat(inputDir); os.IsNotExist(err) {
-		return fmt.Errorf("input directory does not exist: %s", inputDir)
+	if _, err := os.Stat(opts.InputDir); os.IsNotExist(err) {
+		return fmt.Errorf("input directory does not exist: %s", opts.InputDir)
 	}
 	
 	// Validate signing requirements
-	if sign && keyFile == "" {
+	if opts.Sign && opts.KeyFile == "" {
 		return fmt.Errorf("signing requires a key file (--key)")
 	}
 	
-	if sign {
-		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
-			return fmt.Errorf("key file does not exist: %s", keyFile)
-		}
+	if opts.Attest.Enabled && opts.KeyFile == "" {
+		return fmt.Errorf("build attestations require a key file (--key)")
 	}
 	
-	// Build process steps
-	steps := []struct {
-		name string
-		fn   func() error
-	}{
-		{"Scanning source files", func() error { return scanSourceFiles(inputDir, verbose) }},
-		{"Validating content", func() error { return validateContent(inputDir, verbose) }},
-		{"Processing assets", func() error { return processAssets(inputDir, compress, verbose) }},
-		{"Generating manifest", func() error { return generateManifest(inputDir, manifestFile, verbose) }},
-		{"Creating package", func() error { return createPackage(inputDir, outputFile, verbose) }},
+	if opts.Sign || opts.Attest.Enabled {
+		if _, err := os.Stat(opts.KeyFile); os.IsNotExist(err) {
+			return fmt.Errorf("key file does not exist: %s", opts.KeyFile)
+		}
 	}
 	
-	if sign {
-		steps = append(steps, struct {
-			name string
-			fn   func() error
-		}{"Signing document", func() error { return signDocument(outputFile, keyFile, verbose) }})
+	if err := opts.Review.check(); err != nil {
+		return err
+	}
+	if err := opts.Vulnerabilities.check(); err != nil {
+		return err
+	}
+	if err := opts.Optimization.check(); err != nil {
+		return err
+	}
+	if opts.Theme != "" {
+		if _, err := templates.LoadTheme(opts.Theme, ""); err != nil {
+			return err
+		}
 	}
+	if opts.Review.Enabled && opts.Sign {
+		fmt.Printf("⚠ The signature on a review copy can identify its signer\n\n")
+	}
+	
+	stage := newSourceStage(opts.InputDir)
+	defer stage.remove()
+	steps := buildSteps(stage, opts)
 	
 	// Execute build steps
 	for i, step := range steps {
@@ -111,21 +232,135 @@ func runBuilder(inputDir, outputFile, manifestFile string, compress, sign bool,
 			return fmt.Errorf("failed at step '%s': %v", step.name, err)
 		}
 		
-		if verbose {
+		if opts.Verbose {
 			fmt.Printf("  ✓ %s completed\n", step.name)
 		}
 	}
 	
-	fmt.Printf("\n✓ LIV document created successfully: %s\n", outputFile)
+	fmt.Printf("\n✓ LIV document created successfully: %s\n", opts.OutputFile)
 	
 	// Show file info
-	if info, err := os.Stat(outputFile); err == nil {
+	if info, err := os.Stat(opts.OutputFile); err == nil {
 		fmt.Printf("  File size: %d bytes\n", info.Size())
 	}
 	
 	return nil
 }
 
+// buildStep is one stage of a build
+type buildStep struct {
+	name string
+	fn   func() error
+}
+
+// buildSteps returns the stages that turn the sources of stage into
+// opts.OutputFile. After path normalization the sources are read from stage.dir,
+// which may be a normalized copy of the input directory. From packaging on,
+// the steps change the package in memory, and it is written once at the end.
+func buildSteps(stage *sourceStage, opts buildOptions) []buildStep {
+	inputDir := stage.inputDir
+	pkg := &builtPackage{}
+	steps := []buildStep{
+		{"Scanning source files", func() error { return scanSourceFiles(inputDir, opts.Verbose) }},
+		{"Normalizing paths", func() error { return stage.prepare(opts.OutputFile, opts.Verbose) }},
+		{"Validating content", func() error { return validateContent(stage.dir, opts.Verbose) }},
+		{"Processing assets", func() error { return processAssets(stage.dir, opts.Compress, opts.ImageVariants, opts.Verbose) }},
+		{"Generating manifest", func() error { return generateManifest(stage.dir, opts.ManifestFile, opts.Project, opts.Reproducible, opts.Verbose) }},
+		{"Validating data files", func() error { return validateDataFiles(stage.dir, opts.Verbose) }},
+		{"Creating package", func() error { return createPackage(pkg, stage.dir, opts.OutputFile, opts.Project, opts.Verbose) }},
+	}
+	
+	if opts.Theme != "" {
+		steps = append(steps, buildStep{"Applying theme", func() error { return applyTheme(pkg, opts.Theme, opts.Verbose) }})
+	}
+	
+	if fileExists(filepath.Join(inputDir, filepath.FromSlash(interactive.SpecPath))) {
+		steps = append(steps, buildStep{"Rendering chart snapshots", func() error { return renderChartSnapshots(pkg, opts.Verbose) }})
+	}
+	
+	// Anchors are made from heading text, which review copies must not give
+	// away, and restored review copies are the author's pages as they were
+	if !opts.Review.Enabled {
+		steps = append(steps, buildStep{"Anchoring sections", func() error { return anchorSections(pkg, opts.Verbose) }})
+	}
+	
+	if opts.Optimization.Stages != "" {
+		steps = append(steps, buildStep{"Optimizing assets", func() error { return optimizeAssets(pkg, opts.Optimization, opts.Verbose) }})
+	}
+	
+	steps = append(steps,
+		buildStep{"Checking asset licenses", func() error { return checkAssetLicenses(pkg, opts.AssetPolicy, opts.Waiver, opts.Verbose) }},
+		buildStep{"Sealing confidential sections", func() error { return sealConfidentialSections(pkg, opts.SectionKeys, opts.Verbose) }},
+	)
+	
+	if opts.Vulnerabilities.FeedFile != "" {
+		steps = append(steps, buildStep{"Checking for vulnerable components", func() error { return checkVulnerabilities(pkg, opts.Vulnerabilities, opts.Verbose) }})
+	}
+	
+	if opts.Review.Enabled {
+		steps = append(steps, buildStep{"Anonymizing for review", func() error { return anonymizeDocument(pkg, opts.OutputFile, opts.Review, opts.Verbose) }})
+	}
+	
+	steps = append(steps, buildStep{"Generating SBOM", func() error { return generateSBOM(pkg, opts.Reproducible, opts.Verbose) }})
+	
+	if opts.Sign {
+		steps = append(steps, buildStep{"Signing document", func() error { return signDocument(pkg, opts.KeyFile, opts.Reproducible, opts.Verbose) }})
+	}
+	
+	steps = append(steps, buildStep{"Writing verification descriptor", func() error { return writeVerificationDescriptor(pkg, opts.Sign, opts.KeyFile, opts.Verbose) }})
+	
+	steps = append(steps, buildStep{"Writing package", func() error { return pkg.write(opts.OutputFile, opts.Reproducible, opts.Verbose) }})
+	
+	if opts.Attest.Enabled {
+		record := &buildRecord{
+			inputDir:     inputDir,
+			reproducible: opts.Reproducible,
+			parameters: map[string]interface{}{
+				"compress":            opts.Compress,
+				"imageVariants":       opts.ImageVariants,
+				"reproducible":        opts.Reproducible,
+				"sign":                opts.Sign,
+				"sectionKeys":         opts.SectionKeys != "",
+				"assetPolicy":         opts.AssetPolicy,
+				"licenseWaiver":       opts.Waiver,
+				"anonymize":           opts.Review.Enabled,
+				"vulnerabilityPolicy": opts.Vulnerabilities.Policy,
+				"optimize":            opts.Optimization.Stages,
+				"optimizeQuality":     opts.Optimization.Quality,
+				"theme":               opts.Theme,
+			},
+			inputs: map[string]string{
+				"manifest":           opts.ManifestFile,
+				"anonymize-patterns": opts.Review.PatternsFile,
+				"advisories":         opts.Vulnerabilities.FeedFile,
+				"build-config":       opts.Optimization.ConfigFile,
+			},
+		}
+		if opts.Project != nil {
+			record.inputs["project"] = opts.Project.File
+		}
+		steps = attestSteps(steps, record, opts.OutputFile, opts.KeyFile, opts.Attest, opts.Verbose)
+	}
+	
+	return steps
+}
+
+// rebuild runs the build steps again in watch mode. Asset processing is left
+// out because manifest generation hashes the changed files, and the remaining
+// steps only report on their own failure. Variants of images added while
+// watching are generated by the next full build.
+func rebuild(steps []buildStep) error {
+	for _, step := range steps {
+		if step.name == "Processing assets" {
+			continue
+		}
+		if err := step.fn(); err != nil {
+			return fmt.Errorf("failed at step '%s': %v", step.name, err)
+		}
+	}
+	return nil
+}
+
 func scanSourceFiles(inputDir string, verbose bool) error {
 	if verbose {
 		fmt.Printf("  Scanning directory: %s\n", inputDir)
@@ -184,65 +419,100 @@ func validateContent(inputDir string, verbose bool) error {
 		fmt.Printf("  Verifying asset references\n")
 	}
 	
-	return nil
+	return validateInteractiveSpec(inputDir, verbose)
 }
 
-func processAssets(inputDir string, compress bool, verbose bool) error {
+func processAssets(inputDir string, compress, imageVariants bool, verbose bool) error {
 	if verbose {
 		fmt.Printf("  Processing images, fonts, and data files\n")
 		if compress {
 			fmt.Printf("  Compressing assets\n")
 		}
+		if imageVariants {
+			fmt.Printf("  Generating image variants\n")
+		}
 		fmt.Printf("  Calculating integrity hashes\n")
 	}
 	
 	// Initialize hasher for integrity calculation
 	hasher := integrity.NewResourceHasher(integrity.SHA256)
 	
-	var processedCount int
+	sources, err := hashSources(inputDir, hasher)
+	if err != nil {
+		return fmt.Errorf("failed to process assets: %v", err)
+	}
 	
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		if info.IsDir() {
-			return nil
-		}
-		
-		// Skip hidden files and system files
-		if strings.HasPrefix(info.Name(), ".") {
-			return nil
-		}
-		
-		// Calculate hash for integrity verification
-		hash, err := hasher.HashFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to hash file %s: %v", path, err)
-		}
-		
-		processedCount++
-		
+	for _, source := range sources {
 		if verbose {
-			relPath, _ := filepath.Rel(inputDir, path)
-			fmt.Printf("    Processed: %s (hash: %s)\n", relPath, hash[:16]+"...")
+			fmt.Printf("    Processed: %s (hash: %s)\n", source.relPath, source.hash[:16]+"...")
 		}
 		
-		return nil
-	})
-	
-	if err != nil {
-		return fmt.Errorf("failed to process assets: %v", err)
+		if imageVariants {
+			generateImageVariants(source.path, source.relPath, source.info, verbose)
+		}
 	}
 	
 	if verbose {
-		fmt.Printf("  Processed %d assets\n", processedCount)
+		fmt.Printf("  Processed %d assets\n", len(sources))
 	}
 	
 	return nil
 }
 
-func generateManifest(inputDir, manifestFile string, verbose bool) error {
+// generateImageVariants writes narrower copies of a PNG or JPEG image next
+// to it, named photo-960w.png, for viewers on small screens and slow
+// connections. Up to date variants are kept. Images that cannot be scaled
+// are packaged without variants.
+func generateImageVariants(path, relPath string, info os.FileInfo, verbose bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if (ext != ".png" && ext != ".jpg" && ext != ".jpeg") || variants.IsVariant(relPath) || relPath == ogimage.Entry {
+		return
+	}
+	
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Warn("Failed to read image for variants", "file", relPath, "error", err)
+		return
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		log.Warn("No variants generated", "file", relPath, "error", err)
+		return
+	}
+	
+	stale := false
+	for _, width := range variants.DefaultWidths {
+		if width >= config.Width {
+			continue
+		}
+		variantInfo, err := os.Stat(variants.WidthPath(path, width))
+		if err != nil || variantInfo.ModTime().Before(info.ModTime()) {
+			stale = true
+			break
+		}
+	}
+	if !stale {
+		return
+	}
+	
+	renditions, err := variants.Generate(data, variants.DefaultWidths)
+	if err != nil {
+		log.Warn("No variants generated", "file", relPath, "error", err)
+		return
+	}
+	for _, rendition := range renditions {
+		variantPath := variants.WidthPath(path, rendition.Width)
+		if err := os.WriteFile(variantPath, rendition.Data, 0644); err != nil {
+			log.Warn("Failed to write image variant", "file", relPath, "error", err)
+			return
+		}
+		if verbose {
+			fmt.Printf("    Generated variant: %s\n", variants.WidthPath(relPath, rendition.Width))
+		}
+	}
+}
+
+func generateManifest(inputDir, manifestFile string, proj *project.Project, reproducible, verbose bool) error {
 	if verbose {
 		fmt.Printf("  Generating document manifest\n")
 		if manifestFile != "" {
@@ -277,12 +547,34 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 				if existingManifest.WASMConfig != nil {
 					builder.SetWASMConfig(existingManifest.WASMConfig)
 				}
+				if existingManifest.License != nil {
+					builder.SetLicense(existingManifest.License)
+				}
+				if existingManifest.Requirements != nil {
+					builder.SetRequirements(existingManifest.Requirements)
+				}
+				if existingManifest.Print != nil {
+					builder.SetPrintSettings(existingManifest.Print)
+				}
+				if existingManifest.Data != nil {
+					// Data files may have been renamed by path normalization
+					for _, asset := range existingManifest.Data {
+						if asset != nil {
+							asset.Path = manifest.NormalizePath(asset.Path)
+						}
+					}
+					builder.SetData(existingManifest.Data)
+				}
+				if existingManifest.Extensions != nil {
+					builder.SetExtensions(existingManifest.Extensions)
+					builder.SetAccess(existingManifest.Access)
+				}
 				
 				if verbose {
 					fmt.Printf("  Loaded custom manifest: %s\n", manifestFile)
 				}
 			} else if verbose {
-				fmt.Printf("  Warning: Could not load custom manifest, using defaults\n")
+				log.Warn("Could not load custom manifest, using defaults", "file", manifestFile, "error", err)
 			}
 		}
 	}
@@ -302,15 +594,18 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 		metadata = &core.DocumentMetadata{
 			Title:       title,
 			Author:      "LIV Builder",
-			Created:     time.Now(),
-			Modified:    time.Now(),
+			Created:     buildTime(reproducible),
+			Modified:    buildTime(reproducible),
 			Description: "Generated by LIV Builder",
 			Version:     "1.0.0",
 			Language:    "en",
 		}
+		if proj != nil {
+			proj.ApplyMetadata(metadata)
+		}
 	} else {
 		// Update modification time for existing metadata
-		metadata.Modified = time.Now()
+		metadata.Modified = modifiedTime(metadata, reproducible)
 	}
 	
 	builder.SetMetadata(metadata)
@@ -416,6 +711,9 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 		}
 	}
 	
+	if proj != nil {
+		proj.ApplySecurity(securityPolicy)
+	}
 	builder.SetSecurityPolicy(securityPolicy)
 	
 	// Set feature flags based on detected content
@@ -429,6 +727,9 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 		WebGL:         hasInteractiveJS,
 		WebAssembly:   hasWASM,
 	}
+	if proj != nil {
+		proj.ApplyFeatures(features)
+	}
 	builder.SetFeatureFlags(features)
 	
 	// Configure WASM modules if any are found
@@ -458,7 +759,7 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 				Metadata: map[string]string{
 					"path":        relPath,
 					"description": fmt.Sprintf("WASM module: %s", moduleName),
-					"created":     time.Now().Format(time.RFC3339),
+					"created":     buildTime(reproducible).Format(time.RFC3339),
 				},
 			}
 			
@@ -479,51 +780,53 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 		}
 	}
 	
-	// Scan and add resources
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
-			return nil
-		}
-		
-		// Calculate relative path
-		relPath, err := filepath.Rel(inputDir, path)
-		if err != nil {
-			return err
+	// Scan and add resources, reusing the hashes of unchanged files
+	sources, err := hashSources(inputDir, hasher)
+	if err != nil {
+		return fmt.Errorf("failed to scan resources: %v", err)
+	}
+	
+	for _, source := range sources {
+		// The manifest of the previous build is replaced, not packaged as a resource
+		if source.relPath == "manifest.json" {
+			continue
 		}
 		
-		// Normalize path separators
-		relPath = filepath.ToSlash(relPath)
-		
-		// Calculate hash
-		hash, err := hasher.HashFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to hash file %s: %v", path, err)
+		// The project file and the paths it leaves out are not packaged
+		if proj != nil && (isProjectFile(proj, source.info) || !proj.Includes(source.relPath)) {
+			if verbose {
+				fmt.Printf("    Left out: %s\n", source.relPath)
+			}
+			continue
 		}
 		
 		// Determine MIME type
-		mimeType := getMimeType(filepath.Ext(path))
+		mimeType := getMimeType(filepath.Ext(source.path))
 		
 		// Add resource to manifest
-		builder.AddResource(relPath, &core.Resource{
-			Hash: hash,
-			Size: info.Size(),
+		builder.AddResource(source.relPath, &core.Resource{
+			Hash: source.hash,
+			Size: source.info.Size(),
 			Type: mimeType,
-			Path: relPath,
+			Path: source.relPath,
 		})
 		
 		if verbose {
-			fmt.Printf("    Added resource: %s (%s)\n", relPath, mimeType)
+			fmt.Printf("    Added resource: %s (%s)\n", source.relPath, mimeType)
 		}
-		
-		return nil
-	})
+	}
 	
-	if err != nil {
-		return fmt.Errorf("failed to scan resources: %v", err)
+	// Record the variants viewers may load instead of each resource
+	builder.DiscoverVariants()
+	
+	// Render the Open Graph card shown when the document is shared
+	if err := renderPreviewCard(inputDir, builder, hasher, verbose); err != nil {
+		return err
+	}
+	
+	// Write the print stylesheet used when the document is printed or exported
+	if err := generatePrintStylesheet(inputDir, builder, hasher, verbose); err != nil {
+		return err
 	}
 	
 	// Build and validate manifest
@@ -534,7 +837,13 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 	
 	// Save manifest to input directory for packaging
 	manifestPath := filepath.Join(inputDir, "manifest.json")
-	err = builder.SaveToFile(manifestPath)
+	if proj != nil {
+		// SaveToFile adds every file in the directory, including those the
+		// project file leaves out
+		err = saveManifest(builtManifest, manifestPath)
+	} else {
+		err = builder.SaveToFile(manifestPath)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to save manifest: %v", err)
 	}
@@ -547,6 +856,105 @@ func generateManifest(inputDir, manifestFile string, verbose bool) error {
 	return nil
 }
 
+// renderPreviewCard writes the document's Open Graph card into the package and
+// records it in the manifest. The card is rendered on every build so it follows
+// title and author changes; authors pick its thumbnail by naming an image cover.
+func renderPreviewCard(inputDir string, builder *manifest.ManifestBuilder, hasher *integrity.ResourceHasher, verbose bool) error {
+	card, err := ogimage.RenderPackage(builder.GetManifest(), func(entry string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(inputDir, filepath.FromSlash(entry)))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render preview image: %v", err)
+	}
+	
+	cardPath := filepath.Join(inputDir, filepath.FromSlash(ogimage.Entry))
+	if err := os.MkdirAll(filepath.Dir(cardPath), 0755); err != nil {
+		return fmt.Errorf("failed to create preview image directory: %v", err)
+	}
+	if err := atomicfile.WriteFile(cardPath, card, 0644); err != nil {
+		return fmt.Errorf("failed to write preview image: %v", err)
+	}
+	
+	builder.AddResource(ogimage.Entry, &core.Resource{
+		Hash: hasher.HashBytes(card),
+		Size: int64(len(card)),
+		Type: "image/png",
+		Path: ogimage.Entry,
+	})
+	
+	if verbose {
+		fmt.Printf("  Rendered preview image: %s\n", ogimage.Entry)
+	}
+	
+	return nil
+}
+
+// generatePrintStylesheet writes a print stylesheet with page break rules
+// derived from the structure of the document's content, for the page size and
+// margins of its print hints, and records it in the manifest. A print
+// stylesheet the author wrote is used instead.
+func generatePrintStylesheet(inputDir string, builder *manifest.ManifestBuilder, hasher *integrity.ResourceHasher, verbose bool) error {
+	settings := builder.GetManifest().Print
+	if settings == nil {
+		settings = &core.PrintSettings{}
+	}
+	if settings.Stylesheet != "" && settings.Stylesheet != printstyle.Entry {
+		return nil
+	}
+	
+	cssPath := filepath.Join(inputDir, filepath.FromSlash(printstyle.Entry))
+	existing, err := os.ReadFile(cssPath)
+	if err == nil && !printstyle.Generated(existing) {
+		settings.Stylesheet = printstyle.Entry
+		builder.SetPrintSettings(settings)
+		if verbose {
+			fmt.Printf("  Using the author's print stylesheet: %s\n", printstyle.Entry)
+		}
+		return nil
+	}
+	
+	page, err := os.ReadFile(filepath.Join(inputDir, "content", "index.html"))
+	if err != nil {
+		return fmt.Errorf("failed to read content: %v", err)
+	}
+	structure, err := printstyle.Analyze(page)
+	if err != nil {
+		return fmt.Errorf("failed to analyze content for printing: %v", err)
+	}
+	css, err := printstyle.Generate(structure, settings)
+	if err != nil {
+		return fmt.Errorf("invalid print hints: %v", err)
+	}
+	if structure.LooseHeaders > 0 {
+		log.Warn("Tables start with header cells outside <thead>; wrap them in <thead> to repeat them on each printed page", "tables", structure.LooseHeaders)
+	}
+	
+	// An unchanged stylesheet is left alone, so watch mode need not hash it
+	if !bytes.Equal(existing, css) {
+		if err := os.MkdirAll(filepath.Dir(cssPath), 0755); err != nil {
+			return fmt.Errorf("failed to create print stylesheet directory: %v", err)
+		}
+		if err := atomicfile.WriteFile(cssPath, css, 0644); err != nil {
+			return fmt.Errorf("failed to write print stylesheet: %v", err)
+		}
+	}
+	
+	builder.AddResource(printstyle.Entry, &core.Resource{
+		Hash: hasher.HashBytes(css),
+		Size: int64(len(css)),
+		Type: "text/css",
+		Path: printstyle.Entry,
+	})
+	settings.Stylesheet = printstyle.Entry
+	builder.SetPrintSettings(settings)
+	
+	if verbose {
+		fmt.Printf("  Generated print stylesheet: %s (%d tables, %d figures)\n", printstyle.Entry, structure.Tables, structure.Figures)
+	}
+	
+	return nil
+}
+
 // getMimeType returns the MIME type for a file extension
 func getMimeType(ext string) string {
 	ext = strings.ToLower(ext)
@@ -580,51 +988,28 @@ func getMimeType(ext string) string {
 	}
 }
 
-func createPackage(inputDir, outputFile string, verbose bool) error {
+// createPackage reads the sources to package into pkg
+func createPackage(pkg *builtPackage, inputDir, outputFile string, proj *project.Project, verbose bool) error {
 	if verbose {
-		fmt.Printf("  Creating ZIP container\n")
 		fmt.Printf("  Packaging content and assets\n")
-		fmt.Printf("  Writing to: %s\n", outputFile)
 	}
 	
-	// Create ZIP container with compression
-	zipContainer := container.NewZIPContainer().
-		SetCompressionLevel(-1). // Use default compression
-		SetValidateStructure(true)
-	
-	// Create the .liv file from directory
-	err := zipContainer.CreateFromDirectory(inputDir, outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create ZIP package: %v", err)
+	if err := pkg.load(inputDir, outputFile, proj); err != nil {
+		return fmt.Errorf("failed to create package: %v", err)
 	}
 	
 	if verbose {
-		// Get file info for reporting
-		if info, err := os.Stat(outputFile); err == nil {
-			fmt.Printf("  Package created: %d bytes\n", info.Size())
-		}
-		
-		// Get compression statistics
-		fileInfos, err := zipContainer.GetFileInfo(outputFile)
-		if err == nil {
-			var totalOriginal, totalCompressed int64
-			for _, info := range fileInfos {
-				totalOriginal += info.Size
-				totalCompressed += info.CompressedSize
-			}
-			
-			if totalOriginal > 0 {
-				ratio := float64(totalCompressed) / float64(totalOriginal) * 100
-				fmt.Printf("  Compression: %.1f%% (%d → %d bytes)\n", 
-					ratio, totalOriginal, totalCompressed)
-			}
+		var total int64
+		for _, data := range pkg.files {
+			total += int64(len(data))
 		}
+		fmt.Printf("  Packaged %d files (%d bytes)\n", len(pkg.files), total)
 	}
 	
 	return nil
 }
 
-func signDocument(outputFile, keyFile string, verbose bool) error {
+func signDocument(pkg *builtPackage, keyFile string, reproducible, verbose bool) error {
 	if verbose {
 		fmt.Printf("  Loading private key: %s\n", keyFile)
 		fmt.Printf("  Generating content signatures\n")
@@ -640,28 +1025,11 @@ func signDocument(outputFile, keyFile string, verbose bool) error {
 		return fmt.Errorf("failed to load private key: %v", err)
 	}
 	
-	// Load the document from the .liv file
-	zipContainer := container.NewZIPContainer()
-	files, err := zipContainer.ExtractToMemory(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to extract document for signing: %v", err)
-	}
-	
-	// Parse manifest
-	manifestData, exists := files["manifest.json"]
-	if !exists {
-		return fmt.Errorf("manifest.json not found in document")
-	}
-	
-	validator := manifest.NewManifestValidator()
-	parsedManifest, result := validator.ValidateManifestJSON(manifestData)
-	if !result.IsValid {
-		return fmt.Errorf("invalid manifest: %v", result.Errors)
-	}
+	files := pkg.files
 	
 	// Create LIV document structure for signing
 	document := &core.LIVDocument{
-		Manifest: parsedManifest,
+		Manifest: pkg.manifest,
 		Content: &core.DocumentContent{
 			HTML:           string(files["content/index.html"]),
 			CSS:            getFileContent(files, "content/styles/main.css", ""),
@@ -698,7 +1066,7 @@ func signDocument(outputFile, keyFile string, verbose bool) error {
 	document.Signatures = signatures
 	
 	// Update manifest with signature information
-	document.Manifest.Metadata.Modified = time.Now()
+	document.Manifest.Metadata.Modified = modifiedTime(document.Manifest.Metadata, reproducible)
 	
 	// Re-serialize manifest with signatures
 	manifestBuilder := manifest.NewManifestBuilder()
@@ -710,33 +1078,131 @@ func signDocument(outputFile, keyFile string, verbose bool) error {
 	if document.Manifest.Features != nil {
 		manifestBuilder.SetFeatureFlags(document.Manifest.Features)
 	}
+	manifestBuilder.SetEncryption(document.Manifest.Encryption)
+	manifestBuilder.SetDisclosure(document.Manifest.Disclosure)
+	manifestBuilder.SetLicense(document.Manifest.License)
+	manifestBuilder.SetCompliance(document.Manifest.Compliance)
+	manifestBuilder.SetRequirements(document.Manifest.Requirements)
+	manifestBuilder.SetExtensions(document.Manifest.Extensions)
+	manifestBuilder.SetAccess(document.Manifest.Access)
 	
 	// Add resources back
 	for path, resource := range document.Manifest.Resources {
 		manifestBuilder.AddResource(path, resource)
 	}
 	
-	updatedManifestData, err := manifestBuilder.BuildJSON()
+	updatedManifest, err := manifestBuilder.Build()
 	if err != nil {
 		return fmt.Errorf("failed to build updated manifest: %v", err)
 	}
 	
-	// Update files map with new manifest
-	files["manifest.json"] = updatedManifestData
+	// Update the package with the new manifest
+	pkg.manifest = updatedManifest
+	
+	if verbose {
+		fmt.Printf("  Document signed successfully\n")
+	}
+	
+	return nil
+}
+
+func sealConfidentialSections(pkg *builtPackage, sectionKeysFile string, verbose bool) error {
+	sectionKeys := make(map[string]string)
+	if sectionKeysFile != "" {
+		data, err := os.ReadFile(sectionKeysFile)
+		if err != nil {
+			return fmt.Errorf("failed to read section keys: %v", err)
+		}
+		if err := json.Unmarshal(data, &sectionKeys); err != nil {
+			return fmt.Errorf("invalid section keys file: %v", err)
+		}
+	}
+	
+	if err := encryption.RedactSections(pkg.files, pkg.manifest, sectionKeys, 0); err != nil {
+		return err
+	}
+	
+	if pkg.manifest.Disclosure == nil {
+		if verbose {
+			fmt.Printf("  No confidential sections found\n")
+		}
+		return nil
+	}
 	
-	// Create new signed .liv file
-	err = zipContainer.CreateFromFiles(files, outputFile)
+	if verbose {
+		for id, section := range pkg.manifest.Disclosure.Sections {
+			fmt.Printf("    Sealed section: %s -> %s\n", id, section.Path)
+		}
+	}
+	
+	return nil
+}
+
+// checkAssetLicenses inspects fonts and media in the package for license metadata.
+// Under a strict policy the build fails unless a waiver reason is given, in which
+// case the waiver is recorded in the manifest for auditing.
+func checkAssetLicenses(pkg *builtPackage, policyName, waiverReason string, verbose bool) error {
+	policy, err := compliance.ParsePolicy(policyName)
 	if err != nil {
-		return fmt.Errorf("failed to create signed document: %v", err)
+		return err
+	}
+	if policy == compliance.PolicyOff {
+		if verbose {
+			fmt.Printf("  Asset license check disabled\n")
+		}
+		return nil
+	}
+	
+	report := compliance.NewAssetLicenseChecker().Check(pkg.files)
+	for _, finding := range report.Findings {
+		switch finding.Severity {
+		case compliance.SeverityError:
+			fmt.Printf("  ✗ %s: %s\n", finding.Path, finding.Message)
+		case compliance.SeverityWarning:
+			fmt.Printf("  ⚠ %s: %s\n", finding.Path, finding.Message)
+		default:
+			if verbose {
+				fmt.Printf("    %s: %s\n", finding.Path, finding.Message)
+			}
+		}
 	}
 	
 	if verbose {
-		fmt.Printf("  Document signed successfully\n")
+		fmt.Printf("  Checked %d fonts and media files\n", report.AssetsChecked)
+	}
+	
+	blocking := report.Blocking(policy)
+	if len(blocking) == 0 {
+		return nil
 	}
 	
+	if waiverReason == "" {
+		return fmt.Errorf("%d assets failed the license check under the %s policy (use --license-waiver to record an override)", len(blocking), policy)
+	}
+	
+	waiver, err := compliance.NewWaiver(blocking, policy, waiverReason, currentUser())
+	if err != nil {
+		return err
+	}
+	
+	if pkg.manifest.Compliance == nil {
+		pkg.manifest.Compliance = &core.ComplianceInfo{}
+	}
+	pkg.manifest.Compliance.Waivers = append(pkg.manifest.Compliance.Waivers, waiver)
+	
+	fmt.Printf("  ⚠ License waiver recorded for %d assets by %s\n", len(waiver.Assets), waiver.ApprovedBy)
+	
 	return nil
 }
 
+// currentUser returns the name of the user running the build, for audit records
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
 // getFileContent safely gets file content with fallback
 func getFileContent(files map[string][]byte, path, fallback string) string {
 	if content, exists := files[path]; exists {
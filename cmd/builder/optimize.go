@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liv-format/liv/pkg/optimize"
+)
+
+// optimizeOptions configures shrinking the packaged assets
+type optimizeOptions struct {
+	// Stages lists the optimizations, or all; none are made when empty
+	Stages string
+	// Quality is the JPEG quality images are recompressed to
+	Quality int
+	// ConfigFile is a build config opting assets out of optimization
+	ConfigFile string
+	// Assets are the project file's settings, used without a ConfigFile
+	Assets *optimize.AssetConfig
+}
+
+// options resolves the stages and the build config
+func (o optimizeOptions) options() (optimize.Options, error) {
+	stages, err := optimize.ParseStages(o.Stages)
+	if err != nil {
+		return optimize.Options{}, err
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return optimize.Options{}, fmt.Errorf("optimization quality must be between 1 and 100")
+	}
+	opts := optimize.Options{Stages: stages, Quality: o.Quality}
+	if o.ConfigFile != "" {
+		config, err := optimize.LoadConfig(o.ConfigFile)
+		if err != nil {
+			return optimize.Options{}, err
+		}
+		opts.Assets = config.Optimize
+	} else if o.Assets != nil {
+		opts.Assets = *o.Assets
+	}
+	return opts, nil
+}
+
+// check reports invalid stages or an invalid build config before the build
+// starts
+func (o optimizeOptions) check() error {
+	_, err := o.options()
+	return err
+}
+
+// optimizeAssets recompresses images, adds WebP renditions, minifies
+// stylesheets and scripts and subsets fonts in the package. It runs before
+// the license check and sealing, while content is still in the clear.
+func optimizeAssets(pkg *builtPackage, opts optimizeOptions, verbose bool) error {
+	options, err := opts.options()
+	if err != nil {
+		return err
+	}
+
+	report := optimize.Optimize(pkg.files, pkg.manifest, options)
+	if verbose {
+		for _, optimized := range report.Results {
+			if optimized.Added != "" {
+				fmt.Printf("  Added %s (%d bytes, %s %d bytes)\n", optimized.Added, optimized.After, optimized.Path, optimized.Before)
+				continue
+			}
+			fmt.Printf("  %s: %s %d -> %d bytes\n", optimized.Stage, optimized.Path, optimized.Before, optimized.After)
+		}
+		for _, skipped := range report.Skipped {
+			fmt.Printf("  Kept %s as is (%s): %s\n", skipped.Path, skipped.Stage, skipped.Reason)
+		}
+	}
+	if len(report.Results) == 0 {
+		return nil
+	}
+	fmt.Printf("  Applied %d optimizations, saving %d bytes\n", len(report.Results), report.Saved())
+	return nil
+}
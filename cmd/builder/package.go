@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/project"
+)
+
+// builtPackage is the package a build makes. Packaging reads the staged
+// sources into memory, the steps after it change the package there, and it
+// is written to the output once, at the end of the build.
+type builtPackage struct {
+	files map[string][]byte
+	// manifest is the parsed manifest.json, which the steps change in place;
+	// it is encoded again before the package is described or written
+	manifest *core.Manifest
+}
+
+// load reads the files of inputDir into the package. With a project file
+// only the manifest and the resources it lists are packaged. The package
+// being written, its backup and writes a crash left behind are left out.
+func (p *builtPackage) load(inputDir, outputFile string, proj *project.Project) error {
+	var include func(relPath string) bool
+	if proj != nil {
+		var err error
+		if include, err = packagedFiles(inputDir); err != nil {
+			return err
+		}
+	}
+	var outputs []os.FileInfo
+	for _, name := range []string{outputFile, outputFile + atomicfile.BackupSuffix} {
+		if info, err := os.Stat(name); err == nil {
+			outputs = append(outputs, info)
+		}
+	}
+
+	files := make(map[string][]byte)
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || atomicfile.IsTemp(path) {
+			return nil
+		}
+		for _, output := range outputs {
+			if os.SameFile(info, output) {
+				return nil
+			}
+		}
+		relPath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if include != nil && !include(relPath) {
+			return nil
+		}
+		if files[relPath], err = os.ReadFile(path); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read sources: %v", err)
+	}
+
+	data, exists := files["manifest.json"]
+	if !exists {
+		return fmt.Errorf("manifest.json not found in %s", inputDir)
+	}
+	parsedManifest, result := manifest.NewManifestValidator().ValidateManifestJSON(data)
+	if !result.IsValid {
+		return fmt.Errorf("invalid manifest: %v", result.Errors)
+	}
+	p.files, p.manifest = files, parsedManifest
+	return nil
+}
+
+// setResource stores data at path and records its hash and size in the
+// manifest, listing it with mediaType when it is not listed yet
+func (p *builtPackage) setResource(path string, data []byte, mediaType string) {
+	p.files[path] = data
+	resource := p.manifest.Resources[path]
+	if resource == nil {
+		resource = &core.Resource{Type: mediaType, Path: path}
+		p.manifest.Resources[path] = resource
+	}
+	resource.Hash = integrity.NewResourceHasher(integrity.SHA256).HashBytes(data)
+	resource.Size = int64(len(data))
+}
+
+// encodeManifest stores the manifest in the package as manifest.json
+func (p *builtPackage) encodeManifest() error {
+	data, err := json.MarshalIndent(p.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %v", err)
+	}
+	p.files["manifest.json"] = data
+	return nil
+}
+
+// write writes the package to outputFile, replacing it in one step.
+// Reproducible packages record every entry at the build time rather than
+// when the build ran.
+func (p *builtPackage) write(outputFile string, reproducible, verbose bool) error {
+	if err := p.encodeManifest(); err != nil {
+		return err
+	}
+	zipContainer := container.NewZIPContainer().
+		SetCompressionLevel(-1). // Use default compression
+		SetValidateStructure(true)
+	if reproducible {
+		zipContainer.SetModified(buildTime(true))
+	}
+	if err := zipContainer.CreateFromFiles(p.files, outputFile); err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+
+	if verbose {
+		if info, err := os.Stat(outputFile); err == nil {
+			fmt.Printf("  Package written to %s: %d bytes\n", outputFile, info.Size())
+		}
+		if reproducible {
+			fmt.Printf("  Recorded %d entries at %s\n", len(p.files), buildTime(true).Format(time.RFC3339))
+		}
+		if fileInfos, err := zipContainer.GetFileInfo(outputFile); err == nil {
+			var totalOriginal, totalCompressed int64
+			for _, info := range fileInfos {
+				totalOriginal += info.Size
+				totalCompressed += info.CompressedSize
+			}
+			if totalOriginal > 0 {
+				ratio := float64(totalCompressed) / float64(totalOriginal) * 100
+				fmt.Printf("  Compression: %.1f%% (%d → %d bytes)\n", ratio, totalOriginal, totalCompressed)
+			}
+		}
+	}
+	return nil
+}
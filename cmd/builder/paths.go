@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/manifest"
+)
+
+// referencingExtensions are the files whose references to renamed files are
+// rewritten
+var referencingExtensions = map[string]bool{
+	".html": true, ".htm": true, ".css": true, ".js": true, ".json": true, ".svg": true,
+}
+
+// sourceStage is the directory a build reads its sources from: the input
+// directory itself, or a copy of it with normalized paths
+type sourceStage struct {
+	inputDir string
+	dir      string
+}
+
+// newSourceStage reads sources from inputDir until prepare stages a copy
+func newSourceStage(inputDir string) *sourceStage {
+	return &sourceStage{inputDir: inputDir, dir: inputDir}
+}
+
+// prepare checks the paths of the sources and, when any are not normalized,
+// such as names with backslashes from Windows, decomposed Unicode from macOS
+// or uppercase extensions, copies the sources to a temporary directory where
+// they are renamed and the references to them in HTML, CSS, JS, JSON and SVG
+// files rewritten. The input directory is never changed. Files whose paths
+// differ only in case cannot be fixed and fail the build.
+func (s *sourceStage) prepare(outputFile string, verbose bool) error {
+	s.remove()
+
+	paths, err := normalizablePaths(s.inputDir, outputFile)
+	if err != nil {
+		return err
+	}
+	if conflicts := manifest.CaseConflicts(paths); len(conflicts) > 0 {
+		for _, group := range conflicts {
+			fmt.Printf("  ✗ paths differ only in case: %s\n", strings.Join(group, ", "))
+		}
+		return fmt.Errorf("%d groups of files differ only in case", len(conflicts))
+	}
+
+	renamed := make(map[string]string)
+	for _, relPath := range paths {
+		if normalized := manifest.NormalizePath(relPath); normalized != relPath {
+			renamed[relPath] = normalized
+		}
+	}
+	if len(renamed) == 0 {
+		if verbose {
+			fmt.Printf("  All %d paths are normalized\n", len(paths))
+		}
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "liv-build-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	s.dir = dir
+	if err := stageSources(s.inputDir, dir, outputFile, renamed, verbose); err != nil {
+		s.remove()
+		return err
+	}
+	if verbose {
+		fmt.Printf("  Building from a normalized copy in %s\n", dir)
+	}
+	return nil
+}
+
+// remove deletes the staged copy, if any, and reads from the input directory
+// again
+func (s *sourceStage) remove() {
+	if s.dir != s.inputDir {
+		os.RemoveAll(s.dir)
+		s.dir = s.inputDir
+	}
+}
+
+// normalizablePaths lists the paths of the files of inputDir that path
+// normalization applies to. Hidden files and the package being written are
+// left out.
+func normalizablePaths(inputDir, outputFile string) ([]string, error) {
+	outputPath, _ := filepath.Abs(outputFile)
+	var paths []string
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != inputDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == outputPath {
+			return nil
+		}
+		relPath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan source files: %v", err)
+	}
+	return paths, nil
+}
+
+// stageSources copies inputDir to dir, giving the files in renamed their new
+// paths and rewriting the references to them. Hidden entries, the package
+// being written, its backup and unfinished writes are not copied.
+func stageSources(inputDir, dir, outputFile string, renamed map[string]string, verbose bool) error {
+	output, _ := os.Stat(outputFile)
+	backup, _ := os.Stat(outputFile + atomicfile.BackupSuffix)
+	return filepath.Walk(inputDir, func(source string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Hidden files and directories, such as .git, are left out as they
+		// are of the manifest
+		if strings.HasPrefix(info.Name(), ".") && source != inputDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || atomicfile.IsTemp(info.Name()) {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(source); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		}
+		if (output != nil && os.SameFile(info, output)) || (backup != nil && os.SameFile(info, backup)) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(inputDir, source)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		stagedPath := relPath
+		if normalized, ok := renamed[relPath]; ok {
+			stagedPath = normalized
+			fmt.Printf("  Packaging %s as %s\n", relPath, normalized)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(stagedPath))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to stage %s: %v", relPath, err)
+		}
+
+		if referencingExtensions[strings.ToLower(path.Ext(stagedPath))] {
+			data, err := os.ReadFile(source)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %v", relPath, err)
+			}
+			rewritten := rewriteReferences(data, path.Dir(relPath), renamed)
+			if verbose && !bytes.Equal(rewritten, data) {
+				fmt.Printf("  Rewrote references in %s\n", stagedPath)
+			}
+			if err := os.WriteFile(target, rewritten, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("failed to stage %s: %v", relPath, err)
+			}
+		} else if err := copyFile(source, target, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to stage %s: %v", relPath, err)
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// rewriteReferences replaces the references to renamed files in data, a file
+// in dir. A reference is a path relative to dir, or to the package root with
+// or without a leading slash, that stands on its own: quoted, in url(), an
+// attribute value or followed by a query or fragment. Longer references are
+// replaced first, so a path is not rewritten as part of another.
+func rewriteReferences(data []byte, dir string, renamed map[string]string) []byte {
+	references := make(map[string]string)
+	for oldPath, newPath := range renamed {
+		references[oldPath] = newPath
+		references["/"+oldPath] = "/" + newPath
+		if relative, ok := relativeReference(dir, oldPath); ok {
+			newRelative, _ := relativeReference(dir, newPath)
+			references[relative] = newRelative
+			references["./"+relative] = "./" + newRelative
+		}
+	}
+	old := make([]string, 0, len(references))
+	for reference := range references {
+		old = append(old, reference)
+	}
+	sort.Slice(old, func(i, j int) bool {
+		if len(old[i]) != len(old[j]) {
+			return len(old[i]) > len(old[j])
+		}
+		return old[i] < old[j]
+	})
+
+	for _, reference := range old {
+		data = replaceReference(data, reference, references[reference])
+	}
+	return data
+}
+
+// relativeReference returns target as a path relative to dir, reporting false
+// for files in the package root, whose relative and root paths are the same
+func relativeReference(dir, target string) (string, bool) {
+	if dir == "." {
+		return "", false
+	}
+	relative, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(target))
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(relative), true
+}
+
+// replaceReference replaces the occurrences of reference in data that stand
+// on their own
+func replaceReference(data []byte, reference, replacement string) []byte {
+	var out bytes.Buffer
+	rest := data
+	for {
+		i := bytes.Index(rest, []byte(reference))
+		if i < 0 {
+			break
+		}
+		end := i + len(reference)
+		before := len(data) - len(rest) + i - 1
+		if (before < 0 || strings.IndexByte("\"'(=, \t\r\n", data[before]) >= 0) &&
+			(end == len(rest) || strings.IndexByte("\"')?#, \t\r\n", rest[end]) >= 0) {
+			out.Write(rest[:i])
+			out.WriteString(replacement)
+		} else {
+			out.Write(rest[:end])
+		}
+		rest = rest[end:]
+	}
+	if out.Len() == 0 {
+		return data
+	}
+	out.Write(rest)
+	return out.Bytes()
+}
+
+// copyFile copies the file at source to target
+func copyFile(source, target string, perm os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/project"
+	"github.com/spf13/cobra"
+)
+
+// loadProject reads the project file given with --project, or the one in
+// inputDir when none is given. It returns nil when there is none.
+func loadProject(inputDir, file string) (*project.Project, error) {
+	if file == "" {
+		if file = project.Find(inputDir); file == "" {
+			return nil, nil
+		}
+	}
+	return project.Load(file)
+}
+
+// applyProject gives the flags that were not set on the command line the
+// values of the project file, so flags override the file
+func applyProject(cmd *cobra.Command, p *project.Project, optimization *optimizeOptions) error {
+	values := make(map[string]string)
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			values[name] = strconv.FormatBool(*value)
+		}
+	}
+	setString := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+
+	if b := p.Build; b != nil {
+		setBool("compress", b.Compress)
+		setBool("image-variants", b.ImageVariants)
+		setBool("reproducible", b.Reproducible)
+		setBool("attest", b.Attest)
+		setString("asset-policy", b.AssetPolicy)
+		setString("section-keys", p.ResolvePath(b.SectionKeys))
+		setString("advisories", p.ResolvePath(b.Advisories))
+		setString("vulnerability-policy", b.VulnerabilityPolicy)
+	}
+	if s := p.Signing; s != nil {
+		setBool("sign", s.Sign)
+		setString("key", p.ResolvePath(s.Key))
+	}
+	if theme := p.Theme; theme != "" {
+		// A theme is named, or a directory relative to the file
+		if strings.ContainsAny(theme, `/\`) || strings.HasPrefix(theme, ".") {
+			theme = p.ResolvePath(theme)
+		}
+		values["theme"] = theme
+	}
+	if o := p.Optimize; o != nil {
+		setString("optimize", o.Stages.String())
+		if o.Quality != 0 {
+			values["optimize-quality"] = strconv.Itoa(o.Quality)
+		}
+	}
+
+	flags := cmd.Flags()
+	for name, value := range values {
+		if flags.Changed(name) {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s in %s: %v", name, p.File, err)
+		}
+	}
+
+	// A build config given with --build-config replaces the file's settings
+	if p.Optimize != nil && optimization.ConfigFile == "" {
+		assets := p.Optimize.AssetConfig
+		assets.Quality = 0
+		optimization.Assets = &assets
+	}
+	return nil
+}
+
+// isProjectFile reports whether info is the project file
+func isProjectFile(p *project.Project, info os.FileInfo) bool {
+	projectInfo, err := os.Stat(p.File)
+	return err == nil && os.SameFile(info, projectInfo)
+}
+
+// saveManifest writes the manifest as built, listing only the resources
+// added to it
+func saveManifest(m *core.Manifest, manifestPath string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest to JSON: %v", err)
+	}
+	return atomicfile.WriteFile(manifestPath, data, 0644)
+}
+
+// packagedFiles returns a filter packaging the manifest in inputDir and the
+// resources it lists, and nothing else
+func packagedFiles(inputDir string) (func(relPath string) bool, error) {
+	builder := manifest.NewManifestBuilder()
+	if err := builder.LoadFromFile(filepath.Join(inputDir, "manifest.json")); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	resources := builder.GetManifest().Resources
+	return func(relPath string) bool {
+		return relPath == "manifest.json" || resources[relPath] != nil
+	}, nil
+}
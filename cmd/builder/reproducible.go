@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+)
+
+// sourceDateEpoch returns the time set in SOURCE_DATE_EPOCH, the convention
+// reproducible build tools use for the time a build should record
+func sourceDateEpoch() (time.Time, bool) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < container.ReproducibleTime.Unix() {
+		log.Warn("Ignoring invalid SOURCE_DATE_EPOCH", "value", value)
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0).UTC(), true
+}
+
+// buildTime returns the time a build records. Reproducible builds record
+// SOURCE_DATE_EPOCH, or the start of the ZIP epoch when it is unset, so two
+// builds of the same sources match byte for byte.
+func buildTime(reproducible bool) time.Time {
+	if !reproducible {
+		return core.UTC(time.Now())
+	}
+	if epoch, ok := sourceDateEpoch(); ok {
+		return epoch
+	}
+	return container.ReproducibleTime
+}
+
+// modifiedTime returns the modification time to record for a document.
+// Reproducible builds keep the time given in the manifest unless
+// SOURCE_DATE_EPOCH is set, and never record a time before its creation.
+func modifiedTime(metadata *core.DocumentMetadata, reproducible bool) time.Time {
+	if !reproducible {
+		return core.UTC(time.Now())
+	}
+	modified := metadata.Modified
+	if epoch, ok := sourceDateEpoch(); ok {
+		modified = epoch
+	}
+	if modified.Before(metadata.Created) {
+		modified = metadata.Created
+	}
+	return modified
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liv-format/liv/pkg/sbom"
+)
+
+// generateSBOM stores an inventory of the package contents and the toolchain
+// that built it, for auditing the document like a software artifact
+func generateSBOM(pkg *builtPackage, reproducible, verbose bool) error {
+	bom, err := sbom.Generate(pkg.files, pkg.manifest, sbom.Options{
+		Timestamp: buildTime(reproducible),
+		Tools:     sbom.Toolchain(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate SBOM: %v", err)
+	}
+	data, err := sbom.Marshal(bom)
+	if err != nil {
+		return err
+	}
+
+	pkg.setResource(sbom.Entry, data, "application/json")
+
+	if verbose {
+		fmt.Printf("  Listed %d components and %d toolchain modules in %s\n", len(bom.Components), len(bom.Metadata.Tools.Components), sbom.Entry)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+// sourceFile is a file of the input directory and its integrity hash
+type sourceFile struct {
+	path    string
+	relPath string
+	info    os.FileInfo
+	hash    string
+}
+
+// hashSources lists the files of inputDir, skipping hidden files, and hashes
+// them on a pool of GOMAXPROCS workers. Hashes go through fileHashes, so a
+// file is read once per build however many steps need its hash. Files are
+// returned in walk order.
+func hashSources(inputDir string, hasher *integrity.ResourceHasher) ([]*sourceFile, error) {
+	var sources []*sourceFile
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		relPath, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, &sourceFile{path: path, relPath: filepath.ToSlash(relPath), info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make(chan *sourceFile)
+	errs := make(chan error, len(sources))
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for source := range jobs {
+				hash, err := fileHashes.hashFile(hasher, source.path, source.info)
+				if err != nil {
+					errs <- fmt.Errorf("failed to hash file %s: %v", source.path, err)
+					continue
+				}
+				source.hash = hash
+			}
+		}()
+	}
+	for _, source := range sources {
+		jobs <- source
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liv-format/liv/pkg/templates"
+)
+
+// applyTheme adds the theme's stylesheets and fonts to the package and wraps
+// the content pages in its layout. It runs right after packaging, so the
+// author's sources are left alone and later steps optimize, check and sign
+// the themed pages.
+func applyTheme(pkg *builtPackage, theme string, verbose bool) error {
+	t, err := templates.LoadTheme(theme, "")
+	if err != nil {
+		return err
+	}
+
+	pages, err := t.Apply(pkg.files, pkg.manifest)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Printf("  Theme: %s %s\n", t.Descriptor.Title, t.Descriptor.Version)
+		for _, page := range pages {
+			fmt.Printf("    Applied layout: %s\n", page)
+		}
+		fmt.Printf("  Added %d theme assets under %s%s/\n", len(t.Files), templates.ThemePrefix, t.Descriptor.Name)
+	}
+
+	return nil
+}
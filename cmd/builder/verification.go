@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/verification"
+)
+
+// writeVerificationDescriptor stores the hashes of the package files and
+// their root hash in the package, signed with keyFile when sign is set, so
+// tools without the LIV libraries can verify the document
+func writeVerificationDescriptor(pkg *builtPackage, sign bool, keyFile string, verbose bool) error {
+	if err := pkg.encodeManifest(); err != nil {
+		return err
+	}
+	descriptor := verification.Describe(pkg.files)
+	if sign {
+		privateKey, err := integrity.NewSignatureManager().LoadPrivateKeyPEM(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load private key: %v", err)
+		}
+		if err := descriptor.Sign(privateKey); err != nil {
+			return fmt.Errorf("failed to sign verification descriptor: %v", err)
+		}
+	}
+	data, err := verification.Marshal(descriptor)
+	if err != nil {
+		return err
+	}
+	pkg.files[verification.Entry] = data
+
+	if verbose {
+		fmt.Printf("  Root hash: sha256:%s (%d files)\n", descriptor.RootHash, len(descriptor.Files))
+		for _, signature := range descriptor.Signatures {
+			fmt.Printf("  Signed by %s (%s)\n", signature.KeyID, signature.Algorithm)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liv-format/liv/pkg/advisory"
+	"github.com/liv-format/liv/pkg/sbom"
+)
+
+// vulnerabilityOptions configures checking the embedded libraries against a
+// deny-list of vulnerable components
+type vulnerabilityOptions struct {
+	// FeedFile is the advisory feed; no check is made without one
+	FeedFile string
+	// Policy is off, warn or strict (the default)
+	Policy string
+}
+
+// check reports an invalid policy or feed before the build starts
+func (o vulnerabilityOptions) check() error {
+	if _, err := advisory.ParsePolicy(o.Policy); err != nil {
+		return err
+	}
+	if o.FeedFile == "" {
+		return nil
+	}
+	_, err := advisory.LoadFeed(o.FeedFile)
+	return err
+}
+
+// checkVulnerabilities matches the libraries, WASM modules and files of the
+// package against the advisory feed. Under the strict policy a match fails
+// the build before the package is written.
+func checkVulnerabilities(pkg *builtPackage, opts vulnerabilityOptions, verbose bool) error {
+	policy, err := advisory.ParsePolicy(opts.Policy)
+	if err != nil {
+		return err
+	}
+	if policy == advisory.PolicyOff {
+		if verbose {
+			fmt.Printf("  Vulnerability check disabled\n")
+		}
+		return nil
+	}
+	feed, err := advisory.LoadFeed(opts.FeedFile)
+	if err != nil {
+		return err
+	}
+
+	bom, err := sbom.Generate(pkg.files, pkg.manifest, sbom.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to inventory document: %v", err)
+	}
+
+	report := advisory.Check(bom, feed)
+	for _, finding := range report.Findings {
+		fmt.Printf("  %s %s: %s\n", findingMark(policy), describeFinding(finding), finding.Advisory.Summary)
+	}
+	if verbose {
+		fmt.Printf("  Checked %d components against %d advisories\n", report.ComponentsChecked, len(feed.Advisories))
+	}
+
+	blocking := report.Blocking(policy)
+	if len(blocking) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d components match advisories under the %s vulnerability policy", len(blocking), policy)
+}
+
+// findingMark marks findings that fail the build
+func findingMark(policy advisory.Policy) string {
+	if policy == advisory.PolicyStrict {
+		return "✗"
+	}
+	return "⚠"
+}
+
+// describeFinding names the component and advisory of a finding
+func describeFinding(finding *advisory.Finding) string {
+	component := finding.Path
+	if finding.Name != finding.Path {
+		component = fmt.Sprintf("%s (%s %s)", finding.Path, finding.Name, finding.Version)
+	}
+	return fmt.Sprintf("%s [%s, %s]", component, finding.Advisory.ID, finding.Advisory.Severity)
+}
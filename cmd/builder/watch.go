@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/ogimage"
+	"github.com/liv-format/liv/pkg/printstyle"
+)
+
+// DefaultWatchInterval is how often watch mode polls the input directory
+const DefaultWatchInterval = 250 * time.Millisecond
+
+// fileState identifies a version of a source file without reading it
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// hashCache remembers file hashes by path, size and modification time so
+// that files are only hashed again after they change. Asset processing and
+// manifest generation share it, and watch mode keeps it between rebuilds.
+type hashCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedHash
+	misses  int
+}
+
+type cachedHash struct {
+	state fileState
+	hash  string
+}
+
+// fileHashes is shared by the build steps of this process
+var fileHashes = &hashCache{entries: make(map[string]cachedHash)}
+
+// hashFile returns the hash of a file, reading it only if it changed since it
+// was last hashed
+func (c *hashCache) hashFile(hasher *integrity.ResourceHasher, path string, info os.FileInfo) (string, error) {
+	state := fileState{size: info.Size(), modTime: info.ModTime()}
+
+	c.mu.Lock()
+	entry, found := c.entries[path]
+	c.mu.Unlock()
+	if found && entry.state == state {
+		return entry.hash, nil
+	}
+
+	hash, err := hasher.HashFile(path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[path] = cachedHash{state: state, hash: hash}
+	c.misses++
+	c.mu.Unlock()
+	return hash, nil
+}
+
+// rehashed returns how many files were hashed since the last call
+func (c *hashCache) rehashed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.misses
+	c.misses = 0
+	return n
+}
+
+// forget drops files that no longer exist
+func (c *hashCache) forget(present map[string]fileState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path := range c.entries {
+		if _, exists := present[path]; !exists {
+			delete(c.entries, path)
+		}
+	}
+}
+
+// snapshotSources records the state of every source file under inputDir.
+// Files the build writes into the input directory, and the output itself, are
+// left out so that a rebuild does not trigger another.
+func snapshotSources(inputDir, outputFile string) (map[string]fileState, error) {
+	generated := map[string]bool{
+		filepath.Join(inputDir, "manifest.json"):                   true,
+		filepath.Join(inputDir, filepath.FromSlash(ogimage.Entry)): true,
+	}
+	if abs, err := filepath.Abs(outputFile); err == nil {
+		generated[abs] = true
+	}
+	// The print stylesheet is a source only when its author wrote it
+	printStylesheet := filepath.Join(inputDir, filepath.FromSlash(printstyle.Entry))
+	if css, err := os.ReadFile(printStylesheet); err == nil && printstyle.Generated(css) {
+		generated[printStylesheet] = true
+	}
+
+	files := make(map[string]fileState)
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed while walking; the next poll settles it
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != inputDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") || strings.HasSuffix(info.Name(), "~") || generated[path] {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && generated[abs] {
+			return nil
+		}
+		files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// changedSources lists the files added, modified or removed between snapshots
+func changedSources(before, after map[string]fileState) []string {
+	var changed []string
+	for path, state := range after {
+		if previous, exists := before[path]; !exists || previous != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, exists := after[path]; !exists {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// watchSources polls inputDir and calls rebuild with the changed files once
+// they stop changing. A failed rebuild is reported and watching continues, so
+// authors can fix the error and save again. It returns when stop is closed.
+func watchSources(inputDir, outputFile string, interval time.Duration, rebuild func(changed []string) error, stop <-chan struct{}) error {
+	current, err := snapshotSources(inputDir, outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %v", inputDir, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pending []string
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		next, err := snapshotSources(inputDir, outputFile)
+		if err != nil {
+			log.Warn("Failed to scan input directory", "dir", inputDir, "error", err)
+			continue
+		}
+		if changed := changedSources(current, next); len(changed) > 0 {
+			// Editors often write a file in several steps; wait for a quiet
+			// interval before rebuilding
+			pending = mergeChanged(pending, changed)
+			current = next
+			continue
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		fileHashes.forget(current)
+		if err := rebuild(pending); err != nil {
+			log.Error("Rebuild failed", "error", err)
+		}
+		pending = nil
+	}
+}
+
+func mergeChanged(pending, changed []string) []string {
+	seen := make(map[string]bool, len(pending))
+	for _, path := range pending {
+		seen[path] = true
+	}
+	for _, path := range changed {
+		if !seen[path] {
+			pending = append(pending, path)
+			seen[path] = true
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// watchBuild rebuilds the document whenever its sources change, until the
+// process is interrupted
+func watchBuild(inputDir, outputFile string, interval time.Duration, build func() error) error {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	fmt.Printf("\nWatching %s for changes (Ctrl+C to stop)\n", inputDir)
+	fileHashes.rehashed()
+	return watchSources(inputDir, outputFile, interval, func(changed []string) error {
+		start := time.Now()
+		if err := build(); err != nil {
+			return err
+		}
+		names := make([]string, len(changed))
+		for i, path := range changed {
+			names[i], _ = filepath.Rel(inputDir, path)
+		}
+		fmt.Printf("✓ Rebuilt %s in %dms (changed: %s; rehashed %d files)\n",
+			outputFile, time.Since(start).Milliseconds(), strings.Join(names, ", "), fileHashes.rehashed())
+		return nil
+	}, stop)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/annotations"
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/spf13/cobra"
+)
+
+func annotationsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "annotations",
+		Short: "Embed or export the annotations of a document",
+		Long: `Annotations are the highlights, notes and drawings readers make in the viewer.
+The viewer exports them as a sidecar file next to the document
+(report.annotations.json for report.liv); embed puts a sidecar into a new
+revision of the document, and export takes the annotations a revision holds
+back out.`,
+	}
+	cmd.AddCommand(annotationsEmbedCmd())
+	cmd.AddCommand(annotationsExportCmd())
+	return cmd
+}
+
+func annotationsEmbedCmd() *cobra.Command {
+	var (
+		keyFile    string
+		outputFile string
+		signer     core.SignerInfo
+	)
+
+	cmd := &cobra.Command{
+		Use:   "embed [file] [sidecar]",
+		Short: "Embed annotations in a new revision of a document",
+		Long: `Embed writes a revision of the document holding the annotations of a sidecar
+file, listed in its manifest like any other resource. The signatures of the
+document no longer match the revision and are dropped; with --key the
+revision is signed, so the signature covers the annotations too.`,
+		Example: `  liv annotations embed report.liv report.annotations.json -o report-annotated.liv
+  liv annotations embed report.liv report.annotations.json --key reviewer.pem --signer-name "Rex Reviewer" --role reviewer`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sidecarFile := strings.TrimSuffix(args[0], filepath.Ext(args[0])) + annotations.SidecarExtension
+			if len(args) > 1 {
+				sidecarFile = args[1]
+			}
+			return runAnnotationsEmbed(args[0], sidecarFile, outputFile, keyFile, signer)
+		},
+	}
+
+	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Private key file signing the revision (default: unsigned)")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: the document name with -annotated.liv)")
+	cmd.Flags().StringVar(&signer.Name, "signer-name", "", "Name of the signer")
+	cmd.Flags().StringVar(&signer.Email, "signer-email", "", "Email address of the signer")
+	cmd.Flags().StringVar(&signer.Role, "role", "", "Role of the signer, such as reviewer")
+
+	return cmd
+}
+
+func runAnnotationsEmbed(livFile, sidecarFile, outputFile, keyFile string, signer core.SignerInfo) error {
+	if outputFile == "" {
+		outputFile = strings.TrimSuffix(livFile, filepath.Ext(livFile)) + "-annotated.liv"
+	}
+
+	data, err := os.ReadFile(sidecarFile)
+	if err != nil {
+		return fmt.Errorf("failed to read annotations: %v", err)
+	}
+	sidecar, err := annotations.ParseSidecar(data)
+	if err != nil {
+		return err
+	}
+
+	opts := annotations.EmbedOptions{Signer: signer, Now: time.Now()}
+	if keyFile != "" {
+		if opts.Key, err = integrity.NewSignatureManager().LoadPrivateKeyPEM(keyFile); err != nil {
+			return fmt.Errorf("failed to load private key: %v", err)
+		}
+	}
+
+	zipContainer := container.NewZIPContainer()
+	files, err := zipContainer.ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	if err := annotations.Embed(files, sidecar, opts); err != nil {
+		return fmt.Errorf("cannot embed annotations: %v", err)
+	}
+	if err := writeFiles(files, outputFile); err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+
+	fmt.Printf("✓ Annotations embedded\n")
+	fmt.Printf("  Annotations: %d\n", len(sidecar.Annotations))
+	if opts.Key != nil {
+		signedBy := opts.Signer
+		signedBy.KeyID = integrity.NewSignatureManager().KeyID(opts.Key.Public())
+		fmt.Printf("  Signed by: %s\n", signedBy.Summary())
+	} else {
+		fmt.Printf("  Unsigned: sign the revision with liv sign, or embed with --key\n")
+	}
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
+
+func annotationsExportCmd() *cobra.Command {
+	var outputFile string
+
+	cmd := &cobra.Command{
+		Use:   "export [file]",
+		Short: "Export the annotations a document embeds as a sidecar file",
+		Example: `  liv annotations export report-annotated.liv
+  liv annotations export report-annotated.liv -o notes.annotations.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAnnotationsExport(args[0], outputFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: the document name with "+annotations.SidecarExtension+")")
+
+	return cmd
+}
+
+func runAnnotationsExport(livFile, outputFile string) error {
+	if outputFile == "" {
+		outputFile = strings.TrimSuffix(livFile, filepath.Ext(livFile)) + annotations.SidecarExtension
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	sidecar, err := annotations.Embedded(files)
+	if err != nil {
+		return fmt.Errorf("invalid embedded annotations: %v", err)
+	}
+	if sidecar == nil {
+		return fmt.Errorf("%s embeds no annotations", livFile)
+	}
+
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize annotations: %v", err)
+	}
+	if err := atomicfile.WriteFile(outputFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write annotations: %v", err)
+	}
+
+	fmt.Printf("✓ Annotations exported\n")
+	fmt.Printf("  Annotations: %d\n", len(sidecar.Annotations))
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/anonymize"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/spf13/cobra"
+)
+
+// anonymizeOptions are the build flags for double-blind review copies,
+// passed through to the builder
+type anonymizeOptions struct {
+	Enabled      bool
+	PatternsFile string
+	MappingFile  string
+	KeyFile      string
+}
+
+// args returns the builder arguments for the options
+func (o anonymizeOptions) args() []string {
+	if !o.Enabled {
+		return nil
+	}
+	args := []string{"--anonymize"}
+	if o.PatternsFile != "" {
+		args = append(args, "--anonymize-patterns", o.PatternsFile)
+	}
+	if o.MappingFile != "" {
+		args = append(args, "--mapping", o.MappingFile)
+	}
+	if o.KeyFile != "" {
+		args = append(args, "--mapping-key", o.KeyFile)
+	}
+	return args
+}
+
+func deanonymizeCmd() *cobra.Command {
+	var (
+		outputFile  string
+		mappingFile string
+		keyFile     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "deanonymize [review.liv]",
+		Short: "Restore the identity removed from a review copy",
+		Long: `Deanonymize puts the authors, acknowledgments and identifying strings removed
+by liv build --anonymize back into the review copy, using the sealed identity
+mapping written by that build and the passphrase that sealed it.
+
+The review copy must be unchanged since it was built; sign the restored
+document again if it was signed.`,
+		Example: `  liv deanonymize paper-review.liv --mapping-key review.key -o paper.liv
+  liv deanonymize paper-review.liv --mapping mappings/paper.livmap --mapping-key review.key`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDeanonymize(args[0], outputFile, mappingFile, keyFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output document (default: the review copy name with -restored.liv)")
+	cmd.Flags().StringVar(&mappingFile, "mapping", "", "Sealed identity mapping (default: the review copy name with "+anonymize.Extension+")")
+	cmd.Flags().StringVar(&keyFile, "mapping-key", "", "File holding the passphrase that sealed the mapping (required)")
+	cmd.MarkFlagRequired("mapping-key")
+
+	return cmd
+}
+
+func runDeanonymize(livFile, outputFile, mappingFile, keyFile string) error {
+	base := strings.TrimSuffix(livFile, filepath.Ext(livFile))
+	if mappingFile == "" {
+		mappingFile = base + anonymize.Extension
+	}
+	if outputFile == "" {
+		outputFile = base + "-restored.liv"
+	}
+
+	passphrase, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read mapping key: %v", err)
+	}
+	sealed, err := os.ReadFile(mappingFile)
+	if err != nil {
+		return fmt.Errorf("failed to read identity mapping: %v", err)
+	}
+	mapping, err := anonymize.Unseal(sealed, strings.TrimRight(string(passphrase), "\r\n"))
+	if err != nil {
+		return err
+	}
+
+	zipContainer := container.NewZIPContainer()
+	files, err := zipContainer.ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return fmt.Errorf("manifest.json not found in document")
+	}
+	doc, err := manifest.NewManifestParser().ParseFromBytes(manifestData)
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	if err := anonymize.Restore(files, doc, mapping); err != nil {
+		return fmt.Errorf("cannot restore identity: %v", err)
+	}
+	if files["manifest.json"], err = json.MarshalIndent(doc, "", "  "); err != nil {
+		return fmt.Errorf("failed to serialize manifest: %v", err)
+	}
+	if err := writeFiles(files, outputFile); err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+
+	fmt.Printf("✓ Identity restored\n")
+	fmt.Printf("  Author: %s\n", doc.Metadata.Author)
+	fmt.Printf("  Resources restored: %d\n", len(mapping.Originals))
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+// attestationOptions ask the builder for a signed build attestation
+type attestationOptions struct {
+	Enabled bool
+	File    string
+}
+
+// args returns the builder arguments for the options
+func (o attestationOptions) args() []string {
+	if !o.Enabled {
+		return nil
+	}
+	args := []string{"--attest"}
+	if o.File != "" {
+		args = append(args, "--attestation", o.File)
+	}
+	return args
+}
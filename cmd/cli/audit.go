@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/a11y"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+func auditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Audit documents against published guidelines",
+	}
+
+	cmd.AddCommand(auditA11yCmd())
+
+	return cmd
+}
+
+func auditA11yCmd() *cobra.Command {
+	var (
+		format   string
+		minScore int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "a11y [file]",
+		Short: "Check a document's pages for accessibility problems",
+		Long: `A11y checks the HTML pages of a document against WCAG: images without alt
+text, headings that skip levels or have no text, text whose inline colors
+contrast too little, misused roles and ARIA attributes, and documents that
+run scripts without a static fallback page.
+
+Pages are checked as written, without their style sheets or scripts. The
+score is the share of checks passed, where a warning counts as half a
+failure; the audit fails when the score is below --min-score, so it can
+gate a build.`,
+		Example: `  liv audit a11y report.liv
+  liv audit a11y report.liv --min-score 90
+  liv audit a11y report.liv --format json > a11y.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuditA11y(cmd.OutOrStdout(), args[0], format, minScore)
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Report format: text or json")
+	cmd.Flags().IntVar(&minScore, "min-score", 0, "Fail when the score is below this, from 0 to 100")
+
+	return cmd
+}
+
+func runAuditA11y(w io.Writer, file, format string, minScore int) error {
+	format = strings.ToLower(format)
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown report format: %s (expected text or json)", format)
+	}
+	if minScore < 0 || minScore > 100 {
+		return fmt.Errorf("--min-score must be from 0 to 100")
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(file)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	m, err := readEditableManifest(files)
+	if err != nil {
+		return err
+	}
+	report := a11y.Audit(files, m)
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printA11yReport(w, report)
+	}
+
+	if !report.Passed(minScore) {
+		return fmt.Errorf("accessibility score %d is below %d", report.Score, minScore)
+	}
+	return nil
+}
+
+// printA11yReport writes the findings of an audit by page, and the score
+func printA11yReport(w io.Writer, report *a11y.Report) {
+	page := ""
+	for _, finding := range report.Findings {
+		if finding.Path != page {
+			page = finding.Path
+			fmt.Fprintf(w, "%s\n", page)
+		}
+		mark := "✗"
+		if finding.Severity == a11y.SeverityWarning {
+			mark = "!"
+		}
+		location := ""
+		if finding.Line > 0 {
+			location = fmt.Sprintf("%d: ", finding.Line)
+		}
+		fmt.Fprintf(w, "  %s %s%s [%s, WCAG %s]\n", mark, location, finding.Message, finding.Rule, finding.WCAG)
+		if finding.Element != "" {
+			fmt.Fprintf(w, "      %s\n", finding.Element)
+		}
+	}
+	for _, skipped := range report.Skipped {
+		fmt.Fprintf(w, "Skipped %s: encrypted\n", skipped)
+	}
+	if len(report.Findings) > 0 || len(report.Skipped) > 0 {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Score: %d/100 (%d pages, %d checks, %d errors, %d warnings)\n",
+		report.Score, len(report.Pages), report.Checks, report.Errors, report.Warnings)
+}
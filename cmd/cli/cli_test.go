@@ -1,15 +1,33 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/liv-format/liv/pkg/conformance"
 	"github.com/liv-format/liv/pkg/container"
 	"github.com/liv-format/liv/pkg/core"
 	"github.com/liv-format/liv/pkg/integrity"
 	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/scaffold"
+	"github.com/liv-format/liv/pkg/transfer"
+	"github.com/liv-format/liv/pkg/tsa/tsatest"
+	"github.com/liv-format/liv/pkg/verification"
 )
 
 // TestCLIFunctions tests the CLI functions directly
@@ -113,16 +131,39 @@ func testValidateFunction(t *testing.T, testDir string) {
 	livFile := filepath.Join(testDir, "test.liv")
 	
 	// Test validation function
-	err := runValidate(livFile, false, false)
+	err := runValidate(livFile, false, false, "", "", vulnerabilityOptions{}, core.DefaultClockSkew, false)
 	if err != nil {
 		t.Errorf("Validate function failed: %v", err)
 	}
 
 	// Test with signatures check
-	err = runValidate(livFile, true, true)
+	err = runValidate(livFile, true, false, "", "", vulnerabilityOptions{}, core.DefaultClockSkew, true)
 	if err != nil {
 		t.Errorf("Validate function with signatures failed: %v", err)
 	}
+
+	// Test that unlicensed documents fail when a license is required
+	err = runValidate(livFile, false, true, "", "", vulnerabilityOptions{}, core.DefaultClockSkew, false)
+	if err == nil {
+		t.Error("Expected validation to fail for unlicensed document")
+	}
+
+	// Test that a denied component fails validation under the strict policy
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		t.Fatalf("Failed to extract test document: %v", err)
+	}
+	feedFile := filepath.Join(testDir, "advisories.json")
+	feed := `{"advisories": [{"id": "LIV-TEST-1", "sha256": "` + container.CalculateFileHash(files["content/index.html"]) + `", "summary": "Denied page"}]}`
+	if err := os.WriteFile(feedFile, []byte(feed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runValidate(livFile, false, false, "", "", vulnerabilityOptions{FeedFile: feedFile, Policy: "strict"}, core.DefaultClockSkew, false); err == nil {
+		t.Error("Expected validation to fail for a denied component")
+	}
+	if err := runValidate(livFile, false, false, "", "", vulnerabilityOptions{FeedFile: feedFile, Policy: "warn"}, core.DefaultClockSkew, false); err != nil {
+		t.Errorf("Expected the warn policy to pass validation, got %v", err)
+	}
 }
 
 func testConvertFunction(t *testing.T, testDir string) {
@@ -130,7 +171,7 @@ func testConvertFunction(t *testing.T, testDir string) {
 	htmlOutput := filepath.Join(testDir, "converted.html")
 	
 	// Test HTML conversion
-	err := runConvert(livFile, "html", htmlOutput, 90)
+	err := runConvert(livFile, "html", htmlOutput, 90, "", nil, nil, "")
 	if err != nil {
 		t.Errorf("Convert function failed: %v", err)
 	}
@@ -152,7 +193,7 @@ func testConvertFunction(t *testing.T, testDir string) {
 	}
 
 	// Test unsupported format
-	err = runConvert(livFile, "unsupported", "test.out", 90)
+	err = runConvert(livFile, "unsupported", "test.out", 90, "", nil, nil, "")
 	if err == nil {
 		t.Errorf("Expected error for unsupported format, but conversion succeeded")
 	}
@@ -164,7 +205,7 @@ func testSignFunction(t *testing.T, testDir string) {
 	signedFile := filepath.Join(testDir, "signed.liv")
 	
 	// Test signing function
-	err := runSign(livFile, keyPath, signedFile)
+	err := runSign(livFile, keyPath, signedFile, "", false, core.SignerInfo{})
 	if err != nil {
 		t.Errorf("Sign function failed: %v", err)
 	}
@@ -174,8 +215,83 @@ func testSignFunction(t *testing.T, testDir string) {
 		t.Errorf("Signed file was not created")
 	}
 
+	// The signatures are stored in the package and verify
+	sm := integrity.NewSignatureManager()
+	privateKey, err := sm.LoadPrivateKeyPEM(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	verifySigned := func(path string) *integrity.SignatureVerificationResult {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open signed file: %v", err)
+		}
+		defer file.Close()
+		document, err := container.NewPackageManager().ExtractPackage(context.Background(), file)
+		if err != nil {
+			t.Fatalf("Failed to extract signed file: %v", err)
+		}
+		result := sm.VerifyDocument(document, privateKey.Public())
+		if !result.Valid {
+			t.Errorf("Signatures of %s do not verify: %v", filepath.Base(path), result.Errors)
+		}
+		return result
+	}
+	if result := verifySigned(signedFile); result.Timestamp != nil {
+		t.Errorf("Expected no timestamp without --tsa-url")
+	}
+
+	// Timestamped signatures
+	server, err := tsatest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	timestampedFile := filepath.Join(testDir, "timestamped.liv")
+	if err := runSign(signedFile, keyPath, timestampedFile, server.URL, false, core.SignerInfo{}); err != nil {
+		t.Fatalf("Sign with a timestamping authority failed: %v", err)
+	}
+	if result := verifySigned(timestampedFile); result.Timestamp == nil {
+		t.Errorf("Expected the signatures to be timestamped")
+	}
+	server.Close()
+	if err := runSign(signedFile, keyPath, filepath.Join(testDir, "unreachable.liv"), server.URL, false, core.SignerInfo{}); err == nil {
+		t.Errorf("Expected signing to fail when the timestamping authority is unreachable")
+	}
+
+	// A reviewer counter-signs the signed document
+	if err := runSign(livFile, keyPath, filepath.Join(testDir, "unsigned.liv"), "", true, core.SignerInfo{}); err == nil {
+		t.Errorf("Expected appending a signature to an unsigned document to fail")
+	}
+	reviewer, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewerKey := filepath.Join(testDir, "reviewer.pem")
+	if err := sm.SaveSigningKeyPairPEM(reviewer, reviewerKey, filepath.Join(testDir, "reviewer.pub")); err != nil {
+		t.Fatal(err)
+	}
+	counterSignedFile := filepath.Join(testDir, "counter-signed.liv")
+	if err := runSign(signedFile, reviewerKey, counterSignedFile, "", true, core.SignerInfo{Name: "Reviewer", Role: "reviewer"}); err != nil {
+		t.Fatalf("Sign with --append failed: %v", err)
+	}
+	verifySigned(counterSignedFile)
+	file, err := os.Open(counterSignedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	document, err := container.NewPackageManager().ExtractPackage(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Failed to extract counter-signed file: %v", err)
+	}
+	results := sm.VerifySigners(document, []crypto.PublicKey{privateKey.Public(), reviewer.PublicKey})
+	if len(results) != 2 || results[0].Status != integrity.SignerValid || results[1].Status != integrity.SignerValid || results[1].Signer.Role != "reviewer" {
+		t.Errorf("Expected both signers to verify, got %+v", results)
+	}
+
 	// Test with nonexistent key file
-	err = runSign(livFile, "nonexistent.pem", "test.liv")
+	err = runSign(livFile, "nonexistent.pem", "test.liv", "", false, core.SignerInfo{})
 	if err == nil {
 		t.Errorf("Expected error for nonexistent key file, but signing succeeded")
 	}
@@ -198,6 +314,446 @@ func testViewFunction(t *testing.T, testDir string) {
 }
 
 // TestHelperFunctions tests utility functions
+func TestFetch(t *testing.T) {
+	data := bytes.Repeat([]byte("liv document "), 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Disposition", `attachment; filename="../report.liv"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := runFetch(server.URL+"/api/document", dir, 0, []string{"Authorization: Bearer secret"}, "", nil); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	// The server suggested name is kept inside the output directory
+	if got, err := os.ReadFile(filepath.Join(dir, "report.liv")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Fetched document does not match: %v", err)
+	}
+
+	if err := runFetch(server.URL+"/api/document", filepath.Join(dir, "other.liv"), 0, nil, "", nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized fetch to fail, got %v", err)
+	}
+	if err := runFetch(server.URL, dir, 0, []string{"Authorization"}, "", nil); err == nil {
+		t.Error("Expected an invalid header to be refused")
+	}
+}
+
+func TestFetchVerified(t *testing.T) {
+	dir := t.TempDir()
+	html := []byte("<h1>Published</h1>")
+	sum := sha256.Sum256(html)
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Published Report", "Publisher")
+	builder.CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(html)), Type: "text/html", Path: "content/index.html"})
+	manifestData, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedFile := filepath.Join(dir, "unsigned.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(map[string][]byte{"manifest.json": manifestData, "content/index.html": html}, unsignedFile); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := integrity.NewSignatureManager()
+	publisher, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisherKey, otherKey := filepath.Join(dir, "publisher.pub"), filepath.Join(dir, "other.pub")
+	if err := sm.SaveSigningKeyPairPEM(publisher, filepath.Join(dir, "publisher.pem"), publisherKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SaveSigningKeyPairPEM(other, filepath.Join(dir, "other.pem"), otherKey); err != nil {
+		t.Fatal(err)
+	}
+	signedFile := filepath.Join(dir, "signed.liv")
+	if err := runSign(unsignedFile, filepath.Join(dir, "publisher.pem"), signedFile, "", false, core.SignerInfo{Name: "Publisher"}); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := os.ReadFile(signedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedSum := sha256.Sum256(signed)
+
+	descriptor := fmt.Sprintf(`{"name": "report", "latest": "1.1.0", "versions": [
+		{"version": "1.0.0", "url": "unsigned.liv", "sha256": "%s", "size": %d},
+		{"version": "1.1.0", "url": "signed.liv", "sha256": "%s", "size": %d, "key_id": "%s"}]}`,
+		strings.Repeat("0", 64), len(html), hex.EncodeToString(signedSum[:]), len(signed), sm.KeyID(publisher.PublicKey))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/report.json" {
+			w.Header().Set("Content-Type", transfer.DescriptorContentType)
+			w.Write([]byte(descriptor))
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(dir, path.Base(r.URL.Path)))
+	}))
+	defer server.Close()
+
+	out := t.TempDir()
+	if err := runFetch(server.URL+"/signed.liv", filepath.Join(out, "a.liv"), 0, nil, "", []string{otherKey, publisherKey}); err != nil {
+		t.Errorf("Fetch of a signed document failed: %v", err)
+	}
+	if err := runFetch(server.URL+"/signed.liv", filepath.Join(out, "b.liv"), 0, nil, "", []string{otherKey}); err == nil {
+		t.Error("Expected a document signed with another key to be refused")
+	}
+	if err := runFetch(server.URL+"/unsigned.liv", filepath.Join(out, "c.liv"), 0, nil, "", []string{publisherKey}); err == nil {
+		t.Error("Expected an unsigned document to be refused")
+	}
+	for _, name := range []string{"b.liv", "b.liv.part", "c.liv"} {
+		if _, err := os.Stat(filepath.Join(out, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s after failed verification", name)
+		}
+	}
+
+	// The descriptor resolves the latest version and pins its hash
+	if err := runFetch(server.URL+"/report.json", filepath.Join(out, "d.liv"), 0, nil, "", []string{publisherKey}); err != nil {
+		t.Errorf("Fetch of the latest published version failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "d.liv")); !bytes.Equal(got, signed) {
+		t.Error("Fetched version does not match")
+	}
+	if err := runFetch(server.URL+"/report.json", filepath.Join(out, "e.liv"), 0, nil, "1.0.0", nil); err == nil {
+		t.Error("Expected a version that does not match its pinned hash to be refused")
+	}
+	if err := runFetch(server.URL+"/report.json", filepath.Join(out, "f.liv"), 0, nil, "2.0.0", nil); err == nil {
+		t.Error("Expected an unpublished version to be refused")
+	}
+	if err := runFetch(server.URL+"/signed.liv", filepath.Join(out, "g.liv"), 0, nil, "1.1.0", nil); err == nil {
+		t.Error("Expected --version to require a publishing descriptor")
+	}
+}
+
+func TestMetaSet(t *testing.T) {
+	dir := t.TempDir()
+	html := []byte("<h1>Report</h1>")
+	sum := sha256.Sum256(html)
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Draft Report", "ACME Corp")
+	builder.CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(html)), Type: "text/html", Path: "content/index.html"})
+	manifestData, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedFiles := map[string][]byte{"manifest.json": manifestData, "content/index.html": html}
+	if unsignedFiles[verification.Entry], err = verification.Marshal(verification.Describe(unsignedFiles)); err != nil {
+		t.Fatal(err)
+	}
+	unsignedFile := filepath.Join(dir, "unsigned.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(unsignedFiles, unsignedFile); err != nil {
+		t.Fatal(err)
+	}
+	sm := integrity.NewSignatureManager()
+	author, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "author.pem")
+	if err := sm.SaveSigningKeyPairPEM(author, keyFile, filepath.Join(dir, "author.pub")); err != nil {
+		t.Fatal(err)
+	}
+	signedFile := filepath.Join(dir, "signed.liv")
+	if err := runSign(unsignedFile, keyFile, signedFile, "", false, core.SignerInfo{Name: "Author"}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(file string) (*core.Manifest, map[string][]byte) {
+		t.Helper()
+		files, err := container.NewZIPContainer().ExtractToMemory(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := readEditableManifest(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The verification descriptor is kept up to date with every rewrite
+		if _, problems, err := verification.Verify(files); err != nil || len(problems) != 0 {
+			t.Errorf("Expected the verification descriptor of %s to match: %v %v", filepath.Base(file), err, problems)
+		}
+		return m, files
+	}
+	read(signedFile)
+
+	// Setting the metadata it already has leaves the document signed
+	signed, _ := os.ReadFile(signedFile)
+	title := "Draft Report"
+	if err := runMetaSet(signedFile, "", metadataEdit{Title: &title}, "", core.SignerInfo{}); err != nil {
+		t.Fatalf("Unchanged metadata failed: %v", err)
+	}
+	if unchanged, _ := os.ReadFile(signedFile); !bytes.Equal(unchanged, signed) {
+		t.Error("Expected unchanged metadata to leave the document untouched")
+	}
+	copiedFile := filepath.Join(dir, "copy.liv")
+	if err := runMetaSet(signedFile, copiedFile, metadataEdit{Title: &title}, "", core.SignerInfo{}); err != nil {
+		t.Fatalf("Unchanged metadata to another file failed: %v", err)
+	}
+	if copied, _ := os.ReadFile(copiedFile); !bytes.Equal(copied, signed) {
+		t.Error("Expected unchanged metadata to copy the document to the output")
+	}
+
+	jsonFile := filepath.Join(dir, "metadata.json")
+	os.WriteFile(jsonFile, []byte(`{"description": "Results for 2024", "authors": [{"name": "Ada Author", "role": "editor"}]}`), 0644)
+	title = "Annual Report 2024"
+	editedFile := filepath.Join(dir, "edited.liv")
+	if err := runMetaSet(signedFile, editedFile, metadataEdit{FromJSON: jsonFile, Title: &title}, "", core.SignerInfo{}); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	m, files := read(editedFile)
+	if m.Metadata.Title != title || m.Metadata.Description != "Results for 2024" || len(m.Metadata.Authors) != 1 || m.Metadata.Author != "ACME Corp" {
+		t.Errorf("Unexpected metadata %+v", m.Metadata)
+	}
+	if !bytes.Equal(files["content/index.html"], html) || m.Resources["content/index.html"].Hash != hex.EncodeToString(sum[:]) {
+		t.Error("Expected the content and resources to be kept")
+	}
+	for entry := range files {
+		if strings.HasPrefix(entry, "signatures/") {
+			t.Errorf("Expected the invalidated signatures to be removed, found %s", entry)
+		}
+	}
+
+	// With a key the edited document is signed again, replacing the
+	// document once: its backup is the document before the edit
+	version := "1.1.0"
+	previous, _ := os.ReadFile(editedFile)
+	keepBackups = true
+	defer func() { keepBackups = false }()
+	if err := runMetaSet(editedFile, "", metadataEdit{Version: &version}, keyFile, core.SignerInfo{Name: "Author"}); err != nil {
+		t.Fatalf("Failed to set and sign metadata: %v", err)
+	}
+	keepBackups = false
+	if backup, _ := os.ReadFile(editedFile + ".bak"); !bytes.Equal(backup, previous) {
+		t.Error("Expected the document before the edit kept as a backup")
+	}
+	m, files = read(editedFile)
+	signatures, err := container.ReadSignatureFiles(files)
+	if err != nil || m.Metadata.Version != version {
+		t.Fatalf("Unexpected signed revision: %v %+v", err, m.Metadata)
+	}
+	document := &core.LIVDocument{Manifest: m, Content: &core.DocumentContent{HTML: string(files["content/index.html"])}, WASMModules: map[string][]byte{}, Signatures: signatures}
+	if result := sm.VerifyDocument(document, author.PublicKey); !result.Valid {
+		t.Errorf("Expected the re-signed document to verify, got %v", result.Errors)
+	}
+
+	language := "english"
+	if err := runMetaSet(editedFile, "", metadataEdit{Language: &language}, "", core.SignerInfo{}); err == nil {
+		t.Error("Expected invalid metadata to be refused")
+	}
+	os.WriteFile(jsonFile, []byte(`{"titel": "Typo"}`), 0644)
+	if err := runMetaSet(editedFile, "", metadataEdit{FromJSON: jsonFile}, "", core.SignerInfo{}); err == nil {
+		t.Error("Expected unknown metadata fields to be refused")
+	}
+}
+
+func TestExtensionsPassThrough(t *testing.T) {
+	dir := t.TempDir()
+	html := []byte("<html><head><title>Case File</title></head><body><h1>Case File</h1></body></html>")
+	sum := sha256.Sum256(html)
+	extensions := map[string]json.RawMessage{"com.example.records": json.RawMessage(`{"case_number":"C-1042"}`)}
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Case File", "ACME Corp")
+	builder.CreateDefaultSecurityPolicy()
+	builder.SetExtensions(extensions)
+	builder.AddResource("content/index.html", &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(html)), Type: "text/html", Path: "content/index.html"})
+	manifestData, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedFile := filepath.Join(dir, "unsigned.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(map[string][]byte{"manifest.json": manifestData, "content/index.html": html}, unsignedFile); err != nil {
+		t.Fatal(err)
+	}
+	sm := integrity.NewSignatureManager()
+	keys, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := sm.SaveSigningKeyPairPEM(keys, keyFile, filepath.Join(dir, "key.pub")); err != nil {
+		t.Fatal(err)
+	}
+	kept := func(file string) {
+		t.Helper()
+		files, err := container.NewZIPContainer().ExtractToMemory(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := readEditableManifest(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		if json.Compact(&got, m.Extensions["com.example.records"]); got.String() != `{"case_number":"C-1042"}` {
+			t.Errorf("Expected %s to keep the extensions, got %s", filepath.Base(file), got.String())
+		}
+	}
+
+	signedFile := filepath.Join(dir, "signed.liv")
+	if err := runSign(unsignedFile, keyFile, signedFile, "", false, core.SignerInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	kept(signedFile)
+
+	htmlFile := filepath.Join(dir, "case.html")
+	if err := convertToHTML(signedFile, htmlFile); err != nil {
+		t.Fatal(err)
+	}
+	importedFile := filepath.Join(dir, "imported.liv")
+	if err := convertToLIV(htmlFile, importedFile); err != nil {
+		t.Fatal(err)
+	}
+	kept(importedFile)
+
+	schemas := filepath.Join(dir, "extensions.json")
+	os.WriteFile(schemas, []byte(`{"com.example.records": {"fields": [{"name": "case_number", "type": "integer"}]}}`), 0644)
+	if err := runValidate(importedFile, false, false, "", schemas, vulnerabilityOptions{}, core.DefaultClockSkew, false); err == nil {
+		t.Error("Expected an extension not matching its schema to fail validation")
+	}
+}
+
+func TestAccessPolicySigned(t *testing.T) {
+	dir := t.TempDir()
+	html := []byte("<h1>Embargoed results</h1>")
+	sum := sha256.Sum256(html)
+	closes := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Results", "ACME Corp")
+	builder.CreateDefaultSecurityPolicy()
+	builder.SetAccess(&core.AccessPolicy{NotAfter: &closes, MaxOpens: 3})
+	builder.AddResource("content/index.html", &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(html)), Type: "text/html", Path: "content/index.html"})
+	manifestData, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedFile := filepath.Join(dir, "unsigned.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(map[string][]byte{"manifest.json": manifestData, "content/index.html": html}, unsignedFile); err != nil {
+		t.Fatal(err)
+	}
+	sm := integrity.NewSignatureManager()
+	keys, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := sm.SaveSigningKeyPairPEM(keys, keyFile, filepath.Join(dir, "key.pub")); err != nil {
+		t.Fatal(err)
+	}
+	signedFile := filepath.Join(dir, "signed.liv")
+	if err := runSign(unsignedFile, keyFile, signedFile, "", false, core.SignerInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	// The signature covers the policy, so stripping it breaks the signature
+	files, err := container.NewZIPContainer().ExtractToMemory(signedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := readEditableManifest(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Access == nil || m.Access.MaxOpens != 3 || !m.Access.NotAfter.Equal(closes) {
+		t.Fatalf("Expected signing to keep the access policy, got %+v", m.Access)
+	}
+	signatures, err := container.ReadSignatureFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := &core.LIVDocument{Manifest: m, Content: &core.DocumentContent{HTML: string(html)}, WASMModules: map[string][]byte{}, Signatures: signatures}
+	if result := sm.VerifyDocument(document, keys.PublicKey); !result.Valid {
+		t.Fatalf("Expected the signed policy to verify, got %v", result.Errors)
+	}
+	m.Access = nil
+	if result := sm.VerifyDocument(document, keys.PublicKey); result.Valid {
+		t.Error("Expected a document stripped of its access policy to fail verification")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	html := []byte("<h1>Quarterly figures</h1>")
+	sum := sha256.Sum256(html)
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Quarterly Report", "ACME Corp")
+	builder.CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(html)), Type: "text/html", Path: "content/index.html"})
+	manifestData, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainFile := filepath.Join(dir, "report.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(map[string][]byte{"manifest.json": manifestData, "content/index.html": html}, plainFile); err != nil {
+		t.Fatal(err)
+	}
+	sm := integrity.NewSignatureManager()
+	reader, err := sm.GenerateSigningKeyPair(integrity.AlgorithmRSASHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SaveSigningKeyPairPEM(reader, filepath.Join(dir, "reader.pem"), filepath.Join(dir, "reader.pub")); err != nil {
+		t.Fatal(err)
+	}
+	passwordFile := filepath.Join(dir, "password.txt")
+	os.WriteFile(passwordFile, []byte("correct horse\n"), 0600)
+	t.Setenv(passwordEnv, "")
+
+	encryptedFile := filepath.Join(dir, "locked.liv")
+	opts := encryptOptions{Recipients: []string{filepath.Join(dir, "reader.pub")}, Password: passwordOptions{File: passwordFile}, KDF: "argon2id"}
+	if err := runEncrypt(plainFile, encryptedFile, opts); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	files, err := container.NewZIPContainer().ExtractToMemory(encryptedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(files["content/index.html"], []byte("Quarterly")) {
+		t.Error("Plaintext leaked into the encrypted document")
+	}
+	m, err := readEditableManifest(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Encryption == nil || len(m.Encryption.Recipients) != 2 || m.Encryption.Recipients[1].KDF != "argon2id" {
+		t.Fatalf("Expected a key and an Argon2id password recipient, got %+v", m.Encryption)
+	}
+	if result := manifest.NewManifestValidator().ValidateManifest(m); !result.IsValid {
+		t.Errorf("Expected a valid encrypted manifest, got %v", result.Errors)
+	}
+	if err := runEncrypt(encryptedFile, filepath.Join(dir, "twice.liv"), opts); err == nil {
+		t.Error("Expected an encrypted document not to be encrypted again")
+	}
+
+	os.WriteFile(passwordFile, []byte("wrong\n"), 0600)
+	if err := runDecrypt(encryptedFile, filepath.Join(dir, "wrong.liv"), "", passwordOptions{File: passwordFile}); err == nil {
+		t.Error("Expected a wrong password to fail")
+	}
+	t.Setenv(passwordEnv, "correct horse")
+	for name, keyFile := range map[string]string{"password.liv": "", "key.liv": filepath.Join(dir, "reader.pem")} {
+		output := filepath.Join(dir, name)
+		if err := runDecrypt(encryptedFile, output, keyFile, passwordOptions{}); err != nil {
+			t.Fatalf("Failed to decrypt %s: %v", name, err)
+		}
+		files, err := container.NewZIPContainer().ExtractToMemory(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, _ := readEditableManifest(files)
+		if !bytes.Equal(files["content/index.html"], html) || m.Encryption != nil || m.Resources["content/index.html"].Hash != hex.EncodeToString(sum[:]) {
+			t.Errorf("Expected %s to restore the plaintext document", name)
+		}
+	}
+}
+
 func TestHelperFunctions(t *testing.T) {
 	t.Run("FindExecutables", func(t *testing.T) {
 		// Test finding builder executable
@@ -234,23 +790,172 @@ func TestHelperFunctions(t *testing.T) {
 	})
 }
 
+func TestEPUBCreators(t *testing.T) {
+	metadata := &core.DocumentMetadata{
+		Author: "Carberry et al.",
+		Authors: []*core.AuthorInfo{
+			{Name: "Josiah Carberry", ORCID: "0000-0002-1825-0097"},
+			{Name: "Ada <Translator>", Role: "translator"},
+		},
+	}
+	creators := epubCreators(metadata)
+	for _, line := range []string{
+		`<dc:creator id="creator1">Josiah Carberry</dc:creator>`,
+		`<meta refines="#creator1" property="role" scheme="marc:relators">aut</meta>`,
+		`<meta refines="#creator1" property="display-seq">1</meta>`,
+		`<meta refines="#creator1" property="dcterms:identifier">https://orcid.org/0000-0002-1825-0097</meta>`,
+		`<dc:contributor id="creator2">Ada &lt;Translator&gt;</dc:contributor>`,
+		`<meta refines="#creator2" property="role" scheme="marc:relators">trl</meta>`,
+	} {
+		if !strings.Contains(creators, line) {
+			t.Errorf("Expected %s in:\n%s", line, creators)
+		}
+	}
+
+	// Documents without author records are by their byline
+	metadata.Authors = nil
+	if creators := epubCreators(metadata); creators != `<dc:creator id="creator1">Carberry et al.</dc:creator>`+"\n        "+`<meta refines="#creator1" property="role" scheme="marc:relators">aut</meta>` {
+		t.Errorf("Unexpected byline creator:\n%s", creators)
+	}
+}
+
+func TestEPUBFunders(t *testing.T) {
+	metadata := &core.DocumentMetadata{
+		Funding: []*core.FundingInfo{
+			{Funder: "National Science Foundation", FunderID: "10.13039/100000001", Awards: []string{"CHE-1234567", "CHE-7654321"}},
+			{Funder: "Wellcome & Partners"},
+		},
+	}
+	funders := epubFunders(metadata)
+	for _, line := range []string{
+		`<dc:contributor id="funder1">National Science Foundation</dc:contributor>`,
+		`<meta refines="#funder1" property="role" scheme="marc:relators">fnd</meta>`,
+		`<meta refines="#funder1" property="dcterms:identifier">https://doi.org/10.13039/100000001</meta>`,
+		`<dc:contributor id="funder2">Wellcome &amp; Partners</dc:contributor>`,
+		`<meta property="dcterms:description">Funding: National Science Foundation (CHE-1234567, CHE-7654321); Wellcome &amp; Partners</meta>`,
+	} {
+		if !strings.Contains(funders, line) {
+			t.Errorf("Expected %s in:\n%s", line, funders)
+		}
+	}
+
+	if funders := epubFunders(&core.DocumentMetadata{}); funders != "" {
+		t.Errorf("Expected no funders, got:\n%s", funders)
+	}
+}
+
+func TestEPUBSubjects(t *testing.T) {
+	metadata := &core.DocumentMetadata{
+		Keywords: []string{"leadership", "R&D"},
+		Subjects: []*core.SubjectInfo{
+			{Scheme: core.SubjectSchemeBISAC, Code: "BUS071000", Label: "BUSINESS & ECONOMICS / Leadership"},
+			{Label: "Management"},
+		},
+	}
+	subjects := epubSubjects(metadata)
+	for _, line := range []string{
+		`<dc:subject>leadership</dc:subject>`,
+		`<dc:subject>R&amp;D</dc:subject>`,
+		`<dc:subject id="subject1">BUSINESS &amp; ECONOMICS / Leadership</dc:subject>`,
+		`<meta refines="#subject1" property="authority">BISAC</meta>`,
+		`<meta refines="#subject1" property="term">BUS071000</meta>`,
+		`<dc:subject>Management</dc:subject>`,
+	} {
+		if !strings.Contains(subjects, line) {
+			t.Errorf("Expected %s in:\n%s", line, subjects)
+		}
+	}
+
+	if subjects := epubSubjects(&core.DocumentMetadata{}); subjects != "" {
+		t.Errorf("Expected no subjects, got:\n%s", subjects)
+	}
+}
+
+func TestPrintInspection(t *testing.T) {
+	m := &core.Manifest{
+		Metadata: &core.DocumentMetadata{
+			Title:    "Leading Teams",
+			Author:   "ACME Corp",
+			Version:  "1.0.0",
+			Language: "en",
+			Keywords: []string{"leadership", "teams"},
+			Subjects: []*core.SubjectInfo{
+				{Scheme: core.SubjectSchemeBISAC, Code: "BUS071000", Label: "BUSINESS & ECONOMICS / Leadership"},
+				{Scheme: core.SubjectSchemeDDC, Code: "658.4"},
+			},
+		},
+		Resources: map[string]*core.Resource{"content/index.html": {Size: 2048}},
+	}
+	var out bytes.Buffer
+	printInspection(&out, m, 2)
+	for _, line := range []string{
+		"Title:      Leading Teams\n",
+		"Keywords:   leadership, teams\n",
+		"Subjects:   BUSINESS & ECONOMICS / Leadership (BISAC BUS071000)\n            DDC 658.4\n",
+		"Signed:     yes, 2 signers\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestAuditA11y(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "report.liv")
+	manifestData, err := json.Marshal(&core.Manifest{Version: "1.0", Metadata: &core.DocumentMetadata{Title: "Report"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"manifest.json":      manifestData,
+		"content/index.html": []byte(`<h1>Report</h1><img src="chart.png"><p>Revenue grew.</p><img src="logo.png" alt="">`),
+	}
+	if err := container.NewZIPContainer().CreateFromFiles(files, file); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runAuditA11y(&out, file, "text", 0); err != nil {
+		t.Fatalf("runAuditA11y failed: %v", err)
+	}
+	for _, want := range []string{"content/index.html\n", "1: image has no alt text", "Score: 66/100 (1 pages, 3 checks, 1 errors, 0 warnings)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := runAuditA11y(&out, file, "json", 90); err == nil {
+		t.Errorf("Expected a score below the minimum to fail")
+	}
+	var report struct {
+		Score    int `json:"score"`
+		Findings []struct {
+			Rule string `json:"rule"`
+		} `json:"findings"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil || report.Score != 66 || len(report.Findings) != 1 {
+		t.Errorf("Expected the JSON report, got %v: %s", err, out.String())
+	}
+}
+
 // TestCLIErrorCases tests error handling
 func TestCLIErrorCases(t *testing.T) {
 	t.Run("NonexistentFiles", func(t *testing.T) {
 		// Test validate with nonexistent file
-		err := runValidate("nonexistent.liv", false, false)
+		err := runValidate("nonexistent.liv", false, false, "", "", vulnerabilityOptions{}, core.DefaultClockSkew, false)
 		if err == nil {
 			t.Error("Expected error for nonexistent file in validate")
 		}
 
 		// Test convert with nonexistent file
-		err = runConvert("nonexistent.liv", "html", "output.html", 90)
+		err = runConvert("nonexistent.liv", "html", "output.html", 90, "", nil, nil, "")
 		if err == nil {
 			t.Error("Expected error for nonexistent file in convert")
 		}
 
 		// Test sign with nonexistent file
-		err = runSign("nonexistent.liv", "key.pem", "output.liv")
+		err = runSign("nonexistent.liv", "key.pem", "output.liv", "", false, core.SignerInfo{})
 		if err == nil {
 			t.Error("Expected error for nonexistent file in sign")
 		}
@@ -270,9 +975,264 @@ func TestCLIErrorCases(t *testing.T) {
 		livFile := filepath.Join(testDir, "test.liv")
 
 		// Test convert with invalid format
-		err := runConvert(livFile, "invalid-format", "output.txt", 90)
+		err := runConvert(livFile, "invalid-format", "output.txt", 90, "", nil, nil, "")
 		if err == nil {
 			t.Error("Expected error for invalid format in convert")
 		}
 	})
-}
\ No newline at end of file
+}
+// testLibrary serves the library API of a viewer from memory
+type testLibrary struct {
+	documents map[string][]byte
+	filenames map[string]string
+	// token, when set, is required to upload
+	token string
+}
+
+func newTestLibrary() *testLibrary {
+	return &testLibrary{documents: make(map[string][]byte), filenames: make(map[string]string)}
+}
+
+func (l *testLibrary) put(filename string, data []byte) {
+	id := fmt.Sprintf("%032d", len(l.documents)+1)
+	l.documents[id] = data
+	l.filenames[id] = filename
+}
+
+func (l *testLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/library":
+		var docs []libraryDocument
+		for id, data := range l.documents {
+			sum := sha256.Sum256(data)
+			docs = append(docs, libraryDocument{ID: id, Filename: l.filenames[id], Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"documents": docs})
+	case "/api/document":
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(l.documents[r.URL.Query().Get("id")]))
+	case "/api/upload":
+		if l.token != "" && r.Header.Get("Authorization") != "Bearer "+l.token {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		l.put(header.Filename, data)
+		w.Write([]byte(`{"status": "uploaded"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestLibrarySync(t *testing.T) {
+	dir := t.TempDir()
+	createPackage := func(name, html string) []byte {
+		sum := sha256.Sum256([]byte(html))
+		builder := manifest.NewManifestBuilder()
+		builder.CreateDefaultMetadata(name, "Library")
+		builder.CreateDefaultSecurityPolicy()
+		builder.AddResource("content/index.html", &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(html)), Type: "text/html", Path: "content/index.html"})
+		manifestData, err := builder.BuildJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, name+".liv")
+		if err := container.NewZIPContainer().CreateFromFiles(map[string][]byte{"manifest.json": manifestData, "content/index.html": []byte(html)}, file); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	handbook := createPackage("handbook", "<h1>Handbook</h1>")
+	policy := createPackage("policy", "<h1>Policy v2</h1>")
+
+	primary, replica := newTestLibrary(), newTestLibrary()
+	primary.put("handbook.liv", handbook)
+	primary.put("policy.liv", policy)
+	primary.put("report.liv", createPackage("report", "<h1>Report</h1>"))
+	replica.put("handbook.liv", handbook)
+	replica.put("policy.liv", createPackage("policy-old", "<h1>Policy v1</h1>"))
+	replica.token = "replica"
+	primaryServer, replicaServer := httptest.NewServer(primary), httptest.NewServer(replica)
+	defer primaryServer.Close()
+	defer replicaServer.Close()
+
+	options := librarySyncOptions{From: primaryServer.URL, To: replicaServer.URL + "/", DryRun: true}
+	summary, err := runLibrarySync(options)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if len(replica.documents) != 2 || summary.Unchanged != 1 {
+		t.Errorf("Expected a dry run to only report, got %+v", summary)
+	}
+
+	// Uploads without the replica's credentials are refused
+	options.DryRun = false
+	if summary, err = runLibrarySync(options); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if summary.Denied != 2 || summary.Copied+summary.Updated+summary.Failed != 0 {
+		t.Errorf("Expected both uploads to be denied, got %+v", summary)
+	}
+
+	options.ToHeaders = []string{"Authorization: Bearer replica"}
+	if summary, err = runLibrarySync(options); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if *summary != (librarySummary{Copied: 1, Updated: 1, Unchanged: 1}) {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	if summary, err = runLibrarySync(options); err != nil || *summary != (librarySummary{Unchanged: 3}) {
+		t.Errorf("Expected the replica to be in sync, got %+v: %v", summary, err)
+	}
+
+	// Documents that do not match their manifest are not copied
+	corrupt := createPackage("corrupt", "<h1>Corrupt</h1>")
+	corrupt = bytes.Replace(corrupt, []byte("<h1>Corrupt</h1>"), []byte("<h1>Forged!</h1>"), 1)
+	primary.put("corrupt.liv", corrupt)
+	if summary, err = runLibrarySync(options); err != nil || summary.Failed != 1 || len(replica.documents) != 4 {
+		t.Errorf("Expected the corrupt document to fail, got %+v: %v", summary, err)
+	}
+
+	if _, err := runLibrarySync(librarySyncOptions{From: "ftp://primary", To: replicaServer.URL}); err == nil {
+		t.Error("Expected a non-HTTP library to be refused")
+	}
+}
+
+func TestTalkingBookExport(t *testing.T) {
+	dir := t.TempDir()
+	htmlContent := `<h1>Guide</h1><p id="intro">Welcome.</p><h2 id="install">Install</h2><h3>Linux</h3><h2>Use</h2>`
+	script := `{"audio": "assets/audio/read.mp3", "clips": [{"id": "install", "begin": 1.5, "end": 3}, {"id": "intro", "begin": 0, "end": 1.5}]}`
+	for name, data := range map[string]string{
+		"content/index.html":    htmlContent,
+		"assets/narration.json": script,
+		"assets/audio/read.mp3": "mp3 audio",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, path.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Talking Guide", "Test Author")
+	builder.CreateDefaultSecurityPolicy()
+	builder.CreateDefaultFeatureFlags()
+	builder.AddResource("content/index.html", &core.Resource{Hash: "test-hash", Size: int64(len(htmlContent)), Type: "text/html", Path: "content/index.html"})
+	if err := builder.SaveToFile(filepath.Join(dir, "manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+	livFile := filepath.Join(t.TempDir(), "guide.liv")
+	if err := container.NewZIPContainer().CreateFromDirectory(dir, livFile); err != nil {
+		t.Fatal(err)
+	}
+
+	epubFile := filepath.Join(t.TempDir(), "guide.epub")
+	if err := runConvert(livFile, "epub-audio", epubFile, 90, "", nil, nil, ""); err != nil {
+		t.Fatalf("epub-audio export failed: %v", err)
+	}
+	archive, err := zip.OpenReader(epubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if first := archive.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("Expected an uncompressed mimetype first, got %s", first.Name)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[file.Name] = string(data)
+	}
+
+	if files["OEBPS/audio/audio/read.mp3"] != "mp3 audio" {
+		t.Errorf("Expected the narration recording in the package, got %v", files)
+	}
+	for name, fragments := range map[string][]string{
+		"OEBPS/content.opf": {
+			`media-overlay="overlay"`,
+			`<item id="audio1" href="audio/audio/read.mp3" media-type="audio/mpeg"/>`,
+			`<meta property="media:duration">0:00:03.000</meta>`,
+		},
+		"OEBPS/content.smil": {`<text src="content.xhtml#intro"/>`, `clipBegin="1.500s" clipEnd="3.000s"`},
+		"OEBPS/content.xhtml": {`<h1 id="liv-n1">Guide</h1>`},
+		"OEBPS/nav.xhtml": {
+			`<li><a href="content.xhtml#liv-n1">Guide</a>`,
+			`<li><a href="content.xhtml#liv-n2">Linux</a></li>`,
+			`<li><a href="content.xhtml#liv-n3">Use</a></li>`,
+		},
+		"OEBPS/toc.ncx": {`<meta name="dtb:depth" content="3"/>`, `<navPoint id="navpoint-4" playOrder="4">`},
+	} {
+		for _, fragment := range fragments {
+			if !strings.Contains(files[name], fragment) {
+				t.Errorf("Expected %s to contain %q, got:\n%s", name, fragment, files[name])
+			}
+		}
+	}
+	if strings.Index(files["OEBPS/content.smil"], "#intro") > strings.Index(files["OEBPS/content.smil"], "#install") {
+		t.Errorf("Expected clips in reading order, got:\n%s", files["OEBPS/content.smil"])
+	}
+}
+
+func TestConformanceExport(t *testing.T) {
+	dir := t.TempDir()
+	if err := runConformanceExport(dir); err != nil {
+		t.Fatalf("runConformanceExport failed: %v", err)
+	}
+	for _, name := range []string{conformance.IndexFile, conformance.DescriptorVectorsFile, "keys/signer.pem", "validate/minimal.liv"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be exported: %v", name, err)
+		}
+	}
+
+	if err := runConformance("true", []string{"rendering"}, nil, time.Second, false); err == nil {
+		t.Errorf("Expected unknown checks to be refused")
+	}
+}
+
+func TestInit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "field-notes")
+	if err := runInit(dir, scaffold.Options{Template: "presentation"}); err != nil {
+		t.Fatalf("runInit failed: %v", err)
+	}
+	for _, name := range []string{"liv.yaml", "content/index.html", "content/scripts/main.js", "content/static/fallback.html"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be created: %v", name, err)
+		}
+	}
+
+	if err := runInit(dir, scaffold.Options{}); err == nil {
+		t.Errorf("Expected an existing document not to be overwritten")
+	}
+}
+
+func TestSplitServeArgs(t *testing.T) {
+	cmd := serveCmd()
+	document := filepath.Join(t.TempDir(), "document.liv")
+	os.WriteFile(document, []byte("PK"), 0644)
+	if err := cmd.ParseFlags([]string{document, "--port", "9000", "--", "--job-workers", "4"}); err != nil {
+		t.Fatalf("ParseFlags failed: %v", err)
+	}
+	file, viewerArgs, err := splitServeArgs(cmd, cmd.Flags().Args())
+	if err != nil || file != document || strings.Join(viewerArgs, " ") != "--job-workers 4" {
+		t.Errorf("Unexpected split %q %q: %v", file, viewerArgs, err)
+	}
+
+	if _, _, err := splitServeArgs(serveCmd(), []string{document, document}); err == nil {
+		t.Errorf("Expected a second document to be refused")
+	}
+}
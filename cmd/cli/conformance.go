@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/conformance"
+	"github.com/spf13/cobra"
+)
+
+func conformanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "conformance",
+		Short: "Check other LIV implementations against the reference fixtures",
+		Long: `Conformance publishes the reference fixtures of the LIV format: valid and
+deliberately broken packages with the outcome this implementation gives them,
+for package validation, resource integrity and signature verification, and
+the verification descriptor vectors. Other implementations, such as the JS
+viewer or Rust tooling, prove compatibility by giving every fixture the
+expected outcome.`,
+	}
+
+	cmd.AddCommand(conformanceRunCmd())
+	cmd.AddCommand(conformanceExportCmd())
+
+	return cmd
+}
+
+func conformanceRunCmd() *cobra.Command {
+	var (
+		checks  []string
+		args    = make(map[string]*string)
+		timeout time.Duration
+		verbose bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run <tool-under-test>",
+		Short: "Run a tool against the reference fixtures",
+		Long: `Run exports the fixtures to a temporary directory and runs the tool under test
+once for each, with the arguments of the check the fixture exercises. {file}
+is replaced with the fixture and {key} with the public key signatures are
+verified with. An exit status of zero accepts the package and any other
+rejects it; the run fails unless every fixture gets the expected outcome.
+
+By default the tool is run as the liv and liv-integrity commands take their
+arguments:
+
+  validate   validate {file}
+  integrity  verify {file}
+  signature  verify-signature {file} {key}`,
+		Example: `  liv conformance run liv --checks validate
+  liv conformance run liv-integrity --checks integrity,signature
+  liv conformance run ./liv-rs --validate-args "check {file}" --signature-args "verify --key {key} {file}"
+  liv conformance run node --validate-args "viewer/validate.js {file}" --checks validate`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, argv []string) error {
+			checkArgs := make(map[string]string)
+			for check, value := range args {
+				checkArgs[check] = *value
+			}
+			return runConformance(argv[0], checks, checkArgs, timeout, verbose)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&checks, "checks", conformance.Checks, "Checks to run: "+strings.Join(conformance.Checks, ", "))
+	for _, check := range conformance.Checks {
+		args[check] = cmd.Flags().String(check+"-args", conformance.DefaultArgs[check], "Arguments of the tool for the "+check+" check")
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "Time allowed for each run of the tool")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show every fixture and the output of failed runs")
+
+	return cmd
+}
+
+func runConformance(tool string, checks []string, args map[string]string, timeout time.Duration, verbose bool) error {
+	for _, check := range checks {
+		if _, known := conformance.DefaultArgs[check]; !known {
+			return fmt.Errorf("unknown check %q, expected one of %s", check, strings.Join(conformance.Checks, ", "))
+		}
+	}
+
+	fixtures, err := conformance.Fixtures()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "liv-conformance-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := conformance.Export(dir, fixtures); err != nil {
+		return err
+	}
+
+	fmt.Printf("Running %s against conformance suite %s\n\n", tool, conformance.Version)
+	results := conformance.Run(dir, fixtures, checks, conformance.Command(tool, args, timeout))
+
+	failed := 0
+	for _, result := range results {
+		expected, got := outcome(result.Fixture.Valid), outcome(result.Accepted)
+		if result.Passed() {
+			if verbose {
+				fmt.Printf("✓ %s/%s: %s\n", result.Fixture.Check, result.Fixture.Name, got)
+			}
+			continue
+		}
+		failed++
+		if result.Err != nil {
+			fmt.Printf("✗ %s/%s: %v\n", result.Fixture.Check, result.Fixture.Name, result.Err)
+		} else {
+			fmt.Printf("✗ %s/%s: expected %s, got %s\n", result.Fixture.Check, result.Fixture.Name, expected, got)
+		}
+		fmt.Printf("  %s\n", result.Fixture.Description)
+		if verbose && strings.TrimSpace(result.Output) != "" {
+			for _, line := range strings.Split(strings.TrimSpace(result.Output), "\n") {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+	}
+
+	fmt.Printf("\nConformance Summary:\n")
+	fmt.Printf("  Passed: %d of %d fixtures\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return fmt.Errorf("%d fixtures failed", failed)
+	}
+	fmt.Printf("✓ %s conforms to the checks run\n", tool)
+	return nil
+}
+
+// outcome names whether a package is accepted
+func outcome(accepted bool) string {
+	if accepted {
+		return "accepted"
+	}
+	return "rejected"
+}
+
+func conformanceExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <dir>",
+		Short: "Write the reference fixtures to a directory",
+		Long: `Export writes the fixtures to a directory, for test suites of other
+implementations: each package under the directory of its check, the public
+keys signatures are verified with, the verification descriptor vectors, and
+` + conformance.IndexFile + `, which lists every fixture with its check, key and
+expected outcome. The fixtures are the same on every run.`,
+		Example: `  liv conformance export ./conformance`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConformanceExport(args[0])
+		},
+	}
+
+	return cmd
+}
+
+func runConformanceExport(dir string) error {
+	fixtures, err := conformance.Fixtures()
+	if err != nil {
+		return err
+	}
+	index, err := conformance.Export(dir, fixtures)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d fixtures and the %s index to %s\n", len(index.Fixtures), conformance.IndexFile, dir)
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/delta"
+	"github.com/spf13/cobra"
+)
+
+func diffCmd() *cobra.Command {
+	var (
+		outputFile string
+		verbose    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff [old.liv] [new.liv]",
+		Short: "Make a patch updating one version of a document to another",
+		Long: `Diff compares two versions of a document and writes a patch holding only the
+resources that were added or changed. Resources are compared by the hashes in
+their manifests, so unchanged and moved resources are left out, however large.
+
+Readers holding the old version apply the patch with liv patch, or upload it
+to a viewer that stores the old version. A patch only applies to the version
+it was made from; every resource is checked against its hash as it is applied.`,
+		Example: `  liv diff report-v1.liv report-v2.liv -o report-v2.livd
+  liv diff report-v1.liv report-v2.liv --verbose`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(args[0], args[1], outputFile, verbose)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output patch file (default: the new document name with "+delta.Extension+")")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "List the resources in the patch")
+
+	return cmd
+}
+
+func patchCmd() *cobra.Command {
+	var outputFile string
+
+	cmd := &cobra.Command{
+		Use:   "patch [old.liv] [patch.livd]",
+		Short: "Apply a patch made by liv diff to a document",
+		Long: `Patch rebuilds the new version of a document from the old version and a patch
+made by liv diff. Unchanged resources are copied from the old version as they
+are, and every resource is checked against its hash, so the patch fails on
+any version other than the one it was made from.`,
+		Example: `  liv patch report-v1.liv report-v2.livd -o report-v2.liv`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPatch(args[0], args[1], outputFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output document (default: the old document name with -patched.liv)")
+
+	return cmd
+}
+
+func runDiff(oldFile, newFile, outputFile string, verbose bool) error {
+	base, err := zip.OpenReader(oldFile)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", oldFile, err)
+	}
+	defer base.Close()
+	target, err := zip.OpenReader(newFile)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", newFile, err)
+	}
+	defer target.Close()
+
+	if outputFile == "" {
+		outputFile = strings.TrimSuffix(newFile, filepath.Ext(newFile)) + delta.Extension
+	}
+	patch, err := writeAtomically(outputFile, func(w io.Writer) (*delta.Patch, error) {
+		return delta.Diff(&base.Reader, &target.Reader, w)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to make patch: %v", err)
+	}
+
+	info, err := os.Stat(outputFile)
+	if err != nil {
+		return err
+	}
+	summary := patch.Summarize()
+	fmt.Printf("✓ Patch written\n")
+	fmt.Printf("  Changed: %d, added: %d, moved: %d, removed: %d, unchanged: %d\n",
+		summary.Changed, summary.Added, summary.Moved, summary.Removed, summary.Unchanged)
+	fmt.Printf("  Carried: %s of resources, %s reused from the old version\n", formatBytes(summary.Included), formatBytes(summary.Reused))
+	fmt.Printf("  Patch size: %s\n", formatBytes(info.Size()))
+	if verbose {
+		for _, name := range patch.Names() {
+			fmt.Printf("    + %s\n", name)
+		}
+		for _, name := range patch.Removed {
+			fmt.Printf("    - %s\n", name)
+		}
+	}
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
+
+func runPatch(oldFile, patchFile, outputFile string) error {
+	base, err := zip.OpenReader(oldFile)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", oldFile, err)
+	}
+	defer base.Close()
+	patchData, err := os.Open(patchFile)
+	if err != nil {
+		return fmt.Errorf("failed to open patch: %v", err)
+	}
+	defer patchData.Close()
+	info, err := patchData.Stat()
+	if err != nil {
+		return err
+	}
+	pr, err := delta.NewReader(patchData, info.Size())
+	if err != nil {
+		return err
+	}
+
+	if outputFile == "" {
+		outputFile = strings.TrimSuffix(oldFile, filepath.Ext(oldFile)) + "-patched.liv"
+	}
+	_, err = writeAtomically(outputFile, func(w io.Writer) (*delta.Patch, error) {
+		return pr.Patch, pr.Apply(&base.Reader, w, 0)
+	})
+	if errors.Is(err, delta.ErrBaseMismatch) {
+		return fmt.Errorf("cannot patch %s: %v", oldFile, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %v", err)
+	}
+
+	summary := pr.Patch.Summarize()
+	fmt.Printf("✓ Patch applied\n")
+	fmt.Printf("  Changed: %d, added: %d, moved: %d, removed: %d, unchanged: %d\n",
+		summary.Changed, summary.Added, summary.Moved, summary.Removed, summary.Unchanged)
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
+
+// writeAtomically writes a file in one step, so a failed write leaves the
+// file as it was; with --backup the file it replaces is kept
+func writeAtomically(path string, write func(w io.Writer) (*delta.Patch, error)) (*delta.Patch, error) {
+	out, err := atomicfile.Create(path, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	out.Backup = keepBackups
+	patch, err := write(out)
+	if err != nil {
+		return nil, err
+	}
+	return patch, out.Commit()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func devCmd() *cobra.Command {
+	var (
+		port       int
+		outputFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dev [dir]",
+		Short: "Preview a document with live reload while editing it",
+		Long: `Dev builds the document in a source directory, serves it in the web viewer
+and rebuilds it whenever a source file changes. Open viewers reload over a
+WebSocket as soon as the rebuilt document is ready.`,
+		Example: `  liv dev ./my-doc
+  liv dev ./my-doc --port 3000
+  liv dev ./my-doc --output preview.liv`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			inputDir := "."
+			if len(args) > 0 {
+				inputDir = args[0]
+			}
+			return runDev(inputDir, port, outputFile)
+		},
+	}
+
+	cmd.Flags().IntVarP(&port, "port", "p", 8080, "Port for the dev server")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Keep the built document at this path (default: a temporary file)")
+
+	return cmd
+}
+
+func runDev(inputDir string, port int, outputFile string) error {
+	if info, err := os.Stat(inputDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("source directory not found: %s", inputDir)
+	}
+
+	builderPath, err := findBuilderExecutable()
+	if err != nil {
+		return fmt.Errorf("builder not found: %v", err)
+	}
+	viewerPath, err := findViewerExecutable()
+	if err != nil {
+		return fmt.Errorf("viewer not found: %v", err)
+	}
+
+	if outputFile == "" {
+		tempDir, err := os.MkdirTemp("", "liv-dev-*")
+		if err != nil {
+			return fmt.Errorf("failed to create build directory: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		name := "document"
+		if abs, err := filepath.Abs(inputDir); err == nil {
+			name = filepath.Base(abs)
+		}
+		outputFile = filepath.Join(tempDir, name+".liv")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	builder, err := startChild(exec.Command(builderPath, "--input", inputDir, "--output", outputFile, "--watch"))
+	if err != nil {
+		return fmt.Errorf("failed to start builder: %v", err)
+	}
+	defer builder.stop()
+
+	// The viewer needs a document to serve; the builder keeps watching after a
+	// failed build, so wait until a fix produces one
+	if !packageReady(outputFile) {
+		fmt.Println("Waiting for the first successful build...")
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !packageReady(outputFile) {
+		select {
+		case <-builder.done:
+			return fmt.Errorf("builder exited: %v", builder.err)
+		case <-signals:
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	viewer, err := startChild(exec.Command(viewerPath, "--web", "--port", fmt.Sprintf("%d", port), "--live-reload", "--health-interval", "0", outputFile))
+	if err != nil {
+		return fmt.Errorf("failed to start viewer: %v", err)
+	}
+	defer viewer.stop()
+
+	fmt.Printf("\nPreview at http://localhost:%d/viewer?file=%s\n", port, url.QueryEscape(filepath.Base(outputFile)))
+	fmt.Printf("Edits in %s reload the preview (Ctrl+C to stop)\n", inputDir)
+
+	select {
+	case <-builder.done:
+		return fmt.Errorf("builder exited: %v", builder.err)
+	case <-viewer.done:
+		return fmt.Errorf("viewer exited: %v", viewer.err)
+	case <-signals:
+		fmt.Println("\nStopping dev server")
+		return nil
+	}
+}
+
+// packageReady reports whether a complete package has been written
+func packageReady(path string) bool {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if strings.EqualFold(file.Name, "manifest.json") {
+			return true
+		}
+	}
+	return false
+}
+
+// child is a subprocess sharing the terminal; done is closed when it exits
+type child struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+func startChild(cmd *exec.Cmd) (*child, error) {
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := &child{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		c.err = c.cmd.Wait()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// stop interrupts the process, killing it if it does not exit promptly
+func (c *child) stop() {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	if err := c.cmd.Process.Signal(os.Interrupt); err != nil {
+		c.cmd.Process.Kill()
+	}
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+		c.cmd.Process.Kill()
+		<-c.done
+	}
+}
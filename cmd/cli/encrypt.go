@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/encryption"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/verification"
+	"github.com/spf13/cobra"
+)
+
+// encryptOptions say who can open an encrypted document
+type encryptOptions struct {
+	// Recipients are PEM files of RSA public keys the content key is wrapped for
+	Recipients []string
+	Password   passwordOptions
+	// KDF derives the key of the password: argon2id or pbkdf2
+	KDF string
+}
+
+func encryptCmd() *cobra.Command {
+	var (
+		outputFile string
+		opts       encryptOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "encrypt [file]",
+		Short: "Encrypt the content of a document",
+		Long: `Encrypt seals the content and assets of a document with AES-256-GCM under a
+random content key, wrapped for a password and for the RSA public keys of
+recipients. The password is derived with Argon2id unless --kdf pbkdf2 is
+given, for readers of older viewers.
+
+The password is read from --password-file or LIV_PASSWORD, or asked for on
+the terminal. With --recipient the document opens only with the private keys
+of the recipients, unless a password is given too.
+
+The manifest stays readable, so viewers know how to decrypt the document; the
+viewer asks readers for the password or private key and decrypts in the
+browser. The signatures no longer match and are removed: sign the encrypted
+document again, its signatures then cover the ciphertext.`,
+		Example: `  liv encrypt report.liv -o report-locked.liv
+  LIV_PASSWORD=... liv encrypt report.liv
+  liv encrypt report.liv --recipient alice.pub --recipient bob.pub`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEncrypt(args[0], outputFile, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: overwrite input)")
+	cmd.Flags().StringArrayVar(&opts.Recipients, "recipient", nil, "RSA public key file of a reader who can decrypt the document (repeatable)")
+	cmd.Flags().StringVar(&opts.Password.File, "password-file", "", "File holding the password on its first line")
+	cmd.Flags().StringVar(&opts.KDF, "kdf", "argon2id", "Password key derivation: argon2id or pbkdf2")
+
+	return cmd
+}
+
+func decryptCmd() *cobra.Command {
+	var (
+		outputFile string
+		keyFile    string
+		password   passwordOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "decrypt [file]",
+		Short: "Decrypt an encrypted document",
+		Long: `Decrypt restores the plaintext content of a document encrypted with liv
+encrypt, using its password or, with --key, the RSA private key of a
+recipient. The password is read from --password-file or LIV_PASSWORD, or
+asked for on the terminal.
+
+The signatures of the encrypted document cover the ciphertext and are removed.`,
+		Example: `  liv decrypt report-locked.liv -o report.liv
+  liv decrypt report-locked.liv --key alice.pem`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDecrypt(args[0], outputFile, keyFile, password)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: overwrite input)")
+	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "RSA private key file of a recipient")
+	cmd.Flags().StringVar(&password.File, "password-file", "", "File holding the password on its first line")
+
+	return cmd
+}
+
+func runEncrypt(livFile, outputFile string, opts encryptOptions) error {
+	if outputFile == "" {
+		outputFile = livFile
+	}
+	if opts.KDF != "argon2id" && opts.KDF != "pbkdf2" {
+		return fmt.Errorf("unknown key derivation %q (argon2id or pbkdf2)", opts.KDF)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	m, err := readEditableManifest(files)
+	if err != nil {
+		return err
+	}
+	if m.Encryption != nil {
+		return fmt.Errorf("document is already encrypted")
+	}
+
+	key, err := encryption.GenerateContentKey()
+	if err != nil {
+		return err
+	}
+	var recipients []*core.KeyRecipient
+	var unlocks []string
+	sm := integrity.NewSignatureManager()
+	for _, file := range opts.Recipients {
+		publicKey, err := sm.LoadPublicKeyPEM(file)
+		if err != nil {
+			return fmt.Errorf("failed to load recipient key %s: %v", file, err)
+		}
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("recipient key %s is not an RSA key; content keys are wrapped with RSA-OAEP", file)
+		}
+		keyID := sm.KeyID(rsaKey)
+		recipient, err := encryption.WrapKeyForPublicKey(key, rsaKey, keyID)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, recipient)
+		unlocks = append(unlocks, "key "+keyID)
+	}
+	if len(recipients) == 0 || opts.Password.given() {
+		password, err := opts.Password.read(true)
+		if err != nil {
+			return err
+		}
+		var recipient *core.KeyRecipient
+		if opts.KDF == "pbkdf2" {
+			recipient, err = encryption.WrapKeyWithPassword(key, password, 0)
+		} else {
+			recipient, err = encryption.WrapKeyWithArgon2id(key, password, encryption.DefaultArgon2Params)
+		}
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, recipient)
+		unlocks = append(unlocks, "password ("+recipient.KDF+")")
+	}
+
+	signers := packageSigners(files)
+	var paths []string
+	for entry := range files {
+		if entry != "manifest.json" && !strings.HasPrefix(entry, "signatures/") {
+			paths = append(paths, entry)
+		}
+	}
+	sort.Strings(paths)
+	if err := encryption.EncryptPackage(files, m, paths, key, 0, recipients...); err != nil {
+		return err
+	}
+	if err := writePackage(files, m, outputFile); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Document encrypted\n")
+	fmt.Printf("  Resources: %d encrypted with %s\n", len(paths), encryption.AlgorithmAES256GCM)
+	fmt.Printf("  Unlocks with: %s\n", strings.Join(unlocks, ", "))
+	if signers > 0 {
+		fmt.Printf("⚠ Signatures removed: the signatures of %d signers cover the plaintext; sign the encrypted document again with liv sign\n", signers)
+	}
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
+
+func runDecrypt(livFile, outputFile, keyFile string, password passwordOptions) error {
+	if outputFile == "" {
+		outputFile = livFile
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	m, err := readEditableManifest(files)
+	if err != nil {
+		return err
+	}
+	if m.Encryption == nil {
+		return fmt.Errorf("document is not encrypted")
+	}
+
+	var key []byte
+	if keyFile != "" {
+		privateKey, err := integrity.NewSignatureManager().LoadPrivateKeyPEM(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load private key: %v", err)
+		}
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("private key %s is not an RSA key", keyFile)
+		}
+		if key, err = encryption.UnwrapKeyWithPrivateKey(m.Encryption, rsaKey); err != nil {
+			return err
+		}
+	} else {
+		secret, err := password.read(false)
+		if err != nil {
+			return err
+		}
+		if key, err = encryption.UnwrapKeyWithPassword(m.Encryption, secret); err != nil {
+			return err
+		}
+	}
+
+	resources := len(m.Encryption.Resources)
+	signers := packageSigners(files)
+	if err := encryption.DecryptPackage(files, m, key); err != nil {
+		return err
+	}
+	if err := writePackage(files, m, outputFile); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Document decrypted\n")
+	fmt.Printf("  Resources: %d decrypted\n", resources)
+	if signers > 0 {
+		fmt.Printf("⚠ Signatures removed: the signatures of %d signers cover the ciphertext\n", signers)
+	}
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
+
+// packageSigners returns the number of signers of an extracted package
+func packageSigners(files map[string][]byte) int {
+	signatures, err := container.ReadSignatureFiles(files)
+	if err != nil || signatures.ManifestSignature == "" {
+		return 0
+	}
+	return 1 + len(signatures.CounterSignatures)
+}
+
+// outputContainer returns the container documents are written with,
+// keeping the ones they replace with --backup
+func outputContainer() *container.ZIPContainer {
+	return container.NewZIPContainer().SetBackup(keepBackups)
+}
+
+// writeFiles writes a rewritten package to outputFile, bringing its
+// verification descriptor up to date first
+func writeFiles(files map[string][]byte, outputFile string) error {
+	if err := verification.Refresh(files); err != nil {
+		return err
+	}
+	return outputContainer().CreateFromFiles(files, outputFile)
+}
+
+// writePackage writes an extracted package with its rewritten manifest and
+// without its signatures, which no longer match it
+func writePackage(files map[string][]byte, m *core.Manifest, outputFile string) error {
+	manifestData, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %v", err)
+	}
+	files["manifest.json"] = manifestData
+	for entry := range files {
+		if strings.HasPrefix(entry, "signatures/") {
+			delete(files, entry)
+		}
+	}
+	if err := writeFiles(files, outputFile); err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/transfer"
+	"github.com/spf13/cobra"
+)
+
+func fetchCmd() *cobra.Command {
+	var (
+		outputFile string
+		retries    int
+		headers    []string
+		version    string
+		keyFiles   []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fetch [url]",
+		Short: "Download a document, resuming interrupted downloads",
+		Long: `Fetch downloads a document over HTTP. Interrupted downloads are resumed with
+range requests, both within one run and when fetch is run again with the same
+output, as long as the document on the server has not changed.
+
+When the server publishes a chunk manifest, every chunk is checked against
+its SHA-256 as it arrives and the whole document once complete. Corrupt
+chunks are downloaded again. The document only appears at the output path
+once it is complete.
+
+With --verify-key the document is verified before it appears: every resource
+must match the manifest, and the document must be signed with one of the keys
+and unchanged since. Fetch fails otherwise, so scripts and CI jobs only ever
+see verified documents.
+
+The URL may also be a publishing descriptor listing the released versions of
+a document with their hashes. Fetch then downloads the version given with
+--version, or the latest, and refuses bytes that do not match its hash.`,
+		Example: `  liv fetch https://docs.example.com/api/document?id=abc123&download=true
+  liv fetch https://docs.example.com/report.liv --output reports/
+  liv fetch https://docs.example.com/report.liv --header "Authorization: Bearer $TOKEN"
+  liv fetch https://docs.example.com/report.liv --verify-key publisher.pem
+  liv fetch https://docs.example.com/report.json --version 1.2.0 --verify-key publisher.pem`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runFetch(args[0], outputFile, retries, headers, version, keyFiles)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file or directory (default: the name given by the server)")
+	cmd.Flags().IntVar(&retries, "retries", 5, "Times to resume an interrupted download")
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", nil, `Extra request header, as "Name: value"`)
+	cmd.Flags().StringVar(&version, "version", "", "Version to fetch from a publishing descriptor (default: the latest)")
+	cmd.Flags().StringArrayVar(&keyFiles, "verify-key", nil, "Public key the document must be signed with (repeatable)")
+
+	return cmd
+}
+
+func runFetch(rawURL, outputFile string, retries int, headers []string, version string, keyFiles []string) error {
+	sm := integrity.NewSignatureManager()
+	keys, err := loadVerificationKeys(sm, keyFiles)
+	if err != nil {
+		return err
+	}
+
+	fetcher := transfer.NewFetcher()
+	fetcher.Retries = retries
+	fetcher.Backup = keepBackups
+	if fetcher.Header, err = parseHeaders(headers); err != nil {
+		return err
+	}
+
+	fmt.Printf("Fetching %s\n", rawURL)
+	ctx := context.Background()
+	remote, err := fetcher.Probe(ctx, rawURL)
+	if err != nil {
+		return fmt.Errorf("failed to reach document: %v", err)
+	}
+
+	// Publishing descriptors pin the hash of each version
+	var published *transfer.PublishedVersion
+	if transfer.IsDescriptor(remote) {
+		descriptor, err := fetcher.FetchDescriptor(ctx, rawURL)
+		if err != nil {
+			return err
+		}
+		if published, err = descriptor.Resolve(version); err != nil {
+			return err
+		}
+		fmt.Printf("Resolved %s %s\n", descriptor.Name, published.Version)
+		if remote, err = fetcher.ProbeVersion(ctx, published); err != nil {
+			return fmt.Errorf("failed to reach document: %v", err)
+		}
+	} else if version != "" {
+		return fmt.Errorf("--version requires a publishing descriptor, but %s is a document", rawURL)
+	}
+
+	var verification *fetchVerification
+	if len(keys) > 0 {
+		pinnedKeyID := ""
+		if published != nil {
+			pinnedKeyID = published.KeyID
+		}
+		fetcher.Verify = func(path string) error {
+			var err error
+			verification, err = verifyFetchedDocument(sm, path, keys, pinnedKeyID)
+			if err != nil {
+				return fmt.Errorf("verification failed: %v", err)
+			}
+			return nil
+		}
+	}
+
+	filename := remote.Filename
+	if filename == "" {
+		filename = "document.liv"
+	}
+	switch info, err := os.Stat(outputFile); {
+	case outputFile == "":
+		outputFile = filename
+	case err == nil && info.IsDir():
+		outputFile = filepath.Join(outputFile, filename)
+	}
+
+	percent := -1
+	fetcher.Progress = func(written, total int64) {
+		if total <= 0 {
+			return
+		}
+		if p := int(written * 100 / total); p != percent {
+			percent = p
+			fmt.Printf("\r  %d%% of %s", p, formatBytes(total))
+		}
+	}
+
+	result, err := fetcher.Fetch(ctx, remote, outputFile)
+	if percent >= 0 {
+		fmt.Println()
+	}
+	if err != nil {
+		if _, statErr := os.Stat(outputFile + ".part"); statErr == nil {
+			return fmt.Errorf("download failed: %v (run fetch again to resume)", err)
+		}
+		return fmt.Errorf("download failed: %v", err)
+	}
+
+	fmt.Printf("✓ Document downloaded\n")
+	if result.Resumed > 0 {
+		fmt.Printf("  Resumed after: %s\n", formatBytes(result.Resumed))
+	}
+	fmt.Printf("  Size: %s\n", formatBytes(result.Size))
+	fmt.Printf("  SHA-256: %s\n", result.SHA256)
+	if result.Verified {
+		fmt.Printf("  Verified: %d chunks\n", len(remote.Manifest.Chunks))
+	} else {
+		fmt.Printf("  Verified: no chunk manifest published\n")
+	}
+	if published != nil {
+		fmt.Printf("  Version: %s (pinned by the publishing descriptor)\n", published.Version)
+	}
+	if verification != nil {
+		fmt.Printf("  Integrity: %d resources match the manifest\n", verification.Resources)
+		for i, signer := range verification.Signers {
+			status := string(signer.Status)
+			if signer.Signer != nil {
+				status = signer.Signer.Summary() + ": " + status
+			}
+			fmt.Printf("  Signer %d: %s\n", i+1, status)
+			for _, warning := range signer.Warnings {
+				fmt.Printf("    Warning: %s\n", warning)
+			}
+		}
+	} else {
+		fmt.Printf("  Signatures: not verified (no --verify-key given)\n")
+	}
+	fmt.Printf("  Output: %s\n", outputFile)
+
+	return nil
+}
+
+// loadVerificationKeys reads the public keys given with --verify-key
+func loadVerificationKeys(sm *integrity.SignatureManager, keyFiles []string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for _, keyFile := range keyFiles {
+		key, err := sm.LoadPublicKeyPEM(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load verification key %s: %v", keyFile, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// parseHeaders parses extra request headers given as "Name: value"
+func parseHeaders(headers []string) (http.Header, error) {
+	parsed := make(http.Header)
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", header)
+		}
+		parsed.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return parsed, nil
+}
+
+// fetchVerification is what was verified of a fetched document
+type fetchVerification struct {
+	Resources int
+	Signers   []*integrity.SignerVerificationResult
+}
+
+// verifyFetchedDocument checks a downloaded document before it is moved into
+// place. Every resource must match the manifest, the first signer must have
+// signed with one of keys, or with the key pinned by keyID when set, and no
+// signature may be invalid.
+func verifyFetchedDocument(sm *integrity.SignatureManager, packagePath string, keys []crypto.PublicKey, keyID string) (*fetchVerification, error) {
+	files, parsedManifest, err := readIntactPackage(packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures, err := container.ReadSignatureFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	if signatures.ManifestSignature == "" {
+		return nil, fmt.Errorf("document is not signed")
+	}
+	document := &core.LIVDocument{
+		Manifest: parsedManifest,
+		Content: &core.DocumentContent{
+			HTML:            getFileContentSafe(files, "content/index.html"),
+			CSS:             getFileContentSafe(files, "content/styles/main.css"),
+			InteractiveSpec: getFileContentSafe(files, "content/scripts/main.js"),
+			StaticFallback:  getFileContentSafe(files, "content/static/fallback.html"),
+		},
+		WASMModules: make(map[string][]byte),
+		Signatures:  signatures,
+	}
+	for name, data := range files {
+		if path.Ext(name) == ".wasm" {
+			document.WASMModules[strings.TrimSuffix(path.Base(name), ".wasm")] = data
+		}
+	}
+
+	if keyID != "" {
+		var pinned crypto.PublicKey
+		for _, key := range keys {
+			if sm.KeyID(key) == keyID {
+				pinned = key
+			}
+		}
+		if pinned == nil {
+			return nil, fmt.Errorf("the publishing descriptor pins signing key %s, which is not among the verification keys", keyID)
+		}
+		if result := sm.VerifyDocument(document, pinned); !result.Valid {
+			return nil, fmt.Errorf("document is not signed with key %s: %s", keyID, strings.Join(result.Errors, "; "))
+		}
+	}
+
+	signers := sm.VerifySigners(document, keys)
+	for i, signer := range signers {
+		switch {
+		case i == 0 && signer.Signer == nil && signer.Status != integrity.SignerValid:
+			// Without signer metadata a failure may only mean another key signed
+			return nil, fmt.Errorf("document is not signed with any of the verification keys")
+		case signer.Status == integrity.SignerInvalid:
+			return nil, fmt.Errorf("signature of signer %d is invalid: %s", i+1, strings.Join(signer.Errors, "; "))
+		case i == 0 && signer.Status != integrity.SignerValid:
+			return nil, fmt.Errorf("document is not signed with any of the verification keys")
+		}
+	}
+	return &fetchVerification{Resources: len(parsedManifest.Resources), Signers: signers}, nil
+}
+
+// readIntactPackage reads a downloaded package and checks that every resource
+// matches its manifest
+func readIntactPackage(packagePath string) (map[string][]byte, *core.Manifest, error) {
+	files, err := container.NewZIPContainer().ExtractToMemory(packagePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid document package: %v", err)
+	}
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return nil, nil, fmt.Errorf("manifest.json not found in document")
+	}
+	parsedManifest, err := manifest.NewManifestParser().ParseFromBytes(manifestData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	result := integrity.NewIntegrityValidator().ValidateResources(parsedManifest.Resources, files)
+	if !result.IsValid {
+		return nil, nil, fmt.Errorf("document does not match its manifest: %s", strings.Join(result.Errors, "; "))
+	}
+	return files, parsedManifest, nil
+}
+
+// formatBytes renders a byte count for people
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
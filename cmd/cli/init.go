@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/scaffold"
+	"github.com/spf13/cobra"
+)
+
+func initCmd() *cobra.Command {
+	var (
+		opts scaffold.Options
+		list bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init [template] [directory]",
+		Short: "Create the source tree of a new document",
+		Long: `Init writes the source tree of a new document to a directory, the current one
+by default: content/index.html, a stylesheet, a static fallback for viewers
+that do not run scripts and a liv.yaml with the title, author and language.
+The tree builds with liv build as it is.
+
+Built-in templates:
+` + templateList() + `
+Other names are looked up in the template library, where liv template install
+puts templates. With --wasm, an example WebAssembly module and the script
+calling it are added.`,
+		Example: `  liv init
+  liv init report annual-report --title "Annual Report 2024" --author "Finance Team"
+  liv init interactive demo --wasm
+  liv init --list`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if list {
+				fmt.Print(templateList())
+				return nil
+			}
+			dir := "."
+			if len(args) > 0 {
+				opts.Template = args[0]
+			}
+			if len(args) > 1 {
+				dir = args[1]
+			}
+			return runInit(dir, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Title, "title", "", "Document title (default: from the directory name)")
+	cmd.Flags().StringVar(&opts.Author, "author", "", "Document author")
+	cmd.Flags().StringVar(&opts.Language, "language", "en", "Two letter code of the document language")
+	cmd.Flags().BoolVar(&opts.WASM, "wasm", false, "Add an example WebAssembly module")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "Write into a directory that is not empty, replacing files of the same name")
+	cmd.Flags().StringVar(&opts.LibraryDir, "library", "", "Template library directory (default ~/.liv/templates)")
+	cmd.Flags().BoolVar(&list, "list", false, "List the built-in templates")
+
+	return cmd
+}
+
+// templateList describes the built-in templates, one per line
+func templateList() string {
+	var list strings.Builder
+	for _, name := range scaffold.Templates() {
+		fmt.Fprintf(&list, "  %-13s %s\n", name, scaffold.Describe(name))
+	}
+	return list.String()
+}
+
+func runInit(dir string, opts scaffold.Options) error {
+	written, err := scaffold.Scaffold(dir, opts)
+	if err != nil {
+		return err
+	}
+
+	template := opts.Template
+	if template == "" {
+		template = scaffold.DefaultTemplate
+	}
+	fmt.Printf("Created a %s document in %s\n", template, dir)
+	for _, path := range written {
+		fmt.Printf("  %s\n", path)
+	}
+
+	name := filepath.Base(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		name = filepath.Base(abs)
+	}
+	fmt.Printf("\nBuild it with:\n  liv build --input %s --output %s.liv\n", dir, name)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/spf13/cobra"
+)
+
+func inspectCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect [file]",
+		Short: "Summarize a document",
+		Long: `Inspect prints what a document is about and how it is packaged: its title,
+authors, keywords and subjects, and its resources, signatures and encryption.
+Use liv meta get for the metadata as JSON and liv validate to check it.`,
+		Example: `  liv inspect report.liv`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := container.NewZIPContainer().ExtractToMemory(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to extract document: %v", err)
+			}
+			m, err := readEditableManifest(files)
+			if err != nil {
+				return err
+			}
+			printInspection(cmd.OutOrStdout(), m, packageSigners(files))
+			return nil
+		},
+	}
+}
+
+// printInspection writes the summary of a document with its manifest and
+// number of signers
+func printInspection(w io.Writer, m *core.Manifest, signers int) {
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%-11s %s\n", name+":", value)
+		}
+	}
+	if metadata := m.Metadata; metadata != nil {
+		field("Title", metadata.Title)
+		field("Authors", metadata.AuthorNames())
+		field("Version", metadata.Version)
+		field("Language", metadata.Language)
+		if !metadata.Modified.IsZero() {
+			field("Modified", metadata.Modified.UTC().Format(time.RFC3339))
+		}
+		field("Keywords", strings.Join(metadata.Keywords, ", "))
+		name := "Subjects:"
+		for _, subject := range metadata.Subjects {
+			if subject == nil || subject.String() == "" {
+				continue
+			}
+			heading := subject.String()
+			if subject.Scheme != "" && subject.Label != "" {
+				heading += fmt.Sprintf(" (%s %s)", strings.ToUpper(subject.Scheme), subject.Code)
+			}
+			// Further subjects line up under the first
+			fmt.Fprintf(w, "%-11s %s\n", name, heading)
+			name = ""
+		}
+	}
+
+	var size int64
+	for _, resource := range m.Resources {
+		if resource != nil {
+			size += resource.Size
+		}
+	}
+	field("Resources", fmt.Sprintf("%d (%s)", len(m.Resources), formatBytes(size)))
+	switch signers {
+	case 0:
+		field("Signed", "no")
+	case 1:
+		field("Signed", "yes")
+	default:
+		field("Signed", fmt.Sprintf("yes, %d signers", signers))
+	}
+	if m.Encryption != nil {
+		field("Encrypted", fmt.Sprintf("yes, %d resources", len(m.Encryption.Resources)))
+	}
+}
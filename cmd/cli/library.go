@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/transfer"
+	"github.com/spf13/cobra"
+)
+
+func libraryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "library",
+		Short: "Manage document libraries served by liv-viewer",
+		Long: `A library is the document store of a liv-viewer server. Library commands
+work against running servers over HTTP, with the permissions of the
+credentials they are given.`,
+	}
+
+	cmd.AddCommand(librarySyncCmd())
+
+	return cmd
+}
+
+func librarySyncCmd() *cobra.Command {
+	var options librarySyncOptions
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Copy missing and updated documents from one library to another",
+		Long: `Sync makes a replica library hold every document of a primary library. The
+inventories of both are compared by content hash: documents the replica does
+not have are copied, and documents whose filename the replica has with other
+content are copied as updates. Nothing is deleted from the replica.
+
+Every copy is downloaded with its hash pinned to the primary's inventory and
+checked against its manifest before it is uploaded. With --verify-key it must
+also be signed with one of the keys.
+
+Each library is accessed with its own credentials, given with --from-header
+and --to-header, so sync sees only the documents the primary lets its
+credentials read and is refused uploads the replica does not allow. Refused
+uploads are reported and do not stop the sync.`,
+		Example: `  liv library sync --from https://primary.example.com --to https://replica.example.com
+  liv library sync --from https://primary.example.com --to https://replica.example.com \
+    --from-header "Cookie: liv_session=$PRIMARY" --to-header "Cookie: liv_session=$REPLICA"
+  liv library sync --from https://primary.example.com --to https://replica.example.com --dry-run`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			summary, err := runLibrarySync(options)
+			if err != nil {
+				return err
+			}
+			if summary.Failed > 0 {
+				return fmt.Errorf("%d documents failed to sync", summary.Failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&options.From, "from", "", "URL of the primary library")
+	cmd.Flags().StringVar(&options.To, "to", "", "URL of the replica library")
+	cmd.Flags().StringArrayVar(&options.FromHeaders, "from-header", nil, `Extra request header for the primary, as "Name: value"`)
+	cmd.Flags().StringArrayVar(&options.ToHeaders, "to-header", nil, `Extra request header for the replica, as "Name: value"`)
+	cmd.Flags().StringArrayVar(&options.KeyFiles, "verify-key", nil, "Public key every copied document must be signed with (repeatable)")
+	cmd.Flags().IntVar(&options.Retries, "retries", 5, "Times to resume an interrupted download")
+	cmd.Flags().BoolVar(&options.DryRun, "dry-run", false, "Only report what would be copied")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// librarySyncOptions configures a library sync
+type librarySyncOptions struct {
+	From        string
+	To          string
+	FromHeaders []string
+	ToHeaders   []string
+	KeyFiles    []string
+	Retries     int
+	DryRun      bool
+}
+
+// librarySummary counts what a sync did with the documents of the primary
+type librarySummary struct {
+	Copied    int
+	Updated   int
+	Unchanged int
+	// Denied documents were refused by the replica
+	Denied int
+	Failed int
+}
+
+// libraryDocument is an entry of a library inventory
+type libraryDocument struct {
+	ID       string    `json:"id"`
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Uploaded time.Time `json:"uploaded"`
+}
+
+// syncAction is a document to copy to the replica
+type syncAction struct {
+	Document libraryDocument
+	// Update is set when the replica holds other content under the filename
+	Update bool
+}
+
+// planLibrarySync compares two inventories by content hash. Documents of the
+// primary listed more than once are copied once.
+func planLibrarySync(primary, replica []libraryDocument) (actions []syncAction, unchanged int) {
+	hashes := make(map[string]bool)
+	filenames := make(map[string]bool)
+	for _, doc := range replica {
+		hashes[strings.ToLower(doc.SHA256)] = true
+		filenames[doc.Filename] = true
+	}
+	for _, doc := range primary {
+		hash := strings.ToLower(doc.SHA256)
+		if hashes[hash] {
+			unchanged++
+			continue
+		}
+		hashes[hash] = true
+		actions = append(actions, syncAction{Document: doc, Update: filenames[doc.Filename]})
+	}
+	return actions, unchanged
+}
+
+func runLibrarySync(options librarySyncOptions) (*librarySummary, error) {
+	sm := integrity.NewSignatureManager()
+	keys, err := loadVerificationKeys(sm, options.KeyFiles)
+	if err != nil {
+		return nil, err
+	}
+	primary, err := newLibraryClient(options.From, options.FromHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("invalid primary library: %v", err)
+	}
+	replica, err := newLibraryClient(options.To, options.ToHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replica library: %v", err)
+	}
+
+	ctx := context.Background()
+	primaryDocs, err := primary.inventory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary library: %v", err)
+	}
+	replicaDocs, err := replica.inventory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica library: %v", err)
+	}
+
+	actions, unchanged := planLibrarySync(primaryDocs, replicaDocs)
+	summary := &librarySummary{Unchanged: unchanged}
+	fmt.Printf("Syncing %s to %s: %d documents, %d to copy\n", primary.base, replica.base, len(primaryDocs), len(actions))
+
+	dir, err := os.MkdirTemp("", "liv-sync-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, action := range actions {
+		doc := action.Document
+		verb := "Copy"
+		if action.Update {
+			verb = "Update"
+		}
+		if options.DryRun {
+			fmt.Printf("  %s %s (%s)\n", verb, doc.Filename, formatBytes(doc.Size))
+			continue
+		}
+
+		err := syncDocument(ctx, primary, replica, doc, filepath.Join(dir, doc.ID+".liv"), options.Retries, func(path string) error {
+			if len(keys) > 0 {
+				_, err := verifyFetchedDocument(sm, path, keys, "")
+				return err
+			}
+			_, _, err := readIntactPackage(path)
+			return err
+		})
+		var statusErr *transfer.StatusError
+		switch {
+		case err == nil && action.Update:
+			summary.Updated++
+		case err == nil:
+			summary.Copied++
+		case errors.As(err, &statusErr) && statusErr.URL == replica.url("/api/upload") && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden):
+			summary.Denied++
+		default:
+			summary.Failed++
+		}
+		if err != nil {
+			fmt.Printf("  ✗ %s %s: %v\n", verb, doc.Filename, err)
+		} else {
+			fmt.Printf("  ✓ %s %s (%s)\n", verb, doc.Filename, formatBytes(doc.Size))
+		}
+	}
+
+	if options.DryRun {
+		fmt.Printf("Dry run: %d to copy, %d unchanged\n", len(actions), summary.Unchanged)
+		return summary, nil
+	}
+	fmt.Printf("Copied %d, updated %d, unchanged %d, denied %d, failed %d\n",
+		summary.Copied, summary.Updated, summary.Unchanged, summary.Denied, summary.Failed)
+	return summary, nil
+}
+
+// syncDocument downloads a document of the primary, pinned to its inventory
+// hash and checked with verify, and uploads it to the replica
+func syncDocument(ctx context.Context, primary, replica *libraryClient, doc libraryDocument, dest string, retries int, verify func(path string) error) error {
+	// Document content is only served to viewers holding the document open
+	lease, err := primary.openViewing(ctx, doc.ID)
+	if err != nil {
+		return err
+	}
+	if lease != "" {
+		defer primary.closeViewing(ctx, lease)
+	}
+
+	fetcher := transfer.NewFetcher()
+	fetcher.Retries = retries
+	fetcher.Header = primary.header
+	fetcher.Verify = verify
+	remote, err := fetcher.Probe(ctx, primary.url("/api/document?id="+url.QueryEscape(doc.ID)+"&download=true"))
+	if err != nil {
+		return fmt.Errorf("failed to reach document: %v", err)
+	}
+	remote.SHA256 = strings.ToLower(doc.SHA256)
+	if _, err := fetcher.Fetch(ctx, remote, dest); err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	defer os.Remove(dest)
+
+	return replica.upload(ctx, dest, doc.Filename)
+}
+
+// libraryClient talks to the HTTP API of a liv-viewer library
+type libraryClient struct {
+	base   string
+	header http.Header
+	client *http.Client
+}
+
+func newLibraryClient(rawURL string, headers []string) (*libraryClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("expected an http or https URL, got %q", rawURL)
+	}
+	header, err := parseHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	return &libraryClient{base: strings.TrimSuffix(u.String(), "/"), header: header, client: &http.Client{}}, nil
+}
+
+func (c *libraryClient) url(path string) string {
+	return c.base + path
+}
+
+func (c *libraryClient) do(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.client.Do(req)
+}
+
+// inventory lists the documents of the library the credentials may read
+func (c *libraryClient) inventory(ctx context.Context) ([]libraryDocument, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/library", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &transfer.StatusError{URL: c.url("/api/library"), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var inventory struct {
+		Documents []libraryDocument `json:"documents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inventory); err != nil {
+		return nil, fmt.Errorf("invalid inventory: %v", err)
+	}
+	return inventory.Documents, nil
+}
+
+// openViewing opens a document under the viewing limits of the library and
+// returns the lease ID, or "" when the library has no limits
+func (c *libraryClient) openViewing(ctx context.Context, id string) (string, error) {
+	body, err := json.Marshal(map[string]string{"document": id})
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/viewing", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return "", nil
+	case http.StatusCreated:
+	default:
+		return "", &transfer.StatusError{URL: c.url("/api/viewing"), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var lease struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return "", fmt.Errorf("invalid viewing lease: %v", err)
+	}
+	return lease.ID, nil
+}
+
+func (c *libraryClient) closeViewing(ctx context.Context, lease string) {
+	resp, err := c.do(ctx, http.MethodPost, "/api/viewing/"+url.PathEscape(lease)+"/close", "", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// upload stores a document in the library
+func (c *libraryClient) upload(ctx context.Context, path, filename string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Stream the form so large documents are not held in memory
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		part, err := form.CreateFormFile("document", filename)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/upload", form.FormDataContentType(), reader)
+	if err != nil {
+		reader.CloseWithError(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if len(bytes.TrimSpace(message)) > 0 && resp.StatusCode == http.StatusBadRequest {
+			return fmt.Errorf("replica refused document: %s", bytes.TrimSpace(message))
+		}
+		return &transfer.StatusError{URL: c.url("/api/upload"), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
@@ -1,17 +1,34 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/charts"
 	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/convert"
 	"github.com/liv-format/liv/pkg/core"
 	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/interactive"
 	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/optimize"
+	"github.com/liv-format/liv/pkg/pdfops"
+	"github.com/liv-format/liv/pkg/printstyle"
+	"github.com/liv-format/liv/pkg/tsa"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +36,10 @@ var (
 	version = "0.1.0"
 	commit  = "dev"
 	date    = "unknown"
+
+	// keepBackups keeps the documents commands replace, with .bak added
+	// to their names
+	keepBackups bool
 )
 
 func main() {
@@ -30,14 +51,36 @@ Live Interactive Visual documents. LIV documents combine the portability
 of PDF with modern web technologies for interactive content.`,
 		Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
 	}
+	rootCmd.PersistentFlags().BoolVar(&keepBackups, "backup", false, "Keep a document an output replaces as <file>.bak")
 
 	// Add subcommands
+	rootCmd.AddCommand(initCmd())
 	rootCmd.AddCommand(buildCmd())
+	rootCmd.AddCommand(devCmd())
 	rootCmd.AddCommand(viewCmd())
+	rootCmd.AddCommand(serveCmd())
+	rootCmd.AddCommand(serveAPICmd())
 	rootCmd.AddCommand(convertCmd())
 	rootCmd.AddCommand(validateCmd())
 	rootCmd.AddCommand(signCmd())
+	rootCmd.AddCommand(fetchCmd())
+	rootCmd.AddCommand(libraryCmd())
 	rootCmd.AddCommand(pdfCmd())
+	rootCmd.AddCommand(templateCmd())
+	rootCmd.AddCommand(workspaceCmd())
+	rootCmd.AddCommand(thumbnailCmd())
+	rootCmd.AddCommand(exportMetadataCmd())
+	rootCmd.AddCommand(diffCmd())
+	rootCmd.AddCommand(patchCmd())
+	rootCmd.AddCommand(deanonymizeCmd())
+	rootCmd.AddCommand(sbomCmd())
+	rootCmd.AddCommand(conformanceCmd())
+	rootCmd.AddCommand(annotationsCmd())
+	rootCmd.AddCommand(inspectCmd())
+	rootCmd.AddCommand(metaCmd())
+	rootCmd.AddCommand(encryptCmd())
+	rootCmd.AddCommand(decryptCmd())
+	rootCmd.AddCommand(auditCmd())
 
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
@@ -48,23 +91,95 @@ of PDF with modern web technologies for interactive content.`,
 
 func buildCmd() *cobra.Command {
 	var (
-		inputDir     string
-		outputFile   string
-		manifestFile string
-		compress     bool
-		sign         bool
-		keyFile      string
+		inputDir        string
+		outputFile      string
+		manifestFile    string
+		compress        bool
+		reproducible    bool
+		sign            bool
+		keyFile         string
+		sectionKeys     string
+		assetPolicy     string
+		waiver          string
+		workspace       string
+		noCache         bool
+		update          bool
+		watch           bool
+		review          anonymizeOptions
+		vulnerabilities vulnerabilityOptions
+		optimization    optimizeOptions
+		attest          attestationOptions
+		project         projectOptions
+		theme           string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "build",
 		Short: "Build a LIV document from source files",
 		Long: `Build creates a LIV document package from source files and assets.
-It validates the content, generates a manifest, and optionally signs the document.`,
+It validates the content, generates a manifest, and optionally signs the document.
+With --workspace, every document listed in a liv.work file is built with the
+workspace's shared settings. With --watch, the document is rebuilt whenever a
+source file changes, hashing only the files that changed. With --anonymize, a
+double-blind review copy is built without author metadata, acknowledgments or
+identifying strings, and the identity is kept in a sealed mapping for
+liv deanonymize. With --optimize, images are recompressed and given WebP
+renditions, stylesheets and scripts are minified and fonts are subset to the
+characters the document uses; a --build-config file opts assets out. With
+--attest, a signed in-toto attestation of the source tree, build steps and
+environment is written next to the package for liv-integrity
+verify-attestation. With --theme, the pages are wrapped in a theme's layout and
+its stylesheets and fonts are packaged with them: a built-in theme (corporate,
+academic or minimal), a theme in ~/.liv/themes by name, or a theme directory.
+
+Build settings can be kept in a liv.yaml (or liv.yml or liv.json) project file
+in the input directory: metadata, security policy overrides, feature flags,
+included and excluded paths, optimization, signing and build options. Flags
+given on the command line override the values of the file.
+
+Builds are reproducible: the same sources give the same bytes on any machine.
+The time recorded is SOURCE_DATE_EPOCH, or 1980-01-01 when it is unset, rather
+than the current time. Confidential sections, license waivers and ECDSA
+signatures still differ between builds; use --reproducible=false to record
+the current time.`,
 		Example: `  liv build --input ./my-doc --output document.liv
-  liv build --input ./my-doc --output document.liv --sign --key private.pem`,
+  liv build --input ./my-doc --output document.liv --watch
+  liv build --input ./my-doc --output document.liv --sign --key private.pem
+  liv build --input ./my-doc --output document.liv --section-keys keys.json
+  liv build --input ./my-doc --output document.liv --asset-policy strict
+  liv build --input ./my-doc --output review.liv --anonymize --mapping-key review.key
+  liv build --input ./my-doc --output document.liv --advisories advisories.json
+  liv build --input ./my-doc --output document.liv --optimize --build-config liv-build.json
+  liv build --input ./my-doc --output document.liv --attest --key private.pem
+  liv build --input ./my-doc --output document.liv --project ./configs/liv.yaml
+  liv build --input ./my-doc --output document.liv --theme corporate
+  liv build --workspace
+  liv build --workspace=./suite/liv.work --no-cache
+  liv build --workspace --update`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runBuild(inputDir, outputFile, manifestFile, compress, sign, keyFile)
+			if cmd.Flags().Changed("workspace") {
+				if watch {
+					return fmt.Errorf("--watch cannot be combined with --workspace")
+				}
+				return runWorkspaceBuild(workspace, noCache, update)
+			}
+			if inputDir == "" || outputFile == "" {
+				return fmt.Errorf("--input and --output are required unless building a workspace")
+			}
+			// Flags left unset are left to the builder, which takes them
+			// from the project file when there is one
+			flags := cmd.Flags()
+			if !flags.Changed("asset-policy") {
+				assetPolicy = ""
+			}
+			if !flags.Changed("vulnerability-policy") {
+				vulnerabilities.Policy = ""
+			}
+			if !flags.Changed("optimize-quality") {
+				optimization.Quality = 0
+			}
+			project.Overrides = changedFlags(cmd, "compress", "reproducible", "sign", "theme")
+			return runBuild(inputDir, outputFile, manifestFile, compress, reproducible, sign, keyFile, sectionKeys, assetPolicy, waiver, review, vulnerabilities, optimization, attest, project, watch)
 		},
 	}
 
@@ -72,11 +187,32 @@ It validates the content, generates a manifest, and optionally signs the documen
 	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output LIV file path (required)")
 	cmd.Flags().StringVarP(&manifestFile, "manifest", "m", "", "Custom manifest file (optional)")
 	cmd.Flags().BoolVarP(&compress, "compress", "c", true, "Compress assets")
+	cmd.Flags().BoolVar(&reproducible, "reproducible", true, "Record fixed timestamps (SOURCE_DATE_EPOCH if set) and a fixed entry order, so builds of the same sources are identical")
 	cmd.Flags().BoolVarP(&sign, "sign", "s", false, "Sign the document")
 	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Private key file for signing")
-
-	cmd.MarkFlagRequired("input")
-	cmd.MarkFlagRequired("output")
+	cmd.Flags().StringVar(&sectionKeys, "section-keys", "", "JSON file mapping confidential section IDs to their keys")
+	cmd.Flags().StringVar(&assetPolicy, "asset-policy", "warn", "Asset license policy: off, warn or strict")
+	cmd.Flags().StringVar(&waiver, "license-waiver", "", "Reason for overriding a failed asset license check (recorded in the manifest)")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Rebuild the document whenever its source files change")
+	cmd.Flags().BoolVar(&review.Enabled, "anonymize", false, "Build a double-blind review copy without author metadata, acknowledgments or identifying strings")
+	cmd.Flags().StringVar(&review.PatternsFile, "anonymize-patterns", "", "File of further identifying strings to remove, one regular expression per line")
+	cmd.Flags().StringVar(&review.MappingFile, "mapping", "", "Where to write the sealed identity mapping (default: the output name with .livmap)")
+	cmd.Flags().StringVar(&review.KeyFile, "mapping-key", "", "File holding the passphrase that seals the identity mapping")
+	cmd.Flags().StringVar(&vulnerabilities.FeedFile, "advisories", "", "JSON deny-list of vulnerable JS libraries and WASM modules to check the document against")
+	cmd.Flags().StringVar(&vulnerabilities.Policy, "vulnerability-policy", "strict", "Vulnerability policy when --advisories is given: off, warn or strict")
+	cmd.Flags().StringVar(&optimization.Stages, "optimize", "", "Optimize assets: all, or a comma-separated list of images, webp, minify and fonts")
+	cmd.Flags().Lookup("optimize").NoOptDefVal = "all"
+	cmd.Flags().IntVar(&optimization.Quality, "optimize-quality", optimize.DefaultQuality, "JPEG quality images are recompressed to when optimizing")
+	cmd.Flags().StringVar(&optimization.ConfigFile, "build-config", "", "JSON build config opting assets out of optimization")
+	cmd.Flags().BoolVar(&attest.Enabled, "attest", false, "Write a signed in-toto attestation of the build's inputs, steps and environment (requires --key)")
+	cmd.Flags().StringVar(&attest.File, "attestation", "", "Where to write the build attestation (default: the output name with .intoto.jsonl)")
+	cmd.Flags().StringVar(&theme, "theme", "", "Theme applied to the pages: a built-in theme, a theme in ~/.liv/themes or a theme directory")
+	cmd.Flags().StringVar(&project.File, "project", "", "Project file (default: liv.yaml, liv.yml or liv.json in the input directory); flags override its values")
+
+	cmd.Flags().StringVarP(&workspace, "workspace", "w", "", "Build all documents in a workspace (liv.work file or directory)")
+	cmd.Flags().Lookup("workspace").NoOptDefVal = "."
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Rebuild workspace documents even if their inputs are unchanged")
+	cmd.Flags().BoolVar(&update, "update", false, "Accept remote inputs that changed since liv.lock was written and update it")
 
 	return cmd
 }
@@ -114,25 +250,59 @@ func convertCmd() *cobra.Command {
 		format     string
 		outputFile string
 		quality    int
+		renderer   string
+		pages      core.PrintSettings
+		press      pressOptions
+		speech     string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "convert [input]",
 		Short: "Convert between LIV and other formats",
 		Long: `Convert transforms LIV documents to other formats (PDF, HTML, Markdown, EPUB)
-or imports other formats into LIV documents.`,
+or imports other formats into LIV documents.
+
+Accessible renditions are made from the static fallback: brf transcribes it
+into uncontracted Unified English Braille as a braille ready file for
+embossers and refreshable displays, and large-print-pdf sets it at 18pt and
+above in a simplified layout on the document's page size.
+
+epub-audio (or daisy) makes a talking book: an EPUB 3 with media overlays that
+highlight each block of text as its narration plays, and navigation points
+for every heading. The narration is the document's own recordings, timed by
+assets/narration.json, or else speech from --speech-command.`,
 		Example: `  liv convert document.liv --format pdf --output document.pdf
   liv convert document.html --format liv --output document.liv
-  liv convert document.liv --format html --output document.html`,
+  liv convert document.liv --format html --output document.html
+  liv convert document.liv --format pdf --renderer native --output document.pdf
+  liv convert report.liv --format pdf --cover --toc --footer "{title}|Page {page} of {pages}" --output report.pdf
+  liv convert brochure.liv --format pdf --print-profile ISOcoated_v2_300_eci.icc --output-condition FOGRA39 --output brochure.pdf
+  liv convert notice.liv --format brf --output notice.brf
+  liv convert notice.liv --format large-print-pdf --output notice-large.pdf
+  liv convert guide.liv --format epub-audio --output guide.epub
+  liv convert guide.liv --format daisy --speech-command "espeak-ng -v en-gb -s 150 -w {output} --stdin" --output guide.epub`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runConvert(args[0], format, outputFile, quality)
+			profile, err := press.load()
+			if err != nil {
+				return err
+			}
+			return runConvert(args[0], format, outputFile, quality, renderer, &pages, profile, speech)
 		},
 	}
 
-	cmd.Flags().StringVarP(&format, "format", "f", "", "Target format (pdf, html, markdown, epub, liv)")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "Target format (pdf, html, markdown, epub, epub-audio, liv, brf, large-print-pdf)")
 	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file path")
 	cmd.Flags().IntVarP(&quality, "quality", "q", 90, "Quality for lossy formats (1-100)")
+	cmd.Flags().StringVar(&renderer, "renderer", "auto", "PDF renderer (auto, native, chrome); auto uses Chrome when installed, unless page furniture is asked for")
+	cmd.Flags().StringVar(&pages.Header, "header", "", "PDF running header; {title}, {author}, {page} and {pages} are replaced and | separates left, centre and right")
+	cmd.Flags().StringVar(&pages.Footer, "footer", "", "PDF running footer, as --header")
+	cmd.Flags().BoolVar(&pages.TableOfContents, "toc", false, "Add a PDF table of contents page with bookmarks")
+	cmd.Flags().BoolVar(&pages.Cover, "cover", false, "Add a PDF cover page from the metadata and thumbnail")
+	cmd.Flags().StringVar(&press.profile, "print-profile", "", "CMYK ICC output profile to prepare the PDF for print with")
+	cmd.Flags().StringVar(&press.condition, "output-condition", "", "Name of the printing condition, such as FOGRA39 (default: the profile description)")
+	cmd.Flags().Float64Var(&press.minResolution, "min-ppi", pdfops.DefaultMinResolution, "Resolution below which images are reported as too coarse for print")
+	cmd.Flags().StringVar(&speech, "speech-command", "", "Text-to-speech program narrating epub-audio exports, given the text on stdin; {lang} is the document language and {output} the WAV file to write (default: espeak-ng)")
 
 	cmd.MarkFlagRequired("format")
 	cmd.MarkFlagRequired("output")
@@ -142,24 +312,49 @@ or imports other formats into LIV documents.`,
 
 func validateCmd() *cobra.Command {
 	var (
-		checkSignatures bool
-		verbose         bool
+		checkSignatures  bool
+		requireLicense   bool
+		funderRegistry   string
+		extensionSchemas string
+		vulnerabilities  vulnerabilityOptions
+		clockSkew        time.Duration
+		verbose          bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "validate [file]",
 		Short: "Validate a LIV document",
 		Long: `Validate checks a LIV document for structural integrity, security compliance,
-and content validity. Reports any errors or warnings found.`,
+and content validity. Reports any errors or warnings found.
+
+With --advisories, the bundled JS libraries, WASM modules and files of the
+document are checked against a deny-list of vulnerable components. Under the
+strict policy, the default, a match fails validation.
+
+Created and modified times more than --clock-skew ahead of this machine's
+clock are reported as in the future; manifests record times in UTC.
+
+Custom metadata extensions of the namespaces in --extension-schemas are
+checked against their schema; other extensions are kept but not checked.`,
 		Example: `  liv validate document.liv
-  liv validate document.liv --signatures --verbose`,
+  liv validate document.liv --signatures --verbose
+  liv validate document.liv --require-license
+  liv validate document.liv --funder-registry funders.csv
+  liv validate document.liv --extension-schemas extensions.json
+  liv validate document.liv --advisories advisories.json --vulnerability-policy warn`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runValidate(args[0], checkSignatures, verbose)
+			return runValidate(args[0], checkSignatures, requireLicense, funderRegistry, extensionSchemas, vulnerabilities, clockSkew, verbose)
 		},
 	}
 
 	cmd.Flags().BoolVarP(&checkSignatures, "signatures", "s", true, "Verify digital signatures")
+	cmd.Flags().BoolVar(&requireLicense, "require-license", false, "Fail if the document has no license information")
+	cmd.Flags().StringVar(&funderRegistry, "funder-registry", "", "CSV of funder IDs and names the acknowledged funders must be listed in")
+	cmd.Flags().StringVar(&extensionSchemas, "extension-schemas", "", "JSON of schemas by namespace the metadata extensions are checked against")
+	cmd.Flags().StringVar(&vulnerabilities.FeedFile, "advisories", "", "JSON deny-list of vulnerable JS libraries and WASM modules")
+	cmd.Flags().StringVar(&vulnerabilities.Policy, "vulnerability-policy", "strict", "Vulnerability policy: off, warn or strict")
+	cmd.Flags().DurationVar(&clockSkew, "clock-skew", core.DefaultClockSkew, "How far ahead of this clock document times may be before they are reported as in the future")
 	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 
 	return cmd
@@ -167,25 +362,45 @@ and content validity. Reports any errors or warnings found.`,
 
 func signCmd() *cobra.Command {
 	var (
-		keyFile    string
-		outputFile string
+		keyFile         string
+		outputFile      string
+		tsaURL          string
+		appendSignature bool
+		signer          core.SignerInfo
 	)
 
 	cmd := &cobra.Command{
 		Use:   "sign [file]",
 		Short: "Sign a LIV document",
 		Long: `Sign adds digital signatures to a LIV document for integrity verification
-and authenticity validation.`,
+and authenticity validation.
+
+With --tsa-url the signatures are timestamped by an RFC 3161 timestamping
+authority. The timestamp proves when the document was signed, so the
+signatures remain valid after the signing certificate expires.
+
+With --append the document keeps its signatures and is counter-signed by a
+further signer, for example a reviewer approving an author's document. The
+counter-signature covers the document and every earlier signature, and each
+signer is verified independently.`,
 		Example: `  liv sign document.liv --key private.pem
-  liv sign document.liv --key private.pem --output signed-document.liv`,
+  liv sign document.liv --key private.pem --output signed-document.liv
+  liv sign document.liv --key private.pem --tsa-url https://freetsa.org/tsr
+  liv sign document.liv --key author.pem --signer-name "Ada Author" --role author
+  liv sign document.liv --key reviewer.pem --append --signer-name "Rex Reviewer" --role reviewer`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSign(args[0], keyFile, outputFile)
+			return runSign(args[0], keyFile, outputFile, tsaURL, appendSignature, signer)
 		},
 	}
 
 	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Private key file for signing (required)")
 	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: overwrite input)")
+	cmd.Flags().StringVar(&tsaURL, "tsa-url", "", "RFC 3161 timestamping authority to timestamp the signatures")
+	cmd.Flags().BoolVar(&appendSignature, "append", false, "Counter-sign the document, keeping its existing signatures")
+	cmd.Flags().StringVar(&signer.Name, "signer-name", "", "Name of the signer")
+	cmd.Flags().StringVar(&signer.Email, "signer-email", "", "Email address of the signer")
+	cmd.Flags().StringVar(&signer.Role, "role", "", "Role of the signer, such as author, reviewer or approver")
 
 	cmd.MarkFlagRequired("key")
 
@@ -194,7 +409,7 @@ and authenticity validation.`,
 
 // Command implementations (stubs for now)
 
-func runBuild(inputDir, outputFile, manifestFile string, compress, sign bool, keyFile string) error {
+func runBuild(inputDir, outputFile, manifestFile string, compress, reproducible, sign bool, keyFile, sectionKeys, assetPolicy, waiver string, review anonymizeOptions, vulnerabilities vulnerabilityOptions, optimization optimizeOptions, attest attestationOptions, project projectOptions, watch bool) error {
 	fmt.Printf("Building LIV document from %s to %s\n", inputDir, outputFile)
 
 	// Find the builder executable
@@ -217,15 +432,42 @@ func runBuild(inputDir, outputFile, manifestFile string, compress, sign bool, ke
 		args = append(args, "--compress=false")
 	}
 
+	if !reproducible {
+		args = append(args, "--reproducible=false")
+	}
+
 	if sign {
 		args = append(args, "--sign")
-		if keyFile != "" {
-			args = append(args, "--key", keyFile)
-		}
 	}
 
+	if keyFile != "" {
+		args = append(args, "--key", keyFile)
+	}
+
+	if sectionKeys != "" {
+		args = append(args, "--section-keys", sectionKeys)
+	}
+
+	if assetPolicy != "" {
+		args = append(args, "--asset-policy", assetPolicy)
+	}
+
+	if waiver != "" {
+		args = append(args, "--license-waiver", waiver)
+	}
+
+	args = append(args, review.args()...)
+	args = append(args, vulnerabilities.args()...)
+	args = append(args, optimization.args()...)
+	args = append(args, attest.args()...)
+	args = append(args, project.args()...)
+
 	args = append(args, "--verbose")
 
+	if watch {
+		args = append(args, "--watch")
+	}
+
 	// Execute builder
 	cmd := exec.Command(builderPath, args...)
 	cmd.Stdout = os.Stdout
@@ -295,6 +537,19 @@ func runView(file string, port int, web, fallback bool) error {
 		fmt.Printf("\nDocument Information:\n")
 		fmt.Printf("  Title: %s\n", parsedManifest.Metadata.Title)
 		fmt.Printf("  Author: %s\n", parsedManifest.Metadata.Author)
+		for _, author := range parsedManifest.Metadata.Authors {
+			line := author.Name
+			if author.Affiliation != "" {
+				line += ", " + author.Affiliation
+			}
+			if author.ORCID != "" {
+				line += " (ORCID " + author.ORCID + ")"
+			}
+			fmt.Printf("    - %s\n", line)
+		}
+		if doi := parsedManifest.Metadata.Publication.DOIURL(); doi != "" {
+			fmt.Printf("  DOI: %s\n", doi)
+		}
 		fmt.Printf("  Version: %s\n", parsedManifest.Metadata.Version)
 		fmt.Printf("  Created: %s\n", parsedManifest.Metadata.Created.Format("2006-01-02 15:04:05"))
 		fmt.Printf("  Modified: %s\n", parsedManifest.Metadata.Modified.Format("2006-01-02 15:04:05"))
@@ -323,7 +578,7 @@ func runView(file string, port int, web, fallback bool) error {
 	}
 }
 
-func runConvert(input, format, output string, quality int) error {
+func runConvert(input, format, output string, quality int, renderer string, pages *core.PrintSettings, profile *pdfops.PrintProfile, speech string) error {
 	fmt.Printf("Converting %s to %s format\n", input, format)
 
 	// Check if input file exists
@@ -335,11 +590,17 @@ func runConvert(input, format, output string, quality int) error {
 	case "html":
 		return convertToHTML(input, output)
 	case "pdf":
-		return convertToPDF(input, output, quality)
+		return convertToPDF(input, output, quality, renderer, pages, profile, false)
+	case "large-print-pdf":
+		return convertToPDF(input, output, quality, renderer, pages, profile, true)
 	case "markdown", "md":
 		return convertToMarkdown(input, output)
+	case "brf":
+		return convertToBRF(input, output)
 	case "epub":
-		return convertToEPUB(input, output)
+		return convertToEPUB(input, output, false, speech)
+	case "epub-audio", "daisy":
+		return convertToEPUB(input, output, true, speech)
 	case "liv":
 		return convertToLIV(input, output)
 	default:
@@ -382,8 +643,15 @@ func convertToHTML(livFile, outputFile string) error {
 		}
 	}
 
+	// Carry the custom metadata of the manifest, so converting back keeps it
+	if m, err := readEditableManifest(files); err == nil {
+		if html, err = convert.EmbedExtensions(html, m.Extensions); err != nil {
+			return err
+		}
+	}
+
 	// Write HTML file
-	err = os.WriteFile(outputFile, []byte(html), 0644)
+	err = atomicfile.WriteFile(outputFile, []byte(html), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write HTML file: %v", err)
 	}
@@ -413,10 +681,13 @@ func convertToMarkdown(livFile, outputFile string) error {
 	}
 
 	// Convert HTML to Markdown
-	markdown := convertHTMLToMarkdown(htmlContent)
+	markdown, err := convert.HTMLToMarkdown(htmlContent)
+	if err != nil {
+		return err
+	}
 
 	// Write Markdown file
-	err = os.WriteFile(outputFile, []byte(markdown), 0644)
+	err = atomicfile.WriteFile(outputFile, []byte(markdown), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write Markdown file: %v", err)
 	}
@@ -425,7 +696,42 @@ func convertToMarkdown(livFile, outputFile string) error {
 	return nil
 }
 
-func convertToEPUB(livFile, outputFile string) error {
+func convertToBRF(livFile, outputFile string) error {
+	fmt.Printf("Transcribing LIV document into braille...\n")
+
+	// Extract document
+	zipContainer := container.NewZIPContainer()
+	files, err := zipContainer.ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract LIV document: %v", err)
+	}
+
+	// Braille is transcribed from the static fallback, which has all the text
+	// without scripts
+	var htmlContent string
+	if staticFallback := getFileContentSafe(files, "content/static/fallback.html"); staticFallback != "" {
+		htmlContent = staticFallback
+	} else if mainHTML, exists := files["content/index.html"]; exists {
+		htmlContent = string(mainHTML)
+	} else {
+		return fmt.Errorf("no HTML content found in document")
+	}
+
+	brf, err := convert.HTMLToBRF(htmlContent, convert.BRFOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = atomicfile.WriteFile(outputFile, []byte(brf), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write BRF file: %v", err)
+	}
+
+	fmt.Printf("✓ Braille ready file exported to: %s (%d pages)\n", outputFile, strings.Count(brf, "\f"))
+	return nil
+}
+
+func convertToEPUB(livFile, outputFile string, narrate bool, speech string) error {
 	fmt.Printf("Converting LIV document to EPUB...\n")
 
 	// Extract document
@@ -463,6 +769,40 @@ func convertToEPUB(livFile, outputFile string) error {
 	// Create EPUB structure
 	epubFiles := make(map[string][]byte)
 
+	// Talking books read each block of text aloud in step with a media
+	// overlay, and are navigated by their headings
+	navList := `            <li><a href="content.xhtml">Content</a></li>`
+	navPoints := `        <navPoint id="navpoint-1" playOrder="1">
+            <navLabel>
+                <text>Content</text>
+            </navLabel>
+            <content src="content.xhtml"/>
+        </navPoint>`
+	navDepth := 1
+	var contentProperties, overlayItems, overlayMetadata string
+	if narrate {
+		narration, err := convert.SegmentNarration(htmlContent)
+		if err != nil {
+			return err
+		}
+		overlay, err := narrateDocument(files, narration, doc.Metadata.Language, speech)
+		if err != nil {
+			return fmt.Errorf("failed to narrate document: %v", err)
+		}
+		htmlContent = narration.Body
+		if len(narration.Outline) > 0 {
+			var list string
+			list, navPoints, navDepth = epubOutline(narration.Outline)
+			navList = strings.TrimSuffix(strings.TrimPrefix(list, "        <ol>\n"), "\n        </ol>")
+		}
+		epubFiles["OEBPS/content.smil"] = overlay.SMIL
+		for href, data := range overlay.Audio {
+			epubFiles["OEBPS/"+href] = data
+		}
+		contentProperties = ` media-overlay="overlay"`
+		overlayItems, overlayMetadata = overlayPackage(overlay)
+	}
+
 	// Add mimetype (must be first and uncompressed)
 	epubFiles["mimetype"] = []byte("application/epub+zip")
 
@@ -484,16 +824,16 @@ func convertToEPUB(livFile, outputFile string) error {
     <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
         <dc:identifier id="uid">urn:uuid:%s</dc:identifier>
         <dc:title>%s</dc:title>
-        <dc:creator>%s</dc:creator>
+        %s
         <dc:language>%s</dc:language>
         <dc:date>%s</dc:date>
-        <meta property="dcterms:modified">%s</meta>
+        <meta property="dcterms:modified">%s</meta>%s%s
     </metadata>
     <manifest>
         <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
         <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
-        <item id="content" href="content.xhtml" media-type="application/xhtml+xml"/>
-        <item id="style" href="styles/main.css" media-type="text/css"/>
+        <item id="content" href="content.xhtml" media-type="application/xhtml+xml"%s/>
+        <item id="style" href="styles/main.css" media-type="text/css"/>%s
     </manifest>
     <spine toc="ncx">
         <itemref idref="content"/>
@@ -501,10 +841,14 @@ func convertToEPUB(livFile, outputFile string) error {
 </package>`,
 		uuid,
 		escapeXML(doc.Metadata.Title),
-		escapeXML(doc.Metadata.Author),
+		epubCreators(doc.Metadata)+epubFunders(doc.Metadata)+epubSubjects(doc.Metadata),
 		doc.Metadata.Language,
-		doc.Metadata.Created.Format("2006-01-02T15:04:05Z"),
-		time.Now().Format("2006-01-02T15:04:05Z"))
+		core.UTC(doc.Metadata.Created).Format(time.RFC3339),
+		core.UTC(time.Now()).Format(time.RFC3339),
+		epubLicenseMetadata(doc.License),
+		overlayMetadata,
+		contentProperties,
+		overlayItems)
 
 	epubFiles["OEBPS/content.opf"] = []byte(contentOPF)
 
@@ -513,7 +857,7 @@ func convertToEPUB(livFile, outputFile string) error {
 <ncx version="2005-1" xmlns="http://www.daisy.org/z3986/2005/ncx/">
     <head>
         <meta name="dtb:uid" content="urn:uuid:%s"/>
-        <meta name="dtb:depth" content="1"/>
+        <meta name="dtb:depth" content="%d"/>
         <meta name="dtb:totalPageCount" content="0"/>
         <meta name="dtb:maxPageNumber" content="0"/>
     </head>
@@ -521,21 +865,18 @@ func convertToEPUB(livFile, outputFile string) error {
         <text>%s</text>
     </docTitle>
     <navMap>
-        <navPoint id="navpoint-1" playOrder="1">
-            <navLabel>
-                <text>Content</text>
-            </navLabel>
-            <content src="content.xhtml"/>
-        </navPoint>
+%s
     </navMap>
 </ncx>`,
 		uuid,
-		escapeXML(doc.Metadata.Title))
+		navDepth,
+		escapeXML(doc.Metadata.Title),
+		navPoints)
 
 	epubFiles["OEBPS/toc.ncx"] = []byte(tocNCX)
 
 	// Add nav.xhtml (EPUB 3 navigation)
-	navXHTML := `<?xml version="1.0" encoding="UTF-8"?>
+	navXHTML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE html>
 <html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
 <head>
@@ -545,11 +886,11 @@ func convertToEPUB(livFile, outputFile string) error {
     <nav epub:type="toc" id="toc">
         <h1>Table of Contents</h1>
         <ol>
-            <li><a href="content.xhtml">Content</a></li>
+%s
         </ol>
     </nav>
 </body>
-</html>`
+</html>`, navList)
 
 	epubFiles["OEBPS/nav.xhtml"] = []byte(navXHTML)
 
@@ -594,9 +935,13 @@ p:first-child, h1 + p, h2 + p, h3 + p {
 }`
 		epubFiles["OEBPS/styles/main.css"] = []byte(defaultCSS)
 	}
+	if narrate {
+		// Highlight the text being read
+		epubFiles["OEBPS/styles/main.css"] = append(epubFiles["OEBPS/styles/main.css"], "\n.-epub-media-overlay-active {\n    background-color: #ffeb3b;\n}\n"...)
+	}
 
 	// Create EPUB file (ZIP format)
-	err = zipContainer.CreateFromFiles(epubFiles, outputFile)
+	err = writeEPUB(epubFiles, outputFile)
 	if err != nil {
 		return fmt.Errorf("failed to create EPUB file: %v", err)
 	}
@@ -605,6 +950,154 @@ p:first-child, h1 + p, h2 + p, h3 + p {
 	return nil
 }
 
+// relatorCodes are the MARC relator codes of author roles
+var relatorCodes = map[string]string{
+	"author":      "aut",
+	"editor":      "edt",
+	"translator":  "trl",
+	"illustrator": "ill",
+	"contributor": "ctb",
+}
+
+// epubCreators renders the authors of a document as OPF creators, or
+// contributors for translators, illustrators and other contributors, refined
+// with their MARC relator role, order and ORCID iD
+func epubCreators(metadata *core.DocumentMetadata) string {
+	creators := metadata.Creators()
+	var lines []string
+	for i, author := range creators {
+		id := fmt.Sprintf("creator%d", i+1)
+		role := author.Role
+		if role == "" {
+			role = "author"
+		}
+		element := "dc:creator"
+		if role != "author" && role != "editor" {
+			element = "dc:contributor"
+		}
+		lines = append(lines,
+			fmt.Sprintf("<%s id=\"%s\">%s</%s>", element, id, escapeXML(author.Name), element),
+			fmt.Sprintf("<meta refines=\"#%s\" property=\"role\" scheme=\"marc:relators\">%s</meta>", id, relatorCodes[role]))
+		if len(creators) > 1 {
+			lines = append(lines, fmt.Sprintf("<meta refines=\"#%s\" property=\"display-seq\">%d</meta>", id, i+1))
+		}
+		if orcid := author.ORCIDURL(); orcid != "" {
+			lines = append(lines, fmt.Sprintf("<meta refines=\"#%s\" property=\"dcterms:identifier\">%s</meta>", id, orcid))
+		}
+	}
+	return strings.Join(lines, "\n        ")
+}
+
+// epubFunders renders the funders of a document as OPF contributors with the
+// MARC funder role, refined with their registry DOI and grants
+func epubFunders(metadata *core.DocumentMetadata) string {
+	var lines []string
+	for i, funding := range metadata.Funding {
+		if funding == nil {
+			continue
+		}
+		id := fmt.Sprintf("funder%d", i+1)
+		lines = append(lines,
+			fmt.Sprintf("<dc:contributor id=\"%s\">%s</dc:contributor>", id, escapeXML(funding.Funder)),
+			fmt.Sprintf("<meta refines=\"#%s\" property=\"role\" scheme=\"marc:relators\">fnd</meta>", id))
+		if funderID := funding.FunderIDURL(); funderID != "" {
+			lines = append(lines, fmt.Sprintf("<meta refines=\"#%s\" property=\"dcterms:identifier\">%s</meta>", id, escapeXML(funderID)))
+		}
+	}
+	if statement := metadata.FundingStatement(); statement != "" {
+		lines = append(lines, fmt.Sprintf("<meta property=\"dcterms:description\">Funding: %s</meta>", escapeXML(statement)))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n        " + strings.Join(lines, "\n        ")
+}
+
+// epubSubjects renders the keywords and subjects of a document as OPF
+// subjects. Subjects from a vocabulary are refined with its name and their
+// code, as reading systems and retailers file them by.
+func epubSubjects(metadata *core.DocumentMetadata) string {
+	var lines []string
+	for _, keyword := range metadata.Keywords {
+		lines = append(lines, fmt.Sprintf("<dc:subject>%s</dc:subject>", escapeXML(keyword)))
+	}
+	for i, subject := range metadata.Subjects {
+		if subject == nil {
+			continue
+		}
+		if subject.Scheme == "" {
+			lines = append(lines, fmt.Sprintf("<dc:subject>%s</dc:subject>", escapeXML(subject.String())))
+			continue
+		}
+		id := fmt.Sprintf("subject%d", i+1)
+		lines = append(lines,
+			fmt.Sprintf("<dc:subject id=\"%s\">%s</dc:subject>", id, escapeXML(subject.String())),
+			fmt.Sprintf("<meta refines=\"#%s\" property=\"authority\">%s</meta>", id, strings.ToUpper(subject.Scheme)),
+			fmt.Sprintf("<meta refines=\"#%s\" property=\"term\">%s</meta>", id, escapeXML(subject.Code)))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n        " + strings.Join(lines, "\n        ")
+}
+
+// epubLicenseMetadata renders the document license as OPF package metadata
+func epubLicenseMetadata(license *core.LicenseInfo) string {
+	if license == nil {
+		return ""
+	}
+
+	metadata := fmt.Sprintf("\n        <dc:rights>%s</dc:rights>", escapeXML(license.Summary()))
+	if license.URL != "" {
+		metadata += fmt.Sprintf("\n        <link rel=\"dcterms:license\" href=\"%s\"/>", escapeXML(license.URL))
+	}
+	if license.SPDX != "" {
+		metadata += fmt.Sprintf("\n        <meta property=\"dcterms:license\">%s</meta>", escapeXML(license.SPDX))
+	}
+	return metadata
+}
+
+// writeEPUB zips an EPUB publication. The mimetype file comes first and
+// uncompressed, so reading systems can identify the file by its first bytes;
+// the LIV container cannot write it, as it expects a LIV manifest.
+func writeEPUB(files map[string][]byte, outputFile string) error {
+	out, err := atomicfile.Create(outputFile, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	paths := make([]string, 0, len(files))
+	for name := range files {
+		if name != "mimetype" {
+			paths = append(paths, name)
+		}
+	}
+	sort.Strings(paths)
+
+	archive := zip.NewWriter(out)
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(files["mimetype"]); err != nil {
+		return err
+	}
+	for _, name := range paths {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
 func convertToLIV(inputFile, outputFile string) error {
 	fmt.Printf("Converting %s to LIV format...\n", inputFile)
 
@@ -617,6 +1110,7 @@ func convertToLIV(inputFile, outputFile string) error {
 	// Determine input format based on file extension
 	ext := strings.ToLower(filepath.Ext(inputFile))
 	var htmlContent, title string
+	var extensions map[string]json.RawMessage
 
 	switch ext {
 	case ".html", ".htm":
@@ -631,18 +1125,17 @@ func convertToLIV(inputFile, outputFile string) error {
 		if title == "" {
 			title = "Imported HTML Document"
 		}
+		if extensions, err = convert.ExtractExtensions(htmlContent); err != nil {
+			return err
+		}
 	case ".md", ".markdown":
-		markdownContent := string(inputContent)
-		htmlContent = convertMarkdownToHTML(markdownContent)
-		// Extract title from first heading
-		lines := strings.Split(markdownContent, "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(line, "# ") {
-				title = strings.TrimSpace(line[2:])
-				break
-			}
+		rendered, err := convert.MarkdownToHTML(inputContent)
+		if err != nil {
+			return err
 		}
+		htmlContent = string(rendered)
+		// Extract title from first heading
+		title = convert.MarkdownTitle(inputContent)
 		if title == "" {
 			title = "Imported Markdown Document"
 		}
@@ -655,22 +1148,28 @@ func convertToLIV(inputFile, outputFile string) error {
 	// Create LIV document structure
 	files := make(map[string][]byte)
 
-	// Create manifest
+	// Create content files
+	files["content/index.html"] = []byte(htmlContent)
+	files["content/styles/main.css"] = []byte(generateDefaultCSS())
+	files["content/static/fallback.html"] = []byte(stripInteractiveElements(htmlContent))
+
+	// Create manifest, with the hashes and sizes of the content files
 	manifest := createImportManifest(title)
+	manifest.SetExtensions(extensions)
+	for path, resource := range manifest.GetManifest().Resources {
+		sum := sha256.Sum256(files[path])
+		resource.Hash = hex.EncodeToString(sum[:])
+		resource.Size = int64(len(files[path]))
+		resource.Path = path
+	}
 	manifestJSON, err := manifest.BuildJSON()
 	if err != nil {
 		return fmt.Errorf("failed to create manifest: %v", err)
 	}
 	files["manifest.json"] = manifestJSON
 
-	// Create content files
-	files["content/index.html"] = []byte(htmlContent)
-	files["content/styles/main.css"] = []byte(generateDefaultCSS())
-	files["content/static/fallback.html"] = []byte(stripInteractiveElements(htmlContent))
-
 	// Create LIV file
-	zipContainer := container.NewZIPContainer()
-	err = zipContainer.CreateFromFiles(files, outputFile)
+	err = outputContainer().CreateFromFiles(files, outputFile)
 	if err != nil {
 		return fmt.Errorf("failed to create LIV file: %v", err)
 	}
@@ -679,8 +1178,21 @@ func convertToLIV(inputFile, outputFile string) error {
 	return nil
 }
 
-func convertToPDF(livFile, outputFile string, quality int) error {
-	fmt.Printf("Converting LIV document to PDF...\n")
+// convertToPDF exports a document as PDF. pages overrides the running
+// headers and footers, contents page and cover of the document's print hints.
+func convertToPDF(livFile, outputFile string, quality int, renderer string, pages *core.PrintSettings, profile *pdfops.PrintProfile, largePrint bool) error {
+	if largePrint {
+		fmt.Printf("Converting LIV document to large-print PDF...\n")
+	} else {
+		fmt.Printf("Converting LIV document to PDF...\n")
+	}
+
+	chromePath := findChromeExecutable()
+	switch renderer {
+	case "", "auto", "chrome", "native":
+	default:
+		return fmt.Errorf("unknown PDF renderer: %s (expected auto, native or chrome)", renderer)
+	}
 
 	// Extract document
 	zipContainer := container.NewZIPContainer()
@@ -700,6 +1212,31 @@ func convertToPDF(livFile, outputFile string, quality int) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse manifest: %v", err)
 	}
+	applyPageFurniture(doc, pages)
+
+	// Headers, footers, contents, covers, print profiles and large print are
+	// handled by the built-in renderer only
+	furnished := doc.Print != nil && (doc.Print.Header != "" || doc.Print.Footer != "" || doc.Print.TableOfContents || doc.Print.Cover)
+	switch renderer {
+	case "", "auto":
+		renderer = "native"
+		if chromePath != "" && !furnished && profile == nil && !largePrint {
+			renderer = "chrome"
+		}
+	case "chrome":
+		if chromePath == "" {
+			return fmt.Errorf("Chrome/Chromium not found. Install Chrome or Chromium, or use --renderer native")
+		}
+		if furnished {
+			fmt.Printf("Warning: headers, footers, contents and cover pages need --renderer native\n")
+		}
+		if profile != nil {
+			return fmt.Errorf("print profiles need --renderer native")
+		}
+		if largePrint {
+			return fmt.Errorf("large print needs --renderer native")
+		}
+	}
 
 	// Get content
 	htmlContent := getFileContentSafe(files, "content/index.html")
@@ -708,27 +1245,135 @@ func convertToPDF(livFile, outputFile string, quality int) error {
 
 	// Use static fallback if available, otherwise use main HTML
 	contentToConvert := staticFallback
+	contentPath := "content/static/fallback.html"
 	if contentToConvert == "" {
 		contentToConvert = htmlContent
+		contentPath = "content/index.html"
 	}
 
 	if contentToConvert == "" {
 		return fmt.Errorf("no content found to convert")
 	}
 
-	// Create temporary HTML file with embedded CSS for PDF generation
-	tempHTML := createPDFReadyHTML(contentToConvert, cssContent, doc.Metadata.Title)
+	if renderer == "native" {
+		fmt.Printf("Rendering with the built-in PDF renderer\n")
+		err = generateNativePDF(contentToConvert, contentPath, files, doc, outputFile, quality, profile, largePrint)
+	} else {
+		fmt.Printf("Rendering with %s\n", chromePath)
+
+		// Create temporary HTML file with embedded CSS for PDF generation
+		tempHTML := createPDFReadyHTML(contentToConvert, cssContent+"\n"+printStylesheet(files, doc, contentToConvert), doc.Metadata.Title)
 
-	// Generate PDF using headless browser approach
-	err = generatePDFFromHTML(tempHTML, outputFile, quality)
+		// Generate PDF using headless browser approach
+		err = generatePDFFromHTML(chromePath, tempHTML, outputFile)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to generate PDF: %v", err)
 	}
 
+	// Carry the license into the PDF's document information
+	if doc.License != nil {
+		if err := pdfops.AppendDocumentInfo(outputFile, pdfLicenseInfo(doc)); err != nil {
+			return fmt.Errorf("failed to embed license metadata: %v", err)
+		}
+	}
+
 	fmt.Printf("✓ PDF exported to: %s\n", outputFile)
 	return nil
 }
 
+// applyPageFurniture overrides a document's running headers and footers,
+// contents page and cover with those asked for on the command line
+func applyPageFurniture(doc *core.Manifest, pages *core.PrintSettings) {
+	if pages == nil || (pages.Header == "" && pages.Footer == "" && !pages.TableOfContents && !pages.Cover) {
+		return
+	}
+	settings := core.PrintSettings{}
+	if doc.Print != nil {
+		settings = *doc.Print
+	}
+	if pages.Header != "" {
+		settings.Header = pages.Header
+	}
+	if pages.Footer != "" {
+		settings.Footer = pages.Footer
+	}
+	settings.TableOfContents = settings.TableOfContents || pages.TableOfContents
+	settings.Cover = settings.Cover || pages.Cover
+	doc.Print = &settings
+}
+
+// pressOptions are the convert flags preparing a PDF for print
+type pressOptions struct {
+	profile       string
+	condition     string
+	minResolution float64
+}
+
+// load reads the print profile, or returns nil when none was given
+func (o *pressOptions) load() (*pdfops.PrintProfile, error) {
+	if o.profile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(o.profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read print profile: %v", err)
+	}
+	profile, err := pdfops.ParsePrintProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid print profile %s: %v", o.profile, err)
+	}
+	profile.OutputCondition = o.condition
+	profile.MinResolution = o.minResolution
+	if profile.Description != "" {
+		fmt.Printf("Preparing PDF for print with %s\n", profile.Description)
+	}
+	return profile, nil
+}
+
+// pdfLicenseInfo builds the PDF document information entries for a licensed document
+func pdfLicenseInfo(doc *core.Manifest) map[string]string {
+	info := map[string]string{
+		"Title":   doc.Metadata.Title,
+		"Author":  doc.Metadata.AuthorNames(),
+		"Creator": "LIV",
+		"Rights":  doc.License.Summary(),
+	}
+	if funding := doc.Metadata.FundingStatement(); funding != "" {
+		info["Funding"] = funding
+	}
+	if doc.License.SPDX != "" {
+		info["License"] = doc.License.SPDX
+	}
+	if doc.License.URL != "" {
+		info["LicenseURL"] = doc.License.URL
+	}
+	if len(doc.License.AllowedUses) > 0 {
+		info["AllowedUses"] = strings.Join(doc.License.AllowedUses, ", ")
+	}
+	return info
+}
+
+// printStylesheet returns the print stylesheet of a document, generating one
+// from its content and page hints when it was built without
+func printStylesheet(files map[string][]byte, doc *core.Manifest, content string) string {
+	if doc.Print != nil && doc.Print.Stylesheet != "" {
+		if css, exists := files[doc.Print.Stylesheet]; exists {
+			return string(css)
+		}
+	}
+	structure, err := printstyle.Analyze([]byte(content))
+	if err != nil {
+		return ""
+	}
+	css, err := printstyle.Generate(structure, doc.Print)
+	if err != nil {
+		fmt.Printf("Warning: ignoring print hints: %v\n", err)
+		css, _ = printstyle.Generate(structure, nil)
+	}
+	return string(css)
+}
+
 func createPDFReadyHTML(htmlContent, cssContent, title string) string {
 	// Create complete HTML document optimized for PDF generation
 	html := fmt.Sprintf(`<!DOCTYPE html>
@@ -815,8 +1460,9 @@ func createPDFReadyHTML(htmlContent, cssContent, title string) string {
 	return html
 }
 
-func generatePDFFromHTML(htmlContent, outputFile string, quality int) error {
-	// Try to use headless Chrome/Chromium for PDF generation
+// findChromeExecutable returns the path of an installed Chrome or Chromium, or
+// an empty string if none is found
+func findChromeExecutable() string {
 	chromePaths := []string{
 		"google-chrome",
 		"chromium",
@@ -827,23 +1473,79 @@ func generatePDFFromHTML(htmlContent, outputFile string, quality int) error {
 		"C:\\Program Files (x86)\\Google\\Chrome\\Application\\chrome.exe",
 	}
 
-	var chromePath string
 	for _, path := range chromePaths {
 		if _, err := exec.LookPath(path); err == nil {
-			chromePath = path
-			break
+			return path
 		}
 		// Check if file exists (for absolute paths)
 		if _, err := os.Stat(path); err == nil {
-			chromePath = path
-			break
+			return path
 		}
 	}
 
-	if chromePath == "" {
-		return fmt.Errorf("Chrome/Chromium not found. Please install Chrome or Chromium for PDF generation")
+	return ""
+}
+
+// generateNativePDF renders a document's HTML with the built-in renderer.
+// Images are loaded from the package relative to the rendered content file.
+func generateNativePDF(htmlContent, contentPath string, files map[string][]byte, doc *core.Manifest, outputFile string, quality int, profile *pdfops.PrintProfile, largePrint bool) error {
+	options := pdfops.RenderOptions{
+		ImageQuality: quality,
+		PrintProfile: profile,
+		Warn: func(message string) {
+			fmt.Printf("Warning: %s\n", message)
+		},
+		LoadImage: func(src string) ([]byte, error) {
+			if strings.Contains(src, ":") {
+				return nil, fmt.Errorf("external image not embedded: %s", src)
+			}
+			resolved := path.Join(path.Dir(contentPath), strings.SplitN(src, "?", 2)[0])
+			read := func(entry string) ([]byte, error) {
+				if data, exists := files[entry]; exists {
+					return data, nil
+				}
+				return nil, fmt.Errorf("image not found in document: %s", entry)
+			}
+			// The renderer cannot draw SVG, so chart snapshots are drawn again
+			if strings.HasPrefix(resolved, charts.SnapshotPrefix) {
+				return charts.SnapshotPNG(resolved, read)
+			}
+			return read(resolved)
+		},
+	}
+	if doc.Metadata != nil {
+		options.Title = doc.Metadata.Title
+		options.Author = doc.Metadata.AuthorNames()
+		options.Keywords = strings.Join(doc.Metadata.Keywords, ", ")
+		options.Subject = strings.Join(doc.Metadata.SubjectHeadings(), "; ")
+	}
+	if err := printstyle.Configure(&options, doc.Print); err != nil {
+		fmt.Printf("Warning: ignoring print hints: %v\n", err)
+	}
+	options.Cover = printstyle.Cover(doc, func(entry string) ([]byte, error) {
+		if data, exists := files[entry]; exists {
+			return data, nil
+		}
+		return nil, fmt.Errorf("entry not found: %s", entry)
+	})
+	if largePrint {
+		options.Scale = pdfops.LargePrintScale
+		options.Plain = true
+	}
+
+	output, err := atomicfile.Create(outputFile, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create PDF file: %v", err)
 	}
+	defer output.Close()
+	if err := pdfops.RenderHTML(htmlContent, output, options); err != nil {
+		return err
+	}
+	return output.Commit()
+}
 
+// generatePDFFromHTML prints HTML to PDF with headless Chrome
+func generatePDFFromHTML(chromePath, htmlContent, outputFile string) error {
 	// Create temporary HTML file
 	tempDir := os.TempDir()
 	tempHTMLFile := filepath.Join(tempDir, fmt.Sprintf("liv-pdf-temp-%d.html", time.Now().Unix()))
@@ -854,13 +1556,18 @@ func generatePDFFromHTML(htmlContent, outputFile string, quality int) error {
 	}
 	defer os.Remove(tempHTMLFile)
 
+	// Chrome writes the PDF as it prints, so it prints beside the HTML file
+	// and the PDF replaces the output once complete
+	tempPDFFile := strings.TrimSuffix(tempHTMLFile, ".html") + ".pdf"
+	defer os.Remove(tempPDFFile)
+
 	// Generate PDF using Chrome headless
 	args := []string{
 		"--headless",
 		"--disable-gpu",
 		"--no-sandbox",
 		"--disable-dev-shm-usage",
-		"--print-to-pdf=" + outputFile,
+		"--print-to-pdf=" + tempPDFFile,
 		"--virtual-time-budget=5000",
 		"--run-all-compositor-stages-before-draw",
 		"file://" + tempHTMLFile,
@@ -873,172 +1580,18 @@ func generatePDFFromHTML(htmlContent, outputFile string, quality int) error {
 	}
 
 	// Verify PDF was created
-	if _, err := os.Stat(outputFile); os.IsNotExist(err) {
+	pdf, err := os.Open(tempPDFFile)
+	if os.IsNotExist(err) {
 		return fmt.Errorf("PDF file was not created")
+	} else if err != nil {
+		return err
 	}
+	defer pdf.Close()
 
-	return nil
-}
-
-// Markdown to HTML conversion function
-func convertMarkdownToHTML(markdownContent string) string {
-	html := markdownContent
-
-	// Convert headings
-	html = strings.ReplaceAll(html, "\n# ", "\n<h1>")
-	html = strings.ReplaceAll(html, "\n## ", "\n<h2>")
-	html = strings.ReplaceAll(html, "\n### ", "\n<h3>")
-	html = strings.ReplaceAll(html, "\n#### ", "\n<h4>")
-	html = strings.ReplaceAll(html, "\n##### ", "\n<h5>")
-	html = strings.ReplaceAll(html, "\n###### ", "\n<h6>")
-
-	// Handle headings at start of document
-	if strings.HasPrefix(html, "# ") {
-		html = "<h1>" + html[2:]
-	}
-	if strings.HasPrefix(html, "## ") {
-		html = "<h2>" + html[3:]
-	}
-	if strings.HasPrefix(html, "### ") {
-		html = "<h3>" + html[4:]
-	}
-	if strings.HasPrefix(html, "#### ") {
-		html = "<h4>" + html[5:]
-	}
-	if strings.HasPrefix(html, "##### ") {
-		html = "<h5>" + html[6:]
-	}
-	if strings.HasPrefix(html, "###### ") {
-		html = "<h6>" + html[7:]
-	}
-
-	// Close heading tags at line endings
-	html = strings.ReplaceAll(html, "<h1>", "<h1>")
-	html = strings.ReplaceAll(html, "<h2>", "<h2>")
-	html = strings.ReplaceAll(html, "<h3>", "<h3>")
-	html = strings.ReplaceAll(html, "<h4>", "<h4>")
-	html = strings.ReplaceAll(html, "<h5>", "<h5>")
-	html = strings.ReplaceAll(html, "<h6>", "<h6>")
-
-	// Convert emphasis
-	html = strings.ReplaceAll(html, "**", "<strong>")
-	html = strings.ReplaceAll(html, "*", "<em>")
-
-	// Convert code
-	html = strings.ReplaceAll(html, "`", "<code>")
-	html = strings.ReplaceAll(html, "```", "<pre>")
-
-	// Convert horizontal rules
-	html = strings.ReplaceAll(html, "\n---\n", "\n<hr>\n")
-	html = strings.ReplaceAll(html, "\n***\n", "\n<hr>\n")
-
-	// Convert line breaks to paragraphs (simple approach)
-	lines := strings.Split(html, "\n")
-	var processedLines []string
-	inParagraph := false
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			if inParagraph {
-				processedLines = append(processedLines, "</p>")
-				inParagraph = false
-			}
-		} else if strings.HasPrefix(line, "<h") || strings.HasPrefix(line, "<hr") || strings.HasPrefix(line, "<pre") {
-			if inParagraph {
-				processedLines = append(processedLines, "</p>")
-				inParagraph = false
-			}
-			processedLines = append(processedLines, line)
-		} else {
-			if !inParagraph {
-				processedLines = append(processedLines, "<p>")
-				inParagraph = true
-			}
-			processedLines = append(processedLines, line)
-		}
-	}
-
-	if inParagraph {
-		processedLines = append(processedLines, "</p>")
-	}
-
-	return strings.Join(processedLines, "\n")
-}
-
-// HTML to Markdown conversion function
-func convertHTMLToMarkdown(htmlContent string) string {
-	markdown := htmlContent
-
-	// Convert headings
-	markdown = strings.ReplaceAll(markdown, "<h1>", "# ")
-	markdown = strings.ReplaceAll(markdown, "</h1>", "\n\n")
-	markdown = strings.ReplaceAll(markdown, "<h2>", "## ")
-	markdown = strings.ReplaceAll(markdown, "</h2>", "\n\n")
-	markdown = strings.ReplaceAll(markdown, "<h3>", "### ")
-	markdown = strings.ReplaceAll(markdown, "</h3>", "\n\n")
-	markdown = strings.ReplaceAll(markdown, "<h4>", "#### ")
-	markdown = strings.ReplaceAll(markdown, "</h4>", "\n\n")
-	markdown = strings.ReplaceAll(markdown, "<h5>", "##### ")
-	markdown = strings.ReplaceAll(markdown, "</h5>", "\n\n")
-	markdown = strings.ReplaceAll(markdown, "<h6>", "###### ")
-	markdown = strings.ReplaceAll(markdown, "</h6>", "\n\n")
-
-	// Convert paragraphs
-	markdown = strings.ReplaceAll(markdown, "<p>", "")
-	markdown = strings.ReplaceAll(markdown, "</p>", "\n\n")
-
-	// Convert emphasis
-	markdown = strings.ReplaceAll(markdown, "<strong>", "**")
-	markdown = strings.ReplaceAll(markdown, "</strong>", "**")
-	markdown = strings.ReplaceAll(markdown, "<b>", "**")
-	markdown = strings.ReplaceAll(markdown, "</b>", "**")
-	markdown = strings.ReplaceAll(markdown, "<em>", "*")
-	markdown = strings.ReplaceAll(markdown, "</em>", "*")
-	markdown = strings.ReplaceAll(markdown, "<i>", "*")
-	markdown = strings.ReplaceAll(markdown, "</i>", "*")
-
-	// Convert code
-	markdown = strings.ReplaceAll(markdown, "<code>", "`")
-	markdown = strings.ReplaceAll(markdown, "</code>", "`")
-	markdown = strings.ReplaceAll(markdown, "<pre>", "```\n")
-	markdown = strings.ReplaceAll(markdown, "</pre>", "\n```\n\n")
-
-	// Convert horizontal rules
-	markdown = strings.ReplaceAll(markdown, "<hr>", "---\n\n")
-	markdown = strings.ReplaceAll(markdown, "<hr/>", "---\n\n")
-	markdown = strings.ReplaceAll(markdown, "<hr />", "---\n\n")
-
-	// Convert line breaks
-	markdown = strings.ReplaceAll(markdown, "<br>", "\n")
-	markdown = strings.ReplaceAll(markdown, "<br/>", "\n")
-	markdown = strings.ReplaceAll(markdown, "<br />", "\n")
-
-	// Remove remaining HTML tags (simple approach)
-	// This is a basic implementation - for production use, consider using a proper HTML parser
-	for strings.Contains(markdown, "<") && strings.Contains(markdown, ">") {
-		start := strings.Index(markdown, "<")
-		end := strings.Index(markdown[start:], ">")
-		if end == -1 {
-			break
-		}
-		markdown = markdown[:start] + markdown[start+end+1:]
-	}
-
-	// Clean up extra whitespace
-	lines := strings.Split(markdown, "\n")
-	var cleanLines []string
-	for _, line := range lines {
-		cleanLines = append(cleanLines, strings.TrimSpace(line))
-	}
-	markdown = strings.Join(cleanLines, "\n")
-
-	// Remove excessive newlines
-	for strings.Contains(markdown, "\n\n\n") {
-		markdown = strings.ReplaceAll(markdown, "\n\n\n", "\n\n")
-	}
-
-	return strings.TrimSpace(markdown)
+	return atomicfile.Write(outputFile, 0644, func(w io.Writer) error {
+		_, err := io.Copy(w, pdf)
+		return err
+	})
 }
 
 // Create manifest for imported documents
@@ -1046,11 +1599,12 @@ func createImportManifest(title string) *manifest.ManifestBuilder {
 	builder := manifest.NewManifestBuilder()
 
 	// Set metadata
+	now := core.UTC(time.Now())
 	metadata := &core.DocumentMetadata{
 		Title:       title,
 		Author:      "LIV Converter",
-		Created:     time.Now(),
-		Modified:    time.Now(),
+		Created:     now,
+		Modified:    now,
 		Description: "Imported document",
 		Version:     "1.0.0",
 		Language:    "en",
@@ -1102,8 +1656,8 @@ func createImportManifest(title string) *manifest.ManifestBuilder {
 
 	// Add resources
 	builder.AddResource("content/index.html", &core.Resource{
-		Hash: "", // Will be calculated during packaging
-		Size: 0,  // Will be calculated during packaging
+		Hash: "", // Set from the content by convertToLIV
+		Size: 0,  // Set from the content by convertToLIV
 		Type: "text/html",
 	})
 	builder.AddResource("content/styles/main.css", &core.Resource{
@@ -1312,7 +1866,7 @@ func getFileContentSafe(files map[string][]byte, path string) string {
 	return ""
 }
 
-func runValidate(file string, checkSignatures, verbose bool) error {
+func runValidate(file string, checkSignatures, requireLicense bool, funderRegistry, extensionSchemas string, vulnerabilities vulnerabilityOptions, clockSkew time.Duration, verbose bool) error {
 	if verbose {
 		fmt.Printf("Validating LIV document: %s\n", file)
 	}
@@ -1361,6 +1915,18 @@ func runValidate(file string, checkSignatures, verbose bool) error {
 
 	// Validate manifest
 	validator := manifest.NewManifestValidator()
+	validator.SetClockSkew(clockSkew)
+	if extensionSchemas != "" {
+		schemas, err := manifest.LoadExtensionSchemas(extensionSchemas)
+		if err != nil {
+			return err
+		}
+		for namespace, schema := range schemas {
+			if err := validator.RegisterExtension(namespace, schema); err != nil {
+				return err
+			}
+		}
+	}
 	parsedManifest, manifestResult := validator.ValidateManifestJSON(manifestData)
 
 	if verbose {
@@ -1382,6 +1948,127 @@ func runValidate(file string, checkSignatures, verbose bool) error {
 			fmt.Printf("  Warning: %s\n", warning)
 		}
 	}
+	if verbose {
+		for _, finding := range manifestResult.Findings {
+			if finding.Severity == core.SeverityInfo {
+				fmt.Printf("  Note: %s\n", finding.Message)
+			}
+		}
+	}
+
+	// Check license information
+	licenseValid := true
+	if parsedManifest != nil && parsedManifest.License != nil {
+		fmt.Printf("✓ License: %s\n", parsedManifest.License.Summary())
+	}
+	if requireLicense {
+		if verbose {
+			fmt.Printf("\nLicense Validation:\n")
+		}
+		licenseErrors := validator.ValidateLicensePresence(parsedManifest)
+		for _, err := range licenseErrors {
+			fmt.Printf("✗ %s\n", err)
+		}
+		licenseValid = len(licenseErrors) == 0
+	}
+
+	// Check funding against the controlled vocabulary
+	fundingValid := true
+	if parsedManifest != nil && parsedManifest.Metadata != nil {
+		for _, funding := range parsedManifest.Metadata.Funding {
+			fmt.Printf("✓ Funding: %s\n", funding.Summary())
+		}
+	}
+	if funderRegistry != "" {
+		if verbose {
+			fmt.Printf("\nFunding Validation:\n")
+		}
+		registry, err := manifest.LoadFunderRegistry(funderRegistry)
+		if err != nil {
+			return err
+		}
+		fundingErrors, fundingWarnings := validator.ValidateFundingRegistry(parsedManifest, registry)
+		for _, err := range fundingErrors {
+			fmt.Printf("✗ %s\n", err)
+		}
+		for _, warning := range fundingWarnings {
+			fmt.Printf("⚠ %s\n", warning)
+		}
+		fundingValid = len(fundingErrors) == 0
+		if fundingValid && verbose {
+			fmt.Printf("✓ Funders are listed in the registry of %d funders\n", registry.Len())
+		}
+	}
+	// Check the interactive spec against its schema
+	interactiveValid := true
+	if spec, exists := files[interactive.SpecPath]; exists {
+		if verbose {
+			fmt.Printf("\nInteractive Spec Validation:\n")
+		}
+		result := interactive.Validate(spec, func(p string) bool {
+			_, exists := files[p]
+			return exists
+		})
+		for _, err := range result.Errors {
+			fmt.Printf("✗ %s: %s\n", interactive.SpecPath, err)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("⚠ %s: %s\n", interactive.SpecPath, warning)
+		}
+		interactiveValid = result.IsValid
+		if interactiveValid {
+			fmt.Printf("✓ Interactive spec is valid\n")
+		}
+	}
+	// Check embedded libraries against the advisory feed
+	componentsValid := true
+	if vulnerabilities.FeedFile != "" {
+		if verbose {
+			fmt.Printf("\nVulnerability Validation:\n")
+		}
+		componentsValid, err = checkVulnerabilities(files, parsedManifest, vulnerabilities, verbose)
+		if err != nil {
+			return err
+		}
+	}
+	if parsedManifest != nil && parsedManifest.Requirements != nil {
+		requirements := parsedManifest.Requirements
+		if requirements.MinFormatVersion != "" {
+			fmt.Printf("✓ Requires viewers reading format %s or later\n", requirements.MinFormatVersion)
+		}
+		if len(requirements.Features) > 0 {
+			fmt.Printf("✓ Requires viewer features: %s\n", strings.Join(requirements.Features, ", "))
+		}
+	}
+	if parsedManifest != nil && parsedManifest.Access != nil {
+		policy := parsedManifest.Access
+		var limits []string
+		if policy.NotBefore != nil {
+			limits = append(limits, "opens "+policy.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if policy.NotAfter != nil {
+			limits = append(limits, "closes "+policy.NotAfter.UTC().Format(time.RFC3339))
+		}
+		if policy.MaxOpens > 0 {
+			limits = append(limits, fmt.Sprintf("%d opens per reader", policy.MaxOpens))
+		}
+		if policy.Watermark != nil {
+			limits = append(limits, "watermarked")
+		}
+		if len(limits) == 0 {
+			limits = append(limits, "no limits")
+		}
+		fmt.Printf("✓ Access policy: %s\n", strings.Join(limits, ", "))
+		if packageSigners(files) == 0 {
+			fmt.Printf("⚠ The access policy is not signed and can be removed; sign the document with liv sign\n")
+		}
+	}
+	if parsedManifest != nil && parsedManifest.Compliance != nil {
+		for _, waiver := range parsedManifest.Compliance.Waivers {
+			fmt.Printf("⚠ License waiver for %d assets by %s on %s: %s\n",
+				len(waiver.Assets), waiver.ApprovedBy, waiver.Granted.Format("2006-01-02"), waiver.Reason)
+		}
+	}
 
 	// Check signatures if requested
 	if checkSignatures && parsedManifest != nil {
@@ -1425,7 +2112,7 @@ func runValidate(file string, checkSignatures, verbose bool) error {
 
 	// Summary
 	fmt.Printf("\nValidation Summary:\n")
-	allValid := structureResult.IsValid && manifestResult.IsValid
+	allValid := structureResult.IsValid && manifestResult.IsValid && licenseValid && fundingValid && interactiveValid && componentsValid
 	if allValid {
 		fmt.Printf("✓ Document is valid\n")
 		return nil
@@ -1435,7 +2122,7 @@ func runValidate(file string, checkSignatures, verbose bool) error {
 	}
 }
 
-func runSign(file, keyFile, outputFile string) error {
+func runSign(file, keyFile, outputFile, tsaURL string, appendSignature bool, signer core.SignerInfo) error {
 	fmt.Printf("Signing LIV document: %s\n", file)
 
 	// Check if files exist
@@ -1486,7 +2173,7 @@ func runSign(file, keyFile, outputFile string) error {
 		Content: &core.DocumentContent{
 			HTML:            string(files["content/index.html"]),
 			CSS:             getFileContentSafe(files, "content/styles/main.css"),
-			InteractiveSpec: getFileContentSafe(files, "content/interactive.json"),
+			InteractiveSpec: getFileContentSafe(files, "content/scripts/main.js"),
 			StaticFallback:  getFileContentSafe(files, "content/static/fallback.html"),
 		},
 		WASMModules: make(map[string][]byte),
@@ -1500,19 +2187,35 @@ func runSign(file, keyFile, outputFile string) error {
 		}
 	}
 
+	if appendSignature {
+		return appendSign(sigManager, document, files, privateKey, signer, outputFile, tsaURL)
+	}
+
+	// Update manifest with new modification time, which the manifest
+	// signature covers
+	document.Manifest.Metadata.Modified = core.UTC(time.Now())
+
 	// Sign the document
 	fmt.Printf("Generating signatures...\n")
 	signatures, err := sigManager.SignDocument(document, privateKey)
 	if err != nil {
 		return fmt.Errorf("failed to sign document: %v", err)
 	}
+	signer.KeyID = sigManager.KeyID(privateKey.Public())
+	signer.SignedAt = core.UTC(time.Now())
+	signatures.Signer = &signer
+
+	// Timestamp the signatures
+	if tsaURL != "" {
+		fmt.Printf("Requesting timestamp from %s...\n", tsaURL)
+		if err := sigManager.TimestampSignatures(context.Background(), signatures, tsa.NewClient(tsaURL)); err != nil {
+			return err
+		}
+	}
 
 	// Update document with signatures
 	document.Signatures = signatures
 
-	// Update manifest with new modification time
-	document.Manifest.Metadata.Modified = time.Now()
-
 	// Re-serialize manifest
 	manifestBuilder := manifest.NewManifestBuilder()
 	manifestBuilder.SetMetadata(document.Manifest.Metadata)
@@ -1523,6 +2226,13 @@ func runSign(file, keyFile, outputFile string) error {
 	if document.Manifest.Features != nil {
 		manifestBuilder.SetFeatureFlags(document.Manifest.Features)
 	}
+	manifestBuilder.SetEncryption(document.Manifest.Encryption)
+	manifestBuilder.SetDisclosure(document.Manifest.Disclosure)
+	manifestBuilder.SetLicense(document.Manifest.License)
+	manifestBuilder.SetCompliance(document.Manifest.Compliance)
+	manifestBuilder.SetRequirements(document.Manifest.Requirements)
+	manifestBuilder.SetExtensions(document.Manifest.Extensions)
+	manifestBuilder.SetAccess(document.Manifest.Access)
 
 	// Add resources back
 	for path, resource := range document.Manifest.Resources {
@@ -1537,9 +2247,12 @@ func runSign(file, keyFile, outputFile string) error {
 	// Update files with new manifest
 	files["manifest.json"] = updatedManifestData
 
+	// Replace any previous signatures
+	replaceSignatureFiles(files, signatures)
+
 	// Create signed document
 	fmt.Printf("Creating signed document...\n")
-	err = zipContainer.CreateFromFiles(files, outputFile)
+	err = writeFiles(files, outputFile)
 	if err != nil {
 		return fmt.Errorf("failed to create signed document: %v", err)
 	}
@@ -1550,11 +2263,70 @@ func runSign(file, keyFile, outputFile string) error {
 	if len(signatures.WASMSignatures) > 0 {
 		fmt.Printf("  WASM signatures: %d modules\n", len(signatures.WASMSignatures))
 	}
+	if len(signatures.Timestamp) > 0 {
+		fmt.Printf("  Timestamp: %s\n", tsaURL)
+	}
+	fmt.Printf("  Signer: %s\n", signer.Summary())
+	fmt.Printf("  Output: %s\n", outputFile)
+
+	return nil
+}
+
+// appendSign counter-signs a signed document. The manifest is left untouched,
+// as changing it would invalidate the existing signatures.
+func appendSign(sigManager *integrity.SignatureManager, document *core.LIVDocument, files map[string][]byte, privateKey crypto.Signer, signer core.SignerInfo, outputFile, tsaURL string) error {
+	signatures, err := container.ReadSignatureFiles(files)
+	if err != nil {
+		return fmt.Errorf("failed to read signatures: %v", err)
+	}
+	if signatures.ManifestSignature == "" {
+		return fmt.Errorf("document is not signed; sign it without --append first")
+	}
+	document.Signatures = signatures
+
+	fmt.Printf("Generating counter-signature...\n")
+	counter, err := sigManager.CounterSign(document, signer, privateKey)
+	if err != nil {
+		return err
+	}
+	if tsaURL != "" {
+		fmt.Printf("Requesting timestamp from %s...\n", tsaURL)
+		if err := sigManager.TimestampCounterSignature(context.Background(), counter, tsa.NewClient(tsaURL)); err != nil {
+			return err
+		}
+	}
+
+	replaceSignatureFiles(files, signatures)
+
+	fmt.Printf("Creating signed document...\n")
+	if err := writeFiles(files, outputFile); err != nil {
+		return fmt.Errorf("failed to create signed document: %v", err)
+	}
+
+	fmt.Printf("✓ Document counter-signed successfully\n")
+	fmt.Printf("  Signer: %s\n", counter.Signer.Summary())
+	fmt.Printf("  Signers: %d\n", len(signatures.CounterSignatures)+1)
+	if len(counter.Timestamp) > 0 {
+		fmt.Printf("  Timestamp: %s\n", tsaURL)
+	}
 	fmt.Printf("  Output: %s\n", outputFile)
 
 	return nil
 }
 
+// replaceSignatureFiles replaces the signatures stored in a package, keeping
+// the signing certificate
+func replaceSignatureFiles(files map[string][]byte, signatures *core.SignatureBundle) {
+	for path := range files {
+		if strings.HasPrefix(path, "signatures/") && path != "signatures/certificate.pem" {
+			delete(files, path)
+		}
+	}
+	for path, data := range container.SignatureFiles(signatures) {
+		files[path] = data
+	}
+}
+
 func pdfCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "pdf",
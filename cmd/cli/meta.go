@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/spf13/cobra"
+)
+
+func metaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "meta",
+		Short: "Show or edit the metadata of a document",
+		Long: `Meta shows the metadata of a document, such as its title and authors, or
+edits it without building the document again. Only the manifest is rewritten;
+the content and resources are left as they are.`,
+	}
+	cmd.AddCommand(metaGetCmd())
+	cmd.AddCommand(metaSetCmd())
+	return cmd
+}
+
+func metaGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get [file]",
+		Short: "Print the metadata of a document as JSON",
+		Example: `  liv meta get report.liv
+  liv meta get report.liv | jq '.title = "Annual Report"' | liv meta set report.liv --from-json -`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := container.NewZIPContainer().ExtractToMemory(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to extract document: %v", err)
+			}
+			m, err := readEditableManifest(files)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(m.Metadata, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to serialize metadata: %v", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\n", data)
+			return nil
+		},
+	}
+}
+
+// metadataEdit is a change to the metadata of a document: the fields of a
+// JSON object, then those given as flags. Nil fields are left as they are.
+type metadataEdit struct {
+	// FromJSON is a file holding a JSON object of metadata fields, or - for
+	// standard input
+	FromJSON    string
+	Title       *string
+	Author      *string
+	Description *string
+	Abstract    *string
+	Language    *string
+	Version     *string
+}
+
+func metaSetCmd() *cobra.Command {
+	var (
+		edit       metadataEdit
+		fields     = map[string]*string{}
+		outputFile string
+		keyFile    string
+		signer     core.SignerInfo
+	)
+
+	cmd := &cobra.Command{
+		Use:   "set [file]",
+		Short: "Edit the metadata of a document",
+		Long: `Set changes metadata fields of a document and records when it was modified.
+With --from-json the fields of a JSON object are applied first, as printed by
+liv meta get, so scripts can edit any field; flags are applied after it.
+
+The manifest signature covers the metadata, so changing it invalidates the
+signatures of a signed document, counter-signatures included. They are
+removed and reported; with --key the document is signed again. When nothing
+changes, the document is left untouched and keeps its signatures.`,
+		Example: `  liv meta set report.liv --title "Annual Report 2024" --author "ACME Corp"
+  liv meta set report.liv --from-json metadata.json -o report-2024.liv
+  liv meta set report.liv --version 1.1.0 --key author.pem --signer-name "Ada Author" --role author`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for name, value := range fields {
+				if !cmd.Flags().Changed(name) {
+					continue
+				}
+				switch name {
+				case "title":
+					edit.Title = value
+				case "author":
+					edit.Author = value
+				case "description":
+					edit.Description = value
+				case "abstract":
+					edit.Abstract = value
+				case "language":
+					edit.Language = value
+				case "version":
+					edit.Version = value
+				}
+			}
+			return runMetaSet(args[0], outputFile, edit, keyFile, signer)
+		},
+	}
+
+	for _, field := range []struct{ name, usage string }{
+		{"title", "Title of the document"},
+		{"author", "Author shown to readers"},
+		{"description", "Description of the document"},
+		{"abstract", "Abstract of the work, for indexes and DOI registration"},
+		{"language", "Two-letter language code, such as en"},
+		{"version", "Version of the document, such as 1.1.0"},
+	} {
+		fields[field.name] = cmd.Flags().String(field.name, "", field.usage)
+	}
+	cmd.Flags().StringVar(&edit.FromJSON, "from-json", "", "JSON file of metadata fields to apply, or - for standard input")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: overwrite input)")
+	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Private key file signing the edited document (default: unsigned)")
+	cmd.Flags().StringVar(&signer.Name, "signer-name", "", "Name of the signer")
+	cmd.Flags().StringVar(&signer.Email, "signer-email", "", "Email address of the signer")
+	cmd.Flags().StringVar(&signer.Role, "role", "", "Role of the signer, such as author or approver")
+
+	return cmd
+}
+
+func runMetaSet(livFile, outputFile string, edit metadataEdit, keyFile string, signer core.SignerInfo) error {
+	if outputFile == "" {
+		outputFile = livFile
+	}
+	// Fail before writing anything when the document cannot be signed again
+	if keyFile != "" {
+		if _, err := integrity.NewSignatureManager().LoadPrivateKeyPEM(keyFile); err != nil {
+			return fmt.Errorf("failed to load private key: %v", err)
+		}
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	m, err := readEditableManifest(files)
+	if err != nil {
+		return err
+	}
+
+	before, err := metadataFields(m.Metadata)
+	if err != nil {
+		return err
+	}
+	if err := edit.apply(m.Metadata, os.Stdin); err != nil {
+		return err
+	}
+	after, err := metadataFields(m.Metadata)
+	if err != nil {
+		return err
+	}
+	var changed []string
+	for name, value := range after {
+		if name != "modified" && !bytes.Equal(value, before[name]) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, kept := after[name]; !kept {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+
+	signers := packageSigners(files)
+
+	if len(changed) == 0 {
+		fmt.Printf("✓ Metadata unchanged\n")
+		if signers > 0 {
+			fmt.Printf("  Signatures: kept (%d signers)\n", signers)
+		}
+		if sameFile(livFile, outputFile) {
+			fmt.Printf("  Document: %s left as it was\n", livFile)
+			return nil
+		}
+		if err := copyDocument(livFile, outputFile); err != nil {
+			return err
+		}
+		fmt.Printf("  Output: %s, a copy of %s\n", outputFile, livFile)
+		return nil
+	}
+
+	m.Metadata.Modified = core.UTC(time.Now())
+	m.Metadata.NormalizeTimes()
+	if m.Metadata.Modified.Before(m.Metadata.Created) {
+		m.Metadata.Modified = m.Metadata.Created
+	}
+	if result := manifest.NewManifestValidator().ValidateManifest(m); !result.IsValid {
+		return fmt.Errorf("edited metadata is invalid: %s", strings.Join(result.Errors, "; "))
+	}
+
+	// With a key, the edit is signed from a temporary copy so the output is
+	// only replaced once, by the signed document
+	written := outputFile
+	if keyFile != "" {
+		dir, err := os.MkdirTemp("", "liv-meta-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		written = filepath.Join(dir, filepath.Base(outputFile))
+	}
+	if err := writePackage(files, m, written); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Metadata updated\n")
+	fmt.Printf("  Changed: %s\n", strings.Join(changed, ", "))
+	if signers > 0 {
+		fmt.Printf("⚠ Signatures removed: the manifest signature covers the metadata, so the signatures of %d signers no longer match\n", signers)
+		if keyFile == "" {
+			fmt.Printf("  Sign the document again with liv sign, or edit it with --key\n")
+		}
+	}
+	fmt.Printf("  Output: %s\n", outputFile)
+
+	if keyFile != "" {
+		return runSign(written, keyFile, outputFile, "", false, signer)
+	}
+	return nil
+}
+
+// apply applies an edit to metadata, reading a JSON object from stdin when
+// FromJSON is -
+func (e metadataEdit) apply(metadata *core.DocumentMetadata, stdin io.Reader) error {
+	if e.FromJSON != "" {
+		var data []byte
+		var err error
+		if e.FromJSON == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(e.FromJSON)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read metadata: %v", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(metadata); err != nil {
+			return fmt.Errorf("invalid metadata JSON: %v", err)
+		}
+	}
+
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{e.Title, &metadata.Title},
+		{e.Author, &metadata.Author},
+		{e.Description, &metadata.Description},
+		{e.Abstract, &metadata.Abstract},
+		{e.Language, &metadata.Language},
+		{e.Version, &metadata.Version},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	return nil
+}
+
+// readEditableManifest reads the manifest of a package without validating
+// it, so metadata that makes it invalid can be corrected
+func readEditableManifest(files map[string][]byte) (*core.Manifest, error) {
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return nil, fmt.Errorf("manifest.json not found in document")
+	}
+	var m core.Manifest
+	if err := json.Unmarshal(manifestData, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if m.Metadata == nil {
+		m.Metadata = &core.DocumentMetadata{}
+	}
+	return &m, nil
+}
+
+// metadataFields returns the serialized metadata fields by JSON name, to tell
+// which an edit changed
+func metadataFields(metadata *core.DocumentMetadata) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize metadata: %v", err)
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// sameFile reports whether a and b name the same file
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	return err == nil && os.SameFile(aInfo, bInfo)
+}
+
+// copyDocument writes an unchanged document to outputFile as it is
+func copyDocument(livFile, outputFile string) error {
+	data, err := os.ReadFile(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to read document: %v", err)
+	}
+	out, err := atomicfile.Create(outputFile, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+	defer out.Close()
+	out.Backup = keepBackups
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/crossref"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/spf13/cobra"
+)
+
+func exportMetadataCmd() *cobra.Command {
+	var (
+		outputFile string
+		format     string
+		deposit    crossref.Deposit
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export-metadata [document.liv]",
+		Short: "Export document metadata for DOI registration",
+		Long: `Export-metadata writes the metadata of a document in a form registration
+agencies accept, so a DOI can be registered for it without entering the title,
+authors, abstract, license and funding again.
+
+The crossref format is a Crossref deposit (schema ` + crossref.SchemaVersion + `) registering the
+document as posted content. The manifest must give the DOI and the landing page
+it resolves to:
+
+  "publication": {"doi": "10.5555/report-2024", "url": "https://docs.example.com/report",
+                  "publisher": "Example Press"},
+  "abstract": "...",
+  "funding": [{"funder": "National Science Foundation", "funder_id": "10.13039/100000001",
+               "awards": ["CHE-1234567"]}]
+
+Authors with the roles author, editor and translator are deposited with their
+affiliations and ORCID iDs. Submit the file through the Crossref web deposit
+form or its HTTPS deposit API.`,
+		Example: `  liv export-metadata report.liv --depositor "Example Press" --email doi@example.com
+  liv export-metadata report.liv --format crossref --type report --depositor "Example Press" \
+    --email doi@example.com --output deposits/report.xml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExportMetadata(args[0], outputFile, format, deposit)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: the document name with .crossref.xml)")
+	cmd.Flags().StringVarP(&format, "format", "f", "crossref", "Metadata format (crossref)")
+	cmd.Flags().StringVar(&deposit.DepositorName, "depositor", "", "Name of the organization or person making the deposit")
+	cmd.Flags().StringVar(&deposit.DepositorEmail, "email", "", "Email address that receives the deposit report")
+	cmd.Flags().StringVar(&deposit.Registrant, "registrant", "", "Organization that owns the DOI (default: the publisher)")
+	cmd.Flags().StringVar(&deposit.BatchID, "batch-id", "", "Deposit batch ID (default: derived from the DOI and time)")
+	cmd.Flags().StringVar(&deposit.Type, "type", "other", "Content type: "+strings.Join(crossref.PostedTypes, ", "))
+
+	return cmd
+}
+
+func runExportMetadata(livFile, outputFile, format string, deposit crossref.Deposit) error {
+	if format != "crossref" {
+		return fmt.Errorf("unsupported metadata format: %s (use crossref)", format)
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return fmt.Errorf("manifest.json not found in document")
+	}
+	doc, err := manifest.NewManifestParser().ParseFromBytes(manifestData)
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	data, err := crossref.Encode(doc, deposit)
+	if err != nil {
+		return fmt.Errorf("failed to export Crossref metadata: %v", err)
+	}
+	if outputFile == "" {
+		outputFile = strings.TrimSuffix(livFile, filepath.Ext(livFile)) + ".crossref.xml"
+	}
+	if err := atomicfile.WriteFile(outputFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+
+	fmt.Printf("✓ Crossref deposit exported\n")
+	fmt.Printf("  DOI: %s\n", doc.Metadata.Publication.DOI)
+	fmt.Printf("  Resolves to: %s\n", doc.Metadata.Publication.URL)
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/convert"
+)
+
+// narrateDocument makes the media overlay of an epub-audio export: from the
+// document's own recordings when it has a narration script, and otherwise
+// by speaking it with the speech command (eSpeak NG by default)
+func narrateDocument(files map[string][]byte, narration *convert.Narration, language, speech string) (*convert.MediaOverlay, error) {
+	if data, exists := files[convert.NarrationScriptPath]; exists {
+		var script convert.NarrationScript
+		if err := json.Unmarshal(data, &script); err != nil {
+			return nil, fmt.Errorf("invalid narration script %s: %v", convert.NarrationScriptPath, err)
+		}
+		fmt.Printf("Synchronising %d narration clips...\n", len(script.Clips))
+		return convert.ScriptedNarration(narration, script, func(path string) ([]byte, bool) {
+			data, exists := files[path]
+			return data, exists
+		}, "content.xhtml")
+	}
+
+	command := convert.DefaultSpeechCommand
+	if speech != "" {
+		command = strings.Fields(speech)
+	} else if _, err := exec.LookPath(command[0]); err != nil {
+		return nil, fmt.Errorf("document has no %s and %s is not installed; set --speech-command", convert.NarrationScriptPath, command[0])
+	}
+	fmt.Printf("Narrating %d blocks of text...\n", len(narration.Segments))
+	return convert.SpeakNarration(narration, convert.CommandSpeaker{Command: command, Language: language}, "content.xhtml")
+}
+
+// overlayPackage lists the media overlay and its audio in the OPF manifest,
+// and returns the overlay's media:duration metadata
+func overlayPackage(overlay *convert.MediaOverlay) (items, metadata string) {
+	hrefs := make([]string, 0, len(overlay.Audio))
+	for href := range overlay.Audio {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+
+	items = "\n        <item id=\"overlay\" href=\"content.smil\" media-type=\"application/smil+xml\"/>"
+	for i, href := range hrefs {
+		items += fmt.Sprintf("\n        <item id=\"audio%d\" href=\"%s\" media-type=\"%s\"/>", i+1, escapeXML(href), audioMediaType(href))
+	}
+	clock := convert.FormatClock(overlay.Duration)
+	metadata = fmt.Sprintf("\n        <meta property=\"media:duration\" refines=\"#overlay\">%s</meta>", clock) +
+		fmt.Sprintf("\n        <meta property=\"media:duration\">%s</meta>", clock) +
+		"\n        <meta property=\"media:active-class\">-epub-media-overlay-active</meta>"
+	return items, metadata
+}
+
+func audioMediaType(href string) string {
+	switch strings.ToLower(path.Ext(href)) {
+	case ".mp3":
+		return "audio/mpeg"
+	case ".m4a", ".mp4", ".aac":
+		return "audio/mp4"
+	case ".ogg", ".opus":
+		return "audio/ogg"
+	case ".wav":
+		return "audio/wav"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// outlineEntry is a heading and the headings below it
+type outlineEntry struct {
+	heading  convert.NarrationSegment
+	depth    int
+	children []*outlineEntry
+}
+
+// epubOutline nests the headings of a document for the EPUB 3 navigation
+// document and the NCX navigation map, which DAISY players read. Skipped
+// heading levels nest under the nearest heading above them.
+func epubOutline(headings []convert.NarrationSegment) (nav, navMap string, depth int) {
+	root := &outlineEntry{}
+	stack := []*outlineEntry{root}
+	for _, heading := range headings {
+		for len(stack) > 1 && stack[len(stack)-1].heading.Level >= heading.Level {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		entry := &outlineEntry{heading: heading, depth: len(stack)}
+		parent.children = append(parent.children, entry)
+		stack = append(stack, entry)
+		depth = max(depth, entry.depth)
+	}
+
+	var navBuf, ncxBuf strings.Builder
+	playOrder := 0
+	var write func(entries []*outlineEntry, indent string)
+	write = func(entries []*outlineEntry, indent string) {
+		navBuf.WriteString(indent + "<ol>\n")
+		for _, entry := range entries {
+			playOrder++
+			href := "content.xhtml#" + escapeXML(entry.heading.ID)
+			title := escapeXML(entry.heading.Text)
+			fmt.Fprintf(&navBuf, "%s    <li><a href=\"%s\">%s</a>", indent, href, title)
+			in := ncxIndent(entry)
+			fmt.Fprintf(&ncxBuf, "%s<navPoint id=\"navpoint-%d\" playOrder=\"%d\">\n", in, playOrder, playOrder)
+			fmt.Fprintf(&ncxBuf, "%s    <navLabel>\n%s        <text>%s</text>\n%s    </navLabel>\n", in, in, title, in)
+			fmt.Fprintf(&ncxBuf, "%s    <content src=\"%s\"/>\n", in, href)
+			if len(entry.children) > 0 {
+				navBuf.WriteString("\n")
+				write(entry.children, indent+"        ")
+				navBuf.WriteString(indent + "    ")
+			}
+			navBuf.WriteString("</li>\n")
+			ncxBuf.WriteString(in + "</navPoint>\n")
+		}
+		navBuf.WriteString(indent + "</ol>\n")
+	}
+	write(root.children, "        ")
+	return strings.TrimRight(navBuf.String(), "\n"), strings.TrimRight(ncxBuf.String(), "\n"), depth
+}
+
+// ncxIndent indents a navPoint by its depth in the navigation map
+func ncxIndent(entry *outlineEntry) string {
+	return strings.Repeat("    ", 1+entry.depth)
+}
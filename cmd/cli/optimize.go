@@ -0,0 +1,25 @@
+package main
+
+import "strconv"
+
+// optimizeOptions select the asset optimizations the builder applies
+type optimizeOptions struct {
+	Stages     string
+	Quality    int
+	ConfigFile string
+}
+
+// args returns the builder arguments for the options
+func (o optimizeOptions) args() []string {
+	if o.Stages == "" {
+		return nil
+	}
+	args := []string{"--optimize=" + o.Stages}
+	if o.Quality != 0 {
+		args = append(args, "--optimize-quality", strconv.Itoa(o.Quality))
+	}
+	if o.ConfigFile != "" {
+		args = append(args, "--build-config", o.ConfigFile)
+	}
+	return args
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// passwordEnv holds a document password for scripts that cannot answer a prompt
+const passwordEnv = "LIV_PASSWORD"
+
+// passwordOptions say where the password of an encrypted document comes from:
+// a file, the LIV_PASSWORD environment variable or, failing both, a prompt
+type passwordOptions struct {
+	// File holds the password on its first line
+	File string
+}
+
+// given reports whether a password is supplied without prompting
+func (o passwordOptions) given() bool {
+	return o.File != "" || os.Getenv(passwordEnv) != ""
+}
+
+// read returns the password, prompting on the terminal when none is given.
+// New passwords are asked for twice, to catch typing mistakes.
+func (o passwordOptions) read(confirm bool) (string, error) {
+	var password string
+	switch {
+	case o.File != "":
+		data, err := os.ReadFile(o.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %v", err)
+		}
+		password, _, _ = strings.Cut(string(data), "\n")
+		password = strings.TrimSuffix(password, "\r")
+	case os.Getenv(passwordEnv) != "":
+		password = os.Getenv(passwordEnv)
+	default:
+		var err error
+		if password, err = promptPassword("Password: "); err != nil {
+			return "", err
+		}
+		if confirm {
+			again, err := promptPassword("Confirm password: ")
+			if err != nil {
+				return "", err
+			}
+			if again != password {
+				return "", fmt.Errorf("passwords do not match")
+			}
+		}
+	}
+	if password == "" {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+	return password, nil
+}
+
+// promptPassword asks for a password on the terminal without echoing it
+func promptPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := readHiddenLine(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("no password: %v; give --password-file or set %s", err, passwordEnv)
+	}
+	return password, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readHiddenLine cannot turn off echo here, so passwords come from a file or
+// the environment
+func readHiddenLine(fd int) (string, error) {
+	return "", errors.New("reading a password without echo is not supported on this system")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// projectOptions pass the project file to the builder, with the flags set on
+// the command line that override it
+type projectOptions struct {
+	File string
+	// Overrides are flags set on the command line that are forwarded even
+	// when they have their default value, so the project file does not win
+	Overrides []string
+}
+
+// args returns the builder arguments for the options
+func (o projectOptions) args() []string {
+	var args []string
+	if o.File != "" {
+		args = append(args, "--project", o.File)
+	}
+	return append(args, o.Overrides...)
+}
+
+// changedFlags returns --name=value for the named flags set on the command
+// line
+func changedFlags(cmd *cobra.Command, names ...string) []string {
+	var args []string
+	for _, name := range names {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+			args = append(args, fmt.Sprintf("--%s=%s", name, flag.Value.String()))
+		}
+	}
+	return args
+}
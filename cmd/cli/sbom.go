@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/sbom"
+	"github.com/spf13/cobra"
+)
+
+func sbomCmd() *cobra.Command {
+	var outputFile string
+
+	cmd := &cobra.Command{
+		Use:   "sbom [document.liv]",
+		Short: "Export the software bill of materials of a document",
+		Long: `Sbom writes the CycloneDX ` + sbom.SpecVersion + ` bill of materials stored in a document by
+liv build. It lists every embedded asset with its SHA-256 hash and type, the
+origin of generated and derived assets, WASM modules with their versions, font
+and image licenses, and the builder, Go toolchain and modules that built it.
+
+The hashes are checked against the package; components that no longer match
+are reported and the command fails. Documents built before SBOMs were stored
+get one generated from their contents, without the toolchain.`,
+		Example: `  liv sbom report.liv
+  liv sbom report.liv -o report.cdx.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSBOM(args[0], outputFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: standard output)")
+
+	return cmd
+}
+
+func runSBOM(livFile, outputFile string) error {
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+
+	data, stored := files[sbom.Entry]
+	var bom *sbom.BOM
+	if stored {
+		if bom, err = sbom.Parse(data); err != nil {
+			return err
+		}
+	} else {
+		manifestData, exists := files["manifest.json"]
+		if !exists {
+			return fmt.Errorf("manifest.json not found in document")
+		}
+		doc, err := manifest.NewManifestParser().ParseFromBytes(manifestData)
+		if err != nil {
+			return fmt.Errorf("failed to parse manifest: %v", err)
+		}
+		if bom, err = sbom.Generate(files, doc, sbom.Options{Timestamp: time.Now()}); err != nil {
+			return fmt.Errorf("failed to generate SBOM: %v", err)
+		}
+		if data, err = sbom.Marshal(bom); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "⚠ No SBOM stored in %s; generated one from its contents\n", livFile)
+	}
+
+	if outputFile == "" {
+		os.Stdout.Write(data)
+	} else {
+		if err := atomicfile.WriteFile(outputFile, data, 0644); err != nil {
+			return fmt.Errorf("failed to write SBOM: %v", err)
+		}
+		fmt.Printf("✓ SBOM exported\n")
+		fmt.Printf("  Components: %d\n", len(bom.Components))
+		fmt.Printf("  Output: %s\n", outputFile)
+	}
+
+	mismatches := sbom.Verify(bom, files)
+	for _, mismatch := range mismatches {
+		if mismatch.Actual == "" {
+			fmt.Fprintf(os.Stderr, "✗ %s: listed in the SBOM but missing from the document\n", mismatch.Path)
+		} else {
+			fmt.Fprintf(os.Stderr, "✗ %s: hash %s does not match the SBOM (%s)\n", mismatch.Path, mismatch.Actual, mismatch.Expected)
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("document does not match its SBOM: %d components differ", len(mismatches))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+func serveCmd() *cobra.Command {
+	var (
+		port     int
+		soakTest *soakTestOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve [file] [-- viewer flags]",
+		Short: "Run the web viewer server",
+		Long: `Serve runs liv-viewer as a web server, where readers upload, open and convert
+documents in the browser. The file, when given, is the document the viewer
+opens by default. Flags after -- are passed on to liv-viewer, such as
+--store-dir or --job-workers.
+
+Built with -tags soak, --soak-test exercises the server for hours instead:
+see liv serve --help in such a build.`,
+		Example: `  liv serve
+  liv serve document.liv --port 9000
+  liv serve -- --store-dir /var/lib/liv --job-workers 4`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, viewerArgs, err := splitServeArgs(cmd, args)
+			if err != nil {
+				return err
+			}
+			if soakTest.enabled() {
+				return runSoakTest(file, port, viewerArgs, soakTest)
+			}
+			return runServe(file, port, viewerArgs)
+		},
+	}
+
+	cmd.Flags().IntVarP(&port, "port", "p", 8080, "Port to listen on")
+	soakTest = addSoakTestFlags(cmd)
+
+	return cmd
+}
+
+// splitServeArgs separates the document to serve from the flags passed on to
+// the viewer after --
+func splitServeArgs(cmd *cobra.Command, args []string) (string, []string, error) {
+	own, viewerArgs := args, []string(nil)
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		own, viewerArgs = args[:dash], args[dash:]
+	}
+	if len(own) > 1 {
+		return "", nil, fmt.Errorf("serve takes at most one document, got %d", len(own))
+	}
+	if len(own) == 0 {
+		return "", viewerArgs, nil
+	}
+	if _, err := os.Stat(own[0]); err != nil {
+		return "", nil, fmt.Errorf("file not found: %s", own[0])
+	}
+	return own[0], viewerArgs, nil
+}
+
+// viewerServerCommand prepares liv-viewer to serve on port
+func viewerServerCommand(file string, port int, viewerArgs []string) (*exec.Cmd, error) {
+	viewerPath, err := findViewerExecutable()
+	if err != nil {
+		return nil, fmt.Errorf("viewer not found: %v", err)
+	}
+	args := append([]string{"--web", "--port", fmt.Sprintf("%d", port)}, viewerArgs...)
+	if file != "" {
+		args = append(args, file)
+	}
+	cmd := exec.Command(viewerPath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+func runServe(file string, port int, viewerArgs []string) error {
+	cmd, err := viewerServerCommand(file, port, viewerArgs)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Server will be available at: http://localhost:%d\n", port)
+	return cmd.Run()
+}
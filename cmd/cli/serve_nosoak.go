@@ -0,0 +1,30 @@
+//go:build !soak
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// soakTestOptions only records whether a soak test was asked for: soak
+// testing is left out of builds without the soak tag
+type soakTestOptions struct {
+	requested bool
+}
+
+func addSoakTestFlags(cmd *cobra.Command) *soakTestOptions {
+	opts := &soakTestOptions{}
+	cmd.Flags().BoolVar(&opts.requested, "soak-test", false, "Exercise the server and report leaks (requires a build with -tags soak)")
+	cmd.Flags().MarkHidden("soak-test")
+	return opts
+}
+
+func (o *soakTestOptions) enabled() bool {
+	return o.requested
+}
+
+func runSoakTest(file string, port int, viewerArgs []string, opts *soakTestOptions) error {
+	return fmt.Errorf("this liv was built without soak testing; rebuild it with go build -tags soak")
+}
@@ -0,0 +1,195 @@
+//go:build soak
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/liv-format/liv/pkg/conformance"
+	"github.com/liv-format/liv/pkg/soak"
+	"github.com/spf13/cobra"
+)
+
+// soakTestOptions configures liv serve --soak-test
+type soakTestOptions struct {
+	requested bool
+	url       string
+	document  string
+	config    soak.Config
+}
+
+func addSoakTestFlags(cmd *cobra.Command) *soakTestOptions {
+	opts := &soakTestOptions{config: soak.Config{Thresholds: soak.DefaultThresholds}}
+	cmd.Long += `
+
+Soak test (--soak-test): uploads, validates, views and converts a document
+over and over, from several clients at once, while sampling the server's
+goroutines, heap, resident memory and open file descriptors from /metrics.
+A resource still growing after warm-up beyond its threshold is reported as a
+leak, and an operation whose 95th percentile latency grew beyond its factor as
+latency drift; either fails the run. Interrupting the test ends it early with
+a report.
+
+The server is started on --port with short-lived uploads unless --soak-url
+names a running one. The document uploaded is --soak-document, the served
+file or, without either, a reference fixture.`
+	cmd.Example += `
+  liv serve --soak-test --soak-duration 8h
+  liv serve --soak-test --soak-url https://staging.example.com --soak-token $HEALTH_TOKEN --soak-document report.liv`
+
+	cmd.Flags().BoolVar(&opts.requested, "soak-test", false, "Exercise the server and report leaks and latency drift")
+	cmd.Flags().StringVar(&opts.url, "soak-url", "", "Soak test a running server instead of starting one")
+	cmd.Flags().StringVar(&opts.config.Token, "soak-token", "", "Health token of the server, for its metrics")
+	cmd.Flags().StringVar(&opts.document, "soak-document", "", "Document uploaded by the soak test")
+	cmd.Flags().StringVar(&opts.config.Format, "soak-format", "html", "Conversion format exercised: html, markdown or pdf")
+	cmd.Flags().DurationVar(&opts.config.Duration, "soak-duration", time.Hour, "How long to run (0: until interrupted)")
+	cmd.Flags().DurationVar(&opts.config.Warmup, "soak-warmup", 5*time.Minute, "Time left out of the baselines while the server warms up")
+	cmd.Flags().DurationVar(&opts.config.Interval, "soak-interval", 30*time.Second, "How often the server is sampled")
+	cmd.Flags().IntVar(&opts.config.Workers, "soak-workers", 4, "Clients exercising the server at once")
+	cmd.Flags().Float64Var(&opts.config.Thresholds.Goroutines, "soak-max-goroutines", soak.DefaultThresholds.Goroutines, "Goroutine growth tolerated")
+	cmd.Flags().Float64Var(&opts.config.Thresholds.OpenFiles, "soak-max-open-files", soak.DefaultThresholds.OpenFiles, "Open file descriptor growth tolerated")
+	cmd.Flags().Float64Var(&opts.config.Thresholds.Memory, "soak-max-memory-growth", soak.DefaultThresholds.Memory, "Heap and resident memory growth tolerated, as a fraction")
+	cmd.Flags().Float64Var(&opts.config.Thresholds.Latency, "soak-max-latency-drift", soak.DefaultThresholds.Latency, "Growth of the 95th percentile latency tolerated, as a factor")
+	cmd.Flags().Float64Var(&opts.config.Thresholds.Errors, "soak-max-errors", soak.DefaultThresholds.Errors, "Fraction of failed operations tolerated")
+	return opts
+}
+
+func (o *soakTestOptions) enabled() bool {
+	return o.requested
+}
+
+func runSoakTest(file string, port int, viewerArgs []string, opts *soakTestOptions) error {
+	config := opts.config
+	document, err := soakDocument(file, opts.document)
+	if err != nil {
+		return err
+	}
+	config.Document = document
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	config.URL = opts.url
+	if config.URL == "" {
+		// Keep uploads short-lived, so that the store does not fill the disk
+		// over a long run
+		args := append([]string{"--store-ttl", "10m", "--store-gc-interval", "1m"}, viewerArgs...)
+		server, err := viewerServerCommand(file, port, args)
+		if err != nil {
+			return err
+		}
+		if err := server.Start(); err != nil {
+			return fmt.Errorf("failed to start the viewer: %v", err)
+		}
+		defer func() {
+			server.Process.Signal(os.Interrupt)
+			server.Wait()
+		}()
+		config.URL = fmt.Sprintf("http://localhost:%d", port)
+		if err := waitForServer(ctx, config.URL, 30*time.Second); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Soak testing %s with %d clients", config.URL, config.Workers)
+	if config.Duration > 0 {
+		fmt.Printf(" for %v", config.Duration)
+	}
+	fmt.Printf("\n\n")
+	config.Progress = func(s soak.Sample) {
+		fmt.Printf("  %8v  %d operations, %d failed", s.Elapsed.Round(time.Second), s.Operations, s.Errors)
+		for _, resource := range soak.Resources {
+			if value, ok := s.Values[resource.Name]; ok {
+				if resource.Memory {
+					fmt.Printf(", %s %.1f MiB", resource.Name, value/(1<<20))
+				} else {
+					fmt.Printf(", %s %.0f", resource.Name, value)
+				}
+			}
+		}
+		fmt.Println()
+	}
+
+	report, err := soak.Run(ctx, config)
+	if report != nil {
+		printSoakReport(report)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.Passed() {
+		return fmt.Errorf("soak test found %d problems", len(report.Findings))
+	}
+	return nil
+}
+
+// soakDocument reads the document to upload: the one given, the served file
+// or a reference fixture
+func soakDocument(file, document string) ([]byte, error) {
+	if document == "" {
+		document = file
+	}
+	if document != "" {
+		data, err := os.ReadFile(document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read document: %v", err)
+		}
+		return data, nil
+	}
+	fixtures, err := conformance.Fixtures()
+	if err != nil {
+		return nil, err
+	}
+	for _, fixture := range fixtures {
+		if fixture.Check == conformance.CheckValidate && fixture.Name == "complete" {
+			return fixture.Package, nil
+		}
+	}
+	return nil, fmt.Errorf("no document to upload; use --soak-document")
+}
+
+// waitForServer waits until the server answers its health check
+func waitForServer(ctx context.Context, url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := http.Get(url + "/api/capabilities")
+		if err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server did not start within %v: %v", timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func printSoakReport(report *soak.Report) {
+	fmt.Printf("\nSoak Test Summary:\n")
+	fmt.Printf("  Duration: %v\n", report.Duration.Round(time.Second))
+	fmt.Printf("  Samples: %d\n", len(report.Samples))
+	for _, op := range soak.Operations {
+		stats := report.Operations[op]
+		fmt.Printf("  %s: %d runs, %d failed", op, stats.Count, stats.Errors)
+		if stats.Final > 0 {
+			fmt.Printf(", p95 %v after warm-up, %v at the end", stats.Baseline.Round(time.Millisecond), stats.Final.Round(time.Millisecond))
+		}
+		fmt.Println()
+	}
+	if report.Passed() {
+		fmt.Printf("✓ No leaks or latency drift found\n")
+		return
+	}
+	for _, finding := range report.Findings {
+		fmt.Printf("✗ %s: %s\n", finding.Kind, finding.Message)
+	}
+}
@@ -0,0 +1,841 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/liv-format/liv/pkg/jobs"
+	"github.com/liv-format/liv/pkg/sandbox"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+// Operations of the processing service
+const (
+	operationBuild    = "build"
+	operationValidate = "validate"
+	operationConvert  = "convert"
+	operationSign     = "sign"
+	operationVerify   = "verify"
+)
+
+// apiConvertFormats are the formats documents are converted to by the
+// service, with the extension of their output
+var apiConvertFormats = map[string]string{
+	"pdf":             ".pdf",
+	"large-print-pdf": ".pdf",
+	"html":            ".html",
+	"markdown":        ".md",
+	"epub":            ".epub",
+	"brf":             ".brf",
+}
+
+// livContentType is the media type of LIV packages the service returns
+const livContentType = "application/vnd.liv+zip"
+
+// maxAPILog is how much of the output of an operation is kept for its job
+const maxAPILog = 64 << 10
+
+// apiWaitPoll is how often a request waiting for a job checks on it
+const apiWaitPoll = 50 * time.Millisecond
+
+// apiOptions configures liv serve-api
+type apiOptions struct {
+	Addr        string
+	GRPCAddr    string
+	Token       string
+	Workers     int
+	TenantLimit int
+	QueueLimit  int
+	MaxSizeMB   int
+	Timeout     time.Duration
+	MemoryMB    int
+	CPUTime     time.Duration
+	Cgroup      string
+	SignKey     string
+	TrustedKeys []string
+	Retention   time.Duration
+}
+
+func serveAPICmd() *cobra.Command {
+	options := apiOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "serve-api",
+		Short: "Run LIV operations as a service for other backends",
+		Long: `Serve-api runs a daemon that builds, validates, converts, signs and verifies
+documents for other backends, over REST on --addr and gRPC on --grpc-addr.
+
+Each request is a job. Jobs wait in a queue shared fairly between tenants,
+named by the X-LIV-Tenant header (liv-tenant gRPC metadata), and run on
+--workers workers. Every job runs in a worker process under its own limits:
+--timeout, --memory and --cpu-time, which a request may lower but not raise,
+and inputs larger than --max-size are refused. On Linux, limits other than
+the timeout are enforced with a cgroup v2 delegated to the service, --cgroup
+or the service's own.
+
+REST endpoints take the document, or for build a tar (optionally gzipped) of
+the source directory, as the request body:
+
+  POST   /v1/build?sign=true
+  POST   /v1/validate
+  POST   /v1/convert?format=pdf
+  POST   /v1/sign?signer_name=...&role=...
+  POST   /v1/verify
+  GET    /v1/jobs                  the tenant's jobs
+  GET    /v1/jobs/{id}?wait=30s    a job, waiting up to 30s for it to finish
+  GET    /v1/jobs/{id}/output      the document or file a job made
+  DELETE /v1/jobs/{id}             cancels a job
+
+Requests may set timeout, memory (in MB) and wait. The gRPC service
+liv.v1.Processing has the same operations, exchanging JSON messages: clients
+call it with the json content subtype (application/grpc+json).
+
+Signing uses the service's --sign-key, never a key sent with a request, and
+verification checks signatures against the --trusted-key keys. With a token
+(--token-file or LIV_API_TOKEN), requests must carry it as a bearer token.`,
+		Example: `  liv serve-api
+  liv serve-api --addr :8090 --grpc-addr :9090 --token-file /etc/liv/api-token
+  liv serve-api --workers 8 --timeout 2m --memory 1024 --sign-key signing.pem --trusted-key signing-public.pem
+  curl --data-binary @document.liv "localhost:8090/v1/convert?format=pdf&wait=60s"`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tokenFile, _ := cmd.Flags().GetString("token-file")
+			if tokenFile != "" {
+				data, err := os.ReadFile(tokenFile)
+				if err != nil {
+					return fmt.Errorf("failed to read token: %v", err)
+				}
+				options.Token = strings.TrimSpace(string(data))
+			}
+			if options.Token == "" {
+				options.Token = os.Getenv("LIV_API_TOKEN")
+			}
+			return runServeAPI(options)
+		},
+	}
+
+	cmd.Flags().StringVar(&options.Addr, "addr", "127.0.0.1:8090", "Address the REST API listens on")
+	cmd.Flags().StringVar(&options.GRPCAddr, "grpc-addr", "127.0.0.1:9090", "Address the gRPC API listens on; empty disables it")
+	cmd.Flags().String("token-file", "", "File holding the bearer token requests must carry (default: LIV_API_TOKEN)")
+	cmd.Flags().IntVar(&options.Workers, "workers", 2, "How many jobs run at once")
+	cmd.Flags().IntVar(&options.TenantLimit, "tenant-limit", 0, "How many jobs a tenant runs at once (0 is --workers)")
+	cmd.Flags().IntVar(&options.QueueLimit, "queue-limit", 20, "How many jobs a tenant may have waiting (0 is unlimited)")
+	cmd.Flags().IntVar(&options.MaxSizeMB, "max-size", 256, "Largest document or source archive accepted, in MB")
+	cmd.Flags().DurationVar(&options.Timeout, "timeout", 5*time.Minute, "Longest a job may run")
+	cmd.Flags().IntVar(&options.MemoryMB, "memory", 512, "Most memory a job may use, in MB")
+	cmd.Flags().DurationVar(&options.CPUTime, "cpu-time", 2*time.Minute, "Most CPU time a job may use")
+	cmd.Flags().StringVar(&options.Cgroup, "cgroup", "", "cgroup v2 directory delegated to the service for job limits (default: its own)")
+	cmd.Flags().StringVar(&options.SignKey, "sign-key", "", "Private key documents are signed with; signing is off without it")
+	cmd.Flags().StringSliceVar(&options.TrustedKeys, "trusted-key", nil, "Public key signatures are verified against (repeatable)")
+	cmd.Flags().DurationVar(&options.Retention, "retention", jobs.DefaultRetention, "How long finished jobs and their output are kept")
+
+	return cmd
+}
+
+// runServeAPI serves the REST and gRPC APIs until interrupted
+func runServeAPI(options apiOptions) error {
+	server, err := newAPIServer(options)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	restListener, err := net.Listen("tcp", options.Addr)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 2)
+	go func() { errs <- httpServer.Serve(restListener) }()
+	fmt.Printf("LIV processing API: http://%s/v1\n", restListener.Addr())
+
+	var grpcServer *grpc.Server
+	if options.GRPCAddr != "" {
+		grpcListener, err := net.Listen("tcp", options.GRPCAddr)
+		if err != nil {
+			httpServer.Close()
+			return err
+		}
+		grpcServer = server.grpcServer()
+		go func() { errs <- grpcServer.Serve(grpcListener) }()
+		fmt.Printf("LIV processing gRPC service: %s\n", grpcListener.Addr())
+	}
+
+	if !server.sandbox.Enforced() {
+		fmt.Printf("⚠ Jobs run without memory and CPU limits: %s\n", server.sandbox.Degraded())
+	}
+	if options.Token == "" {
+		fmt.Printf("⚠ No token is set: any client that reaches the service can use it\n")
+	}
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("Shutting down")
+	case err = <-errs:
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	httpServer.Shutdown(shutdown)
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	if errors.Is(err, http.ErrServerClosed) || errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// apiServer runs the jobs of the processing service
+type apiServer struct {
+	options   apiOptions
+	scheduler *jobs.Scheduler
+	sandbox   *sandbox.Sandbox
+	// executable is the liv executable jobs run as workers
+	executable string
+	// integrity finds liv-integrity, which verifies signatures
+	integrity func() (string, error)
+}
+
+func newAPIServer(options apiOptions) (*apiServer, error) {
+	if options.SignKey != "" {
+		if _, err := os.Stat(options.SignKey); err != nil {
+			return nil, fmt.Errorf("signing key not found: %s", options.SignKey)
+		}
+	}
+	for _, key := range options.TrustedKeys {
+		if _, err := os.Stat(key); err != nil {
+			return nil, fmt.Errorf("trusted key not found: %s", key)
+		}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate liv: %v", err)
+	}
+	limits := sandbox.DefaultLimits
+	limits.Memory = int64(options.MemoryMB) << 20
+	limits.CPUTime = options.CPUTime
+	limits.Timeout = options.Timeout
+	return &apiServer{
+		options: options,
+		scheduler: jobs.New(jobs.Config{
+			Workers:     options.Workers,
+			TenantLimit: options.TenantLimit,
+			QueueLimit:  options.QueueLimit,
+			Retention:   options.Retention,
+			Timeout:     options.Timeout,
+		}),
+		sandbox:    sandbox.New(limits, options.Cgroup),
+		executable: executable,
+		integrity:  findIntegrityExecutable,
+	}, nil
+}
+
+// Close cancels the jobs and waits for running ones to stop
+func (s *apiServer) Close() {
+	s.scheduler.Close()
+}
+
+// apiRequest is an operation asked of the service
+type apiRequest struct {
+	Operation string
+	Tenant    string
+	// Input is the document, or the source archive to build
+	Input []byte
+	// Format is what convert makes
+	Format string
+	// Sign builds signed documents
+	Sign bool
+	// SignerName and Role describe the signer of sign
+	SignerName string
+	Role       string
+	// Timeout and Memory lower the limits of the job when positive
+	Timeout time.Duration
+	Memory  int64
+}
+
+// apiError is a request the service refuses, with the HTTP status and gRPC
+// code to refuse it with
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+// apiResult is what a job's operation gave
+type apiResult struct {
+	// OK reports whether the operation succeeded: the document was made, or
+	// it is valid and its signatures verify
+	OK       bool   `json:"ok"`
+	ExitCode int    `json:"exit_code"`
+	Log      string `json:"log,omitempty"`
+	Output   []byte `json:"-"`
+	Filename string `json:"-"`
+	// ContentType is the media type of Output
+	ContentType string `json:"-"`
+}
+
+// apiJob describes a job to its owner
+type apiJob struct {
+	ID        string            `json:"id"`
+	Operation string            `json:"operation"`
+	State     jobs.State        `json:"state"`
+	Position  int               `json:"position,omitempty"`
+	Submitted time.Time         `json:"submitted"`
+	Started   *time.Time        `json:"started,omitempty"`
+	Finished  *time.Time        `json:"finished,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Budget    *jobs.BudgetError `json:"budget,omitempty"`
+	Result    *apiResult        `json:"result,omitempty"`
+	// Output describes the file made by a succeeded job, fetched from
+	// /v1/jobs/{id}/output or with GetOutput
+	Output *apiOutput `json:"output,omitempty"`
+}
+
+// apiOutput describes the file a job made
+type apiOutput struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	URL         string `json:"url"`
+}
+
+func newAPIJob(status jobs.Status) *apiJob {
+	job := &apiJob{
+		ID:        status.ID,
+		Operation: status.Labels["operation"],
+		State:     status.State,
+		Position:  status.Position,
+		Submitted: status.Submitted,
+		Started:   status.Started,
+		Finished:  status.Finished,
+		Error:     status.Error,
+		Budget:    status.Budget,
+	}
+	if result, ok := status.Result.(*apiResult); ok {
+		job.Result = result
+		if result.OK && result.Filename != "" {
+			job.Output = &apiOutput{
+				Filename:    result.Filename,
+				ContentType: result.ContentType,
+				Size:        len(result.Output),
+				URL:         "/v1/jobs/" + status.ID + "/output",
+			}
+		}
+	}
+	return job
+}
+
+// submit checks a request and queues its job
+func (s *apiServer) submit(request *apiRequest) (jobs.Status, error) {
+	maxSize := int64(s.options.MaxSizeMB) << 20
+	if len(request.Input) == 0 {
+		return jobs.Status{}, badRequest("send the document as the request body")
+	}
+	if maxSize > 0 && int64(len(request.Input)) > maxSize {
+		return jobs.Status{}, &apiError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("input is larger than %d MB", s.options.MaxSizeMB)}
+	}
+	switch request.Operation {
+	case operationBuild, operationValidate, operationVerify:
+	case operationConvert:
+		if _, ok := apiConvertFormats[request.Format]; !ok {
+			return jobs.Status{}, badRequest("unsupported format %q (use %s)", request.Format, strings.Join(sortedKeys(apiConvertFormats), ", "))
+		}
+	case operationSign:
+		if s.options.SignKey == "" {
+			return jobs.Status{}, &apiError{status: http.StatusNotImplemented, message: "signing is not configured on this service"}
+		}
+	default:
+		return jobs.Status{}, &apiError{status: http.StatusNotFound, message: fmt.Sprintf("unknown operation %q", request.Operation)}
+	}
+	if request.Sign && s.options.SignKey == "" {
+		return jobs.Status{}, &apiError{status: http.StatusNotImplemented, message: "signing is not configured on this service"}
+	}
+	if request.Timeout < 0 || request.Memory < 0 {
+		return jobs.Status{}, badRequest("limits cannot be negative")
+	}
+
+	box := s.sandbox.Tighten(sandbox.Limits{Memory: request.Memory, Timeout: request.Timeout})
+	return s.scheduler.Submit(jobs.Spec{
+		Tenant:  request.Tenant,
+		Cost:    int64(len(request.Input)),
+		Labels:  map[string]string{"operation": request.Operation},
+		Timeout: box.Limits().Timeout,
+		Run: func(ctx context.Context) (interface{}, error) {
+			result, err := s.run(ctx, box, request)
+			if result == nil {
+				return nil, err
+			}
+			return result, err
+		},
+	})
+}
+
+// wait returns a job once it finished, or as it is when timeout passes
+func (s *apiServer) wait(ctx context.Context, id, tenant string, timeout time.Duration) (jobs.Status, error) {
+	status, err := s.scheduler.Get(id, tenant)
+	if err != nil || timeout <= 0 {
+		return status, err
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(apiWaitPoll)
+	defer poll.Stop()
+	for !status.State.Finished() {
+		select {
+		case <-ctx.Done():
+			return status, nil
+		case <-deadline.C:
+			return status, nil
+		case <-poll.C:
+		}
+		if status, err = s.scheduler.Get(id, tenant); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// run does the work of a job in a worker under the limits of box
+func (s *apiServer) run(ctx context.Context, box *sandbox.Sandbox, request *apiRequest) (*apiResult, error) {
+	dir, err := os.MkdirTemp("", "liv-api-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	jobs.SetStage(ctx, "reading the input")
+	input := filepath.Join(dir, "input.liv")
+	output := ""
+	if request.Operation == operationBuild {
+		input = filepath.Join(dir, "source")
+		if err := extractSourceArchive(request.Input, input, int64(s.options.MaxSizeMB)<<20); err != nil {
+			return nil, err
+		}
+		input = sourceRoot(input)
+	} else if err := os.WriteFile(input, request.Input, 0600); err != nil {
+		return nil, err
+	}
+
+	executable := s.executable
+	var args []string
+	switch request.Operation {
+	case operationBuild:
+		output = filepath.Join(dir, "document.liv")
+		args = []string{"build", "--input", input, "--output", output}
+		if request.Sign {
+			args = append(args, "--sign", "--key", s.options.SignKey)
+		}
+	case operationValidate:
+		args = []string{"validate", input, "--verbose"}
+	case operationConvert:
+		output = filepath.Join(dir, "document"+apiConvertFormats[request.Format])
+		args = []string{"convert", input, "--format", request.Format, "--output", output}
+	case operationSign:
+		output = filepath.Join(dir, "document.liv")
+		args = []string{"sign", input, "--key", s.options.SignKey, "--output", output}
+		if request.SignerName != "" {
+			args = append(args, "--signer-name", request.SignerName)
+		}
+		if request.Role != "" {
+			args = append(args, "--role", request.Role)
+		}
+	case operationVerify:
+		if executable, err = s.integrity(); err != nil {
+			return nil, err
+		}
+		args = []string{"verify", input, "--verbose"}
+		if len(s.options.TrustedKeys) > 0 {
+			args = append([]string{"verify-signature", input}, s.options.TrustedKeys...)
+			args = append(args, "--verbose")
+		}
+	}
+
+	jobs.SetStage(ctx, request.Operation+"ing")
+	log := &apiLog{}
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	usage, err := box.Run(ctx, cmd)
+	result := &apiResult{Log: log.String()}
+	var exit *exec.ExitError
+	switch limits := box.Limits(); {
+	case errors.Is(err, sandbox.ErrMemoryLimit):
+		used := ""
+		if usage != nil && usage.PeakMemory > 0 {
+			used = strconv.FormatInt(usage.PeakMemory>>20, 10) + " MB"
+		}
+		return nil, &jobs.BudgetError{Resource: jobs.ResourceMemory, Limit: strconv.FormatInt(limits.Memory>>20, 10) + " MB", Used: used}
+	case errors.Is(err, sandbox.ErrCPULimit):
+		return nil, &jobs.BudgetError{Resource: jobs.ResourceCPU, Limit: limits.CPUTime.String()}
+	case errors.Is(err, sandbox.ErrTimeout):
+		return nil, &jobs.BudgetError{Resource: jobs.ResourceTime, Limit: limits.Timeout.String()}
+	case errors.As(err, &exit):
+		result.ExitCode = exit.ExitCode()
+		return result, nil
+	case err != nil:
+		return nil, err
+	}
+
+	result.OK = true
+	if output != "" {
+		if result.Output, err = os.ReadFile(output); err != nil {
+			return nil, fmt.Errorf("%s made no output", request.Operation)
+		}
+		result.Filename = filepath.Base(output)
+		result.ContentType = mime.TypeByExtension(filepath.Ext(output))
+		if filepath.Ext(output) == ".liv" {
+			result.ContentType = livContentType
+		} else if result.ContentType == "" {
+			result.ContentType = "application/octet-stream"
+		}
+	}
+	return result, nil
+}
+
+// apiLog keeps the first maxAPILog bytes a worker writes
+type apiLog struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (l *apiLog) Write(p []byte) (int, error) {
+	if room := maxAPILog - l.buf.Len(); room < len(p) {
+		l.buf.Write(p[:max(room, 0)])
+		l.truncated = true
+	} else {
+		l.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (l *apiLog) String() string {
+	if l.truncated {
+		return l.buf.String() + "\n[output truncated]"
+	}
+	return l.buf.String()
+}
+
+// extractSourceArchive unpacks a tar, gzipped or not, of a document's
+// sources into dir. Entries must be regular files or directories inside dir,
+// and hold at most limit bytes in all when limit is positive.
+func extractSourceArchive(archive []byte, dir string, limit int64) error {
+	var reader io.Reader = bytes.NewReader(archive)
+	if len(archive) > 2 && archive[0] == 0x1f && archive[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return badRequest("invalid gzip archive: %v", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	tr := tar.NewReader(bufio.NewReader(reader))
+	var total int64
+	files := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return badRequest("invalid source archive: %v", err)
+		}
+		name := filepath.FromSlash(strings.TrimPrefix(header.Name, "./"))
+		if name == "" || name == "." {
+			continue
+		}
+		if filepath.IsAbs(name) || !filepath.IsLocal(name) {
+			return badRequest("source archive entry %q is outside the source directory", header.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += header.Size
+			if limit > 0 && total > limit {
+				return &apiError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("source archive unpacks to more than %d MB", limit>>20)}
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+			if err != nil {
+				return badRequest("source archive entry %q: %v", header.Name, err)
+			}
+			_, err = io.Copy(file, io.LimitReader(tr, header.Size))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			files++
+		default:
+			// Links could point outside the source directory
+			return badRequest("source archive entry %q is not a file or directory", header.Name)
+		}
+	}
+	if files == 0 {
+		return badRequest("source archive has no files")
+	}
+	return nil
+}
+
+// sourceRoot returns the directory sources were unpacked into, or the one
+// directory it holds, as archives of a directory usually have it at the top
+func sourceRoot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
+
+// findIntegrityExecutable finds liv-integrity, which verifies signatures
+func findIntegrityExecutable() (string, error) {
+	for _, candidate := range []string{"./bin/liv-integrity.exe", "./bin/liv-integrity"} {
+		if _, err := os.Stat(candidate); err == nil {
+			return filepath.Abs(candidate)
+		}
+	}
+	if path, err := exec.LookPath("liv-integrity"); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("liv-integrity executable not found")
+}
+
+// authorized reports whether a request carries the service's token, when
+// it has one
+func (s *apiServer) authorized(authorization string) bool {
+	if s.options.Token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.options.Token)) == 1
+}
+
+// apiTenant is who a request's jobs belong to
+func apiTenant(name string) string {
+	if name = strings.TrimSpace(name); name == "" {
+		return "default"
+	}
+	return name
+}
+
+// ServeHTTP serves the REST API
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/health" {
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "jobs": s.scheduler.Metrics()})
+		return
+	}
+	if !s.authorized(r.Header.Get("Authorization")) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="liv"`)
+		writeAPIError(w, &apiError{status: http.StatusUnauthorized, message: "a valid bearer token is required"})
+		return
+	}
+	tenant := apiTenant(r.Header.Get("X-LIV-Tenant"))
+	query := r.URL.Query()
+	wait, err := apiDuration(query.Get("wait"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if path == r.URL.Path {
+		writeAPIError(w, &apiError{status: http.StatusNotFound, message: "not found"})
+		return
+	}
+	if rest, ok := strings.CutPrefix(path, "jobs"); ok {
+		s.serveJobs(w, r, tenant, strings.TrimPrefix(rest, "/"), wait)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeAPIError(w, &apiError{status: http.StatusMethodNotAllowed, message: "method not allowed"})
+		return
+	}
+	request := &apiRequest{
+		Operation:  path,
+		Tenant:     tenant,
+		Format:     strings.ToLower(query.Get("format")),
+		Sign:       query.Get("sign") == "true",
+		SignerName: query.Get("signer_name"),
+		Role:       query.Get("role"),
+	}
+	if request.Timeout, err = apiDuration(query.Get("timeout")); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if memory := query.Get("memory"); memory != "" {
+		mb, err := strconv.ParseInt(memory, 10, 64)
+		if err != nil {
+			writeAPIError(w, badRequest("invalid memory %q: give it in MB", memory))
+			return
+		}
+		request.Memory = mb << 20
+	}
+	maxSize := int64(s.options.MaxSizeMB) << 20
+	if request.Input, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize+1)); err != nil {
+		writeAPIError(w, &apiError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("input is larger than %d MB", s.options.MaxSizeMB)})
+		return
+	}
+
+	status, err := s.submit(request)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if status, err = s.wait(r.Context(), status.ID, tenant, wait); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	code := http.StatusAccepted
+	if status.State.Finished() {
+		code = http.StatusOK
+	}
+	w.Header().Set("Location", "/v1/jobs/"+status.ID)
+	writeAPIJSON(w, code, newAPIJob(status))
+}
+
+// serveJobs serves /v1/jobs: the tenant's jobs, one job, its output, or
+// cancels it
+func (s *apiServer) serveJobs(w http.ResponseWriter, r *http.Request, tenant, path string, wait time.Duration) {
+	id, rest, _ := strings.Cut(path, "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		list := []*apiJob{}
+		for _, status := range s.scheduler.List(tenant) {
+			list = append(list, newAPIJob(status))
+		}
+		writeAPIJSON(w, http.StatusOK, list)
+	case id != "" && rest == "" && r.Method == http.MethodGet:
+		status, err := s.wait(r.Context(), id, tenant, wait)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, newAPIJob(status))
+	case id != "" && rest == "" && r.Method == http.MethodDelete:
+		status, err := s.scheduler.Cancel(id, tenant)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, newAPIJob(status))
+	case id != "" && rest == "output" && r.Method == http.MethodGet:
+		result, err := s.output(id, tenant)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", result.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": result.Filename}))
+		w.Header().Set("Content-Length", strconv.Itoa(len(result.Output)))
+		w.Write(result.Output)
+	default:
+		writeAPIError(w, &apiError{status: http.StatusNotFound, message: "not found"})
+	}
+}
+
+// output returns the result of a job that made a file
+func (s *apiServer) output(id, tenant string) (*apiResult, error) {
+	status, err := s.scheduler.Get(id, tenant)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := status.Result.(*apiResult)
+	if !status.State.Finished() {
+		return nil, &apiError{status: http.StatusConflict, message: "the job has not finished"}
+	}
+	if !ok || !result.OK || result.Filename == "" {
+		return nil, &apiError{status: http.StatusNotFound, message: "the job made no output"}
+	}
+	return result, nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// apiDuration parses a duration parameter, in Go syntax or seconds
+func apiDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, badRequest("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// apiStatus returns the HTTP status a failed request is answered with
+func apiStatus(err error) int {
+	var refused *apiError
+	var full *jobs.QueueFullError
+	switch {
+	case errors.As(err, &refused):
+		return refused.status
+	case errors.As(err, &full):
+		return http.StatusTooManyRequests
+	case errors.Is(err, jobs.ErrUnknownJob):
+		return http.StatusNotFound
+	case errors.Is(err, jobs.ErrClosed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	writeAPIJSON(w, apiStatus(err), map[string]string{"error": err.Error()})
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// processingService is the gRPC service of liv serve-api
+const processingService = "liv.v1.Processing"
+
+// jsonCodec exchanges gRPC messages as JSON, so the service needs no
+// generated protobuf code; clients call it with the json content subtype
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// ProcessRequest asks the gRPC service for an operation
+type ProcessRequest struct {
+	// Input is the document, or for Build a tar of its sources
+	Input      []byte `json:"input"`
+	Format     string `json:"format,omitempty"`
+	Sign       bool   `json:"sign,omitempty"`
+	SignerName string `json:"signer_name,omitempty"`
+	Role       string `json:"role,omitempty"`
+	// Timeout and Wait are durations such as "30s"; Memory is in MB
+	Timeout string `json:"timeout,omitempty"`
+	Memory  int64  `json:"memory,omitempty"`
+	Wait    string `json:"wait,omitempty"`
+}
+
+// JobRequest names a job of the gRPC service
+type JobRequest struct {
+	ID   string `json:"id"`
+	Wait string `json:"wait,omitempty"`
+}
+
+// OutputResponse is the file a job made
+type OutputResponse struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// grpcServer returns a gRPC server of the service
+func (s *apiServer) grpcServer() *grpc.Server {
+	maxSize := s.options.MaxSizeMB<<20 + 1<<20
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(maxSize), grpc.MaxSendMsgSize(maxSize))
+	server.RegisterService(&processingServiceDesc, s)
+	return server
+}
+
+// processingServer is implemented by apiServer for the service description
+type processingServer interface {
+	process(ctx context.Context, operation string, request *ProcessRequest) (*apiJob, error)
+	job(ctx context.Context, request *JobRequest) (*apiJob, error)
+	cancelJob(ctx context.Context, request *JobRequest) (*apiJob, error)
+	jobOutput(ctx context.Context, request *JobRequest) (*OutputResponse, error)
+}
+
+var processingServiceDesc = grpc.ServiceDesc{
+	ServiceName: processingService,
+	HandlerType: (*processingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		processMethod("Build", operationBuild),
+		processMethod("Validate", operationValidate),
+		processMethod("Convert", operationConvert),
+		processMethod("Sign", operationSign),
+		processMethod("Verify", operationVerify),
+		jobMethod("GetJob", func(s processingServer, ctx context.Context, request *JobRequest) (interface{}, error) {
+			return s.job(ctx, request)
+		}),
+		jobMethod("CancelJob", func(s processingServer, ctx context.Context, request *JobRequest) (interface{}, error) {
+			return s.cancelJob(ctx, request)
+		}),
+		jobMethod("GetOutput", func(s processingServer, ctx context.Context, request *JobRequest) (interface{}, error) {
+			return s.jobOutput(ctx, request)
+		}),
+	},
+}
+
+// processMethod describes the method submitting jobs of an operation
+func processMethod(name, operation string) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			request := &ProcessRequest{}
+			if err := dec(request); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+				return srv.(processingServer).process(ctx, operation, request.(*ProcessRequest))
+			}
+			if interceptor == nil {
+				return handler(ctx, request)
+			}
+			return interceptor(ctx, request, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + processingService + "/" + name}, handler)
+		},
+	}
+}
+
+// jobMethod describes a method on a job
+func jobMethod(name string, call func(processingServer, context.Context, *JobRequest) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			request := &JobRequest{}
+			if err := dec(request); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+				return call(srv.(processingServer), ctx, request.(*JobRequest))
+			}
+			if interceptor == nil {
+				return handler(ctx, request)
+			}
+			return interceptor(ctx, request, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + processingService + "/" + name}, handler)
+		},
+	}
+}
+
+// grpcTenant checks a call's token and returns its tenant
+func (s *apiServer) grpcTenant(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if !s.authorized(first("authorization")) {
+		return "", status.Error(codes.Unauthenticated, "a valid bearer token is required")
+	}
+	return apiTenant(first("liv-tenant")), nil
+}
+
+func (s *apiServer) process(ctx context.Context, operation string, request *ProcessRequest) (*apiJob, error) {
+	tenant, err := s.grpcTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := apiDuration(request.Timeout)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	wait, err := apiDuration(request.Wait)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	submitted, err := s.submit(&apiRequest{
+		Operation:  operation,
+		Tenant:     tenant,
+		Input:      request.Input,
+		Format:     request.Format,
+		Sign:       request.Sign,
+		SignerName: request.SignerName,
+		Role:       request.Role,
+		Timeout:    timeout,
+		Memory:     request.Memory << 20,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return s.grpcWait(ctx, submitted.ID, tenant, wait)
+}
+
+func (s *apiServer) job(ctx context.Context, request *JobRequest) (*apiJob, error) {
+	tenant, err := s.grpcTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := apiDuration(request.Wait)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return s.grpcWait(ctx, request.ID, tenant, wait)
+}
+
+func (s *apiServer) cancelJob(ctx context.Context, request *JobRequest) (*apiJob, error) {
+	tenant, err := s.grpcTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	canceled, err := s.scheduler.Cancel(request.ID, tenant)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return newAPIJob(canceled), nil
+}
+
+func (s *apiServer) jobOutput(ctx context.Context, request *JobRequest) (*OutputResponse, error) {
+	tenant, err := s.grpcTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.output(request.ID, tenant)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &OutputResponse{Filename: result.Filename, ContentType: result.ContentType, Content: result.Output}, nil
+}
+
+// grpcWait returns a job once it finished, or after wait
+func (s *apiServer) grpcWait(ctx context.Context, id, tenant string, wait time.Duration) (*apiJob, error) {
+	waited, err := s.wait(ctx, id, tenant, wait)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return newAPIJob(waited), nil
+}
+
+// grpcError turns an error of the service into a gRPC status
+func grpcError(err error) error {
+	code := codes.Internal
+	switch apiStatus(err) {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	case http.StatusNotImplemented:
+		code = codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	if errors.Is(err, context.Canceled) {
+		code = codes.Canceled
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/jobs"
+	"github.com/liv-format/liv/pkg/manifest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestMain runs the test binary as liv when serve-api runs it as a worker
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case operationValidate, operationConvert, operationSign:
+			main()
+			os.Exit(0)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+// newTestAPIServer returns a processing service signing with a new key, and
+// a document to send it
+func newTestAPIServer(t *testing.T, token string) (*apiServer, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	html := []byte("<html><head><title>Service Test</title></head><body><h1>Service Test</h1></body></html>")
+	sum := sha256.Sum256(html)
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Service Test", "ACME Corp")
+	builder.CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(html)), Type: "text/html", Path: "content/index.html"})
+	manifestData, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := filepath.Join(dir, "document.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(map[string][]byte{"manifest.json": manifestData, "content/index.html": html}, document); err != nil {
+		t.Fatal(err)
+	}
+	sm := integrity.NewSignatureManager()
+	key, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "service.pem")
+	if err := sm.SaveSigningKeyPairPEM(key, keyFile, filepath.Join(dir, "service.pub")); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := newAPIServer(apiOptions{
+		Token:     token,
+		Workers:   2,
+		MaxSizeMB: 1,
+		Timeout:   time.Minute,
+		MemoryMB:  512,
+		CPUTime:   time.Minute,
+		SignKey:   keyFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	data, err := os.ReadFile(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, data
+}
+
+func TestServeAPIREST(t *testing.T) {
+	server, document := newTestAPIServer(t, "secret")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	call := func(method, path string, body []byte, v interface{}) int {
+		t.Helper()
+		request, _ := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+		request.Header.Set("Authorization", "Bearer secret")
+		request.Header.Set("X-LIV-Tenant", "reports")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if v != nil {
+			json.NewDecoder(response.Body).Decode(v)
+		}
+		return response.StatusCode
+	}
+
+	var job apiJob
+	if code := call(http.MethodPost, "/v1/validate?wait=60s", document, &job); code != http.StatusOK || job.State != jobs.StateSucceeded || job.Result == nil || !job.Result.OK {
+		t.Fatalf("Expected the document to validate, got %d %+v %+v", code, job, job.Result)
+	}
+	if job.Operation != operationValidate || job.Output != nil {
+		t.Errorf("Unexpected validate job %+v", job)
+	}
+	if code := call(http.MethodPost, "/v1/validate?wait=60s", []byte("not a document"), &job); code != http.StatusOK || job.Result == nil || job.Result.OK || job.Result.ExitCode == 0 {
+		t.Errorf("Expected an invalid document to fail validation, got %d %+v", code, job.Result)
+	}
+
+	if code := call(http.MethodPost, "/v1/convert?format=html&wait=60s", document, &job); code != http.StatusOK || job.Output == nil {
+		t.Fatalf("Expected the document to convert, got %d %+v %+v", code, job, job.Result)
+	}
+	request, _ := http.NewRequest(http.MethodGet, ts.URL+job.Output.URL, nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	request.Header.Set("X-LIV-Tenant", "reports")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(converted), "Service Test") || !strings.HasPrefix(response.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("Unexpected output %d %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	if code := call(http.MethodPost, "/v1/sign?signer_name=Service&wait=60s", document, &job); code != http.StatusOK || job.Output == nil || job.Output.ContentType != livContentType {
+		t.Fatalf("Expected the document to be signed, got %d %+v %+v", code, job, job.Result)
+	}
+
+	// Jobs belong to their tenant
+	var list []apiJob
+	if code := call(http.MethodGet, "/v1/jobs", nil, &list); code != http.StatusOK || len(list) != 4 {
+		t.Errorf("Expected the tenant's 4 jobs, got %d %d", code, len(list))
+	}
+	other, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/jobs/"+job.ID, nil)
+	other.Header.Set("Authorization", "Bearer secret")
+	other.Header.Set("X-LIV-Tenant", "billing")
+	if response, err := http.DefaultClient.Do(other); err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected another tenant's job to be hidden, got %v %v", response.StatusCode, err)
+	}
+
+	for path, want := range map[string]int{
+		"/v1/convert?format=docx":      http.StatusBadRequest,
+		"/v1/validate?timeout=forever": http.StatusBadRequest,
+		"/v1/publish":                  http.StatusNotFound,
+	} {
+		if code := call(http.MethodPost, path, document, nil); code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, code)
+		}
+	}
+	if code := call(http.MethodPost, "/v1/validate", bytes.Repeat([]byte("x"), 2<<20), nil); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected oversized input to be refused, got %d", code)
+	}
+	if code := call(http.MethodGet, "/v1/jobs/unknown", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown job to be 404, got %d", code)
+	}
+	if response, err := http.Post(ts.URL+"/v1/validate", "application/octet-stream", bytes.NewReader(document)); err != nil || response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected requests without the token to be refused, got %v %v", response.StatusCode, err)
+	}
+}
+
+func TestServeAPIGRPC(t *testing.T) {
+	server, document := newTestAPIServer(t, "")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := server.grpcServer()
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype("json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "liv-tenant", "reports")
+
+	var job apiJob
+	if err := conn.Invoke(ctx, "/liv.v1.Processing/Convert", &ProcessRequest{Input: document, Format: "markdown", Wait: "60s"}, &job); err != nil {
+		t.Fatalf("Convert failed: %v", err)
+	}
+	if job.State != jobs.StateSucceeded || job.Output == nil || job.Output.Filename != "document.md" {
+		t.Fatalf("Unexpected convert job %+v %+v", job, job.Result)
+	}
+	var output OutputResponse
+	if err := conn.Invoke(ctx, "/liv.v1.Processing/GetOutput", &JobRequest{ID: job.ID}, &output); err != nil || !strings.Contains(string(output.Content), "Service Test") {
+		t.Errorf("Unexpected output %q: %v", output.Content, err)
+	}
+
+	err = conn.Invoke(ctx, "/liv.v1.Processing/Convert", &ProcessRequest{Input: document, Format: "docx"}, &job)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected an unsupported format to be invalid, got %v", err)
+	}
+	err = conn.Invoke(ctx, "/liv.v1.Processing/GetJob", &JobRequest{ID: "unknown"}, &job)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected an unknown job to be not found, got %v", err)
+	}
+}
+
+func TestExtractSourceArchive(t *testing.T) {
+	archive := func(compress bool, entries ...*tar.Header) []byte {
+		var buf bytes.Buffer
+		var w io.Writer = &buf
+		var gz *gzip.Writer
+		if compress {
+			gz = gzip.NewWriter(&buf)
+			w = gz
+		}
+		tw := tar.NewWriter(w)
+		for _, header := range entries {
+			tw.WriteHeader(header)
+			if header.Typeflag == tar.TypeReg {
+				tw.Write(bytes.Repeat([]byte("x"), int(header.Size)))
+			}
+		}
+		tw.Close()
+		if gz != nil {
+			gz.Close()
+		}
+		return buf.Bytes()
+	}
+	file := func(name string, size int64) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeReg, Size: size, Mode: 0644}
+	}
+
+	dir := t.TempDir()
+	if err := extractSourceArchive(archive(true, &tar.Header{Name: "report/", Typeflag: tar.TypeDir, Mode: 0755}, file("report/content/index.html", 10)), dir, 1<<20); err != nil {
+		t.Fatalf("Failed to extract sources: %v", err)
+	}
+	if root := sourceRoot(dir); root != filepath.Join(dir, "report") {
+		t.Errorf("Expected the top directory to be the sources, got %s", root)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report", "content", "index.html")); err != nil {
+		t.Error(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"parent":   archive(false, file("../escape.html", 1)),
+		"absolute": archive(false, file("/etc/escape.html", 1)),
+		"symlink":  archive(false, &tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}),
+		"oversize": archive(false, file("a.html", 600), file("b.html", 600)),
+		"empty":    archive(false),
+	} {
+		if err := extractSourceArchive(data, t.TempDir(), 1024); err == nil {
+			t.Errorf("%s: expected the archive to be refused", name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/templates"
+	"github.com/spf13/cobra"
+)
+
+func templateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Manage document templates",
+		Long: `Template packages bundle a document starting point with a descriptor listing
+its name, version, preview image and required features. Packages are signed by
+their publisher and verified before installation.`,
+	}
+
+	cmd.AddCommand(templateInstallCmd())
+	cmd.AddCommand(templatePackCmd())
+	cmd.AddCommand(templateListCmd())
+
+	return cmd
+}
+
+func templateInstallCmd() *cobra.Command {
+	var (
+		dir           string
+		trustedKeys   []string
+		allowUnsigned bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install [url|file]",
+		Short: "Install a template package",
+		Example: `  liv template install report.livt --trusted-key publisher.pem
+  liv template install https://example.com/templates/report.livt --trusted-key publisher.pem`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTemplateInstall(args[0], dir, trustedKeys, allowUnsigned)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", "", "Template library directory (default ~/.liv/templates)")
+	cmd.Flags().StringSliceVar(&trustedKeys, "trusted-key", nil, "Publisher public key (PEM) to accept; may be repeated")
+	cmd.Flags().BoolVar(&allowUnsigned, "allow-unsigned", false, "Install templates without a trusted signature")
+
+	return cmd
+}
+
+func templatePackCmd() *cobra.Command {
+	var (
+		outputFile string
+		keyFile    string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "pack [directory]",
+		Short:   "Create a signed template package",
+		Example: `  liv template pack ./my-template --output my-template.livt --key publisher-private.pem`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTemplatePack(args[0], outputFile, keyFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output template package (default <directory>.livt)")
+	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Private key file for signing")
+
+	return cmd
+}
+
+func templateListCmd() *cobra.Command {
+	var dir string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List installed templates",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTemplateList(dir)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", "", "Template library directory (default ~/.liv/templates)")
+
+	return cmd
+}
+
+func runTemplateInstall(source, dir string, trustedKeyFiles []string, allowUnsigned bool) error {
+	fmt.Printf("Installing template from %s\n", source)
+
+	sigManager := integrity.NewSignatureManager()
+	var trustedKeys []*rsa.PublicKey
+	for _, keyFile := range trustedKeyFiles {
+		key, err := sigManager.LoadPublicKeyPEM(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load trusted key %s: %v", keyFile, err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("trusted key %s is not an RSA key; template signatures use RSA", keyFile)
+		}
+		trustedKeys = append(trustedKeys, rsaKey)
+	}
+
+	installed, err := templates.Install(source, templates.InstallOptions{
+		Dir:           dir,
+		TrustedKeys:   trustedKeys,
+		AllowUnsigned: allowUnsigned,
+	})
+	if err != nil {
+		return err
+	}
+
+	if installed.Signed {
+		fmt.Printf("✓ Signature verified\n")
+	} else {
+		fmt.Printf("⚠ Template is not signed by a trusted key\n")
+	}
+	fmt.Printf("✓ Installed %s %s to %s\n", installed.Descriptor.Name, installed.Descriptor.Version, installed.Path)
+	if len(installed.Descriptor.RequiredFeatures) > 0 {
+		fmt.Printf("  Required features: %s\n", strings.Join(installed.Descriptor.RequiredFeatures, ", "))
+	}
+
+	return nil
+}
+
+func runTemplatePack(sourceDir, outputFile, keyFile string) error {
+	var privateKey *rsa.PrivateKey
+	if keyFile != "" {
+		key, err := integrity.NewSignatureManager().LoadPrivateKeyPEM(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load private key: %v", err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("private key %s is not an RSA key; template signatures use RSA", keyFile)
+		}
+		privateKey = rsaKey
+	}
+
+	target := outputFile
+	if target == "" {
+		target = filepath.Join(filepath.Dir(filepath.Clean(sourceDir)), filepath.Base(filepath.Clean(sourceDir))+templates.PackageExtension)
+	}
+
+	descriptor, err := templates.Pack(sourceDir, target, privateKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Packed template %s %s (%d files) to %s\n", descriptor.Name, descriptor.Version, len(descriptor.Files), target)
+	if privateKey == nil {
+		fmt.Printf("⚠ Template is unsigned\n")
+	}
+
+	return nil
+}
+
+func runTemplateList(dir string) error {
+	installed, err := templates.List(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %v", err)
+	}
+
+	if len(installed) == 0 {
+		fmt.Printf("No templates installed\n")
+		return nil
+	}
+
+	for _, tmpl := range installed {
+		status := "signed"
+		if !tmpl.Signed {
+			status = "unsigned"
+		}
+		fmt.Printf("%s %s - %s (%s)\n", tmpl.Descriptor.Name, tmpl.Descriptor.Version, tmpl.Descriptor.Title, status)
+	}
+
+	return nil
+}
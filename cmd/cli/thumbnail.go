@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/preview"
+	"github.com/spf13/cobra"
+)
+
+func thumbnailCmd() *cobra.Command {
+	var (
+		outputFile string
+		width      int
+		height     int
+		format     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "thumbnail [document.liv]",
+		Short: "Render a preview image of a document",
+		Long: `Thumbnail renders the first page of a document, as a reader without scripts
+would see it, to a PNG or lossless WebP image for file listings and link
+previews. The static fallback is rendered when the document has one, and its
+main content otherwise.
+
+Encrypted content is never rendered; encrypted documents show their title
+instead. The format is taken from --format, or from the extension of the
+output file.`,
+		Example: `  liv thumbnail report.liv
+  liv thumbnail report.liv --width 640 --output previews/report.webp
+  liv thumbnail report.liv --width 400 --height 300 --format webp`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runThumbnail(args[0], outputFile, preview.Options{Width: width, Height: height, Format: format})
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: the document name with .png or .webp)")
+	cmd.Flags().IntVarP(&width, "width", "w", preview.DefaultWidth, "Thumbnail width in pixels")
+	cmd.Flags().IntVar(&height, "height", 0, "Thumbnail height in pixels (default: four thirds of the width)")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "Image format: png or webp (default: from the output file, or png)")
+
+	return cmd
+}
+
+func runThumbnail(livFile, outputFile string, opts preview.Options) error {
+	if opts.Format == "" {
+		switch strings.ToLower(filepath.Ext(outputFile)) {
+		case ".webp":
+			opts.Format = preview.FormatWebP
+		case ".png", "":
+			opts.Format = preview.FormatPNG
+		default:
+			return fmt.Errorf("cannot tell the image format of %s (use --format png or webp)", outputFile)
+		}
+	}
+	opts, err := opts.Normalize()
+	if err != nil {
+		return err
+	}
+	if outputFile == "" {
+		outputFile = strings.TrimSuffix(livFile, filepath.Ext(livFile)) + "." + opts.Format
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return fmt.Errorf("manifest.json not found in document")
+	}
+	doc, err := manifest.NewManifestParser().ParseFromBytes(manifestData)
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	data, err := preview.RenderPackage(doc, func(entry string) ([]byte, error) {
+		if data, exists := files[entry]; exists {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%s not found in document", entry)
+	}, opts)
+	if err != nil {
+		return fmt.Errorf("failed to render thumbnail: %v", err)
+	}
+	if err := atomicfile.WriteFile(outputFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write thumbnail: %v", err)
+	}
+
+	fmt.Printf("✓ Thumbnail rendered\n")
+	fmt.Printf("  Size: %dx%d %s, %s\n", opts.Width, opts.Height, strings.ToUpper(opts.Format), formatBytes(int64(len(data))))
+	fmt.Printf("  Output: %s\n", outputFile)
+	return nil
+}
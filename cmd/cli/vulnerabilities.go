@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liv-format/liv/pkg/advisory"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/sbom"
+)
+
+// vulnerabilityOptions name the advisory feed embedded libraries are checked
+// against and the policy applied to matches
+type vulnerabilityOptions struct {
+	FeedFile string
+	Policy   string
+}
+
+// args returns the builder arguments for the options
+func (o vulnerabilityOptions) args() []string {
+	if o.FeedFile == "" {
+		return nil
+	}
+	args := []string{"--advisories", o.FeedFile}
+	if o.Policy != "" {
+		args = append(args, "--vulnerability-policy", o.Policy)
+	}
+	return args
+}
+
+// checkVulnerabilities matches the libraries, WASM modules and files of a
+// document against the advisory feed and reports whether it passes the policy
+func checkVulnerabilities(files map[string][]byte, doc *core.Manifest, opts vulnerabilityOptions, verbose bool) (bool, error) {
+	policy, err := advisory.ParsePolicy(opts.Policy)
+	if err != nil {
+		return false, err
+	}
+	if opts.FeedFile == "" || policy == advisory.PolicyOff {
+		return true, nil
+	}
+	feed, err := advisory.LoadFeed(opts.FeedFile)
+	if err != nil {
+		return false, err
+	}
+	if doc == nil || doc.Metadata == nil {
+		return false, fmt.Errorf("cannot check components without a valid manifest")
+	}
+	bom, err := sbom.Generate(files, doc, sbom.Options{})
+	if err != nil {
+		return false, fmt.Errorf("failed to inventory document: %v", err)
+	}
+
+	report := advisory.Check(bom, feed)
+	mark := "⚠"
+	if policy == advisory.PolicyStrict {
+		mark = "✗"
+	}
+	for _, finding := range report.Findings {
+		component := finding.Path
+		if finding.Name != finding.Path {
+			component = fmt.Sprintf("%s (%s %s)", finding.Path, finding.Name, finding.Version)
+		}
+		fmt.Printf("%s %s [%s, %s]: %s\n", mark, component, finding.Advisory.ID, finding.Advisory.Severity, finding.Advisory.Summary)
+		if finding.Advisory.URL != "" && verbose {
+			fmt.Printf("  %s\n", finding.Advisory.URL)
+		}
+	}
+	if len(report.Findings) == 0 {
+		fmt.Printf("✓ No known vulnerable components among %d checked against %d advisories\n", report.ComponentsChecked, len(feed.Advisories))
+	}
+
+	return len(report.Blocking(policy)) == 0, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+func workspaceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workspace",
+		Short: "Inspect multi-document workspaces",
+		Long: `A workspace is a liv.work file listing document source directories that are
+built together with shared settings and a shared asset library.`,
+	}
+
+	cmd.AddCommand(workspaceAssetsCmd())
+
+	return cmd
+}
+
+func workspaceAssetsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "assets [workspace]",
+		Short: "Show shared assets and the documents that use them",
+		Long: `Assets lists every shared asset in the workspace library, whether it changed
+since the last successful build, and which documents would change when it is updated.`,
+		Example: `  liv workspace assets
+  liv workspace assets ./suite/liv.work`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return runWorkspaceAssets(path)
+		},
+	}
+}
+
+func runWorkspaceAssets(path string) error {
+	ws, err := workspace.Load(path)
+	if err != nil {
+		return err
+	}
+	if ws.SharedAssets == nil {
+		fmt.Printf("Workspace has no shared asset library\n")
+		return nil
+	}
+
+	impacts, err := ws.AssetImpacts()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Shared assets in %s\n\n", ws.SharedAssetDir())
+	for _, impact := range impacts {
+		users := "unused"
+		if len(impact.Documents) > 0 {
+			users = strings.Join(impact.Documents, ", ")
+		}
+		fmt.Printf("  %-10s %-40s %s\n", impact.Status, impact.Path, users)
+	}
+
+	affected := workspace.AffectedDocuments(impacts)
+	if len(affected) == 0 {
+		fmt.Printf("\nNo documents are affected by shared asset changes\n")
+	} else {
+		fmt.Printf("\nDocuments that will change on the next build: %s\n", strings.Join(affected, ", "))
+	}
+
+	return nil
+}
+
+// runWorkspaceBuild builds every document listed in a liv.work file and writes a
+// combined report next to the outputs
+func runWorkspaceBuild(path string, noCache, update bool) error {
+	ws, err := workspace.Load(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Building workspace %s (%d documents)\n", ws.Dir, len(ws.Documents))
+
+	if ws.SharedAssets != nil {
+		impacts, err := ws.AssetImpacts()
+		if err != nil {
+			return err
+		}
+		for _, impact := range impacts {
+			if (impact.Status == workspace.AssetChanged || impact.Status == workspace.AssetRemoved) && len(impact.Documents) > 0 {
+				fmt.Printf("  Shared asset %s %s: affects %s\n", impact.Path, impact.Status, strings.Join(impact.Documents, ", "))
+			}
+		}
+	}
+
+	build := func(job *workspace.Job) error {
+		fmt.Printf("\n=== %s ===\n", job.Document.Name)
+		return runBuild(job.InputDir, job.OutputFile, job.ManifestFile, job.Compress, true, job.Sign, job.KeyFile, job.SectionKeys, job.AssetPolicy, "", anonymizeOptions{}, vulnerabilityOptions{}, optimizeOptions{}, attestationOptions{}, projectOptions{}, false)
+	}
+
+	report, err := workspace.Build(ws, build, workspace.BuildOptions{NoCache: noCache, Update: update})
+	if err != nil {
+		return fmt.Errorf("workspace build failed: %v", err)
+	}
+
+	fmt.Printf("\nWorkspace Build Report\n")
+	fmt.Printf("======================\n")
+	for _, result := range report.Documents {
+		switch result.Status {
+		case workspace.StatusFailed:
+			fmt.Printf("✗ %-24s %s\n", result.Name, result.Error)
+		case workspace.StatusCached:
+			fmt.Printf("✓ %-24s %s (cached, %d bytes)\n", result.Name, result.Output, result.Size)
+		default:
+			fmt.Printf("✓ %-24s %s (%d bytes, %d shared assets, %.1fs)\n", result.Name, result.Output, result.Size, result.Assets, result.Seconds)
+		}
+	}
+	fmt.Printf("\nBuilt: %d, cached: %d, failed: %d (%.1fs)\n",
+		report.Count(workspace.StatusBuilt), report.Count(workspace.StatusCached), report.Count(workspace.StatusFailed), report.Seconds)
+
+	if len(report.LockChanges) > 0 {
+		fmt.Printf("\n%s updated:\n", workspace.LockFile)
+		for _, change := range report.LockChanges {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+
+	reportPath := filepath.Join(ws.OutputPath(), "build-report.json")
+	if err := report.WriteFile(reportPath); err != nil {
+		return fmt.Errorf("failed to write build report: %v", err)
+	}
+	fmt.Printf("Report written to %s\n", reportPath)
+
+	if failed := report.Count(workspace.StatusFailed); failed > 0 {
+		return fmt.Errorf("%d of %d documents failed to build", failed, len(report.Documents))
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+//go:build js && wasm
+
+// Command liv-crypto-wasm is compiled to WebAssembly and loaded by the web viewer
+// to decrypt encrypted .liv resources in the browser. Content keys are unwrapped
+// and held inside the WASM instance; the server only ever sees ciphertext.
+//
+// Build with:
+//
+//	GOOS=js GOARCH=wasm go build -o cmd/viewer/static/wasm/liv-crypto.wasm ./cmd/liv-crypto-wasm
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"syscall/js"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/encryption"
+)
+
+// session holds an unlocked content key together with the document's encryption info
+type session struct {
+	info      *core.EncryptionInfo
+	encryptor *encryption.Encryptor
+}
+
+var (
+	sessions    = make(map[int]*session)
+	nextSession = 1
+)
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("unlockWithPassword", js.FuncOf(unlockWithPassword))
+	api.Set("unlockWithPrivateKey", js.FuncOf(unlockWithPrivateKey))
+	api.Set("chunkRange", js.FuncOf(chunkRange))
+	api.Set("decryptChunks", js.FuncOf(decryptChunks))
+	api.Set("lock", js.FuncOf(lock))
+	js.Global().Set("livCrypto", api)
+
+	// Keep the module alive for the lifetime of the page
+	select {}
+}
+
+// unlockWithPassword(encryptionJSON, password) -> session id
+func unlockWithPassword(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		return jsError("unlockWithPassword expects (encryption, password)")
+	}
+
+	info, err := parseInfo(args[0].String())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	key, err := encryption.UnwrapKeyWithPassword(info, args[1].String())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	return openSession(info, key)
+}
+
+// unlockWithPrivateKey(encryptionJSON, pemPrivateKey) -> session id
+func unlockWithPrivateKey(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		return jsError("unlockWithPrivateKey expects (encryption, privateKeyPEM)")
+	}
+
+	info, err := parseInfo(args[0].String())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	privateKey, err := parsePrivateKey(args[1].String())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	key, err := encryption.UnwrapKeyWithPrivateKey(info, privateKey)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	return openSession(info, key)
+}
+
+// chunkRange(sessionID, path, start, end) -> {start, end, firstChunk} ciphertext range
+func chunkRange(this js.Value, args []js.Value) interface{} {
+	if len(args) != 4 {
+		return jsError("chunkRange expects (session, path, start, end)")
+	}
+
+	s, resource, err := lookup(args[0].Int(), args[1].String())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	end := int64(args[3].Float())
+	if end < 0 {
+		end = resource.PlaintextSize - 1
+	}
+
+	cipherStart, cipherEnd, first, err := encryption.ChunkRange(resource.PlaintextSize, s.info.ChunkSize, int64(args[2].Float()), end)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	result := js.Global().Get("Object").New()
+	result.Set("start", cipherStart)
+	result.Set("end", cipherEnd)
+	result.Set("firstChunk", first)
+	result.Set("plaintextSize", resource.PlaintextSize)
+	result.Set("plaintextType", resource.PlaintextType)
+	return result
+}
+
+// decryptChunks(sessionID, path, firstChunk, Uint8Array ciphertext) -> Uint8Array plaintext
+func decryptChunks(this js.Value, args []js.Value) interface{} {
+	if len(args) != 4 {
+		return jsError("decryptChunks expects (session, path, firstChunk, ciphertext)")
+	}
+
+	s, resource, err := lookup(args[0].Int(), args[1].String())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	path := args[1].String()
+	first := args[2].Int()
+	ciphertext := make([]byte, args[3].Get("length").Int())
+	js.CopyBytesToGo(ciphertext, args[3])
+
+	sealed := s.info.ChunkSize + encryption.TagSize
+	plaintext := make([]byte, 0, len(ciphertext))
+	for i := 0; i*sealed < len(ciphertext); i++ {
+		end := (i + 1) * sealed
+		if end > len(ciphertext) {
+			end = len(ciphertext)
+		}
+		chunk, err := s.encryptor.DecryptChunk(path, first+i, ciphertext[i*sealed:end], resource)
+		if err != nil {
+			return jsError(err.Error())
+		}
+		plaintext = append(plaintext, chunk...)
+	}
+
+	out := js.Global().Get("Uint8Array").New(len(plaintext))
+	js.CopyBytesToJS(out, plaintext)
+	return out
+}
+
+// lock(sessionID) discards an unlocked content key
+func lock(this js.Value, args []js.Value) interface{} {
+	if len(args) == 1 {
+		delete(sessions, args[0].Int())
+	}
+	return nil
+}
+
+// Helper functions
+
+func openSession(info *core.EncryptionInfo, key []byte) interface{} {
+	encryptor, err := encryption.NewEncryptor(key, info.ChunkSize)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	id := nextSession
+	nextSession++
+	sessions[id] = &session{info: info, encryptor: encryptor}
+	return id
+}
+
+func lookup(id int, path string) (*session, *core.EncryptedResource, error) {
+	s, exists := sessions[id]
+	if !exists {
+		return nil, nil, fmt.Errorf("document is locked")
+	}
+
+	resource, exists := s.info.Resources[path]
+	if !exists {
+		return nil, nil, fmt.Errorf("resource is not encrypted: %s", path)
+	}
+
+	return s, resource, nil
+}
+
+func parseInfo(data string) (*core.EncryptionInfo, error) {
+	var info core.EncryptionInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return nil, fmt.Errorf("invalid encryption info: %v", err)
+	}
+	return &info, nil
+}
+
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+func jsError(message string) interface{} {
+	return js.Global().Get("Error").New(message)
+}
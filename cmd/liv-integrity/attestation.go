@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/liv-format/liv/pkg/attestation"
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+// verifyAttestation checks that a build attestation of livFile is signed by
+// one of the public keys and covers the package. With sourceDir, the source
+// tree it records is compared with the files in sourceDir.
+func verifyAttestation(livFile string, publicKeyFiles []string, attestationFile, sourceDir string, verbose bool) error {
+	if attestationFile == "" {
+		attestationFile = livFile + attestation.Extension
+	}
+	if verbose {
+		fmt.Printf("Verifying build attestation: %s\n", attestationFile)
+	}
+
+	sm := integrity.NewSignatureManager()
+	var publicKeys []crypto.PublicKey
+	for _, publicKeyFile := range publicKeyFiles {
+		publicKey, err := sm.LoadPublicKeyPEM(publicKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load public key %s: %v", publicKeyFile, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	pkg, err := os.ReadFile(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to read LIV file: %v", err)
+	}
+	data, err := os.ReadFile(attestationFile)
+	if err != nil {
+		return fmt.Errorf("failed to read attestation: %v", err)
+	}
+	envelopes, err := attestation.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	// A bundle may hold attestations of several builds; the first that is
+	// signed by a given key and covers this package is used
+	var statement *attestation.Statement
+	var errs []string
+	for _, envelope := range envelopes {
+		s, err := attestation.Verify(envelope, publicKeys)
+		if err == nil {
+			err = s.CheckSubject(pkg)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		statement = s
+		break
+	}
+
+	fmt.Printf("Build Attestation Results\n")
+	fmt.Printf("=========================\n\n")
+
+	if statement == nil {
+		fmt.Printf("✗ Status: INVALID\n")
+		fmt.Printf("\nErrors:\n")
+		for _, err := range errs {
+			fmt.Printf("  - %s\n", err)
+		}
+		return fmt.Errorf("attestation verification failed")
+	}
+
+	valid := true
+	fmt.Printf("Signature:    ✓ Valid\n")
+	fmt.Printf("Package:      ✓ sha256:%s\n", attestation.Digest(pkg))
+
+	source := statement.Dependency("source")
+	if sourceDir != "" {
+		digest, count, err := attestation.HashTree(sourceDir)
+		if err != nil {
+			return fmt.Errorf("failed to hash source tree: %v", err)
+		}
+		if source != nil && source.Digest["sha256"] == digest {
+			fmt.Printf("Source tree:  ✓ Matches %s (%d files)\n", sourceDir, count)
+		} else {
+			fmt.Printf("Source tree:  ✗ %s (sha256:%s) was not the source of this build\n", sourceDir, digest)
+			valid = false
+		}
+	} else if source != nil {
+		fmt.Printf("Source tree:  sha256:%s\n", source.Digest["sha256"])
+	}
+
+	predicate := statement.Predicate
+	fmt.Printf("Builder:      %s\n", predicate.RunDetails.Builder.ID)
+	if metadata := predicate.RunDetails.Metadata; metadata != nil && metadata.StartedOn != nil && metadata.FinishedOn != nil {
+		fmt.Printf("Built:        %s to %s\n", metadata.StartedOn.Format(time.RFC3339), metadata.FinishedOn.Format(time.RFC3339))
+	}
+	if steps, ok := predicate.BuildDefinition.InternalParameters["steps"].([]interface{}); ok {
+		fmt.Printf("Steps:        %d\n", len(steps))
+		if verbose {
+			for i, step := range steps {
+				fmt.Printf("  %d. %v\n", i+1, step)
+			}
+		}
+	}
+
+	if verbose {
+		fmt.Printf("\nInputs:\n")
+		for _, dependency := range predicate.BuildDefinition.ResolvedDependencies {
+			fmt.Printf("  %s: sha256:%s\n", dependency.Name, dependency.Digest["sha256"])
+		}
+		fmt.Printf("\nParameters:\n")
+		for _, name := range sortedKeys(predicate.BuildDefinition.ExternalParameters) {
+			fmt.Printf("  %s: %v\n", name, predicate.BuildDefinition.ExternalParameters[name])
+		}
+		if environment, ok := predicate.BuildDefinition.InternalParameters["environment"].(map[string]interface{}); ok {
+			fmt.Printf("\nEnvironment:\n")
+			for _, name := range sortedKeys(environment) {
+				fmt.Printf("  %s: %v\n", name, environment[name])
+			}
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("attestation verification failed")
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
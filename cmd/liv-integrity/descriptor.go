@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/verification"
+)
+
+// verifyDescriptor checks a LIV document against its verification
+// descriptor. With public keys, the descriptor must also be signed by one
+// of them.
+func verifyDescriptor(livFile string, publicKeyFiles []string, verbose bool) error {
+	if verbose {
+		fmt.Printf("Verifying descriptor: %s\n", livFile)
+	}
+
+	sm := integrity.NewSignatureManager()
+	trusted := make(map[string]bool)
+	for _, publicKeyFile := range publicKeyFiles {
+		publicKey, err := sm.LoadPublicKeyPEM(publicKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load public key %s: %v", publicKeyFile, err)
+		}
+		trusted[sm.KeyID(publicKey)] = true
+	}
+
+	files, err := container.NewZIPContainer().ExtractToMemory(livFile)
+	if err != nil {
+		return fmt.Errorf("failed to read LIV file: %v", err)
+	}
+	descriptor, problems, err := verification.Verify(files)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Verification Descriptor Results\n")
+	fmt.Printf("===============================\n\n")
+	fmt.Printf("Format:       %s\n", descriptor.Format)
+	fmt.Printf("Root hash:    %s:%s\n", descriptor.HashAlgorithm, descriptor.RootHash)
+	fmt.Printf("Files:        %d\n", len(descriptor.Files))
+
+	signedByTrusted := false
+	for _, signature := range descriptor.Signatures {
+		status := "✓ Valid"
+		if err := signature.Verify(descriptor.RootHash); err != nil {
+			status = "✗ Invalid"
+		} else if trusted[signature.KeyID] {
+			status = "✓ Valid, trusted key"
+			signedByTrusted = true
+		}
+		fmt.Printf("Signature:    %s (%s, key %s)\n", status, signature.Algorithm, signature.KeyID)
+	}
+	if len(descriptor.Signatures) == 0 {
+		fmt.Printf("Signature:    ⚠ Unsigned\n")
+	}
+	if len(trusted) > 0 && !signedByTrusted {
+		problems = append(problems, "the descriptor is not signed by any of the given keys")
+	}
+
+	if verbose {
+		fmt.Printf("\nFiles:\n")
+		for _, path := range sortedPaths(descriptor.Files) {
+			fmt.Printf("  %s  %s\n", descriptor.Files[path], path)
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("\n✗ Status: INVALID\n")
+		fmt.Printf("\nErrors:\n")
+		for _, problem := range problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+		return fmt.Errorf("descriptor verification failed")
+	}
+	fmt.Printf("\n✓ Status: VALID\n")
+	return nil
+}
+
+// writeVectors writes the descriptor conformance suite to outputFile, or to
+// standard output when it is empty
+func writeVectors(outputFile string) error {
+	suite, err := verification.Vectors()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize vectors: %v", err)
+	}
+	data = append(data, '\n')
+	if outputFile == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := atomicfile.WriteFile(outputFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write vectors: %v", err)
+	}
+	fmt.Printf("Wrote %d conformance vectors to %s\n", len(suite.Vectors), outputFile)
+	return nil
+}
+
+// sortedPaths returns the keys of m in order
+func sortedPaths(m map[string]string) []string {
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -2,22 +2,32 @@ package main
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/liv-format/liv/pkg/container"
 	"github.com/liv-format/liv/pkg/core"
 	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/tsa"
 	"github.com/spf13/cobra"
 )
 
 func main() {
 	var (
-		verbose    bool
-		keySize    int
-		outputFile string
+		verbose         bool
+		keySize         int
+		algorithm       string
+		outputFile      string
+		tsaURL          string
+		tsaRoots        string
+		requireAll      bool
+		attestationFile string
+		sourceDir       string
 	)
 
 	rootCmd := &cobra.Command{
@@ -57,14 +67,15 @@ for LIV documents.`,
 	// Generate keys command
 	generateKeysCmd := &cobra.Command{
 		Use:   "generate-keys [key-name]",
-		Short: "Generate RSA key pair for signing",
-		Long:  "Generate a new RSA key pair for signing LIV documents.",
+		Short: "Generate key pair for signing",
+		Long:  "Generate a new RSA, ECDSA P-256 or Ed25519 key pair for signing LIV documents.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return generateKeys(args[0], keySize, verbose)
+			return generateKeys(args[0], algorithm, keySize, verbose)
 		},
 	}
 
+	generateKeysCmd.Flags().StringVarP(&algorithm, "algorithm", "a", "rsa", "Signature algorithm (rsa, ecdsa, ed25519)")
 	generateKeysCmd.Flags().IntVarP(&keySize, "key-size", "s", 2048, "RSA key size in bits")
 	generateKeysCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 
@@ -75,25 +86,82 @@ for LIV documents.`,
 		Long:  "Add digital signatures to a LIV document using a private key.",
 		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return signDocument(args[0], args[1], outputFile, verbose)
+			return signDocument(args[0], args[1], outputFile, tsaURL, verbose)
 		},
 	}
 
 	signCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file (default: overwrite input)")
+	signCmd.Flags().StringVar(&tsaURL, "tsa-url", "", "RFC 3161 timestamping authority to timestamp the signatures")
 	signCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 
 	// Verify signature command
 	verifySignatureCmd := &cobra.Command{
-		Use:   "verify-signature [liv-file] [public-key]",
+		Use:   "verify-signature [liv-file] [public-key...]",
 		Short: "Verify signatures in a LIV document",
-		Long:  "Verify all digital signatures in a LIV document using a public key.",
-		Args:  cobra.ExactArgs(2),
+		Long: `Verify all digital signatures in a LIV document using the public keys of its
+signers. Each signer of a counter-signed document is verified independently
+with the key matching their key ID; signers without a matching key are
+reported as unverified.`,
+		Args: cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return verifySignatures(args[0], args[1], verbose)
+			return verifySignatures(args[0], args[1:], tsaRoots, requireAll, verbose)
 		},
 	}
 
 	verifySignatureCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Detailed verification output")
+	verifySignatureCmd.Flags().StringVar(&tsaRoots, "tsa-roots", "", "PEM file of roots timestamping authorities must chain to (default: any authority, whose timestamps are untrusted)")
+	verifySignatureCmd.Flags().BoolVar(&requireAll, "require-all-signers", false, "Fail unless every signer is verified")
+
+	// Verify attestation command
+	verifyAttestationCmd := &cobra.Command{
+		Use:   "verify-attestation [liv-file] [public-key...]",
+		Short: "Verify the build attestation of a LIV document",
+		Long: `Verify the signed in-toto attestation liv-builder --attest wrote for a LIV
+document: that it is signed by one of the public keys and covers the document,
+and with --source, that the document was built from the given source tree.
+The builder, build steps, inputs and environment it records are shown.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return verifyAttestation(args[0], args[1:], attestationFile, sourceDir, verbose)
+		},
+	}
+
+	verifyAttestationCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the recorded inputs, parameters and environment")
+	verifyAttestationCmd.Flags().StringVar(&attestationFile, "attestation", "", "Attestation file (default: the document name with .intoto.jsonl)")
+	verifyAttestationCmd.Flags().StringVar(&sourceDir, "source", "", "Source directory to check against the recorded source tree")
+
+	// Verify descriptor command
+	verifyDescriptorCmd := &cobra.Command{
+		Use:   "verify-descriptor [liv-file] [public-key...]",
+		Short: "Verify a LIV document against its verification descriptor",
+		Long: `Verify a LIV document against the verification descriptor the builder stores
+in it: every file must match its listed hash, the root hash must match the
+list and every signature must be valid. With public keys, the descriptor must
+also be signed by one of them.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return verifyDescriptor(args[0], args[1:], verbose)
+		},
+	}
+
+	verifyDescriptorCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "List the hash of every file")
+
+	// Conformance vectors command
+	vectorsCmd := &cobra.Command{
+		Use:   "conformance-vectors [output-file]",
+		Short: "Write the verification descriptor conformance vectors",
+		Long: `Write the conformance test vectors for implementations of the verification
+descriptor format as JSON, to the given file or standard output. The vectors
+are the same on every run.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output := ""
+			if len(args) == 1 {
+				output = args[0]
+			}
+			return writeVectors(output)
+		},
+	}
 
 	// Report command
 	reportCmd := &cobra.Command{
@@ -114,6 +182,9 @@ for LIV documents.`,
 	rootCmd.AddCommand(generateKeysCmd)
 	rootCmd.AddCommand(signCmd)
 	rootCmd.AddCommand(verifySignatureCmd)
+	rootCmd.AddCommand(verifyAttestationCmd)
+	rootCmd.AddCommand(verifyDescriptorCmd)
+	rootCmd.AddCommand(vectorsCmd)
 	rootCmd.AddCommand(reportCmd)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -247,28 +318,40 @@ func verifyIntegrity(livFile string, verbose bool) error {
 	return nil
 }
 
-func generateKeys(keyName string, keySize int, verbose bool) error {
+func generateKeys(keyName, algorithmName string, keySize int, verbose bool) error {
+	algorithm, err := integrity.ParseSignatureAlgorithm(algorithmName)
+	if err != nil {
+		return err
+	}
 	if verbose {
-		fmt.Printf("Generating %d-bit RSA key pair: %s\n", keySize, keyName)
+		if algorithm == integrity.AlgorithmRSASHA256 {
+			fmt.Printf("Generating %d-bit RSA key pair: %s\n", keySize, keyName)
+		} else {
+			fmt.Printf("Generating %s key pair: %s\n", algorithm, keyName)
+		}
 	}
 
 	sm := integrity.NewSignatureManager()
 
-	keyPair, err := sm.GenerateKeyPair(keySize)
-	if err != nil {
-		return fmt.Errorf("failed to generate key pair: %v", err)
+	var keyPair *integrity.SigningKeyPair
+	if algorithm == integrity.AlgorithmRSASHA256 {
+		rsaKeyPair, err := sm.GenerateKeyPair(keySize)
+		if err != nil {
+			return fmt.Errorf("failed to generate key pair: %v", err)
+		}
+		keyPair = &integrity.SigningKeyPair{Algorithm: algorithm, PrivateKey: rsaKeyPair.PrivateKey, PublicKey: rsaKeyPair.PublicKey}
+	} else {
+		keyPair, err = sm.GenerateSigningKeyPair(algorithm)
+		if err != nil {
+			return fmt.Errorf("failed to generate key pair: %v", err)
+		}
 	}
 
-	// Save private key
+	// Save private and public keys
 	privateKeyFile := keyName + "-private.pem"
-	if err := sm.SavePrivateKeyPEM(keyPair, privateKeyFile); err != nil {
-		return fmt.Errorf("failed to save private key: %v", err)
-	}
-
-	// Save public key
 	publicKeyFile := keyName + "-public.pem"
-	if err := sm.SavePublicKeyPEM(keyPair, publicKeyFile); err != nil {
-		return fmt.Errorf("failed to save public key: %v", err)
+	if err := sm.SaveSigningKeyPairPEM(keyPair, privateKeyFile, publicKeyFile); err != nil {
+		return fmt.Errorf("failed to save key pair: %v", err)
 	}
 
 	fmt.Printf("✓ Generated key pair:\n")
@@ -286,7 +369,7 @@ func generateKeys(keyName string, keySize int, verbose bool) error {
 	return nil
 }
 
-func signDocument(livFile, privateKeyFile, outputFile string, verbose bool) error {
+func signDocument(livFile, privateKeyFile, outputFile, tsaURL string, verbose bool) error {
 	if verbose {
 		fmt.Printf("Signing document: %s\n", livFile)
 		fmt.Printf("Private key: %s\n", privateKeyFile)
@@ -318,6 +401,16 @@ func signDocument(livFile, privateKeyFile, outputFile string, verbose bool) erro
 		return fmt.Errorf("failed to sign document: %v", err)
 	}
 
+	// Timestamp signatures
+	if tsaURL != "" {
+		if verbose {
+			fmt.Printf("Timestamping authority: %s\n", tsaURL)
+		}
+		if err := sm.TimestampSignatures(context.TODO(), signatures, tsa.NewClient(tsaURL)); err != nil {
+			return err
+		}
+	}
+
 	document.Signatures = signatures
 
 	// Determine output file
@@ -342,22 +435,40 @@ func signDocument(livFile, privateKeyFile, outputFile string, verbose bool) erro
 		if len(signatures.WASMSignatures) > 0 {
 			fmt.Printf("  WASM modules: %d\n", len(signatures.WASMSignatures))
 		}
+		if len(signatures.Timestamp) > 0 {
+			fmt.Printf("  Timestamp: %d bytes\n", len(signatures.Timestamp))
+		}
 	}
 
 	return nil
 }
 
-func verifySignatures(livFile, publicKeyFile string, verbose bool) error {
+func verifySignatures(livFile string, publicKeyFiles []string, tsaRoots string, requireAll, verbose bool) error {
 	if verbose {
 		fmt.Printf("Verifying signatures in: %s\n", livFile)
-		fmt.Printf("Public key: %s\n", publicKeyFile)
+		fmt.Printf("Public keys: %s\n", strings.Join(publicKeyFiles, ", "))
 	}
 
-	// Load public key
+	// Load public keys
 	sm := integrity.NewSignatureManager()
-	publicKey, err := sm.LoadPublicKeyPEM(publicKeyFile)
-	if err != nil {
-		return fmt.Errorf("failed to load public key: %v", err)
+	var publicKeys []crypto.PublicKey
+	for _, publicKeyFile := range publicKeyFiles {
+		publicKey, err := sm.LoadPublicKeyPEM(publicKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load public key %s: %v", publicKeyFile, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	if tsaRoots != "" {
+		data, err := os.ReadFile(tsaRoots)
+		if err != nil {
+			return fmt.Errorf("failed to read timestamping roots: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", tsaRoots)
+		}
+		sm.SetTimestampRoots(roots)
 	}
 
 	// Extract LIV document
@@ -373,8 +484,11 @@ func verifySignatures(livFile, publicKeyFile string, verbose bool) error {
 		return fmt.Errorf("failed to extract LIV document: %v", err)
 	}
 
-	// Verify signatures
+	// Verify the signatures of the first signer with their key, and every
+	// signer independently
+	publicKey := firstSignerKey(sm, document, publicKeys)
 	result := sm.VerifyDocument(document, publicKey)
+	signers := sm.VerifySigners(document, publicKeys)
 
 	fmt.Printf("Signature Verification Results\n")
 	fmt.Printf("==============================\n\n")
@@ -399,6 +513,14 @@ func verifySignatures(livFile, publicKeyFile string, verbose bool) error {
 		fmt.Printf("✗ Invalid\n")
 	}
 
+	if result.Timestamp != nil && result.TimestampTrusted {
+		fmt.Printf("Timestamp:          ✓ Signed at %s by %s\n", result.Timestamp.Format(time.RFC3339), result.TimestampAuthority)
+	} else if result.Timestamp != nil {
+		fmt.Printf("Timestamp:          ⚠ Claims %s by %s, an authority not in --tsa-roots\n", result.Timestamp.Format(time.RFC3339), result.TimestampAuthority)
+	} else if document.Signatures != nil && len(document.Signatures.Timestamp) > 0 {
+		fmt.Printf("Timestamp:          ✗ Invalid\n")
+	}
+
 	if len(result.WASMModulesValid) > 0 {
 		fmt.Printf("WASM modules:\n")
 		for moduleName, valid := range result.WASMModulesValid {
@@ -410,6 +532,36 @@ func verifySignatures(livFile, publicKeyFile string, verbose bool) error {
 		}
 	}
 
+	// Signer metadata is shown for signed documents that record it
+	signersVerified := true
+	if len(signers) > 1 || (len(signers) == 1 && signers[0].Signer != nil) {
+		fmt.Printf("Signers:\n")
+	}
+	for i, signer := range signers {
+		if signer.CounterSignature && signer.Status == integrity.SignerInvalid {
+			result.Valid = false
+		}
+		if signer.Status != integrity.SignerValid {
+			signersVerified = false
+		}
+		if signer.Signer == nil {
+			continue
+		}
+		mark := "✓"
+		if signer.Status != integrity.SignerValid {
+			mark = "✗"
+		}
+		fmt.Printf("  %s %d. %s: %s\n", mark, i+1, signer.Signer.Summary(), signer.Status)
+		if signer.Timestamp != nil {
+			fmt.Printf("       Timestamped at %s\n", signer.Timestamp.Format(time.RFC3339))
+		}
+		if signer.CounterSignature {
+			for _, err := range signer.Errors {
+				result.Errors = append(result.Errors, fmt.Sprintf("signer %d: %s", i+1, err))
+			}
+		}
+	}
+
 	if len(result.Errors) > 0 {
 		fmt.Printf("\nErrors:\n")
 		for _, err := range result.Errors {
@@ -429,10 +581,33 @@ func verifySignatures(livFile, publicKeyFile string, verbose bool) error {
 	if !result.Valid {
 		return fmt.Errorf("signature verification failed")
 	}
+	if requireAll && !signersVerified {
+		return fmt.Errorf("not every signer was verified")
+	}
 
 	return nil
 }
 
+// firstSignerKey picks the key of the first signer among keys: the key
+// matching the recorded key ID or, for documents without signer metadata, the
+// first key their signatures verify with
+func firstSignerKey(sm *integrity.SignatureManager, document *core.LIVDocument, keys []crypto.PublicKey) crypto.PublicKey {
+	if document.Signatures != nil && document.Signatures.Signer != nil {
+		for _, key := range keys {
+			if sm.KeyID(key) == document.Signatures.Signer.KeyID {
+				return key
+			}
+		}
+		return keys[0]
+	}
+	for _, key := range keys {
+		if sm.VerifyDocument(document, key).Valid {
+			return key
+		}
+	}
+	return keys[0]
+}
+
 func generateReport(livFile string, verbose bool) error {
 	// Extract LIV document
 	packageManager := container.NewPackageManager()
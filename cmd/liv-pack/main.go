@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
 )
 
 func main() {
@@ -14,6 +17,7 @@ func main() {
 		compressionLevel int
 		verbose          bool
 		validate         bool
+		deep             bool
 	)
 
 	rootCmd := &cobra.Command{
@@ -68,14 +72,18 @@ This tool handles the packaging, extraction, and validation of .liv file contain
 	validateCmd := &cobra.Command{
 		Use:   "validate [input.liv]",
 		Short: "Validate a .liv file structure",
-		Long:  "Validate checks the internal structure and security of a .liv file.",
-		Args:  cobra.ExactArgs(1),
+		Long: `Validate checks the internal structure and security of a .liv file.
+With --deep it also re-hashes every file in the archive and compares hashes and
+sizes with the manifest, reporting missing resources and files the manifest
+does not list.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return validateFile(args[0], verbose)
+			return validateFile(args[0], verbose, deep)
 		},
 	}
 
 	validateCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show detailed validation results")
+	validateCmd.Flags().BoolVarP(&deep, "deep", "", false, "Verify file hashes and sizes against the manifest")
 
 	// Info command
 	infoCmd := &cobra.Command{
@@ -242,7 +250,7 @@ func listContents(inputPath string, verbose bool) error {
 	return nil
 }
 
-func validateFile(inputPath string, verbose bool) error {
+func validateFile(inputPath string, verbose, deep bool) error {
 	// Check if input file exists
 	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
 		return fmt.Errorf("input file does not exist: %s", inputPath)
@@ -319,6 +327,12 @@ func validateFile(inputPath string, verbose bool) error {
 		}
 	}
 
+	if deep {
+		if err := verifyFile(inputPath, verbose); err != nil {
+			return err
+		}
+	}
+
 	if !result.IsValid {
 		return fmt.Errorf("validation failed")
 	}
@@ -326,6 +340,94 @@ func validateFile(inputPath string, verbose bool) error {
 	return nil
 }
 
+// verifyFile re-hashes the files of a .liv archive and compares them with the
+// resources of its manifest. The manifest and signatures describe the package
+// rather than belong to it, so they are not expected to be listed. The error
+// names every file that does not match.
+func verifyFile(inputPath string, verbose bool) error {
+	files, err := container.NewZIPContainer().ExtractToMemory(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to extract archive: %v", err)
+	}
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return fmt.Errorf("archive has no manifest.json")
+	}
+	m, err := manifest.NewManifestParser().ParseFromBytes(manifestData)
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	// Older builds listed the manifest among its own resources, with a hash
+	// it cannot have
+	delete(m.Resources, "manifest.json")
+
+	resources := make(map[string][]byte)
+	wasmModules := make(map[string][]byte)
+	for path, data := range files {
+		if path == "manifest.json" || strings.HasPrefix(path, "signatures/") {
+			continue
+		}
+		resources[path] = data
+		if filepath.Ext(path) == ".wasm" {
+			wasmModules[strings.TrimSuffix(filepath.Base(path), ".wasm")] = data
+		}
+	}
+
+	report := integrity.NewIntegrityValidator().GenerateIntegrityReport(m, resources, wasmModules)
+
+	fmt.Printf("\nIntegrity:\n")
+	fmt.Printf("  Resources verified: %d of %d\n", report.ValidatedResources, report.TotalResources)
+	for _, mismatch := range report.HashMismatches {
+		fmt.Printf("  ✗ %s: hash %s, manifest has %s\n", mismatch.Path, mismatch.ActualHash, mismatch.ExpectedHash)
+	}
+	for _, mismatch := range report.SizeMismatches {
+		fmt.Printf("  ✗ %s: %d bytes, manifest has %d\n", mismatch.Path, mismatch.ActualSize, mismatch.ExpectedSize)
+	}
+	for _, missing := range report.MissingResources {
+		fmt.Printf("  ✗ %s: listed in the manifest but not in the archive\n", missing)
+	}
+	for _, orphan := range report.OrphanedFiles {
+		fmt.Printf("  ⚠ %s: not listed in the manifest\n", orphan)
+	}
+	if report.WASMValidation != nil {
+		for _, err := range report.WASMValidation.Errors {
+			fmt.Printf("  ✗ %s\n", err)
+		}
+		if verbose {
+			for _, warning := range report.WASMValidation.Warnings {
+				fmt.Printf("  ⚠ %s\n", warning)
+			}
+		}
+	}
+	if report.Valid {
+		fmt.Printf("  ✓ All files match the manifest\n")
+		return nil
+	}
+
+	var failed []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			failed = append(failed, path)
+		}
+	}
+	for _, mismatch := range report.HashMismatches {
+		add(mismatch.Path)
+	}
+	for _, mismatch := range report.SizeMismatches {
+		add(mismatch.Path)
+	}
+	for _, missing := range report.MissingResources {
+		add(missing)
+	}
+	if len(failed) == 0 {
+		return fmt.Errorf("integrity check failed")
+	}
+	return fmt.Errorf("integrity check failed: %s", strings.Join(failed, ", "))
+}
+
 func showInfo(inputPath string) error {
 	// Check if input file exists
 	fileInfo, err := os.Stat(inputPath)
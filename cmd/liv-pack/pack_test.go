@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/liv"
+)
+
+func TestValidateDeep(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"content/index.html":      "<html><head><title>Quarterly Report</title></head><body><h1>Quarterly Report</h1></body></html>",
+		"content/styles/main.css": "body { font-family: serif; }",
+	} {
+		file := filepath.Join(dir, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc, err := liv.Build(filepath.Join(dir, "src"), liv.BuildOptions{Author: "ACME Corp"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	livPath := filepath.Join(dir, "report.liv")
+	if err := doc.Save(livPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateFile(livPath, false, true); err != nil {
+		t.Fatalf("Expected the built package to pass deep validation, got %v", err)
+	}
+
+	// Repackage with one file changed and the manifest left as it was
+	files, err := container.NewZIPContainer().ExtractToMemory(livPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["content/styles/main.css"] = []byte("body { display: none; }")
+	tampered := filepath.Join(dir, "tampered.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(files, tampered); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateFile(tampered, false, false); err != nil {
+		t.Errorf("Expected the structure alone to pass, got %v", err)
+	}
+	err = validateFile(tampered, false, true)
+	if err == nil {
+		t.Fatal("Expected deep validation to fail on the changed file")
+	}
+	if !strings.Contains(err.Error(), "content/styles/main.css") || strings.Contains(err.Error(), "content/index.html") {
+		t.Errorf("Expected the error to name only the changed file, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+//go:build js && wasm
+
+// Command liv-reader-wasm is compiled to WebAssembly and loaded by the web viewer
+// to open .liv files in the browser. The package is read, its manifest and
+// resource hashes checked and its signatures verified inside the WASM instance,
+// so documents can be viewed without being uploaded to the server.
+//
+// Build with:
+//
+//	GOOS=js GOARCH=wasm go build -o cmd/viewer/static/wasm/liv-reader.wasm ./cmd/liv-reader-wasm
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"syscall/js"
+
+	"github.com/liv-format/liv/pkg/liv"
+)
+
+// certificateEntry is the signer certificate signed packages may carry
+const certificateEntry = "signatures/certificate.pem"
+
+var (
+	documents    = make(map[int]*liv.Document)
+	nextDocument = 1
+)
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("open", js.FuncOf(open))
+	api.Set("files", js.FuncOf(files))
+	api.Set("read", js.FuncOf(read))
+	api.Set("close", js.FuncOf(closeDocument))
+	js.Global().Set("livReader", api)
+
+	// Keep the module alive for the lifetime of the page
+	select {}
+}
+
+// open(Uint8Array package) -> {id, manifest, valid, errors, warnings, signature}
+func open(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return jsError("open expects (package)")
+	}
+
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+	doc, err := liv.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return jsError(err.Error())
+	}
+	manifestJSON, err := json.Marshal(doc.Manifest())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	result := doc.Validate()
+	id := nextDocument
+	nextDocument++
+	documents[id] = doc
+
+	return js.ValueOf(map[string]interface{}{
+		"id":        id,
+		"manifest":  string(manifestJSON),
+		"valid":     result.IsValid,
+		"errors":    jsStrings(result.Errors),
+		"warnings":  jsStrings(result.Warnings),
+		"signature": verify(doc),
+	})
+}
+
+// verify checks the signatures of a document with the signer certificate it
+// carries. The certificate is not checked against a trust store; the result
+// tells whether the document is as its signer signed it.
+func verify(doc *liv.Document) map[string]interface{} {
+	signature := map[string]interface{}{"signed": doc.Signed(), "verified": false}
+	if !doc.Signed() {
+		return signature
+	}
+	certPEM, err := doc.ReadFile(certificateEntry)
+	if err != nil {
+		signature["error"] = "the document is signed but has no signer certificate, so its signatures cannot be verified here"
+		return signature
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		signature["error"] = "invalid signer certificate"
+		return signature
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		signature["error"] = fmt.Sprintf("invalid signer certificate: %v", err)
+		return signature
+	}
+	signature["signer"] = cert.Subject.String()
+	if err := doc.Verify(cert.PublicKey); err != nil {
+		signature["error"] = err.Error()
+		return signature
+	}
+	signature["verified"] = true
+	return signature
+}
+
+// files(id) -> paths of the package's files
+func files(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return jsError("files expects (document)")
+	}
+
+	doc, err := lookup(args[0].Int())
+	if err != nil {
+		return jsError(err.Error())
+	}
+	return js.ValueOf(jsStrings(doc.Files()))
+}
+
+// read(id, path) -> Uint8Array contents of a file of the package
+func read(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		return jsError("read expects (document, path)")
+	}
+
+	doc, err := lookup(args[0].Int())
+	if err != nil {
+		return jsError(err.Error())
+	}
+	data, err := doc.ReadFile(args[1].String())
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	out := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(out, data)
+	return out
+}
+
+// close(id) releases an open document
+func closeDocument(this js.Value, args []js.Value) interface{} {
+	if len(args) == 1 {
+		delete(documents, args[0].Int())
+	}
+	return nil
+}
+
+// Helper functions
+
+func lookup(id int) (*liv.Document, error) {
+	doc, exists := documents[id]
+	if !exists {
+		return nil, fmt.Errorf("document is closed")
+	}
+	return doc, nil
+}
+
+// jsStrings converts a list for js.ValueOf, which takes []interface{}
+func jsStrings(list []string) []interface{} {
+	values := make([]interface{}, len(list))
+	for i, value := range list {
+		values[i] = value
+	}
+	return values
+}
+
+func jsError(message string) interface{} {
+	return js.Global().Get("Error").New(message)
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/liv-format/liv/pkg/atomicfile"
 	"github.com/liv-format/liv/pkg/core"
 	"github.com/liv-format/liv/pkg/manifest"
 )
@@ -31,6 +33,20 @@ files or manifests within complete LIV documents.`,
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output with warnings")
 	rootCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json)")
 
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the manifest format",
+		Long: `Schema prints the JSON Schema of the manifest format, for editors and other
+tools. Manifests are validated against it as well as by the checks of the
+validator.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := cmd.OutOrStdout().Write(manifest.JSONSchema())
+			return err
+		},
+	}
+	rootCmd.AddCommand(schemaCmd, generateCmd())
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -140,6 +156,7 @@ func outputJSON(result *core.ValidationResult, manifestObj *core.Manifest) error
 		"valid":    result.IsValid,
 		"errors":   result.Errors,
 		"warnings": result.Warnings,
+		"findings": result.Findings,
 	}
 
 	if manifestObj != nil {
@@ -165,29 +182,57 @@ func outputJSON(result *core.ValidationResult, manifestObj *core.Manifest) error
 	return nil
 }
 
-// Add a command to generate example manifests
-func init() {
-	generateCmd := &cobra.Command{
-		Use:   "generate [type]",
+// generateOptions are the settings of an example manifest
+type generateOptions struct {
+	title    string
+	author   string
+	features []string
+	output   string
+}
+
+func generateCmd() *cobra.Command {
+	var opts generateOptions
+
+	cmd := &cobra.Command{
+		Use:   "generate [interactive|static|presentation|report]",
 		Short: "Generate example manifest files",
-		Long:  "Generate example manifest files for different document types (interactive, static)",
-		Args:  cobra.ExactArgs(1),
+		Long: `Generate writes an example manifest for a kind of document: interactive pages
+with WebAssembly, static pages without scripts, scripted slide presentations
+or static reports laid out for print. --features replaces the features the
+kind enables. The manifest is printed, or written to --output.`,
+		Example: `  manifest-validator generate static
+  manifest-validator generate report --title "Annual Report" --author "Finance Team" -o manifest.json
+  manifest-validator generate interactive --features animations,interactivity,charts`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"interactive", "static", "presentation", "report"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return generateExampleManifest(args[0])
+			if !cmd.Flags().Changed("features") {
+				opts.features = nil
+			} else if opts.features == nil {
+				opts.features = []string{}
+			}
+			return generateExampleManifest(args[0], opts)
 		},
 	}
 
-	// Add generate command as subcommand
-	// This would be added to the root command in a real implementation
-	_ = generateCmd
+	cmd.Flags().StringVar(&opts.title, "title", "", "Document title (default: from the type)")
+	cmd.Flags().StringVar(&opts.author, "author", "Example Author", "Document author")
+	cmd.Flags().StringSliceVar(&opts.features, "features", nil, "Features to enable instead of those of the type: animations, interactivity, charts, forms, audio, video, webgl, webassembly")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "Write the manifest to this file instead of printing it")
+
+	return cmd
 }
 
-func generateExampleManifest(manifestType string) error {
+func generateExampleManifest(manifestType string, opts generateOptions) error {
+	title := opts.title
 	var builder *manifest.ManifestBuilder
 
 	switch manifestType {
 	case "interactive":
-		builder = manifest.CreateInteractiveDocumentTemplate("Interactive Document", "Example Author")
+		if title == "" {
+			title = "Interactive Document"
+		}
+		builder = manifest.CreateInteractiveDocumentTemplate(title, opts.author)
 		
 		// Add some example resources
 		builder.AddResource("content/index.html", &core.Resource{
@@ -208,7 +253,10 @@ func generateExampleManifest(manifestType string) error {
 		builder.AddWASMModule(wasmModule)
 
 	case "static":
-		builder = manifest.CreateStaticDocumentTemplate("Static Document", "Example Author")
+		if title == "" {
+			title = "Static Document"
+		}
+		builder = manifest.CreateStaticDocumentTemplate(title, opts.author)
 		
 		// Add basic resources
 		builder.AddResource("content/index.html", &core.Resource{
@@ -218,8 +266,57 @@ func generateExampleManifest(manifestType string) error {
 			Path: "content/index.html",
 		})
 
+	case "presentation":
+		if title == "" {
+			title = "Presentation"
+		}
+		builder = manifest.CreatePresentationDocumentTemplate(title, opts.author)
+		
+		// The slides and the script moving between them
+		builder.AddResource("content/index.html", &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 4096,
+			Type: "text/html",
+			Path: "content/index.html",
+		})
+		builder.AddResource("content/scripts/main.js", &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 1024,
+			Type: "application/javascript",
+			Path: "content/scripts/main.js",
+		})
+
+	case "report":
+		if title == "" {
+			title = "Report"
+		}
+		builder = manifest.CreateReportDocumentTemplate(title, opts.author)
+		
+		builder.AddResource("content/index.html", &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 8192,
+			Type: "text/html",
+			Path: "content/index.html",
+		})
+		builder.AddResource("content/styles/main.css", &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 2048,
+			Type: "text/css",
+			Path: "content/styles/main.css",
+		})
+
 	default:
-		return fmt.Errorf("unknown manifest type: %s (supported: interactive, static)", manifestType)
+		return fmt.Errorf("unknown manifest type: %s (supported: interactive, static, presentation, report)", manifestType)
+	}
+
+	if opts.features != nil {
+		features := &core.FeatureFlags{}
+		for _, name := range opts.features {
+			if err := features.Set(strings.TrimSpace(name), true); err != nil {
+				return err
+			}
+		}
+		builder.SetFeatureFlags(features)
 	}
 
 	// Build and output the manifest
@@ -228,6 +325,14 @@ func generateExampleManifest(manifestType string) error {
 		return fmt.Errorf("failed to build manifest: %v", err)
 	}
 
+	if opts.output != "" {
+		if err := atomicfile.WriteFile(opts.output, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write manifest: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Manifest written to %s\n", opts.output)
+		return nil
+	}
+
 	fmt.Println(string(data))
 	return nil
-}
\ No newline at end of file
+}
@@ -5,105 +5,93 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/liv-format/liv/pkg/auth"
 	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/scim"
 	"github.com/liv-format/liv/pkg/security"
+	"github.com/liv-format/liv/pkg/security/sqlstore"
+	"github.com/liv-format/liv/pkg/telemetry"
 )
 
 var (
-	port      = flag.String("port", "8080", "Server port")
-	configDir = flag.String("config-dir", "./security-config", "Security configuration directory")
-	logLevel  = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
-	enableTLS = flag.Bool("tls", false, "Enable TLS")
-	certFile  = flag.String("cert", "", "TLS certificate file")
-	keyFile   = flag.String("key", "", "TLS private key file")
+	port          = flag.String("port", "8080", "Server port")
+	configDir     = flag.String("config-dir", "./security-config", "Security configuration directory")
+	logLevel      = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	logFormat     = flag.String("log-format", "json", "Log format (json, text)")
+	logOutput     = flag.String("log-output", "stderr", "Comma-separated log sinks: stderr, stdout, syslog, syslog://host:port, syslog+tcp://host:port or a file path")
+	enableTLS     = flag.Bool("tls", false, "Enable TLS")
+	certFile      = flag.String("cert", "", "TLS certificate file")
+	keyFile       = flag.String("key", "", "TLS private key file")
+	authFile      = flag.String("auth-config", "", "Authentication config file requiring LDAP/Active Directory or SAML sign-in")
+	quarantineDir = flag.String("quarantine-dir", "", "Directory holding quarantined documents (default <config-dir>/quarantine)")
+	storageDSN    = flag.String("storage", "", "Database shared by permission servers for policies and logs: sqlite:<path> or postgres://... (default in-memory policies and log files)")
+	apiToken      = flag.String("api-token", "", "Bearer token granting programs access to the policy API (default $LIV_API_TOKEN)")
+	signersFile   = flag.String("trusted-signers", "", "JSON file of signers trusted to sign documents (default <config-dir>/trusted-signers.json)")
 )
 
-// SimpleLogger implements the core.Logger interface
-type SimpleLogger struct {
-	level string
-}
-
-func NewSimpleLogger(level string) *SimpleLogger {
-	return &SimpleLogger{level: level}
-}
-
-func (l *SimpleLogger) Debug(msg string, fields ...interface{}) {
-	if l.level == "debug" {
-		log.Printf("[DEBUG] %s %v", msg, fields)
-	}
+// SimpleSecurityManager implements basic security operations
+type SimpleSecurityManager struct {
+	crypto core.CryptoProvider
 }
 
-func (l *SimpleLogger) Info(msg string, fields ...interface{}) {
-	if l.level == "debug" || l.level == "info" {
-		log.Printf("[INFO] %s %v", msg, fields)
-	}
+// timedCryptoProvider records how long signature verification takes and
+// counts the signatures that fail it
+type timedCryptoProvider struct {
+	core.CryptoProvider
+	metrics *telemetry.Metrics
 }
 
-func (l *SimpleLogger) Warn(msg string, fields ...interface{}) {
-	if l.level != "error" {
-		log.Printf("[WARN] %s %v", msg, fields)
+func (cp *timedCryptoProvider) Verify(data []byte, signature []byte, publicKey []byte) bool {
+	start := time.Now()
+	valid := cp.CryptoProvider.Verify(data, signature, publicKey)
+	result := "valid"
+	if !valid {
+		result = "invalid"
+		cp.metrics.ValidationFailures.Inc("invalid_signature")
 	}
+	cp.metrics.SignatureVerification.ObserveSince(start, result)
+	return valid
 }
 
-func (l *SimpleLogger) Error(msg string, fields ...interface{}) {
-	log.Printf("[ERROR] %s %v", msg, fields)
-}
-
-func (l *SimpleLogger) Fatal(msg string, fields ...interface{}) {
-	log.Fatalf("[FATAL] %s %v", msg, fields)
-}
-
-// SimpleCryptoProvider implements basic cryptographic operations
-type SimpleCryptoProvider struct{}
-
-func (cp *SimpleCryptoProvider) GenerateKeyPair() (publicKey, privateKey []byte, err error) {
-	// Simplified implementation - in production, use proper crypto
-	return []byte("mock-public-key"), []byte("mock-private-key"), nil
-}
-
-func (cp *SimpleCryptoProvider) Sign(data []byte, privateKey []byte) ([]byte, error) {
-	// Simplified implementation - in production, use proper crypto
-	return []byte("mock-signature"), nil
-}
-
-func (cp *SimpleCryptoProvider) Verify(data []byte, signature []byte, publicKey []byte) bool {
-	// Simplified implementation - in production, use proper crypto
-	return string(signature) == "mock-signature"
-}
-
-func (cp *SimpleCryptoProvider) Hash(data []byte) []byte {
-	// Simplified implementation - in production, use proper crypto
-	return []byte("mock-hash")
-}
-
-func (cp *SimpleCryptoProvider) GenerateRandomBytes(length int) ([]byte, error) {
-	// Simplified implementation - in production, use proper crypto
-	bytes := make([]byte, length)
-	for i := range bytes {
-		bytes[i] = byte(i % 256)
+// countViolations counts the policy and compliance violations published by
+// events until the stream ends
+func countViolations(events *security.EventStream, metrics *telemetry.Metrics) {
+	violations, _ := events.Subscribe(&security.EventFilter{
+		EventTypes: []security.SecurityEventType{security.EventPolicyViolation, security.EventComplianceViolation},
+	})
+	for event := range violations {
+		metrics.PolicyViolations.Inc(string(event.EventType), string(event.Severity))
 	}
-	return bytes, nil
 }
 
-// SimpleSecurityManager implements basic security operations
-type SimpleSecurityManager struct{}
-
 func (sm *SimpleSecurityManager) ValidateSignature(content []byte, signature string, publicKey []byte) bool {
-	return signature == "mock-signature"
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return sm.crypto.Verify(content, sig, publicKey)
 }
 
 func (sm *SimpleSecurityManager) CreateSignature(content []byte, privateKey []byte) (string, error) {
-	return "mock-signature", nil
+	sig, err := sm.crypto.Sign(content, privateKey)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sig), nil
 }
 
 func (sm *SimpleSecurityManager) ValidateWASMModule(module []byte, permissions *core.WASMPermissions) error {
@@ -172,7 +160,12 @@ func main() {
 	flag.Parse()
 
 	// Create logger
-	logger := NewSimpleLogger(*logLevel)
+	logger, err := log.Setup(log.Config{Level: *logLevel, Format: *logFormat, Output: *logOutput})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	defer logger.Close()
 	logger.Info("Starting LIV Permission Management Server", "port", *port, "config_dir", *configDir)
 
 	// Ensure config directory exists
@@ -181,10 +174,25 @@ func main() {
 	}
 
 	// Create security components
-	eventLogger := security.NewFileSecurityEventLogger(filepath.Join(*configDir, "security-events.log"))
-	auditLogger := security.NewFileAuditLogger(filepath.Join(*configDir, "audit.log"))
-	cryptoProvider := &SimpleCryptoProvider{}
-	securityManager := &SimpleSecurityManager{}
+	var eventLogger security.SecurityEventLogger = security.NewFileSecurityEventLogger(filepath.Join(*configDir, "security-events.log"))
+	var auditLogger security.AuditLogger = security.NewFileAuditLogger(filepath.Join(*configDir, "audit.log"))
+	var storage security.Storage
+	if *storageDSN != "" {
+		store, err := sqlstore.Open(*storageDSN)
+		if err != nil {
+			logger.Fatal("Failed to open storage", "error", err)
+		}
+		defer store.Close()
+		storage, eventLogger, auditLogger = store, store, store
+	}
+	// Publish security events as they are logged, for security-admin monitor
+	// and the metrics
+	metrics := telemetry.NewMetrics()
+	eventStream := security.NewEventStream(eventLogger)
+	eventLogger = eventStream
+	go countViolations(eventStream, metrics)
+	cryptoProvider := &timedCryptoProvider{CryptoProvider: security.NewEd25519CryptoProvider(), metrics: metrics}
+	securityManager := &SimpleSecurityManager{crypto: cryptoProvider}
 
 	// Create policy manager
 	config := &security.PolicyManagerConfig{
@@ -196,10 +204,51 @@ func main() {
 		EventLogPath:            filepath.Join(*configDir, "security-events.log"),
 	}
 	policyManager := security.NewPolicyManager(config, eventLogger, auditLogger)
+	if storage != nil {
+		var err error
+		if policyManager, err = security.NewPolicyManagerWithStorage(context.Background(), config, storage); err != nil {
+			logger.Fatal("Failed to load stored policies", "error", err)
+		}
+		policyManager.SetEventLogger(eventLogger)
+	}
+
+	// Create quarantine for documents held under policies enforcing it
+	if *quarantineDir == "" {
+		*quarantineDir = filepath.Join(*configDir, "quarantine")
+	}
+	quarantine, err := security.NewQuarantineManager(*quarantineDir, eventLogger, auditLogger)
+	if err != nil {
+		logger.Fatal("Failed to create quarantine", "error", err)
+	}
+	quarantine.Reviewer = func(r *http.Request) string {
+		if id, ok := auth.FromContext(r.Context()); ok {
+			return id.Username
+		}
+		return ""
+	}
+	policyManager.SetQuarantineManager(quarantine)
 
 	// Create permission manager
 	permissionManager := security.NewPermissionManager(policyManager, securityManager, cryptoProvider, logger)
 
+	// Load the signers trusted to sign documents under policies requiring
+	// signatures
+	if *signersFile == "" {
+		*signersFile = filepath.Join(*configDir, "trusted-signers.json")
+	}
+	if signers, err := security.LoadTrustedSigners(*signersFile); err == nil {
+		for _, signer := range signers {
+			if err := permissionManager.AddTrustedSigner(signer); err != nil {
+				logger.Fatal("Invalid trusted signer", "error", err)
+			}
+		}
+		logger.Info("Trusted signers loaded", "count", len(signers))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logger.Fatal("Failed to load trusted signers", "error", err)
+	} else {
+		logger.Warn("No trusted signers: documents under policies requiring signatures are denied", "file", *signersFile)
+	}
+
 	// Create some sample policies for demonstration
 	if err := createSamplePolicies(policyManager, logger); err != nil {
 		logger.Error("Failed to create sample policies", "error", err)
@@ -208,8 +257,65 @@ func main() {
 	// Create HTTP server
 	mux := http.NewServeMux()
 
-	// Mount permission management UI
-	mux.Handle("/", permissionManager.ServePermissionManagementUI())
+	// Mount permission management UI and APIs. When sign-in is configured,
+	// viewers, auditors and administrators may read policies, auditors and
+	// administrators the audit trail, and only administrators make changes.
+	readers := []string{auth.RoleViewer, auth.RoleAuditor, auth.RoleAdmin}
+	auditors := []string{auth.RoleAuditor, auth.RoleAdmin}
+	ui := permissionManager.ServePermissionManagementUI()
+	policyAPI := security.NewPolicyAPI(policyManager)
+	policyAPI.User = func(r *http.Request) string {
+		if id, ok := auth.FromContext(r.Context()); ok {
+			return id.Username
+		}
+		return ""
+	}
+	auditAPI := security.NewAuditAPI(eventLogger, auditLogger)
+	if *apiToken == "" {
+		*apiToken = os.Getenv("LIV_API_TOKEN")
+	}
+	var unauthenticated http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+	})
+	policyAPIAccess, auditAPIAccess, quarantineAccess, metricsAccess := unauthenticated, unauthenticated, unauthenticated, unauthenticated
+	if *authFile != "" {
+		authenticator, err := auth.LoadAuthenticator(*authFile, "Sign in to LIV Permission Management")
+		if err != nil {
+			logger.Fatal("Failed to configure authentication", "error", err)
+		}
+		mux.Handle(auth.PathPrefix, authenticator)
+		ui = byAccess(authenticator.Require(ui, readers...), authenticator.Require(ui, auth.RoleAdmin))
+		quarantineAccess = authenticator.Require(quarantine, auth.RoleAdmin)
+		policyAPIAccess = byAccess(authenticator.RequireAPI(policyAPI, readers...), authenticator.RequireAPI(policyAPI, auth.RoleAdmin))
+		auditAPIAccess = authenticator.RequireAPI(auditAPI, auditors...)
+		metricsAccess = authenticator.RequireAPI(metrics, auditors...)
+		logger.Info("Sign-in required", "read", readers, "audit", auditors, "change", auth.RoleAdmin)
+		if authenticator.Provisioning != nil {
+			mux.Handle(scim.PathPrefix, authenticator.Provisioning)
+			logger.Info("SCIM provisioning enabled", "path", scim.PathPrefix)
+		}
+	}
+	mux.Handle("/", ui)
+
+	// Mount the policy, audit and quarantine APIs and the Prometheus metrics
+	// for programs bearing the API token or, when sign-in is configured,
+	// users' credentials
+	if *apiToken != "" || *authFile != "" {
+		mux.Handle(security.QuarantinePathPrefix, requireToken(*apiToken, quarantine, quarantineAccess))
+		logger.Info("API enabled", "path", security.QuarantinePathPrefix)
+		for prefix, handler := range map[string]http.Handler{
+			security.PolicyAPIPathPrefix: requireToken(*apiToken, policyAPI, policyAPIAccess),
+			security.AuditAPIPathPrefix:  requireToken(*apiToken, auditAPI, auditAPIAccess),
+		} {
+			mux.Handle(prefix, handler)
+			mux.Handle(prefix+"/", handler)
+			logger.Info("API enabled", "path", prefix)
+		}
+		mux.Handle("/metrics", requireToken(*apiToken, metrics, metricsAccess))
+		logger.Info("Metrics enabled", "path", "/metrics")
+	} else {
+		logger.Warn("Policy, audit and quarantine APIs and metrics disabled: set -api-token or -auth-config to enable them")
+	}
 
 	// Add health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -268,8 +374,44 @@ func main() {
 	}
 }
 
+// createSamplePolicy creates a sample policy unless the storage already
+// holds it from an earlier run or another server
+func createSamplePolicy(ctx context.Context, pm *security.PolicyManager, policy *security.SystemSecurityPolicy) error {
+	if _, err := pm.GetPolicy(ctx, policy.ID); err == nil {
+		return nil
+	}
+	return pm.CreatePolicy(ctx, policy, "system")
+}
+
+// requireToken serves next to requests bearing token as an Authorization
+// bearer token, as the administrator "api", and hands the others to
+// otherwise
+func requireToken(token string, next, otherwise http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && ok && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+			id := &auth.Identity{Username: "api", Provider: "api-token", Roles: []string{auth.RoleAdmin}}
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+			return
+		}
+		otherwise.ServeHTTP(w, r)
+	})
+}
+
+// byAccess serves requests that only read with read and the others with
+// write. Permission evaluation is posted but changes nothing.
+func byAccess(read, write http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.URL.Path == "/api/permissions/evaluate" {
+			read.ServeHTTP(w, r)
+			return
+		}
+		write.ServeHTTP(w, r)
+	})
+}
+
 // createSamplePolicies creates sample security policies for demonstration
-func createSamplePolicies(pm *security.PolicyManager, logger *SimpleLogger) error {
+func createSamplePolicies(pm *security.PolicyManager, logger *log.Logger) error {
 	ctx := context.Background()
 
 	// Create basic security policy
@@ -334,7 +476,7 @@ func createSamplePolicies(pm *security.PolicyManager, logger *SimpleLogger) erro
 		},
 	}
 
-	if err := pm.CreatePolicy(ctx, basicPolicy, "system"); err != nil {
+	if err := createSamplePolicy(ctx, pm, basicPolicy); err != nil {
 		return fmt.Errorf("failed to create basic policy: %w", err)
 	}
 
@@ -401,7 +543,7 @@ func createSamplePolicies(pm *security.PolicyManager, logger *SimpleLogger) erro
 		},
 	}
 
-	if err := pm.CreatePolicy(ctx, highSecurityPolicy, "system"); err != nil {
+	if err := createSamplePolicy(ctx, pm, highSecurityPolicy); err != nil {
 		return fmt.Errorf("failed to create high security policy: %w", err)
 	}
 
@@ -467,7 +609,7 @@ func createSamplePolicies(pm *security.PolicyManager, logger *SimpleLogger) erro
 		},
 	}
 
-	if err := pm.CreatePolicy(ctx, interactivePolicy, "system"); err != nil {
+	if err := createSamplePolicy(ctx, pm, interactivePolicy); err != nil {
 		return fmt.Errorf("failed to create interactive policy: %w", err)
 	}
 
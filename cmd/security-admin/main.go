@@ -4,14 +4,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/liv-format/liv/pkg/auth"
 	"github.com/liv-format/liv/pkg/core"
 	"github.com/liv-format/liv/pkg/security"
 	"github.com/spf13/cobra"
@@ -22,6 +27,19 @@ var (
 	policyID     string
 	templateID   string
 	outputFormat string
+	auditUser    string
+
+	accountsPath string
+	userRoles    []string
+	userName     string
+	userEmail    string
+	userDisabled bool
+
+	monitorServer     string
+	monitorToken      string
+	monitorTypes      []string
+	monitorSeverities []string
+	monitorSince      time.Duration
 )
 
 func main() {
@@ -34,6 +52,7 @@ func main() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "./security-config", "Security configuration directory")
 	rootCmd.PersistentFlags().StringVar(&outputFormat, "format", "json", "Output format (json, yaml, table)")
+	rootCmd.PersistentFlags().StringVar(&auditUser, "user", currentUser(), "User recorded in the audit trail for changes")
 
 	// Add subcommands
 	rootCmd.AddCommand(createPolicyCmd())
@@ -41,6 +60,7 @@ func main() {
 	rootCmd.AddCommand(validateSystemCmd())
 	rootCmd.AddCommand(monitorCmd())
 	rootCmd.AddCommand(metricsCmd())
+	rootCmd.AddCommand(userCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
@@ -78,11 +98,22 @@ func validateSystemCmd() *cobra.Command {
 }
 
 func monitorCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "monitor",
 		Short: "Monitor system security in real-time",
-		RunE:  monitorSystem,
+		Long: `Monitor subscribes to the security event stream of a permission server and
+prints security events as they are logged. The server's API token or, with
+-auth-config, an auditor's credentials are needed.`,
+		RunE: monitorSystem,
 	}
+
+	cmd.Flags().StringVar(&monitorServer, "server", "http://localhost:8080", "Permission server URL")
+	cmd.Flags().StringVar(&monitorToken, "token", "", "API token of the permission server (default $LIV_API_TOKEN)")
+	cmd.Flags().StringSliceVar(&monitorTypes, "type", nil, "Only show events of these types")
+	cmd.Flags().StringSliceVar(&monitorSeverities, "severity", nil, "Only show events of these severities (low, medium, high, critical)")
+	cmd.Flags().DurationVar(&monitorSince, "since", 0, "Show the events logged this long ago first")
+
+	return cmd
 }
 
 func metricsCmd() *cobra.Command {
@@ -93,6 +124,160 @@ func metricsCmd() *cobra.Command {
 	}
 }
 
+func userCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage local accounts for permission server sign-in",
+	}
+	cmd.PersistentFlags().StringVar(&accountsPath, "accounts", "", "Local accounts file (default <config-dir>/users.json)")
+
+	set := &cobra.Command{
+		Use:   "set [username]",
+		Short: "Add a local account or change it; a new password is read from standard input",
+		Args:  cobra.ExactArgs(1),
+		RunE:  setUser,
+	}
+	set.Flags().StringSliceVar(&userRoles, "role", nil, "Roles to grant (viewer, auditor, admin); replaces the account's roles")
+	set.Flags().StringVar(&userName, "name", "", "Display name")
+	set.Flags().StringVar(&userEmail, "email", "", "Email address")
+	set.Flags().BoolVar(&userDisabled, "disabled", false, "Disable the account")
+
+	cmd.AddCommand(set)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove [username]",
+		Short: "Remove a local account",
+		Args:  cobra.ExactArgs(1),
+		RunE:  removeUser,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List local accounts",
+		RunE:  listUsers,
+	})
+	return cmd
+}
+
+// currentUser names the operating system user for the audit trail
+func currentUser() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return "admin"
+}
+
+func localAccountsPath() string {
+	if accountsPath != "" {
+		return accountsPath
+	}
+	return filepath.Join(configDir, "users.json")
+}
+
+func setUser(cmd *cobra.Command, args []string) error {
+	path := localAccountsPath()
+	accounts, err := auth.ReadLocalAccounts(path)
+	if err != nil {
+		return err
+	}
+	for _, role := range userRoles {
+		switch role {
+		case auth.RoleViewer, auth.RoleAuditor, auth.RoleAdmin, auth.RoleReader, auth.RoleAuthor:
+		default:
+			return fmt.Errorf("unknown role %q", role)
+		}
+	}
+
+	fmt.Fprint(os.Stderr, "Password (empty keeps the current one): ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	account := accounts.Lookup(args[0])
+	switch {
+	case password != "":
+		if account, err = accounts.SetPassword(args[0], password); err != nil {
+			return err
+		}
+	case account == nil:
+		return fmt.Errorf("a new account needs a password")
+	}
+	if cmd.Flags().Changed("role") {
+		account.Roles = userRoles
+	}
+	if cmd.Flags().Changed("name") {
+		account.Name = userName
+	}
+	if cmd.Flags().Changed("email") {
+		account.Email = userEmail
+	}
+	account.Disabled = userDisabled
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := accounts.Write(path); err != nil {
+		return err
+	}
+	fmt.Printf("Saved account '%s' with roles %s\n", account.Username, strings.Join(account.Roles, ", "))
+	return nil
+}
+
+func removeUser(cmd *cobra.Command, args []string) error {
+	path := localAccountsPath()
+	accounts, err := auth.ReadLocalAccounts(path)
+	if err != nil {
+		return err
+	}
+	if !accounts.Remove(args[0]) {
+		return fmt.Errorf("no account '%s' in %s", args[0], path)
+	}
+	if err := accounts.Write(path); err != nil {
+		return err
+	}
+	fmt.Printf("Removed account '%s'\n", args[0])
+	return nil
+}
+
+func listUsers(cmd *cobra.Command, args []string) error {
+	accounts, err := auth.ReadLocalAccounts(localAccountsPath())
+	if err != nil {
+		return err
+	}
+	// Password hashes are never shown
+	type listedAccount struct {
+		Username string   `json:"username"`
+		Name     string   `json:"name,omitempty"`
+		Email    string   `json:"email,omitempty"`
+		Groups   []string `json:"groups,omitempty"`
+		Roles    []string `json:"roles"`
+		Disabled bool     `json:"disabled,omitempty"`
+	}
+	listed := make([]listedAccount, 0, len(accounts.Users))
+	for _, account := range accounts.Users {
+		listed = append(listed, listedAccount{account.Username, account.Name, account.Email, account.Groups, account.Roles, account.Disabled})
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(listed, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal accounts: %w", err)
+		}
+		fmt.Println(string(data))
+	default:
+		fmt.Printf("Found %d accounts:\n\n", len(listed))
+		for _, account := range listed {
+			status := ""
+			if account.Disabled {
+				status = " (disabled)"
+			}
+			fmt.Printf("%s%s: %s\n", account.Username, status, strings.Join(account.Roles, ", "))
+		}
+	}
+	return nil
+}
+
 func createPolicyManager() (*security.PolicyManager, error) {
 	// Ensure config directory exists
 	if err := os.MkdirAll(configDir, 0755); err != nil {
@@ -135,7 +320,7 @@ func createPolicy(cmd *cobra.Command, args []string) error {
 			"require_signature": true,
 		}
 
-		err = pm.CreatePolicyFromTemplate(ctx, templateID, policyID, variables, "admin")
+		err = pm.CreatePolicyFromTemplate(ctx, templateID, policyID, variables, auditUser)
 		if err != nil {
 			return fmt.Errorf("failed to create policy from template: %w", err)
 		}
@@ -148,7 +333,7 @@ func createPolicy(cmd *cobra.Command, args []string) error {
 			policy.ParentPolicy = policyID
 		}
 
-		err = pm.CreatePolicy(ctx, policy, "admin")
+		err = pm.CreatePolicy(ctx, policy, auditUser)
 		if err != nil {
 			return fmt.Errorf("failed to create policy: %w", err)
 		}
@@ -247,51 +432,6 @@ func validateSystem(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func monitorSystem(cmd *cobra.Command, args []string) error {
-	pm, err := createPolicyManager()
-	if err != nil {
-		return fmt.Errorf("failed to create policy manager: %w", err)
-	}
-
-	ctx := context.Background()
-	fmt.Println("Starting security monitoring... (Press Ctrl+C to stop)")
-
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
-			// Simulate resource metrics (in real implementation, these would come from actual monitoring)
-			resourceMetrics := &security.ResourceMetrics{
-				MemoryUsage:         50 * 1024 * 1024, // 50MB
-				CPUTime:             2000,             // 2 seconds
-				ConcurrentDocuments: 3,
-				NetworkBandwidth:    512 * 1024,       // 512KB/s
-				StorageUsage:        25 * 1024 * 1024, // 25MB
-			}
-
-			report, err := pm.MonitorResourceUsage(ctx, resourceMetrics)
-			if err != nil {
-				fmt.Printf("Monitoring error: %v\n", err)
-				continue
-			}
-
-			fmt.Printf("[%s] Status: %s", time.Now().Format("15:04:05"), report.OverallStatus)
-			if len(report.Violations) > 0 {
-				fmt.Printf(" - %d violations detected", len(report.Violations))
-			}
-			fmt.Println()
-
-			for _, violation := range report.Violations {
-				fmt.Printf("  VIOLATION: %s (Policy: %s)\n", violation.Description, violation.PolicyID)
-			}
-		}
-	}
-}
-
 func showMetrics(cmd *cobra.Command, args []string) error {
 	pm, err := createPolicyManager()
 	if err != nil {
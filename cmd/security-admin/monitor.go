@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/liv-format/liv/pkg/security"
+	"github.com/spf13/cobra"
+)
+
+// maxReconnectDelay caps the wait between attempts to reconnect to the
+// event stream
+const maxReconnectDelay = 30 * time.Second
+
+// errStreamRefused is returned when the server will not stream events, and
+// reconnecting would not help
+var errStreamRefused = errors.New("event stream refused")
+
+// eventCursor remembers the last events seen, so a reconnected stream
+// replays from them without repeating them
+type eventCursor struct {
+	since time.Time
+	seen  map[string]bool
+}
+
+func (c *eventCursor) advance(event *security.SecurityEvent) bool {
+	if event.ID != "" && c.seen[event.ID] && !event.Timestamp.After(c.since) {
+		return false
+	}
+	if event.Timestamp.After(c.since) {
+		c.since = event.Timestamp
+		c.seen = make(map[string]bool)
+	}
+	c.seen[event.ID] = true
+	return true
+}
+
+func monitorSystem(cmd *cobra.Command, args []string) error {
+	if monitorToken == "" {
+		monitorToken = os.Getenv("LIV_API_TOKEN")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cursor := &eventCursor{seen: make(map[string]bool)}
+	if monitorSince > 0 {
+		cursor.since = time.Now().Add(-monitorSince)
+	}
+	fmt.Fprintf(os.Stderr, "Monitoring security events from %s... (Press Ctrl+C to stop)\n", monitorServer)
+
+	delay := time.Second
+	for {
+		connected, err := streamSecurityEvents(ctx, cursor)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, errStreamRefused) {
+			return err
+		}
+		if connected {
+			delay = time.Second
+		}
+		fmt.Fprintf(os.Stderr, "Event stream interrupted: %v; reconnecting in %s\n", err, delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+// streamSecurityEvents prints the events of the server's event stream until
+// it ends, and reports whether it connected
+func streamSecurityEvents(ctx context.Context, cursor *eventCursor) (bool, error) {
+	query := url.Values{"type": monitorTypes, "severity": monitorSeverities}
+	if !cursor.since.IsZero() {
+		query.Set("since", cursor.since.Format(time.RFC3339Nano))
+	}
+	endpoint := strings.TrimRight(monitorServer, "/") + security.AuditAPIPathPrefix + "/events/stream?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", errStreamRefused, err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if monitorToken != "" {
+		req.Header.Set("Authorization", "Bearer "+monitorToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return false, fmt.Errorf("%w: %s; pass the server's API token with --token or $LIV_API_TOKEN", errStreamRefused, resp.Status)
+	case resp.StatusCode == http.StatusNotFound:
+		return false, fmt.Errorf("%w: the server does not stream security events or its audit API is disabled", errStreamRefused)
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	err = readServerSentEvents(resp.Body, func(name, data string) {
+		switch name {
+		case "security":
+			var event security.SecurityEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				fmt.Fprintf(os.Stderr, "Unreadable event: %v\n", err)
+				return
+			}
+			if cursor.advance(&event) {
+				printSecurityEvent(&event, data)
+			}
+		case "dropped":
+			fmt.Fprintf(os.Stderr, "Warning: %s events were missed while the monitor fell behind\n", data)
+		case "error":
+			fmt.Fprintf(os.Stderr, "Server error: %s\n", data)
+		}
+	})
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return true, err
+}
+
+// readServerSentEvents calls dispatch with the name and data of each event
+// of a server-sent event stream until it ends
+func readServerSentEvents(r io.Reader, dispatch func(name, data string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	name := ""
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				if name == "" {
+					name = "message"
+				}
+				dispatch(name, strings.Join(data, "\n"))
+			}
+			name, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			name = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	return scanner.Err()
+}
+
+// printSecurityEvent prints an event as a line of JSON or of text
+func printSecurityEvent(event *security.SecurityEvent, data string) {
+	if outputFormat == "json" {
+		fmt.Println(data)
+		return
+	}
+	fmt.Printf("[%s] %-8s %-22s %s", event.Timestamp.Local().Format("15:04:05"), strings.ToUpper(string(event.Severity)), event.EventType, event.Description)
+	var context []string
+	for _, field := range [][2]string{{"policy", event.PolicyID}, {"user", event.UserID}, {"target", event.Target}} {
+		if field[1] != "" {
+			context = append(context, field[0]+": "+field[1])
+		}
+	}
+	if len(context) > 0 {
+		fmt.Printf(" (%s)", strings.Join(context, ", "))
+	}
+	fmt.Println()
+}
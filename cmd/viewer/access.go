@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/access"
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// accessClockSkew is how far the reader's access window is stretched for
+// clocks that run behind or ahead of the signer's
+const accessClockSkew = 5 * time.Minute
+
+// accessCounter counts opens of documents with an access policy and grants
+// their content; nil serves no such document
+var accessCounter *access.Counter
+
+// accessResponse is the response to opening a document with an access policy
+type accessResponse struct {
+	Watermark string     `json:"watermark,omitempty"`
+	Opens     int        `json:"opens"`
+	MaxOpens  int        `json:"max_opens,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+}
+
+// accessDeniedResponse explains why a document does not open
+type accessDeniedResponse struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+// handleAccess opens an uploaded document, or the served document when no id
+// is given, under its access policy: POST /api/access?id=... checks the dates
+// of the policy, counts the open against the reader's limit and grants the
+// reader the document's content. Documents without a policy answer 204.
+func handleAccess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m, err := readDocumentManifest(r.URL.Query().Get("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		}
+		return
+	}
+	if m.Access == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if accessCounter == nil {
+		writeAccessDenied(w, errors.New("this viewer cannot open documents with an access policy"))
+		return
+	}
+
+	now := time.Now()
+	if err := access.Check(m.Access, now, accessClockSkew); err != nil {
+		writeAccessDenied(w, err)
+		return
+	}
+	key, err := access.DocumentKey(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reader, name := accessReaderOf(r)
+	opens, err := accessCounter.Open(key, reader, m.Access, now)
+	if err != nil {
+		if errors.Is(err, access.ErrOpenLimit) {
+			writeAccessDenied(w, err)
+		} else {
+			log.ErrorContext(r.Context(), "Failed to count document open", "error", err)
+			http.Error(w, "Failed to open document", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.InfoContext(r.Context(), "Document opened under access policy", "reader", reader, "opens", opens, "max_opens", m.Access.MaxOpens)
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeViewingJSON(w, http.StatusOK, accessResponse{
+		Watermark: access.Watermark(m.Access, name, now),
+		Opens:     opens,
+		MaxOpens:  m.Access.MaxOpens,
+		NotAfter:  m.Access.NotAfter,
+	})
+}
+
+// requireAccess serves the content of documents with an access policy only
+// within the dates of the policy and to readers who opened them through
+// /api/access, so the policy cannot be bypassed by fetching content directly
+func requireAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authorizeAccess(w, r, accessDocumentID(r)) {
+			next(w, r)
+		}
+	}
+}
+
+// authorizeAccess reports whether the reader of r may have the content of a
+// document, answering the request when they may not. Documents that do not
+// exist are left to the caller to report, but a document whose manifest
+// cannot be read is refused, as its policy cannot be checked.
+func authorizeAccess(w http.ResponseWriter, r *http.Request, id string) bool {
+	m, err := readDocumentManifest(id)
+	switch {
+	case errors.Is(err, store.ErrNotFound) || errors.Is(err, os.ErrNotExist):
+		return true
+	case err != nil:
+		log.ErrorContext(r.Context(), "Failed to read document access policy", log.DocumentID, id, "error", err)
+		http.Error(w, "Failed to read the document's access policy", http.StatusUnprocessableEntity)
+		return false
+	case m.Access == nil:
+		return true
+	}
+
+	now := time.Now()
+	if err := access.Check(m.Access, now, accessClockSkew); err != nil {
+		writeAccessDenied(w, err)
+		return false
+	}
+	key, err := access.DocumentKey(m)
+	reader, _ := accessReaderOf(r)
+	if err != nil || accessCounter == nil || !accessCounter.Granted(key, reader, now) {
+		http.Error(w, "Open the document in the viewer first", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// accessDocumentID returns the id of the uploaded document a content request
+// is for, or "" for the served document
+func accessDocumentID(r *http.Request) string {
+	if id := r.URL.Query().Get("id"); id != "" {
+		return id
+	}
+	for _, prefix := range []string{"/api/content/", "/api/data/", documentResourcePrefix} {
+		if rest, ok := strings.CutPrefix(r.URL.Path, prefix); ok {
+			id, _, _ := strings.Cut(rest, "/")
+			return id
+		}
+	}
+	return ""
+}
+
+// accessReaderOf identifies who opens are counted against, like viewerOf, and
+// the name their watermark shows
+func accessReaderOf(r *http.Request) (reader, name string) {
+	user, ip := viewerOf(r)
+	if user == "" {
+		return "ip:" + ip, ip
+	}
+	name = user
+	if id, ok := auth.FromContext(r.Context()); ok && id.Name != "" {
+		name = id.Name
+	}
+	return "user:" + user, name
+}
+
+func writeAccessDenied(w http.ResponseWriter, err error) {
+	reason := "unavailable"
+	switch {
+	case errors.Is(err, access.ErrNotYetValid):
+		reason = "not_yet_valid"
+	case errors.Is(err, access.ErrExpired):
+		reason = "expired"
+	case errors.Is(err, access.ErrOpenLimit):
+		reason = "open_limit"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeViewingJSON(w, http.StatusForbidden, accessDeniedResponse{Error: err.Error(), Reason: reason})
+}
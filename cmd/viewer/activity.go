@@ -0,0 +1,75 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+)
+
+const (
+	// interactiveSpecEntry holds the interactive spec of a package
+	interactiveSpecEntry = "content/interactive.json"
+
+	// activityRuntimePath is the script that pauses document content when
+	// the viewer reports it hidden or the device low on battery
+	activityRuntimePath = "/static/js/liv-runtime.js"
+)
+
+var (
+	headTag = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+	htmlTag = regexp.MustCompile(`(?i)<html(\s[^>]*)?>`)
+)
+
+// readActivitySpec returns the activity section of a package's interactive
+// spec. An invalid section is ignored, so everything pauses.
+func readActivitySpec(reader *zip.Reader) *core.ActivitySpec {
+	data, err := readZipEntry(reader, interactiveSpecEntry)
+	if err != nil {
+		return &core.ActivitySpec{}
+	}
+	spec, err := core.ParseActivitySpec(data)
+	if err != nil {
+		log.Warn("Ignoring activity section", "error", err)
+		return &core.ActivitySpec{}
+	}
+	return spec
+}
+
+// injectActivityRuntime loads the activity runtime first in a page's head,
+// so it wraps the timers before the document's own scripts use them
+func injectActivityRuntime(page []byte) []byte {
+	return injectIntoHead(page, `<script src="`+activityRuntimePath+`"></script>`)
+}
+
+// injectPrintStylesheet links a document's print stylesheet from a page that
+// does not link it itself
+func injectPrintStylesheet(page []byte, href string) []byte {
+	if bytes.Contains(page, []byte(path.Base(href))) {
+		return page
+	}
+	return injectIntoHead(page, `<link rel="stylesheet" media="print" href="`+html.EscapeString(href)+`">`)
+}
+
+// injectIntoHead inserts markup first in a page's head
+func injectIntoHead(page []byte, markup string) []byte {
+	for _, tag := range []*regexp.Regexp{headTag, htmlTag} {
+		if loc := tag.FindIndex(page); loc != nil {
+			injected := make([]byte, 0, len(page)+len(markup))
+			injected = append(injected, page[:loc[1]]...)
+			injected = append(injected, markup...)
+			return append(injected, page[loc[1]:]...)
+		}
+	}
+	return append([]byte(markup), page...)
+}
+
+// runsScripts reports whether content under policy may run scripts
+func runsScripts(policy *contentPolicy) bool {
+	return strings.Contains(policy.Sandbox, "allow-scripts")
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/annotations"
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/liv-format/liv/pkg/verification"
+)
+
+// annotationsPath is the API for the annotations of uploaded documents
+const annotationsPath = "/api/annotations"
+
+// maxAnnotationSize is the largest annotation, or sidecar to embed, accepted
+const maxAnnotationSize = 4 << 20
+
+// annotationStore keeps the annotations readers make on uploaded documents;
+// nil keeps them in the browser only
+var annotationStore *annotations.Store
+
+// annotationKey signs the revisions annotations are embedded in; nil leaves
+// them unsigned
+var annotationKey crypto.Signer
+
+// annotationsResponse lists the annotations of a document
+type annotationsResponse struct {
+	Annotations []*annotations.Annotation `json:"annotations"`
+	// Embedded are the annotations the package itself holds
+	Embedded []*annotations.Annotation `json:"embedded"`
+	// SignsRevisions reports whether embedding signs the new revision
+	SignsRevisions bool `json:"signs_revisions"`
+}
+
+// handleAnnotations serves the annotations of an uploaded document, given
+// by the id parameter:
+//
+//	GET    /api/annotations          lists them
+//	POST   /api/annotations          adds one
+//	PUT    /api/annotations/{id}     changes one of the reader's own
+//	DELETE /api/annotations/{id}     removes one of the reader's own
+//	GET    /api/annotations/export   downloads them as a sidecar file
+//	POST   /api/annotations/embed    stores a new revision of the document
+//	                                 holding them, or the sidecar posted
+func handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if documentStore == nil {
+		http.Error(w, "Document storage not available", http.StatusServiceUnavailable)
+		return
+	}
+	document := r.URL.Query().Get("id")
+	if !store.ValidID(document) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	switch rest := strings.Trim(strings.TrimPrefix(r.URL.Path, annotationsPath), "/"); {
+	case rest == "embed":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		embedAnnotations(w, r, document)
+	case annotationStore == nil:
+		http.Error(w, "Annotation storage not available", http.StatusServiceUnavailable)
+	case rest == "export":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		exportAnnotations(w, r, document)
+	case rest == "":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			listAnnotations(w, r, document)
+		case http.MethodPost:
+			addAnnotation(w, r, document)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		changeAnnotation(w, r, document, rest)
+	}
+}
+
+func listAnnotations(w http.ResponseWriter, r *http.Request, document string) {
+	doc, reader, err := openStoredPackage(document)
+	if err != nil {
+		annotationError(w, err)
+		return
+	}
+	defer doc.Close()
+
+	response := annotationsResponse{Embedded: []*annotations.Annotation{}, SignsRevisions: annotationKey != nil}
+	if data, err := readZipEntry(reader, annotations.EntryPath); err == nil {
+		if sidecar, err := annotations.ParseSidecar(data); err == nil {
+			response.Embedded = sidecar.Annotations
+		} else {
+			log.WarnContext(r.Context(), "Ignoring embedded annotations", log.DocumentID, document, "error", err)
+		}
+	}
+	if response.Annotations, err = annotationStore.List(document); err != nil {
+		annotationError(w, err)
+		return
+	}
+	writeAnnotationJSON(w, http.StatusOK, response)
+}
+
+func addAnnotation(w http.ResponseWriter, r *http.Request, document string) {
+	if _, err := documentStore.Stat(document); err != nil {
+		annotationError(w, err)
+		return
+	}
+	var a annotations.Annotation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnotationSize)).Decode(&a); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid annotation: %v", err), http.StatusBadRequest)
+		return
+	}
+	a.Author = ""
+	if id, ok := auth.FromContext(r.Context()); ok {
+		a.Author = id.Username
+	}
+	added, err := annotationStore.Add(document, &a)
+	if err != nil {
+		annotationError(w, err)
+		return
+	}
+	writeAnnotationJSON(w, http.StatusCreated, added)
+}
+
+// changeAnnotation updates or removes an annotation. Signed-in readers may
+// only change their own; annotations made anonymously may be changed by
+// anyone who may view the document.
+func changeAnnotation(w http.ResponseWriter, r *http.Request, document, id string) {
+	existing, err := annotationStore.Get(document, id)
+	if err != nil {
+		annotationError(w, err)
+		return
+	}
+	if existing.Author != "" {
+		if reader, ok := auth.FromContext(r.Context()); !ok || reader.Username != existing.Author {
+			http.Error(w, "Only the author of an annotation may change it", http.StatusForbidden)
+			return
+		}
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := annotationStore.Delete(document, id); err != nil {
+			annotationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var a annotations.Annotation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnotationSize)).Decode(&a); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid annotation: %v", err), http.StatusBadRequest)
+		return
+	}
+	a.ID = id
+	updated, err := annotationStore.Update(document, &a)
+	if err != nil {
+		annotationError(w, err)
+		return
+	}
+	writeAnnotationJSON(w, http.StatusOK, updated)
+}
+
+func exportAnnotations(w http.ResponseWriter, r *http.Request, document string) {
+	doc, reader, err := openStoredPackage(document)
+	if err != nil {
+		annotationError(w, err)
+		return
+	}
+	defer doc.Close()
+	list, err := annotationStore.List(document)
+	if err != nil {
+		annotationError(w, err)
+		return
+	}
+
+	data, err := json.MarshalIndent(annotations.NewSidecar(annotatedDocument(doc, reader), list, time.Now()), "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to export annotations", http.StatusInternalServerError)
+		return
+	}
+	name := strings.TrimSuffix(doc.Info().Filename, ".liv")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachmentFilename(name, "document", annotations.SidecarExtension)}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// embedAnnotations stores a new revision of a document holding its stored
+// annotations, or those of a sidecar posted from the browser, signed with
+// --annotation-key when it is set. The response is that of /api/upload.
+func embedAnnotations(w http.ResponseWriter, r *http.Request, document string) {
+	doc, reader, err := openStoredPackage(document)
+	if err != nil {
+		annotationError(w, err)
+		return
+	}
+	defer doc.Close()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAnnotationSize))
+	if err != nil {
+		http.Error(w, "Annotations too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var sidecar *annotations.Sidecar
+	if len(bytes.TrimSpace(body)) > 0 {
+		if sidecar, err = annotations.ParseSidecar(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if annotationStore != nil {
+		list, err := annotationStore.List(document)
+		if err != nil {
+			annotationError(w, err)
+			return
+		}
+		sidecar = annotations.NewSidecar(annotatedDocument(doc, reader), list, time.Now())
+	} else {
+		http.Error(w, "No annotations to embed", http.StatusBadRequest)
+		return
+	}
+
+	files, err := container.NewZIPContainer().ExtractFromReaderToMemory(doc, doc.Info().Size)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid LIV document: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	opts := annotations.EmbedOptions{Key: annotationKey, Signer: core.SignerInfo{Name: "LIV Viewer", Role: "annotations"}}
+	if id, ok := auth.FromContext(r.Context()); ok {
+		opts.Signer.Name, opts.Signer.Email = id.Name, id.Email
+		if opts.Signer.Name == "" {
+			opts.Signer.Name = id.Username
+		}
+	}
+	if err := annotations.Embed(files, sidecar, opts); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to embed annotations: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := verification.Refresh(files); err != nil {
+		http.Error(w, "Failed to embed annotations", http.StatusInternalServerError)
+		return
+	}
+
+	var revision bytes.Buffer
+	if err := container.NewZIPContainer().CreateFromFilesToWriter(files, &revision); err != nil {
+		log.ErrorContext(r.Context(), "Failed to package annotated revision", log.DocumentID, document, "error", err)
+		http.Error(w, "Failed to embed annotations", http.StatusInternalServerError)
+		return
+	}
+	storeUpload(w, r, doc.Info().Filename, &revision)
+}
+
+// annotatedDocument identifies an uploaded document in the sidecars of its
+// annotations
+func annotatedDocument(doc store.Document, reader *zip.Reader) annotations.DocumentRef {
+	info := doc.Info()
+	ref := annotations.DocumentRef{Filename: info.Filename, SHA256: info.SHA256}
+	if m, err := readStoredManifest(reader); err == nil && m.Metadata != nil {
+		ref.Title = m.Metadata.Title
+	}
+	return ref
+}
+
+// annotationError reports a failed annotation request with the status
+// matching err
+func annotationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Document not found", http.StatusNotFound)
+	case errors.Is(err, annotations.ErrNotFound):
+		http.Error(w, "Annotation not found", http.StatusNotFound)
+	case errors.Is(err, annotations.ErrTooMany):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	}
+}
+
+func writeAnnotationJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
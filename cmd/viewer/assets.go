@@ -0,0 +1,20 @@
+package main
+
+import (
+	"embed"
+)
+
+// staticAssets holds viewer scripts and modules served under /static/.
+// WASM modules are generated by `make build-viewer-assets`.
+//
+//go:embed static
+var staticAssets embed.FS
+
+// readStaticAsset returns an embedded static asset if it exists
+func readStaticAsset(path string) ([]byte, bool) {
+	data, err := staticAssets.ReadFile("static/" + path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
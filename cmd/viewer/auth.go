@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/scim"
+)
+
+// authenticator signs users in to the library; nil when authentication is
+// disabled
+var authenticator *auth.Authenticator
+
+// protectLibrary requires signed-in users for the library. Readers may view
+// documents, authors may also upload them. The health pages, viewing and
+// job metrics and Prometheus metrics keep their own token check and additionally admit administrators. The SCIM endpoint, when
+// configured, authenticates identity providers with its own bearer token.
+func protectLibrary(a *auth.Authenticator, next http.Handler) http.Handler {
+	readers := a.Require(next, auth.RoleReader, auth.RoleAuthor, auth.RoleAdmin)
+	authors := a.Require(next, auth.RoleAuthor, auth.RoleAdmin)
+	public := a.Attach(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case strings.HasPrefix(path, auth.PathPrefix):
+			a.ServeHTTP(w, r)
+		case a.Provisioning != nil && strings.HasPrefix(path, scim.PathPrefix):
+			a.Provisioning.ServeHTTP(w, r)
+		case path == "/health" || path == "/api/health" || path == "/api/viewing/metrics" || path == "/api/jobs/metrics" || path == "/metrics" || path == "/sw.js" || path == "/manifest.json" || strings.HasPrefix(path, "/static/"):
+			public.ServeHTTP(w, r)
+		case path == "/api/upload" || path == "/api/patch" || path == annotationsPath+"/embed" || path == uploadsPath || strings.HasPrefix(path, uploadsPath+"/"):
+			authors.ServeHTTP(w, r)
+		default:
+			readers.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/liv-format/liv/pkg/vcard"
+)
+
+// documentAuthor is an author in the metadata of a document that lists its
+// authors
+type documentAuthor struct {
+	*core.AuthorInfo
+	ORCIDURL string `json:"orcid_url,omitempty"`
+	// VCardURL exports the author's contact card
+	VCardURL string `json:"vcard_url"`
+}
+
+// newDocumentAuthors returns the authors a document lists, with where to
+// export their contact cards
+func newDocumentAuthors(id string, metadata *core.DocumentMetadata) []documentAuthor {
+	var authors []documentAuthor
+	for i, author := range metadata.Authors {
+		if author == nil {
+			continue
+		}
+		authors = append(authors, documentAuthor{
+			AuthorInfo: author,
+			ORCIDURL:   author.ORCIDURL(),
+			VCardURL:   "/api/authors?" + url.Values{"id": {id}, "author": {strconv.Itoa(i)}}.Encode(),
+		})
+	}
+	return authors
+}
+
+// handleAuthors exports the authors of an uploaded document, or of the
+// served document when no id is given, as vCard contact cards. The author
+// parameter exports the author at that position in the manifest.
+func handleAuthors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		reader *zip.Reader
+		err    error
+	)
+	if id := r.URL.Query().Get("id"); id != "" {
+		var doc store.Document
+		doc, reader, err = openStoredPackage(id)
+		if err == nil {
+			defer doc.Close()
+		}
+	} else if servedDocument != "" {
+		var served *zip.ReadCloser
+		served, err = zip.OpenReader(servedDocument)
+		if err == nil {
+			defer served.Close()
+			reader = &served.Reader
+		}
+	} else {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Invalid LIV document: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid document manifest: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	var listed []*core.AuthorInfo
+	if m.Metadata != nil {
+		listed = m.Metadata.Authors
+	}
+	var authors []*core.AuthorInfo
+	name := ""
+	if position := r.URL.Query().Get("author"); position != "" {
+		i, err := strconv.Atoi(position)
+		if err != nil || i < 0 || i >= len(listed) || listed[i] == nil {
+			http.Error(w, "Document has no such author", http.StatusNotFound)
+			return
+		}
+		authors = listed[i : i+1]
+		name = listed[i].Name
+	} else {
+		for _, author := range listed {
+			if author != nil {
+				authors = append(authors, author)
+			}
+		}
+	}
+	if len(authors) == 0 {
+		http.Error(w, "Document lists no authors", http.StatusNotFound)
+		return
+	}
+
+	data, err := vcard.Encode(authors)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", vcard.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": vcardFilename(name)}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// vcardFilename names exported contact cards after who they are for
+func vcardFilename(name string) string {
+	return attachmentFilename(name, "authors", ".vcf")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"github.com/liv-format/liv/pkg/capability"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// viewerCapabilities is what the web viewer supports. Features listed in
+// Deprecated still render, with a notice to the reader.
+var viewerCapabilities = &capability.Capabilities{
+	Viewer:        "liv-viewer",
+	FormatVersion: "1.0",
+	Features:      (&core.FeatureFlags{Animations: true, Interactivity: true, Charts: true, Forms: true, Audio: true, Video: true, WebGL: true, WebAssembly: true}).Enabled(),
+	UpdateURL:     "https://github.com/liv-format/liv/releases",
+}
+
+// capabilitiesResponse is the /api/capabilities response
+type capabilitiesResponse struct {
+	Viewer *capability.Capabilities `json:"viewer"`
+	// Negotiation is the outcome for the requested document
+	Negotiation *capability.Result `json:"negotiation,omitempty"`
+	// FallbackURL shows the static version of the document, when it has one
+	FallbackURL string `json:"fallback_url,omitempty"`
+}
+
+// handleCapabilities advertises the capabilities of the viewer. With an id,
+// or while a document is served, it also negotiates them with the
+// document's requirements, so the viewer can explain what is missing before
+// rendering anything.
+func handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := capabilitiesResponse{Viewer: viewerCapabilities}
+	id := r.URL.Query().Get("id")
+	if id != "" || servedDocument != "" {
+		if !holdsOpenDocument(r) {
+			http.Error(w, "Open the document in the viewer first", http.StatusForbidden)
+			return
+		}
+		m, err := readDocumentManifest(id)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				http.Error(w, "Document not found", http.StatusNotFound)
+				return
+			}
+			log.WarnContext(r.Context(), "Failed to read document manifest", "error", err)
+			http.Error(w, fmt.Sprintf("Invalid LIV document: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+
+		// Encrypted content cannot be rendered statically on the server
+		hasFallback := m.Encryption == nil
+		response.Negotiation = capability.Negotiate(m, viewerCapabilities, hasFallback)
+		if hasFallback {
+			query := url.Values{"static": {"1"}}
+			if id != "" {
+				query.Set("id", id)
+			} else {
+				query.Set("file", filepath.Base(servedDocument))
+			}
+			response.FallbackURL = "/viewer?" + query.Encode()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// readDocumentManifest reads the manifest of an uploaded document, or of the
+// served document when id is empty
+func readDocumentManifest(id string) (*core.Manifest, error) {
+	if id != "" {
+		doc, reader, err := openStoredPackage(id)
+		if err != nil {
+			return nil, err
+		}
+		defer doc.Close()
+		return readStoredManifest(reader)
+	}
+
+	reader, err := zip.OpenReader(servedDocument)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document package: %w", err)
+	}
+	defer reader.Close()
+	return readStoredManifest(&reader.Reader)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"archive/zip"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/charts"
+	"github.com/liv-format/liv/pkg/interactive"
+	"github.com/liv-format/liv/pkg/log"
+)
+
+// embedCharts draws the charts of a package's interactive spec into a page
+// served as content, as inline SVG in the empty element each chart targets.
+// Charts the page has no place for, or that target a canvas, are left to the
+// document's own scripts. An invalid spec is ignored.
+func embedCharts(reader *zip.Reader, page []byte) []byte {
+	data, err := readZipEntry(reader, interactiveSpecEntry)
+	if err != nil {
+		return page
+	}
+	spec, result := interactive.Parse(data, nil)
+	if !result.IsValid || len(spec.Charts) == 0 {
+		return page
+	}
+
+	snapshots, errs := charts.Render(spec, func(entry string) ([]byte, error) {
+		return readZipEntry(reader, entry)
+	})
+	for _, err := range errs {
+		log.Warn("Chart not rendered", "error", err)
+	}
+	for _, snapshot := range snapshots {
+		svg := strings.TrimSpace(string(snapshot.SVG))
+		page, _ = charts.Embed(page, snapshot.Chart.Target, `<div class="liv-chart">`+svg+`</div>`)
+	}
+	return page
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/liv-format/liv/pkg/variants"
+)
+
+// defaultDocumentCSP applies to documents whose policy sets no CSP of their own
+const defaultDocumentCSP = "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:"
+
+// viewerPageCSP keeps the viewer page itself out of other sites' frames
+const viewerPageCSP = "frame-ancestors 'self'; object-src 'none'"
+
+// knownCSPDirectives are the directives a document CSP may use
+var knownCSPDirectives = map[string]bool{
+	"default-src": true, "script-src": true, "script-src-elem": true, "script-src-attr": true,
+	"style-src": true, "style-src-elem": true, "style-src-attr": true, "img-src": true,
+	"font-src": true, "connect-src": true, "media-src": true, "object-src": true,
+	"frame-src": true, "child-src": true, "worker-src": true, "manifest-src": true,
+	"form-action": true, "frame-ancestors": true, "base-uri": true, "sandbox": true,
+	"report-uri": true, "report-to": true, "upgrade-insecure-requests": true,
+	"block-all-mixed-content": true, "require-trusted-types-for": true, "trusted-types": true,
+}
+
+// cspSource matches the characters a CSP source expression may contain
+var cspSource = regexp.MustCompile(`^[a-zA-Z0-9\-'*.:/_+=]+$`)
+
+// policyError reports a document security policy the viewer cannot satisfy
+type policyError struct {
+	reason string
+}
+
+func (e *policyError) Error() string {
+	return "security policy cannot be satisfied: " + e.reason
+}
+
+// contentPolicy is how the viewer enforces a document's security policy: the
+// CSP sent with its content and the sandbox of the frame it is rendered in
+type contentPolicy struct {
+	CSP string `json:"csp"`
+	// Sandbox is the iframe sandbox attribute; content never gets
+	// allow-same-origin, so it cannot reach the viewer or its storage
+	Sandbox string `json:"sandbox"`
+}
+
+// newContentPolicy translates a document security policy into the headers
+// and frame sandbox the viewer enforces. Policies asking for more than the
+// viewer grants, such as trusted script execution, are refused rather than
+// weakened.
+func newContentPolicy(policy *core.SecurityPolicy) (*contentPolicy, error) {
+	if policy == nil {
+		return nil, &policyError{"the document has no security policy"}
+	}
+
+	csp := policy.ContentSecurityPolicy
+	if strings.TrimSpace(csp) == "" {
+		csp = defaultDocumentCSP
+	}
+	names, directives, err := parseCSP(csp)
+	if err != nil {
+		return nil, &policyError{err.Error()}
+	}
+	set := func(name string, sources ...string) {
+		if _, exists := directives[name]; !exists {
+			names = append(names, name)
+		}
+		directives[name] = sources
+	}
+
+	var sandbox []string
+	mode := "none"
+	if policy.JSPermissions != nil && policy.JSPermissions.ExecutionMode != "" {
+		mode = policy.JSPermissions.ExecutionMode
+	}
+	switch mode {
+	case "none":
+		set("script-src", "'none'")
+		delete(directives, "script-src-elem")
+		delete(directives, "script-src-attr")
+	case "sandboxed":
+		sandbox = append(sandbox, "allow-scripts")
+		if storage := policy.StoragePolicy; storage != nil &&
+			(storage.AllowLocalStorage || storage.AllowSessionStorage || storage.AllowIndexedDB || storage.AllowCookies) {
+			return nil, &policyError{"document scripts cannot use storage, which needs the viewer's origin"}
+		}
+	case "trusted":
+		return nil, &policyError{"the viewer runs document scripts sandboxed, not trusted"}
+	default:
+		return nil, &policyError{fmt.Sprintf("unknown script execution mode %q", mode)}
+	}
+
+	// Remote sources are limited to the hosts the network policy allows
+	network := policy.NetworkPolicy
+	allowed := func(source string) bool {
+		if strings.HasPrefix(source, "'") || source == "data:" || source == "blob:" {
+			return true
+		}
+		if network == nil || !network.AllowOutbound {
+			return false
+		}
+		if len(network.AllowedHosts) == 0 {
+			return true
+		}
+		host := source
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		host = strings.SplitN(strings.SplitN(host, "/", 2)[0], ":", 2)[0]
+		for _, allowedHost := range network.AllowedHosts {
+			if strings.EqualFold(host, allowedHost) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, "-src") {
+			continue
+		}
+		var kept []string
+		for _, source := range directives[name] {
+			if allowed(source) {
+				kept = append(kept, source)
+			}
+		}
+		if len(kept) == 0 {
+			kept = []string{"'none'"}
+		}
+		directives[name] = kept
+	}
+
+	switch {
+	case network == nil || !network.AllowOutbound:
+		set("connect-src", "'none'")
+	case len(network.AllowedHosts) > 0:
+		var hosts []string
+		for _, host := range network.AllowedHosts {
+			hosts = append(hosts, "https://"+host)
+		}
+		set("connect-src", hosts...)
+	case directives["connect-src"] == nil:
+		set("connect-src", "https:")
+	}
+
+	// The viewer decides how content is framed, reported and navigated
+	delete(directives, "report-uri")
+	delete(directives, "report-to")
+	set("frame-ancestors", "'self'")
+	set("base-uri", "'none'")
+	set("form-action", "'none'")
+	set("object-src", "'none'")
+	set("sandbox", sandbox...)
+
+	var parts []string
+	for _, name := range names {
+		sources, exists := directives[name]
+		if !exists {
+			continue
+		}
+		parts = append(parts, strings.TrimSpace(name+" "+strings.Join(sources, " ")))
+	}
+	return &contentPolicy{CSP: strings.Join(parts, "; "), Sandbox: strings.Join(sandbox, " ")}, nil
+}
+
+// parseCSP splits a CSP into its directives, in order
+func parseCSP(csp string) ([]string, map[string][]string, error) {
+	var names []string
+	directives := make(map[string][]string)
+	for _, part := range strings.Split(csp, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if !knownCSPDirectives[name] {
+			return nil, nil, fmt.Errorf("unknown CSP directive %q", fields[0])
+		}
+		if _, exists := directives[name]; exists {
+			return nil, nil, fmt.Errorf("CSP directive %s is set twice", name)
+		}
+		for _, source := range fields[1:] {
+			if !cspSource.MatchString(source) {
+				return nil, nil, fmt.Errorf("invalid source %q in CSP directive %s", source, name)
+			}
+		}
+		names = append(names, name)
+		directives[name] = fields[1:]
+	}
+	return names, directives, nil
+}
+
+// storedContentPolicy returns the content policy of a stored document
+func storedContentPolicy(id string) (*contentPolicy, error) {
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.Close()
+
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		return nil, err
+	}
+	return newContentPolicy(m.Security)
+}
+
+// contentURL is where the content of a stored document is served from
+func contentURL(id string) string {
+	return "/api/content/" + id + "/content/index.html"
+}
+
+// handleContent serves the content of a stored document, at
+// /api/content/{id}/{entry}, under the CSP its security policy translates
+// to. Paths keep the package layout, so relative links between entries work.
+//
+// The viewer may put the reader's device profile before the entry, as in
+// /api/content/{id}/~2x_1280w_4g/content/index.html. Relative links keep
+// it, and entries with variants are served as the variant that suits it,
+// in a format the browser's Accept header names when there is one.
+func handleContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, entry, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/content/"), "/")
+	var profile variants.Profile
+	if strings.HasPrefix(entry, "~") {
+		var segment string
+		segment, entry, _ = strings.Cut(entry[1:], "/")
+		var err error
+		if profile, err = variants.ParseProfile(segment); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid device profile: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if id == "" || !isContentEntry(entry) {
+		http.Error(w, "Invalid content path", http.StatusBadRequest)
+		return
+	}
+
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Document not available", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer doc.Close()
+
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid document manifest: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	if m.Encryption != nil {
+		// Encrypted content is only ever decrypted in the browser
+		http.Error(w, "Encrypted documents are rendered by the viewer", http.StatusForbidden)
+		return
+	}
+	policy, err := newContentPolicy(m.Security)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if resource := m.Resources[entry]; resource != nil && len(resource.Variants) > 0 {
+		profile.Accept = r.Header.Get("Accept")
+		if variant := variants.Select(resource, profile); isContentEntry(variant) {
+			entry = variant
+		}
+	}
+
+	data, err := readZipEntry(reader, entry)
+	if err != nil {
+		http.Error(w, "Resource not found", http.StatusNotFound)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(entry))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// Printing the frame follows the document's page hints
+	if strings.HasPrefix(contentType, "text/html") && m.Print != nil && isContentEntry(m.Print.Stylesheet) {
+		data = injectPrintStylesheet(data, "/api/content/"+id+"/"+m.Print.Stylesheet)
+	}
+	// The section a link opened at is highlighted
+	if strings.HasPrefix(contentType, "text/html") {
+		data = injectSectionsStylesheet(data)
+	}
+	// Charts are drawn by the viewer, so they show without scripts
+	if strings.HasPrefix(contentType, "text/html") {
+		data = embedCharts(reader, data)
+	}
+	// Scripted pages follow the viewer's pause and resume signals
+	if strings.HasPrefix(contentType, "text/html") && runsScripts(policy) {
+		data = injectActivityRuntime(data)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", policy.CSP)
+	w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
+
+// isContentEntry reports whether a package entry may be served as content
+func isContentEntry(entry string) bool {
+	return !strings.Contains(entry, "..") &&
+		(strings.HasPrefix(entry, "content/") || strings.HasPrefix(entry, "assets/"))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/datasets"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// documentDataset is a data file of a document, as listed in its metadata
+type documentDataset struct {
+	Name        string           `json:"name"`
+	Format      string           `json:"format"`
+	Description string           `json:"description,omitempty"`
+	Schema      *core.DataSchema `json:"schema"`
+	// URL serves the typed rows of the data
+	URL string `json:"url"`
+}
+
+// dataRows is the body of a data request: the rows of a data file typed by
+// its schema
+type dataRows struct {
+	Name   string                   `json:"name"`
+	Schema *core.DataSchema         `json:"schema"`
+	Rows   []map[string]interface{} `json:"rows"`
+}
+
+// documentDatasets lists the data files a document declares, in name order
+func documentDatasets(m *core.Manifest, id string) []documentDataset {
+	var listed []documentDataset
+	for name, asset := range m.Data {
+		if asset == nil {
+			continue
+		}
+		listed = append(listed, documentDataset{
+			Name:        name,
+			Format:      asset.FileFormat(),
+			Description: asset.Description,
+			Schema:      asset.Schema,
+			URL:         dataURL(id, name),
+		})
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+	return listed
+}
+
+// dataURL returns the URL of the rows of a document's data file
+func dataURL(id, name string) string {
+	return "/api/data/" + id + "/" + url.PathEscape(name)
+}
+
+// handleData serves the rows of a data file a stored document declares, at
+// /api/data/{id}/{name}, typed by its schema. Content frames cannot fetch
+// them; the viewer page does, and hands them to the frame on request. Only
+// files the manifest declares are served, and rows that do not follow the
+// schema are left out.
+func handleData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/data/"), "/")
+	if id == "" || name == "" {
+		http.Error(w, "Invalid data path", http.StatusBadRequest)
+		return
+	}
+
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Document not available", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer doc.Close()
+
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid document manifest: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	if m.Encryption != nil {
+		http.Error(w, "Encrypted documents are rendered by the viewer", http.StatusForbidden)
+		return
+	}
+	asset := m.Data[name]
+	if asset == nil {
+		http.Error(w, "Document has no such data", http.StatusNotFound)
+		return
+	}
+
+	table, errs := datasets.Load(asset, func(entry string) ([]byte, error) {
+		return readZipEntry(reader, entry)
+	})
+	if table == nil {
+		http.Error(w, fmt.Sprintf("Invalid data: %v", errs[0]), http.StatusUnprocessableEntity)
+		return
+	}
+	if len(errs) > 0 {
+		log.Warn("Leaving out data rows that do not follow their schema", log.DocumentID, id, "data", name, "errors", len(errs), "first", errs[0])
+	}
+
+	rows := table.Rows
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(dataRows{Name: name, Schema: asset.Schema, Rows: rows})
+}
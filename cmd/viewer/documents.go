@@ -0,0 +1,275 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// maxUploadSize is the largest document accepted by /api/upload
+const maxUploadSize = 100 << 20
+
+// storeConfig configures where uploaded documents are kept and for how long
+type storeConfig struct {
+	Dir         string
+	TTL         time.Duration
+	GCInterval  time.Duration
+	LockTimeout time.Duration
+}
+
+// dir is the directory uploaded documents are kept in
+func (c storeConfig) dir() string {
+	if c.Dir == "" {
+		return filepath.Join(os.TempDir(), "liv-viewer", "documents")
+	}
+	return c.Dir
+}
+
+// documentStore holds documents uploaded through the web viewer
+var documentStore store.DocumentStore
+
+// openDocumentStore creates the upload store and starts its garbage collector
+func openDocumentStore(ctx context.Context, config storeConfig) (store.DocumentStore, error) {
+	fileStore, err := store.NewFileStore(config.dir(), config.TTL)
+	if err != nil {
+		return nil, err
+	}
+	fileStore.SetMaxSize(maxUploadSize).SetLockTimeout(config.LockTimeout)
+
+	if _, err := fileStore.PurgeExpired(time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to clean document store: %v", err)
+	}
+	if config.TTL > 0 {
+		go store.RunCollector(ctx, fileStore, config.GCInterval)
+	}
+
+	return fileStore, nil
+}
+
+// openStoredPackage opens an uploaded document as a ZIP archive
+func openStoredPackage(id string) (store.Document, *zip.Reader, error) {
+	if documentStore == nil {
+		return nil, nil, store.ErrNotFound
+	}
+
+	doc, err := documentStore.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := zip.NewReader(doc, doc.Info().Size)
+	if err != nil {
+		doc.Close()
+		return nil, nil, fmt.Errorf("invalid document package: %v", err)
+	}
+
+	return doc, reader, nil
+}
+
+// readZipEntry reads a single entry from an opened package
+func readZipEntry(reader *zip.Reader, entry string) ([]byte, error) {
+	file, err := reader.Open(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// readStoredManifest parses and validates the manifest of an opened package
+func readStoredManifest(reader *zip.Reader) (*core.Manifest, error) {
+	data, err := readZipEntry(reader, "manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", core.ErrManifestMissing, err)
+	}
+
+	return manifest.NewManifestParser().ParseFromBytes(data)
+}
+
+// validationReason names the kind of error a document failed validation
+// with, for the validation failure metrics
+func validationReason(err error) string {
+	switch {
+	case errors.Is(err, core.ErrManifestMissing):
+		return "manifest_missing"
+	case errors.Is(err, core.ErrManifestInvalid):
+		return "invalid_manifest"
+	case errors.Is(err, core.ErrHashMismatch):
+		return "tampered"
+	case errors.Is(err, core.ErrSignatureInvalid):
+		return "invalid_signature"
+	case errors.Is(err, core.ErrPolicyDenied):
+		return "policy_denied"
+	default:
+		return "invalid_package"
+	}
+}
+
+// documentResource describes a single resource listed in a document manifest
+type documentResource struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+	// URL streams the resource, honoring range requests
+	URL string `json:"url"`
+}
+
+// documentModule is a WASM module a document declares, for the viewer to
+// fetch and compile while the document opens
+type documentModule struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url"`
+}
+
+// documentPage is the page size a paged document declares, in CSS pixels,
+// for the viewer to show its pages at actual size or fit them
+type documentPage struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// documentMetadata is the /api/document response for a stored document
+type documentMetadata struct {
+	ID          string             `json:"id"`
+	Filename    string             `json:"filename"`
+	Size        int64              `json:"size"`
+	SHA256      string             `json:"sha256"`
+	Uploaded    time.Time          `json:"uploaded"`
+	Expires     *time.Time         `json:"expires,omitempty"`
+	Title       string             `json:"title"`
+	Author      string             `json:"author"`
+	Description string             `json:"description,omitempty"`
+	Version     string             `json:"version"`
+	Language    string             `json:"language"`
+	Created     time.Time          `json:"created"`
+	Modified    time.Time          `json:"modified"`
+	Resources   []documentResource `json:"resources"`
+	Features    []string           `json:"features"`
+	WASMModules []documentModule   `json:"wasm_modules"`
+	Encrypted   bool               `json:"encrypted"`
+	License     string             `json:"license,omitempty"`
+	Status      string             `json:"status"`
+	// ContentURL serves the content of unencrypted documents under
+	// ContentPolicy, for rendering in a sandboxed frame
+	ContentURL    string         `json:"content_url,omitempty"`
+	ContentPolicy *contentPolicy `json:"content_policy,omitempty"`
+	// Activity is what keeps running while the content is paused
+	Activity *core.ActivitySpec `json:"activity,omitempty"`
+	// Graphics is how a WebGL document degrades on devices that cannot run
+	// it; unset for other documents
+	Graphics *documentGraphics `json:"graphics,omitempty"`
+	// Events is the programme or schedule of documents that have one
+	Events *documentEvents `json:"events,omitempty"`
+	// Data are the data files the document declares, which its content
+	// loads through the viewer
+	Data []documentDataset `json:"data,omitempty"`
+	// Authors are the authors a document lists, with their affiliations
+	// and identifiers
+	Authors []documentAuthor `json:"authors,omitempty"`
+	// Funding acknowledges the funders and grants that supported the work
+	Funding []*core.FundingInfo `json:"funding,omitempty"`
+	// Keywords and Subjects classify the document
+	Keywords []string            `json:"keywords,omitempty"`
+	Subjects []*core.SubjectInfo `json:"subjects,omitempty"`
+	// Page is set for paged documents, those with print settings
+	Page *documentPage `json:"page,omitempty"`
+}
+
+// newDocumentMetadata combines storage information with the parsed manifest
+func newDocumentMetadata(info *store.DocumentInfo, m *core.Manifest) *documentMetadata {
+	metadata := &documentMetadata{
+		ID:          info.ID,
+		Filename:    info.Filename,
+		Size:        info.Size,
+		SHA256:      info.SHA256,
+		Uploaded:    info.Uploaded,
+		Resources:   []documentResource{},
+		Features:    []string{},
+		WASMModules: []documentModule{},
+		Encrypted:   m.Encryption != nil,
+		Status:      "loaded",
+	}
+	if !info.Expires.IsZero() {
+		expires := info.Expires
+		metadata.Expires = &expires
+	}
+
+	if m.Metadata != nil {
+		metadata.Title = m.Metadata.Title
+		metadata.Author = m.Metadata.Author
+		metadata.Description = m.Metadata.Description
+		metadata.Version = m.Metadata.Version
+		metadata.Language = m.Metadata.Language
+		metadata.Created = m.Metadata.Created
+		metadata.Modified = m.Metadata.Modified
+		metadata.Authors = newDocumentAuthors(info.ID, m.Metadata)
+		metadata.Funding = m.Metadata.Funding
+		metadata.Keywords = m.Metadata.Keywords
+		metadata.Subjects = m.Metadata.Subjects
+	}
+	if m.Features != nil {
+		metadata.Features = m.Features.Enabled()
+	}
+	if m.License != nil {
+		metadata.License = m.License.Summary()
+	}
+	if m.Print != nil {
+		if width, height, err := m.Print.PageDimensions(); err == nil {
+			// Points are 1/72 inch and CSS pixels 1/96
+			metadata.Page = &documentPage{Width: width * 4 / 3, Height: height * 4 / 3}
+		}
+	}
+
+	for path, resource := range m.Resources {
+		if resource == nil {
+			continue
+		}
+		metadata.Resources = append(metadata.Resources, documentResource{
+			Path: path,
+			Type: resource.Type,
+			Size: resource.Size,
+			Hash: resource.Hash,
+			URL:  documentResourceURL(info.ID, path),
+		})
+	}
+	sort.Slice(metadata.Resources, func(i, j int) bool {
+		return metadata.Resources[i].Path < metadata.Resources[j].Path
+	})
+
+	// Encrypted modules are only readable after decryption, so they cannot
+	// be compiled ahead of time
+	if m.WASMConfig != nil && m.Encryption == nil {
+		for name := range m.WASMConfig.Modules {
+			path := "wasm/" + name + ".wasm"
+			resource := m.Resources[path]
+			if resource == nil {
+				continue
+			}
+			metadata.WASMModules = append(metadata.WASMModules, documentModule{
+				Name:   name,
+				Path:   path,
+				SHA256: resource.Hash,
+				URL:    documentResourceURL(info.ID, path),
+			})
+		}
+		sort.Slice(metadata.WASMModules, func(i, j int) bool {
+			return metadata.WASMModules[i].Name < metadata.WASMModules[j].Name
+		})
+	}
+
+	return metadata
+}
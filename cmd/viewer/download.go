@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/liv-format/liv/pkg/transfer"
+)
+
+// chunkCacheSize bounds the number of chunk manifests kept in memory
+const chunkCacheSize = 128
+
+// chunkCache keeps the most recently requested chunk manifests, so a document
+// is hashed once per chunk size rather than on every resumed download
+type chunkCache struct {
+	mu      sync.Mutex
+	entries map[string]*transfer.ChunkManifest
+	order   []string
+}
+
+var chunkManifests = &chunkCache{entries: make(map[string]*transfer.ChunkManifest)}
+
+func (c *chunkCache) get(key string) *transfer.ChunkManifest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *chunkCache) put(key string, m *transfer.ChunkManifest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = m
+	for len(c.order) > chunkCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// documentETag is the strong entity tag of a stored document download
+func documentETag(info *store.DocumentInfo) string {
+	return `"` + info.SHA256 + `"`
+}
+
+// documentChunksURL is the chunk manifest of a document download, announced to
+// clients in the transfer.ManifestHeader of the download
+func documentChunksURL(id string) string {
+	return "/api/document?" + url.Values{"id": {id}, "chunks": {"true"}}.Encode()
+}
+
+// serveDocumentChunks sends the chunk manifest of a stored document. Clients
+// pick the chunk size with chunk_size; it defaults to transfer.DefaultChunkSize.
+func serveDocumentChunks(w http.ResponseWriter, r *http.Request, doc store.Document) {
+	chunkSize := int64(transfer.DefaultChunkSize)
+	if value := r.URL.Query().Get("chunk_size"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < transfer.MinChunkSize || size > transfer.MaxChunkSize {
+			http.Error(w, fmt.Sprintf("chunk_size must be between %d and %d", transfer.MinChunkSize, transfer.MaxChunkSize), http.StatusBadRequest)
+			return
+		}
+		chunkSize = size
+	}
+
+	info := doc.Info()
+	key := fmt.Sprintf("%s/%d", info.SHA256, chunkSize)
+	m := chunkManifests.get(key)
+	if m == nil {
+		if _, err := doc.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Failed to read document", http.StatusInternalServerError)
+			return
+		}
+		var err error
+		if m, err = transfer.ComputeChunks(doc, chunkSize); err != nil {
+			log.ErrorContext(r.Context(), "Failed to hash document", log.DocumentID, info.ID, "error", err)
+			http.Error(w, "Failed to read document", http.StatusInternalServerError)
+			return
+		}
+		m.ETag = documentETag(info)
+		chunkManifests.put(key, m)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		http.Error(w, "Failed to encode chunk manifest", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-chunks-%d"`, info.SHA256, chunkSize))
+	http.ServeContent(w, r, "", info.Uploaded, bytes.NewReader(data))
+}
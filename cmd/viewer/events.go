@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/calendar"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// documentEvents is the events section of the metadata of a document with a
+// programme or schedule
+type documentEvents struct {
+	*core.EventsSpec
+	// CalendarURL exports the events as an iCalendar file; with an event
+	// parameter, just that event
+	CalendarURL string `json:"calendar_url"`
+}
+
+// readEventsSpec returns the events section of a package's interactive spec,
+// and nil for documents without events. An invalid section is ignored, so
+// no timeline is shown.
+func readEventsSpec(reader *zip.Reader, id string) *documentEvents {
+	data, err := readZipEntry(reader, interactiveSpecEntry)
+	if err != nil {
+		return nil
+	}
+	spec, err := core.ParseEventsSpec(data)
+	if err != nil {
+		log.Warn("Ignoring events section", log.DocumentID, id, "error", err)
+		return nil
+	}
+	if len(spec.Items) == 0 {
+		return nil
+	}
+	return &documentEvents{EventsSpec: spec, CalendarURL: "/api/events?" + url.Values{"id": {id}}.Encode()}
+}
+
+// handleEvents exports the events of an uploaded document, or of the served
+// document when no id is given, as an iCalendar attachment. The event
+// parameter exports a single event.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		reader *zip.Reader
+		err    error
+	)
+	if id := r.URL.Query().Get("id"); id != "" {
+		var doc store.Document
+		doc, reader, err = openStoredPackage(id)
+		if err == nil {
+			defer doc.Close()
+		}
+	} else if servedDocument != "" {
+		var served *zip.ReadCloser
+		served, err = zip.OpenReader(servedDocument)
+		if err == nil {
+			defer served.Close()
+			reader = &served.Reader
+		}
+	} else {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Invalid LIV document: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid document manifest: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	spec := &core.EventsSpec{}
+	if data, err := readZipEntry(reader, interactiveSpecEntry); err == nil {
+		if spec, err = core.ParseEventsSpec(data); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	name := spec.Name
+	if name == "" && m.Metadata != nil {
+		name = m.Metadata.Title
+	}
+	if eventID := r.URL.Query().Get("event"); eventID != "" {
+		var selected []core.Event
+		for _, event := range spec.Items {
+			if event.ID == eventID {
+				selected = append(selected, event)
+				name = event.Title
+			}
+		}
+		spec = &core.EventsSpec{Name: spec.Name, Items: selected}
+	}
+	if len(spec.Items) == 0 {
+		http.Error(w, "Document has no such events", http.StatusNotFound)
+		return
+	}
+
+	data, err := calendar.ICS(spec, calendar.Options{UIDDomain: eventUIDDomain(m), Stamp: time.Now()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", calendar.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": calendarFilename(name)}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// eventUIDDomain identifies a document in the UIDs of its events. It is
+// derived from what stays the same across versions of the document, so a
+// calendar importing a new version updates the events it already has.
+func eventUIDDomain(m *core.Manifest) string {
+	hash := sha256.New()
+	if m.Metadata != nil {
+		fmt.Fprintf(hash, "%s\x00%s\x00%s", m.Metadata.Title, m.Metadata.Author, m.Metadata.Created.UTC().Format(time.RFC3339))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16] + ".liv"
+}
+
+// calendarFilename names an exported calendar after its title
+func calendarFilename(title string) string {
+	return attachmentFilename(title, "events", ".ics")
+}
+
+// attachmentFilename names an exported file after what it holds, or
+// fallback when that has no name
+func attachmentFilename(title, fallback, extension string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = fallback
+	}
+	return name + extension
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/charts"
+	"github.com/liv-format/liv/pkg/convert"
+	"github.com/liv-format/liv/pkg/jobs"
+	"github.com/liv-format/liv/pkg/pdfops"
+	"github.com/liv-format/liv/pkg/printstyle"
+	"github.com/liv-format/liv/pkg/sandbox"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// exportFormat is a format uploaded documents can be converted to
+type exportFormat struct {
+	ContentType string
+	Extension   string
+}
+
+// exportFormats are the formats of /api/jobs exports
+var exportFormats = map[string]exportFormat{
+	"pdf":      {ContentType: "application/pdf", Extension: ".pdf"},
+	"markdown": {ContentType: "text/markdown; charset=utf-8", Extension: ".md"},
+	"html":     {ContentType: "text/html; charset=utf-8", Extension: ".html"},
+}
+
+// exportFormatNames lists the export formats for error messages
+func exportFormatNames() string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// exportMemory is the memory budget of each export in bytes, zero for none
+var exportMemory int64
+
+// Stages of an export, as reported to users
+const (
+	stageReading  = "reading the document"
+	stageImages   = "embedding images"
+	stageMarkdown = "converting to Markdown"
+	stageLayout   = "laying out the PDF"
+)
+
+// htmlParseOverhead estimates the memory of parsing HTML as a multiple of its
+// size
+const htmlParseOverhead = 8
+
+// budgetHints tell users what to do about an export that ran out of budget
+var budgetHints = map[string]string{
+	jobs.ResourceTime:   "export to Markdown, which is faster, retry when the server is less busy, or ask the administrator to raise --job-timeout",
+	jobs.ResourceMemory: "export to Markdown, which leaves out images, or ask the administrator to raise --job-memory",
+	jobs.ResourceCPU:    "export to Markdown, which is faster, or ask the administrator to raise the CPU time limit of the sandbox policy",
+}
+
+func newBudgetError(resource, stage, limit, used string) *jobs.BudgetError {
+	return &jobs.BudgetError{Resource: resource, Stage: stage, Limit: limit, Used: used, Hint: budgetHints[resource]}
+}
+
+func formatSize(size int64) string {
+	if size < 1<<20 {
+		return strconv.FormatInt(size>>10, 10) + " KB"
+	}
+	return strconv.FormatInt(size>>20, 10) + " MB"
+}
+
+// exportBudget tracks an export against its time and memory budget. Output is
+// committed a block at a time, so an export that runs out of budget keeps what
+// it converted until then.
+type exportBudget struct {
+	ctx     context.Context
+	timeout time.Duration
+	memory  int64
+	used    int64
+	stage   string
+	// err is the breach of the budget, once it has run out
+	err  error
+	out  bytes.Buffer
+	kept int
+	// onStage and onCommit pass progress from workers to the server
+	onStage  func(stage string)
+	onCommit func(committed []byte) error
+}
+
+// newExportBudget budgets an export that must finish before ctx expires, after
+// timeout, and use at most memory bytes. Zero means unlimited.
+func newExportBudget(ctx context.Context, timeout time.Duration, memory int64) *exportBudget {
+	return &exportBudget{ctx: ctx, timeout: timeout, memory: memory}
+}
+
+// enter starts a stage of the export
+func (b *exportBudget) enter(stage string) error {
+	b.stage = stage
+	if b.onStage != nil {
+		b.onStage(stage)
+	}
+	return b.check()
+}
+
+// check stops the export once its budget has run out or it was canceled
+func (b *exportBudget) check() error {
+	if b.err != nil {
+		return b.err
+	}
+	switch err := b.ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		limit := ""
+		if b.timeout > 0 {
+			limit = b.timeout.String()
+		}
+		b.err = newBudgetError(jobs.ResourceTime, b.stage, limit, "")
+	case err != nil:
+		return err
+	}
+	return b.err
+}
+
+// charge accounts for memory the export is about to use
+func (b *exportBudget) charge(size int64) error {
+	b.used += size
+	if b.err == nil && b.memory > 0 && b.used > b.memory {
+		b.err = newBudgetError(jobs.ResourceMemory, b.stage, formatSize(b.memory), formatSize(b.used))
+	}
+	return b.err
+}
+
+// commit keeps the output written so far
+func (b *exportBudget) commit() error {
+	committed := b.out.Bytes()[b.kept:]
+	b.kept = b.out.Len()
+	if b.onCommit != nil {
+		return b.onCommit(committed)
+	}
+	return nil
+}
+
+// committed returns the output kept so far
+func (b *exportBudget) committed() []byte {
+	return b.out.Bytes()[:b.kept]
+}
+
+// exportStoredDocument converts an uploaded document, in a worker when the
+// server is sandboxed. When the export runs out of budget it returns the
+// output converted so far, marked as incomplete, with a *jobs.BudgetError.
+func exportStoredDocument(ctx context.Context, id, format string, timeout time.Duration, memory int64) ([]byte, error) {
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.Close()
+
+	var output []byte
+	if workerSandbox != nil {
+		output, err = runExportWorker(ctx, doc, id, format, timeout, memory)
+	} else {
+		b := newExportBudget(ctx, timeout, memory)
+		b.onStage = func(stage string) { jobs.SetStage(ctx, stage) }
+		err = exportPackage(reader, id, format, b)
+		output = b.committed()
+	}
+
+	var budget *jobs.BudgetError
+	switch {
+	case err == nil:
+		return output, nil
+	case errors.As(err, &budget) && len(output) > 0:
+		return markIncomplete(format, output, budget), err
+	default:
+		return nil, err
+	}
+}
+
+// runExportWorker exports a document in a sandboxed worker whose memory is
+// capped at the budget. Workers stop by themselves shortly before they would
+// be killed, so they can return what they converted.
+func runExportWorker(ctx context.Context, doc store.Document, id, format string, timeout time.Duration, memory int64) ([]byte, error) {
+	box := workerSandbox.Tighten(sandbox.Limits{Memory: memory})
+	limits := box.Limits()
+	if limits.Memory > 0 {
+		memory = limits.Memory
+	}
+
+	budget := timeout
+	if limits.Timeout > 0 && (budget == 0 || limits.Timeout < budget) {
+		budget = limits.Timeout
+	}
+	remaining := limits.Timeout
+	if deadline, ok := ctx.Deadline(); ok && (remaining == 0 || time.Until(deadline) < remaining) {
+		remaining = time.Until(deadline)
+	}
+	args := []string{"export", "--id", id, "--format", format, "--memory", strconv.FormatInt(memory, 10), "--timeout", budget.String()}
+	if remaining > 0 {
+		args = append(args, "--deadline", (remaining - remaining/10).String())
+	}
+
+	log := &workerLog{onStage: func(stage string) { jobs.SetStage(ctx, stage) }}
+	output, usage, err := runWorkerIn(ctx, box, doc, log, args...)
+	if err == nil {
+		return output, nil
+	}
+	partial := output[:min(log.kept, len(output))]
+	if log.budget != nil {
+		return partial, log.budget
+	}
+
+	switch {
+	case errors.Is(err, sandbox.ErrMemoryLimit):
+		used := ""
+		if usage != nil && usage.PeakMemory > 0 {
+			used = formatSize(usage.PeakMemory)
+		}
+		return partial, newBudgetError(jobs.ResourceMemory, log.stage, formatSize(memory), used)
+	case errors.Is(err, sandbox.ErrCPULimit):
+		return partial, newBudgetError(jobs.ResourceCPU, log.stage, limits.CPUTime.String(), "")
+	case errors.Is(err, sandbox.ErrTimeout):
+		return partial, newBudgetError(jobs.ResourceTime, log.stage, budget.String(), "")
+	}
+	return nil, log.failure(err)
+}
+
+// exportPackage converts the static content of a package into the output of
+// b. HTML exports are the static fallback page with images embedded, so they
+// display offline.
+func exportPackage(reader *zip.Reader, id, format string, b *exportBudget) error {
+	if _, ok := exportFormats[format]; !ok {
+		return fmt.Errorf("unsupported export format %q (use %s)", format, exportFormatNames())
+	}
+	if err := b.enter(stageReading); err != nil {
+		return err
+	}
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		return err
+	}
+	if m.Access != nil {
+		return errors.New("documents with an access policy cannot be exported")
+	}
+
+	if format == "html" {
+		if err := b.enter(stageImages); err != nil {
+			return err
+		}
+		body, err := renderStaticFallback(reader, embeddedResourceURL(reader, fallbackResourceURL(id), b), "")
+		if err != nil {
+			return err
+		}
+		b.out.Write(body)
+		if err := b.commit(); err != nil {
+			return err
+		}
+		// Images past the memory budget are linked instead of embedded
+		return b.err
+	}
+
+	entry, content := readStaticContent(reader)
+	switch {
+	case isEncryptedEntry(m, entry):
+		return errors.New("encrypted documents cannot be exported")
+	case content == nil:
+		return errors.New("document has no static content to export")
+	}
+	if err := b.charge(int64(len(content)) * htmlParseOverhead); err != nil {
+		return err
+	}
+
+	if format == "markdown" {
+		if err := b.enter(stageMarkdown); err != nil {
+			return err
+		}
+		err := convert.HTMLToMarkdownBlocks(string(content), func(block string) error {
+			if err := b.check(); err != nil {
+				return err
+			}
+			if b.kept > 0 {
+				b.out.WriteString("\n\n")
+			}
+			b.out.WriteString(block)
+			return b.commit()
+		})
+		if err != nil || b.kept == 0 {
+			return err
+		}
+		b.out.WriteString("\n")
+		return b.commit()
+	}
+
+	if err := b.enter(stageLayout); err != nil {
+		return err
+	}
+	options := pdfops.RenderOptions{
+		LoadImage: func(src string) ([]byte, error) {
+			if strings.Contains(src, ":") {
+				return nil, fmt.Errorf("external image not embedded: %s", src)
+			}
+			name := path.Join(path.Dir(entry), strings.SplitN(src, "?", 2)[0])
+			if isEncryptedEntry(m, name) {
+				return nil, fmt.Errorf("image is encrypted: %s", src)
+			}
+			var data []byte
+			var err error
+			if strings.HasPrefix(name, charts.SnapshotPrefix) {
+				// The renderer cannot draw SVG, so chart snapshots are drawn again
+				data, err = charts.SnapshotPNG(name, func(entry string) ([]byte, error) { return readZipEntry(reader, entry) })
+			} else {
+				data, err = readZipEntry(reader, name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			// Decoded images take four bytes a pixel
+			if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+				if err := b.charge(int64(len(data)) + 4*int64(config.Width)*int64(config.Height)); err != nil {
+					return nil, err
+				}
+			}
+			return data, nil
+		},
+		// Layout stops at the next block once the budget has run out, and
+		// the pages so far are kept
+		Interrupt: b.check,
+	}
+	if m.Metadata != nil {
+		options.Title = m.Metadata.Title
+		options.Author = m.Metadata.AuthorNames()
+	}
+	// Invalid page hints fall back to A4 with one inch margins
+	printstyle.Configure(&options, m.Print)
+	options.Cover = printstyle.Cover(m, func(name string) ([]byte, error) {
+		if isEncryptedEntry(m, name) {
+			return nil, fmt.Errorf("entry is encrypted: %s", name)
+		}
+		data, err := readZipEntry(reader, name)
+		if err != nil {
+			return nil, err
+		}
+		return data, b.charge(int64(len(data)))
+	})
+	err = pdfops.RenderHTML(string(content), &b.out, options)
+	var budget *jobs.BudgetError
+	if err != nil && !errors.As(err, &budget) {
+		return err
+	}
+	if err := b.commit(); err != nil {
+		return err
+	}
+	return err
+}
+
+// embeddedResourceURL inlines package images as data URLs and links other
+// entries with link. Once the budget has run out images are linked too.
+func embeddedResourceURL(reader *zip.Reader, link func(string) string, b *exportBudget) func(string) string {
+	return func(entry string) string {
+		contentType := mime.TypeByExtension(path.Ext(entry))
+		if strings.HasPrefix(contentType, "image/") && b.err == nil {
+			if data, err := readZipEntry(reader, entry); err == nil && b.charge(int64(len(data)+base64.StdEncoding.EncodedLen(len(data)))) == nil {
+				return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+			}
+		}
+		return link(entry)
+	}
+}
+
+// markIncomplete adds a note to the partial output of an export saying why it
+// stopped. Partial PDFs already end with one.
+func markIncomplete(format string, output []byte, budget *jobs.BudgetError) []byte {
+	switch format {
+	case "markdown":
+		return append(output, []byte("\n\n> **Incomplete export:** "+budget.Error()+"\n")...)
+	case "html":
+		note := []byte(`<p role="note" style="border-top: 1px solid #999; color: #555; font-style: italic">Incomplete export: ` + html.EscapeString(budget.Error()) + "</p>")
+		end := bytes.LastIndex(output, []byte("</body>"))
+		if end < 0 {
+			return append(output, note...)
+		}
+		return append(output[:end:end], append(note, output[end:]...)...)
+	}
+	return output
+}
+
+// exportFilename names the result of an export after the uploaded file
+func exportFilename(id, format string) string {
+	name := "document"
+	if documentStore != nil {
+		if info, err := documentStore.Stat(id); err == nil {
+			name = strings.TrimSuffix(info.Filename, path.Ext(info.Filename))
+		}
+	}
+	return name + exportFormats[format].Extension
+}
+
+// storedDocumentSize is the size of an uploaded document, the cost of
+// converting it
+func storedDocumentSize(id string) (int64, error) {
+	if documentStore == nil {
+		return 0, store.ErrNotFound
+	}
+	info, err := documentStore.Stat(id)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
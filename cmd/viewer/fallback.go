@@ -0,0 +1,504 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// fallbackEntry is the pre-rendered, script-free version of a document
+	fallbackEntry = "content/static/fallback.html"
+	// contentEntry is served, sanitized, when a document has no static fallback
+	contentEntry = "content/index.html"
+
+	// staticFallbackPolicy forbids scripts, frames and remote loads in server-rendered pages
+	staticFallbackPolicy = "default-src 'none'; img-src 'self' data:; media-src 'self'; font-src 'self' data:; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors 'self'"
+)
+
+// staticFallbackMode serves the static fallback to every client (--fallback)
+var staticFallbackMode bool
+
+// noScriptAgents are User-Agent fragments of clients that cannot run the viewer:
+// command-line tools, text browsers, link-preview crawlers and mail webviews
+var noScriptAgents = []string{
+	"curl/", "wget/", "httpie/", "lynx/", "links (", "elinks/", "w3m/",
+	"slackbot", "twitterbot", "facebookexternalhit", "discordbot", "linkedinbot",
+	"telegrambot", "whatsapp", "skypeuripreview", "embedly", "googlebot",
+	"bingbot", "applebot", "ms-office", "microsoft outlook",
+}
+
+// prefersStaticFallback reports whether a viewer request should be answered with
+// server-rendered HTML instead of the JavaScript loader. An explicit static=1 or
+// static=0 query parameter overrides the User-Agent check.
+func prefersStaticFallback(r *http.Request) bool {
+	switch r.URL.Query().Get("static") {
+	case "1", "true":
+		return true
+	case "0", "false":
+		return false
+	}
+	if staticFallbackMode {
+		return true
+	}
+
+	agent := strings.ToLower(r.UserAgent())
+	for _, fragment := range noScriptAgents {
+		if strings.Contains(agent, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// staticFallbackURL returns the HTML-escaped URL of the static rendering of the
+// current viewer page, for browsers with JavaScript disabled
+func staticFallbackURL(r *http.Request) string {
+	query := r.URL.Query()
+	query.Set("static", "1")
+	return html.EscapeString("/viewer?" + query.Encode())
+}
+
+// staticPage is a document rendered for clients without JavaScript
+type staticPage struct {
+	Body    []byte
+	ModTime time.Time
+	ETag    string
+}
+
+// handleStaticFallback serves the sanitized static fallback of an uploaded
+// document, or of the served document when no id is given
+func handleStaticFallback(w http.ResponseWriter, r *http.Request, documentID string) {
+	var (
+		page *staticPage
+		err  error
+	)
+	imageURL := previewImageURL(r, documentID)
+	if documentID != "" {
+		page, err = renderStoredFallback(r.Context(), documentID, imageURL)
+	} else {
+		page, err = renderServedFallback(imageURL)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			log.ErrorContext(r.Context(), "Failed to render static fallback", "error", err)
+			http.Error(w, "Failed to render document", http.StatusUnprocessableEntity)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", staticFallbackPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	if page.ETag != "" {
+		w.Header().Set("ETag", page.ETag)
+	}
+
+	http.ServeContent(w, r, "", page.ModTime, bytes.NewReader(page.Body))
+}
+
+// renderStoredFallback renders an uploaded document, in a worker when the
+// server is sandboxed
+func renderStoredFallback(ctx context.Context, id, imageURL string) (*staticPage, error) {
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.Close()
+
+	info := doc.Info()
+	var body []byte
+	if workerSandbox != nil {
+		body, err = runWorker(ctx, doc, "fallback", "--id", id, "--image-url", imageURL)
+	} else {
+		body, err = renderStaticFallback(reader, fallbackResourceURL(id), imageURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &staticPage{Body: body, ModTime: info.Uploaded, ETag: `"` + info.SHA256 + `-static"`}, nil
+}
+
+func renderServedFallback(imageURL string) (*staticPage, error) {
+	if servedDocument == "" {
+		return nil, store.ErrNotFound
+	}
+
+	info, err := os.Stat(servedDocument)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(servedDocument)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document package: %v", err)
+	}
+	defer reader.Close()
+
+	body, err := renderStaticFallback(&reader.Reader, fallbackResourceURL(""), imageURL)
+	if err != nil {
+		return nil, err
+	}
+	return &staticPage{Body: body, ModTime: info.ModTime()}, nil
+}
+
+// fallbackResourceURL links package entries of an uploaded document, or of the
+// served document when id is empty
+func fallbackResourceURL(id string) func(string) string {
+	return func(entry string) string {
+		query := url.Values{"path": {entry}}
+		if id != "" {
+			query.Set("id", id)
+		}
+		return "/api/resource?" + query.Encode()
+	}
+}
+
+// renderStaticFallback produces a standalone, script-free HTML page for a
+// package. The static fallback is preferred over the main content; both are
+// sanitized, stylesheets are inlined and other package resources are linked
+// through /api/resource. Manifest metadata and the preview card at imageURL are
+// added for link previews.
+func renderStaticFallback(reader *zip.Reader, resourceURL func(string) string, imageURL string) ([]byte, error) {
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, content := readStaticContent(reader)
+	if isEncryptedEntry(m, entry) {
+		content = []byte("<p>This document is encrypted. Open it in a browser with JavaScript enabled to unlock it.</p>")
+	} else if m.Access != nil {
+		content = []byte("<p>Access to this document is restricted. Open it in a browser with JavaScript enabled to view it.</p>")
+	} else if content == nil {
+		content = []byte("<p>This document has no static content. Open it in a browser with JavaScript enabled to view it.</p>")
+	}
+
+	doc, err := nethtml.ParseWithOptions(bytes.NewReader(content), nethtml.ParseOptionEnableScripting(false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", entry, err)
+	}
+
+	sanitizer := &fallbackSanitizer{reader: reader, manifest: m, base: path.Dir(entry), resourceURL: resourceURL}
+	sanitizer.sanitize(doc)
+	addPageMetadata(doc, m, imageURL)
+	if doc.FirstChild == nil || doc.FirstChild.Type != nethtml.DoctypeNode {
+		doc.InsertBefore(&nethtml.Node{Type: nethtml.DoctypeNode, Data: "html"}, doc.FirstChild)
+	}
+
+	var buf bytes.Buffer
+	if err := nethtml.Render(&buf, doc); err != nil {
+		return nil, fmt.Errorf("failed to render static fallback: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readStaticContent returns the static fallback of a package, or its main
+// content when it has none. Content is nil when the package has neither.
+func readStaticContent(reader *zip.Reader) (string, []byte) {
+	if content, err := readZipEntry(reader, fallbackEntry); err == nil {
+		return fallbackEntry, content
+	}
+	content, _ := readZipEntry(reader, contentEntry)
+	return contentEntry, content
+}
+
+func isEncryptedEntry(m *core.Manifest, entry string) bool {
+	if m.Encryption == nil {
+		return false
+	}
+	_, encrypted := m.Encryption.Resources[entry]
+	return encrypted
+}
+
+// fallbackSanitizer strips active content from a parsed document and rewrites
+// package-relative references
+type fallbackSanitizer struct {
+	reader      *zip.Reader
+	manifest    *core.Manifest
+	base        string
+	resourceURL func(string) string
+}
+
+// removedElements never appear in a static fallback
+var removedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Iframe: true, atom.Frame: true, atom.Frameset: true,
+	atom.Object: true, atom.Embed: true, atom.Applet: true, atom.Base: true,
+	atom.Template: true,
+}
+
+// urlAttributes hold URLs that are checked and rewritten
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "poster": true, "cite": true, "background": true,
+	"action": true, "xlink:href": true, "data": true,
+}
+
+func (s *fallbackSanitizer) sanitize(n *nethtml.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+
+		switch {
+		case child.Type == nethtml.CommentNode:
+			n.RemoveChild(child)
+		case child.Type != nethtml.ElementNode:
+		case removedElements[child.DataAtom] || (child.Data == "meta" && hasAttribute(child, "http-equiv")):
+			n.RemoveChild(child)
+		case child.DataAtom == atom.Noscript:
+			// Without scripts, noscript content is exactly what should be shown
+			if child.FirstChild != nil {
+				next = child.FirstChild
+			}
+			for grandchild := child.FirstChild; grandchild != nil; grandchild = child.FirstChild {
+				child.RemoveChild(grandchild)
+				n.InsertBefore(grandchild, child)
+			}
+			n.RemoveChild(child)
+		case child.DataAtom == atom.Link:
+			if style := s.inlineStylesheet(child); style != nil {
+				n.InsertBefore(style, child)
+			}
+			n.RemoveChild(child)
+		default:
+			s.sanitizeAttributes(child)
+			s.sanitize(child)
+		}
+
+		child = next
+	}
+}
+
+// inlineStylesheet replaces a package stylesheet link with a style element, as
+// no-JS and mail clients rarely fetch linked stylesheets
+func (s *fallbackSanitizer) inlineStylesheet(link *nethtml.Node) *nethtml.Node {
+	if !strings.EqualFold(getAttribute(link, "rel"), "stylesheet") {
+		return nil
+	}
+	entry, ok := s.resolve(getAttribute(link, "href"))
+	if !ok || isEncryptedEntry(s.manifest, entry) {
+		return nil
+	}
+	css, err := readZipEntry(s.reader, entry)
+	if err != nil {
+		return nil
+	}
+
+	style := &nethtml.Node{Type: nethtml.ElementNode, Data: "style", DataAtom: atom.Style}
+	style.AppendChild(&nethtml.Node{Type: nethtml.TextNode, Data: strings.ReplaceAll(string(css), "</", "<\\/")})
+	return style
+}
+
+func (s *fallbackSanitizer) sanitizeAttributes(n *nethtml.Node) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if a.Namespace == "xlink" && key == "href" {
+			key = "xlink:href"
+		}
+
+		switch {
+		case strings.HasPrefix(key, "on"), key == "srcdoc", key == "srcset", key == "formaction", key == "ping":
+			continue
+		case urlAttributes[key]:
+			value, ok := s.rewriteURL(a.Val, n.DataAtom == atom.Img)
+			if !ok {
+				continue
+			}
+			a.Val = value
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
+// rewriteURL keeps fragments and http(s), mailto and tel links, points package
+// paths at /api/resource and rejects every other scheme
+func (s *fallbackSanitizer) rewriteURL(value string, image bool) (string, bool) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return trimmed, true
+	}
+
+	parsed, err := url.Parse(trimmed)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto", "tel":
+		return trimmed, true
+	case "data":
+		return trimmed, image && strings.HasPrefix(strings.ToLower(parsed.Opaque), "image/")
+	case "":
+	default:
+		return "", false
+	}
+
+	entry, ok := s.resolve(trimmed)
+	if !ok {
+		return "", false
+	}
+	if parsed.Fragment != "" {
+		return s.resourceURL(entry) + "#" + parsed.Fragment, true
+	}
+	return s.resourceURL(entry), true
+}
+
+// resolve turns a reference relative to the fallback page into a package path
+func (s *fallbackSanitizer) resolve(ref string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.Path == "" {
+		return "", false
+	}
+
+	entry := path.Clean(path.Join(s.base, parsed.Path))
+	if strings.HasPrefix(parsed.Path, "/") {
+		entry = strings.TrimPrefix(path.Clean(parsed.Path), "/")
+	}
+	if entry == "." || entry == ".." || strings.HasPrefix(entry, "../") {
+		return "", false
+	}
+	return entry, true
+}
+
+// addPageMetadata sets the title, language and description of a static page and
+// adds Open Graph tags so shared links unfurl with the document's details and
+// preview card. Authors are listed as Dublin Core creators and in the
+// citation tags academic search engines index.
+func addPageMetadata(doc *nethtml.Node, m *core.Manifest, imageURL string) {
+	root := findNode(doc, atom.Html)
+	head := findNode(doc, atom.Head)
+	if root == nil || head == nil || m.Metadata == nil {
+		return
+	}
+	metadata := m.Metadata
+
+	if metadata.Language != "" && getAttribute(root, "lang") == "" {
+		root.Attr = append(root.Attr, nethtml.Attribute{Key: "lang", Val: metadata.Language})
+	}
+
+	title := findNode(head, atom.Title)
+	if metadata.Title != "" {
+		if title != nil {
+			head.RemoveChild(title)
+		}
+		title = &nethtml.Node{Type: nethtml.ElementNode, Data: "title", DataAtom: atom.Title}
+		title.AppendChild(&nethtml.Node{Type: nethtml.TextNode, Data: metadata.Title})
+		head.InsertBefore(title, head.FirstChild)
+	}
+
+	meta := func(key, name, content string) {
+		if content == "" {
+			return
+		}
+		head.AppendChild(&nethtml.Node{
+			Type:     nethtml.ElementNode,
+			Data:     "meta",
+			DataAtom: atom.Meta,
+			Attr:     []nethtml.Attribute{{Key: key, Val: name}, {Key: "content", Val: content}},
+		})
+	}
+	meta("name", "description", metadata.Description)
+	meta("name", "author", metadata.Author)
+	if creators := metadata.Creators(); len(creators) > 0 {
+		head.AppendChild(&nethtml.Node{
+			Type:     nethtml.ElementNode,
+			Data:     "link",
+			DataAtom: atom.Link,
+			Attr:     []nethtml.Attribute{{Key: "rel", Val: "schema.DC"}, {Key: "href", Val: "http://purl.org/dc/elements/1.1/"}},
+		})
+		meta("name", "DC.title", metadata.Title)
+		for _, author := range creators {
+			meta("name", "DC.creator", author.Name)
+		}
+		meta("name", "DC.language", metadata.Language)
+		meta("name", "citation_title", metadata.Title)
+		for _, author := range creators {
+			meta("name", "citation_author", author.Name)
+			meta("name", "citation_author_institution", author.Affiliation)
+			meta("name", "citation_author_email", author.Email)
+			meta("name", "citation_author_orcid", author.ORCIDURL())
+		}
+	}
+	// Search engines and scholarly indexes file the page by its keywords
+	// and subjects
+	if terms := metadata.Terms(); len(terms) > 0 {
+		meta("name", "keywords", strings.Join(terms, ", "))
+		for _, heading := range metadata.SubjectHeadings() {
+			meta("name", "DC.subject", heading)
+		}
+		meta("name", "citation_keywords", strings.Join(terms, "; "))
+	}
+	meta("property", "og:type", "article")
+	meta("property", "og:title", metadata.Title)
+	meta("property", "og:description", metadata.Description)
+	if imageURL != "" {
+		for _, tag := range previewImageTags(imageURL) {
+			meta(tag[0], tag[1], tag[2])
+		}
+	}
+
+	if findCharset(head) == nil {
+		charset := &nethtml.Node{
+			Type:     nethtml.ElementNode,
+			Data:     "meta",
+			DataAtom: atom.Meta,
+			Attr:     []nethtml.Attribute{{Key: "charset", Val: "utf-8"}},
+		}
+		head.InsertBefore(charset, head.FirstChild)
+	}
+}
+
+func findCharset(head *nethtml.Node) *nethtml.Node {
+	for child := head.FirstChild; child != nil; child = child.NextSibling {
+		if child.DataAtom == atom.Meta && hasAttribute(child, "charset") {
+			return child
+		}
+	}
+	return nil
+}
+
+func findNode(n *nethtml.Node, a atom.Atom) *nethtml.Node {
+	if n.Type == nethtml.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findNode(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func getAttribute(n *nethtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttribute(n *nethtml.Node, key string) bool {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+)
+
+// Rendering paths of WebGL documents, as reported by the viewer
+const (
+	renderingWebGL    = "webgl"
+	renderingCanvas2D = core.GraphicsFallbackCanvas2D
+	renderingSnapshot = core.GraphicsFallbackSnapshot
+)
+
+// maxUsageDocuments bounds the documents the usage report counts separately;
+// later ones are only counted in the totals
+const maxUsageDocuments = 1000
+
+// documentGraphics is the graphics section of the metadata of a WebGL document
+type documentGraphics struct {
+	*core.GraphicsSpec
+	// SnapshotURL shows the document on the snapshot path: the spec's
+	// snapshot image, or the static version of the document
+	SnapshotURL string `json:"snapshot_url"`
+}
+
+// readGraphicsSpec returns the graphics section of a WebGL document's
+// interactive spec, and nil for documents that do not use WebGL. An invalid
+// section is ignored, so any WebGL will do.
+func readGraphicsSpec(reader *zip.Reader, m *core.Manifest, id string) *documentGraphics {
+	if !usesWebGL(m) {
+		return nil
+	}
+	spec := &core.GraphicsSpec{}
+	if data, err := readZipEntry(reader, interactiveSpecEntry); err == nil {
+		if spec, err = core.ParseGraphicsSpec(data); err != nil {
+			log.Warn("Ignoring graphics section", log.DocumentID, id, "error", err)
+			spec = &core.GraphicsSpec{}
+		}
+	}
+	graphics := &documentGraphics{GraphicsSpec: spec}
+	if spec.Snapshot != "" {
+		graphics.SnapshotURL = "/api/content/" + id + "/" + spec.Snapshot
+	} else {
+		graphics.SnapshotURL = "/viewer?" + url.Values{"id": {id}, "static": {"1"}}.Encode()
+	}
+	return graphics
+}
+
+// usesWebGL reports whether a document declares that it renders with WebGL
+func usesWebGL(m *core.Manifest) bool {
+	if m.Features != nil && m.Features.WebGL {
+		return true
+	}
+	if m.Requirements != nil {
+		for _, feature := range m.Requirements.Features {
+			if feature == "webgl" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderingReport is what the viewer reports after choosing how to render
+// a WebGL document
+type renderingReport struct {
+	Document string `json:"document"`
+	Path     string `json:"path"`
+	// Reason is why the viewer degraded, such as no_webgl or small_textures
+	Reason string `json:"reason,omitempty"`
+}
+
+// renderingCounts counts the rendering paths taken
+type renderingCounts struct {
+	Paths   map[string]int `json:"paths"`
+	Reasons map[string]int `json:"reasons,omitempty"`
+}
+
+func (c *renderingCounts) add(report *renderingReport) {
+	if c.Paths == nil {
+		c.Paths = map[string]int{}
+	}
+	c.Paths[report.Path]++
+	if report.Reason != "" {
+		if c.Reasons == nil {
+			c.Reasons = map[string]int{}
+		}
+		c.Reasons[report.Reason]++
+	}
+}
+
+// documentRendering is a document's entry in the usage report
+type documentRendering struct {
+	Document string `json:"document"`
+	renderingCounts
+}
+
+// usageReport is the /api/usage response
+type usageReport struct {
+	Since     time.Time            `json:"since"`
+	Rendering renderingCounts      `json:"rendering"`
+	Documents []*documentRendering `json:"documents"`
+}
+
+// usage counts how documents were rendered since the viewer started
+var usage = struct {
+	sync.Mutex
+	since     time.Time
+	rendering renderingCounts
+	documents map[string]*renderingCounts
+}{since: time.Now(), documents: map[string]*renderingCounts{}}
+
+// recordRendering adds a rendering report to the usage report
+func recordRendering(report *renderingReport) {
+	usage.Lock()
+	defer usage.Unlock()
+	usage.rendering.add(report)
+	counts := usage.documents[report.Document]
+	if counts == nil {
+		if len(usage.documents) >= maxUsageDocuments {
+			return
+		}
+		counts = &renderingCounts{}
+		usage.documents[report.Document] = counts
+	}
+	counts.add(report)
+}
+
+// currentUsage returns the usage report, documents in ID order
+func currentUsage() *usageReport {
+	usage.Lock()
+	defer usage.Unlock()
+	report := &usageReport{Since: usage.since, Documents: []*documentRendering{}}
+	report.Rendering.Paths = copyCounts(usage.rendering.Paths)
+	report.Rendering.Reasons = copyCounts(usage.rendering.Reasons)
+	for id, counts := range usage.documents {
+		report.Documents = append(report.Documents, &documentRendering{
+			Document:        id,
+			renderingCounts: renderingCounts{Paths: copyCounts(counts.Paths), Reasons: copyCounts(counts.Reasons)},
+		})
+	}
+	sort.Slice(report.Documents, func(i, j int) bool { return report.Documents[i].Document < report.Documents[j].Document })
+	return report
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	if counts == nil {
+		return nil
+	}
+	copied := make(map[string]int, len(counts))
+	for key, count := range counts {
+		copied[key] = count
+	}
+	return copied
+}
+
+// handleRenderingUsage records which rendering path the viewer took for a
+// WebGL document, at POST /api/usage/rendering
+func handleRenderingUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var report renderingReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&report); err != nil {
+		http.Error(w, "Invalid rendering report", http.StatusBadRequest)
+		return
+	}
+	switch report.Path {
+	case renderingWebGL, renderingCanvas2D, renderingSnapshot:
+	default:
+		http.Error(w, "Unknown rendering path", http.StatusBadRequest)
+		return
+	}
+	if report.Document == "" || len(report.Document) > 128 || len(report.Reason) > 64 {
+		http.Error(w, "Invalid rendering report", http.StatusBadRequest)
+		return
+	}
+	recordRendering(&report)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUsage serves the usage report, to those who may read the health of
+// the library
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeHealth(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(currentUsage())
+}
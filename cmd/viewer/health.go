@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/health"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// healthConfig configures revalidation of uploaded documents
+type healthConfig struct {
+	Interval       time.Duration
+	RootsFile      string
+	RevocationFile string
+	Webhook        string
+	Token          string
+}
+
+// healthMonitor revalidates the document store; nil when monitoring is disabled
+var healthMonitor *health.Monitor
+
+// healthToken protects the health dashboard and API. Without a token they are
+// only served to loopback clients, as they list every stored document ID.
+var healthToken string
+
+// startHealthMonitor creates the monitor and starts its schedule
+func startHealthMonitor(ctx context.Context, s store.DocumentStore, config healthConfig) (*health.Monitor, error) {
+	trust := health.TrustConfig{RootsFile: config.RootsFile, RevocationFile: config.RevocationFile}
+	// Fail at startup rather than on the first scheduled run
+	if _, err := trust.Load(); err != nil {
+		return nil, err
+	}
+
+	checker := health.NewChecker()
+	checker.ClockSkew = clockSkew
+	monitor := health.NewMonitor(s, checker, trust).AddAlerter(health.LogAlerter{})
+	if config.Webhook != "" {
+		monitor.AddAlerter(&health.WebhookAlerter{URL: config.Webhook})
+	}
+	go monitor.Run(ctx, config.Interval)
+
+	return monitor, nil
+}
+
+// authorizeHealth reports whether a request may read the health of the library
+func authorizeHealth(r *http.Request) bool {
+	if id, ok := auth.FromContext(r.Context()); ok && id.HasRole(auth.RoleAdmin) {
+		return true
+	}
+	if healthToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		return subtle.ConstantTimeCompare([]byte(token), []byte(healthToken)) == 1
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// healthResponse is the /api/health response for the whole library
+type healthResponse struct {
+	Summary   *health.Summary  `json:"summary"`
+	Documents []*health.Report `json:"documents"`
+}
+
+// handleHealth serves health reports. GET returns the latest reports, or the
+// report of one document when an id is given; POST revalidates immediately.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeHealth(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if healthMonitor == nil {
+		http.Error(w, "Health monitoring is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		report, checked := healthMonitor.Report(id)
+		if !checked || r.Method == http.MethodPost {
+			var err error
+			report, err = healthMonitor.Check(id)
+			if err != nil {
+				writeHealthError(w, r, err)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := healthMonitor.RunOnce(); err != nil {
+			writeHealthError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&healthResponse{
+		Summary:   healthMonitor.Summary(),
+		Documents: healthMonitor.Reports(),
+	})
+}
+
+func writeHealthError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	log.ErrorContext(r.Context(), "Health check failed", "error", err)
+	http.Error(w, "Health check failed", http.StatusInternalServerError)
+}
+
+// handleHealthDashboard renders the latest reports as a page for operators
+func handleHealthDashboard(w http.ResponseWriter, r *http.Request) {
+	if !authorizeHealth(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if healthMonitor == nil {
+		http.Error(w, "Health monitoring is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	summary := healthMonitor.Summary()
+	lastRun := "never"
+	if !summary.LastRun.IsZero() {
+		lastRun = summary.LastRun.Format(time.RFC1123)
+	}
+
+	var rows strings.Builder
+	for _, report := range healthMonitor.Reports() {
+		var issues []string
+		for _, issue := range report.Issues {
+			issues = append(issues, html.EscapeString(issue.Message))
+		}
+		signer := "unsigned"
+		if report.Signed {
+			signer = "signed"
+			if report.Signer != "" {
+				signer = html.EscapeString(report.Signer)
+			}
+		}
+		fmt.Fprintf(&rows, `
+            <tr class="%s">
+                <td><span class="status">%s</span></td>
+                <td><a href="/viewer?id=%s">%s</a><br><code>%s</code></td>
+                <td>%s</td>
+                <td>%s</td>
+                <td>%s</td>
+            </tr>`,
+			report.Status, report.Status, report.ID, html.EscapeString(report.Filename), report.ID,
+			signer, report.Checked.Format("2006-01-02 15:04"), strings.Join(issues, "<br>"))
+	}
+	if rows.Len() == 0 {
+		rows.WriteString(`
+            <tr><td colspan="5">No documents have been checked yet.</td></tr>`)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>LIV Library Health</title>
+    <meta charset="utf-8">
+    <meta http-equiv="refresh" content="60">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 40px; color: #212529; background: #f8f9fa; }
+        .summary { display: flex; gap: 16px; margin-bottom: 24px; }
+        .summary div { background: #fff; border: 1px solid #dee2e6; border-radius: 4px; padding: 12px 20px; }
+        .summary strong { display: block; font-size: 1.6em; }
+        table { width: 100%%; border-collapse: collapse; background: #fff; }
+        th, td { text-align: left; padding: 8px 12px; border-bottom: 1px solid #dee2e6; vertical-align: top; }
+        .status { font-weight: 600; text-transform: uppercase; font-size: 0.8em; }
+        .healthy .status { color: #198754; }
+        .warning .status { color: #b8860b; }
+        .invalid .status { color: #dc3545; }
+        .invalid { background: #fff5f5; }
+    </style>
+</head>
+<body>
+    <h1>Library Health</h1>
+    <p>Last revalidation: %s</p>
+    <div class="summary">
+        <div><strong>%d</strong>documents</div>
+        <div><strong>%d</strong>healthy</div>
+        <div><strong>%d</strong>warnings</div>
+        <div><strong>%d</strong>invalid</div>
+    </div>
+    <table>
+        <thead>
+            <tr><th>Status</th><th>Document</th><th>Signer</th><th>Checked</th><th>Issues</th></tr>
+        </thead>
+        <tbody>%s
+        </tbody>
+    </table>
+</body>
+</html>`, lastRun, summary.Documents, summary.Healthy, summary.Warning, summary.Invalid, rows.String())
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/jobs"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// jobConfig configures how conversion jobs share the server
+type jobConfig struct {
+	Workers     int
+	TenantLimit int
+	QueueLimit  int
+	// Weights give users a larger share of the workers
+	Weights map[string]int
+	// Timeout and MemoryMB are the budget of each job; zero is unlimited
+	Timeout  time.Duration
+	MemoryMB int
+}
+
+// jobScheduler runs conversion jobs in web mode
+var jobScheduler *jobs.Scheduler
+
+// jobRetryAfter is how often owners should poll unfinished jobs
+const jobRetryAfter = 2 * time.Second
+
+// startJobs creates the scheduler for conversion jobs. Without a worker count
+// half the CPUs convert documents.
+func startJobs(config jobConfig) *jobs.Scheduler {
+	exportMemory = int64(config.MemoryMB) << 20
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU() / 2
+	}
+	weights := make(map[string]float64)
+	for user, weight := range config.Weights {
+		weights[userTenant(user)] = float64(weight)
+	}
+	return jobs.New(jobs.Config{
+		Workers:     workers,
+		TenantLimit: config.TenantLimit,
+		QueueLimit:  config.QueueLimit,
+		Weights:     weights,
+		Timeout:     config.Timeout,
+	})
+}
+
+// jobTenant is who the jobs of a request belong to and share workers with:
+// the signed-in user, or the client address for anonymous viewers
+func jobTenant(r *http.Request) string {
+	user, ip := viewerOf(r)
+	if user != "" {
+		return userTenant(user)
+	}
+	return "ip:" + ip
+}
+
+func userTenant(user string) string {
+	return "user:" + user
+}
+
+// exportResult is the converted document of a succeeded job
+type exportResult struct {
+	Body        []byte
+	ContentType string
+	Filename    string
+}
+
+// jobResponse describes a job to its owner
+type jobResponse struct {
+	jobs.Status
+	ResultURL string `json:"result_url,omitempty"`
+}
+
+func newJobResponse(status jobs.Status) jobResponse {
+	response := jobResponse{Status: status}
+	if status.State == jobs.StateSucceeded || status.Partial {
+		response.ResultURL = "/api/jobs/" + status.ID + "/result"
+	}
+	return response
+}
+
+// handleJobs manages conversion jobs of the viewer's own uploads:
+//
+//	POST   /api/jobs               export a document ({"document": "<id>", "format": "pdf", "priority": "normal"})
+//	GET    /api/jobs               the viewer's jobs, newest first
+//	GET    /api/jobs/{id}          state of a job and its position in the queue
+//	GET    /api/jobs/{id}/result   download the converted document, or what was
+//	                               converted of it before the job ran out of budget
+//	DELETE /api/jobs/{id}          cancel a job
+//	GET    /api/jobs/metrics       queue activity (health access required)
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	if jobScheduler == nil {
+		http.Error(w, "Conversion jobs are disabled", http.StatusServiceUnavailable)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/")
+	tenant := jobTenant(r)
+
+	if path == "metrics" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeHealth(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeViewingJSON(w, http.StatusOK, jobScheduler.Metrics())
+		return
+	}
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodPost:
+			submitJob(w, r, tenant)
+		case http.MethodGet, http.MethodHead:
+			statuses := jobScheduler.List(tenant)
+			list := make([]jobResponse, len(statuses))
+			for i, status := range statuses {
+				list[i] = newJobResponse(status)
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			writeViewingJSON(w, http.StatusOK, map[string][]jobResponse{"jobs": list})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, action, _ := strings.Cut(path, "/")
+	var (
+		status jobs.Status
+		err    error
+	)
+	switch {
+	case action == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		status, err = jobScheduler.Get(id, tenant)
+	case action == "" && r.Method == http.MethodDelete:
+		status, err = jobScheduler.Cancel(id, tenant)
+	case action == "result" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		status, err = jobScheduler.Get(id, tenant)
+		if err == nil {
+			serveJobResult(w, r, status)
+			return
+		}
+	case action == "" || action == "result":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if !status.State.Finished() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(jobRetryAfter.Seconds())))
+	}
+	writeViewingJSON(w, http.StatusOK, newJobResponse(status))
+}
+
+// submitJob queues an export of an uploaded document
+func submitJob(w http.ResponseWriter, r *http.Request, tenant string) {
+	var request struct {
+		Document string `json:"document"`
+		Format   string `json:"format"`
+		Priority string `json:"priority"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	format := strings.ToLower(request.Format)
+	if _, ok := exportFormats[format]; !ok {
+		http.Error(w, fmt.Sprintf("Unsupported format %q (use %s)", request.Format, exportFormatNames()), http.StatusBadRequest)
+		return
+	}
+	priority, err := jobs.ParsePriority(request.Priority)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// High priority would let anyone jump the fair queue
+	if priority == jobs.PriorityHigh && !authorizeHealth(r) {
+		http.Error(w, "High priority jobs require administrator access", http.StatusForbidden)
+		return
+	}
+	if !holdsOpenDocument(r) {
+		http.Error(w, "Open the document in the viewer first", http.StatusForbidden)
+		return
+	}
+	// Exports carry the whole content, so they are held to its access policy
+	if !authorizeAccess(w, r, request.Document) {
+		return
+	}
+
+	size, err := storedDocumentSize(request.Document)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to open document", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	id := request.Document
+	timeout := jobScheduler.Config().Timeout
+	status, err := jobScheduler.Submit(jobs.Spec{
+		Tenant:   tenant,
+		Priority: priority,
+		Cost:     size,
+		Labels:   map[string]string{"document": id, "format": format},
+		Run: func(ctx context.Context) (interface{}, error) {
+			body, err := exportStoredDocument(ctx, id, format, timeout, exportMemory)
+			if err != nil {
+				log.ErrorContext(ctx, "Failed to export document", log.DocumentID, id, "format", format, "error", err)
+			}
+			if body == nil {
+				return nil, err
+			}
+			// Exports that ran out of budget keep their partial output
+			return &exportResult{Body: body, ContentType: exportFormats[format].ContentType, Filename: exportFilename(id, format)}, err
+		},
+	})
+	var full *jobs.QueueFullError
+	switch {
+	case errors.As(err, &full):
+		w.Header().Set("Retry-After", "30")
+		writeViewingJSON(w, http.StatusTooManyRequests, map[string]string{"error": full.Error()})
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+status.ID)
+	w.Header().Set("Retry-After", strconv.Itoa(int(jobRetryAfter.Seconds())))
+	writeViewingJSON(w, http.StatusAccepted, newJobResponse(status))
+}
+
+// serveJobResult sends the converted document of a succeeded job, or explains
+// why there is none. Jobs that ran out of budget send their partial output,
+// named as such.
+func serveJobResult(w http.ResponseWriter, r *http.Request, status jobs.Status) {
+	result, ok := status.Result.(*exportResult)
+	if (status.State != jobs.StateSucceeded && !status.Partial) || !ok {
+		message := fmt.Sprintf("Job is %s", status.State)
+		switch status.State {
+		case jobs.StateQueued:
+			message = fmt.Sprintf("Job is queued at position %d", status.Position)
+		case jobs.StateFailed:
+			message = "Job failed: " + status.Error
+		}
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+
+	filename := result.Filename
+	if status.Partial {
+		ext := path.Ext(filename)
+		filename = strings.TrimSuffix(filename, ext) + ".partial" + ext
+		w.Header().Set("X-Export-Incomplete", status.Error)
+	}
+	w.Header().Set("Content-Type", result.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Security-Policy", staticFallbackPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	// A strong ETag lets clients resume the download with If-Range
+	sum := sha256.Sum256(result.Body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	http.ServeContent(w, r, filename, *status.Finished, bytes.NewReader(result.Body))
+}
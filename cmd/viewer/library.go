@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+)
+
+// Weights of the fields a library search matches, so documents tagged with a
+// term rank above those that only mention it
+const (
+	searchWeightTerms       = 3 // keywords and subjects
+	searchWeightTitle       = 2
+	searchWeightDescription = 1 // description and abstract
+)
+
+// libraryDocument is an entry of the library inventory
+type libraryDocument struct {
+	ID       string    `json:"id"`
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Uploaded time.Time `json:"uploaded"`
+	// ThumbnailURL serves a preview image of the document's first page
+	ThumbnailURL string `json:"thumbnail_url"`
+	Title        string `json:"title,omitempty"`
+	// Keywords and Subjects classify the document, as its manifest does
+	Keywords []string            `json:"keywords,omitempty"`
+	Subjects []*core.SubjectInfo `json:"subjects,omitempty"`
+	// Score ranks the document in search results; unset without a query
+	Score int `json:"score,omitempty"`
+}
+
+// libraryCatalog keeps the metadata of stored documents by content hash, so
+// listing the library reads each document once. Documents no longer stored
+// are forgotten when the library is listed.
+var libraryCatalog = &catalog{entries: make(map[string]*core.DocumentMetadata)}
+
+type catalog struct {
+	mu      sync.Mutex
+	entries map[string]*core.DocumentMetadata
+}
+
+// metadata returns the metadata of an uploaded document, or nil when its
+// manifest cannot be read
+func (c *catalog) metadata(id, sha256 string) *core.DocumentMetadata {
+	c.mu.Lock()
+	metadata, ok := c.entries[sha256]
+	c.mu.Unlock()
+	if ok {
+		return metadata
+	}
+	if m, err := readDocumentManifest(id); err == nil {
+		metadata = m.Metadata
+	}
+	c.mu.Lock()
+	c.entries[sha256] = metadata
+	c.mu.Unlock()
+	return metadata
+}
+
+// retain forgets the documents whose hashes are not listed
+func (c *catalog) retain(hashes map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for hash := range c.entries {
+		if !hashes[hash] {
+			delete(c.entries, hash)
+		}
+	}
+}
+
+// libraryQuery filters and searches the library
+type libraryQuery struct {
+	// Keyword keeps documents with the keyword
+	Keyword string
+	// Subject keeps documents with a subject of the heading, or whose code
+	// starts with it, so BUS07 finds BUS071000 and 658 finds 658.4
+	Subject string
+	// Search ranks documents by the words they match, and keeps those that
+	// match any
+	Search string
+}
+
+// matches reports whether a document passes the filters of q, and its
+// search score
+func (q libraryQuery) matches(metadata *core.DocumentMetadata) (bool, int) {
+	if q.Keyword == "" && q.Subject == "" && q.Search == "" {
+		return true, 0
+	}
+	if metadata == nil {
+		return false, 0
+	}
+	if q.Keyword != "" && !containsFold(metadata.Keywords, q.Keyword) {
+		return false, 0
+	}
+	if q.Subject != "" {
+		found := false
+		for _, subject := range metadata.Subjects {
+			if subject != nil && (strings.EqualFold(subject.Label, q.Subject) ||
+				(subject.Code != "" && strings.HasPrefix(strings.ToLower(subject.Code), strings.ToLower(q.Subject)))) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, 0
+		}
+	}
+	if q.Search == "" {
+		return true, 0
+	}
+
+	terms := strings.ToLower(strings.Join(metadata.Terms(), "\n"))
+	for _, subject := range metadata.Subjects {
+		if subject != nil {
+			terms += "\n" + strings.ToLower(subject.Code)
+		}
+	}
+	title := strings.ToLower(metadata.Title)
+	description := strings.ToLower(metadata.Description + "\n" + metadata.Abstract)
+	score := 0
+	for _, word := range strings.Fields(strings.ToLower(q.Search)) {
+		if strings.Contains(terms, word) {
+			score += searchWeightTerms
+		}
+		if strings.Contains(title, word) {
+			score += searchWeightTitle
+		}
+		if strings.Contains(description, word) {
+			score += searchWeightDescription
+		}
+	}
+	return score > 0, score
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// libraryInventory is the /api/library response
+type libraryInventory struct {
+	Documents []libraryDocument `json:"documents"`
+}
+
+// handleLibrary lists the stored documents with their content hashes, so
+// another library can tell which documents it is missing. Only metadata is
+// listed; content is still fetched through /api/document, which applies the
+// viewing limits. The keyword and subject parameters filter the documents,
+// and q searches them: matches in keywords and subjects rank first, then in
+// titles, then in descriptions.
+func handleLibrary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := libraryQuery{
+		Keyword: strings.TrimSpace(r.URL.Query().Get("keyword")),
+		Subject: strings.TrimSpace(r.URL.Query().Get("subject")),
+		Search:  r.URL.Query().Get("q"),
+	}
+
+	inventory := libraryInventory{Documents: []libraryDocument{}}
+	if documentStore != nil {
+		infos, err := documentStore.List()
+		if err != nil {
+			log.ErrorContext(r.Context(), "Failed to list documents", "error", err)
+			http.Error(w, "Failed to list documents", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		hashes := make(map[string]bool)
+		for _, info := range infos {
+			if info.Expired(now) {
+				continue
+			}
+			hashes[info.SHA256] = true
+			metadata := libraryCatalog.metadata(info.ID, info.SHA256)
+			ok, score := query.matches(metadata)
+			if !ok {
+				continue
+			}
+			document := libraryDocument{
+				ID:           info.ID,
+				Filename:     info.Filename,
+				Size:         info.Size,
+				SHA256:       info.SHA256,
+				Uploaded:     info.Uploaded,
+				ThumbnailURL: thumbnailURL(info.ID),
+				Score:        score,
+			}
+			if metadata != nil {
+				document.Title = metadata.Title
+				document.Keywords = metadata.Keywords
+				document.Subjects = metadata.Subjects
+			}
+			inventory.Documents = append(inventory.Documents, document)
+		}
+		libraryCatalog.retain(hashes)
+	}
+	sort.Slice(inventory.Documents, func(i, j int) bool {
+		a, b := inventory.Documents[i], inventory.Documents[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Uploaded.Before(b.Uploaded)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(inventory)
+}
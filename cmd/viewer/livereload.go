@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// liveReloadInterval is how often the served document is checked for changes
+const liveReloadInterval = 200 * time.Millisecond
+
+// liveReload notifies open viewers when the served document is rebuilt; nil
+// unless the viewer runs with --live-reload
+var liveReload *reloadHub
+
+// reloadEvent is sent to viewers over the live reload WebSocket. A "hello"
+// event carries the current version when a viewer connects, so viewers that
+// reconnect after missing a rebuild reload as well.
+type reloadEvent struct {
+	Type     string    `json:"type"`
+	Version  int       `json:"version"`
+	Modified time.Time `json:"modified"`
+}
+
+// reloadHub tracks the version of the served document and the viewers
+// waiting for it to change
+type reloadHub struct {
+	mu       sync.Mutex
+	version  int
+	modified time.Time
+	clients  map[chan reloadEvent]bool
+}
+
+func newReloadHub() *reloadHub {
+	return &reloadHub{clients: make(map[chan reloadEvent]bool)}
+}
+
+// current returns the latest version of the document
+func (h *reloadHub) current() reloadEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return reloadEvent{Type: "hello", Version: h.version, Modified: h.modified}
+}
+
+// publish records a new version and tells every connected viewer
+func (h *reloadHub) publish(modified time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.version++
+	h.modified = modified
+	event := reloadEvent{Type: "reload", Version: h.version, Modified: modified}
+	for client := range h.clients {
+		select {
+		case client <- event:
+		default:
+			// The viewer already has a reload pending
+		}
+	}
+}
+
+func (h *reloadHub) subscribe() chan reloadEvent {
+	client := make(chan reloadEvent, 1)
+	h.mu.Lock()
+	h.clients[client] = true
+	h.mu.Unlock()
+	return client
+}
+
+func (h *reloadHub) unsubscribe(client chan reloadEvent) {
+	h.mu.Lock()
+	delete(h.clients, client)
+	h.mu.Unlock()
+}
+
+// watch polls the document and publishes a reload once a change has settled.
+// The builder rewrites the package in several steps, so a version is only
+// published after it stops changing and opens as a complete archive.
+func (h *reloadHub) watch(ctx context.Context, file string, interval time.Duration) {
+	type fileState struct {
+		size    int64
+		modTime time.Time
+	}
+	stat := func() (fileState, bool) {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fileState{}, false
+		}
+		return fileState{info.Size(), info.ModTime()}, true
+	}
+
+	published, _ := stat()
+	last := published
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		state, ok := stat()
+		if !ok || state == published {
+			continue
+		}
+		if state != last {
+			last = state
+			continue
+		}
+		if reader, err := zip.OpenReader(file); err == nil {
+			reader.Close()
+			published = state
+			h.publish(state.modTime)
+		}
+	}
+}
+
+// handleLiveReload streams reload events to a viewer over a WebSocket. Only
+// pages served by this viewer may connect.
+func handleLiveReload(w http.ResponseWriter, r *http.Request) {
+	if liveReload == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			origin, err := url.Parse(r.Header.Get("Origin"))
+			if err != nil || origin.Host != r.Host {
+				return websocket.ErrBadWebSocketOrigin
+			}
+			config.Origin = origin
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+			events := liveReload.subscribe()
+			defer liveReload.unsubscribe(events)
+
+			if err := websocket.JSON.Send(conn, liveReload.current()); err != nil {
+				return
+			}
+
+			// Viewers never send anything; reading detects when they leave
+			closed := make(chan struct{})
+			go func() {
+				var discard []byte
+				for websocket.Message.Receive(conn, &discard) == nil {
+				}
+				close(closed)
+			}()
+
+			for {
+				select {
+				case event := <-events:
+					if err := websocket.JSON.Send(conn, event); err != nil {
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// liveReloadScript returns the script that reloads the viewer when the served
+// document changes, or nothing when live reload is off
+func liveReloadScript() string {
+	if liveReload == nil {
+		return ""
+	}
+	return `
+    <script>
+        (function () {
+            var seen = null;
+            var delay = 500;
+            function connect() {
+                var scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+                var socket = new WebSocket(scheme + location.host + '/api/live-reload');
+                socket.onopen = function () { delay = 500; };
+                socket.onmessage = function (message) {
+                    var event = JSON.parse(message.data);
+                    if (event.type === 'reload' || (seen !== null && event.version !== seen)) {
+                        location.reload();
+                    }
+                    seen = event.version;
+                };
+                socket.onclose = function () {
+                    setTimeout(connect, delay);
+                    delay = Math.min(delay * 2, 5000);
+                };
+            }
+            connect();
+        })();
+    </script>`
+}
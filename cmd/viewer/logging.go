@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/log"
+)
+
+// withLogFields adds the signed-in user and the document a request is about
+// to its context, so everything logged while serving it says whose request
+// it was and which document it concerned
+func withLogFields(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var fields []interface{}
+		if id, ok := auth.FromContext(r.Context()); ok {
+			fields = append(fields, log.UserID, id.Username)
+		}
+		if id := requestedDocument(r); id != "" {
+			fields = append(fields, log.DocumentID, id)
+		}
+		if len(fields) > 0 {
+			r = r.WithContext(log.WithFields(r.Context(), fields...))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestedDocument returns the ID of the stored document a request names,
+// in its id parameter or its content or resource path
+func requestedDocument(r *http.Request) string {
+	if id := r.URL.Query().Get("id"); id != "" {
+		return id
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/api/content/"); ok {
+		id, _, _ := strings.Cut(rest, "/")
+		return id
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, documentResourcePrefix); ok {
+		id, _, _ := strings.Cut(rest, "/")
+		return id
+	}
+	return ""
+}
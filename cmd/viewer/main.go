@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/liv-format/liv/pkg/access"
+	"github.com/liv-format/liv/pkg/annotations"
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/readingstate"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/liv-format/liv/pkg/transfer"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +30,17 @@ func main() {
 		web      bool
 		fallback bool
 		debug    bool
+		storage  storeConfig
+		checks   healthConfig
+		authFile string
+		reload   bool
+		limits   viewingConfig
+		workers  sandboxConfig
+		queue    jobConfig
+		keyFiles []string
+		logging  log.Config
+
+		annotationKeyFile string
 	)
 
 	rootCmd := &cobra.Command{
@@ -31,7 +54,15 @@ Supports both desktop and web-based viewing modes.`,
 			if len(args) > 0 {
 				file = args[0]
 			}
-			return runViewer(file, port, web, fallback, debug)
+			if debug && !cmd.Flags().Changed("log-level") {
+				logging.Level = "debug"
+			}
+			logger, err := log.Setup(logging)
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+			return runViewer(file, port, web, fallback, debug, storage, checks, authFile, reload, limits, workers, queue, keyFiles, annotationKeyFile)
 		},
 	}
 
@@ -39,6 +70,38 @@ Supports both desktop and web-based viewing modes.`,
 	rootCmd.Flags().BoolVarP(&web, "web", "w", false, "Run as web server")
 	rootCmd.Flags().BoolVarP(&fallback, "fallback", "f", false, "Use static fallback mode")
 	rootCmd.Flags().BoolVarP(&debug, "debug", "d", false, "Enable debug mode")
+	rootCmd.Flags().StringVar(&storage.Dir, "store-dir", "", "Directory for uploaded documents (default <tmp>/liv-viewer/documents)")
+	rootCmd.Flags().DurationVar(&storage.TTL, "store-ttl", 24*time.Hour, "How long uploaded documents are kept (0 keeps them indefinitely)")
+	rootCmd.Flags().DurationVar(&storage.GCInterval, "store-gc-interval", 10*time.Minute, "How often expired uploads are removed")
+	rootCmd.Flags().DurationVar(&storage.LockTimeout, "store-lock-timeout", store.DefaultLockTimeout, "How long changes wait for another process sharing --store-dir before failing")
+	rootCmd.Flags().DurationVar(&checks.Interval, "health-interval", time.Hour, "How often uploaded documents are revalidated (0 disables health monitoring)")
+	rootCmd.Flags().StringVar(&checks.RootsFile, "trust-roots", "", "PEM file of root certificates trusted to sign documents")
+	rootCmd.Flags().StringVar(&checks.RevocationFile, "revocation-list", "", "File of revoked certificate serial numbers, re-read on every revalidation")
+	rootCmd.Flags().StringVar(&checks.Webhook, "health-webhook", "", "URL notified with a JSON alert when a document becomes invalid")
+	rootCmd.Flags().StringVar(&checks.Token, "health-token", "", "Bearer token for the health dashboard and API (default: loopback clients only)")
+	rootCmd.Flags().StringVar(&authFile, "auth-config", "", "Authentication config file enabling LDAP/Active Directory and SAML sign-in")
+	rootCmd.Flags().BoolVar(&reload, "live-reload", false, "Reload open viewers when the served file changes")
+	rootCmd.Flags().StringVar(&limits.PolicyFile, "viewing-policy", "", "Security policy JSON file whose resource limits cap the documents each viewer may have open")
+	rootCmd.Flags().IntVar(&limits.PerUser, "max-open-documents", 0, "Documents each signed-in user may have open at once (0: policy or unlimited)")
+	rootCmd.Flags().IntVar(&limits.PerIP, "max-open-documents-per-ip", 0, "Documents each anonymous client address may have open at once (0: policy or unlimited)")
+	rootCmd.Flags().BoolVar(&workers.Enabled, "sandbox", false, "Validate and render uploaded documents in worker processes under resource limits")
+	rootCmd.Flags().StringVar(&workers.PolicyFile, "sandbox-policy", "", "Security policy JSON file whose resource limits apply to sandboxed workers (implies --sandbox)")
+	rootCmd.Flags().StringVar(&workers.Cgroup, "sandbox-cgroup", "", "Delegated cgroup v2 directory for worker cgroups (default: the viewer's own cgroup; implies --sandbox)")
+	rootCmd.Flags().IntVar(&queue.Workers, "job-workers", 0, "Conversion jobs run at once (0: half the CPUs)")
+	rootCmd.Flags().IntVar(&queue.TenantLimit, "job-tenant-limit", 2, "Conversion jobs each user or anonymous address may run at once (0: no limit beyond --job-workers)")
+	rootCmd.Flags().IntVar(&queue.QueueLimit, "job-queue-limit", 20, "Conversion jobs each user or anonymous address may have waiting (0: unlimited)")
+	rootCmd.Flags().StringToIntVar(&queue.Weights, "job-weight", nil, "Share of the conversion workers given to a user relative to others, as user=weight (default 1)")
+	rootCmd.Flags().DurationVar(&queue.Timeout, "job-timeout", 2*time.Minute, "Time each conversion job may run before it stops and keeps its partial output (0: unlimited)")
+	rootCmd.Flags().IntVar(&queue.MemoryMB, "job-memory", 512, "Memory in MB each conversion job may use (0: unlimited); a hard limit in sandboxed workers, estimated otherwise")
+	rootCmd.Flags().StringArrayVar(&keyFiles, "trusted-key", nil, "PEM public key whose document signatures the viewer shows as verified (repeatable)")
+	rootCmd.Flags().Int64Var(&offlineLimits.CacheMB, "offline-cache-mb", offlineLimits.CacheMB, "Space in MB each browser may use to keep the documents it opened readable offline (0 keeps none)")
+	rootCmd.Flags().Int64Var(&offlineLimits.DocumentMB, "offline-document-mb", offlineLimits.DocumentMB, "Largest document in MB browsers keep readable offline")
+	rootCmd.Flags().DurationVar(&clockSkew, "clock-skew", clockSkew, "How far the clocks of signers and the viewer may disagree before document times are reported as in the future and certificates as outside their validity period")
+	rootCmd.Flags().StringVar(&annotationKeyFile, "annotation-key", "", "PEM private key signing the revisions readers embed their annotations in (default: unsigned)")
+	rootCmd.Flags().StringVar(&logging.Level, "log-level", "info", "Log level (debug, info, warn, error); --debug sets debug")
+	rootCmd.Flags().StringVar(&logging.Format, "log-format", "json", "Log format (json, text)")
+	rootCmd.Flags().StringVar(&logging.Output, "log-output", "stderr", "Comma-separated log sinks: stderr, stdout, syslog, syslog://host:port, syslog+tcp://host:port or a file path")
+	rootCmd.AddCommand(workerCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -46,40 +109,178 @@ Supports both desktop and web-based viewing modes.`,
 	}
 }
 
-func runViewer(file string, port int, web, fallback, debug bool) error {
+func runViewer(file string, port int, web, fallback, debug bool, storage storeConfig, checks healthConfig, authFile string, reload bool, limits viewingConfig, workers sandboxConfig, queue jobConfig, keyFiles []string, annotationKeyFile string) error {
 	if web {
-		return runWebViewer(file, port, fallback, debug)
+		return runWebViewer(file, port, fallback, debug, storage, checks, authFile, reload, limits, workers, queue, keyFiles, annotationKeyFile)
 	}
 	return runDesktopViewer(file, fallback, debug)
 }
 
-func runWebViewer(file string, port int, fallback, debug bool) error {
-	fmt.Printf("Starting LIV web viewer on port %d\n", port)
+func runWebViewer(file string, port int, fallback, debug bool, storage storeConfig, checks healthConfig, authFile string, reload bool, limits viewingConfig, workers sandboxConfig, queue jobConfig, keyFiles []string, annotationKeyFile string) error {
+	log.Info("Starting LIV web viewer", "port", port)
 	
 	if file != "" {
-		fmt.Printf("Serving file: %s\n", file)
+		log.Info("Serving file", "file", file)
+		servedDocument = file
 	}
 	
 	if fallback {
-		fmt.Println("Using static fallback mode")
+		log.Info("Using static fallback mode")
+		staticFallbackMode = true
+	}
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	docStore, err := openDocumentStore(ctx, storage)
+	if err != nil {
+		return fmt.Errorf("failed to open document store: %v", err)
+	}
+	documentStore = docStore
+	
+	uploads, err := openUploadStore(ctx, storage)
+	if err != nil {
+		return fmt.Errorf("failed to open upload store: %v", err)
+	}
+	uploadStore = uploads
+	
+	if checks.Interval > 0 {
+		monitor, err := startHealthMonitor(ctx, docStore, checks)
+		if err != nil {
+			return fmt.Errorf("failed to start health monitoring: %v", err)
+		}
+		healthMonitor = monitor
+		healthToken = checks.Token
+		log.Info("Revalidating uploaded documents", "interval", checks.Interval.String(), "dashboard", "/health")
+	}
+	
+	keys, err := loadTrustedKeys(keyFiles)
+	if err != nil {
+		return err
+	}
+	trustedKeys = keys
+	if len(keys) > 0 {
+		log.Info("Verifying document signatures", "trusted_keys", len(keys))
+	}
+	
+	notes, err := annotations.NewStore(filepath.Join(storage.dir(), "annotations"))
+	if err != nil {
+		return fmt.Errorf("failed to open annotation store: %v", err)
+	}
+	annotationStore = notes
+	
+	states, err := readingstate.NewStore(filepath.Join(storage.dir(), "reading-state"))
+	if err != nil {
+		return fmt.Errorf("failed to open reading state store: %v", err)
+	}
+	readingStateStore = states
+	
+	counter, err := access.NewCounter(filepath.Join(storage.dir(), "access"))
+	if err != nil {
+		return fmt.Errorf("failed to open access counts: %v", err)
+	}
+	accessCounter = counter
+	if annotationKeyFile != "" {
+		key, err := integrity.NewSignatureManager().LoadPrivateKeyPEM(annotationKeyFile)
+		if err != nil {
+			return fmt.Errorf("invalid annotation key %s: %v", annotationKeyFile, err)
+		}
+		annotationKey = key
+		log.Info("Signing annotated revisions", "key_id", integrity.NewSignatureManager().KeyID(key.Public()))
+	}
+	
+	if authFile != "" {
+		a, err := auth.LoadAuthenticator(authFile, "Sign in to LIV Library")
+		if err != nil {
+			return fmt.Errorf("failed to configure authentication: %v", err)
+		}
+		authenticator = a
+		log.Info("Sign-in required", "login", auth.PathPrefix+"login")
 	}
 	
+	if reload && file != "" {
+		liveReload = newReloadHub()
+		go liveReload.watch(ctx, file, liveReloadInterval)
+		log.Info("Live reload enabled")
+	}
+	
+	tracker, err := startViewingLimits(limits)
+	if err != nil {
+		return fmt.Errorf("failed to configure viewing limits: %v", err)
+	}
+	if tracker != nil {
+		viewingTracker = tracker
+		l := tracker.Limits()
+		log.Info("Limiting open documents (0 is unlimited)", "per_user", l.PerUser, "per_address", l.PerIP)
+	}
+	
+	box, err := startSandbox(workers)
+	if err != nil {
+		return fmt.Errorf("failed to configure sandbox: %v", err)
+	}
+	if box != nil {
+		workerSandbox = box
+		l := box.Limits()
+		if box.Enforced() {
+			log.Info("Processing uploads in sandboxed workers", "memory_mb", l.Memory>>20, "cpu_time", l.CPUTime.String(), "timeout", l.Timeout.String())
+		} else {
+			log.Warn("Processing uploads in workers without cgroup limits; only the timeout applies", "reason", box.Degraded(), "timeout", l.Timeout.String())
+		}
+	}
+	
+	jobScheduler = startJobs(queue)
+	defer jobScheduler.Close()
+	jobsConfig := jobScheduler.Config()
+	log.Info("Running conversion jobs (0 is unlimited)", "workers", jobsConfig.Workers, "per_tenant", jobsConfig.TenantLimit, "timeout", jobsConfig.Timeout.String(), "memory_mb", queue.MemoryMB)
+	
 	// Set up HTTP handlers
 	http.HandleFunc("/", handleIndex)
 	http.HandleFunc("/viewer", handleViewer)
-	http.HandleFunc("/api/document", handleDocument)
+	http.HandleFunc("/api/document", requireViewing(requireAccess(handleDocument)))
 	http.HandleFunc("/api/upload", handleUpload)
+	http.HandleFunc("/api/patch", requireAccess(handlePatch))
+	http.HandleFunc(uploadsPath, handleUploads)
+	http.HandleFunc(uploadsPath+"/", handleUploads)
 	http.HandleFunc("/api/validate", handleValidate)
+	http.HandleFunc("/api/resource", requireViewing(requireAccess(handleResource)))
+	http.HandleFunc(documentResourcePrefix, requireViewing(requireAccess(handleDocumentResource)))
+	http.HandleFunc("/api/og-image", requireAccess(handleOGImage))
+	http.HandleFunc("/api/thumbnail", requireAccess(handleThumbnail))
+	http.HandleFunc("/api/health", handleHealth)
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/health", handleHealthDashboard)
 	http.HandleFunc("/static/", handleStatic)
 	http.HandleFunc("/manifest.json", handleManifest)
 	http.HandleFunc("/sw.js", handleServiceWorker)
+	http.HandleFunc("/api/live-reload", handleLiveReload)
+	http.HandleFunc("/api/viewing", handleViewing)
+	http.HandleFunc("/api/viewing/", handleViewing)
+	http.HandleFunc("/api/access", requireViewing(handleAccess))
+	http.HandleFunc("/api/jobs", handleJobs)
+	http.HandleFunc("/api/jobs/", handleJobs)
+	http.HandleFunc("/api/verify", requireViewing(handleVerify))
+	http.HandleFunc("/api/events", requireViewing(handleEvents))
+	http.HandleFunc("/api/authors", requireViewing(handleAuthors))
+	http.HandleFunc("/api/library", handleLibrary)
+	http.HandleFunc("/api/content/", requireViewing(requireAccess(handleContent)))
+	http.HandleFunc("/api/data/", requireViewing(requireAccess(handleData)))
+	http.HandleFunc(annotationsPath, requireViewing(handleAnnotations))
+	http.HandleFunc(annotationsPath+"/", requireViewing(handleAnnotations))
+	http.HandleFunc(readingStatePath, requireViewing(handleReadingState))
+	http.HandleFunc(sectionsPath, requireViewing(requireAccess(handleSections)))
+	http.HandleFunc("/api/capabilities", handleCapabilities)
+	http.HandleFunc("/api/usage", handleUsage)
+	http.HandleFunc("/api/usage/rendering", requireViewing(handleRenderingUsage))
 	
 	// Serve the viewer
 	addr := fmt.Sprintf(":%d", port)
-	fmt.Printf("LIV Viewer available at http://localhost%s\n", addr)
-	fmt.Printf("Progressive Web App features enabled\n")
+	log.Info("LIV Viewer available", "url", "http://localhost"+addr)
 	
-	return http.ListenAndServe(addr, nil)
+	handler := withLogFields(http.DefaultServeMux)
+	if authenticator != nil {
+		handler = protectLibrary(authenticator, handler)
+	}
+	return http.ListenAndServe(addr, handler)
 }
 
 func runDesktopViewer(file string, fallback, debug bool) error {
@@ -302,6 +503,12 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             border: 1px solid #ffcdd2;
         }
         
+        .upload-progress {
+            width: 100%;
+            height: 0.75rem;
+            margin-top: 0.75rem;
+        }
+        
         .features {
             display: grid;
             grid-template-columns: repeat(auto-fit, minmax(250px, 1fr));
@@ -438,6 +645,54 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                 background: #404040;
             }
         }
+        
+        /* Documents opened in the browser cover the start page */
+        body.local-open {
+            overflow: hidden;
+        }
+        
+        .local-view {
+            position: fixed;
+            inset: 0;
+            display: flex;
+            flex-direction: column;
+            background: white;
+            z-index: 1000;
+        }
+        
+        .local-bar {
+            display: flex;
+            align-items: center;
+            gap: 1rem;
+            padding: 0.5rem 1rem;
+            border-bottom: 1px solid #e0e0e0;
+            background: #f8f9fa;
+        }
+        
+        .local-title {
+            flex: 1;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            white-space: nowrap;
+        }
+        
+        .local-trust {
+            font-size: 0.875rem;
+        }
+        
+        .local-trust-verified {
+            color: #2e7d32;
+        }
+        
+        .local-trust-warning {
+            color: #c62828;
+        }
+        
+        .local-content {
+            flex: 1;
+            width: 100%;
+            border: 0;
+        }
     </style>
 </head>
 <body>
@@ -469,11 +724,12 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             <div class="upload-area" onclick="document.getElementById('fileInput').click()">
                 <div class="upload-icon">📁</div>
                 <p class="upload-text">Click here or drag and drop a .liv file</p>
-                <p class="upload-hint">Supports .liv documents up to 100MB</p>
+                <p class="upload-hint">Supports .liv documents up to 100MB; documents open in your browser without uploading where they can</p>
                 <input type="file" id="fileInput" accept=".liv" onchange="handleFile(this.files[0])">
             </div>
             
             <div id="status" class="status"></div>
+            <progress id="upload-progress" class="upload-progress" max="100" value="0" hidden></progress>
         </div>
 
         <div class="features">
@@ -500,6 +756,7 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
         </div>
     </main>
 
+    <script src="/static/js/liv-local.js"></script>
     <script>
         // Progressive Web App support
         let deferredPrompt;
@@ -562,22 +819,30 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                     return;
                 }
                 
-                showStatus('Uploading document...', 'info');
-                
-                // Upload file to server
-                const formData = new FormData();
-                formData.append('document', file);
-                
-                const response = await fetch('/api/upload', {
-                    method: 'POST',
-                    body: formData
-                });
-                
-                if (!response.ok) {
-                    throw new Error('Upload failed');
+                // Open the document in this browser where it can be, and
+                // upload it otherwise
+                showStatus('Opening document...', 'info');
+                if (await LIVLocal.open(file, { upload: () => uploadDocument(file) })) {
+                    showStatus('Document opened in your browser', 'success');
+                    return;
                 }
                 
-                const result = await response.json();
+                await uploadDocument(file);
+            } catch (error) {
+                console.error('File handling error:', error);
+                showStatus('Failed to load document: ' + error.message, 'error');
+            }
+        }
+        
+        // uploadDocument uploads a document and opens it in the viewer
+        async function uploadDocument(file) {
+            try {
+                showStatus('Uploading document...', 'info');
+                
+                // Upload file to server in chunks, resuming where an
+                // interrupted upload of the same file stopped
+                const result = await uploadResumable(file, showProgress);
+                document.getElementById('upload-progress').hidden = true;
                 showStatus('Document loaded successfully!', 'success');
                 
                 // Redirect to viewer
@@ -587,10 +852,125 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                 
             } catch (error) {
                 console.error('File handling error:', error);
+                document.getElementById('upload-progress').hidden = true;
                 showStatus('Failed to load document: ' + error.message, 'error');
             }
         }
         
+        const UPLOAD_CHUNK_SIZE = 4 * 1024 * 1024;
+        const UPLOAD_RETRIES = 6;
+        
+        // uploadResumable sends a file to /api/uploads following the tus
+        // protocol. Each chunk carries its SHA-256 when the browser can
+        // compute it; failed chunks are retried with backoff from the
+        // offset the server reports.
+        async function uploadResumable(file, onProgress) {
+            const tus = { 'Tus-Resumable': '1.0.0' };
+            const key = 'liv-upload:' + file.name + ':' + file.size + ':' + file.lastModified;
+            let url = localStorage.getItem(key);
+            let offset = url ? await uploadOffset(url, tus) : null;
+            if (offset === null) {
+                const created = await fetch('/api/uploads', {
+                    method: 'POST',
+                    headers: Object.assign({
+                        'Upload-Length': String(file.size),
+                        'Upload-Metadata': 'filename ' + base64(new TextEncoder().encode(file.name))
+                    }, tus)
+                });
+                if (!created.ok) {
+                    throw new Error((await created.text()).trim() || 'Upload failed');
+                }
+                url = created.headers.get('Location');
+                offset = 0;
+                localStorage.setItem(key, url);
+            }
+            
+            let failures = 0;
+            for (;;) {
+                onProgress(offset, file.size);
+                const chunk = file.slice(offset, offset + UPLOAD_CHUNK_SIZE);
+                const headers = Object.assign({
+                    'Content-Type': 'application/offset+octet-stream',
+                    'Upload-Offset': String(offset)
+                }, tus);
+                if (window.crypto && crypto.subtle) {
+                    const digest = await crypto.subtle.digest('SHA-256', await chunk.arrayBuffer());
+                    headers['Upload-Checksum'] = 'sha256 ' + base64(new Uint8Array(digest));
+                }
+                
+                let response = null;
+                try {
+                    response = await fetch(url, { method: 'PATCH', headers: headers, body: chunk });
+                } catch (error) {
+                    console.warn('Upload chunk failed:', error);
+                }
+                if (response && response.status === 200) {
+                    localStorage.removeItem(key);
+                    onProgress(file.size, file.size);
+                    return response.json();
+                }
+                if (response && response.status === 204) {
+                    offset = parseInt(response.headers.get('Upload-Offset'), 10);
+                    failures = 0;
+                    continue;
+                }
+                // Conflicts, checksum mismatches, locked uploads and server
+                // or network errors are retried; other refusals are final
+                const retryable = !response || response.status >= 500 || [409, 423, 460].includes(response.status);
+                if (!retryable) {
+                    localStorage.removeItem(key);
+                    throw new Error((await response.text()).trim() || 'Upload failed');
+                }
+                if (++failures > UPLOAD_RETRIES) {
+                    throw new Error('connection lost; choose the file again to resume the upload');
+                }
+                showStatus('Connection interrupted, retrying upload...', 'info');
+                await new Promise((resolve) => setTimeout(resolve, 500 * Math.pow(2, failures)));
+                const reached = await uploadOffset(url, tus);
+                if (reached === null) {
+                    localStorage.removeItem(key);
+                    throw new Error('the upload expired; choose the file again');
+                }
+                offset = reached;
+            }
+        }
+        
+        // uploadOffset asks how much of an upload the server holds, or
+        // returns null when the upload no longer exists
+        async function uploadOffset(url, tus) {
+            for (let attempt = 0; attempt < UPLOAD_RETRIES; attempt++) {
+                try {
+                    const response = await fetch(url, { method: 'HEAD', headers: tus, cache: 'no-store' });
+                    if (response.ok) {
+                        return parseInt(response.headers.get('Upload-Offset'), 10);
+                    }
+                    if (response.status < 500) {
+                        return null;
+                    }
+                } catch (error) {
+                    console.warn('Upload status unavailable:', error);
+                }
+                await new Promise((resolve) => setTimeout(resolve, 500 * Math.pow(2, attempt + 1)));
+            }
+            throw new Error('server unreachable; choose the file again to resume the upload');
+        }
+        
+        function base64(bytes) {
+            let binary = '';
+            for (let i = 0; i < bytes.length; i++) {
+                binary += String.fromCharCode(bytes[i]);
+            }
+            return btoa(binary);
+        }
+        
+        function showProgress(sent, total) {
+            const progress = document.getElementById('upload-progress');
+            const percent = total > 0 ? Math.floor(sent * 100 / total) : 100;
+            progress.hidden = false;
+            progress.value = percent;
+            showStatus('Uploading document... ' + percent + '% (' + (sent / 1048576).toFixed(1) + ' of ' + (total / 1048576).toFixed(1) + ' MB)', 'info');
+        }
+        
         async function validateDocument(file) {
             // Basic validation - check if it's a ZIP file (LIV files are ZIP-based)
             const buffer = await file.slice(0, 4).arrayBuffer();
@@ -684,6 +1064,24 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Clients without JavaScript get the server-rendered static fallback
+	w.Header().Add("Vary", "User-Agent")
+	if prefersStaticFallback(r) {
+		handleStaticFallback(w, r, documentID)
+		return
+	}
+	
+	// Documents whose security policy the viewer cannot enforce are not rendered
+	var policyErr *policyError
+	if documentID != "" {
+		if _, err := storedContentPolicy(documentID); errors.As(err, &policyErr) {
+			http.Error(w, "This document cannot be shown: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	w.Header().Set("Content-Security-Policy", viewerPageCSP)
+	w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	
 	documentName := file
 	if documentName == "" {
 		documentName = "Document " + documentID
@@ -696,6 +1094,7 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
     <meta charset="utf-8">
     <meta name="viewport" content="width=device-width, initial-scale=1, user-scalable=no">
     <meta name="theme-color" content="#007bff">
+    <noscript><meta http-equiv="refresh" content="0; url=%s"></noscript>%s
     
     <style>
         :root {
@@ -771,6 +1170,74 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             max-width: 300px;
         }
         
+        .trust-badge {
+            font-size: 0.75rem;
+            font-weight: 600;
+            padding: 0.25rem 0.5rem;
+            border-radius: var(--border-radius);
+            border: 1px solid currentColor;
+            white-space: nowrap;
+            cursor: help;
+        }
+        
+        .trust-verified {
+            color: #198754;
+        }
+        
+        .trust-untrusted {
+            color: #b8860b;
+        }
+        
+        .trust-tampered {
+            color: #dc3545;
+        }
+        
+        .trust-unsigned {
+            color: var(--text-secondary);
+        }
+        
+        .capability-notice {
+            padding: 0.5rem 1rem;
+            font-size: 0.875rem;
+            background: #fff3cd;
+            color: #664d03;
+            border-bottom: 1px solid var(--border);
+        }
+        
+        .find-bar {
+            position: absolute;
+            top: 0.5rem;
+            right: 1rem;
+            z-index: 20;
+            display: flex;
+            align-items: center;
+            gap: 0.25rem;
+            padding: 0.25rem 0.5rem;
+            background: var(--surface);
+            border: 1px solid var(--border);
+            border-radius: 6px;
+            box-shadow: 0 2px 8px rgba(0, 0, 0, 0.15);
+        }
+        
+        .find-bar[hidden] {
+            display: none;
+        }
+        
+        .find-bar input {
+            width: 14rem;
+            padding: 0.25rem 0.5rem;
+            border: 1px solid var(--border);
+            border-radius: 4px;
+            font-size: 0.875rem;
+        }
+        
+        .find-count {
+            min-width: 5rem;
+            font-size: 0.75rem;
+            color: var(--text-secondary);
+            text-align: center;
+        }
+        
         .viewer-content {
             flex: 1;
             background: var(--surface);
@@ -785,6 +1252,29 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             border: none;
             background: var(--surface);
             position: relative;
+            overflow: auto;
+        }
+        
+        .zoom-stage {
+            height: 100%%;
+        }
+        
+        .zoom-stage.zoom-paged {
+            margin: 16px auto;
+            overflow: hidden;
+            background: white;
+            box-shadow: var(--shadow);
+        }
+        
+        .zoom-sheet {
+            transform-origin: 0 0;
+            overflow: auto;
+        }
+        
+        .zoom-sheet > .document-content {
+            display: block;
+            height: 100%%;
+            min-height: 0;
         }
         
         .loading-overlay {
@@ -840,6 +1330,14 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             cursor: not-allowed;
         }
         
+        .btn[hidden] {
+            display: none;
+        }
+        
+        a.btn {
+            text-decoration: none;
+        }
+        
         .btn-secondary {
             background: var(--text-secondary);
         }
@@ -875,6 +1373,15 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             color: var(--text-secondary);
         }
         
+        .zoom-controls .btn-icon[aria-pressed="true"] {
+            background: var(--surface);
+            color: var(--primary-color);
+        }
+        
+        #offlineToggle[aria-pressed="true"] {
+            color: var(--primary-color);
+        }
+        
         .error-message {
             background: #ffebee;
             color: #c62828;
@@ -885,6 +1392,58 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             text-align: center;
         }
         
+        .liv-unlock-overlay {
+            position: fixed;
+            inset: 0;
+            background: rgba(0,0,0,0.5);
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            z-index: 2000;
+        }
+        
+        .liv-unlock-dialog {
+            background: var(--surface);
+            color: var(--text-primary);
+            padding: 1.5rem;
+            border-radius: var(--border-radius);
+            box-shadow: var(--shadow);
+            width: min(420px, 90vw);
+            display: flex;
+            flex-direction: column;
+            gap: 0.75rem;
+        }
+        
+        .liv-unlock-dialog label {
+            display: flex;
+            flex-direction: column;
+            gap: 0.25rem;
+            font-size: 0.875rem;
+        }
+        
+        .liv-unlock-actions {
+            display: flex;
+            justify-content: flex-end;
+            gap: 0.5rem;
+        }
+        
+        .liv-redacted {
+            display: flex;
+            align-items: center;
+            gap: 0.75rem;
+            padding: 1rem;
+            border: 1px dashed var(--border);
+            border-radius: var(--border-radius);
+            background: var(--background);
+            color: var(--text-secondary);
+            font-style: italic;
+        }
+        
+        .liv-redacted-error {
+            color: #c62828;
+            font-size: 0.875rem;
+        }
+        
         .progress-bar {
             width: 100%%;
             height: 4px;
@@ -902,37 +1461,337 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             width: 0%%;
         }
         
-        /* Responsive Design */
-        @media (max-width: 768px) {
-            .toolbar {
-                padding: 0 0.5rem;
-                height: 50px;
-            }
-            
-            .toolbar-center {
-                gap: 0.5rem;
-            }
-            
-            .toolbar-right {
-                gap: 0.25rem;
-            }
-            
-            .document-title {
-                max-width: 150px;
-                font-size: 0.875rem;
-            }
-            
-            .btn {
-                padding: 0.375rem 0.75rem;
-                font-size: 0.8rem;
-            }
-            
-            .zoom-controls {
-                display: none; /* Hide on mobile */
-            }
-            
-            .viewer-content {
-                height: calc(100vh - 50px);
+        .document-content {
+            width: 100%%;
+            min-height: 80vh;
+            border: 0;
+            background: var(--surface);
+        }
+        
+        .events-panel, .annotations-panel, .bookmarks-panel {
+            position: absolute;
+            top: 0;
+            right: 0;
+            bottom: 0;
+            width: min(360px, 100%%);
+            overflow-y: auto;
+            background: var(--surface);
+            border-left: 1px solid var(--border);
+            box-shadow: var(--shadow);
+            padding: 1rem;
+            z-index: 10;
+        }
+        
+        .events-header {
+            display: flex;
+            align-items: center;
+            justify-content: space-between;
+            gap: 0.5rem;
+            margin-bottom: 1rem;
+        }
+        
+        .events-header h2 {
+            font-size: 1.125rem;
+        }
+        
+        .events-timeline, .events-list {
+            list-style: none;
+            margin: 0;
+            padding: 0;
+        }
+        
+        .events-day h3 {
+            font-size: 0.875rem;
+            color: var(--text-secondary);
+            margin: 1rem 0 0.5rem;
+        }
+        
+        .event-item {
+            border-left: 3px solid var(--primary-color);
+            padding-left: 0.75rem;
+            margin-bottom: 0.5rem;
+        }
+        
+        .event-item.event-past {
+            border-left-color: var(--border);
+            opacity: 0.6;
+        }
+        
+        .event-item.event-now {
+            border-left-color: #198754;
+        }
+        
+        .event-item.event-next .event-title {
+            font-weight: 600;
+        }
+        
+        .event-summary {
+            display: flex;
+            flex-direction: column;
+            align-items: flex-start;
+            width: 100%%;
+            background: none;
+            border: 0;
+            padding: 0.25rem 0;
+            color: inherit;
+            font: inherit;
+            text-align: left;
+            cursor: pointer;
+        }
+        
+        .event-time, .event-location {
+            font-size: 0.8rem;
+            color: var(--text-secondary);
+        }
+        
+        .event-details {
+            display: flex;
+            flex-direction: column;
+            gap: 0.375rem;
+            padding-bottom: 0.5rem;
+            font-size: 0.875rem;
+        }
+        
+        .event-description {
+            white-space: pre-line;
+        }
+        
+        .annotations-header, .annotations-tools, .annotations-footer {
+            display: flex;
+            align-items: center;
+            flex-wrap: wrap;
+            gap: 0.5rem;
+            margin-bottom: 1rem;
+        }
+        
+        .annotations-header {
+            justify-content: space-between;
+        }
+        
+        .annotations-header h2 {
+            font-size: 1.125rem;
+        }
+        
+        .annotations-mode, .annotations-hint, .annotation-meta {
+            font-size: 0.8rem;
+            color: var(--text-secondary);
+        }
+        
+        .annotations-tools [aria-pressed="true"] {
+            background: var(--primary-color);
+            color: #fff;
+        }
+        
+        .annotations-list {
+            list-style: none;
+            margin: 0 0 1rem;
+            padding: 0;
+        }
+        
+        .annotation-item {
+            padding: 0.5rem 0;
+            border-bottom: 1px solid var(--border);
+            font-size: 0.875rem;
+        }
+        
+        .annotation-item.annotation-focused {
+            background: var(--background);
+        }
+        
+        .annotation-swatch {
+            display: inline-block;
+            width: 0.75rem;
+            height: 0.75rem;
+            margin-right: 0.5rem;
+            border-radius: 2px;
+        }
+        
+        .annotation-text {
+            white-space: pre-line;
+            margin: 0.25rem 0;
+        }
+        
+        .annotation-actions {
+            display: flex;
+            gap: 0.375rem;
+            margin-top: 0.375rem;
+        }
+        
+        .outline-panel {
+            position: absolute;
+            top: 0;
+            left: 0;
+            bottom: 0;
+            width: min(300px, 100%%);
+            overflow-y: auto;
+            background: var(--surface);
+            border-right: 1px solid var(--border);
+            box-shadow: var(--shadow);
+            padding: 1rem 0.5rem;
+            z-index: 10;
+        }
+        
+        .outline-header {
+            display: flex;
+            align-items: baseline;
+            justify-content: space-between;
+            gap: 0.5rem;
+            padding: 0 0.5rem;
+            margin-bottom: 0.75rem;
+        }
+        
+        .outline-header h2 {
+            font-size: 1.125rem;
+        }
+        
+        .outline-summary {
+            color: var(--text-secondary);
+            font-size: 0.8rem;
+        }
+        
+        .outline-tree, .outline-group {
+            list-style: none;
+            margin: 0;
+            padding: 0;
+        }
+        
+        .outline-group {
+            padding-left: 1rem;
+        }
+        
+        .outline-item[aria-expanded="false"] > .outline-group {
+            display: none;
+        }
+        
+        .outline-item:focus {
+            outline: none;
+        }
+        
+        .outline-item:focus-visible > .outline-row {
+            outline: 2px solid var(--primary-color);
+            outline-offset: -2px;
+        }
+        
+        .outline-row {
+            display: flex;
+            align-items: center;
+            gap: 0.375rem;
+            padding: 0.3rem 0.5rem;
+            border-radius: 4px;
+            font-size: 0.875rem;
+            cursor: pointer;
+        }
+        
+        .outline-row:hover {
+            background: var(--background);
+        }
+        
+        .outline-item[aria-current] > .outline-row {
+            background: var(--background);
+            color: var(--primary-color);
+            font-weight: 600;
+        }
+        
+        .outline-twisty {
+            flex: none;
+            width: 1rem;
+            text-align: center;
+            color: var(--text-secondary);
+        }
+        
+        .outline-item[aria-expanded="true"] > .outline-row .outline-twisty::before {
+            content: "▾";
+        }
+        
+        .outline-item[aria-expanded="false"] > .outline-row .outline-twisty::before {
+            content: "▸";
+        }
+        
+        .outline-title {
+            flex: 1;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            white-space: nowrap;
+        }
+        
+        .outline-progress {
+            flex: none;
+            width: 2.5rem;
+            height: 4px;
+            border-radius: 2px;
+            background: var(--border);
+            overflow: hidden;
+        }
+        
+        .outline-progress-fill {
+            display: block;
+            height: 100%%;
+            background: var(--primary-color);
+        }
+        
+        .outline-read > .outline-row .outline-title {
+            color: var(--text-secondary);
+        }
+        
+        .bookmarks-list {
+            list-style: none;
+            margin: 1rem 0;
+            padding: 0;
+        }
+        
+        .bookmark-item {
+            padding: 0.5rem 0;
+            border-bottom: 1px solid var(--border);
+            font-size: 0.875rem;
+        }
+        
+        .bookmark-label {
+            background: none;
+            border: 0;
+            padding: 0;
+            color: var(--primary-color);
+            font: inherit;
+            text-align: left;
+            cursor: pointer;
+        }
+        
+        .document-snapshot {
+            display: block;
+            max-width: 100%%;
+            margin: 0 auto;
+        }
+        
+        /* Responsive Design */
+        @media (max-width: 768px) {
+            .toolbar {
+                padding: 0 0.5rem;
+                height: 50px;
+            }
+            
+            .toolbar-center {
+                gap: 0.5rem;
+            }
+            
+            .toolbar-right {
+                gap: 0.25rem;
+            }
+            
+            .document-title {
+                max-width: 150px;
+                font-size: 0.875rem;
+            }
+            
+            .btn {
+                padding: 0.375rem 0.75rem;
+                font-size: 0.8rem;
+            }
+            
+            .zoom-controls {
+                display: none; /* Hide on mobile */
+            }
+            
+            .viewer-content {
+                height: calc(100vh - 50px);
             }
         }
         
@@ -977,14 +1836,23 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                     <span>←</span>
                     <span>Back</span>
                 </button>
+                <button class="btn btn-icon" id="outlineToggle" onclick="LIVOutline.toggle()" title="Outline (Alt+O)" aria-controls="outlinePanel" aria-expanded="false" hidden>
+                    <span>☰</span>
+                </button>
+                <button class="btn btn-icon" id="historyBack" onclick="LIVNavigation.back()" title="Previous place in the document (Alt+Left)" disabled hidden>‹</button>
+                <button class="btn btn-icon" id="historyForward" onclick="LIVNavigation.forward()" title="Next place in the document (Alt+Right)" disabled hidden>›</button>
             </div>
             
             <div class="toolbar-center">
                 <div class="document-title" id="documentTitle">%s</div>
-                <div class="zoom-controls">
-                    <button class="btn btn-icon" onclick="zoomOut()" title="Zoom Out">−</button>
+                <span class="trust-badge" id="trustBadge" hidden></span>
+                <div class="zoom-controls" role="group" aria-label="Zoom">
+                    <button class="btn btn-icon" onclick="zoomOut()" title="Zoom Out (Ctrl+-)">−</button>
                     <div class="zoom-level" id="zoomLevel">100%%</div>
-                    <button class="btn btn-icon" onclick="zoomIn()" title="Zoom In">+</button>
+                    <button class="btn btn-icon" onclick="zoomIn()" title="Zoom In (Ctrl++)">+</button>
+                    <button class="btn btn-icon" data-zoom-mode="fit-width" onclick="LIVZoom.fit('fit-width')" title="Fit width (Alt+W)" aria-pressed="true">↔</button>
+                    <button class="btn btn-icon" data-zoom-mode="fit-page" onclick="LIVZoom.fit('fit-page')" title="Fit page (Alt+P)" aria-pressed="false" hidden>⤢</button>
+                    <button class="btn btn-icon" data-zoom-mode="actual" onclick="LIVZoom.fit('actual')" title="Actual size (Ctrl+0)" aria-pressed="false">1:1</button>
                 </div>
             </div>
             
@@ -992,6 +1860,27 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                 <button class="btn btn-icon" onclick="toggleFullscreen()" title="Fullscreen">
                     <span>⛶</span>
                 </button>
+                <button class="btn btn-icon" id="offlineToggle" onclick="LIVOffline.toggle()" title="Available offline" aria-pressed="false" hidden>
+                    <span>⇩</span>
+                </button>
+                <button class="btn btn-icon" id="eventsToggle" onclick="LIVEvents.toggle()" title="Events" aria-controls="eventsPanel" aria-expanded="false" hidden>
+                    <span>📅</span>
+                </button>
+                <button class="btn btn-icon" id="findToggle" onclick="LIVFind.open()" title="Find (Ctrl+F)" aria-controls="findBar" hidden>
+                    <span>🔍</span>
+                </button>
+                <button class="btn btn-icon" id="sectionLink" onclick="LIVSections.copy()" title="Copy link to section" hidden>
+                    <span>🔗</span>
+                </button>
+                <button class="btn btn-icon" id="bookmarksToggle" onclick="LIVNavigation.toggle()" title="Bookmarks (Ctrl+D to add)" aria-controls="bookmarksPanel" aria-expanded="false" hidden>
+                    <span>☆</span>
+                </button>
+                <button class="btn btn-icon" id="annotationsToggle" onclick="LIVAnnotations.toggle()" title="Annotations" aria-controls="annotationsPanel" aria-expanded="false" hidden>
+                    <span>✎</span>
+                </button>
+                <a class="btn btn-icon" id="calendarExport" title="Add events to calendar (.ics)" download hidden>
+                    <span>+📅</span>
+                </a>
                 <button class="btn btn-icon" onclick="downloadDocument()" title="Download">
                     <span>↓</span>
                 </button>
@@ -1001,7 +1890,16 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             </div>
         </div>
         
+        <div class="capability-notice" id="capabilityNotice" role="status" hidden></div>
+        
         <div class="viewer-content">
+            <div class="find-bar" id="findBar" role="search" hidden>
+                <input type="search" id="findInput" placeholder="Find in document" aria-label="Find in document" autocomplete="off">
+                <span class="find-count" id="findCount" aria-live="polite"></span>
+                <button class="btn btn-icon" onclick="LIVFind.previous()" title="Previous match (Shift+Enter)">↑</button>
+                <button class="btn btn-icon" onclick="LIVFind.next()" title="Next match (Enter)">↓</button>
+                <button class="btn btn-icon" onclick="LIVFind.close()" title="Close (Escape)">✕</button>
+            </div>
             <div id="liv-viewer" class="document-frame">
                 <div class="loading-overlay" id="loadingOverlay">
                     <div class="loading-spinner"></div>
@@ -1012,31 +1910,97 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                     </div>
                 </div>
             </div>
+            <aside class="events-panel" id="eventsPanel" aria-label="Events" hidden></aside>
+            <aside class="annotations-panel" id="annotationsPanel" aria-label="Annotations" hidden></aside>
+            <aside class="bookmarks-panel" id="bookmarksPanel" aria-label="Bookmarks" hidden></aside>
+            <nav class="outline-panel" id="outlinePanel" aria-label="Outline" hidden></nav>
         </div>
     </div>
 
+    <script src="/static/js/liv-decrypt.js"></script>
+    <script src="/static/js/liv-disclosure.js"></script>
+    <script src="/static/js/liv-viewing.js"></script>
+    <script src="/static/js/liv-trust.js"></script>
+    <script src="/static/js/liv-capabilities.js"></script>
+    <script src="/static/js/liv-access.js"></script>
+    <script src="/static/js/liv-wasm-cache.js"></script>
+    <script src="/static/js/liv-assets.js"></script>
+    <script src="/static/js/liv-activity.js"></script>
+    <script src="/static/js/liv-graphics.js"></script>
+    <script src="/static/js/liv-data.js"></script>
+    <script src="/static/js/liv-events.js"></script>
+    <script src="/static/js/liv-annotations.js"></script>
+    <script src="/static/js/liv-find.js"></script>
+    <script src="/static/js/liv-navigation.js"></script>
+    <script src="/static/js/liv-outline.js"></script>
+    <script src="/static/js/liv-sections.js"></script>
+    <script src="/static/js/liv-zoom.js"></script>
+    <script src="/static/js/liv-offline.js"></script>
     <script>
         // Global viewer state
-        let currentZoom = 100;
         let documentData = null;
         let wasmModule = null;
+        let documentModules = {};
         let renderer = null;
+        let decryptor = null;
         
         // Initialize LIV viewer with full WASM integration
         async function initViewer() {
             try {
+                updateProgress(5, 'Opening viewing session...');
+                
+                // Take a slot before loading content; servers may limit how
+                // many documents a reader has open at once
+                const params = new URLSearchParams(window.location.search);
+                await LIVViewing.open(params.get('id') || params.get('file') || document.title);
+                
+                // Check signatures before any content is rendered
+                updateProgress(8, 'Verifying signatures...');
+                const documentId = params.get('id');
+                await LIVTrust.check(documentId);
+                
+                // Refuse documents this viewer cannot fully render
+                updateProgress(9, 'Checking viewer capabilities...');
+                await LIVCapabilities.check(documentId);
+                
+                // Open under the document's access policy, which may limit
+                // when and how often it opens
+                updateProgress(9, 'Checking access...');
+                await LIVAccess.open(documentId);
+                
                 updateProgress(10, 'Loading document...');
                 
                 // Load document data
-                const documentId = new URLSearchParams(window.location.search).get('id');
                 if (documentId) {
                     const response = await fetch('/api/document?id=' + documentId);
                     if (!response.ok) {
                         throw new Error('Failed to load document');
                     }
                     documentData = await response.json();
+                    LIVActivity.configure(documentData.activity);
+                    LIVEvents.configure(documentData.events);
+                    LIVData.configure(documentData.data);
+                    
+                    // WebGL documents degrade on devices that cannot run them
+                    LIVGraphics.choose(documentId, documentData.graphics);
+                    
+                    // Compile the document's modules while the rest loads
+                    LIVWasmCache.warm(documentData.wasm_modules);
                 }
                 
+                // Annotations of uploaded documents are shared through the
+                // server, others stay in this browser
+                await LIVAnnotations.configure(documentId, documentData?.filename || params.get('file'), documentData?.title);
+                // and so are the bookmarks of signed-in readers
+                await LIVNavigation.configure(documentId, documentData?.filename || params.get('file'), documentData?.title);
+                // Readers' zoom is kept per document; paged documents are
+                // shown a page at a time at the size they declare
+                LIVZoom.configure(documentId || params.get('file'), documentData?.page);
+                
+                // Unlock encrypted documents in the browser
+                updateProgress(20, 'Checking document encryption...');
+                decryptor = await LIVDecryptor.open();
+                
                 updateProgress(30, 'Initializing WASM engine...');
                 
                 // Load WASM modules
@@ -1057,6 +2021,10 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                 // Setup event listeners
                 setupEventListeners();
                 
+                // Documents opened here stay readable offline unless the
+                // reader turns it off
+                LIVOffline.configure(documentId);
+                
                 updateProgress(100, 'Ready');
                 
                 // Hide loading overlay
@@ -1066,6 +2034,11 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                 
             } catch (error) {
                 console.error('Failed to initialize viewer:', error);
+                if (error instanceof LIVViewing.LimitError || error instanceof LIVTrust.TamperedError ||
+                    error instanceof LIVCapabilities.IncompatibleError || error instanceof LIVAccess.DeniedError) {
+                    showError(error.html());
+                    return;
+                }
                 showError('Failed to load document: ' + error.message);
             }
         }
@@ -1077,6 +2050,7 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                 if (wasmResponse.ok) {
                     const wasmBytes = await wasmResponse.arrayBuffer();
                     wasmModule = await WebAssembly.instantiate(wasmBytes);
+                    LIVActivity.attachInstance(wasmModule.instance);
                     console.log('WASM module loaded successfully');
                 } else {
                     console.warn('WASM module not available, using fallback mode');
@@ -1084,6 +2058,15 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             } catch (error) {
                 console.warn('Failed to load WASM module:', error);
             }
+            
+            // Collect the document's modules, compiled during warm-up
+            for (const module of documentData?.wasm_modules || []) {
+                try {
+                    documentModules[module.name] = await LIVWasmCache.get(module);
+                } catch (error) {
+                    console.warn('Failed to load WASM module ' + module.name + ':', error);
+                }
+            }
         }
         
         async function initRenderer() {
@@ -1093,7 +2076,6 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             // Create renderer instance (this would use the actual LIV renderer)
             renderer = {
                 element: viewerElement,
-                zoom: currentZoom,
                 
                 render: function(content) {
                     // This would use the actual renderer implementation
@@ -1101,15 +2083,53 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                 },
                 
                 setZoom: function(zoom) {
-                    this.zoom = zoom;
-                    this.element.style.transform = 'scale(' + (zoom / 100) + ')';
-                    this.element.style.transformOrigin = 'top left';
+                    LIVZoom.set(zoom);
                 }
             };
         }
         
         async function loadDocumentContent() {
-            if (documentData) {
+            if (decryptor && decryptor.isEncrypted('content/index.html')) {
+                // Decrypted content stays in page memory only
+                renderer.render(await decryptor.readText('content/index.html'));
+            } else if (await LIVDisclosure.hasSections()) {
+                // Public content with sealed sections is rendered as stored
+                const response = await fetch(LIVDecryptor.resourceURL('content/index.html'));
+                if (!response.ok) {
+                    throw new Error('Failed to load document content');
+                }
+                renderer.render(await response.text());
+            } else if (LIVGraphics.choice && LIVGraphics.choice.path === 'snapshot') {
+                // The device cannot run the document's WebGL
+                renderer.element.replaceChildren(LIVGraphics.snapshot(documentData.title || 'Document'));
+            } else if (documentData && documentData.content_url) {
+                // Content runs in a frame sandboxed by its security policy,
+                // and the server sends it with the matching CSP
+                const frame = document.createElement('iframe');
+                frame.className = 'document-content';
+                frame.title = documentData.title || 'Document';
+                frame.setAttribute('sandbox', documentData.content_policy.sandbox);
+                frame.referrerPolicy = 'no-referrer';
+                // Assets with variants are picked for this screen and connection,
+                // and links to a section open the frame there
+                const section = await LIVSections.resolve(new URLSearchParams(window.location.search).get('id'));
+                frame.src = LIVSections.contentURL(LIVGraphics.contentURL(LIVAssets.contentURL(documentData.content_url, renderer.element.clientWidth)), section);
+                // The frame pauses while hidden or on low battery
+                LIVActivity.attach(frame);
+                // and asks the viewer for the document's data files
+                LIVData.attach(frame);
+                // Readers annotate scripted pages in the frame
+                LIVAnnotations.attach(frame);
+                // and the viewer follows where they are in it
+                if (frame.sandbox.contains('allow-scripts')) {
+                    LIVNavigation.attach(frame);
+                }
+                // Readers copy links to the section they are in
+                LIVSections.attach(frame, new URLSearchParams(window.location.search).get('id'));
+                // and find their way around long documents in the outline
+                LIVOutline.attach(frame, new URLSearchParams(window.location.search).get('id'));
+                renderer.element.replaceChildren(frame);
+            } else if (documentData) {
                 // Render actual document content
                 const content = '<div style="padding: 2rem; max-width: 800px; margin: 0 auto;"><h1>' + 
                     documentData.title + '</h1><p>Document loaded successfully!</p>' +
@@ -1131,6 +2151,11 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                 
                 renderer.render(content);
             }
+            
+            await LIVDisclosure.attach(renderer.element);
+            // The viewer's find replaces the browser's where it can search
+            LIVFind.attach(renderer.element);
+            LIVZoom.attach(renderer.element);
         }
         
         function setupEventListeners() {
@@ -1149,11 +2174,52 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                             break;
                         case '0':
                             e.preventDefault();
-                            resetZoom();
+                            LIVZoom.fit('actual');
+                            break;
+                        case 'f':
+                        case 'F':
+                            if (LIVFind.available) {
+                                e.preventDefault();
+                                LIVFind.open();
+                            }
+                            break;
+                        case 'g':
+                        case 'G':
+                            if (LIVFind.available) {
+                                e.preventDefault();
+                                e.shiftKey ? LIVFind.previous() : LIVFind.next();
+                            }
+                            break;
+                        case 'd':
+                        case 'D':
+                            if (LIVNavigation.available) {
+                                e.preventDefault();
+                                LIVNavigation.bookmark();
+                            }
                             break;
                     }
                 }
                 
+                if (e.altKey && !e.ctrlKey && !e.metaKey && LIVNavigation.available && (e.key === 'ArrowLeft' || e.key === 'ArrowRight')) {
+                    e.preventDefault();
+                    e.key === 'ArrowLeft' ? LIVNavigation.back() : LIVNavigation.forward();
+                }
+                
+                if (e.altKey && !e.ctrlKey && !e.metaKey && e.code === 'KeyO' && LIVOutline.available) {
+                    e.preventDefault();
+                    LIVOutline.toggle();
+                }
+                
+                if (e.altKey && !e.ctrlKey && !e.metaKey && (e.code === 'KeyW' || e.code === 'KeyP')) {
+                    e.preventDefault();
+                    LIVZoom.fit(e.code === 'KeyW' ? 'fit-width' : 'fit-page');
+                }
+                
+                if (e.key === 'F3' && LIVFind.available) {
+                    e.preventDefault();
+                    e.shiftKey ? LIVFind.previous() : LIVFind.next();
+                }
+                
                 if (e.key === 'F11') {
                     e.preventDefault();
                     toggleFullscreen();
@@ -1166,12 +2232,12 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             
             // Touch gestures for mobile
             let touchStartDistance = 0;
-            let initialZoom = currentZoom;
+            let initialZoom = LIVZoom.zoom;
             
             document.addEventListener('touchstart', (e) => {
                 if (e.touches.length === 2) {
                     touchStartDistance = getTouchDistance(e.touches);
-                    initialZoom = currentZoom;
+                    initialZoom = LIVZoom.zoom;
                 }
             });
             
@@ -1217,23 +2283,19 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
         }
         
         function zoomIn() {
-            setZoom(Math.min(400, currentZoom + 25));
+            LIVZoom.zoomIn();
         }
         
         function zoomOut() {
-            setZoom(Math.max(25, currentZoom - 25));
+            LIVZoom.zoomOut();
         }
         
         function resetZoom() {
-            setZoom(100);
+            LIVZoom.fit('actual');
         }
         
         function setZoom(zoom) {
-            currentZoom = zoom;
-            document.getElementById('zoomLevel').textContent = Math.round(zoom) + '%%';
-            if (renderer) {
-                renderer.setZoom(zoom);
-            }
+            LIVZoom.set(zoom);
         }
         
         function toggleFullscreen() {
@@ -1256,7 +2318,7 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
                         const url = URL.createObjectURL(blob);
                         const a = document.createElement('a');
                         a.href = url;
-                        a.download = (documentData?.title || 'document') + '.liv';
+                        a.download = documentData?.filename || (documentData?.title || 'document') + '.liv';
                         document.body.appendChild(a);
                         a.click();
                         document.body.removeChild(a);
@@ -1271,17 +2333,85 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
             }
         }
         
-        function showInfo() {
-            const info = documentData ? 
+        async function showInfo() {
+            let info = documentData ? 
                 'Title: ' + documentData.title + '\\n' +
                 'Author: ' + (documentData.author || 'Unknown') + '\\n' +
                 'Created: ' + (documentData.created || 'Unknown') + '\\n' +
                 'Version: ' + (documentData.version || '1.0') :
                 'Document information not available';
+            if (documentData && documentData.authors) {
+                info += '\\n\\nAuthors:';
+                for (const author of documentData.authors) {
+                    info += '\\n' + author.name + (author.affiliation ? ', ' + author.affiliation : '');
+                    if (author.orcid_url) {
+                        info += '\\n    ORCID: ' + author.orcid_url;
+                    }
+                    if (author.email) {
+                        info += '\\n    Email: ' + author.email;
+                    }
+                    info += '\\n    Contact card: ' + new URL(author.vcard_url, window.location.href).href;
+                }
+            }
+            if (documentData && documentData.funding) {
+                info += '\\n\\nFunding:';
+                for (const funding of documentData.funding) {
+                    if (!funding) {
+                        continue;
+                    }
+                    info += '\\n' + funding.funder;
+                    if (funding.awards && funding.awards.length > 0) {
+                        info += ' (' + funding.awards.join(', ') + ')';
+                    }
+                    if (funding.funder_id) {
+                        info += '\\n    Funder ID: https://doi.org/' + funding.funder_id;
+                    }
+                }
+            }
+            if (documentData && documentData.keywords) {
+                info += '\\n\\nKeywords: ' + documentData.keywords.join(', ');
+            }
+            if (documentData && documentData.subjects) {
+                info += '\\n\\nSubjects:';
+                for (const subject of documentData.subjects) {
+                    const code = subject.code ? ((subject.scheme || '').toUpperCase() + ' ' + subject.code).trim() : '';
+                    info += '\\n' + (subject.label && code ? subject.label + ' (' + code + ')' : subject.label || code);
+                }
+            }
+            info += '\\n\\n' + LIVTrust.details();
+            info += '\\n' + LIVCapabilities.details();
+            info += '\\n' + LIVAccess.details();
+            
+            const license = await loadLicense();
+            if (license) {
+                info += '\\n\\nLicense: ' + (license.spdx || license.terms || 'Unspecified');
+                if (license.holder) {
+                    info += '\\nRights holder: ' + license.holder;
+                }
+                if (license.allowed_uses && license.allowed_uses.length > 0) {
+                    info += '\\nAllowed uses: ' + license.allowed_uses.join(', ');
+                }
+                if (license.url) {
+                    info += '\\nTerms: ' + license.url;
+                }
+            }
             
             alert('Document Information\\n\\n' + info);
         }
         
+        async function loadLicense() {
+            try {
+                const response = await fetch(LIVDecryptor.resourceURL('manifest.json'));
+                if (!response.ok) {
+                    return null;
+                }
+                const manifest = await response.json();
+                return manifest.license || null;
+            } catch (error) {
+                return null;
+            }
+        }
+        
         // Responsive design updates
         function updateViewport() {
             const vh = window.innerHeight * 0.01;
@@ -1295,25 +2425,22 @@ func handleViewer(w http.ResponseWriter, r *http.Request) {
         // Initialize when page loads
         window.addEventListener('load', initViewer);
         
-        // Handle page visibility changes
-        document.addEventListener('visibilitychange', () => {
-            if (document.hidden) {
-                // Pause animations or reduce activity when page is hidden
-                console.log('Page hidden, reducing activity');
-            } else {
-                // Resume normal activity when page is visible
-                console.log('Page visible, resuming activity');
-            }
-        });
-    </script>
+        // Pause content rendered in this page while hidden or on low battery
+        LIVActivity.attachElement(document.getElementById('liv-viewer'));
+    </script>%s
 </body>
-</html>`, documentName, documentName)
+</html>`, documentName, staticFallbackURL(r), documentPreviewTags(r, documentID), documentName, liveReloadScript())
 	
 	w.Header().Set("Content-Type", "text/html")
 	w.Write([]byte(html))
 }
 
 func handleDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
 	documentID := r.URL.Query().Get("id")
 	download := r.URL.Query().Get("download") == "true"
 	
@@ -1322,26 +2449,64 @@ func handleDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	doc, reader, err := openStoredPackage(documentID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			log.ErrorContext(r.Context(), "Failed to open document", "error", err)
+			http.Error(w, "Failed to open document", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer doc.Close()
+	
+	info := doc.Info()
+	
+	if r.URL.Query().Get("chunks") == "true" {
+		countServed(r, "chunks")
+		serveDocumentChunks(w, r, doc)
+		return
+	}
+	
 	if download {
-		// TODO: Implement actual document download
+		// ServeContent sets Content-Length and answers conditional and range
+		// requests; If-Range with the strong ETag lets clients resume safely
 		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Disposition", "attachment; filename=\"document.liv\"")
-		w.Write([]byte("Mock LIV document content"))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Filename}))
+		w.Header().Set("ETag", documentETag(info))
+		w.Header().Set(transfer.ManifestHeader, documentChunksURL(documentID))
+		countServed(r, "download")
+		http.ServeContent(w, r, info.Filename, info.Uploaded, doc)
 		return
 	}
 	
-	// Return document metadata
-	w.Header().Set("Content-Type", "application/json")
-	response := fmt.Sprintf(`{
-		"id": "%s",
-		"title": "Sample LIV Document",
-		"author": "LIV Viewer",
-		"created": "2024-01-01T00:00:00Z",
-		"version": "1.0.0",
-		"status": "loaded"
-	}`, documentID)
+	docManifest, err := readStoredManifest(reader)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid document manifest: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
 	
-	w.Write([]byte(response))
+	policy, err := newContentPolicy(docManifest.Security)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	
+	metadata := newDocumentMetadata(info, docManifest)
+	if !metadata.Encrypted {
+		metadata.ContentURL = contentURL(documentID)
+		metadata.ContentPolicy = policy
+		metadata.Activity = readActivitySpec(reader)
+		metadata.Graphics = readGraphicsSpec(reader, docManifest, documentID)
+		metadata.Events = readEventsSpec(reader, documentID)
+		metadata.Data = documentDatasets(docManifest, documentID)
+	}
+	
+	countServed(r, "view")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(metadata)
 }
 
 func handleUpload(w http.ResponseWriter, r *http.Request) {
@@ -1351,7 +2516,8 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Parse multipart form
-	err := r.ParseMultipartForm(100 << 20) // 100MB max
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1<<20)
+	err := r.ParseMultipartForm(32 << 20)
 	if err != nil {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
@@ -1370,24 +2536,57 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	if header.Size > 100<<20 { // 100MB limit
+	if header.Size > maxUploadSize {
 		http.Error(w, "File too large", http.StatusBadRequest)
 		return
 	}
 	
-	// TODO: Implement actual file storage and processing
-	// For now, generate a mock document ID
-	documentID := fmt.Sprintf("doc_%d", time.Now().Unix())
+	if documentStore == nil {
+		http.Error(w, "Document storage not available", http.StatusServiceUnavailable)
+		return
+	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	response := fmt.Sprintf(`{
-		"id": "%s",
-		"filename": "%s",
-		"size": %d,
-		"status": "uploaded"
-	}`, documentID, header.Filename, header.Size)
+	storeUpload(w, r, header.Filename, file)
+}
+
+// storeUpload stores an uploaded document, rejecting invalid packages, and
+// responds with its ID
+func storeUpload(w http.ResponseWriter, r *http.Request, filename string, data io.Reader) {
+	info, err := documentStore.Put(filename, data)
+	if errors.Is(err, store.ErrLockTimeout) {
+		log.WarnContext(r.Context(), "Document store busy", "filename", filename, "error", err)
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Document storage is busy, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.ErrorContext(r.Context(), "Failed to store upload", "filename", filename, "error", err)
+		http.Error(w, "Failed to store document", http.StatusInternalServerError)
+		return
+	}
 	
-	w.Write([]byte(response))
+	// Reject anything that is not a valid LIV package before handing out its ID
+	if err := validateStoredPackage(r.Context(), info.ID); err != nil {
+		documentStore.Delete(info.ID)
+		serverMetrics.ValidationFailures.Inc(validationReason(err))
+		http.Error(w, fmt.Sprintf("Invalid LIV document: %v", err), http.StatusBadRequest)
+		return
+	}
+	serverMetrics.UploadSize.Observe(float64(info.Size))
+	
+	// Record a baseline report so later revalidations can detect degradation
+	if healthMonitor != nil {
+		go healthMonitor.Check(info.ID)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       info.ID,
+		"filename": info.Filename,
+		"size":     info.Size,
+		"expires":  info.Expires,
+		"status":   "uploaded",
+	})
 }
 
 func handleValidate(w http.ResponseWriter, r *http.Request) {
@@ -1444,82 +2643,6 @@ func handleManifest(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(manifest))
 }
 
-func handleServiceWorker(w http.ResponseWriter, r *http.Request) {
-	sw := `
-// LIV Viewer Service Worker
-const CACHE_NAME = 'liv-viewer-v1';
-const urlsToCache = [
-	'/',
-	'/static/css/app.css',
-	'/static/js/app.js',
-	'/static/wasm/interactive-engine.wasm'
-];
-
-self.addEventListener('install', (event) => {
-	event.waitUntil(
-		caches.open(CACHE_NAME)
-			.then((cache) => {
-				console.log('Opened cache');
-				return cache.addAll(urlsToCache);
-			})
-	);
-});
-
-self.addEventListener('fetch', (event) => {
-	event.respondWith(
-		caches.match(event.request)
-			.then((response) => {
-				// Return cached version or fetch from network
-				return response || fetch(event.request);
-			})
-	);
-});
-
-self.addEventListener('activate', (event) => {
-	event.waitUntil(
-		caches.keys().then((cacheNames) => {
-			return Promise.all(
-				cacheNames.map((cacheName) => {
-					if (cacheName !== CACHE_NAME) {
-						console.log('Deleting old cache:', cacheName);
-						return caches.delete(cacheName);
-					}
-				})
-			);
-		})
-	);
-});
-
-// Handle background sync for offline document uploads
-self.addEventListener('sync', (event) => {
-	if (event.tag === 'document-upload') {
-		event.waitUntil(uploadPendingDocuments());
-	}
-});
-
-async function uploadPendingDocuments() {
-	// TODO: Implement offline document upload sync
-	console.log('Syncing pending document uploads');
-}
-
-// Handle push notifications
-self.addEventListener('push', (event) => {
-	const options = {
-		body: event.data ? event.data.text() : 'New LIV document available',
-		icon: '/static/icons/icon-192x192.png',
-		badge: '/static/icons/badge-72x72.png'
-	};
-
-	event.waitUntil(
-		self.registration.showNotification('LIV Viewer', options)
-	);
-});
-`
-	
-	w.Header().Set("Content-Type", "application/javascript")
-	w.Write([]byte(sw))
-}
-
 func handleStatic(w http.ResponseWriter, r *http.Request) {
 	// Serve static files (CSS, JS, WASM modules)
 	path := r.URL.Path[len("/static/"):]
@@ -1552,6 +2675,12 @@ func handleStatic(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Cache-Control", "public, max-age=31536000") // 1 year cache
 	
+	// Serve embedded viewer assets first
+	if data, ok := readStaticAsset(path); ok {
+		w.Write(data)
+		return
+	}
+	
 	// Serve mock static files for demonstration
 	switch path {
 	case "wasm/interactive-engine.wasm":
@@ -1579,7 +2708,7 @@ func handleStatic(w http.ResponseWriter, r *http.Request) {
 		// Mock Apple touch icon
 		w.Write([]byte("\x89PNG\r\n\x1a\n"))
 	default:
-		log.Printf("Static file requested: %s", path)
+		log.DebugContext(r.Context(), "Static file not found", "path", path)
 		http.Error(w, "File not found", http.StatusNotFound)
 	}
 }
\ No newline at end of file
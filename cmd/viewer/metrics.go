@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/liv-format/liv/pkg/telemetry"
+)
+
+// serverMetrics are the viewer's Prometheus metrics
+var serverMetrics = telemetry.NewMetrics()
+
+// handleMetrics serves the Prometheus metrics to scrapers with health access:
+// administrators, bearers of the health token or, without one, local
+// requests
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !authorizeHealth(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	serverMetrics.ServeHTTP(w, r)
+}
+
+// countServed counts a document served to a reader. HEAD requests and the
+// later ranges of resumed downloads are not counted.
+func countServed(r *http.Request, mode string) {
+	if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+		return
+	}
+	serverMetrics.DocumentsServed.Inc(mode)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/log"
+)
+
+// serviceWorkerSource is the viewer's service worker; /sw.js serves it after
+// the configuration generated for this viewer
+//
+//go:embed sw.js
+var serviceWorkerSource string
+
+// offlineConfig limits what each browser keeps of the documents it opened
+type offlineConfig struct {
+	// CacheMB is the space opened documents may take; 0 keeps none
+	CacheMB int64
+	// DocumentMB is the largest document kept
+	DocumentMB int64
+}
+
+// offlineLimits are the limits of the service worker's document cache
+var offlineLimits = offlineConfig{CacheMB: 200, DocumentMB: 50}
+
+// serviceWorkerConfig is the configuration /sw.js starts with
+type serviceWorkerConfig struct {
+	// Version changes with the static assets, replacing their cache
+	Version string `json:"version"`
+	// Static are the pages and assets cached when the worker installs
+	Static []string `json:"static"`
+	// Documents are the digests of the stored documents, as
+	// documentDigest computes them, so cached copies of documents that
+	// were removed or replaced are dropped. Digests do not reveal ids.
+	Documents []string `json:"documents"`
+	// Listed reports whether Documents lists the stored documents; servers
+	// without a store serve only the document they were started with
+	Listed bool          `json:"listed"`
+	Limits offlineBudget `json:"limits"`
+}
+
+// offlineBudget are the limits in bytes
+type offlineBudget struct {
+	Cache    int64 `json:"cache"`
+	Document int64 `json:"document"`
+}
+
+var (
+	staticListOnce    sync.Once
+	staticList        []string
+	staticListVersion string
+)
+
+// staticServiceWorkerAssets lists the embedded assets under their /static/
+// URLs, and a version that changes when any of them does
+func staticServiceWorkerAssets() ([]string, string) {
+	staticListOnce.Do(func() {
+		hash := sha256.New()
+		fs.WalkDir(staticAssets, "static", func(name string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			data, err := staticAssets.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			hash.Write([]byte(name))
+			hash.Write(sum[:])
+			staticList = append(staticList, "/"+name)
+			return nil
+		})
+		sort.Strings(staticList)
+		staticListVersion = hex.EncodeToString(hash.Sum(nil))[:16]
+	})
+	return staticList, staticListVersion
+}
+
+// documentDigest identifies a stored document and its content to the service
+// worker, which computes the same digest for the documents it cached
+func documentDigest(id, sha string) string {
+	sum := sha256.Sum256([]byte(id + "\x00" + sha))
+	return hex.EncodeToString(sum[:])
+}
+
+// newServiceWorkerConfig describes the viewer's assets and stored documents
+func newServiceWorkerConfig() (*serviceWorkerConfig, error) {
+	assets, version := staticServiceWorkerAssets()
+	config := &serviceWorkerConfig{
+		Version:   version,
+		Static:    append([]string{"/", "/manifest.json"}, assets...),
+		Documents: []string{},
+		Limits: offlineBudget{
+			Cache:    offlineLimits.CacheMB << 20,
+			Document: offlineLimits.DocumentMB << 20,
+		},
+	}
+	if documentStore == nil {
+		return config, nil
+	}
+	infos, err := documentStore.List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, info := range infos {
+		if !info.Expired(now) {
+			config.Documents = append(config.Documents, documentDigest(info.ID, info.SHA256))
+		}
+	}
+	sort.Strings(config.Documents)
+	config.Listed = true
+	return config, nil
+}
+
+// handleServiceWorker serves the service worker that keeps the viewer and
+// the documents a browser opened available offline. It is generated for the
+// viewer's assets and stored documents, so browsers update it when they
+// change and drop what they no longer need.
+func handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	config, err := newServiceWorkerConfig()
+	if err != nil {
+		log.ErrorContext(r.Context(), "Failed to list documents for the service worker", "error", err)
+		http.Error(w, "Failed to list documents", http.StatusInternalServerError)
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		http.Error(w, "Failed to generate the service worker", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/javascript")
+	// Browsers compare the worker with the one they run on every check
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte("const LIV_OFFLINE = "))
+	w.Write(data)
+	w.Write([]byte(";\n\n"))
+	w.Write([]byte(serviceWorkerSource))
+}
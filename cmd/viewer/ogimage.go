@@ -0,0 +1,242 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/ogimage"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// previewCacheSize bounds the number of rendered preview cards kept in memory
+const previewCacheSize = 128
+
+// previewImage is the Open Graph card of a document
+type previewImage struct {
+	Data    []byte
+	ModTime time.Time
+	ETag    string
+}
+
+// previewCache keeps the most recently rendered cards, so a card is rendered
+// once per document version rather than on every crawler request
+type previewCache struct {
+	mu      sync.Mutex
+	entries map[string]*previewImage
+	order   []string
+}
+
+var previewImages = &previewCache{entries: make(map[string]*previewImage)}
+
+func (c *previewCache) get(key string) *previewImage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *previewCache) put(key string, image *previewImage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = image
+	for len(c.order) > previewCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// handleOGImage serves the preview card of an uploaded document, or of the
+// served document when no id is given. A card rendered at build time is served
+// as is; otherwise one is rendered on first request and cached.
+func handleOGImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		image *previewImage
+		err   error
+	)
+	if id := r.URL.Query().Get("id"); id != "" {
+		image, err = storedPreviewImage(id)
+	} else {
+		image, err = servedPreviewImage()
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			log.ErrorContext(r.Context(), "Failed to render preview image", "error", err)
+			http.Error(w, "Failed to render preview image", http.StatusUnprocessableEntity)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", image.ETag)
+
+	http.ServeContent(w, r, "", image.ModTime, bytes.NewReader(image.Data))
+}
+
+func storedPreviewImage(id string) (*previewImage, error) {
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.Close()
+
+	info := doc.Info()
+	if cached := previewImages.get(info.SHA256); cached != nil {
+		return cached, nil
+	}
+
+	data, err := renderPreviewImage(reader)
+	if err != nil {
+		return nil, err
+	}
+	image := &previewImage{Data: data, ModTime: info.Uploaded, ETag: `"` + info.SHA256 + `-og"`}
+	previewImages.put(info.SHA256, image)
+	return image, nil
+}
+
+func servedPreviewImage() (*previewImage, error) {
+	if servedDocument == "" {
+		return nil, store.ErrNotFound
+	}
+
+	info, err := os.Stat(servedDocument)
+	if err != nil {
+		return nil, err
+	}
+	version := fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+	key := servedDocument + "@" + version
+	if cached := previewImages.get(key); cached != nil {
+		return cached, nil
+	}
+
+	reader, err := zip.OpenReader(servedDocument)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document package: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := renderPreviewImage(&reader.Reader)
+	if err != nil {
+		return nil, err
+	}
+	image := &previewImage{Data: data, ModTime: info.ModTime(), ETag: `"` + version + `-og"`}
+	previewImages.put(key, image)
+	return image, nil
+}
+
+// renderPreviewImage returns the card stored in a package by the builder, or
+// renders one from the manifest metadata and the document's thumbnail
+func renderPreviewImage(reader *zip.Reader) ([]byte, error) {
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isEncryptedEntry(m, ogimage.Entry) {
+		if data, err := readZipEntry(reader, ogimage.Entry); err == nil {
+			return data, nil
+		}
+	}
+
+	return ogimage.RenderPackage(m, func(entry string) ([]byte, error) {
+		return readZipEntry(reader, entry)
+	})
+}
+
+// previewImageURL returns the absolute URL of a document's preview card. Link
+// unfurlers require absolute og:image URLs, so the scheme and host are taken
+// from the request, honoring X-Forwarded-Proto behind a TLS-terminating proxy.
+func previewImageURL(r *http.Request, documentID string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "https" || proto == "http" {
+		scheme = proto
+	}
+
+	imageURL := scheme + "://" + r.Host + "/api/og-image"
+	if documentID != "" {
+		imageURL += "?" + url.Values{"id": {documentID}}.Encode()
+	}
+	return imageURL
+}
+
+// documentPreviewTags returns the Open Graph and Twitter card tags for the
+// viewer page of a document, or nothing when the document is not available
+func documentPreviewTags(r *http.Request, documentID string) string {
+	m, err := loadPreviewManifest(documentID)
+	if err != nil || m.Metadata == nil {
+		return ""
+	}
+
+	var tags strings.Builder
+	meta := func(key, name, content string) {
+		if content != "" {
+			fmt.Fprintf(&tags, "\n    <meta %s=\"%s\" content=\"%s\">", key, name, html.EscapeString(content))
+		}
+	}
+	meta("name", "description", m.Metadata.Description)
+	meta("property", "og:type", "article")
+	meta("property", "og:title", m.Metadata.Title)
+	meta("property", "og:description", m.Metadata.Description)
+	for _, tag := range previewImageTags(previewImageURL(r, documentID)) {
+		meta(tag[0], tag[1], tag[2])
+	}
+	return tags.String()
+}
+
+// previewImageTags are the meta tags that point unfurlers at a preview card
+func previewImageTags(imageURL string) [][3]string {
+	return [][3]string{
+		{"property", "og:image", imageURL},
+		{"property", "og:image:type", "image/png"},
+		{"property", "og:image:width", fmt.Sprint(ogimage.Width)},
+		{"property", "og:image:height", fmt.Sprint(ogimage.Height)},
+		{"name", "twitter:card", "summary_large_image"},
+		{"name", "twitter:image", imageURL},
+	}
+}
+
+func loadPreviewManifest(documentID string) (*core.Manifest, error) {
+	if documentID != "" {
+		doc, reader, err := openStoredPackage(documentID)
+		if err != nil {
+			return nil, err
+		}
+		defer doc.Close()
+		return readStoredManifest(reader)
+	}
+
+	if servedDocument == "" {
+		return nil, store.ErrNotFound
+	}
+	reader, err := zip.OpenReader(servedDocument)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readStoredManifest(&reader.Reader)
+}
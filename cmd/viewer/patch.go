@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/liv-format/liv/pkg/delta"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// handlePatch updates an uploaded document by applying a patch made by
+// liv diff to it, so a new version can be published without uploading the
+// resources that did not change. The patch is the request body; the patched
+// document is stored as a new upload and its ID returned, as for /api/upload.
+//
+// A patch makes a new document out of a stored one, so it is only accepted
+// from signed-in authors who may read the document it patches. Without
+// sign-in nobody could be held to that, and patches are refused. The patched
+// document is stored and validated as an upload is: it gets an ID only once
+// it passes validation.
+func handlePatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if authenticator == nil {
+		http.Error(w, "Patches require sign-in; start the viewer with --auth-config", http.StatusForbidden)
+		return
+	}
+	if documentStore == nil {
+		http.Error(w, "Document storage not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	doc, base, err := openStoredPackage(r.URL.Query().Get("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		}
+		return
+	}
+	defer doc.Close()
+
+	// Patches are read out of order, so they are spooled to disk first
+	patchFile, err := os.CreateTemp("", "liv-patch-*"+delta.Extension)
+	if err != nil {
+		log.ErrorContext(r.Context(), "Failed to spool patch", "error", err)
+		http.Error(w, "Failed to apply patch", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(patchFile.Name())
+	defer patchFile.Close()
+	size, err := io.Copy(patchFile, http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if err != nil {
+		http.Error(w, "Patch too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	patch, err := delta.NewReader(patchFile, size)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid patch: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	patched, err := os.CreateTemp("", "liv-patched-*.liv")
+	if err != nil {
+		log.ErrorContext(r.Context(), "Failed to apply patch", "error", err)
+		http.Error(w, "Failed to apply patch", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(patched.Name())
+	defer patched.Close()
+	if err := patch.Apply(base, patched, maxUploadSize); err != nil {
+		if errors.Is(err, delta.ErrBaseMismatch) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to apply patch: %v", err), http.StatusUnprocessableEntity)
+		}
+		return
+	}
+	if _, err := patched.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to apply patch", http.StatusInternalServerError)
+		return
+	}
+
+	storeUpload(w, r, doc.Info().Filename, patched)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/readingstate"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// readingStatePath is the API for the bookmarks and last location of
+// signed-in readers in uploaded documents
+const readingStatePath = "/api/reading-state"
+
+// maxReadingStateSize is the largest reading state accepted
+const maxReadingStateSize = 1 << 20
+
+// readingStateStore keeps where signed-in readers are in uploaded documents;
+// nil keeps it in the browser only
+var readingStateStore *readingstate.Store
+
+// handleReadingState serves the reading state of the signed-in reader in
+// an uploaded document, given by the id parameter:
+//
+//	GET /api/reading-state   returns it
+//	PUT /api/reading-state   replaces it
+//
+// Anonymous readers get 401 and keep their state in the browser.
+func handleReadingState(w http.ResponseWriter, r *http.Request) {
+	if documentStore == nil || readingStateStore == nil {
+		http.Error(w, "Reading state storage not available", http.StatusServiceUnavailable)
+		return
+	}
+	document := r.URL.Query().Get("id")
+	if !store.ValidID(document) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	reader, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Sign in to keep reading state", http.StatusUnauthorized)
+		return
+	}
+	if _, err := documentStore.Stat(document); err != nil {
+		readingStateError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		state, err := readingStateStore.Get(document, reader.Username)
+		if err != nil {
+			readingStateError(w, err)
+			return
+		}
+		writeAnnotationJSON(w, http.StatusOK, state)
+	case http.MethodPut:
+		var state readingstate.State
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReadingStateSize)).Decode(&state); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid reading state: %v", err), http.StatusBadRequest)
+			return
+		}
+		saved, err := readingStateStore.Put(document, reader.Username, &state)
+		if err != nil {
+			readingStateError(w, err)
+			return
+		}
+		writeAnnotationJSON(w, http.StatusOK, saved)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// readingStateError reports a failed reading state request with the status
+// matching err
+func readingStateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Document not found", http.StatusNotFound)
+	case errors.Is(err, readingstate.ErrTooMany):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// documentResourcePrefix is where the entries of stored documents are
+// streamed from, as /api/document/{id}/resource/{path}
+const documentResourcePrefix = "/api/document/"
+
+// servedDocument is the .liv file the web viewer was started with
+var servedDocument string
+
+// handleResource serves raw entries of the served document, or of an uploaded
+// document when an id is given. Entries are returned exactly as stored, so
+// encrypted resources leave the server as ciphertext and are decrypted in the browser. Range requests are supported for on-demand loading.
+func handleResource(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" || strings.Contains(path, "..") || strings.HasPrefix(path, "/") {
+		http.Error(w, "Invalid resource path", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		data    []byte
+		modTime time.Time
+	)
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		doc, reader, err := openStoredPackage(id)
+		if err != nil {
+			http.Error(w, "Document not available", http.StatusNotFound)
+			return
+		}
+		defer doc.Close()
+
+		data, err = readZipEntry(reader, path)
+		if err != nil {
+			http.Error(w, "Resource not found", http.StatusNotFound)
+			return
+		}
+		modTime = doc.Info().Uploaded
+	} else {
+		if servedDocument == "" {
+			http.Error(w, "No document is being served", http.StatusNotFound)
+			return
+		}
+
+		info, err := os.Stat(servedDocument)
+		if err != nil {
+			http.Error(w, "Document not available", http.StatusNotFound)
+			return
+		}
+
+		data, err = readPackageEntry(servedDocument, path)
+		if err != nil {
+			http.Error(w, "Resource not found", http.StatusNotFound)
+			return
+		}
+		modTime = info.ModTime()
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, path, modTime, bytes.NewReader(data))
+}
+
+// readPackageEntry reads a single entry from a .liv package without extracting it to disk
+func readPackageEntry(livPath, entry string) ([]byte, error) {
+	reader, err := zip.OpenReader(livPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return readZipEntry(&reader.Reader, entry)
+}
+
+// documentResourceURL is where a package entry of a stored document is
+// streamed from
+func documentResourceURL(id, entry string) string {
+	segments := strings.Split(entry, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return documentResourcePrefix + url.PathEscape(id) + "/resource/" + strings.Join(segments, "/")
+}
+
+// handleDocumentResource streams a single entry of a stored document, so the
+// viewer can load images, fonts and media as they are needed instead of the
+// whole package. Entries are read straight from the package: byte ranges of
+// stored entries are read without touching the rest of the file, which lets
+// audio and video seek. Encrypted resources are served as the ciphertext
+// they are stored as.
+func handleDocumentResource(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, entry, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, documentResourcePrefix), "/resource/")
+	if !ok || id == "" || strings.Contains(id, "/") || !isResourceEntry(entry) {
+		http.Error(w, "Invalid resource path", http.StatusBadRequest)
+		return
+	}
+
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Document not available", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer doc.Close()
+
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid document manifest: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	var file *zip.File
+	for _, f := range reader.File {
+		if f.Name == entry {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		http.Error(w, "Resource not found", http.StatusNotFound)
+		return
+	}
+	content, err := openZipEntry(doc, file)
+	if err != nil {
+		http.Error(w, "Resource not available", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(entry))
+	if contentType == "" || (m.Encryption != nil && m.Encryption.Resources[entry] != nil) {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	// The package is immutable once stored, so its hash and the entry's
+	// checksum identify the bytes served; If-Range relies on this
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%08x"`, doc.Info().SHA256, file.CRC32))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Resources are loaded by the viewer, never opened as pages of its origin
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+
+	http.ServeContent(w, r, path.Base(entry), doc.Info().Uploaded, content)
+}
+
+// isResourceEntry reports whether a package entry path may be requested
+func isResourceEntry(entry string) bool {
+	return entry != "" && !strings.Contains(entry, "..") && !strings.HasPrefix(entry, "/") && !strings.HasSuffix(entry, "/")
+}
+
+// zipEntryReader reads an entry of a package from any offset
+type zipEntryReader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// openZipEntry opens an entry of the package in doc for reading from any
+// offset. Stored entries are read directly from their place in the package;
+// compressed entries are decompressed up to the offset asked for.
+func openZipEntry(doc io.ReaderAt, file *zip.File) (zipEntryReader, error) {
+	size := int64(file.UncompressedSize64)
+	if file.Method == zip.Store && file.CompressedSize64 == file.UncompressedSize64 {
+		offset, err := file.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		return nopCloser{io.NewSectionReader(doc, offset, size)}, nil
+	}
+	return &inflatingReader{file: file, size: size}, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// inflatingReader seeks within a compressed entry. Seeking forward skips
+// the data in between and seeking backward starts over, which suits the
+// one seek of a range request.
+type inflatingReader struct {
+	file   *zip.File
+	size   int64
+	body   io.ReadCloser
+	read   int64 // position of body
+	offset int64 // position of the next Read
+}
+
+func (r *inflatingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *inflatingReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil || r.read > r.offset {
+		r.Close()
+		body, err := r.file.Open()
+		if err != nil {
+			return 0, err
+		}
+		r.body, r.read = body, 0
+	}
+	if r.read < r.offset {
+		skipped, err := io.CopyN(io.Discard, r.body, r.offset-r.read)
+		r.read += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.body.Read(p)
+	r.read += int64(n)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *inflatingReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/jobs"
+	"github.com/liv-format/liv/pkg/preview"
+	"github.com/liv-format/liv/pkg/sandbox"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// sandboxConfig configures worker processes for uploaded documents
+type sandboxConfig struct {
+	Enabled    bool
+	PolicyFile string
+	Cgroup     string
+}
+
+// workerSandbox validates and renders uploaded documents in worker processes
+// under resource limits; nil processes them in the server
+var workerSandbox *sandbox.Sandbox
+
+// startSandbox prepares the sandbox for workers. Limits come from the resource
+// limits of the policy file, or the sandbox defaults.
+func startSandbox(config sandboxConfig) (*sandbox.Sandbox, error) {
+	if !config.Enabled && config.PolicyFile == "" && config.Cgroup == "" {
+		return nil, nil
+	}
+	limits := sandbox.DefaultLimits
+	if config.PolicyFile != "" {
+		policy, err := loadSecurityPolicy(config.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		limits = sandbox.LimitsFromPolicy(policy.ResourceLimits)
+	}
+	return sandbox.New(limits, config.Cgroup), nil
+}
+
+// validateStoredPackage checks that an uploaded document is a LIV package
+func validateStoredPackage(ctx context.Context, id string) error {
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		return err
+	}
+	defer doc.Close()
+
+	if workerSandbox != nil {
+		_, err = runWorker(ctx, doc, "validate")
+		return err
+	}
+	_, err = readStoredManifest(reader)
+	return err
+}
+
+// runWorker runs a worker subcommand of this executable on a stored document
+// in the sandbox and returns its output
+func runWorker(ctx context.Context, doc store.Document, args ...string) ([]byte, error) {
+	log := &workerLog{}
+	output, _, err := runWorkerIn(ctx, workerSandbox, doc, log, args...)
+	if err != nil {
+		return nil, log.failure(err)
+	}
+	return output, nil
+}
+
+// runWorkerIn runs a worker in box, passing what it writes to standard error
+// to log. It returns the worker's output, even when it fails, and the error of
+// the sandbox.
+func runWorkerIn(ctx context.Context, box *sandbox.Sandbox, doc store.Document, log *workerLog, args ...string) ([]byte, *sandbox.Usage, error) {
+	input := store.File(doc)
+	if input == nil {
+		// Workers read the document as a file; copy it out of other stores
+		temp, err := os.CreateTemp("", "liv-worker-*.liv")
+		if err != nil {
+			return nil, nil, err
+		}
+		defer os.Remove(temp.Name())
+		defer temp.Close()
+		if _, err := io.Copy(temp, io.NewSectionReader(doc, 0, doc.Info().Size)); err != nil {
+			return nil, nil, err
+		}
+		input = temp
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to locate worker: %v", err)
+	}
+	cmd := exec.Command(executable, append([]string{"worker"}, args...)...)
+	cmd.Stdin = input
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = log
+
+	usage, err := box.Run(ctx, cmd)
+	return stdout.Bytes(), usage, err
+}
+
+// workerProgress starts the lines in which exporting workers report their
+// progress on standard error: "stage <stage>", "commit <bytes of output
+// kept>" and "budget <JSON of a budget error>"
+const workerProgress = "liv-progress: "
+
+// workerLog reads what a worker writes to standard error: progress reports,
+// then the error message of a failed worker
+type workerLog struct {
+	onStage func(stage string)
+	stage   string
+	kept    int
+	budget  *jobs.BudgetError
+	message bytes.Buffer
+	line    []byte
+}
+
+func (l *workerLog) Write(p []byte) (int, error) {
+	l.line = append(l.line, p...)
+	for {
+		end := bytes.IndexByte(l.line, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		l.record(l.line[:end+1])
+		l.line = l.line[end+1:]
+	}
+}
+
+func (l *workerLog) record(line []byte) {
+	report, ok := strings.CutPrefix(strings.TrimSuffix(string(line), "\n"), workerProgress)
+	if !ok {
+		l.message.Write(line)
+		return
+	}
+	kind, value, _ := strings.Cut(report, " ")
+	switch kind {
+	case "stage":
+		l.stage = value
+		if l.onStage != nil {
+			l.onStage(value)
+		}
+	case "commit":
+		if kept, err := strconv.Atoi(value); err == nil {
+			l.kept = kept
+		}
+	case "budget":
+		var budget jobs.BudgetError
+		if json.Unmarshal([]byte(value), &budget) == nil {
+			l.budget = &budget
+		}
+	}
+}
+
+// failure explains why a worker failed: its error message, or the limit that
+// stopped it
+func (l *workerLog) failure(err error) error {
+	message := strings.TrimSpace(l.message.String() + string(l.line))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && message != "" {
+		return errors.New(strings.TrimPrefix(message, "Error: "))
+	}
+	return fmt.Errorf("document processing stopped: %v", err)
+}
+
+// workerCmd is run by the server in the sandbox. Workers read the document
+// from standard input, which must be a file.
+func workerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "worker",
+		Short:  "Process an uploaded document in a sandboxed worker",
+		Hidden: true,
+	}
+
+	// The server reports worker errors to users; main prints them once
+	validate := &cobra.Command{
+		Use:           "validate",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reader, err := workerInput()
+			if err != nil {
+				return err
+			}
+			_, err = readStoredManifest(reader)
+			return err
+		},
+	}
+	cmd.AddCommand(validate)
+
+	var id, imageURL, format string
+	fallback := &cobra.Command{
+		Use:           "fallback",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reader, err := workerInput()
+			if err != nil {
+				return err
+			}
+			body, err := renderStaticFallback(reader, fallbackResourceURL(id), imageURL)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(body)
+			return err
+		},
+	}
+	fallback.Flags().StringVar(&id, "id", "", "ID of the uploaded document")
+	fallback.Flags().StringVar(&imageURL, "image-url", "", "URL of the preview image")
+	cmd.AddCommand(fallback)
+
+	var width, height int
+	thumbnail := &cobra.Command{
+		Use:           "thumbnail",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reader, err := workerInput()
+			if err != nil {
+				return err
+			}
+			data, err := renderThumbnail(reader, preview.Options{Width: width, Height: height, Format: format})
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		},
+	}
+	thumbnail.Flags().IntVar(&width, "width", 0, "Thumbnail width in pixels")
+	thumbnail.Flags().IntVar(&height, "height", 0, "Thumbnail height in pixels")
+	thumbnail.Flags().StringVar(&format, "format", "", "Image format")
+	cmd.AddCommand(thumbnail)
+
+	var (
+		memory            int64
+		timeout, deadline time.Duration
+	)
+	export := &cobra.Command{
+		Use:           "export",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reader, err := workerInput()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			if deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, deadline)
+				defer cancel()
+			}
+
+			// Output goes to the server as it is committed, so it keeps
+			// what was converted if the worker is killed
+			b := newExportBudget(ctx, timeout, memory)
+			sent := 0
+			b.onStage = func(stage string) {
+				fmt.Fprintf(os.Stderr, "%sstage %s\n", workerProgress, stage)
+			}
+			b.onCommit = func(committed []byte) error {
+				if _, err := os.Stdout.Write(committed); err != nil {
+					return err
+				}
+				sent += len(committed)
+				_, err := fmt.Fprintf(os.Stderr, "%scommit %d\n", workerProgress, sent)
+				return err
+			}
+
+			err = exportPackage(reader, id, format, b)
+			var budget *jobs.BudgetError
+			if errors.As(err, &budget) {
+				report, _ := json.Marshal(budget)
+				fmt.Fprintf(os.Stderr, "%sbudget %s\n", workerProgress, report)
+			}
+			return err
+		},
+	}
+	export.Flags().StringVar(&id, "id", "", "ID of the uploaded document")
+	export.Flags().StringVar(&format, "format", "", "Format to convert to")
+	export.Flags().Int64Var(&memory, "memory", 0, "Memory budget in bytes")
+	export.Flags().DurationVar(&timeout, "timeout", 0, "Time budget of the job, as reported to users")
+	export.Flags().DurationVar(&deadline, "deadline", 0, "Time after which the export stops and keeps its partial output")
+	cmd.AddCommand(export)
+
+	return cmd
+}
+
+// workerInput opens the document on standard input as a package
+func workerInput() (*zip.Reader, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New("worker input must be a file")
+	}
+	reader, err := zip.NewReader(os.Stdin, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("invalid document package: %v", err)
+	}
+	return reader, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/sections"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// sectionsPath is the API listing the sections of uploaded documents and
+// resolving links to them
+const sectionsPath = "/api/sections"
+
+// sectionsStylesheetPath highlights the section a link opened at
+const sectionsStylesheetPath = "/static/css/liv-sections.css"
+
+// pageSections are the sections of a page of a document
+type pageSections struct {
+	Page     string             `json:"page"`
+	Sections []sections.Section `json:"sections"`
+}
+
+// sectionTarget is the section a link resolved to
+type sectionTarget struct {
+	Page  string `json:"page"`
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+}
+
+// handleSections lists the sections of the pages of an uploaded document,
+// given by the id parameter. With a section parameter, it resolves a link
+// to a section instead, returning the page and anchor to open, or 404 when
+// no section matches. The page parameter names the page looked in first.
+func handleSections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	doc, reader, err := openStoredPackage(query.Get("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Document not available", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer doc.Close()
+
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		http.Error(w, "Invalid document manifest", http.StatusUnprocessableEntity)
+		return
+	}
+	if m.Encryption != nil {
+		// Encrypted pages are only ever read in the browser
+		http.Error(w, "Encrypted documents are rendered by the viewer", http.StatusForbidden)
+		return
+	}
+
+	pages := documentPages(m, query.Get("page"))
+	anchor := query.Get("section")
+	if anchor == "" {
+		list := []pageSections{}
+		for _, page := range pages {
+			if data, err := readZipEntry(reader, page); err == nil {
+				list = append(list, pageSections{Page: page, Sections: sections.List(data)})
+			}
+		}
+		writeAnnotationJSON(w, http.StatusOK, list)
+		return
+	}
+	if target, ok := resolveSection(reader, pages, anchor); ok {
+		writeAnnotationJSON(w, http.StatusOK, target)
+		return
+	}
+	http.Error(w, "Section not found", http.StatusNotFound)
+}
+
+// documentPages returns the HTML pages of a document's content: first the
+// page given, if it is one, then the index page and the rest by path
+func documentPages(m *core.Manifest, first string) []string {
+	var pages []string
+	for entry := range m.Resources {
+		if strings.HasPrefix(entry, "content/") && isContentEntry(entry) &&
+			strings.HasPrefix(mime.TypeByExtension(path.Ext(entry)), "text/html") {
+			pages = append(pages, entry)
+		}
+	}
+	rank := func(page string) int {
+		switch page {
+		case first:
+			return 0
+		case "content/index.html":
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if rank(pages[i]) != rank(pages[j]) {
+			return rank(pages[i]) < rank(pages[j])
+		}
+		return pages[i] < pages[j]
+	})
+	return pages
+}
+
+// resolveSection finds the section an anchor links to in the first of
+// pages with one. Anchors the pages use are preferred over headings whose
+// text matches, so a heading of a later page cannot shadow an anchor.
+func resolveSection(reader *zip.Reader, pages []string, anchor string) (sectionTarget, bool) {
+	loaded := make(map[string][]byte)
+	for _, exact := range []bool{true, false} {
+		for _, page := range pages {
+			data, ok := loaded[page]
+			if !ok {
+				data, _ = readZipEntry(reader, page)
+				loaded[page] = data
+			}
+			section, ok := sections.Match(data, anchor)
+			if ok && (!exact || section.ID == anchor) {
+				return sectionTarget{Page: page, ID: section.ID, Title: section.Title}, true
+			}
+		}
+	}
+	return sectionTarget{}, false
+}
+
+// injectSectionsStylesheet links the stylesheet highlighting the section a
+// link opened at from a page with sections
+func injectSectionsStylesheet(page []byte) []byte {
+	if len(sections.List(page)) == 0 {
+		return page
+	}
+	return injectIntoHead(page, `<link rel="stylesheet" href="`+sectionsStylesheetPath+`">`)
+}
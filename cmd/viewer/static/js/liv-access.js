@@ -0,0 +1,105 @@
+// LIV Viewer access policies
+//
+// Documents may only open between two dates, a limited number of times per
+// reader, or with the reader's identity laid over them. Before loading content
+// the viewer opens the document through the server, which enforces the policy
+// and grants the content to this reader. Documents without a policy open as
+// usual.
+(function (global) {
+    'use strict';
+
+    let grant = null;
+
+    function escapeHTML(text) {
+        const element = document.createElement('span');
+        element.textContent = String(text);
+        return element.innerHTML;
+    }
+
+    // DeniedError carries the server's explanation of a document that does
+    // not open
+    class DeniedError extends Error {
+        constructor(details) {
+            super(details.error);
+            this.name = 'DeniedError';
+            this.details = details;
+        }
+
+        // html explains why the document does not open, for showError
+        html() {
+            const hints = {
+                not_yet_valid: 'Try again once the document becomes available.',
+                expired: 'Ask the publisher for a current copy.',
+                open_limit: 'Ask the publisher to open it again.'
+            };
+            let text = escapeHTML(this.details.error.charAt(0).toUpperCase() + this.details.error.slice(1)) + '.';
+            if (hints[this.details.reason]) {
+                text += ' ' + escapeHTML(hints[this.details.reason]);
+            }
+            return text;
+        }
+    }
+
+    // showWatermark tiles the watermark over the page. It does not take
+    // pointer events, so the document stays usable beneath it.
+    function showWatermark(text) {
+        const layer = document.createElement('div');
+        layer.className = 'liv-watermark';
+        layer.setAttribute('aria-hidden', 'true');
+        layer.style.cssText = 'position:fixed;inset:0;z-index:9999;pointer-events:none;overflow:hidden;' +
+            'display:flex;flex-wrap:wrap;align-content:space-around;justify-content:space-around;' +
+            'transform:rotate(-30deg) scale(1.5);opacity:0.12;font:600 18px sans-serif;color:#000;user-select:none';
+        for (let i = 0; i < 24; i++) {
+            const tile = document.createElement('span');
+            tile.textContent = text;
+            tile.style.cssText = 'padding:48px;white-space:nowrap';
+            layer.appendChild(tile);
+        }
+        document.body.appendChild(layer);
+    }
+
+    const LIVAccess = {
+        DeniedError: DeniedError,
+
+        // open opens a document, or the served document without an id, under
+        // its access policy. It throws a DeniedError for documents that must
+        // not be opened now or by this reader.
+        async open(id) {
+            const response = await fetch('/api/access' + (id ? '?id=' + encodeURIComponent(id) : ''), { method: 'POST' });
+            if (response.status === 204) {
+                return null;
+            }
+            if (response.status === 403) {
+                throw new DeniedError(await response.json());
+            }
+            if (!response.ok) {
+                throw new Error('Failed to open document');
+            }
+            grant = await response.json();
+            if (grant.watermark) {
+                showWatermark(grant.watermark);
+            }
+            return grant;
+        },
+
+        // details describes the policy for the document information
+        details() {
+            if (!grant) {
+                return 'Access: unrestricted';
+            }
+            const limits = [];
+            if (grant.max_opens) {
+                limits.push('opened ' + grant.opens + ' of ' + grant.max_opens + ' times');
+            }
+            if (grant.not_after) {
+                limits.push('available until ' + new Date(grant.not_after).toLocaleString());
+            }
+            if (grant.watermark) {
+                limits.push('watermarked');
+            }
+            return 'Access: ' + (limits.length ? limits.join(', ') : 'restricted');
+        }
+    };
+
+    global.LIVAccess = LIVAccess;
+})(window);
@@ -0,0 +1,169 @@
+// LIV Viewer activity signals
+//
+// Documents should not spend power on animations and timers nobody sees.
+// The viewer tracks page visibility and, where the Battery Status API is
+// available, the battery, and tells the document runtime when to pause:
+// content frames get a liv:activity message, which the runtime loaded into
+// scripted pages acts on, viewer WASM instances a call to their
+// liv_set_active export, and content rendered in the viewer page has its
+// animations and media paused directly. The document's interactive spec can
+// keep components running.
+(function (global) {
+    'use strict';
+
+    // LOW_BATTERY is the charge at or below which a discharging device is
+    // low on battery
+    const LOW_BATTERY = 0.2;
+
+    const frames = [];
+    const listeners = [];
+    let battery = null;
+    let activity = {};
+    let last = null;
+
+    function state() {
+        const visible = !document.hidden;
+        const lowBattery = battery !== null && !battery.charging && battery.level <= LOW_BATTERY;
+        let reason = '';
+        if (!visible) {
+            reason = 'hidden';
+        } else if (lowBattery) {
+            reason = 'low_battery';
+        }
+        return {
+            visible: visible,
+            low_battery: lowBattery,
+            battery: battery,
+            paused: reason !== '',
+            reason: reason
+        };
+    }
+
+    function message(current) {
+        return {
+            type: 'liv:activity',
+            state: current,
+            keep_running: activity.keep_running || [],
+            keep_timers: !!activity.keep_timers
+        };
+    }
+
+    function post(frame, current) {
+        // Content frames have an opaque origin, so no target origin matches
+        if (frame.contentWindow) {
+            frame.contentWindow.postMessage(message(current), '*');
+        }
+    }
+
+    // notify signals a change of whether and why the document is paused;
+    // battery level changes alone are not worth waking the document for
+    function notify() {
+        const current = state();
+        if (last && last.paused === current.paused && last.reason === current.reason) {
+            return;
+        }
+        last = current;
+        frames.forEach((frame) => post(frame, current));
+        listeners.forEach((listener) => {
+            try {
+                listener(current);
+            } catch (error) {
+                console.warn('Activity listener failed:', error);
+            }
+        });
+    }
+
+    // kept reports whether an element is in a component kept running
+    function kept(element) {
+        return element instanceof Element && (activity.keep_running || []).some((selector) => {
+            try {
+                return element.closest(selector) !== null;
+            } catch (error) {
+                return false;
+            }
+        });
+    }
+
+    const LIVActivity = {
+        state: state,
+
+        // configure sets the activity section of the document's
+        // interactive spec
+        configure(spec) {
+            activity = spec || {};
+        },
+
+        // onChange calls listener with the current state, and again
+        // whenever the document is paused or resumed
+        onChange(listener) {
+            listeners.push(listener);
+            listener(state());
+        },
+
+        // attach signals a content frame whenever it loads a page, and
+        // answers the runtime in the frame asking for the current state
+        attach(frame) {
+            frames.push(frame);
+            frame.addEventListener('load', () => post(frame, state()));
+        },
+
+        // attachInstance pauses a WASM instance exporting liv_set_active,
+        // called with 0 to pause and 1 to resume
+        attachInstance(instance) {
+            const setActive = instance && instance.exports && instance.exports.liv_set_active;
+            if (typeof setActive !== 'function') {
+                return;
+            }
+            LIVActivity.onChange((current) => setActive(current.paused ? 0 : 1));
+        },
+
+        // attachElement pauses the animations and media of content rendered
+        // into element in the viewer page
+        attachElement(element) {
+            const animations = new Set();
+            const media = new Set();
+            LIVActivity.onChange((current) => {
+                if (current.paused) {
+                    element.getAnimations({ subtree: true }).forEach((animation) => {
+                        if (animation.playState === 'running' && !kept(animation.effect && animation.effect.target)) {
+                            animation.pause();
+                            animations.add(animation);
+                        }
+                    });
+                    element.querySelectorAll('video, audio').forEach((player) => {
+                        if (!player.paused && !kept(player)) {
+                            player.pause();
+                            media.add(player);
+                        }
+                    });
+                    return;
+                }
+                animations.forEach((animation) => animation.playState === 'paused' && animation.play());
+                media.forEach((player) => player.play().catch(() => {}));
+                animations.clear();
+                media.clear();
+            });
+        }
+    };
+
+    global.addEventListener('message', (event) => {
+        const frame = frames.find((candidate) => candidate.contentWindow === event.source);
+        if (frame && event.data && event.data.type === 'liv:activity-request') {
+            post(frame, state());
+        }
+    });
+    document.addEventListener('visibilitychange', notify);
+    if (navigator.getBattery) {
+        navigator.getBattery().then((manager) => {
+            const update = () => {
+                battery = { level: manager.level, charging: manager.charging };
+                notify();
+            };
+            manager.addEventListener('levelchange', update);
+            manager.addEventListener('chargingchange', update);
+            update();
+        }).catch(() => {});
+    }
+
+    global.LIVActivity = LIVActivity;
+})(window);
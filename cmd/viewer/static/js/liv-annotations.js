@@ -0,0 +1,410 @@
+// LIV Viewer annotations
+//
+// Readers highlight text, pin sticky notes and draw on document pages. The
+// side panel lists the annotations and picks the tool; the runtime loaded
+// into scripted pages draws them on the page and reports new ones with a
+// liv:annotation message, since content frames have an opaque origin. The
+// viewer tells the frame the tool with liv:annotate-tool and the
+// annotations to draw with liv:annotations.
+//
+// Annotations on uploaded documents are kept by the server under
+// /api/annotations, so every reader sees them; others are kept in this
+// browser only. Either way they export as a .annotations.json sidecar file,
+// and embedding stores a new revision of the document holding them, signed
+// when the server has an annotation key.
+(function (global) {
+    'use strict';
+
+    const SIDECAR_FORMAT = 'liv-annotations';
+    const SIDECAR_VERSION = 1;
+    const STORAGE_PREFIX = 'liv-annotations:';
+
+    const frames = [];
+    let documentId = null;
+    let documentName = 'document';
+    let documentTitle = '';
+    let server = false;
+    let signsRevisions = false;
+    let annotations = [];
+    let embedded = [];
+    let tool = 'none';
+    let color = '#ffe066';
+
+    function element(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) {
+            node.className = className;
+        }
+        if (text !== undefined) {
+            node.textContent = text;
+        }
+        return node;
+    }
+
+    function newID() {
+        const bytes = new Uint8Array(16);
+        crypto.getRandomValues(bytes);
+        return Array.from(bytes, (b) => b.toString(16).padStart(2, '0')).join('');
+    }
+
+    function storageKey() {
+        return STORAGE_PREFIX + (documentId || documentName);
+    }
+
+    function apiURL(rest) {
+        return '/api/annotations' + (rest ? '/' + rest : '') + '?id=' + encodeURIComponent(documentId);
+    }
+
+    async function request(method, rest, body) {
+        const options = { method: method, headers: {} };
+        if (body !== undefined) {
+            options.headers['Content-Type'] = 'application/json';
+            options.body = JSON.stringify(body);
+        }
+        const response = await fetch(apiURL(rest), options);
+        if (!response.ok) {
+            throw new Error((await response.text()).trim() || response.statusText);
+        }
+        return response.status === 204 ? null : response.json();
+    }
+
+    function saveLocal() {
+        try {
+            global.localStorage.setItem(storageKey(), JSON.stringify(annotations));
+        } catch (error) {
+            console.warn('Failed to keep annotations in this browser:', error);
+        }
+    }
+
+    function loadLocal() {
+        try {
+            const saved = JSON.parse(global.localStorage.getItem(storageKey()) || '[]');
+            return Array.isArray(saved) ? saved : [];
+        } catch (error) {
+            return [];
+        }
+    }
+
+    function sidecar() {
+        return {
+            format: SIDECAR_FORMAT,
+            version: SIDECAR_VERSION,
+            document: { filename: documentName, title: documentTitle },
+            exported: new Date().toISOString(),
+            annotations: annotations
+        };
+    }
+
+    // broadcast sends the frames the tool and what to draw
+    function broadcast() {
+        for (const frame of frames) {
+            if (!frame.contentWindow) {
+                continue;
+            }
+            // Content frames have an opaque origin, so no target origin matches
+            frame.contentWindow.postMessage({ type: 'liv:annotations', annotations: embedded.concat(annotations) }, '*');
+            frame.contentWindow.postMessage({ type: 'liv:annotate-tool', tool: tool, color: color }, '*');
+        }
+    }
+
+    function changed() {
+        if (!server) {
+            saveLocal();
+        }
+        broadcast();
+        render();
+    }
+
+    async function add(annotation) {
+        if (annotation.kind === 'note' && !annotation.text) {
+            annotation.text = (global.prompt('Note') || '').trim();
+            if (!annotation.text) {
+                return;
+            }
+        }
+        annotation.color = annotation.color || color;
+        try {
+            if (server) {
+                annotations.push(await request('POST', '', annotation));
+            } else {
+                const now = new Date().toISOString();
+                annotations.push(Object.assign({}, annotation, { id: newID(), created: now, modified: now }));
+            }
+        } catch (error) {
+            global.alert('Failed to save annotation: ' + error.message);
+        }
+        changed();
+    }
+
+    async function edit(annotation) {
+        const text = global.prompt(annotation.kind === 'note' ? 'Note' : 'Comment', annotation.text || '');
+        if (text === null) {
+            return;
+        }
+        const update = Object.assign({}, annotation, { text: text.trim() });
+        try {
+            const saved = server ? await request('PUT', annotation.id, update) : Object.assign(update, { modified: new Date().toISOString() });
+            annotations = annotations.map((a) => (a.id === annotation.id ? saved : a));
+        } catch (error) {
+            global.alert('Failed to change annotation: ' + error.message);
+        }
+        changed();
+    }
+
+    async function remove(annotation) {
+        try {
+            if (server) {
+                await request('DELETE', annotation.id);
+            }
+            annotations = annotations.filter((a) => a.id !== annotation.id);
+        } catch (error) {
+            global.alert('Failed to remove annotation: ' + error.message);
+        }
+        changed();
+    }
+
+    function download(blob, filename) {
+        const a = document.createElement('a');
+        a.href = URL.createObjectURL(blob);
+        a.download = filename;
+        document.body.appendChild(a);
+        a.click();
+        a.remove();
+        setTimeout(() => URL.revokeObjectURL(a.href), 0);
+    }
+
+    function exportSidecar() {
+        if (server) {
+            global.location.href = apiURL('export');
+            return;
+        }
+        const name = documentName.replace(/\.liv$/, '') || 'document';
+        download(new Blob([JSON.stringify(sidecar(), null, 2)], { type: 'application/json' }), name + '.annotations.json');
+    }
+
+    // embed stores a new revision holding the annotations and opens it
+    async function embed() {
+        const signed = signsRevisions ? ' The revision is signed by this server.' : ' The revision is not signed.';
+        if (!global.confirm('Store a new revision of the document with its annotations?' + signed)) {
+            return;
+        }
+        try {
+            const response = await fetch(apiURL('embed'), {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: server ? '' : JSON.stringify(sidecar())
+            });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim() || response.statusText);
+            }
+            const revision = await response.json();
+            global.location.href = '/viewer?id=' + encodeURIComponent(revision.id);
+        } catch (error) {
+            global.alert('Failed to embed annotations: ' + error.message);
+        }
+    }
+
+    function describe(annotation) {
+        if (annotation.kind === 'freehand') {
+            return 'Drawing';
+        }
+        if (annotation.quote && annotation.quote.exact) {
+            return '“' + annotation.quote.exact + '”';
+        }
+        return annotation.text || '';
+    }
+
+    function renderItem(annotation, own) {
+        const item = element('li', 'annotation-item annotation-' + annotation.kind);
+        item.dataset.id = annotation.id;
+        const swatch = element('span', 'annotation-swatch');
+        swatch.style.background = annotation.color || color;
+        item.append(swatch, element('span', 'annotation-summary', describe(annotation)));
+        if (annotation.kind !== 'note' && annotation.text) {
+            item.append(element('p', 'annotation-text', annotation.text));
+        }
+        const meta = [annotation.author, annotation.target, annotation.modified && new Date(annotation.modified).toLocaleString()].filter(Boolean);
+        item.append(element('div', 'annotation-meta', meta.join(' · ')));
+        if (own) {
+            const actions = element('div', 'annotation-actions');
+            if (annotation.kind !== 'freehand') {
+                const change = element('button', 'btn btn-secondary', annotation.kind === 'note' ? 'Edit' : 'Comment');
+                change.type = 'button';
+                change.addEventListener('click', () => edit(annotation));
+                actions.append(change);
+            }
+            const del = element('button', 'btn btn-secondary', 'Remove');
+            del.type = 'button';
+            del.addEventListener('click', () => remove(annotation));
+            actions.append(del);
+            item.append(actions);
+        }
+        return item;
+    }
+
+    function render() {
+        const panel = document.getElementById('annotationsPanel');
+        if (!panel || panel.hidden) {
+            return;
+        }
+        panel.replaceChildren();
+
+        const header = element('div', 'annotations-header');
+        header.append(element('h2', null, 'Annotations'));
+        header.append(element('span', 'annotations-mode', server ? 'Shared' : 'This browser only'));
+        panel.append(header);
+
+        const tools = element('div', 'annotations-tools');
+        tools.setAttribute('role', 'toolbar');
+        for (const [name, label] of [['none', 'Select'], ['highlight', 'Highlight'], ['note', 'Note'], ['freehand', 'Draw']]) {
+            const button = element('button', 'btn btn-secondary', label);
+            button.type = 'button';
+            button.setAttribute('aria-pressed', String(tool === name));
+            button.addEventListener('click', () => {
+                tool = name;
+                broadcast();
+                render();
+            });
+            tools.append(button);
+        }
+        const picker = element('input');
+        picker.type = 'color';
+        picker.value = color;
+        picker.title = 'Color';
+        picker.addEventListener('change', () => {
+            color = picker.value;
+            broadcast();
+        });
+        tools.append(picker);
+        panel.append(tools);
+        if (frames.length === 0) {
+            panel.append(element('p', 'annotations-hint', 'This page cannot be annotated; its annotations are listed below.'));
+        }
+
+        const list = element('ol', 'annotations-list');
+        for (const annotation of annotations) {
+            list.append(renderItem(annotation, true));
+        }
+        panel.append(list);
+        if (embedded.length) {
+            panel.append(element('h3', null, 'In this revision'));
+            const kept = element('ol', 'annotations-list');
+            for (const annotation of embedded) {
+                kept.append(renderItem(annotation, false));
+            }
+            panel.append(kept);
+        }
+
+        const actions = element('div', 'annotations-footer');
+        const exportButton = element('button', 'btn btn-secondary', 'Export');
+        exportButton.type = 'button';
+        exportButton.title = 'Download the annotations as a sidecar file';
+        exportButton.disabled = annotations.length === 0;
+        exportButton.addEventListener('click', exportSidecar);
+        actions.append(exportButton);
+        if (documentId) {
+            const embedButton = element('button', 'btn btn-secondary', signsRevisions ? 'Embed and sign' : 'Embed');
+            embedButton.type = 'button';
+            embedButton.title = 'Store a new revision of the document holding the annotations';
+            embedButton.disabled = annotations.length === 0;
+            embedButton.addEventListener('click', embed);
+            actions.append(embedButton);
+        }
+        panel.append(actions);
+    }
+
+    function focus(id) {
+        const panel = document.getElementById('annotationsPanel');
+        if (panel && panel.hidden) {
+            LIVAnnotations.toggle();
+        }
+        const item = panel && panel.querySelector('[data-id="' + CSS.escape(String(id)) + '"]');
+        if (item) {
+            item.scrollIntoView({ block: 'nearest' });
+            item.classList.add('annotation-focused');
+            setTimeout(() => item.classList.remove('annotation-focused'), 1500);
+        }
+    }
+
+    const LIVAnnotations = {
+        // configure loads the annotations of the document, from the server
+        // for uploaded documents when it keeps them, from this browser
+        // otherwise
+        async configure(id, filename, title) {
+            documentId = id || null;
+            documentName = filename || 'document';
+            documentTitle = title || '';
+            server = false;
+            annotations = [];
+            embedded = [];
+            if (documentId) {
+                try {
+                    const response = await fetch(apiURL(''));
+                    if (response.ok) {
+                        const listed = await response.json();
+                        annotations = listed.annotations || [];
+                        embedded = listed.embedded || [];
+                        signsRevisions = !!listed.signs_revisions;
+                        server = true;
+                    }
+                } catch (error) {
+                    console.warn('Annotations are kept in this browser:', error);
+                }
+            }
+            if (!server) {
+                annotations = loadLocal();
+            }
+            const toggle = document.getElementById('annotationsToggle');
+            if (toggle) {
+                toggle.hidden = false;
+            }
+            broadcast();
+        },
+
+        // toggle shows or hides the annotations panel
+        toggle() {
+            const panel = document.getElementById('annotationsPanel');
+            if (!panel) {
+                return;
+            }
+            panel.hidden = !panel.hidden;
+            render();
+            const toggle = document.getElementById('annotationsToggle');
+            if (toggle) {
+                toggle.setAttribute('aria-expanded', String(!panel.hidden));
+            }
+        },
+
+        // attach draws the annotations on a content frame and takes the
+        // annotations its reader makes
+        attach(frame) {
+            frames.push(frame);
+            frame.addEventListener('load', broadcast);
+        },
+
+        get annotations() {
+            return annotations.slice();
+        },
+
+        sidecar: sidecar
+    };
+
+    global.addEventListener('message', (event) => {
+        const frame = frames.find((candidate) => candidate.contentWindow === event.source);
+        const message = event.data;
+        if (!frame || !message) {
+            return;
+        }
+        if (message.type === 'liv:annotations-request') {
+            broadcast();
+        } else if (message.type === 'liv:annotation' && message.action === 'create' && message.annotation) {
+            // Pages are untrusted; only the fields of an annotation are kept
+            const a = message.annotation;
+            add({ kind: String(a.kind), target: String(a.target), quote: a.quote, position: a.position, points: a.points, width: a.width });
+        } else if (message.type === 'liv:annotation' && message.action === 'focus') {
+            focus(message.id);
+        }
+    });
+
+    global.LIVAnnotations = LIVAnnotations;
+})(window);
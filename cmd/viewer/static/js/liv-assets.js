@@ -0,0 +1,42 @@
+// LIV Viewer adaptive assets
+//
+// Documents may carry variants of their assets: images at several widths or
+// pixel densities, and data at a low and a high resolution. The viewer
+// describes the reader's screen and connection in the content URL, and the
+// server answers each asset request with the variant that suits them, so
+// small screens and slow or metered connections load less.
+(function (global) {
+    'use strict';
+
+    const NETWORKS = ['slow-2g', '2g', '3g', '4g'];
+
+    const LIVAssets = {
+        // profile describes the device for a frame width in CSS pixels,
+        // as in 2x_1280w_4g. Browsers without the Network Information API
+        // leave the connection out.
+        profile(width) {
+            const tokens = [(Math.round((global.devicePixelRatio || 1) * 100) / 100) + 'x'];
+            width = Math.round(width || global.innerWidth || 0);
+            if (width > 0) {
+                tokens.push(width + 'w');
+            }
+            const connection = navigator.connection;
+            if (connection) {
+                if (NETWORKS.includes(connection.effectiveType)) {
+                    tokens.push(connection.effectiveType);
+                }
+                if (connection.saveData) {
+                    tokens.push('save');
+                }
+            }
+            return tokens.join('_');
+        },
+
+        // contentURL adds the profile to a document content URL
+        contentURL(url, width) {
+            return url.replace(/^(\/api\/content\/[^/]+)\//, '$1/~' + LIVAssets.profile(width) + '/');
+        }
+    };
+
+    global.LIVAssets = LIVAssets;
+})(window);
@@ -0,0 +1,93 @@
+// LIV Viewer capability negotiation
+//
+// Documents declare the format version and features they need of a viewer.
+// Before rendering, the viewer asks the server to check them against what it
+// supports. A document it cannot fully render is not rendered partially: the
+// reader is told what is missing and offered a newer viewer or the static
+// version of the document. Features the viewer is phasing out are shown as a
+// notice.
+(function (global) {
+    'use strict';
+
+    let result = null;
+
+    function escapeHTML(text) {
+        const element = document.createElement('span');
+        element.textContent = String(text);
+        return element.innerHTML;
+    }
+
+    // IncompatibleError stops rendering of a document the viewer cannot
+    // fully render
+    class IncompatibleError extends Error {
+        constructor(details) {
+            super(details.negotiation.message);
+            this.name = 'IncompatibleError';
+            this.details = details;
+        }
+
+        // html lists what is missing and the remedies, for showError
+        html() {
+            const negotiation = this.details.negotiation;
+            let text = escapeHTML('This viewer cannot fully render the document.') + '</p><ul>' +
+                negotiation.mismatches.map((mismatch) => '<li>' + escapeHTML(mismatch.message) + '</li>').join('') +
+                '</ul><p>';
+            const remedies = [];
+            if (negotiation.remedies.includes('update_viewer')) {
+                const url = this.details.viewer.update_url;
+                remedies.push(url ? '<a href="' + escapeHTML(url) + '" rel="noopener">Update the viewer</a>' : 'Update the viewer');
+            }
+            if (negotiation.remedies.includes('open_fallback') && this.details.fallback_url) {
+                remedies.push('<a href="' + escapeHTML(this.details.fallback_url) + '">open the static version</a>');
+            }
+            return text + remedies.join(' or ') + '.';
+        }
+    }
+
+    function showNotice(warnings) {
+        const notice = document.getElementById('capabilityNotice');
+        if (!notice || !warnings.length) {
+            return;
+        }
+        notice.textContent = warnings.map((warning) => warning.feature + ': ' + warning.message +
+            (warning.removal ? ' (until viewer ' + warning.removal + ')' : '')).join('; ');
+        notice.hidden = false;
+    }
+
+    const LIVCapabilities = {
+        IncompatibleError: IncompatibleError,
+
+        // check negotiates the viewer's capabilities with a document, or the
+        // served document without an id. It throws an IncompatibleError for
+        // documents that must not be rendered.
+        async check(id) {
+            const response = await fetch('/api/capabilities' + (id ? '?id=' + encodeURIComponent(id) : ''));
+            if (!response.ok) {
+                throw new Error('Failed to check viewer capabilities');
+            }
+            result = await response.json();
+            if (!result.negotiation) {
+                return result;
+            }
+            if (!result.negotiation.compatible) {
+                throw new IncompatibleError(result);
+            }
+            showNotice(result.negotiation.warnings || []);
+            return result;
+        },
+
+        // details describes the last result for the document information
+        details() {
+            if (!result) {
+                return 'Viewer: not checked';
+            }
+            let text = 'Viewer: ' + result.viewer.viewer + ', format ' + result.viewer.format_version;
+            if (result.negotiation) {
+                text += '\nCompatibility: ' + result.negotiation.message;
+            }
+            return text;
+        }
+    };
+
+    global.LIVCapabilities = LIVCapabilities;
+})(window);
@@ -0,0 +1,80 @@
+// LIV Viewer data access
+//
+// Documents package data files under assets/data/ and declare them, with
+// the schema of their rows, in the manifest. Content frames have an opaque
+// origin and may not reach the viewer's API, so the runtime loaded into
+// scripted pages asks the viewer for data by name with a liv:data-request
+// message. The viewer loads the typed rows of the files the document
+// declares, and of no others, and answers with a liv:data message.
+(function (global) {
+    'use strict';
+
+    const frames = [];
+    let declared = new Map();
+    let loaded = new Map();
+
+    // load fetches the rows of a declared data file once
+    function load(name) {
+        if (!loaded.has(name)) {
+            const dataset = declared.get(name);
+            loaded.set(name, fetch(dataset.url).then((response) => {
+                if (!response.ok) {
+                    throw new Error('Failed to load data ' + name);
+                }
+                return response.json();
+            }).catch((error) => {
+                loaded.delete(name);
+                throw error;
+            }));
+        }
+        return loaded.get(name);
+    }
+
+    function answer(frame, request, reply) {
+        // Content frames have an opaque origin, so no target origin matches
+        if (frame.contentWindow) {
+            frame.contentWindow.postMessage(Object.assign({ type: 'liv:data', request: request }, reply), '*');
+        }
+    }
+
+    const LIVData = {
+        // configure sets the data files the document declares
+        configure(datasets) {
+            declared = new Map((datasets || []).map((dataset) => [dataset.name, dataset]));
+            loaded = new Map();
+        },
+
+        // datasets lists the declared data files with their schemas
+        datasets() {
+            return Array.from(declared.values());
+        },
+
+        // load returns a promise of the schema and rows of a declared data
+        // file
+        load(name) {
+            if (!declared.has(name)) {
+                return Promise.reject(new Error('The document has no data named ' + name));
+            }
+            return load(name);
+        },
+
+        // attach answers the data requests of a content frame
+        attach(frame) {
+            frames.push(frame);
+        }
+    };
+
+    global.addEventListener('message', (event) => {
+        const frame = frames.find((candidate) => candidate.contentWindow === event.source);
+        const message = event.data;
+        if (!frame || !message || message.type !== 'liv:data-request') {
+            return;
+        }
+        LIVData.load(String(message.name)).then(
+            (data) => answer(frame, message.request, { data: data }),
+            (error) => answer(frame, message.request, { error: error.message })
+        );
+    });
+
+    global.LIVData = LIVData;
+})(window);
@@ -0,0 +1,192 @@
+// LIV Viewer client-side decryption
+//
+// Encrypted documents are served as ciphertext. The content key is unwrapped
+// inside the liv-crypto WASM module using the reader's password or private key,
+// and resources are decrypted chunk by chunk as ranges are requested. Plaintext
+// only ever exists in this page.
+(function (global) {
+    'use strict';
+
+    const MANIFEST_PATH = 'manifest.json';
+
+    let runtimeReady = null;
+
+    // resourceURL streams an entry of the open document: of a stored
+    // document by its path, which answers range requests without reading
+    // the whole package
+    function resourceURL(path) {
+        const params = new URLSearchParams(window.location.search);
+        const id = params.get('id');
+        if (id) {
+            return '/api/document/' + encodeURIComponent(id) + '/resource/' +
+                path.split('/').map(encodeURIComponent).join('/');
+        }
+        return '/api/resource?' + new URLSearchParams({ path: path }).toString();
+    }
+
+    function loadScript(src) {
+        return new Promise((resolve, reject) => {
+            const script = document.createElement('script');
+            script.src = src;
+            script.onload = resolve;
+            script.onerror = () => reject(new Error('Failed to load ' + src));
+            document.head.appendChild(script);
+        });
+    }
+
+    // Load the Go WASM runtime and the crypto module once per page
+    function loadCryptoModule() {
+        if (!runtimeReady) {
+            runtimeReady = (async () => {
+                if (typeof Go === 'undefined') {
+                    await loadScript('/static/js/wasm_exec.js');
+                }
+                const go = new Go();
+                const response = await fetch('/static/wasm/liv-crypto.wasm');
+                if (!response.ok) {
+                    throw new Error('Decryption module not available');
+                }
+                const result = await WebAssembly.instantiate(await response.arrayBuffer(), go.importObject);
+                go.run(result.instance);
+                if (!global.livCrypto) {
+                    throw new Error('Decryption module failed to initialize');
+                }
+                return global.livCrypto;
+            })();
+        }
+        return runtimeReady;
+    }
+
+    function check(result) {
+        if (result instanceof Error) {
+            throw result;
+        }
+        return result;
+    }
+
+    // Ask the reader for a password or a PEM private key
+    function requestCredentials(message) {
+        return new Promise((resolve, reject) => {
+            const overlay = document.createElement('div');
+            overlay.className = 'liv-unlock-overlay';
+            overlay.innerHTML =
+                '<form class="liv-unlock-dialog">' +
+                '<h3>Encrypted document</h3>' +
+                '<p class="liv-unlock-message"></p>' +
+                '<label>Password <input type="password" name="password" autocomplete="off"></label>' +
+                '<label>or private key (PEM) <textarea name="privateKey" rows="4"></textarea></label>' +
+                '<div class="liv-unlock-actions">' +
+                '<button type="button" class="btn btn-secondary" data-action="cancel">Cancel</button>' +
+                '<button type="submit" class="btn">Unlock</button>' +
+                '</div></form>';
+            overlay.querySelector('.liv-unlock-message').textContent =
+                message || 'Enter the password or private key for this document. It is used only in your browser.';
+
+            const form = overlay.querySelector('form');
+            form.addEventListener('submit', (e) => {
+                e.preventDefault();
+                const credentials = {
+                    password: form.elements.password.value,
+                    privateKey: form.elements.privateKey.value.trim()
+                };
+                form.reset();
+                overlay.remove();
+                resolve(credentials);
+            });
+            overlay.querySelector('[data-action="cancel"]').addEventListener('click', () => {
+                overlay.remove();
+                reject(new Error('Document is locked'));
+            });
+
+            document.body.appendChild(overlay);
+            form.elements.password.focus();
+        });
+    }
+
+    class LIVDecryptor {
+        constructor(crypto, encryption, session) {
+            this.crypto = crypto;
+            this.encryption = encryption;
+            this.session = session;
+        }
+
+        // Open the served document, prompting for credentials if it is encrypted.
+        // Resolves to null for unencrypted documents.
+        static async open() {
+            const response = await fetch(resourceURL(MANIFEST_PATH));
+            if (!response.ok) {
+                return null;
+            }
+            const manifest = await response.json();
+            if (!manifest.encryption) {
+                return null;
+            }
+
+            const crypto = await loadCryptoModule();
+            const encryption = JSON.stringify(manifest.encryption);
+            let message = null;
+
+            for (;;) {
+                const credentials = await requestCredentials(message);
+                const session = credentials.privateKey
+                    ? crypto.unlockWithPrivateKey(encryption, credentials.privateKey)
+                    : crypto.unlockWithPassword(encryption, credentials.password);
+                if (!(session instanceof Error)) {
+                    return new LIVDecryptor(crypto, manifest.encryption, session);
+                }
+                message = session.message;
+            }
+        }
+
+        // Unlock a single resource set, such as a confidential section, with a passphrase
+        static async withPassword(encryption, password) {
+            const crypto = await loadCryptoModule();
+            const session = check(crypto.unlockWithPassword(JSON.stringify(encryption), password));
+            return new LIVDecryptor(crypto, encryption, session);
+        }
+
+        isEncrypted(path) {
+            return Boolean(this.encryption.resources[path]);
+        }
+
+        // Decrypt an inclusive plaintext byte range, fetching only the chunks that cover it
+        async readRange(path, start, end) {
+            const range = check(this.crypto.chunkRange(this.session, path, start, end === undefined ? -1 : end));
+            const response = await fetch(resourceURL(path), {
+                headers: { 'Range': 'bytes=' + range.start + '-' + range.end }
+            });
+            if (!response.ok) {
+                throw new Error('Failed to load ' + path);
+            }
+
+            const ciphertext = new Uint8Array(await response.arrayBuffer());
+            const plaintext = check(this.crypto.decryptChunks(this.session, path, range.firstChunk, ciphertext));
+
+            const offset = start - range.firstChunk * this.encryption.chunk_size;
+            const last = end === undefined || end < 0 ? range.plaintextSize - 1 : Math.min(end, range.plaintextSize - 1);
+            return plaintext.subarray(offset, offset + (last - start) + 1);
+        }
+
+        async readBytes(path) {
+            return this.readRange(path, 0);
+        }
+
+        async readText(path) {
+            return new TextDecoder().decode(await this.readBytes(path));
+        }
+
+        async readBlobURL(path) {
+            const info = this.encryption.resources[path];
+            const blob = new Blob([await this.readBytes(path)], { type: info.plaintext_type || 'application/octet-stream' });
+            return URL.createObjectURL(blob);
+        }
+
+        lock() {
+            this.crypto.lock(this.session);
+            this.session = null;
+        }
+    }
+
+    LIVDecryptor.resourceURL = resourceURL;
+    global.LIVDecryptor = LIVDecryptor;
+})(window);
@@ -0,0 +1,76 @@
+// LIV Viewer selective disclosure
+//
+// Confidential sections are sealed at build time and replaced with placeholders.
+// Readers holding a section key can unlock a section in place; the key and the
+// decrypted content never leave the page.
+(function (global) {
+    'use strict';
+
+    let manifestRequest = null;
+
+    function loadManifest() {
+        if (!manifestRequest) {
+            manifestRequest = fetch(LIVDecryptor.resourceURL('manifest.json'))
+                .then((response) => (response.ok ? response.json() : null))
+                .catch(() => null);
+        }
+        return manifestRequest;
+    }
+
+    async function sections() {
+        const manifest = await loadManifest();
+        return (manifest && manifest.disclosure && manifest.disclosure.sections) || {};
+    }
+
+    async function unlock(placeholder, section) {
+        const passphrase = window.prompt('Enter the key for "' + (section.label || placeholder.dataset.livSection) + '"');
+        if (!passphrase) {
+            return;
+        }
+
+        try {
+            const decryptor = await LIVDecryptor.withPassword(section.encryption, passphrase);
+            const content = await decryptor.readText(section.path);
+            decryptor.lock();
+
+            const container = placeholder.parentElement;
+            placeholder.remove();
+            container.insertAdjacentHTML('beforeend', content);
+            container.classList.add('liv-disclosed');
+        } catch (error) {
+            placeholder.querySelector('.liv-redacted-error').textContent = error.message;
+        }
+    }
+
+    const LIVDisclosure = {
+        // Report whether the served document has confidential sections
+        async hasSections() {
+            return Object.keys(await sections()).length > 0;
+        },
+
+        // Add unlock controls to every placeholder under root
+        async attach(root) {
+            const available = await sections();
+            root.querySelectorAll('.liv-redacted[data-liv-section]').forEach((placeholder) => {
+                const section = available[placeholder.dataset.livSection];
+                if (!section || placeholder.querySelector('button')) {
+                    return;
+                }
+
+                const button = document.createElement('button');
+                button.type = 'button';
+                button.className = 'btn btn-secondary';
+                button.textContent = 'Unlock';
+                button.addEventListener('click', () => unlock(placeholder, section));
+
+                const error = document.createElement('span');
+                error.className = 'liv-redacted-error';
+
+                placeholder.appendChild(button);
+                placeholder.appendChild(error);
+            });
+        }
+    };
+
+    global.LIVDisclosure = LIVDisclosure;
+})(window);
@@ -0,0 +1,197 @@
+// LIV Viewer events timeline
+//
+// Documents with a programme or schedule list their events in the events
+// section of their interactive spec. The viewer shows them as a timeline
+// beside the document, grouped by day with past, current and upcoming events
+// marked, and the toolbar exports them as an iCalendar file. Each event can
+// also be added to a calendar on its own.
+(function (global) {
+    'use strict';
+
+    let events = null;
+
+    // span returns when an event starts and ends; all-day events are dates
+    // and end on their last day
+    function span(event) {
+        const allDay = /^\d{4}-\d{2}-\d{2}$/.test(event.start);
+        const start = allDay ? new Date(event.start + 'T00:00:00') : new Date(event.start);
+        let end = start;
+        if (event.end) {
+            end = allDay ? new Date(event.end + 'T00:00:00') : new Date(event.end);
+        }
+        if (allDay) {
+            end = new Date(end.getFullYear(), end.getMonth(), end.getDate() + 1);
+        }
+        return { start: start, end: end, allDay: allDay };
+    }
+
+    function dayKey(date) {
+        return date.getFullYear() + '-' + (date.getMonth() + 1) + '-' + date.getDate();
+    }
+
+    function formatTime(date) {
+        return date.toLocaleTimeString(undefined, { hour: '2-digit', minute: '2-digit' });
+    }
+
+    function when(event, times) {
+        if (times.allDay) {
+            const last = new Date(times.end.getTime() - 1);
+            if (dayKey(last) === dayKey(times.start)) {
+                return 'All day';
+            }
+            return 'Until ' + last.toLocaleDateString(undefined, { weekday: 'short', day: 'numeric', month: 'short' });
+        }
+        if (times.end > times.start) {
+            return formatTime(times.start) + ' – ' + formatTime(times.end);
+        }
+        return formatTime(times.start);
+    }
+
+    function element(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) {
+            node.className = className;
+        }
+        if (text !== undefined) {
+            node.textContent = text;
+        }
+        return node;
+    }
+
+    function safeURL(value) {
+        try {
+            const url = new URL(value, window.location.href);
+            return url.protocol === 'https:' || url.protocol === 'http:' ? url.href : null;
+        } catch (error) {
+            return null;
+        }
+    }
+
+    function renderEvent(event, now) {
+        const times = span(event);
+        const item = element('li', 'event-item');
+        if (times.end <= now) {
+            item.classList.add('event-past');
+        }
+        if (times.start <= now && now < times.end) {
+            item.classList.add('event-now');
+        }
+
+        const toggle = element('button', 'event-summary');
+        toggle.type = 'button';
+        toggle.setAttribute('aria-expanded', 'false');
+        toggle.append(element('span', 'event-time', when(event, times)), element('span', 'event-title', event.title));
+        item.append(toggle);
+
+        const details = element('div', 'event-details');
+        details.hidden = true;
+        if (event.location) {
+            details.append(element('div', 'event-location', '📍 ' + event.location));
+        }
+        if (event.description) {
+            details.append(element('p', 'event-description', event.description));
+        }
+        const link = event.url && safeURL(event.url);
+        if (link) {
+            const more = element('a', null, 'More information');
+            more.href = link;
+            more.target = '_blank';
+            more.rel = 'noopener noreferrer';
+            details.append(more);
+        }
+        const add = element('a', 'event-add', 'Add to calendar');
+        add.href = events.calendar_url + '&event=' + encodeURIComponent(event.id);
+        add.setAttribute('download', '');
+        details.append(add);
+        item.append(details);
+
+        toggle.addEventListener('click', () => {
+            details.hidden = !details.hidden;
+            toggle.setAttribute('aria-expanded', String(!details.hidden));
+        });
+        return { item: item, times: times };
+    }
+
+    // render fills the timeline panel and returns the event on now or next
+    function render(panel) {
+        const now = new Date();
+        panel.replaceChildren();
+
+        const header = element('div', 'events-header');
+        header.append(element('h2', null, events.name || 'Events'));
+        const exportAll = element('a', 'btn btn-secondary', 'Add all to calendar');
+        exportAll.href = events.calendar_url;
+        exportAll.setAttribute('download', '');
+        header.append(exportAll);
+        panel.append(header);
+
+        const rendered = events.items.map((event) => renderEvent(event, now));
+        rendered.sort((a, b) => a.times.start - b.times.start);
+
+        const timeline = element('ol', 'events-timeline');
+        let day = null;
+        let list = null;
+        let next = null;
+        for (const entry of rendered) {
+            const key = dayKey(entry.times.start);
+            if (key !== day) {
+                day = key;
+                const group = element('li', 'events-day');
+                group.append(element('h3', null, entry.times.start.toLocaleDateString(undefined, { weekday: 'long', day: 'numeric', month: 'long', year: 'numeric' })));
+                list = element('ol', 'events-list');
+                group.append(list);
+                timeline.append(group);
+            }
+            list.append(entry.item);
+            if (!next && !entry.item.classList.contains('event-past')) {
+                next = entry.item;
+            }
+        }
+        panel.append(timeline);
+        if (next) {
+            next.classList.add('event-next');
+        }
+        return next;
+    }
+
+    const LIVEvents = {
+        // configure shows the toolbar controls of a document with events,
+        // given its events metadata, or hides them without
+        configure(metadata) {
+            events = metadata && metadata.items && metadata.items.length ? metadata : null;
+            const toggle = document.getElementById('eventsToggle');
+            const calendar = document.getElementById('calendarExport');
+            if (toggle) {
+                toggle.hidden = !events;
+            }
+            if (calendar) {
+                calendar.hidden = !events;
+                if (events) {
+                    calendar.href = events.calendar_url;
+                }
+            }
+        },
+
+        // toggle shows or hides the timeline
+        toggle() {
+            const panel = document.getElementById('eventsPanel');
+            if (!panel || !events) {
+                return;
+            }
+            const next = panel.hidden ? render(panel) : null;
+            panel.hidden = !panel.hidden;
+            // Open at what is on now or next
+            if (next) {
+                next.scrollIntoView({ block: 'nearest' });
+            }
+            const toggle = document.getElementById('eventsToggle');
+            if (toggle) {
+                toggle.setAttribute('aria-expanded', String(!panel.hidden));
+            }
+        },
+
+        span: span
+    };
+
+    global.LIVEvents = LIVEvents;
+})(window);
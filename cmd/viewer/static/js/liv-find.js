@@ -0,0 +1,294 @@
+// LIV Viewer find in document
+//
+// The find bar searches the text of the document as it is rendered. Scripted
+// content frames have an opaque origin, so the runtime loaded into them marks
+// the matches, answering the viewer's liv:find messages with the match count;
+// content rendered in the viewer itself, such as decrypted documents, is
+// searched here. Frames that run no scripts cannot be searched by the viewer
+// and keep the browser's own find.
+//
+// Ctrl+F opens the bar, Enter and F3 go to the next match and Shift with
+// either to the previous one, and Escape closes it.
+(function (global) {
+    'use strict';
+
+    const FIND_LIMIT = 1000;
+    const CURRENT = '#ff9632';
+    const MATCH = '#ffe066';
+
+    // The frame or element searched, or null when the document cannot be
+    let frame = null;
+    let root = null;
+    let query = '';
+    let index = 0;
+    let count = 0;
+    let limited = false;
+    let timer = null;
+    let marks = [];
+
+    function bar() {
+        return document.getElementById('findBar');
+    }
+
+    function input() {
+        return document.getElementById('findInput');
+    }
+
+    function showCount() {
+        const label = document.getElementById('findCount');
+        if (!label) {
+            return;
+        }
+        if (!query) {
+            label.textContent = '';
+        } else if (count === 0) {
+            label.textContent = 'No matches';
+        } else {
+            label.textContent = (index + 1) + ' of ' + count + (limited ? '+' : '');
+        }
+    }
+
+    function textNodes() {
+        const nodes = [];
+        const walker = document.createTreeWalker(root, NodeFilter.SHOW_TEXT, {
+            acceptNode: (node) => (node.parentElement && node.parentElement.closest('script, style, .loading-overlay') ? NodeFilter.FILTER_REJECT : NodeFilter.FILTER_ACCEPT)
+        });
+        while (walker.nextNode()) {
+            nodes.push(walker.currentNode);
+        }
+        return nodes;
+    }
+
+    function clearMarks() {
+        if (!root) {
+            return;
+        }
+        for (const mark of root.querySelectorAll('mark.liv-find')) {
+            mark.replaceWith(...mark.childNodes);
+        }
+        root.normalize();
+        marks = [];
+    }
+
+    // markMatches wraps each case-insensitive match of the query in marks,
+    // one list of marks per match since matches may span elements
+    function markMatches() {
+        const nodes = textNodes();
+        const text = nodes.map((node) => node.data).join('');
+        const pattern = new RegExp(query.replace(/[.*+?^${}()|[\]\\]/g, '\\$&'), 'giu');
+        const matches = [];
+        let match;
+        while ((match = pattern.exec(text)) && matches.length < FIND_LIMIT) {
+            matches.push([match.index, match.index + match[0].length]);
+        }
+
+        marks = matches.map(() => []);
+        // Wrapping from the last match keeps the offsets of earlier ones
+        let offset = text.length;
+        for (let n = nodes.length - 1, m = matches.length - 1; n >= 0 && m >= 0; n--) {
+            const node = nodes[n];
+            offset -= node.data.length;
+            for (; m >= 0 && matches[m][1] > offset; m--) {
+                const from = Math.max(matches[m][0] - offset, 0);
+                const to = Math.min(matches[m][1] - offset, node.data.length);
+                if (from < to) {
+                    const range = document.createRange();
+                    range.setStart(node, from);
+                    range.setEnd(node, to);
+                    const mark = document.createElement('mark');
+                    mark.className = 'liv-find';
+                    Object.assign(mark.style, { backgroundColor: MATCH, color: 'inherit' });
+                    range.surroundContents(mark);
+                    marks[m].unshift(mark);
+                }
+                if (matches[m][0] < offset) {
+                    // The match continues in the previous text node
+                    break;
+                }
+            }
+        }
+        limited = matches.length >= FIND_LIMIT;
+    }
+
+    // search marks the query in the document and moves to the match at
+    // index, wrapping around at either end
+    function search() {
+        if (frame) {
+            if (frame.contentWindow) {
+                // Content frames have an opaque origin, so no target origin matches
+                frame.contentWindow.postMessage({ type: 'liv:find', query: query, index: index }, '*');
+            }
+            return;
+        }
+        if (!root) {
+            return;
+        }
+
+        if (marks.length && marks[0][0] && marks[0][0].textContent.toLowerCase() !== query.toLowerCase()) {
+            clearMarks();
+        }
+        if (!marks.length || !marks.every((match) => match.every((mark) => mark.isConnected))) {
+            clearMarks();
+            if (query) {
+                markMatches();
+            }
+        }
+        for (const match of marks) {
+            for (const mark of match) {
+                mark.style.backgroundColor = MATCH;
+            }
+        }
+        count = marks.length;
+        index = count ? ((index % count) + count) % count : 0;
+        if (count) {
+            for (const mark of marks[index]) {
+                mark.style.backgroundColor = CURRENT;
+            }
+            if (marks[index].length) {
+                marks[index][0].scrollIntoView({ block: 'center', inline: 'nearest' });
+            }
+        }
+        showCount();
+    }
+
+    function step(delta) {
+        if (!LIVFind.available) {
+            return;
+        }
+        if (bar().hidden) {
+            LIVFind.open();
+        }
+        if (!query) {
+            return;
+        }
+        index += delta;
+        search();
+    }
+
+    const LIVFind = {
+        // attach makes the document rendered in element searchable: the
+        // content frame in it when the frame runs the runtime, else the
+        // element itself
+        attach(element) {
+            const content = element.querySelector('iframe.document-content');
+            frame = null;
+            root = null;
+            if (content) {
+                if (content.sandbox && content.sandbox.contains('allow-scripts')) {
+                    frame = content;
+                    // Pages the reader moves to are searched again
+                    frame.addEventListener('load', () => {
+                        if (!bar().hidden && query) {
+                            index = 0;
+                            search();
+                        }
+                    });
+                }
+            } else {
+                root = element;
+            }
+            const toggle = document.getElementById('findToggle');
+            if (toggle) {
+                toggle.hidden = !LIVFind.available;
+            }
+        },
+
+        // available reports whether the viewer can search the document, so
+        // it takes Ctrl+F from the browser
+        get available() {
+            return !!(frame || root) && !!bar();
+        },
+
+        open() {
+            if (!LIVFind.available) {
+                return;
+            }
+            bar().hidden = false;
+            input().focus();
+            input().select();
+        },
+
+        close() {
+            if (!bar()) {
+                return;
+            }
+            bar().hidden = true;
+            query = '';
+            index = 0;
+            count = 0;
+            if (frame) {
+                search();
+            } else {
+                clearMarks();
+            }
+            showCount();
+        },
+
+        next() {
+            step(1);
+        },
+
+        previous() {
+            step(-1);
+        }
+    };
+
+    const field = input();
+    if (field) {
+        field.addEventListener('input', () => {
+            clearTimeout(timer);
+            timer = setTimeout(() => {
+                query = field.value;
+                index = 0;
+                if (!frame) {
+                    clearMarks();
+                }
+                search();
+                if (!query) {
+                    showCount();
+                }
+            }, 150);
+        });
+        field.addEventListener('keydown', (event) => {
+            if (event.key === 'Enter') {
+                event.preventDefault();
+                if (field.value !== query) {
+                    clearTimeout(timer);
+                    query = field.value;
+                    index = 0;
+                    if (!frame) {
+                        clearMarks();
+                    }
+                    search();
+                } else {
+                    step(event.shiftKey ? -1 : 1);
+                }
+            } else if (event.key === 'Escape') {
+                event.preventDefault();
+                event.stopPropagation();
+                LIVFind.close();
+            }
+        });
+    }
+
+    global.addEventListener('message', (event) => {
+        const message = event.data;
+        if (!frame || event.source !== frame.contentWindow || !message) {
+            return;
+        }
+        if (message.type === 'liv:find-result' && message.query === query) {
+            count = Number(message.count) || 0;
+            index = Math.max(Number(message.index) || 0, 0);
+            limited = !!message.limited;
+            showCount();
+        } else if (message.type === 'liv:find-shortcut') {
+            if (message.action === 'open') {
+                LIVFind.open();
+            } else {
+                step(message.action === 'previous' ? -1 : 1);
+            }
+        }
+    });
+
+    global.LIVFind = LIVFind;
+})(window);
@@ -0,0 +1,159 @@
+// LIV Viewer graphics probing
+//
+// WebGL documents are probed for when they open: the viewer checks what the
+// device's WebGL can do against the graphics section of the document's
+// interactive spec and, when it falls short, takes the declared degradation
+// path. On the canvas2d path the document runs with WebGL unavailable, so it
+// draws with a 2D canvas instead; on the snapshot path the viewer shows the
+// spec's snapshot image or the static version of the document. The path
+// taken, and why, is reported for the usage report.
+(function (global) {
+    'use strict';
+
+    let capabilities = null;
+    let choice = null;
+
+    // context returns a WebGL context on a fresh canvas; a canvas keeps the
+    // first kind of context it gives out
+    function context(kind, attributes) {
+        try {
+            return document.createElement('canvas').getContext(kind, attributes);
+        } catch (e) {
+            return null;
+        }
+    }
+
+    function release(gl) {
+        // Browsers limit how many contexts are alive at once
+        const lose = gl.getExtension('WEBGL_lose_context');
+        if (lose) {
+            lose.loseContext();
+        }
+    }
+
+    // probe reports the device's WebGL support; contexts that only exist
+    // with a major performance caveat are software rendered
+    function probe() {
+        const result = {
+            webgl: false,
+            webgl2: false,
+            software: false,
+            max_texture_size: 0,
+            extensions: [],
+            canvas2d: !!context('2d')
+        };
+        const strict = { failIfMajorPerformanceCaveat: true };
+        let gl = context('webgl2', strict);
+        result.webgl2 = !!gl;
+        if (!gl) {
+            gl = context('webgl', strict);
+        }
+        if (!gl) {
+            gl = context('webgl2') || context('webgl');
+            result.software = !!gl;
+            result.webgl2 = !!gl && typeof WebGL2RenderingContext !== 'undefined' && gl instanceof WebGL2RenderingContext;
+        }
+        if (gl) {
+            result.webgl = true;
+            result.max_texture_size = gl.getParameter(gl.MAX_TEXTURE_SIZE) || 0;
+            result.extensions = gl.getSupportedExtensions() || [];
+            release(gl);
+        }
+        return result;
+    }
+
+    // shortfall names what the device lacks for the spec, or '' when it
+    // can run the document
+    function shortfall(spec, probed) {
+        if (!probed.webgl) {
+            return 'no_webgl';
+        }
+        if (probed.software && !spec.allow_software) {
+            return 'software_rendering';
+        }
+        if (spec.webgl2 && !probed.webgl2) {
+            return 'no_webgl2';
+        }
+        if (spec.min_texture_size && probed.max_texture_size < spec.min_texture_size) {
+            return 'small_textures';
+        }
+        if ((spec.extensions || []).some((name) => !probed.extensions.includes(name))) {
+            return 'missing_extension';
+        }
+        return '';
+    }
+
+    function report(documentId) {
+        if (!documentId) {
+            return;
+        }
+        fetch('/api/usage/rendering', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ document: documentId, path: choice.path, reason: choice.reason })
+        }).catch(() => {});
+    }
+
+    const LIVGraphics = {
+        // choose picks how to render a document from the graphics section
+        // of its metadata, reports it, and returns it: path is webgl,
+        // canvas2d or snapshot, and reason why the viewer degraded
+        choose(documentId, graphics) {
+            choice = null;
+            if (!graphics) {
+                return null;
+            }
+            if (!capabilities) {
+                capabilities = probe();
+            }
+            const reason = shortfall(graphics, capabilities);
+            let path = 'webgl';
+            if (reason) {
+                path = graphics.fallback === 'canvas2d' && capabilities.canvas2d ? 'canvas2d' : 'snapshot';
+            }
+            choice = { path: path, reason: reason, snapshot_url: graphics.snapshot_url };
+            report(documentId);
+            return choice;
+        },
+
+        // choice is the path chosen for the open document, if it uses WebGL
+        get choice() {
+            return choice;
+        },
+
+        // capabilities is what the last probe found
+        get capabilities() {
+            return capabilities;
+        },
+
+        // contentURL tells the document runtime to run without WebGL on the
+        // canvas2d path
+        contentURL(url) {
+            if (!choice || choice.path !== 'canvas2d') {
+                return url;
+            }
+            return url + (url.includes('?') ? '&' : '?') + 'liv-graphics=canvas2d';
+        },
+
+        // snapshot returns what the snapshot path shows instead of the
+        // document: the snapshot image, or a frame with the static version
+        snapshot(title) {
+            const url = choice.snapshot_url;
+            if (url.startsWith('/viewer?')) {
+                const frame = document.createElement('iframe');
+                frame.className = 'document-content';
+                frame.title = title;
+                frame.setAttribute('sandbox', '');
+                frame.src = url;
+                return frame;
+            }
+            const image = document.createElement('img');
+            image.className = 'document-snapshot';
+            image.alt = title;
+            image.src = url;
+            return image;
+        }
+    };
+
+    global.LIVGraphics = LIVGraphics;
+})(window);
@@ -0,0 +1,297 @@
+// LIV Viewer local documents
+//
+// Documents chosen on the start page are opened in this browser where they
+// can be: the liv-reader WASM module reads the package, checks its manifest
+// and resource hashes and verifies its signatures with the signer
+// certificate it carries, and the page is shown in a sandboxed frame with
+// its resources from memory. The file never leaves the reader's machine
+// unless they choose to upload it.
+//
+// Documents the browser cannot show are uploaded and opened by the server
+// as before: encrypted documents, those whose scripts need more than the
+// sandbox, or any when the module cannot be loaded.
+(function (global) {
+    'use strict';
+
+    const INDEX = 'content/index.html';
+    // URL_ATTRIBUTES are the attributes of a page that load resources
+    const URL_ATTRIBUTES = ['src', 'href', 'poster', 'data'];
+
+    let runtimeReady = null;
+    let current = null;
+
+    function loadScript(src) {
+        return new Promise((resolve, reject) => {
+            const script = document.createElement('script');
+            script.src = src;
+            script.onload = resolve;
+            script.onerror = () => reject(new Error('Failed to load ' + src));
+            document.head.appendChild(script);
+        });
+    }
+
+    // Load the Go WASM runtime and the reader module once per page
+    function loadReaderModule() {
+        if (!runtimeReady) {
+            runtimeReady = (async () => {
+                if (typeof Go === 'undefined') {
+                    await loadScript('/static/js/wasm_exec.js');
+                }
+                const go = new Go();
+                const response = await fetch('/static/wasm/liv-reader.wasm');
+                if (!response.ok) {
+                    throw new Error('Reader module not available');
+                }
+                const result = await WebAssembly.instantiate(await response.arrayBuffer(), go.importObject);
+                go.run(result.instance);
+                if (!global.livReader) {
+                    throw new Error('Reader module failed to initialize');
+                }
+                return global.livReader;
+            })();
+            runtimeReady.catch(() => {
+                runtimeReady = null;
+            });
+        }
+        return runtimeReady;
+    }
+
+    function check(result) {
+        if (result instanceof Error) {
+            throw result;
+        }
+        return result;
+    }
+
+    // sandboxFor returns the sandbox the document's scripts run in, as the
+    // server would serve its content, or null when it needs more
+    function sandboxFor(security) {
+        const js = (security && security.js_permissions) || {};
+        const storage = (security && security.storage_policy) || {};
+        switch (js.execution_mode || 'none') {
+            case 'none':
+                return '';
+            case 'sandboxed':
+                // Storage needs the viewer's origin
+                if (storage.allow_local_storage || storage.allow_session_storage || storage.allow_indexed_db || storage.allow_cookies) {
+                    return null;
+                }
+                return 'allow-scripts';
+            default:
+                return null;
+        }
+    }
+
+    // packagePath resolves a reference in a package file to the package
+    // path it names, or '' for references outside the package
+    function packagePath(base, reference) {
+        if (!reference || reference.startsWith('#') || /^[a-z][a-z0-9+.-]*:/i.test(reference) || reference.startsWith('//')) {
+            return '';
+        }
+        try {
+            const url = new URL(reference, 'https://package.invalid/' + base);
+            return decodeURIComponent(url.pathname.slice(1));
+        } catch (error) {
+            return '';
+        }
+    }
+
+    function fragment(reference) {
+        const index = reference.indexOf('#');
+        return index >= 0 ? reference.slice(index) : '';
+    }
+
+    // rewriteCSS points the url() references of a stylesheet at the
+    // package's resources
+    function rewriteCSS(text, base, urls) {
+        return text.replace(/url\(\s*(['"]?)([^'")]+)\1\s*\)/g, (match, quote, reference) => {
+            const url = urls.get(packagePath(base, reference.trim()));
+            return url ? 'url("' + url + fragment(reference) + '")' : match;
+        });
+    }
+
+    // page returns the document's page with its resources from memory and
+    // a policy that lets it load nothing from the network
+    function page(html, urls, scripts) {
+        const doc = new DOMParser().parseFromString(html, 'text/html');
+        for (const attribute of URL_ATTRIBUTES) {
+            for (const node of doc.querySelectorAll('[' + attribute + ']')) {
+                const reference = node.getAttribute(attribute);
+                const url = urls.get(packagePath(INDEX, reference));
+                if (url) {
+                    node.setAttribute(attribute, url + fragment(reference));
+                }
+            }
+        }
+        for (const style of doc.querySelectorAll('style')) {
+            style.textContent = rewriteCSS(style.textContent, INDEX, urls);
+        }
+        const csp = doc.createElement('meta');
+        csp.httpEquiv = 'Content-Security-Policy';
+        csp.content = "default-src 'none'; img-src blob: data:; media-src blob: data:; font-src blob: data:; " +
+            "style-src blob: 'unsafe-inline'; script-src " + (scripts ? "blob: 'unsafe-inline'" : "'none'");
+        doc.head.prepend(csp);
+        return '<!DOCTYPE html>\n' + doc.documentElement.outerHTML;
+    }
+
+    function element(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) {
+            node.className = className;
+        }
+        if (text !== undefined) {
+            node.textContent = text;
+        }
+        return node;
+    }
+
+    // trust describes what was checked of the document
+    function trust(opened) {
+        const signature = opened.signature || {};
+        if (signature.verified) {
+            return { level: 'verified', text: 'Signed by ' + signature.signer + ' (certificate in the document)' };
+        }
+        if (signature.signed) {
+            return { level: 'warning', text: 'Signature not verified: ' + (signature.error || 'unknown error') };
+        }
+        return { level: 'info', text: 'Not signed; resources match the manifest' };
+    }
+
+    function show(opened, manifest, html, options) {
+        const metadata = manifest.metadata || {};
+        const view = element('section', 'local-view');
+        view.setAttribute('aria-label', 'Document opened in this browser');
+
+        const bar = element('div', 'local-bar');
+        const close = element('button', 'btn btn-secondary', '← Close');
+        close.type = 'button';
+        close.addEventListener('click', () => LIVLocal.close());
+        const title = element('strong', 'local-title', metadata.title || 'Document');
+        const checked = trust(opened);
+        const status = element('span', 'local-trust local-trust-' + checked.level, checked.text);
+        status.setAttribute('role', 'status');
+        bar.append(close, title, status);
+        if (options.upload) {
+            const upload = element('button', 'btn', 'Upload to share');
+            upload.type = 'button';
+            upload.title = 'Upload the document to open it with the full viewer';
+            upload.addEventListener('click', () => {
+                LIVLocal.close();
+                options.upload();
+            });
+            bar.append(upload);
+        }
+
+        const frame = document.createElement('iframe');
+        frame.className = 'local-content';
+        frame.title = metadata.title || 'Document';
+        frame.setAttribute('sandbox', options.sandbox);
+        frame.referrerPolicy = 'no-referrer';
+        frame.srcdoc = html;
+
+        view.append(bar, frame);
+        document.body.classList.add('local-open');
+        document.body.append(view);
+        close.focus();
+        return view;
+    }
+
+    const LIVLocal = {
+        // open shows a document chosen by the reader without uploading it.
+        // It resolves to false when the document has to be uploaded to be
+        // viewed, and rejects when the document is invalid. options.upload
+        // uploads it when the reader asks to.
+        async open(file, options) {
+            options = options || {};
+            let reader;
+            try {
+                reader = await loadReaderModule();
+            } catch (error) {
+                console.warn('Opening documents in the browser is not available:', error);
+                return false;
+            }
+
+            const opened = check(reader.open(new Uint8Array(await file.arrayBuffer())));
+            const keep = { id: opened.id, urls: [] };
+            try {
+                if (!opened.valid) {
+                    throw new Error(opened.errors.join('; ') || 'invalid document');
+                }
+                const manifest = JSON.parse(opened.manifest);
+                const sandbox = sandboxFor(manifest.security);
+                const paths = Array.from(check(reader.files(opened.id)));
+                if (manifest.encryption || sandbox === null || !paths.includes(INDEX)) {
+                    reader.close(opened.id);
+                    return false;
+                }
+
+                // Stylesheets refer to the other resources, and the page to both
+                const resources = manifest.resources || {};
+                const urls = new Map();
+                const add = (path, data) => {
+                    const type = (resources[path] && resources[path].type) || 'application/octet-stream';
+                    const url = URL.createObjectURL(new Blob([data], { type: type }));
+                    keep.urls.push(url);
+                    urls.set(path, url);
+                };
+                const decoder = new TextDecoder();
+                const stylesheets = [];
+                for (const path of paths) {
+                    if (path === INDEX || path === 'manifest.json' || path.startsWith('signatures/')) {
+                        continue;
+                    }
+                    if (path.endsWith('.css')) {
+                        stylesheets.push(path);
+                    } else {
+                        add(path, check(reader.read(opened.id, path)));
+                    }
+                }
+                for (const path of stylesheets) {
+                    add(path, rewriteCSS(decoder.decode(check(reader.read(opened.id, path))), path, urls));
+                }
+                const html = page(decoder.decode(check(reader.read(opened.id, INDEX))), urls, sandbox !== '');
+
+                LIVLocal.close();
+                keep.view = show(opened, manifest, html, { sandbox: sandbox, upload: options.upload });
+                current = keep;
+                return true;
+            } catch (error) {
+                for (const url of keep.urls) {
+                    URL.revokeObjectURL(url);
+                }
+                reader.close(opened.id);
+                throw error;
+            }
+        },
+
+        // close closes the document opened in the browser and frees its
+        // resources
+        close() {
+            if (!current) {
+                return;
+            }
+            current.view.remove();
+            for (const url of current.urls) {
+                URL.revokeObjectURL(url);
+            }
+            if (global.livReader) {
+                global.livReader.close(current.id);
+            }
+            current = null;
+            document.body.classList.remove('local-open');
+        },
+
+        // opened reports whether a document is open in the browser
+        get opened() {
+            return current !== null;
+        }
+    };
+
+    document.addEventListener('keydown', (event) => {
+        if (event.key === 'Escape' && current) {
+            LIVLocal.close();
+        }
+    });
+
+    global.LIVLocal = LIVLocal;
+})(window);
@@ -0,0 +1,410 @@
+// LIV Viewer bookmarks and navigation history
+//
+// The runtime loaded into scripted pages reports where the reader is with
+// liv:location messages. Pages loaded and fragments followed within the
+// document make the viewer's navigation history, which the back and
+// forward buttons, Alt+Left and Alt+Right step through with liv:navigate
+// messages, leaving the browser's history to the viewer page itself.
+//
+// Readers bookmark where they are with the bookmark button or Ctrl+D and
+// come back to it from the bookmarks panel. Bookmarks and the place last
+// read are kept for signed-in readers by the server under
+// /api/reading-state, so they follow the reader to other devices, and in
+// this browser otherwise. Opening the document again resumes where the
+// reader left off.
+(function (global) {
+    'use strict';
+
+    const STORAGE_PREFIX = 'liv-reading-state:';
+    const MAX_HISTORY = 100;
+    const MAX_LABEL = 200;
+    const SAVE_DELAY = 2000;
+
+    let frame = null;
+    let documentId = null;
+    let documentName = 'document';
+    let documentTitle = '';
+    let server = false;
+    let state = { bookmarks: [], last: null };
+    let entries = [];
+    let position = -1;
+    // pending is the location being navigated to, whose page is loading
+    let pending = null;
+    let started = false;
+    let saveTimer = null;
+
+    function element(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) {
+            node.className = className;
+        }
+        if (text !== undefined) {
+            node.textContent = text;
+        }
+        return node;
+    }
+
+    function newID() {
+        const bytes = new Uint8Array(16);
+        crypto.getRandomValues(bytes);
+        return Array.from(bytes, (b) => b.toString(16).padStart(2, '0')).join('');
+    }
+
+    function storageKey() {
+        return STORAGE_PREFIX + (documentId || documentName);
+    }
+
+    function apiURL() {
+        return '/api/reading-state?id=' + encodeURIComponent(documentId);
+    }
+
+    // place keeps the fields of a location; pages are untrusted
+    function place(location) {
+        const scroll = Number(location && location.scroll);
+        return {
+            page: String((location && location.page) || ''),
+            fragment: String((location && location.fragment) || ''),
+            scroll: isFinite(scroll) ? Math.min(Math.max(scroll, 0), 1) : 0,
+            heading: String((location && location.heading) || '').slice(0, MAX_LABEL)
+        };
+    }
+
+    function samePlace(a, b) {
+        return a.page === b.page && a.fragment === b.fragment;
+    }
+
+    async function save() {
+        clearTimeout(saveTimer);
+        saveTimer = null;
+        const body = {
+            bookmarks: state.bookmarks,
+            last: state.last && { page: state.last.page, fragment: state.last.fragment, scroll: state.last.scroll }
+        };
+        if (!server) {
+            try {
+                global.localStorage.setItem(storageKey(), JSON.stringify(body));
+            } catch (error) {
+                console.warn('Failed to keep bookmarks in this browser:', error);
+            }
+            return;
+        }
+        try {
+            const response = await fetch(apiURL(), {
+                method: 'PUT',
+                // The last save may be made as the reader leaves
+                keepalive: true,
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(body)
+            });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim() || response.statusText);
+            }
+        } catch (error) {
+            console.warn('Failed to save reading state:', error);
+        }
+    }
+
+    function loadLocal() {
+        try {
+            const saved = JSON.parse(global.localStorage.getItem(storageKey()) || '{}');
+            return saved && typeof saved === 'object' ? saved : {};
+        } catch (error) {
+            return {};
+        }
+    }
+
+    // post moves the page to a location
+    function post(location) {
+        if (frame && frame.contentWindow) {
+            // Content frames have an opaque origin, so no target origin matches
+            frame.contentWindow.postMessage({ type: 'liv:navigate', location: { page: location.page, fragment: location.fragment, scroll: location.scroll } }, '*');
+        }
+    }
+
+    function push(location) {
+        entries = entries.slice(0, position + 1);
+        entries.push(location);
+        if (entries.length > MAX_HISTORY) {
+            entries.shift();
+        }
+        position = entries.length - 1;
+    }
+
+    // go moves offset entries through the history
+    function go(offset) {
+        const to = position + offset;
+        if (to < 0 || to >= entries.length) {
+            return;
+        }
+        position = to;
+        pending = entries[to];
+        post(pending);
+        update();
+    }
+
+    // remember keeps where the reader is as the place last read, saved a
+    // little after the reader stops moving
+    function remember(location) {
+        state.last = location;
+        clearTimeout(saveTimer);
+        saveTimer = setTimeout(save, SAVE_DELAY);
+    }
+
+    function located(kind, location) {
+        if (kind === 'load' && pending) {
+            // The page of a location moved to loaded; place it there
+            const target = pending;
+            pending = null;
+            if (target.page === location.page) {
+                post(target);
+                return;
+            }
+        }
+        if (kind === 'load' && !started) {
+            started = true;
+            entries = [location];
+            position = 0;
+            const last = state.last && place(state.last);
+            if (last && last.page && !location.fragment && (!samePlace(last, location) || last.scroll !== location.scroll)) {
+                // Resume where the reader left off
+                entries[0] = Object.assign(last, { heading: '' });
+                pending = entries[0];
+                post(pending);
+            }
+        } else if (kind === 'load' && !(entries[position] && entries[position].page === location.page)) {
+            push(location);
+        } else if (kind === 'jump') {
+            push(location);
+        } else if (position >= 0) {
+            // Scrolling, moves the viewer made and reloads keep the entry
+            entries[position] = location;
+            if (kind === 'navigate') {
+                pending = null;
+            }
+        }
+        remember(location);
+        update();
+    }
+
+    function bookmark() {
+        const current = entries[position];
+        if (!current) {
+            return;
+        }
+        const label = global.prompt('Bookmark', current.heading || documentTitle || current.page);
+        if (label === null) {
+            return;
+        }
+        state.bookmarks.push({
+            id: newID(),
+            label: (label.trim() || current.heading || current.page).slice(0, MAX_LABEL),
+            page: current.page,
+            fragment: current.fragment,
+            scroll: current.scroll,
+            created: new Date().toISOString()
+        });
+        changed();
+    }
+
+    function open(saved) {
+        const target = place(saved);
+        target.heading = saved.label;
+        push(target);
+        pending = target;
+        post(target);
+        update();
+    }
+
+    function rename(saved) {
+        const label = global.prompt('Bookmark', saved.label);
+        if (label === null || !label.trim()) {
+            return;
+        }
+        saved.label = label.trim().slice(0, MAX_LABEL);
+        changed();
+    }
+
+    function remove(saved) {
+        state.bookmarks = state.bookmarks.filter((b) => b !== saved);
+        changed();
+    }
+
+    function changed() {
+        save();
+        render();
+        update();
+    }
+
+    function update() {
+        const back = document.getElementById('historyBack');
+        const forward = document.getElementById('historyForward');
+        if (back) {
+            back.disabled = position <= 0;
+        }
+        if (forward) {
+            forward.disabled = position < 0 || position >= entries.length - 1;
+        }
+    }
+
+    function render() {
+        const panel = document.getElementById('bookmarksPanel');
+        if (!panel || panel.hidden) {
+            return;
+        }
+        panel.replaceChildren();
+
+        const header = element('div', 'annotations-header');
+        header.append(element('h2', null, 'Bookmarks'));
+        header.append(element('span', 'annotations-mode', server ? 'Synced' : 'This browser only'));
+        panel.append(header);
+
+        const add = element('button', 'btn btn-secondary', 'Bookmark this place');
+        add.type = 'button';
+        add.title = 'Bookmark (Ctrl+D)';
+        add.disabled = position < 0;
+        add.addEventListener('click', bookmark);
+        panel.append(add);
+
+        const list = element('ol', 'bookmarks-list');
+        for (const saved of state.bookmarks) {
+            const item = element('li', 'bookmark-item');
+            const link = element('button', 'bookmark-label', saved.label);
+            link.type = 'button';
+            link.addEventListener('click', () => open(saved));
+            const meta = [saved.page, saved.created && new Date(saved.created).toLocaleString()].filter(Boolean);
+            item.append(link, element('div', 'annotation-meta', meta.join(' · ')));
+            const actions = element('div', 'annotation-actions');
+            const change = element('button', 'btn btn-secondary', 'Rename');
+            change.type = 'button';
+            change.addEventListener('click', () => rename(saved));
+            const del = element('button', 'btn btn-secondary', 'Remove');
+            del.type = 'button';
+            del.addEventListener('click', () => remove(saved));
+            actions.append(change, del);
+            item.append(actions);
+            list.append(item);
+        }
+        panel.append(list);
+        if (state.bookmarks.length === 0) {
+            panel.append(element('p', 'annotations-hint', 'No bookmarks yet.'));
+        }
+    }
+
+    const LIVNavigation = {
+        // configure loads the reader's bookmarks and the place last read,
+        // from the server for signed-in readers of uploaded documents, from
+        // this browser otherwise
+        async configure(id, filename, title) {
+            documentId = id || null;
+            documentName = filename || 'document';
+            documentTitle = title || '';
+            server = false;
+            let saved = null;
+            if (documentId) {
+                try {
+                    const response = await fetch(apiURL());
+                    if (response.ok) {
+                        saved = await response.json();
+                        server = true;
+                    }
+                } catch (error) {
+                    console.warn('Bookmarks are kept in this browser:', error);
+                }
+            }
+            if (!server) {
+                saved = loadLocal();
+            }
+            state = {
+                bookmarks: Array.isArray(saved.bookmarks) ? saved.bookmarks.filter((b) => b && b.page) : [],
+                last: saved.last || null
+            };
+        },
+
+        // attach follows where the reader is in a scripted content frame
+        attach(content) {
+            frame = content;
+            entries = [];
+            position = -1;
+            pending = null;
+            started = false;
+            for (const id of ['historyBack', 'historyForward', 'bookmarksToggle']) {
+                const button = document.getElementById(id);
+                if (button) {
+                    button.hidden = false;
+                }
+            }
+            update();
+        },
+
+        // available reports whether the viewer follows the document, so it
+        // takes the navigation shortcuts from the browser
+        get available() {
+            return frame !== null;
+        },
+
+        // toggle shows or hides the bookmarks panel
+        toggle() {
+            const panel = document.getElementById('bookmarksPanel');
+            if (!panel) {
+                return;
+            }
+            panel.hidden = !panel.hidden;
+            render();
+            const toggle = document.getElementById('bookmarksToggle');
+            if (toggle) {
+                toggle.setAttribute('aria-expanded', String(!panel.hidden));
+            }
+        },
+
+        back() {
+            go(-1);
+        },
+
+        forward() {
+            go(1);
+        },
+
+        bookmark: bookmark,
+
+        // visit goes to a section of the document, as a new place in the
+        // history
+        visit(page, fragment, heading) {
+            const target = { page: String(page), fragment: String(fragment || ''), scroll: null, heading: String(heading || '') };
+            push(target);
+            pending = target;
+            post(target);
+            update();
+        },
+
+        get bookmarks() {
+            return state.bookmarks.slice();
+        }
+    };
+
+    global.addEventListener('message', (event) => {
+        const message = event.data;
+        if (!frame || event.source !== frame.contentWindow || !message) {
+            return;
+        }
+        if (message.type === 'liv:location') {
+            located(String(message.kind), place(message.location));
+        } else if (message.type === 'liv:navigation-shortcut') {
+            if (message.action === 'back') {
+                go(-1);
+            } else if (message.action === 'forward') {
+                go(1);
+            } else if (message.action === 'bookmark') {
+                bookmark();
+            }
+        }
+    });
+
+    // The place last read is kept when the reader leaves
+    global.addEventListener('pagehide', () => {
+        if (saveTimer !== null) {
+            save();
+        }
+    });
+
+    global.LIVNavigation = LIVNavigation;
+})(window);
@@ -0,0 +1,122 @@
+// LIV Viewer offline documents
+//
+// The viewer's service worker keeps the documents opened in this browser so
+// they can be read offline, within the space the server allows, dropping
+// the least recently opened first. The "Available offline" button shows
+// whether the open document is kept and lets the reader stop keeping it, or
+// keep it again. Documents with an access policy are only ever read online.
+(function (global) {
+    'use strict';
+
+    // TIMEOUT is how long to wait for the service worker, in milliseconds
+    const TIMEOUT = 3000;
+
+    let id = null;
+    let state = null;
+
+    function supported() {
+        return 'serviceWorker' in navigator && global.isSecureContext !== false;
+    }
+
+    // ask sends a message to the service worker and resolves to its answer,
+    // or null when there is no worker to answer
+    async function ask(message) {
+        if (!supported()) {
+            return null;
+        }
+        const registration = await Promise.race([
+            navigator.serviceWorker.ready,
+            new Promise((resolve) => setTimeout(resolve, TIMEOUT))
+        ]);
+        if (!registration || !registration.active) {
+            return null;
+        }
+        return new Promise((resolve) => {
+            const channel = new MessageChannel();
+            const timer = setTimeout(() => resolve(null), TIMEOUT);
+            channel.port1.onmessage = (event) => {
+                clearTimeout(timer);
+                resolve(event.data);
+            };
+            registration.active.postMessage(message, [channel.port2]);
+        });
+    }
+
+    function formatSize(bytes) {
+        if (bytes >= 1 << 20) {
+            return (bytes / (1 << 20)).toFixed(1) + ' MB';
+        }
+        return Math.max(1, Math.round(bytes / 1024)) + ' KB';
+    }
+
+    function render() {
+        const button = document.getElementById('offlineToggle');
+        if (!button) {
+            return;
+        }
+        button.hidden = !state || !state.supported;
+        if (button.hidden) {
+            return;
+        }
+        const blocked = state.restricted || state.too_large;
+        button.disabled = blocked;
+        button.setAttribute('aria-pressed', String(state.available && !blocked));
+        if (state.restricted) {
+            button.title = 'Not available offline: its access policy is checked online';
+        } else if (state.too_large) {
+            button.title = 'Not available offline: too large to keep in this browser';
+        } else if (!state.available) {
+            button.title = 'Keep available offline';
+        } else if (state.bytes > 0) {
+            button.title = 'Available offline (' + formatSize(state.bytes) + (state.complete ? '' : ', more as it loads') + '); click to remove';
+        } else {
+            button.title = 'Available offline once loaded; click to remove';
+        }
+    }
+
+    const LIVOffline = {
+        // register installs the service worker that keeps the viewer and
+        // opened documents available offline
+        register() {
+            if (!supported()) {
+                return Promise.resolve(null);
+            }
+            return navigator.serviceWorker.register('/sw.js').catch((error) => {
+                console.warn('Offline reading is not available:', error);
+                return null;
+            });
+        },
+
+        // configure shows whether the document is kept for offline reading
+        async configure(documentId) {
+            id = documentId || null;
+            state = null;
+            render();
+            if (!id) {
+                return;
+            }
+            await LIVOffline.register();
+            state = await ask({ type: 'liv:offline-status', id: id });
+            render();
+        },
+
+        // toggle keeps the document available offline, or stops keeping it
+        async toggle() {
+            if (!id || !state || state.restricted || state.too_large) {
+                return;
+            }
+            const answer = await ask({ type: 'liv:offline-set', id: id, available: !state.available });
+            if (answer) {
+                state = answer;
+            }
+            render();
+        },
+
+        // available reports whether the document is kept for offline reading
+        get available() {
+            return !!(state && state.supported && state.available && !state.restricted && !state.too_large);
+        }
+    };
+
+    global.LIVOffline = LIVOffline;
+})(window);
@@ -0,0 +1,422 @@
+// LIV Viewer document outline
+//
+// The outline sidebar lists the sections of an uploaded document from
+// /api/sections as a tree, nested by heading level and, in documents of
+// several pages, under their page. The section the reader is in, from the
+// runtime's liv:location messages, is highlighted and kept in view, and each
+// section shows how much of it has been read. Progress is kept in this
+// browser.
+//
+// The tree follows the WAI-ARIA tree pattern: Up and Down move between
+// sections, Right and Left expand and collapse them, Home and End go to the
+// first and last, Enter opens a section and typing a letter moves to the
+// next section starting with it. Alt+O, in the viewer or the page, opens
+// and closes the outline; Escape closes it.
+(function (global) {
+    'use strict';
+
+    const STORAGE_PREFIX = 'liv-outline-progress:';
+    const SAVE_DELAY = 1000;
+
+    let frame = null;
+    let frameSrc = '';
+    let documentId = null;
+    let pages = [];
+    // items holds the tree item of each section by its key
+    let items = new Map();
+    let progress = {};
+    let current = null;
+    // revealed is the current section last expanded and scrolled to
+    let revealed = null;
+    let saveTimer = null;
+
+    function element(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) {
+            node.className = className;
+        }
+        if (text !== undefined) {
+            node.textContent = text;
+        }
+        return node;
+    }
+
+    function key(page, id) {
+        return page + '#' + id;
+    }
+
+    function storageKey() {
+        return STORAGE_PREFIX + documentId;
+    }
+
+    function loadProgress() {
+        try {
+            const saved = JSON.parse(global.localStorage.getItem(storageKey()) || '{}');
+            return saved && typeof saved === 'object' ? saved : {};
+        } catch (error) {
+            return {};
+        }
+    }
+
+    function saveProgress() {
+        clearTimeout(saveTimer);
+        saveTimer = setTimeout(() => {
+            try {
+                global.localStorage.setItem(storageKey(), JSON.stringify(progress));
+            } catch (error) {
+                console.warn('Failed to keep reading progress in this browser:', error);
+            }
+        }, SAVE_DELAY);
+    }
+
+    // read is how much of a section was read, 0 to 1
+    function read(page, id) {
+        const value = Number(progress[key(page, id)]);
+        return isFinite(value) ? Math.min(Math.max(value, 0), 1) : 0;
+    }
+
+    function pageLabel(page) {
+        return page.replace(/^content\//, '');
+    }
+
+    // build nests the sections of a page by heading level under parent, the
+    // top ones at the tree level given
+    function build(parent, page, level) {
+        const stack = [{ level: 0, group: parent }];
+        for (const section of page.sections) {
+            while (stack.length > 1 && stack[stack.length - 1].level >= section.level) {
+                stack.pop();
+            }
+            const item = treeItem(section.title || section.id, page.page, section.id, level + stack.length - 1);
+            stack[stack.length - 1].group.append(item);
+            stack.push({ level: section.level, group: item.querySelector(':scope > ul') });
+        }
+    }
+
+    function treeItem(title, page, id, level) {
+        const item = element('li', 'outline-item');
+        item.setAttribute('role', 'treeitem');
+        item.setAttribute('aria-level', String(level));
+        item.tabIndex = -1;
+        item.dataset.page = page;
+        item.dataset.section = id;
+        item.dataset.title = title;
+
+        const row = element('div', 'outline-row');
+        const twisty = element('span', 'outline-twisty');
+        twisty.setAttribute('aria-hidden', 'true');
+        twisty.addEventListener('click', (event) => {
+            event.stopPropagation();
+            expand(item, item.getAttribute('aria-expanded') !== 'true');
+        });
+        const bar = element('span', 'outline-progress');
+        bar.setAttribute('aria-hidden', 'true');
+        bar.append(element('span', 'outline-progress-fill'));
+        row.append(twisty, element('span', 'outline-title', title), bar);
+        row.addEventListener('click', () => {
+            focus(item);
+            open(item);
+        });
+
+        const group = element('ul', 'outline-group');
+        group.setAttribute('role', 'group');
+        item.append(row, group);
+        if (id) {
+            items.set(key(page, id), item);
+        }
+        return item;
+    }
+
+    // finish marks the items with sections under them as expandable, and
+    // drops the groups of the others
+    function finish(tree) {
+        for (const item of tree.querySelectorAll('[role="treeitem"]')) {
+            const group = item.querySelector(':scope > ul');
+            if (group.children.length > 0) {
+                item.setAttribute('aria-expanded', 'true');
+            } else {
+                group.remove();
+            }
+        }
+    }
+
+    function render() {
+        const panel = document.getElementById('outlinePanel');
+        if (!panel) {
+            return;
+        }
+        items = new Map();
+        panel.replaceChildren();
+
+        const header = element('div', 'outline-header');
+        header.append(element('h2', null, 'Outline'));
+        const summary = element('span', 'outline-summary');
+        summary.id = 'outlineSummary';
+        header.append(summary);
+        panel.append(header);
+
+        const tree = element('ul', 'outline-tree');
+        tree.setAttribute('role', 'tree');
+        tree.setAttribute('aria-label', 'Document outline');
+        tree.addEventListener('keydown', keydown);
+        if (pages.length > 1) {
+            for (const page of pages) {
+                const item = treeItem(pageLabel(page.page), page.page, '', 1);
+                build(item.querySelector(':scope > ul'), page, 2);
+                tree.append(item);
+            }
+        } else if (pages.length === 1) {
+            build(tree, pages[0], 1);
+        }
+        finish(tree);
+        panel.append(tree);
+
+        const first = tree.querySelector('[role="treeitem"]');
+        if (first) {
+            first.tabIndex = 0;
+        }
+        update();
+    }
+
+    // update shows the progress of each section and the section read
+    function update() {
+        let total = 0;
+        let count = 0;
+        for (const [id, item] of items) {
+            const fraction = read(item.dataset.page, item.dataset.section);
+            const percent = Math.round(fraction * 100);
+            item.querySelector(':scope > .outline-row .outline-progress-fill').style.width = percent + '%';
+            item.classList.toggle('outline-read', fraction >= 1);
+            item.setAttribute('aria-label', item.dataset.title + ', ' + (fraction >= 1 ? 'read' : percent + '% read'));
+            if (id === current) {
+                item.setAttribute('aria-current', 'location');
+            } else {
+                item.removeAttribute('aria-current');
+            }
+            total += fraction;
+            count++;
+        }
+        const summary = document.getElementById('outlineSummary');
+        if (summary) {
+            summary.textContent = count ? Math.round(total / count * 100) + '% read' : '';
+        }
+        const item = items.get(current);
+        const panel = document.getElementById('outlinePanel');
+        if (item && (current !== revealed || panel.hidden)) {
+            for (let parent = item.parentElement.closest('[role="treeitem"]'); parent; parent = parent.parentElement.closest('[role="treeitem"]')) {
+                expand(parent, true);
+            }
+            if (!panel.hidden) {
+                // Collapsed again by the reader, it stays so until they move on
+                revealed = current;
+                item.querySelector(':scope > .outline-row').scrollIntoView({ block: 'nearest' });
+            }
+        }
+    }
+
+    function expand(item, open) {
+        if (item.hasAttribute('aria-expanded')) {
+            item.setAttribute('aria-expanded', String(open));
+        }
+    }
+
+    // visible lists the items not inside a collapsed one, in order
+    function visible() {
+        const panel = document.getElementById('outlinePanel');
+        return Array.from(panel.querySelectorAll('[role="treeitem"]')).filter((item) => {
+            for (let parent = item.parentElement.closest('[role="treeitem"]'); parent; parent = parent.parentElement.closest('[role="treeitem"]')) {
+                if (parent.getAttribute('aria-expanded') === 'false') {
+                    return false;
+                }
+            }
+            return true;
+        });
+    }
+
+    // focus moves the tree's single tab stop to an item
+    function focus(item) {
+        if (!item) {
+            return;
+        }
+        const panel = document.getElementById('outlinePanel');
+        for (const other of panel.querySelectorAll('[role="treeitem"][tabindex="0"]')) {
+            other.tabIndex = -1;
+        }
+        item.tabIndex = 0;
+        item.focus();
+    }
+
+    // open goes to the section of an item
+    function open(item) {
+        const page = item.dataset.page;
+        const id = item.dataset.section;
+        if (LIVNavigation.available) {
+            LIVNavigation.visit(page, id, item.dataset.title);
+        } else if (frame) {
+            // Pages without scripts are opened at the section
+            frame.src = LIVSections.contentURL(frameSrc, { page: page, id: id });
+        }
+    }
+
+    function keydown(event) {
+        const item = event.target.closest('[role="treeitem"]');
+        if (!item || event.altKey || event.ctrlKey || event.metaKey) {
+            return;
+        }
+        const list = visible();
+        const index = list.indexOf(item);
+        const expanded = item.getAttribute('aria-expanded');
+        let handled = true;
+        switch (event.key) {
+            case 'ArrowDown':
+                focus(list[index + 1]);
+                break;
+            case 'ArrowUp':
+                focus(list[index - 1]);
+                break;
+            case 'ArrowRight':
+                if (expanded === 'false') {
+                    expand(item, true);
+                } else if (expanded === 'true') {
+                    focus(list[index + 1]);
+                }
+                break;
+            case 'ArrowLeft':
+                if (expanded === 'true') {
+                    expand(item, false);
+                } else {
+                    focus(item.parentElement.closest('[role="treeitem"]'));
+                }
+                break;
+            case 'Home':
+                focus(list[0]);
+                break;
+            case 'End':
+                focus(list[list.length - 1]);
+                break;
+            case 'Enter':
+            case ' ':
+                open(item);
+                break;
+            case 'Escape':
+                LIVOutline.toggle(false);
+                break;
+            default:
+                handled = false;
+                if (event.key.length === 1 && event.key.trim()) {
+                    // Type-ahead to the next section starting with the letter
+                    const letter = event.key.toLowerCase();
+                    const next = list.slice(index + 1).concat(list.slice(0, index + 1))
+                        .find((candidate) => candidate.dataset.title.toLowerCase().startsWith(letter));
+                    focus(next);
+                    handled = true;
+                }
+        }
+        if (handled) {
+            event.preventDefault();
+            event.stopPropagation();
+        }
+    }
+
+    // located follows the section the reader is in and how much of the
+    // sections in view was read
+    function located(location) {
+        const page = String(location.page || '');
+        const reached = location.progress && typeof location.progress === 'object' ? location.progress : {};
+        let changed = false;
+        for (const [id, value] of Object.entries(reached)) {
+            const fraction = Math.min(Math.max(Number(value) || 0, 0), 1);
+            const name = key(page, String(id));
+            if (items.has(name) && fraction > read(page, String(id))) {
+                progress[name] = Math.round(fraction * 100) / 100;
+                changed = true;
+            }
+        }
+        if (changed) {
+            saveProgress();
+        }
+        const section = String(location.section || '');
+        current = section && items.has(key(page, section)) ? key(page, section) : null;
+        update();
+    }
+
+    const LIVOutline = {
+        // attach shows the outline of an uploaded document in a content
+        // frame, once its sections are listed
+        async attach(content, id) {
+            frame = content;
+            frameSrc = content.src;
+            documentId = id || null;
+            pages = [];
+            current = null;
+            revealed = null;
+            const toggle = document.getElementById('outlineToggle');
+            if (!documentId) {
+                return;
+            }
+            try {
+                const response = await fetch('/api/sections?id=' + encodeURIComponent(documentId));
+                if (!response.ok) {
+                    // Encrypted documents have no outline on the server
+                    return;
+                }
+                pages = (await response.json()).filter((page) => page.sections && page.sections.length > 0);
+            } catch (error) {
+                console.warn('Failed to load the document outline:', error);
+                return;
+            }
+            progress = loadProgress();
+            render();
+            if (toggle) {
+                toggle.hidden = pages.length === 0;
+            }
+        },
+
+        // available reports whether the document has an outline
+        get available() {
+            return pages.length > 0;
+        },
+
+        // toggle opens or closes the outline, or sets it open, moving the
+        // focus into it when it opens and back when it closes
+        toggle(open) {
+            const panel = document.getElementById('outlinePanel');
+            if (!panel || pages.length === 0) {
+                return;
+            }
+            panel.hidden = open === undefined ? !panel.hidden : !open;
+            const toggle = document.getElementById('outlineToggle');
+            if (toggle) {
+                toggle.setAttribute('aria-expanded', String(!panel.hidden));
+            }
+            if (panel.hidden) {
+                if (panel.contains(document.activeElement) && toggle) {
+                    toggle.focus();
+                }
+                return;
+            }
+            revealed = null;
+            update();
+            focus(items.get(current) || panel.querySelector('[role="treeitem"]'));
+        },
+
+        // progress is how much of each section was read, by page#anchor
+        get progress() {
+            return Object.assign({}, progress);
+        }
+    };
+
+    global.addEventListener('message', (event) => {
+        const message = event.data;
+        if (!frame || event.source !== frame.contentWindow || !message) {
+            return;
+        }
+        if (message.type === 'liv:location' && message.location) {
+            located(message.location);
+        } else if (message.type === 'liv:navigation-shortcut' && message.action === 'outline') {
+            LIVOutline.toggle();
+        }
+    });
+
+    global.LIVOutline = LIVOutline;
+})(window);
@@ -0,0 +1,843 @@
+// LIV document runtime: activity and graphics
+//
+// The viewer loads this script first in scripted document pages. It follows
+// the viewer's liv:activity messages: while the document is hidden or the
+// device is low on battery, animations and media are paused, timeouts and
+// animation frames are held until the document resumes and interval ticks
+// are skipped. Components the interactive spec lists in keep_running keep
+// animating and playing, and keep_timers leaves the timers alone. Documents
+// can follow the liv:activitychange event on window, read LIVRuntime.paused,
+// and schedule work that must not wait with LIVRuntime.unthrottled.
+//
+// When the viewer degrades a WebGL document to its canvas2d path, canvases
+// give out no WebGL contexts, as on devices without WebGL, so the document
+// falls back to drawing in 2D. LIVRuntime.graphics is the path taken.
+//
+// LIVRuntime.data(name) loads a data file the document declares in its
+// manifest, resolving to its schema and rows typed by the schema. The page
+// cannot fetch from the viewer itself; the viewer answers its requests.
+//
+// The viewer's liv:annotations messages list the reader's annotations, which
+// are drawn over the page: highlights mark the text they quote, notes are
+// pinned where they were placed and drawings are lines over the page. With
+// the tool liv:annotate-tool picks, the reader makes new ones, reported to
+// the viewer with liv:annotation messages.
+//
+// The viewer's liv:find messages search the page text: matches are marked,
+// the current one scrolled into view, and the count reported back with
+// liv:find-result. Ctrl+F and F3 in the page open the viewer's find bar and
+// step through the matches, with liv:find-shortcut messages.
+//
+// Where the reader is goes to the viewer in liv:location messages: the page,
+// the fragment jumped to, how far down the page and the heading above. The
+// viewer keeps its navigation history and bookmarks from them, and moves
+// the page back to a place with liv:navigate. Alt+Left, Alt+Right and
+// Ctrl+D in the page go back, forward and bookmark, and Alt+O opens the
+// outline, with liv:navigation-shortcut messages. Locations also tell how
+// much of each section in view has been read, for the outline's progress.
+// The viewer's zoom shortcuts, Ctrl+Plus, Ctrl+Minus, Ctrl+0, Alt+W and
+// Alt+P, go to it with liv:zoom-shortcut messages.
+//
+// Locations name the section the reader is in by its anchor, and headings
+// with one show a button under the pointer asking the viewer to copy a
+// link to their section, with liv:copy-section-link; only the viewer knows
+// the document's link.
+(function (global) {
+    'use strict';
+
+    const native = {
+        setTimeout: global.setTimeout.bind(global),
+        clearTimeout: global.clearTimeout.bind(global),
+        setInterval: global.setInterval.bind(global),
+        clearInterval: global.clearInterval.bind(global),
+        requestAnimationFrame: global.requestAnimationFrame.bind(global),
+        cancelAnimationFrame: global.cancelAnimationFrame.bind(global)
+    };
+
+    // The viewer marks the canvas2d path on the page URL, so it applies
+    // before the document's own scripts run
+    const graphics = new URLSearchParams(global.location.search).get('liv-graphics') === 'canvas2d' ? 'canvas2d' : 'webgl';
+    if (graphics === 'canvas2d') {
+        const webgl = /^(webgl2?|experimental-webgl)$/;
+        for (const Canvas of [global.HTMLCanvasElement, global.OffscreenCanvas]) {
+            if (!Canvas) {
+                continue;
+            }
+            const getContext = Canvas.prototype.getContext;
+            Canvas.prototype.getContext = function (kind, ...args) {
+                return webgl.test(kind) ? null : getContext.call(this, kind, ...args);
+            };
+        }
+    }
+
+    let state = { visible: true, low_battery: false, battery: null, paused: false, reason: '' };
+    let keepRunning = [];
+    let keepTimers = false;
+
+    // Work held while paused: timeouts by their id, and animation frames by
+    // the id the document was given, with their current native id
+    const heldTimeouts = new Map();
+    const heldFrames = new Map();
+    const frameIds = new Map();
+    let nextFrameId = 1;
+
+    const pausedAnimations = new Set();
+    const pausedMedia = new Set();
+
+    function throttled() {
+        return state.paused && !keepTimers;
+    }
+
+    function kept(element) {
+        return element instanceof Element && keepRunning.some((selector) => {
+            try {
+                return element.closest(selector) !== null;
+            } catch (error) {
+                return false;
+            }
+        });
+    }
+
+    global.setTimeout = function (callback, delay, ...args) {
+        if (typeof callback !== 'function') {
+            return native.setTimeout(callback, delay, ...args);
+        }
+        const id = native.setTimeout(() => {
+            if (throttled()) {
+                heldTimeouts.set(id, () => callback.apply(global, args));
+                return;
+            }
+            callback.apply(global, args);
+        }, delay);
+        return id;
+    };
+
+    global.clearTimeout = function (id) {
+        heldTimeouts.delete(id);
+        native.clearTimeout(id);
+    };
+
+    global.setInterval = function (callback, delay, ...args) {
+        if (typeof callback !== 'function') {
+            return native.setInterval(callback, delay, ...args);
+        }
+        return native.setInterval(() => {
+            if (!throttled()) {
+                callback.apply(global, args);
+            }
+        }, delay);
+    };
+
+    global.requestAnimationFrame = function (callback) {
+        const id = nextFrameId++;
+        const schedule = () => {
+            frameIds.set(id, native.requestAnimationFrame((time) => {
+                if (throttled()) {
+                    heldFrames.set(id, schedule);
+                    return;
+                }
+                frameIds.delete(id);
+                callback(time);
+            }));
+        };
+        schedule();
+        return id;
+    };
+
+    global.cancelAnimationFrame = function (id) {
+        heldFrames.delete(id);
+        if (frameIds.has(id)) {
+            native.cancelAnimationFrame(frameIds.get(id));
+            frameIds.delete(id);
+        }
+    };
+
+    function pause() {
+        document.getAnimations().forEach((animation) => {
+            if (animation.playState === 'running' && !kept(animation.effect && animation.effect.target)) {
+                animation.pause();
+                pausedAnimations.add(animation);
+            }
+        });
+        document.querySelectorAll('video, audio').forEach((player) => {
+            if (!player.paused && !kept(player)) {
+                player.pause();
+                pausedMedia.add(player);
+            }
+        });
+    }
+
+    function resume() {
+        pausedAnimations.forEach((animation) => animation.playState === 'paused' && animation.play());
+        pausedMedia.forEach((player) => player.play().catch(() => {}));
+        pausedAnimations.clear();
+        pausedMedia.clear();
+
+        // Held work runs once the signal has been handled
+        const timeouts = Array.from(heldTimeouts.values());
+        const frames = Array.from(heldFrames.values());
+        heldTimeouts.clear();
+        heldFrames.clear();
+        timeouts.forEach((run) => native.setTimeout(run, 0));
+        frames.forEach((schedule) => schedule());
+    }
+
+    function apply(message) {
+        keepRunning = Array.isArray(message.keep_running) ? message.keep_running : [];
+        keepTimers = !!message.keep_timers;
+        const previous = state;
+        state = Object.assign({}, message.state, { paused: !!(message.state && message.state.paused) });
+        if (state.paused === previous.paused && state.reason === previous.reason) {
+            return;
+        }
+        if (state.paused && !previous.paused) {
+            pause();
+        } else if (!state.paused && previous.paused) {
+            resume();
+        }
+        global.dispatchEvent(new CustomEvent('liv:activitychange', { detail: state }));
+    }
+
+    // Data requests waiting for the viewer's answer, by request number
+    const dataRequests = new Map();
+    let nextDataRequest = 1;
+
+    function data(name) {
+        return new Promise((resolve, reject) => {
+            if (global.parent === global) {
+                reject(new Error('Data is loaded through the LIV viewer'));
+                return;
+            }
+            const request = nextDataRequest++;
+            dataRequests.set(request, { resolve: resolve, reject: reject });
+            global.parent.postMessage({ type: 'liv:data-request', request: request, name: String(name) }, '*');
+        });
+    }
+
+    function answer(message) {
+        const pending = dataRequests.get(message.request);
+        if (!pending) {
+            return;
+        }
+        dataRequests.delete(message.request);
+        if (message.error) {
+            pending.reject(new Error(message.error));
+        } else {
+            pending.resolve(message.data);
+        }
+    }
+
+    // Annotations: places are fractions of the page's size, so they stay
+    // put at any window size
+    const SVG = 'http://www.w3.org/2000/svg';
+    let annotations = [];
+    let annotateTool = 'none';
+    let annotateColor = '#ffe066';
+    let overlay = null;
+    let drawing = null;
+
+    // page is the package path of this page, after the viewer's
+    // /api/content/{id}/ prefix and any asset variant segment
+    function page() {
+        const parts = global.location.pathname.split('/').slice(4);
+        if (parts.length && parts[0].startsWith('~')) {
+            parts.shift();
+        }
+        return decodeURIComponent(parts.join('/'));
+    }
+
+    function pageSize() {
+        const root = global.document.documentElement;
+        return { width: Math.max(root.scrollWidth, 1), height: Math.max(root.scrollHeight, 1) };
+    }
+
+    function report(message) {
+        if (global.parent !== global) {
+            global.parent.postMessage(Object.assign({ type: 'liv:annotation' }, message), '*');
+        }
+    }
+
+    function textNodes() {
+        const nodes = [];
+        const walker = global.document.createTreeWalker(global.document.body, NodeFilter.SHOW_TEXT, {
+            acceptNode: (node) => (node.parentElement && node.parentElement.closest('script, style, .liv-annotation-layer') ? NodeFilter.FILTER_REJECT : NodeFilter.FILTER_ACCEPT)
+        });
+        while (walker.nextNode()) {
+            nodes.push(walker.currentNode);
+        }
+        return nodes;
+    }
+
+    // highlight wraps the text a quote selects in marks, preferring the
+    // occurrence with the quoted prefix and suffix
+    function highlight(annotation) {
+        const quote = annotation.quote;
+        const nodes = textNodes();
+        const text = nodes.map((node) => node.data).join('');
+        let start = text.indexOf((quote.prefix || '') + quote.exact + (quote.suffix || ''));
+        if (start >= 0) {
+            start += (quote.prefix || '').length;
+        } else {
+            start = text.indexOf(quote.exact);
+        }
+        if (start < 0) {
+            return;
+        }
+        const end = start + quote.exact.length;
+        let offset = 0;
+        for (const node of nodes) {
+            const from = Math.max(start - offset, 0);
+            const to = Math.min(end - offset, node.data.length);
+            offset += node.data.length;
+            if (from >= to) {
+                continue;
+            }
+            const range = global.document.createRange();
+            range.setStart(node, from);
+            range.setEnd(node, to);
+            const mark = global.document.createElement('mark');
+            mark.className = 'liv-annotation';
+            mark.dataset.livAnnotation = annotation.id;
+            mark.style.backgroundColor = annotation.color || annotateColor;
+            mark.style.color = 'inherit';
+            if (annotation.text) {
+                mark.title = annotation.text;
+            }
+            range.surroundContents(mark);
+        }
+    }
+
+    function ensureOverlay() {
+        if (overlay && overlay.isConnected) {
+            return overlay;
+        }
+        overlay = global.document.createElement('div');
+        overlay.className = 'liv-annotation-layer';
+        Object.assign(overlay.style, { position: 'absolute', left: '0', top: '0', zIndex: '2147483647', pointerEvents: 'none' });
+        const svg = global.document.createElementNS(SVG, 'svg');
+        svg.setAttribute('viewBox', '0 0 1 1');
+        svg.setAttribute('preserveAspectRatio', 'none');
+        Object.assign(svg.style, { position: 'absolute', left: '0', top: '0', width: '100%', height: '100%', overflow: 'visible' });
+        overlay.append(svg);
+        overlay.addEventListener('pointerdown', startDrawing);
+        overlay.addEventListener('pointermove', continueDrawing);
+        overlay.addEventListener('pointerup', finishDrawing);
+        overlay.addEventListener('click', placeNote);
+        global.document.body.append(overlay);
+        return overlay;
+    }
+
+    function line(points, stroke, width) {
+        const polyline = global.document.createElementNS(SVG, 'polyline');
+        polyline.setAttribute('points', points.map((p) => p.x + ',' + p.y).join(' '));
+        polyline.setAttribute('fill', 'none');
+        polyline.setAttribute('stroke', stroke);
+        polyline.setAttribute('stroke-width', String(width || 3));
+        polyline.setAttribute('stroke-linecap', 'round');
+        polyline.setAttribute('stroke-linejoin', 'round');
+        polyline.setAttribute('vector-effect', 'non-scaling-stroke');
+        return polyline;
+    }
+
+    function pin(annotation) {
+        const note = global.document.createElement('button');
+        note.type = 'button';
+        note.className = 'liv-annotation-note';
+        note.textContent = '✎';
+        note.title = annotation.text || '';
+        note.setAttribute('aria-label', 'Note: ' + (annotation.text || ''));
+        Object.assign(note.style, {
+            position: 'absolute',
+            left: 'calc(' + annotation.position.x * 100 + '% - 12px)',
+            top: 'calc(' + annotation.position.y * 100 + '% - 12px)',
+            width: '24px',
+            height: '24px',
+            padding: '0',
+            border: '1px solid rgba(0, 0, 0, 0.3)',
+            borderRadius: '4px',
+            background: annotation.color || annotateColor,
+            cursor: 'pointer',
+            pointerEvents: 'auto'
+        });
+        note.addEventListener('click', (event) => {
+            event.stopPropagation();
+            report({ action: 'focus', id: annotation.id });
+        });
+        return note;
+    }
+
+    function drawAnnotations() {
+        for (const mark of global.document.querySelectorAll('mark.liv-annotation')) {
+            mark.replaceWith(...mark.childNodes);
+        }
+        global.document.body.normalize();
+        const layer = ensureOverlay();
+        const size = pageSize();
+        Object.assign(layer.style, { width: size.width + 'px', height: size.height + 'px' });
+        const svg = layer.querySelector('svg');
+        svg.replaceChildren();
+        for (const note of layer.querySelectorAll('.liv-annotation-note')) {
+            note.remove();
+        }
+
+        const target = page();
+        for (const annotation of annotations) {
+            if (annotation.target !== target) {
+                continue;
+            }
+            if (annotation.kind === 'highlight' && annotation.quote && annotation.quote.exact) {
+                highlight(annotation);
+            } else if (annotation.kind === 'note' && annotation.position) {
+                layer.append(pin(annotation));
+            } else if (annotation.kind === 'freehand' && Array.isArray(annotation.points)) {
+                svg.append(line(annotation.points, annotation.color || annotateColor, annotation.width));
+            }
+        }
+        setTool(annotateTool, annotateColor);
+    }
+
+    function setTool(tool, color) {
+        annotateTool = tool;
+        annotateColor = color || annotateColor;
+        const layer = ensureOverlay();
+        const capturing = tool === 'freehand' || tool === 'note';
+        layer.style.pointerEvents = capturing ? 'auto' : 'none';
+        layer.style.cursor = tool === 'freehand' ? 'crosshair' : tool === 'note' ? 'copy' : '';
+        layer.style.touchAction = capturing ? 'none' : '';
+    }
+
+    function pointAt(event) {
+        const size = pageSize();
+        const clamp = (v) => Math.min(Math.max(v, 0), 1);
+        return { x: clamp(event.pageX / size.width), y: clamp(event.pageY / size.height) };
+    }
+
+    function startDrawing(event) {
+        if (annotateTool !== 'freehand') {
+            return;
+        }
+        overlay.setPointerCapture(event.pointerId);
+        drawing = { points: [pointAt(event)], line: line([], annotateColor, 3) };
+        overlay.querySelector('svg').append(drawing.line);
+    }
+
+    function continueDrawing(event) {
+        if (!drawing) {
+            return;
+        }
+        drawing.points.push(pointAt(event));
+        drawing.line.setAttribute('points', drawing.points.map((p) => p.x + ',' + p.y).join(' '));
+    }
+
+    function finishDrawing() {
+        if (!drawing) {
+            return;
+        }
+        const points = drawing.points;
+        drawing = null;
+        if (points.length >= 2) {
+            report({ action: 'create', annotation: { kind: 'freehand', target: page(), points: points, width: 3 } });
+        }
+    }
+
+    function placeNote(event) {
+        if (annotateTool === 'note') {
+            report({ action: 'create', annotation: { kind: 'note', target: page(), position: pointAt(event) } });
+        }
+    }
+
+    // quoteSelection reports the selected text as a highlight, quoted with
+    // some of the text around it
+    function quoteSelection() {
+        if (annotateTool !== 'highlight') {
+            return;
+        }
+        const selection = global.getSelection();
+        const exact = selection ? selection.toString() : '';
+        if (!exact.trim() || selection.rangeCount === 0) {
+            return;
+        }
+        const range = selection.getRangeAt(0);
+        const before = global.document.createRange();
+        before.setStart(global.document.body, 0);
+        before.setEnd(range.startContainer, range.startOffset);
+        const after = global.document.createRange();
+        after.setStart(range.endContainer, range.endOffset);
+        after.setEnd(global.document.body, global.document.body.childNodes.length);
+        selection.removeAllRanges();
+        report({ action: 'create', annotation: {
+            kind: 'highlight',
+            target: page(),
+            quote: { exact: exact, prefix: before.toString().slice(-32), suffix: after.toString().slice(0, 32) }
+        } });
+    }
+
+    global.document.addEventListener('mouseup', quoteSelection);
+    global.document.addEventListener('click', (event) => {
+        const mark = event.target instanceof Element && event.target.closest('mark.liv-annotation');
+        if (mark && annotateTool === 'none') {
+            report({ action: 'focus', id: mark.dataset.livAnnotation });
+        }
+    });
+
+    // Find in page: the query marked and the match that is current
+    const FIND_LIMIT = 1000;
+    let findQuery = '';
+    let findMarks = [];
+    let findIndex = -1;
+
+    function clearFind() {
+        for (const mark of global.document.querySelectorAll('mark.liv-find')) {
+            mark.replaceWith(...mark.childNodes);
+        }
+        global.document.body.normalize();
+        findMarks = [];
+        findIndex = -1;
+    }
+
+    // markMatches wraps each case-insensitive match of the query in marks,
+    // one list of marks per match since matches may span elements
+    function markMatches(query) {
+        const nodes = textNodes();
+        const text = nodes.map((node) => node.data).join('');
+        const pattern = new RegExp(query.replace(/[.*+?^${}()|[\]\\]/g, '\\$&'), 'giu');
+        const matches = [];
+        let match;
+        while ((match = pattern.exec(text)) && matches.length < FIND_LIMIT) {
+            matches.push([match.index, match.index + match[0].length]);
+        }
+
+        const marks = matches.map(() => []);
+        // Wrapping from the last match keeps the offsets of earlier ones
+        let offset = text.length;
+        for (let n = nodes.length - 1, m = matches.length - 1; n >= 0 && m >= 0; n--) {
+            const node = nodes[n];
+            offset -= node.data.length;
+            for (; m >= 0 && matches[m][1] > offset; m--) {
+                const from = Math.max(matches[m][0] - offset, 0);
+                const to = Math.min(matches[m][1] - offset, node.data.length);
+                if (from < to) {
+                    const range = global.document.createRange();
+                    range.setStart(node, from);
+                    range.setEnd(node, to);
+                    const mark = global.document.createElement('mark');
+                    mark.className = 'liv-find';
+                    Object.assign(mark.style, { backgroundColor: '#ffe066', color: 'inherit' });
+                    range.surroundContents(mark);
+                    marks[m].unshift(mark);
+                }
+                if (matches[m][0] < offset) {
+                    // The match continues in the previous text node
+                    break;
+                }
+            }
+        }
+        return marks;
+    }
+
+    function find(message) {
+        const query = String(message.query || '');
+        if (query !== findQuery || !findMarks.every((marks) => marks.every((mark) => mark.isConnected))) {
+            clearFind();
+            findQuery = query;
+            if (query && global.document.body) {
+                findMarks = markMatches(query);
+            }
+        }
+        if (findIndex >= 0) {
+            for (const mark of findMarks[findIndex] || []) {
+                mark.style.backgroundColor = '#ffe066';
+            }
+        }
+        const count = findMarks.length;
+        findIndex = count ? ((Number(message.index) || 0) % count + count) % count : -1;
+        if (findIndex >= 0) {
+            const current = findMarks[findIndex];
+            for (const mark of current) {
+                mark.style.backgroundColor = '#ff9632';
+            }
+            if (current.length) {
+                current[0].scrollIntoView({ block: 'center', inline: 'nearest' });
+            }
+        }
+        global.parent.postMessage({ type: 'liv:find-result', query: query, count: count, index: findIndex, limited: count >= FIND_LIMIT }, '*');
+    }
+
+    // Find shortcuts in the page open the viewer's find bar, which the page
+    // would otherwise take from the browser's own
+    global.addEventListener('keydown', (event) => {
+        if (global.parent === global) {
+            return;
+        }
+        let action = '';
+        if ((event.ctrlKey || event.metaKey) && !event.altKey && event.key.toLowerCase() === 'f') {
+            action = 'open';
+        } else if (event.key === 'F3' || ((event.ctrlKey || event.metaKey) && event.key.toLowerCase() === 'g')) {
+            action = event.shiftKey ? 'previous' : 'next';
+        }
+        if (action) {
+            event.preventDefault();
+            global.parent.postMessage({ type: 'liv:find-shortcut', action: action }, '*');
+        }
+    });
+
+    let expectedHash = null;
+    let scrollTimer = null;
+
+    const HEADINGS = 'h1, h2, h3, h4, h5, h6';
+
+    // headingAbove is the last heading above the top of the window, naming
+    // where the reader is
+    function headingAbove() {
+        let found = null;
+        for (const candidate of global.document.querySelectorAll(HEADINGS)) {
+            if (candidate.getBoundingClientRect().top > 10) {
+                found = found || candidate;
+                break;
+            }
+            found = candidate;
+        }
+        return found;
+    }
+
+    // sectionOf is the anchor of a heading's section: its own id, or that of
+    // the section element it starts
+    function sectionOf(found) {
+        if (!found) {
+            return '';
+        }
+        if (found.id) {
+            return found.id;
+        }
+        const section = found.closest('section[id]');
+        return section && section.querySelector(HEADINGS) === found ? section.id : '';
+    }
+
+    // sectionProgress is how far the window has got through each section in
+    // view with an anchor, from its heading to the next heading
+    function sectionProgress() {
+        const headings = Array.from(global.document.querySelectorAll(HEADINGS));
+        const bottom = global.innerHeight;
+        const end = global.document.documentElement.scrollHeight - global.scrollY;
+        const progress = {};
+        headings.forEach((heading, index) => {
+            const id = sectionOf(heading);
+            const top = heading.getBoundingClientRect().top;
+            const next = index + 1 < headings.length ? headings[index + 1].getBoundingClientRect().top : end;
+            if (!id || top >= bottom || next <= 0) {
+                return;
+            }
+            progress[id] = next > top ? Math.min(Math.max((bottom - top) / (next - top), 0), 1) : 1;
+        });
+        return progress;
+    }
+
+    function here() {
+        const root = global.document.documentElement;
+        const range = Math.max(root.scrollHeight - global.innerHeight, 0);
+        const found = headingAbove();
+        const text = found ? found.textContent : global.document.title;
+        return {
+            page: page(),
+            fragment: decodeURIComponent(global.location.hash.slice(1)),
+            scroll: range > 0 ? Math.min(Math.max(global.scrollY / range, 0), 1) : 0,
+            heading: (text || '').trim().replace(/\s+/g, ' ').slice(0, 200),
+            section: sectionOf(found),
+            progress: sectionProgress()
+        };
+    }
+
+    // reportLocation tells the viewer where the reader is: kind is load for
+    // a new page, jump for a fragment followed, scroll once scrolling stops
+    // and navigate after a liv:navigate
+    function reportLocation(kind) {
+        if (global.parent !== global) {
+            global.parent.postMessage({ type: 'liv:location', kind: kind, location: here() }, '*');
+        }
+    }
+
+    // navigate moves to a location of this document, loading its page when
+    // it is another one
+    function navigate(message) {
+        const target = message.location || {};
+        const fragment = String(target.fragment || '');
+        if (target.page && String(target.page) !== page()) {
+            const parts = global.location.pathname.split('/');
+            const prefix = parts.slice(0, 4).concat(parts[4] && parts[4].startsWith('~') ? [parts[4]] : []);
+            const path = String(target.page).split('/').map(encodeURIComponent).join('/');
+            global.location.assign(prefix.join('/') + '/' + path + global.location.search + (fragment ? '#' + encodeURIComponent(fragment) : ''));
+            return;
+        }
+        if (decodeURIComponent(global.location.hash.slice(1)) !== fragment) {
+            // The jump is the viewer's, not one to record
+            expectedHash = fragment ? '#' + encodeURIComponent(fragment) : '';
+            global.location.hash = expectedHash;
+        }
+        if (typeof target.scroll === 'number' && isFinite(target.scroll)) {
+            const root = global.document.documentElement;
+            global.scrollTo(0, Math.max(root.scrollHeight - global.innerHeight, 0) * Math.min(Math.max(target.scroll, 0), 1));
+        } else if (fragment) {
+            const element = global.document.getElementById(fragment);
+            if (element) {
+                element.scrollIntoView();
+            }
+        }
+        reportLocation('navigate');
+    }
+
+    global.addEventListener('load', () => reportLocation('load'));
+    global.addEventListener('hashchange', () => {
+        if (expectedHash !== null && global.location.hash === expectedHash) {
+            expectedHash = null;
+            return;
+        }
+        expectedHash = null;
+        reportLocation('jump');
+    });
+    global.addEventListener('scroll', () => {
+        native.clearTimeout(scrollTimer);
+        scrollTimer = native.setTimeout(() => reportLocation('scroll'), 250);
+    }, { passive: true });
+
+    // Navigation shortcuts in the page work the viewer's history and
+    // bookmarks rather than the browser's
+    global.addEventListener('keydown', (event) => {
+        if (global.parent === global) {
+            return;
+        }
+        let action = '';
+        if (event.altKey && !event.ctrlKey && !event.metaKey && event.key === 'ArrowLeft') {
+            action = 'back';
+        } else if (event.altKey && !event.ctrlKey && !event.metaKey && event.key === 'ArrowRight') {
+            action = 'forward';
+        } else if ((event.ctrlKey || event.metaKey) && !event.altKey && event.key.toLowerCase() === 'd') {
+            action = 'bookmark';
+        } else if (event.altKey && !event.ctrlKey && !event.metaKey && event.code === 'KeyO') {
+            action = 'outline';
+        }
+        if (action) {
+            event.preventDefault();
+            global.parent.postMessage({ type: 'liv:navigation-shortcut', action: action }, '*');
+        }
+    });
+
+    // Zoom shortcuts in the page zoom the viewer rather than the browser
+    global.addEventListener('keydown', (event) => {
+        if (global.parent === global) {
+            return;
+        }
+        let action = '';
+        if ((event.ctrlKey || event.metaKey) && !event.altKey) {
+            action = { '=': 'in', '+': 'in', '-': 'out', '0': 'actual' }[event.key] || '';
+        } else if (event.altKey && !event.ctrlKey && !event.metaKey) {
+            action = { KeyW: 'fit-width', KeyP: 'fit-page' }[event.code] || '';
+        }
+        if (action) {
+            event.preventDefault();
+            global.parent.postMessage({ type: 'liv:zoom-shortcut', action: action }, '*');
+        }
+    });
+
+    let sectionLink = null;
+
+    // showSectionLink puts the copy link button next to the heading under the
+    // pointer, when it has a section anchor
+    function showSectionLink(event) {
+        const found = event.target.closest && event.target.closest(HEADINGS);
+        const id = sectionOf(found);
+        if (!id) {
+            return;
+        }
+        if (!sectionLink) {
+            sectionLink = global.document.createElement('button');
+            sectionLink.type = 'button';
+            sectionLink.className = 'liv-section-link';
+            sectionLink.textContent = '🔗';
+            sectionLink.title = 'Copy link to section';
+            sectionLink.setAttribute('aria-label', 'Copy link to section');
+            // Placed over the page even where its CSP keeps the stylesheet out
+            sectionLink.style.position = 'fixed';
+            sectionLink.addEventListener('click', () => {
+                global.parent.postMessage({ type: 'liv:copy-section-link', page: page(), id: sectionLink.dataset.section }, '*');
+            });
+            sectionLink.addEventListener('mouseleave', hideSectionLink);
+            global.document.body.append(sectionLink);
+        }
+        const rect = found.getBoundingClientRect();
+        sectionLink.dataset.section = id;
+        sectionLink.style.top = rect.top + 'px';
+        sectionLink.style.left = Math.max(rect.left - 32, 0) + 'px';
+        sectionLink.hidden = false;
+    }
+
+    function hideSectionLink(event) {
+        if (sectionLink && !(event && event.relatedTarget && (event.relatedTarget === sectionLink || event.relatedTarget.closest(HEADINGS)))) {
+            sectionLink.hidden = true;
+        }
+    }
+
+    if (global.parent !== global) {
+        global.document.addEventListener('mouseover', showSectionLink);
+        global.document.addEventListener('mouseout', (event) => {
+            if (event.target.closest && event.target.closest(HEADINGS)) {
+                hideSectionLink(event);
+            }
+        });
+        global.addEventListener('scroll', () => hideSectionLink(), { passive: true });
+    }
+
+    function annotate(message) {
+        if (message.type === 'liv:annotations') {
+            annotations = Array.isArray(message.annotations) ? message.annotations : [];
+        } else {
+            annotateTool = String(message.tool || 'none');
+            annotateColor = String(message.color || annotateColor);
+        }
+        if (global.document.body) {
+            if (message.type === 'liv:annotations') {
+                drawAnnotations();
+            } else {
+                setTool(annotateTool, annotateColor);
+            }
+        }
+    }
+
+    global.addEventListener('message', (event) => {
+        if (event.source !== global.parent || !event.data) {
+            return;
+        }
+        if (event.data.type === 'liv:activity') {
+            apply(event.data);
+        } else if (event.data.type === 'liv:data') {
+            answer(event.data);
+        } else if (event.data.type === 'liv:annotations' || event.data.type === 'liv:annotate-tool') {
+            annotate(event.data);
+        } else if (event.data.type === 'liv:find') {
+            find(event.data);
+        } else if (event.data.type === 'liv:navigate') {
+            navigate(event.data);
+        }
+    });
+
+    global.LIVRuntime = {
+        get paused() {
+            return state.paused;
+        },
+        get activity() {
+            return state;
+        },
+        graphics: graphics,
+        data: data,
+        unthrottled: native
+    };
+
+    // The page may load before the viewer attached to the frame
+    if (global.parent !== global) {
+        global.parent.postMessage({ type: 'liv:activity-request' }, '*');
+        if (global.document.readyState === 'loading') {
+            global.document.addEventListener('DOMContentLoaded', () => global.parent.postMessage({ type: 'liv:annotations-request' }, '*'));
+        } else {
+            global.parent.postMessage({ type: 'liv:annotations-request' }, '*');
+        }
+    }
+})(window);
@@ -0,0 +1,136 @@
+// LIV Viewer section links
+//
+// Links to a section of an uploaded document open the viewer with a section
+// parameter, as in /viewer?id=...&section=results. The server resolves it
+// under /api/sections to the page and anchor of the section, also for
+// anchors that changed with their heading's text, and the frame opens the
+// page there; the document's stylesheet highlights the section briefly.
+//
+// Readers copy a link to the section they are reading with the toolbar's
+// link button, or with the button scripted pages show next to headings,
+// which sends liv:copy-section-link.
+(function (global) {
+    'use strict';
+
+    let frame = null;
+    let documentId = null;
+    // current is the section the reader is in, or was linked to
+    let current = null;
+
+    function notice(text) {
+        const element = document.getElementById('capabilityNotice');
+        if (!element) {
+            return;
+        }
+        element.textContent = element.hidden || !element.textContent ? text : element.textContent + '; ' + text;
+        element.hidden = false;
+    }
+
+    // link is the viewer link to a section of the document
+    function link(section) {
+        const params = new URLSearchParams({ id: documentId });
+        if (section && section.id) {
+            if (section.page && section.page !== 'content/index.html') {
+                params.set('page', section.page);
+            }
+            params.set('section', section.id);
+        }
+        return global.location.origin + '/viewer?' + params.toString();
+    }
+
+    async function copy(section) {
+        const button = document.getElementById('sectionLink');
+        try {
+            await global.navigator.clipboard.writeText(link(section));
+            if (button) {
+                button.title = 'Link copied';
+                setTimeout(() => {
+                    button.title = 'Copy link to section';
+                }, 1500);
+            }
+        } catch (error) {
+            // Without clipboard access the reader copies the link by hand
+            global.prompt('Link to section', link(section));
+        }
+    }
+
+    const LIVSections = {
+        // resolve finds the section the viewer's link points at in an
+        // uploaded document, or null when it names none or no longer exists
+        async resolve(id) {
+            const params = new URLSearchParams(global.location.search);
+            const section = params.get('section');
+            if (!id || !section) {
+                return null;
+            }
+            const query = new URLSearchParams({ id: id, section: section });
+            if (params.get('page')) {
+                query.set('page', params.get('page'));
+            }
+            try {
+                const response = await fetch('/api/sections?' + query.toString());
+                if (response.ok) {
+                    current = await response.json();
+                    return current;
+                }
+                if (response.status === 404) {
+                    notice('The linked section "' + section + '" is not in this document; it opens at the start');
+                }
+            } catch (error) {
+                console.warn('Failed to resolve section link:', error);
+            }
+            return null;
+        },
+
+        // contentURL points a content URL at the page and anchor of a
+        // resolved section
+        contentURL(url, target) {
+            if (!target) {
+                return url;
+            }
+            const resolved = new URL(url, global.location.origin);
+            const page = target.page.split('/').map(encodeURIComponent).join('/');
+            resolved.pathname = resolved.pathname.replace(/content\/index\.html$/, page);
+            resolved.hash = encodeURIComponent(target.id);
+            return resolved.pathname + resolved.search + resolved.hash;
+        },
+
+        // attach offers links to sections of an uploaded document, following
+        // the section the reader is in when the frame is scripted
+        attach(content, id) {
+            frame = content;
+            documentId = id || null;
+            const button = document.getElementById('sectionLink');
+            if (button) {
+                button.hidden = !documentId;
+            }
+        },
+
+        // copy copies a link to the section the reader is in, or to the
+        // document when that is not known
+        copy() {
+            if (documentId) {
+                copy(current);
+            }
+        },
+
+        get current() {
+            return current;
+        }
+    };
+
+    global.addEventListener('message', (event) => {
+        const message = event.data;
+        if (!frame || event.source !== frame.contentWindow || !message) {
+            return;
+        }
+        if (message.type === 'liv:location' && message.location) {
+            const id = String(message.location.section || '');
+            current = id ? { page: String(message.location.page || ''), id: id } : null;
+        } else if (message.type === 'liv:copy-section-link' && message.id) {
+            copy({ page: String(message.page || ''), id: String(message.id) });
+        }
+    });
+
+    global.LIVSections = LIVSections;
+})(window);
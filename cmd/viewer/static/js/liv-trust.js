@@ -0,0 +1,104 @@
+// LIV Viewer signature trust
+//
+// The server verifies document signatures against the keys it trusts. The
+// viewer asks for the result before rendering a document, shows it as a badge
+// in the toolbar and refuses to render documents that were tampered with.
+(function (global) {
+    'use strict';
+
+    const labels = {
+        verified: '✓ Verified',
+        untrusted: '⚠ Untrusted',
+        tampered: '✗ Tampered',
+        unsigned: 'Unsigned'
+    };
+
+    let result = null;
+
+    function escapeHTML(text) {
+        const element = document.createElement('span');
+        element.textContent = String(text);
+        return element.innerHTML;
+    }
+
+    function describeSigner(signer) {
+        if (!signer.signer) {
+            return 'Signer: ' + signer.status;
+        }
+        let text = (signer.counter_signature ? 'Counter-signed by ' : 'Signed by ') + (signer.signer.name || 'unnamed signer');
+        if (signer.signer.role) {
+            text += ' (' + signer.signer.role + ')';
+        }
+        return text + ', key ' + signer.signer.key_id + ': ' + signer.status;
+    }
+
+    // TamperedError stops rendering of a document that changed after signing
+    class TamperedError extends Error {
+        constructor(details) {
+            super(details.message);
+            this.name = 'TamperedError';
+            this.details = details;
+        }
+
+        // html lists what failed verification, for showError
+        html() {
+            let text = escapeHTML(this.details.message) + '. It is not shown, as its content cannot be trusted.';
+            const errors = this.details.errors || [];
+            if (errors.length) {
+                text += '</p><ul>' + errors.map((error) => '<li>' + escapeHTML(error) + '</li>').join('') + '</ul><p>';
+            }
+            return text;
+        }
+    }
+
+    function showBadge(details) {
+        const badge = document.getElementById('trustBadge');
+        if (!badge) {
+            return;
+        }
+        badge.className = 'trust-badge trust-' + details.status;
+        badge.textContent = labels[details.status] || details.status;
+        badge.title = [details.message].concat(details.warnings || []).join('\n');
+        badge.hidden = false;
+    }
+
+    const LIVTrust = {
+        TamperedError: TamperedError,
+
+        // check verifies the signatures of a document, or of the served
+        // document without an id, and updates the badge. It throws a
+        // TamperedError for documents that must not be rendered.
+        async check(id) {
+            const response = await fetch('/api/verify' + (id ? '?id=' + encodeURIComponent(id) : ''));
+            if (!response.ok) {
+                throw new Error('Failed to verify document signatures');
+            }
+            result = await response.json();
+            showBadge(result);
+            if (result.status === 'tampered') {
+                throw new TamperedError(result);
+            }
+            return result;
+        },
+
+        // details describes the last result for the document information
+        details() {
+            if (!result) {
+                return 'Signatures: not checked';
+            }
+            let text = 'Signatures: ' + result.status + ' (' + result.message + ')';
+            if (result.timestamp) {
+                text += '\nTimestamped: ' + new Date(result.timestamp).toLocaleString();
+            }
+            for (const signer of result.signers || []) {
+                text += '\n' + describeSigner(signer);
+            }
+            for (const warning of result.warnings || []) {
+                text += '\nWarning: ' + warning;
+            }
+            return text;
+        }
+    };
+
+    global.LIVTrust = LIVTrust;
+})(window);
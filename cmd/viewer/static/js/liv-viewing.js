@@ -0,0 +1,119 @@
+// LIV Viewer viewing sessions
+//
+// Servers may limit how many documents a reader has open at once. The viewer
+// opens a session before loading a document, renews it while the page stays
+// open and releases it when the page goes away, so the slot frees up at once.
+(function (global) {
+    'use strict';
+
+    let session = null;
+    let opened = null;
+    let timer = null;
+
+    function escapeHTML(text) {
+        const element = document.createElement('span');
+        element.textContent = String(text);
+        return element.innerHTML;
+    }
+
+    // LimitError carries the server's explanation of a refused document
+    class LimitError extends Error {
+        constructor(details) {
+            super(details.error);
+            this.name = 'LimitError';
+            this.details = details;
+        }
+
+        // html describes the limit and the documents already open, for showError
+        html() {
+            let text = escapeHTML(this.details.error);
+            const open = this.details.open || [];
+            if (open.length) {
+                text += '</p><p>Open documents:</p><ul>' + open.map((item) =>
+                    '<li>' + escapeHTML(item.document || 'Untitled') + ' (since ' +
+                    escapeHTML(new Date(item.opened).toLocaleTimeString()) + ')</li>').join('') + '</ul><p>';
+            }
+            if (this.details.retry_after) {
+                text += 'Closed tabs free their slot within ' + escapeHTML(this.details.retry_after) + ' seconds.';
+            }
+            return text;
+        }
+    }
+
+    function schedule(seconds) {
+        clearTimeout(timer);
+        timer = setTimeout(renew, Math.max(1, seconds) * 1000);
+    }
+
+    async function renew() {
+        if (!session) {
+            return;
+        }
+        try {
+            const response = await fetch('/api/viewing/' + encodeURIComponent(session.id) + '/renew', { method: 'POST' });
+            if (response.status === 404) {
+                // The session expired, e.g. while the computer slept
+                session = null;
+                await LIVViewing.open(opened);
+                return;
+            }
+            if (response.ok) {
+                session = await response.json();
+            }
+        } catch (error) {
+            console.warn('Failed to renew viewing session:', error);
+        }
+        if (session) {
+            schedule(session.renew_seconds);
+        }
+    }
+
+    function release() {
+        if (!session) {
+            return;
+        }
+        clearTimeout(timer);
+        navigator.sendBeacon('/api/viewing/' + encodeURIComponent(session.id) + '/close');
+        session = null;
+    }
+
+    const LIVViewing = {
+        LimitError: LimitError,
+
+        // open starts a viewing session for a document. It resolves to null
+        // when the server does not limit viewing and throws a LimitError when
+        // the reader has too many documents open.
+        async open(document) {
+            opened = document || '';
+            const response = await fetch('/api/viewing', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ document: opened })
+            });
+            if (response.status === 404) {
+                return null;
+            }
+            if (response.status === 429) {
+                throw new LimitError(await response.json());
+            }
+            if (!response.ok) {
+                throw new Error('Failed to open viewing session');
+            }
+            session = await response.json();
+            schedule(session.renew_seconds);
+            return session;
+        },
+
+        close: release
+    };
+
+    window.addEventListener('pagehide', release);
+    window.addEventListener('pageshow', (event) => {
+        // Pages restored from the back/forward cache take their slot again
+        if (event.persisted && opened !== null && !session) {
+            LIVViewing.open(opened).catch((error) => console.warn(error.message));
+        }
+    });
+
+    global.LIVViewing = LIVViewing;
+})(window);
@@ -0,0 +1,97 @@
+// LIV Viewer compiled module cache
+//
+// Compiling WASM on every open adds latency. Document modules are kept in
+// the Cache API keyed by their hash, so opening a document again downloads
+// nothing, and are compiled with compileStreaming, which lets the browser
+// reuse the machine code it cached for the same response. The viewer warms
+// up the modules a document declares in the background while its loading
+// screen shows.
+(function (global) {
+    'use strict';
+
+    const CACHE_NAME = 'liv-wasm-v1';
+
+    // compiled maps module hashes to promises of compiled modules
+    const compiled = new Map();
+
+    function cacheKey(hash) {
+        return '/wasm-cache/' + hash;
+    }
+
+    async function sha256(bytes) {
+        const digest = await crypto.subtle.digest('SHA-256', bytes);
+        return Array.from(new Uint8Array(digest), (b) => b.toString(16).padStart(2, '0')).join('');
+    }
+
+    function wasmResponse(bytes) {
+        return new Response(bytes, { headers: { 'Content-Type': 'application/wasm' } });
+    }
+
+    // load returns the module as a response, from the cache when present.
+    // Only modules matching their hash are cached, so a bad download cannot
+    // poison later opens.
+    async function load(module) {
+        // The Cache API is only available to secure contexts
+        const cache = global.caches ? await caches.open(CACHE_NAME).catch(() => null) : null;
+        if (cache) {
+            const cached = await cache.match(cacheKey(module.sha256));
+            if (cached) {
+                return cached;
+            }
+        }
+
+        const response = await fetch(module.url);
+        if (!response.ok) {
+            throw new Error('Failed to load WASM module ' + module.name);
+        }
+        const bytes = await response.arrayBuffer();
+        if (!global.crypto || !crypto.subtle) {
+            return wasmResponse(bytes);
+        }
+        if (await sha256(bytes) !== module.sha256) {
+            throw new Error('WASM module ' + module.name + ' does not match its hash');
+        }
+        if (cache) {
+            await cache.put(cacheKey(module.sha256), wasmResponse(bytes));
+        }
+        return wasmResponse(bytes);
+    }
+
+    async function compile(module) {
+        const response = await load(module);
+        if (WebAssembly.compileStreaming) {
+            return WebAssembly.compileStreaming(response);
+        }
+        return WebAssembly.compile(await response.arrayBuffer());
+    }
+
+    const LIVWasmCache = {
+        // warm starts compiling modules in the background. Failures are
+        // reported when the module is asked for.
+        warm(modules) {
+            for (const module of modules || []) {
+                if (!compiled.has(module.sha256)) {
+                    const promise = compile(module);
+                    promise.catch((error) => console.warn('Failed to warm up WASM module:', error));
+                    compiled.set(module.sha256, promise);
+                }
+            }
+        },
+
+        // get returns a compiled module, waiting for its warm-up if needed
+        get(module) {
+            LIVWasmCache.warm([module]);
+            return compiled.get(module.sha256);
+        },
+
+        // clear forgets all compiled and cached modules
+        async clear() {
+            compiled.clear();
+            if (global.caches) {
+                await caches.delete(CACHE_NAME);
+            }
+        }
+    };
+
+    global.LIVWasmCache = LIVWasmCache;
+})(window);
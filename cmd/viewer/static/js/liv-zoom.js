@@ -0,0 +1,231 @@
+// LIV Viewer zoom
+//
+// Documents are zoomed to a percentage or to a mode that follows the
+// window: fit width, fit page and actual size. Paged documents, those that
+// declare a page size in their print settings, are laid out a page at a
+// time at that size; fit width and fit page scale the page to the width or
+// the whole of the viewer, and actual size shows it at its declared size.
+// Other documents reflow to the width the zoom leaves them, so they always
+// fit the width; fit page does not apply to them.
+//
+// The zoom is kept per document in this browser. Ctrl+Plus, Ctrl+Minus and
+// Ctrl+0 zoom in, out and to actual size, Alt+W fits the width and Alt+P
+// the page, in the viewer or the page.
+(function (global) {
+    'use strict';
+
+    const STORAGE_PREFIX = 'liv-zoom:';
+    const MODES = ['fit-width', 'fit-page', 'actual', 'custom'];
+    const MIN = 25;
+    const MAX = 400;
+    const STEP = 25;
+    // GAP is the space around pages, in CSS pixels
+    const GAP = 16;
+    const SAVE_DELAY = 500;
+
+    let key = null;
+    // page is the declared page size in CSS pixels, null for documents
+    // that reflow
+    let page = null;
+    let mode = 'fit-width';
+    let zoom = 100;
+    let element = null;
+    let stage = null;
+    let sheet = null;
+    let observer = null;
+    let saveTimer = null;
+
+    function clamp(value) {
+        return Math.min(MAX, Math.max(MIN, value));
+    }
+
+    function load() {
+        if (!key) {
+            return;
+        }
+        try {
+            const saved = JSON.parse(global.localStorage.getItem(STORAGE_PREFIX + key) || 'null');
+            if (saved && MODES.includes(saved.mode) && (saved.mode !== 'fit-page' || page)) {
+                mode = saved.mode;
+                zoom = clamp(Number(saved.zoom) || 100);
+            }
+        } catch (error) {
+            // Unreadable settings start at the default
+        }
+    }
+
+    function save() {
+        if (!key) {
+            return;
+        }
+        clearTimeout(saveTimer);
+        saveTimer = setTimeout(() => {
+            try {
+                global.localStorage.setItem(STORAGE_PREFIX + key, JSON.stringify({ mode: mode, zoom: zoom }));
+            } catch (error) {
+                console.warn('Failed to keep the zoom in this browser:', error);
+            }
+        }, SAVE_DELAY);
+    }
+
+    // scale is the factor the document is shown at in the current mode
+    function scale() {
+        if (mode === 'custom') {
+            return zoom / 100;
+        }
+        if (!page || mode === 'actual' || !element) {
+            return 1;
+        }
+        const width = Math.max(element.clientWidth - 2 * GAP, 1) / page.width;
+        if (mode === 'fit-width') {
+            return width;
+        }
+        return Math.min(width, Math.max(element.clientHeight - 2 * GAP, 1) / page.height);
+    }
+
+    function apply() {
+        const factor = scale();
+        zoom = clamp(Math.round(factor * 100));
+        if (stage) {
+            if (page) {
+                stage.style.width = page.width * factor + 'px';
+                stage.style.height = page.height * factor + 'px';
+                sheet.style.width = page.width + 'px';
+                sheet.style.height = page.height + 'px';
+            } else {
+                stage.style.width = '';
+                stage.style.height = '';
+                // The document reflows to the width left at this zoom
+                sheet.style.width = 100 / factor + '%';
+                sheet.style.height = 100 / factor + '%';
+            }
+            sheet.style.transform = factor === 1 ? '' : 'scale(' + factor + ')';
+        }
+
+        const level = document.getElementById('zoomLevel');
+        if (level) {
+            level.textContent = zoom + '%';
+        }
+        for (const button of document.querySelectorAll('[data-zoom-mode]')) {
+            button.setAttribute('aria-pressed', String(button.dataset.zoomMode === mode));
+            if (button.dataset.zoomMode === 'fit-page') {
+                button.hidden = !page;
+            }
+        }
+    }
+
+    function frame() {
+        return element ? element.querySelector('iframe') : null;
+    }
+
+    const LIVZoom = {
+        // configure sets the document whose zoom is kept, and the page size
+        // paged documents declare
+        configure(id, declared) {
+            key = id || null;
+            page = declared && declared.width > 0 && declared.height > 0
+                ? { width: Number(declared.width), height: Number(declared.height) }
+                : null;
+            mode = 'fit-width';
+            zoom = 100;
+            load();
+            apply();
+        },
+
+        // attach zooms the content rendered in the viewer element, following
+        // the element's size
+        attach(viewer) {
+            element = viewer;
+            stage = element.querySelector(':scope > .zoom-stage');
+            if (!stage) {
+                stage = document.createElement('div');
+                stage.className = 'zoom-stage';
+                sheet = document.createElement('div');
+                sheet.className = 'zoom-sheet';
+                sheet.append(...element.childNodes);
+                stage.append(sheet);
+                element.append(stage);
+            } else {
+                sheet = stage.querySelector(':scope > .zoom-sheet');
+            }
+            stage.classList.toggle('zoom-paged', !!page);
+            if (observer) {
+                observer.disconnect();
+            }
+            if (typeof ResizeObserver !== 'undefined') {
+                observer = new ResizeObserver(() => apply());
+                observer.observe(element);
+            }
+            apply();
+        },
+
+        // set zooms to a percentage
+        set(percent) {
+            mode = 'custom';
+            zoom = clamp(Number(percent) || 100);
+            apply();
+            save();
+        },
+
+        // fit zooms to a mode: fit-width, fit-page or actual
+        fit(name) {
+            if (!MODES.includes(name) || name === 'custom' || (name === 'fit-page' && !page)) {
+                return;
+            }
+            mode = name;
+            apply();
+            save();
+        },
+
+        zoomIn() {
+            LIVZoom.set(Math.floor(zoom / STEP) * STEP + STEP);
+        },
+
+        zoomOut() {
+            LIVZoom.set(Math.ceil(zoom / STEP) * STEP - STEP);
+        },
+
+        // shortcut runs a zoom shortcut of the viewer or the page: in, out,
+        // or a mode to fit
+        shortcut(action) {
+            switch (action) {
+                case 'in':
+                    LIVZoom.zoomIn();
+                    break;
+                case 'out':
+                    LIVZoom.zoomOut();
+                    break;
+                default:
+                    LIVZoom.fit(action);
+            }
+        },
+
+        // zoom is the percentage the document is shown at
+        get zoom() {
+            return zoom;
+        },
+
+        // mode is fit-width, fit-page, actual or custom
+        get mode() {
+            return mode;
+        },
+
+        // paged reports whether the document declares a page size
+        get paged() {
+            return !!page;
+        }
+    };
+
+    global.addEventListener('message', (event) => {
+        const message = event.data;
+        const content = frame();
+        if (!content || event.source !== content.contentWindow || !message) {
+            return;
+        }
+        if (message.type === 'liv:zoom-shortcut') {
+            LIVZoom.shortcut(String(message.action));
+        }
+    });
+
+    global.LIVZoom = LIVZoom;
+})(window);
@@ -0,0 +1,447 @@
+// LIV Viewer Service Worker
+//
+// LIV_OFFLINE, generated by the viewer ahead of this script, lists the
+// static assets to cache, the digests of the stored documents and the limits
+// of the document cache.
+//
+// The viewer's pages and assets are cached when the worker installs.
+// Documents are cached as they are opened: requests for a document are
+// answered from the network when it can be reached and from the cache
+// otherwise, and once its content has been shown the rest of its resources
+// are fetched too, so documents opened before can be read offline. They are
+// kept until the cache is full, least recently opened first, until they are
+// no longer stored, or until the reader turns "available offline" off.
+// Documents with an access policy are never kept: the server checks and
+// counts each of their opens.
+
+const STATIC_CACHE = 'liv-static-' + LIV_OFFLINE.version;
+const DOCUMENT_CACHE = 'liv-documents-v1';
+// Caches of earlier workers, removed when this one activates
+const RETIRED_CACHES = ['liv-viewer-v1'];
+// INDEX_URL keeps the index of cached documents in the document cache
+const INDEX_URL = '/offline/index.json';
+// Requests that stream or change state are never cached
+const UNCACHED = ['/api/live-reload', '/api/viewing', '/api/jobs', '/api/uploads', '/api/usage'];
+// The content page of a document, under the base its resources share
+const CONTENT_PAGE = /^(\/api\/content\/[^/]+\/(?:~[^/]+\/)?)content\/index\.html$/;
+// Requests the viewer makes for every document, filled in with its id
+const DOCUMENT_URLS = ['/viewer?id=', '/api/document?id=', '/api/verify?id=', '/api/capabilities?id=', '/api/sections?id='];
+
+let index = null;
+let saving = Promise.resolve();
+
+// loadIndex returns the index of cached documents: for each document id,
+// the URLs cached and their sizes, when it was last opened and what the
+// viewer told of it
+function loadIndex() {
+    if (!index) {
+        index = caches.open(DOCUMENT_CACHE)
+            .then((cache) => cache.match(INDEX_URL))
+            .then((response) => (response ? response.json() : null))
+            .catch(() => null)
+            .then((saved) => (saved && saved.documents ? saved : { documents: {} }));
+    }
+    return index;
+}
+
+function saveIndex() {
+    saving = saving.then(async () => {
+        const current = await loadIndex();
+        const cache = await caches.open(DOCUMENT_CACHE);
+        await cache.put(INDEX_URL, new Response(JSON.stringify(current), {
+            headers: { 'Content-Type': 'application/json' }
+        }));
+    }).catch((error) => console.warn('Failed to save the offline index:', error));
+    return saving;
+}
+
+async function entryOf(id) {
+    const documents = (await loadIndex()).documents;
+    if (!documents[id]) {
+        documents[id] = { urls: {}, bytes: 0, used: 0 };
+    }
+    return documents[id];
+}
+
+function absolute(path) {
+    return new URL(path, self.location.origin).href;
+}
+
+// documentOf returns the id of the document a request is for, or ''
+function documentOf(url) {
+    if (url.origin !== self.location.origin ||
+        UNCACHED.some((path) => url.pathname === path || url.pathname.startsWith(path + '/'))) {
+        return '';
+    }
+    const match = url.pathname.match(/^\/api\/(?:document|content|data)\/([^/]+)\//);
+    if (match) {
+        return decodeURIComponent(match[1]);
+    }
+    if (url.pathname === '/viewer' || url.pathname.startsWith('/api/')) {
+        return url.searchParams.get('id') || '';
+    }
+    return '';
+}
+
+// cacheKey is the URL a response is cached under. Viewer pages are cached
+// once per document, whatever section they were opened at.
+function cacheKey(url, id) {
+    if (url.pathname === '/viewer') {
+        return absolute('/viewer?id=' + encodeURIComponent(id));
+    }
+    return url.href;
+}
+
+function keepable(entry) {
+    const limits = LIV_OFFLINE.limits;
+    return limits.cache > 0 && !entry.disabled && !entry.restricted && !(entry.size > limits.document);
+}
+
+// forget removes the cached responses of a document
+async function forget(entry) {
+    const cache = await caches.open(DOCUMENT_CACHE);
+    await Promise.all(Object.keys(entry.urls).map((url) => cache.delete(url)));
+    entry.urls = {};
+    entry.bytes = 0;
+}
+
+// evict forgets the least recently opened documents until the cache fits
+// its limit; the document being opened is kept
+async function evict(current) {
+    const documents = (await loadIndex()).documents;
+    let total = Object.values(documents).reduce((sum, entry) => sum + entry.bytes, 0);
+    const oldest = Object.keys(documents)
+        .filter((id) => id !== current && documents[id].bytes > 0)
+        .sort((a, b) => documents[a].used - documents[b].used);
+    for (const id of oldest) {
+        if (total <= LIV_OFFLINE.limits.cache) {
+            break;
+        }
+        total -= documents[id].bytes;
+        await forget(documents[id]);
+        if (!documents[id].disabled) {
+            delete documents[id];
+        }
+    }
+}
+
+// keep caches a response of a document
+async function keep(id, key, response) {
+    const entry = await entryOf(id);
+    if (!keepable(entry)) {
+        return;
+    }
+    const body = await response.blob();
+    if (body.size > LIV_OFFLINE.limits.document) {
+        return;
+    }
+    const cache = await caches.open(DOCUMENT_CACHE);
+    await cache.put(key, new Response(body, {
+        status: response.status,
+        statusText: response.statusText,
+        headers: response.headers
+    }));
+    entry.bytes += body.size - (entry.urls[key] || 0);
+    entry.urls[key] = body.size;
+    entry.used = Date.now();
+    await evict(id);
+    await saveIndex();
+}
+
+// remember caches a response of a document as it is opened, learning its
+// resources from its description and fetching them once its content shows
+async function remember(id, url, key, response) {
+    const entry = await entryOf(id);
+    if (url.pathname === '/api/document' && !url.searchParams.has('download')) {
+        const description = await response.clone().json().catch(() => null);
+        if (description) {
+            entry.sha256 = description.sha256;
+            entry.size = description.size;
+            entry.resources = (description.resources || [])
+                .map((resource) => resource.path)
+                .filter((path) => path.startsWith('content/') || path.startsWith('assets/'));
+            if (!keepable(entry)) {
+                await forget(entry);
+                await saveIndex();
+                return;
+            }
+        }
+    }
+    await keep(id, key, response);
+
+    const content = url.pathname.match(CONTENT_PAGE);
+    if (content) {
+        entry.base = content[1];
+        await fill(id);
+    }
+}
+
+// fill fetches what the document needs to be read offline and is not cached
+async function fill(id) {
+    const entry = await entryOf(id);
+    const urls = DOCUMENT_URLS.map((path) => absolute(path + encodeURIComponent(id)));
+    if (entry.base) {
+        for (const path of entry.resources || []) {
+            urls.push(absolute(entry.base + path.split('/').map(encodeURIComponent).join('/')));
+        }
+    }
+    for (const url of urls) {
+        if (!keepable(entry)) {
+            return;
+        }
+        if (entry.urls[url] !== undefined) {
+            continue;
+        }
+        try {
+            const response = await fetch(url, { credentials: 'same-origin' });
+            if (response.status === 200 && !response.redirected) {
+                await keep(id, url, response);
+            }
+        } catch (error) {
+            // Offline again; the rest is fetched when the document next opens
+            return;
+        }
+    }
+}
+
+async function touch(id) {
+    const entry = (await loadIndex()).documents[id];
+    if (entry) {
+        entry.used = Date.now();
+        await saveIndex();
+    }
+}
+
+async function documentRequest(event, url, id) {
+    const request = event.request;
+    const key = cacheKey(url, id);
+    try {
+        const response = await fetch(request);
+        if (response.status === 200 && response.type === 'basic' && !response.redirected && !request.headers.has('range')) {
+            event.waitUntil(remember(id, url, key, response.clone()));
+        }
+        return response;
+    } catch (error) {
+        const cache = await caches.open(DOCUMENT_CACHE);
+        const cached = await cache.match(key);
+        if (!cached) {
+            throw error;
+        }
+        event.waitUntil(touch(id));
+        return cached;
+    }
+}
+
+async function clientDocument(clientId) {
+    const client = clientId ? await self.clients.get(clientId) : null;
+    return client ? documentOf(new URL(client.url)) : '';
+}
+
+// opening answers the requests that open a document. Online they reach the
+// server, which tells whether the document has an access policy; offline,
+// documents kept here open as they did when last opened online.
+async function opening(event, url, id) {
+    try {
+        const response = await fetch(event.request);
+        if (url.pathname === '/api/access' && id) {
+            event.waitUntil(accessChecked(id, response.status));
+        }
+        return response;
+    } catch (error) {
+        const document = id || await clientDocument(event.clientId);
+        const entry = document ? (await loadIndex()).documents[document] : null;
+        if (!entry || !entry.open || entry.bytes === 0) {
+            throw error;
+        }
+        if (url.pathname === '/api/access') {
+            return new Response(null, { status: 204 });
+        }
+        // Viewing sessions are only limited online
+        return new Response('Viewing is not limited offline', { status: 404 });
+    }
+}
+
+async function accessChecked(id, status) {
+    const entry = await entryOf(id);
+    if (status === 204) {
+        entry.open = true;
+        entry.restricted = false;
+    } else if (status === 200 || status === 403) {
+        entry.open = false;
+        entry.restricted = true;
+        await forget(entry);
+    } else {
+        return;
+    }
+    await saveIndex();
+}
+
+async function cacheFirst(request) {
+    const cached = await caches.match(request, { cacheName: STATIC_CACHE });
+    return cached || fetch(request);
+}
+
+async function networkFirst(request) {
+    try {
+        const response = await fetch(request);
+        const url = new URL(request.url);
+        if (response.status === 200 && !response.redirected && LIV_OFFLINE.static.includes(url.pathname) && !url.search) {
+            const copy = response.clone();
+            caches.open(STATIC_CACHE).then((cache) => cache.put(request, copy));
+        }
+        return response;
+    } catch (error) {
+        const cached = await caches.match(request, { cacheName: STATIC_CACHE, ignoreSearch: true });
+        if (!cached) {
+            throw error;
+        }
+        return cached;
+    }
+}
+
+// status describes whether a document is kept for offline reading
+async function status(id) {
+    const entry = (await loadIndex()).documents[id] || { urls: {}, bytes: 0 };
+    const cached = new Set(Object.keys(entry.urls));
+    return {
+        supported: LIV_OFFLINE.limits.cache > 0,
+        available: !entry.disabled,
+        restricted: !!entry.restricted,
+        too_large: entry.size > LIV_OFFLINE.limits.document,
+        bytes: entry.bytes,
+        // complete reports whether every resource of its content is cached
+        complete: !!entry.base && (entry.resources || []).every((path) =>
+            cached.has(absolute(entry.base + path.split('/').map(encodeURIComponent).join('/'))))
+    };
+}
+
+async function setAvailable(id, available) {
+    const entry = await entryOf(id);
+    entry.disabled = !available;
+    if (available) {
+        entry.used = Date.now();
+        await fill(id);
+    } else {
+        await forget(entry);
+    }
+    await saveIndex();
+}
+
+async function digest(id, sha) {
+    const bytes = new TextEncoder().encode(id + '\0' + sha);
+    const sum = await crypto.subtle.digest('SHA-256', bytes);
+    return Array.from(new Uint8Array(sum), (b) => b.toString(16).padStart(2, '0')).join('');
+}
+
+// prune forgets documents the viewer no longer stores, or stores with other
+// content
+async function prune() {
+    if (LIV_OFFLINE.limits.cache <= 0) {
+        index = null;
+        await caches.delete(DOCUMENT_CACHE);
+        return;
+    }
+    if (!LIV_OFFLINE.listed) {
+        return;
+    }
+    const stored = new Set(LIV_OFFLINE.documents);
+    const documents = (await loadIndex()).documents;
+    for (const [id, entry] of Object.entries(documents)) {
+        if (entry.sha256 && !stored.has(await digest(id, entry.sha256))) {
+            await forget(entry);
+            delete documents[id];
+        }
+    }
+    await saveIndex();
+}
+
+self.addEventListener('install', (event) => {
+    event.waitUntil(
+        caches.open(STATIC_CACHE)
+            .then((cache) => Promise.all(LIV_OFFLINE.static.map((url) =>
+                cache.add(url).catch((error) => console.warn('Not cached for offline use:', url, error)))))
+            .then(() => self.skipWaiting())
+    );
+});
+
+self.addEventListener('activate', (event) => {
+    event.waitUntil(
+        caches.keys()
+            .then((cacheNames) => Promise.all(cacheNames
+                .filter((cacheName) => RETIRED_CACHES.includes(cacheName) ||
+                    (cacheName.startsWith('liv-static-') && cacheName !== STATIC_CACHE))
+                .map((cacheName) => caches.delete(cacheName))))
+            .then(prune)
+            .then(() => self.clients.claim())
+    );
+});
+
+self.addEventListener('fetch', (event) => {
+    const request = event.request;
+    const url = new URL(request.url);
+    if (url.origin !== self.location.origin) {
+        return;
+    }
+    const id = documentOf(url);
+    if (request.method === 'POST' && (url.pathname === '/api/access' || url.pathname === '/api/viewing')) {
+        event.respondWith(opening(event, url, id));
+        return;
+    }
+    if (request.method !== 'GET') {
+        return;
+    }
+    if (id && LIV_OFFLINE.limits.cache > 0) {
+        event.respondWith(documentRequest(event, url, id));
+    } else if (url.pathname.startsWith('/static/')) {
+        event.respondWith(cacheFirst(request));
+    } else if (request.mode === 'navigate' || LIV_OFFLINE.static.includes(url.pathname)) {
+        event.respondWith(networkFirst(request));
+    }
+});
+
+// Pages ask whether their document is kept offline, and change it, over the
+// port they send
+self.addEventListener('message', (event) => {
+    const message = event.data || {};
+    const port = event.ports[0];
+    if (!port || typeof message.id !== 'string' || !message.id) {
+        return;
+    }
+    let done;
+    switch (message.type) {
+        case 'liv:offline-status':
+            done = status(message.id);
+            break;
+        case 'liv:offline-set':
+            done = setAvailable(message.id, !!message.available).then(() => status(message.id));
+            break;
+        default:
+            return;
+    }
+    event.waitUntil(done.then((result) => port.postMessage(result)));
+});
+
+// Handle background sync for offline document uploads
+self.addEventListener('sync', (event) => {
+    if (event.tag === 'document-upload') {
+        event.waitUntil(uploadPendingDocuments());
+    }
+});
+
+async function uploadPendingDocuments() {
+    // TODO: Implement offline document upload sync
+    console.log('Syncing pending document uploads');
+}
+
+// Handle push notifications
+self.addEventListener('push', (event) => {
+    const options = {
+        body: event.data ? event.data.text() : 'New LIV document available',
+        icon: '/static/icons/icon-192x192.png',
+        badge: '/static/icons/badge-72x72.png'
+    };
+
+    event.waitUntil(
+        self.registration.showNotification('LIV Viewer', options)
+    );
+});
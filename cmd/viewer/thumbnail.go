@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/preview"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// thumbnailImages keeps the most recently rendered thumbnails, keyed by
+// document version, size and format
+var thumbnailImages = &previewCache{entries: make(map[string]*previewImage)}
+
+// thumbnailURL returns where the thumbnail of an uploaded document is served
+func thumbnailURL(id string) string {
+	return "/api/thumbnail?" + url.Values{"id": {id}}.Encode()
+}
+
+// handleThumbnail serves a preview image of the first page of an uploaded
+// document, or of the served document when no id is given, for file listings.
+// The width, height and format parameters choose the image; without a format
+// WebP is served to clients that accept it and PNG to others.
+func handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var opts preview.Options
+	for _, size := range []struct {
+		name  string
+		value *int
+	}{{"width", &opts.Width}, {"height", &opts.Height}} {
+		if raw := query.Get(size.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid %s %q", size.name, raw), http.StatusBadRequest)
+				return
+			}
+			*size.value = n
+		}
+	}
+	opts.Format = query.Get("format")
+	if opts.Format == "" {
+		w.Header().Set("Vary", "Accept")
+		if strings.Contains(r.Header.Get("Accept"), "image/webp") {
+			opts.Format = preview.FormatWebP
+		}
+	}
+	opts, err := opts.Normalize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var image *previewImage
+	if id := query.Get("id"); id != "" {
+		image, err = storedThumbnail(r.Context(), id, opts)
+	} else {
+		image, err = servedThumbnail(opts)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			log.ErrorContext(r.Context(), "Failed to render thumbnail", "error", err)
+			http.Error(w, "Failed to render thumbnail", http.StatusUnprocessableEntity)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", preview.ContentType(opts.Format))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", image.ETag)
+
+	http.ServeContent(w, r, "", image.ModTime, bytes.NewReader(image.Data))
+}
+
+// storedThumbnail renders the thumbnail of an uploaded document, in a worker
+// when the server is sandboxed
+func storedThumbnail(ctx context.Context, id string, opts preview.Options) (*previewImage, error) {
+	doc, reader, err := openStoredPackage(id)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.Close()
+
+	info := doc.Info()
+	variant := thumbnailVariant(opts)
+	if cached := thumbnailImages.get(info.SHA256 + "@" + variant); cached != nil {
+		return cached, nil
+	}
+
+	var data []byte
+	if workerSandbox != nil {
+		data, err = runWorker(ctx, doc, "thumbnail",
+			"--width", strconv.Itoa(opts.Width), "--height", strconv.Itoa(opts.Height), "--format", opts.Format)
+	} else {
+		data, err = renderThumbnail(reader, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	image := &previewImage{Data: data, ModTime: info.Uploaded, ETag: `"` + info.SHA256 + "-" + variant + `"`}
+	thumbnailImages.put(info.SHA256+"@"+variant, image)
+	return image, nil
+}
+
+func servedThumbnail(opts preview.Options) (*previewImage, error) {
+	if servedDocument == "" {
+		return nil, store.ErrNotFound
+	}
+
+	info, err := os.Stat(servedDocument)
+	if err != nil {
+		return nil, err
+	}
+	version := fmt.Sprintf("%x-%x-%s", info.ModTime().UnixNano(), info.Size(), thumbnailVariant(opts))
+	key := servedDocument + "@" + version
+	if cached := thumbnailImages.get(key); cached != nil {
+		return cached, nil
+	}
+
+	reader, err := zip.OpenReader(servedDocument)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document package: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := renderThumbnail(&reader.Reader, opts)
+	if err != nil {
+		return nil, err
+	}
+	image := &previewImage{Data: data, ModTime: info.ModTime(), ETag: `"` + version + `"`}
+	thumbnailImages.put(key, image)
+	return image, nil
+}
+
+// thumbnailVariant names a thumbnail size and format, as in 320x426.png
+func thumbnailVariant(opts preview.Options) string {
+	return fmt.Sprintf("%dx%d.%s", opts.Width, opts.Height, opts.Format)
+}
+
+// renderThumbnail renders the first page of a package
+func renderThumbnail(reader *zip.Reader, opts preview.Options) ([]byte, error) {
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		return nil, err
+	}
+	return preview.RenderPackage(m, func(entry string) ([]byte, error) {
+		return readZipEntry(reader, entry)
+	}, opts)
+}
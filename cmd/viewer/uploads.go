@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/transfer"
+)
+
+// uploadsPath is the collection of resumable uploads
+const uploadsPath = "/api/uploads"
+
+// uploadStore keeps resumable uploads until their last chunk arrives
+var uploadStore *transfer.UploadStore
+
+// openUploadStore keeps resumable uploads in the document store's directory
+// and removes those abandoned for the store's TTL, or a day when documents
+// are kept indefinitely
+func openUploadStore(ctx context.Context, config storeConfig) (*transfer.UploadStore, error) {
+	uploads, err := transfer.NewUploadStore(filepath.Join(config.dir(), "uploads"), maxUploadSize, config.TTL)
+	if err != nil {
+		return nil, err
+	}
+	if config.GCInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(config.GCInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-ticker.C:
+					if removed, err := uploads.PurgeExpired(now); err != nil {
+						log.Error("Failed to remove abandoned uploads", "error", err)
+					} else if removed > 0 {
+						log.Info("Removed abandoned uploads", "count", removed)
+					}
+				}
+			}
+		}()
+	}
+	return uploads, nil
+}
+
+// uploader identifies who may continue an upload: the signed-in user or,
+// without sign-in, the client address
+func uploader(r *http.Request) string {
+	user, ip := viewerOf(r)
+	if user != "" {
+		return "user:" + user
+	}
+	return "ip:" + ip
+}
+
+// handleUploads serves resumable uploads following the tus protocol. POST
+// /api/uploads with Upload-Length and a base64 filename in Upload-Metadata
+// creates an upload at the Location returned. PATCH sends the chunk at
+// Upload-Offset, optionally with an Upload-Checksum of its SHA-256; HEAD and
+// GET report the offset reached, so an interrupted upload resumes there;
+// DELETE abandons it. The PATCH completing the upload stores the document
+// and responds as /api/upload does.
+func handleUploads(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(transfer.ResumableHeader, transfer.ResumableVersion)
+	if uploadStore == nil || documentStore == nil {
+		http.Error(w, "Document storage not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, uploadsPath), "/")
+	switch {
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Tus-Version", transfer.ResumableVersion)
+		w.Header().Set("Tus-Extension", "creation,checksum,termination,expiration")
+		w.Header().Set("Tus-Checksum-Algorithm", "sha256")
+		w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+		w.WriteHeader(http.StatusNoContent)
+	case id == "" && r.Method == http.MethodPost:
+		createUpload(w, r)
+	case id == "" || strings.Contains(id, "/"):
+		http.NotFound(w, r)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		upload, err := uploadStore.Get(id, uploader(r))
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		writeUploadHeaders(w, upload)
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodHead {
+			return
+		}
+		writeUploadJSON(w, http.StatusOK, uploadStatus(upload))
+	case r.Method == http.MethodPatch:
+		appendUpload(w, r, id)
+	case r.Method == http.MethodDelete:
+		if err := uploadStore.Delete(id, uploader(r)); err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createUpload(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.Header.Get(transfer.UploadLengthHeader), 10, 64)
+	if err != nil || size <= 0 {
+		http.Error(w, "Upload-Length required", http.StatusBadRequest)
+		return
+	}
+	if size > maxUploadSize {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, err := transfer.ParseUploadMetadata(r.Header.Get(transfer.UploadMetadataHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !strings.HasSuffix(metadata["filename"], ".liv") {
+		http.Error(w, "Invalid file type", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := uploadStore.Create(metadata["filename"], size, uploader(r))
+	if err != nil {
+		log.ErrorContext(r.Context(), "Failed to create upload", "filename", metadata["filename"], "error", err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", uploadsPath+"/"+upload.ID)
+	writeUploadHeaders(w, upload)
+	writeUploadJSON(w, http.StatusCreated, uploadStatus(upload))
+}
+
+func appendUpload(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != transfer.UploadContentType {
+		http.Error(w, "Content-Type must be "+transfer.UploadContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(transfer.UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset required", http.StatusBadRequest)
+		return
+	}
+
+	owner := uploader(r)
+	upload, err := uploadStore.Append(id, owner, offset, r.Body, r.Header.Get(transfer.UploadChecksumHeader))
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	writeUploadHeaders(w, upload)
+	if !upload.Complete() || upload.Offset == offset {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// The last chunk assembles the document, which is then stored as if
+	// uploaded whole
+	file, err := uploadStore.Open(id, owner)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	defer uploadStore.Delete(id, owner)
+	defer file.Close()
+	storeUpload(w, r, upload.Filename, file)
+}
+
+// uploadStatus is the progress of an upload reported to clients
+func uploadStatus(upload *transfer.Upload) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       upload.ID,
+		"filename": upload.Filename,
+		"size":     upload.Size,
+		"offset":   upload.Offset,
+		"chunks":   upload.Chunks,
+		"expires":  upload.Expires,
+		"status":   "uploading",
+	}
+}
+
+func writeUploadJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeUploadHeaders(w http.ResponseWriter, upload *transfer.Upload) {
+	w.Header().Set(transfer.UploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set(transfer.UploadLengthHeader, strconv.FormatInt(upload.Size, 10))
+	w.Header().Set(transfer.UploadExpiresHeader, upload.Expires.Format(http.TimeFormat))
+}
+
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var offsetErr *transfer.OffsetError
+	switch {
+	case errors.Is(err, transfer.ErrUploadNotFound):
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case errors.As(err, &offsetErr):
+		w.Header().Set(transfer.UploadOffsetHeader, strconv.FormatInt(offsetErr.Expected, 10))
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, transfer.ErrUploadBusy):
+		http.Error(w, err.Error(), http.StatusLocked)
+	case errors.Is(err, transfer.ErrChecksumMismatch):
+		serverMetrics.ValidationFailures.Inc("chunk_checksum")
+		http.Error(w, err.Error(), transfer.StatusChecksumMismatch)
+	default:
+		log.WarnContext(r.Context(), "Upload chunk refused", "error", err)
+		http.Error(w, fmt.Sprintf("Chunk refused: %v", err), http.StatusBadRequest)
+	}
+}
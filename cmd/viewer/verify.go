@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// Trust states of a document shown by the viewer badge
+const (
+	// trustVerified documents are signed with a trusted key and unchanged
+	trustVerified = "verified"
+	// trustUntrusted documents are signed, but not with a trusted key, so
+	// whether they are unchanged cannot always be told
+	trustUntrusted = "untrusted"
+	// trustTampered documents changed after they were signed, or their
+	// content does not match the manifest
+	trustTampered = "tampered"
+	// trustUnsigned documents carry no signatures
+	trustUnsigned = "unsigned"
+)
+
+// trustedKeys are the public keys whose signatures the viewer trusts
+var trustedKeys []crypto.PublicKey
+
+// clockSkew is how far ahead of the clock of the viewer the times of a
+// document and its signers may be before verification warns of them, and
+// how far outside their validity period certificates are still accepted
+var clockSkew = core.DefaultClockSkew
+
+// loadTrustedKeys reads the PEM public keys given with --trusted-key
+func loadTrustedKeys(files []string) ([]crypto.PublicKey, error) {
+	sm := integrity.NewSignatureManager()
+	var keys []crypto.PublicKey
+	for _, file := range files {
+		key, err := sm.LoadPublicKeyPEM(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted key %s: %v", file, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// verifyResponse is the /api/verify response
+type verifyResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Signers are the signers of the document in signing order, verified
+	// with the trusted keys
+	Signers []*integrity.SignerVerificationResult `json:"signers"`
+	// Timestamp is when the first signer signed, attested by a valid timestamp
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Errors    []string   `json:"errors"`
+	// Warnings report times of the document ahead of the clock of the
+	// viewer and unsigned access policies, which do not change its status
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// handleVerify checks the signatures of an uploaded document, or of the
+// served document when no id is given, against the trusted keys. The viewer
+// shows the result before rendering the document.
+func handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		response *verifyResponse
+		err      error
+	)
+	if id := r.URL.Query().Get("id"); id != "" {
+		var doc store.Document
+		var reader *zip.Reader
+		doc, reader, err = openStoredPackage(id)
+		if err == nil {
+			defer doc.Close()
+			response, err = verifyPackage(reader)
+		}
+	} else if servedDocument != "" {
+		var reader *zip.ReadCloser
+		reader, err = zip.OpenReader(servedDocument)
+		if err == nil {
+			defer reader.Close()
+			response, err = verifyPackage(&reader.Reader)
+		}
+	} else {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		log.WarnContext(r.Context(), "Failed to verify document", "error", err)
+		serverMetrics.ValidationFailures.Inc(validationReason(err))
+		http.Error(w, fmt.Sprintf("Invalid LIV document: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if response.Status == trustTampered {
+		serverMetrics.ValidationFailures.Inc("tampered")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// verifyPackage checks the resources of an opened package against its
+// manifest and its signatures against the trusted keys
+func verifyPackage(reader *zip.Reader) (*verifyResponse, error) {
+	files := make(map[string][]byte)
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		data, err := readZipEntry(reader, file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file.Name, err)
+		}
+		files[file.Name] = data
+	}
+	m, err := readStoredManifest(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &verifyResponse{Signers: []*integrity.SignerVerificationResult{}, Errors: []string{}}
+	for _, err := range integrity.NewResourceHasher(integrity.SHA256).VerifyResources(m, files) {
+		var missing *core.FileMissingError
+		if errors.As(err, &missing) {
+			response.Errors = append(response.Errors, fmt.Sprintf("resource %s is missing", missing.Path))
+		} else {
+			response.Errors = append(response.Errors, "resource "+err.Error())
+		}
+	}
+
+	signatures, err := container.ReadSignatureFiles(files)
+	if err != nil {
+		response.Errors = append(response.Errors, err.Error())
+		return response.finish(trustTampered, "The signatures of this document are corrupt"), nil
+	}
+	if signatures.ManifestSignature == "" {
+		if len(response.Errors) > 0 {
+			return response.finish(trustTampered, "This document does not match its manifest"), nil
+		}
+		if m.Access != nil {
+			response.Warnings = append(response.Warnings, "the access policy is not signed, so it can be removed without notice")
+		}
+		return response.finish(trustUnsigned, "This document is not signed"), nil
+	}
+
+	document := &core.LIVDocument{
+		Manifest: m,
+		Content: &core.DocumentContent{
+			HTML:            string(files["content/index.html"]),
+			CSS:             string(files["content/styles/main.css"]),
+			InteractiveSpec: string(files["content/scripts/main.js"]),
+			StaticFallback:  string(files["content/static/fallback.html"]),
+		},
+		WASMModules: make(map[string][]byte),
+		Signatures:  signatures,
+	}
+	for name, data := range files {
+		if path.Ext(name) == ".wasm" {
+			document.WASMModules[strings.TrimSuffix(path.Base(name), ".wasm")] = data
+		}
+	}
+
+	start := time.Now()
+	defer func() { serverMetrics.SignatureVerification.ObserveSince(start, response.Status) }()
+	sm := integrity.NewSignatureManager()
+	sm.SetClockSkew(clockSkew)
+	response.Signers = sm.VerifySigners(document, trustedKeys)
+	first := response.Signers[0]
+	response.Timestamp = first.Timestamp
+	for i, signer := range response.Signers {
+		for _, message := range signer.Errors {
+			response.Errors = append(response.Errors, fmt.Sprintf("signer %d: %s", i+1, message))
+		}
+		for _, message := range signer.Warnings {
+			response.Warnings = append(response.Warnings, fmt.Sprintf("signer %d: %s", i+1, message))
+		}
+	}
+
+	tampered := len(response.Errors) > 0
+	for _, signer := range response.Signers {
+		// Without signer metadata a failure may only mean another key signed
+		if signer.Status == integrity.SignerInvalid && signer.Signer != nil {
+			tampered = true
+		}
+	}
+	if first.Status != integrity.SignerValid && !tampered {
+		// The signer is not trusted, but the certificate shipped with the
+		// document still tells whether it changed after signing
+		if key := packageCertificateKey(files); key != nil {
+			if result := sm.VerifyDocument(document, key); !result.Valid {
+				response.Errors = append(response.Errors, result.Errors...)
+				tampered = true
+			}
+		}
+	}
+
+	switch {
+	case tampered:
+		return response.finish(trustTampered, "This document was changed after it was signed"), nil
+	case first.Status == integrity.SignerValid:
+		return response.finish(trustVerified, "Signed with a trusted key"), nil
+	}
+	return response.finish(trustUntrusted, "Signed, but not with a trusted key"), nil
+}
+
+func (r *verifyResponse) finish(status, message string) *verifyResponse {
+	r.Status = status
+	r.Message = message
+	return r
+}
+
+// packageCertificateKey returns the public key of the signer certificate
+// stored in a package, or nil when there is none
+func packageCertificateKey(files map[string][]byte) crypto.PublicKey {
+	block, _ := pem.Decode(files["signatures/certificate.pem"])
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	if _, err := integrity.AlgorithmForKey(cert.PublicKey); err != nil {
+		return nil
+	}
+	return cert.PublicKey
+}
@@ -1,12 +1,66 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math/rand"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/access"
+	"github.com/liv-format/liv/pkg/annotations"
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/delta"
+	"github.com/liv-format/liv/pkg/health"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/jobs"
+	"github.com/liv-format/liv/pkg/log"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/ogimage"
+	"github.com/liv-format/liv/pkg/readingstate"
+	"github.com/liv-format/liv/pkg/sandbox"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/liv-format/liv/pkg/transfer"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/websocket"
 )
 
+func TestMain(m *testing.M) {
+	// Sandboxed workers run this test binary as the viewer executable
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		root := &cobra.Command{Use: "liv-viewer"}
+		root.AddCommand(workerCmd())
+		root.SetArgs(os.Args[1:])
+		if err := root.Execute(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
 func TestHandleIndex(t *testing.T) {
 	req, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -35,6 +89,10 @@ func TestHandleIndex(t *testing.T) {
 	if !strings.Contains(body, "manifest.json") {
 		t.Errorf("handler returned unexpected body: missing PWA manifest")
 	}
+
+	if _, ok := readStaticAsset("js/liv-local.js"); !ok || !strings.Contains(body, "LIVLocal.open(file") || !strings.Contains(body, "uploadDocument(file)") {
+		t.Errorf("expected documents to open in the browser, uploading them as a fallback")
+	}
 }
 
 func TestHandleViewer(t *testing.T) {
@@ -62,34 +120,203 @@ func TestHandleViewer(t *testing.T) {
 		t.Errorf("handler returned unexpected body: missing WASM integration")
 	}
 
+	if !strings.Contains(body, `id="trustBadge"`) || !strings.Contains(body, "/static/js/liv-trust.js") {
+		t.Errorf("handler returned unexpected body: missing signature trust badge")
+	}
+
 	if !strings.Contains(body, "responsive") {
 		t.Errorf("handler returned unexpected body: missing responsive design")
 	}
 }
 
+// createTestPackage writes a minimal valid .liv package and returns its bytes
+func createTestPackage(t *testing.T) []byte {
+	return createTestPackageWithFiles(t, nil)
+}
+
+// createTestPackageWithFiles writes a valid .liv package containing extra files
+// in addition to the main content
+func createTestPackageWithFiles(t *testing.T, extra map[string][]byte) []byte {
+	return createTestPackageWithManifest(t, extra, nil)
+}
+
+// createTestPackageWithManifest writes a valid .liv package whose manifest is
+// adjusted by edit
+func createTestPackageWithManifest(t *testing.T, extra map[string][]byte, edit func(*core.Manifest)) []byte {
+	files := map[string][]byte{
+		"content/index.html": []byte("<h1>Stored</h1>"),
+	}
+	for path, data := range extra {
+		files[path] = data
+	}
+
+	builder := manifest.CreateStaticDocumentTemplate("Quarterly Report", "ACME Corp")
+	for path, data := range files {
+		hash := sha256.Sum256(data)
+		builder.AddResource(path, &core.Resource{
+			Hash: hex.EncodeToString(hash[:]),
+			Size: int64(len(data)),
+			Type: "text/html",
+			Path: path,
+		})
+	}
+	if edit != nil {
+		edit(builder.GetManifest())
+	}
+	manifestJSON, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["manifest.json"] = manifestJSON
+
+	livPath := filepath.Join(t.TempDir(), "report.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(files, livPath); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(livPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
 func TestHandleDocument(t *testing.T) {
-	req, err := http.NewRequest("GET", "/api/document?id=test123", nil)
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	packageData := createTestPackage(t)
+	info, err := docStore.Put("report.liv", bytes.NewReader(packageData))
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(handleDocument)
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+info.ID, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
 
-	handler.ServeHTTP(rr, req)
+	var metadata documentMetadata
+	if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil {
+		t.Fatalf("invalid metadata response: %v", err)
+	}
+	if metadata.ID != info.ID || metadata.Title != "Quarterly Report" || metadata.Author != "ACME Corp" {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+	if len(metadata.Resources) != 1 || metadata.Resources[0].Path != "content/index.html" {
+		t.Errorf("unexpected resources: %+v", metadata.Resources)
+	}
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+info.ID+"&download=true", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), packageData) {
+		t.Fatalf("download did not return the stored bytes: %v", rr.Code)
+	}
+	if length := rr.Header().Get("Content-Length"); length != strconv.Itoa(len(packageData)) {
+		t.Errorf("unexpected Content-Length: %q", length)
+	}
+	etag := rr.Header().Get("ETag")
+	if etag != `"`+info.SHA256+`"` {
+		t.Errorf("unexpected ETag: %q", etag)
 	}
 
-	body := rr.Body.String()
-	if !strings.Contains(body, "test123") {
-		t.Errorf("handler returned unexpected body: missing document ID")
+	req := httptest.NewRequest("GET", "/api/document?id="+info.ID+"&download=true", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handleDocument(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for matching ETag, got %v", rr.Code)
+	}
+
+	for _, id := range []string{"test123", strings.Repeat("0", 32)} {
+		rr = httptest.NewRecorder()
+		handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+id, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected unknown document %q to be missing, got %v", id, rr.Code)
+		}
+	}
+}
+
+func TestResumableDownload(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	// A package large enough for several chunks
+	noise := make([]byte, 3*transfer.MinChunkSize)
+	rand.New(rand.NewSource(1)).Read(noise)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	entry, _ := zw.CreateHeader(&zip.FileHeader{Name: "assets/data/noise.bin", Method: zip.Store})
+	entry.Write(noise)
+	zw.Close()
+	packageData := buf.Bytes()
+	info, err := docStore.Put("large.liv", bytes.NewReader(packageData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloadURL := "/api/document?id=" + info.ID + "&download=true"
+	etag := `"` + info.SHA256 + `"`
+
+	req := httptest.NewRequest("GET", downloadURL, nil)
+	req.Header.Set("Range", "bytes=1000-")
+	req.Header.Set("If-Range", etag)
+	rr := httptest.NewRecorder()
+	handleDocument(rr, req)
+	if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), packageData[1000:]) {
+		t.Fatalf("expected the rest of the document, got %v", rr.Code)
+	}
+	if link := rr.Header().Get(transfer.ManifestHeader); link != documentChunksURL(info.ID) {
+		t.Errorf("unexpected chunk manifest link %q", link)
+	}
+
+	// A stale ETag gets the whole current document
+	req.Header.Set("If-Range", `"stale"`)
+	rr = httptest.NewRecorder()
+	handleDocument(rr, req)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), packageData) {
+		t.Errorf("expected the whole document for a stale If-Range, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", documentChunksURL(info.ID)+"&chunk_size=65536", nil))
+	var chunks transfer.ChunkManifest
+	if err := json.Unmarshal(rr.Body.Bytes(), &chunks); err != nil {
+		t.Fatalf("invalid chunk manifest: %v", err)
+	}
+	expected, _ := transfer.ComputeChunks(bytes.NewReader(packageData), 65536)
+	if chunks.SHA256 != info.SHA256 || chunks.ETag != etag || len(chunks.Chunks) != len(expected.Chunks) || chunks.Chunks[1] != expected.Chunks[1] {
+		t.Errorf("unexpected chunk manifest: %+v", chunks)
+	}
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", documentChunksURL(info.ID)+"&chunk_size=12", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a tiny chunk size to be refused, got %v", rr.Code)
 	}
 
-	if !strings.Contains(body, "Sample LIV Document") {
-		t.Errorf("handler returned unexpected body: missing document title")
+	// A client follows the manifest link and verifies the download
+	server := httptest.NewServer(http.HandlerFunc(handleDocument))
+	defer server.Close()
+	fetcher := transfer.NewFetcher()
+	remote, err := fetcher.Probe(context.Background(), server.URL+downloadURL)
+	if err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if remote.Filename != "large.liv" || remote.Manifest == nil {
+		t.Errorf("unexpected remote %+v", remote)
+	}
+	dest := filepath.Join(t.TempDir(), remote.Filename)
+	result, err := fetcher.Fetch(context.Background(), remote, dest)
+	if err != nil || !result.Verified || result.SHA256 != info.SHA256 {
+		t.Fatalf("fetch failed: %+v, %v", result, err)
 	}
 }
 
@@ -157,6 +384,45 @@ func TestHandleServiceWorker(t *testing.T) {
 	}
 }
 
+func TestServiceWorkerLists(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleServiceWorker(rr, httptest.NewRequest("GET", "/sw.js", nil))
+	body := rr.Body.String()
+	prefix, _, ok := strings.Cut(body, ";\n")
+	if !ok || !strings.HasPrefix(prefix, "const LIV_OFFLINE = ") {
+		t.Fatalf("Expected the worker to start with its configuration, got %.200s", body)
+	}
+	var config serviceWorkerConfig
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(prefix, "const LIV_OFFLINE = ")), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	static := strings.Join(config.Static, " ")
+	if !strings.Contains(static, "/static/js/liv-offline.js") || strings.Contains(static, "/static/css/app.css") {
+		t.Errorf("Expected the embedded assets to be cached, got %v", config.Static)
+	}
+	if !config.Listed || len(config.Documents) != 1 || config.Documents[0] != documentDigest(info.ID, info.SHA256) {
+		t.Errorf("Expected the stored document's digest, got %v", config.Documents)
+	}
+	if strings.Contains(body, info.ID) {
+		t.Error("Expected the worker not to reveal document ids")
+	}
+	if config.Limits.Cache != offlineLimits.CacheMB<<20 || config.Limits.Document != offlineLimits.DocumentMB<<20 {
+		t.Errorf("Unexpected limits %+v", config.Limits)
+	}
+}
+
 func TestHandleStatic(t *testing.T) {
 	tests := []struct {
 		path        string
@@ -223,4 +489,2646 @@ func TestRunViewer(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+func TestHandleResource(t *testing.T) {
+	dir := t.TempDir()
+	livPath := filepath.Join(dir, "doc.liv")
+
+	files := map[string][]byte{
+		"manifest.json":      []byte(`{"version":"1.0"}`),
+		"content/index.html": []byte("0123456789abcdef"),
+	}
+	if err := container.NewZIPContainer().CreateFromFiles(files, livPath); err != nil {
+		t.Fatal(err)
+	}
+
+	servedDocument = livPath
+	defer func() { servedDocument = "" }()
+
+	req := httptest.NewRequest("GET", "/api/resource?path=content/index.html", nil)
+	req.Header.Set("Range", "bytes=4-7")
+	rr := httptest.NewRecorder()
+	handleResource(rr, req)
+
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("expected partial content, got %v", rr.Code)
+	}
+	if body := rr.Body.String(); body != "4567" {
+		t.Errorf("unexpected range body: %q", body)
+	}
+
+	for _, path := range []string{"", "../etc/passwd", "/abs", "content/missing.html"} {
+		rr := httptest.NewRecorder()
+		handleResource(rr, httptest.NewRequest("GET", "/api/resource?path="+path, nil))
+		if rr.Code == http.StatusOK || rr.Code == http.StatusPartialContent {
+			t.Errorf("expected %q to be rejected, got %v", path, rr.Code)
+		}
+	}
+}
+
+func TestDocumentResource(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	// Video is stored uncompressed and stylesheets are compressed
+	video := bytes.Repeat([]byte("0123456789"), 10000)
+	style := []byte(strings.Repeat("body { margin: 0; }\n", 500))
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackageWithFiles(t, map[string][]byte{
+		"assets/media/intro clip.mp4": video,
+		"assets/style.css":            style,
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+info.ID, nil))
+	var metadata documentMetadata
+	if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil {
+		t.Fatal(err)
+	}
+	videoURL := ""
+	for _, resource := range metadata.Resources {
+		if resource.Path == "assets/media/intro clip.mp4" {
+			videoURL = resource.URL
+		}
+	}
+	if videoURL != "/api/document/"+info.ID+"/resource/assets/media/intro%20clip.mp4" {
+		t.Fatalf("unexpected resource URL %q", videoURL)
+	}
+
+	rr = httptest.NewRecorder()
+	handleDocumentResource(rr, httptest.NewRequest("GET", videoURL, nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), video) {
+		t.Fatalf("expected the whole video, got %v with %d bytes", rr.Code, rr.Body.Len())
+	}
+	if rr.Header().Get("Content-Type") != "video/mp4" || rr.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("unexpected headers %v", rr.Header())
+	}
+	etag := rr.Header().Get("ETag")
+
+	for _, entry := range []struct {
+		url  string
+		data []byte
+	}{
+		{videoURL, video},
+		{"/api/document/" + info.ID + "/resource/assets/style.css", style},
+	} {
+		req := httptest.NewRequest("GET", entry.url, nil)
+		req.Header.Set("Range", "bytes=5000-5009")
+		rr = httptest.NewRecorder()
+		handleDocumentResource(rr, req)
+		if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), entry.data[5000:5010]) {
+			t.Errorf("expected bytes 5000-5009 of %s, got %v: %q", entry.url, rr.Code, rr.Body.String())
+		}
+		if want := fmt.Sprintf("bytes 5000-5009/%d", len(entry.data)); rr.Header().Get("Content-Range") != want {
+			t.Errorf("expected Content-Range %q, got %q", want, rr.Header().Get("Content-Range"))
+		}
+
+		// Later ranges of a compressed entry are read after earlier ones
+		req = httptest.NewRequest("GET", entry.url, nil)
+		req.Header.Set("Range", "bytes=-4")
+		rr = httptest.NewRecorder()
+		handleDocumentResource(rr, req)
+		if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), entry.data[len(entry.data)-4:]) {
+			t.Errorf("expected the last bytes of %s, got %v: %q", entry.url, rr.Code, rr.Body.String())
+		}
+	}
+
+	// A range is only served from the version it was asked for
+	req := httptest.NewRequest("GET", videoURL, nil)
+	req.Header.Set("Range", "bytes=0-9")
+	req.Header.Set("If-Range", etag)
+	rr = httptest.NewRecorder()
+	handleDocumentResource(rr, req)
+	if rr.Code != http.StatusPartialContent {
+		t.Errorf("expected a range of the same version, got %v", rr.Code)
+	}
+	req.Header.Set("If-Range", `"other"`)
+	rr = httptest.NewRecorder()
+	handleDocumentResource(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.Len() != len(video) {
+		t.Errorf("expected the whole video for another version, got %v", rr.Code)
+	}
+	req = httptest.NewRequest("GET", videoURL, nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handleDocumentResource(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected an unchanged video to be revalidated, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleDocumentResource(rr, httptest.NewRequest("HEAD", videoURL, nil))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 || rr.Header().Get("Content-Length") != strconv.Itoa(len(video)) {
+		t.Errorf("unexpected HEAD response %v %v", rr.Code, rr.Header())
+	}
+
+	for path, code := range map[string]int{
+		"/api/document/" + info.ID + "/resource/assets/missing.png": http.StatusNotFound,
+		"/api/document/missing/resource/assets/style.css":           http.StatusNotFound,
+		"/api/document/" + info.ID + "/resource/../manifest.json":   http.StatusBadRequest,
+		"/api/document/" + info.ID + "/resource/":                   http.StatusBadRequest,
+		"/api/document/" + info.ID + "/assets/style.css":            http.StatusBadRequest,
+	} {
+		rr = httptest.NewRecorder()
+		handleDocumentResource(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != code {
+			t.Errorf("expected %v for %s, got %v", code, path, rr.Code)
+		}
+	}
+}
+
+func TestUploadAndRetrieveDocument(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	packageData := createTestPackage(t)
+
+	upload := func(filename string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("document", filename)
+		part.Write(data)
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rr := httptest.NewRecorder()
+		handleUpload(rr, req)
+		return rr
+	}
+
+	if rr := upload("fake.liv", []byte("not a zip")); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid package to be rejected, got %v", rr.Code)
+	}
+
+	rr := upload("report.liv", packageData)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("upload failed: %v %s", rr.Code, rr.Body.String())
+	}
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &uploaded)
+	if !store.ValidID(uploaded.ID) {
+		t.Fatalf("unexpected document ID: %q", uploaded.ID)
+	}
+
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+uploaded.ID+"&download=true", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), packageData) {
+		t.Errorf("download did not return the uploaded bytes: %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleResource(rr, httptest.NewRequest("GET", "/api/resource?id="+uploaded.ID+"&path=content/index.html", nil))
+	if rr.Body.String() != "<h1>Stored</h1>" {
+		t.Errorf("unexpected resource body: %q", rr.Body.String())
+	}
+
+	docStore.Delete(uploaded.ID)
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+uploaded.ID, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected deleted document to be missing, got %v", rr.Code)
+	}
+}
+
+// busyStore is a document store another process keeps locked
+type busyStore struct {
+	store.DocumentStore
+}
+
+func (busyStore) Put(filename string, r io.Reader) (*store.DocumentInfo, error) {
+	return nil, store.ErrLockTimeout
+}
+
+func TestUploadToBusyStore(t *testing.T) {
+	documentStore = busyStore{}
+	defer func() { documentStore = nil }()
+
+	rr := httptest.NewRecorder()
+	storeUpload(rr, httptest.NewRequest("POST", "/api/upload", nil), "report.liv", bytes.NewReader(createTestPackage(t)))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a busy store to ask the client to retry, got %v", rr.Code)
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := transfer.NewUploadStore(t.TempDir(), maxUploadSize, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore, uploadStore = docStore, uploads
+	defer func() { documentStore, uploadStore = nil, nil }()
+
+	packageData := createTestPackage(t)
+	send := func(method, path string, body []byte, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set(transfer.ResumableHeader, transfer.ResumableVersion)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rr := httptest.NewRecorder()
+		handleUploads(rr, req)
+		return rr
+	}
+	checksum := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	filename := "filename " + base64.StdEncoding.EncodeToString([]byte("report.liv"))
+	size := strconv.Itoa(len(packageData))
+
+	if rr := send("POST", uploadsPath, nil, transfer.UploadLengthHeader, size, transfer.UploadMetadataHeader, "filename "+base64.StdEncoding.EncodeToString([]byte("report.exe"))); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a non-LIV upload to be refused, got %v", rr.Code)
+	}
+	if rr := send("POST", uploadsPath, nil, transfer.UploadLengthHeader, strconv.Itoa(maxUploadSize+1), transfer.UploadMetadataHeader, filename); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected an oversized upload to be refused, got %v", rr.Code)
+	}
+
+	rr := send("POST", uploadsPath, nil, transfer.UploadLengthHeader, size, transfer.UploadMetadataHeader, filename)
+	location := rr.Header().Get("Location")
+	if rr.Code != http.StatusCreated || !strings.HasPrefix(location, uploadsPath+"/") {
+		t.Fatalf("create failed: %v %q %s", rr.Code, location, rr.Body.String())
+	}
+
+	half := len(packageData) / 2
+	first, rest := packageData[:half], packageData[half:]
+	patch := func(offset int, chunk []byte, sum string) *httptest.ResponseRecorder {
+		return send("PATCH", location, chunk, "Content-Type", transfer.UploadContentType,
+			transfer.UploadOffsetHeader, strconv.Itoa(offset), transfer.UploadChecksumHeader, sum)
+	}
+	if rr := patch(0, first, checksum(rest)); rr.Code != transfer.StatusChecksumMismatch {
+		t.Errorf("expected a corrupted chunk to be refused, got %v", rr.Code)
+	}
+	if rr := patch(0, first, checksum(first)); rr.Code != http.StatusNoContent || rr.Header().Get(transfer.UploadOffsetHeader) != strconv.Itoa(half) {
+		t.Fatalf("first chunk failed: %v %v", rr.Code, rr.Header())
+	}
+	if rr := patch(0, first, checksum(first)); rr.Code != http.StatusConflict || rr.Header().Get(transfer.UploadOffsetHeader) != strconv.Itoa(half) {
+		t.Errorf("expected a replayed chunk to conflict at the reached offset, got %v %v", rr.Code, rr.Header())
+	}
+
+	// Another client cannot see or continue the upload
+	req := httptest.NewRequest("HEAD", location, nil)
+	req.RemoteAddr = "192.0.2.9:1234"
+	other := httptest.NewRecorder()
+	handleUploads(other, req)
+	if other.Code != http.StatusNotFound {
+		t.Errorf("expected another client's upload to be hidden, got %v", other.Code)
+	}
+
+	if rr := send("HEAD", location, nil); rr.Code != http.StatusOK || rr.Header().Get(transfer.UploadOffsetHeader) != strconv.Itoa(half) {
+		t.Errorf("expected HEAD to report the offset reached, got %v %v", rr.Code, rr.Header())
+	}
+
+	rr = patch(half, rest, checksum(rest))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("last chunk failed: %v %s", rr.Code, rr.Body.String())
+	}
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &uploaded)
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+uploaded.ID+"&download=true", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), packageData) {
+		t.Errorf("download did not return the uploaded bytes: %v", rr.Code)
+	}
+	if rr := send("HEAD", location, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the finished upload to be removed, got %v", rr.Code)
+	}
+}
+
+func TestStaticFallback(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	fallback := `<html><head><link rel="stylesheet" href="../styles/main.css"><script>alert(1)</script></head>
+<body onload="steal()"><h1>Quarterly Report</h1>
+<p><a href="javascript:alert(1)">bad</a> <a href="https://example.com">good</a></p>
+<img src="../images/chart.png" onerror="steal()"><iframe src="https://evil.example"></iframe>
+<noscript><p>Static summary</p></noscript></body></html>`
+	packageData := createTestPackageWithFiles(t, map[string][]byte{
+		"content/static/fallback.html": []byte(fallback),
+		"content/styles/main.css":      []byte("h1 { color: navy; }"),
+	})
+	info, err := docStore.Put("report.liv", bytes.NewReader(packageData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viewer := func(query, agent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/viewer?id="+info.ID+query, nil)
+		req.Header.Set("User-Agent", agent)
+		rr := httptest.NewRecorder()
+		handleViewer(rr, req)
+		return rr
+	}
+
+	rr := viewer("", "curl/8.4.0")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected static fallback, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("unexpected content type: %q", contentType)
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("expected restrictive content security policy, got %q", csp)
+	}
+	if vary := rr.Header().Get("Vary"); vary != "User-Agent" {
+		t.Errorf("expected Vary: User-Agent, got %q", vary)
+	}
+
+	body := rr.Body.String()
+	for _, unexpected := range []string{"<script", "alert(1)", "onload", "onerror", "<iframe", "javascript:", "LIV Viewer"} {
+		if strings.Contains(body, unexpected) {
+			t.Errorf("static fallback contains %q:\n%s", unexpected, body)
+		}
+	}
+	expected := []string{
+		"<title>Quarterly Report</title>",
+		`<meta property="og:title" content="Quarterly Report"/>`,
+		"<style>h1 { color: navy; }</style>",
+		`<a href="https://example.com">good</a>`,
+		`<img src="/api/resource?id=` + info.ID + `&amp;path=content%2Fimages%2Fchart.png"/>`,
+		"<p>Static summary</p>",
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(body, fragment) {
+			t.Errorf("static fallback missing %q:\n%s", fragment, body)
+		}
+	}
+
+	browser := "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	rr = viewer("", browser)
+	if body := rr.Body.String(); !strings.Contains(body, "LIV Viewer") || !strings.Contains(body, "static=1") {
+		t.Errorf("expected loader shell with a noscript fallback link for browsers")
+	}
+	if rr := viewer("&static=1", browser); strings.Contains(rr.Body.String(), "LIV Viewer") {
+		t.Errorf("expected static=1 to force the static fallback")
+	}
+	if rr := viewer("&static=0", "Slackbot-LinkExpanding 1.0"); !strings.Contains(rr.Body.String(), "LIV Viewer") {
+		t.Errorf("expected static=0 to force the loader shell")
+	}
+
+	req := httptest.NewRequest("GET", "/viewer?id=0123456789abcdef0123456789abcdef", nil)
+	req.Header.Set("User-Agent", "Wget/1.21")
+	rr = httptest.NewRecorder()
+	handleViewer(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown document to be missing, got %v", rr.Code)
+	}
+}
+
+func TestOGImage(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	cover := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	var coverPNG bytes.Buffer
+	if err := png.Encode(&coverPNG, cover); err != nil {
+		t.Fatal(err)
+	}
+	packageData := createTestPackageWithFiles(t, map[string][]byte{"assets/cover.png": coverPNG.Bytes()})
+	info, err := docStore.Put("report.liv", bytes.NewReader(packageData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleOGImage(rr, httptest.NewRequest("GET", "/api/og-image?id="+info.ID, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected preview image, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("unexpected content type: %q", contentType)
+	}
+	card, err := png.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("preview image is not a PNG: %v", err)
+	}
+	if card.Bounds().Dx() != ogimage.Width || card.Bounds().Dy() != ogimage.Height {
+		t.Errorf("unexpected preview size %v", card.Bounds())
+	}
+	if previewImages.get(info.SHA256) == nil {
+		t.Errorf("expected the rendered card to be cached")
+	}
+
+	req := httptest.NewRequest("GET", "/api/og-image?id="+info.ID, nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	handleOGImage(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %v", rr.Code)
+	}
+
+	// A card rendered at build time is served unchanged
+	prebuilt := createTestPackageWithFiles(t, map[string][]byte{ogimage.Entry: coverPNG.Bytes()})
+	prebuiltInfo, err := docStore.Put("prebuilt.liv", bytes.NewReader(prebuilt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handleOGImage(rr, httptest.NewRequest("GET", "/api/og-image?id="+prebuiltInfo.ID, nil))
+	if !bytes.Equal(rr.Body.Bytes(), coverPNG.Bytes()) {
+		t.Errorf("expected the build-time card to be served")
+	}
+
+	rr = httptest.NewRecorder()
+	handleOGImage(rr, httptest.NewRequest("GET", "/api/og-image?id=0123456789abcdef0123456789abcdef", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown document to be missing, got %v", rr.Code)
+	}
+
+	imageURL := "https://docs.example.com/api/og-image?id=" + info.ID
+	for _, agent := range []string{"Mozilla/5.0 Chrome/120.0", "Slackbot-LinkExpanding 1.0"} {
+		req := httptest.NewRequest("GET", "/viewer?id="+info.ID, nil)
+		req.Host = "docs.example.com"
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("User-Agent", agent)
+		rr := httptest.NewRecorder()
+		handleViewer(rr, req)
+
+		body := rr.Body.String()
+		for _, fragment := range []string{`property="og:image" content="` + imageURL, `name="twitter:card" content="summary_large_image"`, `content="Quarterly Report"`} {
+			if !strings.Contains(body, fragment) {
+				t.Errorf("viewer page for %q missing %q", agent, fragment)
+			}
+		}
+	}
+}
+
+func TestHealthAPI(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	healthMonitor = health.NewMonitor(docStore, health.NewChecker(), health.TrustConfig{})
+	defer func() { documentStore, healthMonitor, healthToken = nil, nil, "" }()
+
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, target, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		if strings.HasPrefix(target, "/health") {
+			handleHealthDashboard(rr, req)
+		} else {
+			handleHealth(rr, req)
+		}
+		return rr
+	}
+
+	if rr := request("GET", "/api/health", "203.0.113.7:4000"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected remote clients to be refused without a token, got %v", rr.Code)
+	}
+
+	rr := request("POST", "/api/health", "127.0.0.1:4000")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected revalidation to succeed, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var response healthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid health response: %v", err)
+	}
+	if response.Summary.Documents != 1 || len(response.Documents) != 1 || response.Documents[0].ID != info.ID {
+		t.Errorf("unexpected health response: %s", rr.Body.String())
+	}
+
+	rr = request("GET", "/api/health?id="+info.ID, "[::1]:4000")
+	var report health.Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil || report.ID != info.ID || report.Status == "" {
+		t.Errorf("unexpected document report: %s", rr.Body.String())
+	}
+	if rr := request("GET", "/api/health?id=0123456789abcdef0123456789abcdef", "127.0.0.1:4000"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown documents to be missing, got %v", rr.Code)
+	}
+
+	rr = request("GET", "/health", "127.0.0.1:4000")
+	if body := rr.Body.String(); !strings.Contains(body, "report.liv") || !strings.Contains(body, "/viewer?id="+info.ID) {
+		t.Errorf("expected the document on the dashboard:\n%s", body)
+	}
+
+	healthToken = "s3cret"
+	if rr := request("GET", "/api/health", "127.0.0.1:4000"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected the token to be required once configured, got %v", rr.Code)
+	}
+	if rr := request("GET", "/api/health?token=s3cret", "203.0.113.7:4000"); rr.Code != http.StatusOK {
+		t.Errorf("expected a valid token to be accepted, got %v", rr.Code)
+	}
+}
+
+// testDirectory signs in users whose password is "pw-" and their username
+type testDirectory struct{}
+
+func (testDirectory) Name() string { return "directory" }
+
+func (testDirectory) Authenticate(ctx context.Context, username, password string) (*auth.Identity, error) {
+	if password != "pw-"+username {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return &auth.Identity{Username: username, Provider: "directory", Groups: []string{"CN=" + username + ",OU=Groups,DC=example,DC=com"}}, nil
+}
+
+func TestLibraryAuthentication(t *testing.T) {
+	sessions, err := auth.NewSessions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &auth.Authenticator{
+		Passwords: []auth.PasswordProvider{testDirectory{}},
+		Roles: &auth.RoleMapping{Groups: map[string][]string{
+			"reader": {auth.RoleReader},
+			"admin":  {auth.RoleAdmin},
+		}},
+		Sessions: sessions,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/viewer", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("viewer")) })
+	mux.HandleFunc("/api/upload", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("uploaded")) })
+	mux.HandleFunc("/api/health", handleHealth)
+	handler := protectLibrary(a, mux)
+
+	signIn := func(username string) *http.Cookie {
+		form := strings.NewReader("username=" + username + "&password=pw-" + username)
+		req := httptest.NewRequest("POST", "/auth/login", form)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		cookies := rr.Result().Cookies()
+		if rr.Code != http.StatusSeeOther || len(cookies) == 0 {
+			t.Fatalf("expected %s to sign in, got %v: %s", username, rr.Code, rr.Body.String())
+		}
+		return cookies[0]
+	}
+	request := func(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", "text/html")
+		req.RemoteAddr = "203.0.113.7:4000"
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request("/viewer?id=abc", nil); rr.Code != http.StatusSeeOther || !strings.HasPrefix(rr.Header().Get("Location"), "/auth/login?next=") {
+		t.Errorf("expected anonymous viewers to be sent to the login page, got %v %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := request("/auth/login", nil); rr.Code != http.StatusOK {
+		t.Errorf("expected the login page to be public, got %v", rr.Code)
+	}
+
+	reader := signIn("reader")
+	if rr := request("/viewer?id=abc", reader); rr.Code != http.StatusOK || rr.Body.String() != "viewer" {
+		t.Errorf("expected readers to view documents, got %v", rr.Code)
+	}
+	if rr := request("/api/upload", reader); rr.Code != http.StatusForbidden {
+		t.Errorf("expected readers to be refused uploads, got %v", rr.Code)
+	}
+	if rr := request("/api/health", reader); rr.Code != http.StatusForbidden {
+		t.Errorf("expected readers to be refused library health, got %v", rr.Code)
+	}
+
+	admin := signIn("admin")
+	if rr := request("/api/upload", admin); rr.Code != http.StatusOK {
+		t.Errorf("expected administrators to upload, got %v", rr.Code)
+	}
+	// Administrators pass the health check's authorization; monitoring is off
+	if rr := request("/api/health", admin); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected administrators to read library health, got %v", rr.Code)
+	}
+}
+
+func TestLiveReload(t *testing.T) {
+	dir := t.TempDir()
+	livPath := filepath.Join(dir, "doc.liv")
+	write := func(body string) {
+		files := map[string][]byte{"manifest.json": []byte(`{"version":"1.0"}`), "content/index.html": []byte(body)}
+		if err := container.NewZIPContainer().CreateFromFiles(files, livPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first")
+
+	liveReload = newReloadHub()
+	defer func() { liveReload = nil }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go liveReload.watch(ctx, livPath, 10*time.Millisecond)
+
+	// The viewer page loads the reload script only in live reload mode
+	rr := httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?file=doc.liv", nil))
+	if !strings.Contains(rr.Body.String(), "/api/live-reload") {
+		t.Error("expected the live reload script in the viewer page")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handleLiveReload))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if _, err := websocket.Dial(wsURL, "", "http://evil.example.com"); err == nil {
+		t.Error("expected a connection from another origin to be refused")
+	}
+
+	conn, err := websocket.Dial(wsURL, "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var event reloadEvent
+	if err := websocket.JSON.Receive(conn, &event); err != nil || event.Type != "hello" || event.Version != 0 {
+		t.Fatalf("expected a hello event, got %+v, %v", event, err)
+	}
+
+	// Ensure the rewrite is visible even on filesystems with coarse timestamps
+	time.Sleep(20 * time.Millisecond)
+	write("second version")
+	if err := websocket.JSON.Receive(conn, &event); err != nil || event.Type != "reload" || event.Version != 1 {
+		t.Fatalf("expected a reload event, got %+v, %v", event, err)
+	}
+}
+
+func TestViewingLimits(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyFile, []byte(`{"policy_id": "shared", "resource_limits": {"max_concurrent_documents": 1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tracker, err := startViewingLimits(viewingConfig{PolicyFile: policyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewingTracker = tracker
+	defer func() { viewingTracker = nil }()
+
+	request := func(method, target, body, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		handleViewing(rr, req)
+		return rr
+	}
+
+	content := requireViewing(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("content")) })
+	fetch := func(remote string) int {
+		req := httptest.NewRequest("GET", "/api/resource?path=manifest.json", nil)
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		content(rr, req)
+		return rr.Code
+	}
+	if code := fetch("203.0.113.7:4000"); code != http.StatusForbidden {
+		t.Errorf("expected content to require an open document, got %v", code)
+	}
+
+	rr := request("POST", "/api/viewing", `{"document": "report.liv"}`, "203.0.113.7:4000")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected the document to open, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var lease viewingLease
+	if err := json.Unmarshal(rr.Body.Bytes(), &lease); err != nil || lease.Lease == nil || lease.ID == "" || lease.RenewSeconds <= 0 {
+		t.Fatalf("unexpected lease %s: %v", rr.Body.String(), err)
+	}
+	if code := fetch("203.0.113.7:5000"); code != http.StatusOK {
+		t.Errorf("expected content to be served while the document is open, got %v", code)
+	}
+
+	rr = request("POST", "/api/viewing", `{"document": "<b>notes</b>"}`, "203.0.113.7:4001")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected the second document to be refused, got %v", rr.Code)
+	}
+	var refusal viewingLimitResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &refusal); err != nil {
+		t.Fatal(err)
+	}
+	if refusal.Scope != "ip" || refusal.Limit != 1 || len(refusal.Open) != 1 || refusal.Open[0].Document != "report.liv" || !strings.Contains(refusal.Error, "limit 1") {
+		t.Errorf("unexpected refusal: %+v", refusal)
+	}
+
+	// Other clients and the holder's other tabs manage only their own sessions
+	if rr := request("POST", "/api/viewing/"+lease.ID+"/close", "", "198.51.100.1:4000"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected other clients not to close the session, got %v", rr.Code)
+	}
+	if rr := request("POST", "/api/viewing/"+lease.ID+"/renew", "", "203.0.113.7:4002"); rr.Code != http.StatusOK {
+		t.Errorf("expected the session to renew, got %v", rr.Code)
+	}
+	if rr := request("POST", "/api/viewing/"+lease.ID+"/close", "", "203.0.113.7:4003"); rr.Code != http.StatusNoContent {
+		t.Errorf("expected the session to close, got %v", rr.Code)
+	}
+	if rr := request("POST", "/api/viewing", `{"document": "notes.liv"}`, "203.0.113.7:4004"); rr.Code != http.StatusCreated {
+		t.Errorf("expected a closed session to free its slot, got %v", rr.Code)
+	}
+
+	if rr := request("GET", "/api/viewing/metrics", "", "203.0.113.7:4000"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected remote clients to be refused metrics, got %v", rr.Code)
+	}
+	rr = request("GET", "/api/viewing/metrics", "", "127.0.0.1:4000")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"rejected":{"ip":1}`) {
+		t.Errorf("unexpected metrics %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSandboxedWorkers(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	// Without a delegated cgroup the workers still run, under the timeout only
+	workerSandbox = sandbox.New(sandbox.Limits{Timeout: 30 * time.Second}, t.TempDir())
+	defer func() { documentStore, workerSandbox = nil, nil }()
+
+	valid, err := docStore.Put("report.liv", bytes.NewReader(createTestPackageWithFiles(t, map[string][]byte{
+		"content/static/fallback.html": []byte(`<h1 onclick="steal()">Quarterly Report</h1><script>alert(1)</script>`),
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateStoredPackage(context.Background(), valid.ID); err != nil {
+		t.Fatalf("expected the worker to accept a valid package: %v", err)
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, _ := zw.Create("content/index.html")
+	w.Write([]byte("<h1>No manifest</h1>"))
+	zw.Close()
+	invalid, err := docStore.Put("broken.liv", bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = validateStoredPackage(context.Background(), invalid.ID)
+	if err == nil || !strings.Contains(err.Error(), "manifest") || strings.Contains(err.Error(), "Error:") || strings.Contains(err.Error(), "Usage:") {
+		t.Errorf("expected the worker to report the missing manifest, got %v", err)
+	}
+
+	page, err := renderStoredFallback(context.Background(), valid.ID, "/api/og-image?id="+valid.ID)
+	if err != nil {
+		t.Fatalf("expected the worker to render the fallback: %v", err)
+	}
+	body := string(page.Body)
+	if !strings.Contains(body, "Quarterly Report") || strings.Contains(body, "<script") || strings.Contains(body, "onclick") {
+		t.Errorf("unexpected fallback from worker:\n%s", body)
+	}
+}
+
+func TestConversionJobs(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	jobScheduler = jobs.New(jobs.Config{Workers: 1})
+	defer func() {
+		jobScheduler.Close()
+		documentStore, jobScheduler = nil, nil
+	}()
+
+	var chart bytes.Buffer
+	png.Encode(&chart, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackageWithFiles(t, map[string][]byte{
+		"content/static/fallback.html": []byte(`<h1>Quarterly Report</h1><p>Revenue grew.</p><img src="../images/chart.png" alt="Chart">`),
+		"content/images/chart.png":     chart.Bytes(),
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, target, body, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		handleJobs(rr, req)
+		return rr
+	}
+	export := func(format string) jobResponse {
+		rr := request("POST", "/api/jobs", `{"document": "`+info.ID+`", "format": "`+format+`"}`, "203.0.113.7:4000")
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("expected the %s export to be queued, got %v: %s", format, rr.Code, rr.Body.String())
+		}
+		var job jobResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil || rr.Header().Get("Location") != "/api/jobs/"+job.ID {
+			t.Fatalf("unexpected job %s: %v", rr.Body.String(), err)
+		}
+		for deadline := time.Now().Add(10 * time.Second); !job.State.Finished(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s export did not finish", format)
+			}
+			rr = request("GET", "/api/jobs/"+job.ID, "", "203.0.113.7:4001")
+			json.Unmarshal(rr.Body.Bytes(), &job)
+		}
+		if job.State != jobs.StateSucceeded || job.ResultURL == "" || job.Labels["format"] != format {
+			t.Fatalf("expected the %s export to succeed, got %+v", format, job)
+		}
+		return job
+	}
+
+	markdown := export("markdown")
+	rr := request("GET", markdown.ResultURL, "", "203.0.113.7:4000")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "# Quarterly Report") || !strings.Contains(rr.Header().Get("Content-Disposition"), "report.md") {
+		t.Errorf("unexpected Markdown export %v %v:\n%s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	if sum := sha256.Sum256(rr.Body.Bytes()); rr.Header().Get("ETag") != `"`+hex.EncodeToString(sum[:])+`"` {
+		t.Errorf("expected a strong ETag on the export, got %q", rr.Header().Get("ETag"))
+	}
+	if rr := request("GET", export("pdf").ResultURL, "", "203.0.113.7:4000"); !strings.HasPrefix(rr.Body.String(), "%PDF") {
+		t.Errorf("expected a PDF export, got %q", rr.Body.String())
+	}
+	if rr := request("GET", export("html").ResultURL, "", "203.0.113.7:4000"); !strings.Contains(rr.Body.String(), "data:image/png;base64,") {
+		t.Errorf("expected an HTML export with embedded images, got:\n%s", rr.Body.String())
+	}
+
+	// Jobs are private to whoever submitted them
+	if rr := request("GET", markdown.ResultURL, "", "198.51.100.1:4000"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected other clients not to see the job, got %v", rr.Code)
+	}
+	rr = request("GET", "/api/jobs", "", "203.0.113.7:4000")
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), `"state":"succeeded"`) != 3 {
+		t.Errorf("unexpected job list %v: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"document": "` + info.ID + `", "format": "docx"}`, http.StatusBadRequest},
+		{`{"document": "missing", "format": "pdf"}`, http.StatusNotFound},
+		{`{"document": "` + info.ID + `", "format": "pdf", "priority": "high"}`, http.StatusForbidden},
+	} {
+		if rr := request("POST", "/api/jobs", tt.body, "203.0.113.7:4000"); rr.Code != tt.code {
+			t.Errorf("expected %v for %s, got %v: %s", tt.code, tt.body, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := request("GET", "/api/jobs/metrics", "", "203.0.113.7:4000"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected remote clients to be refused metrics, got %v", rr.Code)
+	}
+	rr = request("GET", "/api/jobs/metrics", "", "127.0.0.1:4000")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"succeeded":3`) {
+		t.Errorf("unexpected metrics %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// expiringContext runs out of time when told to
+type expiringContext struct {
+	context.Context
+	expired bool
+}
+
+func (c *expiringContext) Err() error {
+	if c.expired {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestExportBudgets(t *testing.T) {
+	// Noise does not compress, so the image is large in any form
+	noise := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	rand.New(rand.NewSource(1)).Read(noise.Pix)
+	var chart bytes.Buffer
+	png.Encode(&chart, noise)
+	content := `<h1>Quarterly Report</h1><p>Revenue grew.</p><img src="../images/chart.png" alt="Chart"><p>Costs fell.</p><p>Outlook</p>`
+	data := createTestPackageWithFiles(t, map[string][]byte{
+		"content/static/fallback.html": []byte(content),
+		"content/images/chart.png":     chart.Bytes(),
+	})
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Markdown stops between blocks when the time runs out and keeps the
+	// blocks converted so far
+	ctx := &expiringContext{Context: context.Background()}
+	b := newExportBudget(ctx, time.Minute, 0)
+	b.onCommit = func([]byte) error {
+		ctx.expired = b.kept > len("# Quarterly Report")
+		return nil
+	}
+	err = exportPackage(reader, "doc", "markdown", b)
+	var budget *jobs.BudgetError
+	if !errors.As(err, &budget) || budget.Resource != jobs.ResourceTime || budget.Stage != stageMarkdown || budget.Limit != "1m0s" || budget.Hint == "" {
+		t.Fatalf("expected the time budget error, got %v", err)
+	}
+	if partial := string(b.committed()); partial != "# Quarterly Report\n\nRevenue grew." {
+		t.Errorf("unexpected partial Markdown %q", partial)
+	}
+	marked := string(markIncomplete("markdown", b.committed(), budget))
+	if !strings.HasSuffix(marked, "> **Incomplete export:** "+budget.Error()+"\n") {
+		t.Errorf("expected a note on the partial Markdown, got %q", marked)
+	}
+
+	// The image does not fit the memory budget, so the PDF stops before the
+	// block after it and the HTML links it instead of embedding it
+	for _, format := range []string{"pdf", "html"} {
+		b = newExportBudget(context.Background(), 0, 64<<10)
+		err = exportPackage(reader, "doc", format, b)
+		if !errors.As(err, &budget) || budget.Resource != jobs.ResourceMemory || budget.Limit != "64 KB" {
+			t.Fatalf("expected the %s export to exceed its memory budget, got %v", format, err)
+		}
+		output := string(b.committed())
+		switch format {
+		case "pdf":
+			if budget.Stage != stageLayout || !strings.HasPrefix(output, "%PDF") || !strings.Contains(output, "%%EOF") {
+				t.Errorf("expected a partial PDF, got stage %q and %d bytes", budget.Stage, len(output))
+			}
+		case "html":
+			if budget.Stage != stageImages || strings.Contains(output, "data:image/png") || !strings.Contains(output, "Outlook") {
+				t.Errorf("expected the full page with linked images, got:\n%s", output)
+			}
+		}
+	}
+	if err := exportPackage(reader, "doc", "markdown", newExportBudget(context.Background(), 0, 64<<10)); err != nil {
+		t.Errorf("expected Markdown to fit the budget: %v", err)
+	}
+
+	// Through the jobs API, a sandboxed worker reports the breach and the
+	// partial output is served marked as such
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	workerSandbox = sandbox.New(sandbox.Limits{Timeout: 30 * time.Second}, t.TempDir())
+	jobScheduler = jobs.New(jobs.Config{Workers: 1})
+	exportMemory = 64 << 10
+	defer func() {
+		jobScheduler.Close()
+		documentStore, workerSandbox, jobScheduler, exportMemory = nil, nil, nil, 0
+	}()
+	info, err := docStore.Put("report.liv", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(`{"document": "`+info.ID+`", "format": "pdf"}`))
+	req.RemoteAddr = "203.0.113.7:4000"
+	rr := httptest.NewRecorder()
+	handleJobs(rr, req)
+	var job jobResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil || rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the export to be queued, got %v: %s", rr.Code, rr.Body.String())
+	}
+	for deadline := time.Now().Add(10 * time.Second); !job.State.Finished(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("export did not finish")
+		}
+		req := httptest.NewRequest("GET", "/api/jobs/"+job.ID, nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		rr = httptest.NewRecorder()
+		handleJobs(rr, req)
+		json.Unmarshal(rr.Body.Bytes(), &job)
+	}
+	if job.State != jobs.StateFailed || !job.Partial || job.Budget == nil || job.Budget.Resource != jobs.ResourceMemory || job.Budget.Stage != stageLayout || job.ResultURL == "" {
+		t.Fatalf("expected a partial export stopped by the memory budget, got %s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", job.ResultURL, nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	rr = httptest.NewRecorder()
+	handleJobs(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "%PDF") || !strings.Contains(rr.Header().Get("Content-Disposition"), "report.partial.pdf") || !strings.Contains(rr.Header().Get("X-Export-Incomplete"), "memory budget") {
+		t.Errorf("unexpected partial result %v %v", rr.Code, rr.Header())
+	}
+}
+
+// signTestPackage signs a package with key and applies change to its files
+// afterwards, e.g. to tamper with the signed content
+func signTestPackage(t *testing.T, data []byte, key crypto.Signer, change func(files map[string][]byte)) []byte {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range reader.File {
+		if files[file.Name], err = readZipEntry(reader, file.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := manifest.NewManifestParser().ParseFromBytes(files["manifest.json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := integrity.NewSignatureManager()
+	document := &core.LIVDocument{
+		Manifest:    m,
+		Content:     &core.DocumentContent{HTML: string(files["content/index.html"])},
+		WASMModules: map[string][]byte{},
+	}
+	signatures, err := sm.SignDocument(document, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures.Signer = &core.SignerInfo{Name: "ACME Corp", KeyID: sm.KeyID(key.Public())}
+	for path, data := range container.SignatureFiles(signatures) {
+		files[path] = data
+	}
+	if change != nil {
+		change(files)
+	}
+
+	livPath := filepath.Join(t.TempDir(), "signed.liv")
+	if err := container.NewZIPContainer().CreateFromFiles(files, livPath); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := os.ReadFile(livPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyDocument(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore, trustedKeys = nil, nil }()
+
+	sm := integrity.NewSignatureManager()
+	trusted, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "trusted.pem")
+	if err := sm.SaveSigningKeyPairPEM(trusted, filepath.Join(t.TempDir(), "private.pem"), keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if trustedKeys, err = loadTrustedKeys([]string{keyFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := createTestPackage(t)
+	tamper := func(files map[string][]byte) {
+		files["content/index.html"] = []byte("<h1>Forged</h1>")
+	}
+	tests := []struct {
+		name   string
+		data   []byte
+		status string
+	}{
+		{"unsigned", unsigned, trustUnsigned},
+		{"trusted", signTestPackage(t, unsigned, trusted.PrivateKey, nil), trustVerified},
+		{"untrusted", signTestPackage(t, unsigned, other.PrivateKey, nil), trustUntrusted},
+		{"tampered", signTestPackage(t, unsigned, trusted.PrivateKey, tamper), trustTampered},
+	}
+	for _, test := range tests {
+		info, err := docStore.Put(test.name+".liv", bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handleVerify(rr, httptest.NewRequest("GET", "/api/verify?id="+info.ID, nil))
+		var response verifyResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected response %v: %s", test.name, rr.Code, rr.Body.String())
+		}
+		if response.Status != test.status {
+			t.Errorf("%s: expected status %s, got %s (%v)", test.name, test.status, response.Status, response.Errors)
+		}
+	}
+
+	// A signer whose clock is an hour ahead is reported, but still verified
+	future := signTestPackage(t, unsigned, trusted.PrivateKey, func(files map[string][]byte) {
+		signer := core.SignerInfo{Name: "ACME Corp", KeyID: sm.KeyID(trusted.PublicKey), SignedAt: time.Now().Add(time.Hour)}
+		files[container.SignersEntry], _ = json.Marshal(map[string]interface{}{"signer": signer})
+	})
+	info, err := docStore.Put("future.liv", bytes.NewReader(future))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handleVerify(rr, httptest.NewRequest("GET", "/api/verify?id="+info.ID, nil))
+	var response verifyResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Status != trustVerified || len(response.Warnings) != 1 || !strings.Contains(response.Warnings[0], "signing time") {
+		t.Errorf("expected a verified document with a warning for the signing time, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleVerify(rr, httptest.NewRequest("GET", "/api/verify?id="+strings.Repeat("0", 32), nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown documents to be missing, got %v", rr.Code)
+	}
+}
+
+func TestHandleLibrary(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleLibrary(rr, httptest.NewRequest("GET", "/api/library", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"documents":[]`) {
+		t.Fatalf("expected an empty inventory without a store, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	packageData := createTestPackage(t)
+	info, err := docStore.Put("report.liv", bytes.NewReader(packageData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := docStore.Put("annex.liv", bytes.NewReader(packageData)); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	handleLibrary(rr, httptest.NewRequest("GET", "/api/library", nil))
+	var inventory libraryInventory
+	if err := json.Unmarshal(rr.Body.Bytes(), &inventory); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	if len(inventory.Documents) != 2 || inventory.Documents[0].Filename != "annex.liv" {
+		t.Fatalf("expected both documents sorted by filename, got %+v", inventory.Documents)
+	}
+	if doc := inventory.Documents[1]; doc.ID != info.ID || doc.SHA256 != info.SHA256 || doc.Size != int64(len(packageData)) {
+		t.Errorf("unexpected inventory entry: %+v", doc)
+	}
+
+	rr = httptest.NewRecorder()
+	handleLibrary(rr, httptest.NewRequest("POST", "/api/library", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to be refused, got %v", rr.Code)
+	}
+}
+
+func TestLibraryFilters(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	put := func(filename string, edit func(m *core.Manifest)) string {
+		t.Helper()
+		info, err := docStore.Put(filename, bytes.NewReader(createTestPackageWithManifest(t, nil, edit)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ID
+	}
+	tagged := put("tagged.liv", func(m *core.Manifest) {
+		m.Metadata.Title = "Quarterly figures"
+		m.Metadata.Keywords = []string{"Leadership", "finance"}
+		m.Metadata.Subjects = []*core.SubjectInfo{{Scheme: core.SubjectSchemeBISAC, Code: "BUS071000", Label: "BUSINESS & ECONOMICS / Leadership"}}
+	})
+	put("titled.liv", func(m *core.Manifest) {
+		m.Metadata.Title = "On leadership"
+		m.Metadata.Subjects = []*core.SubjectInfo{{Scheme: core.SubjectSchemeDDC, Code: "658.4"}}
+	})
+	put("plain.liv", nil)
+
+	list := func(query string) []libraryDocument {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleLibrary(rr, httptest.NewRequest("GET", "/api/library?"+query, nil))
+		var inventory libraryInventory
+		if err := json.Unmarshal(rr.Body.Bytes(), &inventory); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+		}
+		return inventory.Documents
+	}
+	filenames := func(documents []libraryDocument) string {
+		var names []string
+		for _, document := range documents {
+			names = append(names, document.Filename)
+		}
+		return strings.Join(names, ",")
+	}
+
+	all := list("")
+	if filenames(all) != "plain.liv,tagged.liv,titled.liv" || len(all[1].Keywords) != 2 || all[1].Subjects[0].Code != "BUS071000" {
+		t.Errorf("expected every document with its keywords and subjects, got %+v", all)
+	}
+	if got := filenames(list("keyword=leadership")); got != "tagged.liv" {
+		t.Errorf("expected the keyword filter to match regardless of case, got %s", got)
+	}
+	if got := filenames(list("subject=bus07")); got != "tagged.liv" {
+		t.Errorf("expected the subject filter to match BISAC codes by prefix, got %s", got)
+	}
+	if got := filenames(list("subject=658")); got != "titled.liv" {
+		t.Errorf("expected the subject filter to match DDC classes, got %s", got)
+	}
+	// Tagged documents rank above those that only mention the term
+	if results := list("q=leadership"); filenames(results) != "tagged.liv,titled.liv" || results[0].Score <= results[1].Score {
+		t.Errorf("expected the tagged document first, got %+v", results)
+	}
+
+	// Search engines read the keywords and subjects from the static page
+	req := httptest.NewRequest("GET", "/viewer?id="+tagged, nil)
+	req.Header.Set("User-Agent", "Googlebot")
+	rr := httptest.NewRecorder()
+	handleViewer(rr, req)
+	for _, tag := range []string{
+		`<meta name="keywords" content="Leadership, finance, BUSINESS &amp; ECONOMICS / Leadership"/>`,
+		`<meta name="DC.subject" content="BUSINESS &amp; ECONOMICS / Leadership"/>`,
+	} {
+		if !strings.Contains(rr.Body.String(), tag) {
+			t.Errorf("static page missing %s:\n%s", tag, rr.Body.String())
+		}
+	}
+}
+
+func TestContentPolicy(t *testing.T) {
+	static := &core.SecurityPolicy{
+		JSPermissions:         &core.JSPermissions{ExecutionMode: "none"},
+		ContentSecurityPolicy: "default-src 'none'; img-src 'self' https://cdn.example.com; style-src 'self'; report-uri https://collect.example.com",
+	}
+	policy, err := newContentPolicy(static)
+	if err != nil {
+		t.Fatalf("newContentPolicy failed: %v", err)
+	}
+	for _, want := range []string{"script-src 'none'", "img-src 'self';", "connect-src 'none'", "frame-ancestors 'self'", "object-src 'none'"} {
+		if !strings.Contains(policy.CSP, want) {
+			t.Errorf("expected CSP to contain %q, got %q", want, policy.CSP)
+		}
+	}
+	if strings.Contains(policy.CSP, "report-uri") || !strings.HasSuffix(policy.CSP, "; sandbox") || policy.Sandbox != "" {
+		t.Errorf("expected reporting removed and content fully sandboxed, got %+v", policy)
+	}
+
+	interactive := &core.SecurityPolicy{
+		JSPermissions:         &core.JSPermissions{ExecutionMode: "sandboxed"},
+		NetworkPolicy:         &core.NetworkPolicy{AllowOutbound: true, AllowedHosts: []string{"api.example.com"}},
+		ContentSecurityPolicy: "default-src 'self'; img-src https://api.example.com https://tracker.example.com",
+	}
+	if policy, err = newContentPolicy(interactive); err != nil {
+		t.Fatalf("newContentPolicy failed: %v", err)
+	}
+	if policy.Sandbox != "allow-scripts" || !strings.Contains(policy.CSP, "img-src https://api.example.com;") ||
+		!strings.Contains(policy.CSP, "connect-src https://api.example.com") || !strings.Contains(policy.CSP, "sandbox allow-scripts") {
+		t.Errorf("unexpected policy for sandboxed scripts: %+v", policy)
+	}
+
+	for name, unsatisfiable := range map[string]*core.SecurityPolicy{
+		"missing": nil,
+		"trusted": {JSPermissions: &core.JSPermissions{ExecutionMode: "trusted"}},
+		"storage": {JSPermissions: &core.JSPermissions{ExecutionMode: "sandboxed"}, StoragePolicy: &core.StoragePolicy{AllowLocalStorage: true}},
+		"unknown": {ContentSecurityPolicy: "default-src 'self'; plugin-types application/pdf"},
+		"invalid": {ContentSecurityPolicy: "default-src 'self' \"x\""},
+	} {
+		var policyErr *policyError
+		if _, err := newContentPolicy(unsatisfiable); !errors.As(err, &policyErr) {
+			t.Errorf("expected %s policy to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestServeDocumentContent(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+info.ID, nil))
+	var metadata documentMetadata
+	if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	if metadata.ContentURL != contentURL(info.ID) || metadata.ContentPolicy == nil || metadata.ContentPolicy.Sandbox != "" {
+		t.Fatalf("expected a fully sandboxed content url, got %+v", metadata)
+	}
+
+	rr = httptest.NewRecorder()
+	handleContent(rr, httptest.NewRequest("GET", metadata.ContentURL, nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "<h1>Stored</h1>" {
+		t.Fatalf("unexpected content %v: %s", rr.Code, rr.Body.String())
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); csp != metadata.ContentPolicy.CSP {
+		t.Errorf("expected content to be served with its CSP, got %q", csp)
+	}
+	if rr.Header().Get("X-Frame-Options") != "SAMEORIGIN" || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("unexpected headers: %v", rr.Header())
+	}
+	for _, path := range []string{"/api/content/" + info.ID + "/manifest.json", "/api/content/" + info.ID + "/content/../manifest.json"} {
+		rr = httptest.NewRecorder()
+		handleContent(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be refused, got %v", path, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+info.ID, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Frame-Options") != "SAMEORIGIN" ||
+		!strings.Contains(rr.Header().Get("Content-Security-Policy"), "frame-ancestors 'self'") {
+		t.Errorf("expected the viewer to refuse framing by other sites, got %v: %v", rr.Code, rr.Header())
+	}
+
+	// A document asking for more than the viewer grants is not rendered
+	trusted, err := docStore.Put("trusted.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, func(m *core.Manifest) {
+		m.Security.JSPermissions.ExecutionMode = "trusted"
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/viewer?id=" + trusted.ID, "/api/document?id=" + trusted.ID, contentURL(trusted.ID)} {
+		rr = httptest.NewRecorder()
+		switch {
+		case strings.HasPrefix(path, "/viewer"):
+			handleViewer(rr, httptest.NewRequest("GET", path, nil))
+		case strings.HasPrefix(path, "/api/document"):
+			handleDocument(rr, httptest.NewRequest("GET", path, nil))
+		default:
+			handleContent(rr, httptest.NewRequest("GET", path, nil))
+		}
+		if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "cannot be satisfied") {
+			t.Errorf("expected %s to be refused, got %v: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestServeAssetVariants(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"assets/photo.png":       []byte("full"),
+		"assets/photo-480w.png":  []byte("480"),
+		"assets/photo-960w.png":  []byte("960"),
+		"assets/sales.json":      []byte("standard"),
+		"assets/sales.low.json":  []byte("low"),
+		"assets/sales.high.json": []byte("high"),
+	}, func(m *core.Manifest) {
+		m.Resources["assets/photo.png"].Variants = []*core.ResourceVariant{
+			{Path: "assets/photo-480w.png", Width: 480}, {Path: "assets/photo-960w.png", Width: 960},
+		}
+		m.Resources["assets/sales.json"].Variants = []*core.ResourceVariant{
+			{Path: "assets/sales.low.json", Quality: "low"}, {Path: "assets/sales.high.json", Quality: "high"},
+		}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/assets/photo.png", "full"},
+		{"/~1x_400w/assets/photo.png", "480"},
+		{"/~2x_400w_4g/assets/photo.png", "960"},
+		{"/~2x_400w_2g/assets/photo.png", "480"},
+		{"/~2x_1280w/assets/photo.png", "full"},
+		{"/~1x_400w_3g/assets/sales.json", "low"},
+		{"/~1x_400w_4g/assets/sales.json", "high"},
+		{"/~1x_400w_4g_save/assets/sales.json", "low"},
+		{"/~1x_400w_2g/assets/photo-960w.png", "960"},
+		{"/~2x_400w/content/index.html", "<h1>Stored</h1>"},
+	}
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		handleContent(rr, httptest.NewRequest("GET", "/api/content/"+info.ID+test.path, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != test.want {
+			t.Errorf("%s: expected %q, got %v: %s", test.path, test.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handleContent(rr, httptest.NewRequest("GET", "/api/content/"+info.ID+"/~5g/assets/photo.png", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid profile to be refused, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+info.ID, nil))
+	if !strings.Contains(rr.Body.String(), "/static/js/liv-assets.js") || !strings.Contains(rr.Body.String(), "LIVAssets.contentURL(") {
+		t.Error("expected the viewer to describe the device in content urls")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleCapabilities(rr, httptest.NewRequest("GET", "/api/capabilities", nil))
+	var response capabilitiesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	if response.Viewer.FormatVersion != "1.0" || !response.Viewer.Supports("webassembly") || response.Negotiation != nil {
+		t.Errorf("expected the viewer to advertise its capabilities only, got %+v", response)
+	}
+
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	compatible, err := docStore.Put("report.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, err := docStore.Put("newer.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, func(m *core.Manifest) {
+		m.Requirements = &core.ViewerRequirements{MinFormatVersion: "1.1", Features: []string{"3d-scenes"}}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	handleCapabilities(rr, httptest.NewRequest("GET", "/api/capabilities?id="+compatible.ID, nil))
+	response = capabilitiesResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Negotiation == nil || !response.Negotiation.Compatible {
+		t.Errorf("expected the document to be compatible, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleCapabilities(rr, httptest.NewRequest("GET", "/api/capabilities?id="+newer.ID, nil))
+	response = capabilitiesResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Negotiation == nil {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	negotiation := response.Negotiation
+	if negotiation.Compatible || len(negotiation.Mismatches) != 2 || negotiation.Mismatches[1].Requirement != "feature:3d-scenes" {
+		t.Errorf("expected the format version and feature to be missing, got %+v", negotiation)
+	}
+	if strings.Join(negotiation.Remedies, ",") != "update_viewer,open_fallback" || response.FallbackURL != "/viewer?id="+newer.ID+"&static=1" {
+		t.Errorf("expected an update and the static version to be offered, got %+v", response)
+	}
+
+	rr = httptest.NewRecorder()
+	handleCapabilities(rr, httptest.NewRequest("GET", "/api/capabilities?id=missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected a missing document to be reported, got %v", rr.Code)
+	}
+}
+
+func TestAccessPolicy(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err := access.NewCounter(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore, accessCounter = docStore, counter
+	defer func() { documentStore, accessCounter = nil, nil }()
+
+	closes := time.Now().AddDate(0, 0, 1)
+	limited, err := docStore.Put("limited.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, func(m *core.Manifest) {
+		m.Access = &core.AccessPolicy{NotAfter: &closes, MaxOpens: 1, Watermark: &core.WatermarkPolicy{Text: "Licensed to {reader}"}}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().AddDate(0, 0, -1)
+	past, err := docStore.Put("past.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, func(m *core.Manifest) {
+		m.Access = &core.AccessPolicy{NotAfter: &expired}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, err := docStore.Put("open.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := requireAccess(handleResource)
+
+	// Content is granted only after the document is opened
+	rr := httptest.NewRecorder()
+	content(rr, httptest.NewRequest("GET", "/api/resource?id="+limited.ID+"&path=content/index.html", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected content to be refused before opening, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleAccess(rr, httptest.NewRequest("POST", "/api/access?id="+limited.ID, nil))
+	var response accessResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	if response.Opens != 1 || response.MaxOpens != 1 || response.Watermark != "Licensed to 192.0.2.1" {
+		t.Errorf("unexpected access response %+v", response)
+	}
+
+	rr = httptest.NewRecorder()
+	content(rr, httptest.NewRequest("GET", "/api/resource?id="+limited.ID+"&path=content/index.html", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected content to be granted after opening, got %v: %s", rr.Code, rr.Body.String())
+	}
+	other := httptest.NewRequest("GET", "/api/resource?id="+limited.ID+"&path=content/index.html", nil)
+	other.RemoteAddr = "198.51.100.7:1234"
+	rr = httptest.NewRecorder()
+	content(rr, other)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected the grant to be the reader's own, got %v", rr.Code)
+	}
+
+	// The limit is per reader
+	var denied accessDeniedResponse
+	rr = httptest.NewRecorder()
+	handleAccess(rr, httptest.NewRequest("POST", "/api/access?id="+limited.ID, nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &denied); err != nil || rr.Code != http.StatusForbidden || denied.Reason != "open_limit" {
+		t.Errorf("expected the second open to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleAccess(rr, httptest.NewRequest("POST", "/api/access?id="+past.ID, nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &denied); err != nil || rr.Code != http.StatusForbidden || denied.Reason != "expired" {
+		t.Errorf("expected the expired document to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	content(rr, httptest.NewRequest("GET", "/api/resource?id="+past.ID+"&path=content/index.html", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected the content of the expired document to be refused, got %v", rr.Code)
+	}
+
+	// Nor can previews or exports of it be had
+	for _, preview := range []http.HandlerFunc{requireAccess(handleThumbnail), requireAccess(handleOGImage)} {
+		rr = httptest.NewRecorder()
+		preview(rr, httptest.NewRequest("GET", "/api/thumbnail?id="+past.ID, nil))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected the preview of the expired document to be refused, got %v", rr.Code)
+		}
+	}
+	jobScheduler = jobs.New(jobs.Config{Workers: 1})
+	defer func() {
+		jobScheduler.Close()
+		jobScheduler = nil
+	}()
+	for _, document := range []string{past.ID, limited.ID} {
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(`{"document": "`+document+`", "format": "pdf"}`))
+		req.RemoteAddr = other.RemoteAddr
+		rr = httptest.NewRecorder()
+		handleJobs(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected the export of %s to be refused, got %v: %s", document, rr.Code, rr.Body.String())
+		}
+	}
+
+	// A document whose policy cannot be read is refused rather than served
+	broken, err := docStore.Put("broken.liv", bytes.NewReader([]byte("not a package")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	content(rr, httptest.NewRequest("GET", "/api/resource?id="+broken.ID+"&path=content/index.html", nil))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected an unreadable document to be refused, got %v", rr.Code)
+	}
+
+	// Documents without a policy are unaffected
+	rr = httptest.NewRecorder()
+	handleAccess(rr, httptest.NewRequest("POST", "/api/access?id="+open.ID, nil))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected no policy to be reported, got %v", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	content(rr, httptest.NewRequest("GET", "/api/resource?id="+open.ID+"&path=content/index.html", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected content without a policy to be served, got %v", rr.Code)
+	}
+
+	// Nor can the static fallback show the content
+	rr = httptest.NewRecorder()
+	handleStaticFallback(rr, httptest.NewRequest("GET", "/viewer?id="+limited.ID+"&static=1", nil), limited.ID)
+	if !strings.Contains(rr.Body.String(), "Access to this document is restricted") {
+		t.Errorf("expected the static fallback to withhold the content, got %s", rr.Body.String())
+	}
+}
+
+func TestDocumentModules(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	module := []byte("\x00asm\x01\x00\x00\x00")
+	packageData := createTestPackageWithManifest(t, map[string][]byte{"wasm/engine.wasm": module}, func(m *core.Manifest) {
+		m.WASMConfig = &core.WASMConfiguration{
+			Modules:     map[string]*core.WASMModule{"engine": {Name: "engine", Version: "1.0.0", EntryPoint: "main"}},
+			Permissions: m.Security.WASMPermissions,
+			MemoryLimit: 1 << 20,
+		}
+	})
+	info, err := docStore.Put("report.liv", bytes.NewReader(packageData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+info.ID, nil))
+	var metadata documentMetadata
+	if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	hash := sha256.Sum256(module)
+	if len(metadata.WASMModules) != 1 || metadata.WASMModules[0].SHA256 != hex.EncodeToString(hash[:]) {
+		t.Fatalf("expected the declared module with its hash, got %+v", metadata.WASMModules)
+	}
+
+	// The module is fetched from its url for compilation in the browser
+	rr = httptest.NewRecorder()
+	handleDocumentResource(rr, httptest.NewRequest("GET", metadata.WASMModules[0].URL, nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), module) {
+		t.Errorf("expected the module bytes from %s, got %v", metadata.WASMModules[0].URL, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+info.ID, nil))
+	if !strings.Contains(rr.Body.String(), "/static/js/liv-wasm-cache.js") || !strings.Contains(rr.Body.String(), "LIVWasmCache.warm(") {
+		t.Error("expected the viewer to warm up document modules while loading")
+	}
+}
+
+func TestActivityRuntime(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	spec := []byte(`{"activity": {"keep_running": ["#clock"]}}`)
+	static, err := docStore.Put("static.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scripted, err := docStore.Put("scripted.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/interactive.json": spec,
+	}, func(m *core.Manifest) {
+		m.Security.JSPermissions.ExecutionMode = "sandboxed"
+		m.Resources["content/interactive.json"].Type = "application/json"
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleContent(rr, httptest.NewRequest("GET", "/api/content/"+scripted.ID+"/content/index.html", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != `<script src="/static/js/liv-runtime.js"></script><h1>Stored</h1>` {
+		t.Errorf("expected scripted content to load the activity runtime, got %v: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	handleContent(rr, httptest.NewRequest("GET", "/api/content/"+static.ID+"/content/index.html", nil))
+	if rr.Body.String() != "<h1>Stored</h1>" {
+		t.Errorf("expected content without scripts to be served as stored, got %s", rr.Body.String())
+	}
+	page := injectActivityRuntime([]byte(`<html><HEAD lang="en"><title>T</title></head></html>`))
+	if string(page) != `<html><HEAD lang="en"><script src="/static/js/liv-runtime.js"></script><title>T</title></head></html>` {
+		t.Errorf("expected the runtime first in the head, got %s", page)
+	}
+
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+scripted.ID, nil))
+	var metadata documentMetadata
+	if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	if metadata.Activity == nil || len(metadata.Activity.KeepRunning) != 1 || metadata.Activity.KeepRunning[0] != "#clock" {
+		t.Errorf("expected the activity section of the interactive spec, got %+v", metadata.Activity)
+	}
+
+	if _, ok := readStaticAsset("js/liv-runtime.js"); !ok {
+		t.Error("expected the activity runtime to be served")
+	}
+	rr = httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+scripted.ID, nil))
+	if !strings.Contains(rr.Body.String(), "/static/js/liv-activity.js") || !strings.Contains(rr.Body.String(), "LIVActivity.attach(frame)") {
+		t.Error("expected the viewer to signal activity to the content frame")
+	}
+	if _, ok := readStaticAsset("js/liv-find.js"); !ok || !strings.Contains(rr.Body.String(), `id="findBar"`) || !strings.Contains(rr.Body.String(), "LIVFind.attach(renderer.element)") {
+		t.Error("expected the viewer to search the content frame through the runtime")
+	}
+}
+
+func TestEventsExport(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	spec := []byte(`{"events": {"name": "Summit programme", "items": [
+		{"id": "keynote", "title": "Keynote", "start": "2025-05-01T09:00:00Z", "end": "2025-05-01T10:00:00Z", "location": "Hall A"},
+		{"id": "party", "title": "Closing party", "start": "2025-05-02"}
+	]}}`)
+	programme, err := docStore.Put("programme.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/interactive.json": spec,
+	}, func(m *core.Manifest) {
+		m.Resources["content/interactive.json"].Type = "application/json"
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := docStore.Put("plain.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metadata documentMetadata
+	rr := httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+programme.ID, nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil || metadata.Events == nil || len(metadata.Events.Items) != 2 {
+		t.Fatalf("expected the events in the metadata, got %s", rr.Body.String())
+	}
+	if metadata.Events.CalendarURL != "/api/events?id="+programme.ID {
+		t.Errorf("unexpected calendar URL %q", metadata.Events.CalendarURL)
+	}
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+plain.ID, nil))
+	if strings.Contains(rr.Body.String(), `"events"`) {
+		t.Errorf("expected no events for a document without them, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleEvents(rr, httptest.NewRequest("GET", metadata.Events.CalendarURL, nil))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("unexpected response %v %v: %s", rr.Code, rr.Header(), body)
+	}
+	if rr.Header().Get("Content-Disposition") != `attachment; filename="Summit programme.ics"` {
+		t.Errorf("unexpected disposition %q", rr.Header().Get("Content-Disposition"))
+	}
+	if strings.Count(body, "BEGIN:VEVENT") != 2 || !strings.Contains(body, "DTSTART:20250501T090000Z") || !strings.Contains(body, "DTSTART;VALUE=DATE:20250502") {
+		t.Errorf("unexpected calendar:\n%s", body)
+	}
+
+	rr = httptest.NewRecorder()
+	handleEvents(rr, httptest.NewRequest("GET", metadata.Events.CalendarURL+"&event=keynote", nil))
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), "BEGIN:VEVENT") != 1 || !strings.Contains(rr.Body.String(), "SUMMARY:Keynote") {
+		t.Errorf("expected just the keynote, got %v:\n%s", rr.Code, rr.Body.String())
+	}
+	// UIDs stay the same for a new upload of the document
+	uid := regexp.MustCompile(`UID:keynote@[0-9a-f]{16}\.liv`).FindString(rr.Body.String())
+	again, err := docStore.Put("programme.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/interactive.json": spec,
+	}, func(m *core.Manifest) {
+		m.Resources["content/interactive.json"].Type = "application/json"
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handleEvents(rr, httptest.NewRequest("GET", "/api/events?id="+again.ID+"&event=keynote", nil))
+	if uid == "" || !strings.Contains(rr.Body.String(), uid) {
+		t.Errorf("expected event UIDs to be stable across uploads, got %q and:\n%s", uid, rr.Body.String())
+	}
+
+	for _, target := range []string{"/api/events?id=" + programme.ID + "&event=missing", "/api/events?id=" + plain.ID, "/api/events?id=" + strings.Repeat("0", 32)} {
+		rr = httptest.NewRecorder()
+		handleEvents(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected %s to be missing, got %v", target, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+programme.ID, nil))
+	if !strings.Contains(rr.Body.String(), "/static/js/liv-events.js") || !strings.Contains(rr.Body.String(), "LIVEvents.configure(documentData.events)") {
+		t.Error("expected the viewer to show the events of documents")
+	}
+}
+
+func TestDocumentAuthors(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	paper, err := docStore.Put("paper.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/static/fallback.html": []byte("<html><head></head><body><h1>Paper</h1></body></html>"),
+	}, func(m *core.Manifest) {
+		m.Metadata.Author = "Carberry and Author"
+		m.Metadata.Authors = []*core.AuthorInfo{
+			{Name: "Josiah Carberry", Affiliation: "Brown University", Email: "josiah@example.edu", ORCID: "0000-0002-1825-0097"},
+			{Name: "Ada Author", Role: "editor"},
+		}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := docStore.Put("plain.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metadata documentMetadata
+	rr := httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+paper.ID, nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil || len(metadata.Authors) != 2 {
+		t.Fatalf("expected the authors in the metadata, got %s", rr.Body.String())
+	}
+	first := metadata.Authors[0]
+	if first.Affiliation != "Brown University" || first.ORCIDURL != "https://orcid.org/0000-0002-1825-0097" {
+		t.Errorf("unexpected author %+v", first.AuthorInfo)
+	}
+	rr = httptest.NewRecorder()
+	handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+plain.ID, nil))
+	if strings.Contains(rr.Body.String(), `"authors"`) {
+		t.Errorf("expected no authors for a document with only a byline, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleAuthors(rr, httptest.NewRequest("GET", first.VCardURL, nil))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/vcard; charset=utf-8" {
+		t.Fatalf("unexpected response %v %v: %s", rr.Code, rr.Header(), body)
+	}
+	if rr.Header().Get("Content-Disposition") != `attachment; filename="Josiah Carberry.vcf"` {
+		t.Errorf("unexpected disposition %q", rr.Header().Get("Content-Disposition"))
+	}
+	if strings.Count(body, "BEGIN:VCARD") != 1 || !strings.Contains(body, "UID:https://orcid.org/0000-0002-1825-0097") {
+		t.Errorf("expected Josiah Carberry's card, got:\n%s", body)
+	}
+
+	rr = httptest.NewRecorder()
+	handleAuthors(rr, httptest.NewRequest("GET", "/api/authors?id="+paper.ID, nil))
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), "BEGIN:VCARD") != 2 {
+		t.Errorf("expected both authors' cards, got %v:\n%s", rr.Code, rr.Body.String())
+	}
+	for _, target := range []string{"/api/authors?id=" + paper.ID + "&author=2", "/api/authors?id=" + plain.ID, "/api/authors?id=missing"} {
+		rr = httptest.NewRecorder()
+		handleAuthors(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected %s to be missing, got %v", target, rr.Code)
+		}
+	}
+
+	// Academic search engines read the authors from the static page
+	req := httptest.NewRequest("GET", "/viewer?id="+paper.ID, nil)
+	req.Header.Set("User-Agent", "Googlebot-Scholar")
+	rr = httptest.NewRecorder()
+	handleViewer(rr, req)
+	for _, tag := range []string{
+		`<meta name="DC.creator" content="Josiah Carberry"/>`,
+		`<meta name="DC.creator" content="Ada Author"/>`,
+		`<meta name="citation_author_institution" content="Brown University"/>`,
+		`<meta name="citation_author_orcid" content="https://orcid.org/0000-0002-1825-0097"/>`,
+	} {
+		if !strings.Contains(rr.Body.String(), tag) {
+			t.Errorf("static page missing %s:\n%s", tag, rr.Body.String())
+		}
+	}
+}
+
+func TestGraphicsDegradation(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	plain, err := docStore.Put("plain.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	webgl, err := docStore.Put("webgl.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/interactive.json": []byte(`{"graphics": {"webgl2": true, "fallback": "snapshot", "snapshot": "assets/snapshot.png"}}`),
+	}, func(m *core.Manifest) {
+		m.Features.WebGL = true
+		m.Resources["content/interactive.json"].Type = "application/json"
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	undeclared, err := docStore.Put("undeclared.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, func(m *core.Manifest) {
+		m.Features.WebGL = true
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graphicsOf := func(id string) *documentGraphics {
+		rr := httptest.NewRecorder()
+		handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+id, nil))
+		var metadata documentMetadata
+		if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil {
+			t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+		}
+		return metadata.Graphics
+	}
+	if graphics := graphicsOf(plain.ID); graphics != nil {
+		t.Errorf("expected no graphics section without WebGL, got %+v", graphics)
+	}
+	if graphics := graphicsOf(webgl.ID); graphics == nil || !graphics.WebGL2 || graphics.SnapshotURL != "/api/content/"+webgl.ID+"/assets/snapshot.png" {
+		t.Errorf("expected the declared graphics section, got %+v", graphics)
+	}
+	if graphics := graphicsOf(undeclared.ID); graphics == nil || graphics.SnapshotURL != "/viewer?id="+undeclared.ID+"&static=1" {
+		t.Errorf("expected the static version as the fallback, got %+v", graphics)
+	}
+
+	report := func(body string) int {
+		rr := httptest.NewRecorder()
+		handleRenderingUsage(rr, httptest.NewRequest("POST", "/api/usage/rendering", strings.NewReader(body)))
+		return rr.Code
+	}
+	if code := report(`{"document": "` + webgl.ID + `", "path": "snapshot", "reason": "no_webgl2"}`); code != http.StatusNoContent {
+		t.Fatalf("expected the rendering report to be recorded, got %d", code)
+	}
+	if code := report(`{"document": "` + webgl.ID + `", "path": "webgl"}`); code != http.StatusNoContent {
+		t.Fatalf("expected the rendering report to be recorded, got %d", code)
+	}
+	if code := report(`{"document": "` + webgl.ID + `", "path": "video"}`); code != http.StatusBadRequest {
+		t.Errorf("expected an unknown path to be refused, got %d", code)
+	}
+
+	rr := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/api/usage", nil)
+	request.RemoteAddr = "127.0.0.1:1234"
+	handleUsage(rr, request)
+	var usage usageReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+	var counts *documentRendering
+	for _, document := range usage.Documents {
+		if document.Document == webgl.ID {
+			counts = document
+		}
+	}
+	if counts == nil || counts.Paths["snapshot"] != 1 || counts.Paths["webgl"] != 1 || counts.Reasons["no_webgl2"] != 1 {
+		t.Errorf("expected the rendering paths in the usage report, got %+v", counts)
+	}
+	request = httptest.NewRequest("GET", "/api/usage", nil)
+	request.RemoteAddr = "203.0.113.9:1234"
+	rr = httptest.NewRecorder()
+	handleUsage(rr, request)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected remote clients to be refused the usage report, got %d", rr.Code)
+	}
+}
+
+func TestContentLinksPrintStylesheet(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	printed, err := docStore.Put("printed.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/styles/print.css": []byte("@page { size: A5; }"),
+	}, func(m *core.Manifest) {
+		m.Resources["content/styles/print.css"].Type = "text/css"
+		m.Print = &core.PrintSettings{PageSize: "A5", Stylesheet: "content/styles/print.css"}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleContent(rr, httptest.NewRequest("GET", "/api/content/"+printed.ID+"/content/index.html", nil))
+	link := `<link rel="stylesheet" media="print" href="/api/content/` + printed.ID + `/content/styles/print.css">`
+	if rr.Code != http.StatusOK || rr.Body.String() != link+"<h1>Stored</h1>" {
+		t.Errorf("expected the print stylesheet to be linked, got %v: %s", rr.Code, rr.Body.String())
+	}
+	page := injectPrintStylesheet([]byte(`<head><link rel="stylesheet" href="styles/print.css" media="print"></head>`), "/api/content/x/content/styles/print.css")
+	if bytes.Count(page, []byte("print.css")) != 1 {
+		t.Errorf("expected a page linking its print stylesheet to be left alone, got %s", page)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	upload := func(data []byte) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("document", "report.liv")
+		part.Write(data)
+		form.Close()
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rr := httptest.NewRecorder()
+		handleUpload(rr, req)
+		return rr.Code
+	}
+	views, downloads := serverMetrics.DocumentsServed.Value("view"), serverMetrics.DocumentsServed.Value("download")
+	failures, uploads := serverMetrics.ValidationFailures.Value("invalid_package"), serverMetrics.UploadSize.Count()
+
+	if code := upload([]byte("not a zip")); code != http.StatusBadRequest {
+		t.Fatalf("expected the invalid package to be rejected, got %v", code)
+	}
+	if code := upload(createTestPackage(t)); code != http.StatusOK {
+		t.Fatalf("upload failed: %v", code)
+	}
+	infos, _ := docStore.List()
+	id := infos[0].ID
+	handleDocument(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/document?id="+id, nil))
+	handleDocument(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/document?id="+id+"&download=true", nil))
+	resumed := httptest.NewRequest("GET", "/api/document?id="+id+"&download=true", nil)
+	resumed.Header.Set("Range", "bytes=10-")
+	handleDocument(httptest.NewRecorder(), resumed)
+
+	if serverMetrics.DocumentsServed.Value("view") != views+1 || serverMetrics.DocumentsServed.Value("download") != downloads+1 {
+		t.Errorf("expected one view and one download to be counted")
+	}
+	if serverMetrics.ValidationFailures.Value("invalid_package") != failures+1 || serverMetrics.UploadSize.Count() != uploads+1 {
+		t.Errorf("expected one failed and one accepted upload to be counted")
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	handleMetrics(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected remote scrapes without the health token to be refused, got %v", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "127.0.0.1:4000"
+	handleMetrics(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `liv_documents_served_total{mode="view"}`) {
+		t.Errorf("unexpected metrics: %v %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "viewer.log")
+	previous := log.Default()
+	logger, err := log.Setup(log.Config{Output: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		logger.Close()
+		log.SetDefault(previous)
+	}()
+
+	handler := withLogFields(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.InfoContext(r.Context(), "Served")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/content/doc-1/index.html", nil)
+	req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Username: "alice"}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/library", nil))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got:\n%s", data)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "Served" || record[log.UserID] != "alice" || record[log.DocumentID] != "doc-1" {
+		t.Errorf("Expected the user and document of the request, got %v", record)
+	}
+	if strings.Contains(lines[1], log.UserID) || strings.Contains(lines[1], log.DocumentID) {
+		t.Errorf("Expected no request fields for an anonymous library request, got %s", lines[1])
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleThumbnail(rr, httptest.NewRequest("GET", "/api/thumbnail?id="+info.ID+"&width=120", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected thumbnail, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("unexpected content type: %q", contentType)
+	}
+	thumbnail, err := png.Decode(bytes.NewReader(rr.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("thumbnail is not a PNG: %v", err)
+	}
+	if thumbnail.Bounds().Dx() != 120 || thumbnail.Bounds().Dy() != 160 {
+		t.Errorf("unexpected thumbnail size %v", thumbnail.Bounds())
+	}
+	if thumbnailImages.get(info.SHA256+"@120x160.png") == nil {
+		t.Errorf("expected the rendered thumbnail to be cached")
+	}
+
+	req := httptest.NewRequest("GET", "/api/thumbnail?id="+info.ID+"&width=120", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	handleThumbnail(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %v", rr.Code)
+	}
+
+	// Browsers that accept WebP get it when no format is asked for
+	req = httptest.NewRequest("GET", "/api/thumbnail?id="+info.ID, nil)
+	req.Header.Set("Accept", "image/avif,image/webp,*/*")
+	rr = httptest.NewRecorder()
+	handleThumbnail(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/webp" || !bytes.HasPrefix(rr.Body.Bytes(), []byte("RIFF")) {
+		t.Errorf("expected a WebP thumbnail, got %v %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if rr.Header().Get("Vary") != "Accept" {
+		t.Errorf("expected the response to vary by Accept")
+	}
+
+	for _, query := range []string{"width=abc", "width=4", "width=100&height=900", "format=gif"} {
+		rr = httptest.NewRecorder()
+		handleThumbnail(rr, httptest.NewRequest("GET", "/api/thumbnail?id="+info.ID+"&"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be refused, got %v", query, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handleThumbnail(rr, httptest.NewRequest("GET", "/api/thumbnail?id=0123456789abcdef0123456789abcdef", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown document to be missing, got %v", rr.Code)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	media := bytes.Repeat([]byte("unchanged media "), 4096)
+	oldPackage := createTestPackageWithFiles(t, map[string][]byte{"assets/media/intro.bin": media})
+	newPackage := createTestPackageWithFiles(t, map[string][]byte{"assets/media/intro.bin": media, "content/notes.html": []byte("<p>Added</p>")})
+	info, err := docStore.Put("report.liv", bytes.NewReader(oldPackage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, _ := zip.NewReader(bytes.NewReader(oldPackage), int64(len(oldPackage)))
+	target, _ := zip.NewReader(bytes.NewReader(newPackage), int64(len(newPackage)))
+	var patch bytes.Buffer
+	if _, err := delta.Diff(base, target, &patch); err != nil {
+		t.Fatal(err)
+	}
+	if patch.Len() > len(media)/2 {
+		t.Errorf("expected the unchanged media to be left out of the patch")
+	}
+
+	// Nobody can be held to a patch without sign-in
+	rr := httptest.NewRecorder()
+	handlePatch(rr, httptest.NewRequest("POST", "/api/patch?id="+info.ID, bytes.NewReader(patch.Bytes())))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected patches to be refused without sign-in, got %v", rr.Code)
+	}
+	authenticator = &auth.Authenticator{}
+	defer func() { authenticator = nil }()
+
+	// Patching a document makes a copy of it, so its access policy applies
+	expired := time.Now().AddDate(0, 0, -1)
+	restricted, err := docStore.Put("restricted.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, func(m *core.Manifest) {
+		m.Access = &core.AccessPolicy{NotAfter: &expired}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	requireAccess(handlePatch)(rr, httptest.NewRequest("POST", "/api/patch?id="+restricted.ID, bytes.NewReader(patch.Bytes())))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected a document the author may not read to be refused, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handlePatch(rr, httptest.NewRequest("POST", "/api/patch?id="+info.ID, bytes.NewReader(patch.Bytes())))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the patch to apply, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var patched struct {
+		ID       string `json:"id"`
+		Filename string `json:"filename"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &patched); err != nil {
+		t.Fatal(err)
+	}
+	if patched.ID == info.ID || patched.Filename != "report.liv" {
+		t.Errorf("expected the patched document to be stored as a new upload: %+v", patched)
+	}
+	doc, reader, err := openStoredPackage(patched.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+	if data, err := readZipEntry(reader, "content/notes.html"); err != nil || string(data) != "<p>Added</p>" {
+		t.Errorf("expected the patched document to have the added page: %q %v", data, err)
+	}
+
+	// The patch no longer applies to the version it produced
+	rr = httptest.NewRecorder()
+	handlePatch(rr, httptest.NewRequest("POST", "/api/patch?id="+patched.ID, bytes.NewReader(patch.Bytes())))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected a patch for another version to conflict, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handlePatch(rr, httptest.NewRequest("POST", "/api/patch?id="+info.ID, strings.NewReader("not a patch")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid patch to be refused, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handlePatch(rr, httptest.NewRequest("POST", "/api/patch?id=0123456789abcdef0123456789abcdef", bytes.NewReader(patch.Bytes())))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown document to be missing, got %v", rr.Code)
+	}
+}
+
+func TestContentDrawsCharts(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	charted, err := docStore.Put("charted.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/index.html": []byte(`<h1>Stored</h1><div id="sales"></div><canvas id="live"></canvas>`),
+		"content/interactive.json": []byte(`{"data": [{"id": "sales", "values": [{"quarter": "Q1", "total": 10}]}],
+			"charts": [{"id": "sales", "type": "bar", "target": "#sales", "data": "sales"}, {"id": "live", "type": "line", "target": "#live", "data": "sales"}]}`),
+	}, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleContent(rr, httptest.NewRequest("GET", "/api/content/"+charted.ID+"/content/index.html", nil))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, `<div id="sales"><div class="liv-chart"><svg xmlns="http://www.w3.org/2000/svg"`) {
+		t.Errorf("expected the chart drawn in its element, got %v: %s", rr.Code, body)
+	}
+	if !strings.HasSuffix(body, `<canvas id="live"></canvas>`) {
+		t.Errorf("expected the canvas chart left to the document's scripts, got %s", body)
+	}
+}
+
+func TestHandleData(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	schema := &core.DataSchema{Fields: []*core.DataField{{Name: "region", Type: "string", Required: true}, {Name: "units", Type: "integer"}}}
+	stored, err := docStore.Put("sales.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"assets/data/sales.csv":  []byte("region,units\nNorth,12\n,3\nSouth,\n"),
+		"assets/data/hidden.csv": []byte("secret\n42\n"),
+	}, func(m *core.Manifest) {
+		m.Data = map[string]*core.DataAsset{"sales": {Path: "assets/data/sales.csv", Schema: schema}}
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handleData(rr, httptest.NewRequest("GET", "/api/data/"+stored.ID+"/sales", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the data served, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var served dataRows
+	if err := json.Unmarshal(rr.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	// The row without a region does not follow the schema
+	if served.Name != "sales" || len(served.Schema.Fields) != 2 || len(served.Rows) != 2 ||
+		served.Rows[0]["region"] != "North" || served.Rows[0]["units"] != 12.0 || served.Rows[1]["region"] != "South" {
+		t.Errorf("unexpected data: %+v", served)
+	}
+
+	// Only declared data is served
+	for _, path := range []string{"/api/data/" + stored.ID + "/hidden", "/api/data/" + stored.ID + "/assets%2Fdata%2Fhidden.csv", "/api/data/missing/sales"} {
+		rr = httptest.NewRecorder()
+		handleData(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected %s not to be served, got %v", path, rr.Code)
+		}
+	}
+
+	listed := documentDatasets(&core.Manifest{Data: map[string]*core.DataAsset{"sales": {Path: "assets/data/sales.parquet", Schema: schema}}}, stored.ID)
+	if len(listed) != 1 || listed[0].Format != "parquet" || listed[0].URL != "/api/data/"+stored.ID+"/sales" {
+		t.Errorf("unexpected data listing: %+v", listed)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := annotations.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore, annotationStore = docStore, notes
+	defer func() { documentStore, annotationStore, annotationKey, trustedKeys = nil, nil, nil, nil }()
+
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, path, body string, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path+"?id="+info.ID, strings.NewReader(body))
+		if user != "" {
+			req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Username: user, Name: strings.ToUpper(user)}))
+		}
+		rr := httptest.NewRecorder()
+		handleAnnotations(rr, req)
+		return rr
+	}
+
+	rr := request("POST", "/api/annotations", `{"kind":"highlight","target":"content/index.html","quote":{"exact":"Stored"},"author":"mallory"}`, "alice")
+	var added annotations.Annotation
+	if err := json.Unmarshal(rr.Body.Bytes(), &added); err != nil || rr.Code != http.StatusCreated {
+		t.Fatalf("expected the annotation to be added, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if added.Author != "alice" || added.ID == "" {
+		t.Errorf("expected the annotation to be made by the signed-in reader: %+v", added)
+	}
+	if rr := request("POST", "/api/annotations", `{"kind":"note","target":"content/index.html"}`, "alice"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected an invalid annotation to be refused, got %v", rr.Code)
+	}
+
+	change := `{"kind":"highlight","target":"content/index.html","quote":{"exact":"Stored"},"text":"Check"}`
+	if rr := request("PUT", "/api/annotations/"+added.ID, change, "bob"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected other readers to be refused changes, got %v", rr.Code)
+	}
+	if rr := request("DELETE", "/api/annotations/"+added.ID, "", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected anonymous readers to be refused removal, got %v", rr.Code)
+	}
+	if rr := request("PUT", "/api/annotations/"+added.ID, change, "alice"); rr.Code != http.StatusOK {
+		t.Errorf("expected the author to change the annotation, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = request("GET", "/api/annotations", "", "")
+	var listed annotationsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil || len(listed.Annotations) != 1 || listed.Annotations[0].Text != "Check" {
+		t.Fatalf("expected the changed annotation listed, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = request("GET", "/api/annotations/export", "", "")
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "report"+annotations.SidecarExtension) {
+		t.Errorf("expected a sidecar named after the document, got %q", rr.Header().Get("Content-Disposition"))
+	}
+	sidecar, err := annotations.ParseSidecar(rr.Body.Bytes())
+	if err != nil || sidecar.Document.SHA256 != info.SHA256 || len(sidecar.Annotations) != 1 {
+		t.Fatalf("expected the sidecar of the document, got %+v, %v", sidecar, err)
+	}
+
+	sm := integrity.NewSignatureManager()
+	keys, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotationKey, trustedKeys = keys.PrivateKey, []crypto.PublicKey{keys.PublicKey}
+	rr = request("POST", "/api/annotations/embed", "", "alice")
+	var revision struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &revision); err != nil || rr.Code != http.StatusOK || revision.ID == info.ID {
+		t.Fatalf("expected a new revision to be stored, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleAnnotations(rr, httptest.NewRequest("GET", "/api/annotations?id="+revision.ID, nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil || len(listed.Embedded) != 1 || len(listed.Annotations) != 0 || !listed.SignsRevisions {
+		t.Errorf("expected the revision to embed the annotations, got %s", rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	handleVerify(rr, httptest.NewRequest("GET", "/api/verify?id="+revision.ID, nil))
+	var verified verifyResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &verified); err != nil || verified.Status != trustVerified {
+		t.Errorf("expected the revision to be signed with the annotation key, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleAnnotations(rr, httptest.NewRequest("GET", "/api/annotations?id="+strings.Repeat("0", 32), nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected unknown documents to be missing, got %v", rr.Code)
+	}
+}
+
+func TestReadingState(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, err := readingstate.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore, readingStateStore = docStore, states
+	defer func() { documentStore, readingStateStore = nil, nil }()
+
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, readingStatePath+"?id="+info.ID, strings.NewReader(body))
+		if user != "" {
+			req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Username: user}))
+		}
+		rr := httptest.NewRecorder()
+		handleReadingState(rr, req)
+		return rr
+	}
+
+	if rr := request("GET", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected anonymous readers to keep their state in the browser, got %v", rr.Code)
+	}
+	state := `{"bookmarks":[{"label":"Results","page":"content/index.html","fragment":"results","scroll":0.5}],"last":{"page":"content/index.html","scroll":0.25}}`
+	rr := request("PUT", state, "alice")
+	var saved readingstate.State
+	if err := json.Unmarshal(rr.Body.Bytes(), &saved); err != nil || rr.Code != http.StatusOK || len(saved.Bookmarks) != 1 || saved.Bookmarks[0].ID == "" {
+		t.Fatalf("expected the state to be saved, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := request("PUT", `{"last":{"page":"content/index.html","scroll":2}}`, "alice"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected an invalid state to be refused, got %v", rr.Code)
+	}
+
+	rr = request("GET", "", "alice")
+	var loaded readingstate.State
+	if err := json.Unmarshal(rr.Body.Bytes(), &loaded); err != nil || len(loaded.Bookmarks) != 1 || loaded.Bookmarks[0].Fragment != "results" || loaded.Last == nil || loaded.Last.Scroll != 0.25 {
+		t.Errorf("expected the saved state, got %v: %s", rr.Code, rr.Body.String())
+	}
+	rr = request("GET", "", "bob")
+	if err := json.Unmarshal(rr.Body.Bytes(), &loaded); err != nil || len(loaded.Bookmarks) != 0 {
+		t.Errorf("expected readers to have their own state, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+info.ID, nil))
+	if !strings.Contains(rr.Body.String(), "/static/js/liv-navigation.js") || !strings.Contains(rr.Body.String(), "LIVNavigation.attach(frame)") {
+		t.Error("expected the viewer to follow navigation in the content frame")
+	}
+}
+
+func TestSections(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackageWithManifest(t, map[string][]byte{
+		"content/index.html":    []byte(`<h1 id="overview">Overview</h1><section id="results"><h2>Results</h2></section>`),
+		"content/appendix.html": []byte(`<h1 id="appendix">Appendix</h1><h2 id="methods">Methods used</h2>`),
+	}, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleSections(rr, httptest.NewRequest("GET", sectionsPath+"?id="+info.ID+query, nil))
+		return rr
+	}
+
+	rr := request("")
+	var list []pageSections
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 2 || list[0].Page != "content/index.html" ||
+		len(list[0].Sections) != 2 || list[0].Sections[1].ID != "results" || list[1].Sections[1].Title != "Methods used" {
+		t.Fatalf("expected the sections of both pages, index first, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	resolved := map[string]sectionTarget{
+		"&section=results":                             {Page: "content/index.html", ID: "results", Title: "Results"},
+		"&section=methods":                             {Page: "content/appendix.html", ID: "methods", Title: "Methods used"},
+		"&section=Methods%20Used":                      {Page: "content/appendix.html", ID: "methods", Title: "Methods used"},
+		"&section=appendix&page=content/appendix.html": {Page: "content/appendix.html", ID: "appendix", Title: "Appendix"},
+	}
+	for query, want := range resolved {
+		rr := request(query)
+		var target sectionTarget
+		if err := json.Unmarshal(rr.Body.Bytes(), &target); err != nil || target != want {
+			t.Errorf("%s: expected %+v, got %v: %s", query, want, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := request("&section=conclusions"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected a missing section to be reported, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleContent(rr, httptest.NewRequest("GET", "/api/content/"+info.ID+"/content/index.html", nil))
+	if !strings.HasPrefix(rr.Body.String(), `<link rel="stylesheet" href="`+sectionsStylesheetPath+`">`) {
+		t.Errorf("expected pages with sections to highlight the one linked, got %s", rr.Body.String())
+	}
+	if _, ok := readStaticAsset("css/liv-sections.css"); !ok {
+		t.Error("expected the sections stylesheet to be served")
+	}
+	rr = httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+info.ID+"&section=results", nil))
+	if !strings.Contains(rr.Body.String(), "/static/js/liv-sections.js") || !strings.Contains(rr.Body.String(), `id="sectionLink"`) {
+		t.Error("expected the viewer to open section links and copy them")
+	}
+	if _, ok := readStaticAsset("js/liv-outline.js"); !ok || !strings.Contains(rr.Body.String(), `id="outlinePanel"`) || !strings.Contains(rr.Body.String(), "LIVOutline.attach(frame") {
+		t.Error("expected the viewer to show the outline of the document")
+	}
+}
+
+func TestZoomPageSize(t *testing.T) {
+	docStore, err := store.NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documentStore = docStore
+	defer func() { documentStore = nil }()
+
+	document := func(edit func(*core.Manifest)) documentMetadata {
+		t.Helper()
+		info, err := docStore.Put("report.liv", bytes.NewReader(createTestPackageWithManifest(t, nil, edit)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handleDocument(rr, httptest.NewRequest("GET", "/api/document?id="+info.ID, nil))
+		var metadata documentMetadata
+		if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil {
+			t.Fatalf("unexpected response %v: %s", rr.Code, rr.Body.String())
+		}
+		return metadata
+	}
+
+	if metadata := document(nil); metadata.Page != nil {
+		t.Errorf("expected documents without print settings to reflow, got %+v", metadata.Page)
+	}
+	metadata := document(func(m *core.Manifest) {
+		m.Print = &core.PrintSettings{PageSize: "Letter", Orientation: "landscape"}
+	})
+	if metadata.Page == nil || metadata.Page.Width != 1056 || metadata.Page.Height != 816 {
+		t.Errorf("expected a landscape letter page of 1056x816 pixels, got %+v", metadata.Page)
+	}
+
+	rr := httptest.NewRecorder()
+	handleViewer(rr, httptest.NewRequest("GET", "/viewer?id="+metadata.ID, nil))
+	if _, ok := readStaticAsset("js/liv-zoom.js"); !ok || !strings.Contains(rr.Body.String(), `data-zoom-mode="fit-page"`) || !strings.Contains(rr.Body.String(), "LIVZoom.configure(") {
+		t.Error("expected the viewer to offer the zoom modes")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/auth"
+	"github.com/liv-format/liv/pkg/security"
+	"github.com/liv-format/liv/pkg/viewing"
+)
+
+// viewingConfig configures how many documents a viewer may have open at once
+type viewingConfig struct {
+	PolicyFile string
+	PerUser    int
+	PerIP      int
+}
+
+// viewingTracker enforces the open document limits; nil when unlimited
+var viewingTracker *viewing.Tracker
+
+// startViewingLimits creates the tracker for the configured limits. Limits
+// given as flags override those of the policy file.
+func startViewingLimits(config viewingConfig) (*viewing.Tracker, error) {
+	var limits viewing.Limits
+	if config.PolicyFile != "" {
+		policy, err := loadSecurityPolicy(config.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		limits = viewing.LimitsFromPolicy(policy, 0)
+	}
+	if config.PerUser > 0 {
+		limits.PerUser = config.PerUser
+	}
+	if config.PerIP > 0 {
+		limits.PerIP = config.PerIP
+	}
+	if limits.PerUser <= 0 && limits.PerIP <= 0 {
+		return nil, nil
+	}
+	return viewing.NewTracker(limits), nil
+}
+
+// loadSecurityPolicy reads a system security policy from a JSON file
+func loadSecurityPolicy(path string) (*security.SystemSecurityPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %v", err)
+	}
+	var policy security.SystemSecurityPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %v", path, err)
+	}
+	if policy.ResourceLimits == nil {
+		return nil, fmt.Errorf("policy %s has no resource_limits", path)
+	}
+	if policy.ResourceLimits.MaxConcurrentDocuments < 0 {
+		return nil, fmt.Errorf("policy %s: max concurrent documents cannot be negative", path)
+	}
+	return &policy, nil
+}
+
+// viewerOf identifies who a request counts against: the signed-in user, or
+// the client address for anonymous viewers
+func viewerOf(r *http.Request) (user, ip string) {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		user = id.Username
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return user, ip
+}
+
+// viewingLease is the response to opening or renewing a document
+type viewingLease struct {
+	*viewing.Lease
+	RenewSeconds int `json:"renew_seconds"`
+}
+
+// openDocument describes a document already held open by the viewer
+type openDocument struct {
+	Document string    `json:"document"`
+	Opened   time.Time `json:"opened"`
+}
+
+// viewingLimitResponse explains why a document could not be opened
+type viewingLimitResponse struct {
+	Error      string         `json:"error"`
+	Scope      string         `json:"scope"`
+	Limit      int            `json:"limit"`
+	Open       []openDocument `json:"open"`
+	RetryAfter int            `json:"retry_after"`
+}
+
+// handleViewing manages viewing sessions:
+//
+//	POST /api/viewing              open a document ({"document": "..."})
+//	POST /api/viewing/{id}/renew   keep a document open
+//	POST /api/viewing/{id}/close   release a document
+//	GET  /api/viewing/metrics      viewing activity (health access required)
+func handleViewing(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/viewing"), "/")
+
+	if path == "metrics" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeHealth(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if viewingTracker == nil {
+			http.Error(w, "Viewing limits are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeViewingJSON(w, http.StatusOK, viewingTracker.Metrics())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if viewingTracker == nil {
+		// Viewers treat this as unlimited
+		http.NotFound(w, r)
+		return
+	}
+	user, ip := viewerOf(r)
+
+	if path == "" {
+		var request struct {
+			Document string `json:"document"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if len(request.Document) > 256 {
+			request.Document = request.Document[:256]
+		}
+		lease, err := viewingTracker.Open(user, ip, request.Document)
+		if err != nil {
+			writeViewingError(w, err)
+			return
+		}
+		writeViewingJSON(w, http.StatusCreated, newViewingLease(lease))
+		return
+	}
+
+	id, action, _ := strings.Cut(path, "/")
+	switch action {
+	case "renew":
+		lease, err := viewingTracker.Renew(id, user, ip)
+		if err != nil {
+			writeViewingError(w, err)
+			return
+		}
+		writeViewingJSON(w, http.StatusOK, newViewingLease(lease))
+	case "close":
+		if err := viewingTracker.Close(id, user, ip); err != nil {
+			writeViewingError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// requireViewing serves document content only to viewers holding an open
+// document, so the limits cannot be bypassed by fetching content directly
+func requireViewing(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !holdsOpenDocument(r) {
+			http.Error(w, "Open the document in the viewer first", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// holdsOpenDocument reports whether the viewer may access document content
+func holdsOpenDocument(r *http.Request) bool {
+	return viewingTracker == nil || len(viewingTracker.Held(viewerOf(r))) > 0
+}
+
+func newViewingLease(lease *viewing.Lease) viewingLease {
+	// Renew well before expiry so one lost request does not close the document
+	renew := int(viewingTracker.Limits().LeaseTTL.Seconds() / 3)
+	if renew < 1 {
+		renew = 1
+	}
+	return viewingLease{Lease: lease, RenewSeconds: renew}
+}
+
+func writeViewingError(w http.ResponseWriter, err error) {
+	var limitErr *viewing.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		retry := int(limitErr.RetryAfter(time.Now()).Seconds())
+		response := viewingLimitResponse{
+			Error:      limitErr.Error(),
+			Scope:      limitErr.Scope,
+			Limit:      limitErr.Limit,
+			RetryAfter: retry,
+		}
+		for _, lease := range limitErr.Open {
+			response.Open = append(response.Open, openDocument{Document: lease.Document, Opened: lease.Opened})
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		writeViewingJSON(w, http.StatusTooManyRequests, response)
+	case errors.Is(err, viewing.ErrUnknownLease):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeViewingJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
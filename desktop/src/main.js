@@ -3,9 +3,11 @@ const { autoUpdater } = require('electron-updater');
 const Store = require('electron-store');
 const path = require('path');
 const fs = require('fs');
+const { fileURLToPath } = require('url');
 const { spawn } = require('child_process');
 
 const goBackend = require('./go-backend');
+const { DocumentSession } = require('./session');
 
 // Initialize electron store for settings
 const store = new Store({
@@ -16,12 +18,17 @@ const store = new Store({
             theme: 'system',
             autoUpdate: true,
             fallbackMode: false,
-            debugMode: false
+            debugMode: false,
+            restoreSession: true
         }
     }
 });
 
+// The window in front; dialogs open over it
 let mainWindow;
+// Set once the app starts quitting, so closing windows keeps them in the session
+let quitting = false;
+const session = new DocumentSession(store);
 let viewerProcess;
 let viewerPort = 8080; // eslint-disable-line no-unused-vars
 // PDF operations moved to frontend LIV editor
@@ -38,12 +45,13 @@ if (process.env.NODE_ENV === 'development') {
     }
 }
 
-function createWindow() {
-    // Get saved window bounds
-    const bounds = store.get('windowBounds');
+// createWindow opens a document window, showing the document of state if
+// given at the bounds and position it was left at
+function createWindow(state = {}) {
+    const bounds = state.bounds || nextWindowBounds();
 
     // Create the browser window
-    mainWindow = new BrowserWindow({
+    const window = new BrowserWindow({
         width: bounds.width,
         height: bounds.height,
         x: bounds.x,
@@ -60,45 +68,102 @@ function createWindow() {
             allowRunningInsecureContent: false
         },
         titleBarStyle: process.platform === 'darwin' ? 'hiddenInset' : 'default',
+        // Document windows group as tabs on macOS
+        tabbingIdentifier: 'liv-documents',
         show: false // Don't show until ready
     });
+    const id = window.id;
+    session.open(id, state.filePath || null, window.getBounds());
 
     // Save window bounds when moved or resized
-    mainWindow.on('moved', saveWindowBounds);
-    mainWindow.on('resized', saveWindowBounds);
+    window.on('moved', () => saveWindowBounds(window));
+    window.on('resized', () => saveWindowBounds(window));
+
+    window.on('focus', () => {
+        mainWindow = window;
+    });
+
+    // The last window's document reopens next time, as do all of them on quit
+    window.on('close', () => {
+        session.close(id, quitting || session.windows.size === 1);
+    });
 
     // Handle window closed
-    mainWindow.on('closed', () => {
-        mainWindow = null;
-        stopViewerProcess();
+    window.on('closed', () => {
+        if (mainWindow === window) {
+            const remaining = [...session.windows.keys()]
+                .map(other => BrowserWindow.fromId(other))
+                .filter(other => other && other !== window && !other.isDestroyed());
+            mainWindow = remaining.pop() || null;
+        }
     });
 
     // Show window when ready
-    mainWindow.once('ready-to-show', () => {
-        mainWindow.show();
+    window.once('ready-to-show', () => {
+        window.show();
 
         // Focus window on creation
         if (process.platform === 'darwin') {
-            mainWindow.focus();
+            window.focus();
         }
     });
 
     // Handle external links
-    mainWindow.webContents.setWindowOpenHandler(({ url }) => {
+    window.webContents.setWindowOpenHandler(({ url }) => {
         shell.openExternal(url);
         return { action: 'deny' };
     });
 
+    // Documents dropped where the page does not take them would replace it
+    window.webContents.on('will-navigate', (event, url) => {
+        if (url.startsWith('file:')) {
+            event.preventDefault();
+            openDroppedFiles(window, [fileURLToPath(url)]);
+        }
+    });
+
     // Load main LIV Editor (Next.js frontend)
-    mainWindow.loadURL('http://localhost:3001/editor');
+    window.loadURL('http://localhost:3001/editor');
+    if (state.filePath) {
+        showDocument(window, state.filePath, state.position);
+    }
+
+    mainWindow = window;
 
     // Set up menu
     createMenu();
+    return window;
 }
 
-function saveWindowBounds() {
+// nextWindowBounds places a new window over the one in front, offset so
+// both can be seen
+function nextWindowBounds() {
+    const bounds = { ...store.get('windowBounds') };
     if (mainWindow && !mainWindow.isDestroyed()) {
-        store.set('windowBounds', mainWindow.getBounds());
+        const front = mainWindow.getBounds();
+        return { ...front, x: front.x + 24, y: front.y + 24 };
+    }
+    return bounds;
+}
+
+function saveWindowBounds(window) {
+    if (window && !window.isDestroyed()) {
+        const bounds = window.getBounds();
+        store.set('windowBounds', bounds);
+        session.setBounds(window.id, bounds);
+    }
+}
+
+// restoreSession reopens the documents open when the app last quit, or an
+// empty window when there are none or the preference is off
+function restoreSession() {
+    const documents = session.restorable();
+    if (documents.length === 0) {
+        createWindow();
+        return;
+    }
+    for (const state of documents) {
+        createWindow(state);
     }
 }
 
@@ -248,11 +313,21 @@ function createMenu() {
                     accelerator: 'CmdOrCtrl+N',
                     click: createNewDocument
                 },
+                {
+                    label: 'New Window',
+                    accelerator: 'CmdOrCtrl+Shift+N',
+                    click: () => createWindow()
+                },
                 { type: 'separator' },
                 {
                     label: 'Open...',
                     accelerator: 'CmdOrCtrl+O',
-                    click: openFile
+                    click: () => openFile()
+                },
+                {
+                    label: 'Open in New Window...',
+                    accelerator: 'CmdOrCtrl+Shift+O',
+                    click: () => openFile({ newWindow: true })
                 },
                 {
                     label: 'Open Recent',
@@ -262,9 +337,9 @@ function createMenu() {
                 {
                     label: 'Close',
                     accelerator: 'CmdOrCtrl+W',
-                    click: () => {
-                        if (mainWindow) {
-                            mainWindow.close();
+                    click: (item, window) => {
+                        if (window) {
+                            window.close();
                         }
                     }
                 }
@@ -276,27 +351,27 @@ function createMenu() {
                 {
                     label: 'Reload',
                     accelerator: 'CmdOrCtrl+R',
-                    click: () => {
-                        if (mainWindow) {
-                            mainWindow.reload();
+                    click: (item, window) => {
+                        if (window) {
+                            window.reload();
                         }
                     }
                 },
                 {
                     label: 'Force Reload',
                     accelerator: 'CmdOrCtrl+Shift+R',
-                    click: () => {
-                        if (mainWindow) {
-                            mainWindow.webContents.reloadIgnoringCache();
+                    click: (item, window) => {
+                        if (window) {
+                            window.webContents.reloadIgnoringCache();
                         }
                     }
                 },
                 {
                     label: 'Toggle Developer Tools',
                     accelerator: process.platform === 'darwin' ? 'Alt+Cmd+I' : 'Ctrl+Shift+I',
-                    click: () => {
-                        if (mainWindow) {
-                            mainWindow.webContents.toggleDevTools();
+                    click: (item, window) => {
+                        if (window) {
+                            window.webContents.toggleDevTools();
                         }
                     }
                 },
@@ -304,29 +379,29 @@ function createMenu() {
                 {
                     label: 'Actual Size',
                     accelerator: 'CmdOrCtrl+0',
-                    click: () => {
-                        if (mainWindow) {
-                            mainWindow.webContents.setZoomLevel(0);
+                    click: (item, window) => {
+                        if (window) {
+                            window.webContents.setZoomLevel(0);
                         }
                     }
                 },
                 {
                     label: 'Zoom In',
                     accelerator: 'CmdOrCtrl+Plus',
-                    click: () => {
-                        if (mainWindow) {
-                            const currentZoom = mainWindow.webContents.getZoomLevel();
-                            mainWindow.webContents.setZoomLevel(currentZoom + 0.5);
+                    click: (item, window) => {
+                        if (window) {
+                            const currentZoom = window.webContents.getZoomLevel();
+                            window.webContents.setZoomLevel(currentZoom + 0.5);
                         }
                     }
                 },
                 {
                     label: 'Zoom Out',
                     accelerator: 'CmdOrCtrl+-',
-                    click: () => {
-                        if (mainWindow) {
-                            const currentZoom = mainWindow.webContents.getZoomLevel();
-                            mainWindow.webContents.setZoomLevel(currentZoom - 0.5);
+                    click: (item, window) => {
+                        if (window) {
+                            const currentZoom = window.webContents.getZoomLevel();
+                            window.webContents.setZoomLevel(currentZoom - 0.5);
                         }
                     }
                 },
@@ -334,9 +409,9 @@ function createMenu() {
                 {
                     label: 'Toggle Fullscreen',
                     accelerator: process.platform === 'darwin' ? 'Ctrl+Cmd+F' : 'F11',
-                    click: () => {
-                        if (mainWindow) {
-                            mainWindow.setFullScreen(!mainWindow.isFullScreen());
+                    click: (item, window) => {
+                        if (window) {
+                            window.setFullScreen(!window.isFullScreen());
                         }
                     }
                 }
@@ -441,6 +516,9 @@ function createMenu() {
         template[4].submenu.shift(); // Remove About from Help menu
         template[2].submenu.shift(); // Remove Preferences from Tools menu
         template[2].submenu.shift(); // Remove separator
+
+        // Window menu with the tab commands, before Help
+        template.splice(template.length - 1, 0, { role: 'windowMenu' });
     } else {
     // Add Quit to File menu for non-macOS
         template[0].submenu.push(
@@ -593,7 +671,7 @@ function openEditor(filePath, documentType) {
     });
 }
 
-async function openFile() {
+async function openFile(options = {}) {
     const result = await dialog.showOpenDialog(mainWindow, {
         title: 'Open LIV Document',
         filters: [
@@ -604,11 +682,14 @@ async function openFile() {
     });
 
     if (!result.canceled && result.filePaths.length > 0) {
-        openFileByPath(result.filePaths[0]);
+        openFileByPath(result.filePaths[0], options);
     }
 }
 
-function openFileByPath(filePath) {
+// openFileByPath shows a document in the window it is opened from while that
+// window is empty, and in a new window otherwise. A document already open is
+// brought to the front instead.
+function openFileByPath(filePath, options = {}) {
     if (!fs.existsSync(filePath)) {
         dialog.showErrorBox('File Not Found', `The file "${filePath}" could not be found.`);
         return;
@@ -617,9 +698,48 @@ function openFileByPath(filePath) {
     // Add to recent files
     addToRecentFiles(filePath);
 
-    // Send file to the web viewer
-    if (mainWindow && !mainWindow.isDestroyed()) {
-        mainWindow.webContents.send('open-file', filePath);
+    const openIn = session.windowOf(filePath);
+    const existing = openIn !== undefined ? BrowserWindow.fromId(openIn) : null;
+    if (existing && !existing.isDestroyed()) {
+        if (existing.isMinimized()) {
+            existing.restore();
+        }
+        existing.focus();
+        return;
+    }
+
+    const window = options.window || mainWindow;
+    if (options.newWindow || !window || window.isDestroyed() || session.documentOf(window.id)) {
+        createWindow({ filePath });
+        return;
+    }
+    session.open(window.id, filePath);
+    showDocument(window, filePath);
+}
+
+// showDocument sends a document to a window's page once it has loaded, with
+// the position to return to if there is one
+function showDocument(window, filePath, position = null) {
+    const send = () => {
+        if (!window.isDestroyed()) {
+            window.webContents.send('open-file', filePath, position);
+        }
+    };
+    if (window.webContents.isLoading()) {
+        window.webContents.once('did-finish-load', send);
+    } else {
+        send();
+    }
+    if (process.platform === 'darwin') {
+        window.setRepresentedFilename(filePath);
+    }
+}
+
+// openDroppedFiles opens the documents among files dropped on a window
+function openDroppedFiles(window, filePaths) {
+    const documents = filePaths.filter(filePath => typeof filePath === 'string' && filePath.toLowerCase().endsWith('.liv'));
+    for (const filePath of documents) {
+        openFileByPath(filePath, { window });
     }
 }
 
@@ -726,7 +846,7 @@ app.whenReady().then(() => {
         callback({ path: filePath });
     });
 
-    createWindow();
+    restoreSession();
 
     // Auto updater setup
     if (store.get('preferences.autoUpdate', true)) {
@@ -734,6 +854,10 @@ app.whenReady().then(() => {
     }
 });
 
+app.on('before-quit', () => {
+    quitting = true;
+});
+
 app.on('window-all-closed', () => {
     stopViewerProcess();
     if (process.platform !== 'darwin') {
@@ -743,7 +867,7 @@ app.on('window-all-closed', () => {
 
 app.on('activate', () => {
     if (BrowserWindow.getAllWindows().length === 0) {
-        createWindow();
+        restoreSession();
     }
 });
 
@@ -1006,25 +1130,44 @@ ipcMain.on('quit-app', () => {
     app.quit();
 });
 
-ipcMain.on('minimize-window', () => {
-    if (mainWindow) {
-        mainWindow.minimize();
+ipcMain.on('minimize-window', (event) => {
+    const window = BrowserWindow.fromWebContents(event.sender);
+    if (window) {
+        window.minimize();
     }
 });
 
-ipcMain.on('maximize-window', () => {
-    if (mainWindow) {
-        if (mainWindow.isMaximized()) {
-            mainWindow.unmaximize();
+ipcMain.on('maximize-window', (event) => {
+    const window = BrowserWindow.fromWebContents(event.sender);
+    if (window) {
+        if (window.isMaximized()) {
+            window.unmaximize();
         } else {
-            mainWindow.maximize();
+            window.maximize();
         }
     }
 });
 
-ipcMain.on('close-window', () => {
-    if (mainWindow) {
-        mainWindow.close();
+ipcMain.on('close-window', (event) => {
+    const window = BrowserWindow.fromWebContents(event.sender);
+    if (window) {
+        window.close();
+    }
+});
+
+// Documents dropped on a window open in it or beside it
+ipcMain.on('open-dropped-files', (event, filePaths) => {
+    const window = BrowserWindow.fromWebContents(event.sender);
+    if (window && Array.isArray(filePaths)) {
+        openDroppedFiles(window, filePaths);
+    }
+});
+
+// Pages report where the reader is so the session can return there
+ipcMain.on('document-position', (event, position) => {
+    const window = BrowserWindow.fromWebContents(event.sender);
+    if (window) {
+        session.setPosition(window.id, position);
     }
 });
 
@@ -117,10 +117,15 @@ contextBridge.exposeInMainWorld('electronAPI', {
     // Get asset URL
     getAssetURL: (assetPath) => ipcRenderer.invoke('get-asset-url', assetPath),
 
+    // ===== Session =====
+    // Report where the reader is in the open document, to return there when
+    // the session is restored; any JSON value the page understands
+    reportDocumentPosition: (position) => ipcRenderer.send('document-position', position),
+
     // ===== Event Listeners =====
-    // File operations
+    // File operations; position is where to return to in a restored document
     onOpenFile: (callback) => {
-        const listener = (event, filePath) => callback(filePath);
+        const listener = (event, filePath, position) => callback(filePath, position);
         ipcRenderer.on('open-file', listener);
         return () => ipcRenderer.removeListener('open-file', listener);
     },
@@ -223,6 +228,28 @@ contextBridge.exposeInMainWorld('electronAPI', {
     electronVersion: process.versions.electron
 });
 
+// LIV documents dropped on the window open in it or in a new window; other
+// drops are left to the page
+function droppedDocuments(event) {
+    const files = event.dataTransfer ? Array.from(event.dataTransfer.files) : [];
+    return files.map(file => file.path).filter(filePath => filePath && filePath.toLowerCase().endsWith('.liv'));
+}
+
+window.addEventListener('dragover', (event) => {
+    if (event.dataTransfer && Array.from(event.dataTransfer.items || []).some(item => item.kind === 'file')) {
+        event.preventDefault();
+    }
+}, true);
+
+window.addEventListener('drop', (event) => {
+    const documents = droppedDocuments(event);
+    if (documents.length > 0) {
+        event.preventDefault();
+        event.stopPropagation();
+        ipcRenderer.send('open-dropped-files', documents);
+    }
+}, true);
+
 // Security: Remove Node.js globals from renderer process
 delete window.require;
 delete window.exports;
@@ -0,0 +1,139 @@
+/**
+ * Document Session
+ * Remembers the documents open in each window so they can be reopened
+ * where the reader left them on the next launch
+ */
+
+const fs = require('fs');
+
+// Documents beyond this many are not restored
+const MAX_DOCUMENTS = 20;
+// Positions larger than this, serialized, are not kept
+const MAX_POSITION_SIZE = 4096;
+
+class DocumentSession {
+    constructor(store, options = {}) {
+        this.store = store;
+        this.exists = options.exists || fs.existsSync;
+        // Open windows by id, in the order they were opened
+        this.windows = new Map();
+    }
+
+    /**
+   * Whether the last session is reopened on launch
+   */
+    get enabled() {
+        return this.store.get('preferences.restoreSession', true) !== false;
+    }
+
+    /**
+   * Documents of the last session that can be reopened, oldest first
+   */
+    restorable() {
+        if (!this.enabled) {
+            return [];
+        }
+        const saved = this.store.get('session.documents', []);
+        if (!Array.isArray(saved)) {
+            return [];
+        }
+        return saved
+            .filter(entry => entry && typeof entry.filePath === 'string' && this.exists(entry.filePath))
+            .slice(-MAX_DOCUMENTS);
+    }
+
+    /**
+   * Record a window and the document it shows, if any
+   */
+    open(id, filePath = null, bounds = null) {
+        const entry = this.windows.get(id) || {};
+        if (filePath !== entry.filePath) {
+            entry.position = null;
+        }
+        entry.filePath = filePath;
+        if (bounds) {
+            entry.bounds = bounds;
+        }
+        this.windows.set(id, entry);
+        this.save();
+    }
+
+    /**
+   * The document shown in a window, or null
+   */
+    documentOf(id) {
+        const entry = this.windows.get(id);
+        return entry ? entry.filePath : null;
+    }
+
+    /**
+   * The window showing a document, or undefined
+   */
+    windowOf(filePath) {
+        for (const [id, entry] of this.windows) {
+            if (entry.filePath === filePath) {
+                return id;
+            }
+        }
+        return undefined;
+    }
+
+    /**
+   * Keep where the reader is in a window's document. Positions are
+   * reported by the page and kept as they are, so they must serialize
+   * to JSON.
+   */
+    setPosition(id, position) {
+        const entry = this.windows.get(id);
+        if (!entry || !entry.filePath) {
+            return;
+        }
+        let serialized;
+        try {
+            serialized = JSON.stringify(position);
+        } catch (error) {
+            return;
+        }
+        if (serialized === undefined || serialized.length > MAX_POSITION_SIZE) {
+            return;
+        }
+        entry.position = JSON.parse(serialized);
+        this.save();
+    }
+
+    setBounds(id, bounds) {
+        const entry = this.windows.get(id);
+        if (entry) {
+            entry.bounds = bounds;
+            this.save();
+        }
+    }
+
+    /**
+   * Forget a closed window. With keep, as when the app quits or the last
+   * window closes, the saved session still lists its document so it
+   * reopens next time.
+   */
+    close(id, keep = false) {
+        this.windows.delete(id);
+        if (!keep) {
+            this.save();
+        }
+    }
+
+    save() {
+        const documents = [];
+        for (const entry of this.windows.values()) {
+            if (entry.filePath) {
+                documents.push({
+                    filePath: entry.filePath,
+                    bounds: entry.bounds || null,
+                    position: entry.position || null
+                });
+            }
+        }
+        this.store.set('session.documents', documents.slice(-MAX_DOCUMENTS));
+    }
+}
+
+module.exports = { DocumentSession };
@@ -0,0 +1,92 @@
+const { expect } = require('chai');
+const { DocumentSession } = require('../src/session');
+
+// A store like electron-store, with dotted keys
+function memoryStore(data = {}) {
+  return {
+    data,
+    get(key, fallback) {
+      const value = key.split('.').reduce((node, part) => (node == null ? undefined : node[part]), this.data);
+      return value === undefined ? fallback : value;
+    },
+    set(key, value) {
+      const parts = key.split('.');
+      const last = parts.pop();
+      const node = parts.reduce((parent, part) => (parent[part] = parent[part] || {}), this.data);
+      node[last] = value;
+    }
+  };
+}
+
+describe('Document Session', () => {
+  const exists = filePath => !filePath.includes('missing');
+
+  it('should save the documents open in windows', () => {
+    const store = memoryStore();
+    const session = new DocumentSession(store, { exists });
+
+    session.open(1, '/docs/report.liv', { x: 0, y: 0, width: 1200, height: 800 });
+    session.open(2);
+    session.setPosition(1, { section: 'outlook', scroll: 0.4 });
+
+    expect(store.get('session.documents')).to.deep.equal([
+      { filePath: '/docs/report.liv', bounds: { x: 0, y: 0, width: 1200, height: 800 }, position: { section: 'outlook', scroll: 0.4 } }
+    ]);
+    expect(session.windowOf('/docs/report.liv')).to.equal(1);
+    expect(session.documentOf(2)).to.be.null;
+  });
+
+  it('should start a document opened in a window at its beginning', () => {
+    const store = memoryStore();
+    const session = new DocumentSession(store, { exists });
+
+    session.open(1, '/docs/report.liv');
+    session.setPosition(1, { scroll: 0.9 });
+    session.open(1, '/docs/summary.liv');
+
+    expect(store.get('session.documents')[0]).to.include({ filePath: '/docs/summary.liv', position: null });
+  });
+
+  it('should keep the last window when it closes', () => {
+    const store = memoryStore();
+    const session = new DocumentSession(store, { exists });
+
+    session.open(1, '/docs/report.liv');
+    session.open(2, '/docs/summary.liv');
+    session.close(2);
+    session.close(1, true);
+
+    expect(store.get('session.documents').map(entry => entry.filePath)).to.deep.equal(['/docs/report.liv']);
+    expect(session.windows.size).to.equal(0);
+  });
+
+  it('should restore documents that still exist', () => {
+    const store = memoryStore({
+      session: {
+        documents: [
+          { filePath: '/docs/report.liv', bounds: null, position: { scroll: 0.4 } },
+          { filePath: '/docs/missing.liv', bounds: null, position: null }
+        ]
+      }
+    });
+    const session = new DocumentSession(store, { exists });
+
+    expect(session.restorable().map(entry => entry.filePath)).to.deep.equal(['/docs/report.liv']);
+
+    store.set('preferences.restoreSession', false);
+    expect(session.restorable()).to.be.empty;
+  });
+
+  it('should not keep positions that cannot be saved', () => {
+    const store = memoryStore();
+    const session = new DocumentSession(store, { exists });
+    session.open(1, '/docs/report.liv');
+
+    session.setPosition(1, { text: 'x'.repeat(5000) });
+    const cyclic = {};
+    cyclic.self = cyclic;
+    session.setPosition(1, cyclic);
+
+    expect(store.get('session.documents')[0].position).to.be.null;
+  });
+});
@@ -0,0 +1,66 @@
+// Package contentline writes the content lines shared by iCalendar
+// (RFC 5545) and vCard (RFC 6350): CRLF endings, folding at 75 octets and
+// escaped text values.
+package contentline
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLineOctets is the longest content line before it is folded
+const MaxLineOctets = 75
+
+// textEscaper escapes backslashes, semicolons, commas and line breaks
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// uriCleaner drops line breaks, which would end a URI's line early
+var uriCleaner = strings.NewReplacer("\r", "", "\n", "")
+
+// EscapeText escapes a TEXT value: backslashes, semicolons, commas and
+// line breaks
+func EscapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// URI keeps a URI value on its line. URIs are not escaped.
+func URI(uri string) string {
+	return uriCleaner.Replace(uri)
+}
+
+// Writer writes content lines with CRLF endings, folding those longer than
+// 75 octets without splitting characters
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// Line writes one content line
+func (w *Writer) Line(content string) {
+	limit := MaxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.buf.WriteString(content[:cut])
+		w.buf.WriteString("\r\n ")
+		content = content[cut:]
+		// Continuation lines start with a space, which counts
+		limit = MaxLineOctets - 1
+	}
+	w.buf.WriteString(content)
+	w.buf.WriteString("\r\n")
+}
+
+// Bytes returns the lines written so far
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
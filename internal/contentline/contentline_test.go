@@ -0,0 +1,32 @@
+package contentline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineFolding(t *testing.T) {
+	var w Writer
+	w.Line("SUMMARY:" + strings.Repeat("é", 60))
+	for i, line := range strings.Split(strings.TrimSuffix(string(w.Bytes()), "\r\n"), "\r\n") {
+		if len(line) > MaxLineOctets {
+			t.Errorf("line %d is %d octets", i, len(line))
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d does not start with a space", i)
+		}
+	}
+	unfolded := strings.ReplaceAll(string(w.Bytes()), "\r\n ", "")
+	if unfolded != "SUMMARY:"+strings.Repeat("é", 60)+"\r\n" {
+		t.Errorf("unfolded line changed: %q", unfolded)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	if got := EscapeText("a\\b;c,d\r\ne"); got != `a\\b\;c\,d\ne` {
+		t.Errorf("EscapeText = %q", got)
+	}
+	if got := URI("https://example.org/\r\nx"); got != "https://example.org/x" {
+		t.Errorf("URI = %q", got)
+	}
+}
@@ -76,7 +76,7 @@ func ConvertPDFToLIV(config ConvertConfig) error {
 
 	// Step 4: Dry run output (optional)
 	if config.DryRun {
-		fmt.Println("\n[DRY RUN] Outputting intermediate JSON...\n")
+		fmt.Print("\n[DRY RUN] Outputting intermediate JSON...\n\n")
 
 		fmt.Println("=== MANIFEST ===")
 		manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
@@ -9,12 +9,13 @@ import (
 	"path/filepath"
 
 	"github.com/liv-format/liv/internal/types"
+	"github.com/liv-format/liv/pkg/atomicfile"
 )
 
 // PackageLIV creates a .liv file from the document, manifest, and assets
 func PackageLIV(outputPath string, doc *types.LIVDocument, manifest *types.LIVManifest, assets *types.ExtractedAssets, compress bool) error {
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	// Create output file, which replaces outputPath once complete
+	outFile, err := atomicfile.Create(outputPath, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
@@ -22,7 +23,6 @@ func PackageLIV(outputPath string, doc *types.LIVDocument, manifest *types.LIVMa
 
 	// Create ZIP writer
 	zipWriter := zip.NewWriter(outFile)
-	defer zipWriter.Close()
 
 	// Set compression level
 	if !compress {
@@ -67,7 +67,10 @@ func PackageLIV(outputPath string, doc *types.LIVDocument, manifest *types.LIVMa
 	// TODO: Add digital signature support
 	// TODO: Add encryption support
 
-	return nil
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish package: %w", err)
+	}
+	return outFile.Commit()
 }
 
 // writeJSON writes a JSON file to the ZIP archive
@@ -0,0 +1,153 @@
+// Package a11y audits the accessibility of a document's pages against WCAG:
+// text alternatives for images, heading order, the contrast of inline
+// styles, use of ARIA, and the static fallback readers without scripts get.
+// Pages are checked as written, without running their scripts or applying
+// style sheets, so the audit finds what the markup gets wrong rather than
+// proving a document accessible.
+package a11y
+
+import (
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// FallbackPath is where a document keeps the page shown to readers who
+// cannot run its scripts
+const FallbackPath = "content/static/fallback.html"
+
+// Severity classifies a finding
+type Severity string
+
+const (
+	// SeverityWarning marks markup that is likely, but not certainly, a barrier
+	SeverityWarning Severity = "warning"
+	// SeverityError marks markup that fails a WCAG success criterion
+	SeverityError Severity = "error"
+)
+
+// Rules checked by the audit
+const (
+	RuleImageAlt       = "image-alt"
+	RuleHeadingOrder   = "heading-order"
+	RuleHeadingEmpty   = "heading-empty"
+	RuleContrast       = "contrast"
+	RuleARIARole       = "aria-role"
+	RuleARIAAttribute  = "aria-attribute"
+	RuleARIAHidden     = "aria-hidden-focusable"
+	RuleARIAReference  = "aria-reference"
+	RuleARIAFocusable  = "aria-focusable"
+	RuleStaticFallback = "static-fallback"
+)
+
+// Finding is an accessibility problem in a page of the document
+type Finding struct {
+	Rule string `json:"rule"`
+	// WCAG is the success criterion the finding fails, such as 1.1.1
+	WCAG     string   `json:"wcag"`
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path"`
+	// Line is the line of the page the element starts on, or 0 for
+	// findings about the whole document
+	Line    int    `json:"line,omitempty"`
+	Element string `json:"element,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report is the outcome of an audit
+type Report struct {
+	// Score is 0 to 100: the share of checks passed, where a warning
+	// counts as half a failure
+	Score int `json:"score"`
+	// Checks is the number of elements and properties checked
+	Checks   int        `json:"checks"`
+	Errors   int        `json:"errors"`
+	Warnings int        `json:"warnings"`
+	Pages    []string   `json:"pages"`
+	Findings []*Finding `json:"findings"`
+	// Skipped are pages that could not be checked, such as encrypted ones
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Passed reports whether the document scores at least minScore
+func (r *Report) Passed(minScore int) bool {
+	return r.Score >= minScore
+}
+
+// Audit checks the HTML pages of a document: its files as extracted from
+// the package, and the manifest, which tells the encrypted pages that
+// cannot be read apart
+func Audit(files map[string][]byte, m *core.Manifest) *Report {
+	report := &Report{Pages: []string{}, Findings: []*Finding{}}
+
+	var pages []string
+	for name := range files {
+		if strings.HasPrefix(name, "content/") && isPage(name) {
+			pages = append(pages, name)
+		}
+	}
+	sort.Strings(pages)
+
+	scripted := false
+	for name := range files {
+		switch strings.ToLower(path.Ext(name)) {
+		case ".js", ".mjs", ".wasm":
+			scripted = true
+		}
+	}
+
+	for _, name := range pages {
+		if m != nil && m.Encryption != nil && m.Encryption.Resources[name] != nil {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+		result := auditPage(name, files[name])
+		report.Pages = append(report.Pages, name)
+		report.Checks += result.checks
+		report.Findings = append(report.Findings, result.findings...)
+		scripted = scripted || result.scripted
+	}
+
+	if scripted {
+		report.Checks++
+		if _, ok := files[FallbackPath]; !ok {
+			report.Findings = append(report.Findings, &Finding{
+				Rule:     RuleStaticFallback,
+				WCAG:     "4.1.2",
+				Severity: SeverityError,
+				Path:     FallbackPath,
+				Message:  "document runs scripts but has no static fallback page for readers without them",
+			})
+		}
+	}
+
+	for _, finding := range report.Findings {
+		if finding.Severity == SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	report.Score = score(report.Checks, report.Errors, report.Warnings)
+	return report
+}
+
+// score is the share of checks passed, out of 100
+func score(checks, errors, warnings int) int {
+	if checks == 0 {
+		return 100
+	}
+	failed := float64(errors) + float64(warnings)/2
+	return int(math.Max(0, math.Floor(100*(1-failed/float64(checks)))))
+}
+
+func isPage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package a11y
+
+import (
+	"math"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+const page = `<!DOCTYPE html>
+<html lang="en"><head><title>Report</title></head>
+<body>
+<h1>Annual Report</h1>
+<img src="logo.png" alt="">
+<img src="chart.png">
+<img src="map.png" alt="map.png">
+<h3>Results</h3>
+<div style="background: #ffffff url(paper.png)"><p style="color: #999">Over an image</p></div>
+<div style="background-color: white">
+  <p style="color: #aaaaaa">Faint text</p>
+  <p style="color: #aaaaaa">More faint text</p>
+  <p style="color: #767676">Readable text</p>
+  <p style="color: #949494; font-size: 24px">Large text</p>
+</div>
+<p style="color: #ccc">No background set inline</p>
+<div role="buton" aria-lable="Menu">Menu</div>
+<span role="button" onclick="go()">Go</span>
+<a href="/next" aria-hidden="true">Next</a>
+<input aria-describedby="hint missing">
+<p id="hint">Hint</p>
+<svg role="img"><title>Trend</title></svg>
+<svg role="img" viewBox="0 0 10 10"></svg>
+<h2><img src="icon.png" alt="Summary"></h2>
+<h2></h2>
+</body></html>`
+
+func findings(report *Report) map[string]int {
+	rules := make(map[string]int)
+	for _, finding := range report.Findings {
+		rules[finding.Rule]++
+	}
+	return rules
+}
+
+func TestAudit(t *testing.T) {
+	report := Audit(map[string][]byte{"content/index.html": []byte(page)}, nil)
+
+	want := map[string]int{
+		RuleImageAlt:      3,
+		RuleHeadingOrder:  1,
+		RuleHeadingEmpty:  1,
+		RuleContrast:      2,
+		RuleARIARole:      1,
+		RuleARIAAttribute: 1,
+		RuleARIAHidden:    1,
+		RuleARIAReference: 1,
+		RuleARIAFocusable: 1,
+	}
+	got := findings(report)
+	for rule, count := range want {
+		if got[rule] != count {
+			t.Errorf("Expected %d %s findings, got %d", count, rule, got[rule])
+		}
+	}
+	for rule := range got {
+		if _, ok := want[rule]; !ok {
+			t.Errorf("Unexpected %s finding", rule)
+		}
+	}
+
+	for _, finding := range report.Findings {
+		if finding.Rule == RuleContrast && finding.Line != 11 && finding.Line != 12 {
+			t.Errorf("Expected contrast findings on lines 11 and 12, got %d: %s", finding.Line, finding.Element)
+		}
+	}
+	if report.Errors+report.Warnings != len(report.Findings) || report.Warnings != 3 {
+		t.Errorf("Expected 3 warnings among %d findings, got %d", len(report.Findings), report.Warnings)
+	}
+	if report.Score >= 100 || report.Score <= 0 {
+		t.Errorf("Expected a partial score, got %d", report.Score)
+	}
+}
+
+func TestAuditStaticFallback(t *testing.T) {
+	scripted := map[string][]byte{
+		"content/index.html": []byte(`<h1>Chart</h1><script src="../assets/chart.js"></script>`),
+	}
+	report := Audit(scripted, nil)
+	if findings(report)[RuleStaticFallback] != 1 {
+		t.Fatalf("Expected a missing fallback, got %+v", report.Findings)
+	}
+
+	scripted[FallbackPath] = []byte(`<h1>Chart</h1><p>Sales rose.</p>`)
+	report = Audit(scripted, nil)
+	if len(report.Findings) != 0 || report.Score != 100 {
+		t.Errorf("Expected a clean report, got %d: %+v", report.Score, report.Findings)
+	}
+	if len(report.Pages) != 2 {
+		t.Errorf("Expected the fallback page audited, got %v", report.Pages)
+	}
+
+	data := map[string][]byte{
+		"content/index.html": []byte(`<h1>Data</h1><script type="application/ld+json">{}</script>`),
+	}
+	if report := Audit(data, nil); len(report.Findings) != 0 {
+		t.Errorf("Expected JSON-LD not to need a fallback, got %+v", report.Findings)
+	}
+}
+
+func TestAuditSkipsEncryptedPages(t *testing.T) {
+	m := &core.Manifest{Encryption: &core.EncryptionInfo{
+		Resources: map[string]*core.EncryptedResource{"content/index.html": {}},
+	}}
+	report := Audit(map[string][]byte{"content/index.html": []byte("\x8f\x02ciphertext")}, m)
+	if len(report.Skipped) != 1 || len(report.Pages) != 0 || report.Score != 100 {
+		t.Errorf("Expected the encrypted page skipped, got %+v", report)
+	}
+}
+
+func TestContrast(t *testing.T) {
+	tests := []struct {
+		fore, back string
+		want       float64
+	}{
+		{"#000", "#fff", 21},
+		{"#767676", "white", 4.54},
+		{"rgb(170, 170, 170)", "#ffffff", 2.32},
+		{"rgb(0 0 255)", "yellow", 8.0},
+	}
+	for _, test := range tests {
+		fore, ok, _ := parseColor(test.fore)
+		back, ok2, _ := parseColor(test.back)
+		if !ok || !ok2 {
+			t.Fatalf("Failed to parse %s or %s", test.fore, test.back)
+		}
+		if got := contrast(fore, back); math.Abs(got-test.want) > 0.01 {
+			t.Errorf("contrast(%s, %s) = %.2f, want %.2f", test.fore, test.back, got, test.want)
+		}
+	}
+	for _, value := range []string{"rgba(0, 0, 0, 0.5)", "#0008", "var(--ink)", "hsl(0 0% 50%)"} {
+		if _, ok, _ := parseColor(value); ok {
+			t.Errorf("Expected %s not to be read", value)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	if got := score(0, 0, 0); got != 100 {
+		t.Errorf("Expected a page with nothing to check to score 100, got %d", got)
+	}
+	if got := score(20, 2, 2); got != 85 {
+		t.Errorf("Expected 85, got %d", got)
+	}
+	if got := score(2, 3, 0); got != 0 {
+		t.Errorf("Expected the score to stop at 0, got %d", got)
+	}
+}
@@ -0,0 +1,58 @@
+package a11y
+
+import "strings"
+
+// roles are the WAI-ARIA 1.2 roles that are not abstract
+var roles = setOf(`alert alertdialog application article banner blockquote button
+	caption cell checkbox code columnheader combobox complementary contentinfo
+	definition deletion dialog directory document emphasis feed figure form
+	generic grid gridcell group heading img insertion link list listbox listitem
+	log main marquee math menu menubar menuitem menuitemcheckbox menuitemradio
+	meter navigation none note option paragraph presentation progressbar radio
+	radiogroup region row rowgroup rowheader scrollbar search searchbox
+	separator slider spinbutton status strong subscript superscript switch tab
+	table tablist tabpanel term textbox time timer toolbar tooltip tree treegrid
+	treeitem`)
+
+// ariaAttributes are the WAI-ARIA 1.2 states and properties
+var ariaAttributes = setOf(`aria-activedescendant aria-atomic aria-autocomplete
+	aria-braillelabel aria-brailleroledescription aria-busy aria-checked
+	aria-colcount aria-colindex aria-colindextext aria-colspan aria-controls
+	aria-current aria-describedby aria-description aria-details aria-disabled
+	aria-dropeffect aria-errormessage aria-expanded aria-flowto aria-grabbed
+	aria-haspopup aria-hidden aria-invalid aria-keyshortcuts aria-label
+	aria-labelledby aria-level aria-live aria-modal aria-multiline
+	aria-multiselectable aria-orientation aria-owns aria-placeholder
+	aria-posinset aria-pressed aria-readonly aria-relevant aria-required
+	aria-roledescription aria-rowcount aria-rowindex aria-rowindextext
+	aria-rowspan aria-selected aria-setsize aria-sort aria-valuemax
+	aria-valuemin aria-valuenow aria-valuetext`)
+
+// idReferences are the attributes whose values are ids of other elements
+var idReferences = setOf(`aria-activedescendant aria-controls aria-describedby
+	aria-details aria-errormessage aria-flowto aria-labelledby aria-owns`)
+
+// focusRoles are the widget roles a reader operates directly, which must be
+// reachable from the keyboard. Roles of items in composite widgets are left
+// out, as the widget often moves focus between them itself.
+var focusRoles = setOf(`button checkbox combobox link searchbox slider
+	spinbutton switch textbox`)
+
+func setOf(names string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range strings.Fields(names) {
+		set[name] = true
+	}
+	return set
+}
+
+// validRole reports whether a role attribute names only known roles; it may
+// list several, the later ones as fallbacks
+func validRole(role string) (string, bool) {
+	for _, name := range strings.Fields(strings.ToLower(role)) {
+		if !roles[name] && !strings.HasPrefix(name, "doc-") && !strings.HasPrefix(name, "graphics-") {
+			return name, false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,234 @@
+package a11y
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WCAG 1.4.3 minimum contrast of text, and of large text
+const (
+	MinContrast      = 4.5
+	MinContrastLarge = 3.0
+)
+
+// color is an opaque sRGB color
+type color struct {
+	r, g, b uint8
+}
+
+func (c color) String() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.r, c.g, c.b)
+}
+
+// luminance is the relative luminance of the color, as WCAG defines it
+func (c color) luminance() float64 {
+	channel := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.r) + 0.7152*channel(c.g) + 0.0722*channel(c.b)
+}
+
+// contrast is the contrast ratio of two colors, 1 to 21
+func contrast(a, b color) float64 {
+	la, lb := a.luminance(), b.luminance()
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// namedColors are the CSS color keywords pages commonly use
+var namedColors = map[string]color{
+	"black": {0, 0, 0}, "white": {255, 255, 255}, "silver": {192, 192, 192},
+	"gray": {128, 128, 128}, "grey": {128, 128, 128}, "darkgray": {169, 169, 169},
+	"darkgrey": {169, 169, 169}, "lightgray": {211, 211, 211}, "lightgrey": {211, 211, 211},
+	"dimgray": {105, 105, 105}, "dimgrey": {105, 105, 105}, "gainsboro": {220, 220, 220},
+	"whitesmoke": {245, 245, 245}, "red": {255, 0, 0}, "maroon": {128, 0, 0},
+	"darkred": {139, 0, 0}, "orange": {255, 165, 0}, "yellow": {255, 255, 0},
+	"gold": {255, 215, 0}, "olive": {128, 128, 0}, "lime": {0, 255, 0},
+	"green": {0, 128, 0}, "darkgreen": {0, 100, 0}, "teal": {0, 128, 128},
+	"aqua": {0, 255, 255}, "cyan": {0, 255, 255}, "blue": {0, 0, 255},
+	"navy": {0, 0, 128}, "darkblue": {0, 0, 139}, "lightblue": {173, 216, 230},
+	"purple": {128, 0, 128}, "fuchsia": {255, 0, 255}, "magenta": {255, 0, 255},
+	"pink": {255, 192, 203}, "brown": {165, 42, 42}, "beige": {245, 245, 220},
+	"ivory": {255, 255, 240}, "linen": {250, 240, 230}, "snow": {255, 250, 250},
+}
+
+// parseColor reads a CSS color. ok is false for colors the audit cannot
+// tell the appearance of, such as translucent colors or var() references,
+// and set is false for transparent, which shows the color beneath, and for
+// keywords that take the parent's color.
+func parseColor(value string) (c color, ok, set bool) {
+	value = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important")))
+	switch {
+	case value == "transparent", value == "inherit", value == "initial", value == "unset", value == "currentcolor":
+		return color{}, false, false
+	case strings.HasPrefix(value, "#"):
+		c, ok = parseHex(value[1:])
+		return c, ok, true
+	case strings.HasPrefix(value, "rgb(") || strings.HasPrefix(value, "rgba("):
+		c, ok = parseRGB(value[strings.Index(value, "(")+1:])
+		return c, ok, true
+	}
+	c, ok = namedColors[value]
+	return c, ok, true
+}
+
+func parseHex(hex string) (color, bool) {
+	switch len(hex) {
+	case 3, 4:
+		if len(hex) == 4 && hex[3] != 'f' {
+			return color{}, false
+		}
+		expanded := make([]byte, 0, 6)
+		for i := 0; i < 3; i++ {
+			expanded = append(expanded, hex[i], hex[i])
+		}
+		hex = string(expanded)
+	case 6:
+	case 8:
+		if hex[6:] != "ff" {
+			return color{}, false
+		}
+		hex = hex[:6]
+	default:
+		return color{}, false
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color{}, false
+	}
+	return color{uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+// parseRGB reads the arguments of rgb() or rgba(), in the comma or the
+// space separated syntax
+func parseRGB(args string) (color, bool) {
+	args = strings.TrimSuffix(strings.TrimSpace(args), ")")
+	var alpha string
+	if i := strings.Index(args, "/"); i >= 0 {
+		args, alpha = args[:i], args[i+1:]
+	}
+	parts := strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(parts) == 4 {
+		parts, alpha = parts[:3], parts[3]
+	}
+	if len(parts) != 3 {
+		return color{}, false
+	}
+	if alpha = strings.TrimSpace(alpha); alpha != "" && alpha != "1" && alpha != "100%" {
+		return color{}, false
+	}
+	var channels [3]uint8
+	for i, part := range parts {
+		scale := 1.0
+		if strings.HasSuffix(part, "%") {
+			part, scale = strings.TrimSuffix(part, "%"), 2.55
+		}
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return color{}, false
+		}
+		channels[i] = uint8(math.Round(math.Max(0, math.Min(255, v*scale))))
+	}
+	return color{channels[0], channels[1], channels[2]}, true
+}
+
+// parseBackground reads the color of a background shorthand. Backgrounds
+// with images are not known, as text may be drawn over any part of them.
+func parseBackground(value string) (c color, ok, set bool) {
+	lower := strings.ToLower(value)
+	if strings.Contains(lower, "url(") || strings.Contains(lower, "gradient(") {
+		return color{}, false, true
+	}
+	for _, token := range splitOutsideParens(lower) {
+		if token == "transparent" {
+			return color{}, false, false
+		}
+		if c, ok, _ := parseColor(token); ok {
+			return c, true, true
+		}
+		for _, prefix := range []string{"#", "rgb", "hsl", "hwb", "lab(", "lch(", "oklab(", "oklch(", "color(", "var("} {
+			if strings.HasPrefix(token, prefix) {
+				return color{}, false, true
+			}
+		}
+	}
+	// Without a color the shorthand resets the background to transparent
+	return color{}, false, false
+}
+
+// splitOutsideParens splits a value on the spaces that are not within
+// parentheses, keeping rgb(...) together
+func splitOutsideParens(value string) []string {
+	var (
+		tokens []string
+		depth  int
+		start  int
+	)
+	for i, r := range value {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ' ' && depth == 0:
+			if i > start {
+				tokens = append(tokens, value[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(value) {
+		tokens = append(tokens, value[start:])
+	}
+	return tokens
+}
+
+// parseFontSize reads a font size in pixels, relative to the size of the
+// parent element. ok is false for sizes the audit cannot resolve.
+func parseFontSize(value string, parent float64) (float64, bool) {
+	value = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important")))
+	keywords := map[string]float64{
+		"xx-small": 9, "x-small": 10, "small": 13, "medium": 16,
+		"large": 18, "x-large": 24, "xx-large": 32, "xxx-large": 48,
+	}
+	if size, ok := keywords[value]; ok {
+		return size, true
+	}
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"px", 1}, {"pt", 4.0 / 3}, {"rem", 16}, {"em", parent}, {"%", parent / 100},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			if err != nil || v < 0 {
+				return 0, false
+			}
+			return v * unit.scale, true
+		}
+	}
+	return 0, false
+}
+
+// parseStyle reads the declarations of a style attribute by property name
+func parseStyle(style string) map[string]string {
+	declarations := make(map[string]string)
+	for _, declaration := range strings.Split(style, ";") {
+		name, value, found := strings.Cut(declaration, ":")
+		if !found {
+			continue
+		}
+		declarations[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return declarations
+}
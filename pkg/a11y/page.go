@@ -0,0 +1,462 @@
+package a11y
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// defaultFontSize is the font size of text no style sizes, in pixels
+const defaultFontSize = 16
+
+// maxElement is the longest element markup quoted in a finding
+const maxElement = 120
+
+// voidElements have no end tag, so they never hold other elements
+var voidElements = setOf(`area base br col embed hr img input link meta param
+	source track wbr`)
+
+// headingStyle is the default size in pixels of headings that count as
+// large text; h1 to h3 are bold and at least 18.66px
+var headingStyle = map[string]float64{"h1": 32, "h2": 24, "h3": 18.72}
+
+// fileName matches alt text that is only the name of the image file
+var fileName = regexp.MustCompile(`(?i)^[\w\-. ]+\.(png|jpe?g|gif|svg|webp|avif|bmp|tiff?)$`)
+
+// element is an open element and the inline style it gives its content
+type element struct {
+	name    string
+	line    int
+	markup  string
+	color   *color
+	colorOK bool // false when the element sets a color the audit cannot read
+	back    *color
+	backOK  bool
+	size    float64 // 0 when the element does not set it
+	bold    *bool
+	// checked is set once the contrast of the element's text is checked
+	checked bool
+	// unnamed is set on an svg with role img until a title names it
+	unnamed bool
+}
+
+// pageAudit walks one page
+type pageAudit struct {
+	path     string
+	checks   int
+	findings []*Finding
+	scripted bool
+
+	line  int
+	stack []*element
+
+	ids  map[string]bool
+	refs []reference
+
+	// level is the level of the last heading, and heading the heading
+	// being read, with its text so far
+	level       int
+	heading     *element
+	headingText strings.Builder
+}
+
+// reference is an id an element refers to by an ARIA attribute
+type reference struct {
+	attribute string
+	id        string
+	line      int
+	markup    string
+}
+
+// auditPage checks the markup of a single page
+func auditPage(name string, page []byte) *pageAudit {
+	a := &pageAudit{path: name, line: 1, ids: make(map[string]bool)}
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		line := a.line
+		a.line += bytes.Count(raw, []byte("\n"))
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			a.startTag(token, line, string(raw), tt == html.SelfClosingTagToken)
+		case html.EndTagToken:
+			token := z.Token()
+			a.endTag(token.Data)
+		case html.TextToken:
+			a.text(string(z.Text()))
+		}
+	}
+	for len(a.stack) > 0 {
+		a.pop()
+	}
+
+	for _, ref := range a.refs {
+		if !a.ids[ref.id] {
+			a.add(RuleARIAReference, "1.3.1", SeverityError, ref.line, ref.markup,
+				fmt.Sprintf("%s refers to id %q, which is not on the page", ref.attribute, ref.id))
+		}
+	}
+	return a
+}
+
+func (a *pageAudit) add(rule, wcag string, severity Severity, line int, markup, message string) {
+	if len(markup) > maxElement {
+		markup = markup[:maxElement] + "…"
+	}
+	a.findings = append(a.findings, &Finding{
+		Rule:     rule,
+		WCAG:     wcag,
+		Severity: severity,
+		Path:     a.path,
+		Line:     line,
+		Element:  markup,
+		Message:  message,
+	})
+}
+
+func (a *pageAudit) startTag(token html.Token, line int, markup string, selfClosing bool) {
+	attrs := make(map[string]string, len(token.Attr))
+	var keys []string
+	for _, attr := range token.Attr {
+		key := strings.ToLower(attr.Key)
+		if _, seen := attrs[key]; !seen {
+			keys = append(keys, key)
+		}
+		attrs[key] = attr.Val
+	}
+	name := token.Data
+
+	if id := attrs["id"]; id != "" {
+		a.ids[id] = true
+	}
+	if name == "script" && isScript(attrs["type"]) {
+		a.scripted = true
+	}
+	if name == "img" && a.heading != nil {
+		a.headingText.WriteString(attrs["alt"])
+	}
+	if name == "title" && len(a.stack) > 0 && a.stack[len(a.stack)-1].unnamed {
+		a.stack[len(a.stack)-1].unnamed = false
+	}
+
+	el := a.style(name, attrs)
+	el.line, el.markup = line, markup
+
+	a.checkImage(el, attrs)
+	a.checkARIA(el, keys, attrs)
+	a.checkHeading(el, attrs)
+
+	if !selfClosing && !voidElements[name] {
+		a.stack = append(a.stack, el)
+	}
+}
+
+func (a *pageAudit) endTag(name string) {
+	for i := len(a.stack) - 1; i >= 0; i-- {
+		if a.stack[i].name == name {
+			for len(a.stack) > i {
+				a.pop()
+			}
+			return
+		}
+	}
+}
+
+// pop closes the innermost open element
+func (a *pageAudit) pop() {
+	el := a.stack[len(a.stack)-1]
+	a.stack = a.stack[:len(a.stack)-1]
+	if el.unnamed {
+		a.add(RuleImageAlt, "1.1.1", SeverityError, el.line, el.markup,
+			"svg image has no title or aria-label")
+	}
+	if el == a.heading {
+		if strings.TrimSpace(a.headingText.String()) == "" {
+			a.add(RuleHeadingEmpty, "2.4.6", SeverityError, el.line, el.markup,
+				"heading has no text")
+		}
+		a.heading = nil
+	}
+}
+
+func (a *pageAudit) text(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if len(a.stack) > 0 {
+		switch a.stack[len(a.stack)-1].name {
+		case "script", "style", "template":
+			return
+		}
+	}
+	if a.heading != nil {
+		a.headingText.WriteString(text)
+	}
+	a.checkContrast()
+}
+
+// style reads the inline style of an element, inheriting the font size
+// from the elements it is in
+func (a *pageAudit) style(name string, attrs map[string]string) *element {
+	el := &element{name: name, colorOK: true, backOK: true}
+	parent := float64(defaultFontSize)
+	for i := len(a.stack) - 1; i >= 0; i-- {
+		if a.stack[i].size > 0 {
+			parent = a.stack[i].size
+			break
+		}
+	}
+	if size, ok := headingStyle[name]; ok {
+		bold := true
+		el.size, el.bold = size, &bold
+	}
+	if name == "b" || name == "strong" {
+		bold := true
+		el.bold = &bold
+	}
+
+	style := attrs["style"]
+	if style == "" {
+		return el
+	}
+	declarations := parseStyle(style)
+	if value, ok := declarations["color"]; ok {
+		if c, known, set := parseColor(value); set {
+			el.color, el.colorOK = &c, known
+		}
+	}
+	background, ok := declarations["background-color"]
+	parse := parseColor
+	if !ok {
+		background, ok = declarations["background"]
+		parse = parseBackground
+	}
+	if ok {
+		if c, known, set := parse(background); set {
+			el.back, el.backOK = &c, known
+		}
+	}
+	if value, ok := declarations["font-size"]; ok {
+		if size, known := parseFontSize(value, parent); known {
+			el.size = size
+		}
+	}
+	if value, ok := declarations["font-weight"]; ok {
+		weight, err := strconv.Atoi(value)
+		bold := value == "bold" || value == "bolder" || (err == nil && weight >= 700)
+		el.bold = &bold
+	}
+	return el
+}
+
+// checkContrast checks the contrast of text against the colors inline
+// styles give it. Text is only checked when both its color and the
+// background beneath it are set inline, as style sheets may set either.
+func (a *pageAudit) checkContrast() {
+	fore, back := -1, -1
+	for i := len(a.stack) - 1; i >= 0 && (fore < 0 || back < 0); i-- {
+		if fore < 0 && a.stack[i].color != nil {
+			fore = i
+		}
+		if back < 0 && a.stack[i].back != nil {
+			back = i
+		}
+	}
+	if fore < 0 || back < 0 || !a.stack[fore].colorOK || !a.stack[back].backOK {
+		return
+	}
+	// The innermost of the two is where the combination starts, and is
+	// checked once for all the text within
+	owner := a.stack[max(fore, back)]
+	if owner.checked {
+		return
+	}
+	owner.checked = true
+	a.checks++
+
+	size, bold := float64(defaultFontSize), false
+	sizeSet, boldSet := false, false
+	for i := len(a.stack) - 1; i >= 0 && (!sizeSet || !boldSet); i-- {
+		el := a.stack[i]
+		if !sizeSet && el.size > 0 {
+			size, sizeSet = el.size, true
+		}
+		if !boldSet && el.bold != nil {
+			bold, boldSet = *el.bold, true
+		}
+	}
+	minimum := MinContrast
+	if size >= 24 || (bold && size >= 18.66) {
+		minimum = MinContrastLarge
+	}
+	text, background := *a.stack[fore].color, *a.stack[back].back
+	if ratio := contrast(text, background); ratio < minimum {
+		a.add(RuleContrast, "1.4.3", SeverityError, owner.line, owner.markup,
+			fmt.Sprintf("text contrast %.2f:1 (%s on %s) is below %.1f:1", ratio, text, background, minimum))
+	}
+}
+
+// checkImage checks that images have a text alternative, or are marked
+// as decorative
+func (a *pageAudit) checkImage(el *element, attrs map[string]string) {
+	named := strings.TrimSpace(attrs["aria-label"]) != "" ||
+		strings.TrimSpace(attrs["aria-labelledby"]) != "" ||
+		strings.TrimSpace(attrs["title"]) != ""
+	alt, hasAlt := attrs["alt"]
+	role := strings.ToLower(strings.TrimSpace(attrs["role"]))
+	hidden := attrs["aria-hidden"] == "true"
+
+	switch {
+	case el.name == "img":
+		a.checks++
+		switch {
+		case hasAlt && fileName.MatchString(strings.TrimSpace(alt)):
+			a.add(RuleImageAlt, "1.1.1", SeverityWarning, el.line, el.markup,
+				fmt.Sprintf("alt text %q is a file name", alt))
+		case hasAlt, named, hidden, role == "presentation", role == "none":
+		default:
+			a.add(RuleImageAlt, "1.1.1", SeverityError, el.line, el.markup,
+				"image has no alt text; use alt=\"\" for decorative images")
+		}
+	case el.name == "input" && strings.EqualFold(attrs["type"], "image"),
+		el.name == "area" && attrs["href"] != "":
+		a.checks++
+		if strings.TrimSpace(alt) == "" && !named {
+			a.add(RuleImageAlt, "1.1.1", SeverityError, el.line, el.markup,
+				fmt.Sprintf("%s has no alt text", el.name))
+		}
+	case role == "img" && !hidden:
+		a.checks++
+		if named {
+			return
+		}
+		if el.name == "svg" {
+			// A title element within names it
+			el.unnamed = true
+			return
+		}
+		a.add(RuleImageAlt, "1.1.1", SeverityError, el.line, el.markup,
+			"element with role img has no aria-label")
+	}
+}
+
+// checkARIA checks roles and ARIA attributes
+func (a *pageAudit) checkARIA(el *element, keys []string, attrs map[string]string) {
+	role, hasRole := attrs["role"]
+	aria := false
+	for _, key := range keys {
+		if strings.HasPrefix(key, "aria-") {
+			aria = true
+			break
+		}
+	}
+	if !hasRole && !aria {
+		return
+	}
+	a.checks++
+
+	if hasRole {
+		if name, ok := validRole(role); !ok {
+			a.add(RuleARIARole, "4.1.2", SeverityError, el.line, el.markup,
+				fmt.Sprintf("role %q is not a WAI-ARIA role", name))
+		}
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "aria-") {
+			continue
+		}
+		if !ariaAttributes[key] {
+			a.add(RuleARIAAttribute, "4.1.2", SeverityError, el.line, el.markup,
+				fmt.Sprintf("%s is not a WAI-ARIA attribute", key))
+			continue
+		}
+		if idReferences[key] {
+			for _, id := range strings.Fields(attrs[key]) {
+				a.refs = append(a.refs, reference{attribute: key, id: id, line: el.line, markup: el.markup})
+			}
+		}
+	}
+
+	focusable := focusable(el.name, attrs)
+	if attrs["aria-hidden"] == "true" && focusable {
+		a.add(RuleARIAHidden, "4.1.2", SeverityError, el.line, el.markup,
+			"focusable element is hidden from assistive technology by aria-hidden")
+	}
+	first := ""
+	if names := strings.Fields(strings.ToLower(role)); len(names) > 0 {
+		first = names[0]
+	}
+	_, tabindex := attrs["tabindex"]
+	if focusRoles[first] && !focusable && !tabindex && attrs["aria-disabled"] != "true" && attrs["aria-hidden"] != "true" {
+		a.add(RuleARIAFocusable, "2.1.1", SeverityWarning, el.line, el.markup,
+			fmt.Sprintf("element with role %s cannot be reached from the keyboard; add tabindex=\"0\"", first))
+	}
+}
+
+// checkHeading checks that headings do not skip levels
+func (a *pageAudit) checkHeading(el *element, attrs map[string]string) {
+	if len(el.name) != 2 || el.name[0] != 'h' || el.name[1] < '1' || el.name[1] > '6' {
+		return
+	}
+	level := int(el.name[1] - '0')
+	a.checks++
+	switch {
+	case a.level == 0 && level > 1:
+		a.add(RuleHeadingOrder, "1.3.1", SeverityWarning, el.line, el.markup,
+			fmt.Sprintf("first heading is h%d; pages start at h1", level))
+	case a.level > 0 && level > a.level+1:
+		a.add(RuleHeadingOrder, "1.3.1", SeverityWarning, el.line, el.markup,
+			fmt.Sprintf("h%d follows h%d, skipping a level", level, a.level))
+	}
+	a.level = level
+
+	a.heading = el
+	a.headingText.Reset()
+	a.headingText.WriteString(attrs["aria-label"])
+}
+
+// focusable reports whether an element is in the tab order
+func focusable(name string, attrs map[string]string) bool {
+	if value, ok := attrs["tabindex"]; ok {
+		index, err := strconv.Atoi(strings.TrimSpace(value))
+		return err == nil && index >= 0
+	}
+	if _, disabled := attrs["disabled"]; disabled {
+		switch name {
+		case "button", "input", "select", "textarea":
+			return false
+		}
+	}
+	if value, ok := attrs["contenteditable"]; ok && value != "false" {
+		return true
+	}
+	switch name {
+	case "a", "area":
+		_, href := attrs["href"]
+		return href
+	case "input":
+		return !strings.EqualFold(attrs["type"], "hidden")
+	case "button", "select", "textarea", "iframe", "summary":
+		return true
+	case "audio", "video":
+		_, controls := attrs["controls"]
+		return controls
+	}
+	return false
+}
+
+// isScript reports whether a script element of the given type runs
+func isScript(kind string) bool {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	return kind == "" || kind == "module" || strings.Contains(kind, "javascript") || strings.Contains(kind, "ecmascript")
+}
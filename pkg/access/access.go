@@ -0,0 +1,207 @@
+// Package access enforces the access policies of documents: the dates between
+// which they open, how many times each reader may open them and the watermark
+// shown while they are open. Opening a document grants the reader its content
+// for a while; the grant is renewed as the content is read.
+package access
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// DefaultGrantTTL is how long an open lets a reader load the content of a
+// document without reading any of it
+const DefaultGrantTTL = 15 * time.Minute
+
+// defaultWatermark is the watermark of policies that give no text
+const defaultWatermark = "{reader} {time}"
+
+// Reasons a document does not open
+var (
+	ErrNotYetValid = errors.New("document cannot be opened yet")
+	ErrExpired     = errors.New("document has expired")
+	ErrOpenLimit   = errors.New("document has been opened as many times as allowed")
+)
+
+// Check reports whether a policy lets the document open at now. Skew is the
+// clock difference tolerated at either end of the window.
+func Check(policy *core.AccessPolicy, now time.Time, skew time.Duration) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.NotBefore != nil && now.Add(skew).Before(*policy.NotBefore) {
+		return fmt.Errorf("%w: it opens on %s", ErrNotYetValid, policy.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if policy.NotAfter != nil && now.Add(-skew).After(*policy.NotAfter) {
+		return fmt.Errorf("%w: it closed on %s", ErrExpired, policy.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Watermark returns the watermark shown to reader, who opened the document at
+// now, or "" when the policy has none
+func Watermark(policy *core.AccessPolicy, reader string, now time.Time) string {
+	if policy == nil || policy.Watermark == nil {
+		return ""
+	}
+	text := policy.Watermark.Text
+	if text == "" {
+		text = defaultWatermark
+	}
+	return strings.NewReplacer(
+		"{reader}", reader,
+		"{time}", now.UTC().Format("2006-01-02 15:04 UTC"),
+	).Replace(text)
+}
+
+// DocumentKey identifies a document by its manifest, so the opens of each
+// revision are counted apart and counts cannot be reset by renaming or
+// uploading the document again
+func DocumentKey(m *core.Manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize manifest: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Counter counts how many times each reader opened each document, in a
+// directory with one <document key>.json file per document, and remembers
+// the grants of recent opens. It is safe for concurrent use.
+type Counter struct {
+	// TTL is how long a grant lasts unused; DefaultGrantTTL when zero
+	TTL time.Duration
+
+	dir    string
+	mu     sync.Mutex
+	grants map[grant]time.Time
+}
+
+// grant is a reader allowed to load the content of a document
+type grant struct {
+	document string
+	reader   string
+}
+
+// NewCounter opens the counts kept in dir
+func NewCounter(dir string) (*Counter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create access directory: %v", err)
+	}
+	return &Counter{dir: dir, grants: make(map[grant]time.Time)}, nil
+}
+
+// Open counts an open of a document by reader and grants them its content.
+// It returns how many times the reader has opened the document, this time
+// included, or ErrOpenLimit when the policy allows no more. The dates of the
+// policy are not checked; see Check.
+func (c *Counter) Open(document, reader string, policy *core.AccessPolicy, now time.Time) (int, error) {
+	if !validKey(document) {
+		return 0, fmt.Errorf("invalid document key %q", document)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts, err := c.read(document)
+	if err != nil {
+		return 0, err
+	}
+	if policy != nil && policy.MaxOpens > 0 && counts[reader] >= policy.MaxOpens {
+		return counts[reader], fmt.Errorf("%w (%d)", ErrOpenLimit, policy.MaxOpens)
+	}
+	counts[reader]++
+	if err := c.write(document, counts); err != nil {
+		return 0, err
+	}
+	c.sweep(now)
+	c.grants[grant{document, reader}] = now.Add(c.ttl())
+	return counts[reader], nil
+}
+
+// Granted reports whether reader opened a document recently enough to load
+// its content, and keeps the grant for another TTL if so
+func (c *Counter) Granted(document, reader string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := grant{document, reader}
+	expires, ok := c.grants[key]
+	if !ok {
+		return false
+	}
+	if now.After(expires) {
+		delete(c.grants, key)
+		return false
+	}
+	c.grants[key] = now.Add(c.ttl())
+	return true
+}
+
+// sweep forgets grants that expired before now
+func (c *Counter) sweep(now time.Time) {
+	for key, expires := range c.grants {
+		if now.After(expires) {
+			delete(c.grants, key)
+		}
+	}
+}
+
+func (c *Counter) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+	return DefaultGrantTTL
+}
+
+// validKey reports whether document is a key made by DocumentKey, and so safe
+// as a file name
+func validKey(document string) bool {
+	if len(document) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(document)
+	return err == nil
+}
+
+func (c *Counter) path(document string) string {
+	return filepath.Join(c.dir, document+".json")
+}
+
+func (c *Counter) read(document string) (map[string]int, error) {
+	counts := make(map[string]int)
+	data, err := os.ReadFile(c.path(document))
+	if errors.Is(err, os.ErrNotExist) {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read open counts: %v", err)
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, fmt.Errorf("failed to parse open counts of %s: %v", document, err)
+	}
+	return counts, nil
+}
+
+// write replaces the counts of a document through a temporary file, so a
+// crash leaves the old or the new counts
+func (c *Counter) write(document string, counts map[string]int) error {
+	data, err := json.MarshalIndent(counts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize open counts: %v", err)
+	}
+	if err := atomicfile.WriteFile(c.path(document), data, 0600); err != nil {
+		return fmt.Errorf("failed to write open counts: %v", err)
+	}
+	return nil
+}
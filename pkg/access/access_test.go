@@ -0,0 +1,106 @@
+package access
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func TestCheck(t *testing.T) {
+	opens := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	closes := opens.AddDate(0, 0, 7)
+	policy := &core.AccessPolicy{NotBefore: &opens, NotAfter: &closes}
+
+	if err := Check(policy, opens.Add(-time.Hour), 0); !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("expected the document not to open early, got %v", err)
+	}
+	if err := Check(policy, opens.Add(-time.Minute), 5*time.Minute); err != nil {
+		t.Errorf("expected clock skew to be tolerated, got %v", err)
+	}
+	if err := Check(policy, opens.AddDate(0, 0, 3), 0); err != nil {
+		t.Errorf("expected the document to open within its window, got %v", err)
+	}
+	if err := Check(policy, closes.Add(time.Hour), 0); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected the document to expire, got %v", err)
+	}
+	if err := Check(nil, closes.Add(time.Hour), 0); err != nil {
+		t.Errorf("expected documents without a policy to open, got %v", err)
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+	policy := &core.AccessPolicy{Watermark: &core.WatermarkPolicy{}}
+	if got := Watermark(policy, "Alice", now); got != "Alice 2026-03-01 08:30 UTC" {
+		t.Errorf("unexpected default watermark %q", got)
+	}
+	policy.Watermark.Text = "Licensed to {reader}"
+	if got := Watermark(policy, "Alice", now); got != "Licensed to Alice" {
+		t.Errorf("unexpected watermark %q", got)
+	}
+	if got := Watermark(&core.AccessPolicy{MaxOpens: 1}, "Alice", now); got != "" {
+		t.Errorf("expected no watermark, got %q", got)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	dir := t.TempDir()
+	counter, err := NewCounter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.TTL = time.Minute
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	document, err := DocumentKey(&core.Manifest{Version: "1.0", Access: &core.AccessPolicy{MaxOpens: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &core.AccessPolicy{MaxOpens: 2}
+
+	if counter.Granted(document, "alice", now) {
+		t.Error("expected no grant before the document is opened")
+	}
+	for want := 1; want <= 2; want++ {
+		opens, err := counter.Open(document, "alice", policy, now)
+		if err != nil || opens != want {
+			t.Fatalf("expected open %d, got %d, %v", want, opens, err)
+		}
+	}
+	if _, err := counter.Open(document, "alice", policy, now); !errors.Is(err, ErrOpenLimit) {
+		t.Errorf("expected the open limit, got %v", err)
+	}
+	if _, err := counter.Open(document, "bob", policy, now); err != nil {
+		t.Errorf("expected readers to be counted apart, got %v", err)
+	}
+
+	// Reading renews the grant; an unused grant expires
+	now = now.Add(50 * time.Second)
+	if !counter.Granted(document, "alice", now) {
+		t.Error("expected alice to be granted the content")
+	}
+	now = now.Add(50 * time.Second)
+	if !counter.Granted(document, "alice", now) {
+		t.Error("expected reading to renew the grant")
+	}
+	if counter.Granted(document, "bob", now) {
+		t.Error("expected bob's unused grant to expire")
+	}
+
+	// Counts outlive the counter
+	reopened, err := NewCounter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Open(document, "alice", policy, now); !errors.Is(err, ErrOpenLimit) {
+		t.Errorf("expected counts to persist, got %v", err)
+	}
+	if reopened.Granted(document, "alice", now) {
+		t.Error("expected grants not to persist")
+	}
+
+	if _, err := counter.Open("../escape", "alice", nil, now); err == nil {
+		t.Error("expected an invalid document key to be refused")
+	}
+}
@@ -0,0 +1,303 @@
+// Package advisory checks the libraries embedded in LIV documents against a
+// deny-list of components with known vulnerabilities. Components come from
+// the document's SBOM: bundled JS libraries identified by their banner, WASM
+// modules with their configured versions, and every file by its SHA-256.
+package advisory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/sbom"
+)
+
+// Policy controls how vulnerable components affect a build or validation
+type Policy string
+
+const (
+	// PolicyOff skips the check
+	PolicyOff Policy = "off"
+	// PolicyWarn reports vulnerable components without failing
+	PolicyWarn Policy = "warn"
+	// PolicyStrict fails when any component matches an advisory
+	PolicyStrict Policy = "strict"
+)
+
+// ParsePolicy converts a policy name into a Policy. Checking against a
+// deny-list is strict unless asked otherwise.
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(strings.ToLower(name)); policy {
+	case PolicyOff, PolicyWarn, PolicyStrict:
+		return policy, nil
+	case "":
+		return PolicyStrict, nil
+	default:
+		return "", fmt.Errorf("unknown vulnerability policy: %s (expected off, warn or strict)", name)
+	}
+}
+
+// Severity ranks an advisory
+type Severity string
+
+// Severities from least to most severe, as CVSS ratings name them
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+var severityRank = map[Severity]int{SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3, SeverityCritical: 4}
+
+// Feed is a deny-list of vulnerable or forbidden components
+type Feed struct {
+	Advisories []*Advisory `json:"advisories"`
+}
+
+// Advisory denies a component by name and version range, by the SHA-256 of
+// the exact file, or both
+type Advisory struct {
+	ID string `json:"id"`
+	// Package is the library or WASM module name, matched case-insensitively
+	Package string `json:"package,omitempty"`
+	// Versions lists the affected versions, such as ">=1.2.0 <3.5.0" or
+	// "<1.0.0 || 2.0.0". Empty means every version.
+	Versions string `json:"versions,omitempty"`
+	// SHA256 denies one build of a component whatever it is called
+	SHA256   string   `json:"sha256,omitempty"`
+	Severity Severity `json:"severity"`
+	Summary  string   `json:"summary"`
+	URL      string   `json:"url,omitempty"`
+
+	ranges [][]constraint
+}
+
+// Finding is a component matching an advisory
+type Finding struct {
+	Path     string
+	Name     string
+	Version  string
+	Advisory *Advisory
+}
+
+// Report collects the findings of a check
+type Report struct {
+	Findings          []*Finding
+	ComponentsChecked int
+}
+
+// Blocking returns the findings that fail under the given policy
+func (r *Report) Blocking(policy Policy) []*Finding {
+	if policy != PolicyStrict {
+		return nil
+	}
+	return r.Findings
+}
+
+// LoadFeed reads a deny-list from a JSON file
+func LoadFeed(path string) (*Feed, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open advisory feed: %v", err)
+	}
+	defer file.Close()
+	return ParseFeed(file)
+}
+
+// ParseFeed reads a deny-list in JSON:
+//
+//	{"advisories": [{"id": "CVE-2020-11022", "package": "jquery",
+//	  "versions": ">=1.2.0 <3.5.0", "severity": "medium",
+//	  "summary": "XSS in htmlPrefilter"}]}
+func ParseFeed(r io.Reader) (*Feed, error) {
+	var feed Feed
+	if err := json.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid advisory feed: %v", err)
+	}
+	for i, advisory := range feed.Advisories {
+		if advisory.ID == "" {
+			return nil, fmt.Errorf("invalid advisory feed: advisory %d has no id", i+1)
+		}
+		if advisory.Package == "" && advisory.SHA256 == "" {
+			return nil, fmt.Errorf("invalid advisory feed: %s names neither a package nor a sha256", advisory.ID)
+		}
+		if advisory.Severity == "" {
+			advisory.Severity = SeverityHigh
+		}
+		advisory.Severity = Severity(strings.ToLower(string(advisory.Severity)))
+		if severityRank[advisory.Severity] == 0 {
+			return nil, fmt.Errorf("invalid advisory feed: %s has unknown severity %q", advisory.ID, advisory.Severity)
+		}
+		ranges, err := parseRanges(advisory.Versions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid advisory feed: %s: %v", advisory.ID, err)
+		}
+		advisory.ranges = ranges
+		advisory.SHA256 = strings.ToLower(advisory.SHA256)
+	}
+	return &feed, nil
+}
+
+// Check matches the components of a BOM against the feed. Findings are
+// ordered by severity, most severe first, then by path.
+func Check(bom *sbom.BOM, feed *Feed) *Report {
+	report := &Report{ComponentsChecked: len(bom.Components)}
+	for _, component := range bom.Components {
+		for _, advisory := range feed.Advisories {
+			if advisory.matches(component) {
+				report.Findings = append(report.Findings, &Finding{
+					Path:     component.BOMRef,
+					Name:     component.Name,
+					Version:  component.Version,
+					Advisory: advisory,
+				})
+			}
+		}
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if severityRank[a.Advisory.Severity] != severityRank[b.Advisory.Severity] {
+			return severityRank[a.Advisory.Severity] > severityRank[b.Advisory.Severity]
+		}
+		return a.Path < b.Path
+	})
+	return report
+}
+
+// matches reports whether a component is denied by the advisory
+func (a *Advisory) matches(component *sbom.Component) bool {
+	if a.SHA256 != "" {
+		hashed := false
+		for _, hash := range component.Hashes {
+			if hash.Alg == "SHA-256" && strings.ToLower(hash.Content) == a.SHA256 {
+				hashed = true
+			}
+		}
+		if !hashed {
+			return false
+		}
+		if a.Package == "" {
+			return true
+		}
+	}
+
+	if component.Type != "library" || !strings.EqualFold(component.Name, a.Package) {
+		return false
+	}
+	if len(a.ranges) == 0 {
+		return true
+	}
+	version, err := parseVersion(component.Version)
+	if err != nil {
+		return false
+	}
+	for _, all := range a.ranges {
+		satisfied := true
+		for _, c := range all {
+			if !c.allows(version) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// constraint is one comparison of a version range
+type constraint struct {
+	op      string
+	version []int
+}
+
+func (c constraint) allows(version []int) bool {
+	cmp := compareVersions(version, c.version)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// parseRanges parses ranges separated by ||, each a list of constraints
+// that must all hold, separated by spaces or commas
+func parseRanges(versions string) ([][]constraint, error) {
+	var ranges [][]constraint
+	for _, alternative := range strings.Split(versions, "||") {
+		fields := strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' })
+		if len(fields) == 0 {
+			continue
+		}
+		var all []constraint
+		for _, field := range fields {
+			op := field[:len(field)-len(strings.TrimLeft(field, "<>="))]
+			switch op {
+			case "", "=", "<", "<=", ">", ">=":
+			default:
+				return nil, fmt.Errorf("invalid version constraint %q", field)
+			}
+			version, err := parseVersion(field[len(op):])
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, constraint{op: op, version: version})
+		}
+		ranges = append(ranges, all)
+	}
+	return ranges, nil
+}
+
+// parseVersion reads the numeric part of a version such as v1.2.3-beta.1;
+// pre-release and build suffixes are ignored
+func parseVersion(version string) ([]int, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if end := strings.IndexAny(trimmed, "-+"); end != -1 {
+		trimmed = trimmed[:end]
+	}
+	if trimmed == "" {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+	var parts []int
+	for _, part := range strings.Split(trimmed, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+// compareVersions compares versions part by part, missing parts counting as 0
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package advisory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/sbom"
+)
+
+const testFeed = `{"advisories": [
+  {"id": "CVE-2020-11022", "package": "jQuery", "versions": ">=1.2.0 <3.5.0", "severity": "medium", "summary": "XSS in htmlPrefilter"},
+  {"id": "LIV-2024-0001", "package": "engine", "versions": "<1.0.0 || 1.4.2", "severity": "critical", "summary": "Sandbox escape"},
+  {"id": "LIV-2024-0002", "sha256": "ABCDEF", "summary": "Tampered analytics bundle"}
+]}`
+
+func testBOM() *sbom.BOM {
+	return &sbom.BOM{Components: []*sbom.Component{
+		{BOMRef: "content/scripts/jquery.min.js", Type: "library", Name: "jquery", Version: "3.4.1"},
+		{BOMRef: "content/scripts/jquery-new.min.js", Type: "library", Name: "jquery", Version: "3.5.0"},
+		{BOMRef: "wasm/engine.wasm", Type: "library", Name: "engine", Version: "1.4.2"},
+		{BOMRef: "content/scripts/analytics.js", Type: "file", Name: "content/scripts/analytics.js", Hashes: []*sbom.Hash{{Alg: "SHA-256", Content: "abcdef"}}},
+		{BOMRef: "content/styles/jquery.css", Type: "file", Name: "jquery"},
+	}}
+}
+
+func TestCheck(t *testing.T) {
+	feed, err := ParseFeed(strings.NewReader(testFeed))
+	if err != nil {
+		t.Fatalf("ParseFeed failed: %v", err)
+	}
+	if feed.Advisories[2].Severity != SeverityHigh {
+		t.Errorf("Expected advisories without a severity to be high, got %s", feed.Advisories[2].Severity)
+	}
+
+	report := Check(testBOM(), feed)
+	if report.ComponentsChecked != 5 {
+		t.Errorf("Expected 5 components checked, got %d", report.ComponentsChecked)
+	}
+	var matched []string
+	for _, finding := range report.Findings {
+		matched = append(matched, finding.Advisory.ID+" "+finding.Path)
+	}
+	expected := []string{
+		"LIV-2024-0001 wasm/engine.wasm",
+		"LIV-2024-0002 content/scripts/analytics.js",
+		"CVE-2020-11022 content/scripts/jquery.min.js",
+	}
+	if strings.Join(matched, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected findings %v, got %v", expected, matched)
+	}
+
+	if len(report.Blocking(PolicyWarn)) != 0 || len(report.Blocking(PolicyStrict)) != 3 {
+		t.Errorf("Expected only the strict policy to block")
+	}
+}
+
+func TestParseFeedRejectsInvalidAdvisories(t *testing.T) {
+	for _, feed := range []string{
+		`{"advisories": [{"package": "jquery"}]}`,
+		`{"advisories": [{"id": "A"}]}`,
+		`{"advisories": [{"id": "A", "package": "jquery", "severity": "urgent"}]}`,
+		`{"advisories": [{"id": "A", "package": "jquery", "versions": "~3.4"}]}`,
+		`{"advisories": [{"id": "A", "package": "jquery", "versions": "<three"}]}`,
+		`not json`,
+	} {
+		if _, err := ParseFeed(strings.NewReader(feed)); err == nil {
+			t.Errorf("Expected %s to be refused", feed)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if policy, err := ParsePolicy(""); err != nil || policy != PolicyStrict {
+		t.Errorf("Expected the default policy to be strict, got %s: %v", policy, err)
+	}
+	if policy, err := ParsePolicy("WARN"); err != nil || policy != PolicyWarn {
+		t.Errorf("Expected warn, got %s: %v", policy, err)
+	}
+	if _, err := ParsePolicy("lenient"); err == nil {
+		t.Errorf("Expected unknown policies to be refused")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2", "1.2.0", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"3.4.1", "3.5.0", -1},
+		{"2.0.0-beta.1", "2.0.0", 0},
+	}
+	for _, test := range tests {
+		a, err := parseVersion(test.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parseVersion(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := compareVersions(a, b); got != test.expected {
+			t.Errorf("compareVersions(%s, %s) = %d, expected %d", test.a, test.b, got, test.expected)
+		}
+	}
+}
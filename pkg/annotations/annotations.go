@@ -0,0 +1,217 @@
+// Package annotations holds the annotations readers make on LIV documents:
+// highlights of quoted text, sticky notes and freehand drawings. Viewers keep
+// them in a Store by document, export them as a sidecar file next to the
+// document, and may embed them in a new revision of the document.
+package annotations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
+// Kinds of annotation
+const (
+	// KindHighlight marks quoted text of a page
+	KindHighlight = "highlight"
+	// KindNote is a sticky note placed on a page
+	KindNote = "note"
+	// KindFreehand is a line drawn on a page
+	KindFreehand = "freehand"
+)
+
+const (
+	// SidecarFormat names the sidecar file format
+	SidecarFormat = "liv-annotations"
+	// SidecarVersion is the version of the sidecar format written
+	SidecarVersion = 1
+	// SidecarExtension is the extension of sidecar files, after the name of
+	// the document they annotate
+	SidecarExtension = ".annotations.json"
+	// EntryPath is where a package embeds its annotations
+	EntryPath = "annotations/annotations.json"
+)
+
+// Limits on what an annotation holds
+const (
+	MaxText        = 10000
+	MaxQuote       = 2000
+	MaxPoints      = 5000
+	MaxAnnotations = 1000
+)
+
+// ErrNotFound is returned for annotations that do not exist
+var ErrNotFound = errors.New("annotation not found")
+
+// ErrTooMany is returned when a document has MaxAnnotations annotations
+var ErrTooMany = fmt.Errorf("documents may have at most %d annotations", MaxAnnotations)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Annotation is a highlight, note or freehand drawing on a page of a document
+type Annotation struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Target is the package path of the page annotated
+	Target string `json:"target"`
+	// Quote is the text a highlight marks, or a note is attached to
+	Quote *TextQuote `json:"quote,omitempty"`
+	// Position places a note on the page
+	Position *Point `json:"position,omitempty"`
+	// Points are the line of a freehand drawing
+	Points []Point `json:"points,omitempty"`
+	// Width is the width of a freehand line in CSS pixels
+	Width float64 `json:"width,omitempty"`
+	// Text is the text of a note, or a comment on a highlight
+	Text     string    `json:"text,omitempty"`
+	Color    string    `json:"color,omitempty"`
+	Author   string    `json:"author,omitempty"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+}
+
+// TextQuote selects text by quoting it, with the text before and after it
+// telling repeated quotes apart, as the W3C Web Annotation
+// TextQuoteSelector does
+type TextQuote struct {
+	Exact  string `json:"exact"`
+	Prefix string `json:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+}
+
+// Point is a place on a page, as fractions of its width and height, so
+// annotations stay in place at any zoom or window size
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Validate checks that an annotation has what its kind needs
+func (a *Annotation) Validate() error {
+	if a.Target == "" {
+		return fmt.Errorf("annotation has no target page")
+	}
+	switch a.Kind {
+	case KindHighlight:
+		if a.Quote == nil || a.Quote.Exact == "" {
+			return fmt.Errorf("highlights need quoted text")
+		}
+	case KindNote:
+		if a.Text == "" {
+			return fmt.Errorf("notes need text")
+		}
+		if a.Position == nil && (a.Quote == nil || a.Quote.Exact == "") {
+			return fmt.Errorf("notes need a position or quoted text")
+		}
+	case KindFreehand:
+		if len(a.Points) < 2 {
+			return fmt.Errorf("freehand drawings need at least 2 points")
+		}
+		if len(a.Points) > MaxPoints {
+			return fmt.Errorf("freehand drawings may have at most %d points", MaxPoints)
+		}
+		if a.Width < 0 || a.Width > 50 {
+			return fmt.Errorf("line width %v is not between 0 and 50", a.Width)
+		}
+	default:
+		return fmt.Errorf("unknown annotation kind %q", a.Kind)
+	}
+
+	if len(a.Text) > MaxText {
+		return fmt.Errorf("annotation text is longer than %d bytes", MaxText)
+	}
+	if a.Quote != nil && len(a.Quote.Exact)+len(a.Quote.Prefix)+len(a.Quote.Suffix) > MaxQuote {
+		return fmt.Errorf("quoted text is longer than %d bytes", MaxQuote)
+	}
+	if a.Color != "" && !colorPattern.MatchString(a.Color) {
+		return fmt.Errorf("color %q is not of the form #rrggbb", a.Color)
+	}
+	points := a.Points
+	if a.Position != nil {
+		points = append([]Point{*a.Position}, points...)
+	}
+	for _, p := range points {
+		if !onPage(p.X) || !onPage(p.Y) {
+			return fmt.Errorf("point (%v, %v) is not on the page", p.X, p.Y)
+		}
+	}
+	return nil
+}
+
+func onPage(v float64) bool {
+	return !math.IsNaN(v) && v >= 0 && v <= 1
+}
+
+// DocumentRef identifies the document a sidecar annotates
+type DocumentRef struct {
+	Filename string `json:"filename,omitempty"`
+	Title    string `json:"title,omitempty"`
+	// SHA256 is the digest of the package annotated
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Sidecar is the file annotations are exported as, and embedded in packages
+// as
+type Sidecar struct {
+	Format      string        `json:"format"`
+	Version     int           `json:"version"`
+	Document    DocumentRef   `json:"document"`
+	Exported    time.Time     `json:"exported"`
+	Annotations []*Annotation `json:"annotations"`
+}
+
+// NewSidecar returns the sidecar of a document's annotations
+func NewSidecar(document DocumentRef, annotations []*Annotation, now time.Time) *Sidecar {
+	if annotations == nil {
+		annotations = []*Annotation{}
+	}
+	return &Sidecar{
+		Format:      SidecarFormat,
+		Version:     SidecarVersion,
+		Document:    document,
+		Exported:    now.UTC(),
+		Annotations: annotations,
+	}
+}
+
+// Validate checks the format of a sidecar and each of its annotations
+func (s *Sidecar) Validate() error {
+	if s.Format != SidecarFormat {
+		return fmt.Errorf("not a %s file", SidecarFormat)
+	}
+	if s.Version < 1 || s.Version > SidecarVersion {
+		return fmt.Errorf("unsupported %s version %d", SidecarFormat, s.Version)
+	}
+	if len(s.Annotations) > MaxAnnotations {
+		return ErrTooMany
+	}
+	ids := make(map[string]bool, len(s.Annotations))
+	for i, a := range s.Annotations {
+		if a == nil {
+			return fmt.Errorf("annotation %d is empty", i+1)
+		}
+		if a.ID == "" || ids[a.ID] {
+			return fmt.Errorf("annotation %d has a missing or duplicate id", i+1)
+		}
+		ids[a.ID] = true
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("annotation %s: %w", a.ID, err)
+		}
+	}
+	return nil
+}
+
+// ParseSidecar reads and validates a sidecar file
+func ParseSidecar(data []byte) (*Sidecar, error) {
+	var sidecar Sidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return nil, fmt.Errorf("invalid %s file: %v", SidecarFormat, err)
+	}
+	if err := sidecar.Validate(); err != nil {
+		return nil, err
+	}
+	return &sidecar, nil
+}
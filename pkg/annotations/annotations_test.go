@@ -0,0 +1,165 @@
+package annotations
+
+import (
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+)
+
+const document = "0123456789abcdef0123456789abcdef"
+
+func highlight() *Annotation {
+	return &Annotation{Kind: KindHighlight, Target: "content/index.html", Quote: &TextQuote{Exact: "revenue grew", Prefix: "In 2024 "}, Color: "#ffe066"}
+}
+
+func TestAnnotationValidate(t *testing.T) {
+	valid := []*Annotation{
+		highlight(),
+		{Kind: KindNote, Target: "content/index.html", Text: "Check this", Position: &Point{X: 0.5, Y: 0.1}},
+		{Kind: KindFreehand, Target: "content/index.html", Points: []Point{{0.1, 0.1}, {0.2, 0.3}}, Width: 2},
+	}
+	for _, a := range valid {
+		if err := a.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", a, err)
+		}
+	}
+
+	invalid := map[string]*Annotation{
+		"quoted text":        {Kind: KindHighlight, Target: "content/index.html"},
+		"notes need text":    {Kind: KindNote, Target: "content/index.html", Position: &Point{}},
+		"at least 2 points":  {Kind: KindFreehand, Target: "content/index.html", Points: []Point{{0.1, 0.1}}},
+		"not on the page":    {Kind: KindNote, Target: "content/index.html", Text: "x", Position: &Point{X: 1.5}},
+		"#rrggbb":            {Kind: KindHighlight, Target: "content/index.html", Quote: &TextQuote{Exact: "x"}, Color: "red"},
+		"unknown annotation": {Kind: "stamp", Target: "content/index.html"},
+		"no target page":     {Kind: KindHighlight, Quote: &TextQuote{Exact: "x"}},
+	}
+	for expected, a := range invalid {
+		if err := a.Validate(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q for %+v, got %v", expected, a, err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed, err := s.List(document); err != nil || len(listed) != 0 {
+		t.Fatalf("Expected no annotations, got %v, %v", listed, err)
+	}
+
+	added, err := s.Add(document, highlight())
+	if err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if added.ID == "" || added.Created.IsZero() {
+		t.Errorf("Expected an ID and creation time, got %+v", added)
+	}
+	if _, err := s.Add(document, &Annotation{Kind: KindNote, Target: "content/index.html"}); err == nil {
+		t.Errorf("Expected an invalid annotation to be refused")
+	}
+
+	change := *added
+	change.Text = "Up 12%"
+	change.Kind = KindNote
+	updated, err := s.Update(document, &change)
+	if err != nil || updated.Text != "Up 12%" || updated.Kind != KindHighlight {
+		t.Errorf("Expected the text updated and the kind kept, got %+v, %v", updated, err)
+	}
+
+	reopened, _ := NewStore(s.dir)
+	if listed, err := reopened.List(document); err != nil || len(listed) != 1 || listed[0].Text != "Up 12%" {
+		t.Errorf("Expected the annotation to persist, got %v, %v", listed, err)
+	}
+
+	if err := s.Delete(document, added.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if err := s.Delete(document, added.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.List("../secrets"); err == nil {
+		t.Errorf("Expected an invalid document ID to be refused")
+	}
+}
+
+func packageFiles(t *testing.T) map[string][]byte {
+	t.Helper()
+	page := []byte("<!DOCTYPE html><html><body><p>In 2024 revenue grew.</p></body></html>")
+	builder := manifest.NewManifestBuilder()
+	builder.CreateDefaultMetadata("Annual Report", "Test Author").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: integrity.NewResourceHasher(integrity.SHA256).HashBytes(page),
+		Size: int64(len(page)),
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	data, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string][]byte{
+		"manifest.json":          data,
+		"content/index.html":     page,
+		"signatures/content.sig": []byte("stale"),
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	a := highlight()
+	a.ID = "a1"
+	sidecar := NewSidecar(DocumentRef{Filename: "report.liv"}, []*Annotation{a}, time.Now())
+
+	sm := integrity.NewSignatureManager()
+	keys, err := sm.GenerateSigningKeyPair(integrity.AlgorithmECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := packageFiles(t)
+	if err := Embed(files, sidecar, EmbedOptions{Key: keys.PrivateKey, Signer: core.SignerInfo{Name: "Ada Reviewer"}}); err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+
+	embedded, err := Embedded(files)
+	if err != nil || embedded == nil || len(embedded.Annotations) != 1 || embedded.Annotations[0].ID != "a1" {
+		t.Fatalf("Expected the annotations embedded, got %+v, %v", embedded, err)
+	}
+	m, result := manifest.NewManifestValidator().ValidateManifestJSON(files["manifest.json"])
+	if !result.IsValid {
+		t.Fatalf("Expected a valid manifest, got %v", result.Errors)
+	}
+	if errs := integrity.NewResourceHasher(integrity.SHA256).VerifyResources(m, files); len(errs) > 0 {
+		t.Errorf("Expected the resources to match the manifest, got %v", errs)
+	}
+
+	signatures, err := container.ReadSignatureFiles(files)
+	if err != nil || signatures.ContentSignature == "stale" {
+		t.Fatalf("Expected the stale signature replaced, got %+v, %v", signatures, err)
+	}
+	revision := &core.LIVDocument{
+		Manifest:    m,
+		Content:     &core.DocumentContent{HTML: string(files["content/index.html"])},
+		WASMModules: map[string][]byte{},
+		Signatures:  signatures,
+	}
+	verified := sm.VerifySigners(revision, []crypto.PublicKey{keys.PublicKey})
+	if verified[0].Status != integrity.SignerValid || verified[0].Signer.Name != "Ada Reviewer" {
+		t.Errorf("Expected the revision signed by the reviewer, got %+v", verified[0])
+	}
+
+	unsigned := packageFiles(t)
+	if err := Embed(unsigned, sidecar, EmbedOptions{}); err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+	if _, signed := unsigned["signatures/content.sig"]; signed {
+		t.Errorf("Expected an unsigned revision without signatures")
+	}
+}
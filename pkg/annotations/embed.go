@@ -0,0 +1,123 @@
+package annotations
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+)
+
+// EmbedOptions sign the revision Embed makes. Without a key the revision is
+// unsigned.
+type EmbedOptions struct {
+	Key    crypto.Signer
+	Signer core.SignerInfo
+	Now    time.Time
+}
+
+// Embed makes the files of a package a new revision holding the annotations
+// of a sidecar at EntryPath, listed in the manifest like any resource. The
+// signatures of the earlier revision no longer match and are removed; with
+// a key the revision is signed, as liv sign does, so the signature covers
+// the annotations too.
+func Embed(files map[string][]byte, sidecar *Sidecar, opts EmbedOptions) error {
+	if err := sidecar.Validate(); err != nil {
+		return err
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	validator := manifest.NewManifestValidator()
+	m, result := validator.ValidateManifestJSON(files["manifest.json"])
+	if !result.IsValid {
+		return fmt.Errorf("invalid manifest: %v", result.Errors)
+	}
+
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize annotations: %v", err)
+	}
+	files[EntryPath] = data
+	m.Resources[EntryPath] = &core.Resource{
+		Hash: integrity.NewResourceHasher(integrity.SHA256).HashBytes(data),
+		Size: int64(len(data)),
+		Type: "application/json",
+		Path: EntryPath,
+	}
+	m.Metadata.Modified = core.UTC(opts.Now)
+	if m.Metadata.Modified.Before(m.Metadata.Created) {
+		m.Metadata.Modified = m.Metadata.Created
+	}
+
+	for entry := range files {
+		if strings.HasPrefix(entry, "signatures/") {
+			delete(files, entry)
+		}
+	}
+
+	var signatures *core.SignatureBundle
+	if opts.Key != nil {
+		if signatures, err = sign(m, files, opts); err != nil {
+			return err
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %v", err)
+	}
+	files["manifest.json"] = manifestData
+	if signatures != nil {
+		for entry, data := range container.SignatureFiles(signatures) {
+			files[entry] = data
+		}
+	}
+	return nil
+}
+
+// Embedded returns the annotations a package embeds, or nil
+func Embedded(files map[string][]byte) (*Sidecar, error) {
+	data, exists := files[EntryPath]
+	if !exists {
+		return nil, nil
+	}
+	return ParseSidecar(data)
+}
+
+// sign signs a revision as liv sign does
+func sign(m *core.Manifest, files map[string][]byte, opts EmbedOptions) (*core.SignatureBundle, error) {
+	document := &core.LIVDocument{
+		Manifest: m,
+		Content: &core.DocumentContent{
+			HTML:            string(files["content/index.html"]),
+			CSS:             string(files["content/styles/main.css"]),
+			InteractiveSpec: string(files["content/scripts/main.js"]),
+			StaticFallback:  string(files["content/static/fallback.html"]),
+		},
+		WASMModules: make(map[string][]byte),
+	}
+	for name, data := range files {
+		if path.Ext(name) == ".wasm" {
+			document.WASMModules[strings.TrimSuffix(path.Base(name), ".wasm")] = data
+		}
+	}
+
+	sm := integrity.NewSignatureManager()
+	signatures, err := sm.SignDocument(document, opts.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign revision: %v", err)
+	}
+	signer := opts.Signer
+	signer.KeyID = sm.KeyID(opts.Key.Public())
+	signer.SignedAt = core.UTC(opts.Now)
+	signatures.Signer = &signer
+	return signatures, nil
+}
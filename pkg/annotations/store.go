@@ -0,0 +1,183 @@
+package annotations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// Store keeps the annotations of stored documents in a directory, one
+// <document id>.json file per document. It is safe for concurrent use.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore opens the annotations kept in dir
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create annotation directory: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// List returns the annotations of a document in the order they were made
+func (s *Store) List(document string) ([]*Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(document)
+}
+
+// Add records a new annotation of a document, giving it an ID and its
+// creation time
+func (s *Store) Add(document string, a *Annotation) (*Annotation, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	id, err := store.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	annotations, err := s.read(document)
+	if err != nil {
+		return nil, err
+	}
+	if len(annotations) >= MaxAnnotations {
+		return nil, ErrTooMany
+	}
+	added := *a
+	added.ID = id
+	added.Created = core.UTC(time.Now())
+	added.Modified = added.Created
+	if err := s.write(document, append(annotations, &added)); err != nil {
+		return nil, err
+	}
+	return &added, nil
+}
+
+// Get returns an annotation of a document
+func (s *Store) Get(document, id string) (*Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	annotations, err := s.read(document)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range annotations {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Update replaces an annotation of a document, keeping its ID, kind, author
+// and creation time
+func (s *Store) Update(document string, a *Annotation) (*Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	annotations, err := s.read(document)
+	if err != nil {
+		return nil, err
+	}
+	for i, existing := range annotations {
+		if existing.ID != a.ID {
+			continue
+		}
+		updated := *a
+		updated.Kind = existing.Kind
+		updated.Author = existing.Author
+		updated.Created = existing.Created
+		updated.Modified = core.UTC(time.Now())
+		if err := updated.Validate(); err != nil {
+			return nil, err
+		}
+		annotations[i] = &updated
+		if err := s.write(document, annotations); err != nil {
+			return nil, err
+		}
+		return &updated, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Delete removes an annotation of a document
+func (s *Store) Delete(document, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	annotations, err := s.read(document)
+	if err != nil {
+		return err
+	}
+	for i, a := range annotations {
+		if a.ID == id {
+			return s.write(document, append(annotations[:i], annotations[i+1:]...))
+		}
+	}
+	return ErrNotFound
+}
+
+// DeleteDocument removes the annotations of a document
+func (s *Store) DeleteDocument(document string) error {
+	if !store.ValidID(document) {
+		return store.ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(document)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove annotations: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) path(document string) string {
+	return filepath.Join(s.dir, document+".json")
+}
+
+func (s *Store) read(document string) ([]*Annotation, error) {
+	if !store.ValidID(document) {
+		return nil, store.ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(document))
+	if errors.Is(err, os.ErrNotExist) {
+		return []*Annotation{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read annotations: %v", err)
+	}
+	var annotations []*Annotation
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		return nil, fmt.Errorf("failed to parse annotations of %s: %v", document, err)
+	}
+	return annotations, nil
+}
+
+// write replaces a document's annotations through a temporary file, so a
+// crash leaves the old or the new annotations
+func (s *Store) write(document string, annotations []*Annotation) error {
+	if len(annotations) == 0 {
+		if err := os.Remove(s.path(document)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove annotations: %v", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(annotations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize annotations: %v", err)
+	}
+	if err := atomicfile.WriteFile(s.path(document), data, 0600); err != nil {
+		return fmt.Errorf("failed to write annotations: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,571 @@
+// Package anonymize prepares double-blind review copies of LIV documents. It
+// strips author metadata, acknowledgments and identifying strings from the
+// manifest and content, and keeps what it removed in a mapping that is sealed
+// with a passphrase so the identity can be restored after review.
+package anonymize
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/encryption"
+	"golang.org/x/net/html"
+)
+
+const (
+	// FormatVersion identifies the mapping format
+	FormatVersion = "liv-identity-mapping/1"
+
+	// Extension is the file extension of sealed mappings
+	Extension = ".livmap"
+
+	// IdentifyingAttribute marks an element whose contents are removed from
+	// review copies, such as a byline or a self-citation
+	IdentifyingAttribute = "data-liv-identifying"
+
+	// Replacement stands in for identifying strings
+	Replacement = "[anonymized]"
+
+	// RemovedText stands in for removed elements and acknowledgments
+	RemovedText = "[Removed for review]"
+
+	// AnonymousAuthor is the byline of review copies
+	AnonymousAuthor = "Anonymous"
+
+	// mappingResource names the sealed mapping for encryption
+	mappingResource = "mapping.json"
+)
+
+var (
+	// acknowledgmentsHeading matches the heading of an acknowledgments section
+	acknowledgmentsHeading = regexp.MustCompile(`(?i)^\s*(acknowledge?ments?|funding)\s*:?\s*$`)
+	// acknowledgmentsName matches the id or class of an acknowledgments element
+	acknowledgmentsName = regexp.MustCompile(`(?i)acknowledge?ments?`)
+)
+
+// textExtensions are the resources searched for identifying strings besides HTML
+var textExtensions = map[string]bool{
+	".css": true, ".js": true, ".json": true, ".md": true, ".txt": true, ".svg": true, ".xml": true, ".csv": true,
+}
+
+// Mapping records what was removed from a review copy so its identity can be
+// restored
+type Mapping struct {
+	Format  string    `json:"format"`
+	Created time.Time `json:"created"`
+	// Metadata, License and Compliance are the manifest sections as they were
+	Metadata   *core.DocumentMetadata `json:"metadata"`
+	License    *core.LicenseInfo      `json:"license,omitempty"`
+	Compliance *core.ComplianceInfo   `json:"compliance,omitempty"`
+	// Originals holds the original content of each resource that was changed
+	Originals map[string][]byte `json:"originals"`
+	// Anonymized holds the SHA-256 of each changed resource in the review copy
+	Anonymized map[string]string `json:"anonymized"`
+}
+
+// Report summarizes what was removed from a review copy
+type Report struct {
+	// Files are the resources that were changed
+	Files []string
+	// Replacements counts the identifying strings replaced, by string
+	Replacements map[string]int
+	// Sections is the number of acknowledgments and marked elements removed
+	Sections int
+}
+
+// LoadPatterns reads identifying patterns from a file
+func LoadPatterns(path string) ([]*regexp.Regexp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open patterns: %v", err)
+	}
+	defer file.Close()
+	return ParsePatterns(file)
+}
+
+// ParsePatterns reads identifying patterns, one regular expression per line.
+// Blank lines and lines starting with # are skipped. Patterns match case
+// sensitively unless they start with (?i).
+func ParsePatterns(r io.Reader) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		pattern, err := regexp.Compile(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern on line %d: %v", line, err)
+		}
+		if pattern.MatchString("") {
+			return nil, fmt.Errorf("pattern on line %d matches empty text", line)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read patterns: %v", err)
+	}
+	return patterns, nil
+}
+
+// Anonymize turns an extracted package into a review copy in place. The
+// authors, funding, publication details, license holder and waiver approvers
+// are removed from the manifest, and their names, affiliations, email
+// addresses, ORCID iDs and grant numbers are replaced wherever they appear in
+// HTML and text resources, along with anything matching patterns.
+// Acknowledgments sections and elements marked with data-liv-identifying are
+// replaced with a placeholder. Resource hashes in the manifest are updated.
+//
+// Binary resources such as images are left as they are; metadata embedded in
+// them is not removed.
+func Anonymize(files map[string][]byte, manifest *core.Manifest, patterns []*regexp.Regexp) (*Mapping, *Report, error) {
+	if manifest == nil || manifest.Metadata == nil {
+		return nil, nil, fmt.Errorf("manifest has no metadata")
+	}
+
+	mapping := &Mapping{
+		Format:     FormatVersion,
+		Created:    time.Now().UTC(),
+		Originals:  make(map[string][]byte),
+		Anonymized: make(map[string]string),
+	}
+	if err := copyJSON(manifest.Metadata, &mapping.Metadata); err != nil {
+		return nil, nil, err
+	}
+	if err := copyJSON(manifest.License, &mapping.License); err != nil {
+		return nil, nil, err
+	}
+	if err := copyJSON(manifest.Compliance, &mapping.Compliance); err != nil {
+		return nil, nil, err
+	}
+
+	r := newReplacer(identifyingTerms(manifest), patterns)
+	report := &Report{Replacements: r.counts}
+
+	metadata := manifest.Metadata
+	metadata.Author = AnonymousAuthor
+	metadata.Authors = nil
+	metadata.Funding = nil
+	metadata.Publication = nil
+	metadata.Title = r.replace(metadata.Title)
+	metadata.Description = r.replace(metadata.Description)
+	metadata.Abstract = r.replace(metadata.Abstract)
+	if manifest.License != nil {
+		manifest.License.Holder = ""
+	}
+	if manifest.Compliance != nil {
+		for _, waiver := range manifest.Compliance.Waivers {
+			waiver.ApprovedBy = AnonymousAuthor
+		}
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if path == "manifest.json" {
+			continue
+		}
+		original := files[path]
+		var anonymized []byte
+		switch ext := strings.ToLower(filepath.Ext(path)); {
+		case ext == ".html" || ext == ".htm":
+			data, sections, err := r.anonymizeHTML(original)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to anonymize %s: %v", path, err)
+			}
+			anonymized = data
+			report.Sections += sections
+		case textExtensions[ext] && utf8.Valid(original):
+			anonymized = []byte(r.replace(string(original)))
+		default:
+			continue
+		}
+		if bytes.Equal(anonymized, original) {
+			continue
+		}
+
+		files[path] = anonymized
+		mapping.Originals[path] = original
+		mapping.Anonymized[path] = sha256Hex(anonymized)
+		report.Files = append(report.Files, path)
+		if resource, ok := manifest.Resources[path]; ok {
+			resource.Hash = sha256Hex(anonymized)
+			resource.Size = int64(len(anonymized))
+		}
+	}
+
+	return mapping, report, nil
+}
+
+// Restore puts the identity removed by Anonymize back into a review copy. It
+// fails if any resource Anonymize changed has been changed since, as the
+// originals would then overwrite later edits. The restored document must be
+// signed again.
+func Restore(files map[string][]byte, manifest *core.Manifest, mapping *Mapping) error {
+	if mapping.Format != FormatVersion {
+		return fmt.Errorf("unsupported mapping format %q", mapping.Format)
+	}
+	if manifest == nil || manifest.Metadata == nil || mapping.Metadata == nil {
+		return fmt.Errorf("manifest has no metadata")
+	}
+	for path, sum := range mapping.Anonymized {
+		data, exists := files[path]
+		if !exists {
+			return fmt.Errorf("%s is missing from the document", path)
+		}
+		if sha256Hex(data) != sum {
+			return fmt.Errorf("%s was changed after the document was anonymized", path)
+		}
+		if _, exists := mapping.Originals[path]; !exists {
+			return fmt.Errorf("mapping has no original for %s", path)
+		}
+	}
+
+	for path, original := range mapping.Originals {
+		files[path] = original
+		if resource, ok := manifest.Resources[path]; ok {
+			resource.Hash = sha256Hex(original)
+			resource.Size = int64(len(original))
+		}
+	}
+	modified := manifest.Metadata.Modified
+	manifest.Metadata = mapping.Metadata
+	manifest.Metadata.Modified = modified
+	manifest.License = mapping.License
+	manifest.Compliance = mapping.Compliance
+	return nil
+}
+
+// sealedMapping is the file format of a sealed mapping
+type sealedMapping struct {
+	Format     string               `json:"format"`
+	Encryption *core.EncryptionInfo `json:"encryption"`
+	Data       []byte               `json:"data"`
+}
+
+// Seal encrypts a mapping with a passphrase
+func Seal(mapping *Mapping, passphrase string) ([]byte, error) {
+	plaintext, err := json.Marshal(mapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize mapping: %v", err)
+	}
+
+	key, err := encryption.GenerateContentKey()
+	if err != nil {
+		return nil, err
+	}
+	encryptor, err := encryption.NewEncryptor(key, encryption.DefaultChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, resource, err := encryptor.EncryptResource(mappingResource, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt mapping: %v", err)
+	}
+	recipient, err := encryption.WrapKeyWithPassword(key, passphrase, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&sealedMapping{
+		Format: FormatVersion,
+		Encryption: &core.EncryptionInfo{
+			Algorithm:  encryption.AlgorithmAES256GCM,
+			ChunkSize:  encryptor.ChunkSize(),
+			Recipients: []*core.KeyRecipient{recipient},
+			Resources:  map[string]*core.EncryptedResource{mappingResource: resource},
+		},
+		Data: ciphertext,
+	}, "", "  ")
+}
+
+// Unseal decrypts a mapping sealed with Seal
+func Unseal(data []byte, passphrase string) (*Mapping, error) {
+	var sealed sealedMapping
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %v", err)
+	}
+	if sealed.Format != FormatVersion {
+		return nil, fmt.Errorf("unsupported mapping format %q", sealed.Format)
+	}
+	if sealed.Encryption == nil || sealed.Encryption.Resources[mappingResource] == nil {
+		return nil, fmt.Errorf("mapping has no encryption parameters")
+	}
+
+	key, err := encryption.UnwrapKeyWithPassword(sealed.Encryption, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal mapping: %v", err)
+	}
+	encryptor, err := encryption.NewEncryptor(key, sealed.Encryption.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := encryptor.DecryptResource(mappingResource, sealed.Data, sealed.Encryption.Resources[mappingResource])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt mapping: %v", err)
+	}
+
+	var mapping Mapping
+	if err := json.Unmarshal(plaintext, &mapping); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %v", err)
+	}
+	return &mapping, nil
+}
+
+// identifyingTerms returns the strings in a manifest that identify its authors
+func identifyingTerms(manifest *core.Manifest) []string {
+	metadata := manifest.Metadata
+	terms := []string{metadata.Author}
+	for _, author := range metadata.Authors {
+		if author == nil {
+			continue
+		}
+		terms = append(terms, author.Name, author.Affiliation, author.Email, author.ORCID, author.URL)
+		// Surnames identify authors in citations such as "Carberry et al."
+		if fields := strings.Fields(author.Name); len(fields) > 1 {
+			terms = append(terms, fields[len(fields)-1])
+		}
+	}
+	for _, grant := range metadata.Funding {
+		if grant == nil {
+			continue
+		}
+		terms = append(terms, grant.Funder, grant.FunderID)
+		terms = append(terms, grant.Awards...)
+	}
+	if publication := metadata.Publication; publication != nil {
+		terms = append(terms, publication.DOI, publication.URL, publication.Publisher)
+	}
+	if manifest.License != nil {
+		terms = append(terms, manifest.License.Holder)
+	}
+	if manifest.Compliance != nil {
+		for _, waiver := range manifest.Compliance.Waivers {
+			terms = append(terms, waiver.ApprovedBy)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		// Very short terms such as initials would match ordinary words
+		if utf8.RuneCountInString(term) < 3 || term == AnonymousAuthor || seen[strings.ToLower(term)] {
+			continue
+		}
+		seen[strings.ToLower(term)] = true
+		unique = append(unique, term)
+	}
+	return unique
+}
+
+// replacer replaces identifying strings and counts what it replaced
+type replacer struct {
+	terms    *regexp.Regexp
+	patterns []*regexp.Regexp
+	counts   map[string]int
+}
+
+func newReplacer(terms []string, patterns []*regexp.Regexp) *replacer {
+	r := &replacer{patterns: patterns, counts: make(map[string]int)}
+	if len(terms) == 0 {
+		return r
+	}
+
+	// Longer terms first, so a full name is replaced before the surname in it
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	alternatives := make([]string, len(terms))
+	for i, term := range terms {
+		alternative := regexp.QuoteMeta(term)
+		if first, _ := utf8.DecodeRuneInString(term); isWordRune(first) {
+			alternative = `\b` + alternative
+		}
+		if last, _ := utf8.DecodeLastRuneInString(term); isWordRune(last) {
+			alternative += `\b`
+		}
+		alternatives[i] = alternative
+	}
+	r.terms = regexp.MustCompile(`(?i)(?:` + strings.Join(alternatives, "|") + `)`)
+	return r
+}
+
+// replace replaces the identifying strings in text
+func (r *replacer) replace(text string) string {
+	count := func(match string) string {
+		r.counts[match]++
+		return Replacement
+	}
+	if r.terms != nil {
+		text = r.terms.ReplaceAllStringFunc(text, count)
+	}
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllStringFunc(text, count)
+	}
+	return text
+}
+
+// anonymizeHTML removes identifying elements from an HTML resource and
+// replaces identifying strings in its text and attributes
+func (r *replacer) anonymizeHTML(data []byte) ([]byte, int, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var marked, headings []*html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if isIdentifying(n) {
+			marked = append(marked, n)
+			return false
+		}
+		if headingLevel(n) > 0 && acknowledgmentsHeading.MatchString(textContent(n)) {
+			headings = append(headings, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range marked {
+		removeChildren(n)
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: RemovedText})
+	}
+	for _, heading := range headings {
+		removeSection(heading)
+	}
+
+	changed := len(marked)+len(headings) > 0
+	walk(doc, func(n *html.Node) bool {
+		switch n.Type {
+		case html.TextNode:
+			if replaced := r.replace(n.Data); replaced != n.Data {
+				n.Data = replaced
+				changed = true
+			}
+		case html.ElementNode:
+			for i, attr := range n.Attr {
+				if replaced := r.replace(attr.Val); replaced != attr.Val {
+					n.Attr[i].Val = replaced
+					changed = true
+				}
+			}
+		}
+		return true
+	})
+	if !changed {
+		return data, 0, nil
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), len(marked) + len(headings), nil
+}
+
+// isIdentifying reports whether an element is marked as identifying or is an
+// acknowledgments section by its id or class
+func isIdentifying(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case IdentifyingAttribute:
+			return true
+		case "id", "class":
+			if acknowledgmentsName.MatchString(attr.Val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeSection replaces the content following a heading, up to the next
+// heading of the same or a higher level, with a placeholder
+func removeSection(heading *html.Node) {
+	level := headingLevel(heading)
+	for next := heading.NextSibling; next != nil; {
+		if l := headingLevel(next); l > 0 && l <= level {
+			break
+		}
+		following := next.NextSibling
+		heading.Parent.RemoveChild(next)
+		next = following
+	}
+	placeholder := &html.Node{Type: html.ElementNode, Data: "p"}
+	placeholder.AppendChild(&html.Node{Type: html.TextNode, Data: RemovedText})
+	heading.Parent.InsertBefore(placeholder, heading.NextSibling)
+}
+
+func headingLevel(n *html.Node) int {
+	if n.Type != html.ElementNode || len(n.Data) != 2 || n.Data[0] != 'h' || n.Data[1] < '1' || n.Data[1] > '6' {
+		return 0
+	}
+	return int(n.Data[1] - '0')
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(n *html.Node) bool {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		return true
+	})
+	return b.String()
+}
+
+func removeChildren(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		n.RemoveChild(child)
+		child = next
+	}
+}
+
+// walk visits nodes depth-first; returning false skips the node's children
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, visit)
+	}
+}
+
+// isWordRune reports whether \b can match next to r; it only knows ASCII
+func isWordRune(r rune) bool {
+	return r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// copyJSON deep-copies src into dst through its JSON form
+func copyJSON(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
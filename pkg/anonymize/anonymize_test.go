@@ -0,0 +1,148 @@
+package anonymize
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func testDocument() (map[string][]byte, *core.Manifest) {
+	files := map[string][]byte{
+		"content/index.html": []byte(`<h1>Protein folding at scale</h1>
+<p class="byline" data-liv-identifying>Josiah Carberry, Brown University</p>
+<p>As Carberry et al. showed, folding is slow. Contact josiah@example.edu.</p>
+<p>Code: <a href="https://github.com/jcarberry/fold">repository</a></p>
+<h2>Acknowledgments</h2>
+<p>We thank the Carberry Lab.</p>
+<p>Supported by grant CHE-1234567.</p>
+<h2>References</h2>
+<p>[1] Smith, 2020.</p>`),
+		"content/data.json":          []byte(`{"contact": "Josiah Carberry"}`),
+		"content/static/fallback.md": []byte("No identifying text here."),
+		"assets/images/photo.png":    []byte("\x89PNG Josiah Carberry"),
+	}
+	manifest := &core.Manifest{
+		Version: "1.0",
+		Metadata: &core.DocumentMetadata{
+			Title:       "Protein folding at scale",
+			Author:      "Josiah Carberry",
+			Created:     time.Now(),
+			Modified:    time.Now(),
+			Description: "Work from the Brown University folding group",
+			Version:     "1.0.0",
+			Language:    "en",
+			Authors: []*core.AuthorInfo{
+				{Name: "Josiah Carberry", Affiliation: "Brown University", Email: "josiah@example.edu", ORCID: "0000-0002-1825-0097"},
+			},
+			Funding: []*core.FundingInfo{
+				{Funder: "National Science Foundation", FunderID: "10.13039/100000001", Awards: []string{"CHE-1234567"}},
+			},
+		},
+		Resources: map[string]*core.Resource{},
+		License:   &core.LicenseInfo{SPDX: "CC-BY-4.0", Holder: "Josiah Carberry"},
+	}
+	for path, data := range files {
+		manifest.Resources[path] = &core.Resource{Hash: sha256Hex(data), Size: int64(len(data)), Path: path}
+	}
+	return files, manifest
+}
+
+func TestAnonymize(t *testing.T) {
+	files, manifest := testDocument()
+	original := string(files["content/index.html"])
+	patterns, err := ParsePatterns(strings.NewReader("# Self-citations\ngithub\\.com/jcarberry\\S*\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, report, err := Anonymize(files, manifest, patterns)
+	if err != nil {
+		t.Fatalf("Anonymize failed: %v", err)
+	}
+
+	metadata := manifest.Metadata
+	if metadata.Author != AnonymousAuthor || metadata.Authors != nil || metadata.Funding != nil || manifest.License.Holder != "" {
+		t.Errorf("Expected the identifying metadata to be removed: %+v", metadata)
+	}
+	if metadata.Description != "Work from the "+Replacement+" folding group" {
+		t.Errorf("Unexpected description %q", metadata.Description)
+	}
+
+	page := string(files["content/index.html"])
+	for _, identifying := range []string{"Josiah", "Carberry", "Brown University", "josiah@example.edu", "CHE-1234567", "We thank", "github.com/jcarberry"} {
+		if strings.Contains(page, identifying) {
+			t.Errorf("Expected %q to be removed from the review copy", identifying)
+		}
+	}
+	for _, kept := range []string{"Protein folding at scale", "folding is slow", "<h2>Acknowledgments</h2>", RemovedText, "<h2>References</h2>", "Smith, 2020"} {
+		if !strings.Contains(page, kept) {
+			t.Errorf("Expected %q to be kept in the review copy", kept)
+		}
+	}
+	if string(files["content/data.json"]) != `{"contact": "`+Replacement+`"}` {
+		t.Errorf("Unexpected data %s", files["content/data.json"])
+	}
+	if string(files["assets/images/photo.png"]) != "\x89PNG Josiah Carberry" {
+		t.Errorf("Expected binary resources to be left as they are")
+	}
+	if manifest.Resources["content/index.html"].Hash != sha256Hex(files["content/index.html"]) {
+		t.Errorf("Expected the resource hash to be updated")
+	}
+	if strings.Join(report.Files, ",") != "content/data.json,content/index.html" || report.Sections != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.Replacements["Carberry"] != 1 || report.Replacements["github.com/jcarberry/fold"] != 1 {
+		t.Errorf("Unexpected replacements %v", report.Replacements)
+	}
+
+	sealed, err := Seal(mapping, "review-2024")
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if strings.Contains(string(sealed), "Carberry") {
+		t.Errorf("Expected the sealed mapping not to reveal the authors")
+	}
+	if _, err := Unseal(sealed, "wrong"); err == nil {
+		t.Errorf("Expected the wrong passphrase to be refused")
+	}
+	unsealed, err := Unseal(sealed, "review-2024")
+	if err != nil {
+		t.Fatalf("Unseal failed: %v", err)
+	}
+
+	if err := Restore(files, manifest, unsealed); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if string(files["content/index.html"]) != original || manifest.Metadata.Author != "Josiah Carberry" || len(manifest.Metadata.Funding) != 1 || manifest.License.Holder != "Josiah Carberry" {
+		t.Errorf("Expected the identity to be restored")
+	}
+	if manifest.Resources["content/index.html"].Hash != sha256Hex([]byte(original)) {
+		t.Errorf("Expected the resource hash to be restored")
+	}
+}
+
+func TestRestoreRefusesChangedDocuments(t *testing.T) {
+	files, manifest := testDocument()
+	mapping, _, err := Anonymize(files, manifest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["content/index.html"] = append(files["content/index.html"], "<p>Reviewer edit</p>"...)
+	if err := Restore(files, manifest, mapping); err == nil {
+		t.Errorf("Expected a changed review copy to be refused")
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns(strings.NewReader("\n# comment\n(?i)carberry lab\nGrant \\d+\n"))
+	if err != nil || len(patterns) != 2 {
+		t.Fatalf("Expected two patterns, got %d: %v", len(patterns), err)
+	}
+	for _, invalid := range []string{"(unclosed", "a*"} {
+		if _, err := ParsePatterns(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
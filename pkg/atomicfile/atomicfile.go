@@ -0,0 +1,185 @@
+// Package atomicfile replaces files in one step. Content is written to a
+// temporary file beside the target, synced to disk, and renamed over the
+// target, so a crash or a failed write leaves either the old file or the
+// new one, never part of either. This matters most when a tool writes its
+// output over its input.
+package atomicfile
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BackupSuffix is added to the name of the file a write replaces when
+// backups are kept
+const BackupSuffix = ".bak"
+
+// tempInfix marks the temporary files of writes in progress, named
+// .<target><tempInfix><random>
+const tempInfix = ".tmp-"
+
+// File is a replacement for a file being written. Writes go to a temporary
+// file until Commit puts it in place; Close without Commit discards it, so
+// a deferred Close cleans up after any failure.
+type File struct {
+	*os.File
+	// Backup keeps the file being replaced as its name with BackupSuffix
+	Backup bool
+
+	path   string
+	closed bool
+}
+
+// Create starts a file to replace path with, created with perm (before the
+// umask) unless it replaces a file, whose permissions it keeps. When path
+// is a symbolic link the file it points to is replaced.
+func Create(path string, perm os.FileMode) (*File, error) {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && !info.Mode().IsRegular():
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	case err == nil:
+		perm = info.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	var suffix [6]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return nil, err
+	}
+	dir, name := filepath.Split(path)
+	temp := filepath.Join(dir, "."+name+tempInfix+hex.EncodeToString(suffix[:]))
+	file, err := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		// The umask may have narrowed them
+		if err := file.Chmod(perm); err != nil {
+			file.Close()
+			os.Remove(temp)
+			return nil, err
+		}
+	}
+	return &File{File: file, path: path}, nil
+}
+
+// Path is the file being replaced
+func (f *File) Path() string {
+	return f.path
+}
+
+// Commit syncs the written content to disk and puts it in place of the
+// file being replaced
+func (f *File) Commit() error {
+	if f.closed {
+		return fmt.Errorf("%s: %w", f.path, os.ErrClosed)
+	}
+	f.closed = true
+	temp := f.File.Name()
+	err := f.File.Sync()
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && f.Backup {
+		err = Backup(f.path)
+	}
+	if err == nil {
+		err = os.Rename(temp, f.path)
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// Close discards the content unless it was committed
+func (f *File) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	err := f.File.Close()
+	os.Remove(f.File.Name())
+	return err
+}
+
+// WriteFile replaces the file at path with data, as os.WriteFile writes it
+// but in one step
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	return Write(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Write replaces the file at path with what write writes, leaving the file
+// as it was when write fails
+func Write(path string, perm os.FileMode, write func(w io.Writer) error) error {
+	file, err := Create(path, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// IsTemp reports whether name is the temporary file of a write in progress,
+// or one a crash left behind
+func IsTemp(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasPrefix(base, ".") && strings.Contains(base, tempInfix)
+}
+
+// Backup keeps a copy of the file at path, if there is one, as its name with
+// BackupSuffix. The copy is a hard link when the file system has them, which
+// stays the old file when the file is replaced.
+func Backup(path string) error {
+	backupPath := path + BackupSuffix
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.Remove(backupPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to replace backup: %w", err)
+	}
+	if err := os.Link(path, backupPath); err == nil {
+		return nil
+	}
+	return Write(backupPath, info.Mode().Perm(), func(w io.Writer) error {
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		_, err = io.Copy(w, source)
+		return err
+	})
+}
+
+// syncDir syncs a directory so a rename within it survives a crash. Not
+// every platform can sync directories, so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,118 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.liv")
+
+	if err := WriteFile(path, []byte("first"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := WriteFile(path, []byte("second"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second" {
+		t.Fatalf("Expected the file replaced, got %q: %v", data, err)
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the permissions of the replaced file kept, got %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat(path + BackupSuffix); err == nil {
+		t.Errorf("Expected no backup unless asked for")
+	}
+	assertNoTemp(t, dir)
+}
+
+func TestWriteFailureKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.liv")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("disk full")
+	err := Write(path, 0644, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "original" {
+		t.Errorf("Expected the original kept, got %q", data)
+	}
+	assertNoTemp(t, dir)
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.liv")
+	if err := os.WriteFile(path, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"v2", "v3"} {
+		file, err := Create(path, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Backup = true
+		file.Write([]byte(content))
+		if err := file.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		if err := file.Close(); err != nil {
+			t.Errorf("Expected Close after Commit to do nothing, got %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v3" {
+		t.Errorf("Expected v3, got %q", data)
+	}
+	if data, _ := os.ReadFile(path + BackupSuffix); string(data) != "v2" {
+		t.Errorf("Expected the replaced version backed up, got %q", data)
+	}
+}
+
+func TestCreateThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "report.liv")
+	link := filepath.Join(dir, "latest.liv")
+	if err := os.WriteFile(target, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+
+	if err := WriteFile(link, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected the link kept")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "v2" {
+		t.Errorf("Expected the linked file replaced, got %q", data)
+	}
+}
+
+func assertNoTemp(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if IsTemp(entry.Name()) {
+			t.Errorf("Expected no temporary files left, found %s", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Package attestation records how LIV documents were built as in-toto
+// attestations: a statement binding the digest of a package to SLSA
+// provenance that names the source tree, build parameters, steps and
+// environment, signed in a DSSE envelope. Attestations are stored next to
+// the package, since they cover its bytes.
+package attestation
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+const (
+	// StatementType is the in-toto statement version written
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType is the SLSA provenance version written
+	PredicateType = "https://slsa.dev/provenance/v1"
+	// PayloadType is the DSSE payload type of in-toto statements
+	PayloadType = "application/vnd.in-toto+json"
+	// BuildType describes the parameters of liv-builder builds
+	BuildType = "https://github.com/liv-format/liv/build/v1"
+	// BuilderID identifies liv-builder
+	BuilderID = "https://github.com/liv-format/liv/cmd/builder"
+	// Extension is appended to a package name for its attestation
+	Extension = ".intoto.jsonl"
+)
+
+// Statement is an in-toto statement about one or more artifacts
+type Statement struct {
+	Type          string      `json:"_type"`
+	Subject       []*Subject  `json:"subject"`
+	PredicateType string      `json:"predicateType"`
+	Predicate     *Provenance `json:"predicate"`
+}
+
+// Subject is an artifact a statement is about
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is a SLSA provenance predicate
+type Provenance struct {
+	BuildDefinition *BuildDefinition `json:"buildDefinition"`
+	RunDetails      *RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of a build. ExternalParameters are
+// the options the build was asked for; InternalParameters are set by the
+// builder itself: its steps and environment.
+type BuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	InternalParameters   map[string]interface{} `json:"internalParameters,omitempty"`
+	ResolvedDependencies []*ResourceDescriptor  `json:"resolvedDependencies,omitempty"`
+}
+
+// ResourceDescriptor names an input or byproduct of a build
+type ResourceDescriptor struct {
+	URI    string            `json:"uri,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// RunDetails describes the builder and the run
+type RunDetails struct {
+	Builder    *Builder              `json:"builder"`
+	Metadata   *RunMetadata          `json:"metadata,omitempty"`
+	Byproducts []*ResourceDescriptor `json:"byproducts,omitempty"`
+}
+
+// Builder identifies the builder and the versions of its components
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// RunMetadata records when a build ran
+type RunMetadata struct {
+	InvocationID string     `json:"invocationId,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// Envelope is a DSSE envelope carrying a signed statement
+type Envelope struct {
+	PayloadType string       `json:"payloadType"`
+	Payload     string       `json:"payload"`
+	Signatures  []*Signature `json:"signatures"`
+}
+
+// Signature is one signature of an envelope
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// SourceFile is a file of a source tree and its SHA-256
+type SourceFile struct {
+	Path   string
+	SHA256 string
+}
+
+// TreeDigest hashes a source tree as the SHA-256 of its sha256sum listing:
+// one "<hex digest>  <path>" line per file, sorted by path, paths relative
+// to the tree with forward slashes
+func TreeDigest(files []*SourceFile) string {
+	sorted := append([]*SourceFile(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	hash := sha256.New()
+	for _, file := range sorted {
+		fmt.Fprintf(hash, "%s  %s\n", strings.ToLower(file.SHA256), file.Path)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// HashTree returns the TreeDigest of the files under dir and their number.
+// Hidden files are skipped, as the builder does not package them.
+func HashTree(dir string) (string, int, error) {
+	var files []*SourceFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		files = append(files, &SourceFile{Path: filepath.ToSlash(relPath), SHA256: Digest(data)})
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return TreeDigest(files), len(files), nil
+}
+
+// Digest returns the SHA-256 of data in hex
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewStatement returns a statement that the artifact name with the given
+// contents was produced as the provenance describes
+func NewStatement(name string, artifact []byte, provenance *Provenance) *Statement {
+	return &Statement{
+		Type:          StatementType,
+		Subject:       []*Subject{{Name: name, Digest: map[string]string{"sha256": Digest(artifact)}}},
+		PredicateType: PredicateType,
+		Predicate:     provenance,
+	}
+}
+
+// PAE is the DSSE pre-authentication encoding of a payload, the bytes that
+// are signed
+func PAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// Sign serializes a statement into an envelope signed with privateKey.
+// RSA, ECDSA P-256 and Ed25519 keys are supported, as for document
+// signatures.
+func Sign(statement *Statement, privateKey crypto.Signer) (*Envelope, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize statement: %v", err)
+	}
+	sm := integrity.NewSignatureManager()
+	sig, err := sm.SignData(PAE(PayloadType, payload), privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []*Signature{{KeyID: sm.KeyID(privateKey.Public()), Sig: sig}},
+	}, nil
+}
+
+// Verify checks that a signature of the envelope verifies with one of keys
+// and returns its statement
+func Verify(envelope *Envelope, keys []crypto.PublicKey) (*Statement, error) {
+	if envelope.PayloadType != PayloadType {
+		return nil, fmt.Errorf("unexpected payload type %q", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %v", err)
+	}
+
+	sm := integrity.NewSignatureManager()
+	signed := PAE(envelope.PayloadType, payload)
+	verified := false
+	for _, signature := range envelope.Signatures {
+		for _, key := range keys {
+			if signature.KeyID != "" && signature.KeyID != sm.KeyID(key) {
+				continue
+			}
+			if ok, err := sm.VerifySignature(signed, signature.Sig, key); err == nil && ok {
+				verified = true
+			}
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("no signature of the attestation verifies with the given keys")
+	}
+
+	var statement Statement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("invalid statement: %v", err)
+	}
+	if statement.Type != StatementType {
+		return nil, fmt.Errorf("unsupported statement type %q", statement.Type)
+	}
+	if statement.PredicateType != PredicateType || statement.Predicate == nil || statement.Predicate.BuildDefinition == nil || statement.Predicate.RunDetails == nil {
+		return nil, fmt.Errorf("attestation carries no SLSA provenance")
+	}
+	return &statement, nil
+}
+
+// CheckSubject reports an error unless the statement covers an artifact
+// with the given contents
+func (s *Statement) CheckSubject(artifact []byte) error {
+	digest := Digest(artifact)
+	for _, subject := range s.Subject {
+		if strings.EqualFold(subject.Digest["sha256"], digest) {
+			return nil
+		}
+	}
+	return fmt.Errorf("attestation does not cover this package (sha256 %s)", digest)
+}
+
+// Dependency returns the resolved dependency with the given name
+func (s *Statement) Dependency(name string) *ResourceDescriptor {
+	for _, dependency := range s.Predicate.BuildDefinition.ResolvedDependencies {
+		if dependency.Name == name {
+			return dependency
+		}
+	}
+	return nil
+}
+
+// Marshal writes an envelope as one line of an in-toto JSON Lines bundle
+func Marshal(envelope *Envelope) ([]byte, error) {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize attestation: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Parse reads the envelopes of an in-toto JSON Lines bundle
+func Parse(data []byte) ([]*Envelope, error) {
+	var envelopes []*Envelope
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var envelope Envelope
+		if err := json.Unmarshal(line, &envelope); err != nil {
+			return nil, fmt.Errorf("invalid attestation on line %d: %v", i+1, err)
+		}
+		envelopes = append(envelopes, &envelope)
+	}
+	if len(envelopes) == 0 {
+		return nil, fmt.Errorf("no attestations found")
+	}
+	return envelopes, nil
+}
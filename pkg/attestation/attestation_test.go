@@ -0,0 +1,109 @@
+package attestation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testProvenance() *Provenance {
+	return &Provenance{
+		BuildDefinition: &BuildDefinition{
+			BuildType:          BuildType,
+			ExternalParameters: map[string]interface{}{"compress": true},
+			ResolvedDependencies: []*ResourceDescriptor{
+				{Name: "source", Digest: map[string]string{"sha256": TreeDigest([]*SourceFile{{Path: "content/index.html", SHA256: Digest([]byte("<h1>Hi</h1>"))}})}},
+			},
+		},
+		RunDetails: &RunDetails{Builder: &Builder{ID: BuilderID}},
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := []byte("PK package bytes")
+
+	envelope, err := Sign(NewStatement("report.liv", pkg, testProvenance()), key)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	data, err := Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), "\n") != 1 {
+		t.Errorf("Expected one JSON line, got %q", data)
+	}
+	envelopes, err := Parse(data)
+	if err != nil || len(envelopes) != 1 {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	statement, err := Verify(envelopes[0], []crypto.PublicKey{other.Public(), key.Public()})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if err := statement.CheckSubject(pkg); err != nil {
+		t.Errorf("Expected the package to be covered: %v", err)
+	}
+	if err := statement.CheckSubject([]byte("PK tampered")); err == nil {
+		t.Errorf("Expected another package to be refused")
+	}
+	if statement.Dependency("source") == nil || statement.Predicate.RunDetails.Builder.ID != BuilderID {
+		t.Errorf("Unexpected provenance %+v", statement.Predicate)
+	}
+
+	if _, err := Verify(envelopes[0], []crypto.PublicKey{other.Public()}); err == nil {
+		t.Errorf("Expected an unknown key to be refused")
+	}
+	envelopes[0].Payload = envelopes[0].Payload[:len(envelopes[0].Payload)-4] + "AAAA"
+	if _, err := Verify(envelopes[0], []crypto.PublicKey{key.Public()}); err == nil {
+		t.Errorf("Expected a modified payload to be refused")
+	}
+}
+
+func TestTreeDigest(t *testing.T) {
+	a := []*SourceFile{{Path: "a.html", SHA256: "AA"}, {Path: "b/c.css", SHA256: "bb"}}
+	b := []*SourceFile{{Path: "b/c.css", SHA256: "bb"}, {Path: "a.html", SHA256: "aa"}}
+	if TreeDigest(a) != TreeDigest(b) {
+		t.Errorf("Expected the digest to ignore order and case")
+	}
+	b[0].Path = "b/d.css"
+	if TreeDigest(a) == TreeDigest(b) {
+		t.Errorf("Expected a renamed file to change the digest")
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "content"), 0755)
+	os.WriteFile(filepath.Join(dir, "content", "index.html"), []byte("<h1>Hi</h1>"), 0644)
+	os.WriteFile(filepath.Join(dir, ".DS_Store"), []byte("junk"), 0644)
+
+	digest, count, err := HashTree(dir)
+	if err != nil {
+		t.Fatalf("HashTree failed: %v", err)
+	}
+	expected := TreeDigest([]*SourceFile{{Path: "content/index.html", SHA256: Digest([]byte("<h1>Hi</h1>"))}})
+	if digest != expected || count != 1 {
+		t.Errorf("Expected hidden files to be skipped, got %s for %d files", digest, count)
+	}
+}
+
+func TestPAE(t *testing.T) {
+	if got := string(PAE("http://example.com/HelloWorld", []byte("hello world"))); got != "DSSEv1 29 http://example.com/HelloWorld 11 hello world" {
+		t.Errorf("Unexpected encoding %q", got)
+	}
+}
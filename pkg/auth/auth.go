@@ -0,0 +1,186 @@
+// Package auth signs users in to the library and permission servers with local
+// accounts or an enterprise identity provider. Password providers (local
+// accounts, LDAP and Active Directory) check credentials directly; redirect
+// providers (SAML and OpenID Connect) send the browser to the identity
+// provider and accept its signed response. The groups a provider reports are
+// mapped to roles, and the signed-in identity is kept in a signed session
+// cookie.
+package auth
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Roles understood by the LIV servers
+const (
+	// RoleReader may view documents
+	RoleReader = "reader"
+	// RoleAuthor may upload documents
+	RoleAuthor = "author"
+	// RoleViewer may view policies and permissions without changing them
+	RoleViewer = "viewer"
+	// RoleAuditor may also read the audit trail and security events
+	RoleAuditor = "auditor"
+	// RoleAdmin may administer policies and read library health
+	RoleAdmin = "admin"
+)
+
+// ErrInvalidCredentials is returned when a user cannot be authenticated. It
+// does not reveal whether the user exists.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrDeactivated is returned for users deactivated in the directory
+var ErrDeactivated = errors.New("user is deactivated")
+
+// ErrNotProvisioned is returned for users missing from the directory when
+// provisioning is required
+var ErrNotProvisioned = errors.New("user is not provisioned")
+
+// Identity is an authenticated user
+type Identity struct {
+	Username string   `json:"username"`
+	Name     string   `json:"name,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	Provider string   `json:"provider"`
+	Groups   []string `json:"groups,omitempty"`
+	Roles    []string `json:"roles"`
+}
+
+// HasRole reports whether the identity holds any of roles
+func (id *Identity) HasRole(roles ...string) bool {
+	for _, held := range id.Roles {
+		for _, role := range roles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PasswordProvider authenticates users by username and password
+type PasswordProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+}
+
+// RedirectProvider authenticates users by redirecting them to an identity
+// provider, which posts the result back to the provider's callback
+type RedirectProvider interface {
+	Name() string
+	// LoginURL returns the identity provider URL to send the browser to.
+	// relayState is returned unchanged by HandleCallback.
+	LoginURL(relayState string) (string, error)
+	// HandleCallback validates the identity provider's response
+	HandleCallback(r *http.Request) (identity *Identity, relayState string, err error)
+}
+
+// MetadataProvider is implemented by redirect providers that publish metadata
+// for the identity provider to import
+type MetadataProvider interface {
+	Metadata() ([]byte, error)
+}
+
+// Directory holds users provisioned by an identity provider, such as a SCIM
+// directory. known is false for users it does not hold.
+type Directory interface {
+	Lookup(username string) (groups []string, active, known bool)
+}
+
+// RoleMapping maps directory groups to roles. Keys are matched without regard
+// to case against either the full group name reported by the provider or, for
+// LDAP distinguished names, the group's common name, so both
+// "CN=LIV Admins,OU=Groups,DC=example,DC=com" and "LIV Admins" match that
+// group.
+type RoleMapping struct {
+	Groups map[string][]string
+	// Default roles are granted to every authenticated user
+	Default []string
+}
+
+// Roles returns the sorted roles granted to members of groups
+func (m *RoleMapping) Roles(groups []string) []string {
+	return m.Grant(nil, groups)
+}
+
+// Grant returns the sorted roles of a user already holding held who is a
+// member of groups
+func (m *RoleMapping) Grant(held, groups []string) []string {
+	granted := make(map[string]bool)
+	for _, role := range held {
+		granted[role] = true
+	}
+	for _, role := range m.Default {
+		granted[role] = true
+	}
+	for key, roles := range m.Groups {
+		for _, group := range groups {
+			if !strings.EqualFold(key, group) && !strings.EqualFold(key, commonName(group)) {
+				continue
+			}
+			for _, role := range roles {
+				granted[role] = true
+			}
+			break
+		}
+	}
+
+	result := make([]string, 0, len(granted))
+	for role := range granted {
+		result = append(result, role)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// commonName returns the value of the leading CN of a distinguished name, or
+// "" when group is not a distinguished name
+func commonName(group string) string {
+	rdn := group
+	for i := 0; i < len(group); i++ {
+		if group[i] == '\\' {
+			i++
+			continue
+		}
+		if group[i] == ',' {
+			rdn = group[:i]
+			break
+		}
+	}
+	name, value, found := strings.Cut(rdn, "=")
+	if !found || !strings.EqualFold(strings.TrimSpace(name), "cn") {
+		return ""
+	}
+	value = strings.TrimSpace(value)
+	var unescaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			if b, err := hex.DecodeString(value[i+1 : min(i+3, len(value))]); err == nil && len(b) == 1 {
+				unescaped.WriteByte(b[0])
+				i += 2
+				continue
+			}
+			i++
+		}
+		unescaped.WriteByte(value[i])
+	}
+	return unescaped.String()
+}
+
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity of the signed-in user, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok && id != nil
+}
@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubProvider accepts a single username and password
+type stubProvider struct {
+	groups []string
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	if username != "jdoe" || password != "secret" {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Username: username, Provider: p.Name(), Groups: p.groups}, nil
+}
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	sessions, err := NewSessions(nil)
+	if err != nil {
+		t.Fatalf("NewSessions() failed: %v", err)
+	}
+	return &Authenticator{
+		Passwords: []PasswordProvider{&stubProvider{groups: []string{"CN=Authors,OU=Groups,DC=example,DC=com"}}},
+		Roles:     &RoleMapping{Groups: map[string][]string{"authors": {RoleAuthor}}, Default: []string{RoleReader}},
+		Sessions:  sessions,
+	}
+}
+
+func TestRoleMapping(t *testing.T) {
+	mapping := &RoleMapping{
+		Groups: map[string][]string{
+			"CN=LIV Admins,OU=Groups,DC=example,DC=com": {RoleAdmin},
+			"engineering": {RoleAuthor, RoleReader},
+		},
+		Default: []string{RoleReader},
+	}
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{nil, "reader"},
+		{[]string{"cn=liv admins,ou=groups,dc=example,dc=com"}, "admin,reader"},
+		{[]string{"CN=Engineering,OU=Teams,DC=example,DC=com"}, "author,reader"},
+		{[]string{"Engineering", "Sales"}, "author,reader"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(mapping.Roles(test.groups), ","); got != test.want {
+			t.Errorf("Roles(%v) = %s, want %s", test.groups, got, test.want)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	sessions, err := NewSessions(nil)
+	if err != nil {
+		t.Fatalf("NewSessions() failed: %v", err)
+	}
+	if _, err := NewSessions([]byte("short")); err == nil {
+		t.Error("NewSessions() accepted a short key")
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := sessions.Issue(recorder, request, &Identity{Username: "jdoe", Provider: "stub", Roles: []string{RoleReader}}); err != nil {
+		t.Fatalf("Issue() failed: %v", err)
+	}
+	cookie := recorder.Result().Cookies()[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("session cookie is not protected: %+v", cookie)
+	}
+
+	request.AddCookie(cookie)
+	id, ok := sessions.Identify(request)
+	if !ok || id.Username != "jdoe" || !id.HasRole(RoleReader) {
+		t.Fatalf("Identify() = %+v, %v", id, ok)
+	}
+
+	// A cookie with altered claims is rejected
+	payload, signature, _ := strings.Cut(cookie.Value, ".")
+	forged := httptest.NewRequest(http.MethodGet, "/", nil)
+	forged.AddCookie(&http.Cookie{Name: cookie.Name, Value: strings.ToUpper(payload[:4]) + payload[4:] + "." + signature})
+	if _, ok := sessions.Identify(forged); ok {
+		t.Error("Identify() accepted a forged cookie")
+	}
+
+	// Sessions expire
+	sessions.Now = func() time.Time { return time.Now().Add(DefaultSessionTTL + time.Minute) }
+	if _, ok := sessions.Identify(request); ok {
+		t.Error("Identify() accepted an expired session")
+	}
+}
+
+func TestAuthenticatorLogin(t *testing.T) {
+	a := newTestAuthenticator(t)
+	protected := a.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		w.Write([]byte(id.Username))
+	}), RoleAuthor)
+
+	// Browsers are sent to the login page, API clients get 401
+	request := httptest.NewRequest(http.MethodGet, "/upload?x=1", nil)
+	request.Header.Set("Accept", "text/html")
+	recorder := httptest.NewRecorder()
+	protected.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/auth/login?next="+url.QueryEscape("/upload?x=1") {
+		t.Errorf("unauthenticated browser got %d %s", recorder.Code, recorder.Header().Get("Location"))
+	}
+	recorder = httptest.NewRecorder()
+	protected.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated API request got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	a.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/login?next=/upload", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `name="password"`) {
+		t.Errorf("login page got %d", recorder.Code)
+	}
+
+	login := func(password, next string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"jdoe"}, "password": {password}, "next": {next}}
+		request := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		a.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := login("wrong", "/upload"); recorder.Code != http.StatusUnauthorized || len(recorder.Result().Cookies()) != 0 {
+		t.Errorf("wrong password got %d", recorder.Code)
+	}
+	if recorder := login("secret", "https://evil.example.com/"); recorder.Header().Get("Location") != "/" {
+		t.Errorf("login redirected off-site to %s", recorder.Header().Get("Location"))
+	}
+
+	recorder = login("secret", "/upload")
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/upload" {
+		t.Fatalf("login got %d %s", recorder.Code, recorder.Header().Get("Location"))
+	}
+	cookie := recorder.Result().Cookies()[0]
+
+	request = httptest.NewRequest(http.MethodPost, "/upload", nil)
+	request.AddCookie(cookie)
+	recorder = httptest.NewRecorder()
+	protected.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "jdoe" {
+		t.Errorf("signed-in request got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	request.AddCookie(cookie)
+	recorder = httptest.NewRecorder()
+	a.ServeHTTP(recorder, request)
+	var id Identity
+	if err := json.NewDecoder(recorder.Body).Decode(&id); err != nil || strings.Join(id.Roles, ",") != "author,reader" {
+		t.Errorf("/auth/me = %+v, %v", id, err)
+	}
+
+	// Users without the role are refused
+	admin := a.Require(http.NotFoundHandler(), RoleAdmin)
+	request = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	request.AddCookie(cookie)
+	recorder = httptest.NewRecorder()
+	admin.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("request without role got %d", recorder.Code)
+	}
+}
+
+// stubDirectory holds provisioned users by name
+type stubDirectory map[string]stubUser
+
+type stubUser struct {
+	groups []string
+	active bool
+}
+
+func (d stubDirectory) Lookup(username string) ([]string, bool, bool) {
+	user, known := d[username]
+	return user.groups, user.active, known
+}
+
+func TestAuthenticatorDirectory(t *testing.T) {
+	a := newTestAuthenticator(t)
+	directory := stubDirectory{"jdoe": {groups: []string{"Authors"}, active: true}}
+	a.Directory = directory
+	protected := a.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		w.Write([]byte(strings.Join(id.Roles, ",")))
+	}))
+
+	login := func() *httptest.ResponseRecorder {
+		form := url.Values{"username": {"jdoe"}, "password": {"secret"}}
+		request := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		a.ServeHTTP(recorder, request)
+		return recorder
+	}
+	get := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/document", nil)
+		request.AddCookie(cookie)
+		recorder := httptest.NewRecorder()
+		protected.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := login()
+	if recorder.Code != http.StatusSeeOther {
+		t.Fatalf("login got %d", recorder.Code)
+	}
+	cookie := recorder.Result().Cookies()[0]
+
+	// Roles follow the provisioned groups rather than the session
+	if recorder := get(cookie); recorder.Body.String() != "author,reader" {
+		t.Errorf("roles = %q", recorder.Body.String())
+	}
+	directory["jdoe"] = stubUser{active: true}
+	if recorder := get(cookie); recorder.Body.String() != "reader" {
+		t.Errorf("roles after leaving the group = %q", recorder.Body.String())
+	}
+
+	// Deactivation ends existing sessions and prevents new ones
+	directory["jdoe"] = stubUser{active: false}
+	if recorder := get(cookie); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("deactivated user got %d", recorder.Code)
+	}
+	if recorder := login(); recorder.Code != http.StatusForbidden || len(recorder.Result().Cookies()) != 0 {
+		t.Errorf("deactivated user sign-in got %d", recorder.Code)
+	}
+
+	// Unknown users fall back to their provider groups unless provisioning is
+	// required
+	delete(directory, "jdoe")
+	if recorder := get(cookie); recorder.Code != http.StatusOK {
+		t.Errorf("unprovisioned user got %d", recorder.Code)
+	}
+	a.RequireProvisioning = true
+	if recorder := get(cookie); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("unprovisioned user with provisioning required got %d", recorder.Code)
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	idp := newTestIdP(t)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.cert.Raw})
+	if err := os.WriteFile(filepath.Join(dir, "idp.pem"), certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TEST_LDAP_PASSWORD", "service-secret")
+	t.Setenv("TEST_SCIM_TOKEN", "0123456789abcdef")
+	t.Setenv("TEST_OIDC_SECRET", "client-secret")
+	configPath := filepath.Join(dir, "auth.json")
+	if err := os.WriteFile(configPath, []byte(`{
+  "session": {"ttl": "1h"},
+  "local": {"accounts": "users.json"},
+  "ldap": [{"name": "Directory", "url": "ldaps://dc.example.com", "base_dn": "DC=example,DC=com", "bind_password": "$TEST_LDAP_PASSWORD"}],
+  "saml": [{
+    "name": "SSO",
+    "entity_id": "https://liv.example.com/auth/sso/SSO/metadata",
+    "acs_url": "https://liv.example.com/auth/sso/SSO/acs",
+    "idp_entity_id": "https://idp.example.com",
+    "idp_sso_url": "https://idp.example.com/sso",
+    "idp_certificate": "idp.pem"
+  }],
+  "oidc": [{
+    "name": "OIDC",
+    "issuer": "https://oidc.example.com",
+    "client_id": "liv",
+    "client_secret": "$TEST_OIDC_SECRET",
+    "redirect_url": "https://liv.example.com/auth/sso/OIDC/callback"
+  }],
+  "scim": {"directory": "scim.json", "token": "$TEST_SCIM_TOKEN", "require_provisioning": true},
+  "roles": {"LIV Admins": ["admin"]},
+  "default_roles": ["reader"]
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	a, err := LoadAuthenticator(configPath, "Sign in to LIV")
+	if err != nil {
+		t.Fatalf("LoadAuthenticator() failed: %v", err)
+	}
+	if len(a.Passwords) != 2 || len(a.Redirects) != 2 || a.Sessions.TTL != time.Hour || a.Title != "Sign in to LIV" {
+		t.Errorf("unexpected authenticator %+v", a)
+	}
+	if a.Directory == nil || a.Provisioning == nil || !a.RequireProvisioning {
+		t.Errorf("SCIM provisioning was not configured")
+	}
+	if local := a.Passwords[0].(*LocalProvider); local.Path != filepath.Join(dir, "users.json") {
+		t.Errorf("local accounts path was not resolved: %q", local.Path)
+	}
+	if oidc := a.Redirects[1].(*OIDCProvider); oidc.ClientSecret != "client-secret" {
+		t.Errorf("client secret was not expanded: %q", oidc.ClientSecret)
+	}
+	if ldap := a.Passwords[1].(*LDAPProvider); ldap.BindPassword != "service-secret" {
+		t.Errorf("bind password was not expanded: %q", ldap.BindPassword)
+	}
+
+	recorder := httptest.NewRecorder()
+	a.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/sso/SSO?next=/viewer", nil))
+	if recorder.Code != http.StatusFound || !strings.HasPrefix(recorder.Header().Get("Location"), "https://idp.example.com/sso?") {
+		t.Errorf("SSO start got %d %s", recorder.Code, recorder.Header().Get("Location"))
+	}
+
+	config.LDAP[0].UserFilter = "(uid={username}"
+	if _, err := NewAuthenticator(config); err == nil {
+		t.Error("NewAuthenticator() accepted an invalid user filter")
+	}
+}
+
+func TestAuthenticatorRequireAPI(t *testing.T) {
+	a := newTestAuthenticator(t)
+	api := a.RequireAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		w.Write([]byte(id.Username))
+	}), RoleAuthor)
+
+	call := func(username, password string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/policies", nil)
+		request.Header.Set("Accept", "text/html")
+		if username != "" {
+			request.SetBasicAuth(username, password)
+		}
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// Programs are challenged rather than sent to the login page
+	if recorder := call("", ""); recorder.Code != http.StatusUnauthorized || !strings.HasPrefix(recorder.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("unauthenticated request got %d %q", recorder.Code, recorder.Header().Get("WWW-Authenticate"))
+	}
+	if recorder := call("jdoe", "wrong"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password got %d", recorder.Code)
+	}
+	if recorder := call("jdoe", "secret"); recorder.Code != http.StatusOK || recorder.Body.String() != "jdoe" {
+		t.Errorf("basic authentication got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	admin := a.RequireAPI(http.NotFoundHandler(), RoleAdmin)
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/policies", nil)
+	request.SetBasicAuth("jdoe", "secret")
+	recorder := httptest.NewRecorder()
+	admin.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("request without role got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifier classes and the constructed bit
+const (
+	berUniversal   = 0x00
+	berApplication = 0x40
+	berContext     = 0x80
+	berConstructed = 0x20
+)
+
+// Universal BER tags used by LDAP
+const (
+	berTagBoolean     = 0x01
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagNull        = 0x05
+	berTagEnumerated  = 0x0a
+	berTagSequence    = 0x10 | berConstructed
+	berTagSet         = 0x11 | berConstructed
+)
+
+// maxBERLength bounds a single element read from a directory server
+const maxBERLength = 16 << 20
+
+// berPacket is a decoded BER element
+type berPacket struct {
+	// Identifier is the identifier octet: class, constructed bit and tag
+	Identifier byte
+	Value      []byte
+	Children   []*berPacket
+}
+
+// Tag returns the tag number without class and constructed bits
+func (p *berPacket) Tag() byte {
+	return p.Identifier & 0x1f
+}
+
+// Constructed reports whether the element holds other elements
+func (p *berPacket) Constructed() bool {
+	return p.Identifier&berConstructed != 0
+}
+
+// Int decodes an INTEGER or ENUMERATED value
+func (p *berPacket) Int() (int64, error) {
+	if len(p.Value) == 0 || len(p.Value) > 8 {
+		return 0, fmt.Errorf("invalid integer of %d bytes", len(p.Value))
+	}
+	n := int64(int8(p.Value[0]))
+	for _, b := range p.Value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// child returns child i or an error naming what was expected
+func (p *berPacket) child(i int, what string) (*berPacket, error) {
+	if i >= len(p.Children) {
+		return nil, fmt.Errorf("malformed LDAP message: missing %s", what)
+	}
+	return p.Children[i], nil
+}
+
+// berElement encodes an element from its identifier and contents
+func berElement(identifier byte, contents []byte) []byte {
+	out := []byte{identifier}
+	switch n := len(contents); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	default:
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+	return append(out, contents...)
+}
+
+// berConstruct encodes a constructed element holding children
+func berConstruct(identifier byte, children ...[]byte) []byte {
+	var contents []byte
+	for _, child := range children {
+		contents = append(contents, child...)
+	}
+	return berElement(identifier|berConstructed, contents)
+}
+
+func berInteger(identifier byte, n int64) []byte {
+	var contents []byte
+	for {
+		contents = append([]byte{byte(n)}, contents...)
+		if (n < 0x80 && n >= -0x80) || len(contents) == 8 {
+			break
+		}
+		n >>= 8
+	}
+	return berElement(identifier, contents)
+}
+
+func berString(identifier byte, s string) []byte {
+	return berElement(identifier, []byte(s))
+}
+
+func berBoolean(b bool) []byte {
+	if b {
+		return berElement(berTagBoolean, []byte{0xff})
+	}
+	return berElement(berTagBoolean, []byte{0x00})
+}
+
+// readBER reads one element, decoding constructed elements recursively
+func readBER(r *bufio.Reader) (*berPacket, error) {
+	identifier, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if identifier&0x1f == 0x1f {
+		return nil, errors.New("unsupported BER high tag number")
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		octets := int(first & 0x7f)
+		if octets == 0 || octets > 4 {
+			return nil, errors.New("unsupported BER length encoding")
+		}
+		length = 0
+		for i := 0; i < octets; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxBERLength {
+		return nil, fmt.Errorf("BER element of %d bytes exceeds limit", length)
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return parseBER(identifier, value)
+}
+
+func parseBER(identifier byte, value []byte) (*berPacket, error) {
+	p := &berPacket{Identifier: identifier, Value: value}
+	if !p.Constructed() {
+		return p, nil
+	}
+	r := bufio.NewReader(bytes.NewReader(value))
+	for {
+		child, err := readBER(r)
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, child)
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,379 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/liv-format/liv/pkg/scim"
+)
+
+// Config is an authentication configuration file:
+//
+//	{
+//	  "session": {"key": "$LIV_SESSION_KEY", "ttl": "8h", "secure": true},
+//	  "local": {"accounts": "users.json"},
+//	  "ldap": [{
+//	    "name": "Corporate directory",
+//	    "url": "ldaps://dc1.example.com",
+//	    "bind_dn": "CN=liv-svc,OU=Service,DC=example,DC=com",
+//	    "bind_password": "$LIV_LDAP_PASSWORD",
+//	    "base_dn": "DC=example,DC=com",
+//	    "group_filter": "(member:1.2.840.113556.1.4.1941:={dn})"
+//	  }],
+//	  "saml": [{
+//	    "name": "Okta",
+//	    "entity_id": "https://liv.example.com/auth/sso/Okta/metadata",
+//	    "acs_url": "https://liv.example.com/auth/sso/Okta/acs",
+//	    "idp_entity_id": "http://www.okta.com/exk1abc",
+//	    "idp_sso_url": "https://example.okta.com/app/liv/exk1abc/sso/saml",
+//	    "idp_certificate": "okta.pem",
+//	    "groups_attribute": "groups"
+//	  }],
+//	  "oidc": [{
+//	    "name": "Entra",
+//	    "issuer": "https://login.microsoftonline.com/{tenant}/v2.0",
+//	    "client_id": "6731de76-14a6-49ae-97bc-6eba6914391e",
+//	    "client_secret": "$LIV_OIDC_SECRET",
+//	    "redirect_url": "https://liv.example.com/auth/sso/Entra/callback"
+//	  }],
+//	  "scim": {"directory": "scim.json", "token": "$LIV_SCIM_TOKEN", "require_provisioning": true},
+//	  "roles": {"LIV Admins": ["admin"], "Security": ["auditor"], "Engineering": ["author"]},
+//	  "default_roles": ["reader"]
+//	}
+//
+// Secrets are expanded from environment variables, so they can stay out of the
+// file. Relative paths resolve against the directory of the file.
+type Config struct {
+	Session SessionConfig `json:"session"`
+	Local   *LocalConfig  `json:"local,omitempty"`
+	LDAP    []*LDAPConfig `json:"ldap,omitempty"`
+	SAML    []*SAMLConfig `json:"saml,omitempty"`
+	OIDC    []*OIDCConfig `json:"oidc,omitempty"`
+	SCIM    *SCIMConfig   `json:"scim,omitempty"`
+	// Roles maps group names or DNs to the roles granted to their members
+	Roles map[string][]string `json:"roles"`
+	// DefaultRoles are granted to every user who signs in
+	DefaultRoles []string `json:"default_roles,omitempty"`
+
+	// Dir is the directory containing the configuration file
+	Dir string `json:"-"`
+}
+
+// SessionConfig configures session cookies
+type SessionConfig struct {
+	// Key signs session cookies and must be at least 32 bytes. Servers sharing
+	// a key accept each other's sessions. A random key is used when empty.
+	Key    string `json:"key,omitempty"`
+	TTL    string `json:"ttl,omitempty"`
+	Cookie string `json:"cookie,omitempty"`
+	Secure bool   `json:"secure,omitempty"`
+}
+
+// LocalConfig configures a LocalProvider
+type LocalConfig struct {
+	Name string `json:"name,omitempty"`
+	// Accounts is the local accounts file, edited with security-admin
+	Accounts string `json:"accounts"`
+}
+
+// LDAPConfig configures an LDAPProvider
+type LDAPConfig struct {
+	Name               string `json:"name"`
+	URL                string `json:"url"`
+	StartTLS           bool   `json:"start_tls,omitempty"`
+	CAFile             string `json:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	BindDN             string `json:"bind_dn,omitempty"`
+	BindPassword       string `json:"bind_password,omitempty"`
+	BaseDN             string `json:"base_dn"`
+	UserFilter         string `json:"user_filter,omitempty"`
+	GroupAttribute     string `json:"group_attribute,omitempty"`
+	GroupFilter        string `json:"group_filter,omitempty"`
+	GroupBaseDN        string `json:"group_base_dn,omitempty"`
+	NameAttribute      string `json:"name_attribute,omitempty"`
+	EmailAttribute     string `json:"email_attribute,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+}
+
+// SAMLConfig configures a SAMLProvider
+type SAMLConfig struct {
+	Name        string `json:"name"`
+	EntityID    string `json:"entity_id"`
+	ACSURL      string `json:"acs_url"`
+	IdPEntityID string `json:"idp_entity_id"`
+	IdPSSOURL   string `json:"idp_sso_url"`
+	// IdPCertificate is a PEM file holding one or more signing certificates
+	IdPCertificate    string `json:"idp_certificate"`
+	UsernameAttribute string `json:"username_attribute,omitempty"`
+	NameAttribute     string `json:"name_attribute,omitempty"`
+	EmailAttribute    string `json:"email_attribute,omitempty"`
+	GroupsAttribute   string `json:"groups_attribute,omitempty"`
+	AllowIdPInitiated bool   `json:"allow_idp_initiated,omitempty"`
+	ClockSkew         string `json:"clock_skew,omitempty"`
+}
+
+// OIDCConfig configures an OIDCProvider
+type OIDCConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes,omitempty"`
+	// UsernameClaim defaults to preferred_username, then email, then sub
+	UsernameClaim string `json:"username_claim,omitempty"`
+	NameClaim     string `json:"name_claim,omitempty"`
+	EmailClaim    string `json:"email_claim,omitempty"`
+	GroupsClaim   string `json:"groups_claim,omitempty"`
+	ClockSkew     string `json:"clock_skew,omitempty"`
+}
+
+// SCIMConfig enables provisioning of users and groups over SCIM 2.0
+type SCIMConfig struct {
+	// Directory is the file holding provisioned users and groups
+	Directory string `json:"directory"`
+	// Token is the bearer token the identity provider presents
+	Token string `json:"token"`
+	// RequireProvisioning refuses users the identity provider has not
+	// provisioned, so access follows assignments in the identity provider
+	RequireProvisioning bool `json:"require_provisioning,omitempty"`
+}
+
+// LoadConfig reads an authentication configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authentication config: %v", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid authentication config %s: %v", path, err)
+	}
+	config.Dir = filepath.Dir(path)
+	return &config, nil
+}
+
+// LoadAuthenticator reads an authentication configuration file and creates
+// an authenticator from it whose sign-in page is titled title
+func LoadAuthenticator(path, title string) (*Authenticator, error) {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewAuthenticator(config)
+	if err != nil {
+		return nil, err
+	}
+	a.Title = title
+	return a, nil
+}
+
+// NewAuthenticator creates an authenticator from a configuration
+func NewAuthenticator(config *Config) (*Authenticator, error) {
+	if config.Local == nil && len(config.LDAP) == 0 && len(config.SAML) == 0 && len(config.OIDC) == 0 {
+		return nil, fmt.Errorf("authentication config has no local, ldap, saml or oidc providers")
+	}
+
+	sessions, err := NewSessions([]byte(os.ExpandEnv(config.Session.Key)))
+	if err != nil {
+		return nil, err
+	}
+	if config.Session.TTL != "" {
+		if sessions.TTL, err = parseDuration("session ttl", config.Session.TTL); err != nil {
+			return nil, err
+		}
+	}
+	if config.Session.Cookie != "" {
+		sessions.Cookie = config.Session.Cookie
+	}
+	sessions.Secure = config.Session.Secure
+
+	a := &Authenticator{
+		Roles:    &RoleMapping{Groups: config.Roles, Default: config.DefaultRoles},
+		Sessions: sessions,
+	}
+	names := make(map[string]bool)
+
+	// Local accounts come first, so they still work when a directory is down
+	if c := config.Local; c != nil {
+		if c.Accounts == "" {
+			return nil, fmt.Errorf("local accounts need an accounts file")
+		}
+		provider := &LocalProvider{ProviderName: c.Name, Path: config.path(c.Accounts)}
+		if _, err := provider.load(); err != nil {
+			return nil, err
+		}
+		names[provider.Name()] = true
+		a.Passwords = append(a.Passwords, provider)
+	}
+
+	for _, c := range config.LDAP {
+		if c.Name == "" || c.URL == "" || c.BaseDN == "" {
+			return nil, fmt.Errorf("ldap providers need a name, url and base_dn")
+		}
+		provider := &LDAPProvider{
+			ProviderName:   c.Name,
+			URL:            c.URL,
+			StartTLS:       c.StartTLS,
+			BindDN:         c.BindDN,
+			BindPassword:   os.ExpandEnv(c.BindPassword),
+			BaseDN:         c.BaseDN,
+			UserFilter:     c.UserFilter,
+			GroupAttribute: c.GroupAttribute,
+			GroupFilter:    c.GroupFilter,
+			GroupBaseDN:    c.GroupBaseDN,
+			NameAttribute:  c.NameAttribute,
+			EmailAttribute: c.EmailAttribute,
+			TLSConfig:      &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify},
+		}
+		if c.UserFilter != "" {
+			// Catch filter typos at startup rather than at the first sign-in
+			if _, err := compileFilter(c.UserFilter); err != nil {
+				return nil, fmt.Errorf("ldap provider %s: %v", c.Name, err)
+			}
+		}
+		if c.CAFile != "" {
+			pool := x509.NewCertPool()
+			certs, err := readCertificates(config.path(c.CAFile))
+			if err != nil {
+				return nil, fmt.Errorf("ldap provider %s: %v", c.Name, err)
+			}
+			for _, cert := range certs {
+				pool.AddCert(cert)
+			}
+			provider.TLSConfig.RootCAs = pool
+		}
+		if c.Timeout != "" {
+			if provider.Timeout, err = parseDuration("ldap timeout", c.Timeout); err != nil {
+				return nil, err
+			}
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate provider name %q", c.Name)
+		}
+		names[c.Name] = true
+		a.Passwords = append(a.Passwords, provider)
+	}
+
+	for _, c := range config.SAML {
+		if c.Name == "" || c.EntityID == "" || c.ACSURL == "" || c.IdPEntityID == "" || c.IdPSSOURL == "" || c.IdPCertificate == "" {
+			return nil, fmt.Errorf("saml providers need a name, entity_id, acs_url, idp_entity_id, idp_sso_url and idp_certificate")
+		}
+		certs, err := readCertificates(config.path(c.IdPCertificate))
+		if err != nil {
+			return nil, fmt.Errorf("saml provider %s: %v", c.Name, err)
+		}
+		provider := &SAMLProvider{
+			ProviderName:      c.Name,
+			EntityID:          c.EntityID,
+			ACSURL:            c.ACSURL,
+			IdPEntityID:       c.IdPEntityID,
+			IdPSSOURL:         c.IdPSSOURL,
+			IdPCertificates:   certs,
+			UsernameAttribute: c.UsernameAttribute,
+			NameAttribute:     c.NameAttribute,
+			EmailAttribute:    c.EmailAttribute,
+			GroupsAttribute:   c.GroupsAttribute,
+			AllowIdPInitiated: c.AllowIdPInitiated,
+		}
+		if c.ClockSkew != "" {
+			if provider.ClockSkew, err = parseDuration("saml clock_skew", c.ClockSkew); err != nil {
+				return nil, err
+			}
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate provider name %q", c.Name)
+		}
+		names[c.Name] = true
+		a.Redirects = append(a.Redirects, provider)
+	}
+
+	for _, c := range config.OIDC {
+		if c.Name == "" || c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc providers need a name, issuer, client_id and redirect_url")
+		}
+		provider := &OIDCProvider{
+			ProviderName:  c.Name,
+			Issuer:        c.Issuer,
+			ClientID:      c.ClientID,
+			ClientSecret:  os.ExpandEnv(c.ClientSecret),
+			RedirectURL:   c.RedirectURL,
+			Scopes:        c.Scopes,
+			UsernameClaim: c.UsernameClaim,
+			NameClaim:     c.NameClaim,
+			EmailClaim:    c.EmailClaim,
+			GroupsClaim:   c.GroupsClaim,
+		}
+		if c.ClockSkew != "" {
+			if provider.ClockSkew, err = parseDuration("oidc clock_skew", c.ClockSkew); err != nil {
+				return nil, err
+			}
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate provider name %q", c.Name)
+		}
+		names[c.Name] = true
+		a.Redirects = append(a.Redirects, provider)
+	}
+
+	if c := config.SCIM; c != nil {
+		token := os.ExpandEnv(c.Token)
+		if c.Directory == "" || len(token) < 16 {
+			return nil, fmt.Errorf("scim needs a directory and a token of at least 16 characters")
+		}
+		directory, err := scim.Open(config.path(c.Directory))
+		if err != nil {
+			return nil, err
+		}
+		a.Directory = directory
+		a.RequireProvisioning = c.RequireProvisioning
+		a.Provisioning = scim.NewHandler(directory, token)
+	}
+
+	return a, nil
+}
+
+// path resolves a path relative to the configuration file
+func (c *Config) path(name string) string {
+	name = os.ExpandEnv(name)
+	if filepath.IsAbs(name) || c.Dir == "" {
+		return name
+	}
+	return filepath.Join(c.Dir, name)
+}
+
+func parseDuration(name, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return d, nil
+}
+
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificates: %v", err)
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in %s: %v", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return certs, nil
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// LDAP filter choices (RFC 4511 section 4.5.1.7)
+const (
+	filterAnd        = berContext | berConstructed | 0
+	filterOr         = berContext | berConstructed | 1
+	filterNot        = berContext | berConstructed | 2
+	filterEquality   = berContext | berConstructed | 3
+	filterSubstrings = berContext | berConstructed | 4
+	filterGreater    = berContext | berConstructed | 5
+	filterLess       = berContext | berConstructed | 6
+	filterPresent    = berContext | 7
+	filterApprox     = berContext | berConstructed | 8
+	filterExtensible = berContext | berConstructed | 9
+)
+
+// EscapeFilter escapes a value for use in an LDAP search filter (RFC 4515),
+// so user input cannot change the structure of the filter
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// compileFilter encodes a string search filter such as
+// "(&(objectClass=person)(uid=jdoe))" in BER
+func compileFilter(filter string) ([]byte, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil, fmt.Errorf("empty LDAP filter")
+	}
+	if filter[0] != '(' {
+		filter = "(" + filter + ")"
+	}
+	encoded, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP filter %q: %v", filter, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid LDAP filter %q: unexpected %q", filter, rest)
+	}
+	return encoded, nil
+}
+
+// parseFilter parses one parenthesized filter from the start of s
+func parseFilter(s string) ([]byte, string, error) {
+	if s == "" || s[0] != '(' {
+		return nil, s, fmt.Errorf("expected '('")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, s, fmt.Errorf("unterminated filter")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		identifier := byte(filterAnd)
+		if s[0] == '|' {
+			identifier = filterOr
+		}
+		s = s[1:]
+		var children [][]byte
+		for s != "" && s[0] == '(' {
+			child, rest, err := parseFilter(s)
+			if err != nil {
+				return nil, rest, err
+			}
+			children = append(children, child)
+			s = rest
+		}
+		if s == "" || s[0] != ')' {
+			return nil, s, fmt.Errorf("expected ')'")
+		}
+		return berConstruct(identifier, children...), s[1:], nil
+
+	case '!':
+		child, rest, err := parseFilter(s[1:])
+		if err != nil {
+			return nil, rest, err
+		}
+		if rest == "" || rest[0] != ')' {
+			return nil, rest, fmt.Errorf("expected ')'")
+		}
+		return berConstruct(filterNot, child), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, s, fmt.Errorf("expected ')'")
+	}
+	item, err := parseFilterItem(s[:end])
+	return item, s[end+1:], err
+}
+
+// parseFilterItem encodes a simple item such as "cn=J*n", "mail=*" or
+// "member:1.2.840.113556.1.4.1941:=CN=..."
+func parseFilterItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("missing '=' in %q", item)
+	}
+	attr, raw := item[:eq], item[eq+1:]
+
+	identifier := byte(filterEquality)
+	switch attr[len(attr)-1] {
+	case '>':
+		identifier, attr = filterGreater, attr[:len(attr)-1]
+	case '<':
+		identifier, attr = filterLess, attr[:len(attr)-1]
+	case '~':
+		identifier, attr = filterApprox, attr[:len(attr)-1]
+	case ':':
+		return parseExtensible(attr[:len(attr)-1], raw)
+	}
+	if attr == "" {
+		return nil, fmt.Errorf("missing attribute in %q", item)
+	}
+
+	if identifier == filterEquality && strings.Contains(raw, "*") {
+		if raw == "*" {
+			return berString(filterPresent, attr), nil
+		}
+		return parseSubstrings(attr, raw)
+	}
+	value, err := unescapeFilter(raw)
+	if err != nil {
+		return nil, err
+	}
+	return berConstruct(identifier, berString(berTagOctetString, attr), berString(berTagOctetString, value)), nil
+}
+
+func parseSubstrings(attr, raw string) ([]byte, error) {
+	parts := strings.Split(raw, "*")
+	var substrings [][]byte
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		value, err := unescapeFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		tag := byte(berContext | 1) // any
+		switch i {
+		case 0:
+			tag = berContext | 0 // initial
+		case len(parts) - 1:
+			tag = berContext | 2 // final
+		}
+		substrings = append(substrings, berString(tag, value))
+	}
+	return berConstruct(filterSubstrings,
+		berString(berTagOctetString, attr),
+		berConstruct(berTagSequence, substrings...)), nil
+}
+
+// parseExtensible encodes an extensible match, "attr[:dn][:rule]:=value"
+func parseExtensible(spec, raw string) ([]byte, error) {
+	fields := strings.Split(spec, ":")
+	attr, fields := fields[0], fields[1:]
+	var rule string
+	dnAttributes := false
+	for _, field := range fields {
+		if strings.EqualFold(field, "dn") {
+			dnAttributes = true
+		} else {
+			rule = field
+		}
+	}
+	if attr == "" && rule == "" {
+		return nil, fmt.Errorf("extensible match needs an attribute or matching rule")
+	}
+	value, err := unescapeFilter(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts [][]byte
+	if rule != "" {
+		parts = append(parts, berString(berContext|1, rule))
+	}
+	if attr != "" {
+		parts = append(parts, berString(berContext|2, attr))
+	}
+	parts = append(parts, berString(berContext|3, value))
+	if dnAttributes {
+		parts = append(parts, berElement(berContext|4, []byte{0xff}))
+	}
+	return berConstruct(filterExtensible, parts...), nil
+}
+
+// unescapeFilter decodes the \XX escapes of a filter value
+func unescapeFilter(raw string) (string, error) {
+	if !strings.Contains(raw, "\\") {
+		return raw, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			b.WriteByte(raw[i])
+			continue
+		}
+		if i+3 > len(raw) {
+			return "", fmt.Errorf("truncated escape in %q", raw)
+		}
+		decoded, err := hex.DecodeString(raw[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", raw)
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
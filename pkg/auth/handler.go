@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PathPrefix is where the Authenticator serves its pages
+const PathPrefix = "/auth/"
+
+// Authenticator signs users in with the configured providers and protects
+// handlers. Its own pages are served under PathPrefix:
+//
+//	/auth/login                 login page; POST checks a username and password
+//	/auth/logout                POST ends the session
+//	/auth/me                    the signed-in identity as JSON
+//	/auth/sso/<name>            starts sign-in with a redirect provider
+//	/auth/sso/<name>/acs        receives the identity provider's response
+//	/auth/sso/<name>/callback   the same, named as OpenID Connect names it
+//	/auth/sso/<name>/metadata   service provider metadata
+type Authenticator struct {
+	Passwords []PasswordProvider
+	Redirects []RedirectProvider
+	Roles     *RoleMapping
+	Sessions  *Sessions
+	// Directory, when set, holds provisioned users; it is consulted on every
+	// request so that deactivated users lose access immediately
+	Directory Directory
+	// RequireProvisioning refuses users the directory does not hold
+	RequireProvisioning bool
+	// Provisioning is the SCIM endpoint that fills the directory, served
+	// under scim.PathPrefix; nil when provisioning is not configured
+	Provisioning http.Handler
+	// Title is shown on the login page
+	Title string
+}
+
+// session returns the user of a request's session, checking it against the
+// directory
+func (a *Authenticator) session(r *http.Request) (*Identity, bool) {
+	id, ok := a.Sessions.Identify(r)
+	if !ok {
+		return nil, false
+	}
+	return id, a.provision(id) == nil
+}
+
+// provision applies the directory to an identity: inactive users and, when
+// provisioning is required, unknown users are refused, and the roles of known
+// users follow their provisioned groups
+func (a *Authenticator) provision(id *Identity) error {
+	if a.Directory == nil {
+		return nil
+	}
+	groups, active, known := a.Directory.Lookup(id.Username)
+	switch {
+	case !known && a.RequireProvisioning:
+		return ErrNotProvisioned
+	case !known:
+		return nil
+	case !active:
+		return ErrDeactivated
+	}
+	id.Groups = groups
+	if a.Roles != nil {
+		id.Roles = a.Roles.Roles(groups)
+	}
+	return nil
+}
+
+// Identify returns the signed-in user of a request
+func (a *Authenticator) Identify(r *http.Request) (*Identity, bool) {
+	if id, ok := FromContext(r.Context()); ok {
+		return id, true
+	}
+	return a.session(r)
+}
+
+// Attach adds the signed-in user, if any, to the request context without
+// requiring a session
+func (a *Authenticator) Attach(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := a.session(r); ok {
+			r = r.WithContext(WithIdentity(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Require serves next only to signed-in users holding any of roles, or to any
+// signed-in user when no roles are given. Browsers are sent to the login page;
+// other clients receive 401 Unauthorized.
+func (a *Authenticator) Require(next http.Handler, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := a.session(r)
+		if !ok {
+			if (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, PathPrefix+"login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if len(roles) > 0 && !id.HasRole(roles...) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
+
+// RequireAPI protects an API used by programs as well as browsers. It serves
+// next to users holding any of roles who have a session, as Require does, or
+// who send a username and password with HTTP Basic authentication, checked
+// by the password providers on every request. Others receive 401 Unauthorized
+// rather than the login page.
+func (a *Authenticator) RequireAPI(next http.Handler, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := a.session(r)
+		if username, password, basic := r.BasicAuth(); !ok && basic && len(a.Passwords) > 0 {
+			var err error
+			if id, err = a.authenticate(r, username, password); err == nil {
+				a.grantRoles(id)
+				err = a.provision(id)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+				log.Printf("auth: API sign-in of %q failed: %v", username, err)
+			}
+			ok = err == nil
+		}
+		if !ok {
+			if len(a.Passwords) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="LIV", charset="UTF-8"`)
+			}
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if len(roles) > 0 && !id.HasRole(roles...) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
+
+// ServeHTTP serves the pages under PathPrefix
+func (a *Authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	route := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(PathPrefix, "/"))
+
+	switch {
+	case route == "/login":
+		a.handleLogin(w, r)
+	case route == "/logout":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		a.Sessions.Clear(w, r)
+		http.Redirect(w, r, PathPrefix+"login", http.StatusSeeOther)
+	case route == "/me":
+		id, ok := a.Identify(r)
+		if !ok {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(id)
+	case strings.HasPrefix(route, "/sso/"):
+		a.handleSSO(w, r, strings.TrimPrefix(route, "/sso/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *Authenticator) handleLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		a.renderLogin(w, r.URL.Query().Get("next"), "", http.StatusOK)
+	case http.MethodPost:
+		if len(a.Passwords) == 0 {
+			http.Error(w, "Password sign-in is not enabled", http.StatusNotFound)
+			return
+		}
+		username := strings.TrimSpace(r.PostFormValue("username"))
+		password := r.PostFormValue("password")
+		next := r.PostFormValue("next")
+
+		id, err := a.authenticate(r, username, password)
+		if err != nil {
+			message := "Invalid username or password."
+			if !errors.Is(err, ErrInvalidCredentials) {
+				log.Printf("auth: sign-in of %q failed: %v", username, err)
+				message = "Sign-in is unavailable. Try again later."
+			}
+			a.renderLogin(w, next, message, http.StatusUnauthorized)
+			return
+		}
+		a.signIn(w, r, id, next)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authenticate tries each password provider in turn. A provider that rejects
+// the credentials passes the user on to the next one.
+func (a *Authenticator) authenticate(r *http.Request, username, password string) (*Identity, error) {
+	err := ErrInvalidCredentials
+	for _, provider := range a.Passwords {
+		id, providerErr := provider.Authenticate(r.Context(), username, password)
+		if providerErr == nil {
+			return id, nil
+		}
+		if !errors.Is(providerErr, ErrInvalidCredentials) {
+			err = fmt.Errorf("%s: %v", provider.Name(), providerErr)
+		}
+	}
+	return nil, err
+}
+
+func (a *Authenticator) handleSSO(w http.ResponseWriter, r *http.Request, route string) {
+	name, action, _ := strings.Cut(route, "/")
+	var provider RedirectProvider
+	for _, candidate := range a.Redirects {
+		if candidate.Name() == name {
+			provider = candidate
+		}
+	}
+	if provider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		target, err := provider.LoginURL(safeRedirect(r.URL.Query().Get("next")))
+		if err != nil {
+			log.Printf("auth: failed to start %s sign-in: %v", name, err)
+			http.Error(w, "Sign-in is unavailable", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	case "acs", "callback":
+		id, relayState, err := provider.HandleCallback(r)
+		if err != nil {
+			log.Printf("auth: %s sign-in rejected: %v", name, err)
+			a.renderLogin(w, "", "Sign-in failed. Try again or contact your administrator.", http.StatusUnauthorized)
+			return
+		}
+		a.signIn(w, r, id, relayState)
+	case "metadata":
+		metadataProvider, ok := provider.(MetadataProvider)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		metadata, err := metadataProvider.Metadata()
+		if err != nil {
+			http.Error(w, "Metadata is unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		w.Write(metadata)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// grantRoles adds the roles mapped from the identity's groups to those its
+// provider granted
+func (a *Authenticator) grantRoles(id *Identity) {
+	if a.Roles != nil {
+		id.Roles = a.Roles.Grant(id.Roles, id.Groups)
+	}
+}
+
+// signIn maps the identity's groups to roles and starts its session
+func (a *Authenticator) signIn(w http.ResponseWriter, r *http.Request, id *Identity, next string) {
+	a.grantRoles(id)
+	if err := a.provision(id); err != nil {
+		log.Printf("auth: refused %s from %s: %v", id.Username, id.Provider, err)
+		a.renderLogin(w, next, "Your account does not have access to this site.", http.StatusForbidden)
+		return
+	}
+	if err := a.Sessions.Issue(w, r, id); err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("auth: %s signed in with %s (roles: %s)", id.Username, id.Provider, strings.Join(id.Roles, ", "))
+	http.Redirect(w, r, safeRedirect(next), http.StatusSeeOther)
+}
+
+// safeRedirect only allows redirects to paths on this server
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") || strings.HasPrefix(next, PathPrefix) {
+		return "/"
+	}
+	return next
+}
+
+func (a *Authenticator) renderLogin(w http.ResponseWriter, next, message string, status int) {
+	title := a.Title
+	if title == "" {
+		title = "Sign in"
+	}
+	next = safeRedirect(next)
+
+	var body strings.Builder
+	if message != "" {
+		fmt.Fprintf(&body, `
+        <p class="error">%s</p>`, html.EscapeString(message))
+	}
+	if len(a.Passwords) > 0 {
+		fmt.Fprintf(&body, `
+        <form method="post" action="%slogin">
+            <input type="hidden" name="next" value="%s">
+            <label>Username <input name="username" autocomplete="username" required autofocus></label>
+            <label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+            <button type="submit">Sign in</button>
+        </form>`, PathPrefix, html.EscapeString(next))
+	}
+	for _, provider := range a.Redirects {
+		fmt.Fprintf(&body, `
+        <a class="sso" href="%ssso/%s?next=%s">Sign in with %s</a>`,
+			PathPrefix, url.PathEscape(provider.Name()), url.QueryEscape(next), html.EscapeString(provider.Name()))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>%s</title>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #f8f9fa; color: #212529; display: flex; justify-content: center; padding-top: 10vh; }
+        main { background: #fff; border: 1px solid #dee2e6; border-radius: 4px; padding: 32px; width: 320px; }
+        label { display: block; margin-bottom: 12px; }
+        input { display: block; width: 100%%; box-sizing: border-box; padding: 8px; margin-top: 4px; }
+        button, .sso { display: block; width: 100%%; box-sizing: border-box; padding: 10px; margin-top: 12px; text-align: center; background: #0d6efd; color: #fff; border: 0; border-radius: 4px; text-decoration: none; font-size: 1em; }
+        .error { color: #dc3545; }
+    </style>
+</head>
+<body>
+    <main>
+        <h1>%s</h1>%s
+    </main>
+</body>
+</html>`, html.EscapeString(title), html.EscapeString(title), body.String())
+}
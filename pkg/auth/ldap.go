@@ -0,0 +1,451 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP protocol operations (RFC 4511)
+const (
+	ldapBindRequest       = berApplication | berConstructed | 0
+	ldapBindResponse      = berApplication | berConstructed | 1
+	ldapUnbindRequest     = berApplication | 2
+	ldapSearchRequest     = berApplication | berConstructed | 3
+	ldapSearchEntry       = berApplication | berConstructed | 4
+	ldapSearchDone        = berApplication | berConstructed | 5
+	ldapSearchReference   = berApplication | berConstructed | 19
+	ldapExtendedRequest   = berApplication | berConstructed | 23
+	ldapExtendedResponse  = berApplication | berConstructed | 24
+	ldapResultSuccess     = 0
+	ldapResultInvalidCred = 49
+	ldapStartTLSOID       = "1.3.6.1.4.1.1466.20037"
+	ldapScopeSubtree      = 2
+	ldapNeverDerefAliases = 0
+)
+
+// Default LDAP settings
+const (
+	// DefaultLDAPUserFilter finds users by uid (OpenLDAP) or sAMAccountName
+	// (Active Directory)
+	DefaultLDAPUserFilter = "(|(uid={username})(sAMAccountName={username}))"
+	// DefaultLDAPGroupAttribute lists a user's groups in both directories
+	DefaultLDAPGroupAttribute = "memberOf"
+	// ADNestedGroupFilter finds every group an Active Directory user belongs to,
+	// including through nested groups
+	ADNestedGroupFilter = "(member:1.2.840.113556.1.4.1941:={dn})"
+	defaultLDAPTimeout  = 10 * time.Second
+)
+
+// LDAPResultError is an unsuccessful LDAP result
+type LDAPResultError struct {
+	Code    int64
+	Message string
+}
+
+func (e *LDAPResultError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("LDAP result code %d", e.Code)
+	}
+	return fmt.Sprintf("LDAP result code %d: %s", e.Code, e.Message)
+}
+
+// LDAPProvider authenticates users against an LDAP directory or Active
+// Directory. It binds with a service account, searches for the user, then
+// binds as the user with the supplied password.
+type LDAPProvider struct {
+	ProviderName string
+	// URL is ldap://host[:389] or ldaps://host[:636]
+	URL string
+	// StartTLS upgrades an ldap:// connection before binding
+	StartTLS bool
+	// TLSConfig configures ldaps:// and StartTLS connections
+	TLSConfig *tls.Config
+
+	// BindDN and BindPassword are the service account used to search for
+	// users; anonymous search is used when BindDN is empty
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is where users are searched for
+	BaseDN string
+	// UserFilter finds a user; {username} is replaced with the escaped username
+	UserFilter string
+
+	// GroupAttribute is the user attribute listing group DNs
+	GroupAttribute string
+	// GroupFilter, when set, searches for groups instead of reading
+	// GroupAttribute. {dn} and {username} are replaced with the escaped user DN
+	// and username. GroupBaseDN defaults to BaseDN.
+	GroupFilter string
+	GroupBaseDN string
+
+	// Attributes holding the user's display name and email address
+	NameAttribute  string
+	EmailAttribute string
+
+	Timeout time.Duration
+}
+
+// Name returns the provider name shown on the login page
+func (p *LDAPProvider) Name() string {
+	return p.ProviderName
+}
+
+// Authenticate checks a username and password against the directory
+func (p *LDAPProvider) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which many servers
+	// accept for any DN
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	if p.BindDN != "" {
+		if err := conn.bind(p.BindDN, p.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service account bind failed: %v", err)
+		}
+	}
+
+	nameAttribute := p.NameAttribute
+	if nameAttribute == "" {
+		nameAttribute = "displayName"
+	}
+	emailAttribute := p.EmailAttribute
+	if emailAttribute == "" {
+		emailAttribute = "mail"
+	}
+	groupAttribute := p.GroupAttribute
+	if groupAttribute == "" {
+		groupAttribute = DefaultLDAPGroupAttribute
+	}
+
+	userFilter := p.UserFilter
+	if userFilter == "" {
+		userFilter = DefaultLDAPUserFilter
+	}
+	filter := strings.ReplaceAll(userFilter, "{username}", EscapeFilter(username))
+	entries, err := conn.search(p.BaseDN, filter, []string{nameAttribute, emailAttribute, groupAttribute, "cn"})
+	if err != nil {
+		return nil, fmt.Errorf("LDAP user search failed: %v", err)
+	}
+	if len(entries) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	if len(entries) > 1 {
+		return nil, fmt.Errorf("LDAP user filter matched %d entries for %q", len(entries), username)
+	}
+	user := entries[0]
+
+	if err := conn.bind(user.DN, password); err != nil {
+		var result *LDAPResultError
+		if errors.As(err, &result) && result.Code == ldapResultInvalidCred {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP user bind failed: %v", err)
+	}
+
+	identity := &Identity{
+		Username: username,
+		Name:     user.first(nameAttribute),
+		Email:    user.first(emailAttribute),
+		Provider: p.ProviderName,
+		Groups:   user.get(groupAttribute),
+	}
+	if identity.Name == "" {
+		identity.Name = user.first("cn")
+	}
+
+	if p.GroupFilter != "" {
+		// Search with the service account, as users may not read groups
+		if p.BindDN != "" {
+			if err := conn.bind(p.BindDN, p.BindPassword); err != nil {
+				return nil, fmt.Errorf("LDAP service account bind failed: %v", err)
+			}
+		}
+		base := p.GroupBaseDN
+		if base == "" {
+			base = p.BaseDN
+		}
+		filter := strings.NewReplacer("{dn}", EscapeFilter(user.DN), "{username}", EscapeFilter(username)).Replace(p.GroupFilter)
+		groups, err := conn.search(base, filter, []string{"cn"})
+		if err != nil {
+			return nil, fmt.Errorf("LDAP group search failed: %v", err)
+		}
+		identity.Groups = nil
+		for _, group := range groups {
+			identity.Groups = append(identity.Groups, group.DN)
+		}
+	}
+
+	return identity, nil
+}
+
+// ldapEntry is a search result entry
+type ldapEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// get returns the values of an attribute; attribute names are case-insensitive
+func (e *ldapEntry) get(name string) []string {
+	return e.Attributes[strings.ToLower(name)]
+}
+
+func (e *ldapEntry) first(name string) string {
+	if values := e.get(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ldapConn is a connection to a directory server. Requests are sent one at a
+// time, so responses are read in order.
+type ldapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int64
+}
+
+func (p *LDAPProvider) dial(ctx context.Context) (*ldapConn, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %v", err)
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultLDAPTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	tlsConfig := p.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	host := u.Host
+	dialer := &net.Dialer{Deadline: deadline}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %v", err)
+	}
+	conn.SetDeadline(deadline)
+
+	c := &ldapConn{conn: conn, reader: bufio.NewReader(conn)}
+	if p.StartTLS && u.Scheme == "ldap" {
+		if err := c.startTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %v", err)
+		}
+		c.conn.SetDeadline(deadline)
+	}
+	return c, nil
+}
+
+func (c *ldapConn) close() {
+	c.send(berElement(ldapUnbindRequest, nil))
+	c.conn.Close()
+}
+
+// send writes a request and returns its message ID
+func (c *ldapConn) send(op []byte) (int64, error) {
+	c.nextID++
+	message := berConstruct(berTagSequence, berInteger(berTagInteger, c.nextID), op)
+	if _, err := c.conn.Write(message); err != nil {
+		return 0, err
+	}
+	return c.nextID, nil
+}
+
+// receive reads the next response to a request, returning its operation
+func (c *ldapConn) receive(id int64) (*berPacket, error) {
+	for {
+		message, err := readBER(c.reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP response: %v", err)
+		}
+		if message.Identifier != berTagSequence || len(message.Children) < 2 {
+			return nil, errors.New("malformed LDAP message")
+		}
+		messageID, err := message.Children[0].Int()
+		if err != nil {
+			return nil, err
+		}
+		if messageID == 0 {
+			// Unsolicited notification, such as a notice of disconnection
+			return nil, errors.New("LDAP server closed the connection")
+		}
+		if messageID == id {
+			return message.Children[1], nil
+		}
+	}
+}
+
+// result decodes the LDAPResult at the start of a response
+func result(op *berPacket) error {
+	code, err := op.child(0, "result code")
+	if err != nil {
+		return err
+	}
+	n, err := code.Int()
+	if err != nil {
+		return err
+	}
+	if n == ldapResultSuccess {
+		return nil
+	}
+	var message string
+	if len(op.Children) > 2 {
+		message = string(op.Children[2].Value)
+	}
+	return &LDAPResultError{Code: n, Message: message}
+}
+
+func (c *ldapConn) bind(dn, password string) error {
+	id, err := c.send(berConstruct(ldapBindRequest,
+		berInteger(berTagInteger, 3),
+		berString(berTagOctetString, dn),
+		berString(berContext|0, password)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.Identifier != ldapBindResponse {
+		return fmt.Errorf("unexpected LDAP response 0x%x to bind", op.Identifier)
+	}
+	return result(op)
+}
+
+func (c *ldapConn) startTLS(config *tls.Config) error {
+	id, err := c.send(berConstruct(ldapExtendedRequest, berString(berContext|0, ldapStartTLSOID)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.Identifier != ldapExtendedResponse {
+		return fmt.Errorf("unexpected LDAP response 0x%x to StartTLS", op.Identifier)
+	}
+	if err := result(op); err != nil {
+		return err
+	}
+
+	conn := tls.Client(c.conn, config)
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	return nil
+}
+
+func (c *ldapConn) search(base, filter string, attributes []string) ([]*ldapEntry, error) {
+	encodedFilter, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([][]byte, len(attributes))
+	for i, attr := range attributes {
+		attrs[i] = berString(berTagOctetString, attr)
+	}
+
+	id, err := c.send(berConstruct(ldapSearchRequest,
+		berString(berTagOctetString, base),
+		berInteger(berTagEnumerated, ldapScopeSubtree),
+		berInteger(berTagEnumerated, ldapNeverDerefAliases),
+		berInteger(berTagInteger, 0),
+		berInteger(berTagInteger, 0),
+		berBoolean(false),
+		encodedFilter,
+		berConstruct(berTagSequence, attrs...)))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ldapEntry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Identifier {
+		case ldapSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapSearchReference:
+			// Referrals to other servers are not followed
+		case ldapSearchDone:
+			return entries, result(op)
+		default:
+			return nil, fmt.Errorf("unexpected LDAP response 0x%x to search", op.Identifier)
+		}
+	}
+}
+
+func parseEntry(op *berPacket) (*ldapEntry, error) {
+	dn, err := op.child(0, "entry name")
+	if err != nil {
+		return nil, err
+	}
+	entry := &ldapEntry{DN: string(dn.Value), Attributes: make(map[string][]string)}
+	attributes, err := op.child(1, "entry attributes")
+	if err != nil {
+		return nil, err
+	}
+	for _, attribute := range attributes.Children {
+		name, err := attribute.child(0, "attribute type")
+		if err != nil {
+			return nil, err
+		}
+		values, err := attribute.child(1, "attribute values")
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(string(name.Value))
+		for _, value := range values.Children {
+			entry.Attributes[key] = append(entry.Attributes[key], string(value.Value))
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEscapeFilter(t *testing.T) {
+	if got := EscapeFilter(`*)(uid=*`); got != `\2a\29\28uid=\2a` {
+		t.Errorf("EscapeFilter() = %q", got)
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		// (uid=jdoe)
+		{"(uid=jdoe)", "a30b040375696404046a646f65"},
+		// (objectClass=*)
+		{"objectClass=*", "870b6f626a656374436c617373"},
+		// (&(a=1)(!(b=2)))
+		{"(&(a=1)(!(b=2)))", "a012a306040161040131a208a306040162040132"},
+		// (cn=J*n)
+		{"(cn=J*n)", "a40c0402636e300680014a82016e"},
+		// (member:1.2:=x)
+		{"(member:1.2:=x)", "a9108103312e3282066d656d626572830178"},
+		// (cn=a\29b)
+		{`(cn=a\29b)`, "a3090402636e0403612962"},
+	}
+	for _, test := range tests {
+		encoded, err := compileFilter(test.filter)
+		if err != nil {
+			t.Errorf("compileFilter(%q) failed: %v", test.filter, err)
+			continue
+		}
+		if got := hex.EncodeToString(encoded); got != test.want {
+			t.Errorf("compileFilter(%q) = %s, want %s", test.filter, got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "(uid=jdoe", "(&(uid=a)", "(=x)", `(cn=\2)`, "(uid=a))"} {
+		if _, err := compileFilter(invalid); err == nil {
+			t.Errorf("compileFilter(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestCommonName(t *testing.T) {
+	tests := map[string]string{
+		"CN=LIV Admins,OU=Groups,DC=example,DC=com": "LIV Admins",
+		`cn=Smith\, John,dc=example`:                "Smith, John",
+		`CN=R\26D,DC=example`:                       "R&D",
+		"OU=Groups,DC=example":                      "",
+		"Engineering":                               "",
+	}
+	for dn, want := range tests {
+		if got := commonName(dn); got != want {
+			t.Errorf("commonName(%q) = %q, want %q", dn, got, want)
+		}
+	}
+}
+
+// fakeDirectory is a minimal LDAP server holding one user
+type fakeDirectory struct {
+	listener net.Listener
+	mu       sync.Mutex
+	filters  []string
+}
+
+const (
+	fakeServiceDN = "cn=liv,ou=services,dc=example,dc=com"
+	fakeUserDN    = "uid=jdoe,ou=people,dc=example,dc=com"
+)
+
+func newFakeDirectory(t *testing.T) *fakeDirectory {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	d := &fakeDirectory{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *fakeDirectory) URL() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *fakeDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		message, err := readBER(reader)
+		if err != nil {
+			return
+		}
+		id, _ := message.Children[0].Int()
+		op := message.Children[1]
+		reply := func(ops ...[]byte) {
+			for _, op := range ops {
+				conn.Write(berConstruct(berTagSequence, berInteger(berTagInteger, id), op))
+			}
+		}
+		done := func(identifier byte, code int64) []byte {
+			return berConstruct(identifier, berInteger(berTagEnumerated, code), berString(berTagOctetString, ""), berString(berTagOctetString, ""))
+		}
+
+		switch op.Identifier {
+		case ldapUnbindRequest:
+			return
+		case ldapBindRequest:
+			dn, password := string(op.Children[1].Value), string(op.Children[2].Value)
+			code := int64(ldapResultInvalidCred)
+			if (dn == fakeServiceDN && password == "service-secret") || (dn == fakeUserDN && password == "correct horse") {
+				code = ldapResultSuccess
+			}
+			reply(done(ldapBindResponse, code))
+		case ldapSearchRequest:
+			filter := hex.EncodeToString(encodePacket(op.Children[6]))
+			d.mu.Lock()
+			d.filters = append(d.filters, filter)
+			d.mu.Unlock()
+
+			var entries [][]byte
+			switch {
+			case strings.Contains(filter, hex.EncodeToString([]byte("member"))):
+				for _, group := range []string{"cn=liv-admins,ou=groups,dc=example,dc=com", "cn=everyone,ou=groups,dc=example,dc=com"} {
+					entries = append(entries, berConstruct(ldapSearchEntry, berString(berTagOctetString, group), berConstruct(berTagSequence)))
+				}
+			case strings.Contains(filter, hex.EncodeToString([]byte("jdoe"))):
+				entries = append(entries, berConstruct(ldapSearchEntry,
+					berString(berTagOctetString, fakeUserDN),
+					berConstruct(berTagSequence,
+						fakeAttribute("displayName", "Jane Doe"),
+						fakeAttribute("mail", "jdoe@example.com"),
+						fakeAttribute("memberOf", "cn=Authors,ou=groups,dc=example,dc=com"))))
+			}
+			reply(append(entries, done(ldapSearchDone, ldapResultSuccess))...)
+		}
+	}
+}
+
+func fakeAttribute(name string, values ...string) []byte {
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		encoded[i] = berString(berTagOctetString, value)
+	}
+	return berConstruct(berTagSequence, berString(berTagOctetString, name), berConstruct(berTagSet, encoded...))
+}
+
+// encodePacket re-encodes a decoded element
+func encodePacket(p *berPacket) []byte {
+	return berElement(p.Identifier, p.Value)
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	directory := newFakeDirectory(t)
+	provider := &LDAPProvider{
+		ProviderName: "Directory",
+		URL:          directory.URL(),
+		BindDN:       fakeServiceDN,
+		BindPassword: "service-secret",
+		BaseDN:       "dc=example,dc=com",
+	}
+
+	id, err := provider.Authenticate(context.Background(), "jdoe", "correct horse")
+	if err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if id.Username != "jdoe" || id.Name != "Jane Doe" || id.Email != "jdoe@example.com" || id.Provider != "Directory" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	if len(id.Groups) != 1 || id.Groups[0] != "cn=Authors,ou=groups,dc=example,dc=com" {
+		t.Errorf("groups = %v", id.Groups)
+	}
+
+	for _, credentials := range [][2]string{{"jdoe", "wrong"}, {"nobody", "correct horse"}, {"jdoe", ""}} {
+		if _, err := provider.Authenticate(context.Background(), credentials[0], credentials[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want ErrInvalidCredentials", credentials[0], credentials[1], err)
+		}
+	}
+
+	// Filter syntax in usernames is escaped rather than interpreted
+	if _, err := provider.Authenticate(context.Background(), "*", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate(*) = %v, want ErrInvalidCredentials", err)
+	}
+	directory.mu.Lock()
+	last := directory.filters[len(directory.filters)-1]
+	directory.mu.Unlock()
+	if want := hex.EncodeToString([]byte("*")); !strings.Contains(last, "04037569640401"+want) {
+		t.Errorf("username was not escaped in filter %s", last)
+	}
+
+	provider.BindPassword = "wrong"
+	if _, err := provider.Authenticate(context.Background(), "jdoe", "correct horse"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() with a bad service account = %v", err)
+	}
+}
+
+func TestLDAPGroupFilter(t *testing.T) {
+	directory := newFakeDirectory(t)
+	provider := &LDAPProvider{
+		ProviderName: "AD",
+		URL:          directory.URL(),
+		BindDN:       fakeServiceDN,
+		BindPassword: "service-secret",
+		BaseDN:       "dc=example,dc=com",
+		GroupFilter:  ADNestedGroupFilter,
+	}
+
+	id, err := provider.Authenticate(context.Background(), "jdoe", "correct horse")
+	if err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if len(id.Groups) != 2 || id.Groups[0] != "cn=liv-admins,ou=groups,dc=example,dc=com" {
+		t.Errorf("groups = %v", id.Groups)
+	}
+
+	directory.mu.Lock()
+	last := directory.filters[len(directory.filters)-1]
+	directory.mu.Unlock()
+	if !strings.HasPrefix(last, "a9") || !strings.Contains(last, hex.EncodeToString([]byte(fakeUserDN))) {
+		t.Errorf("group search used filter %s", last)
+	}
+
+	mapping := &RoleMapping{Groups: map[string][]string{"LIV-Admins": {RoleAdmin}}, Default: []string{RoleReader}}
+	if roles := mapping.Roles(id.Groups); len(roles) != 2 || roles[0] != RoleAdmin || roles[1] != RoleReader {
+		t.Errorf("roles = %v", roles)
+	}
+}
+
+func TestBERInteger(t *testing.T) {
+	for n, want := range map[int64]string{0: "020100", 127: "02017f", 128: "02020080", 256: "02020100", -1: "0201ff"} {
+		encoded := berInteger(berTagInteger, n)
+		if got := hex.EncodeToString(encoded); got != want {
+			t.Errorf("berInteger(%d) = %s, want %s", n, got, want)
+		}
+		p, err := readBER(bufio.NewReader(bytes.NewReader(encoded)))
+		if err != nil {
+			t.Fatalf("readBER failed: %v", err)
+		}
+		if got, _ := p.Int(); got != n {
+			t.Errorf("Int() = %d, want %d", got, n)
+		}
+	}
+}
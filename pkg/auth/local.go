@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+// Local account settings
+const (
+	// DefaultLocalProviderName is shown on the login page when the local
+	// provider is not named
+	DefaultLocalProviderName = "Local accounts"
+	// MinPasswordLength is the shortest password HashPassword accepts
+	MinPasswordLength = 12
+	passwordHashCost  = 12
+)
+
+// unknownUserHash is compared against when a user does not exist, so that
+// unknown users take as long to refuse as wrong passwords
+var unknownUserHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("liv-unknown-user"), passwordHashCost)
+	return hash
+})
+
+// LocalAccount is a user kept in a local accounts file. Roles are granted
+// directly; groups are mapped to roles like those of directory users.
+type LocalAccount struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password_hash"`
+	Name         string   `json:"name,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	Roles        []string `json:"roles,omitempty"`
+	Disabled     bool     `json:"disabled,omitempty"`
+}
+
+// LocalAccounts is a local accounts file:
+//
+//	{"users": [{"username": "alice", "password_hash": "$2a$12$...", "roles": ["admin"]}]}
+//
+// Passwords are stored as bcrypt hashes made by HashPassword.
+type LocalAccounts struct {
+	Users []*LocalAccount `json:"users"`
+}
+
+// ReadLocalAccounts reads a local accounts file. A missing file holds no
+// accounts.
+func ReadLocalAccounts(path string) (*LocalAccounts, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &LocalAccounts{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local accounts: %v", err)
+	}
+	var accounts LocalAccounts
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("invalid local accounts file %s: %v", path, err)
+	}
+	return &accounts, nil
+}
+
+// Write replaces the accounts file at path in one step, so servers never
+// read half of it. A new file is readable by its owner only; a replaced one
+// keeps its permissions.
+func (a *LocalAccounts) Write(path string) error {
+	sort.Slice(a.Users, func(i, j int) bool { return a.Users[i].Username < a.Users[j].Username })
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write local accounts: %v", err)
+	}
+	return nil
+}
+
+// Lookup returns the account of username, matched without regard to case
+func (a *LocalAccounts) Lookup(username string) *LocalAccount {
+	for _, account := range a.Users {
+		if strings.EqualFold(account.Username, username) {
+			return account
+		}
+	}
+	return nil
+}
+
+// SetPassword sets the password of username, adding the account if it does
+// not exist, and returns the account
+func (a *LocalAccounts) SetPassword(username, password string) (*LocalAccount, error) {
+	if username == "" || strings.ContainsAny(username, " \t\r\n") {
+		return nil, fmt.Errorf("invalid username %q", username)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	account := a.Lookup(username)
+	if account == nil {
+		account = &LocalAccount{Username: username}
+		a.Users = append(a.Users, account)
+	}
+	account.PasswordHash = hash
+	return account, nil
+}
+
+// Remove deletes the account of username and reports whether it existed
+func (a *LocalAccounts) Remove(username string) bool {
+	for i, account := range a.Users {
+		if strings.EqualFold(account.Username, username) {
+			a.Users = append(a.Users[:i], a.Users[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// HashPassword returns the bcrypt hash of a password for a local accounts
+// file
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// LocalProvider authenticates users against a local accounts file, for
+// servers without a directory or to keep an administrator who can sign in
+// when the directory is down. The file is read again when it changes, so
+// accounts edited with security-admin apply without a restart.
+type LocalProvider struct {
+	ProviderName string
+	Path         string
+
+	mu       sync.Mutex
+	accounts *LocalAccounts
+	modified time.Time
+	size     int64
+}
+
+// Name returns the provider name shown on the login page
+func (p *LocalProvider) Name() string {
+	if p.ProviderName == "" {
+		return DefaultLocalProviderName
+	}
+	return p.ProviderName
+}
+
+// load returns the accounts, reading the file again when it has changed
+func (p *LocalProvider) load() (*LocalAccounts, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, err := os.Stat(p.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read local accounts: %v", err)
+	}
+	var modified time.Time
+	var size int64
+	if info != nil {
+		modified, size = info.ModTime(), info.Size()
+	}
+	if p.accounts != nil && modified.Equal(p.modified) && size == p.size {
+		return p.accounts, nil
+	}
+	accounts, err := ReadLocalAccounts(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	p.accounts, p.modified, p.size = accounts, modified, size
+	return accounts, nil
+}
+
+// Authenticate checks a username and password against the accounts file
+func (p *LocalProvider) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	accounts, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	account := accounts.Lookup(username)
+	if account == nil || account.Disabled || account.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(unknownUserHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{
+		Username: account.Username,
+		Name:     account.Name,
+		Email:    account.Email,
+		Provider: p.Name(),
+		Groups:   append([]string(nil), account.Groups...),
+		Roles:    append([]string(nil), account.Roles...),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	accounts, err := ReadLocalAccounts(path)
+	if err != nil || len(accounts.Users) != 0 {
+		t.Fatalf("ReadLocalAccounts() of a missing file = %v, %v", accounts, err)
+	}
+	if _, err := accounts.SetPassword("alice", "short"); err == nil {
+		t.Error("SetPassword() accepted a short password")
+	}
+	account, err := accounts.SetPassword("alice", "correct horse battery")
+	if err != nil {
+		t.Fatalf("SetPassword() failed: %v", err)
+	}
+	account.Roles = []string{RoleAuditor}
+	account.Groups = []string{"Security"}
+	if err := accounts.Write(path); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("accounts file mode = %v, %v", info.Mode(), err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "correct horse") {
+		t.Error("accounts file holds the password")
+	}
+
+	provider := &LocalProvider{Path: path}
+	ctx := context.Background()
+	id, err := provider.Authenticate(ctx, "ALICE", "correct horse battery")
+	if err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if id.Username != "alice" || id.Provider != DefaultLocalProviderName || strings.Join(id.Roles, ",") != RoleAuditor {
+		t.Errorf("Authenticate() = %+v", id)
+	}
+	for _, credentials := range [][2]string{{"alice", "wrong password!"}, {"bob", "correct horse battery"}} {
+		if _, err := provider.Authenticate(ctx, credentials[0], credentials[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%s) error = %v, want ErrInvalidCredentials", credentials[0], err)
+		}
+	}
+
+	// Disabling the account applies without restarting
+	account.Disabled = true
+	if err := accounts.Write(path); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	if _, err := provider.Authenticate(ctx, "alice", "correct horse battery"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() of a disabled account error = %v", err)
+	}
+	if !accounts.Remove("Alice") || accounts.Remove("alice") {
+		t.Error("Remove() did not remove the account once")
+	}
+}
+
+func TestRoleMappingGrant(t *testing.T) {
+	mapping := &RoleMapping{Groups: map[string][]string{"Security": {RoleAuditor}}, Default: []string{RoleViewer}}
+	if got := strings.Join(mapping.Grant([]string{RoleAdmin}, []string{"security"}), ","); got != "admin,auditor,viewer" {
+		t.Errorf("Grant() = %s", got)
+	}
+}
@@ -0,0 +1,594 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenID Connect settings
+const (
+	oidcRequestLifetime = 10 * time.Minute
+	oidcKeyRefresh      = time.Minute
+	oidcTimeout         = 10 * time.Second
+	maxOIDCResponseSize = 1 << 20
+	defaultOIDCSkew     = 2 * time.Minute
+)
+
+// OIDCProvider signs users in through an OpenID Connect provider such as
+// Azure AD, Okta, Google, Keycloak or Dex, using the authorization code flow
+// with PKCE. The provider's endpoints and signing keys are discovered from its
+// issuer, and ID tokens must be signed with RSA or ECDSA.
+type OIDCProvider struct {
+	ProviderName string
+	// Issuer is the provider's issuer URL, where its discovery document is
+	// published under /.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is this server's callback URL registered with the provider
+	RedirectURL string
+	// Scopes requested besides openid; profile and email when empty
+	Scopes []string
+
+	// Claim names of the user's username, display name, email address and
+	// groups. The username defaults to preferred_username, then email, then
+	// the subject.
+	UsernameClaim string
+	NameClaim     string
+	EmailClaim    string
+	GroupsClaim   string
+
+	// ClockSkew is the tolerance applied to token lifetimes
+	ClockSkew  time.Duration
+	HTTPClient *http.Client
+	Now        func() time.Time
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+	requests    map[string]*oidcRequest
+}
+
+// oidcDiscovery is the part of the discovery document the provider uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcRequest is a sign-in waiting for the provider's redirect, by state
+type oidcRequest struct {
+	nonce      string
+	verifier   string
+	relayState string
+	expires    time.Time
+}
+
+// Name returns the provider name shown on the login page
+func (p *OIDCProvider) Name() string {
+	return p.ProviderName
+}
+
+func (p *OIDCProvider) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+func (p *OIDCProvider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return &http.Client{Timeout: oidcTimeout}
+}
+
+// getJSON fetches a JSON document from the provider
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := p.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, response.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxOIDCResponseSize)).Decode(value); err != nil {
+		return fmt.Errorf("invalid response from %s: %v", target, err)
+	}
+	return nil
+}
+
+// discover returns the provider's endpoints, fetching them on first use
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	discovery = &oidcDiscovery{}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, fmt.Errorf("OpenID Connect discovery failed: %v", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, fmt.Errorf("OpenID Connect discovery returned issuer %s", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OpenID Connect discovery document is incomplete")
+	}
+
+	p.mu.Lock()
+	p.discovery = discovery
+	p.mu.Unlock()
+	return discovery, nil
+}
+
+// LoginURL returns the provider's authorization URL carrying a new request
+func (p *OIDCProvider) LoginURL(relayState string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		if secrets[i], err = randomToken(); err != nil {
+			return "", err
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+	challenge := sha256.Sum256([]byte(verifier))
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+	target, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %v", err)
+	}
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", "openid "+strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	target.RawQuery = query.Encode()
+
+	now := p.now()
+	p.mu.Lock()
+	if p.requests == nil {
+		p.requests = make(map[string]*oidcRequest)
+	}
+	for pending, request := range p.requests {
+		if now.After(request.expires) {
+			delete(p.requests, pending)
+		}
+	}
+	p.requests[state] = &oidcRequest{
+		nonce:      nonce,
+		verifier:   verifier,
+		relayState: relayState,
+		expires:    now.Add(oidcRequestLifetime),
+	}
+	p.mu.Unlock()
+
+	return target.String(), nil
+}
+
+// HandleCallback exchanges the authorization code the provider redirected
+// back with for an ID token, and validates it
+func (p *OIDCProvider) HandleCallback(r *http.Request) (*Identity, string, error) {
+	query := r.URL.Query()
+	if code := query.Get("error"); code != "" {
+		message := code
+		if description := query.Get("error_description"); description != "" {
+			message += ": " + description
+		}
+		return nil, "", fmt.Errorf("identity provider rejected the sign-in: %s", message)
+	}
+
+	state := query.Get("state")
+	p.mu.Lock()
+	request := p.requests[state]
+	delete(p.requests, state)
+	p.mu.Unlock()
+	if request == nil || p.now().After(request.expires) {
+		return nil, "", errors.New("OpenID Connect response does not answer a pending sign-in")
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, "", errors.New("OpenID Connect response has no authorization code")
+	}
+
+	rawToken, err := p.exchange(r.Context(), code, request.verifier)
+	if err != nil {
+		return nil, "", err
+	}
+	claims, err := p.VerifyIDToken(r.Context(), rawToken, request.nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	identity, err := p.identity(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, request.relayState, nil
+}
+
+// exchange redeems an authorization code at the token endpoint and returns
+// the ID token
+func (p *OIDCProvider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.ClientID},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	response, err := p.client().Do(request)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %v", err)
+	}
+	defer response.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxOIDCResponseSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("token request refused: %s %s", token.Error, token.ErrorDescription)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", response.Status)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response has no ID token")
+	}
+	return token.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, lifetime and nonce of
+// an ID token and returns its claims
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (map[string]interface{}, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("ID token is not a signed JWT")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid ID token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token signature: %v", err)
+	}
+	key, err := p.signingKey(ctx, discovery, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("invalid ID token signature: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %v", err)
+	}
+	if issuer, _ := claims["iss"].(string); issuer != discovery.Issuer {
+		return nil, errors.New("ID token is from an unknown issuer")
+	}
+	audiences := claimStrings(claims["aud"])
+	audienceMatches := false
+	for _, audience := range audiences {
+		audienceMatches = audienceMatches || audience == p.ClientID
+	}
+	if !audienceMatches {
+		return nil, errors.New("ID token is not addressed to this client")
+	}
+	if party, ok := claims["azp"].(string); ok && len(audiences) > 1 && party != p.ClientID {
+		return nil, errors.New("ID token was issued to another client")
+	}
+
+	now := p.now()
+	skew := p.ClockSkew
+	if skew == 0 {
+		skew = defaultOIDCSkew
+	}
+	expires, ok := claims["exp"].(float64)
+	if !ok || !now.Before(time.Unix(int64(expires), 0).Add(skew)) {
+		return nil, errors.New("ID token has expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(skew).Before(time.Unix(int64(notBefore), 0)) {
+		return nil, errors.New("ID token is not yet valid")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); nonce != "" && tokenNonce != nonce {
+		return nil, errors.New("ID token does not answer this sign-in")
+	}
+	return claims, nil
+}
+
+// identity extracts the user from ID token claims
+func (p *OIDCProvider) identity(claims map[string]interface{}) (*Identity, error) {
+	claim := func(name string) string {
+		value, _ := claims[name].(string)
+		return value
+	}
+	username := ""
+	if p.UsernameClaim != "" {
+		username = claim(p.UsernameClaim)
+	} else {
+		for _, name := range []string{"preferred_username", "email", "sub"} {
+			if username = claim(name); username != "" {
+				break
+			}
+		}
+	}
+	if username == "" {
+		return nil, errors.New("ID token does not name the user")
+	}
+
+	identity := &Identity{Username: username, Provider: p.ProviderName}
+	identity.Name = claim(defaultString(p.NameClaim, "name"))
+	identity.Email = claim(defaultString(p.EmailClaim, "email"))
+	identity.Groups = claimStrings(claims[defaultString(p.GroupsClaim, "groups")])
+	return identity, nil
+}
+
+// signingKey returns the provider key with id, fetching the key set again
+// when the provider may have rotated its keys
+func (p *OIDCProvider) signingKey(ctx context.Context, discovery *oidcDiscovery, id string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, found := p.lookupKey(id)
+	refresh := !found && p.now().Sub(p.keysFetched) >= oidcKeyRefresh
+	p.mu.Unlock()
+	if found {
+		return key, nil
+	}
+	if !refresh {
+		return nil, fmt.Errorf("unknown ID token signing key %q", id)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, webKey := range set.Keys {
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+		if publicKey, err := webKey.publicKey(); err == nil {
+			keys[webKey.KeyID] = publicKey
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.keysFetched = keys, p.now()
+	if key, found = p.lookupKey(id); !found {
+		return nil, fmt.Errorf("unknown ID token signing key %q", id)
+	}
+	return key, nil
+}
+
+// lookupKey finds a cached key. Tokens without a key ID are accepted when
+// the provider publishes a single key. The caller holds the lock.
+func (p *OIDCProvider) lookupKey(id string) (crypto.PublicKey, bool) {
+	if key, found := p.keys[id]; found {
+		return key, true
+	}
+	if id == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// jsonWebKey is a public key from a JSON Web Key Set (RFC 7517)
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var checked ecdh.Curve
+		switch k.Curve {
+		case "P-256":
+			curve, checked = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, checked = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, checked = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		// The point must be on the curve
+		if _, err := checked.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// verifyJWTSignature checks a JWS signature made with an RSA or ECDSA
+// algorithm; unsigned and HMAC tokens are refused
+func verifyJWTSignature(algorithm string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch algorithm[len(algorithm)-min(3, len(algorithm)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	digester := hash.New()
+	digester.Write([]byte(signed))
+	digest := digester.Sum(nil)
+
+	switch strings.TrimRight(algorithm, "0123456789") {
+	case "RS", "PS":
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key does not match the algorithm")
+		}
+		if algorithm[0] == 'P' {
+			return rsa.VerifyPSS(publicKey, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(publicKey, hash, digest, signature)
+	case "ES":
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("key does not match the algorithm")
+		}
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("signature has the wrong length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, digest, r, s) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
+
+func decodeJWTPart(part string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// claimStrings reads a claim holding a string or a list of strings
+func claimStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// randomToken returns an unguessable URL-safe token
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
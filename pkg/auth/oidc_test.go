@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testOIDCProvider is an OpenID Connect provider issuing ID tokens for one
+// authorization code
+type testOIDCProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	code      string
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	idp := &testOIDCProvider{key: key, code: "code-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, secret, _ := r.BasicAuth()
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if user != "liv" || secret != "s3cret" || r.PostFormValue("code") != idp.code ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, "RS256", "key-1", idp.claims)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testOIDCProvider) sign(t *testing.T, algorithm, keyID string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "kid": keyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	provider := &OIDCProvider{
+		ProviderName: "Test",
+		Issuer:       idp.server.URL,
+		ClientID:     "liv",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://liv.example.com/auth/sso/Test/callback",
+	}
+
+	login := func() url.Values {
+		target, err := provider.LoginURL("/policies")
+		if err != nil {
+			t.Fatalf("LoginURL() failed: %v", err)
+		}
+		parsed, _ := url.Parse(target)
+		query := parsed.Query()
+		if parsed.Path != "/authorize" || query.Get("client_id") != "liv" || query.Get("code_challenge_method") != "S256" || !strings.HasPrefix(query.Get("scope"), "openid ") {
+			t.Fatalf("LoginURL() = %s", target)
+		}
+		idp.challenge = query.Get("code_challenge")
+		idp.claims = map[string]interface{}{
+			"iss":                idp.server.URL,
+			"aud":                "liv",
+			"sub":                "00u1",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"nonce":              query.Get("nonce"),
+			"preferred_username": "jdoe@example.com",
+			"name":               "Jane Doe",
+			"groups":             []string{"Security", "Everyone"},
+		}
+		return query
+	}
+	callback := func(query url.Values) (*Identity, string, error) {
+		request := httptest.NewRequest(http.MethodGet, "/auth/sso/Test/callback?"+query.Encode(), nil)
+		return provider.HandleCallback(request)
+	}
+
+	query := login()
+	response := url.Values{"code": {idp.code}, "state": {query.Get("state")}}
+	id, relayState, err := callback(response)
+	if err != nil {
+		t.Fatalf("HandleCallback() failed: %v", err)
+	}
+	if id.Username != "jdoe@example.com" || id.Name != "Jane Doe" || strings.Join(id.Groups, ",") != "Security,Everyone" || relayState != "/policies" {
+		t.Errorf("HandleCallback() = %+v, %q", id, relayState)
+	}
+	if _, _, err := callback(response); err == nil {
+		t.Error("HandleCallback() accepted a response twice")
+	}
+
+	query = login()
+	idp.claims["nonce"] = "replayed"
+	if _, _, err := callback(url.Values{"code": {idp.code}, "state": {query.Get("state")}}); err == nil || !strings.Contains(err.Error(), "does not answer") {
+		t.Errorf("HandleCallback() with another nonce error = %v", err)
+	}
+	query = login()
+	if _, _, err := callback(url.Values{"error": {"access_denied"}, "state": {query.Get("state")}}); err == nil {
+		t.Error("HandleCallback() accepted an error response")
+	}
+
+	// Tokens are checked for their audience, lifetime and signature
+	ctx := context.Background()
+	claims := func(edit func(map[string]interface{})) map[string]interface{} {
+		claims := map[string]interface{}{"iss": idp.server.URL, "aud": []string{"liv", "other"}, "azp": "liv", "sub": "00u1", "exp": time.Now().Add(time.Hour).Unix()}
+		if edit != nil {
+			edit(claims)
+		}
+		return claims
+	}
+	if _, err := provider.VerifyIDToken(ctx, idp.sign(t, "RS256", "key-1", claims(nil)), ""); err != nil {
+		t.Errorf("VerifyIDToken() failed: %v", err)
+	}
+	invalid := map[string]string{
+		"audience": idp.sign(t, "RS256", "key-1", claims(func(c map[string]interface{}) { c["aud"] = "other" })),
+		"party":    idp.sign(t, "RS256", "key-1", claims(func(c map[string]interface{}) { c["azp"] = "other" })),
+		"issuer":   idp.sign(t, "RS256", "key-1", claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" })),
+		"expired":  idp.sign(t, "RS256", "key-1", claims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() })),
+		"key":      idp.sign(t, "RS256", "key-2", claims(nil)),
+		"hmac":     idp.sign(t, "HS256", "key-1", claims(nil)),
+	}
+	token := idp.sign(t, "RS256", "key-1", claims(nil))
+	invalid["tampered"] = strings.Replace(token, ".", ".e30", 1)
+	for name, token := range invalid {
+		if _, err := provider.VerifyIDToken(ctx, token, ""); err == nil {
+			t.Errorf("VerifyIDToken() accepted a token with a bad %s", name)
+		}
+	}
+}
+
+func TestVerifyJWTSignatureECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	webKey := &jsonWebKey{
+		KeyType: "EC",
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:       base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+	publicKey, err := webKey.publicKey()
+	if err != nil {
+		t.Fatalf("publicKey() failed: %v", err)
+	}
+	digest := sha256.Sum256([]byte("header.payload"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	if err := verifyJWTSignature("ES256", publicKey, "header.payload", signature); err != nil {
+		t.Errorf("verifyJWTSignature() failed: %v", err)
+	}
+	if err := verifyJWTSignature("ES256", publicKey, "header.tampered", signature); err == nil {
+		t.Error("verifyJWTSignature() accepted a tampered token")
+	}
+	if err := verifyJWTSignature("none", publicKey, "header.payload", nil); err == nil {
+		t.Error("verifyJWTSignature() accepted an unsigned token")
+	}
+
+	webKey.Y = webKey.X
+	if _, err := webKey.publicKey(); err == nil {
+		t.Error("publicKey() accepted a point off the curve")
+	}
+}
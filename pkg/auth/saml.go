@@ -0,0 +1,413 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SAML 2.0 namespaces and identifiers
+const (
+	nsSAMLAssertion     = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLProtocol      = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsSAMLMetadata      = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer          = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlHTTPPost        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlNameIDFormat    = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	maxSAMLResponseSize = 256 << 10
+	samlRequestLifetime = 10 * time.Minute
+	defaultSAMLSkew     = 2 * time.Minute
+)
+
+// SAMLProvider signs users in through a SAML 2.0 identity provider such as
+// Active Directory Federation Services, Azure AD, Okta or Keycloak, using the
+// HTTP-Redirect binding for requests and the HTTP-POST binding for responses.
+//
+// Either the response or its assertion must be signed with RSA-SHA256 or
+// RSA-SHA512 using exclusive canonicalization. Encrypted assertions are not
+// supported, so assertion encryption must be disabled for this service
+// provider at the identity provider.
+type SAMLProvider struct {
+	ProviderName string
+	// EntityID identifies this service provider to the identity provider
+	EntityID string
+	// ACSURL is the assertion consumer service URL the identity provider posts
+	// responses to
+	ACSURL string
+
+	// IdPEntityID is the issuer of the identity provider's assertions
+	IdPEntityID string
+	// IdPSSOURL receives authentication requests
+	IdPSSOURL string
+	// IdPCertificates verify the identity provider's signatures. More than one
+	// may be configured while the identity provider rolls over its key.
+	IdPCertificates []*x509.Certificate
+
+	// Attribute names of the user's username, display name, email address and
+	// groups. The username defaults to the subject NameID.
+	UsernameAttribute string
+	NameAttribute     string
+	EmailAttribute    string
+	GroupsAttribute   string
+
+	// AllowIdPInitiated accepts responses that do not answer a request from
+	// this provider
+	AllowIdPInitiated bool
+	// ClockSkew is the tolerance applied to validity periods
+	ClockSkew time.Duration
+	Now       func() time.Time
+
+	mu       sync.Mutex
+	requests map[string]time.Time
+	seen     map[string]time.Time
+}
+
+// Name returns the provider name shown on the login page
+func (p *SAMLProvider) Name() string {
+	return p.ProviderName
+}
+
+func (p *SAMLProvider) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// LoginURL returns the identity provider URL carrying a new authentication
+// request
+func (p *SAMLProvider) LoginURL(relayState string) (string, error) {
+	id, err := samlID()
+	if err != nil {
+		return "", err
+	}
+	now := p.now()
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, `<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s"`,
+		nsSAMLProtocol, nsSAMLAssertion, id, now.UTC().Format(time.RFC3339))
+	writeXMLAttr(&request, "Destination", p.IdPSSOURL)
+	writeXMLAttr(&request, "AssertionConsumerServiceURL", p.ACSURL)
+	writeXMLAttr(&request, "ProtocolBinding", samlHTTPPost)
+	request.WriteString(`><saml:Issuer>`)
+	xml.EscapeText(&request, []byte(p.EntityID))
+	request.WriteString(`</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`)
+
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	writer.Write(request.Bytes())
+	writer.Close()
+
+	target, err := url.Parse(p.IdPSSOURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid identity provider URL: %v", err)
+	}
+	query := target.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+	target.RawQuery = query.Encode()
+
+	p.mu.Lock()
+	if p.requests == nil {
+		p.requests = make(map[string]time.Time)
+	}
+	for pending, expires := range p.requests {
+		if now.After(expires) {
+			delete(p.requests, pending)
+		}
+	}
+	p.requests[id] = now.Add(samlRequestLifetime)
+	p.mu.Unlock()
+
+	return target.String(), nil
+}
+
+// HandleCallback validates a response posted to the assertion consumer service
+func (p *SAMLProvider) HandleCallback(r *http.Request) (*Identity, string, error) {
+	if r.Method != http.MethodPost {
+		return nil, "", errors.New("SAML responses must be posted")
+	}
+	r.Body = http.MaxBytesReader(nil, r.Body, 2*maxSAMLResponseSize)
+	if err := r.ParseForm(); err != nil {
+		return nil, "", fmt.Errorf("invalid SAML response: %v", err)
+	}
+	identity, err := p.ParseResponse(r.PostForm.Get("SAMLResponse"))
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, r.PostForm.Get("RelayState"), nil
+}
+
+// ParseResponse validates a base64-encoded SAML response and returns the
+// identity it asserts
+func (p *SAMLProvider) ParseResponse(encoded string) (*Identity, error) {
+	if len(encoded) > maxSAMLResponseSize {
+		return nil, errors.New("SAML response is too large")
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML response encoding: %v", err)
+	}
+	response, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML response: %v", err)
+	}
+	if !response.Is(nsSAMLProtocol, "Response") {
+		return nil, errors.New("not a SAML response")
+	}
+
+	if status := response.Element(nsSAMLProtocol, "Status"); status == nil {
+		return nil, errors.New("SAML response has no status")
+	} else if code := status.Element(nsSAMLProtocol, "StatusCode"); code == nil || code.Attr("Value") != samlStatusSuccess {
+		message := ""
+		if statusMessage := status.Element(nsSAMLProtocol, "StatusMessage"); statusMessage != nil {
+			message = ": " + strings.TrimSpace(statusMessage.Text())
+		}
+		return nil, fmt.Errorf("identity provider rejected the sign-in%s", message)
+	}
+	if destination := response.Attr("Destination"); destination != "" && destination != p.ACSURL {
+		return nil, fmt.Errorf("SAML response is addressed to %s", destination)
+	}
+	if issuer := response.Element(nsSAMLAssertion, "Issuer"); issuer != nil && strings.TrimSpace(issuer.Text()) != p.IdPEntityID {
+		return nil, errors.New("SAML response is from an unknown issuer")
+	}
+
+	responseSigned := false
+	switch err := verifySignature(response, p.IdPCertificates); err {
+	case nil:
+		responseSigned = true
+	case errNotSigned:
+	default:
+		return nil, fmt.Errorf("invalid SAML response signature: %v", err)
+	}
+
+	if response.Element(nsSAMLAssertion, "EncryptedAssertion") != nil {
+		return nil, errors.New("encrypted SAML assertions are not supported")
+	}
+	assertions := response.Elements(nsSAMLAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("SAML response must contain exactly one assertion, found %d", len(assertions))
+	}
+	assertion := assertions[0]
+	if err := verifySignature(assertion, p.IdPCertificates); err != nil {
+		if err != errNotSigned || !responseSigned {
+			return nil, fmt.Errorf("invalid SAML assertion signature: %v", err)
+		}
+	}
+
+	return p.validateAssertion(assertion, response.Attr("InResponseTo"))
+}
+
+// validateAssertion checks the conditions of a signed assertion and extracts
+// the identity
+func (p *SAMLProvider) validateAssertion(assertion *xmlElement, inResponseTo string) (*Identity, error) {
+	now := p.now()
+	skew := p.ClockSkew
+	if skew == 0 {
+		skew = defaultSAMLSkew
+	}
+
+	if issuer := assertion.Element(nsSAMLAssertion, "Issuer"); issuer == nil || strings.TrimSpace(issuer.Text()) != p.IdPEntityID {
+		return nil, errors.New("SAML assertion is from an unknown issuer")
+	}
+
+	var expires time.Time
+	if conditions := assertion.Element(nsSAMLAssertion, "Conditions"); conditions != nil {
+		if notBefore, err := samlTime(conditions.Attr("NotBefore")); err != nil {
+			return nil, err
+		} else if !notBefore.IsZero() && now.Add(skew).Before(notBefore) {
+			return nil, errors.New("SAML assertion is not yet valid")
+		}
+		notOnOrAfter, err := samlTime(conditions.Attr("NotOnOrAfter"))
+		if err != nil {
+			return nil, err
+		}
+		if !notOnOrAfter.IsZero() && !now.Add(-skew).Before(notOnOrAfter) {
+			return nil, errors.New("SAML assertion has expired")
+		}
+		expires = notOnOrAfter
+
+		for _, restriction := range conditions.Elements(nsSAMLAssertion, "AudienceRestriction") {
+			allowed := false
+			for _, audience := range restriction.Elements(nsSAMLAssertion, "Audience") {
+				if strings.TrimSpace(audience.Text()) == p.EntityID {
+					allowed = true
+				}
+			}
+			if !allowed {
+				return nil, errors.New("SAML assertion is intended for another service provider")
+			}
+		}
+	}
+
+	subject := assertion.Element(nsSAMLAssertion, "Subject")
+	if subject == nil {
+		return nil, errors.New("SAML assertion has no subject")
+	}
+	confirmed := false
+	for _, confirmation := range subject.Elements(nsSAMLAssertion, "SubjectConfirmation") {
+		if confirmation.Attr("Method") != samlBearer {
+			continue
+		}
+		data := confirmation.Element(nsSAMLAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if recipient := data.Attr("Recipient"); recipient != p.ACSURL {
+			continue
+		}
+		notOnOrAfter, err := samlTime(data.Attr("NotOnOrAfter"))
+		if err != nil || notOnOrAfter.IsZero() || !now.Add(-skew).Before(notOnOrAfter) {
+			continue
+		}
+		if expires.IsZero() || notOnOrAfter.Before(expires) {
+			expires = notOnOrAfter
+		}
+		if id := data.Attr("InResponseTo"); id != "" {
+			if inResponseTo != "" && inResponseTo != id {
+				continue
+			}
+			inResponseTo = id
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, errors.New("SAML assertion has no valid bearer confirmation for this service")
+	}
+
+	// Responses must answer an outstanding request, and each assertion is
+	// accepted once
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if inResponseTo != "" {
+		requestExpires, pending := p.requests[inResponseTo]
+		if !pending || now.After(requestExpires) {
+			return nil, errors.New("SAML response does not answer a pending sign-in")
+		}
+	} else if !p.AllowIdPInitiated {
+		return nil, errors.New("unsolicited SAML responses are not accepted")
+	}
+	assertionID := assertion.Attr("ID")
+	if assertionID == "" {
+		return nil, errors.New("SAML assertion has no ID")
+	}
+	if p.seen == nil {
+		p.seen = make(map[string]time.Time)
+	}
+	for id, until := range p.seen {
+		if now.After(until) {
+			delete(p.seen, id)
+		}
+	}
+	if _, replayed := p.seen[assertionID]; replayed {
+		return nil, errors.New("SAML assertion has already been used")
+	}
+	p.seen[assertionID] = expires.Add(skew)
+	delete(p.requests, inResponseTo)
+
+	identity := &Identity{Provider: p.ProviderName}
+	if nameID := subject.Element(nsSAMLAssertion, "NameID"); nameID != nil {
+		identity.Username = strings.TrimSpace(nameID.Text())
+	}
+	attributes := samlAttributes(assertion)
+	if p.UsernameAttribute != "" {
+		if values := attributes[p.UsernameAttribute]; len(values) > 0 {
+			identity.Username = values[0]
+		}
+	}
+	if identity.Username == "" {
+		return nil, errors.New("SAML assertion does not name the user")
+	}
+	if values := attributes[p.NameAttribute]; p.NameAttribute != "" && len(values) > 0 {
+		identity.Name = values[0]
+	}
+	if values := attributes[p.EmailAttribute]; p.EmailAttribute != "" && len(values) > 0 {
+		identity.Email = values[0]
+	}
+	if p.GroupsAttribute != "" {
+		identity.Groups = attributes[p.GroupsAttribute]
+	}
+	return identity, nil
+}
+
+// samlAttributes collects attribute values by both Name and FriendlyName
+func samlAttributes(assertion *xmlElement) map[string][]string {
+	attributes := make(map[string][]string)
+	for _, statement := range assertion.Elements(nsSAMLAssertion, "AttributeStatement") {
+		for _, attribute := range statement.Elements(nsSAMLAssertion, "Attribute") {
+			var values []string
+			for _, value := range attribute.Elements(nsSAMLAssertion, "AttributeValue") {
+				values = append(values, strings.TrimSpace(value.Text()))
+			}
+			for _, name := range []string{attribute.Attr("Name"), attribute.Attr("FriendlyName")} {
+				if name != "" {
+					attributes[name] = append(attributes[name], values...)
+				}
+			}
+		}
+	}
+	return attributes
+}
+
+// Metadata returns the service provider metadata to register with the
+// identity provider
+func (p *SAMLProvider) Metadata() ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<md:EntityDescriptor xmlns:md="%s"`, nsSAMLMetadata)
+	writeXMLAttr(&b, "entityID", p.EntityID)
+	fmt.Fprintf(&b, `>
+  <md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">
+    <md:NameIDFormat>%s</md:NameIDFormat>
+    <md:AssertionConsumerService Binding="%s"`, nsSAMLProtocol, samlNameIDFormat, samlHTTPPost)
+	writeXMLAttr(&b, "Location", p.ACSURL)
+	b.WriteString(` index="0" isDefault="true"/>
+  </md:SPSSODescriptor>
+</md:EntityDescriptor>
+`)
+	return b.Bytes(), nil
+}
+
+func writeXMLAttr(b *bytes.Buffer, name, value string) {
+	b.WriteString(" " + name + `="`)
+	xml.EscapeText(b, []byte(value))
+	b.WriteByte('"')
+}
+
+func samlTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SAML time %q", value)
+	}
+	return t, nil
+}
+
+// samlID returns a random identifier; XML IDs must not start with a digit
+func samlID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalize(t *testing.T) {
+	root, err := parseXML([]byte(`<?xml version="1.0"?>
+<root xmlns="urn:a" xmlns:b="urn:b" xmlns:unused="urn:u"><!-- comment --><b:child z="1" b:y="2" a="&quot;x&#9;"><inner>t &amp; &lt; &gt;</inner><empty/></b:child></root>`))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	child := root.Element("urn:b", "child")
+	if child == nil {
+		t.Fatal("child element not found")
+	}
+
+	want := `<b:child xmlns:b="urn:b" a="&quot;x&#x9;" z="1" b:y="2"><inner xmlns="urn:a">t &amp; &lt; &gt;</inner><empty xmlns="urn:a"></empty></b:child>`
+	if got := string(canonicalize(child, nil, nil)); got != want {
+		t.Errorf("canonicalize() =\n%s\nwant\n%s", got, want)
+	}
+
+	want = `<b:child xmlns:b="urn:b" xmlns:unused="urn:u" a="&quot;x&#x9;" z="1" b:y="2"><inner xmlns="urn:a">t &amp; &lt; &gt;</inner><empty xmlns="urn:a"></empty></b:child>`
+	if got := string(canonicalize(child, []string{"unused"}, nil)); got != want {
+		t.Errorf("canonicalize() with inclusive prefixes =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := string(canonicalize(root, nil, child.Element("urn:a", "inner"))); !strings.Contains(got, `<empty></empty>`) || strings.Contains(got, "inner") {
+		t.Errorf("canonicalize() with skipped element = %s", got)
+	}
+
+	if _, err := parseXML([]byte(`<!DOCTYPE x [<!ENTITY a "b">]><x>&a;</x>`)); err == nil {
+		t.Error("parseXML accepted a document type declaration")
+	}
+}
+
+// testIdP signs SAML responses for tests
+type testIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return &testIdP{key: key, cert: cert}
+}
+
+// sign inserts an enveloped signature after the Issuer of the element with
+// the given ID
+func (idp *testIdP) sign(t *testing.T, document, id string) string {
+	root, err := parseXML([]byte(document))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	element := findByID(root, id)
+	if element == nil {
+		t.Fatalf("element %s not found", id)
+	}
+	digest := sha256.Sum256(canonicalize(element, nil, nil))
+
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="%s"/><ds:SignatureMethod Algorithm="%s"/><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="%s"/><ds:Transform Algorithm="%s"/></ds:Transforms><ds:DigestMethod Algorithm="%s"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>SIGNATURE</ds:SignatureValue></ds:Signature>`,
+		algExcC14N, algRSASHA256, id, algEnveloped, algExcC14N, algSHA256, base64.StdEncoding.EncodeToString(digest[:]))
+
+	// The signature follows the element's Issuer
+	start := strings.Index(document, `ID="`+id+`"`)
+	issuerEnd := strings.Index(document[start:], "</saml:Issuer>") + start + len("</saml:Issuer>")
+	signed := document[:issuerEnd] + signature + document[issuerEnd:]
+
+	root, err = parseXML([]byte(signed))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	signedInfo := findByID(root, id).Element(nsDSig, "Signature").Element(nsDSig, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return strings.Replace(signed, "SIGNATURE", base64.StdEncoding.EncodeToString(value), 1)
+}
+
+func findByID(e *xmlElement, id string) *xmlElement {
+	if e.Attr("ID") == id {
+		return e
+	}
+	for _, child := range e.Children {
+		if el, ok := child.(*xmlElement); ok {
+			if found := findByID(el, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+type testAssertion struct {
+	ResponseID   string
+	AssertionID  string
+	InResponseTo string
+	Audience     string
+	Recipient    string
+	NameID       string
+	NotOnOrAfter time.Time
+}
+
+func (a testAssertion) response() string {
+	inResponseTo := ""
+	if a.InResponseTo != "" {
+		inResponseTo = fmt.Sprintf(` InResponseTo="%s"`, a.InResponseTo)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	expires := a.NotOnOrAfter.UTC().Format(time.RFC3339)
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="%[1]s" Version="2.0" IssueInstant="%[2]s" Destination="%[3]s"%[4]s>
+  <saml:Issuer>https://idp.example.com</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  <saml:Assertion ID="%[5]s" Version="2.0" IssueInstant="%[2]s">
+    <saml:Issuer>https://idp.example.com</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">%[6]s</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData NotOnOrAfter="%[7]s" Recipient="%[3]s"%[4]s/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="%[2]s" NotOnOrAfter="%[7]s">
+      <saml:AudienceRestriction><saml:Audience>%[8]s</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="displayName"><saml:AttributeValue>Jane Doe</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="http://schemas.microsoft.com/ws/2008/06/identity/claims/groups" FriendlyName="groups">
+        <saml:AttributeValue>LIV Authors</saml:AttributeValue>
+        <saml:AttributeValue>Staff</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`, a.ResponseID, now, a.Recipient, inResponseTo, a.AssertionID, a.NameID, expires, a.Audience)
+}
+
+func newTestSAMLProvider(idp *testIdP) *SAMLProvider {
+	return &SAMLProvider{
+		ProviderName:    "SSO",
+		EntityID:        "https://liv.example.com/auth/sso/SSO/metadata",
+		ACSURL:          "https://liv.example.com/auth/sso/SSO/acs",
+		IdPEntityID:     "https://idp.example.com",
+		IdPSSOURL:       "https://idp.example.com/sso",
+		IdPCertificates: []*x509.Certificate{idp.cert},
+		NameAttribute:   "displayName",
+		GroupsAttribute: "groups",
+	}
+}
+
+// requestID starts a sign-in and returns the ID of its AuthnRequest
+func requestID(t *testing.T, p *SAMLProvider) string {
+	login, err := p.LoginURL("/viewer?id=abc")
+	if err != nil {
+		t.Fatalf("LoginURL() failed: %v", err)
+	}
+	u, err := url.Parse(login)
+	if err != nil {
+		t.Fatalf("invalid login URL: %v", err)
+	}
+	if u.Query().Get("RelayState") != "/viewer?id=abc" {
+		t.Errorf("RelayState = %q", u.Query().Get("RelayState"))
+	}
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("invalid SAMLRequest: %v", err)
+	}
+	request, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatalf("failed to inflate SAMLRequest: %v", err)
+	}
+	if !bytes.Contains(request, []byte(`AssertionConsumerServiceURL="https://liv.example.com/auth/sso/SSO/acs"`)) {
+		t.Errorf("AuthnRequest does not name the ACS: %s", request)
+	}
+	return regexp.MustCompile(`ID="([^"]+)"`).FindStringSubmatch(string(request))[1]
+}
+
+func encodeResponse(document string) string {
+	return base64.StdEncoding.EncodeToString([]byte(document))
+}
+
+func TestSAMLResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := newTestSAMLProvider(idp)
+	valid := func(inResponseTo string) testAssertion {
+		return testAssertion{
+			ResponseID:   "_response",
+			AssertionID:  "_assertion-" + inResponseTo,
+			InResponseTo: inResponseTo,
+			Audience:     provider.EntityID,
+			Recipient:    provider.ACSURL,
+			NameID:       "jdoe@example.com",
+			NotOnOrAfter: time.Now().Add(5 * time.Minute),
+		}
+	}
+
+	assertion := valid(requestID(t, provider))
+	response := encodeResponse(idp.sign(t, assertion.response(), assertion.AssertionID))
+	id, err := provider.ParseResponse(response)
+	if err != nil {
+		t.Fatalf("ParseResponse() failed: %v", err)
+	}
+	if id.Username != "jdoe@example.com" || id.Name != "Jane Doe" || id.Provider != "SSO" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	if len(id.Groups) != 2 || id.Groups[0] != "LIV Authors" {
+		t.Errorf("groups = %v", id.Groups)
+	}
+
+	if _, err := provider.ParseResponse(response); err == nil {
+		t.Error("ParseResponse() accepted a replayed assertion")
+	}
+
+	otherIdP := newTestIdP(t)
+	rejected := map[string]func() string{
+		"unsigned": func() string {
+			return valid(requestID(t, provider)).response()
+		},
+		"tampered": func() string {
+			a := valid(requestID(t, provider))
+			return strings.Replace(idp.sign(t, a.response(), a.AssertionID), "jdoe@example.com</saml:NameID>", "admin@example.com</saml:NameID>", 1)
+		},
+		"untrusted key": func() string {
+			a := valid(requestID(t, provider))
+			return otherIdP.sign(t, a.response(), a.AssertionID)
+		},
+		"wrong audience": func() string {
+			a := valid(requestID(t, provider))
+			a.Audience = "https://other.example.com"
+			return idp.sign(t, a.response(), a.AssertionID)
+		},
+		"wrong recipient": func() string {
+			a := valid(requestID(t, provider))
+			a.Recipient = "https://other.example.com/acs"
+			return idp.sign(t, a.response(), a.AssertionID)
+		},
+		"expired": func() string {
+			a := valid(requestID(t, provider))
+			a.NotOnOrAfter = time.Now().Add(-time.Hour)
+			return idp.sign(t, a.response(), a.AssertionID)
+		},
+		"unknown request": func() string {
+			a := valid("_never-requested")
+			return idp.sign(t, a.response(), a.AssertionID)
+		},
+		"unsolicited": func() string {
+			a := valid("")
+			a.AssertionID = "_unsolicited"
+			return idp.sign(t, a.response(), a.AssertionID)
+		},
+		"wrapped": func() string {
+			// A signed assertion hidden in an extension, next to a forged one
+			a := valid(requestID(t, provider))
+			signed := idp.sign(t, a.response(), a.AssertionID)
+			start := strings.Index(signed, "<saml:Assertion")
+			end := strings.Index(signed, "</saml:Assertion>") + len("</saml:Assertion>")
+			original := signed[start:end]
+			forged := strings.Replace(strings.Replace(original, "jdoe@example.com", "admin@example.com", 1), a.AssertionID, "_forged", 1)
+			forged = regexp.MustCompile(`<ds:Signature.*</ds:Signature>`).ReplaceAllString(forged, "")
+			return signed[:start] + "<samlp:Extensions>" + original + "</samlp:Extensions>" + forged + signed[end:]
+		},
+	}
+	for name, document := range rejected {
+		if id, err := provider.ParseResponse(encodeResponse(document())); err == nil {
+			t.Errorf("%s response accepted as %+v", name, id)
+		}
+	}
+}
+
+func TestSAMLSignedResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := newTestSAMLProvider(idp)
+	provider.AllowIdPInitiated = true
+
+	a := testAssertion{
+		ResponseID:   "_idp-initiated",
+		AssertionID:  "_assertion",
+		Audience:     provider.EntityID,
+		Recipient:    provider.ACSURL,
+		NameID:       "jdoe@example.com",
+		NotOnOrAfter: time.Now().Add(5 * time.Minute),
+	}
+	signed := idp.sign(t, a.response(), a.ResponseID)
+	if _, err := provider.ParseResponse(encodeResponse(signed)); err != nil {
+		t.Fatalf("ParseResponse() of a signed response failed: %v", err)
+	}
+
+	a.AssertionID = "_tampered"
+	tampered := strings.Replace(idp.sign(t, a.response(), a.ResponseID), "LIV Authors", "LIV Admins", 1)
+	if _, err := provider.ParseResponse(encodeResponse(tampered)); err == nil {
+		t.Error("ParseResponse() accepted a modified signed response")
+	}
+}
+
+func TestSAMLMetadata(t *testing.T) {
+	provider := newTestSAMLProvider(newTestIdP(t))
+	metadata, err := provider.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata() failed: %v", err)
+	}
+	root, err := parseXML(metadata)
+	if err != nil {
+		t.Fatalf("metadata is not valid XML: %v", err)
+	}
+	if root.Attr("entityID") != provider.EntityID {
+		t.Errorf("entityID = %q", root.Attr("entityID"))
+	}
+	acs := root.Element(nsSAMLMetadata, "SPSSODescriptor").Element(nsSAMLMetadata, "AssertionConsumerService")
+	if acs == nil || acs.Attr("Location") != provider.ACSURL {
+		t.Errorf("metadata does not name the ACS: %s", metadata)
+	}
+}
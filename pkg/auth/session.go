@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Session defaults
+const (
+	DefaultSessionCookie = "liv_session"
+	DefaultSessionTTL    = 8 * time.Hour
+)
+
+// Sessions issues and verifies signed session cookies. Sessions are stateless:
+// the cookie carries the identity, so any server sharing the key accepts it.
+type Sessions struct {
+	Key    []byte
+	Cookie string
+	TTL    time.Duration
+	// Secure marks cookies HTTPS-only. Cookies set on TLS requests are always
+	// secure.
+	Secure bool
+	Now    func() time.Time
+}
+
+// NewSessions creates a session manager. A random key is generated when key
+// is empty, so sessions end when the server restarts.
+func NewSessions(key []byte) (*Sessions, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	if len(key) < 32 {
+		return nil, errors.New("session key must be at least 32 bytes")
+	}
+	return &Sessions{Key: key, Cookie: DefaultSessionCookie, TTL: DefaultSessionTTL, Now: time.Now}, nil
+}
+
+// sessionClaims is the signed cookie payload. Groups are left out to keep the
+// cookie small; the roles they map to are kept instead.
+type sessionClaims struct {
+	Username string    `json:"u"`
+	Name     string    `json:"n,omitempty"`
+	Email    string    `json:"e,omitempty"`
+	Provider string    `json:"p"`
+	Roles    []string  `json:"r"`
+	Expires  time.Time `json:"x"`
+}
+
+// Issue sets a session cookie for id
+func (s *Sessions) Issue(w http.ResponseWriter, r *http.Request, id *Identity) error {
+	expires := s.Now().Add(s.TTL)
+	payload, err := json.Marshal(&sessionClaims{
+		Username: id.Username,
+		Name:     id.Name,
+		Email:    id.Email,
+		Provider: id.Provider,
+		Roles:    id.Roles,
+		Expires:  expires,
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	value := encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.Cookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Identify returns the identity of a request's valid session cookie
+func (s *Sessions) Identify(r *http.Request) (*Identity, bool) {
+	cookie, err := r.Cookie(s.Cookie)
+	if err != nil {
+		return nil, false
+	}
+	encoded, signature, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return nil, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.sign(encoded)) {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || !s.Now().Before(claims.Expires) {
+		return nil, false
+	}
+	return &Identity{
+		Username: claims.Username,
+		Name:     claims.Name,
+		Email:    claims.Email,
+		Provider: claims.Provider,
+		Roles:    claims.Roles,
+	}, true
+}
+
+// Clear removes the session cookie
+func (s *Sessions) Clear(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.Cookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Sessions) sign(value string) []byte {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
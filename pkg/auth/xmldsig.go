@@ -0,0 +1,473 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// XML namespaces and algorithm identifiers used by XML signatures
+const (
+	nsXML        = "http://www.w3.org/XML/1998/namespace"
+	nsDSig       = "http://www.w3.org/2000/09/xmldsig#"
+	algExcC14N   = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algSHA256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512    = "http://www.w3.org/2001/04/xmlenc#sha512"
+	maxXMLDepth  = 64
+)
+
+// errNotSigned is returned when an element carries no signature
+var errNotSigned = errors.New("element is not signed")
+
+// xmlElement is a parsed element that keeps the namespace prefixes of the
+// source, as canonicalization needs them
+type xmlElement struct {
+	Prefix   string
+	Local    string
+	Attrs    []xmlAttr
+	Children []interface{} // *xmlElement or string
+	// Scope maps every prefix in scope to its namespace; "" is the default
+	Scope map[string]string
+}
+
+type xmlAttr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+// Space returns the namespace of the element
+func (e *xmlElement) Space() string {
+	return e.Scope[e.Prefix]
+}
+
+// Is reports whether the element has the given namespace and local name
+func (e *xmlElement) Is(space, local string) bool {
+	return e.Local == local && e.Space() == space
+}
+
+// Attr returns an unprefixed attribute value
+func (e *xmlElement) Attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Prefix == "" && attr.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Elements returns the child elements with the given namespace and local name
+func (e *xmlElement) Elements(space, local string) []*xmlElement {
+	var result []*xmlElement
+	for _, child := range e.Children {
+		if el, ok := child.(*xmlElement); ok && el.Is(space, local) {
+			result = append(result, el)
+		}
+	}
+	return result
+}
+
+// Element returns the first matching child element, or nil
+func (e *xmlElement) Element(space, local string) *xmlElement {
+	if elements := e.Elements(space, local); len(elements) > 0 {
+		return elements[0]
+	}
+	return nil
+}
+
+// Text returns the concatenated character data of the element
+func (e *xmlElement) Text() string {
+	var b strings.Builder
+	for _, child := range e.Children {
+		if text, ok := child.(string); ok {
+			b.WriteString(text)
+		}
+	}
+	return b.String()
+}
+
+// parseXML parses a document into elements. Document type declarations are
+// rejected, so entity expansion cannot be used against the parser.
+func parseXML(data []byte) (*xmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) >= maxXMLDepth {
+				return nil, errors.New("XML is nested too deeply")
+			}
+			if root != nil && len(stack) == 0 {
+				return nil, errors.New("XML has more than one root element")
+			}
+			scope := map[string]string{"xml": nsXML}
+			if len(stack) > 0 {
+				scope = stack[len(stack)-1].Scope
+			}
+			el := &xmlElement{Prefix: t.Name.Space, Local: t.Name.Local, Scope: scope}
+			copied := false
+			for _, attr := range t.Attr {
+				declared, isDeclaration := "", false
+				switch {
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					declared, isDeclaration = "", true
+				case attr.Name.Space == "xmlns":
+					declared, isDeclaration = attr.Name.Local, true
+				}
+				if !isDeclaration {
+					el.Attrs = append(el.Attrs, xmlAttr{Prefix: attr.Name.Space, Local: attr.Name.Local, Value: attr.Value})
+					continue
+				}
+				if !copied {
+					el.Scope = make(map[string]string, len(scope)+1)
+					for prefix, space := range scope {
+						el.Scope[prefix] = space
+					}
+					copied = true
+				}
+				el.Scope[declared] = attr.Value
+			}
+			if _, ok := el.Scope[el.Prefix]; !ok && el.Prefix != "" {
+				return nil, fmt.Errorf("undeclared namespace prefix %q", el.Prefix)
+			}
+			for _, attr := range el.Attrs {
+				if _, ok := el.Scope[attr.Prefix]; !ok && attr.Prefix != "" {
+					return nil, fmt.Errorf("undeclared namespace prefix %q", attr.Prefix)
+				}
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, el)
+			} else {
+				root = el
+			}
+			stack = append(stack, el)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("unexpected end element")
+			}
+			top := stack[len(stack)-1]
+			if t.Name.Space != top.Prefix || t.Name.Local != top.Local {
+				return nil, fmt.Errorf("element <%s> closed by </%s>", top.Local, t.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, string(t))
+			}
+
+		case xml.Directive:
+			return nil, errors.New("XML document type declarations are not allowed")
+		}
+	}
+
+	if root == nil || len(stack) != 0 {
+		return nil, errors.New("incomplete XML document")
+	}
+	return root, nil
+}
+
+// canonicalize serializes an element with Exclusive XML Canonicalization
+// without comments. inclusive lists the prefixes of an InclusiveNamespaces
+// PrefixList; skip is omitted from the output, for the enveloped signature
+// transform.
+func canonicalize(e *xmlElement, inclusive []string, skip *xmlElement) []byte {
+	var b bytes.Buffer
+	c14nElement(&b, e, map[string]string{}, inclusive, skip)
+	return b.Bytes()
+}
+
+func c14nElement(b *bytes.Buffer, e *xmlElement, rendered map[string]string, inclusive []string, skip *xmlElement) {
+	// Namespaces are rendered where they are visibly used, unless an output
+	// ancestor already rendered the same declaration
+	used := map[string]bool{e.Prefix: true}
+	for _, attr := range e.Attrs {
+		if attr.Prefix != "" && attr.Prefix != "xml" {
+			used[attr.Prefix] = true
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, ok := e.Scope[prefix]; ok {
+			used[prefix] = true
+		}
+	}
+
+	var declarations []string
+	output := rendered
+	for prefix := range used {
+		space := e.Scope[prefix]
+		previous, wasRendered := rendered[prefix]
+		if (wasRendered && previous == space) || (!wasRendered && space == "") {
+			continue
+		}
+		if len(declarations) == 0 {
+			output = make(map[string]string, len(rendered)+len(used))
+			for p, s := range rendered {
+				output[p] = s
+			}
+		}
+		output[prefix] = space
+		declarations = append(declarations, prefix)
+	}
+	sort.Strings(declarations)
+
+	b.WriteByte('<')
+	writeQName(b, e.Prefix, e.Local)
+	for _, prefix := range declarations {
+		if prefix == "" {
+			b.WriteString(` xmlns="`)
+		} else {
+			b.WriteString(` xmlns:` + prefix + `="`)
+		}
+		escapeC14NAttr(b, output[prefix])
+		b.WriteByte('"')
+	}
+
+	attrs := append([]xmlAttr(nil), e.Attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		si, sj := attrSpace(e, attrs[i]), attrSpace(e, attrs[j])
+		if si != sj {
+			return si < sj
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+	for _, attr := range attrs {
+		b.WriteByte(' ')
+		writeQName(b, attr.Prefix, attr.Local)
+		b.WriteString(`="`)
+		escapeC14NAttr(b, attr.Value)
+		b.WriteByte('"')
+	}
+	b.WriteByte('>')
+
+	for _, child := range e.Children {
+		switch c := child.(type) {
+		case string:
+			escapeC14NText(b, c)
+		case *xmlElement:
+			if c != skip {
+				c14nElement(b, c, output, inclusive, skip)
+			}
+		}
+	}
+
+	b.WriteString("</")
+	writeQName(b, e.Prefix, e.Local)
+	b.WriteByte('>')
+}
+
+func attrSpace(e *xmlElement, attr xmlAttr) string {
+	if attr.Prefix == "" {
+		return ""
+	}
+	return e.Scope[attr.Prefix]
+}
+
+func writeQName(b *bytes.Buffer, prefix, local string) {
+	if prefix != "" {
+		b.WriteString(prefix)
+		b.WriteByte(':')
+	}
+	b.WriteString(local)
+}
+
+func escapeC14NText(b *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+func escapeC14NAttr(b *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '"':
+			b.WriteString("&quot;")
+		case '\t':
+			b.WriteString("&#x9;")
+		case '\n':
+			b.WriteString("&#xA;")
+		case '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// verifySignature checks the enveloped signature of an element against the
+// trusted certificates. Only a signature that is a direct child of the element
+// and references the element by its ID is accepted, so a signature cannot be
+// moved onto other content. Key information inside the document is ignored.
+func verifySignature(e *xmlElement, trusted []*x509.Certificate) error {
+	signatures := e.Elements(nsDSig, "Signature")
+	if len(signatures) == 0 {
+		return errNotSigned
+	}
+	if len(signatures) > 1 {
+		return errors.New("element has more than one signature")
+	}
+	signature := signatures[0]
+
+	signedInfo := signature.Element(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature has no SignedInfo")
+	}
+	method := signedInfo.Element(nsDSig, "CanonicalizationMethod")
+	if method == nil || method.Attr("Algorithm") != algExcC14N {
+		return errors.New("unsupported signature canonicalization method")
+	}
+	signedInfoPrefixes := inclusivePrefixes(method)
+
+	var hash crypto.Hash
+	switch algorithm := signedInfo.Element(nsDSig, "SignatureMethod"); {
+	case algorithm == nil:
+		return errors.New("signature has no SignatureMethod")
+	case algorithm.Attr("Algorithm") == algRSASHA256:
+		hash = crypto.SHA256
+	case algorithm.Attr("Algorithm") == algRSASHA512:
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature method %q", algorithm.Attr("Algorithm"))
+	}
+
+	references := signedInfo.Elements(nsDSig, "Reference")
+	if len(references) != 1 {
+		return fmt.Errorf("signature must have exactly one reference, found %d", len(references))
+	}
+	reference := references[0]
+	id := e.Attr("ID")
+	if id == "" || reference.Attr("URI") != "#"+id {
+		return errors.New("signature does not reference the signed element")
+	}
+
+	var prefixes []string
+	enveloped := false
+	if transforms := reference.Element(nsDSig, "Transforms"); transforms != nil {
+		for _, transform := range transforms.Elements(nsDSig, "Transform") {
+			switch transform.Attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				prefixes = inclusivePrefixes(transform)
+			default:
+				return fmt.Errorf("unsupported signature transform %q", transform.Attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped {
+		return errors.New("signature is not an enveloped signature")
+	}
+
+	var digestHash crypto.Hash
+	switch digestMethod := reference.Element(nsDSig, "DigestMethod"); {
+	case digestMethod == nil:
+		return errors.New("reference has no DigestMethod")
+	case digestMethod.Attr("Algorithm") == algSHA256:
+		digestHash = crypto.SHA256
+	case digestMethod.Attr("Algorithm") == algSHA512:
+		digestHash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported digest method %q", digestMethod.Attr("Algorithm"))
+	}
+	digestValue := reference.Element(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return errors.New("reference has no DigestValue")
+	}
+	expected, err := decodeBase64(digestValue.Text())
+	if err != nil {
+		return fmt.Errorf("invalid digest value: %v", err)
+	}
+
+	digest := digestHash.New()
+	digest.Write(canonicalize(e, prefixes, signature))
+	if subtle.ConstantTimeCompare(digest.Sum(nil), expected) != 1 {
+		return errors.New("signed content has been modified")
+	}
+
+	signatureValue := signature.Element(nsDSig, "SignatureValue")
+	if signatureValue == nil {
+		return errors.New("signature has no SignatureValue")
+	}
+	value, err := decodeBase64(signatureValue.Text())
+	if err != nil {
+		return fmt.Errorf("invalid signature value: %v", err)
+	}
+
+	signed := hash.New()
+	signed.Write(canonicalize(signedInfo, signedInfoPrefixes, nil))
+	hashed := signed.Sum(nil)
+	for _, cert := range trusted {
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			continue
+		}
+		if rsa.VerifyPKCS1v15(key, hash, hashed, value) == nil {
+			return nil
+		}
+	}
+	return errors.New("signature was not made by a trusted identity provider certificate")
+}
+
+// inclusivePrefixes returns the PrefixList of an exclusive canonicalization
+// method's InclusiveNamespaces element
+func inclusivePrefixes(method *xmlElement) []string {
+	for _, child := range method.Children {
+		if el, ok := child.(*xmlElement); ok && el.Is(algExcC14N, "InclusiveNamespaces") {
+			return strings.Fields(el.Attr("PrefixList"))
+		}
+	}
+	return nil
+}
+
+// decodeBase64 decodes base64 that may be wrapped across lines
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,91 @@
+// Package calendar exports the events section of a document's interactive
+// spec as an iCalendar (RFC 5545) file, so readers can add a programme or
+// schedule to their calendar application.
+package calendar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/liv-format/liv/internal/contentline"
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// ContentType is the media type of iCalendar files
+const ContentType = "text/calendar; charset=utf-8"
+
+// productID identifies the application that made a calendar
+const productID = "-//LIV//LIV Document Viewer//EN"
+
+// Options are how events are written
+type Options struct {
+	// UIDDomain makes event UIDs unique across documents: each event's UID
+	// is <event ID>@<UIDDomain>. Use the same value for every version of a
+	// document, so calendars update its events instead of adding them again.
+	UIDDomain string
+	// Stamp is when the calendar was made
+	Stamp time.Time
+}
+
+// ICS writes the events of spec as an iCalendar file to publish. Timed
+// events are written in UTC and all-day events as dates.
+func ICS(spec *core.EventsSpec, opts Options) ([]byte, error) {
+	if len(spec.Items) == 0 {
+		return nil, fmt.Errorf("no events to export")
+	}
+	if opts.Stamp.IsZero() {
+		opts.Stamp = time.Now()
+	}
+
+	var w contentline.Writer
+	w.Line("BEGIN:VCALENDAR")
+	w.Line("VERSION:2.0")
+	w.Line("PRODID:" + productID)
+	w.Line("CALSCALE:GREGORIAN")
+	w.Line("METHOD:PUBLISH")
+	if spec.Name != "" {
+		w.Line("X-WR-CALNAME:" + contentline.EscapeText(spec.Name))
+	}
+	for i := range spec.Items {
+		event := &spec.Items[i]
+		start, end, allDay, err := event.Span()
+		if err != nil {
+			return nil, fmt.Errorf("event %s %v", event.ID, err)
+		}
+		uid := event.ID
+		if opts.UIDDomain != "" {
+			uid += "@" + opts.UIDDomain
+		}
+
+		w.Line("BEGIN:VEVENT")
+		w.Line("UID:" + contentline.EscapeText(uid))
+		w.Line("DTSTAMP:" + formatTime(opts.Stamp))
+		if allDay {
+			w.Line("DTSTART;VALUE=DATE:" + start.Format("20060102"))
+			w.Line("DTEND;VALUE=DATE:" + end.Format("20060102"))
+		} else {
+			w.Line("DTSTART:" + formatTime(start))
+			if end.After(start) {
+				w.Line("DTEND:" + formatTime(end))
+			}
+		}
+		w.Line("SUMMARY:" + contentline.EscapeText(event.Title))
+		if event.Location != "" {
+			w.Line("LOCATION:" + contentline.EscapeText(event.Location))
+		}
+		if event.Description != "" {
+			w.Line("DESCRIPTION:" + contentline.EscapeText(event.Description))
+		}
+		if event.URL != "" {
+			// URIs are not escaped, but must stay on their line
+			w.Line("URL:" + contentline.URI(event.URL))
+		}
+		w.Line("END:VEVENT")
+	}
+	w.Line("END:VCALENDAR")
+	return w.Bytes(), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
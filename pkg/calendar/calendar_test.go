@@ -0,0 +1,77 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/internal/contentline"
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func TestICS(t *testing.T) {
+	spec, err := core.ParseEventsSpec([]byte(`{"events": {"name": "Summit, 2025", "items": [
+		{"id": "keynote", "title": "Keynote; welcome", "start": "2025-05-01T09:00:00+02:00", "end": "2025-05-01T10:00:00+02:00",
+		 "location": "Hall A", "description": "Opening talk\nwith questions", "url": "https://example.com/keynote"},
+		{"title": "Workshops", "start": "2025-05-02", "end": "2025-05-03"},
+		{"title": "Doors open", "start": "2025-05-01T08:30:00Z"}
+	]}}`))
+	if err != nil {
+		t.Fatalf("ParseEventsSpec failed: %v", err)
+	}
+	data, err := ICS(spec, Options{UIDDomain: "doc-1.liv", Stamp: time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("ICS failed: %v", err)
+	}
+	ics := string(data)
+	if !strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n") || !strings.HasSuffix(ics, "END:VEVENT\r\nEND:VCALENDAR\r\n") {
+		t.Errorf("Unexpected calendar framing:\n%s", ics)
+	}
+	for _, line := range []string{
+		`X-WR-CALNAME:Summit\, 2025`,
+		"UID:keynote@doc-1.liv",
+		"DTSTAMP:20250401T120000Z",
+		"DTSTART:20250501T070000Z",
+		"DTEND:20250501T080000Z",
+		`SUMMARY:Keynote\; welcome`,
+		"LOCATION:Hall A",
+		`DESCRIPTION:Opening talk\nwith questions`,
+		"URL:https://example.com/keynote",
+		"UID:event-2@doc-1.liv",
+		"DTSTART;VALUE=DATE:20250502",
+		"DTEND;VALUE=DATE:20250504",
+		"DTSTART:20250501T083000Z",
+	} {
+		if !strings.Contains(ics, "\r\n"+line+"\r\n") {
+			t.Errorf("Expected line %q in:\n%s", line, ics)
+		}
+	}
+	if strings.Count(ics, "BEGIN:VEVENT") != 3 || strings.Count(ics, "DTEND") != 2 {
+		t.Errorf("Expected 3 events, the moment without DTEND:\n%s", ics)
+	}
+}
+
+func TestICSFolding(t *testing.T) {
+	spec := &core.EventsSpec{Items: []core.Event{{ID: "talk", Title: strings.Repeat("é", 100), Start: "2025-05-01"}}}
+	data, err := ICS(spec, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unfolded strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n") {
+		if len(line) > contentline.MaxLineOctets {
+			t.Errorf("Line of %d octets: %q", len(line), line)
+		}
+		if !strings.HasPrefix(line, " ") {
+			unfolded.WriteString("\n")
+		}
+		unfolded.WriteString(strings.TrimPrefix(line, " "))
+	}
+	if !strings.Contains(unfolded.String(), "\nSUMMARY:"+strings.Repeat("é", 100)+"\n") {
+		t.Errorf("Folded summary does not unfold to the title:\n%s", data)
+	}
+
+	if _, err := ICS(&core.EventsSpec{}, Options{}); err == nil {
+		t.Error("Expected a calendar without events to be refused")
+	}
+}
@@ -0,0 +1,206 @@
+// Package capability negotiates between what a document requires of its
+// viewer and what a viewer supports. Documents declare the format version
+// and features they need; viewers advertise theirs, including features they
+// are phasing out. A document the viewer cannot fully render is reported
+// before rendering, with what the reader can do about it.
+package capability
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// Remedies offered when a document cannot be rendered
+const (
+	// RemedyUpdateViewer means a newer viewer can render the document
+	RemedyUpdateViewer = "update_viewer"
+	// RemedyOpenFallback means the static fallback of the document can be
+	// shown instead, without the unsupported parts
+	RemedyOpenFallback = "open_fallback"
+)
+
+// Version is a format version, major.minor
+type Version struct {
+	Major int
+	Minor int
+}
+
+// ParseVersion parses a format version such as "1.0"
+func ParseVersion(s string) (Version, error) {
+	major, minor, found := strings.Cut(s, ".")
+	if !found {
+		return Version{}, fmt.Errorf("format version %q is not major.minor", s)
+	}
+	var v Version
+	var err error
+	if v.Major, err = strconv.Atoi(major); err != nil || v.Major < 0 {
+		return Version{}, fmt.Errorf("format version %q is not major.minor", s)
+	}
+	if v.Minor, err = strconv.Atoi(minor); err != nil || v.Minor < 0 {
+		return Version{}, fmt.Errorf("format version %q is not major.minor", s)
+	}
+	return v, nil
+}
+
+// Less reports whether v is an older version than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	return v.Minor < other.Minor
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Deprecation is a feature a viewer still supports but will drop
+type Deprecation struct {
+	Feature string `json:"feature"`
+	// Removal is the viewer version expected to drop the feature
+	Removal string `json:"removal,omitempty"`
+	Message string `json:"message"`
+}
+
+// Capabilities is what a viewer supports
+type Capabilities struct {
+	Viewer string `json:"viewer"`
+	// FormatVersion is the newest format version the viewer reads
+	FormatVersion string         `json:"format_version"`
+	Features      []string       `json:"features"`
+	Deprecated    []*Deprecation `json:"deprecated,omitempty"`
+	// UpdateURL is where a newer viewer can be found
+	UpdateURL string `json:"update_url,omitempty"`
+}
+
+// Supports reports whether the viewer supports a feature
+func (c *Capabilities) Supports(feature string) bool {
+	for _, supported := range c.Features {
+		if supported == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Mismatch is a requirement of a document the viewer does not meet
+type Mismatch struct {
+	// Requirement is "format_version" or "feature:<name>"
+	Requirement string `json:"requirement"`
+	Message     string `json:"message"`
+}
+
+// Result is the outcome of negotiating a document with a viewer
+type Result struct {
+	Compatible bool           `json:"compatible"`
+	Mismatches []*Mismatch    `json:"mismatches,omitempty"`
+	Warnings   []*Deprecation `json:"warnings,omitempty"`
+	// Remedies are what the reader can do when the document is not
+	// compatible, in order of preference
+	Remedies []string `json:"remedies,omitempty"`
+	// Message summarizes the outcome for display
+	Message string `json:"message"`
+}
+
+// Negotiate checks the requirements a document declares against the
+// capabilities of a viewer. Deprecated features the document requires or
+// enables are reported as warnings. hasFallback reports whether a static
+// fallback can be shown instead.
+func Negotiate(m *core.Manifest, capabilities *Capabilities, hasFallback bool) *Result {
+	result := &Result{Compatible: true}
+
+	viewerVersion, err := ParseVersion(capabilities.FormatVersion)
+	if err != nil {
+		viewerVersion = Version{}
+	}
+	required := []string{m.Version}
+	if m.Requirements != nil && m.Requirements.MinFormatVersion != "" {
+		required = append(required, m.Requirements.MinFormatVersion)
+	}
+	for _, version := range required {
+		documentVersion, err := ParseVersion(version)
+		if err != nil {
+			result.Mismatches = append(result.Mismatches, &Mismatch{
+				Requirement: "format_version",
+				Message:     fmt.Sprintf("the document needs format version %q, which this viewer does not recognize", version),
+			})
+			break
+		}
+		if viewerVersion.Less(documentVersion) {
+			result.Mismatches = append(result.Mismatches, &Mismatch{
+				Requirement: "format_version",
+				Message:     fmt.Sprintf("the document needs format version %s, but this viewer reads up to %s", documentVersion, viewerVersion),
+			})
+			break
+		}
+	}
+
+	if m.Requirements != nil {
+		for _, feature := range m.Requirements.Features {
+			if !capabilities.Supports(feature) {
+				result.Mismatches = append(result.Mismatches, &Mismatch{
+					Requirement: "feature:" + feature,
+					Message:     fmt.Sprintf("the document needs %s, which this viewer does not support", feature),
+				})
+			}
+		}
+	}
+	used := usedFeatures(m)
+	for _, deprecation := range capabilities.Deprecated {
+		if used[deprecation.Feature] {
+			result.Warnings = append(result.Warnings, deprecation)
+		}
+	}
+
+	if len(result.Mismatches) > 0 {
+		result.Compatible = false
+		result.Remedies = []string{RemedyUpdateViewer}
+		if hasFallback {
+			result.Remedies = append(result.Remedies, RemedyOpenFallback)
+		}
+	}
+	result.Message = result.summary()
+	return result
+}
+
+// usedFeatures returns the features a document requires or enables
+func usedFeatures(m *core.Manifest) map[string]bool {
+	used := make(map[string]bool)
+	if m.Features != nil {
+		for _, feature := range m.Features.Enabled() {
+			used[feature] = true
+		}
+	}
+	if m.Requirements != nil {
+		for _, feature := range m.Requirements.Features {
+			used[feature] = true
+		}
+	}
+	return used
+}
+
+func (r *Result) summary() string {
+	if r.Compatible {
+		if len(r.Warnings) == 0 {
+			return "This viewer supports everything the document needs."
+		}
+		var features []string
+		for _, warning := range r.Warnings {
+			features = append(features, warning.Feature)
+		}
+		return fmt.Sprintf("The document uses features this viewer will stop supporting: %s.", strings.Join(features, ", "))
+	}
+
+	var messages []string
+	for _, mismatch := range r.Mismatches {
+		messages = append(messages, mismatch.Message)
+	}
+	message := "This viewer cannot fully render the document: " + strings.Join(messages, "; ") + ". Update the viewer"
+	if len(r.Remedies) > 1 {
+		message += " or open the static version of the document"
+	}
+	return message + "."
+}
@@ -0,0 +1,65 @@
+package capability
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+var testCapabilities = &Capabilities{
+	Viewer:        "test",
+	FormatVersion: "1.2",
+	Features:      []string{"animations", "charts", "webassembly"},
+	Deprecated:    []*Deprecation{{Feature: "charts", Removal: "2.0", Message: "charts will be rendered as images"}},
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("1.10")
+	if err != nil || v != (Version{1, 10}) || v.String() != "1.10" {
+		t.Fatalf("Expected 1.10, got %v: %v", v, err)
+	}
+	if !(Version{1, 2}).Less(v) || v.Less(Version{1, 2}) || !v.Less(Version{2, 0}) {
+		t.Error("Unexpected version ordering")
+	}
+	for _, invalid := range []string{"", "1", "1.x", "-1.0", "1.0.0"} {
+		if _, err := ParseVersion(invalid); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	m := &core.Manifest{Version: "1.0", Features: &core.FeatureFlags{Animations: true}}
+	result := Negotiate(m, testCapabilities, true)
+	if !result.Compatible || len(result.Mismatches) != 0 || len(result.Warnings) != 0 || len(result.Remedies) != 0 {
+		t.Errorf("Expected a compatible document, got %+v", result)
+	}
+
+	// Deprecated features are reported without blocking rendering
+	m.Features.Charts = true
+	m.Requirements = &core.ViewerRequirements{MinFormatVersion: "1.2", Features: []string{"webassembly"}}
+	result = Negotiate(m, testCapabilities, true)
+	if !result.Compatible || len(result.Warnings) != 1 || result.Warnings[0].Feature != "charts" || !strings.Contains(result.Message, "charts") {
+		t.Errorf("Expected a deprecation warning for charts, got %+v", result)
+	}
+
+	m.Requirements = &core.ViewerRequirements{MinFormatVersion: "1.3", Features: []string{"webgl", "3d-scenes"}}
+	result = Negotiate(m, testCapabilities, true)
+	if result.Compatible || len(result.Mismatches) != 3 {
+		t.Fatalf("Expected three mismatches, got %+v", result)
+	}
+	if result.Mismatches[0].Requirement != "format_version" || result.Mismatches[2].Requirement != "feature:3d-scenes" {
+		t.Errorf("Unexpected mismatches: %+v %+v", result.Mismatches[0], result.Mismatches[2])
+	}
+	if strings.Join(result.Remedies, ",") != RemedyUpdateViewer+","+RemedyOpenFallback || !strings.Contains(result.Message, "static version") {
+		t.Errorf("Expected updating the viewer or opening the fallback to be offered, got %+v", result)
+	}
+
+	if result = Negotiate(&core.Manifest{Version: "2.0"}, testCapabilities, false); result.Compatible || len(result.Remedies) != 1 {
+		t.Errorf("Expected a newer format without a fallback to offer only an update, got %+v", result)
+	}
+	if result = Negotiate(&core.Manifest{Version: "next"}, testCapabilities, false); result.Compatible {
+		t.Errorf("Expected an unrecognized format version to be a mismatch, got %+v", result)
+	}
+}
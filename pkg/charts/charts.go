@@ -0,0 +1,180 @@
+// Package charts renders the charts of an interactive spec: as SVG for the
+// viewer and for the snapshots packaged at build time, which static fallback
+// pages show, and as PNG for renderers without SVG support, such as the
+// built-in PDF renderer.
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/datasets"
+	"github.com/liv-format/liv/pkg/interactive"
+)
+
+const (
+	// SnapshotPrefix is where the builder packages chart snapshots, as
+	// <chart id>.svg
+	SnapshotPrefix = "assets/charts/"
+
+	// DefaultWidth and DefaultHeight are the size of charts without one, in
+	// CSS pixels
+	DefaultWidth  = 640
+	DefaultHeight = 360
+)
+
+// Types are the chart types rendered. Charts of the spec's other types are
+// left to the document's own scripts.
+var Types = []string{"area", "bar", "line", "pie", "scatter"}
+
+// ReadFunc reads an entry of a package
+type ReadFunc func(entry string) ([]byte, error)
+
+// Table is the rows of a data source
+type Table = datasets.Table
+
+// Snapshot is a chart rendered as SVG
+type Snapshot struct {
+	Chart *interactive.Chart
+	// Path is where the builder packages the snapshot
+	Path string
+	SVG  []byte
+}
+
+// SnapshotPath returns the package path of a chart's snapshot
+func SnapshotPath(chartID string) string {
+	return SnapshotPrefix + chartID + ".svg"
+}
+
+// LoadData reads the rows of a data source: its inline values, or the JSON
+// array of objects, CSV file with a header row or Parquet file it refers to
+func LoadData(source *interactive.DataSource, read ReadFunc) (*Table, error) {
+	if source.Values != nil {
+		return datasets.FromValues(source.Values)
+	}
+	data, err := read(source.Src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", source.Src, err)
+	}
+	table, err := datasets.Decode(data, datasets.FormatOf(source.Src, source.Format))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data in %s: %v", source.Src, err)
+	}
+	return table, nil
+}
+
+// RenderSVG renders a chart from its data as an SVG document
+func RenderSVG(chart *interactive.Chart, table *Table) ([]byte, error) {
+	s, err := plot(chart, table)
+	if err != nil {
+		return nil, err
+	}
+	return s.svg(), nil
+}
+
+// RenderPNG renders a chart from its data as a PNG image, scale device pixels
+// to a CSS pixel
+func RenderPNG(chart *interactive.Chart, table *Table, scale float64) ([]byte, error) {
+	s, err := plot(chart, table)
+	if err != nil {
+		return nil, err
+	}
+	return s.png(scale)
+}
+
+// Render renders the charts of a spec as SVG. Charts that cannot be
+// rendered, such as charts of other types, are reported and left out.
+func Render(spec *interactive.Spec, read ReadFunc) ([]*Snapshot, []error) {
+	var snapshots []*Snapshot
+	var errors []error
+	tables := make(map[string]*Table)
+	for _, chart := range spec.Charts {
+		table, err := loadChartData(spec, chart, read, tables)
+		if err == nil {
+			var svg []byte
+			if svg, err = RenderSVG(chart, table); err == nil {
+				snapshots = append(snapshots, &Snapshot{Chart: chart, Path: SnapshotPath(chart.ID), SVG: svg})
+				continue
+			}
+		}
+		errors = append(errors, fmt.Errorf("chart %s: %v", chart.ID, err))
+	}
+	return snapshots, errors
+}
+
+// SnapshotPNG renders the chart whose snapshot is at entry as PNG, for
+// renderers that cannot draw SVG. The chart is rendered again from the
+// package's interactive spec.
+func SnapshotPNG(entry string, read ReadFunc) ([]byte, error) {
+	if !strings.HasPrefix(entry, SnapshotPrefix) || path.Ext(entry) != ".svg" {
+		return nil, fmt.Errorf("%s is not a chart snapshot", entry)
+	}
+	data, err := read(interactive.SpecPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", interactive.SpecPath, err)
+	}
+	spec, result := interactive.Parse(data, nil)
+	if !result.IsValid {
+		return nil, fmt.Errorf("invalid %s: %s", interactive.SpecPath, strings.Join(result.Errors, "; "))
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(entry, SnapshotPrefix), ".svg")
+	for _, chart := range spec.Charts {
+		if chart.ID == id {
+			table, err := loadChartData(spec, chart, read, make(map[string]*Table))
+			if err != nil {
+				return nil, err
+			}
+			return RenderPNG(chart, table, 2)
+		}
+	}
+	return nil, fmt.Errorf("no chart %s in %s", id, interactive.SpecPath)
+}
+
+// loadChartData returns the data of a chart, loading each source once
+func loadChartData(spec *interactive.Spec, chart *interactive.Chart, read ReadFunc, tables map[string]*Table) (*Table, error) {
+	if table, ok := tables[chart.Data]; ok {
+		return table, nil
+	}
+	for _, source := range spec.Data {
+		if source.ID == chart.Data {
+			table, err := LoadData(source, read)
+			if err != nil {
+				return nil, err
+			}
+			tables[chart.Data] = table
+			return table, nil
+		}
+	}
+	return nil, fmt.Errorf("no data source %q", chart.Data)
+}
+
+// Embed places markup, such as a chart, inside the element of a page that a
+// chart's target selects. Only #id targets are placed, and only in elements
+// that are empty, so content a page gives the element itself is kept.
+func Embed(page []byte, target, markup string) ([]byte, bool) {
+	if !strings.HasPrefix(target, "#") || len(target) < 2 || strings.ContainsAny(target[1:], " .#[:>+~,") {
+		return page, false
+	}
+	element := regexp.MustCompile(`(?is)<([a-z][a-z0-9-]*)(?:\s[^>]*)?\sid\s*=\s*["']?` + regexp.QuoteMeta(target[1:]) + `(?:["'\s][^>]*)?>`)
+	loc := element.FindSubmatchIndex(page)
+	if loc == nil {
+		return page, false
+	}
+	tag := strings.ToLower(string(page[loc[2]:loc[3]]))
+	rest := page[loc[1]:]
+	closing := "</" + tag + ">"
+	if tag == "canvas" || len(rest) < len(closing) {
+		return page, false
+	}
+	trimmed := bytes.TrimLeft(rest, " \t\r\n")
+	if !bytes.HasPrefix(bytes.ToLower(trimmed[:min(len(trimmed), len(closing))]), []byte(closing)) {
+		return page, false
+	}
+	embedded := make([]byte, 0, len(page)+len(markup))
+	embedded = append(embedded, page[:loc[1]]...)
+	embedded = append(embedded, markup...)
+	return append(embedded, rest...), true
+}
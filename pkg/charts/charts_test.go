@@ -0,0 +1,155 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/interactive"
+)
+
+const spec = `{
+  "data": [
+    {"id": "sales", "src": "assets/data/sales.csv"},
+    {"id": "share", "values": [{"region": "North", "total": 30}, {"region": "South", "total": 10}]}
+  ],
+  "charts": [
+    {"id": "revenue", "type": "bar", "target": "#revenue", "data": "sales", "x": "quarter", "y": ["north", "south"], "title": "Revenue"},
+    {"id": "trend", "type": "line", "target": "#trend", "data": "sales", "x": "quarter"},
+    {"id": "regions", "type": "pie", "target": "#regions", "data": "share", "x": "region", "y": "total", "width": 400, "height": 300},
+    {"id": "flow", "type": "sankey", "target": "#flow", "data": "sales"}
+  ]
+}`
+
+const sales = "quarter,north,south\nQ1,120,80\nQ2,150,95\nQ3,90,-20\n"
+
+func files(entries map[string]string) ReadFunc {
+	return func(entry string) ([]byte, error) {
+		if data, ok := entries[entry]; ok {
+			return []byte(data), nil
+		}
+		return nil, fmt.Errorf("entry not found: %s", entry)
+	}
+}
+
+func TestLoadData(t *testing.T) {
+	read := files(map[string]string{"sales.csv": sales, "sales.json": `[{"quarter": "Q1", "north": 120}]`})
+
+	table, err := LoadData(&interactive.DataSource{ID: "sales", Src: "sales.csv"}, read)
+	if err != nil {
+		t.Fatalf("LoadData failed: %v", err)
+	}
+	if strings.Join(table.Fields, ",") != "quarter,north,south" || len(table.Rows) != 3 || table.Rows[2]["south"] != -20.0 {
+		t.Errorf("Unexpected table %+v", table)
+	}
+
+	table, err = LoadData(&interactive.DataSource{ID: "sales", Src: "sales.json"}, read)
+	if err != nil {
+		t.Fatalf("LoadData failed: %v", err)
+	}
+	if strings.Join(table.Fields, ",") != "north,quarter" || table.Rows[0]["north"] != 120.0 {
+		t.Errorf("Unexpected table %+v", table)
+	}
+
+	if _, err := LoadData(&interactive.DataSource{ID: "sales", Src: "sales.xml"}, read); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestRender(t *testing.T) {
+	parsed, result := interactive.Parse([]byte(spec), nil)
+	if !result.IsValid {
+		t.Fatalf("Invalid spec: %v", result.Errors)
+	}
+	snapshots, errs := Render(parsed, files(map[string]string{"assets/data/sales.csv": sales}))
+	if len(snapshots) != 3 {
+		t.Fatalf("Expected 3 snapshots, got %d", len(snapshots))
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "chart flow") {
+		t.Errorf("Expected the sankey chart to be reported, got %v", errs)
+	}
+
+	revenue := string(snapshots[0].SVG)
+	if snapshots[0].Path != "assets/charts/revenue.svg" || !strings.HasPrefix(revenue, `<svg xmlns="http://www.w3.org/2000/svg" width="640" height="360"`) {
+		t.Errorf("Unexpected snapshot %s: %.120s", snapshots[0].Path, revenue)
+	}
+	for _, want := range []string{"<title>Revenue</title>", "<title>Q3, south: -20</title>", ">north</text>"} {
+		if !strings.Contains(revenue, want) {
+			t.Errorf("Expected the bar chart to contain %q", want)
+		}
+	}
+	if strings.Contains(revenue, "style=") {
+		t.Error("Expected no style attributes, which content policies may block")
+	}
+
+	regions := string(snapshots[2].SVG)
+	if !strings.Contains(regions, `width="400" height="300"`) || !strings.Contains(regions, "North (75.0%)") {
+		t.Errorf("Unexpected pie chart %s", regions)
+	}
+
+	// Rendering is deterministic, so builds are reproducible
+	again, _ := Render(parsed, files(map[string]string{"assets/data/sales.csv": sales}))
+	if !bytes.Equal(again[1].SVG, snapshots[1].SVG) {
+		t.Error("Expected the same chart to render the same SVG")
+	}
+}
+
+func TestSnapshotPNG(t *testing.T) {
+	read := files(map[string]string{interactive.SpecPath: spec, "assets/data/sales.csv": sales})
+
+	data, err := SnapshotPNG("assets/charts/regions.svg", read)
+	if err != nil {
+		t.Fatalf("SnapshotPNG failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Invalid PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 800 || bounds.Dy() != 600 {
+		t.Errorf("Expected an 800x600 image at twice the size, got %v", bounds)
+	}
+
+	if _, err := SnapshotPNG("assets/charts/missing.svg", read); err == nil {
+		t.Error("Expected an error for a chart not in the spec")
+	}
+	if _, err := SnapshotPNG("assets/images/photo.svg", read); err == nil {
+		t.Error("Expected an error for an entry that is not a snapshot")
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   string
+		target string
+		want   string
+		placed bool
+	}{
+		{"empty element", `<p>Intro</p><div id="chart"></div>`, "#chart", `<p>Intro</p><div id="chart"><svg/></div>`, true},
+		{"quoted attributes", `<figure class="wide" id='chart'>  </figure>`, "#chart", `<figure class="wide" id='chart'><svg/>  </figure>`, true},
+		{"element with content", `<div id="chart"><p>Table</p></div>`, "#chart", `<div id="chart"><p>Table</p></div>`, false},
+		{"canvas", `<canvas id="chart"></canvas>`, "#chart", `<canvas id="chart"></canvas>`, false},
+		{"other id", `<div id="chart-2"></div>`, "#chart", `<div id="chart-2"></div>`, false},
+		{"class selector", `<div class="chart"></div>`, ".chart", `<div class="chart"></div>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, placed := Embed([]byte(tt.page), tt.target, "<svg/>")
+			if string(page) != tt.want || placed != tt.placed {
+				t.Errorf("Embed() = %q, %v, want %q, %v", page, placed, tt.want, tt.placed)
+			}
+		})
+	}
+}
+
+func TestNiceTicks(t *testing.T) {
+	ticks := niceTicks(-20, 150, 5)
+	if ticks[0] != -50 || ticks[len(ticks)-1] != 150 {
+		t.Errorf("Unexpected ticks %v", ticks)
+	}
+	if ticks := niceTicks(5, 5, 5); ticks[0] != 0 || ticks[len(ticks)-1] < 5 {
+		t.Errorf("Unexpected ticks for a single value %v", ticks)
+	}
+}
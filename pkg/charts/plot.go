@@ -0,0 +1,451 @@
+package charts
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/interactive"
+)
+
+// palette colors the series of a chart in order
+var palette = []color.NRGBA{
+	{0x4e, 0x79, 0xa7, 0xff}, {0xf2, 0x8e, 0x2b, 0xff}, {0xe1, 0x57, 0x59, 0xff},
+	{0x76, 0xb7, 0xb2, 0xff}, {0x59, 0xa1, 0x4f, 0xff}, {0xed, 0xc9, 0x48, 0xff},
+	{0xb0, 0x7a, 0xa1, 0xff}, {0xff, 0x9d, 0xa7, 0xff}, {0x9c, 0x75, 0x5f, 0xff},
+	{0xba, 0xb0, 0xac, 0xff},
+}
+
+var (
+	textColor  = color.NRGBA{0x33, 0x33, 0x33, 0xff}
+	mutedColor = color.NRGBA{0x66, 0x66, 0x66, 0xff}
+	gridColor  = color.NRGBA{0xe0, 0xe0, 0xe0, 0xff}
+	axisColor  = color.NRGBA{0x99, 0x99, 0x99, 0xff}
+)
+
+const (
+	titleSize = 16
+	labelSize = 11
+	// maxLabels is how many category labels fit under a chart before they
+	// are thinned out
+	maxLabels = 12
+)
+
+type point struct {
+	x, y float64
+}
+
+type shapeKind int
+
+const (
+	shapePolygon shapeKind = iota
+	shapePolyline
+	shapeText
+)
+
+// shape is a filled polygon, a stroked line or a text, the parts charts are
+// drawn from so that SVG and PNG output match
+type shape struct {
+	kind   shapeKind
+	points []point
+	color  color.NRGBA
+	width  float64
+	// text is anchored at points[0], its baseline: start, middle or end
+	text   string
+	size   float64
+	anchor string
+	bold   bool
+	// tooltip describes the value a shape shows
+	tooltip string
+}
+
+// scene is a laid-out chart
+type scene struct {
+	width, height float64
+	label         string
+	shapes        []shape
+}
+
+func (s *scene) polygon(c color.NRGBA, tooltip string, points ...point) {
+	s.shapes = append(s.shapes, shape{kind: shapePolygon, points: points, color: c, tooltip: tooltip})
+}
+
+func (s *scene) rect(x, y, w, h float64, c color.NRGBA, tooltip string) {
+	s.polygon(c, tooltip, point{x, y}, point{x + w, y}, point{x + w, y + h}, point{x, y + h})
+}
+
+func (s *scene) line(c color.NRGBA, width float64, points ...point) {
+	s.shapes = append(s.shapes, shape{kind: shapePolyline, points: points, color: c, width: width})
+}
+
+func (s *scene) circle(center point, r float64, c color.NRGBA, tooltip string) {
+	var points []point
+	for i := 0; i < 16; i++ {
+		angle := float64(i) * math.Pi / 8
+		points = append(points, point{center.x + r*math.Cos(angle), center.y + r*math.Sin(angle)})
+	}
+	s.polygon(c, tooltip, points...)
+}
+
+func (s *scene) text(x, y float64, text string, size float64, anchor string, c color.NRGBA, bold bool) {
+	s.shapes = append(s.shapes, shape{kind: shapeText, points: []point{{x, y}}, text: text, size: size, anchor: anchor, color: c, bold: bold})
+}
+
+// textWidth estimates the width of text, for placing legends without font
+// metrics
+func textWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * 0.6
+}
+
+// plot lays out a chart
+func plot(chart *interactive.Chart, table *Table) (*scene, error) {
+	if len(table.Fields) == 0 || len(table.Rows) == 0 {
+		return nil, fmt.Errorf("data source %s has no rows", chart.Data)
+	}
+	s := &scene{width: chart.Width, height: chart.Height, label: chart.Title}
+	if s.width == 0 {
+		s.width = DefaultWidth
+	}
+	if s.height == 0 {
+		s.height = DefaultHeight
+	}
+	if s.label == "" {
+		s.label = "Chart " + chart.ID
+	}
+
+	x := chart.X
+	if x == "" {
+		x = table.Fields[0]
+	}
+	series, err := seriesFields(chart, table, x)
+	if err != nil {
+		return nil, err
+	}
+
+	top := 16.0
+	if chart.Title != "" {
+		s.text(s.width/2, 26, chart.Title, titleSize, "middle", textColor, true)
+		top = 44
+	}
+	area := box{left: 56, top: top, right: s.width - 16, bottom: s.height - 36}
+	if len(series) > 1 && chart.Type != "pie" {
+		s.legend(area.left, top+4, series)
+		area.top += 24
+	}
+
+	switch chart.Type {
+	case "bar", "line", "area":
+		s.plotCategories(chart.Type, area, table, x, series)
+	case "scatter":
+		if err := s.plotScatter(area, table, x, series); err != nil {
+			return nil, err
+		}
+	case "pie":
+		s.plotPie(area, table, x, series[0])
+	default:
+		return nil, fmt.Errorf("%s charts are not rendered (rendered types are %s)", chart.Type, strings.Join(Types, ", "))
+	}
+	return s, nil
+}
+
+// box is the plot area of a chart
+type box struct {
+	left, top, right, bottom float64
+}
+
+// seriesFields returns the fields plotted: y, or every numeric field but x
+func seriesFields(chart *interactive.Chart, table *Table, x string) ([]string, error) {
+	var fields []string
+	switch y := chart.Y.(type) {
+	case string:
+		fields = []string{y}
+	case []interface{}:
+		for _, field := range y {
+			fields = append(fields, fmt.Sprint(field))
+		}
+	default:
+		for _, field := range table.Fields {
+			if field == x {
+				continue
+			}
+			if _, ok := number(table.Rows[0][field]); ok {
+				fields = append(fields, field)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("data source %s has no numeric fields to plot", chart.Data)
+	}
+	for _, field := range append([]string{x}, fields...) {
+		if !hasField(table, field) {
+			return nil, fmt.Errorf("data source %s has no field %q", chart.Data, field)
+		}
+	}
+	return fields, nil
+}
+
+func hasField(table *Table, field string) bool {
+	for _, f := range table.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// legend names the series in a row
+func (s *scene) legend(x, y float64, series []string) {
+	for i, name := range series {
+		s.rect(x, y, 10, 10, palette[i%len(palette)], "")
+		s.text(x+14, y+9, name, labelSize, "start", textColor, false)
+		x += 14 + textWidth(name, labelSize) + 16
+	}
+}
+
+// plotCategories draws bar, line and area charts: a value of each series for
+// each row, with the rows' x values as labels
+func (s *scene) plotCategories(kind string, area box, table *Table, x string, series []string) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, row := range table.Rows {
+		for _, field := range series {
+			if v, ok := number(row[field]); ok {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	if kind != "line" {
+		lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	}
+	ticks := niceTicks(lo, hi, 5)
+	y := s.valueAxis(area, ticks)
+
+	n := len(table.Rows)
+	band := (area.right - area.left) / float64(n)
+	step := (n + maxLabels - 1) / maxLabels
+	for i, row := range table.Rows {
+		if i%step == 0 {
+			s.text(area.left+band*(float64(i)+0.5), area.bottom+18, label(row[x]), labelSize, "middle", mutedColor, false)
+		}
+	}
+
+	base := y(math.Max(ticks[0], math.Min(0, ticks[len(ticks)-1])))
+	for j, field := range series {
+		c := palette[j%len(palette)]
+		if kind == "bar" {
+			group := band * 0.8
+			width := group / float64(len(series))
+			for i, row := range table.Rows {
+				v, ok := number(row[field])
+				if !ok {
+					continue
+				}
+				left := area.left + band*float64(i) + band*0.1 + width*float64(j)
+				top, bottom := y(math.Max(v, 0)), y(math.Min(v, 0))
+				s.rect(left, top, width, bottom-top, c, fmt.Sprintf("%s, %s: %s", label(row[x]), field, formatNumber(v)))
+			}
+			continue
+		}
+
+		var points []point
+		var tooltips []string
+		for i, row := range table.Rows {
+			if v, ok := number(row[field]); ok {
+				points = append(points, point{area.left + band*(float64(i)+0.5), y(v)})
+				tooltips = append(tooltips, fmt.Sprintf("%s, %s: %s", label(row[x]), field, formatNumber(v)))
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+		if kind == "area" {
+			fill := c
+			fill.A = 0x55
+			outline := append(append([]point{}, points...), point{points[len(points)-1].x, base}, point{points[0].x, base})
+			s.polygon(fill, field, outline...)
+		}
+		s.line(c, 2, points...)
+		for i, p := range points {
+			s.circle(p, 3, c, tooltips[i])
+		}
+	}
+	s.line(axisColor, 1, point{area.left, area.bottom}, point{area.right, area.bottom})
+}
+
+// plotScatter draws a point for each row of each series at its x and y
+func (s *scene) plotScatter(area box, table *Table, x string, series []string) error {
+	xlo, xhi := math.Inf(1), math.Inf(-1)
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, row := range table.Rows {
+		xv, ok := number(row[x])
+		if !ok {
+			continue
+		}
+		xlo, xhi = math.Min(xlo, xv), math.Max(xhi, xv)
+		for _, field := range series {
+			if v, ok := number(row[field]); ok {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	if math.IsInf(xlo, 0) {
+		return fmt.Errorf("field %q has no numbers for the x axis of a scatter chart", x)
+	}
+	y := s.valueAxis(area, niceTicks(lo, hi, 5))
+
+	xticks := niceTicks(xlo, xhi, 6)
+	xscale := func(v float64) float64 {
+		return area.left + (v-xticks[0])/(xticks[len(xticks)-1]-xticks[0])*(area.right-area.left)
+	}
+	for _, tick := range xticks {
+		s.text(xscale(tick), area.bottom+18, formatNumber(tick), labelSize, "middle", mutedColor, false)
+	}
+	for j, field := range series {
+		for _, row := range table.Rows {
+			xv, xok := number(row[x])
+			v, ok := number(row[field])
+			if xok && ok {
+				s.circle(point{xscale(xv), y(v)}, 4, palette[j%len(palette)], fmt.Sprintf("%s %s, %s %s", x, formatNumber(xv), field, formatNumber(v)))
+			}
+		}
+	}
+	s.line(axisColor, 1, point{area.left, area.bottom}, point{area.right, area.bottom})
+	return nil
+}
+
+// valueAxis draws the grid lines and labels of the ticks and returns the
+// scale from values to y coordinates
+func (s *scene) valueAxis(area box, ticks []float64) func(float64) float64 {
+	lo, hi := ticks[0], ticks[len(ticks)-1]
+	y := func(v float64) float64 {
+		return area.bottom - (v-lo)/(hi-lo)*(area.bottom-area.top)
+	}
+	for _, tick := range ticks {
+		s.line(gridColor, 1, point{area.left, y(tick)}, point{area.right, y(tick)})
+		s.text(area.left-8, y(tick)+4, formatNumber(tick), labelSize, "end", mutedColor, false)
+	}
+	return y
+}
+
+// plotPie draws a wedge for each row's positive value of the field, with a
+// legend of the x values and shares
+func (s *scene) plotPie(area box, table *Table, x, field string) {
+	var total float64
+	for _, row := range table.Rows {
+		if v, ok := number(row[field]); ok && v > 0 {
+			total += v
+		}
+	}
+	if total == 0 {
+		s.text(s.width/2, s.height/2, "No data", labelSize, "middle", mutedColor, false)
+		return
+	}
+
+	height := s.height - 16 - area.top
+	r := math.Min(s.width*0.3, height/2)
+	center := point{s.width * 0.35, area.top + height/2}
+	angle := -math.Pi / 2
+	legendY := center.y - float64(len(table.Rows))*9
+	i := 0
+	for _, row := range table.Rows {
+		v, ok := number(row[field])
+		if !ok || v <= 0 {
+			continue
+		}
+		c := palette[i%len(palette)]
+		sweep := v / total * 2 * math.Pi
+		points := []point{center}
+		steps := int(math.Ceil(sweep / (math.Pi / 60)))
+		for k := 0; k <= steps; k++ {
+			a := angle + sweep*float64(k)/float64(steps)
+			points = append(points, point{center.x + r*math.Cos(a), center.y + r*math.Sin(a)})
+		}
+		share := strconv.FormatFloat(v/total*100, 'f', 1, 64) + "%"
+		s.polygon(c, fmt.Sprintf("%s: %s (%s)", label(row[x]), formatNumber(v), share), points...)
+		angle += sweep
+
+		legendX := s.width * 0.7
+		s.rect(legendX, legendY+float64(i)*18, 10, 10, c, "")
+		s.text(legendX+14, legendY+float64(i)*18+9, label(row[x])+" ("+share+")", labelSize, "start", textColor, false)
+		i++
+	}
+}
+
+// number returns a cell as a number
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// label returns a cell as a label
+func label(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// niceTicks returns count or so evenly spaced round values covering lo to hi
+func niceTicks(lo, hi float64, count int) []float64 {
+	if math.IsInf(lo, 0) || math.IsInf(hi, 0) {
+		lo, hi = 0, 1
+	}
+	if lo == hi {
+		if lo == 0 {
+			hi = 1
+		} else {
+			lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+		}
+	}
+	step := niceNumber(niceNumber(hi-lo, false)/float64(count-1), true)
+	start, end := math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	var ticks []float64
+	for v := start; v <= end+step/2; v += step {
+		ticks = append(ticks, math.Round(v/step)*step)
+	}
+	return ticks
+}
+
+// niceNumber returns a number of the form 1, 2 or 5 times a power of ten near
+// n, rounded when round is set and otherwise no less than n
+func niceNumber(n float64, round bool) float64 {
+	exponent := math.Floor(math.Log10(n))
+	fraction := n / math.Pow(10, exponent)
+	var nice float64
+	switch {
+	case round && fraction < 1.5, !round && fraction <= 1:
+		nice = 1
+	case round && fraction < 3, !round && fraction <= 2:
+		nice = 2
+	case round && fraction < 7, !round && fraction <= 5:
+		nice = 5
+	default:
+		nice = 10
+	}
+	return nice * math.Pow(10, exponent)
+}
+
+// formatNumber shortens large numbers with k and M
+func formatNumber(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e6:
+		return strconv.FormatFloat(math.Round(v/1e4)/1e2, 'f', -1, 64) + "M"
+	case abs >= 1e4:
+		return strconv.FormatFloat(math.Round(v/10)/1e2, 'f', -1, 64) + "k"
+	default:
+		return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+	}
+}
@@ -0,0 +1,152 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+var (
+	fontsOnce sync.Once
+	fontsErr  error
+	regular   *opentype.Font
+	bold      *opentype.Font
+)
+
+// loadFonts parses the Go fonts charts are rasterized with
+func loadFonts() error {
+	fontsOnce.Do(func() {
+		if regular, fontsErr = opentype.Parse(goregular.TTF); fontsErr != nil {
+			return
+		}
+		bold, fontsErr = opentype.Parse(gobold.TTF)
+	})
+	return fontsErr
+}
+
+// png rasterizes the scene at scale device pixels to a CSS pixel
+func (s *scene) png(scale float64) ([]byte, error) {
+	if err := loadFonts(); err != nil {
+		return nil, fmt.Errorf("failed to load fonts: %v", err)
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(s.width*scale)), int(math.Ceil(s.height*scale))))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	faces := make(map[float64]font.Face)
+	for _, shape := range s.shapes {
+		scaled := make([]point, len(shape.points))
+		for i, p := range shape.points {
+			scaled[i] = point{p.x * scale, p.y * scale}
+		}
+		switch shape.kind {
+		case shapePolygon:
+			fill(img, scaled, shape.color)
+		case shapePolyline:
+			stroke(img, scaled, shape.width*scale, shape.color)
+		case shapeText:
+			f := regular
+			key := shape.size * scale
+			if shape.bold {
+				f, key = bold, -key
+			}
+			face, ok := faces[key]
+			if !ok {
+				var err error
+				if face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: shape.size * scale, DPI: 72, Hinting: font.HintingFull}); err != nil {
+					return nil, fmt.Errorf("failed to load font face: %v", err)
+				}
+				defer face.Close()
+				faces[key] = face
+			}
+			drawText(img, face, scaled[0], shape.text, shape.anchor, shape.color)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// fill fills a polygon, rasterizing only its bounding box
+func fill(img *image.RGBA, points []point, c color.NRGBA) {
+	if len(points) < 3 {
+		return
+	}
+	minX, minY, maxX, maxY := points[0].x, points[0].y, points[0].x, points[0].y
+	for _, p := range points {
+		minX, minY = math.Min(minX, p.x), math.Min(minY, p.y)
+		maxX, maxY = math.Max(maxX, p.x), math.Max(maxY, p.y)
+	}
+	bounds := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY))).Intersect(img.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	offset := func(p point) (float32, float32) {
+		return float32(p.x - float64(bounds.Min.X)), float32(p.y - float64(bounds.Min.Y))
+	}
+	z.MoveTo(offset(points[0]))
+	for _, p := range points[1:] {
+		z.LineTo(offset(p))
+	}
+	z.ClosePath()
+	z.Draw(img, bounds, image.NewUniform(c), image.Point{})
+}
+
+// stroke draws a line of width through the points, each segment a quad with
+// round joins
+func stroke(img *image.RGBA, points []point, width float64, c color.NRGBA) {
+	half := width / 2
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		length := math.Hypot(b.x-a.x, b.y-a.y)
+		if length == 0 {
+			continue
+		}
+		nx, ny := -(b.y-a.y)/length*half, (b.x-a.x)/length*half
+		fill(img, []point{{a.x + nx, a.y + ny}, {b.x + nx, b.y + ny}, {b.x - nx, b.y - ny}, {a.x - nx, a.y - ny}}, c)
+	}
+	if len(points) > 2 && width > 2 {
+		for _, p := range points[1 : len(points)-1] {
+			var join []point
+			for k := 0; k < 12; k++ {
+				angle := float64(k) * math.Pi / 6
+				join = append(join, point{p.x + half*math.Cos(angle), p.y + half*math.Sin(angle)})
+			}
+			fill(img, join, c)
+		}
+	}
+}
+
+// drawText draws text with its baseline at p, anchored at its start, middle
+// or end
+func drawText(img *image.RGBA, face font.Face, p point, text, anchor string, c color.NRGBA) {
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face}
+	x := fixed.Int26_6(p.x * 64)
+	switch anchor {
+	case "middle":
+		x -= d.MeasureString(text) / 2
+	case "end":
+		x -= d.MeasureString(text)
+	}
+	d.Dot = fixed.Point26_6{X: x, Y: fixed.Int26_6(p.y * 64)}
+	d.DrawString(text)
+}
@@ -0,0 +1,85 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// fontFamily is the font of chart text in SVG, the reader's sans-serif
+const fontFamily = `system-ui, -apple-system, "Segoe UI", Roboto, sans-serif`
+
+// svg writes the scene as an SVG document. Styling is given as presentation
+// attributes rather than style attributes, which content security policies
+// without unsafe-inline block.
+func (s *scene) svg() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" role="img" aria-label="%s" font-family="%s">`,
+		coordinate(s.width), coordinate(s.height), coordinate(s.width), coordinate(s.height), html.EscapeString(s.label), html.EscapeString(fontFamily))
+	fmt.Fprintf(&b, "\n<title>%s</title>\n", html.EscapeString(s.label))
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+
+	for _, shape := range s.shapes {
+		switch shape.kind {
+		case shapePolygon:
+			fmt.Fprintf(&b, `<polygon points="%s" fill="%s"%s`, points(shape.points), hex(shape.color), opacity("fill", shape.color))
+		case shapePolyline:
+			fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%s" stroke-linejoin="round" stroke-linecap="round"%s`,
+				points(shape.points), hex(shape.color), coordinate(shape.width), opacity("stroke", shape.color))
+		case shapeText:
+			anchor := ""
+			if shape.anchor != "start" {
+				anchor = ` text-anchor="` + shape.anchor + `"`
+			}
+			weight := ""
+			if shape.bold {
+				weight = ` font-weight="bold"`
+			}
+			fmt.Fprintf(&b, `<text x="%s" y="%s" font-size="%s" fill="%s"%s%s>%s</text>`+"\n",
+				coordinate(shape.points[0].x), coordinate(shape.points[0].y), coordinate(shape.size), hex(shape.color), anchor, weight, html.EscapeString(shape.text))
+			continue
+		}
+		if shape.tooltip != "" {
+			fmt.Fprintf(&b, "><title>%s</title></%s>\n", html.EscapeString(shape.tooltip), svgElement(shape.kind))
+		} else {
+			b.WriteString("/>\n")
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+func svgElement(kind shapeKind) string {
+	if kind == shapePolyline {
+		return "polyline"
+	}
+	return "polygon"
+}
+
+func points(ps []point) string {
+	parts := make([]string, len(ps))
+	for i, p := range ps {
+		parts[i] = coordinate(p.x) + "," + coordinate(p.y)
+	}
+	return strings.Join(parts, " ")
+}
+
+// coordinate formats a coordinate to a hundredth of a pixel
+func coordinate(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func hex(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func opacity(attribute string, c color.NRGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+	return fmt.Sprintf(` %s-opacity="%s"`, attribute, strconv.FormatFloat(float64(c.A)/255, 'f', 2, 64))
+}
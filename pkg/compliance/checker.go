@@ -0,0 +1,213 @@
+package compliance
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// Policy controls how asset license findings affect a build
+type Policy string
+
+const (
+	// PolicyOff skips the asset license check
+	PolicyOff Policy = "off"
+	// PolicyWarn reports findings without failing the build
+	PolicyWarn Policy = "warn"
+	// PolicyStrict fails the build unless every asset is cleanly licensed
+	PolicyStrict Policy = "strict"
+)
+
+// ParsePolicy converts a policy name into a Policy
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(strings.ToLower(name)); policy {
+	case PolicyOff, PolicyWarn, PolicyStrict:
+		return policy, nil
+	case "":
+		return PolicyWarn, nil
+	default:
+		return "", fmt.Errorf("unknown asset license policy: %s (expected off, warn or strict)", name)
+	}
+}
+
+// Severity classifies an asset license finding
+type Severity string
+
+const (
+	// SeverityInfo records license information found on an asset
+	SeverityInfo Severity = "info"
+	// SeverityWarning marks an asset whose license could not be established
+	SeverityWarning Severity = "warning"
+	// SeverityError marks an asset whose license prohibits embedding or redistribution
+	SeverityError Severity = "error"
+)
+
+// Finding describes the license status of a single asset
+type Finding struct {
+	Path     string
+	Kind     string
+	Severity Severity
+	Message  string
+}
+
+// Report collects the findings of an asset license check
+type Report struct {
+	Findings      []*Finding
+	AssetsChecked int
+}
+
+// Blocking returns the findings that fail a build under the given policy
+func (r *Report) Blocking(policy Policy) []*Finding {
+	if policy != PolicyStrict {
+		return nil
+	}
+
+	var blocking []*Finding
+	for _, finding := range r.Findings {
+		if finding.Severity != SeverityInfo {
+			blocking = append(blocking, finding)
+		}
+	}
+	return blocking
+}
+
+// prohibitedTerms match usage terms that forbid publishing an asset inside a document
+var prohibitedTerms = regexp.MustCompile(`(?i)(not for (re)?distribution|do not (re)?distribute|no (re)?distribution|(re)?distribution (is )?(prohibited|not permitted)|not for publication|editorial use only)`)
+
+var fontExtensions = map[string]bool{".ttf": true, ".otf": true, ".ttc": true, ".woff": true, ".woff2": true}
+
+var mediaExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".svg": true,
+	".tif": true, ".tiff": true, ".avif": true, ".heic": true, ".pdf": true,
+	".mp3": true, ".m4a": true, ".wav": true, ".ogg": true, ".flac": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".webm": true,
+}
+
+// AssetLicenseChecker inspects embedded fonts and media for license metadata
+type AssetLicenseChecker struct{}
+
+// NewAssetLicenseChecker creates a new asset license checker
+func NewAssetLicenseChecker() *AssetLicenseChecker {
+	return &AssetLicenseChecker{}
+}
+
+// Check inspects every font and media file in a package. Fonts are checked for their
+// OS/2 embedding permissions; media files for XMP rights metadata.
+func (c *AssetLicenseChecker) Check(files map[string][]byte) *Report {
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	report := &Report{}
+	for _, filePath := range paths {
+		ext := strings.ToLower(path.Ext(filePath))
+		switch {
+		case fontExtensions[ext]:
+			report.AssetsChecked++
+			report.Findings = append(report.Findings, c.checkFont(filePath, files[filePath]))
+		case mediaExtensions[ext]:
+			report.AssetsChecked++
+			if finding := c.checkMedia(filePath, files[filePath]); finding != nil {
+				report.Findings = append(report.Findings, finding)
+			}
+		}
+	}
+
+	return report
+}
+
+func (c *AssetLicenseChecker) checkFont(filePath string, data []byte) *Finding {
+	finding := &Finding{Path: filePath, Kind: "font"}
+
+	license, err := InspectFont(data)
+	if err != nil {
+		finding.Severity = SeverityWarning
+		finding.Message = fmt.Sprintf("embedding permissions could not be verified: %v", err)
+		return finding
+	}
+
+	switch {
+	case license.Embedding == EmbeddingRestricted:
+		finding.Severity = SeverityError
+		finding.Message = fmt.Sprintf("font license prohibits embedding (fsType 0x%04x)", license.FSType)
+	case license.BitmapOnly:
+		finding.Severity = SeverityError
+		finding.Message = fmt.Sprintf("font license only permits bitmap embedding (fsType 0x%04x)", license.FSType)
+	case prohibitedTerms.MatchString(license.License):
+		finding.Severity = SeverityError
+		finding.Message = fmt.Sprintf("font license prohibits redistribution: %s", license.License)
+	case license.License == "" && license.LicenseURL == "":
+		finding.Severity = SeverityWarning
+		finding.Message = fmt.Sprintf("%s embedding permitted, but the font names no license", license.Embedding)
+	default:
+		finding.Severity = SeverityInfo
+		finding.Message = fmt.Sprintf("%s embedding permitted; license: %s", license.Embedding, firstNonEmpty(license.LicenseURL, license.License))
+	}
+
+	return finding
+}
+
+func (c *AssetLicenseChecker) checkMedia(filePath string, data []byte) *Finding {
+	rights := ExtractXMP(data)
+	if rights == nil {
+		return nil
+	}
+
+	finding := &Finding{Path: filePath, Kind: "media"}
+	terms := strings.Join([]string{rights.UsageTerms, rights.Rights}, " ")
+
+	switch {
+	case prohibitedTerms.MatchString(terms):
+		finding.Severity = SeverityError
+		finding.Message = fmt.Sprintf("usage terms prohibit redistribution: %s", strings.TrimSpace(terms))
+	case strings.EqualFold(rights.Marked, "true") && !rights.HasLicense():
+		finding.Severity = SeverityWarning
+		finding.Message = "asset is marked as rights-managed but carries no usage terms"
+	case rights.HasLicense():
+		finding.Severity = SeverityInfo
+		finding.Message = fmt.Sprintf("license: %s", firstNonEmpty(rights.License, rights.WebStatement, rights.UsageTerms))
+	default:
+		return nil
+	}
+
+	return finding
+}
+
+// NewWaiver records an audited override for assets that failed the check
+func NewWaiver(findings []*Finding, policy Policy, reason, approvedBy string) (*core.LicenseWaiver, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("a license waiver requires a reason")
+	}
+	if strings.TrimSpace(approvedBy) == "" {
+		return nil, fmt.Errorf("a license waiver requires an approver")
+	}
+
+	assets := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		assets = append(assets, finding.Path)
+	}
+
+	return &core.LicenseWaiver{
+		Assets:     assets,
+		Policy:     string(policy),
+		Reason:     reason,
+		ApprovedBy: approvedBy,
+		Granted:    time.Now().UTC(),
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
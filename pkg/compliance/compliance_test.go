@@ -0,0 +1,200 @@
+package compliance
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// buildFontTables returns the OS/2 and name tables of a test font
+func buildFontTables(fsType uint16, license string) map[string][]byte {
+	os2 := make([]byte, 78)
+	binary.BigEndian.PutUint16(os2[8:10], fsType)
+
+	var name []byte
+	if license == "" {
+		name = make([]byte, 6)
+	} else {
+		var str []byte
+		for _, unit := range utf16.Encode([]rune(license)) {
+			str = binary.BigEndian.AppendUint16(str, unit)
+		}
+		name = make([]byte, 18)
+		binary.BigEndian.PutUint16(name[2:4], 1)
+		binary.BigEndian.PutUint16(name[4:6], 18)
+		binary.BigEndian.PutUint16(name[6:8], 3)
+		binary.BigEndian.PutUint16(name[8:10], 1)
+		binary.BigEndian.PutUint16(name[10:12], 0x409)
+		binary.BigEndian.PutUint16(name[12:14], nameIDLicense)
+		binary.BigEndian.PutUint16(name[14:16], uint16(len(str)))
+		name = append(name, str...)
+	}
+
+	return map[string][]byte{"OS/2": os2, "name": name}
+}
+
+func buildTTF(fsType uint16, license string) []byte {
+	tables := buildFontTables(fsType, license)
+	tags := []string{"OS/2", "name"}
+
+	header := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(header[0:4], 0x00010000)
+	binary.BigEndian.PutUint16(header[4:6], uint16(len(tags)))
+
+	var body []byte
+	offset := len(header)
+	for i, tag := range tags {
+		record := header[12+i*16:]
+		copy(record[0:4], tag)
+		binary.BigEndian.PutUint32(record[8:12], uint32(offset+len(body)))
+		binary.BigEndian.PutUint32(record[12:16], uint32(len(tables[tag])))
+		body = append(body, tables[tag]...)
+	}
+
+	return append(header, body...)
+}
+
+func buildWOFF(fsType uint16, license string) []byte {
+	tables := buildFontTables(fsType, license)
+	tags := []string{"OS/2", "name"}
+
+	header := make([]byte, 44+20*len(tags))
+	copy(header[0:4], "wOFF")
+	binary.BigEndian.PutUint16(header[12:14], uint16(len(tags)))
+
+	var body []byte
+	for i, tag := range tags {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(tables[tag])
+		w.Close()
+
+		entry := header[44+i*20:]
+		copy(entry[0:4], tag)
+		binary.BigEndian.PutUint32(entry[4:8], uint32(len(header)+len(body)))
+		binary.BigEndian.PutUint32(entry[8:12], uint32(compressed.Len()))
+		binary.BigEndian.PutUint32(entry[12:16], uint32(len(tables[tag])))
+		body = append(body, compressed.Bytes()...)
+	}
+
+	return append(header, body...)
+}
+
+func xmpImage(rights string) []byte {
+	return []byte("\xff\xd8\xff\xe1" + `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:xmpRights="http://ns.adobe.com/xap/1.0/rights/" xmlns:cc="http://creativecommons.org/ns#" ` + rights + `
+</rdf:RDF></x:xmpmeta>` + "\xff\xd9")
+}
+
+func TestInspectFont(t *testing.T) {
+	license, err := InspectFont(buildTTF(0x0008, "SIL Open Font License 1.1"))
+	if err != nil {
+		t.Fatalf("Failed to inspect TTF: %v", err)
+	}
+	if license.Embedding != EmbeddingEditable || license.License != "SIL Open Font License 1.1" {
+		t.Errorf("Unexpected TTF license: %+v", license)
+	}
+
+	license, err = InspectFont(buildWOFF(0x0002, ""))
+	if err != nil {
+		t.Fatalf("Failed to inspect WOFF: %v", err)
+	}
+	if license.Format != "woff" || license.Embedding != EmbeddingRestricted {
+		t.Errorf("Unexpected WOFF license: %+v", license)
+	}
+
+	if _, err := InspectFont([]byte("wOF2\x00\x00\x00\x00\x00\x00\x00\x00")); err == nil {
+		t.Error("Expected WOFF2 inspection to report an error")
+	}
+	if _, err := InspectFont([]byte("not a font at all")); err == nil {
+		t.Error("Expected invalid font to fail")
+	}
+}
+
+func TestExtractXMP(t *testing.T) {
+	rights := ExtractXMP(xmpImage(`xmpRights:Marked="True">
+<xmpRights:UsageTerms><rdf:Alt><rdf:li xml:lang="x-default">Editorial use only</rdf:li></rdf:Alt></xmpRights:UsageTerms>
+<cc:license rdf:resource="https://example.com/license"/>
+</rdf:Description>`))
+	if rights == nil {
+		t.Fatal("Expected XMP packet to be found")
+	}
+	if rights.Marked != "True" || rights.UsageTerms != "Editorial use only" || rights.License != "https://example.com/license" {
+		t.Errorf("Unexpected XMP rights: %+v", rights)
+	}
+
+	if ExtractXMP([]byte("\xff\xd8\xff\xd9")) != nil {
+		t.Error("Expected nil for media without XMP")
+	}
+}
+
+func TestAssetLicenseChecker(t *testing.T) {
+	files := map[string][]byte{
+		"content/index.html":           []byte("<html></html>"),
+		"assets/fonts/open.ttf":        buildTTF(0x0000, "SIL Open Font License 1.1"),
+		"assets/fonts/restricted.woff": buildWOFF(0x0002, ""),
+		"assets/fonts/unnamed.otf":     buildTTF(0x0004, ""),
+		"assets/images/plain.png":      []byte("\x89PNG\r\n\x1a\n"),
+		"assets/images/stock.jpg":      xmpImage(`><xmpRights:UsageTerms>Not for redistribution</xmpRights:UsageTerms></rdf:Description>`),
+		"assets/images/cc.jpg":         xmpImage(`xmpRights:Marked="True" xmpRights:WebStatement="https://creativecommons.org/licenses/by/4.0/"></rdf:Description>`),
+	}
+
+	report := NewAssetLicenseChecker().Check(files)
+	if report.AssetsChecked != 6 {
+		t.Errorf("Expected 6 assets checked, got %d", report.AssetsChecked)
+	}
+
+	severities := make(map[string]Severity)
+	for _, finding := range report.Findings {
+		severities[finding.Path] = finding.Severity
+	}
+	expected := map[string]Severity{
+		"assets/fonts/open.ttf":        SeverityInfo,
+		"assets/fonts/restricted.woff": SeverityError,
+		"assets/fonts/unnamed.otf":     SeverityWarning,
+		"assets/images/stock.jpg":      SeverityError,
+		"assets/images/cc.jpg":         SeverityInfo,
+	}
+	for path, want := range expected {
+		if severities[path] != want {
+			t.Errorf("%s: expected severity %s, got %q", path, want, severities[path])
+		}
+	}
+	if _, exists := severities["assets/images/plain.png"]; exists {
+		t.Error("Expected no finding for media without rights metadata")
+	}
+
+	if len(report.Blocking(PolicyWarn)) != 0 {
+		t.Error("Expected warn policy not to block")
+	}
+	blocking := report.Blocking(PolicyStrict)
+	if len(blocking) != 3 {
+		t.Errorf("Expected 3 blocking findings under strict policy, got %d", len(blocking))
+	}
+
+	waiver, err := NewWaiver(blocking, PolicyStrict, "Licensed separately under contract 42", "legal")
+	if err != nil {
+		t.Fatalf("Failed to create waiver: %v", err)
+	}
+	if len(waiver.Assets) != 3 || waiver.Policy != "strict" || waiver.Granted.IsZero() {
+		t.Errorf("Unexpected waiver: %+v", waiver)
+	}
+	if _, err := NewWaiver(blocking, PolicyStrict, " ", "legal"); err == nil {
+		t.Error("Expected waiver without reason to fail")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if policy, err := ParsePolicy(""); err != nil || policy != PolicyWarn {
+		t.Errorf("Expected default policy to be warn, got %q (%v)", policy, err)
+	}
+	if policy, err := ParsePolicy("STRICT"); err != nil || policy != PolicyStrict {
+		t.Errorf("Expected strict policy, got %q (%v)", policy, err)
+	}
+	if _, err := ParsePolicy("lenient"); err == nil {
+		t.Error("Expected unknown policy to fail")
+	}
+}
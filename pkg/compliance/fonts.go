@@ -0,0 +1,235 @@
+package compliance
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// OS/2 fsType embedding permission bits
+const (
+	fsTypeRestricted   = 0x0002
+	fsTypePreviewPrint = 0x0004
+	fsTypeEditable     = 0x0008
+	fsTypeNoSubsetting = 0x0100
+	fsTypeBitmapOnly   = 0x0200
+)
+
+// Embedding permission levels derived from the OS/2 fsType field
+const (
+	EmbeddingInstallable  = "installable"
+	EmbeddingRestricted   = "restricted"
+	EmbeddingPreviewPrint = "preview-print"
+	EmbeddingEditable     = "editable"
+)
+
+// name table IDs carrying license information
+const (
+	nameIDCopyright  = 0
+	nameIDLicense    = 13
+	nameIDLicenseURL = 14
+)
+
+// FontLicense holds the licensing information embedded in a font file
+type FontLicense struct {
+	Format       string
+	FSType       uint16
+	Embedding    string
+	NoSubsetting bool
+	BitmapOnly   bool
+	Copyright    string
+	License      string
+	LicenseURL   string
+}
+
+// InspectFont reads the OS/2 embedding bits and name table license strings of a
+// TrueType, OpenType, TrueType Collection or WOFF font
+func InspectFont(data []byte) (*FontLicense, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font data too short")
+	}
+
+	var tables map[string][]byte
+	var err error
+	format := "sfnt"
+
+	switch string(data[:4]) {
+	case "wOFF":
+		format = "woff"
+		tables, err = readWOFFTables(data)
+	case "wOF2":
+		return nil, fmt.Errorf("WOFF2 fonts cannot be inspected")
+	case "ttcf":
+		format = "ttc"
+		if len(data) < 16 {
+			return nil, fmt.Errorf("font collection header too short")
+		}
+		tables, err = readSFNTTables(data, int(binary.BigEndian.Uint32(data[12:16])))
+	case "\x00\x01\x00\x00", "OTTO", "true":
+		tables, err = readSFNTTables(data, 0)
+	default:
+		return nil, fmt.Errorf("unrecognized font format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	os2, exists := tables["OS/2"]
+	if !exists || len(os2) < 10 {
+		return nil, fmt.Errorf("font has no OS/2 table")
+	}
+
+	fsType := binary.BigEndian.Uint16(os2[8:10])
+	license := &FontLicense{
+		Format:       format,
+		FSType:       fsType,
+		Embedding:    embeddingLevel(fsType),
+		NoSubsetting: fsType&fsTypeNoSubsetting != 0,
+		BitmapOnly:   fsType&fsTypeBitmapOnly != 0,
+	}
+
+	if name, exists := tables["name"]; exists {
+		names := readNames(name)
+		license.Copyright = names[nameIDCopyright]
+		license.License = names[nameIDLicense]
+		license.LicenseURL = names[nameIDLicenseURL]
+	}
+
+	return license, nil
+}
+
+// embeddingLevel interprets the usage permission bits; when several are set the
+// least restrictive one applies
+func embeddingLevel(fsType uint16) string {
+	switch {
+	case fsType&fsTypeEditable != 0:
+		return EmbeddingEditable
+	case fsType&fsTypePreviewPrint != 0:
+		return EmbeddingPreviewPrint
+	case fsType&fsTypeRestricted != 0:
+		return EmbeddingRestricted
+	default:
+		return EmbeddingInstallable
+	}
+}
+
+func readSFNTTables(data []byte, offset int) (map[string][]byte, error) {
+	if offset < 0 || offset+12 > len(data) {
+		return nil, fmt.Errorf("invalid font offset")
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[offset+4 : offset+6]))
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		record := offset + 12 + i*16
+		if record+16 > len(data) {
+			return nil, fmt.Errorf("font table directory is truncated")
+		}
+		tag := string(data[record : record+4])
+		start := int(binary.BigEndian.Uint32(data[record+8 : record+12]))
+		length := int(binary.BigEndian.Uint32(data[record+12 : record+16]))
+		if start < 0 || length < 0 || start+length > len(data) {
+			return nil, fmt.Errorf("font table %q is out of bounds", tag)
+		}
+		tables[tag] = data[start : start+length]
+	}
+
+	return tables, nil
+}
+
+func readWOFFTables(data []byte) (map[string][]byte, error) {
+	if len(data) < 44 {
+		return nil, fmt.Errorf("WOFF header too short")
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[12:14]))
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		entry := 44 + i*20
+		if entry+20 > len(data) {
+			return nil, fmt.Errorf("WOFF table directory is truncated")
+		}
+		tag := string(data[entry : entry+4])
+		// Only the tables carrying license data are decoded
+		if tag != "OS/2" && tag != "name" {
+			continue
+		}
+
+		start := int(binary.BigEndian.Uint32(data[entry+4 : entry+8]))
+		compLength := int(binary.BigEndian.Uint32(data[entry+8 : entry+12]))
+		origLength := int(binary.BigEndian.Uint32(data[entry+12 : entry+16]))
+		if start < 0 || compLength < 0 || start+compLength > len(data) {
+			return nil, fmt.Errorf("WOFF table %q is out of bounds", tag)
+		}
+
+		table := data[start : start+compLength]
+		if compLength < origLength {
+			reader, err := zlib.NewReader(bytes.NewReader(table))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress WOFF table %q: %v", tag, err)
+			}
+			table, err = io.ReadAll(io.LimitReader(reader, int64(origLength)))
+			reader.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress WOFF table %q: %v", tag, err)
+			}
+		}
+		tables[tag] = table
+	}
+
+	return tables, nil
+}
+
+// readNames decodes the name table, preferring Windows English and Unicode records
+func readNames(table []byte) map[int]string {
+	names := make(map[int]string)
+	if len(table) < 6 {
+		return names
+	}
+
+	count := int(binary.BigEndian.Uint16(table[2:4]))
+	storage := int(binary.BigEndian.Uint16(table[4:6]))
+	preferred := make(map[int]bool)
+
+	for i := 0; i < count; i++ {
+		record := 6 + i*12
+		if record+12 > len(table) {
+			break
+		}
+		platformID := binary.BigEndian.Uint16(table[record : record+2])
+		languageID := binary.BigEndian.Uint16(table[record+4 : record+6])
+		nameID := int(binary.BigEndian.Uint16(table[record+6 : record+8]))
+		length := int(binary.BigEndian.Uint16(table[record+8 : record+10]))
+		offset := storage + int(binary.BigEndian.Uint16(table[record+10:record+12]))
+		if nameID != nameIDCopyright && nameID != nameIDLicense && nameID != nameIDLicenseURL {
+			continue
+		}
+		if offset+length > len(table) || preferred[nameID] {
+			continue
+		}
+
+		raw := table[offset : offset+length]
+		switch platformID {
+		case 0, 3:
+			names[nameID] = decodeUTF16BE(raw)
+			preferred[nameID] = platformID == 3 && languageID == 0x409
+		case 1:
+			if _, exists := names[nameID]; !exists {
+				names[nameID] = string(raw)
+			}
+		}
+	}
+
+	return names
+}
+
+func decodeUTF16BE(raw []byte) string {
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(raw[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
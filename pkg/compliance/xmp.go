@@ -0,0 +1,111 @@
+package compliance
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// XMP namespaces carrying rights information
+const (
+	nsXMPRights = "http://ns.adobe.com/xap/1.0/rights/"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsCC        = "http://creativecommons.org/ns#"
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// XMPRights holds the rights properties of an embedded XMP packet
+type XMPRights struct {
+	Marked       string
+	UsageTerms   string
+	WebStatement string
+	Owner        string
+	Rights       string
+	License      string
+}
+
+// HasLicense reports whether the packet names a license or usage terms
+func (x *XMPRights) HasLicense() bool {
+	return x.UsageTerms != "" || x.WebStatement != "" || x.License != ""
+}
+
+// ExtractXMP finds an XMP packet embedded in a media file and reads its rights
+// properties. Images, audio, video, SVG and PDF files all store XMP as plain XML,
+// so the packet can be located without parsing the container format. Returns nil
+// when the file has no XMP packet.
+func ExtractXMP(data []byte) *XMPRights {
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	if start == -1 {
+		return nil
+	}
+	end := bytes.Index(data[start:], []byte("</x:xmpmeta>"))
+	if end == -1 {
+		return nil
+	}
+	packet := data[start : start+end+len("</x:xmpmeta>")]
+
+	rights := &XMPRights{}
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+
+	var stack []xml.Name
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			for _, attr := range t.Attr {
+				if attr.Name.Space == nsRDF && attr.Name.Local == "resource" && t.Name.Space == nsCC && t.Name.Local == "license" {
+					rights.License = attr.Value
+				}
+				rights.set(attr.Name, attr.Value)
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text == "" {
+				continue
+			}
+			// Property values may be nested in rdf:Alt/rdf:Seq/rdf:li containers
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Space != nsRDF {
+					rights.set(stack[i], text)
+					break
+				}
+			}
+		}
+	}
+
+	return rights
+}
+
+func (x *XMPRights) set(name xml.Name, value string) {
+	switch {
+	case name.Space == nsXMPRights && name.Local == "Marked":
+		x.Marked = value
+	case name.Space == nsXMPRights && name.Local == "UsageTerms":
+		x.UsageTerms = appendValue(x.UsageTerms, value)
+	case name.Space == nsXMPRights && name.Local == "WebStatement":
+		x.WebStatement = value
+	case name.Space == nsXMPRights && name.Local == "Owner":
+		x.Owner = appendValue(x.Owner, value)
+	case name.Space == nsDC && name.Local == "rights":
+		x.Rights = appendValue(x.Rights, value)
+	case name.Space == nsCC && name.Local == "license":
+		x.License = value
+	}
+}
+
+func appendValue(existing, value string) string {
+	if existing == "" || existing == value {
+		return value
+	}
+	return existing + "; " + value
+}
@@ -0,0 +1,386 @@
+// Package conformance holds the reference fixtures other implementations of
+// the LIV format, such as the JS viewer or Rust tooling, are checked
+// against: valid and deliberately broken packages, each with the outcome this
+// implementation gives it. Fixtures are grouped by the check they exercise:
+// validation of the package structure and manifest, integrity of the
+// resources against their manifest hashes, and signature verification.
+//
+// Fixtures are generated, not stored, and are the same on every run: the
+// archives have fixed timestamps and are signed with fixed Ed25519 keys.
+// Export writes them to a directory with an index of the expected outcomes,
+// and Run checks a tool under test against them.
+package conformance
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+)
+
+// Version is the version of the fixture suite
+const Version = "1"
+
+// Checks a fixture can exercise
+const (
+	// CheckValidate is validation of the package structure and manifest
+	CheckValidate = "validate"
+	// CheckIntegrity is verification of the resources against the hashes
+	// and sizes in the manifest
+	CheckIntegrity = "integrity"
+	// CheckSignature is verification of the document signatures with the
+	// public key of the signer
+	CheckSignature = "signature"
+)
+
+// Checks lists the checks in the order fixtures are run
+var Checks = []string{CheckValidate, CheckIntegrity, CheckSignature}
+
+// fixtureTime is the time recorded in fixture manifests and archives
+var fixtureTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// Fixture is a package with the outcome a conforming implementation gives it
+type Fixture struct {
+	Name        string `json:"name"`
+	Check       string `json:"check"`
+	Description string `json:"description"`
+	Valid       bool   `json:"valid"`
+	// File is the path of the package in an exported suite
+	File string `json:"file"`
+	// Key is the path of the public key signatures are verified with in an
+	// exported suite
+	Key string `json:"key,omitempty"`
+
+	// Package is the .liv archive
+	Package []byte `json:"-"`
+	// PublicKey is the key signatures are verified with
+	PublicKey crypto.PublicKey `json:"-"`
+}
+
+// fixtureKey returns a fixed Ed25519 key, so signed fixtures are the same on
+// every run
+func fixtureKey(name string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("liv conformance key " + name))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// document returns the files of a small document whose manifest lists its
+// resources
+func document() map[string][]byte {
+	files := map[string][]byte{
+		"content/index.html":           []byte("<!DOCTYPE html>\n<html><head><title>Conformance</title></head><body><h1>Conformance</h1></body></html>\n"),
+		"content/styles/main.css":      []byte("h1 { color: #333; }\n"),
+		"content/static/fallback.html": []byte("<!DOCTYPE html>\n<html><body><h1>Conformance</h1></body></html>\n"),
+		"assets/images/dot.png":        {0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0x00, 0x00, 0x0d},
+	}
+	files["manifest.json"] = marshalManifest(documentManifest(files))
+	return files
+}
+
+// documentManifest returns a valid manifest listing files
+func documentManifest(files map[string][]byte) *core.Manifest {
+	m := manifest.NewManifestBuilder().CreateDefaultSecurityPolicy().GetManifest()
+	m.Metadata = &core.DocumentMetadata{
+		Title:    "Conformance",
+		Author:   "LIV Conformance Suite",
+		Created:  fixtureTime,
+		Modified: fixtureTime,
+		Version:  "1.0.0",
+		Language: "en",
+	}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	for path, data := range files {
+		if path == "manifest.json" {
+			continue
+		}
+		m.Resources[path] = &core.Resource{
+			Hash: hasher.HashBytes(data),
+			Size: int64(len(data)),
+			Type: mimeType(path),
+			Path: path,
+		}
+	}
+	return m
+}
+
+// withManifest returns the files of the document with the manifest changed
+// by edit
+func withManifest(edit func(m *core.Manifest)) map[string][]byte {
+	files := document()
+	m := documentManifest(files)
+	edit(m)
+	files["manifest.json"] = marshalManifest(m)
+	return files
+}
+
+// marshalManifest encodes a manifest without validating it, so broken
+// manifests can be written
+func marshalManifest(m *core.Manifest) []byte {
+	// Marshalling plain structs cannot fail
+	data, _ := json.MarshalIndent(m, "", "  ")
+	return data
+}
+
+// mimeType returns the type fixture resources are listed with
+func mimeType(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".html"):
+		return "text/html"
+	case strings.HasSuffix(path, ".css"):
+		return "text/css"
+	case strings.HasSuffix(path, ".png"):
+		return "image/png"
+	}
+	return "text/plain"
+}
+
+// archive writes files to a ZIP archive in path order with fixed
+// timestamps. Paths are written as given, so unsafe paths can be tested.
+func archive(files map[string][]byte) ([]byte, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, path := range paths {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Deflate, Modified: fixtureTime})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %v", path, err)
+		}
+		if _, err := w.Write(files[path]); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sign adds the signature files of the document in files, signed with
+// privateKey
+func sign(files map[string][]byte, privateKey crypto.Signer) (map[string][]byte, error) {
+	pkg, err := archive(files)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := container.NewPackageManager().ExtractPackage(context.Background(), bytes.NewReader(pkg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %v", err)
+	}
+	signatures, err := integrity.NewSignatureManager().SignDocument(doc, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	signed := make(map[string][]byte, len(files))
+	for path, data := range files {
+		signed[path] = data
+	}
+	for path, data := range container.SignatureFiles(signatures) {
+		signed[path] = data
+	}
+	return signed, nil
+}
+
+// Fixtures returns the fixture suite
+func Fixtures() ([]*Fixture, error) {
+	var fixtures []*Fixture
+	var failed error
+	add := func(check, name, description string, valid bool, files map[string][]byte) *Fixture {
+		pkg, err := archive(files)
+		if err != nil && failed == nil {
+			failed = fmt.Errorf("fixture %s: %v", name, err)
+		}
+		fixture := &Fixture{
+			Name:        name,
+			Check:       check,
+			Description: description,
+			Valid:       valid,
+			File:        check + "/" + name + ".liv",
+			Package:     pkg,
+		}
+		fixtures = append(fixtures, fixture)
+		return fixture
+	}
+
+	// Validation of the structure and manifest
+	add(CheckValidate, "minimal", "The required manifest and content/index.html with a valid manifest", true,
+		map[string][]byte{
+			"manifest.json":      marshalManifest(documentManifest(map[string][]byte{"content/index.html": document()["content/index.html"]})),
+			"content/index.html": document()["content/index.html"],
+		})
+	add(CheckValidate, "complete", "A stylesheet, static fallback and image asset besides the required files", true, document())
+	withExtra := document()
+	withExtra["notes/readme.txt"] = []byte("Files the manifest does not list are allowed\n")
+	add(CheckValidate, "unlisted-file", "A file the manifest does not list, which is only a warning", true, withExtra)
+	fixtures = append(fixtures, &Fixture{
+		Name:        "not-a-zip",
+		Check:       CheckValidate,
+		Description: "A package that is not a ZIP archive",
+		File:        CheckValidate + "/not-a-zip.liv",
+		Package:     []byte("This is not a ZIP archive\n"),
+	})
+	noManifest := document()
+	delete(noManifest, "manifest.json")
+	add(CheckValidate, "missing-manifest", "A package without manifest.json", false, noManifest)
+	noIndex := document()
+	delete(noIndex, "content/index.html")
+	add(CheckValidate, "missing-index", "A package without content/index.html", false, noIndex)
+	malformed := document()
+	malformed["manifest.json"] = []byte(`{"version": "1.0", "metadata": {`)
+	add(CheckValidate, "malformed-manifest", "A manifest that is not valid JSON", false, malformed)
+	add(CheckValidate, "missing-title", "A manifest without the required title", false,
+		withManifest(func(m *core.Manifest) { m.Metadata.Title = "" }))
+	add(CheckValidate, "invalid-language", "A language that is not a two letter code", false,
+		withManifest(func(m *core.Manifest) { m.Metadata.Language = "eng" }))
+	add(CheckValidate, "created-after-modified", "A creation time after the modification time", false,
+		withManifest(func(m *core.Manifest) { m.Metadata.Created = fixtureTime.Add(time.Hour) }))
+	add(CheckValidate, "missing-security-policy", "A manifest without the required security policy", false,
+		withManifest(func(m *core.Manifest) { m.Security = nil }))
+	traversal := document()
+	traversal["../outside.html"] = []byte("<p>Outside the package</p>\n")
+	add(CheckValidate, "path-traversal", "An entry whose path leaves the package", false, traversal)
+	absolute := document()
+	absolute["/etc/liv.conf"] = []byte("absolute\n")
+	add(CheckValidate, "absolute-path", "An entry with an absolute path", false, absolute)
+
+	// Integrity of the resources
+	add(CheckIntegrity, "intact", "Every resource matches its hash and size", true, document())
+	add(CheckIntegrity, "unlisted-file", "A file the manifest does not list, which is only a warning", true, func() map[string][]byte {
+		files := document()
+		files["assets/data/notes.txt"] = []byte("Not listed\n")
+		return files
+	}())
+	add(CheckIntegrity, "uppercase-hash", "Hashes compare without regard to case", true,
+		withManifest(func(m *core.Manifest) {
+			resource := m.Resources["content/index.html"]
+			resource.Hash = strings.ToUpper(resource.Hash)
+		}))
+	modified := document()
+	modified["content/index.html"] = []byte("<!DOCTYPE html>\n<html><body><h1>Tampered</h1></body></html>\n")
+	add(CheckIntegrity, "hash-mismatch", "A resource changed after its hash was recorded", false, modified)
+	add(CheckIntegrity, "size-mismatch", "A resource whose recorded size is wrong", false,
+		withManifest(func(m *core.Manifest) { m.Resources["content/styles/main.css"].Size++ }))
+	missing := document()
+	delete(missing, "assets/images/dot.png")
+	add(CheckIntegrity, "missing-resource", "A listed resource is not in the package", false, missing)
+
+	// Signatures
+	signer, other := fixtureKey("signer"), fixtureKey("other")
+	signature := func(name, description string, valid bool, files map[string][]byte, privateKey crypto.Signer, edit func(files map[string][]byte)) {
+		if privateKey != nil {
+			signed, err := sign(files, privateKey)
+			if err != nil && failed == nil {
+				failed = fmt.Errorf("fixture %s: %v", name, err)
+			}
+			files = signed
+		}
+		if edit != nil {
+			edit(files)
+		}
+		fixture := add(CheckSignature, name, description, valid, files)
+		fixture.Key = "keys/signer.pem"
+		fixture.PublicKey = signer.Public()
+	}
+	signature("signed", "Signatures of the manifest and content by the signer", true, document(), signer, nil)
+	signature("unsigned", "A document without signatures", false, document(), nil, nil)
+	signature("tampered-content", "The page changed after signing", false, document(), signer, func(files map[string][]byte) {
+		files["content/index.html"] = modified["content/index.html"]
+	})
+	signature("tampered-manifest", "The title changed after signing", false, document(), signer, func(files map[string][]byte) {
+		var m core.Manifest
+		json.Unmarshal(files["manifest.json"], &m)
+		m.Metadata.Title = "Forged"
+		files["manifest.json"] = marshalManifest(&m)
+	})
+	signature("other-signer", "Signatures by a key other than the signer's", false, document(), other, nil)
+	signature("algorithm-mismatch", "Ed25519 signatures recorded as RSA-SHA256", false, document(), signer, func(files map[string][]byte) {
+		files["signatures/algorithm"] = []byte(integrity.AlgorithmRSASHA256)
+	})
+
+	if failed != nil {
+		return nil, failed
+	}
+	return fixtures, nil
+}
+
+// Reference checks a fixture with this implementation, returning an error
+// when the package fails the check
+func Reference(fixture *Fixture) error {
+	switch fixture.Check {
+	case CheckValidate:
+		return Validate(fixture.Package)
+	case CheckIntegrity:
+		return VerifyIntegrity(fixture.Package)
+	case CheckSignature:
+		return VerifySignature(fixture.Package, fixture.PublicKey)
+	}
+	return fmt.Errorf("unknown check %q", fixture.Check)
+}
+
+// Validate checks the structure and manifest of a package as liv validate
+// does
+func Validate(pkg []byte) error {
+	zipContainer := container.NewZIPContainer()
+	files, err := zipContainer.ExtractFromReaderToMemory(bytes.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		return fmt.Errorf("failed to extract document: %v", err)
+	}
+	if result := zipContainer.ValidateStructureFromMemory(files); !result.IsValid {
+		return fmt.Errorf("invalid structure: %s", strings.Join(result.Errors, "; "))
+	}
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return fmt.Errorf("manifest.json not found in document")
+	}
+	if _, result := manifest.NewManifestValidator().ValidateManifestJSON(manifestData); !result.IsValid {
+		return fmt.Errorf("invalid manifest: %s", strings.Join(result.Errors, "; "))
+	}
+	return nil
+}
+
+// VerifyIntegrity checks that every resource of a package matches the hash
+// and size in its manifest, as liv-integrity verify does. Files the manifest
+// does not list are allowed.
+func VerifyIntegrity(pkg []byte) error {
+	doc, err := container.NewPackageManager().ExtractPackage(context.Background(), bytes.NewReader(pkg))
+	if err != nil {
+		return err
+	}
+	files, err := container.NewZIPContainer().ExtractFromReaderToMemory(bytes.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		return err
+	}
+	if result := integrity.NewIntegrityValidator().ValidateResources(doc.Manifest.Resources, files); !result.IsValid {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(result.Errors, "; "))
+	}
+	return nil
+}
+
+// VerifySignature checks the signatures of a package with the signer's
+// public key, as liv-integrity verify-signature does
+func VerifySignature(pkg []byte, publicKey crypto.PublicKey) error {
+	doc, err := container.NewPackageManager().ExtractPackage(context.Background(), bytes.NewReader(pkg))
+	if err != nil {
+		return err
+	}
+	if result := integrity.NewSignatureManager().VerifyDocument(doc, publicKey); !result.Valid {
+		return fmt.Errorf("signature verification failed: %s", strings.Join(result.Errors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixturesMatchReference(t *testing.T) {
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatalf("Fixtures failed: %v", err)
+	}
+	checks := make(map[string]int)
+	for _, fixture := range fixtures {
+		checks[fixture.Check]++
+		err := Reference(fixture)
+		if fixture.Valid && err != nil {
+			t.Errorf("Expected %s to be accepted: %v", fixture.File, err)
+		}
+		if !fixture.Valid && err == nil {
+			t.Errorf("Expected %s to be rejected", fixture.File)
+		}
+	}
+	for _, check := range Checks {
+		if checks[check] == 0 {
+			t.Errorf("Expected fixtures for the %s check", check)
+		}
+	}
+
+	// Published fixtures must not change from run to run
+	again, err := Fixtures()
+	if err != nil {
+		t.Fatalf("Fixtures failed: %v", err)
+	}
+	for i, fixture := range fixtures {
+		if !bytes.Equal(fixture.Package, again[i].Package) {
+			t.Errorf("Expected %s to be the same on every run", fixture.File)
+		}
+	}
+}
+
+func TestExportAndRun(t *testing.T) {
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatalf("Fixtures failed: %v", err)
+	}
+	dir := t.TempDir()
+	if _, err := Export(dir, fixtures); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatalf("Expected an index: %v", err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil || len(index.Fixtures) != len(fixtures) {
+		t.Fatalf("Unexpected index: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keys", "signer.pem")); err != nil {
+		t.Errorf("Expected the signer's public key: %v", err)
+	}
+
+	// A runner reading the exported files with the reference implementation
+	// passes every fixture
+	reference := func(fixture *Fixture, file, keyFile string) (bool, string, error) {
+		pkg, err := os.ReadFile(file)
+		if err != nil {
+			return false, "", err
+		}
+		exported := *fixture
+		exported.Package = pkg
+		return Reference(&exported) == nil, "", nil
+	}
+	for _, result := range Run(dir, fixtures, Checks, reference) {
+		if !result.Passed() {
+			t.Errorf("Expected %s to pass: %v", result.Fixture.File, result.Err)
+		}
+	}
+
+	// A tool accepting everything fails the invalid fixtures of the checks
+	// it is run for
+	accepting := func(fixture *Fixture, file, keyFile string) (bool, string, error) {
+		return true, "", nil
+	}
+	results := Run(dir, fixtures, []string{CheckIntegrity}, accepting)
+	failed := 0
+	for _, result := range results {
+		if result.Fixture.Check != CheckIntegrity {
+			t.Errorf("Expected only integrity fixtures to run, got %s", result.Fixture.File)
+		}
+		if !result.Passed() {
+			failed++
+		}
+	}
+	if failed != 3 {
+		t.Errorf("Expected the 3 invalid integrity fixtures to fail, got %d", failed)
+	}
+}
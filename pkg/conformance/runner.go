@@ -0,0 +1,178 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/verification"
+)
+
+const (
+	// IndexFile is the index of an exported suite, listing every fixture
+	// with its expected outcome
+	IndexFile = "expected.json"
+	// DescriptorVectorsFile holds the verification descriptor vectors in
+	// an exported suite
+	DescriptorVectorsFile = "verification-vectors.json"
+)
+
+// DefaultArgs are the arguments a tool under test is run with for each
+// check, as the liv and liv-integrity commands take them. {file} is replaced
+// with the fixture and {key} with the public key file.
+var DefaultArgs = map[string]string{
+	CheckValidate:  "validate {file}",
+	CheckIntegrity: "verify {file}",
+	CheckSignature: "verify-signature {file} {key}",
+}
+
+// Index describes an exported suite
+type Index struct {
+	Version  string     `json:"version"`
+	Fixtures []*Fixture `json:"fixtures"`
+	// DescriptorVectors is the file of the verification descriptor
+	// conformance vectors
+	DescriptorVectors string `json:"descriptor_vectors"`
+}
+
+// Export writes fixtures to dir with the public keys, the verification
+// descriptor vectors and the index
+func Export(dir string, fixtures []*Fixture) (*Index, error) {
+	write := func(name string, data []byte) error {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", name, err)
+		}
+		return nil
+	}
+
+	keys := make(map[string]bool)
+	for _, fixture := range fixtures {
+		if err := write(fixture.File, fixture.Package); err != nil {
+			return nil, err
+		}
+		if fixture.Key == "" || keys[fixture.Key] {
+			continue
+		}
+		der, err := x509.MarshalPKIXPublicKey(fixture.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode public key: %v", err)
+		}
+		if err := write(fixture.Key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err != nil {
+			return nil, err
+		}
+		keys[fixture.Key] = true
+	}
+
+	vectors, err := verification.Vectors()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize vectors: %v", err)
+	}
+	if err := write(DescriptorVectorsFile, append(data, '\n')); err != nil {
+		return nil, err
+	}
+
+	index := &Index{Version: Version, Fixtures: fixtures, DescriptorVectors: DescriptorVectorsFile}
+	data, err = json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize index: %v", err)
+	}
+	if err := write(IndexFile, append(data, '\n')); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Runner runs the check of a fixture on the package in file, with the
+// public key in keyFile for signature checks. It reports whether the
+// package was accepted, with the output of the tool; an error means the
+// check could not be run.
+type Runner func(fixture *Fixture, file, keyFile string) (accepted bool, output string, err error)
+
+// Command returns a Runner running tool with the arguments args gives the
+// check, DefaultArgs when it has none. A zero exit status accepts the
+// package and any other rejects it.
+func Command(tool string, args map[string]string, timeout time.Duration) Runner {
+	return func(fixture *Fixture, file, keyFile string) (bool, string, error) {
+		template, ok := args[fixture.Check]
+		if !ok {
+			template = DefaultArgs[fixture.Check]
+		}
+		var argv []string
+		for _, arg := range strings.Fields(template) {
+			arg = strings.ReplaceAll(arg, "{file}", file)
+			arg = strings.ReplaceAll(arg, "{key}", keyFile)
+			argv = append(argv, arg)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, tool, argv...)
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return false, output.String(), fmt.Errorf("timed out after %s", timeout)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, output.String(), nil
+		}
+		if err != nil {
+			return false, output.String(), fmt.Errorf("failed to run %s: %v", tool, err)
+		}
+		return true, output.String(), nil
+	}
+}
+
+// Result is the outcome of one fixture
+type Result struct {
+	Fixture  *Fixture
+	Accepted bool
+	Output   string
+	Err      error
+}
+
+// Passed reports whether the tool gave the expected outcome
+func (r *Result) Passed() bool {
+	return r.Err == nil && r.Accepted == r.Fixture.Valid
+}
+
+// Run runs the fixtures of the given checks, exported to dir, with runner
+func Run(dir string, fixtures []*Fixture, checks []string, runner Runner) []*Result {
+	selected := make(map[string]bool)
+	for _, check := range checks {
+		selected[check] = true
+	}
+
+	var results []*Result
+	for _, fixture := range fixtures {
+		if !selected[fixture.Check] {
+			continue
+		}
+		keyFile := ""
+		if fixture.Key != "" {
+			keyFile = filepath.Join(dir, filepath.FromSlash(fixture.Key))
+		}
+		accepted, output, err := runner(fixture, filepath.Join(dir, filepath.FromSlash(fixture.File)), keyFile)
+		results = append(results, &Result{Fixture: fixture, Accepted: accepted, Output: output, Err: err})
+	}
+	return results
+}
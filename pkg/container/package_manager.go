@@ -2,10 +2,12 @@ package container
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/liv-format/liv/pkg/core"
 	"github.com/liv-format/liv/pkg/manifest"
@@ -54,7 +56,7 @@ func OpenContainer(path string) (*Container, error) {
 func (c *Container) ReadFile(path string) ([]byte, error) {
 	data, ok := c.files[path]
 	if !ok {
-		return nil, fmt.Errorf("file not found: %s", path)
+		return nil, &core.FileMissingError{Path: path}
 	}
 	return data, nil
 }
@@ -68,6 +70,20 @@ func (c *Container) ListFiles() ([]string, error) {
 	return files, nil
 }
 
+// TimestampEntry is the package path of the RFC 3161 timestamp token over the
+// signatures
+const TimestampEntry = "signatures/timestamp.tsr"
+
+// SignersEntry is the package path of the signer metadata and the
+// counter-signatures of further signers
+const SignersEntry = "signatures/signers.json"
+
+// signersFile is the content of SignersEntry
+type signersFile struct {
+	Signer            *core.SignerInfo         `json:"signer,omitempty"`
+	CounterSignatures []*core.CounterSignature `json:"counter_signatures,omitempty"`
+}
+
 // PackageManagerImpl implements the core.PackageManager interface
 type PackageManagerImpl struct {
 	zipContainer *ZIPContainer
@@ -92,7 +108,7 @@ func (pm *PackageManagerImpl) CreatePackage(ctx context.Context, sources map[str
 	for path, reader := range sources {
 		content, err := io.ReadAll(reader)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read source file %s: %v", path, err)
+			return nil, fmt.Errorf("failed to read source file %s: %w", path, err)
 		}
 		files[path] = content
 	}
@@ -114,22 +130,22 @@ func (pm *PackageManagerImpl) CreatePackage(ctx context.Context, sources map[str
 
 	// Extract content files
 	if err := pm.extractContent(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract content: %v", err)
+		return nil, fmt.Errorf("failed to extract content: %w", err)
 	}
 
 	// Extract assets
 	if err := pm.extractAssets(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract assets: %v", err)
+		return nil, fmt.Errorf("failed to extract assets: %w", err)
 	}
 
 	// Extract WASM modules
 	if err := pm.extractWASMModules(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract WASM modules: %v", err)
+		return nil, fmt.Errorf("failed to extract WASM modules: %w", err)
 	}
 
 	// Extract signatures
 	if err := pm.extractSignatures(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract signatures: %v", err)
+		return nil, fmt.Errorf("failed to extract signatures: %w", err)
 	}
 
 	return document, nil
@@ -140,44 +156,45 @@ func (pm *PackageManagerImpl) ExtractPackage(ctx context.Context, reader io.Read
 	// Read all data into memory
 	data, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read package data: %v", err)
+		return nil, fmt.Errorf("failed to read package data: %w", err)
 	}
 
 	// Create a temporary file for ZIP operations
 	tempFile, err := os.CreateTemp("", "liv-extract-*.zip")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
 	}
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
 	// Write data to temp file
 	if _, err := tempFile.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to write temporary file: %v", err)
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
 	}
 	tempFile.Close()
 
 	// Extract files to memory
 	files, err := pm.zipContainer.ExtractToMemory(tempFile.Name())
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract ZIP: %v", err)
+		return nil, fmt.Errorf("failed to extract ZIP: %w", err)
 	}
 
 	// Validate structure
+	manifestData, exists := files["manifest.json"]
+	if !exists {
+		return nil, fmt.Errorf("%w in package", core.ErrManifestMissing)
+	}
+
 	structureResult := pm.zipContainer.ValidateStructureFromMemory(files)
 	if !structureResult.IsValid {
 		return nil, fmt.Errorf("invalid package structure: %v", structureResult.Errors)
 	}
 
 	// Parse manifest
-	manifestData, exists := files["manifest.json"]
-	if !exists {
-		return nil, fmt.Errorf("manifest.json not found in package")
-	}
 
 	manifestObj, err := pm.parser.ParseFromBytes(manifestData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
 	}
 
 	// Create document structure
@@ -191,22 +208,22 @@ func (pm *PackageManagerImpl) ExtractPackage(ctx context.Context, reader io.Read
 
 	// Extract content files
 	if err := pm.extractContent(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract content: %v", err)
+		return nil, fmt.Errorf("failed to extract content: %w", err)
 	}
 
 	// Extract assets
 	if err := pm.extractAssets(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract assets: %v", err)
+		return nil, fmt.Errorf("failed to extract assets: %w", err)
 	}
 
 	// Extract WASM modules
 	if err := pm.extractWASMModules(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract WASM modules: %v", err)
+		return nil, fmt.Errorf("failed to extract WASM modules: %w", err)
 	}
 
 	// Extract signatures
 	if err := pm.extractSignatures(files, document); err != nil {
-		return nil, fmt.Errorf("failed to extract signatures: %v", err)
+		return nil, fmt.Errorf("failed to extract signatures: %w", err)
 	}
 
 	return document, nil
@@ -214,37 +231,34 @@ func (pm *PackageManagerImpl) ExtractPackage(ctx context.Context, reader io.Read
 
 // ValidateStructure validates the internal structure of a .liv package
 func (pm *PackageManagerImpl) ValidateStructure(doc *core.LIVDocument) *core.ValidationResult {
-	var errors []string
-	var warnings []string
+	result := core.NewValidationResult()
 
 	// Validate manifest
 	if doc.Manifest == nil {
-		errors = append(errors, "document manifest is missing")
+		result.AddError("package.manifest_missing", "manifest.json", "document manifest is missing")
 	} else {
-		manifestResult := pm.validator.ValidateManifest(doc.Manifest)
-		errors = append(errors, manifestResult.Errors...)
-		warnings = append(warnings, manifestResult.Warnings...)
+		result.Merge(pm.validator.ValidateManifest(doc.Manifest))
 	}
 
 	// Validate content structure
 	if doc.Content == nil {
-		errors = append(errors, "document content is missing")
+		result.AddError("package.content_missing", "content/index.html", "document content is missing")
 	} else {
 		if doc.Content.HTML == "" && doc.Content.StaticFallback == "" {
-			errors = append(errors, "document must have either HTML content or static fallback")
+			result.AddError("package.content_missing", "content/index.html", "document must have either HTML content or static fallback")
 		}
 	}
 
 	// Validate assets structure
 	if doc.Assets == nil {
-		warnings = append(warnings, "document has no assets")
+		result.AddWarning("package.no_assets", "assets/", "document has no assets")
 	}
 
 	// Validate WASM modules if configured
 	if doc.Manifest != nil && doc.Manifest.WASMConfig != nil && len(doc.Manifest.WASMConfig.Modules) > 0 {
 		for moduleName := range doc.Manifest.WASMConfig.Modules {
 			if _, exists := doc.WASMModules[moduleName]; !exists {
-				errors = append(errors, fmt.Sprintf("WASM module '%s' referenced in manifest but not found", moduleName))
+				result.AddError("package.wasm_module_missing", core.JSONPointer("wasm_config", "modules", moduleName), fmt.Sprintf("WASM module '%s' referenced in manifest but not found", moduleName))
 			}
 		}
 	}
@@ -252,15 +266,11 @@ func (pm *PackageManagerImpl) ValidateStructure(doc *core.LIVDocument) *core.Val
 	// Check for orphaned WASM modules
 	for moduleName := range doc.WASMModules {
 		if doc.Manifest.WASMConfig == nil || doc.Manifest.WASMConfig.Modules[moduleName] == nil {
-			warnings = append(warnings, fmt.Sprintf("WASM module '%s' found but not referenced in manifest", moduleName))
+			result.AddWarning("package.wasm_module_unlisted", "wasm/"+moduleName+".wasm", fmt.Sprintf("WASM module '%s' found but not referenced in manifest", moduleName))
 		}
 	}
 
-	return &core.ValidationResult{
-		IsValid:  len(errors) == 0,
-		Errors:   errors,
-		Warnings: warnings,
-	}
+	return result
 }
 
 // CompressAssets compresses and deduplicates assets
@@ -439,6 +449,17 @@ func (pm *PackageManagerImpl) extractWASMModules(files map[string][]byte, docume
 }
 
 func (pm *PackageManagerImpl) extractSignatures(files map[string][]byte, document *core.LIVDocument) error {
+	signatures, err := ReadSignatureFiles(files)
+	if err != nil {
+		return err
+	}
+	document.Signatures = signatures
+	return nil
+}
+
+// ReadSignatureFiles returns the signature bundle stored in package files, the
+// inverse of SignatureFiles
+func ReadSignatureFiles(files map[string][]byte) (*core.SignatureBundle, error) {
 	signatures := &core.SignatureBundle{}
 
 	if contentSig, exists := files["signatures/content.sig"]; exists {
@@ -449,6 +470,15 @@ func (pm *PackageManagerImpl) extractSignatures(files map[string][]byte, documen
 		signatures.ManifestSignature = string(manifestSig)
 	}
 
+	// Packages signed before the algorithm was recorded have none
+	if algorithm, exists := files["signatures/algorithm"]; exists {
+		signatures.Algorithm = strings.TrimSpace(string(algorithm))
+	}
+
+	if token, exists := files[TimestampEntry]; exists {
+		signatures.Timestamp = token
+	}
+
 	// Extract WASM signatures
 	wasmSignatures := make(map[string]string)
 	for path, data := range files {
@@ -462,8 +492,16 @@ func (pm *PackageManagerImpl) extractSignatures(files map[string][]byte, documen
 	}
 	signatures.WASMSignatures = wasmSignatures
 
-	document.Signatures = signatures
-	return nil
+	if data, exists := files[SignersEntry]; exists {
+		var signers signersFile
+		if err := json.Unmarshal(data, &signers); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", SignersEntry, err)
+		}
+		signatures.Signer = signers.Signer
+		signatures.CounterSignatures = signers.CounterSignatures
+	}
+
+	return signatures, nil
 }
 
 // SavePackage saves a LIV document to a file
@@ -477,7 +515,7 @@ func (pm *PackageManagerImpl) SavePackage(document *core.LIVDocument, outputPath
 	// Convert document to files map
 	files, err := pm.documentToFiles(document)
 	if err != nil {
-		return fmt.Errorf("failed to convert document to files: %v", err)
+		return fmt.Errorf("failed to convert document to files: %w", err)
 	}
 
 	// Create ZIP file
@@ -495,7 +533,7 @@ func (pm *PackageManagerImpl) SavePackageToWriter(document *core.LIVDocument, wr
 	// Convert document to files map
 	files, err := pm.documentToFiles(document)
 	if err != nil {
-		return fmt.Errorf("failed to convert document to files: %v", err)
+		return fmt.Errorf("failed to convert document to files: %w", err)
 	}
 
 	// Create ZIP to writer
@@ -508,7 +546,7 @@ func (pm *PackageManagerImpl) documentToFiles(document *core.LIVDocument) (map[s
 	// Add manifest
 	manifestData, err := pm.parser.SerializeToBytes(document.Manifest)
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize manifest: %v", err)
+		return nil, fmt.Errorf("failed to serialize manifest: %w", err)
 	}
 	files["manifest.json"] = manifestData
 
@@ -547,17 +585,38 @@ func (pm *PackageManagerImpl) documentToFiles(document *core.LIVDocument) (map[s
 	}
 
 	// Add signatures
-	if document.Signatures != nil {
-		if document.Signatures.ContentSignature != "" {
-			files["signatures/content.sig"] = []byte(document.Signatures.ContentSignature)
-		}
-		if document.Signatures.ManifestSignature != "" {
-			files["signatures/manifest.sig"] = []byte(document.Signatures.ManifestSignature)
-		}
-		for name, sig := range document.Signatures.WASMSignatures {
-			files["signatures/"+name+".sig"] = []byte(sig)
-		}
+	for path, data := range SignatureFiles(document.Signatures) {
+		files[path] = data
 	}
 
 	return files, nil
 }
+
+// SignatureFiles returns the package files storing a signature bundle
+func SignatureFiles(signatures *core.SignatureBundle) map[string][]byte {
+	files := make(map[string][]byte)
+	if signatures == nil {
+		return files
+	}
+	if signatures.ContentSignature != "" {
+		files["signatures/content.sig"] = []byte(signatures.ContentSignature)
+	}
+	if signatures.ManifestSignature != "" {
+		files["signatures/manifest.sig"] = []byte(signatures.ManifestSignature)
+	}
+	for name, sig := range signatures.WASMSignatures {
+		files["signatures/"+name+".sig"] = []byte(sig)
+	}
+	if signatures.Algorithm != "" {
+		files["signatures/algorithm"] = []byte(signatures.Algorithm)
+	}
+	if len(signatures.Timestamp) > 0 {
+		files[TimestampEntry] = signatures.Timestamp
+	}
+	if signatures.Signer != nil || len(signatures.CounterSignatures) > 0 {
+		// Marshalling plain structs cannot fail
+		data, _ := json.MarshalIndent(signersFile{Signer: signatures.Signer, CounterSignatures: signatures.CounterSignatures}, "", "  ")
+		files[SignersEntry] = data
+	}
+	return files
+}
@@ -3,6 +3,7 @@ package container
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -251,6 +252,30 @@ func TestPackageManagerImpl_ExtractPackage(t *testing.T) {
 	}
 }
 
+func TestPackageManagerImpl_ExtractPackageWithoutManifest(t *testing.T) {
+	var archive bytes.Buffer
+	err := NewZIPContainer().SetValidateStructure(false).CreateFromFilesToWriter(map[string][]byte{
+		"content/index.html": []byte("<h1>No manifest</h1>"),
+	}, &archive)
+	if err != nil {
+		t.Fatalf("Failed to create package: %v", err)
+	}
+
+	if err := NewZIPContainer().CreateFromFilesToWriter(map[string][]byte{"content/index.html": nil}, io.Discard); !errors.Is(err, core.ErrManifestMissing) {
+		t.Errorf("Expected packaging without a manifest to fail with a missing manifest, got %v", err)
+	}
+
+	_, err = NewPackageManager().ExtractPackage(context.Background(), &archive)
+	if !errors.Is(err, core.ErrManifestMissing) {
+		t.Errorf("Expected a missing manifest error, got %v", err)
+	}
+
+	container := &Container{files: map[string][]byte{}}
+	if _, err := container.ReadFile("manifest.json"); !errors.Is(err, core.ErrManifestMissing) || !errors.Is(err, core.ErrFileMissing) {
+		t.Errorf("Expected reading a missing manifest to be a missing file and manifest, got %v", err)
+	}
+}
+
 func TestPackageManagerImpl_ValidateStructure(t *testing.T) {
 	pm := NewPackageManager()
 
@@ -625,6 +650,12 @@ func TestPackageManagerImpl_SaveAndLoadRoundTrip(t *testing.T) {
 			ContentSignature:  "fake-content-signature",
 			ManifestSignature: "fake-manifest-signature",
 			WASMSignatures:    map[string]string{},
+			Algorithm:         "Ed25519",
+			Timestamp:         []byte{0x30, 0x03, 0x02, 0x01, 0x00},
+			Signer:            &core.SignerInfo{Name: "Author", KeyID: "0123456789abcdef"},
+			CounterSignatures: []*core.CounterSignature{
+				{Signer: core.SignerInfo{Name: "Reviewer", Role: "reviewer", KeyID: "fedcba9876543210"}, Algorithm: "Ed25519", Signature: "fake-counter-signature"},
+			},
 		},
 		WASMModules: map[string][]byte{
 			"test-module": {0x00, 0x61, 0x73, 0x6D, 0x01, 0x00, 0x00, 0x00},
@@ -671,6 +702,29 @@ func TestPackageManagerImpl_SaveAndLoadRoundTrip(t *testing.T) {
 			len(originalDocument.WASMModules),
 			len(loadedDocument.WASMModules))
 	}
+
+	if loadedDocument.Signatures.Algorithm != originalDocument.Signatures.Algorithm {
+		t.Errorf("Signature algorithm mismatch: expected '%s', got '%s'",
+			originalDocument.Signatures.Algorithm,
+			loadedDocument.Signatures.Algorithm)
+	}
+	if len(loadedDocument.Signatures.WASMSignatures) != 0 {
+		t.Errorf("Signature algorithm should not be read as a WASM signature: %v", loadedDocument.Signatures.WASMSignatures)
+	}
+	if !bytes.Equal(loadedDocument.Signatures.Timestamp, originalDocument.Signatures.Timestamp) {
+		t.Errorf("Signature timestamp mismatch: expected %x, got %x",
+			originalDocument.Signatures.Timestamp,
+			loadedDocument.Signatures.Timestamp)
+	}
+	if signer := loadedDocument.Signatures.Signer; signer == nil || signer.Name != "Author" || signer.KeyID != "0123456789abcdef" {
+		t.Errorf("Signer mismatch: got %+v", signer)
+	}
+	if counters := loadedDocument.Signatures.CounterSignatures; len(counters) != 1 || counters[0].Signer.Role != "reviewer" || counters[0].Signature != "fake-counter-signature" {
+		t.Errorf("Counter-signatures mismatch: got %+v", counters)
+	}
+	if _, exists := loadedDocument.Signatures.WASMSignatures["signers"]; exists {
+		t.Errorf("Signer metadata should not be read as a WASM signature")
+	}
 }
 
 func BenchmarkPackageManagerImpl_CreatePackage(b *testing.B) {
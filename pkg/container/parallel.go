@@ -0,0 +1,185 @@
+package container
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"runtime"
+	"time"
+	"unicode/utf8"
+)
+
+// zipEntry is a file to write into a package, held in memory or read from
+// disk at sourcePath
+type zipEntry struct {
+	name       string
+	content    []byte
+	sourcePath string
+	modified   time.Time
+}
+
+// compressedEntry is an entry deflated ahead of being written
+type compressedEntry struct {
+	data         []byte
+	crc          uint32
+	uncompressed int
+	err          error
+}
+
+// workerCount returns how many entries are compressed at once
+func (zc *ZIPContainer) workerCount() int {
+	if zc.workers > 0 {
+		return zc.workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// writeEntries writes entries in order. Entries that are deflated are
+// compressed ahead on a pool of workers, keeping at most two per worker in
+// memory; stored entries read from disk are copied straight into the archive
+// when their turn comes.
+func (zc *ZIPContainer) writeEntries(zipWriter *zip.Writer, entries []*zipEntry) error {
+	workers := zc.workerCount()
+	results := make([]chan *compressedEntry, len(entries))
+	for i := range results {
+		results[i] = make(chan *compressedEntry, 1)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	window := make(chan struct{}, 2*workers)
+	slots := make(chan struct{}, workers)
+	go func() {
+		for i, entry := range entries {
+			if !zc.shouldCompress(entry.name) {
+				continue
+			}
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(entry *zipEntry, result chan<- *compressedEntry) {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				result <- zc.deflateEntry(entry)
+			}(entry, results[i])
+		}
+	}()
+
+	for i, entry := range entries {
+		if !zc.shouldCompress(entry.name) {
+			if err := zc.storeEntry(zipWriter, entry); err != nil {
+				return err
+			}
+			continue
+		}
+
+		compressed := <-results[i]
+		<-window
+		if compressed.err != nil {
+			return compressed.err
+		}
+		header := rawHeader(entry.name, entry.modified)
+		header.CRC32 = compressed.crc
+		header.CompressedSize64 = uint64(len(compressed.data))
+		header.UncompressedSize64 = uint64(compressed.uncompressed)
+		writer, err := zipWriter.CreateRaw(header)
+		if err != nil {
+			return fmt.Errorf("failed to create ZIP entry for %s: %w", entry.name, err)
+		}
+		if _, err := writer.Write(compressed.data); err != nil {
+			return fmt.Errorf("failed to write content for %s: %w", entry.name, err)
+		}
+	}
+
+	return nil
+}
+
+// deflateEntry compresses an entry in memory
+func (zc *ZIPContainer) deflateEntry(entry *zipEntry) *compressedEntry {
+	content := entry.content
+	if entry.sourcePath != "" {
+		var err error
+		if content, err = os.ReadFile(entry.sourcePath); err != nil {
+			return &compressedEntry{err: fmt.Errorf("failed to open file %s: %w", entry.sourcePath, err)}
+		}
+	}
+
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, zc.compressionLevel)
+	if err != nil {
+		return &compressedEntry{err: fmt.Errorf("failed to compress %s: %w", entry.name, err)}
+	}
+	if _, err := writer.Write(content); err != nil {
+		return &compressedEntry{err: fmt.Errorf("failed to compress %s: %w", entry.name, err)}
+	}
+	if err := writer.Close(); err != nil {
+		return &compressedEntry{err: fmt.Errorf("failed to compress %s: %w", entry.name, err)}
+	}
+
+	return &compressedEntry{
+		data:         buf.Bytes(),
+		crc:          crc32.ChecksumIEEE(content),
+		uncompressed: len(content),
+	}
+}
+
+// storeEntry writes an entry without compression
+func (zc *ZIPContainer) storeEntry(zipWriter *zip.Writer, entry *zipEntry) error {
+	if entry.sourcePath != "" {
+		return zc.addFileToZip(zipWriter, entry.sourcePath, entry.name)
+	}
+
+	header := &zip.FileHeader{
+		Name:     entry.name,
+		Method:   zip.Store,
+		Modified: entry.modified,
+	}
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to create ZIP entry for %s: %w", entry.name, err)
+	}
+	if _, err := writer.Write(entry.content); err != nil {
+		return fmt.Errorf("failed to write content for %s: %w", entry.name, err)
+	}
+	return nil
+}
+
+// rawHeader returns the header of an entry written with CreateRaw, which
+// leaves the version, name encoding and time fields to the caller. They are
+// set as CreateHeader would set them.
+func rawHeader(name string, modified time.Time) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:           name,
+		Method:         zip.Deflate,
+		CreatorVersion: 20,
+		ReaderVersion:  20,
+	}
+	for _, r := range name {
+		if r >= utf8.RuneSelf {
+			if utf8.ValidString(name) {
+				header.Flags |= 0x800
+			}
+			break
+		}
+	}
+
+	header.Modified = modified
+	header.ModifiedDate = uint16(modified.Day() + int(modified.Month())<<5 + (modified.Year()-1980)<<9)
+	header.ModifiedTime = uint16(modified.Second()/2 + modified.Minute()<<5 + modified.Hour()<<11)
+
+	// Extended timestamp, as Info-ZIP and CreateHeader record it
+	extra := make([]byte, 9)
+	binary.LittleEndian.PutUint16(extra[0:2], 0x5455)
+	binary.LittleEndian.PutUint16(extra[2:4], 5)
+	extra[4] = 1
+	binary.LittleEndian.PutUint32(extra[5:9], uint32(modified.Unix()))
+	header.Extra = extra
+
+	return header
+}
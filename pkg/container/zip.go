@@ -13,13 +13,22 @@ import (
 	"strings"
 	"time"
 
+	"github.com/liv-format/liv/pkg/atomicfile"
 	"github.com/liv-format/liv/pkg/core"
 )
 
+// ReproducibleTime is the modification time recorded for entries of
+// reproducible packages: the earliest time ZIP's MS-DOS date fields can hold
+var ReproducibleTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
 // ZIPContainer handles ZIP-based .liv file operations
 type ZIPContainer struct {
 	compressionLevel int
 	validateStructure bool
+	modified time.Time
+	workers int
+	filter func(relPath string) bool
+	backup bool
 }
 
 // NewZIPContainer creates a new ZIP container handler
@@ -36,72 +45,155 @@ func (zc *ZIPContainer) SetCompressionLevel(level int) *ZIPContainer {
 	return zc
 }
 
+// SetModified records the same modification time for every entry, so
+// packages of the same files are identical byte for byte. A zero time records
+// the current time, or the file's time for entries added from a directory.
+func (zc *ZIPContainer) SetModified(modified time.Time) *ZIPContainer {
+	zc.modified = modified
+	return zc
+}
+
+// SetWorkers sets how many entries are compressed at once (0 for GOMAXPROCS)
+func (zc *ZIPContainer) SetWorkers(workers int) *ZIPContainer {
+	zc.workers = workers
+	return zc
+}
+
+// SetFilter limits the files CreateFromDirectory packages to those for
+// which include returns true, given their path relative to the directory
+// with forward slashes. A nil filter packages every file.
+func (zc *ZIPContainer) SetFilter(include func(relPath string) bool) *ZIPContainer {
+	zc.filter = include
+	return zc
+}
+
+// SetBackup keeps the file a package replaces, with atomicfile.BackupSuffix
+// added to its name
+func (zc *ZIPContainer) SetBackup(keep bool) *ZIPContainer {
+	zc.backup = keep
+	return zc
+}
+
 // SetValidateStructure enables/disables structure validation
 func (zc *ZIPContainer) SetValidateStructure(validate bool) *ZIPContainer {
 	zc.validateStructure = validate
 	return zc
 }
 
-// CreateFromDirectory creates a .liv file from a directory structure
+// CreateFromDirectory creates a .liv file from a directory structure. The
+// package replaces outputPath only once it is complete and on disk.
 func (zc *ZIPContainer) CreateFromDirectory(sourceDir, outputPath string) error {
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	outFile, err := zc.createOutput(outputPath)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return err
 	}
 	defer outFile.Close()
 
+	// The output may be written inside the source directory: the package
+	// being written, the one it replaces and its backup are left out
+	var outputs []os.FileInfo
+	for _, name := range []string{outFile.Name(), outFile.Path(), outFile.Path() + atomicfile.BackupSuffix} {
+		if info, err := os.Stat(name); err == nil {
+			outputs = append(outputs, info)
+		}
+	}
+
 	// Create ZIP writer
 	zipWriter := zip.NewWriter(outFile)
-	defer zipWriter.Close()
 
 	// Set compression level
 	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
 		return flate.NewWriter(out, zc.compressionLevel)
 	})
 
-	// Walk directory and add files
-	return filepath.Walk(sourceDir, func(filePath string, info os.FileInfo, err error) error {
+	// Walk directory and collect files
+	var entries []*zipEntry
+	err = filepath.Walk(sourceDir, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories
-		if info.IsDir() {
+		// Skip directories, the package being written and writes a crash
+		// left behind
+		if info.IsDir() || atomicfile.IsTemp(filePath) {
 			return nil
 		}
+		for _, output := range outputs {
+			if os.SameFile(info, output) {
+				return nil
+			}
+		}
 
 		// Calculate relative path
 		relPath, err := filepath.Rel(sourceDir, filePath)
 		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
+			return fmt.Errorf("failed to get relative path: %w", err)
 		}
 
 		// Normalize path separators for ZIP format
 		relPath = filepath.ToSlash(relPath)
+		if zc.filter != nil && !zc.filter(relPath) {
+			return nil
+		}
 
-		// Add file to ZIP
-		return zc.addFileToZip(zipWriter, filePath, relPath)
+		entries = append(entries, &zipEntry{
+			name:       relPath,
+			sourcePath: filePath,
+			modified:   zc.modifiedTime(info.ModTime()),
+		})
+		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// Add files to ZIP, compressing them in parallel
+	if err := zc.writeEntries(zipWriter, entries); err != nil {
+		return err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish package: %w", err)
+	}
+	return zc.commitOutput(outFile)
 }
 
-// CreateFromFiles creates a .liv file from a map of file paths to content
+// CreateFromFiles creates a .liv file from a map of file paths to content.
+// The package replaces outputPath only once it is complete and on disk.
 func (zc *ZIPContainer) CreateFromFiles(files map[string][]byte, outputPath string) error {
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	outFile, err := zc.createOutput(outputPath)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return err
 	}
 	defer outFile.Close()
 
-	return zc.CreateFromFilesToWriter(files, outFile)
+	if err := zc.CreateFromFilesToWriter(files, outFile); err != nil {
+		return err
+	}
+	return zc.commitOutput(outFile)
+}
+
+// createOutput starts the package written to outputPath
+func (zc *ZIPContainer) createOutput(outputPath string) (*atomicfile.File, error) {
+	outFile, err := atomicfile.Create(outputPath, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	outFile.Backup = zc.backup
+	return outFile, nil
+}
+
+// commitOutput puts a finished package in place
+func (zc *ZIPContainer) commitOutput(outFile *atomicfile.File) error {
+	if err := outFile.Commit(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
 }
 
 // CreateFromFilesToWriter creates a .liv file and writes to an io.Writer
 func (zc *ZIPContainer) CreateFromFilesToWriter(files map[string][]byte, writer io.Writer) error {
 	// Create ZIP writer
 	zipWriter := zip.NewWriter(writer)
-	defer zipWriter.Close()
 
 	// Set compression level
 	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
@@ -111,42 +203,24 @@ func (zc *ZIPContainer) CreateFromFilesToWriter(files map[string][]byte, writer
 	// Validate structure if enabled
 	if zc.validateStructure {
 		if err := zc.validateFileStructure(files); err != nil {
-			return fmt.Errorf("structure validation failed: %v", err)
+			return fmt.Errorf("structure validation failed: %w", err)
 		}
 	}
 
-	// Add files to ZIP in a consistent order
+	// Add files to ZIP in a consistent order, compressing them in parallel
 	orderedPaths := zc.getOrderedPaths(files)
-	
+	entries := make([]*zipEntry, 0, len(orderedPaths))
+	modified := zc.modifiedTime(time.Now())
 	for _, path := range orderedPaths {
-		content := files[path]
-		
-		// Create ZIP file header
-		header := &zip.FileHeader{
-			Name:     path,
-			Method:   zip.Deflate,
-			Modified: time.Now(),
-		}
-		
-		// Set compression method based on file type
-		if zc.shouldCompress(path) {
-			header.Method = zip.Deflate
-		} else {
-			header.Method = zip.Store
-		}
-
-		// Create writer for this file
-		fileWriter, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return fmt.Errorf("failed to create ZIP entry for %s: %v", path, err)
-		}
-
-		// Write content
-		if _, err := fileWriter.Write(content); err != nil {
-			return fmt.Errorf("failed to write content for %s: %v", path, err)
-		}
+		entries = append(entries, &zipEntry{name: path, content: files[path], modified: modified})
 	}
 
+	if err := zc.writeEntries(zipWriter, entries); err != nil {
+		return err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish package: %w", err)
+	}
 	return nil
 }
 
@@ -155,7 +229,7 @@ func (zc *ZIPContainer) ExtractToDirectory(livPath, targetDir string) error {
 	// Open .liv file
 	reader, err := zip.OpenReader(livPath)
 	if err != nil {
-		return fmt.Errorf("failed to open .liv file: %v", err)
+		return fmt.Errorf("failed to open .liv file: %w", err)
 	}
 	defer reader.Close()
 
@@ -166,7 +240,7 @@ func (zc *ZIPContainer) ExtractToDirectory(livPath, targetDir string) error {
 func (zc *ZIPContainer) ExtractFromReader(reader io.ReaderAt, size int64, targetDir string) error {
 	zipReader, err := zip.NewReader(reader, size)
 	if err != nil {
-		return fmt.Errorf("failed to create ZIP reader: %v", err)
+		return fmt.Errorf("failed to create ZIP reader: %w", err)
 	}
 
 	return zc.extractZipToDirectory(zipReader, targetDir)
@@ -177,7 +251,7 @@ func (zc *ZIPContainer) ExtractToMemory(livPath string) (map[string][]byte, erro
 	// Open .liv file
 	reader, err := zip.OpenReader(livPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open .liv file: %v", err)
+		return nil, fmt.Errorf("failed to open .liv file: %w", err)
 	}
 	defer reader.Close()
 
@@ -188,7 +262,7 @@ func (zc *ZIPContainer) ExtractToMemory(livPath string) (map[string][]byte, erro
 func (zc *ZIPContainer) ExtractFromReaderToMemory(reader io.ReaderAt, size int64) (map[string][]byte, error) {
 	zipReader, err := zip.NewReader(reader, size)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create ZIP reader: %v", err)
+		return nil, fmt.Errorf("failed to create ZIP reader: %w", err)
 	}
 
 	return zc.extractZipToMemory(zipReader)
@@ -198,10 +272,9 @@ func (zc *ZIPContainer) ExtractFromReaderToMemory(reader io.ReaderAt, size int64
 func (zc *ZIPContainer) ValidateStructure(livPath string) *core.ValidationResult {
 	files, err := zc.ExtractToMemory(livPath)
 	if err != nil {
-		return &core.ValidationResult{
-			IsValid: false,
-			Errors:  []string{fmt.Sprintf("failed to extract file: %v", err)},
-		}
+		result := core.NewValidationResult()
+		result.AddError("package.unreadable", "", fmt.Sprintf("failed to extract file: %v", err))
+		return result
 	}
 
 	return zc.validateExtractedStructure(files)
@@ -216,7 +289,7 @@ func (zc *ZIPContainer) ValidateStructureFromMemory(files map[string][]byte) *co
 func (zc *ZIPContainer) GetFileList(livPath string) ([]string, error) {
 	reader, err := zip.OpenReader(livPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open .liv file: %v", err)
+		return nil, fmt.Errorf("failed to open .liv file: %w", err)
 	}
 	defer reader.Close()
 
@@ -234,7 +307,7 @@ func (zc *ZIPContainer) GetFileList(livPath string) ([]string, error) {
 func (zc *ZIPContainer) GetFileInfo(livPath string) (map[string]FileInfo, error) {
 	reader, err := zip.OpenReader(livPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open .liv file: %v", err)
+		return nil, fmt.Errorf("failed to open .liv file: %w", err)
 	}
 	defer reader.Close()
 
@@ -272,20 +345,20 @@ func (zc *ZIPContainer) addFileToZip(zipWriter *zip.Writer, filePath, zipPath st
 	// Open source file
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+		return fmt.Errorf("failed to open file %s: %w", filePath, err)
 	}
 	defer file.Close()
 
 	// Get file info
 	info, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to get file info for %s: %v", filePath, err)
+		return fmt.Errorf("failed to get file info for %s: %w", filePath, err)
 	}
 
 	// Create ZIP file header
 	header := &zip.FileHeader{
 		Name:     zipPath,
-		Modified: info.ModTime(),
+		Modified: zc.modifiedTime(info.ModTime()),
 	}
 
 	// Set compression method
@@ -298,12 +371,12 @@ func (zc *ZIPContainer) addFileToZip(zipWriter *zip.Writer, filePath, zipPath st
 	// Create writer for this file
 	fileWriter, err := zipWriter.CreateHeader(header)
 	if err != nil {
-		return fmt.Errorf("failed to create ZIP entry for %s: %v", zipPath, err)
+		return fmt.Errorf("failed to create ZIP entry for %s: %w", zipPath, err)
 	}
 
 	// Copy file content
 	if _, err := io.Copy(fileWriter, file); err != nil {
-		return fmt.Errorf("failed to write file %s to ZIP: %v", zipPath, err)
+		return fmt.Errorf("failed to write file %s to ZIP: %w", zipPath, err)
 	}
 
 	return nil
@@ -312,13 +385,13 @@ func (zc *ZIPContainer) addFileToZip(zipWriter *zip.Writer, filePath, zipPath st
 func (zc *ZIPContainer) extractZipToDirectory(zipReader *zip.Reader, targetDir string) error {
 	// Create target directory
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %v", err)
+		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
 	// Extract files
 	for _, file := range zipReader.File {
 		if err := zc.extractFile(file, targetDir); err != nil {
-			return fmt.Errorf("failed to extract file %s: %v", file.Name, err)
+			return fmt.Errorf("failed to extract file %s: %w", file.Name, err)
 		}
 	}
 
@@ -337,14 +410,14 @@ func (zc *ZIPContainer) extractZipToMemory(zipReader *zip.Reader) (map[string][]
 		// Open file in ZIP
 		reader, err := file.Open()
 		if err != nil {
-			return nil, fmt.Errorf("failed to open file %s in ZIP: %v", file.Name, err)
+			return nil, fmt.Errorf("failed to open file %s in ZIP: %w", file.Name, err)
 		}
 
 		// Read content
 		content, err := io.ReadAll(reader)
 		reader.Close()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read file %s: %v", file.Name, err)
+			return nil, fmt.Errorf("failed to read file %s: %w", file.Name, err)
 		}
 
 		files[file.Name] = content
@@ -369,26 +442,26 @@ func (zc *ZIPContainer) extractFile(file *zip.File, targetDir string) error {
 
 	// Create directory for file
 	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %v", err)
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	// Open file in ZIP
 	reader, err := file.Open()
 	if err != nil {
-		return fmt.Errorf("failed to open file in ZIP: %v", err)
+		return fmt.Errorf("failed to open file in ZIP: %w", err)
 	}
 	defer reader.Close()
 
 	// Create target file
 	outFile, err := os.Create(fullPath)
 	if err != nil {
-		return fmt.Errorf("failed to create target file: %v", err)
+		return fmt.Errorf("failed to create target file: %w", err)
 	}
 	defer outFile.Close()
 
 	// Copy content
 	if _, err := io.Copy(outFile, reader); err != nil {
-		return fmt.Errorf("failed to copy file content: %v", err)
+		return fmt.Errorf("failed to copy file content: %w", err)
 	}
 
 	// Set file modification time
@@ -412,7 +485,7 @@ func (zc *ZIPContainer) validateFileStructure(files map[string][]byte) error {
 	// Check required files
 	for _, required := range requiredFiles {
 		if _, exists := files[required]; !exists {
-			return fmt.Errorf("required file missing: %s", required)
+			return fmt.Errorf("required %w", &core.FileMissingError{Path: required})
 		}
 	}
 
@@ -433,7 +506,7 @@ func (zc *ZIPContainer) validateFileStructure(files map[string][]byte) error {
 	// Validate file paths
 	for path := range files {
 		if err := zc.validateFilePath(path); err != nil {
-			return fmt.Errorf("invalid file path %s: %v", path, err)
+			return fmt.Errorf("invalid file path %s: %w", path, err)
 		}
 	}
 
@@ -441,8 +514,7 @@ func (zc *ZIPContainer) validateFileStructure(files map[string][]byte) error {
 }
 
 func (zc *ZIPContainer) validateExtractedStructure(files map[string][]byte) *core.ValidationResult {
-	var errors []string
-	var warnings []string
+	result := core.NewValidationResult()
 
 	// Check for required files
 	requiredFiles := []string{
@@ -452,7 +524,7 @@ func (zc *ZIPContainer) validateExtractedStructure(files map[string][]byte) *cor
 
 	for _, required := range requiredFiles {
 		if _, exists := files[required]; !exists {
-			errors = append(errors, fmt.Sprintf("required file missing: %s", required))
+			result.AddError("package.required_file", required, fmt.Sprintf("required file missing: %s", required))
 		}
 	}
 
@@ -463,14 +535,15 @@ func (zc *ZIPContainer) validateExtractedStructure(files map[string][]byte) *cor
 
 	for _, recommended := range recommendedFiles {
 		if _, exists := files[recommended]; !exists {
-			warnings = append(warnings, fmt.Sprintf("recommended file missing: %s", recommended))
+			result.AddWarning("package.recommended_file", recommended, fmt.Sprintf("recommended file missing: %s", recommended)).
+				Suggestion = "add a static page for viewers that do not run scripts"
 		}
 	}
 
 	// Validate file paths
 	for path := range files {
 		if err := zc.validateFilePath(path); err != nil {
-			errors = append(errors, fmt.Sprintf("invalid file path %s: %v", path, err))
+			result.AddError("package.file_path", path, fmt.Sprintf("invalid file path %s: %v", path, err))
 		}
 	}
 
@@ -479,7 +552,7 @@ func (zc *ZIPContainer) validateExtractedStructure(files map[string][]byte) *cor
 	for path := range files {
 		for _, ext := range suspiciousExtensions {
 			if strings.HasSuffix(strings.ToLower(path), ext) {
-				warnings = append(warnings, fmt.Sprintf("suspicious file type: %s", path))
+				result.AddWarning("package.suspicious_file", path, fmt.Sprintf("suspicious file type: %s", path))
 			}
 		}
 	}
@@ -491,14 +564,10 @@ func (zc *ZIPContainer) validateExtractedStructure(files map[string][]byte) *cor
 	}
 
 	if totalSize > 100*1024*1024 { // 100MB
-		warnings = append(warnings, fmt.Sprintf("document is very large: %d bytes", totalSize))
+		result.AddWarning("package.large", "", fmt.Sprintf("document is very large: %d bytes", totalSize))
 	}
 
-	return &core.ValidationResult{
-		IsValid:  len(errors) == 0,
-		Errors:   errors,
-		Warnings: warnings,
-	}
+	return result
 }
 
 func (zc *ZIPContainer) validateFilePath(path string) error {
@@ -548,6 +617,14 @@ func (zc *ZIPContainer) shouldCompress(path string) bool {
 	return true
 }
 
+// modifiedTime returns the modification time to record for an entry
+func (zc *ZIPContainer) modifiedTime(fallback time.Time) time.Time {
+	if zc.modified.IsZero() {
+		return fallback
+	}
+	return zc.modified
+}
+
 func (zc *ZIPContainer) getOrderedPaths(files map[string][]byte) []string {
 	// Define priority order for files
 	priorityFiles := []string{
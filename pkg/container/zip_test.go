@@ -1,11 +1,13 @@
 package container
 
 import (
+	"archive/zip"
 	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestZIPContainer_CreateAndExtract(t *testing.T) {
@@ -172,6 +174,84 @@ func TestZIPContainer_CompressionSettings(t *testing.T) {
 	}
 }
 
+func TestZIPContainer_SetModified(t *testing.T) {
+	testFiles := map[string][]byte{
+		"manifest.json":      []byte(`{"version": "1.0", "title": "Test Document"}`),
+		"content/index.html": []byte("<h1>Hello</h1>"),
+		"assets/b.png":       []byte("PNG"),
+		"assets/a.css":       []byte("body {}"),
+	}
+
+	var first, second bytes.Buffer
+	if err := NewZIPContainer().SetModified(ReproducibleTime).CreateFromFilesToWriter(testFiles, &first); err != nil {
+		t.Fatalf("Failed to create ZIP: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if err := NewZIPContainer().SetModified(ReproducibleTime).CreateFromFilesToWriter(testFiles, &second); err != nil {
+		t.Fatalf("Failed to create ZIP: %v", err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Errorf("Expected packages of the same files to be identical")
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(first.Bytes()), int64(first.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range reader.File {
+		if !file.Modified.Equal(ReproducibleTime) {
+			t.Errorf("Expected %s to be recorded at %v, got %v", file.Name, ReproducibleTime, file.Modified)
+		}
+	}
+}
+
+func TestZIPContainer_ParallelCompression(t *testing.T) {
+	testFiles := map[string][]byte{
+		"manifest.json":      []byte(`{"version": "1.0", "title": "Test Document"}`),
+		"content/index.html": []byte(strings.Repeat("<p>Hello</p>", 500)),
+		"content/résumé.txt": []byte("naïve"),
+		"assets/photo.png":   []byte("PNG data"),
+		"assets/empty.css":   {},
+	}
+	for i := 0; i < 20; i++ {
+		testFiles[filepath.ToSlash(filepath.Join("assets", "data", string(rune('a'+i))+".json"))] = []byte(strings.Repeat(`{"value": 1}`, i*10))
+	}
+
+	var serial, parallel bytes.Buffer
+	if err := NewZIPContainer().SetWorkers(1).SetModified(ReproducibleTime).CreateFromFilesToWriter(testFiles, &serial); err != nil {
+		t.Fatalf("Failed to create ZIP: %v", err)
+	}
+	if err := NewZIPContainer().SetWorkers(8).SetModified(ReproducibleTime).CreateFromFilesToWriter(testFiles, &parallel); err != nil {
+		t.Fatalf("Failed to create ZIP: %v", err)
+	}
+	if !bytes.Equal(serial.Bytes(), parallel.Bytes()) {
+		t.Errorf("Expected the number of workers not to change the package")
+	}
+
+	files, err := NewZIPContainer().ExtractFromReaderToMemory(bytes.NewReader(parallel.Bytes()), int64(parallel.Len()))
+	if err != nil {
+		t.Fatalf("Failed to extract ZIP: %v", err)
+	}
+	for path, content := range testFiles {
+		if !bytes.Equal(files[path], content) {
+			t.Errorf("Content of %s was not preserved", path)
+		}
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(parallel.Bytes()), int64(parallel.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range reader.File {
+		if !file.Modified.Equal(ReproducibleTime) {
+			t.Errorf("Expected %s to be recorded at %v, got %v", file.Name, ReproducibleTime, file.Modified)
+		}
+		if file.Name == "content/résumé.txt" && file.Flags&0x800 == 0 {
+			t.Errorf("Expected the UTF-8 flag on %s", file.Name)
+		}
+	}
+}
+
 func TestZIPContainer_FileInfo(t *testing.T) {
 	container := NewZIPContainer()
 
@@ -292,6 +372,60 @@ func TestZIPContainer_DirectoryOperations(t *testing.T) {
 	}
 }
 
+func TestZIPContainer_AtomicOutput(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "document.liv")
+	original := []byte("original package")
+	if err := os.WriteFile(output, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed write leaves the existing package as it was
+	if err := NewZIPContainer().CreateFromFiles(map[string][]byte{"content/index.html": []byte("<p>")}, output); err == nil {
+		t.Fatal("Expected a package without a manifest to be refused")
+	}
+	if data, _ := os.ReadFile(output); !bytes.Equal(data, original) {
+		t.Fatalf("Expected the existing package kept, got %q", data)
+	}
+
+	files := map[string][]byte{
+		"manifest.json":      []byte(`{"version": "1.0"}`),
+		"content/index.html": []byte(`<html><body>Test</body></html>`),
+	}
+	if err := NewZIPContainer().SetBackup(true).CreateFromFiles(files, output); err != nil {
+		t.Fatalf("Failed to create package: %v", err)
+	}
+	if data, _ := os.ReadFile(output + ".bak"); !bytes.Equal(data, original) {
+		t.Errorf("Expected the replaced package backed up, got %q", data)
+	}
+
+	// Packaging a directory into itself leaves out the package, its backup
+	// and the temporary file of the write
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewZIPContainer().SetBackup(true).CreateFromDirectory(dir, output); err != nil {
+		t.Fatalf("Failed to create package from directory: %v", err)
+	}
+	list, err := NewZIPContainer().GetFileList(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(files) {
+		t.Errorf("Expected only the directory's files packaged, got %v", list)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("Expected no temporary file left, found %s", entry.Name())
+		}
+	}
+}
+
 func TestDeduplicateFiles(t *testing.T) {
 	// Create test files with duplicates
 	testFiles := map[string][]byte{
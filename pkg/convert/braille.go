@@ -0,0 +1,430 @@
+package convert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BRFOptions sets the page size of a braille ready file
+type BRFOptions struct {
+	// CellsPerLine defaults to 40 and LinesPerPage to 25, the page of most
+	// embossers
+	CellsPerLine int
+	LinesPerPage int
+}
+
+// brfBlock is a block of text to transcribe and how it is placed on the
+// page: its first line starts at cell first and the lines after it at cell
+// runover, counting from zero
+type brfBlock struct {
+	text    string
+	first   int
+	runover int
+	// heading is the level of a heading, which starts on a new line after a
+	// blank one and stays with the block after it
+	heading int
+	// verbatim blocks keep their line breaks
+	verbatim bool
+	// centred blocks are centred on the line
+	centred bool
+	// separator blocks are a line of dots 36 between sections
+	separator bool
+}
+
+// HTMLToBRF transcribes the text of an HTML document into uncontracted
+// Unified English Braille as a braille ready file (BRF): North American ASCII
+// braille with CR LF line endings and a form feed after each page. The last
+// line of each page carries the braille page number at the right margin.
+// Headings are centred (level 1) or start at cell 5, paragraphs start at cell
+// 3 and lists and quotes are indented, following the BANA formats. Images are
+// replaced by their alt text and tables are read row by row with their
+// headers.
+func HTMLToBRF(htmlContent string, opts BRFOptions) (string, error) {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	if opts.CellsPerLine <= 0 {
+		opts.CellsPerLine = 40
+	}
+	if opts.LinesPerPage <= 0 {
+		opts.LinesPerPage = 25
+	}
+	if opts.CellsPerLine < 20 || opts.LinesPerPage < 5 {
+		return "", fmt.Errorf("braille page of %d cells by %d lines is too small", opts.CellsPerLine, opts.LinesPerPage)
+	}
+
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	var blocks []brfBlock
+	brfBlocks(root, 0, &blocks)
+
+	p := &brfPager{opts: opts}
+	for i, block := range blocks {
+		var next *brfBlock
+		if i+1 < len(blocks) {
+			next = &blocks[i+1]
+		}
+		p.place(block, next)
+	}
+	return p.finish(), nil
+}
+
+// brfBlocks collects the blocks of the children of n, indented by indent
+// cells
+func brfBlocks(n *html.Node, indent int, blocks *[]brfBlock) {
+	var inline strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(collapseWhitespace(inline.String())); text != "" {
+			*blocks = append(*blocks, brfBlock{text: text, first: indent + 2, runover: indent})
+		}
+		inline.Reset()
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && skipped[child.DataAtom] {
+			continue
+		}
+		if !isBlock(child) {
+			brfInline(child, &inline)
+			continue
+		}
+		flush()
+		switch child.DataAtom {
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			var text strings.Builder
+			brfInline(child, &text)
+			level := int(child.Data[1] - '0')
+			block := brfBlock{text: strings.TrimSpace(collapseWhitespace(text.String())), first: 4, runover: 4, heading: level}
+			if level == 1 {
+				block.first, block.runover, block.centred = 0, 0, true
+			}
+			if block.text != "" {
+				*blocks = append(*blocks, block)
+			}
+		case atom.P:
+			var text strings.Builder
+			brfInline(child, &text)
+			if text := strings.TrimSpace(collapseWhitespace(text.String())); text != "" {
+				*blocks = append(*blocks, brfBlock{text: text, first: indent + 2, runover: indent})
+			}
+		case atom.Pre:
+			*blocks = append(*blocks, brfBlock{text: strings.Trim(textContent(child), "\n"), first: indent, runover: indent, verbatim: true})
+		case atom.Blockquote:
+			brfBlocks(child, indent+2, blocks)
+		case atom.Ul, atom.Ol:
+			brfList(child, indent, blocks)
+		case atom.Hr:
+			*blocks = append(*blocks, brfBlock{separator: true, centred: true})
+		case atom.Table:
+			brfTable(child, indent, blocks)
+		default:
+			brfBlocks(child, indent, blocks)
+		}
+	}
+	flush()
+}
+
+// brfList adds the items of a list. Items start at the list's indent and
+// their lines after the first are indented two cells; ordered items start
+// with their number.
+func brfList(n *html.Node, indent int, blocks *[]brfBlock) {
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		var items []brfBlock
+		brfBlocks(li, indent+2, &items)
+		marker := ""
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		for i, item := range items {
+			// The first paragraph of the item is its entry
+			if i == 0 && !item.verbatim {
+				item.text = marker + item.text
+				item.first, item.runover = indent, indent+2
+			}
+			*blocks = append(*blocks, item)
+		}
+	}
+}
+
+// brfTable adds each row of a table as an entry, its cells prefixed with the
+// headers of their columns
+func brfTable(n *html.Node, indent int, blocks *[]brfBlock) {
+	var headers []string
+	first := true
+	collectRows(n, func(tr *html.Node) {
+		var cells []string
+		allHeaders := true
+		for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type != html.ElementNode || (cell.DataAtom != atom.Th && cell.DataAtom != atom.Td) {
+				continue
+			}
+			var text strings.Builder
+			brfInline(cell, &text)
+			cells = append(cells, strings.TrimSpace(collapseWhitespace(text.String())))
+			allHeaders = allHeaders && cell.DataAtom == atom.Th
+		}
+		if len(cells) == 0 {
+			return
+		}
+		if first && allHeaders {
+			headers = cells
+			first = false
+			return
+		}
+		first = false
+		for i := range cells {
+			if i < len(headers) && headers[i] != "" {
+				cells[i] = headers[i] + ": " + cells[i]
+			}
+		}
+		*blocks = append(*blocks, brfBlock{text: strings.Join(cells, "; "), first: indent, runover: indent + 2})
+	})
+}
+
+// brfInline appends the text of inline content, with images as their alt
+// text
+func brfInline(n *html.Node, buf *strings.Builder) {
+	switch n.Type {
+	case html.TextNode:
+		buf.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if skipped[n.DataAtom] {
+		return
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		buf.WriteString(" ")
+		return
+	case atom.Img:
+		buf.WriteString(" " + attr(n, "alt") + " ")
+		return
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if isBlock(child) {
+			buf.WriteString(" ")
+		}
+		brfInline(child, buf)
+	}
+}
+
+// brfPager lays out transcribed lines on braille pages
+type brfPager struct {
+	opts  BRFOptions
+	pages []string
+	lines []string
+}
+
+// body is the number of lines of a page above the page number line
+func (p *brfPager) body() int {
+	return p.opts.LinesPerPage - 1
+}
+
+// place lays out a block, keeping a heading with the start of next
+func (p *brfPager) place(block brfBlock, next *brfBlock) {
+	width := p.opts.CellsPerLine
+	var lines []string
+	switch {
+	case block.separator:
+		lines = []string{strings.Repeat("-", 12)}
+	case block.verbatim:
+		for _, line := range strings.Split(block.text, "\n") {
+			lines = append(lines, wrapBraille(TranslateUEB(strings.TrimRight(line, " \t\r")), block.first, block.runover, width)...)
+		}
+	default:
+		lines = wrapBraille(TranslateUEB(block.text), block.first, block.runover, width)
+	}
+	if block.centred {
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			lines[i] = strings.Repeat(" ", max(0, (width-len(line))/2)) + line
+		}
+	}
+
+	if block.heading > 0 {
+		// A blank line separates headings from the text before them, and a
+		// heading moves to the next page rather than end one
+		if len(p.lines) > 0 {
+			p.lines = append(p.lines, "")
+		}
+		keep := len(lines) + 1
+		if next != nil && next.heading == 0 {
+			keep++
+		}
+		if len(p.lines)+keep > p.body() {
+			p.newPage()
+		}
+	}
+	for _, line := range lines {
+		if len(p.lines) >= p.body() {
+			p.newPage()
+		}
+		p.lines = append(p.lines, line)
+	}
+	if block.heading == 1 && len(p.lines) > 0 && len(p.lines) < p.body() {
+		p.lines = append(p.lines, "")
+	}
+}
+
+// newPage ends the current page with its number
+func (p *brfPager) newPage() {
+	for len(p.lines) > 0 && p.lines[len(p.lines)-1] == "" {
+		p.lines = p.lines[:len(p.lines)-1]
+	}
+	lines := p.lines
+	for len(lines) < p.body() {
+		lines = append(lines, "")
+	}
+	number := TranslateUEB(strconv.Itoa(len(p.pages) + 1))
+	lines = append(lines, strings.Repeat(" ", p.opts.CellsPerLine-len(number))+number)
+	p.pages = append(p.pages, strings.Join(lines, "\r\n")+"\r\n\f")
+	p.lines = nil
+}
+
+// finish ends the last page and returns the file
+func (p *brfPager) finish() string {
+	if len(p.lines) > 0 || len(p.pages) == 0 {
+		p.newPage()
+	}
+	return strings.Join(p.pages, "")
+}
+
+// wrapBraille breaks braille text into lines of width cells, the first
+// starting at cell first and the others at cell runover. Words longer than
+// a line are divided with a hyphen.
+func wrapBraille(text string, first, runover, width int) []string {
+	var lines []string
+	line := strings.Repeat(" ", first)
+	empty := true
+	for _, word := range strings.Fields(text) {
+		for {
+			room := width - len(line)
+			if !empty {
+				room--
+			}
+			if len(word) <= room {
+				if !empty {
+					line += " "
+				}
+				line += word
+				empty = false
+				break
+			}
+			if empty && room > 1 {
+				// The word does not fit on a whole line
+				line += word[:room-1] + "-"
+				word = word[room-1:]
+			}
+			lines = append(lines, line)
+			line = strings.Repeat(" ", runover)
+			empty = true
+		}
+	}
+	if !empty {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// uebSymbols are the North American ASCII braille of punctuation and signs
+// in Unified English Braille
+var uebSymbols = map[rune]string{
+	',': "1", ';': "2", ':': "3", '.': "4", '!': "6", '?': "8", '\'': "'", '-': "-",
+	'(': `"<`, ')': `">`, '[': ".<", ']': ".>", '{': "_<", '}': "_>",
+	'/': "_/", '\\': "_*", '&': "@&", '@': "@A", '%': ".0", '$': "@S",
+	'*': `"9`, '+': `"6`, '=': `"7`, '#': "_?", '<': "@<", '>': "@>",
+	'_': ".-", '~': "@9", '^': "@5", '|': `_\`, '`': "@?",
+	'–': ",-", '—': `",-`, '…': "444", '“': "8", '”': "0", '‘': ",8", '’': "'",
+	'£': "@L", '€': "@E", '¢': "@C", '°': "^J", '©': "^C", '×': `"8`, '÷': `"/`,
+}
+
+// uebDigits are the letters a to j, which are the digits 1 to 9 and 0 after
+// the numeric indicator
+const uebDigits = "JABCDEFGHI"
+
+// TranslateUEB transcribes text into uncontracted Unified English Braille in
+// North American ASCII braille. Accents are dropped from letters and
+// characters without a braille sign are left out.
+func TranslateUEB(text string) string {
+	runes := []rune(norm.NFD.String(text))
+	var b strings.Builder
+	numeric := false
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case unicode.Is(unicode.Mn, c):
+			continue
+		case c >= '0' && c <= '9':
+			if !numeric {
+				b.WriteByte('#')
+				numeric = true
+			}
+			b.WriteByte(uebDigits[c-'0'])
+			continue
+		case numeric && (c == '.' || c == ',') && i+1 < len(runes) && runes[i+1] >= '0' && runes[i+1] <= '9':
+			// Decimal points and digit group separators continue the number
+			b.WriteString(uebSymbols[c])
+			continue
+		}
+
+		wasNumeric := numeric
+		numeric = false
+		switch {
+		case c < unicode.MaxASCII && unicode.IsLetter(c):
+			// A run of two or more capitals takes the capitalised word
+			// indicator, other capitals the capital letter indicator
+			j := i
+			for j < len(runes) && runes[j] < unicode.MaxASCII && unicode.IsLetter(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if j-i > 1 && word == strings.ToUpper(word) {
+				b.WriteString(",," + word)
+			} else {
+				for k, letter := range word {
+					if unicode.IsUpper(letter) {
+						b.WriteByte(',')
+					} else if k == 0 && wasNumeric && letter <= 'j' {
+						// The grade 1 indicator stops letters a to j being
+						// read as digits
+						b.WriteByte(';')
+					}
+					b.WriteRune(unicode.ToUpper(letter))
+				}
+			}
+			i = j - 1
+		case unicode.IsSpace(c):
+			b.WriteByte(' ')
+		case c == '"':
+			// Straight quotes open at the start of a word and close after one
+			if i == 0 || unicode.IsSpace(runes[i-1]) || strings.ContainsRune("([{", runes[i-1]) {
+				b.WriteString("8")
+			} else {
+				b.WriteString("0")
+			}
+		default:
+			b.WriteString(uebSymbols[c])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,384 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	source := "# Guide\n\n" +
+		"Some *emphasis with **strong** inside* and a [link](https://example.com/a_b).\n\n" +
+		"1. one\n2. two\n   - nested\n\n" +
+		"| Name | Value |\n|:-----|------:|\n| a | 1 |\n\n" +
+		"```go\nx := a * b * c\n```\n\n" +
+		"~~gone~~ and 2 * 3 * 4\n"
+
+	rendered, err := MarkdownToHTML([]byte(source))
+	if err != nil {
+		t.Fatalf("MarkdownToHTML failed: %v", err)
+	}
+	html := string(rendered)
+
+	expected := []string{
+		`<h1 id="guide">Guide</h1>`,
+		`<em>emphasis with <strong>strong</strong> inside</em>`,
+		`<a href="https://example.com/a_b">link</a>`,
+		"<ol>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul>\n</li>\n</ol>",
+		`<th style="text-align:left">Name</th>`,
+		`<td style="text-align:right">1</td>`,
+		"<pre><code class=\"language-go\">x := a * b * c\n</code></pre>",
+		"<del>gone</del> and 2 * 3 * 4",
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(html, fragment) {
+			t.Errorf("Expected HTML to contain %q, got:\n%s", fragment, html)
+		}
+	}
+}
+
+func TestMarkdownTitle(t *testing.T) {
+	tests := map[string]string{
+		"# Simple title\n\nBody":                  "Simple title",
+		"Intro\n\n## Section\n\n# The *real* one": "The real one",
+		"Setext title\n============\n":            "Setext title",
+		"# Uses `code`":                           "Uses code",
+		"No headings here":                        "",
+	}
+	for source, expected := range tests {
+		if title := MarkdownTitle([]byte(source)); title != expected {
+			t.Errorf("MarkdownTitle(%q) = %q, expected %q", source, title, expected)
+		}
+	}
+}
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "headings and emphasis",
+			html:     "<h2>Hello <em>there</em></h2><p>Some <em>nested <strong>strong</strong></em> text</p>",
+			expected: "## Hello *there*\n\nSome *nested **strong*** text\n",
+		},
+		{
+			name:     "links and images",
+			html:     `<p><a href="https://example.com" title="Home">site</a>, <a href="https://go.dev">https://go.dev</a> and <img src="a b.png" alt="pic"></p>`,
+			expected: "[site](https://example.com \"Home\"), <https://go.dev> and ![pic](<a b.png>)\n",
+		},
+		{
+			name:     "nested lists",
+			html:     "<ol start=\"3\"><li>three<ul><li>child</li></ul></li><li>four</li></ol>",
+			expected: "3. three\n   - child\n4. four\n",
+		},
+		{
+			name:     "loose list",
+			html:     "<ul><li><p>first</p></li><li><p>second</p></li></ul>",
+			expected: "- first\n\n- second\n",
+		},
+		{
+			name:     "task list",
+			html:     `<ul><li><input type="checkbox" checked disabled> done</li><li><input type="checkbox" disabled> todo</li></ul>`,
+			expected: "- [x] done\n- [ ] todo\n",
+		},
+		{
+			name:     "table",
+			html:     `<table><thead><tr><th align="left">Name</th><th style="text-align: right">Value</th></tr></thead><tbody><tr><td>a | b</td><td><code>x</code></td></tr><tr><td>c</td></tr></tbody></table>`,
+			expected: "| Name | Value |\n| :--- | ---: |\n| a \\| b | `x` |\n| c |  |\n",
+		},
+		{
+			name:     "code block",
+			html:     "<pre><code class=\"language-go\">fmt.Println(\"```\")\n</code></pre>",
+			expected: "````go\nfmt.Println(\"```\")\n````\n",
+		},
+		{
+			name:     "blockquote",
+			html:     "<blockquote><p>quoted</p><ul><li>item</li></ul></blockquote>",
+			expected: "> quoted\n>\n> - item\n",
+		},
+		{
+			name:     "escaping",
+			html:     "<p>1. not a list, *not emphasis* and [not a link]</p><p># not a heading</p>",
+			expected: "1\\. not a list, \\*not emphasis\\* and \\[not a link\\]\n\n\\# not a heading\n",
+		},
+		{
+			name:     "document",
+			html:     "<html><head><title>Ignored</title><style>p{}</style></head><body><div>Loose text<br>after break<script>alert(1)</script></div><hr><p>End</p></body></html>",
+			expected: "Loose text\\\nafter break\n\n---\n\nEnd\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			markdown, err := HTMLToMarkdown(test.html)
+			if err != nil {
+				t.Fatalf("HTMLToMarkdown failed: %v", err)
+			}
+			if markdown != test.expected {
+				t.Errorf("Expected:\n%q\ngot:\n%q", test.expected, markdown)
+			}
+		})
+	}
+}
+
+func TestHTMLToMarkdownBlocks(t *testing.T) {
+	var blocks []string
+	stop := errors.New("stop")
+	err := HTMLToMarkdownBlocks("<h1>Title</h1><div><p>One</p>loose <em>text</em></div><p>Two</p><p>Three</p>", func(block string) error {
+		if len(blocks) == 3 {
+			return stop
+		}
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("Expected the error of emit, got %v", err)
+	}
+	expected := []string{"# Title", "One", "loose *text*"}
+	if strings.Join(blocks, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected blocks %q, got %q", expected, blocks)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	source := "# Title\n\n" +
+		"Text with *emphasis*, **strong**, `code` and a [link](https://example.com).\n\n" +
+		"- one\n- two\n  1. nested\n  2. list\n\n" +
+		"> quote\n\n" +
+		"| A | B |\n| :---: | --- |\n| 1 | 2 |\n\n" +
+		"```js\nconst a = `b`;\n```\n"
+
+	first, err := MarkdownToHTML([]byte(source))
+	if err != nil {
+		t.Fatalf("MarkdownToHTML failed: %v", err)
+	}
+	markdown, err := HTMLToMarkdown(string(first))
+	if err != nil {
+		t.Fatalf("HTMLToMarkdown failed: %v", err)
+	}
+	second, err := MarkdownToHTML([]byte(markdown))
+	if err != nil {
+		t.Fatalf("MarkdownToHTML failed: %v", err)
+	}
+
+	if string(first) != string(second) {
+		t.Errorf("Round trip changed the document.\nMarkdown:\n%s\nBefore:\n%s\nAfter:\n%s", markdown, first, second)
+	}
+}
+
+func TestTranslateUEB(t *testing.T) {
+	tests := map[string]string{
+		"Hello World":        ",HELLO ,WORLD",
+		"NASA rocks":         ",,NASA ROCKS",
+		"page 12":            "PAGE #AB",
+		"3.5 kg, 1,000 g":    "#C4E KG1 #A1JJJ G",
+		"4a or 4th":          "#D;A OR #DTH",
+		`She said "hi" (ok)`: `,SHE SAID 8HI0 "<OK">`,
+		"café":               "CAFE",
+	}
+	for text, expected := range tests {
+		if braille := TranslateUEB(text); braille != expected {
+			t.Errorf("TranslateUEB(%q) = %q, expected %q", text, braille, expected)
+		}
+	}
+}
+
+func TestHTMLToBRF(t *testing.T) {
+	source := "<h1>Annual Report</h1><p>" + strings.Repeat("word ", 30) + "</p>" +
+		"<ul><li>first</li><li>second</li></ul>" +
+		"<table><tr><th>Year</th><th>Total</th></tr><tr><td>2024</td><td>7</td></tr></table>" +
+		`<p><img src="chart.png" alt="Sales chart"></p>`
+
+	brf, err := HTMLToBRF(source, BRFOptions{})
+	if err != nil {
+		t.Fatalf("HTMLToBRF failed: %v", err)
+	}
+	pages := strings.Split(strings.TrimSuffix(brf, "\f"), "\f")
+	if len(pages) != 1 {
+		t.Fatalf("Expected 1 page, got %d", len(pages))
+	}
+	lines := strings.Split(strings.TrimSuffix(pages[0], "\r\n"), "\r\n")
+	if len(lines) != 25 {
+		t.Fatalf("Expected 25 lines, got %d", len(lines))
+	}
+	for i, line := range lines {
+		if len(line) > 40 {
+			t.Errorf("Line %d is %d cells long", i+1, len(line))
+		}
+	}
+	expected := []string{
+		"            ,ANNUAL ,REPORT",
+		"",
+		"  WORD WORD WORD WORD WORD WORD WORD",
+		"WORD WORD WORD WORD WORD WORD WORD WORD",
+	}
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("Line %d = %q, expected %q", i+1, lines[i], line)
+		}
+	}
+	for _, fragment := range []string{"\r\nFIRST\r\n", "\r\nSECOND\r\n", ",YEAR3 #BJBD2 ,TOTAL3 #G", "  ,SALES CHART\r\n"} {
+		if !strings.Contains(brf, fragment) {
+			t.Errorf("Expected BRF to contain %q, got:\n%s", fragment, brf)
+		}
+	}
+	if lines[24] != strings.Repeat(" ", 38)+"#A" {
+		t.Errorf("Expected the page number on the last line, got %q", lines[24])
+	}
+
+	long := strings.Repeat("<h2>Section</h2><p>Text</p>", 20)
+	brf, err = HTMLToBRF(long, BRFOptions{CellsPerLine: 30, LinesPerPage: 10})
+	if err != nil {
+		t.Fatalf("HTMLToBRF failed: %v", err)
+	}
+	for i, page := range strings.Split(strings.TrimSuffix(brf, "\f"), "\f") {
+		lines := strings.Split(strings.TrimSuffix(page, "\r\n"), "\r\n")
+		if len(lines) != 10 {
+			t.Errorf("Page %d has %d lines", i+1, len(lines))
+		}
+		if body := strings.TrimSpace(strings.Join(lines[:9], "\n")); strings.HasSuffix(body, ",SECTION") {
+			t.Errorf("Page %d ends with a heading:\n%s", i+1, page)
+		}
+	}
+
+	if _, err := HTMLToBRF("<p>x</p>", BRFOptions{CellsPerLine: 10}); err == nil {
+		t.Error("Expected a page too small to be refused")
+	}
+}
+
+// toneSpeaker speaks each text as silence of 10ms per character in 8kHz
+// 8-bit mono WAV
+type toneSpeaker struct{ spoken []string }
+
+func (s *toneSpeaker) Speak(text string) ([]byte, error) {
+	s.spoken = append(s.spoken, text)
+	audio := &wavAudio{
+		format: []byte{1, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x40, 0x1f, 0, 0, 1, 0, 8, 0},
+		data:   make([]byte, 80*len(text)),
+	}
+	return audio.bytes(), nil
+}
+
+func TestSegmentNarration(t *testing.T) {
+	source := `<h1>Guide</h1><p id="liv-n1">Intro <img src="a.png" alt="with a map"></p>` +
+		`<script>alert(1)</script><ul><li>One</li><li><p>Two</p></li></ul>` +
+		`<h2 id="setup">Setup</h2><table><tr><th>Step</th></tr></table><div></div>`
+
+	n, err := SegmentNarration(source)
+	if err != nil {
+		t.Fatalf("SegmentNarration failed: %v", err)
+	}
+	var got []string
+	for _, s := range n.Segments {
+		got = append(got, s.ID+"="+s.Text)
+	}
+	expected := "liv-n2=Guide|liv-n1=Intro with a map|liv-n3=One|liv-n4=Two|setup=Setup|liv-n5=Step"
+	if strings.Join(got, "|") != expected {
+		t.Errorf("Segments = %q, expected %q", strings.Join(got, "|"), expected)
+	}
+	if len(n.Outline) != 2 || n.Outline[0].Level != 1 || n.Outline[1].ID != "setup" || n.Outline[1].Level != 2 {
+		t.Errorf("Unexpected outline %+v", n.Outline)
+	}
+	if !strings.Contains(n.Body, `<h1 id="liv-n2">Guide</h1>`) || !strings.Contains(n.Body, `<img src="a.png" alt="with a map"/>`) || strings.Contains(n.Body, "script") {
+		t.Errorf("Unexpected XHTML body %s", n.Body)
+	}
+}
+
+func TestSpeakNarration(t *testing.T) {
+	n, err := SegmentNarration("<h1>Title</h1><p>A paragraph</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	speaker := &toneSpeaker{}
+	overlay, err := SpeakNarration(n, speaker, "content.xhtml")
+	if err != nil {
+		t.Fatalf("SpeakNarration failed: %v", err)
+	}
+	if len(speaker.spoken) != 2 {
+		t.Errorf("Expected 2 segments spoken, got %q", speaker.spoken)
+	}
+	audio, err := parseWAV(overlay.Audio[NarrationAudio])
+	if err != nil || len(audio.data) != 80*16 {
+		t.Fatalf("Expected the speech joined into one WAV file, got %v", err)
+	}
+	if overlay.Duration != 160*time.Millisecond || FormatClock(overlay.Duration) != "0:00:00.160" {
+		t.Errorf("Unexpected duration %v", overlay.Duration)
+	}
+	for _, fragment := range []string{
+		`<text src="content.xhtml#liv-n1"/>`,
+		`<audio src="audio/narration.wav" clipBegin="0.000s" clipEnd="0.050s"/>`,
+		`<audio src="audio/narration.wav" clipBegin="0.050s" clipEnd="0.160s"/>`,
+	} {
+		if !bytes.Contains(overlay.SMIL, []byte(fragment)) {
+			t.Errorf("Expected SMIL to contain %q, got:\n%s", fragment, overlay.SMIL)
+		}
+	}
+}
+
+func TestScriptedNarration(t *testing.T) {
+	n, err := SegmentNarration(`<h1 id="title">Title</h1><p id="body">Text</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordings := map[string][]byte{"assets/audio/read.mp3": []byte("mp3")}
+	audio := func(path string) ([]byte, bool) {
+		data, exists := recordings[path]
+		return data, exists
+	}
+
+	script := NarrationScript{Audio: "assets/audio/read.mp3", Clips: []NarrationClip{
+		{ID: "body", Begin: 2, End: 5.5},
+		{ID: "title", Begin: 0, End: 2},
+	}}
+	overlay, err := ScriptedNarration(n, script, audio, "content.xhtml")
+	if err != nil {
+		t.Fatalf("ScriptedNarration failed: %v", err)
+	}
+	if string(overlay.Audio["audio/audio/read.mp3"]) != "mp3" || overlay.Duration != 5500*time.Millisecond {
+		t.Errorf("Unexpected overlay audio %v and duration %v", overlay.Audio, overlay.Duration)
+	}
+	if title, body := bytes.Index(overlay.SMIL, []byte("#title")), bytes.Index(overlay.SMIL, []byte("#body")); title < 0 || body < title {
+		t.Errorf("Expected clips in reading order, got:\n%s", overlay.SMIL)
+	}
+
+	for _, clip := range []NarrationClip{
+		{ID: "missing", Begin: 0, End: 1},
+		{ID: "title", Begin: 3, End: 1},
+		{ID: "title", Audio: "assets/audio/none.mp3", Begin: 0, End: 1},
+	} {
+		if _, err := ScriptedNarration(n, NarrationScript{Audio: script.Audio, Clips: []NarrationClip{clip}}, audio, "content.xhtml"); err == nil {
+			t.Errorf("Expected clip %+v to be refused", clip)
+		}
+	}
+}
+
+func TestExtensionsRoundTrip(t *testing.T) {
+	extensions := map[string]json.RawMessage{"com.example.records": json.RawMessage(`{"note":"<b>\"quoted\"</b> & more"}`)}
+	embedded, err := EmbedExtensions("<html><head><title>T</title></head><body><p>Hi</p></body></html>", extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(embedded, `<meta name="liv-extensions"`) || strings.Contains(embedded, "<b>") {
+		t.Errorf("Expected an escaped meta element, got %s", embedded)
+	}
+	got, err := ExtractExtensions(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record struct{ Note string }
+	if json.Unmarshal(got["com.example.records"], &record); record.Note != `<b>"quoted"</b> & more` {
+		t.Errorf("Expected the extensions back, got %s", got["com.example.records"])
+	}
+
+	if got, err := ExtractExtensions("<p>No extensions</p>"); err != nil || got != nil {
+		t.Errorf("Expected no extensions, got %v %v", got, err)
+	}
+	if _, err := ExtractExtensions(`<meta name="liv-extensions" content="{broken">`); err == nil {
+		t.Error("Expected malformed extensions to be reported")
+	}
+}
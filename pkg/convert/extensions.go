@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ExtensionsMetaName names the meta element carrying the manifest extensions
+// of a document exported as HTML, so they survive a round trip back to LIV
+const ExtensionsMetaName = "liv-extensions"
+
+// EmbedExtensions adds the manifest extensions of a document to its HTML as a
+// meta element in the head, as ExtractExtensions reads them back
+func EmbedExtensions(htmlContent string, extensions map[string]json.RawMessage) (string, error) {
+	if len(extensions) == 0 {
+		return htmlContent, nil
+	}
+	data, err := json.Marshal(extensions)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize extensions: %v", err)
+	}
+	meta := fmt.Sprintf(`<meta name="%s" content="%s">`, ExtensionsMetaName, template.HTMLEscapeString(string(data)))
+	if headEnd := strings.Index(strings.ToLower(htmlContent), "</head>"); headEnd != -1 {
+		return htmlContent[:headEnd] + meta + "\n" + htmlContent[headEnd:], nil
+	}
+	return meta + "\n" + htmlContent, nil
+}
+
+// ExtractExtensions returns the manifest extensions embedded in HTML by
+// EmbedExtensions, or nil when it has none
+func ExtractExtensions(htmlContent string) (map[string]json.RawMessage, error) {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	var content string
+	var found bool
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if found {
+			return
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Meta && attr(n, "name") == ExtensionsMetaName {
+			content, found = attr(n, "content"), true
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	if !found {
+		return nil, nil
+	}
+	var extensions map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &extensions); err != nil {
+		return nil, fmt.Errorf("invalid %s meta element: %v", ExtensionsMetaName, err)
+	}
+	return extensions, nil
+}
@@ -0,0 +1,570 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToMarkdown converts an HTML document or fragment to CommonMark with GitHub
+// Flavored Markdown tables, strikethrough and task lists. Only the body is
+// converted; scripts, styles and other non-content elements are dropped.
+func HTMLToMarkdown(htmlContent string) (string, error) {
+	var blocks []string
+	err := HTMLToMarkdownBlocks(htmlContent, func(block string) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != nil || len(blocks) == 0 {
+		return "", err
+	}
+	return strings.Join(blocks, "\n\n") + "\n", nil
+}
+
+// HTMLToMarkdownBlocks converts like HTMLToMarkdown, passing each Markdown
+// block to emit as soon as it is rendered, so callers can keep what was
+// converted when they stop early. Blocks are separated by a blank line.
+// Conversion stops at the first error of emit, which is returned.
+func HTMLToMarkdownBlocks(htmlContent string, emit func(block string) error) error {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	return walkBlocks(root, emit)
+}
+
+// skipped elements carry no document content
+var skipped = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Title: true, atom.Meta: true, atom.Link: true,
+	atom.Button: true, atom.Select: true, atom.Textarea: true, atom.Iframe: true,
+	atom.Object: true, atom.Embed: true, atom.Canvas: true, atom.Svg: true,
+}
+
+// containers are block elements whose children are rendered as separate blocks
+var containers = map[atom.Atom]bool{
+	atom.Html: true, atom.Body: true, atom.Div: true, atom.Section: true,
+	atom.Article: true, atom.Main: true, atom.Header: true, atom.Footer: true,
+	atom.Nav: true, atom.Aside: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Details: true, atom.Summary: true, atom.Dl: true, atom.Dt: true,
+	atom.Dd: true, atom.Address: true, atom.Form: true, atom.Fieldset: true,
+	atom.Center: true, atom.Li: true,
+}
+
+// blockElements start a new Markdown block
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Pre: true, atom.Blockquote: true,
+	atom.Ul: true, atom.Ol: true, atom.Hr: true, atom.Table: true,
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && (blockElements[n.DataAtom] || containers[n.DataAtom])
+}
+
+// renderBlocks renders the children of n as a list of Markdown blocks
+func renderBlocks(n *html.Node) []string {
+	var blocks []string
+	walkBlocks(n, func(block string) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	return blocks
+}
+
+// walkBlocks renders the children of n as Markdown blocks, passing each to
+// emit. Runs of inline content between block elements become paragraphs.
+func walkBlocks(n *html.Node, emit func(block string) error) error {
+	var inline strings.Builder
+
+	flush := func() error {
+		paragraph := formatParagraph(inline.String())
+		inline.Reset()
+		if paragraph == "" {
+			return nil
+		}
+		return emit(paragraph)
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && skipped[child.DataAtom] {
+			continue
+		}
+		if !isBlock(child) {
+			renderInline(child, &inline, false)
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if containers[child.DataAtom] {
+			if err := walkBlocks(child, emit); err != nil {
+				return err
+			}
+		} else if block := renderBlock(child); block != "" {
+			if err := emit(block); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// renderBlock renders a single block-level element
+func renderBlock(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		content := formatParagraph(strings.ReplaceAll(renderInlineChildren(n, false), "\\\n", " "))
+		if content == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + content
+	case atom.P:
+		return formatParagraph(renderInlineChildren(n, false))
+	case atom.Pre:
+		return renderCodeBlock(n)
+	case atom.Blockquote:
+		return prefixLines(strings.Join(renderBlocks(n), "\n\n"), "> ", ">")
+	case atom.Ul, atom.Ol:
+		return renderList(n)
+	case atom.Hr:
+		return "---"
+	case atom.Table:
+		return renderTable(n)
+	}
+	return strings.Join(renderBlocks(n), "\n\n")
+}
+
+// renderCodeBlock renders a pre element as a fenced code block, taking the
+// language from a language-* or lang-* class on the pre or its code element
+func renderCodeBlock(n *html.Node) string {
+	language := codeLanguage(n)
+	if code := firstElementChild(n); code != nil && code.DataAtom == atom.Code {
+		if lang := codeLanguage(code); lang != "" {
+			language = lang
+		}
+	}
+
+	content := strings.TrimSuffix(textContent(n), "\n")
+	fence := strings.Repeat("`", max(3, longestRun(content, '`')+1))
+	return fence + language + "\n" + content + "\n" + fence
+}
+
+func codeLanguage(n *html.Node) string {
+	for _, class := range strings.Fields(attr(n, "class")) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if strings.HasPrefix(class, prefix) {
+				return strings.TrimPrefix(class, prefix)
+			}
+		}
+	}
+	return ""
+}
+
+// renderList renders a ul or ol element. Lists whose items contain paragraphs are
+// rendered loose, with blank lines between items, as CommonMark would parse them.
+func renderList(n *html.Node) string {
+	ordered := n.DataAtom == atom.Ol
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil && ordered {
+		number = start
+	}
+
+	var items []string
+	loose := false
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+
+		separator := "\n"
+		if findElement(li, atom.P) != nil {
+			separator = "\n\n"
+			loose = true
+		}
+		content := strings.Join(renderBlocks(li), separator)
+
+		indent := strings.Repeat(" ", len(marker))
+		items = append(items, marker+prefixLines(content, indent, "")[len(indent):])
+	}
+
+	if loose {
+		return strings.Join(items, "\n\n")
+	}
+	return strings.Join(items, "\n")
+}
+
+// renderTable renders a table as a GitHub Flavored Markdown table. The first row
+// becomes the header row, which GFM requires.
+func renderTable(n *html.Node) string {
+	var rows [][]string
+	var alignments []string
+	collectRows(n, func(tr *html.Node) {
+		var cells []string
+		for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type != html.ElementNode || (cell.DataAtom != atom.Th && cell.DataAtom != atom.Td) {
+				continue
+			}
+			if len(rows) == 0 {
+				alignments = append(alignments, cellAlignment(cell))
+			}
+			content := formatParagraph(renderInlineChildren(cell, true))
+			cells = append(cells, strings.ReplaceAll(content, "\n", " "))
+		}
+		rows = append(rows, cells)
+	})
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return ""
+	}
+
+	var lines []string
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+
+		if i == 0 {
+			delimiters := make([]string, columns)
+			for column := range delimiters {
+				alignment := ""
+				if column < len(alignments) {
+					alignment = alignments[column]
+				}
+				switch alignment {
+				case "left":
+					delimiters[column] = ":---"
+				case "center":
+					delimiters[column] = ":---:"
+				case "right":
+					delimiters[column] = "---:"
+				default:
+					delimiters[column] = "---"
+				}
+			}
+			lines = append(lines, "| "+strings.Join(delimiters, " | ")+" |")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// collectRows visits the rows of a table in document order without descending
+// into nested tables
+func collectRows(n *html.Node, visit func(*html.Node)) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		switch child.DataAtom {
+		case atom.Tr:
+			visit(child)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			collectRows(child, visit)
+		}
+	}
+}
+
+var textAlignPattern = regexp.MustCompile(`text-align\s*:\s*(left|center|right)`)
+
+func cellAlignment(cell *html.Node) string {
+	if align := strings.ToLower(attr(cell, "align")); align != "" {
+		return align
+	}
+	if match := textAlignPattern.FindStringSubmatch(strings.ToLower(attr(cell, "style"))); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func renderInlineChildren(n *html.Node, inTable bool) string {
+	var buf strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		renderInline(child, &buf, inTable)
+	}
+	return buf.String()
+}
+
+// renderInline renders phrasing content. Block elements nested inside inline
+// content are flattened to their text.
+func renderInline(n *html.Node, buf *strings.Builder, inTable bool) {
+	switch n.Type {
+	case html.TextNode:
+		text := collapseWhitespace(n.Data)
+		if strings.HasPrefix(text, " ") && strings.HasSuffix(buf.String(), " ") {
+			text = text[1:]
+		}
+		buf.WriteString(escapeText(text, inTable))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if skipped[n.DataAtom] {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Strong, atom.B:
+		wrapInline(buf, "**", renderInlineChildren(n, inTable))
+	case atom.Em, atom.I, atom.Cite, atom.Var:
+		wrapInline(buf, "*", renderInlineChildren(n, inTable))
+	case atom.Del, atom.S, atom.Strike:
+		wrapInline(buf, "~~", renderInlineChildren(n, inTable))
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		buf.WriteString(codeSpan(collapseWhitespace(textContent(n)), inTable))
+	case atom.A:
+		renderLink(n, buf, inTable)
+	case atom.Img:
+		src := attr(n, "src")
+		if src == "" {
+			return
+		}
+		buf.WriteString("![" + escapeText(attr(n, "alt"), inTable) + "](" + linkDestination(src) + linkTitle(attr(n, "title")) + ")")
+	case atom.Br:
+		if inTable {
+			buf.WriteString(" ")
+		} else {
+			buf.WriteString("\\\n")
+		}
+	case atom.Input:
+		if strings.EqualFold(attr(n, "type"), "checkbox") {
+			if hasAttr(n, "checked") {
+				buf.WriteString("[x] ")
+			} else {
+				buf.WriteString("[ ] ")
+			}
+		}
+	default:
+		if isBlock(n) {
+			buf.WriteString(" ")
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				renderInline(child, buf, inTable)
+			}
+			buf.WriteString(" ")
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			renderInline(child, buf, inTable)
+		}
+	}
+}
+
+func renderLink(n *html.Node, buf *strings.Builder, inTable bool) {
+	content := strings.TrimSpace(renderInlineChildren(n, inTable))
+	href, hasHref := attrValue(n, "href")
+	if !hasHref {
+		buf.WriteString(content)
+		return
+	}
+	if content == "" {
+		content = escapeText(href, inTable)
+	}
+
+	// Bare URLs are written as autolinks
+	title := attr(n, "title")
+	if title == "" && textContent(n) == href && strings.Contains(href, "://") && !strings.ContainsAny(href, " <>") {
+		buf.WriteString("<" + href + ">")
+		return
+	}
+
+	buf.WriteString("[" + content + "](" + linkDestination(href) + linkTitle(title) + ")")
+}
+
+// wrapInline surrounds content with an emphasis delimiter, keeping surrounding
+// whitespace outside the delimiters so CommonMark still recognizes them
+func wrapInline(buf *strings.Builder, delimiter, content string) {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		buf.WriteString(content)
+		return
+	}
+	if strings.HasPrefix(content, " ") {
+		buf.WriteString(" ")
+	}
+	buf.WriteString(delimiter + trimmed + delimiter)
+	if strings.HasSuffix(content, " ") {
+		buf.WriteString(" ")
+	}
+}
+
+// codeSpan wraps text in a backtick fence longer than any backtick run it contains
+func codeSpan(content string, inTable bool) string {
+	if content == "" {
+		return ""
+	}
+	if inTable {
+		content = strings.ReplaceAll(content, "|", "\\|")
+	}
+	fence := strings.Repeat("`", longestRun(content, '`')+1)
+	if strings.HasPrefix(content, "`") || strings.HasSuffix(content, "`") {
+		content = " " + content + " "
+	}
+	return fence + content + fence
+}
+
+func linkDestination(href string) string {
+	if href == "" || strings.ContainsAny(href, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(href) + ">"
+	}
+	return href
+}
+
+func linkTitle(title string) string {
+	if title == "" {
+		return ""
+	}
+	return ` "` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(title) + `"`
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`,
+	"<", `\<`, "~", `\~`,
+)
+
+// escapeText escapes characters that would otherwise be read as inline Markdown
+func escapeText(text string, inTable bool) string {
+	text = markdownEscaper.Replace(text)
+	if inTable {
+		text = strings.ReplaceAll(text, "|", `\|`)
+	}
+	return text
+}
+
+var (
+	whitespacePattern = regexp.MustCompile(`[ \t\r\n\f]+`)
+	// lineStartPattern matches text that would start a heading, quote, list,
+	// thematic break or setext underline when it begins a line
+	lineStartPattern = regexp.MustCompile(`^(#{1,6}(?:\s|$)|>|[-+=](?:\s|$)|-{3,}|={2,}|\d+[.)](?:\s|$))`)
+)
+
+func collapseWhitespace(text string) string {
+	return whitespacePattern.ReplaceAllString(text, " ")
+}
+
+// formatParagraph trims inline content, drops hard breaks at its edges and
+// escapes line starts that would be parsed as block syntax
+func formatParagraph(content string) string {
+	raw := strings.Split(content, "\n")
+	lines := make([]string, 0, len(raw))
+	for i, line := range raw {
+		line = strings.TrimSpace(line)
+		if i < len(raw)-1 {
+			line = strings.TrimSpace(strings.TrimSuffix(line, `\`))
+		}
+		if line == "" {
+			continue
+		}
+		if match := lineStartPattern.FindString(line); match != "" {
+			if first := match[0]; first >= '0' && first <= '9' {
+				digits := strings.TrimRight(match, ".) \t")
+				line = digits + `\` + line[len(digits):]
+			} else {
+				line = `\` + line
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\\\n")
+}
+
+// prefixLines prefixes every line of text, using blank for empty lines
+func prefixLines(text, prefix, blank string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = blank
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func longestRun(text string, c rune) int {
+	longest, current := 0, 0
+	for _, r := range text {
+		if r == c {
+			current++
+			longest = max(longest, current)
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var buf strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		buf.WriteString(textContent(child))
+	}
+	return buf.String()
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func firstElementChild(n *html.Node) *html.Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			return child
+		}
+	}
+	return nil
+}
+
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attr(n *html.Node, key string) string {
+	value, _ := attrValue(n, key)
+	return value
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	_, exists := attrValue(n, key)
+	return exists
+}
@@ -0,0 +1,71 @@
+// Package convert translates document content between Markdown and HTML.
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown is a CommonMark parser and renderer with the GitHub Flavored Markdown
+// extensions (tables, strikethrough, autolinks and task lists). Raw HTML is passed
+// through as CommonMark requires; imported documents run in the viewer sandbox.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// MarkdownToHTML renders Markdown source as an HTML fragment
+func MarkdownToHTML(source []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(source, &buf); err != nil {
+		return nil, fmt.Errorf("failed to render markdown: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// MarkdownTitle returns the plain text of the first level-one heading in Markdown
+// source, or an empty string if there is none
+func MarkdownTitle(source []byte) string {
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	var title string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering && heading.Level == 1 {
+			title = strings.TrimSpace(plainText(heading, source))
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return title
+}
+
+// plainText concatenates the text content of a Markdown node
+func plainText(n ast.Node, source []byte) string {
+	var buf strings.Builder
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := child.(type) {
+		case *ast.Text:
+			buf.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
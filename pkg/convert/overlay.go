@@ -0,0 +1,454 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// NarrationScriptPath is where a document keeps the timings of its own
+// narration recordings
+const NarrationScriptPath = "assets/narration.json"
+
+// NarrationAudio is the audio file of synthesised narration, relative to the
+// package document
+const NarrationAudio = "audio/narration.wav"
+
+// DefaultSpeechCommand speaks with eSpeak NG. {lang} is replaced by the
+// document language and {output} by the WAV file to write
+var DefaultSpeechCommand = []string{"espeak-ng", "-v", "{lang}", "-w", "{output}", "--stdin"}
+
+// Narration is a document marked up for reading aloud: every block of text
+// has an ID that a media overlay can synchronise audio with
+type Narration struct {
+	// Body is the document body as XHTML, with IDs added where blocks had
+	// none
+	Body     string
+	Segments []NarrationSegment
+	// Outline lists the headings in reading order, for navigation
+	Outline []NarrationSegment
+	// order is the reading position of every element ID in the body
+	order map[string]int
+}
+
+// NarrationSegment is a block of text read as one clip. Level is the
+// heading level of headings and 0 for other blocks.
+type NarrationSegment struct {
+	ID    string
+	Text  string
+	Level int
+}
+
+// NarrationScript times a document's own narration recordings against its
+// content. Each clip plays Begin to End seconds of Audio (or of the script's
+// Audio when the clip names none) while the element with ID is shown.
+type NarrationScript struct {
+	Audio string          `json:"audio,omitempty"`
+	Clips []NarrationClip `json:"clips"`
+}
+
+// NarrationClip is one timed stretch of a narration recording
+type NarrationClip struct {
+	ID    string  `json:"id"`
+	Audio string  `json:"audio,omitempty"`
+	Begin float64 `json:"begin"`
+	End   float64 `json:"end"`
+}
+
+// MediaOverlay is an EPUB 3 media overlay: a SMIL document playing audio
+// clips in step with the elements of a content document
+type MediaOverlay struct {
+	SMIL []byte
+	// Audio holds the audio files by their path relative to the package
+	// document
+	Audio map[string][]byte
+	// Duration is the total length of the clips
+	Duration time.Duration
+}
+
+// Speaker turns text into speech, returned as a WAV file
+type Speaker interface {
+	Speak(text string) ([]byte, error)
+}
+
+// CommandSpeaker speaks text with a text-to-speech program, which is given
+// the text on its standard input. In Command, {lang} is replaced by Language
+// (English when empty) and {output} by a file for the program to write the
+// WAV audio to; without {output} the audio is read from its standard output.
+type CommandSpeaker struct {
+	Command  []string
+	Language string
+}
+
+// Speak runs the speech program for text
+func (s CommandSpeaker) Speak(text string) ([]byte, error) {
+	if len(s.Command) == 0 {
+		return nil, fmt.Errorf("no speech command")
+	}
+	language := s.Language
+	if language == "" {
+		language = "en"
+	}
+
+	var output string
+	args := make([]string, len(s.Command))
+	for i, arg := range s.Command {
+		if strings.Contains(arg, "{output}") && output == "" {
+			file, err := os.CreateTemp("", "liv-speech-*.wav")
+			if err != nil {
+				return nil, fmt.Errorf("failed to create speech file: %v", err)
+			}
+			file.Close()
+			output = file.Name()
+			defer os.Remove(output)
+		}
+		arg = strings.ReplaceAll(arg, "{lang}", language)
+		args[i] = strings.ReplaceAll(arg, "{output}", output)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("speech command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if output == "" {
+		return stdout.Bytes(), nil
+	}
+	audio, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speech: %v", err)
+	}
+	return audio, nil
+}
+
+// narratedElements are read as a block of their own unless they hold blocks
+var narratedElements = map[atom.Atom]bool{
+	atom.Td: true, atom.Th: true, atom.Caption: true,
+}
+
+// SegmentNarration splits the body of an HTML document into the blocks of
+// text it is read aloud in: headings, paragraphs, list items, table cells
+// and other blocks holding no further blocks. Blocks without an ID are given
+// one. Scripts are dropped, as media overlays play in reading systems
+// without them.
+func SegmentNarration(htmlContent string) (*Narration, error) {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	removeElements(root, atom.Script)
+
+	n := &Narration{}
+	var visit func(*html.Node)
+	visit = func(node *html.Node) {
+		if node.Type != html.ElementNode {
+			return
+		}
+		if id := attr(node, "id"); id != "" {
+			if _, seen := n.order[id]; !seen {
+				n.order[id] = len(n.order)
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	n.order = make(map[string]int)
+	visit(root)
+
+	next := 0
+	var segment func(*html.Node)
+	segment = func(node *html.Node) {
+		if node.Type != html.ElementNode || skipped[node.DataAtom] {
+			return
+		}
+		if node != root && narrationBlock(node) && !holdsBlocks(node) {
+			text := strings.TrimSpace(collapseWhitespace(narrationText(node)))
+			if text == "" {
+				return
+			}
+			id := attr(node, "id")
+			if id == "" {
+				for id == "" || n.hasID(id) {
+					next++
+					id = "liv-n" + strconv.Itoa(next)
+				}
+				node.Attr = append(node.Attr, html.Attribute{Key: "id", Val: id})
+				n.order[id] = len(n.order)
+			}
+			s := NarrationSegment{ID: id, Text: text}
+			switch node.DataAtom {
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				s.Level = int(node.Data[1] - '0')
+				n.Outline = append(n.Outline, s)
+			}
+			n.Segments = append(n.Segments, s)
+			return
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			segment(child)
+		}
+	}
+	segment(root)
+	// Number the IDs again to put those added in reading order
+	n.order = make(map[string]int)
+	visit(root)
+
+	var body strings.Builder
+	for child := root.FirstChild; child != nil; child = child.NextSibling {
+		if err := html.Render(&body, child); err != nil {
+			return nil, fmt.Errorf("failed to render XHTML: %v", err)
+		}
+	}
+	n.Body = body.String()
+	return n, nil
+}
+
+func (n *Narration) hasID(id string) bool {
+	_, exists := n.order[id]
+	return exists
+}
+
+func narrationBlock(n *html.Node) bool {
+	return isBlock(n) || narratedElements[n.DataAtom]
+}
+
+func holdsBlocks(n *html.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || skipped[child.DataAtom] {
+			continue
+		}
+		if narrationBlock(child) || holdsBlocks(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// narrationText is the text of n as read aloud, with images read by their
+// alt text
+func narrationText(n *html.Node) string {
+	switch {
+	case n.Type == html.TextNode:
+		return n.Data
+	case n.Type != html.ElementNode:
+		return ""
+	case skipped[n.DataAtom]:
+		return ""
+	case n.DataAtom == atom.Img:
+		return " " + attr(n, "alt") + " "
+	case n.DataAtom == atom.Br:
+		return " "
+	}
+	var buf strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		buf.WriteString(narrationText(child))
+	}
+	return buf.String()
+}
+
+func removeElements(n *html.Node, a atom.Atom) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && child.DataAtom == a {
+			n.RemoveChild(child)
+		} else {
+			removeElements(child, a)
+		}
+		child = next
+	}
+}
+
+// SpeakNarration narrates every segment with speaker and joins the speech
+// into one WAV file, NarrationAudio, played by a media overlay for the
+// content document at textHref
+func SpeakNarration(n *Narration, speaker Speaker, textHref string) (*MediaOverlay, error) {
+	if len(n.Segments) == 0 {
+		return nil, fmt.Errorf("document has no text to narrate")
+	}
+
+	var joined *wavAudio
+	clips := make([]NarrationClip, 0, len(n.Segments))
+	for _, s := range n.Segments {
+		data, err := speaker.Speak(s.Text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to narrate %s: %v", s.ID, err)
+		}
+		speech, err := parseWAV(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to narrate %s: %v", s.ID, err)
+		}
+		if joined == nil {
+			joined = &wavAudio{format: speech.format}
+		} else if !bytes.Equal(joined.format, speech.format) {
+			return nil, fmt.Errorf("failed to narrate %s: speech changed audio format", s.ID)
+		}
+		begin := joined.seconds()
+		joined.data = append(joined.data, speech.data...)
+		clips = append(clips, NarrationClip{ID: s.ID, Audio: NarrationAudio, Begin: begin, End: joined.seconds()})
+	}
+
+	overlay := &MediaOverlay{Audio: map[string][]byte{NarrationAudio: joined.bytes()}}
+	overlay.SMIL, overlay.Duration = overlaySMIL(clips, textHref)
+	return overlay, nil
+}
+
+// ScriptedNarration makes a media overlay from a document's own narration
+// recordings, timed by script. Clips are played in reading order and must
+// name elements of the content; audio returns a recording by its path in
+// the document. Recordings are placed under audio/ in the package.
+func ScriptedNarration(n *Narration, script NarrationScript, audio func(path string) ([]byte, bool), textHref string) (*MediaOverlay, error) {
+	if len(script.Clips) == 0 {
+		return nil, fmt.Errorf("narration script has no clips")
+	}
+
+	overlay := &MediaOverlay{Audio: make(map[string][]byte)}
+	clips := make([]NarrationClip, len(script.Clips))
+	for i, clip := range script.Clips {
+		if !n.hasID(clip.ID) {
+			return nil, fmt.Errorf("narration clip %d: no element with ID %q", i+1, clip.ID)
+		}
+		if clip.Begin < 0 || clip.End <= clip.Begin {
+			return nil, fmt.Errorf("narration clip %d: invalid timing %g to %g", i+1, clip.Begin, clip.End)
+		}
+		source := clip.Audio
+		if source == "" {
+			source = script.Audio
+		}
+		if source == "" {
+			return nil, fmt.Errorf("narration clip %d: no audio", i+1)
+		}
+		href := "audio/" + path.Clean(strings.TrimPrefix(source, "assets/"))
+		if _, added := overlay.Audio[href]; !added {
+			data, exists := audio(source)
+			if !exists {
+				return nil, fmt.Errorf("narration clip %d: audio %s not found", i+1, source)
+			}
+			overlay.Audio[href] = data
+		}
+		clip.Audio = href
+		clips[i] = clip
+	}
+	sort.SliceStable(clips, func(i, j int) bool {
+		return n.order[clips[i].ID] < n.order[clips[j].ID]
+	})
+
+	overlay.SMIL, overlay.Duration = overlaySMIL(clips, textHref)
+	return overlay, nil
+}
+
+// overlaySMIL writes the SMIL document playing clips in order
+func overlaySMIL(clips []NarrationClip, textHref string) ([]byte, time.Duration) {
+	var buf bytes.Buffer
+	var total float64
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<smil xmlns="http://www.w3.org/ns/SMIL" xmlns:epub="http://www.idpf.org/2007/ops" version="3.0">
+    <body>
+        <seq id="seq1" epub:textref="` + html.EscapeString(textHref) + `" epub:type="bodymatter">
+`)
+	for i, clip := range clips {
+		fmt.Fprintf(&buf, `            <par id="par%d">
+                <text src="%s#%s"/>
+                <audio src="%s" clipBegin="%.3fs" clipEnd="%.3fs"/>
+            </par>
+`, i+1, html.EscapeString(textHref), html.EscapeString(clip.ID), html.EscapeString(clip.Audio), clip.Begin, clip.End)
+		total += clip.End - clip.Begin
+	}
+	buf.WriteString(`        </seq>
+    </body>
+</smil>
+`)
+	return buf.Bytes(), time.Duration(total * float64(time.Second))
+}
+
+// FormatClock writes a duration as a SMIL clock value, as media:duration
+// metadata needs
+func FormatClock(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	return fmt.Sprintf("%d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
+
+// wavAudio is the format chunk and sample data of a WAV file
+type wavAudio struct {
+	format []byte
+	data   []byte
+}
+
+// parseWAV reads a RIFF WAV file. A data chunk claiming more than the file
+// holds, as streaming encoders write, is taken to run to the end.
+func parseWAV(data []byte) (*wavAudio, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("speech is not WAV audio")
+	}
+	audio := &wavAudio{}
+	for rest := data[12:]; len(rest) >= 8; {
+		id, size := string(rest[0:4]), int(binary.LittleEndian.Uint32(rest[4:8]))
+		rest = rest[8:]
+		if size < 0 || size > len(rest) {
+			size = len(rest)
+		}
+		switch id {
+		case "fmt ":
+			audio.format = rest[:size]
+		case "data":
+			audio.data = rest[:size]
+		}
+		if audio.format != nil && audio.data != nil {
+			break
+		}
+		rest = rest[min(size+size%2, len(rest)):]
+	}
+	if len(audio.format) < 16 || audio.data == nil {
+		return nil, fmt.Errorf("speech WAV audio has no samples")
+	}
+	if audio.byteRate() == 0 {
+		return nil, fmt.Errorf("speech WAV audio has no byte rate")
+	}
+	// Samples are copied as later speech is appended to them
+	audio.data = append([]byte(nil), audio.data...)
+	return audio, nil
+}
+
+func (a *wavAudio) byteRate() int {
+	return int(binary.LittleEndian.Uint32(a.format[8:12]))
+}
+
+func (a *wavAudio) seconds() float64 {
+	return float64(len(a.data)) / float64(a.byteRate())
+}
+
+func (a *wavAudio) bytes() []byte {
+	var buf bytes.Buffer
+	size := 4 + 8 + len(a.format) + len(a.format)%2 + 8 + len(a.data) + len(a.data)%2
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(size))
+	buf.WriteString("WAVE")
+	for _, chunk := range []struct {
+		id   string
+		data []byte
+	}{{"fmt ", a.format}, {"data", a.data}} {
+		buf.WriteString(chunk.id)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(chunk.data)))
+		buf.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of error callers branch on, with errors.Is. The packages reading,
+// verifying and checking documents wrap them with the details.
+var (
+	// ErrManifestMissing is a package without a manifest.json
+	ErrManifestMissing = errors.New("manifest.json not found")
+	// ErrManifestInvalid is a manifest that is not valid JSON or fails
+	// validation
+	ErrManifestInvalid = errors.New("manifest validation failed")
+	// ErrFileMissing is a file a package or its manifest should have
+	ErrFileMissing = errors.New("file not found")
+	// ErrHashMismatch is a file that does not match its manifest hash; the
+	// errors are *HashMismatchError
+	ErrHashMismatch = errors.New("hash mismatch")
+	// ErrSignatureInvalid is a signature that does not verify
+	ErrSignatureInvalid = errors.New("signature is invalid")
+	// ErrPolicyDenied is an operation a security or signature policy forbids
+	ErrPolicyDenied = errors.New("denied by policy")
+)
+
+// HashMismatchError is a file whose content does not match the hash its
+// manifest lists. It is ErrHashMismatch to errors.Is.
+type HashMismatchError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("%s does not match its manifest hash", e.Path)
+}
+
+// Is reports ErrHashMismatch as the kind of the error
+func (e *HashMismatchError) Is(target error) bool {
+	return target == ErrHashMismatch
+}
+
+// FileMissingError is a file a package lacks. It is ErrFileMissing to
+// errors.Is, and ErrManifestMissing too when the file is the manifest.
+type FileMissingError struct {
+	Path string
+}
+
+func (e *FileMissingError) Error() string {
+	return "file not found: " + e.Path
+}
+
+// Is reports ErrFileMissing, or ErrManifestMissing, as the kind of the error
+func (e *FileMissingError) Is(target error) bool {
+	return target == ErrFileMissing || (target == ErrManifestMissing && e.Path == "manifest.json")
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultClockSkew is how far the clocks of the machine that made a document
+// and the machine checking it may disagree before a time is taken to be in
+// the future, or a certificate to be outside its validity period
+const DefaultClockSkew = 5 * time.Minute
+
+// UTC returns t as manifests record times: in UTC, to the second, so they
+// are written as RFC 3339 times ending in Z whatever the local time zone
+func UTC(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// NormalizeTimes puts the created and modified times of the metadata in UTC,
+// to the second. Signed manifests must not be normalized, as the signature
+// covers the times as written.
+func (m *DocumentMetadata) NormalizeTimes() {
+	m.Created = UTC(m.Created)
+	m.Modified = UTC(m.Modified)
+}
+
+// InFuture reports whether t is later than now by more than skew
+func InFuture(t, now time.Time, skew time.Duration) bool {
+	return t.After(now.Add(skew))
+}
+
+// FutureTime describes a time that is later than now by more than skew, or
+// returns "" for one that is not
+func FutureTime(what string, t, now time.Time, skew time.Duration) string {
+	if t.IsZero() || !InFuture(t, now, skew) {
+		return ""
+	}
+	return fmt.Sprintf("%s %s is %s ahead of this clock", what, t.UTC().Format(time.RFC3339), t.Sub(now).Round(time.Second))
+}
+
+// HasUTCOffset reports whether t was recorded with an offset from UTC, as
+// in 2025-01-01T10:00:00+02:00
+func HasUTCOffset(t time.Time) bool {
+	_, offset := t.Zone()
+	return offset != 0
+}
@@ -3,6 +3,9 @@ package core
 import (
 	"encoding/json"
 	"fmt"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,6 +26,206 @@ type DocumentContent struct {
 	StaticFallback  string `json:"static_fallback"`
 }
 
+// ActivitySpec is the activity section of an interactive spec. Viewers pause
+// a document's animations, media and timers while it is hidden or the device
+// is low on battery; the spec lists what keeps running regardless.
+type ActivitySpec struct {
+	// KeepRunning lists CSS selectors of components that keep animating
+	// and playing, such as live clocks or progress indicators
+	KeepRunning []string `json:"keep_running,omitempty"`
+	// KeepTimers leaves the document's timers and animation frames running
+	KeepTimers bool `json:"keep_timers,omitempty"`
+}
+
+// ParseActivitySpec reads the activity section of an interactive spec.
+// Specs that are scripts rather than JSON, or have no activity section, get
+// an empty section: everything pauses.
+func ParseActivitySpec(spec []byte) (*ActivitySpec, error) {
+	var parsed struct {
+		Activity *ActivitySpec `json:"activity"`
+	}
+	trimmed := strings.TrimSpace(string(spec))
+	if !strings.HasPrefix(trimmed, "{") {
+		return &ActivitySpec{}, nil
+	}
+	if err := json.Unmarshal([]byte(trimmed), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid interactive spec: %w", err)
+	}
+	if parsed.Activity == nil {
+		return &ActivitySpec{}, nil
+	}
+	for _, selector := range parsed.Activity.KeepRunning {
+		if strings.TrimSpace(selector) == "" {
+			return nil, fmt.Errorf("invalid interactive spec: empty keep_running selector")
+		}
+	}
+	return parsed.Activity, nil
+}
+
+// Degradation paths of a WebGL document, taken when the device's graphics
+// fall short of its graphics section
+const (
+	// GraphicsFallbackCanvas2D runs the document with WebGL unavailable, so
+	// that it draws with a 2D canvas instead
+	GraphicsFallbackCanvas2D = "canvas2d"
+	// GraphicsFallbackSnapshot shows the spec's snapshot image, or the static
+	// version of the document without one
+	GraphicsFallbackSnapshot = "snapshot"
+)
+
+// GraphicsSpec is the graphics section of an interactive spec. Viewers probe
+// the device's WebGL support when a WebGL document opens and take the
+// declared degradation path when it falls short.
+type GraphicsSpec struct {
+	// WebGL2 requires WebGL 2 rather than WebGL 1
+	WebGL2 bool `json:"webgl2,omitempty"`
+	// Extensions lists WebGL extensions the document needs
+	Extensions []string `json:"extensions,omitempty"`
+	// MinTextureSize is the smallest MAX_TEXTURE_SIZE the document works with
+	MinTextureSize int `json:"min_texture_size,omitempty"`
+	// AllowSoftware accepts software rendering, which viewers otherwise
+	// treat as no WebGL
+	AllowSoftware bool `json:"allow_software,omitempty"`
+	// Fallback is the degradation path; snapshot when unset
+	Fallback string `json:"fallback,omitempty"`
+	// Snapshot is the package path of the image the snapshot path shows
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+// ParseGraphicsSpec reads the graphics section of an interactive spec. Specs
+// that are scripts rather than JSON, or have no graphics section, get an
+// empty section: any WebGL will do, and the static version is the fallback.
+func ParseGraphicsSpec(spec []byte) (*GraphicsSpec, error) {
+	var parsed struct {
+		Graphics *GraphicsSpec `json:"graphics"`
+	}
+	trimmed := strings.TrimSpace(string(spec))
+	if !strings.HasPrefix(trimmed, "{") {
+		return &GraphicsSpec{}, nil
+	}
+	if err := json.Unmarshal([]byte(trimmed), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid interactive spec: %w", err)
+	}
+	graphics := parsed.Graphics
+	if graphics == nil {
+		return &GraphicsSpec{}, nil
+	}
+	switch graphics.Fallback {
+	case "", GraphicsFallbackCanvas2D, GraphicsFallbackSnapshot:
+	default:
+		return nil, fmt.Errorf("invalid interactive spec: unknown graphics fallback %q", graphics.Fallback)
+	}
+	if graphics.MinTextureSize < 0 {
+		return nil, fmt.Errorf("invalid interactive spec: negative min_texture_size")
+	}
+	for _, extension := range graphics.Extensions {
+		if strings.TrimSpace(extension) == "" {
+			return nil, fmt.Errorf("invalid interactive spec: empty graphics extension")
+		}
+	}
+	if graphics.Snapshot != "" {
+		clean := path.Clean(graphics.Snapshot)
+		if clean != graphics.Snapshot || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("invalid interactive spec: snapshot %q is not a package path", graphics.Snapshot)
+		}
+	}
+	return graphics, nil
+}
+
+// EventsSpec is the events section of an interactive spec: the sessions,
+// deadlines or performances of a programme or schedule. Viewers show them as
+// a timeline and export them as an iCalendar file.
+type EventsSpec struct {
+	// Name names the calendar, such as the conference or season
+	Name  string  `json:"name,omitempty"`
+	Items []Event `json:"items"`
+}
+
+// Event is an entry of the events section. Start and End are RFC 3339 times,
+// or dates for all-day events, whose End is their last day. Without End,
+// timed events are a moment and all-day events last a day.
+type Event struct {
+	// ID identifies the event across versions of the document, so calendars
+	// update it rather than add it again; event-<n> by position when unset
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Start       string `json:"start"`
+	End         string `json:"end,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+// eventDate is the layout of the start and end of all-day events
+const eventDate = "2006-01-02"
+
+// Span returns when an event starts and ends. The end of all-day events is
+// exclusive: midnight UTC after their last day.
+func (e *Event) Span() (start, end time.Time, allDay bool, err error) {
+	if start, err = time.Parse(eventDate, e.Start); err == nil {
+		allDay = true
+	} else if start, err = time.Parse(time.RFC3339, e.Start); err != nil {
+		return start, end, false, fmt.Errorf("start %q is neither an RFC 3339 time nor a date", e.Start)
+	}
+
+	switch {
+	case e.End == "" && allDay:
+		end = start.AddDate(0, 0, 1)
+	case e.End == "":
+		end = start
+	case allDay:
+		if end, err = time.Parse(eventDate, e.End); err != nil {
+			return start, end, allDay, fmt.Errorf("end %q of an all-day event is not a date", e.End)
+		}
+		end = end.AddDate(0, 0, 1)
+	default:
+		if end, err = time.Parse(time.RFC3339, e.End); err != nil {
+			return start, end, allDay, fmt.Errorf("end %q is not an RFC 3339 time", e.End)
+		}
+	}
+	if end.Before(start) || (allDay && !end.After(start)) {
+		return start, end, allDay, fmt.Errorf("ends before it starts")
+	}
+	return start, end, allDay, nil
+}
+
+// ParseEventsSpec reads the events section of an interactive spec. Specs that
+// are scripts rather than JSON, or have no events section, have no events.
+func ParseEventsSpec(spec []byte) (*EventsSpec, error) {
+	var parsed struct {
+		Events *EventsSpec `json:"events"`
+	}
+	trimmed := strings.TrimSpace(string(spec))
+	if !strings.HasPrefix(trimmed, "{") {
+		return &EventsSpec{}, nil
+	}
+	if err := json.Unmarshal([]byte(trimmed), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid interactive spec: %w", err)
+	}
+	events := parsed.Events
+	if events == nil {
+		return &EventsSpec{}, nil
+	}
+	ids := make(map[string]bool)
+	for i := range events.Items {
+		event := &events.Items[i]
+		if event.ID == "" {
+			event.ID = "event-" + strconv.Itoa(i+1)
+		}
+		if ids[event.ID] {
+			return nil, fmt.Errorf("invalid interactive spec: duplicate event ID %q", event.ID)
+		}
+		ids[event.ID] = true
+		if strings.TrimSpace(event.Title) == "" {
+			return nil, fmt.Errorf("invalid interactive spec: event %s has no title", event.ID)
+		}
+		if _, _, _, err := event.Span(); err != nil {
+			return nil, fmt.Errorf("invalid interactive spec: event %s %w", event.ID, err)
+		}
+	}
+	return events, nil
+}
+
 // AssetBundle contains all document assets
 type AssetBundle struct {
 	Images map[string][]byte `json:"images"`
@@ -35,6 +238,54 @@ type SignatureBundle struct {
 	ContentSignature  string            `json:"content_signature"`
 	ManifestSignature string            `json:"manifest_signature"`
 	WASMSignatures    map[string]string `json:"wasm_signatures"`
+	// Algorithm is the signature algorithm; empty for RSA-SHA256 signatures
+	// made before it was recorded
+	Algorithm string `json:"algorithm,omitempty"`
+	// Timestamp is an RFC 3161 timestamp token over the signatures, proving
+	// they were made before the signing certificate expired
+	Timestamp []byte `json:"timestamp,omitempty"`
+	// Signer describes the first signer, who made the signatures above
+	Signer *SignerInfo `json:"signer,omitempty"`
+	// CounterSignatures are the signatures of further signers, such as
+	// approvers, in the order they signed
+	CounterSignatures []*CounterSignature `json:"counter_signatures,omitempty"`
+}
+
+// SignerInfo describes who signed a document
+type SignerInfo struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	// Role is what the signature stands for, such as author or approver
+	Role string `json:"role,omitempty"`
+	// KeyID is the fingerprint of the signer's public key
+	KeyID    string    `json:"key_id"`
+	SignedAt time.Time `json:"signed_at"`
+}
+
+// Summary returns a one-line description of the signer for display
+func (s *SignerInfo) Summary() string {
+	summary := s.Name
+	if summary == "" {
+		summary = "unnamed signer"
+	}
+	if s.Email != "" {
+		summary = fmt.Sprintf("%s <%s>", summary, s.Email)
+	}
+	if s.Role != "" {
+		summary = fmt.Sprintf("%s (%s)", summary, s.Role)
+	}
+	return fmt.Sprintf("%s, key %s", summary, s.KeyID)
+}
+
+// CounterSignature is the signature of a further signer. It covers the
+// document, every earlier signature and the signer metadata, so earlier
+// signatures cannot be removed or replaced without invalidating it.
+type CounterSignature struct {
+	Signer    SignerInfo `json:"signer"`
+	Algorithm string     `json:"algorithm"`
+	Signature string     `json:"signature"`
+	// Timestamp is an RFC 3161 timestamp token over the signature
+	Timestamp []byte `json:"timestamp,omitempty"`
 }
 
 // Manifest contains document metadata and security configuration
@@ -45,6 +296,26 @@ type Manifest struct {
 	Resources  map[string]*Resource `json:"resources" validate:"required"`
 	WASMConfig *WASMConfiguration   `json:"wasm_config"`
 	Features   *FeatureFlags        `json:"features"`
+	Encryption *EncryptionInfo      `json:"encryption,omitempty"`
+	Disclosure *DisclosureInfo      `json:"disclosure,omitempty"`
+	License    *LicenseInfo         `json:"license,omitempty"`
+	Compliance *ComplianceInfo      `json:"compliance,omitempty"`
+	// Requirements are the viewer capabilities the document cannot be
+	// rendered without
+	Requirements *ViewerRequirements `json:"requirements,omitempty"`
+	// Print holds page hints for printing and PDF export
+	Print *PrintSettings `json:"print,omitempty"`
+	// Data are the data files packaged under assets/data/, by the name
+	// interactive content and charts know them by
+	Data map[string]*DataAsset `json:"data,omitempty" validate:"omitempty,dive"`
+	// Extensions are custom metadata of organizations, such as a department
+	// or case number, as a JSON object per reverse-DNS namespace:
+	// "extensions": {"com.example.records": {"case_number": "C-1042"}}
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	// Access limits when and how often readers may open the document. Sign
+	// the document, so the policy cannot be removed without breaking the
+	// signature.
+	Access *AccessPolicy `json:"access,omitempty"`
 }
 
 // DocumentMetadata contains basic document information
@@ -56,6 +327,238 @@ type DocumentMetadata struct {
 	Description string    `json:"description" validate:"max=1000"`
 	Version     string    `json:"version" validate:"required,semver"`
 	Language    string    `json:"language" validate:"required,len=2"`
+	// Authors are the people who wrote or edited the document, for citation
+	// and contact. Author remains the byline shown to readers.
+	Authors []*AuthorInfo `json:"authors,omitempty" validate:"max=100,dive,required"`
+	// Abstract summarizes the work for indexes and DOI registration;
+	// Description is used when it is empty
+	Abstract string `json:"abstract,omitempty" validate:"max=10000"`
+	// Publication identifies the published document, for registering a DOI
+	Publication *PublicationInfo `json:"publication,omitempty"`
+	// Funding lists the grants that supported the work
+	Funding []*FundingInfo `json:"funding,omitempty" validate:"max=50,dive,required"`
+	// Keywords are free tags readers and libraries find the document by
+	Keywords []string `json:"keywords,omitempty" validate:"max=50,dive,required,max=100"`
+	// Subjects classify the document, in a controlled vocabulary or as
+	// free-text headings
+	Subjects []*SubjectInfo `json:"subjects,omitempty" validate:"max=20,dive,required"`
+}
+
+// Subject vocabularies documents are classified in
+const (
+	// SubjectSchemeBISAC is the BISAC subject headings of the book trade,
+	// with codes such as BUS070000
+	SubjectSchemeBISAC = "bisac"
+	// SubjectSchemeDDC is the Dewey Decimal Classification, with class
+	// numbers such as 658.4
+	SubjectSchemeDDC = "ddc"
+)
+
+// SubjectInfo is a subject of a document. Subjects in a vocabulary give their
+// code and may give its heading; free subjects give only a heading.
+type SubjectInfo struct {
+	// Scheme is the vocabulary, bisac or ddc; free subjects leave it empty
+	Scheme string `json:"scheme,omitempty" validate:"omitempty,oneof=bisac ddc"`
+	Code   string `json:"code,omitempty" validate:"required_with=Scheme,max=20"`
+	// Label is the heading, such as "BUSINESS & ECONOMICS / Leadership"
+	Label string `json:"label,omitempty" validate:"required_without=Code,max=200"`
+}
+
+// String returns the heading of a subject, or its code in its vocabulary
+// when it has none
+func (s *SubjectInfo) String() string {
+	if s.Label != "" || s.Code == "" {
+		return s.Label
+	}
+	return strings.TrimSpace(strings.ToUpper(s.Scheme) + " " + s.Code)
+}
+
+// AuthorInfo describes one author of a document
+type AuthorInfo struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Affiliation string `json:"affiliation,omitempty" validate:"max=200"`
+	Email       string `json:"email,omitempty" validate:"omitempty,email"`
+	// ORCID is the author's ORCID iD, as 0000-0002-1825-0097
+	ORCID string `json:"orcid,omitempty" validate:"omitempty,orcid"`
+	URL   string `json:"url,omitempty" validate:"omitempty,url"`
+	// Role is how the author contributed; authors when unset
+	Role string `json:"role,omitempty" validate:"omitempty,oneof=author editor translator illustrator contributor"`
+}
+
+// PublicationInfo describes where a document is published
+type PublicationInfo struct {
+	// DOI is the document's Digital Object Identifier, as 10.5555/report-2024
+	DOI string `json:"doi,omitempty" validate:"omitempty,doi"`
+	// URL is the landing page the DOI resolves to
+	URL       string `json:"url,omitempty" validate:"omitempty,url"`
+	Publisher string `json:"publisher,omitempty" validate:"max=200"`
+}
+
+// DOIURL returns the resolver URL of the document's DOI, or "" without one
+func (p *PublicationInfo) DOIURL() string {
+	if p == nil || p.DOI == "" {
+		return ""
+	}
+	return "https://doi.org/" + p.DOI
+}
+
+// FundingInfo records a funder that supported the work and the grants it
+// awarded, for acknowledgments and open-science reporting
+type FundingInfo struct {
+	Funder string `json:"funder" validate:"required,max=200"`
+	// FunderID is the funder's DOI in the Crossref Funder Registry, as
+	// 10.13039/100000001
+	FunderID string `json:"funder_id,omitempty" validate:"omitempty,doi"`
+	// Awards are the funder's identifiers of the grants, as CHE-1234567
+	Awards []string `json:"awards,omitempty" validate:"max=20,dive,required,max=100"`
+}
+
+// Summary returns the funder with its grants, as
+// "National Science Foundation (CHE-1234567, CHE-7654321)"
+func (f *FundingInfo) Summary() string {
+	if len(f.Awards) == 0 {
+		return f.Funder
+	}
+	return fmt.Sprintf("%s (%s)", f.Funder, strings.Join(f.Awards, ", "))
+}
+
+// FunderIDURL returns the resolver URL of the funder's registry DOI, or ""
+// without one
+func (f *FundingInfo) FunderIDURL() string {
+	if f.FunderID == "" {
+		return ""
+	}
+	return "https://doi.org/" + f.FunderID
+}
+
+// Summary returns the abstract of a document, or its description when it
+// has none
+func (m *DocumentMetadata) Summary() string {
+	if strings.TrimSpace(m.Abstract) != "" {
+		return m.Abstract
+	}
+	return m.Description
+}
+
+// FundingStatement returns the funders and grants of a document for export
+// metadata that holds a single funding field, separated by semicolons
+func (m *DocumentMetadata) FundingStatement() string {
+	var funders []string
+	for _, funding := range m.Funding {
+		if funding != nil {
+			funders = append(funders, funding.Summary())
+		}
+	}
+	return strings.Join(funders, "; ")
+}
+
+// Creators returns the authors of a document, or its byline as the only
+// author when it lists none
+func (m *DocumentMetadata) Creators() []*AuthorInfo {
+	if len(m.Authors) > 0 {
+		return m.Authors
+	}
+	if m.Author == "" {
+		return nil
+	}
+	return []*AuthorInfo{{Name: m.Author}}
+}
+
+// Terms returns the keywords and subject headings of a document, in that
+// order and each once, for search and library filters
+func (m *DocumentMetadata) Terms() []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(term string) {
+		key := strings.ToLower(strings.TrimSpace(term))
+		if key != "" && !seen[key] {
+			seen[key] = true
+			terms = append(terms, strings.TrimSpace(term))
+		}
+	}
+	for _, keyword := range m.Keywords {
+		add(keyword)
+	}
+	for _, heading := range m.SubjectHeadings() {
+		add(heading)
+	}
+	return terms
+}
+
+// SubjectHeadings returns the headings of the subjects of a document
+func (m *DocumentMetadata) SubjectHeadings() []string {
+	var headings []string
+	for _, subject := range m.Subjects {
+		if subject != nil && subject.String() != "" {
+			headings = append(headings, subject.String())
+		}
+	}
+	return headings
+}
+
+// AuthorNames returns the names of the authors for export metadata that
+// holds a single author field, separated by semicolons
+func (m *DocumentMetadata) AuthorNames() string {
+	var names []string
+	for _, author := range m.Creators() {
+		names = append(names, author.Name)
+	}
+	return strings.Join(names, "; ")
+}
+
+// ORCIDURL returns the author's ORCID iD as the URL it is cited by, or an
+// empty string for authors without one
+func (a *AuthorInfo) ORCIDURL() string {
+	if a.ORCID == "" {
+		return ""
+	}
+	return "https://orcid.org/" + a.ORCID
+}
+
+// ValidORCID reports whether id is an ORCID iD: four groups of four digits
+// whose last character is the ISO 7064 11,2 check digit, or X for ten
+func ValidORCID(id string) bool {
+	if len(id) != 19 {
+		return false
+	}
+	total := 0
+	for i := 0; i < 18; i++ {
+		c := id[i]
+		if i%5 == 4 {
+			if c != '-' {
+				return false
+			}
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		total = (total + int(c-'0')) * 2
+	}
+	check := (12 - total%11) % 11
+	if check == 10 {
+		return id[18] == 'X'
+	}
+	return id[18] == byte('0'+check)
+}
+
+// ValidDOI reports whether doi is a Digital Object Identifier: the 10.
+// directory, a registrant code and a suffix, as 10.1000/xyz123
+func ValidDOI(doi string) bool {
+	prefix, suffix, found := strings.Cut(doi, "/")
+	if !found || suffix == "" || strings.ContainsAny(suffix, " \t\r\n") {
+		return false
+	}
+	registrant, found := strings.CutPrefix(prefix, "10.")
+	if !found || len(registrant) < 4 {
+		return false
+	}
+	for _, part := range strings.Split(registrant, ".") {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
 }
 
 // SecurityPolicy defines security constraints and permissions
@@ -105,6 +608,25 @@ type Resource struct {
 	Size int64  `json:"size" validate:"min=0"`
 	Type string `json:"type" validate:"required,mimetype"`
 	Path string `json:"path" validate:"required"`
+	// Variants are alternative renditions viewers may load instead, to
+	// suit the device and connection
+	Variants []*ResourceVariant `json:"variants,omitempty"`
+}
+
+// ResourceVariant is an alternative rendition of a resource, itself stored
+// as a resource at Path. Exactly one of Density, Width, Quality and Type
+// describes it.
+type ResourceVariant struct {
+	Path string `json:"path"`
+	// Density is the device pixel ratio an image is made for, 2 for @2x
+	Density float64 `json:"density,omitempty"`
+	// Width is the width of an image in pixels
+	Width int `json:"width,omitempty"`
+	// Quality is low or high, for data at a coarser or finer resolution
+	Quality string `json:"quality,omitempty"`
+	// Type is the media type of a rendition in another format, such as
+	// image/webp, for browsers that display it
+	Type string `json:"type,omitempty"`
 }
 
 // WASMConfiguration defines WASM module configuration
@@ -137,11 +659,333 @@ type FeatureFlags struct {
 	WebAssembly   bool `json:"webassembly"`
 }
 
-// ValidationResult represents the result of document validation
-type ValidationResult struct {
-	IsValid  bool     `json:"is_valid"`
-	Errors   []string `json:"errors"`
-	Warnings []string `json:"warnings"`
+// Enabled returns the names of the enabled features
+func (f *FeatureFlags) Enabled() []string {
+	flags := []struct {
+		name    string
+		enabled bool
+	}{
+		{"animations", f.Animations},
+		{"interactivity", f.Interactivity},
+		{"charts", f.Charts},
+		{"forms", f.Forms},
+		{"audio", f.Audio},
+		{"video", f.Video},
+		{"webgl", f.WebGL},
+		{"webassembly", f.WebAssembly},
+	}
+
+	enabled := []string{}
+	for _, flag := range flags {
+		if flag.enabled {
+			enabled = append(enabled, flag.name)
+		}
+	}
+	return enabled
+}
+
+// Set turns the feature named as by Enabled on or off
+func (f *FeatureFlags) Set(name string, enabled bool) error {
+	switch name {
+	case "animations":
+		f.Animations = enabled
+	case "interactivity":
+		f.Interactivity = enabled
+	case "charts":
+		f.Charts = enabled
+	case "forms":
+		f.Forms = enabled
+	case "audio":
+		f.Audio = enabled
+	case "video":
+		f.Video = enabled
+	case "webgl":
+		f.WebGL = enabled
+	case "webassembly":
+		f.WebAssembly = enabled
+	default:
+		return fmt.Errorf("unknown feature %q (expected animations, interactivity, charts, forms, audio, video, webgl or webassembly)", name)
+	}
+	return nil
+}
+
+// ViewerRequirements declares what a viewer must support to render a document.
+// Viewers that fall short say so before rendering, rather than rendering the
+// document partially.
+type ViewerRequirements struct {
+	// MinFormatVersion is the lowest format version, as major.minor, the
+	// viewer must read
+	MinFormatVersion string `json:"min_format_version,omitempty"`
+	// Features are the features, named as by FeatureFlags.Enabled, the
+	// document needs. Names a viewer does not know are unsupported.
+	Features []string `json:"features,omitempty" validate:"dive,required"`
+}
+
+// AccessPolicy limits when and how often readers may open a document. Viewers
+// enforce it; it keeps honest readers honest and does not stop anyone who
+// unzips the package.
+type AccessPolicy struct {
+	// NotBefore and NotAfter bound the times the document opens
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	// MaxOpens is how many times each reader may open the document; zero
+	// means unlimited
+	MaxOpens int `json:"max_opens,omitempty" validate:"min=0"`
+	// Watermark is laid over the document while it is open
+	Watermark *WatermarkPolicy `json:"watermark,omitempty"`
+}
+
+// WatermarkPolicy is the identity shown over an open document
+type WatermarkPolicy struct {
+	// Text is the watermark, in which {reader} is replaced by the reader's
+	// name and {time} by the time the document was opened; "{reader} {time}"
+	// when empty
+	Text string `json:"text,omitempty" validate:"max=200"`
+}
+
+// pageSizes are the named page sizes of PrintSettings, in points
+var pageSizes = map[string][2]float64{
+	"a3":     {841.89, 1190.55},
+	"a4":     {595.28, 841.89},
+	"a5":     {419.53, 595.28},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// lengthUnits are the units of print lengths, in points
+var lengthUnits = map[string]float64{
+	"mm": 72 / 25.4,
+	"cm": 72 / 2.54,
+	"in": 72,
+	"pt": 1,
+	"px": 0.75,
+}
+
+// PrintSettings are page hints for printing and PDF export
+type PrintSettings struct {
+	// PageSize is A3, A4, A5, Letter or Legal, or a width and height such
+	// as "210mm 297mm"; A4 when unset
+	PageSize string `json:"page_size,omitempty"`
+	// Orientation is portrait, the default, or landscape
+	Orientation string `json:"orientation,omitempty"`
+	// Margin is one to four lengths, read as the CSS margin property; one
+	// inch when unset
+	Margin string `json:"margin,omitempty"`
+	// Stylesheet is the package path of the document's print stylesheet
+	Stylesheet string `json:"stylesheet,omitempty"`
+	// Header and Footer run along the top and bottom of exported pages.
+	// {title}, {author}, {page} and {pages} are replaced, and | separates
+	// text aligned left and right, or left, centre and right.
+	Header string `json:"header,omitempty"`
+	Footer string `json:"footer,omitempty"`
+	// TableOfContents adds a contents page of the document's headings
+	TableOfContents bool `json:"table_of_contents,omitempty"`
+	// Cover adds a cover page from the metadata and thumbnail
+	Cover bool `json:"cover,omitempty"`
+}
+
+// PageDimensions returns the width and height of the page in points
+func (p *PrintSettings) PageDimensions() (width, height float64, err error) {
+	size := pageSizes["a4"]
+	if p != nil && p.PageSize != "" {
+		var ok bool
+		if size, ok = pageSizes[strings.ToLower(p.PageSize)]; !ok {
+			fields := strings.Fields(p.PageSize)
+			if len(fields) != 2 {
+				return 0, 0, fmt.Errorf("invalid page size %q", p.PageSize)
+			}
+			for i, field := range fields {
+				if size[i], err = parsePrintLength(field); err != nil || size[i] <= 0 {
+					return 0, 0, fmt.Errorf("invalid page size %q", p.PageSize)
+				}
+			}
+		}
+	}
+	width, height = size[0], size[1]
+	if p != nil {
+		switch p.Orientation {
+		case "", "portrait":
+		case "landscape":
+			width, height = max(width, height), min(width, height)
+		default:
+			return 0, 0, fmt.Errorf("invalid page orientation %q", p.Orientation)
+		}
+	}
+	return width, height, nil
+}
+
+// Margins returns the top, right, bottom and left page margins in points
+func (p *PrintSettings) Margins() (top, right, bottom, left float64, err error) {
+	if p == nil || p.Margin == "" {
+		return 72, 72, 72, 72, nil
+	}
+	fields := strings.Fields(p.Margin)
+	if len(fields) == 0 || len(fields) > 4 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid margin %q", p.Margin)
+	}
+	lengths := make([]float64, len(fields))
+	for i, field := range fields {
+		if lengths[i], err = parsePrintLength(field); err != nil || lengths[i] < 0 {
+			return 0, 0, 0, 0, fmt.Errorf("invalid margin %q", p.Margin)
+		}
+	}
+	// As CSS: top, then right, bottom and left taken from the opposite side
+	switch len(lengths) {
+	case 1:
+		return lengths[0], lengths[0], lengths[0], lengths[0], nil
+	case 2:
+		return lengths[0], lengths[1], lengths[0], lengths[1], nil
+	case 3:
+		return lengths[0], lengths[1], lengths[2], lengths[1], nil
+	}
+	return lengths[0], lengths[1], lengths[2], lengths[3], nil
+}
+
+// parsePrintLength converts a length such as 20mm or 0.5in to points
+func parsePrintLength(length string) (float64, error) {
+	if length == "0" {
+		return 0, nil
+	}
+	for unit, points := range lengthUnits {
+		if number, ok := strings.CutSuffix(strings.ToLower(length), unit); ok {
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid length %q", length)
+			}
+			return value * points, nil
+		}
+	}
+	return 0, fmt.Errorf("length %q has no unit of mm, cm, in, pt or px", length)
+}
+
+// DataPrefix is where documents package their data files
+const DataPrefix = "assets/data/"
+
+// DataFormats are the formats of data files
+var DataFormats = []string{"csv", "json", "parquet"}
+
+// DataFieldTypes are the types a data schema gives its fields
+var DataFieldTypes = []string{"string", "number", "integer", "boolean", "date"}
+
+// DataAsset is a data file of the package and the schema its rows follow
+type DataAsset struct {
+	// Path is the package path of the file, under DataPrefix
+	Path string `json:"path" validate:"required"`
+	// Format is csv, json (an array of objects) or parquet; by the
+	// extension of Path when unset
+	Format string      `json:"format,omitempty" validate:"omitempty,oneof=csv json parquet"`
+	Schema *DataSchema `json:"schema" validate:"required"`
+	// Description says what the data is, for readers and tools
+	Description string `json:"description,omitempty"`
+}
+
+// FileFormat returns the format of the data file
+func (d *DataAsset) FileFormat() string {
+	if d.Format != "" {
+		return d.Format
+	}
+	return strings.TrimPrefix(strings.ToLower(path.Ext(d.Path)), ".")
+}
+
+// DataSchema lists the fields of the rows of a data file. Rows have no
+// fields besides these.
+type DataSchema struct {
+	Fields []*DataField `json:"fields" validate:"required,min=1,dive"`
+}
+
+// DataField is a field of the rows of a data file
+type DataField struct {
+	Name string `json:"name" validate:"required"`
+	// Type is string, number, integer, boolean or date (ISO 8601, with or
+	// without a time)
+	Type string `json:"type" validate:"required,oneof=string number integer boolean date"`
+	// Required fields have a value in every row
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// EncryptionInfo describes how the encrypted resources of a document were sealed.
+// Resource hashes and sizes in the manifest always refer to the stored ciphertext,
+// so integrity can be verified without access to the content key.
+type EncryptionInfo struct {
+	Algorithm  string                        `json:"algorithm" validate:"required,oneof=AES-256-GCM"`
+	ChunkSize  int                           `json:"chunk_size" validate:"min=1024,max=16777216"`
+	Recipients []*KeyRecipient               `json:"recipients" validate:"required,min=1,dive"`
+	Resources  map[string]*EncryptedResource `json:"resources" validate:"required,dive"`
+}
+
+// KeyRecipient holds the content key wrapped for one password or public key
+type KeyRecipient struct {
+	Type  string `json:"type" validate:"required,oneof=password rsa-oaep-256"`
+	KeyID string `json:"key_id,omitempty"`
+	KDF   string `json:"kdf,omitempty" validate:"omitempty,oneof=PBKDF2-SHA256 argon2id"`
+	Salt  string `json:"salt,omitempty"`
+	// Iterations is the PBKDF2 iteration count, or the Argon2id time cost
+	Iterations int `json:"iterations,omitempty"`
+	// Memory (KiB) and Parallelism are the further Argon2id costs
+	Memory      uint32 `json:"memory,omitempty"`
+	Parallelism uint8  `json:"parallelism,omitempty"`
+	Nonce       string `json:"nonce,omitempty"`
+	WrappedKey  string `json:"wrapped_key" validate:"required"`
+}
+
+// EncryptedResource records the per-resource parameters needed for chunked decryption
+type EncryptedResource struct {
+	NoncePrefix   string `json:"nonce_prefix" validate:"required"`
+	PlaintextSize int64  `json:"plaintext_size" validate:"min=0"`
+	PlaintextType string `json:"plaintext_type"`
+}
+
+// DisclosureInfo lists confidential sections that were encrypted at build time.
+// Public readers see placeholders; holders of a section key can unlock them in place.
+type DisclosureInfo struct {
+	Sections map[string]*ConfidentialSection `json:"sections" validate:"required,dive"`
+}
+
+// ConfidentialSection describes one encrypted section and where its ciphertext is stored
+type ConfidentialSection struct {
+	Label      string          `json:"label"`
+	Path       string          `json:"path" validate:"required"`
+	Encryption *EncryptionInfo `json:"encryption" validate:"required"`
+}
+
+// LicenseInfo declares the terms under which a document may be used. Either an SPDX
+// license expression or custom terms must be given.
+type LicenseInfo struct {
+	SPDX        string   `json:"spdx,omitempty" validate:"omitempty,spdx"`
+	Terms       string   `json:"terms,omitempty" validate:"max=5000"`
+	URL         string   `json:"url,omitempty" validate:"omitempty,url"`
+	Holder      string   `json:"holder,omitempty" validate:"max=200"`
+	AllowedUses []string `json:"allowed_uses,omitempty" validate:"dive,oneof=view print copy modify redistribute commercial"`
+}
+
+// Summary returns a one-line description of the license for display and export metadata
+func (l *LicenseInfo) Summary() string {
+	summary := l.SPDX
+	if summary == "" {
+		summary = l.Terms
+	}
+	if l.Holder != "" {
+		summary = fmt.Sprintf("%s (%s)", summary, l.Holder)
+	}
+	if len(l.AllowedUses) > 0 {
+		summary = fmt.Sprintf("%s; allowed uses: %s", summary, strings.Join(l.AllowedUses, ", "))
+	}
+	return summary
+}
+
+// ComplianceInfo records the outcome of build-time compliance checks that were overridden
+type ComplianceInfo struct {
+	Waivers []*LicenseWaiver `json:"waivers" validate:"dive"`
+}
+
+// LicenseWaiver is an audited override allowing assets that failed the asset license check
+type LicenseWaiver struct {
+	Assets     []string  `json:"assets" validate:"required,min=1"`
+	Policy     string    `json:"policy" validate:"required"`
+	Reason     string    `json:"reason" validate:"required,max=1000"`
+	ApprovedBy string    `json:"approved_by" validate:"required,max=100"`
+	Granted    time.Time `json:"granted" validate:"required"`
 }
 
 // SecurityReport represents security validation results
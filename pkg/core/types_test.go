@@ -649,4 +649,101 @@ func BenchmarkLIVDocument_JSONUnmarshal(b *testing.B) {
 			b.Fatalf("Failed to unmarshal document: %v", err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestParseActivitySpec(t *testing.T) {
+	spec, err := ParseActivitySpec([]byte(`{"activity": {"keep_running": ["#clock", ".ticker"], "keep_timers": true}}`))
+	if err != nil || len(spec.KeepRunning) != 2 || spec.KeepRunning[0] != "#clock" || !spec.KeepTimers {
+		t.Errorf("Unexpected activity section: %+v: %v", spec, err)
+	}
+	for _, script := range []string{"", "console.log('hello');", `{"modules": {}}`} {
+		if spec, err := ParseActivitySpec([]byte(script)); err != nil || len(spec.KeepRunning) != 0 || spec.KeepTimers {
+			t.Errorf("Expected %q to pause everything, got %+v: %v", script, spec, err)
+		}
+	}
+	for _, invalid := range []string{`{"activity": {"keep_running": [" "]}}`, `{"activity": []}`} {
+		if _, err := ParseActivitySpec([]byte(invalid)); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestParseGraphicsSpec(t *testing.T) {
+	spec, err := ParseGraphicsSpec([]byte(`{"graphics": {"webgl2": true, "extensions": ["OES_texture_float"], "min_texture_size": 4096, "fallback": "canvas2d"}}`))
+	if err != nil || !spec.WebGL2 || len(spec.Extensions) != 1 || spec.MinTextureSize != 4096 || spec.Fallback != GraphicsFallbackCanvas2D {
+		t.Errorf("Unexpected graphics section: %+v: %v", spec, err)
+	}
+	for _, script := range []string{"", "console.log('hello');", `{"activity": {}}`} {
+		if spec, err := ParseGraphicsSpec([]byte(script)); err != nil || spec.WebGL2 || spec.Fallback != "" {
+			t.Errorf("Expected %q to have an empty graphics section, got %+v: %v", script, spec, err)
+		}
+	}
+	for _, invalid := range []string{
+		`{"graphics": {"fallback": "video"}}`,
+		`{"graphics": {"min_texture_size": -1}}`,
+		`{"graphics": {"extensions": [""]}}`,
+		`{"graphics": {"snapshot": "../secret.png"}}`,
+		`{"graphics": {"snapshot": "/assets/snapshot.png"}}`,
+	} {
+		if _, err := ParseGraphicsSpec([]byte(invalid)); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestParseEventsSpec(t *testing.T) {
+	spec, err := ParseEventsSpec([]byte(`{"events": {"name": "Programme", "items": [
+		{"id": "opening", "title": "Opening", "start": "2025-05-01T09:00:00+02:00", "end": "2025-05-01T10:30:00+02:00", "location": "Hall A"},
+		{"title": "Festival", "start": "2025-05-02", "end": "2025-05-04"}
+	]}}`))
+	if err != nil || spec.Name != "Programme" || len(spec.Items) != 2 || spec.Items[1].ID != "event-2" {
+		t.Fatalf("Unexpected events section: %+v: %v", spec, err)
+	}
+	start, end, allDay, err := spec.Items[0].Span()
+	if err != nil || allDay || end.Sub(start) != 90*time.Minute {
+		t.Errorf("Unexpected span %v to %v: %v", start, end, err)
+	}
+	start, end, allDay, err = spec.Items[1].Span()
+	if err != nil || !allDay || end.Sub(start) != 72*time.Hour {
+		t.Errorf("Expected the festival to last three days, got %v to %v: %v", start, end, err)
+	}
+	for _, script := range []string{"", "console.log('hello');", `{"activity": {}}`} {
+		if spec, err := ParseEventsSpec([]byte(script)); err != nil || len(spec.Items) != 0 {
+			t.Errorf("Expected %q to have no events, got %+v: %v", script, spec, err)
+		}
+	}
+	for _, invalid := range []string{
+		`{"events": {"items": [{"title": "A", "start": "tomorrow"}]}}`,
+		`{"events": {"items": [{"start": "2025-05-01"}]}}`,
+		`{"events": {"items": [{"title": "A", "start": "2025-05-02", "end": "2025-05-01"}]}}`,
+		`{"events": {"items": [{"title": "A", "start": "2025-05-01", "end": "2025-05-01T10:00:00Z"}]}}`,
+		`{"events": {"items": [{"id": "a", "title": "A", "start": "2025-05-01"}, {"id": "a", "title": "B", "start": "2025-05-02"}]}}`,
+	} {
+		if _, err := ParseEventsSpec([]byte(invalid)); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestPrintSettings(t *testing.T) {
+	var unset *PrintSettings
+	if width, height, err := unset.PageDimensions(); err != nil || width != 595.28 || height != 841.89 {
+		t.Errorf("Expected A4 by default, got %.2fx%.2f: %v", width, height, err)
+	}
+	settings := &PrintSettings{PageSize: "210mm 297mm", Orientation: "landscape", Margin: "10mm 1in 0"}
+	width, height, err := settings.PageDimensions()
+	if err != nil || width < 841 || width > 842 || height < 595 || height > 596 {
+		t.Errorf("Expected landscape A4, got %.2fx%.2f: %v", width, height, err)
+	}
+	top, right, bottom, left, err := settings.Margins()
+	if err != nil || top < 28.3 || top > 28.4 || right != 72 || bottom != 0 || left != 72 {
+		t.Errorf("Unexpected margins %.2f %.2f %.2f %.2f: %v", top, right, bottom, left, err)
+	}
+	for _, invalid := range []*PrintSettings{{PageSize: "huge"}, {PageSize: "-1in 2in"}, {Margin: "1em"}, {Margin: "1 2 3 4 5"}} {
+		_, _, sizeErr := invalid.PageDimensions()
+		_, _, _, _, marginErr := invalid.Margins()
+		if sizeErr == nil && marginErr == nil {
+			t.Errorf("Expected %+v to be refused", invalid)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity is how serious a validation finding is
+type Severity string
+
+const (
+	// SeverityError findings make what was validated invalid
+	SeverityError Severity = "error"
+	// SeverityWarning findings are worth fixing but do not make it invalid
+	SeverityWarning Severity = "warning"
+	// SeverityInfo findings are notes
+	SeverityInfo Severity = "info"
+)
+
+// Finding is one thing a validator found. Code names the kind of finding
+// for tools to act on; codes are dotted, the area checked first, such as
+// manifest.required or resource.hash_mismatch, and do not change with the
+// wording of Message.
+type Finding struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Path is where the finding is: a JSON pointer into the manifest or
+	// spec, such as /metadata/title, or the package path of a file
+	Path string `json:"path,omitempty"`
+	// Suggestion says how to fix the finding, when there is a clear fix
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// String formats the finding on one line, as
+// "error manifest.required at /metadata/title: message (suggestion)"
+func (f *Finding) String() string {
+	var b strings.Builder
+	b.WriteString(string(f.Severity))
+	if f.Code != "" {
+		b.WriteString(" " + f.Code)
+	}
+	if f.Path != "" {
+		b.WriteString(" at " + f.Path)
+	}
+	b.WriteString(": " + f.Message)
+	if f.Suggestion != "" {
+		b.WriteString(" (" + f.Suggestion + ")")
+	}
+	return b.String()
+}
+
+// ValidationResult represents the result of document validation. Findings
+// hold the details of each problem; Errors and Warnings are the messages of
+// the error and warning findings, the text validation has always reported.
+type ValidationResult struct {
+	IsValid  bool       `json:"is_valid"`
+	Errors   []string   `json:"errors"`
+	Warnings []string   `json:"warnings"`
+	Findings []*Finding `json:"findings,omitempty"`
+}
+
+// NewValidationResult returns a valid result without findings
+func NewValidationResult() *ValidationResult {
+	return &ValidationResult{IsValid: true, Errors: []string{}, Warnings: []string{}}
+}
+
+// Add records a finding. Error findings make the result invalid.
+func (r *ValidationResult) Add(finding *Finding) *Finding {
+	r.Findings = append(r.Findings, finding)
+	switch finding.Severity {
+	case SeverityError:
+		r.IsValid = false
+		r.Errors = append(r.Errors, finding.Message)
+	case SeverityWarning:
+		r.Warnings = append(r.Warnings, finding.Message)
+	}
+	return finding
+}
+
+// AddError records an error finding. The returned finding can be given a
+// suggestion.
+func (r *ValidationResult) AddError(code, path, message string) *Finding {
+	return r.Add(&Finding{Code: code, Severity: SeverityError, Path: path, Message: message})
+}
+
+// AddWarning records a warning finding
+func (r *ValidationResult) AddWarning(code, path, message string) *Finding {
+	return r.Add(&Finding{Code: code, Severity: SeverityWarning, Path: path, Message: message})
+}
+
+// Merge records the findings of another result. Errors and warnings it has
+// without findings, from validators reporting text only, are kept as text.
+func (r *ValidationResult) Merge(other *ValidationResult) {
+	if other == nil {
+		return
+	}
+	if len(other.Findings) == 0 {
+		r.Errors = append(r.Errors, other.Errors...)
+		r.Warnings = append(r.Warnings, other.Warnings...)
+		r.IsValid = r.IsValid && other.IsValid && len(other.Errors) == 0
+		return
+	}
+	for _, finding := range other.Findings {
+		r.Add(finding)
+	}
+}
+
+// FindingsWithCode returns the findings of a kind
+func (r *ValidationResult) FindingsWithCode(code string) []*Finding {
+	var found []*Finding
+	for _, finding := range r.Findings {
+		if finding.Code == code {
+			found = append(found, finding)
+		}
+	}
+	return found
+}
+
+// JSONPointer returns the JSON pointer of a location given as its keys, such
+// as /resources/content~1index.html for "resources", "content/index.html"
+func JSONPointer(keys ...interface{}) string {
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteByte('/')
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(fmt.Sprint(key)))
+	}
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package core
+
+import "testing"
+
+func TestValidationResult_Findings(t *testing.T) {
+	result := NewValidationResult()
+	result.AddWarning("manifest.version", "/version", "version 2.0 may not be supported")
+	if !result.IsValid || len(result.Warnings) != 1 {
+		t.Fatalf("Expected a warning to leave the result valid, got %+v", result)
+	}
+
+	result.AddError("resource.required", JSONPointer("resources", "content/index.html"), "required resource missing").Suggestion = "add the file"
+	if result.IsValid || len(result.Errors) != 1 || result.Errors[0] != "required resource missing" {
+		t.Fatalf("Expected an error to make the result invalid, got %+v", result)
+	}
+	found := result.FindingsWithCode("resource.required")
+	if len(found) != 1 || found[0].Path != "/resources/content~1index.html" {
+		t.Fatalf("Unexpected findings %+v", found)
+	}
+	if got, want := found[0].String(), "error resource.required at /resources/content~1index.html: required resource missing (add the file)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	merged := NewValidationResult()
+	merged.Merge(&ValidationResult{IsValid: false, Errors: []string{"text only"}})
+	merged.Merge(result)
+	if merged.IsValid || len(merged.Errors) != 2 || len(merged.Warnings) != 1 || len(merged.Findings) != 2 {
+		t.Errorf("Unexpected merged result %+v", merged)
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	if got := JSONPointer("data", "a~b", 0); got != "/data/a~0b/0" {
+		t.Errorf("JSONPointer() = %q", got)
+	}
+	if got := JSONPointer(); got != "" {
+		t.Errorf("JSONPointer() of the root = %q", got)
+	}
+}
@@ -0,0 +1,333 @@
+// Package crossref exports the metadata of a document as a Crossref deposit,
+// so publishers can register a DOI for it without entering the title,
+// authors, abstract, license and funding again.
+package crossref
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// ContentType is the media type of deposit files
+const ContentType = "application/vnd.crossref.deposit+xml"
+
+// SchemaVersion is the version of the Crossref deposit schema written
+const SchemaVersion = "5.3.1"
+
+// PostedTypes are the kinds of posted content Crossref registers
+var PostedTypes = []string{"preprint", "working_paper", "letter", "dissertation", "report", "review", "other"}
+
+// contributorRoles maps author roles to Crossref contributor roles.
+// Illustrators and other contributors have no Crossref role and are left out.
+var contributorRoles = map[string]string{
+	"":           "author",
+	"author":     "author",
+	"editor":     "editor",
+	"translator": "translator",
+}
+
+// Deposit describes who registers the DOI and what kind of work it is for
+type Deposit struct {
+	// BatchID identifies the submission; Crossref reports on it by this ID.
+	// It defaults to one derived from the DOI and Timestamp.
+	BatchID string
+	// Timestamp orders deposits for the same DOI; later ones replace earlier
+	// ones. It defaults to the current time.
+	Timestamp time.Time
+	// DepositorName and DepositorEmail receive the submission report
+	DepositorName  string
+	DepositorEmail string
+	// Registrant is the organization that owns the DOI; the publisher when
+	// empty
+	Registrant string
+	// Type is one of PostedTypes; "other" when empty
+	Type string
+}
+
+// Encode writes a deposit registering the DOI of a document. The manifest
+// must give the DOI, the landing page it resolves to, a title and at least
+// one author.
+func Encode(m *core.Manifest, d Deposit) ([]byte, error) {
+	if m == nil || m.Metadata == nil {
+		return nil, fmt.Errorf("manifest has no metadata")
+	}
+	metadata := m.Metadata
+	publication := metadata.Publication
+	switch {
+	case publication == nil || publication.DOI == "":
+		return nil, fmt.Errorf("metadata.publication.doi is required to register a DOI")
+	case !core.ValidDOI(publication.DOI):
+		return nil, fmt.Errorf("invalid DOI %q", publication.DOI)
+	case publication.URL == "":
+		return nil, fmt.Errorf("metadata.publication.url is required: it is the page the DOI resolves to")
+	case strings.TrimSpace(metadata.Title) == "":
+		return nil, fmt.Errorf("document has no title")
+	case d.DepositorName == "" || d.DepositorEmail == "":
+		return nil, fmt.Errorf("depositor name and email are required")
+	}
+
+	var contributors []*core.AuthorInfo
+	for _, author := range metadata.Creators() {
+		if author == nil {
+			continue
+		}
+		if _, ok := contributorRoles[author.Role]; ok {
+			contributors = append(contributors, author)
+		}
+	}
+	if len(contributors) == 0 {
+		return nil, fmt.Errorf("document has no authors")
+	}
+
+	postedType := d.Type
+	if postedType == "" {
+		postedType = "other"
+	}
+	if !isPostedType(postedType) {
+		return nil, fmt.Errorf("unsupported content type %q (use %s)", postedType, strings.Join(PostedTypes, ", "))
+	}
+	timestamp := d.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	batchID := d.BatchID
+	if batchID == "" {
+		batchID = fmt.Sprintf("liv-%s-%d", strings.NewReplacer("/", "-", ".", "-").Replace(publication.DOI), timestamp.Unix())
+	}
+	registrant := d.Registrant
+	if registrant == "" {
+		registrant = publication.Publisher
+	}
+	if registrant == "" {
+		registrant = d.DepositorName
+	}
+
+	w := &writer{}
+	w.raw(xml.Header)
+	w.open("doi_batch",
+		"xmlns", "http://www.crossref.org/schema/"+SchemaVersion,
+		"xmlns:xsi", "http://www.w3.org/2001/XMLSchema-instance",
+		"xmlns:jats", "http://www.ncbi.nlm.nih.gov/JATS1",
+		"xmlns:fr", "http://www.crossref.org/fundref.xsd",
+		"xmlns:ai", "http://www.crossref.org/AccessIndicators.xsd",
+		"version", SchemaVersion,
+		"xsi:schemaLocation", "http://www.crossref.org/schema/"+SchemaVersion+" https://www.crossref.org/schemas/crossref"+SchemaVersion+".xsd")
+
+	w.open("head")
+	w.element("doi_batch_id", batchID)
+	// Crossref timestamps are integers that must increase between deposits
+	w.element("timestamp", timestamp.UTC().Format("20060102150405"))
+	w.open("depositor")
+	w.element("depositor_name", d.DepositorName)
+	w.element("email_address", d.DepositorEmail)
+	w.close("depositor")
+	w.element("registrant", registrant)
+	w.close("head")
+
+	w.open("body")
+	attrs := []string{"type", postedType}
+	if metadata.Language != "" {
+		attrs = append(attrs, "language", strings.ToLower(metadata.Language))
+	}
+	w.open("posted_content", attrs...)
+
+	w.open("contributors")
+	for i, author := range contributors {
+		sequence := "additional"
+		if i == 0 {
+			sequence = "first"
+		}
+		w.open("person_name", "sequence", sequence, "contributor_role", contributorRoles[author.Role])
+		given, surname := splitName(author.Name)
+		if given != "" {
+			w.element("given_name", given)
+		}
+		w.element("surname", surname)
+		if author.Affiliation != "" {
+			w.open("affiliations")
+			w.open("institution")
+			w.element("institution_name", author.Affiliation)
+			w.close("institution")
+			w.close("affiliations")
+		}
+		if orcid := author.ORCIDURL(); orcid != "" {
+			w.element("ORCID", orcid, "authenticated", "false")
+		}
+		w.close("person_name")
+	}
+	w.close("contributors")
+
+	w.open("titles")
+	w.element("title", metadata.Title)
+	w.close("titles")
+
+	posted := metadata.Created
+	if posted.IsZero() {
+		posted = timestamp
+	}
+	w.open("posted_date")
+	w.element("month", fmt.Sprintf("%02d", posted.Month()))
+	w.element("day", fmt.Sprintf("%02d", posted.Day()))
+	w.element("year", fmt.Sprintf("%d", posted.Year()))
+	w.close("posted_date")
+
+	if publication.Publisher != "" {
+		w.open("institution")
+		w.element("institution_name", publication.Publisher)
+		w.close("institution")
+	}
+
+	if summary := strings.TrimSpace(metadata.Summary()); summary != "" {
+		w.open("jats:abstract")
+		for _, paragraph := range paragraphs(summary) {
+			w.element("jats:p", paragraph)
+		}
+		w.close("jats:abstract")
+	}
+
+	if funding := fundingOf(metadata); len(funding) > 0 {
+		w.open("fr:program", "name", "fundref")
+		for _, grant := range funding {
+			w.open("fr:assertion", "name", "fundgroup")
+			// The funder identifier is nested in the funder name, whose text
+			// must not pick up indentation
+			w.indent()
+			w.startTag("fr:assertion", []string{"name", "funder_name"})
+			xml.EscapeText(&w.buf, []byte(grant.Funder))
+			if grant.FunderID != "" {
+				w.startTag("fr:assertion", []string{"name", "funder_identifier"})
+				xml.EscapeText(&w.buf, []byte(grant.FunderIDURL()))
+				w.buf.WriteString("</fr:assertion>")
+			}
+			w.buf.WriteString("</fr:assertion>\n")
+			for _, award := range grant.Awards {
+				w.element("fr:assertion", award, "name", "award_number")
+			}
+			w.close("fr:assertion")
+		}
+		w.close("fr:program")
+	}
+
+	if license := licenseURL(m.License); license != "" {
+		w.open("ai:program", "name", "AccessIndicators")
+		w.element("ai:license_ref", license)
+		w.close("ai:program")
+	}
+
+	w.open("doi_data")
+	w.element("doi", publication.DOI)
+	w.element("resource", publication.URL)
+	w.close("doi_data")
+
+	w.close("posted_content")
+	w.close("body")
+	w.close("doi_batch")
+	return w.buf.Bytes(), nil
+}
+
+// splitName splits a personal name into given names and a surname, taking
+// the last word as the surname
+func splitName(name string) (given, surname string) {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+}
+
+// paragraphs splits text at blank lines
+func paragraphs(text string) []string {
+	var result []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.Join(strings.Fields(paragraph), " "); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+	return result
+}
+
+func fundingOf(metadata *core.DocumentMetadata) []*core.FundingInfo {
+	var funding []*core.FundingInfo
+	for _, grant := range metadata.Funding {
+		if grant != nil && grant.Funder != "" {
+			funding = append(funding, grant)
+		}
+	}
+	return funding
+}
+
+// licenseURL returns the URL of a document's license. Documents under a
+// single SPDX license without a URL link the SPDX license page.
+func licenseURL(license *core.LicenseInfo) string {
+	switch {
+	case license == nil:
+		return ""
+	case license.URL != "":
+		return license.URL
+	case license.SPDX != "" && !strings.ContainsAny(license.SPDX, " ()"):
+		return "https://spdx.org/licenses/" + license.SPDX + ".html"
+	default:
+		return ""
+	}
+}
+
+func isPostedType(postedType string) bool {
+	for _, t := range PostedTypes {
+		if t == postedType {
+			return true
+		}
+	}
+	return false
+}
+
+// writer writes indented XML elements
+type writer struct {
+	buf   bytes.Buffer
+	depth int
+}
+
+func (w *writer) raw(s string) {
+	w.buf.WriteString(s)
+}
+
+func (w *writer) indent() {
+	w.buf.WriteString(strings.Repeat("  ", w.depth))
+}
+
+func (w *writer) startTag(name string, attrs []string) {
+	w.buf.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		w.buf.WriteString(" " + attrs[i] + `="`)
+		xml.EscapeText(&w.buf, []byte(attrs[i+1]))
+		w.buf.WriteString(`"`)
+	}
+	w.buf.WriteString(">")
+}
+
+// open starts an element whose content follows on the next lines. attrs
+// are name and value pairs.
+func (w *writer) open(name string, attrs ...string) {
+	w.indent()
+	w.startTag(name, attrs)
+	w.buf.WriteString("\n")
+	w.depth++
+}
+
+func (w *writer) close(name string) {
+	w.depth--
+	w.indent()
+	w.buf.WriteString("</" + name + ">\n")
+}
+
+// element writes an element holding only text
+func (w *writer) element(name, text string, attrs ...string) {
+	w.indent()
+	w.startTag(name, attrs)
+	xml.EscapeText(&w.buf, []byte(text))
+	w.buf.WriteString("</" + name + ">\n")
+}
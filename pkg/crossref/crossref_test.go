@@ -0,0 +1,109 @@
+package crossref
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func testManifest() *core.Manifest {
+	return &core.Manifest{
+		Metadata: &core.DocumentMetadata{
+			Title:    "Rivers & Deltas",
+			Author:   "Josiah Carberry",
+			Created:  time.Date(2024, 3, 7, 9, 0, 0, 0, time.UTC),
+			Language: "EN",
+			Authors: []*core.AuthorInfo{
+				{Name: "Josiah Stinkney Carberry", Affiliation: "Brown University", ORCID: "0000-0002-1825-0097"},
+				{Name: "Ada Illustrator", Role: "illustrator"},
+				{Name: "Eve Editor", Role: "editor"},
+			},
+			Description: "Short description.",
+			Abstract:    "First paragraph\nwrapped.\n\nSecond paragraph.",
+			Publication: &core.PublicationInfo{DOI: "10.5555/rivers-2024", URL: "https://docs.example.com/rivers", Publisher: "Example Press"},
+			Funding: []*core.FundingInfo{
+				{Funder: "National Science Foundation", FunderID: "10.13039/100000001", Awards: []string{"CHE-1234567", "CHE-7654321"}},
+			},
+		},
+		License: &core.LicenseInfo{SPDX: "CC-BY-4.0"},
+	}
+}
+
+func TestEncode(t *testing.T) {
+	data, err := Encode(testManifest(), Deposit{
+		DepositorName:  "Example Press",
+		DepositorEmail: "doi@example.com",
+		Timestamp:      time.Date(2024, 3, 8, 12, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Deposit is not well-formed XML: %v\n%s", err, data)
+		}
+	}
+
+	deposit := string(data)
+	for _, want := range []string{
+		`<doi_batch xmlns="http://www.crossref.org/schema/5.3.1"`,
+		`<doi_batch_id>liv-10-5555-rivers-2024-1709901000</doi_batch_id>`,
+		`<timestamp>20240308123000</timestamp>`,
+		`<registrant>Example Press</registrant>`,
+		`<posted_content type="other" language="en">`,
+		`<person_name sequence="first" contributor_role="author">`,
+		`<given_name>Josiah Stinkney</given_name>`,
+		`<surname>Carberry</surname>`,
+		`<institution_name>Brown University</institution_name>`,
+		`<ORCID authenticated="false">https://orcid.org/0000-0002-1825-0097</ORCID>`,
+		`<person_name sequence="additional" contributor_role="editor">`,
+		`<title>Rivers &amp; Deltas</title>`,
+		`<month>03</month>`,
+		`<jats:p>First paragraph wrapped.</jats:p>`,
+		`<jats:p>Second paragraph.</jats:p>`,
+		`<fr:assertion name="funder_name">National Science Foundation<fr:assertion name="funder_identifier">https://doi.org/10.13039/100000001</fr:assertion></fr:assertion>`,
+		`<fr:assertion name="award_number">CHE-1234567</fr:assertion>`,
+		`<fr:assertion name="award_number">CHE-7654321</fr:assertion>`,
+		`<ai:license_ref>https://spdx.org/licenses/CC-BY-4.0.html</ai:license_ref>`,
+		`<doi>10.5555/rivers-2024</doi>`,
+		`<resource>https://docs.example.com/rivers</resource>`,
+	} {
+		if !strings.Contains(deposit, want) {
+			t.Errorf("Expected %s in:\n%s", want, deposit)
+		}
+	}
+	if strings.Contains(deposit, "Ada Illustrator") {
+		t.Error("Expected the illustrator to be left out")
+	}
+	if strings.Index(deposit, "<jats:abstract>") > strings.Index(deposit, "<fr:program") ||
+		strings.Index(deposit, "<ai:program") > strings.Index(deposit, "<doi_data>") {
+		t.Error("Expected elements in the order of the schema")
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	deposit := Deposit{DepositorName: "Example Press", DepositorEmail: "doi@example.com"}
+	for name, edit := range map[string]func(m *core.Manifest, d *Deposit){
+		"no DOI":       func(m *core.Manifest, d *Deposit) { m.Metadata.Publication.DOI = "" },
+		"invalid DOI":  func(m *core.Manifest, d *Deposit) { m.Metadata.Publication.DOI = "doi:10.5555/x" },
+		"no URL":       func(m *core.Manifest, d *Deposit) { m.Metadata.Publication.URL = "" },
+		"no depositor": func(m *core.Manifest, d *Deposit) { d.DepositorEmail = "" },
+		"no authors":   func(m *core.Manifest, d *Deposit) { m.Metadata.Authors, m.Metadata.Author = nil, "" },
+		"bad type":     func(m *core.Manifest, d *Deposit) { d.Type = "novel" },
+	} {
+		m, d := testManifest(), deposit
+		edit(m, &d)
+		if _, err := Encode(m, d); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
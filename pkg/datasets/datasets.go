@@ -0,0 +1,165 @@
+// Package datasets reads the data files documents package under assets/data/
+// and checks their rows against the schemas the manifest declares for them.
+// The builder refuses data that does not follow its schema, and the viewer
+// hands the typed rows to interactive content and charts.
+package datasets
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// ReadFunc reads an entry of a package
+type ReadFunc func(entry string) ([]byte, error)
+
+// Table is the rows of a data file
+type Table struct {
+	Fields []string
+	// Rows map fields to their values: numbers, as float64, strings and,
+	// in typed tables, booleans. Empty cells have no value.
+	Rows []map[string]interface{}
+}
+
+// FormatOf returns the format of a data file: format when set, otherwise
+// the extension of its path
+func FormatOf(entry, format string) string {
+	if format != "" {
+		return format
+	}
+	return strings.TrimPrefix(strings.ToLower(path.Ext(entry)), ".")
+}
+
+// Decode reads the rows of a data file in format: a CSV file with a header
+// row, a JSON array of objects or a Parquet file with flat columns. Cells of
+// CSV files that are numbers become numbers.
+func Decode(data []byte, format string) (*Table, error) {
+	return decode(data, format, true)
+}
+
+// decode reads the rows of a data file, leaving CSV cells strings unless
+// numbers is set
+func decode(data []byte, format string, numbers bool) (*Table, error) {
+	switch format {
+	case "csv":
+		return decodeCSV(data, numbers)
+	case "json":
+		var values []interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("invalid JSON data: %v", err)
+		}
+		return FromValues(values)
+	case "parquet":
+		return decodeParquet(data)
+	default:
+		return nil, fmt.Errorf("unknown data format %q", format)
+	}
+}
+
+// decodeCSV reads a CSV file whose first row names the fields
+func decodeCSV(data []byte, numbers bool) (*Table, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV has no header row")
+	}
+	table := &Table{}
+	for _, field := range records[0] {
+		table.Fields = append(table.Fields, strings.TrimSpace(field))
+	}
+	for _, record := range records[1:] {
+		row := make(map[string]interface{})
+		for i, cell := range record {
+			if i >= len(table.Fields) {
+				break
+			}
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			if n, err := strconv.ParseFloat(cell, 64); err == nil && numbers {
+				row[table.Fields[i]] = n
+			} else {
+				row[table.Fields[i]] = cell
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// FromValues reads rows given as JSON objects. The fields are those of all
+// rows, in name order.
+func FromValues(values []interface{}) (*Table, error) {
+	table := &Table{}
+	fields := make(map[string]bool)
+	for i, value := range values {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("row %d is not an object", i)
+		}
+		row := make(map[string]interface{})
+		for field, v := range object {
+			fields[field] = true
+			switch v := v.(type) {
+			case float64, string, bool:
+				row[field] = v
+			case nil:
+			default:
+				row[field] = fmt.Sprint(v)
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	for field := range fields {
+		table.Fields = append(table.Fields, field)
+	}
+	sort.Strings(table.Fields)
+	return table, nil
+}
+
+// Load reads a declared data file and converts its rows to the types of its
+// schema. The table is returned with the rows that follow the schema even
+// when others do not; the errors name the rows and fields that do not.
+func Load(asset *core.DataAsset, read ReadFunc) (*Table, []error) {
+	data, err := read(asset.Path)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read %s: %w", asset.Path, err)}
+	}
+	// Cells are converted by the schema, so CSV strings of digits stay
+	// strings where the schema says so
+	table, err := decode(data, asset.FileFormat(), false)
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %w", asset.Path, err)}
+	}
+	return Apply(table, asset.Schema)
+}
+
+// Validate loads every data file a manifest declares, returning the problems
+// found prefixed with the name of the data
+func Validate(manifest *core.Manifest, read ReadFunc) []error {
+	names := make([]string, 0, len(manifest.Data))
+	for name := range manifest.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		_, loadErrs := Load(manifest.Data[name], read)
+		for _, err := range loadErrs {
+			errs = append(errs, fmt.Errorf("data %s: %w", name, err))
+		}
+	}
+	return errs
+}
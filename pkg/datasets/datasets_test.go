@@ -0,0 +1,131 @@
+package datasets
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/parquet-go/parquet-go"
+)
+
+var salesSchema = &core.DataSchema{Fields: []*core.DataField{
+	{Name: "region", Type: "string", Required: true},
+	{Name: "code", Type: "string"},
+	{Name: "units", Type: "integer"},
+	{Name: "revenue", Type: "number"},
+	{Name: "active", Type: "boolean"},
+	{Name: "day", Type: "date"},
+}}
+
+func reader(files map[string][]byte) ReadFunc {
+	return func(entry string) ([]byte, error) {
+		data, ok := files[entry]
+		if !ok {
+			return nil, fmt.Errorf("no entry %s", entry)
+		}
+		return data, nil
+	}
+}
+
+func TestLoadCSV(t *testing.T) {
+	files := map[string][]byte{"assets/data/sales.csv": []byte("region,code,units,revenue,active,day\nNorth,007,12,1500.5,true,2024-03-01\nSouth,,3,,false,2024-03-02T10:00:00Z\n")}
+	table, errs := Load(&core.DataAsset{Path: "assets/data/sales.csv", Schema: salesSchema}, reader(files))
+	if len(errs) > 0 {
+		t.Fatalf("Load() errors: %v", errs)
+	}
+	if len(table.Fields) != 6 || table.Fields[0] != "region" || len(table.Rows) != 2 {
+		t.Fatalf("unexpected table: %+v", table)
+	}
+	north := table.Rows[0]
+	if north["code"] != "007" || north["units"] != 12.0 || north["revenue"] != 1500.5 || north["active"] != true || north["day"] != "2024-03-01" {
+		t.Errorf("unexpected typed row: %+v", north)
+	}
+	if _, ok := table.Rows[1]["revenue"]; ok {
+		t.Errorf("expected an empty cell to have no value, got %+v", table.Rows[1])
+	}
+}
+
+func TestLoadReportsRowsAgainstSchema(t *testing.T) {
+	files := map[string][]byte{
+		"assets/data/sales.json": []byte(`[{"region": "North", "units": 2.5}, {"units": 3}, {"region": "West", "active": "maybe"}, {"region": "East", "day": "March"}]`),
+		"assets/data/extra.csv":  []byte("region,colour\nNorth,red\n"),
+	}
+	table, errs := Load(&core.DataAsset{Path: "assets/data/sales.json", Schema: salesSchema}, reader(files))
+	want := []string{
+		`row 1: field "units": 2.5 is not an integer`,
+		`row 2: field "region" is required`,
+		`row 3: field "active": maybe is not a boolean`,
+		`row 4: field "day": "March" is not an ISO 8601 date`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, err, want[i])
+		}
+	}
+	if len(table.Rows) != 0 {
+		t.Errorf("expected rows that do not follow the schema left out, got %+v", table.Rows)
+	}
+
+	if _, errs := Load(&core.DataAsset{Path: "assets/data/extra.csv", Schema: salesSchema}, reader(files)); len(errs) != 1 || !strings.Contains(errs[0].Error(), `field "colour" is not in the schema`) {
+		t.Errorf("expected an undeclared column to be refused, got %v", errs)
+	}
+}
+
+func days(year int, month time.Month, day int) int32 {
+	return int32(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+func TestLoadParquet(t *testing.T) {
+	type sale struct {
+		Region  string  `parquet:"region"`
+		Units   int64   `parquet:"units"`
+		Revenue float64 `parquet:"revenue"`
+		Active  bool    `parquet:"active"`
+		// Day is days since the Unix epoch
+		Day int32 `parquet:"day,date"`
+	}
+	var buf bytes.Buffer
+	rows := []sale{
+		{Region: "North", Units: 12, Revenue: 1500.5, Active: true, Day: days(2024, 3, 1)},
+		{Region: "South", Units: 3, Revenue: 80, Day: days(2024, 3, 2)},
+	}
+	if err := parquet.Write(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{"assets/data/sales.parquet": buf.Bytes()}
+	table, errs := Load(&core.DataAsset{Path: "assets/data/sales.parquet", Schema: salesSchema}, reader(files))
+	if len(errs) > 0 {
+		t.Fatalf("Load() errors: %v", errs)
+	}
+	if len(table.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %+v", table.Rows)
+	}
+	north := table.Rows[0]
+	if north["region"] != "North" || north["units"] != 12.0 || north["revenue"] != 1500.5 || north["active"] != true || north["day"] != "2024-03-01" {
+		t.Errorf("unexpected typed row: %+v", north)
+	}
+
+	if _, err := Decode([]byte("not parquet"), "parquet"); err == nil {
+		t.Errorf("expected invalid Parquet to be refused")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m := &core.Manifest{Data: map[string]*core.DataAsset{
+		"sales":   {Path: "assets/data/sales.csv", Schema: salesSchema},
+		"missing": {Path: "assets/data/missing.csv", Schema: salesSchema},
+	}}
+	files := map[string][]byte{"assets/data/sales.csv": []byte("region,units\nNorth,many\n")}
+	errs := Validate(m, reader(files))
+	if len(errs) != 2 || !strings.HasPrefix(errs[0].Error(), "data missing: failed to read assets/data/missing.csv") ||
+		errs[1].Error() != `data sales: row 1: field "units": "many" is not a number` {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
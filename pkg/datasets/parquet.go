@@ -0,0 +1,93 @@
+package datasets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// decodeParquet reads a Parquet file of flat columns. Dates and timestamps
+// become ISO 8601 strings, integers and floats numbers and byte arrays
+// strings.
+func decodeParquet(data []byte) (*Table, error) {
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Parquet: %v", err)
+	}
+	schema := file.Schema()
+	table := &Table{}
+	var leaves []parquet.LeafColumn
+	for _, column := range schema.Columns() {
+		leaf, _ := schema.Lookup(column...)
+		if len(column) != 1 || leaf.MaxRepetitionLevel > 0 {
+			return nil, fmt.Errorf("parquet column %s is nested or repeated; only flat columns are read", strings.Join(column, "."))
+		}
+		table.Fields = append(table.Fields, column[0])
+		leaves = append(leaves, leaf)
+	}
+
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+	rows := make([]parquet.Row, 64)
+	for {
+		n, err := reader.ReadRows(rows)
+		for _, row := range rows[:n] {
+			values := make(map[string]interface{})
+			for _, value := range row {
+				column := value.Column()
+				if column < 0 || column >= len(leaves) || value.IsNull() {
+					continue
+				}
+				values[table.Fields[column]] = parquetValue(value, leaves[column].Node.Type())
+			}
+			table.Rows = append(table.Rows, values)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Parquet: %v", err)
+		}
+	}
+	return table, nil
+}
+
+// parquetValue returns a Parquet value as a table value
+func parquetValue(value parquet.Value, kind parquet.Type) interface{} {
+	logical := kind.LogicalType()
+	switch value.Kind() {
+	case parquet.Boolean:
+		return value.Boolean()
+	case parquet.Int32:
+		if logical != nil && logical.Date != nil {
+			return time.Unix(int64(value.Int32())*86400, 0).UTC().Format("2006-01-02")
+		}
+		return float64(value.Int32())
+	case parquet.Int64:
+		if logical != nil && logical.Timestamp != nil {
+			n := value.Int64()
+			var t time.Time
+			switch unit := logical.Timestamp.Unit; {
+			case unit.Millis != nil:
+				t = time.UnixMilli(n)
+			case unit.Micros != nil:
+				t = time.UnixMicro(n)
+			default:
+				t = time.Unix(0, n)
+			}
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+		return float64(value.Int64())
+	case parquet.Float:
+		return float64(value.Float())
+	case parquet.Double:
+		return value.Double()
+	default:
+		return string(value.ByteArray())
+	}
+}
@@ -0,0 +1,152 @@
+package datasets
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// dateLayouts are the ISO 8601 forms date fields are read in
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// Apply converts the rows of a table to the types of schema: numbers and
+// integers to float64, booleans to bool, and strings and dates to string,
+// dates in ISO 8601. The fields of the result are those of the schema, in
+// its order. Rows with a value that cannot be converted, a required field
+// without a value or a field the schema does not list are left out, and an
+// error names each problem with its row, counted from 1.
+func Apply(table *Table, schema *core.DataSchema) (*Table, []error) {
+	if schema == nil {
+		return table, nil
+	}
+	typed := &Table{}
+	declared := make(map[string]*core.DataField)
+	for _, field := range schema.Fields {
+		typed.Fields = append(typed.Fields, field.Name)
+		declared[field.Name] = field
+	}
+
+	var errs []error
+	for _, name := range table.Fields {
+		if declared[name] == nil {
+			errs = append(errs, fmt.Errorf("field %q is not in the schema", name))
+		}
+	}
+	if len(errs) > 0 {
+		return typed, errs
+	}
+
+	for i, row := range table.Rows {
+		converted, rowErrs := Record(row, schema)
+		for _, err := range rowErrs {
+			errs = append(errs, fmt.Errorf("row %d: %v", i+1, err))
+		}
+		if len(rowErrs) == 0 {
+			typed.Rows = append(typed.Rows, converted)
+		}
+	}
+	return typed, errs
+}
+
+// Record converts the values of one record to the types of schema, as Apply
+// does for each row, and names each problem in an error
+func Record(record map[string]interface{}, schema *core.DataSchema) (map[string]interface{}, []error) {
+	var errs []error
+	converted := make(map[string]interface{}, len(record))
+	declared := make(map[string]bool, len(schema.Fields))
+	for _, field := range schema.Fields {
+		declared[field.Name] = true
+		value, ok := record[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				errs = append(errs, fmt.Errorf("field %q is required", field.Name))
+			}
+			continue
+		}
+		v, err := convert(value, field.Type)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %q: %v", field.Name, err))
+			continue
+		}
+		converted[field.Name] = v
+	}
+	names := make([]string, 0, len(record))
+	for name := range record {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		errs = append(errs, fmt.Errorf("field %q is not in the schema", name))
+	}
+	return converted, errs
+}
+
+// convert returns value as a value of a field of type kind
+func convert(value interface{}, kind string) (interface{}, error) {
+	switch kind {
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	case "number", "integer":
+		var n float64
+		switch v := value.(type) {
+		case float64:
+			n = v
+		case string:
+			var err error
+			if n, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				return nil, fmt.Errorf("%q is not a number", v)
+			}
+		default:
+			return nil, fmt.Errorf("%v is not a number", v)
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("%v is not a finite number", n)
+		}
+		if kind == "integer" && n != math.Trunc(n) {
+			return nil, fmt.Errorf("%v is not an integer", n)
+		}
+		return n, nil
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a boolean", value)
+	case "date":
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a date", value)
+		}
+		v = strings.TrimSpace(v)
+		for _, layout := range dateLayouts {
+			if _, err := time.Parse(layout, v); err == nil {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not an ISO 8601 date", v)
+	default:
+		return nil, fmt.Errorf("unknown field type %q", kind)
+	}
+}
@@ -0,0 +1,409 @@
+// Package delta encodes the changes between two versions of a document as a
+// patch, so an update can be distributed without the resources that did not
+// change. A patch is a ZIP file holding patch.json, which lists every entry
+// of the new version with its SHA-256, and the contents of the entries that
+// are new or changed. Entries are matched by the resource hashes already in
+// the manifest, so moved resources are reused too. Applying a patch copies
+// the other entries from the old version and checks every entry against its
+// hash, so a patch only applies to the version it was made from.
+package delta
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+const (
+	// FormatVersion identifies the patch format
+	FormatVersion = "liv-delta/1"
+	// ContentType is the media type of patches
+	ContentType = "application/vnd.liv.delta+zip"
+	// Extension is the file extension of patches
+	Extension = ".livd"
+
+	patchEntry   = "patch.json"
+	dataPrefix   = "data/"
+	manifestPath = "manifest.json"
+)
+
+// ErrBaseMismatch is returned when a patch is applied to a document other than
+// the one it was made from
+var ErrBaseMismatch = errors.New("patch was made for a different version of the document")
+
+// Patch describes the entries of a new document version and where their
+// contents come from
+type Patch struct {
+	Format string `json:"format"`
+	// Base and Target are the SHA-256 of the manifest of the version the
+	// patch applies to and of the version it produces
+	Base   string `json:"base"`
+	Target string `json:"target"`
+	// Created is when the patch was made
+	Created time.Time `json:"created"`
+	// Entries are the entries of the new version, in package order
+	Entries []*Entry `json:"entries"`
+	// Removed are the entries of the old version the new one no longer has
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Entry is an entry of the new version
+type Entry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// From is the entry of the old version with the same contents, which is
+	// Path when the entry is unchanged. Contents of entries without it are
+	// in the patch.
+	From string `json:"from,omitempty"`
+	// Changed is set on entries whose contents in the patch replace those
+	// at the same path in the old version
+	Changed bool `json:"changed,omitempty"`
+}
+
+// Summary counts the changes a patch makes
+type Summary struct {
+	Unchanged int
+	Moved     int
+	Added     int
+	Changed   int
+	Removed   int
+	// Reused and Included are the bytes copied from the old version and
+	// carried in the patch
+	Reused   int64
+	Included int64
+}
+
+// Summarize counts the changes a patch makes
+func (p *Patch) Summarize() Summary {
+	s := Summary{Removed: len(p.Removed)}
+	for _, entry := range p.Entries {
+		switch {
+		case entry.From == entry.Path:
+			s.Unchanged++
+			s.Reused += entry.Size
+		case entry.From != "":
+			s.Moved++
+			s.Reused += entry.Size
+		case entry.Changed:
+			s.Changed++
+			s.Included += entry.Size
+		default:
+			s.Added++
+			s.Included += entry.Size
+		}
+	}
+	return s
+}
+
+// Diff writes a patch from base to target and returns its description
+func Diff(base, target *zip.Reader, w io.Writer) (*Patch, error) {
+	baseHashes, err := entryHashes(base)
+	if err != nil {
+		return nil, fmt.Errorf("old version: %v", err)
+	}
+	targetHashes, err := entryHashes(target)
+	if err != nil {
+		return nil, fmt.Errorf("new version: %v", err)
+	}
+
+	// Contents are reused from the entry at the same path when possible, and
+	// otherwise from the first entry with the same hash
+	byHash := make(map[string]string)
+	for _, f := range base.File {
+		if hash, ok := baseHashes[f.Name]; ok {
+			if _, seen := byHash[hash]; !seen {
+				byHash[hash] = f.Name
+			}
+		}
+	}
+
+	patch := &Patch{
+		Format:  FormatVersion,
+		Base:    baseHashes[manifestPath],
+		Target:  targetHashes[manifestPath],
+		Created: time.Now().UTC(),
+	}
+	var included []*zip.File
+	inTarget := make(map[string]bool)
+	for _, f := range target.File {
+		hash, ok := targetHashes[f.Name]
+		if !ok {
+			continue
+		}
+		inTarget[f.Name] = true
+		entry := &Entry{Path: f.Name, SHA256: hash, Size: int64(f.UncompressedSize64)}
+		if baseHashes[f.Name] == hash {
+			entry.From = f.Name
+		} else if from, ok := byHash[hash]; ok {
+			entry.From = from
+		} else {
+			_, entry.Changed = baseHashes[f.Name]
+			included = append(included, f)
+		}
+		patch.Entries = append(patch.Entries, entry)
+	}
+	for _, f := range base.File {
+		if _, ok := baseHashes[f.Name]; ok && !inTarget[f.Name] {
+			patch.Removed = append(patch.Removed, f.Name)
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	description, err := json.MarshalIndent(patch, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	pw, err := zw.Create(patchEntry)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pw.Write(description); err != nil {
+		return nil, err
+	}
+	for _, f := range included {
+		// A stale manifest hash would make the patch impossible to apply
+		if hash, err := hashEntry(f, -1); err != nil || hash != targetHashes[f.Name] {
+			return nil, fmt.Errorf("%s does not match its hash in the manifest of the new version", f.Name)
+		}
+		if err := copyRaw(zw, f, dataPrefix+f.Name); err != nil {
+			return nil, fmt.Errorf("failed to add %s: %v", f.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// Reader reads a patch
+type Reader struct {
+	Patch *Patch
+	data  map[string]*zip.File
+}
+
+// NewReader opens a patch and checks its description
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch: %v", err)
+	}
+
+	pr := &Reader{data: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		if f.Name == patchEntry {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch: %v", err)
+			}
+			err = json.NewDecoder(io.LimitReader(rc, 16<<20)).Decode(&pr.Patch)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch description: %v", err)
+			}
+		} else if strings.HasPrefix(f.Name, dataPrefix) {
+			pr.data[strings.TrimPrefix(f.Name, dataPrefix)] = f
+		}
+	}
+	if pr.Patch == nil {
+		return nil, fmt.Errorf("invalid patch: %s not found", patchEntry)
+	}
+	if err := pr.check(); err != nil {
+		return nil, fmt.Errorf("invalid patch: %v", err)
+	}
+	return pr, nil
+}
+
+func (pr *Reader) check() error {
+	p := pr.Patch
+	if p.Format != FormatVersion {
+		return fmt.Errorf("unsupported format %q", p.Format)
+	}
+	if !isHash(p.Base) || !isHash(p.Target) {
+		return fmt.Errorf("base and target must be SHA-256 hashes")
+	}
+	seen := make(map[string]bool)
+	for _, entry := range p.Entries {
+		if entry == nil {
+			return fmt.Errorf("empty entry")
+		}
+		if !validPath(entry.Path) || (entry.From != "" && !validPath(entry.From)) {
+			return fmt.Errorf("invalid entry path %q", entry.Path)
+		}
+		if seen[entry.Path] {
+			return fmt.Errorf("entry %s is listed more than once", entry.Path)
+		}
+		seen[entry.Path] = true
+		if !isHash(entry.SHA256) || entry.Size < 0 {
+			return fmt.Errorf("entry %s has an invalid hash or size", entry.Path)
+		}
+		if entry.From == "" && pr.data[entry.Path] == nil {
+			return fmt.Errorf("contents of %s are missing", entry.Path)
+		}
+		if entry.Path == manifestPath && entry.SHA256 != p.Target {
+			return fmt.Errorf("manifest does not match the target")
+		}
+	}
+	if !seen[manifestPath] {
+		return fmt.Errorf("patched document has no manifest")
+	}
+	return nil
+}
+
+// Apply writes the patched document, copying unchanged entries from base.
+// The patched document is at most limit bytes uncompressed when limit is
+// positive. Every entry is checked against its hash as it is copied.
+func (pr *Reader) Apply(base *zip.Reader, w io.Writer, limit int64) error {
+	baseFiles := make(map[string]*zip.File)
+	for _, f := range base.File {
+		baseFiles[f.Name] = f
+	}
+	manifest := baseFiles[manifestPath]
+	if manifest == nil {
+		return fmt.Errorf("document has no manifest")
+	}
+	if hash, err := hashEntry(manifest, -1); err != nil || hash != pr.Patch.Base {
+		return ErrBaseMismatch
+	}
+
+	zw := zip.NewWriter(w)
+	var total int64
+	for _, entry := range pr.Patch.Entries {
+		total += entry.Size
+		if limit > 0 && total > limit {
+			return fmt.Errorf("patched document exceeds %d bytes", limit)
+		}
+
+		source := pr.data[entry.Path]
+		if entry.From != "" {
+			if source = baseFiles[entry.From]; source == nil {
+				return fmt.Errorf("%w: %s is missing", ErrBaseMismatch, entry.From)
+			}
+		}
+		hash, err := hashEntry(source, entry.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", entry.Path, err)
+		}
+		if hash != entry.SHA256 {
+			if entry.From != "" {
+				return fmt.Errorf("%w: %s has changed", ErrBaseMismatch, entry.From)
+			}
+			return fmt.Errorf("contents of %s do not match their hash", entry.Path)
+		}
+		if err := copyRaw(zw, source, entry.Path); err != nil {
+			return fmt.Errorf("failed to write %s: %v", entry.Path, err)
+		}
+	}
+	return zw.Close()
+}
+
+// entryHashes returns the SHA-256 of each file in a package. The hashes of
+// resources are taken from the manifest; other entries, and the manifest
+// itself, are hashed.
+func entryHashes(r *zip.Reader) (map[string]string, error) {
+	var manifestFile *zip.File
+	for _, f := range r.File {
+		if f.Name == manifestPath {
+			manifestFile = f
+		}
+	}
+	if manifestFile == nil {
+		return nil, fmt.Errorf("%s not found", manifestPath)
+	}
+	rc, err := manifestFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	var m core.Manifest
+	err = json.NewDecoder(rc).Decode(&m)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	hashes := make(map[string]string)
+	for _, f := range r.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if resource := m.Resources[f.Name]; resource != nil && f.Name != manifestPath && isHash(strings.ToLower(resource.Hash)) {
+			hashes[f.Name] = strings.ToLower(resource.Hash)
+			continue
+		}
+		hash, err := hashEntry(f, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+		}
+		hashes[f.Name] = hash
+	}
+	return hashes, nil
+}
+
+// hashEntry returns the SHA-256 of the contents of f, which must be size
+// bytes unless size is negative
+func hashEntry(f *zip.File, size int64) (string, error) {
+	if size >= 0 && f.UncompressedSize64 != uint64(size) {
+		return "", fmt.Errorf("size is %d bytes, expected %d", f.UncompressedSize64, size)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyRaw copies an entry under a new name without recompressing it
+func copyRaw(zw *zip.Writer, f *zip.File, name string) error {
+	header := f.FileHeader
+	header.Name = name
+	w, err := zw.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func validPath(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "/") && !strings.Contains(name, "\\") &&
+		path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+func isHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// Names returns the entries a patch adds or changes, sorted
+func (p *Patch) Names() []string {
+	var names []string
+	for _, entry := range p.Entries {
+		if entry.From == "" {
+			names = append(names, entry.Path)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
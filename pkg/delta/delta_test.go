@@ -0,0 +1,183 @@
+package delta
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// testPackage zips files with a manifest listing their hashes
+func testPackage(t *testing.T, title string, files map[string]string, order ...string) *zip.Reader {
+	t.Helper()
+	m := core.Manifest{Version: "1.0", Metadata: &core.DocumentMetadata{Title: title}, Resources: map[string]*core.Resource{}}
+	for name, data := range files {
+		sum := sha256.Sum256([]byte(data))
+		m.Resources[name] = &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(data)), Path: name}
+	}
+	manifestData, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, data string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	write(manifestPath, string(manifestData))
+	for _, name := range order {
+		write(name, files[name])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func readAll(t *testing.T, zr *zip.Reader) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+func TestDiffAndApply(t *testing.T) {
+	video := strings.Repeat("large unchanged media ", 5000)
+	base := testPackage(t, "Report", map[string]string{
+		"content/index.html":     "<p>Revenue grew 10%.</p>",
+		"assets/media/intro.mp4": video,
+		"assets/images/logo.png": "logo",
+		"content/old.css":        "body{}",
+	}, "content/index.html", "assets/media/intro.mp4", "assets/images/logo.png", "content/old.css")
+	target := testPackage(t, "Report", map[string]string{
+		"content/index.html":     "<p>Revenue grew 12%.</p>",
+		"assets/media/intro.mp4": video,
+		"assets/logo.png":        "logo",
+		"content/new.js":         "console.log(1)",
+	}, "content/index.html", "assets/media/intro.mp4", "assets/logo.png", "content/new.js")
+
+	var patchData bytes.Buffer
+	patch, err := Diff(base, target, &patchData)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	summary := patch.Summarize()
+	if summary.Unchanged != 1 || summary.Moved != 1 || summary.Changed != 2 || summary.Added != 1 || summary.Removed != 2 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if patchData.Len() > len(video)/10 {
+		t.Errorf("Expected the unchanged media to be left out of a %d byte patch", patchData.Len())
+	}
+	if names := strings.Join(patch.Names(), ","); names != "content/index.html,content/new.js,manifest.json" {
+		t.Errorf("Unexpected patched entries %s", names)
+	}
+
+	pr, err := NewReader(bytes.NewReader(patchData.Bytes()), int64(patchData.Len()))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	var patched bytes.Buffer
+	if err := pr.Apply(base, &patched, 0); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	result, err := zip.NewReader(bytes.NewReader(patched.Bytes()), int64(patched.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := readAll(t, result), readAll(t, target)
+	if len(got) != len(want) {
+		t.Errorf("Expected %d entries, got %d", len(want), len(got))
+	}
+	for name, data := range want {
+		if got[name] != data {
+			t.Errorf("Entry %s differs after patching", name)
+		}
+	}
+
+	// The patch only applies to the version it was made from
+	if err := pr.Apply(target, io.Discard, 0); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("Expected a base mismatch, got %v", err)
+	}
+	if err := pr.Apply(base, io.Discard, 1000); err == nil {
+		t.Error("Expected the size limit to be enforced")
+	}
+}
+
+func TestApplyDetectsTampering(t *testing.T) {
+	files := map[string]string{"content/index.html": "<p>v1</p>", "assets/data.bin": "original"}
+	base := testPackage(t, "v1", files, "content/index.html", "assets/data.bin")
+	target := testPackage(t, "v2", map[string]string{"content/index.html": "<p>v2</p>", "assets/data.bin": "original"}, "content/index.html", "assets/data.bin")
+	var patchData bytes.Buffer
+	if _, err := Diff(base, target, &patchData); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := NewReader(bytes.NewReader(patchData.Bytes()), int64(patchData.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same manifest, different bytes for an entry the patch reuses
+	tampered := bytes.Buffer{}
+	zw := zip.NewWriter(&tampered)
+	for _, f := range base.File {
+		w, _ := zw.Create(f.Name)
+		if f.Name == "assets/data.bin" {
+			w.Write([]byte("modified"))
+			continue
+		}
+		rc, _ := f.Open()
+		io.Copy(w, rc)
+		rc.Close()
+	}
+	zw.Close()
+	tamperedBase, _ := zip.NewReader(bytes.NewReader(tampered.Bytes()), int64(tampered.Len()))
+	if err := pr.Apply(tamperedBase, io.Discard, 0); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("Expected the modified entry to be detected, got %v", err)
+	}
+}
+
+func TestNewReaderRejectsInvalidPatches(t *testing.T) {
+	hash := strings.Repeat("a", 64)
+	for name, patch := range map[string]Patch{
+		"format":    {Format: "liv-delta/9", Base: hash, Target: hash, Entries: []*Entry{{Path: manifestPath, SHA256: hash, From: manifestPath}}},
+		"traversal": {Format: FormatVersion, Base: hash, Target: hash, Entries: []*Entry{{Path: manifestPath, SHA256: hash, From: manifestPath}, {Path: "../evil", SHA256: hash, From: "a"}}},
+		"missing":   {Format: FormatVersion, Base: hash, Target: hash, Entries: []*Entry{{Path: manifestPath, SHA256: hash}}},
+		"manifest":  {Format: FormatVersion, Base: hash, Target: hash, Entries: []*Entry{{Path: "content/index.html", SHA256: hash, From: "content/index.html"}}},
+	} {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create(patchEntry)
+		json.NewEncoder(w).Encode(patch)
+		zw.Close()
+		if _, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+			t.Errorf("%s: expected the patch to be rejected", name)
+		}
+	}
+}
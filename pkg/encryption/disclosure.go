@@ -0,0 +1,261 @@
+package encryption
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"golang.org/x/net/html"
+)
+
+const (
+	// ConfidentialAttribute marks an element whose contents are encrypted at build time
+	ConfidentialAttribute = "data-liv-confidential"
+
+	// LabelAttribute optionally names a confidential section in its placeholder
+	LabelAttribute = "data-liv-label"
+
+	// SectionDirectory holds the ciphertext of confidential sections inside the package
+	SectionDirectory = "content/sections/"
+)
+
+// RedactSections encrypts every element marked with data-liv-confidential in the
+// package's HTML resources. Each section is sealed under its own content key, which
+// is wrapped with the section key from sectionKeys. The element is kept in place with
+// a placeholder so layout and navigation still work for public readers.
+//
+// A marked section without a key is an error: publishing it in the clear is never
+// the intended outcome.
+func RedactSections(files map[string][]byte, manifest *core.Manifest, sectionKeys map[string]string, iterations int) error {
+	var htmlPaths []string
+	for path := range files {
+		if strings.HasPrefix(path, "content/") && (strings.HasSuffix(path, ".html") || strings.HasSuffix(path, ".htm")) {
+			htmlPaths = append(htmlPaths, path)
+		}
+	}
+	// Seal sections from the main document before any copies in fallbacks
+	sort.Slice(htmlPaths, func(i, j int) bool {
+		if htmlPaths[i] == "content/index.html" || htmlPaths[j] == "content/index.html" {
+			return htmlPaths[i] == "content/index.html"
+		}
+		return htmlPaths[i] < htmlPaths[j]
+	})
+
+	disclosure := manifest.Disclosure
+	if disclosure == nil {
+		disclosure = &core.DisclosureInfo{Sections: make(map[string]*core.ConfidentialSection)}
+	}
+
+	for _, path := range htmlPaths {
+		doc, err := html.Parse(bytes.NewReader(files[path]))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+
+		changed := false
+		var walkErr error
+		walk(doc, func(n *html.Node) bool {
+			id, marked := attribute(n, ConfidentialAttribute)
+			if !marked {
+				return true
+			}
+			if walkErr != nil {
+				return false
+			}
+			if id == "" {
+				walkErr = fmt.Errorf("confidential section in %s has no id", path)
+				return false
+			}
+
+			label, _ := attribute(n, LabelAttribute)
+			if _, sealed := disclosure.Sections[id]; !sealed {
+				passphrase, ok := sectionKeys[id]
+				if !ok || passphrase == "" {
+					walkErr = fmt.Errorf("no key provided for confidential section %q", id)
+					return false
+				}
+				section, ciphertext, err := sealSection(id, label, innerHTML(n), passphrase, iterations)
+				if err != nil {
+					walkErr = err
+					return false
+				}
+				if _, exists := files[section.Path]; exists {
+					walkErr = fmt.Errorf("confidential section %q collides with existing resource %s", id, section.Path)
+					return false
+				}
+				files[section.Path] = ciphertext
+				disclosure.Sections[id] = section
+				if manifest.Resources != nil {
+					manifest.Resources[section.Path] = &core.Resource{
+						Hash: sha256Hex(ciphertext),
+						Size: int64(len(ciphertext)),
+						Type: "application/octet-stream",
+						Path: section.Path,
+					}
+				}
+			}
+
+			replaceWithPlaceholder(n, id, label)
+			changed = true
+			return false
+		})
+		if walkErr != nil {
+			return walkErr
+		}
+		if !changed {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := html.Render(&buf, doc); err != nil {
+			return fmt.Errorf("failed to render %s: %v", path, err)
+		}
+		files[path] = buf.Bytes()
+
+		if resource, ok := manifest.Resources[path]; ok {
+			resource.Hash = sha256Hex(buf.Bytes())
+			resource.Size = int64(buf.Len())
+		}
+	}
+
+	if len(disclosure.Sections) > 0 {
+		manifest.Disclosure = disclosure
+	}
+	return nil
+}
+
+// UnlockSection decrypts a confidential section's HTML with its section key
+func UnlockSection(files map[string][]byte, section *core.ConfidentialSection, passphrase string) (string, error) {
+	ciphertext, exists := files[section.Path]
+	if !exists {
+		return "", fmt.Errorf("section ciphertext not found: %s", section.Path)
+	}
+
+	key, err := UnwrapKeyWithPassword(section.Encryption, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	encryptor, err := NewEncryptor(key, section.Encryption.ChunkSize)
+	if err != nil {
+		return "", err
+	}
+
+	info, exists := section.Encryption.Resources[section.Path]
+	if !exists {
+		return "", fmt.Errorf("section %s has no encryption parameters", section.Path)
+	}
+
+	plaintext, err := encryptor.DecryptResource(section.Path, ciphertext, info)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Helper functions
+
+func sealSection(id, label, content, passphrase string, iterations int) (*core.ConfidentialSection, []byte, error) {
+	key, err := GenerateContentKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptor, err := NewEncryptor(key, DefaultChunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := SectionDirectory + sanitizeSectionID(id) + ".enc"
+	ciphertext, resource, err := encryptor.EncryptResource(path, []byte(content))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt section %q: %v", id, err)
+	}
+	resource.PlaintextType = "text/html"
+
+	recipient, err := WrapKeyWithPassword(key, passphrase, iterations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &core.ConfidentialSection{
+		Label: label,
+		Path:  path,
+		Encryption: &core.EncryptionInfo{
+			Algorithm:  AlgorithmAES256GCM,
+			ChunkSize:  encryptor.ChunkSize(),
+			Recipients: []*core.KeyRecipient{recipient},
+			Resources:  map[string]*core.EncryptedResource{path: resource},
+		},
+	}, ciphertext, nil
+}
+
+func replaceWithPlaceholder(n *html.Node, id, label string) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		n.RemoveChild(child)
+		child = next
+	}
+
+	text := "Confidential section"
+	if label != "" {
+		text += ": " + label
+	}
+
+	placeholder := &html.Node{
+		Type: html.ElementNode,
+		Data: "div",
+		Attr: []html.Attribute{
+			{Key: "class", Val: "liv-redacted"},
+			{Key: "data-liv-section", Val: id},
+			{Key: "role", Val: "note"},
+		},
+	}
+	placeholder.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+	n.AppendChild(placeholder)
+}
+
+func innerHTML(n *html.Node) string {
+	var buf bytes.Buffer
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		html.Render(&buf, child)
+	}
+	return buf.String()
+}
+
+func attribute(n *html.Node, key string) (string, bool) {
+	if n.Type != html.ElementNode {
+		return "", false
+	}
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// walk visits nodes depth-first; returning false skips the node's children
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, visit)
+	}
+}
+
+func sanitizeSectionID(id string) string {
+	var b strings.Builder
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
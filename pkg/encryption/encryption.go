@@ -0,0 +1,507 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/liv-format/liv/pkg/core"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// AlgorithmAES256GCM is the only payload cipher currently supported
+	AlgorithmAES256GCM = "AES-256-GCM"
+
+	// KDFPBKDF2SHA256 derives key-encryption keys from passwords
+	KDFPBKDF2SHA256 = "PBKDF2-SHA256"
+
+	// KDFArgon2id derives key-encryption keys from passwords with a
+	// memory-hard function, making guessing on GPUs costly
+	KDFArgon2id = "argon2id"
+
+	// RecipientPassword wraps the content key with a password-derived key
+	RecipientPassword = "password"
+
+	// RecipientRSAOAEP wraps the content key with an RSA public key
+	RecipientRSAOAEP = "rsa-oaep-256"
+
+	// DefaultChunkSize is the plaintext size of each independently sealed chunk
+	DefaultChunkSize = 64 * 1024
+
+	// DefaultIterations is the PBKDF2 iteration count used for new recipients
+	DefaultIterations = 210000
+
+	// maxArgon2Memory bounds the memory in KiB a document may ask for, so
+	// opening a crafted document cannot exhaust the memory of the reader
+	maxArgon2Memory = 1024 * 1024
+
+	// KeySize is the size of content and key-encryption keys in bytes
+	KeySize = 32
+
+	// TagSize is the GCM authentication tag appended to every chunk
+	TagSize = 16
+
+	noncePrefixSize = 8
+	nonceSize       = 12
+	saltSize        = 16
+)
+
+// Argon2Params are the costs of deriving a key with Argon2id
+type Argon2Params struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is the memory used in KiB
+	Memory uint32
+	// Threads is the degree of parallelism
+	Threads uint8
+}
+
+// DefaultArgon2Params are the costs used for new recipients, the second
+// recommended option of RFC 9106 for memory-constrained environments
+var DefaultArgon2Params = Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// Encryptor seals and opens chunked resources with a single content key
+type Encryptor struct {
+	aead      cipher.AEAD
+	chunkSize int
+}
+
+// GenerateContentKey generates a random content key
+func GenerateContentKey() ([]byte, error) {
+	return randomBytes(KeySize)
+}
+
+// NewEncryptor creates an encryptor for the given content key and chunk size
+func NewEncryptor(key []byte, chunkSize int) (*Encryptor, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("content key must be %d bytes, got %d", KeySize, len(key))
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encryptor{aead: aead, chunkSize: chunkSize}, nil
+}
+
+// ChunkSize returns the plaintext chunk size
+func (e *Encryptor) ChunkSize() int {
+	return e.chunkSize
+}
+
+// EncryptResource seals a resource chunk by chunk. The resource path is bound
+// to every chunk as additional data so ciphertexts cannot be swapped between entries.
+func (e *Encryptor) EncryptResource(path string, plaintext []byte) ([]byte, *core.EncryptedResource, error) {
+	prefix, err := randomBytes(noncePrefixSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chunks := ChunkCount(int64(len(plaintext)), e.chunkSize)
+	out := make([]byte, 0, len(plaintext)+chunks*TagSize)
+
+	for i := 0; i < chunks; i++ {
+		start := i * e.chunkSize
+		end := start + e.chunkSize
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		out = e.aead.Seal(out, chunkNonce(prefix, i), plaintext[start:end], chunkAAD(path, i, i == chunks-1))
+	}
+
+	return out, &core.EncryptedResource{
+		NoncePrefix:   base64.StdEncoding.EncodeToString(prefix),
+		PlaintextSize: int64(len(plaintext)),
+	}, nil
+}
+
+// DecryptResource opens a complete encrypted resource
+func (e *Encryptor) DecryptResource(path string, ciphertext []byte, info *core.EncryptedResource) ([]byte, error) {
+	chunks := ChunkCount(info.PlaintextSize, e.chunkSize)
+	if int64(len(ciphertext)) != CiphertextSize(info.PlaintextSize, e.chunkSize) {
+		return nil, fmt.Errorf("ciphertext for %s has unexpected length %d", path, len(ciphertext))
+	}
+
+	plaintext := make([]byte, 0, info.PlaintextSize)
+	sealed := e.chunkSize + TagSize
+
+	for i := 0; i < chunks; i++ {
+		start := i * sealed
+		end := start + sealed
+		if end > len(ciphertext) {
+			end = len(ciphertext)
+		}
+		chunk, err := e.DecryptChunk(path, i, ciphertext[start:end], info)
+		if err != nil {
+			return nil, err
+		}
+		plaintext = append(plaintext, chunk...)
+	}
+
+	return plaintext, nil
+}
+
+// DecryptChunk opens a single sealed chunk, allowing ranges to be decrypted on demand
+func (e *Encryptor) DecryptChunk(path string, index int, chunk []byte, info *core.EncryptedResource) ([]byte, error) {
+	prefix, err := base64.StdEncoding.DecodeString(info.NoncePrefix)
+	if err != nil || len(prefix) != noncePrefixSize {
+		return nil, fmt.Errorf("invalid nonce prefix for %s", path)
+	}
+
+	chunks := ChunkCount(info.PlaintextSize, e.chunkSize)
+	if index < 0 || index >= chunks {
+		return nil, fmt.Errorf("chunk %d out of range for %s", index, path)
+	}
+
+	plaintext, err := e.aead.Open(nil, chunkNonce(prefix, index), chunk, chunkAAD(path, index, index == chunks-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt chunk %d of %s: authentication failed", index, path)
+	}
+
+	return plaintext, nil
+}
+
+// ChunkCount returns the number of chunks used for a plaintext of the given size.
+// Empty resources still produce a single authenticated chunk.
+func ChunkCount(plaintextSize int64, chunkSize int) int {
+	if plaintextSize == 0 {
+		return 1
+	}
+	return int((plaintextSize + int64(chunkSize) - 1) / int64(chunkSize))
+}
+
+// CiphertextSize returns the stored size of a resource with the given plaintext size
+func CiphertextSize(plaintextSize int64, chunkSize int) int64 {
+	return plaintextSize + int64(ChunkCount(plaintextSize, chunkSize))*TagSize
+}
+
+// ChunkRange maps an inclusive plaintext byte range onto the ciphertext byte range
+// that has to be fetched to decrypt it, returning the first chunk index as well.
+func ChunkRange(plaintextSize int64, chunkSize int, start, end int64) (cipherStart, cipherEnd int64, firstChunk int, err error) {
+	if plaintextSize == 0 {
+		return 0, TagSize - 1, 0, nil
+	}
+	if start < 0 || end < start || start >= plaintextSize {
+		return 0, 0, 0, fmt.Errorf("invalid plaintext range %d-%d", start, end)
+	}
+	if end >= plaintextSize {
+		end = plaintextSize - 1
+	}
+
+	sealed := int64(chunkSize + TagSize)
+	first := start / int64(chunkSize)
+	last := end / int64(chunkSize)
+
+	cipherStart = first * sealed
+	cipherEnd = (last+1)*sealed - 1
+	if total := CiphertextSize(plaintextSize, chunkSize); cipherEnd >= total {
+		cipherEnd = total - 1
+	}
+
+	return cipherStart, cipherEnd, int(first), nil
+}
+
+// WrapKeyWithPassword wraps a content key for a password recipient, deriving
+// the key-encryption key with PBKDF2
+func WrapKeyWithPassword(key []byte, password string, iterations int) (*core.KeyRecipient, error) {
+	if iterations <= 0 {
+		iterations = DefaultIterations
+	}
+	return wrapKeyWithPassword(key, password, &core.KeyRecipient{
+		Type:       RecipientPassword,
+		KDF:        KDFPBKDF2SHA256,
+		Iterations: iterations,
+	})
+}
+
+// WrapKeyWithArgon2id wraps a content key for a password recipient, deriving
+// the key-encryption key with Argon2id
+func WrapKeyWithArgon2id(key []byte, password string, params Argon2Params) (*core.KeyRecipient, error) {
+	if params.Time == 0 || params.Memory == 0 || params.Threads == 0 {
+		return nil, fmt.Errorf("argon2id costs must be positive")
+	}
+	if params.Memory > maxArgon2Memory {
+		return nil, fmt.Errorf("argon2id memory of %d KiB exceeds the limit of %d KiB", params.Memory, maxArgon2Memory)
+	}
+	return wrapKeyWithPassword(key, password, &core.KeyRecipient{
+		Type:        RecipientPassword,
+		KDF:         KDFArgon2id,
+		Iterations:  int(params.Time),
+		Memory:      params.Memory,
+		Parallelism: params.Threads,
+	})
+}
+
+// wrapKeyWithPassword seals a content key under a key derived from password
+// with the KDF and costs of recipient
+func wrapKeyWithPassword(key []byte, password string, recipient *core.KeyRecipient) (*core.KeyRecipient, error) {
+	if password == "" {
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+
+	salt, err := randomBytes(saltSize)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(nonceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, err := recipientKey(recipient, password, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient.Salt = base64.StdEncoding.EncodeToString(salt)
+	recipient.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	recipient.WrappedKey = base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, key, []byte(RecipientPassword)))
+	return recipient, nil
+}
+
+// WrapKeyForPublicKey wraps a content key for an RSA key holder
+func WrapKeyForPublicKey(key []byte, publicKey *rsa.PublicKey, keyID string) (*core.KeyRecipient, error) {
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap content key: %v", err)
+	}
+
+	return &core.KeyRecipient{
+		Type:       RecipientRSAOAEP,
+		KeyID:      keyID,
+		WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+	}, nil
+}
+
+// UnwrapKeyWithPassword recovers the content key using any password recipient
+func UnwrapKeyWithPassword(info *core.EncryptionInfo, password string) ([]byte, error) {
+	for _, recipient := range info.Recipients {
+		if recipient.Type != RecipientPassword {
+			continue
+		}
+
+		salt, err := base64.StdEncoding.DecodeString(recipient.Salt)
+		if err != nil {
+			continue
+		}
+		nonce, err := base64.StdEncoding.DecodeString(recipient.Nonce)
+		if err != nil {
+			continue
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(recipient.WrappedKey)
+		if err != nil {
+			continue
+		}
+
+		kek, err := recipientKey(recipient, password, salt)
+		if err != nil {
+			continue
+		}
+		aead, err := newGCM(kek)
+		if err != nil {
+			return nil, err
+		}
+		if key, err := aead.Open(nil, nonce, wrapped, []byte(RecipientPassword)); err == nil {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("password does not unlock this document")
+}
+
+// UnwrapKeyWithPrivateKey recovers the content key using an RSA private key
+func UnwrapKeyWithPrivateKey(info *core.EncryptionInfo, privateKey *rsa.PrivateKey) ([]byte, error) {
+	for _, recipient := range info.Recipients {
+		if recipient.Type != RecipientRSAOAEP {
+			continue
+		}
+
+		wrapped, err := base64.StdEncoding.DecodeString(recipient.WrappedKey)
+		if err != nil {
+			continue
+		}
+		if key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrapped, nil); err == nil {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("private key does not unlock this document")
+}
+
+// DeriveKey derives a key-encryption key from a password
+func DeriveKey(password string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(password), salt, iterations, KeySize, sha256.New)
+}
+
+// recipientKey derives the key-encryption key of a password recipient with
+// its KDF. Recipients without a KDF predate Argon2id and use PBKDF2.
+func recipientKey(recipient *core.KeyRecipient, password string, salt []byte) ([]byte, error) {
+	switch recipient.KDF {
+	case "", KDFPBKDF2SHA256:
+		if recipient.Iterations <= 0 {
+			return nil, fmt.Errorf("PBKDF2 iterations must be positive")
+		}
+		return DeriveKey(password, salt, recipient.Iterations), nil
+	case KDFArgon2id:
+		if recipient.Iterations <= 0 || recipient.Memory == 0 || recipient.Parallelism == 0 {
+			return nil, fmt.Errorf("argon2id costs must be positive")
+		}
+		if recipient.Memory > maxArgon2Memory {
+			return nil, fmt.Errorf("argon2id memory of %d KiB exceeds the limit of %d KiB", recipient.Memory, maxArgon2Memory)
+		}
+		return argon2.IDKey([]byte(password), salt, uint32(recipient.Iterations), recipient.Memory, recipient.Parallelism, KeySize), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function %q", recipient.KDF)
+	}
+}
+
+// EncryptPackage encrypts the given resources of an extracted package in place and
+// records the encryption parameters and ciphertext hashes in the manifest.
+// The manifest itself is never encrypted so viewers can discover how to decrypt.
+func EncryptPackage(files map[string][]byte, manifest *core.Manifest, paths []string, key []byte, chunkSize int, recipients ...*core.KeyRecipient) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("at least one key recipient is required")
+	}
+
+	encryptor, err := NewEncryptor(key, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	info := &core.EncryptionInfo{
+		Algorithm:  AlgorithmAES256GCM,
+		ChunkSize:  encryptor.ChunkSize(),
+		Recipients: recipients,
+		Resources:  make(map[string]*core.EncryptedResource),
+	}
+
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		if path == "manifest.json" {
+			return fmt.Errorf("manifest.json cannot be encrypted")
+		}
+		plaintext, exists := files[path]
+		if !exists {
+			return fmt.Errorf("resource not found: %s", path)
+		}
+
+		ciphertext, resource, err := encryptor.EncryptResource(path, plaintext)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %v", path, err)
+		}
+
+		if existing, ok := manifest.Resources[path]; ok {
+			resource.PlaintextType = existing.Type
+			existing.Hash = sha256Hex(ciphertext)
+			existing.Size = int64(len(ciphertext))
+			existing.Type = "application/octet-stream"
+		}
+
+		files[path] = ciphertext
+		info.Resources[path] = resource
+	}
+
+	manifest.Encryption = info
+	return nil
+}
+
+// DecryptPackage reverses EncryptPackage, restoring plaintext resources and manifest entries
+func DecryptPackage(files map[string][]byte, manifest *core.Manifest, key []byte) error {
+	if manifest.Encryption == nil {
+		return fmt.Errorf("document is not encrypted")
+	}
+
+	encryptor, err := NewEncryptor(key, manifest.Encryption.ChunkSize)
+	if err != nil {
+		return err
+	}
+
+	for path, info := range manifest.Encryption.Resources {
+		ciphertext, exists := files[path]
+		if !exists {
+			return fmt.Errorf("encrypted resource not found: %s", path)
+		}
+
+		plaintext, err := encryptor.DecryptResource(path, ciphertext, info)
+		if err != nil {
+			return err
+		}
+
+		if existing, ok := manifest.Resources[path]; ok {
+			existing.Hash = sha256Hex(plaintext)
+			existing.Size = int64(len(plaintext))
+			if info.PlaintextType != "" {
+				existing.Type = info.PlaintextType
+			}
+		}
+
+		files[path] = plaintext
+	}
+
+	manifest.Encryption = nil
+	return nil
+}
+
+// Helper functions
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %v", err)
+	}
+	return aead, nil
+}
+
+func chunkNonce(prefix []byte, index int) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], uint32(index))
+	return nonce
+}
+
+// chunkAAD binds the resource path, chunk position and final-chunk marker to each
+// chunk, so reordering, cross-resource substitution and truncation are detected.
+func chunkAAD(path string, index int, final bool) []byte {
+	aad := make([]byte, 0, len(path)+5)
+	aad = append(aad, path...)
+	aad = binary.BigEndian.AppendUint32(aad, uint32(index))
+	if final {
+		return append(aad, 1)
+	}
+	return append(aad, 0)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate random bytes: %v", err)
+	}
+	return b, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%x", sum)
+}
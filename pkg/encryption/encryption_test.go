@@ -0,0 +1,290 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func TestEncryptor_RoundTrip(t *testing.T) {
+	key, err := GenerateContentKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	encryptor, err := NewEncryptor(key, 1024)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+
+	sizes := []int{0, 1, 1023, 1024, 1025, 5000}
+	for _, size := range sizes {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		ciphertext, info, err := encryptor.EncryptResource("content/index.html", plaintext)
+		if err != nil {
+			t.Fatalf("Failed to encrypt %d bytes: %v", size, err)
+		}
+
+		if int64(len(ciphertext)) != CiphertextSize(int64(size), 1024) {
+			t.Errorf("Size %d: expected ciphertext size %d, got %d", size, CiphertextSize(int64(size), 1024), len(ciphertext))
+		}
+
+		decrypted, err := encryptor.DecryptResource("content/index.html", ciphertext, info)
+		if err != nil {
+			t.Fatalf("Failed to decrypt %d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Size %d: decrypted content does not match", size)
+		}
+	}
+}
+
+func TestEncryptor_RejectsTampering(t *testing.T) {
+	key, _ := GenerateContentKey()
+	encryptor, _ := NewEncryptor(key, 1024)
+
+	plaintext := bytes.Repeat([]byte("secret"), 500)
+	ciphertext, info, err := encryptor.EncryptResource("content/index.html", plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	// Decrypting under another path must fail
+	if _, err := encryptor.DecryptResource("content/other.html", ciphertext, info); err == nil {
+		t.Error("Expected decryption under a different path to fail")
+	}
+
+	// Flipping a bit must fail
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[10] ^= 0x01
+	if _, err := encryptor.DecryptResource("content/index.html", tampered, info); err == nil {
+		t.Error("Expected tampered ciphertext to fail")
+	}
+
+	// Truncating to a chunk boundary must fail
+	truncatedInfo := &core.EncryptedResource{NoncePrefix: info.NoncePrefix, PlaintextSize: 1024}
+	if _, err := encryptor.DecryptResource("content/index.html", ciphertext[:1024+TagSize], truncatedInfo); err == nil {
+		t.Error("Expected truncated ciphertext to fail")
+	}
+}
+
+func TestChunkRange_DecryptsOnDemand(t *testing.T) {
+	key, _ := GenerateContentKey()
+	encryptor, _ := NewEncryptor(key, 1024)
+
+	plaintext := make([]byte, 4000)
+	for i := range plaintext {
+		plaintext[i] = byte(i % 251)
+	}
+
+	ciphertext, info, err := encryptor.EncryptResource("assets/data.bin", plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	cipherStart, cipherEnd, first, err := ChunkRange(int64(len(plaintext)), 1024, 1500, 2100)
+	if err != nil {
+		t.Fatalf("ChunkRange failed: %v", err)
+	}
+
+	if first != 1 {
+		t.Errorf("Expected first chunk 1, got %d", first)
+	}
+
+	segment := ciphertext[cipherStart : cipherEnd+1]
+	sealed := 1024 + TagSize
+	var recovered []byte
+	for i := 0; i*sealed < len(segment); i++ {
+		end := (i + 1) * sealed
+		if end > len(segment) {
+			end = len(segment)
+		}
+		chunk, err := encryptor.DecryptChunk("assets/data.bin", first+i, segment[i*sealed:end], info)
+		if err != nil {
+			t.Fatalf("Failed to decrypt chunk %d: %v", first+i, err)
+		}
+		recovered = append(recovered, chunk...)
+	}
+
+	offset := 1500 - first*1024
+	if !bytes.Equal(recovered[offset:offset+601], plaintext[1500:2101]) {
+		t.Error("Range decryption returned wrong bytes")
+	}
+
+	if _, _, _, err := ChunkRange(int64(len(plaintext)), 1024, 5000, 6000); err == nil {
+		t.Error("Expected out-of-range request to fail")
+	}
+}
+
+func TestKeyWrapping(t *testing.T) {
+	key, _ := GenerateContentKey()
+
+	recipient, err := WrapKeyWithPassword(key, "correct horse", 1000)
+	if err != nil {
+		t.Fatalf("Failed to wrap key: %v", err)
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	rsaRecipient, err := WrapKeyForPublicKey(key, &privateKey.PublicKey, "reader-1")
+	if err != nil {
+		t.Fatalf("Failed to wrap key for public key: %v", err)
+	}
+
+	info := &core.EncryptionInfo{Recipients: []*core.KeyRecipient{recipient, rsaRecipient}}
+
+	unwrapped, err := UnwrapKeyWithPassword(info, "correct horse")
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("Password unwrap failed: %v", err)
+	}
+
+	if _, err := UnwrapKeyWithPassword(info, "wrong"); err == nil {
+		t.Error("Expected wrong password to fail")
+	}
+
+	unwrapped, err = UnwrapKeyWithPrivateKey(info, privateKey)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("Private key unwrap failed: %v", err)
+	}
+}
+
+func TestKeyWrapping_Argon2id(t *testing.T) {
+	key, _ := GenerateContentKey()
+	params := Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1}
+
+	recipient, err := WrapKeyWithArgon2id(key, "correct horse", params)
+	if err != nil {
+		t.Fatalf("Failed to wrap key: %v", err)
+	}
+	if recipient.KDF != KDFArgon2id || recipient.Memory != params.Memory || recipient.Parallelism != params.Threads {
+		t.Errorf("Expected the Argon2id costs to be recorded, got %+v", recipient)
+	}
+	legacy, _ := WrapKeyWithPassword(key, "battery staple", 1000)
+	info := &core.EncryptionInfo{Recipients: []*core.KeyRecipient{recipient, legacy}}
+
+	for _, password := range []string{"correct horse", "battery staple"} {
+		if unwrapped, err := UnwrapKeyWithPassword(info, password); err != nil || !bytes.Equal(unwrapped, key) {
+			t.Errorf("Unwrap with %q failed: %v", password, err)
+		}
+	}
+	if _, err := UnwrapKeyWithPassword(info, "wrong"); err == nil {
+		t.Error("Expected wrong password to fail")
+	}
+
+	// A crafted document must not make readers allocate unbounded memory
+	recipient.Memory = maxArgon2Memory + 1
+	if _, err := UnwrapKeyWithPassword(&core.EncryptionInfo{Recipients: []*core.KeyRecipient{recipient}}, "correct horse"); err == nil {
+		t.Error("Expected excessive Argon2id memory to be refused")
+	}
+	if _, err := WrapKeyWithArgon2id(key, "pw", Argon2Params{Time: 1, Memory: maxArgon2Memory + 1, Threads: 1}); err == nil {
+		t.Error("Expected excessive Argon2id memory to be refused when wrapping")
+	}
+}
+
+func TestEncryptPackage_RoundTrip(t *testing.T) {
+	files := map[string][]byte{
+		"manifest.json":      []byte("{}"),
+		"content/index.html": []byte("<h1>Confidential</h1>"),
+	}
+	manifest := &core.Manifest{
+		Resources: map[string]*core.Resource{
+			"content/index.html": {Path: "content/index.html", Type: "text/html", Size: 21},
+		},
+	}
+
+	key, _ := GenerateContentKey()
+	recipient, _ := WrapKeyWithPassword(key, "pw", 1000)
+
+	if err := EncryptPackage(files, manifest, []string{"content/index.html"}, key, 0, recipient); err != nil {
+		t.Fatalf("Failed to encrypt package: %v", err)
+	}
+
+	if bytes.Contains(files["content/index.html"], []byte("Confidential")) {
+		t.Error("Plaintext leaked into encrypted package")
+	}
+	if manifest.Resources["content/index.html"].Type != "application/octet-stream" {
+		t.Error("Expected encrypted resource to be typed as octet-stream")
+	}
+	if manifest.Encryption.Resources["content/index.html"].PlaintextType != "text/html" {
+		t.Error("Expected plaintext type to be preserved")
+	}
+
+	if err := EncryptPackage(files, manifest, []string{"manifest.json"}, key, 0, recipient); err == nil {
+		t.Error("Expected manifest encryption to be rejected")
+	}
+
+	if err := DecryptPackage(files, manifest, key); err != nil {
+		t.Fatalf("Failed to decrypt package: %v", err)
+	}
+
+	if string(files["content/index.html"]) != "<h1>Confidential</h1>" {
+		t.Error("Decrypted package content does not match")
+	}
+	if manifest.Encryption != nil {
+		t.Error("Expected encryption info to be removed")
+	}
+}
+
+func TestRedactSections(t *testing.T) {
+	page := `<html><body><h1>Report</h1>` +
+		`<section id="salaries" data-liv-confidential="salaries" data-liv-label="Compensation"><p>CEO earns 1M</p></section>` +
+		`<p>Public text</p></body></html>`
+	files := map[string][]byte{
+		"content/index.html":           []byte(page),
+		"content/static/fallback.html": []byte(page),
+	}
+	manifest := &core.Manifest{
+		Resources: map[string]*core.Resource{
+			"content/index.html": {Path: "content/index.html", Type: "text/html"},
+		},
+	}
+
+	if err := RedactSections(files, manifest, map[string]string{}, 1000); err == nil {
+		t.Fatal("Expected missing section key to fail")
+	}
+
+	if err := RedactSections(files, manifest, map[string]string{"salaries": "board-only"}, 1000); err != nil {
+		t.Fatalf("Failed to redact sections: %v", err)
+	}
+
+	for _, path := range []string{"content/index.html", "content/static/fallback.html"} {
+		content := string(files[path])
+		if bytes.Contains(files[path], []byte("CEO earns")) {
+			t.Errorf("%s still contains confidential text", path)
+		}
+		if !bytes.Contains(files[path], []byte(`data-liv-section="salaries"`)) || !bytes.Contains(files[path], []byte("Compensation")) {
+			t.Errorf("%s is missing the placeholder: %s", path, content)
+		}
+		if !bytes.Contains(files[path], []byte("Public text")) {
+			t.Errorf("%s lost public content", path)
+		}
+	}
+
+	section := manifest.Disclosure.Sections["salaries"]
+	if section == nil {
+		t.Fatal("Expected section to be recorded in manifest")
+	}
+	if _, ok := manifest.Resources[section.Path]; !ok {
+		t.Error("Expected section ciphertext to be registered as a resource")
+	}
+
+	unlocked, err := UnlockSection(files, section, "board-only")
+	if err != nil {
+		t.Fatalf("Failed to unlock section: %v", err)
+	}
+	if unlocked != "<p>CEO earns 1M</p>" {
+		t.Errorf("Unexpected unlocked content: %q", unlocked)
+	}
+
+	if _, err := UnlockSection(files, section, "wrong"); err == nil {
+		t.Error("Expected wrong section key to fail")
+	}
+}
@@ -0,0 +1,380 @@
+// Package health revalidates stored documents after upload. Documents can turn
+// invalid long after they were accepted: storage corrupts, signing certificates
+// expire or are revoked. The Checker inspects one document and the Monitor
+// revalidates a whole store on a schedule, alerting when a document degrades.
+//
+// Signatures are read from the package layout written by the container
+// package: signatures/manifest.sig, signatures/content.sig and one
+// signatures/<module>.sig per WASM module, with their algorithm in
+// signatures/algorithm. The signer's X.509 certificate is read from
+// signatures/certificate.pem. An RFC 3161 timestamp token in
+// signatures/timestamp.tsr proves when the document was signed, so its
+// signatures stay valid after the certificate expires.
+package health
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// CertificateEntry is the package path of the signer certificate
+const CertificateEntry = "signatures/certificate.pem"
+
+// AlgorithmEntry is the package path of the signature algorithm, absent from
+// packages signed with RSA before it was recorded
+const AlgorithmEntry = "signatures/algorithm"
+
+// Status is the health of a document, ordered from best to worst
+type Status string
+
+const (
+	StatusHealthy Status = "healthy"
+	StatusWarning Status = "warning"
+	StatusInvalid Status = "invalid"
+)
+
+// Worse reports whether s is a worse status than other. An empty status counts
+// as healthy.
+func (s Status) Worse(other Status) bool {
+	return s.rank() > other.rank()
+}
+
+func (s Status) rank() int {
+	switch s {
+	case StatusWarning:
+		return 1
+	case StatusInvalid:
+		return 2
+	}
+	return 0
+}
+
+// Checks performed on every document
+const (
+	CheckStorage     = "storage"
+	CheckManifest    = "manifest"
+	CheckResources   = "resources"
+	CheckSignature   = "signature"
+	CheckCertificate = "certificate"
+)
+
+// Issue is a single problem found while checking a document
+type Issue struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+// Report is the result of checking one document
+type Report struct {
+	ID                 string     `json:"id"`
+	Filename           string     `json:"filename"`
+	Status             Status     `json:"status"`
+	Checked            time.Time  `json:"checked"`
+	Signed             bool       `json:"signed"`
+	Signer             string     `json:"signer,omitempty"`
+	CertificateExpires *time.Time `json:"certificate_expires,omitempty"`
+	// SignedAt is the signing time attested by a valid timestamp from an
+	// authority that chains to TimestampRoots
+	SignedAt         *time.Time `json:"signed_at,omitempty"`
+	ResourcesChecked int        `json:"resources_checked"`
+	Issues           []Issue    `json:"issues"`
+}
+
+func (r *Report) add(check string, status Status, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Check: check, Status: status, Message: fmt.Sprintf(format, args...)})
+	if status.Worse(r.Status) {
+		r.Status = status
+	}
+}
+
+// Checker revalidates stored documents
+type Checker struct {
+	// Trust holds the revoked certificates and trusted roots. Certificate
+	// chains are only verified when it has roots; expiry is always checked.
+	Trust *integrity.TrustStore
+	// TimestampRoots are the roots timestamping authorities must chain to;
+	// with nil, timestamps are reported untrusted and expiry is checked now
+	TimestampRoots *x509.CertPool
+	// ExpiryWarning is how long before a certificate expires it is reported
+	ExpiryWarning time.Duration
+	// SpotChecks is the number of resources re-hashed per check; 0 checks all
+	SpotChecks int
+	// ClockSkew is how far the clock of the checker may disagree with that
+	// of the signer before certificates are taken to be outside their
+	// validity period, or signing times to be in the future
+	ClockSkew time.Duration
+	// Now returns the current time
+	Now func() time.Time
+}
+
+// NewChecker creates a checker that warns 30 days before certificates expire,
+// spot-checks up to 8 resources per document and tolerates the default clock
+// skew
+func NewChecker() *Checker {
+	return &Checker{
+		ExpiryWarning: 30 * 24 * time.Hour,
+		SpotChecks:    8,
+		ClockSkew:     core.DefaultClockSkew,
+		Now:           time.Now,
+	}
+}
+
+// Check revalidates an open stored document
+func (c *Checker) Check(doc store.Document) *Report {
+	info := doc.Info()
+	report := &Report{
+		ID:       info.ID,
+		Filename: info.Filename,
+		Status:   StatusHealthy,
+		Checked:  c.Now(),
+		Issues:   []Issue{},
+	}
+
+	// The stored bytes must still match the hash recorded at upload
+	if _, err := doc.Seek(0, io.SeekStart); err != nil {
+		report.add(CheckStorage, StatusInvalid, "failed to read document: %v", err)
+		return report
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, doc); err != nil {
+		report.add(CheckStorage, StatusInvalid, "failed to read document: %v", err)
+		return report
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != info.SHA256 {
+		report.add(CheckStorage, StatusInvalid, "stored document changed since upload (sha256 %s, expected %s)", sum, info.SHA256)
+		return report
+	}
+
+	reader, err := zip.NewReader(doc, info.Size)
+	if err != nil {
+		report.add(CheckStorage, StatusInvalid, "invalid document package: %v", err)
+		return report
+	}
+	data, err := readEntry(reader, "manifest.json")
+	if err != nil {
+		report.add(CheckManifest, StatusInvalid, "manifest.json not found")
+		return report
+	}
+	m, err := manifest.NewManifestParser().ParseFromBytes(data)
+	if err != nil {
+		report.add(CheckManifest, StatusInvalid, "invalid manifest: %v", err)
+		return report
+	}
+
+	c.checkResources(report, reader, m)
+	c.checkSignatures(report, reader, m)
+	return report
+}
+
+// checkResources re-hashes a random sample of the resources listed in the
+// manifest. Sampling keeps large libraries cheap to revalidate while every
+// resource is still covered over repeated runs.
+func (c *Checker) checkResources(report *Report, reader *zip.Reader, m *core.Manifest) {
+	var paths []string
+	for resourcePath, resource := range m.Resources {
+		if resource != nil && resource.Hash != "" {
+			paths = append(paths, resourcePath)
+		}
+	}
+	sort.Strings(paths)
+	if c.SpotChecks > 0 && len(paths) > c.SpotChecks {
+		rand.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+		paths = paths[:c.SpotChecks]
+		sort.Strings(paths)
+	}
+
+	for _, resourcePath := range paths {
+		data, err := readEntry(reader, resourcePath)
+		if err != nil {
+			report.add(CheckResources, StatusInvalid, "resource %s is missing", resourcePath)
+			continue
+		}
+		report.ResourcesChecked++
+
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), m.Resources[resourcePath].Hash) {
+			report.add(CheckResources, StatusInvalid, "resource %s does not match its manifest hash", resourcePath)
+		}
+	}
+}
+
+// checkSignatures verifies the document signatures with the signer
+// certificate and checks the certificate against the current trust state
+func (c *Checker) checkSignatures(report *Report, reader *zip.Reader, m *core.Manifest) {
+	signatures := readSignatures(reader)
+	if signatures == nil {
+		return
+	}
+	report.Signed = true
+
+	certPEM, err := readEntry(reader, CertificateEntry)
+	if err != nil {
+		report.add(CheckSignature, StatusWarning, "document is signed but has no signer certificate, so its signatures cannot be verified")
+		return
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		report.add(CheckCertificate, StatusInvalid, "invalid signer certificate: %v", err)
+		return
+	}
+	report.Signer = cert.Subject.String()
+	expires := cert.NotAfter
+	report.CertificateExpires = &expires
+
+	if _, err := integrity.AlgorithmForKey(cert.PublicKey); err != nil {
+		report.add(CheckSignature, StatusInvalid, "signer certificate key cannot verify signatures: %v", err)
+		return
+	}
+	document := &core.LIVDocument{
+		Manifest:    m,
+		Content:     readContent(reader),
+		WASMModules: readWASMModules(reader),
+		Signatures:  signatures,
+	}
+	sm := integrity.NewSignatureManager()
+	sm.SetTimestampRoots(c.TimestampRoots)
+	sm.SetClockSkew(c.ClockSkew)
+	sm.SetClock(c.Now)
+	result := sm.VerifyDocument(document, cert.PublicKey)
+	if !result.Valid {
+		for _, message := range result.Errors {
+			report.add(CheckSignature, StatusInvalid, "%s", message)
+		}
+	}
+	for _, message := range result.Warnings {
+		report.add(CheckSignature, StatusWarning, "%s", message)
+	}
+	// A timestamp only outlives the certificate when its authority is
+	// trusted; anyone can make a certificate for timestamping
+	if result.TimestampTrusted {
+		report.SignedAt = result.Timestamp
+	}
+
+	now := c.Now()
+	switch {
+	case c.Trust != nil && c.Trust.IsCertificateRevoked(cert):
+		report.add(CheckCertificate, StatusInvalid, "signer certificate %s has been revoked", cert.SerialNumber)
+	case report.SignedAt != nil:
+		// The certificate only had to be valid when the document was signed
+		signedAt := *report.SignedAt
+		if signedAt.Add(c.ClockSkew).Before(cert.NotBefore) || signedAt.Add(-c.ClockSkew).After(cert.NotAfter) {
+			report.add(CheckCertificate, StatusInvalid, "signer certificate was not valid when the document was signed on %s", signedAt.Format(time.RFC3339))
+		} else if c.Trust != nil && c.Trust.HasRoots() {
+			if err := c.Trust.ValidateCertificateChainAt(cert, signedAt); err != nil {
+				report.add(CheckCertificate, StatusInvalid, "signer certificate is not trusted: %v", err)
+			}
+		}
+	case now.Add(-c.ClockSkew).After(cert.NotAfter):
+		report.add(CheckCertificate, StatusInvalid, "signer certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	case now.Add(c.ClockSkew).Before(cert.NotBefore):
+		report.add(CheckCertificate, StatusInvalid, "signer certificate is not valid until %s", cert.NotBefore.Format(time.RFC3339))
+	default:
+		if c.Trust != nil && c.Trust.HasRoots() {
+			if err := c.Trust.ValidateCertificateChain(cert); err != nil {
+				report.add(CheckCertificate, StatusInvalid, "signer certificate is not trusted: %v", err)
+			}
+		}
+		if cert.NotAfter.Sub(now) < c.ExpiryWarning {
+			report.add(CheckCertificate, StatusWarning, "signer certificate expires on %s", cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// readSignatures returns the signatures stored in a package, or nil for an
+// unsigned package
+func readSignatures(reader *zip.Reader) *core.SignatureBundle {
+	signatures := &core.SignatureBundle{WASMSignatures: make(map[string]string)}
+	signed := false
+	for _, file := range reader.File {
+		if path.Dir(file.Name) != "signatures" || path.Ext(file.Name) != ".sig" {
+			continue
+		}
+		data, err := readEntry(reader, file.Name)
+		if err != nil {
+			continue
+		}
+		signed = true
+
+		switch name := strings.TrimSuffix(path.Base(file.Name), ".sig"); name {
+		case "manifest":
+			signatures.ManifestSignature = string(data)
+		case "content":
+			signatures.ContentSignature = string(data)
+		default:
+			signatures.WASMSignatures[name] = string(data)
+		}
+	}
+	if !signed {
+		return nil
+	}
+	if algorithm, err := readEntry(reader, AlgorithmEntry); err == nil {
+		signatures.Algorithm = strings.TrimSpace(string(algorithm))
+	}
+	if token, err := readEntry(reader, container.TimestampEntry); err == nil {
+		signatures.Timestamp = token
+	}
+	return signatures
+}
+
+// readContent collects the content parts covered by the content signature, from
+// the paths the container package writes them to
+func readContent(reader *zip.Reader) *core.DocumentContent {
+	entry := func(name string) string {
+		data, _ := readEntry(reader, name)
+		return string(data)
+	}
+	return &core.DocumentContent{
+		HTML:            entry("content/index.html"),
+		CSS:             entry("content/styles/main.css"),
+		InteractiveSpec: entry("content/scripts/main.js"),
+		StaticFallback:  entry("content/static/fallback.html"),
+	}
+}
+
+func readWASMModules(reader *zip.Reader) map[string][]byte {
+	modules := make(map[string][]byte)
+	for _, file := range reader.File {
+		if path.Ext(file.Name) != ".wasm" {
+			continue
+		}
+		if data, err := readEntry(reader, file.Name); err == nil {
+			modules[strings.TrimSuffix(path.Base(file.Name), ".wasm")] = data
+		}
+	}
+	return modules
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func readEntry(reader *zip.Reader, name string) ([]byte, error) {
+	file, err := reader.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
@@ -0,0 +1,498 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/store"
+	"github.com/liv-format/liv/pkg/tsa/tsatest"
+)
+
+// testPKI is a root CA and a signing certificate issued by it
+type testPKI struct {
+	rootPEM []byte
+	certPEM []byte
+	cert    *x509.Certificate
+	key     crypto.Signer
+}
+
+func newTestPKI(t *testing.T, notAfter time.Time) *testPKI {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestPKIWithKey(t, notAfter, key)
+}
+
+func newTestPKIWithKey(t *testing.T, notAfter time.Time, key crypto.Signer) *testPKI {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0x2a),
+		Subject:      pkix.Name{CommonName: "ACME Publishing"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, key.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testPKI{
+		rootPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}),
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		cert:    cert,
+		key:     key,
+	}
+}
+
+// createPackage builds a package whose manifest hashes match its files. When
+// pki is given the package is signed and carries the signer certificate.
+func createPackage(t *testing.T, pki *testPKI, tamper func(files map[string][]byte)) []byte {
+	files := map[string][]byte{
+		"content/index.html":      []byte("<h1>Report</h1>"),
+		"content/styles/main.css": []byte("h1 { color: navy; }"),
+	}
+
+	builder := manifest.CreateStaticDocumentTemplate("Quarterly Report", "ACME Corp")
+	for path, data := range files {
+		sum := sha256.Sum256(data)
+		builder.AddResource(path, &core.Resource{Hash: hex.EncodeToString(sum[:]), Size: int64(len(data)), Type: "text/plain", Path: path})
+	}
+	manifestJSON, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["manifest.json"] = manifestJSON
+
+	if pki != nil {
+		// Sign the manifest as it will be parsed back from the package
+		parsed, err := manifest.NewManifestParser().ParseFromBytes(manifestJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		document := &core.LIVDocument{
+			Manifest: parsed,
+			Content:  &core.DocumentContent{HTML: string(files["content/index.html"]), CSS: string(files["content/styles/main.css"])},
+		}
+		signatures, err := integrity.NewSignatureManager().SignDocument(document, pki.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["signatures/manifest.sig"] = []byte(signatures.ManifestSignature)
+		files["signatures/content.sig"] = []byte(signatures.ContentSignature)
+		files[CertificateEntry] = pki.certPEM
+		// RSA packages keep the layout from before the algorithm was recorded
+		if signatures.Algorithm != string(integrity.AlgorithmRSASHA256) {
+			files[AlgorithmEntry] = []byte(signatures.Algorithm)
+		}
+	}
+
+	if tamper != nil {
+		tamper(files)
+	}
+
+	var buf bytes.Buffer
+	if err := container.NewZIPContainer().CreateFromFilesToWriter(files, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func putPackage(t *testing.T, s store.DocumentStore, data []byte) *store.DocumentInfo {
+	info, err := s.Put("report.liv", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func checkStored(t *testing.T, s store.DocumentStore, checker *Checker, id string) *Report {
+	doc, err := s.Open(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+	return checker.Check(doc)
+}
+
+func hasIssue(report *Report, check string, status Status) bool {
+	for _, issue := range report.Issues {
+		if issue.Check == check && issue.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckUnsignedDocument(t *testing.T) {
+	s, _ := store.NewFileStore(t.TempDir(), 0)
+	info := putPackage(t, s, createPackage(t, nil, nil))
+
+	report := checkStored(t, s, NewChecker(), info.ID)
+	if report.Status != StatusHealthy || report.Signed || len(report.Issues) != 0 {
+		t.Errorf("Expected a healthy unsigned document, got %+v", report)
+	}
+	if report.ResourcesChecked != 2 {
+		t.Errorf("Expected both resources to be checked, got %d", report.ResourcesChecked)
+	}
+}
+
+func TestCheckDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := store.NewFileStore(dir, 0)
+
+	// A resource that no longer matches its manifest hash
+	tampered := putPackage(t, s, createPackage(t, nil, func(files map[string][]byte) {
+		files["content/index.html"] = []byte("<h1>Altered</h1>")
+	}))
+	report := checkStored(t, s, NewChecker(), tampered.ID)
+	if report.Status != StatusInvalid || !hasIssue(report, CheckResources, StatusInvalid) {
+		t.Errorf("Expected a resource hash mismatch, got %+v", report)
+	}
+
+	// Stored bytes that changed on disk after upload
+	info := putPackage(t, s, createPackage(t, nil, nil))
+	matches, _ := filepath.Glob(filepath.Join(dir, info.ID+".liv"))
+	if len(matches) != 1 {
+		t.Fatalf("Stored document not found in %s", dir)
+	}
+	data, _ := os.ReadFile(matches[0])
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(matches[0], data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	report = checkStored(t, s, NewChecker(), info.ID)
+	if report.Status != StatusInvalid || !hasIssue(report, CheckStorage, StatusInvalid) {
+		t.Errorf("Expected a storage integrity failure, got %+v", report)
+	}
+}
+
+func TestCheckSignatures(t *testing.T) {
+	pki := newTestPKI(t, time.Now().Add(365*24*time.Hour))
+	s, _ := store.NewFileStore(t.TempDir(), 0)
+
+	trust := integrity.NewTrustStore()
+	trust.AddRootCA(mustParse(t, pki.rootPEM))
+	checker := NewChecker()
+	checker.Trust = trust
+
+	signed := putPackage(t, s, createPackage(t, pki, nil))
+	report := checkStored(t, s, checker, signed.ID)
+	if report.Status != StatusHealthy || !report.Signed || report.Signer != "CN=ACME Publishing" {
+		t.Fatalf("Expected a healthy signed document, got %+v", report)
+	}
+
+	altered := putPackage(t, s, createPackage(t, pki, func(files map[string][]byte) {
+		files["content/styles/main.css"] = []byte("h1 { color: red; }")
+	}))
+	report = checkStored(t, s, checker, altered.ID)
+	if !hasIssue(report, CheckSignature, StatusInvalid) {
+		t.Errorf("Expected altered content to fail signature verification, got %+v", report)
+	}
+
+	// The same document turns invalid once its certificate is revoked
+	trust.RevokeCertificate(pki.cert.SerialNumber.String())
+	report = checkStored(t, s, checker, signed.ID)
+	if report.Status != StatusInvalid || !hasIssue(report, CheckCertificate, StatusInvalid) {
+		t.Errorf("Expected a revoked certificate, got %+v", report)
+	}
+
+	// Certificates from unknown issuers are not trusted
+	other := integrity.NewTrustStore()
+	other.AddRootCA(mustParse(t, newTestPKI(t, time.Now().Add(time.Hour)).rootPEM))
+	checker.Trust = other
+	if report := checkStored(t, s, checker, signed.ID); !hasIssue(report, CheckCertificate, StatusInvalid) {
+		t.Errorf("Expected an untrusted certificate, got %+v", report)
+	}
+
+	unverifiable := putPackage(t, s, createPackage(t, pki, func(files map[string][]byte) {
+		delete(files, CertificateEntry)
+	}))
+	if report := checkStored(t, s, NewChecker(), unverifiable.ID); report.Status != StatusWarning || !report.Signed {
+		t.Errorf("Expected a warning for signatures without a certificate, got %+v", report)
+	}
+}
+
+func TestCheckECDSASignatures(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki := newTestPKIWithKey(t, time.Now().Add(365*24*time.Hour), key)
+	s, _ := store.NewFileStore(t.TempDir(), 0)
+
+	trust := integrity.NewTrustStore()
+	trust.AddRootCA(mustParse(t, pki.rootPEM))
+	checker := NewChecker()
+	checker.Trust = trust
+
+	signed := putPackage(t, s, createPackage(t, pki, nil))
+	if report := checkStored(t, s, checker, signed.ID); report.Status != StatusHealthy || !report.Signed {
+		t.Fatalf("Expected a healthy ECDSA signed document, got %+v", report)
+	}
+
+	// Without the algorithm the signatures are taken to be RSA
+	legacy := putPackage(t, s, createPackage(t, pki, func(files map[string][]byte) {
+		delete(files, AlgorithmEntry)
+	}))
+	if report := checkStored(t, s, checker, legacy.ID); !hasIssue(report, CheckSignature, StatusInvalid) {
+		t.Errorf("Expected ECDSA signatures without an algorithm to fail verification, got %+v", report)
+	}
+}
+
+func TestCheckCertificateExpiry(t *testing.T) {
+	pki := newTestPKI(t, time.Now().Add(365*24*time.Hour))
+	s, _ := store.NewFileStore(t.TempDir(), 0)
+	info := putPackage(t, s, createPackage(t, pki, nil))
+
+	checker := NewChecker()
+	checker.Now = func() time.Time { return pki.cert.NotAfter.Add(-10 * 24 * time.Hour) }
+	report := checkStored(t, s, checker, info.ID)
+	if report.Status != StatusWarning || !hasIssue(report, CheckCertificate, StatusWarning) {
+		t.Errorf("Expected an expiry warning, got %+v", report)
+	}
+	if report.CertificateExpires == nil || !report.CertificateExpires.Equal(pki.cert.NotAfter) {
+		t.Errorf("Expected the certificate expiry in the report")
+	}
+
+	checker.Now = func() time.Time { return pki.cert.NotAfter.Add(time.Hour) }
+	report = checkStored(t, s, checker, info.ID)
+	if report.Status != StatusInvalid || !hasIssue(report, CheckCertificate, StatusInvalid) {
+		t.Errorf("Expected an expired certificate, got %+v", report)
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	pki := newTestPKI(t, time.Now().Add(365*24*time.Hour))
+	s, _ := store.NewFileStore(t.TempDir(), 0)
+	info := putPackage(t, s, createPackage(t, pki, nil))
+
+	// A checker whose clock is a little past the expiry of the certificate
+	// still takes it to be valid
+	checker := NewChecker()
+	checker.Now = func() time.Time { return pki.cert.NotAfter.Add(2 * time.Minute) }
+	if report := checkStored(t, s, checker, info.ID); hasIssue(report, CheckCertificate, StatusInvalid) {
+		t.Errorf("Expected the certificate to be valid within the clock skew, got %+v", report)
+	}
+	checker.ClockSkew = 0
+	if report := checkStored(t, s, checker, info.ID); !hasIssue(report, CheckCertificate, StatusInvalid) {
+		t.Errorf("Expected an expired certificate without clock skew, got %+v", report)
+	}
+
+	// A checker whose clock is an hour behind sees the document made in
+	// the future
+	checker = NewChecker()
+	checker.Now = func() time.Time { return time.Now().Add(-time.Hour) }
+	report := checkStored(t, s, checker, info.ID)
+	if report.Status != StatusWarning || !hasIssue(report, CheckSignature, StatusWarning) {
+		t.Errorf("Expected a warning for document times in the future, got %+v", report)
+	}
+}
+
+func TestCheckTimestampedSignatures(t *testing.T) {
+	server, err := tsatest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	pki := newTestPKI(t, time.Now().Add(365*24*time.Hour))
+	s, _ := store.NewFileStore(t.TempDir(), 0)
+	// timestamp adds a token from the authority over the signatures of a package
+	timestamp := func(files map[string][]byte) {
+		signatures := &core.SignatureBundle{
+			ManifestSignature: string(files["signatures/manifest.sig"]),
+			ContentSignature:  string(files["signatures/content.sig"]),
+			Algorithm:         string(files[AlgorithmEntry]),
+		}
+		token, err := server.Client().Timestamp(context.Background(), integrity.TimestampedData(signatures))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[container.TimestampEntry] = token
+	}
+
+	trust := integrity.NewTrustStore()
+	trust.AddRootCA(mustParse(t, pki.rootPEM))
+	checker := NewChecker()
+	checker.Trust = trust
+	checker.TimestampRoots = server.Roots()
+	checker.Now = func() time.Time { return pki.cert.NotAfter.Add(30 * 24 * time.Hour) }
+
+	// Signed and timestamped while the certificate was valid
+	info := putPackage(t, s, createPackage(t, pki, timestamp))
+	report := checkStored(t, s, checker, info.ID)
+	if report.Status != StatusHealthy || report.SignedAt == nil {
+		t.Fatalf("Expected a timestamped document to outlive its certificate, got %+v", report)
+	}
+
+	// Timestamped after the certificate expired
+	server.SetTime(pki.cert.NotAfter.Add(time.Hour))
+	late := putPackage(t, s, createPackage(t, pki, timestamp))
+	if report := checkStored(t, s, checker, late.ID); !hasIssue(report, CheckCertificate, StatusInvalid) {
+		t.Errorf("Expected a timestamp after expiry to be rejected, got %+v", report)
+	}
+
+	// A token over other signatures
+	forged := putPackage(t, s, createPackage(t, pki, func(files map[string][]byte) {
+		timestamp(files)
+		files["signatures/content.sig"] = files["signatures/manifest.sig"]
+	}))
+	if report := checkStored(t, s, checker, forged.ID); !hasIssue(report, CheckSignature, StatusInvalid) || report.SignedAt != nil {
+		t.Errorf("Expected a mismatched timestamp to be rejected, got %+v", report)
+	}
+
+	// Without roots, a self-signed authority backdating the token does not
+	// keep the expired certificate valid
+	selfSigned, err := tsatest.NewSelfSignedServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer selfSigned.Close()
+	selfSigned.SetTime(pki.cert.NotAfter.Add(-time.Hour))
+	server = selfSigned
+	checker.TimestampRoots = nil
+	backdated := putPackage(t, s, createPackage(t, pki, timestamp))
+	report = checkStored(t, s, checker, backdated.ID)
+	if !hasIssue(report, CheckCertificate, StatusInvalid) || !hasIssue(report, CheckSignature, StatusWarning) || report.SignedAt != nil {
+		t.Errorf("Expected an untrusted timestamp to leave the expired certificate invalid, got %+v", report)
+	}
+}
+
+func mustParse(t *testing.T, data []byte) *x509.Certificate {
+	cert, err := parseCertificate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+type recordingAlerter struct {
+	alerts []Status
+}
+
+func (a *recordingAlerter) Alert(report *Report, previous Status) error {
+	a.alerts = append(a.alerts, report.Status)
+	return nil
+}
+
+func TestMonitorAlertsWhenDocumentsDegrade(t *testing.T) {
+	pki := newTestPKI(t, time.Now().Add(365*24*time.Hour))
+	s, _ := store.NewFileStore(t.TempDir(), 0)
+	signed := putPackage(t, s, createPackage(t, pki, nil))
+	unsigned := putPackage(t, s, createPackage(t, nil, nil))
+
+	dir := t.TempDir()
+	roots := filepath.Join(dir, "roots.pem")
+	revoked := filepath.Join(dir, "revoked.txt")
+	os.WriteFile(roots, pki.rootPEM, 0644)
+	os.WriteFile(revoked, []byte("# revoked signing certificates\n"), 0644)
+
+	alerter := &recordingAlerter{}
+	monitor := NewMonitor(s, NewChecker(), TrustConfig{RootsFile: roots, RevocationFile: revoked}).AddAlerter(alerter)
+
+	if err := monitor.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if summary := monitor.Summary(); summary.Documents != 2 || summary.Healthy != 2 || summary.LastRun.IsZero() {
+		t.Errorf("Expected two healthy documents, got %+v", summary)
+	}
+	if len(alerter.alerts) != 0 {
+		t.Errorf("Expected no alerts for healthy documents, got %v", alerter.alerts)
+	}
+
+	// Revoking the certificate takes effect on the next run without a restart
+	os.WriteFile(revoked, []byte("0x2a\n"), 0644)
+	monitor.RunOnce()
+	monitor.RunOnce()
+	if len(alerter.alerts) != 1 || alerter.alerts[0] != StatusInvalid {
+		t.Errorf("Expected a single alert when the document turned invalid, got %v", alerter.alerts)
+	}
+	if report, _ := monitor.Report(signed.ID); report.Status != StatusInvalid {
+		t.Errorf("Expected the signed document to be invalid, got %+v", report)
+	}
+	reports := monitor.Reports()
+	if len(reports) != 2 || reports[0].ID != signed.ID {
+		t.Errorf("Expected the invalid document to be listed first")
+	}
+
+	// Deleted documents are dropped from the dashboard
+	s.Delete(unsigned.ID)
+	monitor.RunOnce()
+	if _, exists := monitor.Report(unsigned.ID); exists || monitor.Summary().Documents != 1 {
+		t.Errorf("Expected the deleted document to be forgotten")
+	}
+
+	os.WriteFile(revoked, []byte("not-a-serial\n"), 0644)
+	if err := monitor.RunOnce(); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected an invalid revocation list to be reported, got %v", err)
+	}
+}
+
+func TestWebhookAlerter(t *testing.T) {
+	var received webhookAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	report := &Report{ID: "0123", Status: StatusInvalid, Issues: []Issue{{Check: CheckCertificate, Status: StatusInvalid, Message: "revoked"}}}
+	if err := (&WebhookAlerter{URL: server.URL}).Alert(report, StatusHealthy); err != nil {
+		t.Fatal(err)
+	}
+	if received.Event != "document.health" || received.Previous != StatusHealthy || received.Report.ID != "0123" {
+		t.Errorf("Unexpected webhook body: %+v", received)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := (&WebhookAlerter{URL: failing.URL}).Alert(report, StatusHealthy); err == nil {
+		t.Errorf("Expected failed deliveries to be reported")
+	}
+}
@@ -0,0 +1,337 @@
+package health
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// Alerter is notified when a document's health gets worse
+type Alerter interface {
+	Alert(report *Report, previous Status) error
+}
+
+// LogAlerter writes alerts to the standard logger
+type LogAlerter struct{}
+
+// Alert logs the report and its issues
+func (LogAlerter) Alert(report *Report, previous Status) error {
+	messages := make([]string, len(report.Issues))
+	for i, issue := range report.Issues {
+		messages[i] = issue.Message
+	}
+	log.Printf("document health: %s (%s) is %s: %s", report.ID, report.Filename, report.Status, strings.Join(messages, "; "))
+	return nil
+}
+
+// WebhookAlerter posts alerts as JSON to a URL
+type WebhookAlerter struct {
+	URL    string
+	Client *http.Client
+}
+
+// webhookAlert is the body of a webhook alert
+type webhookAlert struct {
+	Event    string  `json:"event"`
+	Previous Status  `json:"previous,omitempty"`
+	Report   *Report `json:"report"`
+}
+
+// Alert posts the report to the webhook
+func (a *WebhookAlerter) Alert(report *Report, previous Status) error {
+	body, err := json.Marshal(&webhookAlert{Event: "document.health", Previous: previous, Report: report})
+	if err != nil {
+		return err
+	}
+
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Post(a.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to deliver alert: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// TrustConfig names the files holding the trust state. They are reloaded
+// before every run, so revocations take effect without a restart.
+type TrustConfig struct {
+	// RootsFile holds PEM-encoded trusted root certificates
+	RootsFile string
+	// RevocationFile lists revoked certificate serial numbers, one per line, in
+	// decimal or 0x-prefixed hexadecimal. Lines starting with # are ignored.
+	RevocationFile string
+}
+
+// Load reads the trust store, or returns nil when no files are configured
+func (c TrustConfig) Load() (*integrity.TrustStore, error) {
+	if c.RootsFile == "" && c.RevocationFile == "" {
+		return nil, nil
+	}
+	trust := integrity.NewTrustStore()
+
+	if c.RootsFile != "" {
+		data, err := os.ReadFile(c.RootsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trust roots: %v", err)
+		}
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trust root: %v", err)
+			}
+			trust.AddRootCA(cert)
+		}
+		if !trust.HasRoots() {
+			return nil, fmt.Errorf("no certificates found in %s", c.RootsFile)
+		}
+	}
+
+	if c.RevocationFile != "" {
+		file, err := os.Open(c.RevocationFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read revocation list: %v", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			serial, ok := new(big.Int).SetString(text, 0)
+			if !ok {
+				return nil, fmt.Errorf("invalid serial number on line %d of %s", line, c.RevocationFile)
+			}
+			trust.RevokeCertificate(serial.String())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read revocation list: %v", err)
+		}
+	}
+
+	return trust, nil
+}
+
+// Summary counts documents by status
+type Summary struct {
+	Documents int       `json:"documents"`
+	Healthy   int       `json:"healthy"`
+	Warning   int       `json:"warning"`
+	Invalid   int       `json:"invalid"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+}
+
+// Monitor periodically revalidates every document in a store and keeps the
+// latest report of each. It is safe for concurrent use.
+type Monitor struct {
+	store   store.DocumentStore
+	checker *Checker
+	trust   TrustConfig
+
+	mu       sync.RWMutex
+	runMu    sync.Mutex
+	reports  map[string]*Report
+	lastRun  time.Time
+	alerters []Alerter
+}
+
+// NewMonitor creates a monitor for s
+func NewMonitor(s store.DocumentStore, checker *Checker, trust TrustConfig) *Monitor {
+	return &Monitor{
+		store:   s,
+		checker: checker,
+		trust:   trust,
+		reports: make(map[string]*Report),
+	}
+}
+
+// AddAlerter registers an alerter
+func (m *Monitor) AddAlerter(a Alerter) *Monitor {
+	m.alerters = append(m.alerters, a)
+	return m
+}
+
+// RunOnce revalidates every stored document with the current trust state
+func (m *Monitor) RunOnce() error {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	checker, err := m.currentChecker()
+	if err != nil {
+		return err
+	}
+	infos, err := m.store.List()
+	if err != nil {
+		return fmt.Errorf("failed to list documents: %v", err)
+	}
+
+	current := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		current[info.ID] = true
+		if _, err := m.check(checker, info.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("document health: failed to check %s: %v", info.ID, err)
+		}
+	}
+
+	// Forget documents that were deleted or expired
+	m.mu.Lock()
+	for id := range m.reports {
+		if !current[id] {
+			delete(m.reports, id)
+		}
+	}
+	m.lastRun = checker.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Check revalidates a single document now
+func (m *Monitor) Check(id string) (*Report, error) {
+	checker, err := m.currentChecker()
+	if err != nil {
+		return nil, err
+	}
+	return m.check(checker, id)
+}
+
+func (m *Monitor) check(checker *Checker, id string) (*Report, error) {
+	doc, err := m.store.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	report := checker.Check(doc)
+	doc.Close()
+
+	m.mu.Lock()
+	var previous Status
+	if last, exists := m.reports[id]; exists {
+		previous = last.Status
+	}
+	m.reports[id] = report
+	m.mu.Unlock()
+
+	if report.Status.Worse(previous) {
+		for _, alerter := range m.alerters {
+			if err := alerter.Alert(report, previous); err != nil {
+				log.Printf("document health: alert for %s failed: %v", id, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// currentChecker returns the checker with freshly loaded trust state
+func (m *Monitor) currentChecker() (*Checker, error) {
+	trust, err := m.trust.Load()
+	if err != nil {
+		return nil, err
+	}
+	checker := *m.checker
+	if trust != nil {
+		trust.SetClockSkew(checker.ClockSkew)
+		checker.Trust = trust
+	}
+	if checker.Now == nil {
+		checker.Now = time.Now
+	}
+	return &checker, nil
+}
+
+// Report returns the latest report of a document, if it has been checked
+func (m *Monitor) Report(id string) (*Report, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	report, exists := m.reports[id]
+	return report, exists
+}
+
+// Reports returns the latest reports, worst first
+func (m *Monitor) Reports() []*Report {
+	m.mu.RLock()
+	reports := make([]*Report, 0, len(m.reports))
+	for _, report := range m.reports {
+		reports = append(reports, report)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Status != reports[j].Status {
+			return reports[i].Status.Worse(reports[j].Status)
+		}
+		return reports[i].ID < reports[j].ID
+	})
+	return reports
+}
+
+// Summary counts the latest reports by status
+func (m *Monitor) Summary() *Summary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summary := &Summary{Documents: len(m.reports), LastRun: m.lastRun}
+	for _, report := range m.reports {
+		switch report.Status {
+		case StatusInvalid:
+			summary.Invalid++
+		case StatusWarning:
+			summary.Warning++
+		default:
+			summary.Healthy++
+		}
+	}
+	return summary
+}
+
+// Run revalidates the store immediately and then every interval until ctx is
+// cancelled
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	if err := m.RunOnce(); err != nil {
+		log.Printf("document health: revalidation failed: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.RunOnce(); err != nil {
+				log.Printf("document health: revalidation failed: %v", err)
+			}
+		}
+	}
+}
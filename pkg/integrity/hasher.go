@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -68,7 +69,7 @@ func (rh *ResourceHasher) HashFile(filePath string) (string, error) {
 	// Open file
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file %s: %v", filePath, err)
+		return "", fmt.Errorf("failed to open file %s: %w", filePath, err)
 	}
 	defer file.Close()
 
@@ -86,7 +87,7 @@ func (rh *ResourceHasher) HashFile(filePath string) (string, error) {
 
 	// Hash file content
 	if _, err := io.Copy(hasher, file); err != nil {
-		return "", fmt.Errorf("failed to hash file %s: %v", filePath, err)
+		return "", fmt.Errorf("failed to hash file %s: %w", filePath, err)
 	}
 
 	hashStr := hex.EncodeToString(hasher.Sum(nil))
@@ -114,7 +115,7 @@ func (rh *ResourceHasher) HashReader(reader io.Reader) (string, error) {
 	}
 
 	if _, err := io.Copy(hasher, reader); err != nil {
-		return "", fmt.Errorf("failed to hash reader: %v", err)
+		return "", fmt.Errorf("failed to hash reader: %w", err)
 	}
 
 	return hex.EncodeToString(hasher.Sum(nil)), nil
@@ -126,6 +127,42 @@ func (rh *ResourceHasher) VerifyBytes(data []byte, expectedHash string) bool {
 	return strings.EqualFold(actualHash, expectedHash)
 }
 
+// VerifyResource checks a package file against the hash its manifest lists.
+// A mismatch is a *core.HashMismatchError.
+func (rh *ResourceHasher) VerifyResource(path string, data []byte, expectedHash string) error {
+	actualHash := rh.HashBytes(data)
+	if !strings.EqualFold(actualHash, expectedHash) {
+		return &core.HashMismatchError{Path: path, Expected: expectedHash, Actual: actualHash}
+	}
+	return nil
+}
+
+// VerifyResources checks the files of a package against the hashes of its
+// manifest, in path order. Resources without a hash are skipped; missing
+// files are *core.FileMissingError and changed ones *core.HashMismatchError.
+func (rh *ResourceHasher) VerifyResources(manifest *core.Manifest, files map[string][]byte) []error {
+	paths := make([]string, 0, len(manifest.Resources))
+	for path, resource := range manifest.Resources {
+		if resource != nil && resource.Hash != "" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var errs []error
+	for _, path := range paths {
+		data, exists := files[path]
+		if !exists {
+			errs = append(errs, &core.FileMissingError{Path: path})
+			continue
+		}
+		if err := rh.VerifyResource(path, data, manifest.Resources[path].Hash); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
 // VerifyFile verifies that a file matches expected hash
 func (rh *ResourceHasher) VerifyFile(filePath, expectedHash string) (bool, error) {
 	actualHash, err := rh.HashFile(filePath)
@@ -163,7 +200,7 @@ func (rh *ResourceHasher) HashDirectory(dirPath string) (map[string]string, erro
 		// Calculate relative path
 		relPath, err := filepath.Rel(dirPath, path)
 		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
+			return fmt.Errorf("failed to get relative path: %w", err)
 		}
 		
 		// Normalize path separators
@@ -172,7 +209,7 @@ func (rh *ResourceHasher) HashDirectory(dirPath string) (map[string]string, erro
 		// Hash file
 		hash, err := rh.HashFile(path)
 		if err != nil {
-			return fmt.Errorf("failed to hash file %s: %v", relPath, err)
+			return fmt.Errorf("failed to hash file %s: %w", relPath, err)
 		}
 		
 		hashes[relPath] = hash
@@ -302,8 +339,7 @@ func NewIntegrityValidator() *IntegrityValidator {
 
 // ValidateResources validates all resources in a manifest
 func (iv *IntegrityValidator) ValidateResources(resources map[string]*core.Resource, files map[string][]byte) *core.ValidationResult {
-	var errors []string
-	var warnings []string
+	result := core.NewValidationResult()
 	
 	// Check that all resources in manifest exist in files
 	for path, resource := range resources {
@@ -311,46 +347,37 @@ func (iv *IntegrityValidator) ValidateResources(resources map[string]*core.Resou
 			// Verify hash
 			actualHash := iv.hasher.HashBytes(fileData)
 			if !strings.EqualFold(actualHash, resource.Hash) {
-				errors = append(errors, fmt.Sprintf("hash mismatch for %s: expected %s, got %s", 
+				result.AddError("resource.hash_mismatch", path, fmt.Sprintf("hash mismatch for %s: expected %s, got %s", 
 					path, resource.Hash, actualHash))
 			}
 			
 			// Verify size
 			actualSize := int64(len(fileData))
 			if actualSize != resource.Size {
-				errors = append(errors, fmt.Sprintf("size mismatch for %s: expected %d, got %d", 
+				result.AddError("resource.size_mismatch", path, fmt.Sprintf("size mismatch for %s: expected %d, got %d", 
 					path, resource.Size, actualSize))
 			}
 		} else {
-			errors = append(errors, fmt.Sprintf("resource %s referenced in manifest but not found in files", path))
+			result.AddError("resource.missing", path, fmt.Sprintf("resource %s referenced in manifest but not found in files", path))
 		}
 	}
 	
 	// Check for files not in manifest
 	for path := range files {
 		if _, exists := resources[path]; !exists {
-			warnings = append(warnings, fmt.Sprintf("file %s found but not referenced in manifest", path))
+			result.AddWarning("resource.unlisted", path, fmt.Sprintf("file %s found but not referenced in manifest", path))
 		}
 	}
 	
-	return &core.ValidationResult{
-		IsValid:  len(errors) == 0,
-		Errors:   errors,
-		Warnings: warnings,
-	}
+	return result
 }
 
 // ValidateWASMModules validates WASM module integrity
 func (iv *IntegrityValidator) ValidateWASMModules(wasmConfig *core.WASMConfiguration, wasmModules map[string][]byte) *core.ValidationResult {
-	var errors []string
-	var warnings []string
+	result := core.NewValidationResult()
 	
 	if wasmConfig == nil {
-		return &core.ValidationResult{
-			IsValid:  true,
-			Errors:   errors,
-			Warnings: warnings,
-		}
+		return result
 	}
 	
 	// Check that all configured modules exist
@@ -360,29 +387,29 @@ func (iv *IntegrityValidator) ValidateWASMModules(wasmConfig *core.WASMConfigura
 			if len(moduleData) < 4 || 
 				moduleData[0] != 0x00 || moduleData[1] != 0x61 || 
 				moduleData[2] != 0x73 || moduleData[3] != 0x6D {
-				errors = append(errors, fmt.Sprintf("WASM module %s has invalid magic number", moduleName))
+				result.AddError("wasm.magic_number", moduleName, fmt.Sprintf("WASM module %s has invalid magic number", moduleName))
 			}
 			
 			// Validate WASM version
 			if len(moduleData) < 8 ||
 				moduleData[4] != 0x01 || moduleData[5] != 0x00 ||
 				moduleData[6] != 0x00 || moduleData[7] != 0x00 {
-				errors = append(errors, fmt.Sprintf("WASM module %s has unsupported version", moduleName))
+				result.AddError("wasm.binary_version", moduleName, fmt.Sprintf("WASM module %s has unsupported version", moduleName))
 			}
 			
 			// Check module size limits
 			if len(moduleData) > 10*1024*1024 { // 10MB limit
-				warnings = append(warnings, fmt.Sprintf("WASM module %s is very large (%d bytes)", 
+				result.AddWarning("wasm.large", moduleName, fmt.Sprintf("WASM module %s is very large (%d bytes)", 
 					moduleName, len(moduleData)))
 			}
 			
 		} else {
-			errors = append(errors, fmt.Sprintf("WASM module %s configured but not found", moduleName))
+			result.AddError("wasm.module_missing", core.JSONPointer("wasm_config", "modules", moduleName), fmt.Sprintf("WASM module %s configured but not found", moduleName))
 		}
 		
 		// Validate module configuration
 		if moduleConfig.Name != moduleName {
-			errors = append(errors, fmt.Sprintf("WASM module name mismatch: config says %s, key is %s", 
+			result.AddError("wasm.module_name", core.JSONPointer("wasm_config", "modules", moduleName, "name"), fmt.Sprintf("WASM module name mismatch: config says %s, key is %s", 
 				moduleConfig.Name, moduleName))
 		}
 	}
@@ -390,15 +417,11 @@ func (iv *IntegrityValidator) ValidateWASMModules(wasmConfig *core.WASMConfigura
 	// Check for unconfigured modules
 	for moduleName := range wasmModules {
 		if _, exists := wasmConfig.Modules[moduleName]; !exists {
-			warnings = append(warnings, fmt.Sprintf("WASM module %s found but not configured", moduleName))
+			result.AddWarning("wasm.module_unlisted", moduleName, fmt.Sprintf("WASM module %s found but not configured", moduleName))
 		}
 	}
 	
-	return &core.ValidationResult{
-		IsValid:  len(errors) == 0,
-		Errors:   errors,
-		Warnings: warnings,
-	}
+	return result
 }
 
 // GenerateResourceManifest generates resource entries for a manifest
@@ -566,6 +589,16 @@ func (iv *IntegrityValidator) GenerateIntegrityReport(manifest *core.Manifest, f
 		}
 	}
 	
+	// Report in path order, so reports of the same document compare equal
+	sort.Slice(report.HashMismatches, func(i, j int) bool {
+		return report.HashMismatches[i].Path < report.HashMismatches[j].Path
+	})
+	sort.Slice(report.SizeMismatches, func(i, j int) bool {
+		return report.SizeMismatches[i].Path < report.SizeMismatches[j].Path
+	})
+	sort.Strings(report.MissingResources)
+	sort.Strings(report.OrphanedFiles)
+
 	// Validate WASM modules
 	report.WASMValidation = iv.ValidateWASMModules(manifest.WASMConfig, wasmModules)
 	if !report.WASMValidation.IsValid {
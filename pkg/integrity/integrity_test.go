@@ -2,6 +2,7 @@ package integrity
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -105,6 +106,41 @@ func TestResourceHasher_VerifyBytes(t *testing.T) {
 	}
 }
 
+func TestResourceHasher_VerifyResources(t *testing.T) {
+	hasher := NewResourceHasher(SHA256)
+	manifest := &core.Manifest{Resources: map[string]*core.Resource{
+		"content/index.html":      {Hash: hasher.HashBytes([]byte("<h1>Report</h1>"))},
+		"content/styles/main.css": {Hash: hasher.HashBytes([]byte("body {}"))},
+		"assets/logo.png":         {Hash: hasher.HashBytes([]byte("png"))},
+		"assets/unhashed.txt":     {},
+	}}
+	files := map[string][]byte{
+		"content/index.html":      []byte("<h1>Report</h1>"),
+		"content/styles/main.css": []byte("body { display: none; }"),
+	}
+
+	errs := hasher.VerifyResources(manifest, files)
+	if len(errs) != 2 {
+		t.Fatalf("Expected a missing and a changed file, got %v", errs)
+	}
+	var missing *core.FileMissingError
+	if !errors.As(errs[0], &missing) || missing.Path != "assets/logo.png" || !errors.Is(errs[0], core.ErrFileMissing) {
+		t.Errorf("Expected the logo to be missing, got %v", errs[0])
+	}
+	var mismatch *core.HashMismatchError
+	if !errors.As(errs[1], &mismatch) || mismatch.Path != "content/styles/main.css" || !errors.Is(errs[1], core.ErrHashMismatch) {
+		t.Errorf("Expected the stylesheet to mismatch, got %v", errs[1])
+	}
+	if mismatch != nil && mismatch.Actual != hasher.HashBytes(files["content/styles/main.css"]) {
+		t.Errorf("Expected the actual hash in the error, got %s", mismatch.Actual)
+	}
+
+	// Wrapped errors keep their kind
+	if err := fmt.Errorf("verification failed: %w", errs[1]); !errors.Is(err, core.ErrHashMismatch) || errors.Is(err, core.ErrFileMissing) {
+		t.Errorf("Expected the wrapped error to be a hash mismatch only")
+	}
+}
+
 func TestResourceHasher_HashDirectory(t *testing.T) {
 	hasher := NewResourceHasher(SHA256)
 
@@ -434,6 +470,30 @@ func TestIntegrityValidator_GenerateIntegrityReport(t *testing.T) {
 	}
 }
 
+func TestIntegrityValidator_GenerateIntegrityReportOrder(t *testing.T) {
+	validator := NewIntegrityValidator()
+	manifest := &core.Manifest{Resources: map[string]*core.Resource{}}
+	files := map[string][]byte{}
+	for _, name := range []string{"d.txt", "b.txt", "a.txt", "c.txt"} {
+		manifest.Resources["missing/"+name] = &core.Resource{Hash: "x", Size: 1}
+		files["extra/"+name] = []byte(name)
+	}
+
+	report := validator.GenerateIntegrityReport(manifest, files, nil)
+
+	want := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+	for i, name := range want {
+		if report.MissingResources[i] != "missing/"+name {
+			t.Errorf("MissingResources = %v, want sorted by path", report.MissingResources)
+			break
+		}
+		if report.OrphanedFiles[i] != "extra/"+name {
+			t.Errorf("OrphanedFiles = %v, want sorted by path", report.OrphanedFiles)
+			break
+		}
+	}
+}
+
 func TestResourceHasher_HashReader(t *testing.T) {
 	hasher := NewResourceHasher(SHA256)
 
@@ -2,28 +2,109 @@ package integrity
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/liv-format/liv/pkg/atomicfile"
 	"github.com/liv-format/liv/pkg/core"
 )
 
 // SignatureManager handles digital signatures for LIV documents
 type SignatureManager struct {
 	hasher *ResourceHasher
+	// timestampRoots are the roots timestamping authorities must chain to;
+	// nil accepts any authority
+	timestampRoots *x509.CertPool
+	// clockSkew is how far ahead of the clock of the verifier signing and
+	// document times may be before they are reported as in the future
+	clockSkew time.Duration
+	now       func() time.Time
 }
 
 // NewSignatureManager creates a new signature manager
 func NewSignatureManager() *SignatureManager {
 	return &SignatureManager{
-		hasher: NewResourceHasher(SHA256),
+		hasher:    NewResourceHasher(SHA256),
+		clockSkew: core.DefaultClockSkew,
+		now:       time.Now,
+	}
+}
+
+// SetClockSkew sets how far ahead of the clock of the verifier the times of
+// a document, its signers and its timestamp may be before verification
+// warns that they are in the future
+func (sm *SignatureManager) SetClockSkew(skew time.Duration) {
+	sm.clockSkew = skew
+}
+
+// SetClock sets the clock the times of documents are compared with
+func (sm *SignatureManager) SetClock(now func() time.Time) {
+	sm.now = now
+}
+
+// SignatureAlgorithm identifies how the signatures of a document were made
+type SignatureAlgorithm string
+
+const (
+	// AlgorithmRSASHA256 is RSA PKCS #1 v1.5 over SHA-256, used by documents
+	// signed before the algorithm was recorded
+	AlgorithmRSASHA256 SignatureAlgorithm = "RSA-SHA256"
+	// AlgorithmECDSAP256 is ECDSA on the P-256 curve over SHA-256, with
+	// ASN.1 encoded signatures
+	AlgorithmECDSAP256 SignatureAlgorithm = "ECDSA-P256-SHA256"
+	// AlgorithmEd25519 is Ed25519 over the data itself
+	AlgorithmEd25519 SignatureAlgorithm = "Ed25519"
+)
+
+// SupportedAlgorithms lists the signature algorithms documents can be signed with
+var SupportedAlgorithms = []SignatureAlgorithm{AlgorithmRSASHA256, AlgorithmECDSAP256, AlgorithmEd25519}
+
+// ParseSignatureAlgorithm returns the algorithm with the given name, ignoring case
+func ParseSignatureAlgorithm(name string) (SignatureAlgorithm, error) {
+	for _, algorithm := range SupportedAlgorithms {
+		if strings.EqualFold(name, string(algorithm)) {
+			return algorithm, nil
+		}
+	}
+	switch strings.ToLower(name) {
+	case "rsa":
+		return AlgorithmRSASHA256, nil
+	case "ecdsa", "p256", "p-256":
+		return AlgorithmECDSAP256, nil
+	}
+	return "", fmt.Errorf("unsupported signature algorithm: %s", name)
+}
+
+// AlgorithmForKey returns the signature algorithm made with a public or private key
+func AlgorithmForKey(key crypto.PublicKey) (SignatureAlgorithm, error) {
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return AlgorithmRSASHA256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported ECDSA curve %s, only P-256 is supported", k.Curve.Params().Name)
+		}
+		return AlgorithmECDSAP256, nil
+	case ed25519.PublicKey:
+		return AlgorithmEd25519, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
 	}
 }
 
@@ -41,7 +122,7 @@ func (sm *SignatureManager) GenerateKeyPair(keySize int) (*KeyPair, error) {
 	
 	privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate private key: %v", err)
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 	
 	return &KeyPair{
@@ -50,11 +131,61 @@ func (sm *SignatureManager) GenerateKeyPair(keySize int) (*KeyPair, error) {
 	}, nil
 }
 
+// SigningKeyPair is a key pair for any supported signature algorithm
+type SigningKeyPair struct {
+	Algorithm  SignatureAlgorithm
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// GenerateSigningKeyPair generates a key pair for the given algorithm. RSA keys
+// are 2048 bits; use GenerateKeyPair for larger ones.
+func (sm *SignatureManager) GenerateSigningKeyPair(algorithm SignatureAlgorithm) (*SigningKeyPair, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRSASHA256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmECDSAP256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEd25519:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	return &SigningKeyPair{
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		PublicKey:  privateKey.Public(),
+	}, nil
+}
+
 // SavePrivateKeyPEM saves private key to PEM file
 func (sm *SignatureManager) SavePrivateKeyPEM(keyPair *KeyPair, filePath string) error {
-	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(keyPair.PrivateKey)
+	return savePrivateKeyPEM(keyPair.PrivateKey, filePath)
+}
+
+// SavePublicKeyPEM saves public key to PEM file
+func (sm *SignatureManager) SavePublicKeyPEM(keyPair *KeyPair, filePath string) error {
+	return savePublicKeyPEM(keyPair.PublicKey, filePath)
+}
+
+// SaveSigningKeyPairPEM saves the private and public keys of a key pair to PEM files
+func (sm *SignatureManager) SaveSigningKeyPairPEM(keyPair *SigningKeyPair, privateKeyFile, publicKeyFile string) error {
+	if err := savePrivateKeyPEM(keyPair.PrivateKey, privateKeyFile); err != nil {
+		return err
+	}
+	return savePublicKeyPEM(keyPair.PublicKey, publicKeyFile)
+}
+
+func savePrivateKeyPEM(privateKey crypto.Signer, filePath string) error {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
 	if err != nil {
-		return fmt.Errorf("failed to marshal private key: %v", err)
+		return fmt.Errorf("failed to marshal private key: %w", err)
 	}
 	
 	privateKeyPEM := &pem.Block{
@@ -62,24 +193,21 @@ func (sm *SignatureManager) SavePrivateKeyPEM(keyPair *KeyPair, filePath string)
 		Bytes: privateKeyBytes,
 	}
 	
-	file, err := os.Create(filePath)
+	// Only the owner may read a new key file
+	err = atomicfile.Write(filePath, 0600, func(w io.Writer) error {
+		return pem.Encode(w, privateKeyPEM)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create private key file: %v", err)
-	}
-	defer file.Close()
-	
-	if err := pem.Encode(file, privateKeyPEM); err != nil {
-		return fmt.Errorf("failed to encode private key: %v", err)
+		return fmt.Errorf("failed to write private key: %w", err)
 	}
 	
 	return nil
 }
 
-// SavePublicKeyPEM saves public key to PEM file
-func (sm *SignatureManager) SavePublicKeyPEM(keyPair *KeyPair, filePath string) error {
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(keyPair.PublicKey)
+func savePublicKeyPEM(publicKey crypto.PublicKey, filePath string) error {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
-		return fmt.Errorf("failed to marshal public key: %v", err)
+		return fmt.Errorf("failed to marshal public key: %w", err)
 	}
 	
 	publicKeyPEM := &pem.Block{
@@ -87,24 +215,23 @@ func (sm *SignatureManager) SavePublicKeyPEM(keyPair *KeyPair, filePath string)
 		Bytes: publicKeyBytes,
 	}
 	
-	file, err := os.Create(filePath)
+	err = atomicfile.Write(filePath, 0644, func(w io.Writer) error {
+		return pem.Encode(w, publicKeyPEM)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create public key file: %v", err)
-	}
-	defer file.Close()
-	
-	if err := pem.Encode(file, publicKeyPEM); err != nil {
-		return fmt.Errorf("failed to encode public key: %v", err)
+		return fmt.Errorf("failed to write public key: %w", err)
 	}
 	
 	return nil
 }
 
-// LoadPrivateKeyPEM loads private key from PEM file
-func (sm *SignatureManager) LoadPrivateKeyPEM(filePath string) (*rsa.PrivateKey, error) {
+// LoadPrivateKeyPEM loads a private key from a PEM file. The key type is
+// detected from the key: PKCS #8 keys of any supported type, PKCS #1 RSA keys
+// and SEC 1 EC keys are accepted.
+func (sm *SignatureManager) LoadPrivateKeyPEM(filePath string) (crypto.Signer, error) {
 	keyData, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %v", err)
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
 	}
 	
 	block, _ := pem.Decode(keyData)
@@ -112,24 +239,35 @@ func (sm *SignatureManager) LoadPrivateKeyPEM(filePath string) (*rsa.PrivateKey,
 		return nil, fmt.Errorf("failed to decode PEM block")
 	}
 	
-	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	var privateKey interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %v", err)
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
 	
-	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	signer, ok := privateKey.(crypto.Signer)
 	if !ok {
-		return nil, fmt.Errorf("not an RSA private key")
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	if _, err := AlgorithmForKey(signer); err != nil {
+		return nil, err
 	}
 	
-	return rsaPrivateKey, nil
+	return signer, nil
 }
 
-// LoadPublicKeyPEM loads public key from PEM file
-func (sm *SignatureManager) LoadPublicKeyPEM(filePath string) (*rsa.PublicKey, error) {
+// LoadPublicKeyPEM loads an RSA, ECDSA P-256 or Ed25519 public key from a PEM file
+func (sm *SignatureManager) LoadPublicKeyPEM(filePath string) (crypto.PublicKey, error) {
 	keyData, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read public key file: %v", err)
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
 	}
 	
 	block, _ := pem.Decode(keyData)
@@ -139,107 +277,128 @@ func (sm *SignatureManager) LoadPublicKeyPEM(filePath string) (*rsa.PublicKey, e
 	
 	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %v", err)
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
 	}
 	
-	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("not an RSA public key")
+	if _, err := AlgorithmForKey(publicKey); err != nil {
+		return nil, err
 	}
 	
-	return rsaPublicKey, nil
+	return publicKey, nil
 }
 
-// SignData signs data with private key
-func (sm *SignatureManager) SignData(data []byte, privateKey *rsa.PrivateKey) (string, error) {
-	// Hash the data
-	hash := sha256.Sum256(data)
+// SignData signs data with private key, using the algorithm of the key
+func (sm *SignatureManager) SignData(data []byte, privateKey crypto.Signer) (string, error) {
+	algorithm, err := AlgorithmForKey(privateKey)
+	if err != nil {
+		return "", err
+	}
 	
-	// Sign the hash
-	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	// Sign the hash of the data, giving PKCS #1 v1.5 signatures for RSA and
+	// ASN.1 signatures for ECDSA; Ed25519 signs the data itself
+	var signature []byte
+	if algorithm == AlgorithmEd25519 {
+		signature, err = privateKey.Sign(rand.Reader, data, crypto.Hash(0))
+	} else {
+		hash := sha256.Sum256(data)
+		signature, err = privateKey.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to sign data: %v", err)
+		return "", fmt.Errorf("failed to sign data: %w", err)
 	}
 	
 	// Encode signature as base64
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
 
-// VerifySignature verifies signature with public key
-func (sm *SignatureManager) VerifySignature(data []byte, signatureStr string, publicKey *rsa.PublicKey) (bool, error) {
+// VerifySignature verifies signature with public key, using the algorithm of the key
+func (sm *SignatureManager) VerifySignature(data []byte, signatureStr string, publicKey crypto.PublicKey) (bool, error) {
+	algorithm, err := AlgorithmForKey(publicKey)
+	if err != nil {
+		return false, err
+	}
+	
 	// Decode signature from base64
 	signature, err := base64.StdEncoding.DecodeString(signatureStr)
 	if err != nil {
-		return false, fmt.Errorf("failed to decode signature: %v", err)
+		return false, fmt.Errorf("failed to decode signature: %w", err)
 	}
 	
 	// Hash the data
 	hash := sha256.Sum256(data)
 	
-	// Verify signature
-	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
-	if err != nil {
-		return false, nil // Invalid signature, but not an error
+	// Verify signature; an invalid signature is not an error
+	switch algorithm {
+	case AlgorithmRSASHA256:
+		return rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, hash[:], signature) == nil, nil
+	case AlgorithmECDSAP256:
+		return ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), hash[:], signature), nil
+	default:
+		return ed25519.Verify(publicKey.(ed25519.PublicKey), data, signature), nil
 	}
-	
-	return true, nil
 }
 
 // SignManifest signs a manifest
-func (sm *SignatureManager) SignManifest(manifest *core.Manifest, privateKey *rsa.PrivateKey) (string, error) {
+func (sm *SignatureManager) SignManifest(manifest *core.Manifest, privateKey crypto.Signer) (string, error) {
 	// Serialize manifest to canonical JSON
 	manifestData, err := sm.serializeManifestForSigning(manifest)
 	if err != nil {
-		return "", fmt.Errorf("failed to serialize manifest: %v", err)
+		return "", fmt.Errorf("failed to serialize manifest: %w", err)
 	}
 	
 	return sm.SignData(manifestData, privateKey)
 }
 
 // VerifyManifestSignature verifies manifest signature
-func (sm *SignatureManager) VerifyManifestSignature(manifest *core.Manifest, signature string, publicKey *rsa.PublicKey) (bool, error) {
+func (sm *SignatureManager) VerifyManifestSignature(manifest *core.Manifest, signature string, publicKey crypto.PublicKey) (bool, error) {
 	// Serialize manifest to canonical JSON
 	manifestData, err := sm.serializeManifestForSigning(manifest)
 	if err != nil {
-		return false, fmt.Errorf("failed to serialize manifest: %v", err)
+		return false, fmt.Errorf("failed to serialize manifest: %w", err)
 	}
 	
 	return sm.VerifySignature(manifestData, signature, publicKey)
 }
 
 // SignContent signs document content
-func (sm *SignatureManager) SignContent(content *core.DocumentContent, privateKey *rsa.PrivateKey) (string, error) {
+func (sm *SignatureManager) SignContent(content *core.DocumentContent, privateKey crypto.Signer) (string, error) {
 	// Create content hash from all content parts
 	contentData := sm.serializeContentForSigning(content)
 	return sm.SignData(contentData, privateKey)
 }
 
 // VerifyContentSignature verifies content signature
-func (sm *SignatureManager) VerifyContentSignature(content *core.DocumentContent, signature string, publicKey *rsa.PublicKey) (bool, error) {
+func (sm *SignatureManager) VerifyContentSignature(content *core.DocumentContent, signature string, publicKey crypto.PublicKey) (bool, error) {
 	contentData := sm.serializeContentForSigning(content)
 	return sm.VerifySignature(contentData, signature, publicKey)
 }
 
 // SignWASMModule signs a WASM module
-func (sm *SignatureManager) SignWASMModule(moduleData []byte, privateKey *rsa.PrivateKey) (string, error) {
+func (sm *SignatureManager) SignWASMModule(moduleData []byte, privateKey crypto.Signer) (string, error) {
 	return sm.SignData(moduleData, privateKey)
 }
 
 // VerifyWASMModuleSignature verifies WASM module signature
-func (sm *SignatureManager) VerifyWASMModuleSignature(moduleData []byte, signature string, publicKey *rsa.PublicKey) (bool, error) {
+func (sm *SignatureManager) VerifyWASMModuleSignature(moduleData []byte, signature string, publicKey crypto.PublicKey) (bool, error) {
 	return sm.VerifySignature(moduleData, signature, publicKey)
 }
 
-// SignDocument signs an entire LIV document
-func (sm *SignatureManager) SignDocument(document *core.LIVDocument, privateKey *rsa.PrivateKey) (*core.SignatureBundle, error) {
+// SignDocument signs an entire LIV document. The algorithm of the key is
+// recorded in the signature bundle.
+func (sm *SignatureManager) SignDocument(document *core.LIVDocument, privateKey crypto.Signer) (*core.SignatureBundle, error) {
+	algorithm, err := AlgorithmForKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
 	signatures := &core.SignatureBundle{
+		Algorithm:      string(algorithm),
 		WASMSignatures: make(map[string]string),
 	}
 	
 	// Sign manifest
 	manifestSig, err := sm.SignManifest(document.Manifest, privateKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign manifest: %v", err)
+		return nil, fmt.Errorf("failed to sign manifest: %w", err)
 	}
 	signatures.ManifestSignature = manifestSig
 	
@@ -247,7 +406,7 @@ func (sm *SignatureManager) SignDocument(document *core.LIVDocument, privateKey
 	if document.Content != nil {
 		contentSig, err := sm.SignContent(document.Content, privateKey)
 		if err != nil {
-			return nil, fmt.Errorf("failed to sign content: %v", err)
+			return nil, fmt.Errorf("failed to sign content: %w", err)
 		}
 		signatures.ContentSignature = contentSig
 	}
@@ -256,7 +415,7 @@ func (sm *SignatureManager) SignDocument(document *core.LIVDocument, privateKey
 	for moduleName, moduleData := range document.WASMModules {
 		wasmSig, err := sm.SignWASMModule(moduleData, privateKey)
 		if err != nil {
-			return nil, fmt.Errorf("failed to sign WASM module %s: %v", moduleName, err)
+			return nil, fmt.Errorf("failed to sign WASM module %s: %w", moduleName, err)
 		}
 		signatures.WASMSignatures[moduleName] = wasmSig
 	}
@@ -264,15 +423,42 @@ func (sm *SignatureManager) SignDocument(document *core.LIVDocument, privateKey
 	return signatures, nil
 }
 
-// VerifyDocument verifies all signatures in a LIV document
-func (sm *SignatureManager) VerifyDocument(document *core.LIVDocument, publicKey *rsa.PublicKey) *SignatureVerificationResult {
+// VerifyDocument verifies all signatures in a LIV document. The key must be
+// of the algorithm recorded in the signature bundle; bundles without one were
+// signed with RSA.
+func (sm *SignatureManager) VerifyDocument(document *core.LIVDocument, publicKey crypto.PublicKey) *SignatureVerificationResult {
 	result := &SignatureVerificationResult{
 		Valid:              true,
 		ManifestValid:      false,
 		ContentValid:       false,
 		WASMModulesValid:   make(map[string]bool),
 		Errors:             []string{},
-		VerificationTime:   time.Now(),
+		VerificationTime:   sm.now().UTC(),
+	}
+	
+	if document.Signatures != nil {
+		if err := checkSignatureAlgorithm(document.Signatures, publicKey); err != nil {
+			result.Valid = false
+			result.Errors = append(result.Errors, err.Error())
+			return result
+		}
+	}
+	
+	// Verify the timestamp proving when the document was signed
+	if document.Signatures != nil && len(document.Signatures.Timestamp) > 0 {
+		token, err := sm.VerifyTimestamp(document.Signatures)
+		if err != nil {
+			result.Valid = false
+			result.Errors = append(result.Errors, fmt.Sprintf("timestamp is invalid: %v", err))
+		} else {
+			result.Timestamp = &token.Time
+			result.TimestampAuthority = token.Authority.Subject.String()
+			result.TimestampTrusted = token.Trusted
+		}
+	}
+	result.Warnings = sm.futureTimes(document, result.Timestamp, result.VerificationTime)
+	if result.Timestamp != nil && !result.TimestampTrusted {
+		result.Warnings = append(result.Warnings, untrustedTimestamp(result.TimestampAuthority))
 	}
 	
 	// Verify manifest signature
@@ -334,6 +520,48 @@ func (sm *SignatureManager) VerifyDocument(document *core.LIVDocument, publicKey
 	return result
 }
 
+// futureTimes warns of the times of a document later than the clock of the
+// verifier by more than the clock skew: the signing time of the first signer,
+// that of its timestamp, and the created and modified times of the document.
+// Either clock may be wrong, so these do not invalidate the signatures.
+func (sm *SignatureManager) futureTimes(document *core.LIVDocument, timestamp *time.Time, now time.Time) []string {
+	var times []string
+	add := func(what string, t time.Time) {
+		if message := core.FutureTime(what, t, now, sm.clockSkew); message != "" {
+			times = append(times, message)
+		}
+	}
+	if timestamp != nil {
+		add("timestamp", *timestamp)
+	}
+	if document.Signatures != nil && document.Signatures.Signer != nil {
+		add("signing time", document.Signatures.Signer.SignedAt)
+	}
+	if document.Manifest != nil && document.Manifest.Metadata != nil {
+		add("created date", document.Manifest.Metadata.Created)
+		add("modified date", document.Manifest.Metadata.Modified)
+	}
+	return times
+}
+
+// checkSignatureAlgorithm checks that a key can verify the signatures of a bundle
+func checkSignatureAlgorithm(signatures *core.SignatureBundle, publicKey crypto.PublicKey) error {
+	keyAlgorithm, err := AlgorithmForKey(publicKey)
+	if err != nil {
+		return err
+	}
+	algorithm := SignatureAlgorithm(signatures.Algorithm)
+	if algorithm == "" {
+		algorithm = AlgorithmRSASHA256
+	} else if _, err := ParseSignatureAlgorithm(signatures.Algorithm); err != nil {
+		return err
+	}
+	if algorithm != keyAlgorithm {
+		return fmt.Errorf("%w: document is signed with %s, but the key is for %s", core.ErrSignatureInvalid, algorithm, keyAlgorithm)
+	}
+	return nil
+}
+
 // SignatureVerificationResult contains signature verification results
 type SignatureVerificationResult struct {
 	Valid              bool              `json:"valid"`
@@ -341,7 +569,27 @@ type SignatureVerificationResult struct {
 	ContentValid       bool              `json:"content_valid"`
 	WASMModulesValid   map[string]bool   `json:"wasm_modules_valid"`
 	Errors             []string          `json:"errors"`
+	// Warnings report times of the document ahead of the clock of the
+	// verifier, and timestamps from untrusted authorities, which do not make
+	// the signatures invalid
+	Warnings           []string          `json:"warnings,omitempty"`
 	VerificationTime   time.Time         `json:"verification_time"`
+	// Timestamp is when a timestamping authority attested the signatures
+	// existed, set only for a valid timestamp
+	Timestamp          *time.Time        `json:"timestamp,omitempty"`
+	TimestampAuthority string            `json:"timestamp_authority,omitempty"`
+	// TimestampTrusted reports whether the authority chains to the configured
+	// timestamping roots. Only then does Timestamp prove the signing time.
+	TimestampTrusted   bool              `json:"timestamp_trusted,omitempty"`
+}
+
+// Err returns nil for valid signatures, and otherwise an error listing what
+// failed that is core.ErrSignatureInvalid to errors.Is
+func (r *SignatureVerificationResult) Err() error {
+	if r.Valid {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", core.ErrSignatureInvalid, strings.Join(r.Errors, "; "))
 }
 
 // Helper methods for serialization
@@ -361,6 +609,17 @@ func (sm *SignatureManager) serializeManifestForSigning(manifest *core.Manifest)
 		manifestCopy.Metadata.Created.Format(time.RFC3339),
 		manifestCopy.Metadata.Modified.Format(time.RFC3339))
 	
+	// Access policies are signed, so they cannot be removed or relaxed
+	// without invalidating the signature. Documents without one sign as
+	// before.
+	if manifestCopy.Access != nil {
+		policy, err := json.Marshal(manifestCopy.Access)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize access policy: %v", err)
+		}
+		data += "|access:" + string(policy)
+	}
+	
 	return []byte(data), nil
 }
 
@@ -374,7 +633,7 @@ func (sm *SignatureManager) serializeContentForSigning(content *core.DocumentCon
 type TrustChain struct {
 	RootCertificates    []*x509.Certificate
 	IntermediateCerts   []*x509.Certificate
-	TrustedPublicKeys   []*rsa.PublicKey
+	TrustedPublicKeys   []crypto.PublicKey
 }
 
 // NewTrustChain creates a new trust chain
@@ -382,12 +641,12 @@ func NewTrustChain() *TrustChain {
 	return &TrustChain{
 		RootCertificates:  []*x509.Certificate{},
 		IntermediateCerts: []*x509.Certificate{},
-		TrustedPublicKeys: []*rsa.PublicKey{},
+		TrustedPublicKeys: []crypto.PublicKey{},
 	}
 }
 
 // AddTrustedPublicKey adds a trusted public key
-func (tc *TrustChain) AddTrustedPublicKey(publicKey *rsa.PublicKey) {
+func (tc *TrustChain) AddTrustedPublicKey(publicKey crypto.PublicKey) {
 	tc.TrustedPublicKeys = append(tc.TrustedPublicKeys, publicKey)
 }
 
@@ -421,14 +680,25 @@ type SignatureInfo struct {
 }
 
 // GetSignatureInfo extracts information about a signature
-func (sm *SignatureManager) GetSignatureInfo(publicKey *rsa.PublicKey) *SignatureInfo {
+func (sm *SignatureManager) GetSignatureInfo(publicKey crypto.PublicKey) *SignatureInfo {
 	// Calculate key fingerprint
 	publicKeyBytes, _ := x509.MarshalPKIXPublicKey(publicKey)
 	fingerprint := sm.hasher.HashBytes(publicKeyBytes)
 	
+	algorithm, _ := AlgorithmForKey(publicKey)
+	var keySize int
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		keySize = key.Size() * 8 // Convert bytes to bits
+	case *ecdsa.PublicKey:
+		keySize = key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		keySize = 256
+	}
+	
 	return &SignatureInfo{
-		Algorithm:   "RSA-SHA256",
-		KeySize:     publicKey.Size() * 8, // Convert bytes to bits
+		Algorithm:   string(algorithm),
+		KeySize:     keySize,
 		SignedAt:    time.Now(),
 		Fingerprint: fingerprint[:16], // First 16 chars of hash
 	}
@@ -1,7 +1,7 @@
 package integrity
 
 import (
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/liv-format/liv/pkg/atomicfile"
 	"github.com/liv-format/liv/pkg/core"
 )
 
@@ -28,18 +29,18 @@ func NewSignatureStorage(storageDir string) *SignatureStorage {
 // SaveSignatureBundle saves a signature bundle to storage
 func (ss *SignatureStorage) SaveSignatureBundle(documentID string, bundle *core.SignatureBundle) error {
 	if err := os.MkdirAll(ss.storageDir, 0755); err != nil {
-		return fmt.Errorf("failed to create storage directory: %v", err)
+		return fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
 	filePath := filepath.Join(ss.storageDir, fmt.Sprintf("%s_signatures.json", documentID))
 	
 	data, err := json.MarshalIndent(bundle, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal signature bundle: %v", err)
+		return fmt.Errorf("failed to marshal signature bundle: %w", err)
 	}
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write signature bundle: %v", err)
+	if err := atomicfile.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write signature bundle: %w", err)
 	}
 
 	return nil
@@ -51,12 +52,12 @@ func (ss *SignatureStorage) LoadSignatureBundle(documentID string) (*core.Signat
 	
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read signature bundle: %v", err)
+		return nil, fmt.Errorf("failed to read signature bundle: %w", err)
 	}
 
 	var bundle core.SignatureBundle
 	if err := json.Unmarshal(data, &bundle); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal signature bundle: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal signature bundle: %w", err)
 	}
 
 	return &bundle, nil
@@ -82,6 +83,9 @@ type TrustStore struct {
 	intermediateCAs   []*x509.Certificate
 	trustedCerts      []*x509.Certificate
 	revokedCerts      map[string]bool // Certificate serial numbers
+	// clockSkew is how far outside the validity period of a certificate
+	// the clock of the verifier may be before the certificate is refused
+	clockSkew         time.Duration
 }
 
 // NewTrustStore creates a new trust store
@@ -91,9 +95,16 @@ func NewTrustStore() *TrustStore {
 		intermediateCAs:  []*x509.Certificate{},
 		trustedCerts:     []*x509.Certificate{},
 		revokedCerts:     make(map[string]bool),
+		clockSkew:        core.DefaultClockSkew,
 	}
 }
 
+// SetClockSkew sets how far outside the validity period of a certificate
+// the clock of the verifier may be before the certificate is refused
+func (ts *TrustStore) SetClockSkew(skew time.Duration) {
+	ts.clockSkew = skew
+}
+
 // AddRootCA adds a root CA certificate to the trust store
 func (ts *TrustStore) AddRootCA(cert *x509.Certificate) {
 	ts.rootCAs = append(ts.rootCAs, cert)
@@ -109,6 +120,11 @@ func (ts *TrustStore) RevokeCertificate(serialNumber string) {
 	ts.revokedCerts[serialNumber] = true
 }
 
+// HasRoots reports whether any root CA has been added
+func (ts *TrustStore) HasRoots() bool {
+	return len(ts.rootCAs) > 0
+}
+
 // IsCertificateRevoked checks if a certificate is revoked
 func (ts *TrustStore) IsCertificateRevoked(cert *x509.Certificate) bool {
 	return ts.revokedCerts[cert.SerialNumber.String()]
@@ -116,15 +132,27 @@ func (ts *TrustStore) IsCertificateRevoked(cert *x509.Certificate) bool {
 
 // ValidateCertificateChain validates a certificate chain
 func (ts *TrustStore) ValidateCertificateChain(cert *x509.Certificate) error {
+	return ts.ValidateCertificateChainAt(cert, time.Now())
+}
+
+// ValidateCertificateChainAt validates a certificate chain as of a past time,
+// such as the timestamped signing time of a document whose certificate has
+// since expired. Revoked certificates are never valid.
+func (ts *TrustStore) ValidateCertificateChainAt(cert *x509.Certificate, now time.Time) error {
 	// Check if certificate is revoked
 	if ts.IsCertificateRevoked(cert) {
 		return fmt.Errorf("certificate is revoked")
 	}
 
-	// Check certificate validity period
-	now := time.Now()
-	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
-		return fmt.Errorf("certificate is not valid at current time")
+	// Check certificate validity period, tolerating clock skew, and verify
+	// the chain at the nearest time within the period
+	if now.Add(ts.clockSkew).Before(cert.NotBefore) || now.Add(-ts.clockSkew).After(cert.NotAfter) {
+		return fmt.Errorf("certificate is not valid at %s", now.UTC().Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) {
+		now = cert.NotBefore
+	} else if now.After(cert.NotAfter) {
+		now = cert.NotAfter
 	}
 
 	// Create certificate pool with root CAs
@@ -173,6 +201,13 @@ func NewEnhancedSignatureManager(storageDir string) *EnhancedSignatureManager {
 	}
 }
 
+// SetClockSkew sets the clock skew tolerated both for the times of documents
+// and for the validity periods of certificates
+func (esm *EnhancedSignatureManager) SetClockSkew(skew time.Duration) {
+	esm.SignatureManager.SetClockSkew(skew)
+	esm.certificateManager.trustStore.SetClockSkew(skew)
+}
+
 // SignDocumentWithCertificate signs a document using a certificate
 func (esm *EnhancedSignatureManager) SignDocumentWithCertificate(document *core.LIVDocument, cert *x509.Certificate, privateKey interface{}) (*core.SignatureBundle, error) {
 	// Validate certificate
@@ -181,16 +216,16 @@ func (esm *EnhancedSignatureManager) SignDocumentWithCertificate(document *core.
 			"error": err.Error(),
 			"cert_subject": cert.Subject.String(),
 		})
-		return nil, fmt.Errorf("certificate validation failed: %v", err)
+		return nil, fmt.Errorf("certificate validation failed: %w", err)
 	}
 
-	// Sign document (assuming RSA private key for now)
-	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	// Sign document with the RSA, ECDSA or Ed25519 key of the certificate
+	signer, ok := privateKey.(crypto.Signer)
 	if !ok {
 		return nil, fmt.Errorf("unsupported private key type")
 	}
 
-	signatures, err := esm.SignDocument(document, rsaPrivateKey)
+	signatures, err := esm.SignDocument(document, signer)
 	if err != nil {
 		esm.auditLogger.LogSecurityEvent("document_signing_failed", map[string]interface{}{
 			"error": err.Error(),
@@ -224,8 +259,25 @@ func (esm *EnhancedSignatureManager) VerifyDocumentWithCertificate(document *cor
 		TrustChainValid:     false,
 	}
 
-	// Validate certificate chain
-	if err := esm.certificateManager.trustStore.ValidateCertificateChain(cert); err != nil {
+	// Extract public key from certificate
+	if _, err := AlgorithmForKey(cert.PublicKey); err != nil {
+		result.Valid = false
+		result.Errors = append(result.Errors, fmt.Sprintf("certificate key cannot verify signatures: %v", err))
+		return result
+	}
+
+	// Verify document signatures
+	basicResult := esm.VerifyDocument(document, cert.PublicKey)
+	result.SignatureVerificationResult = *basicResult
+
+	// Validate certificate chain, as of the signing time when the signatures
+	// are timestamped by a trusted authority so they stay valid after the
+	// certificate expires
+	validAt := result.VerificationTime
+	if result.Timestamp != nil && result.TimestampTrusted {
+		validAt = *result.Timestamp
+	}
+	if err := esm.certificateManager.trustStore.ValidateCertificateChainAt(cert, validAt); err != nil {
 		result.Valid = false
 		result.Errors = append(result.Errors, fmt.Sprintf("certificate validation failed: %v", err))
 		esm.auditLogger.LogSecurityEvent("certificate_verification_failed", map[string]interface{}{
@@ -237,18 +289,6 @@ func (esm *EnhancedSignatureManager) VerifyDocumentWithCertificate(document *cor
 		result.TrustChainValid = true
 	}
 
-	// Extract public key from certificate
-	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
-	if !ok {
-		result.Valid = false
-		result.Errors = append(result.Errors, "certificate does not contain RSA public key")
-		return result
-	}
-
-	// Verify document signatures
-	basicResult := esm.VerifyDocument(document, publicKey)
-	result.SignatureVerificationResult = *basicResult
-
 	// Set certificate info
 	result.CertificateInfo = &CertificateInfo{
 		Subject:      cert.Subject.String(),
@@ -293,15 +333,8 @@ func (esm *EnhancedSignatureManager) ValidateWASMModuleSignature(moduleName stri
 	}
 	result.CertificateValid = true
 
-	// Extract public key
-	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
-	if !ok {
-		result.Errors = append(result.Errors, "certificate does not contain RSA public key")
-		return result
-	}
-
 	// Verify WASM module signature
-	valid, err := esm.VerifyWASMModuleSignature(moduleData, signature, publicKey)
+	valid, err := esm.VerifyWASMModuleSignature(moduleData, signature, cert.PublicKey)
 	if err != nil {
 		result.Errors = append(result.Errors, fmt.Sprintf("signature verification failed: %v", err))
 		return result
@@ -432,7 +465,7 @@ func DefaultSignaturePolicy() *SignaturePolicy {
 func (esm *EnhancedSignatureManager) ValidateSignaturePolicy(cert *x509.Certificate, policy *SignaturePolicy) error {
 	// Check if certificates are required
 	if policy.RequireCertificates && cert == nil {
-		return fmt.Errorf("certificate required by policy")
+		return fmt.Errorf("%w: certificate required", core.ErrPolicyDenied)
 	}
 
 	if cert == nil {
@@ -441,7 +474,7 @@ func (esm *EnhancedSignatureManager) ValidateSignaturePolicy(cert *x509.Certific
 
 	// Check self-signed certificates
 	if !policy.AllowSelfSigned && cert.Subject.String() == cert.Issuer.String() {
-		return fmt.Errorf("self-signed certificates not allowed by policy")
+		return fmt.Errorf("%w: self-signed certificates not allowed", core.ErrPolicyDenied)
 	}
 
 	// Check key usage
@@ -454,7 +487,7 @@ func (esm *EnhancedSignatureManager) ValidateSignaturePolicy(cert *x509.Certific
 			}
 		}
 		if !hasRequiredUsage {
-			return fmt.Errorf("certificate does not have required key usage")
+			return fmt.Errorf("%w: certificate does not have required key usage", core.ErrPolicyDenied)
 		}
 	}
 
@@ -462,7 +495,7 @@ func (esm *EnhancedSignatureManager) ValidateSignaturePolicy(cert *x509.Certific
 	if policy.MaxCertificateAge > 0 {
 		age := time.Since(cert.NotBefore)
 		if age > policy.MaxCertificateAge {
-			return fmt.Errorf("certificate is too old (age: %v, max: %v)", age, policy.MaxCertificateAge)
+			return fmt.Errorf("%w: certificate is too old (age: %v, max: %v)", core.ErrPolicyDenied, age, policy.MaxCertificateAge)
 		}
 	}
 
@@ -476,7 +509,7 @@ func (esm *EnhancedSignatureManager) ValidateSignaturePolicy(cert *x509.Certific
 			}
 		}
 		if !issuerFound {
-			return fmt.Errorf("certificate issuer not in trusted list")
+			return fmt.Errorf("%w: certificate issuer not in trusted list", core.ErrPolicyDenied)
 		}
 	}
 
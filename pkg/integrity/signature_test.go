@@ -1,7 +1,15 @@
 package integrity
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -87,12 +95,12 @@ func TestSignatureManager_SaveAndLoadKeys(t *testing.T) {
 	}
 
 	// Verify loaded keys match original
-	if loadedPrivateKey.Size() != keyPair.PrivateKey.Size() {
-		t.Error("Loaded private key size doesn't match original")
+	if !keyPair.PrivateKey.Equal(loadedPrivateKey) {
+		t.Error("Loaded private key doesn't match original")
 	}
 
-	if loadedPublicKey.Size() != keyPair.PublicKey.Size() {
-		t.Error("Loaded public key size doesn't match original")
+	if !keyPair.PublicKey.Equal(loadedPublicKey) {
+		t.Error("Loaded public key doesn't match original")
 	}
 
 	// Test signing with loaded keys
@@ -213,6 +221,37 @@ func TestSignatureManager_SignAndVerifyManifest(t *testing.T) {
 	}
 }
 
+func TestSignatureManager_SignedAccessPolicy(t *testing.T) {
+	sm := NewSignatureManager()
+	keyPair, err := sm.GenerateSigningKeyPair(AlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	closes := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	manifest := &core.Manifest{
+		Version:  "1.0",
+		Metadata: &core.DocumentMetadata{Title: "Results", Author: "Test Author", Created: closes.AddDate(-1, 0, 0), Modified: closes.AddDate(-1, 0, 0)},
+		Access:   &core.AccessPolicy{NotAfter: &closes, MaxOpens: 3},
+	}
+	signature, err := sm.SignManifest(manifest, keyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign manifest: %v", err)
+	}
+	if valid, err := sm.VerifyManifestSignature(manifest, signature, keyPair.PublicKey); err != nil || !valid {
+		t.Fatalf("Expected the signed policy to verify: %v", err)
+	}
+
+	relaxed := *manifest
+	relaxed.Access = &core.AccessPolicy{NotAfter: &closes, MaxOpens: 30}
+	if valid, _ := sm.VerifyManifestSignature(&relaxed, signature, keyPair.PublicKey); valid {
+		t.Error("Expected a relaxed access policy to invalidate the signature")
+	}
+	relaxed.Access = nil
+	if valid, _ := sm.VerifyManifestSignature(&relaxed, signature, keyPair.PublicKey); valid {
+		t.Error("Expected a removed access policy to invalidate the signature")
+	}
+}
+
 func TestSignatureManager_SignAndVerifyContent(t *testing.T) {
 	sm := NewSignatureManager()
 
@@ -374,6 +413,9 @@ func TestSignatureManager_SignAndVerifyDocument(t *testing.T) {
 	if result.Valid {
 		t.Error("Document verification should have failed with corrupted manifest signature")
 	}
+	if err := result.Err(); !errors.Is(err, core.ErrSignatureInvalid) {
+		t.Errorf("Expected an invalid signature error, got %v", err)
+	}
 }
 
 func TestSignatureManager_TrustChain(t *testing.T) {
@@ -491,6 +533,178 @@ func TestSignatureManager_GetSignatureInfo(t *testing.T) {
 	}
 }
 
+func newTestDocument() *core.LIVDocument {
+	return &core.LIVDocument{
+		Manifest: &core.Manifest{
+			Version: "1.0",
+			Metadata: &core.DocumentMetadata{
+				Title:    "Test Document",
+				Author:   "Test Author",
+				Created:  time.Now().Add(-time.Hour),
+				Modified: time.Now(),
+			},
+		},
+		Content: &core.DocumentContent{
+			HTML: "<html><body>Test</body></html>",
+			CSS:  "body { color: red; }",
+		},
+		WASMModules: map[string][]byte{
+			"test-module": {0x00, 0x61, 0x73, 0x6D, 0x01, 0x00, 0x00, 0x00},
+		},
+	}
+}
+
+func TestSignatureManager_SignatureAlgorithms(t *testing.T) {
+	sm := NewSignatureManager()
+	dir := t.TempDir()
+
+	for _, algorithm := range SupportedAlgorithms {
+		keyPair, err := sm.GenerateSigningKeyPair(algorithm)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", algorithm, err)
+		}
+
+		// Keys are saved as PKCS #8 and the type is detected on load
+		privateKeyFile := filepath.Join(dir, string(algorithm)+"-private.pem")
+		publicKeyFile := filepath.Join(dir, string(algorithm)+"-public.pem")
+		if err := sm.SaveSigningKeyPairPEM(keyPair, privateKeyFile, publicKeyFile); err != nil {
+			t.Fatalf("Failed to save %s key pair: %v", algorithm, err)
+		}
+		privateKey, err := sm.LoadPrivateKeyPEM(privateKeyFile)
+		if err != nil {
+			t.Fatalf("Failed to load %s private key: %v", algorithm, err)
+		}
+		publicKey, err := sm.LoadPublicKeyPEM(publicKeyFile)
+		if err != nil {
+			t.Fatalf("Failed to load %s public key: %v", algorithm, err)
+		}
+
+		document := newTestDocument()
+		signatures, err := sm.SignDocument(document, privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign document with %s: %v", algorithm, err)
+		}
+		if signatures.Algorithm != string(algorithm) {
+			t.Errorf("Expected algorithm %s in the signature bundle, got %q", algorithm, signatures.Algorithm)
+		}
+		document.Signatures = signatures
+
+		if result := sm.VerifyDocument(document, publicKey); !result.Valid {
+			t.Errorf("Document signed with %s should verify: %v", algorithm, result.Errors)
+		}
+		if info := sm.GetSignatureInfo(publicKey); info.Algorithm != string(algorithm) || info.KeySize == 0 {
+			t.Errorf("Unexpected signature info for %s: %+v", algorithm, info)
+		}
+
+		document.Content.HTML = "<html><body>Modified</body></html>"
+		if result := sm.VerifyDocument(document, publicKey); result.Valid || result.ContentValid {
+			t.Errorf("Modified document signed with %s should not verify", algorithm)
+		}
+	}
+}
+
+func TestSignatureManager_LoadPrivateKeyFormats(t *testing.T) {
+	sm := NewSignatureManager()
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	ecBytes, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal ECDSA key: %v", err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate P-384 key: %v", err)
+	}
+	p384Bytes, err := x509.MarshalPKCS8PrivateKey(p384Key)
+	if err != nil {
+		t.Fatalf("Failed to marshal P-384 key: %v", err)
+	}
+
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		file      string
+		algorithm SignatureAlgorithm
+	}{
+		{write("pkcs1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), AlgorithmRSASHA256},
+		{write("sec1.pem", "EC PRIVATE KEY", ecBytes), AlgorithmECDSAP256},
+	}
+	for _, tt := range tests {
+		key, err := sm.LoadPrivateKeyPEM(tt.file)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", tt.file, err)
+		}
+		if algorithm, _ := AlgorithmForKey(key); algorithm != tt.algorithm {
+			t.Errorf("Expected %s key in %s, got %s", tt.algorithm, tt.file, algorithm)
+		}
+	}
+
+	// Only the P-256 curve is supported for ECDSA
+	if _, err := sm.LoadPrivateKeyPEM(write("p384.pem", "PRIVATE KEY", p384Bytes)); err == nil {
+		t.Error("Expected a P-384 key to be rejected")
+	}
+}
+
+func TestSignatureManager_VerifyDocumentAlgorithm(t *testing.T) {
+	sm := NewSignatureManager()
+
+	rsaKeyPair, err := sm.GenerateKeyPair(2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	edKeyPair, err := sm.GenerateSigningKeyPair(AlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	// Documents signed before the algorithm was recorded have RSA signatures
+	document := newTestDocument()
+	signatures, err := sm.SignDocument(document, rsaKeyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign document: %v", err)
+	}
+	signatures.Algorithm = ""
+	document.Signatures = signatures
+	if result := sm.VerifyDocument(document, rsaKeyPair.PublicKey); !result.Valid {
+		t.Errorf("Legacy RSA signatures should verify: %v", result.Errors)
+	}
+	if result := sm.VerifyDocument(document, edKeyPair.PublicKey); result.Valid {
+		t.Error("Legacy RSA signatures should not verify with an Ed25519 key")
+	}
+
+	// The recorded algorithm must match the key
+	signatures, err = sm.SignDocument(document, edKeyPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign document: %v", err)
+	}
+	document.Signatures = signatures
+	if result := sm.VerifyDocument(document, rsaKeyPair.PublicKey); result.Valid || len(result.Errors) != 1 {
+		t.Errorf("Expected an algorithm mismatch, got %v", result.Errors)
+	}
+	if err := checkSignatureAlgorithm(signatures, rsaKeyPair.PublicKey); !errors.Is(err, core.ErrSignatureInvalid) {
+		t.Errorf("Expected an algorithm mismatch to be an invalid signature, got %v", err)
+	}
+
+	signatures.Algorithm = "DSA-SHA1"
+	if result := sm.VerifyDocument(document, edKeyPair.PublicKey); result.Valid {
+		t.Error("Signatures of an unsupported algorithm should not verify")
+	}
+}
+
 func BenchmarkSignatureManager_SignData(b *testing.B) {
 	sm := NewSignatureManager()
 
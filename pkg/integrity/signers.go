@@ -0,0 +1,237 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/tsa"
+)
+
+// SignerStatus is the verification outcome for one signer of a document
+type SignerStatus string
+
+const (
+	// SignerValid signatures verify with the signer's key
+	SignerValid SignerStatus = "valid"
+	// SignerInvalid signatures do not verify: the document or an earlier
+	// signature changed after signing, or the signature is corrupt
+	SignerInvalid SignerStatus = "invalid"
+	// SignerUnverified signatures were not checked because no key of the
+	// signer was given
+	SignerUnverified SignerStatus = "unverified"
+)
+
+// SignerVerificationResult is the verification outcome for one signer
+type SignerVerificationResult struct {
+	// Signer is nil for documents signed before signer metadata was recorded
+	Signer           *core.SignerInfo `json:"signer,omitempty"`
+	CounterSignature bool             `json:"counter_signature"`
+	Status           SignerStatus     `json:"status"`
+	// Timestamp is when a timestamping authority attested the signature
+	// existed, set only for a valid timestamp
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	// TimestampTrusted reports whether the authority chains to the configured
+	// timestamping roots
+	TimestampTrusted bool     `json:"timestamp_trusted,omitempty"`
+	Errors           []string `json:"errors"`
+	// Warnings report signing times ahead of the clock of the verifier and
+	// timestamps from untrusted authorities
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Err returns nil unless the signer's signatures failed to verify, and then
+// an error that is core.ErrSignatureInvalid to errors.Is. Unverified signers
+// are not an error.
+func (r *SignerVerificationResult) Err() error {
+	if r.Status != SignerInvalid {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", core.ErrSignatureInvalid, strings.Join(r.Errors, "; "))
+}
+
+// KeyID returns the fingerprint identifying a public key in signer metadata
+func (sm *SignatureManager) KeyID(publicKey crypto.PublicKey) string {
+	return sm.GetSignatureInfo(publicKey).Fingerprint
+}
+
+// CounterSign adds the signature of a further signer to a signed document. The
+// key ID and, when unset, the signing time of the signer are filled in.
+func (sm *SignatureManager) CounterSign(document *core.LIVDocument, signer core.SignerInfo, privateKey crypto.Signer) (*core.CounterSignature, error) {
+	if document.Signatures == nil || document.Signatures.ManifestSignature == "" {
+		return nil, fmt.Errorf("document must be signed before it can be counter-signed")
+	}
+	algorithm, err := AlgorithmForKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	signer.KeyID = sm.KeyID(privateKey.Public())
+	if signer.SignedAt.IsZero() {
+		signer.SignedAt = core.UTC(time.Now())
+	}
+
+	counter := &core.CounterSignature{Signer: signer, Algorithm: string(algorithm)}
+	data, err := sm.counterSignedData(document, len(document.Signatures.CounterSignatures), counter)
+	if err != nil {
+		return nil, err
+	}
+	if counter.Signature, err = sm.SignData(data, privateKey); err != nil {
+		return nil, fmt.Errorf("failed to counter-sign document: %w", err)
+	}
+	document.Signatures.CounterSignatures = append(document.Signatures.CounterSignatures, counter)
+	return counter, nil
+}
+
+// TimestampCounterSignature obtains a timestamp token for a counter-signature
+// from a timestamping authority and stores it in the counter-signature
+func (sm *SignatureManager) TimestampCounterSignature(ctx context.Context, counter *core.CounterSignature, client *tsa.Client) error {
+	token, err := client.Timestamp(ctx, []byte(counter.Signature))
+	if err != nil {
+		return fmt.Errorf("failed to timestamp counter-signature: %w", err)
+	}
+	counter.Timestamp = token
+	return nil
+}
+
+// VerifySigners verifies every signer of a document independently, in signing
+// order, with the key among keys that matches each signer's key ID. Signers
+// without a matching key are reported as unverified.
+func (sm *SignatureManager) VerifySigners(document *core.LIVDocument, keys []crypto.PublicKey) []*SignerVerificationResult {
+	if document.Signatures == nil || document.Signatures.ManifestSignature == "" {
+		return nil
+	}
+	results := []*SignerVerificationResult{sm.verifyFirstSigner(document, keys)}
+	for i, counter := range document.Signatures.CounterSignatures {
+		results = append(results, sm.verifyCounterSignature(document, i, counter, keys))
+	}
+	return results
+}
+
+// verifyFirstSigner verifies the signatures of the first signer. Without
+// signer metadata every key of the signature algorithm is tried.
+func (sm *SignatureManager) verifyFirstSigner(document *core.LIVDocument, keys []crypto.PublicKey) *SignerVerificationResult {
+	signer := document.Signatures.Signer
+	result := &SignerVerificationResult{Signer: signer, Status: SignerUnverified, Errors: []string{}}
+	for _, key := range keys {
+		if signer != nil && sm.KeyID(key) != signer.KeyID {
+			continue
+		}
+		if signer == nil && checkSignatureAlgorithm(document.Signatures, key) != nil {
+			continue
+		}
+		verification := sm.VerifyDocument(document, key)
+		if verification.Valid {
+			result.Status = SignerValid
+			result.Timestamp = verification.Timestamp
+			result.TimestampTrusted = verification.TimestampTrusted
+			result.Errors = []string{}
+			result.Warnings = verification.Warnings
+			return result
+		}
+		result.Status = SignerInvalid
+		result.Errors = verification.Errors
+	}
+	return result
+}
+
+func (sm *SignatureManager) verifyCounterSignature(document *core.LIVDocument, index int, counter *core.CounterSignature, keys []crypto.PublicKey) *SignerVerificationResult {
+	signer := counter.Signer
+	result := &SignerVerificationResult{Signer: &signer, CounterSignature: true, Status: SignerUnverified, Errors: []string{}}
+	var key crypto.PublicKey
+	for _, candidate := range keys {
+		if sm.KeyID(candidate) == signer.KeyID {
+			key = candidate
+			break
+		}
+	}
+	if key == nil {
+		return result
+	}
+
+	fail := func(format string, args ...interface{}) *SignerVerificationResult {
+		result.Status = SignerInvalid
+		result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+		return result
+	}
+	if err := checkSignatureAlgorithm(&core.SignatureBundle{Algorithm: counter.Algorithm}, key); err != nil {
+		return fail("%v", err)
+	}
+	data, err := sm.counterSignedData(document, index, counter)
+	if err != nil {
+		return fail("%v", err)
+	}
+	valid, err := sm.VerifySignature(data, counter.Signature, key)
+	if err != nil {
+		return fail("counter-signature verification error: %v", err)
+	}
+	if !valid {
+		return fail("counter-signature is invalid")
+	}
+	if len(counter.Timestamp) > 0 {
+		token, err := tsa.Verify(counter.Timestamp, []byte(counter.Signature), sm.timestampRoots)
+		if err != nil {
+			return fail("timestamp is invalid: %v", err)
+		}
+		result.Timestamp = &token.Time
+		result.TimestampTrusted = token.Trusted
+		if !token.Trusted {
+			result.Warnings = append(result.Warnings, untrustedTimestamp(token.Authority.Subject.String()))
+		}
+	}
+	now := sm.now()
+	if message := core.FutureTime("signing time", signer.SignedAt, now, sm.clockSkew); message != "" {
+		result.Warnings = append(result.Warnings, message)
+	}
+	if result.Timestamp != nil {
+		if message := core.FutureTime("timestamp", *result.Timestamp, now, sm.clockSkew); message != "" {
+			result.Warnings = append(result.Warnings, message)
+		}
+	}
+	result.Status = SignerValid
+	return result
+}
+
+// counterSignedData returns the bytes the counter-signature at index covers:
+// the document, the signatures made before it and its own signer metadata
+func (sm *SignatureManager) counterSignedData(document *core.LIVDocument, index int, counter *core.CounterSignature) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("liv-counter-signature-v1\n")
+
+	manifestData, err := sm.serializeManifestForSigning(document.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	fmt.Fprintf(&buf, "manifest:%x\n", sha256.Sum256(manifestData))
+	if document.Content != nil {
+		fmt.Fprintf(&buf, "content:%x\n", sha256.Sum256(sm.serializeContentForSigning(document.Content)))
+	}
+	names := make([]string, 0, len(document.WASMModules))
+	for name := range document.WASMModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "wasm:%s:%x\n", name, sha256.Sum256(document.WASMModules[name]))
+	}
+
+	signatures := document.Signatures
+	fmt.Fprintf(&buf, "signatures:%x\n", sha256.Sum256(TimestampedData(signatures)))
+	prior := []interface{}{signatures.Signer}
+	for _, earlier := range signatures.CounterSignatures[:index] {
+		prior = append(prior, earlier.Signer, earlier.Algorithm, earlier.Signature)
+	}
+	prior = append(prior, counter.Signer, counter.Algorithm)
+	metadata, err := json.Marshal(prior)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(metadata)
+	return buf.Bytes(), nil
+}
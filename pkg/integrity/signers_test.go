@@ -0,0 +1,147 @@
+package integrity
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func TestSignatureManager_CounterSign(t *testing.T) {
+	sm := NewSignatureManager()
+	author, err := sm.GenerateSigningKeyPair(AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := sm.GenerateSigningKeyPair(AlgorithmECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approver, err := sm.GenerateSigningKeyPair(AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := newTestDocument()
+	if _, err := sm.CounterSign(document, core.SignerInfo{Name: "Reviewer"}, reviewer.PrivateKey); err == nil {
+		t.Error("Counter-signing an unsigned document succeeded")
+	}
+	signatures, err := sm.SignDocument(document, author.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign document: %v", err)
+	}
+	signatures.Signer = &core.SignerInfo{Name: "Author", Role: "author", KeyID: sm.KeyID(author.PublicKey), SignedAt: time.Now().UTC()}
+	document.Signatures = signatures
+
+	counter, err := sm.CounterSign(document, core.SignerInfo{Name: "Reviewer", Role: "reviewer"}, reviewer.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to counter-sign document: %v", err)
+	}
+	if counter.Signer.KeyID != sm.KeyID(reviewer.PublicKey) || counter.Signer.SignedAt.IsZero() || counter.Algorithm != string(AlgorithmECDSAP256) {
+		t.Errorf("Unexpected counter-signature %+v", counter)
+	}
+	if _, err := sm.CounterSign(document, core.SignerInfo{Name: "Approver"}, approver.PrivateKey); err != nil {
+		t.Fatalf("Failed to counter-sign document: %v", err)
+	}
+
+	statuses := func(keys ...crypto.PublicKey) []SignerStatus {
+		var statuses []SignerStatus
+		for _, result := range sm.VerifySigners(document, keys) {
+			statuses = append(statuses, result.Status)
+		}
+		return statuses
+	}
+	expect := func(got []SignerStatus, want ...SignerStatus) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("Expected statuses %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected statuses %v, got %v", want, got)
+				return
+			}
+		}
+	}
+
+	expect(statuses(author.PublicKey, reviewer.PublicKey, approver.PublicKey), SignerValid, SignerValid, SignerValid)
+	// Signers are verified independently of the keys given for the others
+	expect(statuses(reviewer.PublicKey), SignerUnverified, SignerValid, SignerUnverified)
+
+	// Replacing the reviewer's metadata breaks their signature and the
+	// approver's, which covers it, but not the author's
+	document.Signatures.CounterSignatures[0].Signer.Role = "approver"
+	expect(statuses(author.PublicKey, reviewer.PublicKey, approver.PublicKey), SignerValid, SignerInvalid, SignerInvalid)
+	document.Signatures.CounterSignatures[0].Signer.Role = "reviewer"
+
+	// Changing the document breaks every signature
+	document.Content.HTML = "<html><body>Modified</body></html>"
+	expect(statuses(author.PublicKey, reviewer.PublicKey, approver.PublicKey), SignerInvalid, SignerInvalid, SignerInvalid)
+}
+
+func TestSignatureManager_VerifySignersWithoutMetadata(t *testing.T) {
+	sm := NewSignatureManager()
+	key, err := sm.GenerateSigningKeyPair(AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := sm.GenerateSigningKeyPair(AlgorithmECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := newTestDocument()
+	if document.Signatures, err = sm.SignDocument(document, key.PrivateKey); err != nil {
+		t.Fatalf("Failed to sign document: %v", err)
+	}
+	results := sm.VerifySigners(document, []crypto.PublicKey{other.PublicKey, key.PublicKey})
+	if len(results) != 1 || results[0].Signer != nil || results[0].Status != SignerValid {
+		t.Errorf("Expected the signature to verify with the matching key, got %+v", results[0])
+	}
+}
+
+func TestSignatureManager_ClockSkew(t *testing.T) {
+	sm := NewSignatureManager()
+	author, err := sm.GenerateSigningKeyPair(AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer, err := sm.GenerateSigningKeyPair(AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	sm.SetClock(func() time.Time { return now })
+
+	// The document was made and signed on a machine whose clock is an
+	// hour ahead, except for the reviewer's, which is a minute ahead
+	document := newTestDocument()
+	document.Manifest.Metadata.Created = now.Add(-24 * time.Hour)
+	document.Manifest.Metadata.Modified = now.Add(time.Hour)
+	signatures, err := sm.SignDocument(document, author.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign document: %v", err)
+	}
+	signatures.Signer = &core.SignerInfo{Name: "Author", KeyID: sm.KeyID(author.PublicKey), SignedAt: now.Add(time.Hour)}
+	document.Signatures = signatures
+	if _, err := sm.CounterSign(document, core.SignerInfo{Name: "Reviewer", SignedAt: now.Add(time.Minute)}, reviewer.PrivateKey); err != nil {
+		t.Fatalf("Failed to counter-sign document: %v", err)
+	}
+
+	result := sm.VerifyDocument(document, author.PublicKey)
+	if !result.Valid || len(result.Warnings) != 2 {
+		t.Errorf("Expected valid signatures with warnings for the signing and modified times, got %v and %v", result.Errors, result.Warnings)
+	}
+	signers := sm.VerifySigners(document, []crypto.PublicKey{author.PublicKey, reviewer.PublicKey})
+	if len(signers) != 2 || signers[0].Status != SignerValid || len(signers[0].Warnings) != 2 {
+		t.Errorf("Expected the author to be valid with warnings, got %+v", signers)
+	} else if signers[1].Status != SignerValid || len(signers[1].Warnings) != 0 {
+		t.Errorf("Expected a signing time within the clock skew to be accepted, got %+v", signers[1])
+	}
+
+	sm.SetClockSkew(2 * time.Hour)
+	if result := sm.VerifyDocument(document, author.PublicKey); !result.Valid || len(result.Warnings) != 0 {
+		t.Errorf("Expected a larger clock skew to accept the times, got %v and %v", result.Errors, result.Warnings)
+	}
+}
@@ -0,0 +1,64 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/tsa"
+)
+
+// TimestampedData returns the bytes an RFC 3161 timestamp of a signature
+// bundle covers: the algorithm and every signature, so the token proves when
+// all of them were made
+func TimestampedData(signatures *core.SignatureBundle) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "algorithm:%s\n", signatures.Algorithm)
+	fmt.Fprintf(&buf, "manifest:%s\n", signatures.ManifestSignature)
+	fmt.Fprintf(&buf, "content:%s\n", signatures.ContentSignature)
+
+	names := make([]string, 0, len(signatures.WASMSignatures))
+	for name := range signatures.WASMSignatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "wasm:%s:%s\n", name, signatures.WASMSignatures[name])
+	}
+	return buf.Bytes()
+}
+
+// SetTimestampRoots sets the roots timestamping authorities must chain to. By
+// default any authority with a timestamping certificate is accepted, but its
+// tokens are untrusted: they do not extend certificates past their expiry.
+func (sm *SignatureManager) SetTimestampRoots(roots *x509.CertPool) {
+	sm.timestampRoots = roots
+}
+
+// TimestampSignatures obtains a timestamp token for a signature bundle from a
+// timestamping authority and stores it in the bundle
+func (sm *SignatureManager) TimestampSignatures(ctx context.Context, signatures *core.SignatureBundle, client *tsa.Client) error {
+	token, err := client.Timestamp(ctx, TimestampedData(signatures))
+	if err != nil {
+		return fmt.Errorf("failed to timestamp signatures: %w", err)
+	}
+	signatures.Timestamp = token
+	return nil
+}
+
+// untrustedTimestamp is the warning for a timestamp whose authority does not
+// chain to configured roots
+func untrustedTimestamp(authority string) string {
+	return fmt.Sprintf("timestamp from %s is not trusted, so it does not prove when the document was signed", authority)
+}
+
+// VerifyTimestamp verifies the timestamp token of a signature bundle
+func (sm *SignatureManager) VerifyTimestamp(signatures *core.SignatureBundle) (*tsa.Token, error) {
+	if len(signatures.Timestamp) == 0 {
+		return nil, fmt.Errorf("signatures are not timestamped")
+	}
+	return tsa.Verify(signatures.Timestamp, TimestampedData(signatures), sm.timestampRoots)
+}
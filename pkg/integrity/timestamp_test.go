@@ -0,0 +1,155 @@
+package integrity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/tsa/tsatest"
+)
+
+func TestTimestampSignatures(t *testing.T) {
+	server, err := tsatest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// The certificate expired after the document was signed and timestamped
+	signedAt := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	server.SetTime(signedAt)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "Expired Signer"},
+		NotBefore:    signedAt.Add(-24 * time.Hour),
+		NotAfter:     signedAt.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	esm := NewEnhancedSignatureManager(t.TempDir())
+	esm.certificateManager.trustStore.AddRootCA(cert)
+	esm.SetTimestampRoots(server.Roots())
+	document := newTestDocument()
+	signatures, err := esm.SignDocument(document, key)
+	if err != nil {
+		t.Fatalf("Failed to sign document: %v", err)
+	}
+	document.Signatures = signatures
+
+	// Without a timestamp the expired certificate is rejected
+	if result := esm.VerifyDocumentWithCertificate(document, cert); result.Valid || result.CertificateValid {
+		t.Errorf("Verification without a timestamp succeeded after the certificate expired")
+	}
+
+	if err := esm.TimestampSignatures(context.Background(), signatures, server.Client()); err != nil {
+		t.Fatalf("Failed to timestamp signatures: %v", err)
+	}
+	result := esm.VerifyDocumentWithCertificate(document, cert)
+	if !result.Valid || !result.CertificateValid {
+		t.Fatalf("Timestamped verification failed: %v", result.Errors)
+	}
+	if result.Timestamp == nil || !result.Timestamp.Equal(signedAt) {
+		t.Errorf("Timestamp = %v, want %s", result.Timestamp, signedAt)
+	}
+	if !strings.Contains(result.TimestampAuthority, "Test Timestamping Authority") {
+		t.Errorf("TimestampAuthority = %q", result.TimestampAuthority)
+	}
+
+	// A timestamp of other signatures does not vouch for these
+	signatures.ContentSignature, signatures.ManifestSignature = signatures.ManifestSignature, signatures.ContentSignature
+	result = esm.VerifyDocumentWithCertificate(document, cert)
+	if result.Valid || result.Timestamp != nil {
+		t.Error("Verification succeeded with a timestamp of other signatures")
+	}
+	found := false
+	for _, message := range result.Errors {
+		found = found || strings.HasPrefix(message, "timestamp is invalid")
+	}
+	if !found {
+		t.Errorf("Errors = %v, want an invalid timestamp", result.Errors)
+	}
+	signatures.ContentSignature, signatures.ManifestSignature = signatures.ManifestSignature, signatures.ContentSignature
+
+	// Authorities must chain to the configured roots
+	esm.SetTimestampRoots(x509.NewCertPool())
+	if result := esm.VerifyDocument(document, cert.PublicKey); result.Valid {
+		t.Error("Verification succeeded with an untrusted timestamping authority")
+	}
+}
+
+func TestSelfSignedTimestampAuthority(t *testing.T) {
+	// Whoever holds an expired key can run their own authority and backdate
+	server, err := tsatest.NewSelfSignedServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	expiredAt := time.Now().Add(-24 * time.Hour)
+	server.SetTime(expiredAt.Add(-time.Hour))
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(8),
+		Subject:      pkix.Name{CommonName: "Expired Signer"},
+		NotBefore:    expiredAt.Add(-48 * time.Hour),
+		NotAfter:     expiredAt,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	esm := NewEnhancedSignatureManager(t.TempDir())
+	esm.certificateManager.trustStore.AddRootCA(cert)
+	document := newTestDocument()
+	signatures, err := esm.SignDocument(document, key)
+	if err != nil {
+		t.Fatalf("Failed to sign document: %v", err)
+	}
+	if err := esm.TimestampSignatures(context.Background(), signatures, server.Client()); err != nil {
+		t.Fatalf("Failed to timestamp signatures: %v", err)
+	}
+	document.Signatures = signatures
+
+	result := esm.VerifyDocumentWithCertificate(document, cert)
+	if result.Valid || result.CertificateValid {
+		t.Error("A self-signed timestamp kept an expired certificate valid")
+	}
+	if result.Timestamp == nil || result.TimestampTrusted {
+		t.Errorf("Expected the timestamp reported untrusted, got %v (trusted %v)", result.Timestamp, result.TimestampTrusted)
+	}
+	found := false
+	for _, message := range result.Warnings {
+		found = found || strings.Contains(message, "is not trusted")
+	}
+	if !found {
+		t.Errorf("Warnings = %v, want an untrusted timestamp", result.Warnings)
+	}
+}
@@ -0,0 +1,299 @@
+// Package interactive reads and validates the interactive spec of a LIV
+// document, content/interactive.json: animations and the triggers that play
+// them, data sources and the bindings that show their values, charts, and the
+// activity, graphics and events sections that viewers read. Specs are checked
+// against the JSON Schema in Schema, then for references between their parts
+// and to files of the package.
+package interactive
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// SpecPath is where a package keeps its interactive spec
+const SpecPath = "content/interactive.json"
+
+// Spec is an interactive spec
+type Spec struct {
+	Animations []*Animation       `json:"animations,omitempty"`
+	Triggers   []*Trigger         `json:"triggers,omitempty"`
+	Data       []*DataSource      `json:"data,omitempty"`
+	Bindings   []*Binding         `json:"bindings,omitempty"`
+	Charts     []*Chart           `json:"charts,omitempty"`
+	Activity   *core.ActivitySpec `json:"activity,omitempty"`
+	Graphics   *core.GraphicsSpec `json:"graphics,omitempty"`
+	Events     *core.EventsSpec   `json:"events,omitempty"`
+}
+
+// Animation is keyframes played on the elements matching Target
+type Animation struct {
+	ID     string `json:"id"`
+	Target string `json:"target"`
+	// Duration and Delay are in milliseconds; an iteration takes a second
+	// when Duration is unset
+	Duration float64 `json:"duration,omitempty"`
+	Delay    float64 `json:"delay,omitempty"`
+	// Easing is a CSS easing function, linear when unset
+	Easing string `json:"easing,omitempty"`
+	// Iterations is a count, or "infinite"; once when unset
+	Iterations interface{} `json:"iterations,omitempty"`
+	Direction  string      `json:"direction,omitempty"`
+	Fill       string      `json:"fill,omitempty"`
+	Keyframes  []*Keyframe `json:"keyframes"`
+}
+
+// Keyframe is the styles of an animation at Offset, from 0 to 1
+type Keyframe struct {
+	Offset float64           `json:"offset"`
+	Styles map[string]string `json:"styles"`
+}
+
+// Trigger plays, pauses, restarts, reverses or toggles an animation when an
+// event happens: load, click, hover, focus, visible (scrolled into view), key
+// or timer
+type Trigger struct {
+	ID string `json:"id,omitempty"`
+	On string `json:"on"`
+	// Target is the selector of the elements click, hover, focus and visible
+	// triggers listen on
+	Target string `json:"target,omitempty"`
+	// Key is the key of key triggers, as KeyboardEvent.key names it
+	Key string `json:"key,omitempty"`
+	// After is how many milliseconds a timer trigger waits after the
+	// document loads
+	After     float64 `json:"after,omitempty"`
+	Animation string  `json:"animation"`
+	// Action is what happens to the animation, play when unset
+	Action string `json:"action,omitempty"`
+}
+
+// DataSource is data for bindings and charts, from a JSON, CSV or Parquet
+// file in the package or given inline as Values
+type DataSource struct {
+	ID     string        `json:"id"`
+	Src    string        `json:"src,omitempty"`
+	Format string        `json:"format,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+}
+
+// Binding shows a value of a data source in the elements matching Target
+type Binding struct {
+	Source string `json:"source"`
+	// Path is the dotted path of the value within the data, the whole data
+	// when unset
+	Path   string `json:"path,omitempty"`
+	Target string `json:"target"`
+	// Property is what the value sets: text (when unset), html, value,
+	// attr:<name> or style:<property>
+	Property string `json:"property,omitempty"`
+	Format   string `json:"format,omitempty"`
+}
+
+// Chart is a chart drawn in the element matching Target from a data source
+type Chart struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	Data   string `json:"data"`
+	X      string `json:"x,omitempty"`
+	// Y is the field plotted, or a list of fields
+	Y       interface{}            `json:"y,omitempty"`
+	Title   string                 `json:"title,omitempty"`
+	Width   float64                `json:"width,omitempty"`
+	Height  float64                `json:"height,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// Parse reads and validates an interactive spec. exists reports whether a
+// path is part of the package, for the files the spec refers to; with a nil
+// exists those references are not checked.
+func Parse(data []byte, exists func(path string) bool) (*Spec, *core.ValidationResult) {
+	result := core.NewValidationResult()
+	if errors := checkSchema(data); len(errors) > 0 {
+		addFindings(result, "interactive.schema", core.SeverityError, errors)
+		return nil, result
+	}
+
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		result.AddError("interactive.invalid_json", "", fmt.Sprintf("invalid JSON: %v", err))
+		return nil, result
+	}
+	errors, warnings := spec.check(data, exists)
+	addFindings(result, "interactive.check", core.SeverityError, errors)
+	addFindings(result, "interactive.check", core.SeverityWarning, warnings)
+	if !result.IsValid {
+		return nil, result
+	}
+	return &spec, result
+}
+
+// location matches the location messages start with, such as
+// animations[0].id
+var location = regexp.MustCompile(`^[A-Za-z_$][\w$-]*(\[\d+\]|\.[A-Za-z_$][\w$-]*)*$`)
+
+// addFindings records messages as findings, located by the JSON pointer of
+// the location they start with
+func addFindings(result *core.ValidationResult, code string, severity core.Severity, messages []string) {
+	for _, message := range messages {
+		finding := &core.Finding{Code: code, Severity: severity, Message: message}
+		if prefix, _, ok := strings.Cut(message, ": "); ok && location.MatchString(prefix) {
+			var keys []interface{}
+			for _, key := range strings.FieldsFunc(prefix, func(r rune) bool { return r == '.' || r == '[' || r == ']' }) {
+				keys = append(keys, key)
+			}
+			finding.Path = core.JSONPointer(keys...)
+		}
+		result.Add(finding)
+	}
+}
+
+// Validate validates an interactive spec, as Parse does
+func Validate(data []byte, exists func(path string) bool) *core.ValidationResult {
+	_, result := Parse(data, exists)
+	return result
+}
+
+// check checks what the schema cannot: that identifiers are unique, that
+// references resolve, and the rules of the sections viewers read
+func (s *Spec) check(data []byte, exists func(path string) bool) ([]string, []string) {
+	var errors, warnings []string
+	fail := func(format string, args ...interface{}) {
+		errors = append(errors, fmt.Sprintf(format, args...))
+	}
+
+	animations := make(map[string]bool)
+	for i, animation := range s.Animations {
+		if animations[animation.ID] {
+			fail("animations[%d].id: duplicate animation %q", i, animation.ID)
+		}
+		animations[animation.ID] = true
+		for j := 1; j < len(animation.Keyframes); j++ {
+			if animation.Keyframes[j].Offset < animation.Keyframes[j-1].Offset {
+				fail("animations[%d].keyframes[%d].offset: keyframes must be in offset order, but %v follows %v",
+					i, j, animation.Keyframes[j].Offset, animation.Keyframes[j-1].Offset)
+			}
+		}
+	}
+
+	triggers := make(map[string]bool)
+	for i, trigger := range s.Triggers {
+		if trigger.ID != "" {
+			if triggers[trigger.ID] {
+				fail("triggers[%d].id: duplicate trigger %q", i, trigger.ID)
+			}
+			triggers[trigger.ID] = true
+		}
+		if !animations[trigger.Animation] {
+			fail("triggers[%d].animation: no animation %q%s", i, trigger.Animation, known(animations))
+		}
+		switch trigger.On {
+		case "click", "hover", "focus", "visible":
+			if trigger.Target == "" {
+				fail("triggers[%d]: %s triggers need a target selector", i, trigger.On)
+			}
+		case "key":
+			if trigger.Key == "" {
+				fail("triggers[%d]: key triggers need a key", i)
+			}
+		case "timer":
+			if trigger.After == 0 {
+				warnings = append(warnings, fmt.Sprintf("triggers[%d]: timer trigger without after fires as the document loads", i))
+			}
+		}
+	}
+
+	sources := make(map[string]bool)
+	used := make(map[string]bool)
+	for i, source := range s.Data {
+		if sources[source.ID] {
+			fail("data[%d].id: duplicate data source %q", i, source.ID)
+		}
+		sources[source.ID] = true
+		switch {
+		case source.Src == "" && source.Values == nil:
+			fail("data[%d]: data source %q needs src or values", i, source.ID)
+		case source.Src != "" && source.Values != nil:
+			fail("data[%d]: data source %q has both src and values", i, source.ID)
+		case source.Src != "":
+			if err := checkPackagePath(source.Src, exists); err != nil {
+				fail("data[%d].src: %v", i, err)
+			}
+			ext := strings.TrimPrefix(strings.ToLower(path.Ext(source.Src)), ".")
+			if source.Format == "" && ext != "json" && ext != "csv" && ext != "parquet" {
+				fail("data[%d].format: the format of %s is not json, csv or parquet by its extension; set format", i, source.Src)
+			}
+		}
+	}
+	for i, binding := range s.Bindings {
+		used[binding.Source] = true
+		if !sources[binding.Source] {
+			fail("bindings[%d].source: no data source %q%s", i, binding.Source, known(sources))
+		}
+	}
+	charts := make(map[string]bool)
+	for i, chart := range s.Charts {
+		used[chart.Data] = true
+		if charts[chart.ID] {
+			fail("charts[%d].id: duplicate chart %q", i, chart.ID)
+		}
+		charts[chart.ID] = true
+		if !sources[chart.Data] {
+			fail("charts[%d].data: no data source %q%s", i, chart.Data, known(sources))
+		}
+	}
+	for _, source := range s.Data {
+		if !used[source.ID] {
+			warnings = append(warnings, fmt.Sprintf("data source %q is not used by a binding or chart", source.ID))
+		}
+	}
+
+	// The sections viewers read are checked as viewers read them
+	if _, err := core.ParseActivitySpec(data); err != nil {
+		fail("activity: %s", strings.TrimPrefix(err.Error(), "invalid interactive spec: "))
+	}
+	if graphics, err := core.ParseGraphicsSpec(data); err != nil {
+		fail("graphics: %s", strings.TrimPrefix(err.Error(), "invalid interactive spec: "))
+	} else if graphics.Snapshot != "" {
+		if err := checkPackagePath(graphics.Snapshot, exists); err != nil {
+			fail("graphics.snapshot: %v", err)
+		}
+	}
+	if _, err := core.ParseEventsSpec(data); err != nil {
+		fail("events: %s", strings.TrimPrefix(err.Error(), "invalid interactive spec: "))
+	}
+	return errors, warnings
+}
+
+// checkPackagePath checks that p is a clean path within the package and, with
+// exists, that the package has it
+func checkPackagePath(p string, exists func(path string) bool) error {
+	clean := path.Clean(p)
+	if clean != p || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%q is not a path within the package", p)
+	}
+	if exists != nil && !exists(p) {
+		return fmt.Errorf("%s is not part of the package", p)
+	}
+	return nil
+}
+
+// known lists the identifiers a reference could have meant, for errors
+func known(ids map[string]bool) string {
+	if len(ids) == 0 {
+		return " (none are defined)"
+	}
+	names := make([]string, 0, len(ids))
+	for id := range ids {
+		names = append(names, fmt.Sprintf("%q", id))
+	}
+	sort.Strings(names)
+	return " (defined: " + strings.Join(names, ", ") + ")"
+}
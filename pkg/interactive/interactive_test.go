@@ -0,0 +1,157 @@
+package interactive
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/jsonschema"
+)
+
+const validSpec = `{
+  "animations": [{
+    "id": "fade-in", "target": "#summary", "duration": 600, "easing": "cubic-bezier(0.2, 0, 0.2, 1)",
+    "iterations": "infinite", "direction": "alternate",
+    "keyframes": [{"offset": 0, "styles": {"opacity": "0"}}, {"offset": 1, "styles": {"opacity": "1"}}]
+  }],
+  "triggers": [
+    {"on": "visible", "target": "#summary", "animation": "fade-in"},
+    {"on": "key", "key": "p", "animation": "fade-in", "action": "toggle"}
+  ],
+  "data": [
+    {"id": "sales", "src": "assets/data/sales.csv"},
+    {"id": "totals", "values": [{"year": 2024, "total": 1200}]}
+  ],
+  "bindings": [{"source": "totals", "path": "0.total", "target": "#total", "format": "currency"}],
+  "charts": [{"id": "revenue", "type": "bar", "target": "#chart", "data": "sales", "x": "quarter", "y": ["north", "south"]}],
+  "activity": {"keep_running": ["#clock"]},
+  "graphics": {"fallback": "snapshot", "snapshot": "assets/snapshot.png"},
+  "events": {"items": [{"title": "Launch", "start": "2025-05-01"}]}
+}`
+
+func packageFiles(paths ...string) func(string) bool {
+	return func(p string) bool {
+		for _, path := range paths {
+			if path == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestParseValidSpec(t *testing.T) {
+	spec, result := Parse([]byte(validSpec), packageFiles("assets/data/sales.csv", "assets/snapshot.png"))
+	if !result.IsValid {
+		t.Fatalf("Expected the spec to be valid, got %v", result.Errors)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Unexpected warnings %v", result.Warnings)
+	}
+	if len(spec.Animations) != 1 || spec.Animations[0].Keyframes[1].Styles["opacity"] != "1" || spec.Charts[0].Type != "bar" {
+		t.Errorf("Unexpected spec %+v", spec)
+	}
+
+	// Without a package, the files the spec refers to are not checked
+	if result := Validate([]byte(validSpec), nil); !result.IsValid {
+		t.Errorf("Expected the spec to be valid without a package, got %v", result.Errors)
+	}
+}
+
+func TestValidateReportsSchemaErrors(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{`[]`, "must be an object, not an array"},
+		{`{"animation": []}`, `unknown property "animation" (did you mean "animations"?)`},
+		{`{"animations": [{"id": "a", "target": "#a"}]}`, `animations[0]: missing required property "keyframes"`},
+		{`{"animations": [{"id": "a", "target": "#a", "duration": "1s", "keyframes": []}]}`, "animations[0].duration: must be a number, not a string"},
+		{`{"animations": [{"id": "a", "target": "#a", "keyframes": [{"offset": 0, "styles": {}}]}]}`, "animations[0].keyframes: must have at least 2 items"},
+		{`{"animations": [{"id": "a", "target": "#a", "keyframes": [{"offset": 2, "styles": {}}, {"offset": 1, "styles": {"opacity": 1}}]}]}`, "animations[0].keyframes[0].offset: must be at most 1, not 2"},
+		{`{"animations": [{"id": "a", "target": "#a", "keyframes": [{"offset": 0, "styles": {}}, {"offset": 1, "styles": {"opacity": 1}}]}]}`, "animations[0].keyframes[1].styles.opacity: must be a string, not an integer"},
+		{`{"animations": [{"id": "a", "target": "#a", "iterations": 0, "keyframes": []}]}`, "animations[0].iterations: must be at least 1, not 0"},
+		{`{"animations": [{"id": "a", "target": "#a", "iterations": "forever", "keyframes": []}]}`, `animations[0].iterations: must be one of "infinite", not "forever"`},
+		{`{"animations": [{"id": "a", "target": "#a", "iterations": 1.5, "keyframes": []}]}`, `animations[0].iterations: must be an integer or one of "infinite", not 1.5`},
+		{`{"animations": [{"id": "a", "target": "#a", "easing": "bounce", "keyframes": []}]}`, `animations[0].easing: must be one of "linear"`},
+		{`{"animations": [{"id": "1st", "target": "#a", "keyframes": []}]}`, `animations[0].id: "1st" is not an identifier`},
+		{`{"triggers": [{"on": "dblclick", "animation": "a"}]}`, `triggers[0].on: must be one of "load", "click", "hover", "focus", "visible", "key", "timer", not "dblclick"`},
+		{`{"bindings": [{"source": "a", "target": "#a", "property": "onclick"}]}`, `bindings[0].property: "onclick" is not what the value sets`},
+		{`{"charts": [{"id": "c", "type": "bar", "target": "#c", "data": "d", "y": []}]}`, "charts[0].y: must have at least 1 item"},
+		{`{"graphics": {"min_texture_size": -1}}`, "graphics.min_texture_size: must be at least 0, not -1"},
+		{`{"activity": {"keep_running": ""}}`, "activity.keep_running: must be an array, not a string"},
+		{`{"events": {"items": [{"title": "Launch"}]}}`, `events.items[0]: missing required property "start"`},
+		{`{"animations": [}`, "invalid JSON"},
+	}
+
+	for _, test := range tests {
+		result := Validate([]byte(test.spec), nil)
+		if result.IsValid {
+			t.Errorf("Expected %s to be invalid", test.spec)
+			continue
+		}
+		if !containsPrefix(result.Errors, test.expected) {
+			t.Errorf("Expected %q for %s, got %v", test.expected, test.spec, result.Errors)
+		}
+	}
+}
+
+func containsPrefix(errors []string, prefix string) bool {
+	for _, err := range errors {
+		if strings.HasPrefix(err, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateChecksReferences(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{`{"triggers": [{"on": "load", "animation": "intro"}]}`, `triggers[0].animation: no animation "intro" (none are defined)`},
+		{`{"animations": [{"id": "a", "target": "#a", "keyframes": [{"offset": 0.5, "styles": {}}, {"offset": 0.2, "styles": {}}]}]}`, "animations[0].keyframes[1].offset: keyframes must be in offset order"},
+		{`{"animations": [{"id": "a", "target": "#a", "keyframes": [{"offset": 0, "styles": {}}, {"offset": 1, "styles": {}}]}], "triggers": [{"on": "click", "animation": "a"}]}`, "triggers[0]: click triggers need a target selector"},
+		{`{"data": [{"id": "d", "values": []}, {"id": "d", "values": []}], "charts": [{"id": "c", "type": "pie", "target": "#c", "data": "d"}]}`, `data[1].id: duplicate data source "d"`},
+		{`{"data": [{"id": "d"}], "bindings": [{"source": "d", "target": "#d"}]}`, `data[0]: data source "d" needs src or values`},
+		{`{"data": [{"id": "d", "src": "assets/data/missing.json"}], "bindings": [{"source": "d", "target": "#d"}]}`, "data[0].src: assets/data/missing.json is not part of the package"},
+		{`{"data": [{"id": "d", "src": "../secrets.json"}], "bindings": [{"source": "d", "target": "#d"}]}`, `data[0].src: "../secrets.json" is not a path within the package`},
+		{`{"data": [{"id": "d", "src": "assets/data/sales.xlsx"}], "bindings": [{"source": "d", "target": "#d"}]}`, "data[0].format: the format of assets/data/sales.xlsx is not json, csv or parquet"},
+		{`{"data": [{"id": "sales", "values": []}], "charts": [{"id": "c", "type": "line", "target": "#c", "data": "revenue"}]}`, `charts[0].data: no data source "revenue" (defined: "sales")`},
+		{`{"graphics": {"fallback": "canvas2d", "snapshot": "assets/missing.png"}}`, "graphics.snapshot: assets/missing.png is not part of the package"},
+		{`{"events": {"items": [{"title": "Launch", "start": "May 1st"}]}}`, `events: event event-1 start "May 1st" is neither an RFC 3339 time nor a date`},
+	}
+
+	exists := packageFiles("assets/data/sales.xlsx")
+	for _, test := range tests {
+		result := Validate([]byte(test.spec), exists)
+		if result.IsValid || !containsPrefix(result.Errors, test.expected) {
+			t.Errorf("Expected %q for %s, got %v", test.expected, test.spec, result.Errors)
+		}
+	}
+
+	result := Validate([]byte(`{"data": [{"id": "unused", "values": [1, 2]}]}`), nil)
+	if !result.IsValid || len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], `"unused" is not used`) {
+		t.Errorf("Expected an unused data source to be a warning, got %+v", result)
+	}
+
+	result = Validate([]byte(`{"animations": [{"id": "a", "target": "#a", "keyframes": [{"offset": 0.5, "styles": {}}, {"offset": 0.2, "styles": {}}]}]}`), nil)
+	if len(result.Findings) != 1 || result.Findings[0].Code != "interactive.check" || result.Findings[0].Path != "/animations/0/keyframes/1/offset" {
+		t.Errorf("Expected the finding to be located by a JSON pointer, got %+v", result.Findings)
+	}
+}
+
+func TestSchemaIsJSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("Expected the schema to be JSON: %v", err)
+	}
+	if schema["$schema"] != "https://json-schema.org/draft/2020-12/schema" {
+		t.Errorf("Expected a draft 2020-12 schema, got %v", schema["$schema"])
+	}
+	// Every reference resolves and every pattern compiles
+	if _, err := jsonschema.Parse(Schema); err != nil {
+		t.Errorf("Expected the schema to parse: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package interactive
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/liv-format/liv/pkg/jsonschema"
+)
+
+// Schema is the JSON Schema of the interactive spec, for editors and other
+// tools. Validate checks specs against it.
+//
+//go:embed schema.json
+var Schema []byte
+
+var (
+	schemaOnce sync.Once
+	schema     *jsonschema.Schema
+)
+
+// loadSchema parses the embedded schema
+func loadSchema() *jsonschema.Schema {
+	schemaOnce.Do(func() {
+		var err error
+		if schema, err = jsonschema.Parse(Schema); err != nil {
+			panic(fmt.Sprintf("invalid interactive spec schema: %v", err))
+		}
+	})
+	return schema
+}
+
+// checkSchema checks a spec against the schema and returns its errors, each
+// prefixed with the path of the offending value
+func checkSchema(spec []byte) []string {
+	decoder := json.NewDecoder(bytes.NewReader(spec))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	if decoder.More() {
+		return []string{"invalid JSON: unexpected data after the top-level object"}
+	}
+
+	var errors []string
+	for _, schemaErr := range loadSchema().Check(value) {
+		message := schemaErr.Message
+		if schemaErr.Suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %q?)", schemaErr.Suggestion)
+		}
+		if path := specPath(schemaErr.Path); path != "" {
+			message = path + ": " + message
+		}
+		errors = append(errors, message)
+	}
+	return errors
+}
+
+// specPath returns the keys leading to a value as a path such as
+// animations[0].keyframes
+func specPath(keys []interface{}) string {
+	var b strings.Builder
+	for _, key := range keys {
+		if i, ok := key.(int); ok {
+			fmt.Fprintf(&b, "[%d]", i)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		fmt.Fprint(&b, key)
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+)
+
+// Resources a job can run out of
+const (
+	ResourceTime   = "time"
+	ResourceMemory = "memory"
+	ResourceCPU    = "cpu"
+)
+
+// BudgetError reports that a job was stopped for exceeding its budget
+type BudgetError struct {
+	// Resource is the budget that ran out
+	Resource string `json:"resource"`
+	// Stage is the step of the job that was running when it stopped
+	Stage string `json:"stage,omitempty"`
+	// Limit and Used describe the budget for people, such as "2m0s" or
+	// "512 MB"
+	Limit string `json:"limit,omitempty"`
+	Used  string `json:"used,omitempty"`
+	// Hint suggests what the owner can do about it
+	Hint string `json:"hint,omitempty"`
+}
+
+func (e *BudgetError) Error() string {
+	message := e.Resource + " budget"
+	if e.Limit != "" {
+		message += " of " + e.Limit
+	}
+	message += " exceeded"
+	if e.Stage != "" {
+		message += " while " + e.Stage
+	}
+	if e.Used != "" {
+		message += fmt.Sprintf(" (used %s)", e.Used)
+	}
+	if e.Hint != "" {
+		message += "; " + e.Hint
+	}
+	return message
+}
+
+type stageKey struct{}
+
+// stageTracker lets a running job report its stage
+type stageTracker struct {
+	s *Scheduler
+	j *job
+}
+
+// SetStage records the step a job is at, as reported in its status and in
+// budget errors. It does nothing outside a job.
+func SetStage(ctx context.Context, stage string) {
+	tracker, ok := ctx.Value(stageKey{}).(*stageTracker)
+	if !ok {
+		return
+	}
+	tracker.s.mu.Lock()
+	defer tracker.s.mu.Unlock()
+	if tracker.j.State == StateRunning {
+		tracker.j.Stage = stage
+	}
+}
@@ -0,0 +1,609 @@
+// Package jobs runs conversion jobs on a fixed pool of workers shared between
+// tenants. Jobs run in priority order. Within a priority, tenants are served
+// by weighted fair queuing on the estimated cost of their jobs, so a tenant
+// submitting large jobs cannot starve one submitting small ones, and each
+// tenant may only run a limited number of jobs at once.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetention is how long finished jobs are kept for their owners
+const DefaultRetention = 15 * time.Minute
+
+// Priority orders jobs: all queued jobs of a higher priority run before any of
+// a lower one
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// ParsePriority returns the priority with the given name; empty is normal
+func ParsePriority(name string) (Priority, error) {
+	switch p := Priority(strings.ToLower(name)); p {
+	case "":
+		return PriorityNormal, nil
+	case PriorityLow, PriorityNormal, PriorityHigh:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown priority %q (use low, normal or high)", name)
+}
+
+func (p Priority) level() int {
+	switch p {
+	case PriorityHigh:
+		return 2
+	case PriorityNormal:
+		return 1
+	}
+	return 0
+}
+
+// State is the stage of a job
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// Finished reports whether a job in this state will not change again
+func (s State) Finished() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCanceled
+}
+
+var (
+	// ErrUnknownJob is returned for jobs that were removed or belong to
+	// another tenant
+	ErrUnknownJob = errors.New("job not found")
+	// ErrClosed is returned for jobs submitted after the scheduler closed
+	ErrClosed = errors.New("job scheduler is shut down")
+)
+
+// QueueFullError is returned when a tenant already has as many jobs queued as
+// allowed
+type QueueFullError struct {
+	Limit int
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("you already have %d jobs waiting (limit %d); wait for one to start or cancel one", e.Limit, e.Limit)
+}
+
+// Config configures a scheduler
+type Config struct {
+	// Workers is how many jobs run at once, at least one
+	Workers int
+	// TenantLimit caps the jobs a tenant runs at once; zero means Workers
+	TenantLimit int
+	// QueueLimit caps the jobs a tenant has queued; zero means unlimited
+	QueueLimit int
+	// Weights give tenants a larger share of the workers. Tenants that are
+	// not listed have weight 1.
+	Weights map[string]float64
+	// Retention is how long finished jobs are kept, DefaultRetention if zero
+	Retention time.Duration
+	// Timeout is the time budget of each job; zero means unlimited
+	Timeout time.Duration
+}
+
+// Spec describes a job to submit
+type Spec struct {
+	// Tenant is who the job belongs to and shares workers with others
+	Tenant   string
+	Priority Priority
+	// Cost estimates the work of the job, such as the size of its input.
+	// Jobs cost at least 1.
+	Cost int64
+	// Labels describe the job to its owner
+	Labels map[string]string
+	// Timeout overrides the time budget of the scheduler when positive
+	Timeout time.Duration
+	// Run does the work. Its context is canceled when the job is canceled,
+	// its time budget runs out or the scheduler closes. Run reports its
+	// progress with SetStage and may return a partial result together with a
+	// *BudgetError. Results that implement io.Closer are closed when the job
+	// is removed.
+	Run func(ctx context.Context) (interface{}, error)
+}
+
+// Status is a snapshot of a job
+type Status struct {
+	ID       string            `json:"id"`
+	Tenant   string            `json:"-"`
+	Priority Priority          `json:"priority"`
+	State    State             `json:"state"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Position is the place of a queued job in the queue, starting at 1.
+	// Jobs of tenants at their limit may be overtaken.
+	Position  int        `json:"position,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// Stage is the step a running job is at, or where a failed one stopped
+	Stage string `json:"stage,omitempty"`
+	// Budget explains why a job was stopped for exceeding its budget
+	Budget *BudgetError `json:"budget,omitempty"`
+	// Partial marks a failed job that kept the output produced before it
+	// stopped
+	Partial bool `json:"partial,omitempty"`
+	// Result is what Run returned for a succeeded job, or the partial output
+	// of a failed one
+	Result interface{} `json:"-"`
+}
+
+// Metrics describes current and cumulative scheduler activity
+type Metrics struct {
+	Workers          int              `json:"workers"`
+	Running          int              `json:"running"`
+	Queued           int              `json:"queued"`
+	QueuedByPriority map[Priority]int `json:"queued_by_priority"`
+	Tenants          int              `json:"tenants"`
+	// LongestWait is how long the oldest queued job has waited
+	LongestWait float64 `json:"longest_wait_seconds"`
+	Submitted   uint64  `json:"submitted"`
+	Succeeded   uint64  `json:"succeeded"`
+	Failed      uint64  `json:"failed"`
+	Canceled    uint64  `json:"canceled"`
+	Rejected    uint64  `json:"rejected"`
+	// BudgetExceeded counts the failed jobs stopped by their budget
+	BudgetExceeded uint64 `json:"budget_exceeded"`
+	TenantLimit    int    `json:"tenant_limit"`
+	QueueLimit     int    `json:"queue_limit"`
+	// Timeout is the default time budget in seconds
+	Timeout float64 `json:"timeout_seconds,omitempty"`
+}
+
+// job is a submitted job with its scheduling state
+type job struct {
+	Status
+	run     func(ctx context.Context) (interface{}, error)
+	timeout time.Duration
+	cancel  context.CancelFunc
+	// finish is the virtual time the job completes under fair queuing
+	start, finish float64
+	seq           uint64
+}
+
+// before reports whether a is dispatched before b
+func (a *job) before(b *job) bool {
+	if a.Priority != b.Priority {
+		return a.Priority.level() > b.Priority.level()
+	}
+	if a.finish != b.finish {
+		return a.finish < b.finish
+	}
+	return a.seq < b.seq
+}
+
+// Scheduler queues and runs jobs. It is safe for concurrent use.
+type Scheduler struct {
+	config Config
+	Now    func() time.Time
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	jobs    map[string]*job
+	queue   []*job
+	running map[string]int
+	// virtual is the virtual time of each priority: the start tag of the
+	// job dispatched last. last is the finish tag of each tenant's latest job.
+	virtual map[Priority]float64
+	last    map[Priority]map[string]float64
+	seq     uint64
+
+	submitted, succeeded, failed, canceled, rejected, budgetExceeded uint64
+}
+
+// New creates a scheduler
+func New(config Config) *Scheduler {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.TenantLimit <= 0 || config.TenantLimit > config.Workers {
+		config.TenantLimit = config.Workers
+	}
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		config:   config,
+		Now:      time.Now,
+		ctx:      ctx,
+		shutdown: cancel,
+		jobs:     make(map[string]*job),
+		running:  make(map[string]int),
+		virtual:  make(map[Priority]float64),
+		last:     make(map[Priority]map[string]float64),
+	}
+}
+
+// Config returns the configuration of the scheduler
+func (s *Scheduler) Config() Config {
+	return s.config
+}
+
+// Submit queues a job and starts it if a worker is free
+func (s *Scheduler) Submit(spec Spec) (Status, error) {
+	if spec.Run == nil {
+		return Status{}, errors.New("job has nothing to run")
+	}
+	priority, err := ParsePriority(string(spec.Priority))
+	if err != nil {
+		return Status{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Status{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Status{}, ErrClosed
+	}
+	s.purge()
+
+	if s.config.QueueLimit > 0 && s.queued(spec.Tenant) >= s.config.QueueLimit {
+		s.rejected++
+		return Status{}, &QueueFullError{Limit: s.config.QueueLimit}
+	}
+
+	// Tenants that were idle start at the current virtual time, so they gain
+	// no credit for the time they submitted nothing
+	cost := spec.Cost
+	if cost < 1 {
+		cost = 1
+	}
+	weight := s.config.Weights[spec.Tenant]
+	if weight <= 0 {
+		weight = 1
+	}
+	tags := s.last[priority]
+	if tags == nil {
+		tags = make(map[string]float64)
+		s.last[priority] = tags
+	}
+	start := s.virtual[priority]
+	if tag := tags[spec.Tenant]; tag > start {
+		start = tag
+	}
+	finish := start + float64(cost)/weight
+	tags[spec.Tenant] = finish
+
+	s.seq++
+	j := &job{
+		Status: Status{
+			ID:        id,
+			Tenant:    spec.Tenant,
+			Priority:  priority,
+			State:     StateQueued,
+			Labels:    spec.Labels,
+			Submitted: s.Now(),
+		},
+		run:     spec.Run,
+		timeout: s.config.Timeout,
+		start:   start,
+		finish:  finish,
+		seq:     s.seq,
+	}
+	if spec.Timeout > 0 {
+		j.timeout = spec.Timeout
+	}
+	s.jobs[id] = j
+	s.queue = append(s.queue, j)
+	s.submitted++
+
+	s.dispatch()
+	return s.status(j), nil
+}
+
+// Get returns a job of tenant
+func (s *Scheduler) Get(id, tenant string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+
+	j, ok := s.jobs[id]
+	if !ok || j.Tenant != tenant {
+		return Status{}, ErrUnknownJob
+	}
+	return s.status(j), nil
+}
+
+// List returns the jobs of tenant, newest first
+func (s *Scheduler) List(tenant string) []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+
+	var list []*job
+	for _, j := range s.jobs {
+		if j.Tenant == tenant {
+			list = append(list, j)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].seq > list[b].seq })
+
+	statuses := make([]Status, len(list))
+	for i, j := range list {
+		statuses[i] = s.status(j)
+	}
+	return statuses
+}
+
+// Cancel stops a queued or running job of tenant. Running jobs stop when their
+// work notices the canceled context. Finished jobs are left unchanged.
+func (s *Scheduler) Cancel(id, tenant string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+
+	j, ok := s.jobs[id]
+	if !ok || j.Tenant != tenant {
+		return Status{}, ErrUnknownJob
+	}
+	switch j.State {
+	case StateQueued:
+		s.remove(j)
+		s.finishJob(j, StateCanceled, "")
+	case StateRunning:
+		j.cancel()
+	}
+	return s.status(j), nil
+}
+
+// Metrics returns current and cumulative activity
+func (s *Scheduler) Metrics() Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+
+	m := Metrics{
+		Workers:          s.config.Workers,
+		QueuedByPriority: make(map[Priority]int),
+		Queued:           len(s.queue),
+		Submitted:        s.submitted,
+		Succeeded:        s.succeeded,
+		Failed:           s.failed,
+		Canceled:         s.canceled,
+		Rejected:         s.rejected,
+		BudgetExceeded:   s.budgetExceeded,
+		TenantLimit:      s.config.TenantLimit,
+		QueueLimit:       s.config.QueueLimit,
+		Timeout:          s.config.Timeout.Seconds(),
+	}
+	tenants := make(map[string]bool)
+	for tenant, running := range s.running {
+		m.Running += running
+		tenants[tenant] = true
+	}
+	now := s.Now()
+	for _, j := range s.queue {
+		m.QueuedByPriority[j.Priority]++
+		tenants[j.Tenant] = true
+		if wait := now.Sub(j.Submitted).Seconds(); wait > m.LongestWait {
+			m.LongestWait = wait
+		}
+	}
+	m.Tenants = len(tenants)
+	return m
+}
+
+// Close cancels all jobs and waits for running ones to return
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for _, j := range s.queue {
+		s.finishJob(j, StateCanceled, "")
+	}
+	s.queue = nil
+	s.mu.Unlock()
+
+	s.shutdown()
+	s.wg.Wait()
+}
+
+// dispatch starts queued jobs while workers are free. The next job is the
+// first in fair queuing order whose tenant is below its limit.
+func (s *Scheduler) dispatch() {
+	running := 0
+	for _, n := range s.running {
+		running += n
+	}
+
+	for running < s.config.Workers && !s.closed {
+		var next *job
+		for _, j := range s.queue {
+			if s.running[j.Tenant] >= s.config.TenantLimit {
+				continue
+			}
+			if next == nil || j.before(next) {
+				next = j
+			}
+		}
+		if next == nil {
+			return
+		}
+		s.remove(next)
+
+		if next.start > s.virtual[next.Priority] {
+			s.virtual[next.Priority] = next.start
+			s.forget(next.Priority)
+		}
+
+		ctx, cancel := context.WithCancel(s.ctx)
+		if next.timeout > 0 {
+			ctx, cancel = context.WithTimeout(s.ctx, next.timeout)
+		}
+		ctx = context.WithValue(ctx, stageKey{}, &stageTracker{s: s, j: next})
+		started := s.Now()
+		next.State = StateRunning
+		next.Started = &started
+		next.cancel = cancel
+		s.running[next.Tenant]++
+		running++
+
+		s.wg.Add(1)
+		go s.execute(ctx, next)
+	}
+}
+
+// execute runs a job on a worker and starts the next one when it returns. Jobs
+// that fail after their time budget ran out, or with a *BudgetError, keep
+// their partial result and the stage they stopped at.
+func (s *Scheduler) execute(ctx context.Context, j *job) {
+	defer s.wg.Done()
+	result, err := j.run(ctx)
+	expired := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	canceled := ctx.Err() != nil && !expired
+	j.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[j.Tenant]--; s.running[j.Tenant] <= 0 {
+		delete(s.running, j.Tenant)
+	}
+
+	var budget *BudgetError
+	switch {
+	case canceled:
+		closeResult(result)
+		s.finishJob(j, StateCanceled, "")
+	case err != nil && (errors.As(err, &budget) || expired):
+		if budget == nil {
+			budget = &BudgetError{
+				Resource: ResourceTime,
+				Limit:    j.timeout.String(),
+				Used:     s.Now().Sub(*j.Started).Round(time.Millisecond).String(),
+			}
+		}
+		if budget.Stage == "" {
+			budget.Stage = j.Stage
+		}
+		j.Stage = budget.Stage
+		j.Budget = budget
+		j.Result = result
+		j.Partial = result != nil
+		s.budgetExceeded++
+		s.finishJob(j, StateFailed, budget.Error())
+	case err != nil:
+		closeResult(result)
+		s.finishJob(j, StateFailed, err.Error())
+	default:
+		j.Result = result
+		j.Stage = ""
+		s.finishJob(j, StateSucceeded, "")
+	}
+	s.dispatch()
+}
+
+func (s *Scheduler) finishJob(j *job, state State, message string) {
+	finished := s.Now()
+	j.State = state
+	j.Finished = &finished
+	j.Error = message
+	switch state {
+	case StateSucceeded:
+		s.succeeded++
+	case StateFailed:
+		s.failed++
+	case StateCanceled:
+		s.canceled++
+	}
+}
+
+// status snapshots a job with its position in the queue
+func (s *Scheduler) status(j *job) Status {
+	status := j.Status
+	if j.State == StateQueued {
+		status.Position = 1
+		for _, other := range s.queue {
+			if other != j && other.before(j) {
+				status.Position++
+			}
+		}
+	}
+	return status
+}
+
+// queued counts the queued jobs of tenant
+func (s *Scheduler) queued(tenant string) int {
+	n := 0
+	for _, j := range s.queue {
+		if j.Tenant == tenant {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Scheduler) remove(j *job) {
+	for i, queued := range s.queue {
+		if queued == j {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// forget drops finish tags the virtual time has passed, which no longer
+// affect scheduling
+func (s *Scheduler) forget(priority Priority) {
+	for tenant, tag := range s.last[priority] {
+		if tag <= s.virtual[priority] {
+			delete(s.last[priority], tenant)
+		}
+	}
+}
+
+// purge removes finished jobs past their retention
+func (s *Scheduler) purge() {
+	cutoff := s.Now().Add(-s.config.Retention)
+	for id, j := range s.jobs {
+		if j.State.Finished() && j.Finished.Before(cutoff) {
+			closeResult(j.Result)
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func closeResult(result interface{}) {
+	if closer, ok := result.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,342 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder runs jobs that note their name when they run
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) job(name string) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		r.mu.Lock()
+		r.order = append(r.order, name)
+		r.mu.Unlock()
+		return name, nil
+	}
+}
+
+func (r *recorder) ran() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.order...)
+}
+
+// blocker occupies a worker until released
+func blocker() (func(ctx context.Context) (interface{}, error), func()) {
+	release := make(chan struct{})
+	return func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}, func() { close(release) }
+}
+
+func submit(t *testing.T, s *Scheduler, spec Spec) Status {
+	t.Helper()
+	status, err := s.Submit(spec)
+	if err != nil {
+		t.Fatalf("Failed to submit job: %v", err)
+	}
+	return status
+}
+
+// wait waits until the jobs of tenant have finished
+func wait(t *testing.T, s *Scheduler, tenant string, ids ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, id := range ids {
+		for {
+			status, err := s.Get(id, tenant)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if status.State.Finished() {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Job %s did not finish, state %s", id, status.State)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFairQueuing(t *testing.T) {
+	s := New(Config{Workers: 1})
+	defer s.Close()
+
+	run, release := blocker()
+	first := submit(t, s, Spec{Tenant: "other", Run: run})
+
+	// A tenant with large jobs queued first does not hold up small jobs of
+	// another tenant
+	r := &recorder{}
+	var large, small []string
+	for _, name := range []string{"large-1", "large-2"} {
+		large = append(large, submit(t, s, Spec{Tenant: "large", Cost: 100, Run: r.job(name)}).ID)
+	}
+	for _, name := range []string{"small-1", "small-2", "small-3"} {
+		small = append(small, submit(t, s, Spec{Tenant: "small", Cost: 10, Run: r.job(name)}).ID)
+	}
+
+	status, _ := s.Get(small[0], "small")
+	if status.State != StateQueued || status.Position != 1 {
+		t.Errorf("Expected the first small job to be next, got %s at %d", status.State, status.Position)
+	}
+	status, _ = s.Get(large[1], "large")
+	if status.Position != 5 {
+		t.Errorf("Expected the second large job to be last, got position %d", status.Position)
+	}
+
+	release()
+	wait(t, s, "other", first.ID)
+	wait(t, s, "large", large...)
+	wait(t, s, "small", small...)
+
+	expected := []string{"small-1", "small-2", "small-3", "large-1", "large-2"}
+	if order := r.ran(); !equal(order, expected) {
+		t.Errorf("Expected jobs to run in order %v, got %v", expected, order)
+	}
+}
+
+func TestWeights(t *testing.T) {
+	s := New(Config{Workers: 1, Weights: map[string]float64{"heavy": 2}})
+	defer s.Close()
+
+	run, release := blocker()
+	first := submit(t, s, Spec{Tenant: "other", Run: run})
+
+	r := &recorder{}
+	var ids []string
+	for _, tenant := range []string{"light", "heavy"} {
+		for i := 0; i < 3; i++ {
+			ids = append(ids, submit(t, s, Spec{Tenant: tenant, Cost: 10, Run: r.job(tenant)}).ID)
+		}
+	}
+	release()
+	wait(t, s, "other", first.ID)
+	wait(t, s, "light", ids[:3]...)
+	wait(t, s, "heavy", ids[3:]...)
+
+	// Twice the weight gets twice the share while both have jobs queued
+	expected := []string{"heavy", "light", "heavy", "heavy", "light", "light"}
+	if order := r.ran(); !equal(order, expected) {
+		t.Errorf("Expected jobs to run in order %v, got %v", expected, order)
+	}
+}
+
+func TestPriorities(t *testing.T) {
+	s := New(Config{Workers: 1})
+	defer s.Close()
+
+	run, release := blocker()
+	first := submit(t, s, Spec{Tenant: "other", Run: run})
+
+	r := &recorder{}
+	low := submit(t, s, Spec{Tenant: "a", Priority: PriorityLow, Run: r.job("low")})
+	normal := submit(t, s, Spec{Tenant: "a", Run: r.job("normal")})
+	high := submit(t, s, Spec{Tenant: "b", Priority: PriorityHigh, Cost: 1000, Run: r.job("high")})
+
+	if high.Position != 1 || normal.Priority != PriorityNormal {
+		t.Errorf("Expected the high priority job first, got position %d", high.Position)
+	}
+
+	release()
+	wait(t, s, "other", first.ID)
+	wait(t, s, "a", low.ID, normal.ID)
+	wait(t, s, "b", high.ID)
+
+	expected := []string{"high", "normal", "low"}
+	if order := r.ran(); !equal(order, expected) {
+		t.Errorf("Expected jobs to run in order %v, got %v", expected, order)
+	}
+
+	if _, err := s.Submit(Spec{Tenant: "a", Priority: "urgent", Run: r.job("urgent")}); err == nil {
+		t.Error("Expected an unknown priority to be rejected")
+	}
+}
+
+func TestTenantLimit(t *testing.T) {
+	s := New(Config{Workers: 3, TenantLimit: 1})
+	defer s.Close()
+
+	run1, release1 := blocker()
+	run2, release2 := blocker()
+	busy1 := submit(t, s, Spec{Tenant: "busy", Run: run1})
+	busy2 := submit(t, s, Spec{Tenant: "busy", Run: run2})
+	other := submit(t, s, Spec{Tenant: "other", Run: (&recorder{}).job("other")})
+
+	// A worker is free, but the busy tenant is at its limit
+	if busy1.State != StateRunning || busy2.State != StateQueued {
+		t.Errorf("Expected only one job of the tenant to run, got %s and %s", busy1.State, busy2.State)
+	}
+	wait(t, s, "other", other.ID)
+	if status, _ := s.Get(other.ID, "other"); status.State != StateSucceeded || status.Result != "other" {
+		t.Errorf("Expected the other tenant's job to run, got %+v", status)
+	}
+
+	release1()
+	wait(t, s, "busy", busy1.ID)
+	if status, _ := s.Get(busy2.ID, "busy"); status.State != StateRunning {
+		t.Errorf("Expected the next job to start, got %s", status.State)
+	}
+	release2()
+	wait(t, s, "busy", busy2.ID)
+
+	if m := s.Metrics(); m.Succeeded != 3 || m.Running != 0 || m.TenantLimit != 1 {
+		t.Errorf("Unexpected metrics: %+v", m)
+	}
+}
+
+func TestCancelAndQueueLimit(t *testing.T) {
+	s := New(Config{Workers: 1, QueueLimit: 2})
+	defer s.Close()
+
+	run, release := blocker()
+	defer release()
+	running := submit(t, s, Spec{Tenant: "a", Run: run})
+	queued1 := submit(t, s, Spec{Tenant: "a", Run: run})
+	queued2 := submit(t, s, Spec{Tenant: "a", Run: run})
+
+	var full *QueueFullError
+	if _, err := s.Submit(Spec{Tenant: "a", Run: run}); !errors.As(err, &full) || full.Limit != 2 {
+		t.Errorf("Expected the queue limit, got %v", err)
+	}
+	if _, err := s.Get(queued1.ID, "b"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Expected jobs of other tenants to be hidden, got %v", err)
+	}
+
+	status, err := s.Cancel(queued1.ID, "a")
+	if err != nil || status.State != StateCanceled {
+		t.Fatalf("Expected the queued job to be canceled, got %s: %v", status.State, err)
+	}
+	if status, _ := s.Get(queued2.ID, "a"); status.Position != 1 {
+		t.Errorf("Expected the remaining job to move up, got position %d", status.Position)
+	}
+
+	// Running jobs stop through their context
+	if _, err := s.Cancel(running.ID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, s, "a", running.ID)
+	if status, _ := s.Get(running.ID, "a"); status.State != StateCanceled {
+		t.Errorf("Expected the running job to be canceled, got %s", status.State)
+	}
+
+	if list := s.List("a"); len(list) != 3 || list[0].ID != queued2.ID {
+		t.Errorf("Expected the tenant's jobs newest first, got %+v", list)
+	}
+	if m := s.Metrics(); m.Canceled != 2 || m.Rejected != 1 {
+		t.Errorf("Unexpected metrics: %+v", m)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := New(Config{Workers: 1, Retention: time.Minute})
+	s.Now = func() time.Time { return now }
+	defer s.Close()
+
+	closed := make(chan bool, 1)
+	done := submit(t, s, Spec{Tenant: "a", Run: func(ctx context.Context) (interface{}, error) {
+		return closer(closed), nil
+	}})
+	failed := submit(t, s, Spec{Tenant: "a", Run: func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("conversion failed")
+	}})
+	wait(t, s, "a", done.ID, failed.ID)
+	if status, _ := s.Get(failed.ID, "a"); status.State != StateFailed || status.Error != "conversion failed" {
+		t.Errorf("Expected the job to fail, got %+v", status)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := s.Get(done.ID, "a"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Expected finished jobs to be removed after retention, got %v", err)
+	}
+	select {
+	case <-closed:
+	default:
+		t.Error("Expected the result of a removed job to be closed")
+	}
+
+	s.Close()
+	if _, err := s.Submit(Spec{Tenant: "a", Run: (&recorder{}).job("late")}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected jobs to be rejected after close, got %v", err)
+	}
+}
+
+type closer chan bool
+
+func (c closer) Close() error {
+	c <- true
+	return nil
+}
+
+func TestBudgets(t *testing.T) {
+	s := New(Config{Workers: 2, Timeout: 20 * time.Millisecond})
+	defer s.Close()
+
+	// Jobs past their time budget keep what they produced so far
+	slow := submit(t, s, Spec{Tenant: "a", Run: func(ctx context.Context) (interface{}, error) {
+		SetStage(ctx, "converting")
+		<-ctx.Done()
+		return "half", ctx.Err()
+	}})
+	large := submit(t, s, Spec{Tenant: "a", Timeout: time.Minute, Run: func(ctx context.Context) (interface{}, error) {
+		SetStage(ctx, "loading images")
+		return nil, &BudgetError{Resource: ResourceMemory, Limit: "1 MB"}
+	}})
+	wait(t, s, "a", slow.ID, large.ID)
+
+	status, _ := s.Get(slow.ID, "a")
+	if status.State != StateFailed || !status.Partial || status.Result != "half" {
+		t.Errorf("Expected a partial result, got %+v", status)
+	}
+	if b := status.Budget; b == nil || b.Resource != ResourceTime || b.Stage != "converting" || b.Limit != "20ms" {
+		t.Errorf("Unexpected budget error %+v", b)
+	}
+	if !strings.Contains(status.Error, "time budget of 20ms exceeded while converting") {
+		t.Errorf("Unexpected error %q", status.Error)
+	}
+
+	status, _ = s.Get(large.ID, "a")
+	if b := status.Budget; b == nil || b.Resource != ResourceMemory || b.Stage != "loading images" || status.Partial {
+		t.Errorf("Expected the memory budget error, got %+v", status)
+	}
+
+	done := submit(t, s, Spec{Tenant: "a", Run: func(ctx context.Context) (interface{}, error) {
+		SetStage(ctx, "converting")
+		return "done", nil
+	}})
+	wait(t, s, "a", done.ID)
+	if status, _ := s.Get(done.ID, "a"); status.State != StateSucceeded || status.Stage != "" || status.Budget != nil {
+		t.Errorf("Expected the job to succeed, got %+v", status)
+	}
+	if m := s.Metrics(); m.BudgetExceeded != 2 || m.Failed != 2 {
+		t.Errorf("Unexpected metrics: %+v", m)
+	}
+}
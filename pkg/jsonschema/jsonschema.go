@@ -0,0 +1,454 @@
+// Package jsonschema checks decoded JSON against the JSON Schemas of the LIV
+// formats. It implements the keywords those schemas use rather than all of
+// JSON Schema: $ref to local definitions, anyOf, type, enum, properties,
+// required, additionalProperties, items, minItems, maxItems, minProperties,
+// maxProperties, minLength, maxLength, pattern, the date-time format, minimum
+// and maximum.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is a parsed schema
+type Schema struct {
+	root     map[string]interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// Parse parses a schema, compiling its patterns and checking that its
+// references resolve
+func Parse(data []byte) (*Schema, error) {
+	s := &Schema{patterns: make(map[string]*regexp.Regexp)}
+	if err := json.Unmarshal(data, &s.root); err != nil {
+		return nil, err
+	}
+	if err := s.compile(s.root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) compile(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if pattern, ok := v["pattern"].(string); ok && s.patterns[pattern] == nil {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+			s.patterns[pattern] = compiled
+		}
+		if ref, ok := v["$ref"].(string); ok && s.resolve(ref) == nil {
+			return fmt.Errorf("schema has no %s", ref)
+		}
+		for _, child := range v {
+			if err := s.compile(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if err := s.compile(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema a local reference, #/$defs/<name>, points to, or
+// nil if there is none
+func (s *Schema) resolve(ref string) map[string]interface{} {
+	name, local := strings.CutPrefix(ref, "#/$defs/")
+	if !local {
+		return nil
+	}
+	defs, _ := s.root["$defs"].(map[string]interface{})
+	schema, _ := defs[name].(map[string]interface{})
+	return schema
+}
+
+// Error is a value that does not match its schema
+type Error struct {
+	// Path leads to the value from the one checked: property names and array
+	// indexes
+	Path []interface{}
+	// Keyword is the schema keyword the value fails, such as "type",
+	// "required" or "additionalProperties"
+	Keyword string
+	// Property is the missing property of a required error, or the unknown
+	// one of an additionalProperties error; Path leads to their object
+	Property string
+	// Message describes what is wrong, without the path
+	Message string
+	// Suggestion is the known property an unknown one is most likely a typo
+	// of, or ""
+	Suggestion string
+}
+
+// Check checks a value, decoded with json.Decoder.UseNumber, against the
+// schema and returns where it does not match. Properties are checked in
+// name order, so the errors are in a stable order.
+func (s *Schema) Check(value interface{}) []Error {
+	c := &checker{schema: s}
+	c.check(s.root, value, nil)
+	return c.errors
+}
+
+type checker struct {
+	schema *Schema
+	errors []Error
+}
+
+func (c *checker) fail(keys []interface{}, keyword, format string, args ...interface{}) {
+	c.errors = append(c.errors, Error{Path: keys, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) check(schema map[string]interface{}, value interface{}, keys []interface{}) {
+	if ref, ok := schema["$ref"].(string); ok {
+		c.check(c.schema.resolve(ref), value, keys)
+		return
+	}
+	if branches, ok := schema["anyOf"].([]interface{}); ok {
+		c.checkAnyOf(branches, value, keys)
+		return
+	}
+
+	if !matchesType(schema["type"], value) {
+		c.fail(keys, "type", "must be %s, not %s", describeType(schema["type"]), article(typeOf(value)))
+		return
+	}
+
+	if allowed, ok := schema["enum"].([]interface{}); ok {
+		for _, option := range allowed {
+			if equal(option, value) {
+				return
+			}
+		}
+		c.fail(keys, "enum", "must be one of %s, not %s", quoteAll(allowed), describe(value))
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c.checkObject(schema, v, keys)
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			c.fail(keys, "minItems", "must have at least %v item%s", min, plural(min))
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			c.fail(keys, "maxItems", "must have at most %v item%s", max, plural(max))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				c.check(items, item, append(keys[:len(keys):len(keys)], i))
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			if min == 1 {
+				c.fail(keys, "minLength", "must not be empty")
+			} else {
+				c.fail(keys, "minLength", "must be at least %v characters", min)
+			}
+			return
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			c.fail(keys, "maxLength", "must be at most %v characters", max)
+			return
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !c.schema.patterns[pattern].MatchString(v) {
+			if description, ok := schema["description"].(string); ok {
+				c.fail(keys, "pattern", "%q is not %s", v, lowerFirst(description))
+			} else {
+				c.fail(keys, "pattern", "%q does not match %s", v, pattern)
+			}
+			return
+		}
+		if format, _ := schema["format"].(string); format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				c.fail(keys, "format", "%q is not an RFC 3339 date and time", v)
+			}
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			c.fail(keys, "minimum", "must be at least %v, not %s", min, v)
+		}
+		if max, ok := schema["maximum"].(float64); ok && n > max {
+			c.fail(keys, "maximum", "must be at most %v, not %s", max, v)
+		}
+	}
+}
+
+func (c *checker) checkObject(schema map[string]interface{}, object map[string]interface{}, keys []interface{}) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, exists := object[name.(string)]; !exists {
+				c.errors = append(c.errors, Error{
+					Path:     keys,
+					Keyword:  "required",
+					Property: name.(string),
+					Message:  fmt.Sprintf("missing required property %q", name),
+				})
+			}
+		}
+	}
+	if min, ok := schema["minProperties"].(float64); ok && float64(len(object)) < min {
+		c.fail(keys, "minProperties", "must have at least %v %s", min, entries(min))
+	}
+	if max, ok := schema["maxProperties"].(float64); ok && float64(len(object)) > max {
+		c.fail(keys, "maxProperties", "must have at most %v %s", max, entries(max))
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := append(keys[:len(keys):len(keys)], name)
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			c.check(property, object[name], child)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				c.errors = append(c.errors, Error{
+					Path:       keys,
+					Keyword:    "additionalProperties",
+					Property:   name,
+					Message:    fmt.Sprintf("unknown property %q", name),
+					Suggestion: closestProperty(name, properties),
+				})
+			}
+		case map[string]interface{}:
+			c.check(additional, object[name], child)
+		}
+	}
+}
+
+// checkAnyOf passes values matching a branch. Otherwise the errors of the
+// only branch of the value's type are reported, or what the branches expect.
+func (c *checker) checkAnyOf(branches []interface{}, value interface{}, keys []interface{}) {
+	var candidates [][]Error
+	var expected []string
+	for _, branch := range branches {
+		schema := branch.(map[string]interface{})
+		for ref, ok := schema["$ref"].(string); ok; ref, ok = schema["$ref"].(string) {
+			schema = c.schema.resolve(ref)
+		}
+		attempt := &checker{schema: c.schema}
+		attempt.check(schema, value, keys)
+		if len(attempt.errors) == 0 {
+			return
+		}
+
+		allowed, enumerated := schema["enum"].([]interface{})
+		if (schema["type"] != nil && matchesType(schema["type"], value)) || (enumerated && enumHasType(allowed, value)) {
+			candidates = append(candidates, attempt.errors)
+		}
+		switch description, described := schema["description"].(string); {
+		case described:
+			expected = append(expected, lowerFirst(description))
+		case enumerated:
+			expected = append(expected, "one of "+quoteAll(allowed))
+		default:
+			expected = append(expected, describeType(schema["type"]))
+		}
+	}
+	if len(candidates) == 1 {
+		c.errors = append(c.errors, candidates[0]...)
+		return
+	}
+	c.fail(keys, "anyOf", "must be %s, not %s", strings.Join(expected, " or "), describe(value))
+}
+
+// matchesType reports whether a value has the type, or one of the types, of
+// a schema; schemas without a type match any value
+func matchesType(types interface{}, value interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return hasType(value, t)
+	case []interface{}:
+		for _, option := range t {
+			if hasType(value, option.(string)) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func hasType(value interface{}, expected string) bool {
+	actual := typeOf(value)
+	if expected == "number" && actual == "integer" {
+		return true
+	}
+	return actual == expected
+}
+
+// typeOf returns the JSON Schema type of a decoded value. Numbers with a
+// fraction or exponent are not integers, as they do not decode into Go
+// integers.
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// equal reports whether a decoded value is an enum option. Options are
+// decoded without UseNumber, so their numbers are float64.
+func equal(option, value interface{}) bool {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Float64()
+		f, ok := option.(float64)
+		return ok && err == nil && n == f
+	case string, bool, nil:
+		return option == value
+	default:
+		return false
+	}
+}
+
+// enumHasType reports whether a value has the type of one of the options of
+// an enum
+func enumHasType(allowed []interface{}, value interface{}) bool {
+	for _, option := range allowed {
+		if hasType(value, typeOf(option)) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeType(types interface{}) string {
+	switch t := types.(type) {
+	case string:
+		return article(t)
+	case []interface{}:
+		names := make([]string, 0, len(t))
+		for _, option := range t {
+			names = append(names, article(fmt.Sprint(option)))
+		}
+		return strings.Join(names, " or ")
+	default:
+		return "a value"
+	}
+}
+
+func article(t string) string {
+	switch t {
+	case "object", "array", "integer":
+		return "an " + t
+	case "null":
+		return "null"
+	default:
+		return "a " + t
+	}
+}
+
+// describe returns a value for an error message: strings and numbers as they
+// are, other values by type
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case json.Number:
+		return v.String()
+	default:
+		return article(typeOf(value))
+	}
+}
+
+func quoteAll(values []interface{}) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", fmt.Sprint(value))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func plural(n float64) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func entries(n float64) string {
+	if n == 1 {
+		return "entry"
+	}
+	return "entries"
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// closestProperty returns the known property an unknown one is most likely a
+// typo of, or "" when none is close
+func closestProperty(name string, properties map[string]interface{}) string {
+	best, bestDistance := "", 3
+	for property := range properties {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(property))
+		if distance < bestDistance || (distance == bestDistance && property < best) {
+			best, bestDistance = property, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
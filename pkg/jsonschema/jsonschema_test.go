@@ -0,0 +1,82 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["title"],
+  "additionalProperties": false,
+  "properties": {
+    "title": { "type": "string", "minLength": 1 },
+    "created": { "type": "string", "format": "date-time" },
+    "level": { "type": "integer", "enum": [1, 2, 3] },
+    "author": { "anyOf": [{ "$ref": "#/$defs/Person" }, { "type": "null" }] },
+    "tags": { "type": ["array", "null"], "maxItems": 2, "items": { "type": "string", "pattern": "^[a-z]+$" } }
+  },
+  "$defs": {
+    "Person": {
+      "type": "object",
+      "required": ["name"],
+      "properties": { "name": { "type": "string" } }
+    }
+  }
+}`
+
+func check(t *testing.T, document string) []Error {
+	t.Helper()
+	schema, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(document)))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	return schema.Check(value)
+}
+
+func TestCheck(t *testing.T) {
+	if errs := check(t, `{"title": "Report", "created": "2024-01-02T03:04:05Z", "level": 2, "author": null, "tags": null}`); len(errs) != 0 {
+		t.Fatalf("Expected a valid document, got %v", errs)
+	}
+
+	tests := []struct {
+		document string
+		want     Error
+	}{
+		{`{}`, Error{Keyword: "required", Property: "title", Message: `missing required property "title"`}},
+		{`{"title": ""}`, Error{Path: []interface{}{"title"}, Keyword: "minLength", Message: "must not be empty"}},
+		{`{"title": 1}`, Error{Path: []interface{}{"title"}, Keyword: "type", Message: "must be a string, not an integer"}},
+		{`{"title": "a", "created": "yesterday"}`, Error{Path: []interface{}{"created"}, Keyword: "format", Message: `"yesterday" is not an RFC 3339 date and time`}},
+		{`{"title": "a", "level": 4}`, Error{Path: []interface{}{"level"}, Keyword: "enum", Message: `must be one of "1", "2", "3", not 4`}},
+		{`{"title": "a", "level": 1.5}`, Error{Path: []interface{}{"level"}, Keyword: "type", Message: "must be an integer, not a number"}},
+		{`{"title": "a", "author": {}}`, Error{Path: []interface{}{"author"}, Keyword: "required", Property: "name", Message: `missing required property "name"`}},
+		{`{"title": "a", "author": "Ada"}`, Error{Path: []interface{}{"author"}, Keyword: "anyOf", Message: `must be an object or null, not "Ada"`}},
+		{`{"title": "a", "tags": {}}`, Error{Path: []interface{}{"tags"}, Keyword: "type", Message: "must be an array or null, not an object"}},
+		{`{"title": "a", "tags": ["a", "b", "c"]}`, Error{Path: []interface{}{"tags"}, Keyword: "maxItems", Message: "must have at most 2 items"}},
+		{`{"title": "a", "tags": ["a", "B"]}`, Error{Path: []interface{}{"tags", 1}, Keyword: "pattern", Message: `"B" does not match ^[a-z]+$`}},
+		{`{"title": "a", "titel": "b"}`, Error{Keyword: "additionalProperties", Property: "titel", Message: `unknown property "titel"`, Suggestion: "title"}},
+	}
+	for _, tt := range tests {
+		errs := check(t, tt.document)
+		if len(errs) != 1 || !reflect.DeepEqual(errs[0], tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.document, tt.want, errs)
+		}
+	}
+}
+
+func TestParseRejectsUnresolvedReferences(t *testing.T) {
+	if _, err := Parse([]byte(`{"properties": {"a": {"$ref": "#/$defs/Missing"}}}`)); err == nil {
+		t.Error("Expected a reference to a missing definition to be refused")
+	}
+	if _, err := Parse([]byte(`{"pattern": "("}`)); err == nil {
+		t.Error("Expected an invalid pattern to be refused")
+	}
+}
@@ -0,0 +1,148 @@
+package liv
+
+import (
+	"crypto"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/sections"
+)
+
+// BuildOptions sets the metadata of a built document and how it is signed
+type BuildOptions struct {
+	// Title defaults to the title of content/index.html
+	Title string
+	// Author defaults to "LIV Builder" and Language to "en"
+	Author      string
+	Language    string
+	Description string
+	// Key signs the document when set, as Signer
+	Key    crypto.Signer
+	Signer core.SignerInfo
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// Build packages the sources in dir, with the page at content/index.html, as
+// liv-builder does: headings get section anchors, every file is recorded as
+// a resource, and documents with scripts or WebAssembly get the interactive
+// security policy. Hidden files and a manifest.json already in dir are left
+// out. The document is returned in memory; Save writes it.
+func Build(dir string, opts BuildOptions) (*Document, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "manifest.json" {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		files[rel] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sources: %w", err)
+	}
+	page, ok := files["content/index.html"]
+	if !ok {
+		return nil, &core.FileMissingError{Path: "content/index.html"}
+	}
+
+	interactive := false
+	for name, data := range files {
+		switch path.Ext(name) {
+		case ".js", ".wasm":
+			interactive = true
+		case ".html", ".htm":
+			if strings.HasPrefix(name, "content/") {
+				files[name], _ = sections.Anchor(data)
+			}
+		}
+	}
+
+	title := opts.Title
+	if title == "" {
+		title = "LIV Document"
+		if match := titlePattern.FindSubmatch(page); match != nil && strings.TrimSpace(string(match[1])) != "" {
+			title = html.UnescapeString(strings.TrimSpace(string(match[1])))
+		}
+	}
+	author := opts.Author
+	if author == "" {
+		author = "LIV Builder"
+	}
+	builder := manifest.CreateStaticDocumentTemplate(title, author)
+	if interactive {
+		builder = manifest.CreateInteractiveDocumentTemplate(title, author)
+	}
+	metadata := builder.GetManifest().Metadata
+	metadata.Description = opts.Description
+	if opts.Language != "" {
+		metadata.Language = opts.Language
+	}
+
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	for name, data := range files {
+		builder.AddResource(name, &core.Resource{
+			Hash: hasher.HashBytes(data),
+			Size: int64(len(data)),
+			Type: manifest.MimeType(name),
+			Path: name,
+		})
+		if path.Ext(name) == ".wasm" {
+			module := strings.TrimSuffix(path.Base(name), ".wasm")
+			builder.AddWASMModule(&core.WASMModule{
+				Name:       module,
+				Version:    "1.0.0",
+				EntryPoint: "main",
+				Exports:    []string{"main", "memory"},
+				Imports:    []string{"env"},
+				Metadata:   map[string]string{"path": name},
+			})
+		}
+	}
+	builder.DiscoverVariants()
+
+	data, err := builder.BuildJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build manifest: %w", err)
+	}
+	files["manifest.json"] = data
+	doc, err := newDocument(files)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Key != nil {
+		if err := doc.Sign(opts.Key, opts.Signer); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,91 @@
+package liv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/convert"
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// Format is a format documents are converted to
+type Format string
+
+const (
+	// HTML is a standalone page with the document's styles inlined
+	HTML Format = "html"
+	// Markdown is CommonMark with GitHub Flavored Markdown tables
+	Markdown Format = "markdown"
+	// BRF is a braille ready file in uncontracted Unified English Braille
+	BRF Format = "brf"
+)
+
+// ErrUnsupportedFormat is returned by Convert for formats it cannot write.
+// PDF and EPUB are written by liv convert only.
+var ErrUnsupportedFormat = errors.New("unsupported conversion format")
+
+// Convert writes the document to w in format, as liv convert does
+func (d *Document) Convert(format Format, w io.Writer) error {
+	var output string
+	switch format {
+	case HTML:
+		html, err := d.standaloneHTML()
+		if err != nil {
+			return err
+		}
+		output = html
+	case Markdown:
+		html, err := d.staticHTML()
+		if err != nil {
+			return err
+		}
+		if output, err = convert.HTMLToMarkdown(html); err != nil {
+			return err
+		}
+	case BRF:
+		html, err := d.staticHTML()
+		if err != nil {
+			return err
+		}
+		if output, err = convert.HTMLToBRF(html, convert.BRFOptions{}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	_, err := io.WriteString(w, output)
+	return err
+}
+
+// standaloneHTML returns the document's page with its styles inlined, and
+// its custom metadata so converting back keeps it
+func (d *Document) standaloneHTML() (string, error) {
+	data, ok := d.files["content/index.html"]
+	if !ok {
+		return "", &core.FileMissingError{Path: "content/index.html"}
+	}
+	html := string(data)
+	if css, ok := d.files["content/styles/main.css"]; ok && len(css) > 0 {
+		style := fmt.Sprintf("<style>\n%s\n</style>", css)
+		if end := strings.Index(strings.ToLower(html), "</head>"); end != -1 {
+			html = html[:end] + style + "\n" + html[end:]
+		} else {
+			html = style + "\n" + html
+		}
+	}
+	return convert.EmbedExtensions(html, d.manifest.Extensions)
+}
+
+// staticHTML returns the page text formats are converted from: the static
+// fallback, which has all the text without scripts, or the page itself
+func (d *Document) staticHTML() (string, error) {
+	if fallback, ok := d.files["content/static/fallback.html"]; ok && len(fallback) > 0 {
+		return string(fallback), nil
+	}
+	if html, ok := d.files["content/index.html"]; ok {
+		return string(html), nil
+	}
+	return "", &core.FileMissingError{Path: "content/index.html"}
+}
@@ -0,0 +1,237 @@
+// Package liv is the high-level Go API for LIV documents. It opens, builds,
+// validates, signs and converts documents without the caller putting the
+// container, manifest and integrity packages together:
+//
+//	doc, err := liv.Open("report.liv")
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(doc.Metadata().Title)
+//	if result := doc.Validate(); !result.IsValid {
+//		return fmt.Errorf("invalid document: %v", result.Errors)
+//	}
+//	key, err := liv.LoadPrivateKey("signing.pem")
+//	if err != nil {
+//		return err
+//	}
+//	if err := doc.Sign(key); err != nil {
+//		return err
+//	}
+//	if err := doc.Save("report-signed.liv"); err != nil {
+//		return err
+//	}
+//	return doc.Convert(liv.Markdown, os.Stdout)
+//
+// Documents are held in memory; changes are written with Save or WriteTo.
+package liv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+	"github.com/liv-format/liv/pkg/manifest"
+	"github.com/liv-format/liv/pkg/verification"
+)
+
+// Document is a LIV document held in memory
+type Document struct {
+	files    map[string][]byte
+	manifest *core.Manifest
+	// saved is the manifest as in files, to tell whether it was changed
+	saved []byte
+}
+
+// Open reads the document at path
+func Open(path string) (*Document, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(file, info.Size())
+}
+
+// Read reads a document of size bytes from r
+func Read(r io.ReaderAt, size int64) (*Document, error) {
+	files, err := container.NewZIPContainer().ExtractFromReaderToMemory(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	return newDocument(files)
+}
+
+// newDocument parses the manifest of a document's files. The manifest is
+// parsed without validating it, so invalid documents can still be opened
+// and checked with Validate.
+func newDocument(files map[string][]byte) (*Document, error) {
+	data, ok := files["manifest.json"]
+	if !ok {
+		return nil, core.ErrManifestMissing
+	}
+	var m *core.Manifest
+	if err := json.Unmarshal(data, &m); err != nil || m == nil {
+		return nil, fmt.Errorf("%w: %v", core.ErrManifestInvalid, err)
+	}
+	if m.Resources == nil {
+		m.Resources = make(map[string]*core.Resource)
+	}
+	saved, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{files: files, manifest: m, saved: saved}, nil
+}
+
+// Manifest returns the document's manifest. Changes to it are saved with
+// the document, but invalidate its signatures until it is signed again.
+func (d *Document) Manifest() *core.Manifest {
+	return d.manifest
+}
+
+// Metadata returns the title, authors and other metadata of the document
+func (d *Document) Metadata() *core.DocumentMetadata {
+	if d.manifest.Metadata == nil {
+		d.manifest.Metadata = &core.DocumentMetadata{}
+	}
+	return d.manifest.Metadata
+}
+
+// Files lists the files of the document's package in path order
+func (d *Document) Files() []string {
+	paths := make([]string, 0, len(d.files))
+	for path := range d.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ReadFile returns a file of the document's package, such as
+// content/index.html
+func (d *Document) ReadFile(path string) ([]byte, error) {
+	data, ok := d.files[path]
+	if !ok {
+		return nil, &core.FileMissingError{Path: path}
+	}
+	return data, nil
+}
+
+// Signed reports whether the document carries signatures
+func (d *Document) Signed() bool {
+	for path := range d.files {
+		if strings.HasPrefix(path, "signatures/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the structure of the package, its manifest and that every
+// resource the manifest lists is there with its recorded hash. It does not
+// check signatures; Verify does.
+func (d *Document) Validate() *core.ValidationResult {
+	result := container.NewZIPContainer().ValidateStructureFromMemory(d.files)
+	merge := func(other *core.ValidationResult) {
+		result.Errors = append(result.Errors, other.Errors...)
+		result.Warnings = append(result.Warnings, other.Warnings...)
+		result.Findings = append(result.Findings, other.Findings...)
+		result.IsValid = result.IsValid && other.IsValid
+	}
+	if data, ok := d.files["manifest.json"]; ok {
+		_, manifestResult := manifest.NewManifestValidator().ValidateManifestJSON(data)
+		merge(manifestResult)
+	}
+	for _, err := range integrity.NewResourceHasher(integrity.SHA256).VerifyResources(d.manifest, d.files) {
+		result.Errors = append(result.Errors, err.Error())
+		result.IsValid = false
+	}
+	return result
+}
+
+// Save writes the document to path
+func (d *Document) Save(path string) error {
+	if err := d.sync(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return container.NewZIPContainer().CreateFromFiles(d.files, path)
+}
+
+// WriteTo writes the document's package to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if err := d.sync(); err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	if err := container.NewZIPContainer().CreateFromFilesToWriter(d.files, &buf); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// sync writes the manifest back into the package when it was changed, so
+// unchanged documents are saved as they were read
+func (d *Document) sync() error {
+	current, err := json.Marshal(d.manifest)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, d.saved) {
+		data, err := manifestJSON(d.manifest)
+		if err != nil {
+			return err
+		}
+		d.files["manifest.json"] = data
+		// Building the manifest puts its times in UTC
+		if d.saved, err = json.Marshal(d.manifest); err != nil {
+			return err
+		}
+	}
+	// A verification descriptor must describe the package as written
+	return verification.Refresh(d.files)
+}
+
+// manifestJSON serializes a manifest, validating it as the builder does
+func manifestJSON(m *core.Manifest) ([]byte, error) {
+	builder := manifest.NewManifestBuilder()
+	builder.SetMetadata(m.Metadata)
+	builder.SetSecurityPolicy(m.Security)
+	if m.WASMConfig != nil {
+		builder.SetWASMConfig(m.WASMConfig)
+	}
+	if m.Features != nil {
+		builder.SetFeatureFlags(m.Features)
+	}
+	builder.SetEncryption(m.Encryption)
+	builder.SetDisclosure(m.Disclosure)
+	builder.SetLicense(m.License)
+	builder.SetCompliance(m.Compliance)
+	builder.SetRequirements(m.Requirements)
+	builder.SetExtensions(m.Extensions)
+	builder.SetAccess(m.Access)
+	if m.Print != nil {
+		builder.SetPrintSettings(m.Print)
+	}
+	if m.Data != nil {
+		builder.SetData(m.Data)
+	}
+	for path, resource := range m.Resources {
+		builder.AddResource(path, resource)
+	}
+	return builder.BuildJSON()
+}
@@ -0,0 +1,127 @@
+package liv
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+func writeSources(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"content/index.html":      "<html><head><title>Quarterly Report</title></head><body><h1>Quarterly Report</h1><p>Revenue grew.</p><h2>Outlook</h2><p>Steady.</p></body></html>",
+		"content/styles/main.css": "body { font-family: serif; }",
+		".draft/notes.txt":        "not packaged",
+		"manifest.json":           "{}",
+	} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuildOpenSignConvert(t *testing.T) {
+	doc, err := Build(writeSources(t), BuildOptions{Author: "ACME Corp"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if doc.Metadata().Title != "Quarterly Report" || doc.Metadata().Author != "ACME Corp" {
+		t.Errorf("Unexpected metadata %+v", doc.Metadata())
+	}
+	for _, name := range doc.Files() {
+		if strings.HasPrefix(name, ".draft/") {
+			t.Errorf("Hidden file %s was packaged", name)
+		}
+	}
+	if page, err := doc.ReadFile("content/index.html"); err != nil || !bytes.Contains(page, []byte(`id="outlook"`)) {
+		t.Errorf("Expected the headings to be anchored, got %s %v", page, err)
+	}
+
+	sm := integrity.NewSignatureManager()
+	key, err := sm.GenerateSigningKeyPair(integrity.AlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Sign(key.PrivateKey, core.SignerInfo{Name: "Finance"}); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "report.liv")
+	if err := doc.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if result := opened.Validate(); !result.IsValid {
+		t.Errorf("Expected the document to be valid, got %v", result.Errors)
+	}
+	if !opened.Signed() {
+		t.Error("Expected the document to be signed")
+	}
+	if err := opened.Verify(key.PublicKey); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	var markdown bytes.Buffer
+	if err := opened.Convert(Markdown, &markdown); err != nil || !strings.Contains(markdown.String(), "# Quarterly Report") {
+		t.Errorf("Unexpected Markdown %q: %v", markdown.String(), err)
+	}
+	var page bytes.Buffer
+	if err := opened.Convert(HTML, &page); err != nil || !strings.Contains(page.String(), "<style>\nbody { font-family: serif; }") {
+		t.Errorf("Expected the styles to be inlined, got %q: %v", page.String(), err)
+	}
+	if err := opened.Convert("docx", &page); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected an unsupported format, got %v", err)
+	}
+
+	// Changing the metadata invalidates the signatures until signed again
+	opened.Metadata().Title = "Annual Report"
+	var buf bytes.Buffer
+	if _, err := opened.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Metadata().Title != "Annual Report" {
+		t.Errorf("Expected the change to be saved, got %q", changed.Metadata().Title)
+	}
+	if err := changed.Verify(key.PublicKey); !errors.Is(err, core.ErrSignatureInvalid) {
+		t.Errorf("Expected the changed document to fail verification, got %v", err)
+	}
+}
+
+func TestValidateTamperedResource(t *testing.T) {
+	doc, err := Build(writeSources(t), BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := doc.Validate(); !result.IsValid {
+		t.Fatalf("Expected the built document to be valid, got %v", result.Errors)
+	}
+	doc.files["content/styles/main.css"] = []byte("body { display: none; }")
+	if result := doc.Validate(); result.IsValid {
+		t.Error("Expected a changed resource to fail validation")
+	}
+	if err := doc.Verify(nil); !errors.Is(err, core.ErrSignatureInvalid) {
+		t.Errorf("Expected an unsigned document to fail verification, got %v", err)
+	}
+	if _, err := Build(t.TempDir(), BuildOptions{}); err == nil {
+		t.Error("Expected sources without content/index.html to be refused")
+	}
+}
@@ -0,0 +1,91 @@
+package liv
+
+import (
+	"crypto"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+// LoadPrivateKey reads a PEM signing key, as liv sign --key does
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	return integrity.NewSignatureManager().LoadPrivateKeyPEM(path)
+}
+
+// LoadPublicKey reads a PEM public key to verify signatures with
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	return integrity.NewSignatureManager().LoadPublicKeyPEM(path)
+}
+
+// Sign signs the document with key, replacing any signatures it had, as
+// liv sign does. The signer, when given, names who signed it.
+func (d *Document) Sign(key crypto.Signer, signer ...core.SignerInfo) error {
+	sm := integrity.NewSignatureManager()
+	// The manifest signature covers the modification time
+	d.Metadata().Modified = core.UTC(time.Now())
+	if err := d.sync(); err != nil {
+		return err
+	}
+	signatures, err := sm.SignDocument(d.livDocument(), key)
+	if err != nil {
+		return fmt.Errorf("failed to sign document: %w", err)
+	}
+	var info core.SignerInfo
+	if len(signer) > 0 {
+		info = signer[0]
+	}
+	info.KeyID = sm.KeyID(key.Public())
+	info.SignedAt = core.UTC(time.Now())
+	signatures.Signer = &info
+
+	for name := range d.files {
+		if strings.HasPrefix(name, "signatures/") && name != "signatures/certificate.pem" {
+			delete(d.files, name)
+		}
+	}
+	for name, data := range container.SignatureFiles(signatures) {
+		d.files[name] = data
+	}
+	return nil
+}
+
+// Verify checks the document's signatures with the signer's public key. It
+// returns an error wrapping core.ErrSignatureInvalid when the document is
+// not signed or was changed since.
+func (d *Document) Verify(key crypto.PublicKey) error {
+	signatures, err := container.ReadSignatureFiles(d.files)
+	if err != nil {
+		return err
+	}
+	if signatures.ManifestSignature == "" {
+		return fmt.Errorf("%w: document is not signed", core.ErrSignatureInvalid)
+	}
+	document := d.livDocument()
+	document.Signatures = signatures
+	return integrity.NewSignatureManager().VerifyDocument(document, key).Err()
+}
+
+// livDocument returns the parts of the document signatures cover
+func (d *Document) livDocument() *core.LIVDocument {
+	document := &core.LIVDocument{
+		Manifest: d.manifest,
+		Content: &core.DocumentContent{
+			HTML:            string(d.files["content/index.html"]),
+			CSS:             string(d.files["content/styles/main.css"]),
+			InteractiveSpec: string(d.files["content/scripts/main.js"]),
+			StaticFallback:  string(d.files["content/static/fallback.html"]),
+		},
+		WASMModules: make(map[string][]byte),
+	}
+	for name, data := range d.files {
+		if path.Ext(name) == ".wasm" {
+			document.WASMModules[strings.TrimSuffix(path.Base(name), ".wasm")] = data
+		}
+	}
+	return document
+}
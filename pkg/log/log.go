@@ -0,0 +1,243 @@
+// Package log is the structured logging shared by the LIV commands. Records
+// are written through log/slog as JSON, or as text for people at a terminal,
+// to one or more sinks: standard error, files and syslog. Fields added to a
+// context, such as the document and user a request is about, are written
+// with every record logged with that context.
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// LevelFatal is the level of records logged before the program exits
+const LevelFatal = slog.Level(12)
+
+// Keys of the request-scoped fields
+const (
+	DocumentID = "document_id"
+	UserID     = "user_id"
+)
+
+// Config selects what is logged, how and where
+type Config struct {
+	// Level is the least level written: debug, info (the default), warn or
+	// error
+	Level string
+	// Format is json (the default) or text
+	Format string
+	// Output is a comma-separated list of sinks: stderr (the default),
+	// stdout, syslog for the local syslog daemon, syslog://host:port or
+	// syslog+tcp://host:port for a remote one, and file paths, optionally
+	// prefixed with file:
+	Output string
+	// Tag names the program in syslog; the program's name when unset
+	Tag string
+}
+
+// Logger writes structured records. It satisfies core.Logger.
+type Logger struct {
+	*slog.Logger
+	closers []io.Closer
+}
+
+// New creates a logger from a configuration
+func New(config Config) (*Logger, error) {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel}
+	var format func(io.Writer) slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "", "json":
+		format = func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, options) }
+	case "text":
+		format = func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, options) }
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected json or text)", config.Format)
+	}
+	if config.Tag == "" {
+		config.Tag = filepath.Base(os.Args[0])
+	}
+
+	l := &Logger{}
+	var handlers []slog.Handler
+	for _, output := range strings.Split(config.Output, ",") {
+		handler, closer, err := openSink(strings.TrimSpace(output), config.Tag, format)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		if closer != nil {
+			l.closers = append(l.closers, closer)
+		}
+		handlers = append(handlers, handler)
+	}
+	var handler slog.Handler = multiHandler(handlers)
+	if len(handlers) == 1 {
+		handler = handlers[0]
+	}
+	l.Logger = slog.New(contextHandler{handler})
+	return l, nil
+}
+
+// ParseLevel reads a level name: debug, info, warn or error. The empty name
+// is info.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	switch strings.ToLower(name) {
+	case "":
+		return slog.LevelInfo, nil
+	case "warning":
+		return slog.LevelWarn, nil
+	case "fatal":
+		return LevelFatal, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// replaceLevel names the fatal level
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level >= LevelFatal {
+			a.Value = slog.StringValue("FATAL")
+		}
+	}
+	return a
+}
+
+// openSink returns the handler writing to an output and what closes it
+func openSink(output, tag string, format func(io.Writer) slog.Handler) (slog.Handler, io.Closer, error) {
+	switch {
+	case output == "" || output == "stderr":
+		return format(os.Stderr), nil, nil
+	case output == "stdout":
+		return format(os.Stdout), nil, nil
+	case output == "syslog":
+		return openSyslog("", "", tag, format)
+	case strings.HasPrefix(output, "syslog://"):
+		return openSyslog("udp", strings.TrimPrefix(output, "syslog://"), tag, format)
+	case strings.HasPrefix(output, "syslog+tcp://"):
+		return openSyslog("tcp", strings.TrimPrefix(output, "syslog+tcp://"), tag, format)
+	}
+	path := strings.TrimPrefix(output, "file:")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open log file: %v", err)
+	}
+	return format(file), file, nil
+}
+
+// With returns a logger that adds args to each record
+func (l *Logger) With(args ...interface{}) *Logger {
+	return &Logger{Logger: l.Logger.With(args...)}
+}
+
+// Fatal logs a record at the fatal level and exits
+func (l *Logger) Fatal(msg string, args ...interface{}) {
+	l.Log(context.Background(), LevelFatal, msg, args...)
+	l.Close()
+	os.Exit(1)
+}
+
+// Close closes the files and connections of the logger's sinks. Loggers
+// made by With share their sinks and are not closed themselves.
+func (l *Logger) Close() error {
+	var first error
+	for _, closer := range l.closers {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	l.closers = nil
+	return first
+}
+
+var defaultLogger atomic.Value
+
+func init() {
+	defaultLogger.Store(&Logger{Logger: slog.New(contextHandler{slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{ReplaceAttr: replaceLevel})})})
+}
+
+// Default returns the default logger, which writes JSON to standard error
+// at the info level until SetDefault is called
+func Default() *Logger {
+	return defaultLogger.Load().(*Logger)
+}
+
+// SetDefault makes l the default logger. The log/slog and standard log
+// packages write through it too, so libraries that log with them join the
+// same stream.
+func SetDefault(l *Logger) {
+	defaultLogger.Store(l)
+	slog.SetDefault(l.Logger)
+}
+
+// Setup creates a logger from a configuration and makes it the default
+func Setup(config Config) (*Logger, error) {
+	l, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	SetDefault(l)
+	return l, nil
+}
+
+// Debug logs at the debug level with the default logger
+func Debug(msg string, args ...interface{}) {
+	Default().Debug(msg, args...)
+}
+
+// Info logs at the info level with the default logger
+func Info(msg string, args ...interface{}) {
+	Default().Info(msg, args...)
+}
+
+// Warn logs at the warn level with the default logger
+func Warn(msg string, args ...interface{}) {
+	Default().Warn(msg, args...)
+}
+
+// Error logs at the error level with the default logger
+func Error(msg string, args ...interface{}) {
+	Default().Error(msg, args...)
+}
+
+// Fatal logs at the fatal level with the default logger and exits
+func Fatal(msg string, args ...interface{}) {
+	Default().Fatal(msg, args...)
+}
+
+// DebugContext logs at the debug level with the default logger and the
+// fields of ctx
+func DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	Default().DebugContext(ctx, msg, args...)
+}
+
+// InfoContext logs at the info level with the default logger and the fields
+// of ctx
+func InfoContext(ctx context.Context, msg string, args ...interface{}) {
+	Default().InfoContext(ctx, msg, args...)
+}
+
+// WarnContext logs at the warn level with the default logger and the fields
+// of ctx
+func WarnContext(ctx context.Context, msg string, args ...interface{}) {
+	Default().WarnContext(ctx, msg, args...)
+}
+
+// ErrorContext logs at the error level with the default logger and the
+// fields of ctx
+func ErrorContext(ctx context.Context, msg string, args ...interface{}) {
+	Default().ErrorContext(ctx, msg, args...)
+}
@@ -0,0 +1,107 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readRecords decodes the JSON records of a log file
+func readRecords(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Record %q is not JSON: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggerFileSink(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	logger, err := New(Config{Level: "warn", Output: "file:" + first + "," + second})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx := WithFields(context.Background(), UserID, "alice", DocumentID, "doc-1")
+	ctx = WithFields(ctx, DocumentID, "doc-2")
+	logger.Info("not written")
+	logger.WarnContext(ctx, "Document rejected", "reason", "tampered")
+	logger.With("component", "store").Error("Disk full")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{first, second} {
+		records := readRecords(t, path)
+		if len(records) != 2 {
+			t.Fatalf("Expected 2 records in %s, got %v", path, records)
+		}
+		warning := records[0]
+		if warning["level"] != "WARN" || warning["msg"] != "Document rejected" || warning["reason"] != "tampered" {
+			t.Errorf("Unexpected record %v", warning)
+		}
+		if warning[UserID] != "alice" || warning[DocumentID] != "doc-2" {
+			t.Errorf("Expected the context's fields, got %v", warning)
+		}
+		if records[1]["component"] != "store" || records[1][UserID] != nil {
+			t.Errorf("Unexpected record %v", records[1])
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, config := range []Config{
+		{Level: "verbose"},
+		{Format: "xml"},
+		{Output: filepath.Join(t.TempDir(), "missing", "liv.log")},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("Expected %+v to be refused", config)
+		}
+	}
+	for name, expected := range map[string]string{"": "INFO", "DEBUG": "DEBUG", "warning": "WARN", "error": "ERROR"} {
+		if level, err := ParseLevel(name); err != nil || level.String() != expected {
+			t.Errorf("ParseLevel(%q) = %v, %v", name, level, err)
+		}
+	}
+}
+
+func TestTextFormatAndDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "liv.log")
+	previous := Default()
+	defer SetDefault(previous)
+
+	logger, err := Setup(Config{Level: "debug", Format: "text", Output: path})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	Debug("Starting", "port", 8080)
+	InfoContext(WithFields(context.Background(), UserID, "bob"), "Signed in")
+	logger.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"level=DEBUG msg=Starting port=8080", "level=INFO msg=\"Signed in\" user_id=bob"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, data)
+		}
+	}
+}
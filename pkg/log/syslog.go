@@ -0,0 +1,81 @@
+//go:build !windows && !plan9
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+)
+
+// writerFunc writes each record as one syslog message
+type writerFunc func(string) error
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	if err := f(string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syslogHandler sends records to syslog at the priority of their level
+type syslogHandler struct {
+	// handlers write at debug, info, warning, err and crit priority
+	handlers [5]slog.Handler
+}
+
+// openSyslog connects to a syslog daemon, the local one when network is
+// empty
+func openSyslog(network, address, tag string, format func(io.Writer) slog.Handler) (slog.Handler, io.Closer, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	h := &syslogHandler{}
+	for i, write := range []writerFunc{w.Debug, w.Info, w.Warning, w.Err, w.Crit} {
+		h.handlers[i] = format(write)
+	}
+	return h, w, nil
+}
+
+// handler returns the handler writing records of a level
+func (h *syslogHandler) handler(level slog.Level) slog.Handler {
+	switch {
+	case level < slog.LevelInfo:
+		return h.handlers[0]
+	case level < slog.LevelWarn:
+		return h.handlers[1]
+	case level < slog.LevelError:
+		return h.handlers[2]
+	case level < LevelFatal:
+		return h.handlers[3]
+	default:
+		return h.handlers[4]
+	}
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler(level).Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler(r.Level).Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := &syslogHandler{}
+	for i, handler := range h.handlers {
+		derived.handlers[i] = handler.WithAttrs(attrs)
+	}
+	return derived
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	derived := &syslogHandler{}
+	for i, handler := range h.handlers {
+		derived.handlers[i] = handler.WithGroup(name)
+	}
+	return derived
+}
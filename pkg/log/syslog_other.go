@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// openSyslog fails: there is no syslog on this platform
+func openSyslog(network, address, tag string, format func(io.Writer) slog.Handler) (slog.Handler, io.Closer, error) {
+	return nil, nil, fmt.Errorf("syslog is not supported on this platform")
+}
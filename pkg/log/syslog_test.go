@@ -0,0 +1,37 @@
+//go:build !windows && !plan9
+
+package log
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	logger, err := New(Config{Output: "syslog://" + conn.LocalAddr().String(), Tag: "liv-test"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer logger.Close()
+	logger.Warn("Low disk space", "free_mb", 12)
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No syslog message received: %v", err)
+	}
+	message := string(buf[:n])
+	// daemon facility (3) at warning priority (4)
+	if !strings.HasPrefix(message, "<28>") || !strings.Contains(message, "liv-test") || !strings.Contains(message, `"msg":"Low disk space","free_mb":12`) {
+		t.Errorf("Unexpected syslog message %q", message)
+	}
+}
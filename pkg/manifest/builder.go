@@ -11,7 +11,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/liv-format/liv/pkg/atomicfile"
 	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/variants"
 )
 
 // ManifestBuilder helps create and populate manifest structures
@@ -55,6 +57,60 @@ func (mb *ManifestBuilder) SetFeatureFlags(features *core.FeatureFlags) *Manifes
 	return mb
 }
 
+// SetEncryption sets the payload encryption parameters
+func (mb *ManifestBuilder) SetEncryption(info *core.EncryptionInfo) *ManifestBuilder {
+	mb.manifest.Encryption = info
+	return mb
+}
+
+// SetDisclosure sets the confidential sections of the document
+func (mb *ManifestBuilder) SetDisclosure(disclosure *core.DisclosureInfo) *ManifestBuilder {
+	mb.manifest.Disclosure = disclosure
+	return mb
+}
+
+// SetLicense sets the document license
+func (mb *ManifestBuilder) SetLicense(license *core.LicenseInfo) *ManifestBuilder {
+	mb.manifest.License = license
+	return mb
+}
+
+// SetCompliance sets the recorded compliance waivers
+func (mb *ManifestBuilder) SetCompliance(compliance *core.ComplianceInfo) *ManifestBuilder {
+	mb.manifest.Compliance = compliance
+	return mb
+}
+
+// SetRequirements sets the viewer capabilities the document requires
+func (mb *ManifestBuilder) SetRequirements(requirements *core.ViewerRequirements) *ManifestBuilder {
+	mb.manifest.Requirements = requirements
+	return mb
+}
+
+// SetPrintSettings sets the page hints for printing and PDF export
+func (mb *ManifestBuilder) SetPrintSettings(settings *core.PrintSettings) *ManifestBuilder {
+	mb.manifest.Print = settings
+	return mb
+}
+
+// SetData sets the data files of the document and their schemas
+func (mb *ManifestBuilder) SetData(data map[string]*core.DataAsset) *ManifestBuilder {
+	mb.manifest.Data = data
+	return mb
+}
+
+// SetExtensions sets the custom metadata of organizations by namespace
+func (mb *ManifestBuilder) SetExtensions(extensions map[string]json.RawMessage) *ManifestBuilder {
+	mb.manifest.Extensions = extensions
+	return mb
+}
+
+// SetAccess sets when and how often readers may open the document
+func (mb *ManifestBuilder) SetAccess(access *core.AccessPolicy) *ManifestBuilder {
+	mb.manifest.Access = access
+	return mb
+}
+
 // AddResource adds a resource to the manifest
 func (mb *ManifestBuilder) AddResource(path string, resource *core.Resource) *ManifestBuilder {
 	if mb.manifest.Resources == nil {
@@ -68,25 +124,25 @@ func (mb *ManifestBuilder) AddResource(path string, resource *core.Resource) *Ma
 func (mb *ManifestBuilder) AddResourceFromFile(path, filePath string) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+		return fmt.Errorf("failed to open file %s: %w", filePath, err)
 	}
 	defer file.Close()
 
 	// Get file info
 	info, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to get file info for %s: %v", filePath, err)
+		return fmt.Errorf("failed to get file info for %s: %w", filePath, err)
 	}
 
 	// Calculate hash
 	hasher := sha256.New()
 	if _, err := io.Copy(hasher, file); err != nil {
-		return fmt.Errorf("failed to calculate hash for %s: %v", filePath, err)
+		return fmt.Errorf("failed to calculate hash for %s: %w", filePath, err)
 	}
 	hash := hex.EncodeToString(hasher.Sum(nil))
 
 	// Determine MIME type
-	mimeType := mb.getMimeType(filePath)
+	mimeType := MimeType(filePath)
 
 	// Create resource
 	resource := &core.Resource{
@@ -102,7 +158,7 @@ func (mb *ManifestBuilder) AddResourceFromFile(path, filePath string) error {
 
 // ScanDirectory scans a directory and adds all files as resources
 func (mb *ManifestBuilder) ScanDirectory(baseDir string) error {
-	return filepath.Walk(baseDir, func(filePath string, info os.FileInfo, err error) error {
+	err := filepath.Walk(baseDir, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -115,20 +171,45 @@ func (mb *ManifestBuilder) ScanDirectory(baseDir string) error {
 		// Calculate relative path
 		relPath, err := filepath.Rel(baseDir, filePath)
 		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
+			return fmt.Errorf("failed to get relative path: %w", err)
 		}
 
 		// Normalize path separators for cross-platform compatibility
 		relPath = filepath.ToSlash(relPath)
 
+		// A manifest already in the directory cannot list itself
+		if relPath == "manifest.json" {
+			return nil
+		}
+
 		// Add resource
 		return mb.AddResourceFromFile(relPath, filePath)
 	})
+	if err != nil {
+		return err
+	}
+
+	mb.DiscoverVariants()
+	return nil
+}
+
+// DiscoverVariants records the variants among the resources by their names:
+// photo@2x.png, photo-960w.png and chart.low.json are variants of photo.png
+// and chart.json
+func (mb *ManifestBuilder) DiscoverVariants() *ManifestBuilder {
+	paths := make([]string, 0, len(mb.manifest.Resources))
+	for path := range mb.manifest.Resources {
+		paths = append(paths, path)
+	}
+	for path, found := range variants.Discover(paths) {
+		mb.manifest.Resources[path].Variants = found
+	}
+	return mb
 }
 
 // CreateDefaultMetadata creates default metadata with current timestamp
 func (mb *ManifestBuilder) CreateDefaultMetadata(title, author string) *ManifestBuilder {
-	now := time.Now()
+	now := core.UTC(time.Now())
 	metadata := &core.DocumentMetadata{
 		Title:       title,
 		Author:      author,
@@ -212,7 +293,7 @@ func (mb *ManifestBuilder) AddWASMModule(module *core.WASMModule) *ManifestBuild
 func (mb *ManifestBuilder) LoadFromFile(filePath string) error {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read manifest file: %v", err)
+		return fmt.Errorf("failed to read manifest file: %w", err)
 	}
 
 	manifest, result := mb.validator.ValidateManifestJSON(data)
@@ -224,12 +305,16 @@ func (mb *ManifestBuilder) LoadFromFile(filePath string) error {
 	return nil
 }
 
-// Build validates and returns the completed manifest
+// Build validates and returns the completed manifest, its times in UTC
 func (mb *ManifestBuilder) Build() (*core.Manifest, error) {
+	if mb.manifest.Metadata != nil {
+		mb.manifest.Metadata.NormalizeTimes()
+	}
+
 	// Validate the manifest
 	result := mb.validator.ValidateManifest(mb.manifest)
 	if !result.IsValid {
-		return nil, fmt.Errorf("manifest validation failed: %v", result.Errors)
+		return nil, fmt.Errorf("%w: %v", core.ErrManifestInvalid, result.Errors)
 	}
 
 	// Return a copy to prevent further modifications
@@ -246,7 +331,7 @@ func (mb *ManifestBuilder) BuildJSON() ([]byte, error) {
 
 	data, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal manifest to JSON: %v", err)
+		return nil, fmt.Errorf("failed to marshal manifest to JSON: %w", err)
 	}
 
 	return data, nil
@@ -263,7 +348,7 @@ func (mb *ManifestBuilder) SaveToFile(filePath string) error {
 
 	// Validate the manifest before serialization
 	if result := mb.validator.ValidateManifest(mb.manifest); !result.IsValid {
-		return fmt.Errorf("manifest validation failed: %v", result.Errors)
+		return fmt.Errorf("%w: %v", core.ErrManifestInvalid, result.Errors)
 	}
 
 	// Marshal manifest to JSON
@@ -274,17 +359,17 @@ func (mb *ManifestBuilder) SaveToFile(filePath string) error {
 
 	data, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal manifest to JSON: %v", err)
+		return fmt.Errorf("failed to marshal manifest to JSON: %w", err)
 	}
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %v", err)
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	// Write manifest file
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write manifest file: %v", err)
+	if err := atomicfile.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
 	}
 
 	return nil
@@ -302,7 +387,9 @@ func (mb *ManifestBuilder) Validate() *core.ValidationResult {
 
 // Helper methods
 
-func (mb *ManifestBuilder) getMimeType(filePath string) string {
+// MimeType returns the type a file is recorded with as a resource, by its
+// extension
+func MimeType(filePath string) string {
 	ext := strings.ToLower(filepath.Ext(filePath))
 	
 	mimeTypes := map[string]string{
@@ -461,4 +548,66 @@ func CreateStaticDocumentTemplate(title, author string) *ManifestBuilder {
 	mb.SetFeatureFlags(features)
 	
 	return mb
-}
\ No newline at end of file
+}
+
+// CreatePresentationDocumentTemplate creates a template for slide
+// presentations: scripted and animated, without WebAssembly
+func CreatePresentationDocumentTemplate(title, author string) *ManifestBuilder {
+	mb := NewManifestBuilder()
+	
+	// Set metadata
+	mb.CreateDefaultMetadata(title, author)
+	
+	// Scripts move between slides; nothing leaves the document
+	policy := &core.SecurityPolicy{
+		WASMPermissions: &core.WASMPermissions{
+			MemoryLimit:     1024, // 1KB minimum
+			AllowedImports:  []string{},
+			CPUTimeLimit:    100, // 100ms minimum
+			AllowNetworking: false,
+			AllowFileSystem: false,
+		},
+		JSPermissions: &core.JSPermissions{
+			ExecutionMode: "sandboxed",
+			AllowedAPIs:   []string{"dom"},
+			DOMAccess:     "write",
+		},
+		NetworkPolicy: &core.NetworkPolicy{
+			AllowOutbound: false,
+			AllowedHosts:  []string{},
+			AllowedPorts:  []int{},
+		},
+		StoragePolicy: &core.StoragePolicy{
+			AllowLocalStorage:   false,
+			AllowSessionStorage: true,
+			AllowIndexedDB:      false,
+			AllowCookies:        false,
+		},
+		ContentSecurityPolicy: "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline';",
+		TrustedDomains:        []string{},
+	}
+	mb.SetSecurityPolicy(policy)
+	
+	features := &core.FeatureFlags{
+		Animations:    true,
+		Interactivity: true,
+	}
+	mb.SetFeatureFlags(features)
+	
+	// Slides print one to a landscape page
+	mb.SetPrintSettings(&core.PrintSettings{PageSize: "A4", Orientation: "landscape"})
+	
+	return mb
+}
+
+// CreateReportDocumentTemplate creates a template for reports: static
+// content laid out for print, with a contents page
+func CreateReportDocumentTemplate(title, author string) *ManifestBuilder {
+	mb := CreateStaticDocumentTemplate(title, author)
+	mb.SetPrintSettings(&core.PrintSettings{
+		PageSize:        "A4",
+		Footer:          "{title}||{page} / {pages}",
+		TableOfContents: true,
+	})
+	return mb
+}
@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/datasets"
+)
+
+// namespacePattern matches reverse-DNS namespaces such as com.example.records
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// ValidNamespace reports whether ns is a reverse-DNS extension namespace: two
+// or more lowercase labels separated by dots, the domain of the organization
+// reversed
+func ValidNamespace(ns string) bool {
+	return namespacePattern.MatchString(ns)
+}
+
+// RegisterExtension registers the schema of the extension metadata of a
+// namespace. Extensions of registered namespaces are checked against their
+// schema; those of other namespaces are passed through unchecked.
+func (mv *ManifestValidator) RegisterExtension(namespace string, schema *core.DataSchema) error {
+	if !ValidNamespace(namespace) {
+		return fmt.Errorf("extension namespace %q is not a reverse-DNS name such as com.example.records", namespace)
+	}
+	if schema == nil || len(schema.Fields) == 0 {
+		return fmt.Errorf("extension %s schema has no fields", namespace)
+	}
+	if err := mv.validator.Struct(schema); err != nil {
+		return fmt.Errorf("extension %s schema is invalid: %v", namespace, err)
+	}
+	if mv.extensions == nil {
+		mv.extensions = make(map[string]*core.DataSchema)
+	}
+	mv.extensions[namespace] = schema
+	return nil
+}
+
+// LoadExtensionSchemas reads extension schemas from a JSON file mapping
+// namespaces to schemas in the form of data schemas:
+// {"com.example.records": {"fields": [{"name": "case_number", "type": "string"}]}}
+func LoadExtensionSchemas(path string) (map[string]*core.DataSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extension schemas: %w", err)
+	}
+	var schemas map[string]*core.DataSchema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return nil, fmt.Errorf("invalid extension schemas: %w", err)
+	}
+	return schemas, nil
+}
+
+// validateExtensions checks that extensions are JSON objects under reverse-DNS
+// namespaces, and those of registered namespaces against their schema
+func (mv *ManifestValidator) validateExtensions(extensions map[string]json.RawMessage, result *core.ValidationResult) {
+	namespaces := make([]string, 0, len(extensions))
+	for ns := range extensions {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		pointer := core.JSONPointer("extensions", ns)
+		if !ValidNamespace(ns) {
+			result.AddError("extension.namespace", pointer, fmt.Sprintf("extension namespace %q is not a reverse-DNS name", ns)).
+				Suggestion = "Name extensions after a domain of your organization, reversed, such as com.example.records"
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(extensions[ns], &record); err != nil || record == nil {
+			result.AddError("extension.invalid", pointer, fmt.Sprintf("extension %s must be a JSON object", ns))
+			continue
+		}
+
+		schema := mv.extensions[ns]
+		if schema == nil {
+			result.Add(&core.Finding{
+				Code:     "extension.unregistered",
+				Severity: core.SeverityInfo,
+				Message:  fmt.Sprintf("extension %s has no registered schema and was not checked", ns),
+				Path:     pointer,
+			})
+			continue
+		}
+		_, errs := datasets.Record(record, schema)
+		for _, err := range errs {
+			result.AddError("extension.schema", pointer, fmt.Sprintf("extension %s: %v", ns, err))
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package manifest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// funderRegistryPrefix is the DOI prefix of the Crossref Funder Registry
+const funderRegistryPrefix = "10.13039/"
+
+// FunderRegistry is a controlled vocabulary of research funders, such as an
+// extract of the Crossref Funder Registry, that the funding a document
+// acknowledges is checked against
+type FunderRegistry struct {
+	// names maps funder IDs to their preferred names
+	names map[string]string
+	// ids maps lowercased preferred and alternate names to funder IDs
+	ids map[string]string
+}
+
+// LoadFunderRegistry reads a funder registry from a CSV file
+func LoadFunderRegistry(path string) (*FunderRegistry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open funder registry: %w", err)
+	}
+	defer file.Close()
+	return ParseFunderRegistry(file)
+}
+
+// ParseFunderRegistry reads a funder registry in CSV: one funder per row with
+// its ID, preferred name and any alternate names. IDs may be registry DOIs,
+// DOI URLs or bare registry numbers. A header row and lines starting with #
+// are skipped.
+func ParseFunderRegistry(r io.Reader) (*FunderRegistry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	registry := &FunderRegistry{names: make(map[string]string), ids: make(map[string]string)}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid funder registry: %w", err)
+		}
+		if row == 1 && len(record) > 0 && strings.Contains(strings.ToLower(record[0]), "id") {
+			continue
+		}
+		if len(record) < 2 || strings.TrimSpace(record[1]) == "" {
+			return nil, fmt.Errorf("invalid funder registry: row %d needs an ID and a name", row)
+		}
+		id := NormalizeFunderID(record[0])
+		if !core.ValidDOI(id) {
+			return nil, fmt.Errorf("invalid funder registry: row %d has invalid funder ID %q", row, record[0])
+		}
+		registry.names[id] = strings.TrimSpace(record[1])
+		for _, name := range record[1:] {
+			if key := funderKey(name); key != "" {
+				registry.ids[key] = id
+			}
+		}
+	}
+	if len(registry.names) == 0 {
+		return nil, fmt.Errorf("funder registry lists no funders")
+	}
+	return registry, nil
+}
+
+// Len returns the number of funders in the registry
+func (fr *FunderRegistry) Len() int {
+	return len(fr.names)
+}
+
+// Lookup returns the ID and preferred name of a funder by ID, preferred name
+// or alternate name
+func (fr *FunderRegistry) Lookup(funder string) (id, name string, found bool) {
+	if name, found := fr.names[NormalizeFunderID(funder)]; found {
+		return NormalizeFunderID(funder), name, true
+	}
+	if id, found := fr.ids[funderKey(funder)]; found {
+		return id, fr.names[id], true
+	}
+	return "", "", false
+}
+
+// NormalizeFunderID returns a funder ID as a registry DOI, accepting DOI URLs
+// and bare registry numbers such as 100000001
+func NormalizeFunderID(id string) string {
+	id = strings.TrimSpace(id)
+	for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi:"} {
+		if len(id) > len(prefix) && strings.EqualFold(id[:len(prefix)], prefix) {
+			id = id[len(prefix):]
+			break
+		}
+	}
+	if id != "" && strings.Trim(id, "0123456789") == "" {
+		id = funderRegistryPrefix + id
+	}
+	return id
+}
+
+func funderKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// validateFunding checks that each funder is listed once, with its grants
+// together, and that no grant is listed twice
+func (mv *ManifestValidator) validateFunding(funding []*core.FundingInfo) []string {
+	var errors []string
+	seen := make(map[string]bool)
+	for _, grant := range funding {
+		if grant == nil {
+			continue
+		}
+		key := "name:" + funderKey(grant.Funder)
+		if grant.FunderID != "" {
+			key = "id:" + grant.FunderID
+		}
+		if seen[key] {
+			errors = append(errors, fmt.Sprintf("funder %s is listed more than once; list all its grants in one entry", grant.Funder))
+		}
+		seen[key] = true
+
+		awards := make(map[string]bool)
+		for _, award := range grant.Awards {
+			if awards[award] {
+				errors = append(errors, fmt.Sprintf("grant %s of %s is listed more than once", award, grant.Funder))
+			}
+			awards[award] = true
+		}
+	}
+	return errors
+}
+
+// ValidateFundingRegistry checks the funders a document acknowledges against
+// a controlled vocabulary. Funders must be in the registry; funders named
+// differently from the registry or given without their ID are warned about,
+// with the registry's name and ID.
+func (mv *ManifestValidator) ValidateFundingRegistry(manifest *core.Manifest, registry *FunderRegistry) (errors, warnings []string) {
+	if manifest == nil || manifest.Metadata == nil || registry == nil {
+		return nil, nil
+	}
+	for _, grant := range manifest.Metadata.Funding {
+		if grant == nil {
+			continue
+		}
+		if grant.FunderID != "" {
+			name, found := registry.names[grant.FunderID]
+			switch {
+			case !found:
+				errors = append(errors, fmt.Sprintf("funder %s: %s is not in the funder registry", grant.Funder, grant.FunderID))
+			case funderKey(grant.Funder) != funderKey(name) && registry.ids[funderKey(grant.Funder)] != grant.FunderID:
+				warnings = append(warnings, fmt.Sprintf("funder %s is registered as %s under %s", grant.Funder, name, grant.FunderID))
+			}
+			continue
+		}
+		if id, name, found := registry.Lookup(grant.Funder); found {
+			warnings = append(warnings, fmt.Sprintf("funder %s has no funder_id; the registry lists %s as %s", grant.Funder, name, id))
+		} else {
+			errors = append(errors, fmt.Sprintf("funder %s is not in the funder registry", grant.Funder))
+		}
+	}
+	return errors, warnings
+}
@@ -0,0 +1,398 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/jsonschema"
+)
+
+// tagPatterns are the patterns of the validation tags that check the form of
+// a string. The validator and the JSON Schema share them.
+var tagPatterns = map[string]*regexp.Regexp{
+	"semver":     regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`),
+	"sha256":     regexp.MustCompile(`^[a-fA-F0-9]{64}$`),
+	"mimetype":   regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9!#$&\-\^_]*\/[a-zA-Z0-9][a-zA-Z0-9!#$&\-\^_.]*$`),
+	"csp":        regexp.MustCompile(`^[a-zA-Z0-9\-\s'*.:/_; ]+$`),
+	"domain":     regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`),
+	"wasmmodule": regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`),
+}
+
+// tagFormats are the JSON Schema formats of validation tags
+var tagFormats = map[string]string{
+	"url":     "uri",
+	"email":   "email",
+	"iso8601": "date-time",
+}
+
+var (
+	schemaOnce     sync.Once
+	schemaJSON     []byte
+	compiledSchema *jsonschema.Schema
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	schemaDialectID = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// JSONSchema returns the JSON Schema of the manifest format. It is generated
+// from the manifest types and their validation tags, so it cannot drift from
+// what the validator accepts; semantic checks such as times being in order
+// are left to the validator.
+func JSONSchema() []byte {
+	loadJSONSchema()
+	return schemaJSON
+}
+
+// loadJSONSchema generates the schema, and parses it back for checking
+// manifests against it
+func loadJSONSchema() *jsonschema.Schema {
+	schemaOnce.Do(func() {
+		g := &schemaGenerator{defs: make(map[string]interface{}), inlining: make(map[reflect.Type]bool)}
+		root := g.structSchema(reflect.TypeOf(core.Manifest{}), true)
+		root["$schema"] = schemaDialectID
+		root["title"] = "LIV document manifest"
+		root["$defs"] = g.defs
+
+		data, err := json.MarshalIndent(root, "", "  ")
+		if err != nil {
+			panic(fmt.Sprintf("invalid manifest schema: %v", err))
+		}
+		schemaJSON = append(data, '\n')
+		if compiledSchema, err = jsonschema.Parse(data); err != nil {
+			panic(fmt.Sprintf("invalid manifest schema: %v", err))
+		}
+	})
+	return compiledSchema
+}
+
+// schemaGenerator builds the schema of a type, with a definition in defs per
+// struct type the validator checks. The validator checks the elements of
+// slices and maps only when their tags dive into them, so the structs of other
+// elements are described inline, without the constraints of their tags.
+type schemaGenerator struct {
+	defs map[string]interface{}
+	// inlining are the struct types being described inline
+	inlining map[reflect.Type]bool
+}
+
+func (g *schemaGenerator) typeSchema(t reflect.Type, checked bool) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeSchema(t.Elem(), checked)
+	case reflect.Struct:
+		if !checked {
+			if g.inlining[t] {
+				return map[string]interface{}{"type": "object"}
+			}
+			g.inlining[t] = true
+			defer delete(g.inlining, t)
+			return g.structSchema(t, false)
+		}
+		if _, defined := g.defs[t.Name()]; !defined {
+			// Reserve the name first, for types that refer to themselves
+			g.defs[t.Name()] = nil
+			g.defs[t.Name()] = g.structSchema(t, true)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem(), checked)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem(), checked)}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type, checked bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	g.addFields(t, properties, &required, checked)
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the properties of the fields of a struct, and of the structs
+// it embeds, as encoding/json marshals them
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string, checked bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			if embedded := derefType(field.Type); embedded.Kind() == reflect.Struct {
+				g.addFields(embedded, properties, required, checked)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var rules, elementRules []string
+		dive := false
+		if checked {
+			rules, elementRules = splitRules(field.Tag.Get("validate"))
+			dive = strings.Contains(","+field.Tag.Get("validate")+",", ",dive,")
+		}
+		fieldType := derefType(field.Type)
+		elementChecked := dive || (fieldType.Kind() != reflect.Slice && fieldType.Kind() != reflect.Map)
+		schema := g.typeSchema(field.Type, checked && elementChecked)
+		applyRules(schema, rules, field.Type)
+		if len(elementRules) > 0 {
+			elementType := fieldType.Elem()
+			if element, ok := schema["items"].(map[string]interface{}); ok {
+				applyRules(element, elementRules, elementType)
+			} else if element, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				applyRules(element, elementRules, elementType)
+			}
+		}
+
+		if rejectsZero(rules) {
+			*required = append(*required, name)
+		} else if kind := field.Type.Kind(); kind == reflect.Ptr || kind == reflect.Slice || kind == reflect.Map {
+			schema = nullable(schema)
+		}
+		properties[name] = schema
+	}
+}
+
+// splitRules splits validation tags into the rules of a field and those of
+// its elements, after dive. The keys rules of maps are not checked.
+func splitRules(tag string) (rules, elementRules []string) {
+	if tag == "" {
+		return nil, nil
+	}
+	all := strings.Split(tag, ",")
+	for i, rule := range all {
+		if rule == "dive" {
+			rules = all[:i]
+			keys := false
+			for _, element := range all[i+1:] {
+				switch {
+				case element == "dive":
+					return rules, elementRules
+				case element == "keys" || element == "endkeys":
+					keys = element == "keys"
+				case !keys:
+					elementRules = append(elementRules, element)
+				}
+			}
+			return rules, elementRules
+		}
+	}
+	return all, nil
+}
+
+// applyRules adds the schema keywords of validation rules to the schema of a
+// value of type t. Rules with no keyword are left to the validator.
+func applyRules(schema map[string]interface{}, rules []string, t reflect.Type) {
+	kind := derefType(t).Kind()
+	if derefType(t) == timeType {
+		return
+	}
+	omitempty := false
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "omitempty":
+			omitempty = true
+		case "required":
+			if kind == reflect.String {
+				schema["minLength"] = 1
+			}
+		case "min", "max", "len":
+			bound, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			var keywords []string
+			switch kind {
+			case reflect.String:
+				keywords = []string{"minLength", "maxLength"}
+			case reflect.Slice, reflect.Array:
+				keywords = []string{"minItems", "maxItems"}
+			case reflect.Map:
+				keywords = []string{"minProperties", "maxProperties"}
+			default:
+				keywords = []string{"minimum", "maximum"}
+			}
+			if name != "max" {
+				schema[keywords[0]] = bound
+			}
+			if name != "min" {
+				schema[keywords[1]] = bound
+			}
+		case "oneof":
+			var values []interface{}
+			if omitempty && kind == reflect.String {
+				values = append(values, "")
+			}
+			for _, option := range strings.Fields(param) {
+				if kind == reflect.String {
+					values = append(values, option)
+				} else if n, err := strconv.ParseFloat(option, 64); err == nil {
+					values = append(values, n)
+				}
+			}
+			schema["enum"] = values
+		default:
+			if pattern, ok := tagPatterns[name]; ok {
+				schema["pattern"] = pattern.String()
+			} else if format, ok := tagFormats[name]; ok {
+				schema["format"] = format
+			}
+		}
+	}
+}
+
+// rejectsZero reports whether rules fail on the zero value, so a manifest
+// without the property is invalid
+func rejectsZero(rules []string) bool {
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "omitempty":
+			return false
+		case "required", "oneof":
+			return true
+		case "min", "len":
+			if bound, err := strconv.ParseFloat(param, 64); err == nil && bound > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nullable allows null as well, which encoding/json writes for nil pointers,
+// slices and maps
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if t, ok := schema["type"].(string); ok {
+		schema["type"] = []interface{}{t, "null"}
+		return schema
+	}
+	if _, ok := schema["$ref"]; ok {
+		return map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+	}
+	return schema
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// schemaCodes are the finding codes of the schema keywords a manifest fails
+var schemaCodes = map[string]string{
+	"type":          "schema.type",
+	"anyOf":         "schema.type",
+	"enum":          "schema.enum",
+	"required":      "schema.required",
+	"minItems":      "schema.items",
+	"maxItems":      "schema.items",
+	"minProperties": "schema.items",
+	"maxProperties": "schema.items",
+	"minLength":     "schema.length",
+	"maxLength":     "schema.length",
+	"pattern":       "schema.pattern",
+	"format":        "schema.format",
+	"minimum":       "schema.range",
+	"maximum":       "schema.range",
+}
+
+// checkJSONSchema checks a manifest against the JSON Schema and records what
+// it finds. Locations with an error already are skipped, so values the
+// validator rejected are not reported twice. Unknown properties are warned
+// of rather than rejected, so documents of newer writers still open.
+func checkJSONSchema(data []byte, result *core.ValidationResult) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return
+	}
+
+	reported := make(map[string]bool)
+	for _, finding := range result.Findings {
+		if finding.Severity == core.SeverityError {
+			reported[finding.Path] = true
+		}
+	}
+	for _, schemaErr := range loadJSONSchema().Check(value) {
+		keys := schemaErr.Path
+		if schemaErr.Property != "" {
+			keys = append(keys[:len(keys):len(keys)], schemaErr.Property)
+		}
+		pointer := core.JSONPointer(keys...)
+
+		if schemaErr.Keyword == "additionalProperties" {
+			message := schemaErr.Message
+			if len(schemaErr.Path) > 0 {
+				message = core.JSONPointer(schemaErr.Path...) + ": " + message
+			}
+			finding := result.AddWarning("schema.unknown_property", pointer, message)
+			if schemaErr.Suggestion != "" {
+				finding.Suggestion = fmt.Sprintf("did you mean %q?", schemaErr.Suggestion)
+			}
+			continue
+		}
+
+		if reported[pointer] {
+			continue
+		}
+		reported[pointer] = true
+		message := schemaErr.Message
+		if pointer != "" {
+			message = pointer + ": " + message
+		}
+		result.AddError(schemaCodes[schemaErr.Keyword], pointer, message)
+	}
+}
@@ -2,11 +2,14 @@ package manifest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"strings"
 
+	"github.com/liv-format/liv/pkg/atomicfile"
 	"github.com/liv-format/liv/pkg/core"
 )
 
@@ -26,7 +29,7 @@ func NewManifestParser() *ManifestParser {
 func (mp *ManifestParser) ParseFromReader(reader io.Reader) (*core.Manifest, error) {
 	data, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read manifest data: %v", err)
+		return nil, fmt.Errorf("failed to read manifest data: %w", err)
 	}
 
 	return mp.ParseFromBytes(data)
@@ -36,13 +39,13 @@ func (mp *ManifestParser) ParseFromReader(reader io.Reader) (*core.Manifest, err
 func (mp *ManifestParser) ParseFromBytes(data []byte) (*core.Manifest, error) {
 	// Validate JSON syntax first
 	if !json.Valid(data) {
-		return nil, fmt.Errorf("invalid JSON syntax")
+		return nil, fmt.Errorf("%w: invalid JSON syntax", core.ErrManifestInvalid)
 	}
 
 	// Parse and validate
 	manifest, result := mp.validator.ValidateManifestJSON(data)
 	if !result.IsValid {
-		return nil, fmt.Errorf("manifest validation failed: %s", strings.Join(result.Errors, "; "))
+		return nil, fmt.Errorf("%w: %s", core.ErrManifestInvalid, strings.Join(result.Errors, "; "))
 	}
 
 	return manifest, nil
@@ -51,8 +54,11 @@ func (mp *ManifestParser) ParseFromBytes(data []byte) (*core.Manifest, error) {
 // ParseFromFile parses a manifest from a file
 func (mp *ManifestParser) ParseFromFile(filePath string) (*core.Manifest, error) {
 	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", core.ErrManifestMissing, filePath)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to open manifest file: %v", err)
+		return nil, fmt.Errorf("failed to open manifest file: %w", err)
 	}
 	defer file.Close()
 
@@ -64,13 +70,13 @@ func (mp *ManifestParser) SerializeToBytes(manifest *core.Manifest) ([]byte, err
 	// Validate before serialization
 	result := mp.validator.ValidateManifest(manifest)
 	if !result.IsValid {
-		return nil, fmt.Errorf("manifest validation failed: %s", strings.Join(result.Errors, "; "))
+		return nil, fmt.Errorf("%w: %s", core.ErrManifestInvalid, strings.Join(result.Errors, "; "))
 	}
 
 	// Serialize with proper formatting
 	data, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize manifest: %v", err)
+		return nil, fmt.Errorf("failed to serialize manifest: %w", err)
 	}
 
 	return data, nil
@@ -85,7 +91,7 @@ func (mp *ManifestParser) SerializeToWriter(manifest *core.Manifest, writer io.W
 
 	_, err = writer.Write(data)
 	if err != nil {
-		return fmt.Errorf("failed to write manifest data: %v", err)
+		return fmt.Errorf("failed to write manifest data: %w", err)
 	}
 
 	return nil
@@ -93,20 +99,16 @@ func (mp *ManifestParser) SerializeToWriter(manifest *core.Manifest, writer io.W
 
 // SerializeToFile serializes a manifest to a file
 func (mp *ManifestParser) SerializeToFile(manifest *core.Manifest, filePath string) error {
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create manifest file: %v", err)
-	}
-	defer file.Close()
-
-	return mp.SerializeToWriter(manifest, file)
+	return atomicfile.Write(filePath, 0644, func(w io.Writer) error {
+		return mp.SerializeToWriter(manifest, w)
+	})
 }
 
 // ValidateAndParse combines validation and parsing in one step
 func (mp *ManifestParser) ValidateAndParse(data []byte) (*core.Manifest, *core.ValidationResult, error) {
 	manifest, result := mp.validator.ValidateManifestJSON(data)
 	if !result.IsValid {
-		return nil, result, fmt.Errorf("validation failed")
+		return nil, result, core.ErrManifestInvalid
 	}
 
 	return manifest, result, nil
@@ -116,7 +118,7 @@ func (mp *ManifestParser) ValidateAndParse(data []byte) (*core.Manifest, *core.V
 func (mp *ManifestParser) ParseWithWarnings(data []byte) (*core.Manifest, []string, error) {
 	manifest, result := mp.validator.ValidateManifestJSON(data)
 	if !result.IsValid {
-		return nil, nil, fmt.Errorf("manifest validation failed: %s", strings.Join(result.Errors, "; "))
+		return nil, nil, fmt.Errorf("%w: %s", core.ErrManifestInvalid, strings.Join(result.Errors, "; "))
 	}
 
 	return manifest, result.Warnings, nil
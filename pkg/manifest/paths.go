@@ -0,0 +1,74 @@
+package manifest
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// NormalizePath returns the form a resource path takes in a package: forward
+// slashes, Unicode NFC, no ./ segments and a lowercase extension. Documents
+// built on Windows or macOS may name files otherwise, and viewers on Linux
+// then fail to find them.
+func NormalizePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	p = norm.NFC.String(strings.ReplaceAll(p, "\\", "/"))
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	ext := path.Ext(p)
+	return strings.TrimSuffix(p, ext) + strings.ToLower(ext)
+}
+
+// FoldPath returns the key paths that differ only in case share. Packages may
+// not hold two such paths, as case-insensitive file systems cannot extract
+// both.
+func FoldPath(p string) string {
+	return strings.ToLower(NormalizePath(p))
+}
+
+// CaseConflicts groups the paths that differ only in case, each group and
+// the groups sorted
+func CaseConflicts(paths []string) [][]string {
+	folded := make(map[string][]string)
+	for _, p := range paths {
+		key := FoldPath(p)
+		folded[key] = append(folded[key], p)
+	}
+
+	var conflicts [][]string
+	for _, group := range folded {
+		if len(group) > 1 {
+			sort.Strings(group)
+			conflicts = append(conflicts, group)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i][0] < conflicts[j][0] })
+	return conflicts
+}
+
+// validateResourcePaths checks that resource paths are normalized and that
+// none differ only in case
+func (mv *ManifestValidator) validateResourcePaths(resources map[string]*core.Resource, result *core.ValidationResult) {
+	paths := make([]string, 0, len(resources))
+	for p := range resources {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if normalized := NormalizePath(p); normalized != p {
+			result.AddError("resource.path_normalization", core.JSONPointer("resources", p), fmt.Sprintf("resource path '%s' is not normalized", p)).
+				Suggestion = "rename it to " + normalized
+		}
+	}
+	for _, group := range CaseConflicts(paths) {
+		result.AddError("resource.case_conflict", core.JSONPointer("resources", group[1]), fmt.Sprintf("resource paths differ only in case: %s", strings.Join(group, ", "))).
+			Suggestion = "give the files distinct names"
+	}
+}
@@ -3,11 +3,18 @@ package manifest
 import (
 	"encoding/json"
 	"fmt"
+	"mime"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/liv-format/liv/pkg/capability"
 	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/variants"
 )
 
 // Type aliases for backward compatibility with tests
@@ -28,6 +35,12 @@ type (
 // ManifestValidator provides validation for LIV document manifests
 type ManifestValidator struct {
 	validator *validator.Validate
+	// clockSkew is how far ahead of the clock of the validator document
+	// times may be before they are reported as in the future
+	clockSkew time.Duration
+	now       func() time.Time
+	// extensions are the schemas of registered extension namespaces
+	extensions map[string]*core.DataSchema
 }
 
 // NewManifestValidator creates a new manifest validator with custom validation rules
@@ -42,45 +55,47 @@ func NewManifestValidator() *ManifestValidator {
 	v.RegisterValidation("csp", validateCSP)
 	v.RegisterValidation("domain", validateDomain)
 	v.RegisterValidation("wasmmodule", validateWASMModuleName)
+	v.RegisterValidation("spdx", validateSPDXExpression)
+	v.RegisterValidation("orcid", validateORCID)
+	v.RegisterValidation("doi", validateDOI)
 
 	return &ManifestValidator{
 		validator: v,
+		clockSkew: core.DefaultClockSkew,
+		now:       time.Now,
 	}
 }
 
+// SetClockSkew sets how far ahead of the clock of the validator the created
+// and modified times of a document may be before they are reported as in
+// the future
+func (mv *ManifestValidator) SetClockSkew(skew time.Duration) {
+	mv.clockSkew = skew
+}
+
 // ValidateManifest validates a complete manifest structure
 func (mv *ManifestValidator) ValidateManifest(manifest *core.Manifest) *core.ValidationResult {
+	result := core.NewValidationResult()
 	if manifest == nil {
-		return &core.ValidationResult{
-			IsValid: false,
-			Errors:  []string{"manifest cannot be nil"},
-		}
+		result.AddError("manifest.missing", "", "manifest cannot be nil")
+		return result
 	}
 
-	var errors []string
-	var warnings []string
-
 	// Validate struct using tags
 	if err := mv.validator.Struct(manifest); err != nil {
 		if validationErrors, ok := err.(validator.ValidationErrors); ok {
 			for _, fieldError := range validationErrors {
-				errors = append(errors, mv.formatValidationError(fieldError))
+				result.AddError("manifest."+fieldError.Tag(), fieldPointer(fieldError.Namespace()), mv.formatValidationError(fieldError))
 			}
 		} else {
-			errors = append(errors, fmt.Sprintf("validation error: %v", err))
+			result.AddError("manifest.invalid", "", fmt.Sprintf("validation error: %v", err))
 		}
 	}
 
 	// Additional semantic validation
-	semanticErrors, semanticWarnings := mv.validateSemantics(manifest)
-	errors = append(errors, semanticErrors...)
-	warnings = append(warnings, semanticWarnings...)
+	mv.validateSemantics(manifest, result)
 
-	return &core.ValidationResult{
-		IsValid:  len(errors) == 0,
-		Errors:   errors,
-		Warnings: warnings,
-	}
+	return result
 }
 
 // ValidateManifestJSON validates a manifest from JSON bytes
@@ -89,155 +104,329 @@ func (mv *ManifestValidator) ValidateManifestJSON(data []byte) (*core.Manifest,
 
 	// Parse JSON
 	if err := json.Unmarshal(data, &manifest); err != nil {
-		return nil, &core.ValidationResult{
-			IsValid: false,
-			Errors:  []string{fmt.Sprintf("invalid JSON: %v", err)},
+		result := core.NewValidationResult()
+		// Values of the wrong type are reported where they are
+		if json.Valid(data) {
+			checkJSONSchema(data, result)
 		}
+		if result.IsValid {
+			result.AddError("manifest.invalid_json", "", fmt.Sprintf("invalid JSON: %v", err))
+		}
+		return nil, result
 	}
 
-	// Validate parsed manifest
+	// Validate parsed manifest, then check it against the JSON Schema for
+	// what parsing hides, such as misspelt properties
 	result := mv.ValidateManifest(&manifest)
+	checkJSONSchema(data, result)
 	return &manifest, result
 }
 
 // validateSemantics performs additional semantic validation beyond struct tags
-func (mv *ManifestValidator) validateSemantics(manifest *core.Manifest) ([]string, []string) {
-	var errors []string
-	var warnings []string
-
+func (mv *ManifestValidator) validateSemantics(manifest *core.Manifest, result *core.ValidationResult) {
 	// Validate version compatibility
 	if manifest.Version != "1.0" {
-		warnings = append(warnings, fmt.Sprintf("manifest version '%s' may not be fully supported", manifest.Version))
+		result.AddWarning("manifest.version", "/version", fmt.Sprintf("manifest version '%s' may not be fully supported", manifest.Version)).
+			Suggestion = "use manifest version 1.0"
 	}
 
 	// Validate metadata consistency
 	if manifest.Metadata != nil {
-		if manifest.Metadata.Created.After(manifest.Metadata.Modified) {
-			errors = append(errors, "created date cannot be after modified date")
-		}
+		mv.validateTimes(manifest.Metadata, result)
 
-		if manifest.Metadata.Modified.After(time.Now().Add(time.Hour)) {
-			warnings = append(warnings, "modified date is in the future")
+		mv.validateAuthors(manifest.Metadata.Authors, result)
+		mv.validateSubjects(manifest.Metadata, result)
+		for _, message := range mv.validateFunding(manifest.Metadata.Funding) {
+			result.AddError("metadata.duplicate_funding", "/metadata/funding", message)
 		}
 	}
 
 	// Validate security policy consistency
 	if manifest.Security != nil {
-		secErrors, secWarnings := mv.validateSecurityPolicy(manifest.Security)
-		errors = append(errors, secErrors...)
-		warnings = append(warnings, secWarnings...)
+		mv.validateSecurityPolicy(manifest.Security, result)
 	}
 
 	// Validate WASM configuration
 	if manifest.WASMConfig != nil {
-		wasmErrors, wasmWarnings := mv.validateWASMConfig(manifest.WASMConfig)
-		errors = append(errors, wasmErrors...)
-		warnings = append(warnings, wasmWarnings...)
+		mv.validateWASMConfig(manifest.WASMConfig, result)
 	}
 
 	// Validate resource references
 	if manifest.Resources != nil {
-		resErrors, resWarnings := mv.validateResources(manifest.Resources)
-		errors = append(errors, resErrors...)
-		warnings = append(warnings, resWarnings...)
+		mv.validateResources(manifest.Resources, result)
 	}
 
 	// Validate feature flags consistency
 	if manifest.Features != nil {
-		featWarnings := mv.validateFeatureFlags(manifest.Features, manifest.WASMConfig)
-		warnings = append(warnings, featWarnings...)
+		mv.validateFeatureFlags(manifest.Features, manifest.WASMConfig, result)
 	}
 
-	return errors, warnings
+	// Validate license terms
+	if manifest.License != nil {
+		for _, message := range mv.validateLicense(manifest.License) {
+			result.AddError("license.terms", "/license", message)
+		}
+	}
+
+	// Validate viewer requirements
+	if manifest.Requirements != nil && manifest.Requirements.MinFormatVersion != "" {
+		if _, err := capability.ParseVersion(manifest.Requirements.MinFormatVersion); err != nil {
+			result.AddError("requirements.min_format_version", "/requirements/min_format_version", fmt.Sprintf("invalid minimum format version: %v", err))
+		}
+	}
+
+	// Validate print hints
+	if manifest.Print != nil {
+		mv.validatePrintSettings(manifest.Print, manifest.Resources, result)
+	}
+
+	// Validate data declarations
+	if manifest.Data != nil {
+		mv.validateData(manifest.Data, manifest.Resources, result)
+	}
+
+	// Validate custom metadata extensions
+	if manifest.Extensions != nil {
+		mv.validateExtensions(manifest.Extensions, result)
+	}
+
+	// Validate access policy
+	if access := manifest.Access; access != nil && access.NotBefore != nil && access.NotAfter != nil {
+		if !access.NotAfter.After(*access.NotBefore) {
+			result.AddError("access.dates", "/access/not_after", "access not_after must be later than not_before")
+		}
+	}
 }
 
-// validateSecurityPolicy validates security policy consistency
-func (mv *ManifestValidator) validateSecurityPolicy(policy *core.SecurityPolicy) ([]string, []string) {
-	var errors []string
-	var warnings []string
+// validateData checks that each data file is packaged under assets/data/ in
+// a known format, and that its schema names each field once
+func (mv *ManifestValidator) validateData(data map[string]*core.DataAsset, resources map[string]*core.Resource, result *core.ValidationResult) {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	namePattern := regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	for _, name := range names {
+		asset := data[name]
+		pointer := core.JSONPointer("data", name)
+		if asset == nil {
+			result.AddError("data.declaration", pointer, fmt.Sprintf("data %s has no declaration", name))
+			continue
+		}
+		if !namePattern.MatchString(name) {
+			result.AddError("data.name", pointer, fmt.Sprintf("data name %q must be letters, digits, - and _", name))
+		}
+		if !strings.HasPrefix(asset.Path, core.DataPrefix) {
+			result.AddError("data.location", pointer+"/path", fmt.Sprintf("data %s must be packaged under %s", name, core.DataPrefix))
+		} else if resources[asset.Path] == nil {
+			result.AddError("data.resource_missing", pointer+"/path", fmt.Sprintf("data %s file %s is not a resource", name, asset.Path))
+		}
+		if format := asset.FileFormat(); !slices.Contains(core.DataFormats, format) {
+			result.AddError("data.format", pointer+"/format", fmt.Sprintf("data %s format %q is not one of %s", name, format, strings.Join(core.DataFormats, ", ")))
+		}
+		if asset.Schema == nil {
+			continue
+		}
+		fields := make(map[string]bool)
+		for i, field := range asset.Schema.Fields {
+			if field == nil {
+				continue
+			}
+			if fields[field.Name] {
+				result.AddError("data.duplicate_field", core.JSONPointer("data", name, "schema", "fields", i), fmt.Sprintf("data %s schema has field %q more than once", name, field.Name))
+			}
+			fields[field.Name] = true
+		}
+	}
+}
 
+// validatePrintSettings checks that the page hints can be laid out and the
+// print stylesheet is packaged
+func (mv *ManifestValidator) validatePrintSettings(settings *core.PrintSettings, resources map[string]*core.Resource, result *core.ValidationResult) {
+	width, height, err := settings.PageDimensions()
+	if err != nil {
+		result.AddError("print.page_size", "/print/page_size", err.Error())
+		return
+	}
+	top, right, bottom, left, err := settings.Margins()
+	if err != nil {
+		result.AddError("print.margin", "/print/margin", err.Error())
+		return
+	}
+	if left+right >= width || top+bottom >= height {
+		result.AddError("print.margin", "/print/margin", "print margins leave no room on the page")
+	}
+	if settings.Stylesheet != "" && resources[settings.Stylesheet] == nil {
+		result.AddError("print.stylesheet_missing", "/print/stylesheet", fmt.Sprintf("print stylesheet %s is not a resource", settings.Stylesheet))
+	}
+	running := func(name, text string) {
+		if len(text) > 200 || strings.Count(text, "|") > 2 {
+			result.AddError("print.running_text", "/print/"+name, fmt.Sprintf("print %s must be at most 200 characters in up to three parts", name))
+		}
+	}
+	running("header", settings.Header)
+	running("footer", settings.Footer)
+}
+
+// validateTimes checks the created and modified times of a document. Times
+// are compared to the second, as manifests record them; those ahead of the
+// clock of the validator by more than its clock skew are reported, as are
+// times recorded with an offset from UTC.
+func (mv *ManifestValidator) validateTimes(metadata *core.DocumentMetadata, result *core.ValidationResult) {
+	if core.UTC(metadata.Created).After(core.UTC(metadata.Modified)) {
+		result.AddError("metadata.dates", "/metadata/created", "created date cannot be after modified date")
+	}
+
+	now := mv.now()
+	for _, field := range []struct {
+		name string
+		time time.Time
+	}{{"created", metadata.Created}, {"modified", metadata.Modified}} {
+		if message := core.FutureTime(field.name+" date", field.time, now, mv.clockSkew); message != "" {
+			result.AddWarning("metadata.future_date", "/metadata/"+field.name, message).
+				Suggestion = "check the clock of the machine that made the document, or of this one"
+		}
+		if !field.time.IsZero() && core.HasUTCOffset(field.time) {
+			result.Add(&core.Finding{
+				Code:       "metadata.timezone",
+				Severity:   core.SeverityInfo,
+				Message:    fmt.Sprintf("%s date %s is not in UTC", field.name, field.time.Format(time.RFC3339)),
+				Path:       "/metadata/" + field.name,
+				Suggestion: "record times in UTC, as " + core.UTC(field.time).Format(time.RFC3339),
+			})
+		}
+	}
+}
+
+// validateSecurityPolicy validates security policy consistency
+func (mv *ManifestValidator) validateSecurityPolicy(policy *core.SecurityPolicy, result *core.ValidationResult) {
 	if policy.WASMPermissions == nil {
-		errors = append(errors, "WASM permissions must be defined")
-		return errors, warnings
+		result.AddError("security.wasm_permissions", "/security/wasm_permissions", "WASM permissions must be defined")
+		return
 	}
 
 	if policy.JSPermissions == nil {
-		errors = append(errors, "JavaScript permissions must be defined")
-		return errors, warnings
+		result.AddError("security.js_permissions", "/security/js_permissions", "JavaScript permissions must be defined")
+		return
 	}
 
 	// Check for overly permissive settings
 	if policy.WASMPermissions.AllowNetworking && policy.NetworkPolicy != nil && policy.NetworkPolicy.AllowOutbound {
-		warnings = append(warnings, "document allows both WASM and general network access")
+		result.AddWarning("security.network", "/security/network_policy/allow_outbound", "document allows both WASM and general network access")
 	}
 
 	if policy.JSPermissions.ExecutionMode == "trusted" {
-		warnings = append(warnings, "document requests trusted JavaScript execution")
+		result.AddWarning("security.trusted_js", "/security/js_permissions/execution_mode", "document requests trusted JavaScript execution").
+			Suggestion = "use sandboxed execution unless the scripts need more"
 	}
 
 	// Validate memory limits
 	if policy.WASMPermissions.MemoryLimit > 256*1024*1024 { // 256MB
-		warnings = append(warnings, "WASM memory limit is very high (>256MB)")
+		result.AddWarning("security.memory_limit", "/security/wasm_permissions/memory_limit", "WASM memory limit is very high (>256MB)")
 	}
 
 	if policy.WASMPermissions.CPUTimeLimit > 30000 { // 30 seconds
-		warnings = append(warnings, "WASM CPU time limit is very high (>30s)")
+		result.AddWarning("security.cpu_time_limit", "/security/wasm_permissions/cpu_time_limit", "WASM CPU time limit is very high (>30s)")
 	}
 
 	// Validate CSP if present
 	if policy.ContentSecurityPolicy != "" {
 		if !mv.isValidCSP(policy.ContentSecurityPolicy) {
-			errors = append(errors, "invalid Content Security Policy syntax")
+			result.AddError("security.csp", "/security/content_security_policy", "invalid Content Security Policy syntax")
 		}
 	}
-
-	return errors, warnings
 }
 
 // validateWASMConfig validates WASM configuration
-func (mv *ManifestValidator) validateWASMConfig(config *core.WASMConfiguration) ([]string, []string) {
-	var errors []string
-	var warnings []string
-
+func (mv *ManifestValidator) validateWASMConfig(config *core.WASMConfiguration, result *core.ValidationResult) {
 	if len(config.Modules) == 0 {
-		warnings = append(warnings, "no WASM modules defined")
-		return errors, warnings
+		result.AddWarning("wasm.no_modules", "/wasm_config/modules", "no WASM modules defined")
+		return
 	}
 
 	// Validate each module
 	for name, module := range config.Modules {
+		pointer := core.JSONPointer("wasm_config", "modules", name)
 		if module.Name != name {
-			errors = append(errors, fmt.Sprintf("module name mismatch: key '%s' vs name '%s'", name, module.Name))
+			result.AddError("wasm.module_name", pointer+"/name", fmt.Sprintf("module name mismatch: key '%s' vs name '%s'", name, module.Name))
 		}
 
 		if module.EntryPoint == "" {
-			errors = append(errors, fmt.Sprintf("module '%s' missing entry point", name))
+			result.AddError("wasm.entry_point", pointer+"/entry_point", fmt.Sprintf("module '%s' missing entry point", name))
 		}
 
 		// Validate semantic versioning
 		if !mv.isValidSemVer(module.Version) {
-			errors = append(errors, fmt.Sprintf("module '%s' has invalid version format", name))
+			result.AddError("wasm.version", pointer+"/version", fmt.Sprintf("module '%s' has invalid version format", name)).
+				Suggestion = "use a semantic version such as 1.0.0"
 		}
 
 		// Check for circular dependencies
 		if mv.hasCircularDependency(name, module, config.Modules) {
-			errors = append(errors, fmt.Sprintf("circular dependency detected for module '%s'", name))
+			result.AddError("wasm.circular_dependency", pointer+"/dependencies", fmt.Sprintf("circular dependency detected for module '%s'", name))
 		}
 	}
 
 	// Validate global memory limit
 	if config.MemoryLimit == 0 {
-		warnings = append(warnings, "no global WASM memory limit set")
+		result.AddWarning("wasm.memory_limit", "/wasm_config/memory_limit", "no global WASM memory limit set")
 	}
+}
+
+// validateVariants checks that each variant of a resource is itself a
+// resource and is described by exactly one of density, width, quality and
+// type
+func (mv *ManifestValidator) validateVariants(path string, resource *core.Resource, resources map[string]*core.Resource, result *core.ValidationResult) {
+	for i, variant := range resource.Variants {
+		pointer := core.JSONPointer("resources", path, "variants", i)
+		if variant == nil {
+			result.AddError("resource.variant", pointer, fmt.Sprintf("resource '%s' has an empty variant", path))
+			continue
+		}
+		target, exists := resources[variant.Path]
+		switch {
+		case variant.Path == path:
+			result.AddError("resource.variant", pointer+"/path", fmt.Sprintf("resource '%s' lists itself as a variant", path))
+		case !exists:
+			result.AddError("resource.variant_missing", pointer+"/path", fmt.Sprintf("variant '%s' of resource '%s' is not a resource", variant.Path, path))
+		case len(target.Variants) > 0:
+			result.AddError("resource.variant", pointer+"/path", fmt.Sprintf("variant '%s' of resource '%s' has variants of its own", variant.Path, path))
+		}
 
-	return errors, warnings
+		descriptors := 0
+		if variant.Density != 0 {
+			descriptors++
+			if variant.Density < 0 {
+				result.AddError("resource.variant", pointer+"/density", fmt.Sprintf("variant '%s' has a negative density", variant.Path))
+			}
+		}
+		if variant.Width != 0 {
+			descriptors++
+			if variant.Width < 0 {
+				result.AddError("resource.variant", pointer+"/width", fmt.Sprintf("variant '%s' has a negative width", variant.Path))
+			}
+		}
+		if variant.Quality != "" {
+			descriptors++
+			if variant.Quality != variants.QualityLow && variant.Quality != variants.QualityHigh {
+				result.AddError("resource.variant", pointer+"/quality", fmt.Sprintf("variant '%s' has unknown quality '%s'", variant.Path, variant.Quality))
+			}
+		}
+		if variant.Type != "" {
+			descriptors++
+			if _, _, err := mime.ParseMediaType(variant.Type); err != nil || !strings.Contains(variant.Type, "/") {
+				result.AddError("resource.variant", pointer+"/type", fmt.Sprintf("variant '%s' has invalid type '%s'", variant.Path, variant.Type))
+			}
+		}
+		if descriptors != 1 {
+			result.AddError("resource.variant", pointer, fmt.Sprintf("variant '%s' must have exactly one of density, width, quality and type", variant.Path))
+		}
+	}
 }
 
 // validateResources validates resource definitions
-func (mv *ManifestValidator) validateResources(resources map[string]*core.Resource) ([]string, []string) {
-	var errors []string
-	var warnings []string
-
+func (mv *ManifestValidator) validateResources(resources map[string]*core.Resource, result *core.ValidationResult) {
 	// Only require content/index.html; manifest.json is the manifest itself and shouldn't be validated as a resource
 	requiredPaths := []string{
 		"content/index.html",
@@ -246,61 +435,100 @@ func (mv *ManifestValidator) validateResources(resources map[string]*core.Resour
 	// Check for required resources
 	for _, path := range requiredPaths {
 		if _, exists := resources[path]; !exists {
-			errors = append(errors, fmt.Sprintf("required resource missing: %s", path))
+			result.AddError("resource.required", core.JSONPointer("resources", path), fmt.Sprintf("required resource missing: %s", path)).
+				Suggestion = "add " + path + " to the package"
 		}
 	}
 
+	mv.validateResourcePaths(resources, result)
+
 	// Validate each resource
 	for path, resource := range resources {
+		pointer := core.JSONPointer("resources", path)
 		if resource.Path != path {
-			errors = append(errors, fmt.Sprintf("resource path mismatch: key '%s' vs path '%s'", path, resource.Path))
+			result.AddError("resource.path_mismatch", pointer+"/path", fmt.Sprintf("resource path mismatch: key '%s' vs path '%s'", path, resource.Path))
 		}
 
 		if resource.Size < 0 {
-			errors = append(errors, fmt.Sprintf("resource '%s' has negative size", path))
+			result.AddError("resource.size", pointer+"/size", fmt.Sprintf("resource '%s' has negative size", path))
 		}
 
 		if resource.Hash == "" {
-			errors = append(errors, fmt.Sprintf("resource '%s' missing integrity hash", path))
+			result.AddError("resource.hash_missing", pointer+"/hash", fmt.Sprintf("resource '%s' missing integrity hash", path))
 		}
 
 		// Validate MIME type
 		if !mv.isValidMimeType(resource.Type) {
-			warnings = append(warnings, fmt.Sprintf("resource '%s' has unusual MIME type: %s", path, resource.Type))
+			result.AddWarning("resource.mime_type", pointer+"/type", fmt.Sprintf("resource '%s' has unusual MIME type: %s", path, resource.Type))
 		}
 
 		// Check for large resources
 		if resource.Size > 10*1024*1024 { // 10MB
-			warnings = append(warnings, fmt.Sprintf("resource '%s' is very large (%d bytes)", path, resource.Size))
+			result.AddWarning("resource.large", pointer+"/size", fmt.Sprintf("resource '%s' is very large (%d bytes)", path, resource.Size))
 		}
-	}
 
-	return errors, warnings
+		mv.validateVariants(path, resource, resources, result)
+	}
 }
 
 // validateFeatureFlags validates feature flag consistency
-func (mv *ManifestValidator) validateFeatureFlags(features *core.FeatureFlags, wasmConfig *core.WASMConfiguration) []string {
-	var warnings []string
-
+func (mv *ManifestValidator) validateFeatureFlags(features *core.FeatureFlags, wasmConfig *core.WASMConfiguration, result *core.ValidationResult) {
 	// Check for enabled features without corresponding modules
 	if features.WebAssembly && (wasmConfig == nil || len(wasmConfig.Modules) == 0) {
-		warnings = append(warnings, "WebAssembly feature enabled but no WASM modules defined")
+		result.AddWarning("features.webassembly", "/features/webassembly", "WebAssembly feature enabled but no WASM modules defined")
 	}
 
 	if features.Charts && !features.Interactivity {
-		warnings = append(warnings, "charts feature enabled but interactivity disabled")
+		result.AddWarning("features.interactivity", "/features/charts", "charts feature enabled but interactivity disabled")
 	}
 
 	if features.WebGL && !features.Interactivity {
-		warnings = append(warnings, "WebGL feature enabled but interactivity disabled")
+		result.AddWarning("features.interactivity", "/features/webgl", "WebGL feature enabled but interactivity disabled")
 	}
 
 	// Check for potentially resource-intensive combinations
 	if features.Video && features.Audio && features.WebGL {
-		warnings = append(warnings, "multiple media features enabled may impact performance")
+		result.AddWarning("features.performance", "/features", "multiple media features enabled may impact performance")
+	}
+}
+
+// validateLicense validates that a license declares its terms
+func (mv *ManifestValidator) validateLicense(license *core.LicenseInfo) []string {
+	var errors []string
+
+	if license.SPDX == "" && license.Terms == "" {
+		errors = append(errors, "license must specify an SPDX identifier or custom terms")
+	}
+
+	return errors
+}
+
+// validateAuthors checks that each author is listed once. Authors are told
+// apart by their ORCID iD, and by name when they have none.
+func (mv *ManifestValidator) validateAuthors(authors []*core.AuthorInfo, result *core.ValidationResult) {
+	seen := make(map[string]bool)
+	for i, author := range authors {
+		if author == nil {
+			continue
+		}
+		key := "name:" + strings.ToLower(strings.TrimSpace(author.Name))
+		if author.ORCID != "" {
+			key = "orcid:" + author.ORCID
+		}
+		if seen[key] {
+			result.AddError("metadata.duplicate_author", core.JSONPointer("metadata", "authors", i), fmt.Sprintf("author %s is listed more than once", author.Name))
+		}
+		seen[key] = true
 	}
+}
 
-	return warnings
+// ValidateLicensePresence reports whether a manifest carries usable license information.
+// It is used when an organization requires every published document to be licensed.
+func (mv *ManifestValidator) ValidateLicensePresence(manifest *core.Manifest) []string {
+	if manifest == nil || manifest.License == nil {
+		return []string{"document has no license information"}
+	}
+	return mv.validateLicense(manifest.License)
 }
 
 // Helper validation functions
@@ -331,11 +559,71 @@ func (mv *ManifestValidator) formatValidationError(err validator.FieldError) str
 		return fmt.Sprintf("field '%s' must be a valid domain name", err.Field())
 	case "wasmmodule":
 		return fmt.Sprintf("field '%s' must be a valid WASM module name", err.Field())
+	case "spdx":
+		return fmt.Sprintf("field '%s' must be a valid SPDX license expression", err.Field())
+	case "url":
+		return fmt.Sprintf("field '%s' must be a valid URL", err.Field())
+	case "email":
+		return fmt.Sprintf("field '%s' must be a valid email address", err.Field())
+	case "orcid":
+		return fmt.Sprintf("field '%s' must be an ORCID iD such as 0000-0002-1825-0097", err.Field())
+	case "doi":
+		return fmt.Sprintf("field '%s' must be a DOI such as 10.5555/report-2024", err.Field())
 	default:
 		return fmt.Sprintf("field '%s' validation failed: %s", err.Field(), err.Tag())
 	}
 }
 
+// fieldPointer returns the JSON pointer of the field a struct tag failed on,
+// from its namespace such as Manifest.Resources[content/index.html].Hash
+func fieldPointer(namespace string) string {
+	var keys []interface{}
+	t := reflect.TypeOf(core.Manifest{})
+	// The first part names the manifest itself
+	start := strings.IndexAny(namespace, ".[")
+	if start < 0 {
+		return ""
+	}
+	rest := namespace[start:]
+	for rest != "" {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			field, ok := t.FieldByName(name)
+			if t.Kind() != reflect.Struct || !ok {
+				return core.JSONPointer(append(keys, name)...)
+			}
+			if jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ","); jsonName != "" {
+				name = jsonName
+			}
+			keys = append(keys, name)
+			t = field.Type
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return core.JSONPointer(keys...)
+			}
+			keys = append(keys, rest[1:end])
+			rest = rest[end+1:]
+			if kind := t.Kind(); kind == reflect.Map || kind == reflect.Slice || kind == reflect.Array {
+				t = t.Elem()
+			}
+		default:
+			return core.JSONPointer(keys...)
+		}
+	}
+	return core.JSONPointer(keys...)
+}
+
 func (mv *ManifestValidator) isValidSemVer(version string) bool {
 	semverRegex := regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
 	return semverRegex.MatchString(version)
@@ -379,8 +667,7 @@ func (mv *ManifestValidator) checkCircularDependency(moduleName string, module *
 // Custom validation functions for validator tags
 
 func validateSemVer(fl validator.FieldLevel) bool {
-	semverRegex := regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
-	return semverRegex.MatchString(fl.Field().String())
+	return tagPatterns["semver"].MatchString(fl.Field().String())
 }
 
 func validateISO8601(fl validator.FieldLevel) bool {
@@ -389,26 +676,69 @@ func validateISO8601(fl validator.FieldLevel) bool {
 }
 
 func validateSHA256(fl validator.FieldLevel) bool {
-	sha256Regex := regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
-	return sha256Regex.MatchString(fl.Field().String())
+	return tagPatterns["sha256"].MatchString(fl.Field().String())
 }
 
 func validateMimeType(fl validator.FieldLevel) bool {
-	mimeRegex := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9!#$&\-\^_]*\/[a-zA-Z0-9][a-zA-Z0-9!#$&\-\^_.]*$`)
-	return mimeRegex.MatchString(fl.Field().String())
+	return tagPatterns["mimetype"].MatchString(fl.Field().String())
 }
 
 func validateCSP(fl validator.FieldLevel) bool {
-	cspRegex := regexp.MustCompile(`^[a-zA-Z0-9\-\s'*.:/_; ]+$`)
-	return cspRegex.MatchString(fl.Field().String())
+	return tagPatterns["csp"].MatchString(fl.Field().String())
 }
 
 func validateDomain(fl validator.FieldLevel) bool {
-	domainRegex := regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`)
-	return domainRegex.MatchString(fl.Field().String())
+	return tagPatterns["domain"].MatchString(fl.Field().String())
 }
 
 func validateWASMModuleName(fl validator.FieldLevel) bool {
-	moduleNameRegex := regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
-	return moduleNameRegex.MatchString(fl.Field().String())
+	return tagPatterns["wasmmodule"].MatchString(fl.Field().String())
+}
+
+// validateORCID checks an ORCID iD and its check digit
+func validateORCID(fl validator.FieldLevel) bool {
+	return core.ValidORCID(fl.Field().String())
+}
+
+// validateDOI checks the syntax of a DOI
+func validateDOI(fl validator.FieldLevel) bool {
+	return core.ValidDOI(fl.Field().String())
+}
+
+// validateSPDXExpression checks the syntax of an SPDX license expression such as
+// "MIT", "Apache-2.0 OR MIT" or "GPL-2.0-only WITH Classpath-exception-2.0"
+func validateSPDXExpression(fl validator.FieldLevel) bool {
+	idRegex := regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.\-]*\+?$`)
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(fl.Field().String()))
+
+	depth := 0
+	expectOperand := true
+	for _, token := range tokens {
+		switch {
+		case token == "(":
+			if !expectOperand {
+				return false
+			}
+			depth++
+		case token == ")":
+			if expectOperand || depth == 0 {
+				return false
+			}
+			depth--
+		case token == "AND" || token == "OR" || token == "WITH":
+			if expectOperand {
+				return false
+			}
+			expectOperand = true
+		case idRegex.MatchString(token):
+			if !expectOperand {
+				return false
+			}
+			expectOperand = false
+		default:
+			return false
+		}
+	}
+
+	return len(tokens) > 0 && !expectOperand && depth == 0
 }
@@ -2,6 +2,10 @@ package manifest
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -285,6 +289,19 @@ func TestManifestValidator_ValidateManifestJSON(t *testing.T) {
 	}
 }
 
+func TestManifestParser_ErrorKinds(t *testing.T) {
+	parser := NewManifestParser()
+	if _, err := parser.ParseFromBytes([]byte(`{"version": `)); !errors.Is(err, core.ErrManifestInvalid) {
+		t.Errorf("Expected invalid JSON to be an invalid manifest, got %v", err)
+	}
+	if _, err := parser.ParseFromBytes([]byte(`{"version": "1.0"}`)); !errors.Is(err, core.ErrManifestInvalid) || !strings.Contains(err.Error(), "manifest validation failed: ") {
+		t.Errorf("Expected an incomplete manifest to be invalid, got %v", err)
+	}
+	if _, err := parser.ParseFromFile(filepath.Join(t.TempDir(), "manifest.json")); !errors.Is(err, core.ErrManifestMissing) {
+		t.Errorf("Expected a missing file to be a missing manifest, got %v", err)
+	}
+}
+
 func TestCustomValidationFunctions(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -334,6 +351,594 @@ func TestCustomValidationFunctions(t *testing.T) {
 	}
 }
 
+func TestManifestValidator_License(t *testing.T) {
+	validator := NewManifestValidator()
+
+	expressions := map[string]bool{
+		"MIT":                                   true,
+		"Apache-2.0 OR MIT":                     true,
+		"(MIT AND BSD-3-Clause)":                true,
+		"GPL-2.0+ WITH Classpath-exception-2.0": true,
+		"LicenseRef-Internal-1.0":               true,
+		"MIT OR":                                false,
+		"(MIT":                                  false,
+		"MIT BSD":                               false,
+		"MIT; rm -rf":                           false,
+	}
+	for expression, want := range expressions {
+		got := validator.validator.Var(expression, "spdx") == nil
+		if got != want {
+			t.Errorf("SPDX expression %q: got valid=%v, want %v", expression, got, want)
+		}
+	}
+
+	if errs := validator.ValidateLicensePresence(&core.Manifest{}); len(errs) == 0 {
+		t.Error("Expected manifest without license to be rejected")
+	}
+	if errs := validator.ValidateLicensePresence(&core.Manifest{License: &core.LicenseInfo{Holder: "ACME"}}); len(errs) == 0 {
+		t.Error("Expected license without terms to be rejected")
+	}
+	if errs := validator.ValidateLicensePresence(&core.Manifest{License: &core.LicenseInfo{Terms: "Internal use only"}}); len(errs) != 0 {
+		t.Errorf("Expected custom terms to be accepted, got %v", errs)
+	}
+
+	license := &core.LicenseInfo{SPDX: "CC-BY-4.0", Holder: "ACME", AllowedUses: []string{"view", "print"}}
+	if summary := license.Summary(); summary != "CC-BY-4.0 (ACME); allowed uses: view, print" {
+		t.Errorf("Unexpected license summary: %q", summary)
+	}
+}
+
+func TestManifestValidator_Requirements(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	builder.SetRequirements(&core.ViewerRequirements{MinFormatVersion: "1.2", Features: []string{"webgl"}})
+	validator := NewManifestValidator()
+
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected valid requirements to be accepted, got %v", result.Errors)
+	}
+
+	builder.SetRequirements(&core.ViewerRequirements{MinFormatVersion: "latest"})
+	if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+		t.Error("Expected an invalid minimum format version to be rejected")
+	}
+}
+
+func TestManifestValidator_Authors(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Carberry et al.").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	validator := NewManifestValidator()
+	metadata := builder.GetManifest().Metadata
+
+	metadata.Authors = []*core.AuthorInfo{
+		{Name: "Josiah Carberry", Affiliation: "Brown University", Email: "josiah@example.edu", ORCID: "0000-0002-1825-0097"},
+		{Name: "Ada Author", ORCID: "0000-0001-5109-3700", Role: "editor"},
+		{Name: "Grace Contributor", ORCID: "0000-0002-1694-233X", Role: "contributor"},
+	}
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected valid authors to be accepted, got %v", result.Errors)
+	}
+	if names := metadata.AuthorNames(); names != "Josiah Carberry; Ada Author; Grace Contributor" {
+		t.Errorf("Unexpected author names %q", names)
+	}
+
+	for _, author := range []*core.AuthorInfo{
+		{Name: "Bad Checksum", ORCID: "0000-0002-1825-0098"},
+		{Name: "Bad Format", ORCID: "https://orcid.org/0000-0002-1825-0097"},
+		{Name: "Bad Email", Email: "not an address"},
+		{Name: "Bad Role", Role: "reviewer"},
+		{Affiliation: "No Name"},
+		{Name: "Josiah Carberry (again)", ORCID: "0000-0002-1825-0097"},
+	} {
+		metadata.Authors = []*core.AuthorInfo{
+			{Name: "Josiah Carberry", ORCID: "0000-0002-1825-0097"},
+			author,
+		}
+		if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+			t.Errorf("Expected author %+v to be rejected", author)
+		}
+	}
+
+	metadata.Authors = nil
+	if creators := metadata.Creators(); len(creators) != 1 || creators[0].Name != "Carberry et al." {
+		t.Errorf("Expected the byline as the only creator, got %+v", creators)
+	}
+}
+
+func TestManifestValidator_Publication(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	validator := NewManifestValidator()
+	metadata := builder.GetManifest().Metadata
+
+	metadata.Publication = &core.PublicationInfo{DOI: "10.5555/report.2024(1)", URL: "https://docs.example.com/report", Publisher: "Example Press"}
+	metadata.Funding = []*core.FundingInfo{{Funder: "National Science Foundation", FunderID: "10.13039/100000001", Awards: []string{"CHE-1234567"}}}
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected valid publication metadata to be accepted, got %v", result.Errors)
+	}
+	if url := metadata.Publication.DOIURL(); url != "https://doi.org/10.5555/report.2024(1)" {
+		t.Errorf("Unexpected DOI URL %q", url)
+	}
+
+	for _, doi := range []string{"10.555/short", "11.5555/x", "10.5555/", "10.5555/has space", "https://doi.org/10.5555/x"} {
+		metadata.Publication.DOI = doi
+		if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+			t.Errorf("Expected DOI %q to be rejected", doi)
+		}
+	}
+	metadata.Publication.DOI = "10.5555/report"
+
+	for _, grant := range []*core.FundingInfo{
+		{Awards: []string{"No funder"}},
+		{Funder: "Bad Registry ID", FunderID: "100000001"},
+	} {
+		metadata.Funding = []*core.FundingInfo{grant}
+		if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+			t.Errorf("Expected funding %+v to be rejected", grant)
+		}
+	}
+}
+
+func TestManifestValidator_FundingRegistry(t *testing.T) {
+	registry, err := ParseFunderRegistry(strings.NewReader(`funder_id,name,alternate names
+# Extract of the Crossref Funder Registry
+https://doi.org/10.13039/100000001,National Science Foundation,NSF
+501100000780,European Commission
+`))
+	if err != nil {
+		t.Fatalf("ParseFunderRegistry failed: %v", err)
+	}
+	if registry.Len() != 2 {
+		t.Errorf("Expected 2 funders, got %d", registry.Len())
+	}
+	if id, name, found := registry.Lookup("nsf"); !found || id != "10.13039/100000001" || name != "National Science Foundation" {
+		t.Errorf("Unexpected lookup of an alternate name: %s %s %v", id, name, found)
+	}
+
+	validator := NewManifestValidator()
+	m := &core.Manifest{Metadata: &core.DocumentMetadata{Funding: []*core.FundingInfo{
+		{Funder: "National Science Foundation", FunderID: "10.13039/100000001", Awards: []string{"CHE-1234567"}},
+		{Funder: "NSF", FunderID: "10.13039/100000001"},
+		{Funder: "Euro Commission", FunderID: "10.13039/501100000780"},
+		{Funder: "european commission"},
+		{Funder: "Unknown Trust"},
+		{Funder: "Made Up", FunderID: "10.13039/999"},
+	}}}
+	errors, warnings := validator.ValidateFundingRegistry(m, registry)
+	if len(errors) != 2 || !strings.Contains(errors[0], "Unknown Trust") || !strings.Contains(errors[1], "10.13039/999") {
+		t.Errorf("Expected unregistered funders to be rejected, got %v", errors)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "registered as European Commission") || !strings.Contains(warnings[1], "10.13039/501100000780") {
+		t.Errorf("Expected misnamed funders and missing IDs to be warned about, got %v", warnings)
+	}
+
+	// Funders are listed once each, whatever the registry
+	if errs := validator.validateFunding(m.Metadata.Funding); len(errs) != 1 || !strings.Contains(errs[0], "NSF") {
+		t.Errorf("Expected the repeated funder to be rejected, got %v", errs)
+	}
+	if errs := validator.validateFunding([]*core.FundingInfo{{Funder: "NSF", Awards: []string{"A-1", "A-1"}}}); len(errs) != 1 {
+		t.Errorf("Expected the repeated grant to be rejected, got %v", errs)
+	}
+
+	for _, bad := range []string{"", "id,name\n", "not-an-id,Someone\n", "100000001\n"} {
+		if _, err := ParseFunderRegistry(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected registry %q to be refused", bad)
+		}
+	}
+}
+
+func TestManifestValidator_Print(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	for path, mimeType := range map[string]string{"content/index.html": "text/html", "content/styles/print.css": "text/css"} {
+		builder.AddResource(path, &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 1024,
+			Type: mimeType,
+			Path: path,
+		})
+	}
+	validator := NewManifestValidator()
+
+	builder.SetPrintSettings(&core.PrintSettings{PageSize: "Letter", Orientation: "landscape", Margin: "0.5in 20mm", Stylesheet: "content/styles/print.css",
+		Header: "{title}", Footer: "{author}|Page {page} of {pages}", TableOfContents: true, Cover: true})
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected valid print hints to be accepted, got %v", result.Errors)
+	}
+
+	for _, settings := range []*core.PrintSettings{
+		{PageSize: "B7"},
+		{Orientation: "sideways"},
+		{Margin: "1in 2"},
+		{Margin: "6in"},
+		{Stylesheet: "content/styles/missing.css"},
+		{Footer: "a|b|c|d"},
+	} {
+		builder.SetPrintSettings(settings)
+		if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+			t.Errorf("Expected %+v to be rejected", settings)
+		}
+	}
+}
+
+func TestManifestValidator_Data(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	for path, mimeType := range map[string]string{"content/index.html": "text/html", "assets/data/sales.csv": "text/csv", "content/sales.csv": "text/csv"} {
+		builder.AddResource(path, &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 1024,
+			Type: mimeType,
+			Path: path,
+		})
+	}
+	schema := &core.DataSchema{Fields: []*core.DataField{{Name: "region", Type: "string", Required: true}, {Name: "units", Type: "integer"}}}
+	validator := NewManifestValidator()
+
+	builder.SetData(map[string]*core.DataAsset{"sales": {Path: "assets/data/sales.csv", Schema: schema}})
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected a declared data file to be accepted, got %v", result.Errors)
+	}
+
+	for _, asset := range []*core.DataAsset{
+		{Path: "content/sales.csv", Schema: schema},
+		{Path: "assets/data/missing.csv", Schema: schema},
+		{Path: "assets/data/sales.csv", Format: "xlsx", Schema: schema},
+		{Path: "assets/data/sales.csv"},
+		{Path: "assets/data/sales.csv", Schema: &core.DataSchema{Fields: []*core.DataField{{Name: "region", Type: "text"}}}},
+		{Path: "assets/data/sales.csv", Schema: &core.DataSchema{Fields: []*core.DataField{{Name: "region", Type: "string"}, {Name: "region", Type: "number"}}}},
+	} {
+		builder.SetData(map[string]*core.DataAsset{"sales": asset})
+		if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+			t.Errorf("Expected %+v to be rejected", asset)
+		}
+	}
+	builder.SetData(map[string]*core.DataAsset{"sales figures": {Path: "assets/data/sales.csv", Schema: schema}})
+	if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+		t.Errorf("Expected a data name with a space to be rejected")
+	}
+}
+
+func TestManifestValidator_Findings(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("", "Test Author").CreateDefaultSecurityPolicy()
+	result := NewManifestValidator().ValidateManifest(builder.GetManifest())
+
+	required := result.FindingsWithCode("resource.required")
+	if len(required) != 1 || required[0].Path != "/resources/content~1index.html" || required[0].Suggestion == "" {
+		t.Errorf("Expected the missing index to be located with a suggestion, got %+v", required)
+	}
+	var title *core.Finding
+	for _, finding := range result.Findings {
+		if finding.Path == "/metadata/title" {
+			title = finding
+		}
+	}
+	if title == nil || title.Code != "manifest.required" || title.Severity != core.SeverityError {
+		t.Errorf("Expected the missing title at /metadata/title, got %+v", result.Findings)
+	}
+	if len(result.Findings) != len(result.Errors)+len(result.Warnings) {
+		t.Errorf("Expected a finding for each message, got %d findings for %v and %v", len(result.Findings), result.Errors, result.Warnings)
+	}
+}
+
+func TestManifestValidator_Times(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	validator := NewManifestValidator()
+	validator.now = func() time.Time { return now }
+	metadata := builder.GetManifest().Metadata
+
+	metadata.Created, metadata.Modified = now.Add(-time.Hour), now.Add(2*time.Minute)
+	if result := validator.ValidateManifest(builder.GetManifest()); len(result.FindingsWithCode("metadata.future_date")) != 0 {
+		t.Errorf("Expected a modified time within the clock skew to be accepted, got %v", result.Warnings)
+	}
+	metadata.Modified = now.Add(time.Hour)
+	future := validator.ValidateManifest(builder.GetManifest()).FindingsWithCode("metadata.future_date")
+	if len(future) != 1 || future[0].Path != "/metadata/modified" || !strings.Contains(future[0].Message, "1h0m0s ahead") {
+		t.Errorf("Expected the modified time to be reported an hour ahead, got %+v", future)
+	}
+	validator.SetClockSkew(2 * time.Hour)
+	if result := validator.ValidateManifest(builder.GetManifest()); len(result.FindingsWithCode("metadata.future_date")) != 0 {
+		t.Errorf("Expected a larger clock skew to accept the modified time, got %v", result.Warnings)
+	}
+
+	paris := time.FixedZone("CET", 3600)
+	metadata.Created, metadata.Modified = now.In(paris), now.Add(500*time.Millisecond)
+	result := validator.ValidateManifest(builder.GetManifest())
+	if !result.IsValid {
+		t.Errorf("Expected times within the same second in different zones to be accepted, got %v", result.Errors)
+	}
+	if zone := result.FindingsWithCode("metadata.timezone"); len(zone) != 1 || zone[0].Path != "/metadata/created" || zone[0].Severity != core.SeverityInfo {
+		t.Errorf("Expected the created time to be reported as not in UTC, got %+v", zone)
+	}
+
+	builder.Build()
+	if _, offset := metadata.Created.Zone(); offset != 0 || metadata.Modified.Nanosecond() != 0 {
+		t.Errorf("Expected built times in UTC to the second, got %v and %v", metadata.Created, metadata.Modified)
+	}
+}
+
+func TestManifestValidator_Extensions(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	builder.SetExtensions(map[string]json.RawMessage{
+		"com.example.records": json.RawMessage(`{"case_number": "C-1042", "retention_years": 7}`),
+		"org.example.lab":     json.RawMessage(`{"instrument": "NMR-600"}`),
+	})
+	validator := NewManifestValidator()
+
+	result := validator.ValidateManifest(builder.GetManifest())
+	if !result.IsValid {
+		t.Errorf("Expected extensions without schemas to be accepted, got %v", result.Errors)
+	}
+	if notes := result.FindingsWithCode("extension.unregistered"); len(notes) != 2 || notes[0].Severity != core.SeverityInfo {
+		t.Errorf("Expected both extensions noted as unchecked, got %+v", notes)
+	}
+
+	schema := &core.DataSchema{Fields: []*core.DataField{
+		{Name: "case_number", Type: "string", Required: true},
+		{Name: "retention_years", Type: "integer"},
+	}}
+	if err := validator.RegisterExtension("records", schema); err == nil {
+		t.Error("Expected a namespace that is not reverse-DNS to be refused")
+	}
+	if err := validator.RegisterExtension("com.example.records", schema); err != nil {
+		t.Fatalf("Failed to register extension: %v", err)
+	}
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected a conforming extension to be accepted, got %v", result.Errors)
+	}
+
+	builder.GetManifest().Extensions["com.example.records"] = json.RawMessage(`{"retention_years": 7.5, "owner": "legal"}`)
+	builder.GetManifest().Extensions["Example"] = json.RawMessage(`["not", "an", "object"]`)
+	result = validator.ValidateManifest(builder.GetManifest())
+	if result.IsValid {
+		t.Error("Expected invalid extensions to fail validation")
+	}
+	if errs := result.FindingsWithCode("extension.schema"); len(errs) != 3 || errs[0].Path != "/extensions/com.example.records" {
+		t.Errorf("Expected a missing, a mistyped and an undeclared field, got %+v", errs)
+	}
+	if len(result.FindingsWithCode("extension.namespace")) != 1 || len(result.FindingsWithCode("extension.invalid")) != 1 {
+		t.Errorf("Expected the namespace and value of Example to be reported, got %v", result.Errors)
+	}
+
+	data, err := json.Marshal(builder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"extensions":{"Example":["not","an","object"]`) {
+		t.Errorf("Expected extensions to be serialized as given, got %s", data)
+	}
+}
+
+func TestManifestValidator_Subjects(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	metadata := builder.GetManifest().Metadata
+	metadata.Keywords = []string{"leadership", "strategy"}
+	metadata.Subjects = []*core.SubjectInfo{
+		{Scheme: core.SubjectSchemeBISAC, Code: "BUS071000", Label: "BUSINESS & ECONOMICS / Leadership"},
+		{Scheme: core.SubjectSchemeDDC, Code: "658.4"},
+		{Label: "Management"},
+	}
+	validator := NewManifestValidator()
+
+	result := validator.ValidateManifest(builder.GetManifest())
+	if !result.IsValid || len(result.Warnings) != 0 {
+		t.Errorf("Expected valid subjects, got %v %v", result.Errors, result.Warnings)
+	}
+
+	metadata.Keywords = append(metadata.Keywords, "Strategy")
+	metadata.Subjects = append(metadata.Subjects,
+		&core.SubjectInfo{Scheme: core.SubjectSchemeBISAC, Code: "business"},
+		&core.SubjectInfo{Scheme: core.SubjectSchemeDDC, Code: "658.4", Label: "Executive management"},
+		&core.SubjectInfo{Code: "658.4"},
+	)
+	result = validator.ValidateManifest(builder.GetManifest())
+	if errs := result.FindingsWithCode("metadata.subject_code"); len(errs) != 1 || errs[0].Path != "/metadata/subjects/3" {
+		t.Errorf("Expected the malformed BISAC code to be reported, got %v", result.Errors)
+	}
+	if len(result.FindingsWithCode("metadata.subject_scheme")) != 1 {
+		t.Errorf("Expected the code without a scheme to be reported, got %v", result.Errors)
+	}
+	if len(result.FindingsWithCode("metadata.duplicate_keyword")) != 1 || len(result.FindingsWithCode("metadata.duplicate_subject")) != 1 {
+		t.Errorf("Expected the repeated keyword and subject to be noted, got %v", result.Warnings)
+	}
+
+	metadata.Subjects = []*core.SubjectInfo{{Scheme: core.SubjectSchemeBISAC}}
+	if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+		t.Error("Expected a subject without a code or label to fail validation")
+	}
+
+	if terms := metadata.Terms(); strings.Join(terms, "|") != "leadership|strategy" {
+		t.Errorf("Expected the keywords once each, got %v", terms)
+	}
+}
+
+func TestManifestValidator_Access(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	opens := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	closes := opens.AddDate(0, 1, 0)
+	builder.SetAccess(&core.AccessPolicy{NotBefore: &opens, NotAfter: &closes, MaxOpens: 3})
+	validator := NewManifestValidator()
+
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected a valid access policy, got %v", result.Errors)
+	}
+
+	builder.GetManifest().Access.NotAfter = &opens
+	result := validator.ValidateManifest(builder.GetManifest())
+	if errs := result.FindingsWithCode("access.dates"); len(errs) != 1 || errs[0].Path != "/access/not_after" {
+		t.Errorf("Expected an access window that closes as it opens to be reported, got %v", result.Errors)
+	}
+
+	builder.GetManifest().Access = &core.AccessPolicy{MaxOpens: -1}
+	if result := validator.ValidateManifest(builder.GetManifest()); result.IsValid {
+		t.Error("Expected a negative open count to fail validation")
+	}
+}
+
+func TestManifestValidator_JSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(JSONSchema(), &schema); err != nil {
+		t.Fatalf("Expected the schema to be JSON: %v", err)
+	}
+	modes := schema["$defs"].(map[string]interface{})["JSPermissions"].(map[string]interface{})["properties"].(map[string]interface{})["dom_access"]
+	if !strings.Contains(fmt.Sprint(modes), "[none read write]") {
+		t.Errorf("Expected dom_access to list its values, got %v", modes)
+	}
+
+	builder := CreateInteractiveDocumentTemplate("Test Document", "Test Author")
+	builder.AddResource("content/index.html", &core.Resource{
+		Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Size: 1024,
+		Type: "text/html",
+		Path: "content/index.html",
+	})
+	data, err := builder.BuildJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := NewManifestValidator()
+	_, result := validator.ValidateManifestJSON(data)
+	for _, finding := range result.Findings {
+		if strings.HasPrefix(finding.Code, "schema.") {
+			t.Errorf("Expected a built manifest to match the schema, got %v", finding)
+		}
+	}
+
+	data = []byte(strings.NewReplacer(
+		`"dom_access": "write"`, `"dom_access": "execute"`,
+		`"description":`, `"descripton":`,
+	).Replace(string(data)))
+	_, result = validator.ValidateManifestJSON(data)
+	if result.IsValid {
+		t.Error("Expected the altered manifest to be invalid")
+	}
+	if typos := result.FindingsWithCode("schema.unknown_property"); len(typos) != 1 || typos[0].Path != "/metadata/descripton" || typos[0].Suggestion != `did you mean "description"?` {
+		t.Errorf("Expected the misspelt property to be warned of, got %+v", typos)
+	}
+	if enums := result.FindingsWithCode("schema.enum"); len(enums) != 0 || len(result.FindingsWithCode("manifest.oneof")) != 1 {
+		t.Errorf("Expected the value the validator rejected not to be reported twice, got %+v", enums)
+	}
+
+	data = []byte(strings.Replace(string(data), `"size": 1024`, `"size": "1 KB"`, 1))
+	if m, result := validator.ValidateManifestJSON(data); m != nil || len(result.FindingsWithCode("schema.type")) != 1 || result.FindingsWithCode("schema.type")[0].Path != "/resources/content~1index.html/size" {
+		t.Errorf("Expected a mistyped value to be reported where it is, got %v", result.Errors)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := map[string]string{
+		"content/index.html":           "content/index.html",
+		`assets\images\photo.png`:      "assets/images/photo.png",
+		"./assets/images/Photo.PNG":    "assets/images/Photo.png",
+		"assets/images/cafe\u0301.png": "assets/images/caf\u00e9.png",
+	}
+	for path, expected := range tests {
+		if got := NormalizePath(path); got != expected {
+			t.Errorf("NormalizePath(%q) = %q, want %q", path, got, expected)
+		}
+	}
+}
+
+func TestManifestValidator_ResourcePaths(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	for _, path := range []string{"content/index.html", "assets/images/photo.PNG", "assets/images/Logo.png", "assets/images/logo.png"} {
+		builder.AddResource(path, &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 1024,
+			Type: "image/png",
+			Path: path,
+		})
+	}
+	result := NewManifestValidator().ValidateManifest(builder.GetManifest())
+
+	normalization := result.FindingsWithCode("resource.path_normalization")
+	if len(normalization) != 1 || normalization[0].Path != "/resources/assets~1images~1photo.PNG" || normalization[0].Suggestion != "rename it to assets/images/photo.png" {
+		t.Errorf("Expected the uppercase extension to be reported, got %+v", normalization)
+	}
+	conflicts := result.FindingsWithCode("resource.case_conflict")
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0].Message, "assets/images/Logo.png, assets/images/logo.png") {
+		t.Errorf("Expected the paths differing only in case to be reported, got %+v", conflicts)
+	}
+}
+
+func TestManifestValidator_Variants(t *testing.T) {
+	builder := NewManifestBuilder()
+	builder.CreateDefaultMetadata("Test Document", "Test Author").CreateDefaultSecurityPolicy()
+	for _, path := range []string{"content/index.html", "assets/images/photo.png", "assets/images/photo-480w.png"} {
+		builder.AddResource(path, &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 1024,
+			Type: "image/png",
+			Path: path,
+		})
+	}
+	photo := builder.GetManifest().Resources["assets/images/photo.png"]
+	photo.Variants = []*core.ResourceVariant{{Path: "assets/images/photo-480w.png", Width: 480}}
+	validator := NewManifestValidator()
+
+	if result := validator.ValidateManifest(builder.GetManifest()); !result.IsValid {
+		t.Errorf("Expected valid variants to be accepted, got %v", result.Errors)
+	}
+
+	photo.Variants = []*core.ResourceVariant{
+		{Path: "assets/images/photo@2x.png", Density: 2},
+		{Path: "assets/images/photo-480w.png", Width: 480, Quality: "medium"},
+	}
+	result := validator.ValidateManifest(builder.GetManifest())
+	if result.IsValid || len(result.Errors) != 3 {
+		t.Errorf("Expected a missing variant, an unknown quality and two descriptors to be rejected, got %v", result.Errors)
+	}
+}
+
 func TestWASMModuleCircularDependency(t *testing.T) {
 	validator := NewManifestValidator()
 
@@ -414,4 +1019,35 @@ func TestManifestBuilder_Integration(t *testing.T) {
 	if parsedManifest.Metadata.Title != "Test Document" {
 		t.Errorf("Parsed manifest title = %s, want %s", parsedManifest.Metadata.Title, "Test Document")
 	}
-}
\ No newline at end of file
+}
+func TestManifestBuilder_Templates(t *testing.T) {
+	templates := map[string]func(title, author string) *ManifestBuilder{
+		"interactive":  CreateInteractiveDocumentTemplate,
+		"static":       CreateStaticDocumentTemplate,
+		"presentation": CreatePresentationDocumentTemplate,
+		"report":       CreateReportDocumentTemplate,
+	}
+	for name, create := range templates {
+		builder := create("Test Document", "Test Author")
+		builder.AddResource("content/index.html", &core.Resource{
+			Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size: 1024,
+			Type: "text/html",
+			Path: "content/index.html",
+		})
+		data, err := builder.BuildJSON()
+		if err != nil {
+			t.Fatalf("%s: failed to build manifest: %v", name, err)
+		}
+		if _, result := NewManifestValidator().ValidateManifestJSON(data); !result.IsValid {
+			t.Errorf("%s: built manifest is invalid: %v", name, result.Errors)
+		}
+	}
+
+	if print := CreateReportDocumentTemplate("Report", "Author").GetManifest().Print; print == nil || !print.TableOfContents {
+		t.Errorf("Expected reports to print with a contents page, got %+v", print)
+	}
+	if features := CreatePresentationDocumentTemplate("Slides", "Author").GetManifest().Features; !features.Interactivity || features.WebAssembly {
+		t.Errorf("Expected scripted presentations without WebAssembly, got %+v", features)
+	}
+}
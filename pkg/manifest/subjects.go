@@ -0,0 +1,56 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// subjectCodes are the forms of the codes of each subject vocabulary: BISAC
+// codes are three letters and six digits, DDC class numbers three digits with
+// an optional decimal part
+var subjectCodes = map[string]*regexp.Regexp{
+	core.SubjectSchemeBISAC: regexp.MustCompile(`^[A-Z]{3}[0-9]{6}$`),
+	core.SubjectSchemeDDC:   regexp.MustCompile(`^[0-9]{3}(\.[0-9]+)?$`),
+}
+
+// validateSubjects checks that subject codes have the form of their
+// vocabulary, and warns of keywords and subjects listed more than once
+func (mv *ManifestValidator) validateSubjects(metadata *core.DocumentMetadata, result *core.ValidationResult) {
+	keywords := make(map[string]bool)
+	for i, keyword := range metadata.Keywords {
+		key := strings.ToLower(strings.TrimSpace(keyword))
+		if keywords[key] {
+			result.AddWarning("metadata.duplicate_keyword", core.JSONPointer("metadata", "keywords", i), fmt.Sprintf("keyword %q is listed more than once", keyword))
+		}
+		keywords[key] = true
+	}
+
+	subjects := make(map[string]bool)
+	for i, subject := range metadata.Subjects {
+		if subject == nil {
+			continue
+		}
+		pointer := core.JSONPointer("metadata", "subjects", i)
+		if subject.Code != "" {
+			pattern, known := subjectCodes[subject.Scheme]
+			switch {
+			case subject.Scheme == "":
+				result.AddError("metadata.subject_scheme", pointer, fmt.Sprintf("subject code %s needs the scheme it is from", subject.Code)).
+					Suggestion = "set scheme to bisac or ddc, or give the subject as a label"
+			case known && !pattern.MatchString(subject.Code):
+				result.AddError("metadata.subject_code", pointer, fmt.Sprintf("%s is not a %s code", subject.Code, strings.ToUpper(subject.Scheme)))
+			}
+		}
+		key := strings.ToLower(subject.Scheme + ":" + subject.Code + ":" + subject.Label)
+		if subject.Code != "" {
+			key = strings.ToLower(subject.Scheme + ":" + subject.Code)
+		}
+		if subjects[key] {
+			result.AddWarning("metadata.duplicate_subject", pointer, fmt.Sprintf("subject %s is listed more than once", subject))
+		}
+		subjects[key] = true
+	}
+}
@@ -0,0 +1,366 @@
+// Package ogimage renders the Open Graph preview cards shown when a document
+// link is shared on social and chat platforms.
+package ogimage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/liv-format/liv/pkg/core"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/net/html"
+)
+
+const (
+	// Width and Height are the card size recommended by Open Graph consumers
+	Width  = 1200
+	Height = 630
+
+	// MaxThumbnailPixels bounds the size of images decoded as thumbnails
+	MaxThumbnailPixels = 40 << 20
+
+	// DefaultBrand is printed in the corner of every card
+	DefaultBrand = "LIV Document"
+
+	// Entry is the package path of a card rendered at build time
+	Entry = "content/static/og-image.png"
+
+	contentEntry = "content/index.html"
+)
+
+var (
+	backgroundTop    = color.RGBA{R: 0x0b, G: 0x1f, B: 0x3a, A: 0xff}
+	backgroundBottom = color.RGBA{R: 0x00, G: 0x56, B: 0xb3, A: 0xff}
+	accentColor      = color.RGBA{R: 0x00, G: 0x7b, B: 0xff, A: 0xff}
+	titleColor       = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	subtitleColor    = color.RGBA{R: 0xc8, G: 0xd6, B: 0xe8, A: 0xff}
+)
+
+// thumbnailNames are file names, without extension, that mark a package image
+// as the intended preview
+var thumbnailNames = map[string]bool{
+	"cover": true, "thumbnail": true, "preview": true, "social": true,
+}
+
+// Card holds what is printed on a preview card
+type Card struct {
+	Title     string
+	Author    string
+	Brand     string
+	Thumbnail image.Image
+}
+
+// NewCard creates a card from document metadata
+func NewCard(metadata *core.DocumentMetadata) *Card {
+	card := &Card{Brand: DefaultBrand}
+	if metadata != nil {
+		card.Title = metadata.Title
+		card.Author = metadata.Author
+	}
+	if strings.TrimSpace(card.Title) == "" {
+		card.Title = "Untitled document"
+	}
+	return card
+}
+
+// Render draws the card: a branded gradient background with the title and
+// author on the left and the thumbnail, if any, on the right
+func (c *Card) Render() (*image.RGBA, error) {
+	faces, err := loadFaces()
+	if err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	for y := 0; y < Height; y++ {
+		line := blend(backgroundTop, backgroundBottom, float64(y)/float64(Height-1))
+		draw.Draw(canvas, image.Rect(0, y, Width, y+1), image.NewUniform(line), image.Point{}, draw.Src)
+	}
+	draw.Draw(canvas, image.Rect(0, 0, 16, Height), image.NewUniform(accentColor), image.Point{}, draw.Src)
+
+	const margin = 80
+	textRight := Width - margin
+	if c.Thumbnail != nil {
+		frame := image.Rect(Width-margin-420, 105, Width-margin, 525)
+		draw.Draw(canvas, frame.Inset(-6), image.NewUniform(titleColor), image.Point{}, draw.Src)
+		drawCover(canvas, frame, c.Thumbnail)
+		textRight = frame.Min.X - 60
+	}
+
+	brand := c.Brand
+	if brand == "" {
+		brand = DefaultBrand
+	}
+	drawText(canvas, faces.brand, subtitleColor, margin, 110, strings.ToUpper(brand))
+
+	y := 230
+	for _, line := range Wrap(faces.title, c.Title, textRight-margin, 3) {
+		drawText(canvas, faces.title, titleColor, margin, y, line)
+		y += 76
+	}
+	if c.Author != "" {
+		lines := Wrap(faces.author, c.Author, textRight-margin, 1)
+		drawText(canvas, faces.author, subtitleColor, margin, y+30, lines[0])
+	}
+
+	return canvas, nil
+}
+
+// Encode renders the card as PNG
+func (c *Card) Encode(w io.Writer) error {
+	canvas, err := c.Render()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, canvas)
+}
+
+// RenderPackage renders the card of a document package. read returns the
+// contents of a package entry. Encrypted entries are never used, so a card
+// cannot leak protected images; a thumbnail that fails to load is left out.
+func RenderPackage(m *core.Manifest, read func(entry string) ([]byte, error)) ([]byte, error) {
+	card := NewCard(m.Metadata)
+
+	var content []byte
+	if !isEncrypted(m, contentEntry) {
+		content, _ = read(contentEntry)
+	}
+	if thumbnail := FindThumbnail(m, content, contentEntry); thumbnail != "" {
+		if data, err := read(thumbnail); err == nil {
+			card.Thumbnail, _ = DecodeThumbnail(data)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := card.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeThumbnail decodes a PNG, JPEG or GIF thumbnail, refusing images whose
+// dimensions would need an unreasonable amount of memory
+func DecodeThumbnail(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported thumbnail: %v", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxThumbnailPixels {
+		return nil, fmt.Errorf("thumbnail is too large: %dx%d", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode thumbnail: %v", err)
+	}
+	return img, nil
+}
+
+// FindThumbnail picks the package image to show on a document's card: an image
+// resource named cover, thumbnail, preview or social, otherwise the first
+// package image referenced by the document content. Encrypted images are skipped. contentPath is the
+// package path of content and is used to resolve relative references.
+func FindThumbnail(m *core.Manifest, content []byte, contentPath string) string {
+	var named []string
+	for resourcePath, resource := range m.Resources {
+		if resource == nil || resourcePath == Entry || isEncrypted(m, resourcePath) || !isImage(resourcePath, resource.Type) {
+			continue
+		}
+		base := path.Base(resourcePath)
+		if thumbnailNames[strings.ToLower(strings.TrimSuffix(base, path.Ext(base)))] {
+			named = append(named, resourcePath)
+		}
+	}
+	if len(named) > 0 {
+		sort.Strings(named)
+		return named[0]
+	}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "img" {
+				continue
+			}
+			for _, attr := range token.Attr {
+				if attr.Key != "src" || strings.Contains(attr.Val, ":") || strings.HasPrefix(attr.Val, "/") {
+					continue
+				}
+				resolved := path.Join(path.Dir(contentPath), strings.SplitN(attr.Val, "?", 2)[0])
+				if resource := m.Resources[resolved]; resource != nil && resolved != Entry && !isEncrypted(m, resolved) && isImage(resolved, resource.Type) {
+					return resolved
+				}
+			}
+		}
+	}
+}
+
+// Wrap breaks text into at most maxLines lines no wider than width pixels,
+// ending the last line with an ellipsis when text is cut short
+func Wrap(face font.Face, text string, width, maxLines int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	fits := func(s string) bool { return font.MeasureString(face, s).Ceil() <= width }
+
+	var lines []string
+	current := ""
+	for i, word := range words {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if fits(candidate) {
+			current = candidate
+			continue
+		}
+
+		if current != "" {
+			lines = append(lines, current)
+		}
+		current = word
+		if len(lines) == maxLines {
+			return ellipsize(face, lines, width, true)
+		}
+		// A single word wider than the line is cut
+		if !fits(current) {
+			lines = append(lines, current)
+			current = ""
+			if len(lines) == maxLines && i < len(words)-1 {
+				return ellipsize(face, lines, width, true)
+			}
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	if len(lines) > maxLines {
+		return ellipsize(face, lines[:maxLines], width, true)
+	}
+	return ellipsize(face, lines, width, false)
+}
+
+// ellipsize shortens lines that do not fit and marks truncated text
+func ellipsize(face font.Face, lines []string, width int, truncated bool) []string {
+	for i, line := range lines {
+		last := i == len(lines)-1
+		if font.MeasureString(face, line).Ceil() <= width && !(last && truncated) {
+			continue
+		}
+		runes := []rune(line)
+		for len(runes) > 0 && font.MeasureString(face, string(runes)+"…").Ceil() > width {
+			runes = runes[:len(runes)-1]
+		}
+		lines[i] = strings.TrimRight(string(runes), " ") + "…"
+	}
+	return lines
+}
+
+func isEncrypted(m *core.Manifest, entry string) bool {
+	if m.Encryption == nil {
+		return false
+	}
+	_, encrypted := m.Encryption.Resources[entry]
+	return encrypted
+}
+
+func isImage(filePath, mimeType string) bool {
+	if strings.HasPrefix(mimeType, "image/") && mimeType != "image/svg+xml" {
+		return true
+	}
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	}
+	return false
+}
+
+// drawCover scales img to cover frame, cropping the overflow evenly
+func drawCover(dst *image.RGBA, frame image.Rectangle, img image.Image) {
+	bounds := img.Bounds()
+	scale := max(float64(frame.Dx())/float64(bounds.Dx()), float64(frame.Dy())/float64(bounds.Dy()))
+	cropWidth := int(float64(frame.Dx()) / scale)
+	cropHeight := int(float64(frame.Dy()) / scale)
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-cropWidth)/2, bounds.Min.Y+(bounds.Dy()-cropHeight)/2)
+	source := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(cropWidth, cropHeight))}
+
+	draw.Draw(dst, frame, image.NewUniform(titleColor), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, frame, img, source, draw.Over, nil)
+}
+
+func drawText(dst *image.RGBA, face font.Face, c color.Color, x, y int, text string) {
+	drawer := &font.Drawer{Dst: dst, Src: image.NewUniform(c), Face: face, Dot: fixed.P(x, y)}
+	drawer.DrawString(text)
+}
+
+func blend(from, to color.RGBA, t float64) color.RGBA {
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*t) }
+	return color.RGBA{R: mix(from.R, to.R), G: mix(from.G, to.G), B: mix(from.B, to.B), A: 0xff}
+}
+
+type faceSet struct {
+	title  font.Face
+	author font.Face
+	brand  font.Face
+}
+
+var (
+	facesOnce   sync.Once
+	cachedFaces *faceSet
+	facesErr    error
+)
+
+// loadFaces parses the bundled Go fonts once
+func loadFaces() (*faceSet, error) {
+	facesOnce.Do(func() {
+		bold, err := opentype.Parse(gobold.TTF)
+		if err != nil {
+			facesErr = fmt.Errorf("failed to load title font: %v", err)
+			return
+		}
+		regular, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			facesErr = fmt.Errorf("failed to load text font: %v", err)
+			return
+		}
+
+		face := func(f *opentype.Font, size float64) font.Face {
+			if facesErr != nil {
+				return nil
+			}
+			var created font.Face
+			created, facesErr = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+			return created
+		}
+		faces := &faceSet{
+			title:  face(bold, 64),
+			author: face(regular, 34),
+			brand:  face(bold, 26),
+		}
+		if facesErr == nil {
+			cachedFaces = faces
+		}
+	})
+	return cachedFaces, facesErr
+}
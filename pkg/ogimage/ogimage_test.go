@@ -0,0 +1,198 @@
+package ogimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+	"golang.org/x/image/font"
+)
+
+func solidPNG(t *testing.T, w, h int, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRenderCard(t *testing.T) {
+	card := NewCard(&core.DocumentMetadata{Title: "Quarterly Report", Author: "ACME Corp"})
+	img, err := card.Render()
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if img.Bounds().Dx() != Width || img.Bounds().Dy() != Height {
+		t.Fatalf("Expected %dx%d card, got %v", Width, Height, img.Bounds())
+	}
+
+	// Title text is drawn in white over the dark background
+	white := 0
+	for x := 80; x < Width-80; x++ {
+		for y := 170; y < 240; y++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r > 0xf000 && g > 0xf000 && b > 0xf000 {
+				white++
+			}
+		}
+	}
+	if white == 0 {
+		t.Errorf("Expected the title to be drawn")
+	}
+
+	untitled := NewCard(nil)
+	if untitled.Title != "Untitled document" || untitled.Brand != DefaultBrand {
+		t.Errorf("Unexpected defaults: %+v", untitled)
+	}
+}
+
+func TestRenderCardThumbnail(t *testing.T) {
+	thumbnail, err := DecodeThumbnail(solidPNG(t, 300, 100, color.RGBA{R: 255, A: 255}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card := &Card{Title: "With thumbnail", Thumbnail: thumbnail}
+	img, err := card.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The thumbnail is scaled to cover its frame, so the center and the frame
+	// corners are all red
+	for _, p := range []image.Point{{910, 315}, {705, 110}, {1115, 520}} {
+		if r, g, b, _ := img.At(p.X, p.Y).RGBA(); r < 0xf000 || g > 0x1000 || b > 0x1000 {
+			t.Errorf("Expected thumbnail pixel at %v, got %v", p, img.At(p.X, p.Y))
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	faces, err := loadFaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := Wrap(faces.title, "Short title", 1000, 3); len(lines) != 1 || lines[0] != "Short title" {
+		t.Errorf("Unexpected wrapping of a short title: %q", lines)
+	}
+
+	long := strings.Repeat("Annual financial statement ", 20)
+	lines := Wrap(faces.title, long, 600, 3)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %q", len(lines), lines)
+	}
+	if !strings.HasSuffix(lines[2], "…") {
+		t.Errorf("Expected the truncated title to end with an ellipsis, got %q", lines[2])
+	}
+
+	word := Wrap(faces.title, strings.Repeat("x", 200), 600, 3)
+	if len(word) != 1 || !strings.HasSuffix(word[0], "…") {
+		t.Errorf("Expected an over-long word to be cut, got %q", word)
+	}
+	for _, line := range append(lines, word...) {
+		if width := font.MeasureString(faces.title, line).Ceil(); width > 600 {
+			t.Errorf("Line %q is %dpx wide", line, width)
+		}
+	}
+}
+
+func TestFindThumbnail(t *testing.T) {
+	m := &core.Manifest{Resources: map[string]*core.Resource{
+		"content/index.html":       {Type: "text/html"},
+		"assets/images/chart.png":  {Type: "image/png"},
+		"assets/images/cover.jpg":  {Type: "image/jpeg"},
+		"assets/images/banner.svg": {Type: "image/svg+xml"},
+		Entry:                      {Type: "image/png"},
+	}}
+	content := []byte(`<p><img src="../assets/images/chart.png"></p>`)
+
+	if got := FindThumbnail(m, content, "content/index.html"); got != "assets/images/cover.jpg" {
+		t.Errorf("Expected the cover image, got %q", got)
+	}
+
+	delete(m.Resources, "assets/images/cover.jpg")
+	if got := FindThumbnail(m, content, "content/index.html"); got != "assets/images/chart.png" {
+		t.Errorf("Expected the first content image, got %q", got)
+	}
+
+	for _, src := range []string{"https://example.com/a.png", "../assets/images/banner.svg", "missing.png", "/etc/passwd"} {
+		if got := FindThumbnail(m, []byte(`<img src="`+src+`">`), "content/index.html"); got != "" {
+			t.Errorf("Expected no thumbnail for %q, got %q", src, got)
+		}
+	}
+}
+
+func TestRenderPackage(t *testing.T) {
+	files := map[string][]byte{
+		"content/index.html":      []byte(`<h1>Report</h1><img src="../assets/chart.png">`),
+		"assets/chart.png":        solidPNG(t, 50, 50, color.RGBA{G: 255, A: 255}),
+		"assets/secret/cover.png": solidPNG(t, 50, 50, color.RGBA{R: 255, A: 255}),
+	}
+	m := &core.Manifest{
+		Metadata: &core.DocumentMetadata{Title: "Report"},
+		Resources: map[string]*core.Resource{
+			"content/index.html":      {Type: "text/html"},
+			"assets/chart.png":        {Type: "image/png"},
+			"assets/secret/cover.png": {Type: "image/png"},
+		},
+		Encryption: &core.EncryptionInfo{Resources: map[string]*core.EncryptedResource{
+			"assets/secret/cover.png": {},
+		}},
+	}
+	var requested []string
+	read := func(entry string) ([]byte, error) {
+		requested = append(requested, entry)
+		if data, ok := files[entry]; ok {
+			return data, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	data, err := RenderPackage(m, read)
+	if err != nil {
+		t.Fatalf("RenderPackage failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Card is not a valid PNG: %v", err)
+	}
+	if img.Bounds().Dx() != Width || img.Bounds().Dy() != Height {
+		t.Errorf("Unexpected card size %v", img.Bounds())
+	}
+	for _, entry := range requested {
+		if entry == "assets/secret/cover.png" {
+			t.Errorf("Encrypted images must not be used as thumbnails")
+		}
+	}
+	if r, g, _, _ := img.At(910, 315).RGBA(); g < 0xf000 || r > 0x1000 {
+		t.Errorf("Expected the content image as thumbnail, got %v", img.At(910, 315))
+	}
+}
+
+func TestDecodeThumbnailRejectsHugeImages(t *testing.T) {
+	// A valid PNG header announcing a 100000x100000 image
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buf.Bytes()
+	copy(data[16:24], []byte{0, 1, 0x86, 0xa0, 0, 1, 0x86, 0xa0})
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := DecodeThumbnail(data); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Expected huge thumbnails to be rejected, got %v", err)
+	}
+	if _, err := DecodeThumbnail([]byte("not an image")); err == nil {
+		t.Errorf("Expected an error for invalid data")
+	}
+}
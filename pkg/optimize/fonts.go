@@ -0,0 +1,396 @@
+package optimize
+
+import (
+	"encoding/binary"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/liv-format/liv/pkg/compliance"
+)
+
+// Composite glyph flags, from the OpenType glyf table specification
+const (
+	argsAreWords   = 0x0001
+	haveScale      = 0x0008
+	moreComponents = 0x0020
+	haveXYScale    = 0x0040
+	haveTwoByTwo   = 0x0080
+)
+
+// The head table's checkSumAdjustment field makes the whole font sum to
+// checksumMagic
+const (
+	checksumMagic   = 0xB1B0AFBA
+	headAdjustField = 8
+)
+
+// textExtensions are the files whose characters a font may have to draw
+var textExtensions = map[string]bool{
+	".html": true, ".htm": true, ".xhtml": true, ".css": true, ".js": true, ".mjs": true,
+	".json": true, ".svg": true, ".txt": true, ".md": true, ".xml": true,
+}
+
+// usedRunes collects the characters of a document's text files, with
+// printable ASCII and the common Latin ligatures always included, since
+// scripts may generate text the files do not contain
+func usedRunes(files map[string][]byte) map[rune]bool {
+	used := make(map[rune]bool)
+	for r := rune(0x20); r < 0x7F; r++ {
+		used[r] = true
+	}
+	for r := rune(0xFB00); r <= 0xFB06; r++ {
+		used[r] = true
+	}
+	for filePath, data := range files {
+		ext := strings.ToLower(path.Ext(filePath))
+		if !textExtensions[ext] || !utf8.Valid(data) {
+			continue
+		}
+		text := string(data)
+		if ext == ".html" || ext == ".htm" || ext == ".xhtml" || ext == ".svg" || ext == ".xml" {
+			text += html.UnescapeString(text)
+		}
+		for _, r := range text {
+			used[r] = true
+		}
+	}
+	return used
+}
+
+// SubsetFont empties the outlines of the glyphs of a TrueType font that
+// draw none of the used characters. Glyph IDs are kept, so the metrics,
+// kerning and layout tables stay valid as they are. Glyphs no character
+// maps to are kept too: ligatures and alternates are reached through layout
+// features rather than the character map. Fonts whose license forbids
+// subsetting, CFF-flavored OpenType fonts and WOFF fonts are refused.
+func SubsetFont(data []byte, used map[rune]bool) ([]byte, error) {
+	license, err := compliance.InspectFont(data)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case license.Format != "sfnt":
+		return nil, fmt.Errorf("only TrueType fonts can be subset, not %s", license.Format)
+	case license.NoSubsetting:
+		return nil, fmt.Errorf("font license forbids subsetting")
+	case license.Embedding == compliance.EmbeddingRestricted || license.BitmapOnly:
+		return nil, fmt.Errorf("font license forbids embedding")
+	}
+
+	font, err := parseSFNT(data)
+	if err != nil {
+		return nil, err
+	}
+	head, maxp, cmap := font.tables["head"], font.tables["maxp"], font.tables["cmap"]
+	loca, glyf := font.tables["loca"], font.tables["glyf"]
+	if glyf == nil || loca == nil {
+		return nil, fmt.Errorf("font has no TrueType outlines")
+	}
+	if head == nil || len(head) < 54 || maxp == nil || len(maxp) < 6 || cmap == nil {
+		return nil, fmt.Errorf("font is missing required tables")
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:6]))
+	longOffsets := binary.BigEndian.Uint16(head[50:52]) == 1
+
+	offsets, err := readLoca(loca, numGlyphs, longOffsets, len(glyf))
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := readCmap(cmap)
+	if err != nil {
+		return nil, err
+	}
+
+	// A glyph is kept when a used character or no character maps to it
+	keep := make([]bool, numGlyphs)
+	mapped := make([]bool, numGlyphs)
+	for r, glyph := range mapping {
+		if glyph >= numGlyphs {
+			continue
+		}
+		mapped[glyph] = true
+		if used[r] {
+			keep[glyph] = true
+		}
+	}
+	for glyph := range keep {
+		if !mapped[glyph] {
+			keep[glyph] = true
+		}
+	}
+	// Composite glyphs need their components
+	for glyph := 0; glyph < numGlyphs; glyph++ {
+		if keep[glyph] {
+			keepComponents(glyf, offsets, glyph, keep, 0)
+		}
+	}
+
+	var newGlyf []byte
+	newOffsets := make([]int, numGlyphs+1)
+	for glyph := 0; glyph < numGlyphs; glyph++ {
+		newOffsets[glyph] = len(newGlyf)
+		if keep[glyph] {
+			newGlyf = append(newGlyf, glyf[offsets[glyph]:offsets[glyph+1]]...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	newOffsets[numGlyphs] = len(newGlyf)
+
+	font.tables["glyf"] = newGlyf
+	font.tables["loca"] = writeLoca(newOffsets, longOffsets)
+	return font.encode(), nil
+}
+
+// keepComponents marks the components of a composite glyph, and theirs
+func keepComponents(glyf []byte, offsets []int, glyph int, keep []bool, depth int) {
+	data := glyf[offsets[glyph]:offsets[glyph+1]]
+	if depth > 16 || len(data) < 10 || int16(binary.BigEndian.Uint16(data[0:2])) >= 0 {
+		return
+	}
+	for i := 10; i+4 <= len(data); {
+		flags := binary.BigEndian.Uint16(data[i : i+2])
+		component := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if component < len(keep) {
+			keep[component] = true
+			keepComponents(glyf, offsets, component, keep, depth+1)
+		}
+		i += 4
+		if flags&argsAreWords != 0 {
+			i += 4
+		} else {
+			i += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			i += 2
+		case flags&haveXYScale != 0:
+			i += 4
+		case flags&haveTwoByTwo != 0:
+			i += 8
+		}
+		if flags&moreComponents == 0 {
+			return
+		}
+	}
+}
+
+// readLoca reads the glyph offsets of a loca table
+func readLoca(loca []byte, numGlyphs int, longOffsets bool, glyfSize int) ([]int, error) {
+	offsets := make([]int, numGlyphs+1)
+	for i := range offsets {
+		if longOffsets {
+			if 4*i+4 > len(loca) {
+				return nil, fmt.Errorf("font loca table is truncated")
+			}
+			offsets[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		} else {
+			if 2*i+2 > len(loca) {
+				return nil, fmt.Errorf("font loca table is truncated")
+			}
+			offsets[i] = 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+		}
+		if offsets[i] > glyfSize || i > 0 && offsets[i] < offsets[i-1] {
+			return nil, fmt.Errorf("font loca table is invalid")
+		}
+	}
+	return offsets, nil
+}
+
+// writeLoca encodes glyph offsets in the font's loca format
+func writeLoca(offsets []int, longOffsets bool) []byte {
+	if longOffsets {
+		loca := make([]byte, 4*len(offsets))
+		for i, offset := range offsets {
+			binary.BigEndian.PutUint32(loca[4*i:], uint32(offset))
+		}
+		return loca
+	}
+	loca := make([]byte, 2*len(offsets))
+	for i, offset := range offsets {
+		binary.BigEndian.PutUint16(loca[2*i:], uint16(offset/2))
+	}
+	return loca
+}
+
+// readCmap reads the Unicode character map of a font, from a format 12
+// subtable when there is one and a format 4 subtable otherwise
+func readCmap(cmap []byte) (map[rune]int, error) {
+	if len(cmap) < 4 {
+		return nil, fmt.Errorf("font cmap table is truncated")
+	}
+	var format4, format12 []byte
+	numTables := int(binary.BigEndian.Uint16(cmap[2:4]))
+	for i := 0; i < numTables; i++ {
+		record := 4 + 8*i
+		if record+8 > len(cmap) {
+			break
+		}
+		platform := binary.BigEndian.Uint16(cmap[record:])
+		encoding := binary.BigEndian.Uint16(cmap[record+2:])
+		offset := int(binary.BigEndian.Uint32(cmap[record+4:]))
+		if offset+2 > len(cmap) || !(platform == 0 || platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue
+		}
+		switch binary.BigEndian.Uint16(cmap[offset:]) {
+		case 4:
+			format4 = cmap[offset:]
+		case 12:
+			format12 = cmap[offset:]
+		}
+	}
+
+	mapping := make(map[rune]int)
+	switch {
+	case format12 != nil:
+		if len(format12) < 16 {
+			return nil, fmt.Errorf("font cmap subtable is truncated")
+		}
+		groups := int(binary.BigEndian.Uint32(format12[12:16]))
+		for i := 0; i < groups && 16+12*i+12 <= len(format12); i++ {
+			group := format12[16+12*i:]
+			start, end := binary.BigEndian.Uint32(group), binary.BigEndian.Uint32(group[4:])
+			glyph := int(binary.BigEndian.Uint32(group[8:]))
+			if end < start || end > utf8.MaxRune {
+				return nil, fmt.Errorf("font cmap subtable is invalid")
+			}
+			for r := start; r <= end; r++ {
+				mapping[rune(r)] = glyph + int(r-start)
+			}
+		}
+	case format4 != nil:
+		if len(format4) < 14 {
+			return nil, fmt.Errorf("font cmap subtable is truncated")
+		}
+		segments := int(binary.BigEndian.Uint16(format4[6:8])) / 2
+		ends, starts := 14, 16+2*segments
+		deltas, rangeOffsets := starts+2*segments, starts+4*segments
+		if rangeOffsets+2*segments > len(format4) {
+			return nil, fmt.Errorf("font cmap subtable is truncated")
+		}
+		for i := 0; i < segments; i++ {
+			end := int(binary.BigEndian.Uint16(format4[ends+2*i:]))
+			start := int(binary.BigEndian.Uint16(format4[starts+2*i:]))
+			delta := int(binary.BigEndian.Uint16(format4[deltas+2*i:]))
+			rangeOffset := int(binary.BigEndian.Uint16(format4[rangeOffsets+2*i:]))
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				glyph := (c + delta) & 0xFFFF
+				if rangeOffset != 0 {
+					at := rangeOffsets + 2*i + rangeOffset + 2*(c-start)
+					if at+2 > len(format4) {
+						continue
+					}
+					if glyph = int(binary.BigEndian.Uint16(format4[at:])); glyph != 0 {
+						glyph = (glyph + delta) & 0xFFFF
+					}
+				}
+				if glyph != 0 {
+					mapping[rune(c)] = glyph
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("font has no Unicode character map")
+	}
+	return mapping, nil
+}
+
+// sfnt is a font's table directory and tables, in directory order
+type sfnt struct {
+	version uint32
+	tags    []string
+	tables  map[string][]byte
+}
+
+func parseSFNT(data []byte) (*sfnt, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font data too short")
+	}
+	font := &sfnt{version: binary.BigEndian.Uint32(data), tables: make(map[string][]byte)}
+	numTables := int(binary.BigEndian.Uint16(data[4:6]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + 16*i
+		if record+16 > len(data) {
+			return nil, fmt.Errorf("font table directory is truncated")
+		}
+		tag := string(data[record : record+4])
+		offset := int(binary.BigEndian.Uint32(data[record+8:]))
+		length := int(binary.BigEndian.Uint32(data[record+12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, fmt.Errorf("font table %q is out of bounds", tag)
+		}
+		font.tags = append(font.tags, tag)
+		font.tables[tag] = data[offset : offset+length]
+	}
+	return font, nil
+}
+
+// encode writes the font with fresh table checksums and head
+// checksum adjustment
+func (f *sfnt) encode() []byte {
+	numTables := len(f.tags)
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= numTables {
+		searchRange *= 2
+		entrySelector++
+	}
+
+	header := make([]byte, 12+16*numTables)
+	binary.BigEndian.PutUint32(header[0:], f.version)
+	binary.BigEndian.PutUint16(header[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange*16))
+	binary.BigEndian.PutUint16(header[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:], uint16(numTables*16-searchRange*16))
+
+	// The directory is sorted by tag, as the specification requires, while
+	// tables keep their order in the file
+	sorted := append([]string(nil), f.tags...)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j] < sorted[j-1]; j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+
+	offsets := make(map[string]int)
+	body := []byte{}
+	for _, tag := range f.tags {
+		table := append([]byte(nil), f.tables[tag]...)
+		if tag == "head" && len(table) >= headAdjustField+4 {
+			binary.BigEndian.PutUint32(table[headAdjustField:], 0)
+			f.tables[tag] = table
+		}
+		offsets[tag] = len(header) + len(body)
+		body = append(body, table...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	for i, tag := range sorted {
+		record := header[12+16*i:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[4:], checksum(f.tables[tag]))
+		binary.BigEndian.PutUint32(record[8:], uint32(offsets[tag]))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(f.tables[tag])))
+	}
+
+	font := append(header, body...)
+	if head, ok := offsets["head"]; ok && len(f.tables["head"]) >= headAdjustField+4 {
+		binary.BigEndian.PutUint32(font[head+headAdjustField:], checksumMagic-checksum(font))
+	}
+	return font
+}
+
+// checksum sums data as big-endian 32-bit words, zero padded
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,123 @@
+package optimize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/liv-format/liv/pkg/compliance"
+	"github.com/liv-format/liv/pkg/preview"
+)
+
+// recompressImage re-encodes a PNG at the best compression level or a JPEG
+// at the given quality. Images whose metadata would be lost are refused:
+// decoding drops XMP rights, which the asset license check reads, color
+// profiles, and EXIF orientation.
+func recompressImage(data []byte, quality int) ([]byte, error) {
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "png":
+		encoder := &png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeWebP converts a PNG or JPEG into a lossless WebP image
+func encodeWebP(data []byte) ([]byte, error) {
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := preview.EncodeWebP(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode WebP: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeImage decodes an image that can be re-encoded without losing
+// metadata that matters
+func decodeImage(data []byte) (image.Image, string, error) {
+	if compliance.ExtractXMP(data) != nil {
+		return nil, "", fmt.Errorf("image carries XMP rights metadata")
+	}
+	if bytes.Contains(data, []byte("ICC_PROFILE")) || bytes.Contains(data, []byte("iCCP")) {
+		return nil, "", fmt.Errorf("image carries a color profile")
+	}
+	if orientation := exifOrientation(data); orientation > 1 {
+		return nil, "", fmt.Errorf("image is rotated by its EXIF orientation")
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	return img, format, nil
+}
+
+// exifOrientation returns the orientation tag of a JPEG's EXIF segment, or
+// 0 when it has none
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 0
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 0
+}
+
+// tiffOrientation reads tag 0x0112 from the first IFD of a TIFF header
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8 : entry+10]))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,254 @@
+package optimize
+
+import (
+	"bytes"
+	"strings"
+)
+
+// MinifyCSS removes comments and collapses whitespace in a stylesheet.
+// Strings are kept as written, and so are /*! comments, which carry the
+// license banners of bundled libraries. Spaces are only removed around
+// braces, semicolons, commas and child combinators, where they never
+// matter, and after colons. A space before a colon may separate a
+// descendant selector from a pseudo-class and is kept.
+func MinifyCSS(data []byte) []byte {
+	var out bytes.Buffer
+	space := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end == -1 {
+				end = len(data)
+			} else {
+				end += i + 4
+			}
+			if i+2 < len(data) && data[i+2] == '!' {
+				flushSpace(&out, &space)
+				out.Write(data[i:end])
+				out.WriteByte('\n')
+			}
+			i = end - 1
+		case c == '"' || c == '\'':
+			flushSpace(&out, &space)
+			end := quotedEnd(data, i)
+			out.Write(data[i:end])
+			i = end - 1
+		case isSpace(c):
+			space = true
+		case strings.IndexByte("{};,>", c) != -1:
+			space = false
+			if c == '}' {
+				trimTrailing(&out, ';')
+			}
+			trimTrailing(&out, ' ')
+			out.WriteByte(c)
+		case c == ':':
+			flushSpace(&out, &space)
+			out.WriteByte(c)
+			for i+1 < len(data) && isSpace(data[i+1]) {
+				i++
+			}
+		default:
+			flushSpace(&out, &space)
+			out.WriteByte(c)
+		}
+	}
+	return bytes.TrimSpace(out.Bytes())
+}
+
+// flushSpace writes a pending space unless it would follow a character
+// that never needs one after it
+func flushSpace(out *bytes.Buffer, space *bool) {
+	if *space && out.Len() > 0 && strings.IndexByte("{};,>\n", out.Bytes()[out.Len()-1]) == -1 {
+		out.WriteByte(' ')
+	}
+	*space = false
+}
+
+// trimTrailing removes one trailing c from out
+func trimTrailing(out *bytes.Buffer, c byte) {
+	if out.Len() > 0 && out.Bytes()[out.Len()-1] == c {
+		out.Truncate(out.Len() - 1)
+	}
+}
+
+// MinifyJS removes comments and indentation from a script and collapses
+// runs of blank lines and spaces. Line breaks are kept, since automatic
+// semicolon insertion depends on them, and so are strings, template
+// literals, regular expressions and /*! license banners.
+func MinifyJS(data []byte) []byte {
+	var out bytes.Buffer
+	space := false
+	// prev is the last character written other than whitespace, which
+	// tells a regular expression from a division
+	var prev byte
+	var word []byte
+	lineStart := true
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end == -1 {
+				end = len(data)
+			} else {
+				end += i + 4
+			}
+			if i+2 < len(data) && data[i+2] == '!' {
+				writeJS(&out, &space, &lineStart, data[i:end])
+			} else if bytes.IndexByte(data[i:end], '\n') != -1 && !lineStart {
+				// A comment spanning lines counts as a line break
+				out.WriteByte('\n')
+				lineStart = true
+			} else {
+				space = true
+			}
+			i = end - 1
+		case c == '\n' || c == '\r':
+			space = false
+			if !lineStart {
+				out.WriteByte('\n')
+				lineStart = true
+			}
+		case isSpace(c):
+			space = true
+		case c == '"' || c == '\'':
+			end := quotedEnd(data, i)
+			writeJS(&out, &space, &lineStart, data[i:end])
+			prev, word = c, nil
+			i = end - 1
+		case c == '`':
+			end := templateEnd(data, i)
+			writeJS(&out, &space, &lineStart, data[i:end])
+			prev, word = c, nil
+			i = end - 1
+		case c == '/' && regexAllowed(prev, word):
+			end := regexEnd(data, i)
+			writeJS(&out, &space, &lineStart, data[i:end])
+			prev, word = '/', nil
+			i = end - 1
+		default:
+			writeJS(&out, &space, &lineStart, data[i:i+1])
+			if isWordByte(c) {
+				if !isWordByte(prev) {
+					word = word[:0]
+				}
+				word = append(word, c)
+			} else {
+				word = nil
+			}
+			prev = c
+		}
+	}
+	return bytes.TrimSpace(out.Bytes())
+}
+
+// writeJS writes a token after a pending space, dropping indentation
+func writeJS(out *bytes.Buffer, space, lineStart *bool, token []byte) {
+	if *space && !*lineStart {
+		out.WriteByte(' ')
+	}
+	out.Write(token)
+	*space, *lineStart = false, false
+}
+
+// regexAllowed reports whether a slash after prev starts a regular
+// expression rather than a division
+func regexAllowed(prev byte, word []byte) bool {
+	if prev == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", prev) != -1 {
+		return true
+	}
+	switch string(word) {
+	case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else", "yield", "await":
+		return isWordByte(prev)
+	}
+	return false
+}
+
+// quotedEnd returns the index after the string starting at data[start]
+func quotedEnd(data []byte, start int) int {
+	quote := data[start]
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		}
+	}
+	return len(data)
+}
+
+// templateEnd returns the index after the template literal starting at
+// data[start], skipping over the expressions it interpolates
+func templateEnd(data []byte, start int) int {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '`':
+			return i + 1
+		case '$':
+			if i+1 < len(data) && data[i+1] == '{' {
+				depth := 0
+				for i++; i < len(data); i++ {
+					switch data[i] {
+					case '{':
+						depth++
+					case '}':
+						depth--
+					case '"', '\'':
+						i = quotedEnd(data, i) - 1
+					case '`':
+						i = templateEnd(data, i) - 1
+					}
+					if depth == 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+	return len(data)
+}
+
+// regexEnd returns the index after the regular expression literal starting
+// at data[start], including its flags
+func regexEnd(data []byte, start int) int {
+	class := false
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '\n':
+			return i
+		case '/':
+			if !class {
+				for i++; i < len(data) && isWordByte(data[i]); i++ {
+				}
+				return i
+			}
+		}
+	}
+	return len(data)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
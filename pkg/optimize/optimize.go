@@ -0,0 +1,336 @@
+// Package optimize shrinks the assets of LIV documents: it recompresses PNG
+// and JPEG images, adds lossless WebP renditions as variants with the
+// original as fallback, minifies stylesheets and scripts, and strips the
+// glyphs a document never uses from its TrueType fonts.
+package optimize
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+// Stage is one kind of optimization
+type Stage string
+
+const (
+	// StageImages recompresses PNG and JPEG images
+	StageImages Stage = "images"
+	// StageWebP adds WebP renditions of PNG and JPEG images
+	StageWebP Stage = "webp"
+	// StageAVIF adds AVIF renditions; no encoder is available yet
+	StageAVIF Stage = "avif"
+	// StageMinify minifies stylesheets and scripts
+	StageMinify Stage = "minify"
+	// StageFonts subsets fonts to the glyphs the document uses
+	StageFonts Stage = "fonts"
+)
+
+// DefaultQuality is the JPEG quality images are recompressed to
+const DefaultQuality = 82
+
+// AllStages are the stages "all" enables
+var AllStages = []Stage{StageImages, StageWebP, StageMinify, StageFonts}
+
+// ParseStages parses a comma-separated list of stages, or "all"
+func ParseStages(list string) ([]Stage, error) {
+	var stages []Stage
+	for _, name := range strings.Split(list, ",") {
+		switch stage := Stage(strings.ToLower(strings.TrimSpace(name))); stage {
+		case "":
+		case "all":
+			stages = append(stages, AllStages...)
+		case StageImages, StageWebP, StageMinify, StageFonts:
+			stages = append(stages, stage)
+		case StageAVIF:
+			return nil, fmt.Errorf("AVIF renditions are not supported: no AVIF encoder is available (use webp)")
+		default:
+			return nil, fmt.Errorf("unknown optimization stage: %s (expected images, webp, minify, fonts or all)", name)
+		}
+	}
+	return stages, nil
+}
+
+// Config is a build configuration file. Only its optimize section is read
+// here:
+//
+//	{"optimize": {"quality": 85,
+//	  "exclude": ["assets/images/signature.png"],
+//	  "skip": {"assets/fonts/*": ["fonts"]}}}
+type Config struct {
+	Optimize AssetConfig `json:"optimize"`
+}
+
+// AssetConfig opts assets out of optimization
+type AssetConfig struct {
+	// Quality overrides the JPEG quality
+	Quality int `json:"quality,omitempty"`
+	// Exclude lists paths or path.Match patterns left untouched
+	Exclude []string `json:"exclude,omitempty"`
+	// Skip maps paths or patterns to the stages not applied to them
+	Skip map[string][]Stage `json:"skip,omitempty"`
+}
+
+// LoadConfig reads a build configuration file
+func LoadConfig(filePath string) (*Config, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build config: %v", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid build config: %v", err)
+	}
+	if err := config.Optimize.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid build config: %v", err)
+	}
+	return &config, nil
+}
+
+// Validate checks the quality, stages and patterns of the settings
+func (c AssetConfig) Validate() error {
+	if c.Quality < 0 || c.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	patterns := c.Exclude
+	for pattern, stages := range c.Skip {
+		patterns = append(patterns, pattern)
+		for _, stage := range stages {
+			if _, err := ParseStages(string(stage)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Options selects the optimizations applied to a document
+type Options struct {
+	Stages []Stage
+	// Quality is the JPEG quality, DefaultQuality when zero
+	Quality int
+	// Assets opts assets out
+	Assets AssetConfig
+}
+
+// enabled reports whether stage applies to the asset at filePath
+func (o Options) enabled(stage Stage, filePath string) bool {
+	found := false
+	for _, s := range o.Stages {
+		if s == stage {
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+	for _, pattern := range o.Assets.Exclude {
+		if matches(pattern, filePath) {
+			return false
+		}
+	}
+	for pattern, stages := range o.Assets.Skip {
+		if !matches(pattern, filePath) {
+			continue
+		}
+		for _, s := range stages {
+			if Stage(strings.ToLower(string(s))) == stage {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// quality returns the JPEG quality to recompress to
+func (o Options) quality() int {
+	switch {
+	case o.Assets.Quality > 0:
+		return o.Assets.Quality
+	case o.Quality > 0:
+		return o.Quality
+	default:
+		return DefaultQuality
+	}
+}
+
+// matches reports whether a pattern names filePath. Patterns without a
+// slash match the file name in any directory.
+func matches(pattern, filePath string) bool {
+	if ok, _ := path.Match(pattern, filePath); ok {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(filePath))
+		return ok
+	}
+	return false
+}
+
+// Result is one optimization applied to an asset
+type Result struct {
+	Path   string
+	Stage  Stage
+	Before int
+	After  int
+	// Added is the path of a new rendition, for the webp stage
+	Added string
+}
+
+// Skipped is an asset an optimization was not applied to, and why
+type Skipped struct {
+	Path   string
+	Stage  Stage
+	Reason string
+}
+
+// Report collects what Optimize did
+type Report struct {
+	Results []*Result
+	Skipped []*Skipped
+}
+
+// Saved returns the bytes saved on assets that were replaced. Added
+// renditions are not counted.
+func (r *Report) Saved() int {
+	saved := 0
+	for _, result := range r.Results {
+		if result.Added == "" {
+			saved += result.Before - result.After
+		}
+	}
+	return saved
+}
+
+// Optimize applies the enabled stages to the resources of a document,
+// replacing files in place and updating the manifest's hashes and sizes.
+// An optimization is only kept when it makes the asset smaller.
+func Optimize(files map[string][]byte, manifest *core.Manifest, opts Options) *Report {
+	report := &Report{}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+
+	// Variants cannot have variants of their own
+	isVariant := make(map[string]bool)
+	for _, resource := range manifest.Resources {
+		for _, variant := range resource.Variants {
+			if variant != nil {
+				isVariant[variant.Path] = true
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(manifest.Resources))
+	for resourcePath := range manifest.Resources {
+		if _, exists := files[resourcePath]; exists && resourcePath != "manifest.json" {
+			paths = append(paths, resourcePath)
+		}
+	}
+	sort.Strings(paths)
+
+	var text map[rune]bool
+	replace := func(resourcePath string, stage Stage, data []byte) {
+		report.Results = append(report.Results, &Result{Path: resourcePath, Stage: stage, Before: len(files[resourcePath]), After: len(data)})
+		files[resourcePath] = data
+		resource := manifest.Resources[resourcePath]
+		resource.Hash = hasher.HashBytes(data)
+		resource.Size = int64(len(data))
+	}
+	skip := func(resourcePath string, stage Stage, reason string) {
+		report.Skipped = append(report.Skipped, &Skipped{Path: resourcePath, Stage: stage, Reason: reason})
+	}
+
+	for _, resourcePath := range paths {
+		data := files[resourcePath]
+		switch strings.ToLower(path.Ext(resourcePath)) {
+		case ".png", ".jpg", ".jpeg":
+			if opts.enabled(StageImages, resourcePath) {
+				smaller, err := recompressImage(data, opts.quality())
+				switch {
+				case err != nil:
+					skip(resourcePath, StageImages, err.Error())
+				case len(smaller) < len(data):
+					replace(resourcePath, StageImages, smaller)
+				}
+			}
+			if opts.enabled(StageWebP, resourcePath) && !isVariant[resourcePath] {
+				if err := addWebP(files, manifest, resourcePath, hasher, report); err != nil {
+					skip(resourcePath, StageWebP, err.Error())
+				}
+			}
+		case ".css", ".js", ".mjs":
+			if !opts.enabled(StageMinify, resourcePath) {
+				continue
+			}
+			var minified []byte
+			if strings.EqualFold(path.Ext(resourcePath), ".css") {
+				minified = MinifyCSS(data)
+			} else {
+				minified = MinifyJS(data)
+			}
+			if len(minified) < len(data) {
+				replace(resourcePath, StageMinify, minified)
+			}
+		case ".ttf", ".otf":
+			if !opts.enabled(StageFonts, resourcePath) {
+				continue
+			}
+			if text == nil {
+				text = usedRunes(files)
+			}
+			subset, err := SubsetFont(data, text)
+			switch {
+			case err != nil:
+				skip(resourcePath, StageFonts, err.Error())
+			case len(subset) < len(data):
+				replace(resourcePath, StageFonts, subset)
+			}
+		}
+	}
+
+	return report
+}
+
+// addWebP stores a lossless WebP rendition of an image next to it and lists
+// it as a variant, when it is smaller than the image
+func addWebP(files map[string][]byte, manifest *core.Manifest, resourcePath string, hasher *integrity.ResourceHasher, report *Report) error {
+	resource := manifest.Resources[resourcePath]
+	for _, variant := range resource.Variants {
+		if variant != nil && variant.Type == "image/webp" {
+			return nil
+		}
+	}
+	webpPath := resourcePath + ".webp"
+	if _, exists := files[webpPath]; exists {
+		return fmt.Errorf("%s already exists", webpPath)
+	}
+
+	data, err := encodeWebP(files[resourcePath])
+	if err != nil {
+		return err
+	}
+	if len(data) >= len(files[resourcePath]) {
+		return nil
+	}
+
+	files[webpPath] = data
+	manifest.Resources[webpPath] = &core.Resource{
+		Hash: hasher.HashBytes(data),
+		Size: int64(len(data)),
+		Type: "image/webp",
+		Path: webpPath,
+	}
+	resource.Variants = append(resource.Variants, &core.ResourceVariant{Path: webpPath, Type: "image/webp"})
+	report.Results = append(report.Results, &Result{Path: resourcePath, Stage: StageWebP, Before: len(files[resourcePath]), After: len(data), Added: webpPath})
+	return nil
+}
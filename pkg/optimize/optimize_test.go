@@ -0,0 +1,257 @@
+package optimize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages("all")
+	if err != nil || len(stages) != len(AllStages) {
+		t.Errorf("Expected all stages, got %v: %v", stages, err)
+	}
+	if stages, err := ParseStages("images, Minify"); err != nil || len(stages) != 2 || stages[1] != StageMinify {
+		t.Errorf("Unexpected stages %v: %v", stages, err)
+	}
+	for _, invalid := range []string{"avif", "images,gzip"} {
+		if _, err := ParseStages(invalid); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "liv-build.json")
+	os.WriteFile(configFile, []byte(`{"optimize": {"quality": 90, "exclude": ["logo.png"], "skip": {"assets/fonts/*": ["fonts"]}}}`), 0644)
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	opts := Options{Stages: AllStages, Quality: 70, Assets: config.Optimize}
+	if opts.quality() != 90 {
+		t.Errorf("Expected the config quality to win, got %d", opts.quality())
+	}
+	if opts.enabled(StageImages, "assets/images/logo.png") || !opts.enabled(StageImages, "assets/images/photo.png") {
+		t.Errorf("Expected excluded file names to match in any directory")
+	}
+	if opts.enabled(StageFonts, "assets/fonts/body.ttf") || !opts.enabled(StageMinify, "assets/fonts/body.ttf") {
+		t.Errorf("Expected only the skipped stage to be disabled")
+	}
+
+	for _, invalid := range []string{
+		`{"optimize": {"quality": 120}}`,
+		`{"optimize": {"skip": {"*.png": ["avif"]}}}`,
+		`{"optimize": {"exclude": ["[a-"]}}`,
+	} {
+		os.WriteFile(configFile, []byte(invalid), 0644)
+		if _, err := LoadConfig(configFile); err == nil {
+			t.Errorf("Expected %s to be refused", invalid)
+		}
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	css := `/*! Theme v1.0 | MIT */
+/* layout */
+body ,  p > a {
+  margin : 0 auto;
+  font-family: "Open  Sans", sans-serif;
+}
+nav :hover { color: red; }
+`
+	expected := "/*! Theme v1.0 | MIT */\nbody,p>a{margin :0 auto;font-family:\"Open  Sans\",sans-serif}nav :hover{color:red}"
+	if got := string(MinifyCSS([]byte(css))); got != expected {
+		t.Errorf("Unexpected CSS:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	js := "/*! lib v2.1.0 */\n" +
+		"// setup\n" +
+		"function f(a,  b) {\n" +
+		"    var url = \"http://example.com\" // home\n" +
+		"    var re = /\\/\\/[\"']/g\n" +
+		"    return a / b /* ratio */ + `x // ${ {a: 1}.a } y`\n" +
+		"}\n\n\n" +
+		"f(1, 2)\n"
+	expected := "/*! lib v2.1.0 */\n" +
+		"function f(a, b) {\n" +
+		"var url = \"http://example.com\"\n" +
+		"var re = /\\/\\/[\"']/g\n" +
+		"return a / b + `x // ${ {a: 1}.a } y`\n" +
+		"}\n" +
+		"f(1, 2)"
+	if got := string(MinifyJS([]byte(js))); got != expected {
+		t.Errorf("Unexpected JS:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+// uncompressedPNG encodes a flat image without compression
+func uncompressedPNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: 128, B: 64, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	encoder := &png.Encoder{CompressionLevel: png.NoCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOptimize(t *testing.T) {
+	photo := uncompressedPNG(t)
+	rights := append(append([]byte{}, photo...), []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:cc="http://creativecommons.org/ns#" cc:license="https://creativecommons.org/licenses/by/4.0/"/></rdf:RDF></x:xmpmeta>`)...)
+	files := map[string][]byte{
+		"manifest.json":            []byte("{}"),
+		"content/index.html":       []byte("<p>Hello</p>"),
+		"content/styles/main.css":  []byte("p {\n  color: red;\n}\n"),
+		"content/scripts/app.js":   []byte("// app\nvar x = 1\n"),
+		"assets/images/photo.png":  photo,
+		"assets/images/rights.png": rights,
+		"assets/images/logo.png":   photo,
+	}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	manifest := &core.Manifest{Resources: map[string]*core.Resource{}}
+	for path, data := range files {
+		if path != "manifest.json" {
+			manifest.Resources[path] = &core.Resource{Hash: hasher.HashBytes(data), Size: int64(len(data)), Type: "application/octet-stream", Path: path}
+		}
+	}
+
+	report := Optimize(files, manifest, Options{
+		Stages: AllStages,
+		Assets: AssetConfig{Exclude: []string{"logo.png"}},
+	})
+
+	for path, resource := range manifest.Resources {
+		if resource.Hash != hasher.HashBytes(files[path]) || resource.Size != int64(len(files[path])) {
+			t.Errorf("Expected the manifest entry of %s to match its content", path)
+		}
+	}
+	if len(files["assets/images/photo.png"]) >= len(photo) {
+		t.Errorf("Expected the PNG to be recompressed")
+	}
+	if !bytes.Equal(files["assets/images/logo.png"], photo) || !bytes.Equal(files["assets/images/rights.png"], rights) {
+		t.Errorf("Expected excluded images and images with rights metadata to be left alone")
+	}
+	if string(files["content/styles/main.css"]) != "p{color:red}" || string(files["content/scripts/app.js"]) != "var x = 1" {
+		t.Errorf("Expected stylesheets and scripts to be minified")
+	}
+	variants := manifest.Resources["assets/images/photo.png"].Variants
+	if len(variants) != 1 || variants[0].Type != "image/webp" || manifest.Resources["assets/images/photo.png.webp"] == nil {
+		t.Errorf("Expected the WebP rendition to be listed as a variant: %+v", variants)
+	}
+	if !bytes.HasPrefix(files["assets/images/photo.png.webp"], []byte("RIFF")) {
+		t.Errorf("Expected a WebP image")
+	}
+
+	skipped := false
+	for _, s := range report.Skipped {
+		if s.Path == "assets/images/rights.png" && s.Stage == StageImages {
+			skipped = true
+		}
+	}
+	if !skipped || report.Saved() <= 0 {
+		t.Errorf("Unexpected report: saved %d, skipped %+v", report.Saved(), report.Skipped)
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00")
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, byte(len(segment) + 2)}
+	jpeg = append(append(jpeg, segment...), 0xFF, 0xD9)
+	if orientation := exifOrientation(jpeg); orientation != 6 {
+		t.Errorf("Expected orientation 6, got %d", orientation)
+	}
+	if _, err := recompressImage(jpeg, DefaultQuality); err == nil {
+		t.Errorf("Expected rotated images to be refused")
+	}
+}
+
+// testFont builds a TrueType font mapping A, B and C to glyphs 1 to 3, where
+// C is a composite of B, and with an unmapped glyph 4
+func testFont(fsType uint16) []byte {
+	simple := func(fill byte) []byte {
+		glyph := []byte{0, 1, 0, 0, 0, 0, 0, 10, 0, 10}
+		return append(glyph, bytes.Repeat([]byte{fill}, 30)...)
+	}
+	composite := []byte{0xFF, 0xFF, 0, 0, 0, 0, 0, 10, 0, 10, 0, 0, 0, 2, 0, 0}
+	glyphs := [][]byte{simple(0), simple(1), simple(2), composite, simple(4)}
+
+	var glyf []byte
+	loca := make([]byte, 2*(len(glyphs)+1))
+	for i, glyph := range glyphs {
+		binary.BigEndian.PutUint16(loca[2*i:], uint16(len(glyf)/2))
+		glyf = append(glyf, glyph...)
+	}
+	binary.BigEndian.PutUint16(loca[2*len(glyphs):], uint16(len(glyf)/2))
+
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint32(head[12:], 0x5F0F3CF5)
+	maxp := make([]byte, 6)
+	binary.BigEndian.PutUint32(maxp, 0x00005000)
+	binary.BigEndian.PutUint16(maxp[4:], uint16(len(glyphs)))
+	os2 := make([]byte, 78)
+	binary.BigEndian.PutUint16(os2[8:], fsType)
+
+	// Format 4: 'A'-'C' map to 1-3 by a delta of -64, then the end segment
+	subtable := []byte{0, 4, 0, 32, 0, 0, 0, 4, 0, 4, 0, 1, 0, 0,
+		0, 'C', 0xFF, 0xFF, 0, 0, 0, 'A', 0xFF, 0xFF, 0xFF, 0xC0, 0, 1, 0, 0, 0, 0}
+	cmap := append([]byte{0, 0, 0, 1, 0, 3, 0, 1, 0, 0, 0, 12}, subtable...)
+
+	font := &sfnt{
+		version: 0x00010000,
+		tags:    []string{"OS/2", "cmap", "glyf", "head", "loca", "maxp"},
+		tables:  map[string][]byte{"OS/2": os2, "cmap": cmap, "glyf": glyf, "head": head, "loca": loca, "maxp": maxp},
+	}
+	return font.encode()
+}
+
+func TestSubsetFont(t *testing.T) {
+	data := testFont(0)
+	subset, err := SubsetFont(data, map[rune]bool{'C': true})
+	if err != nil {
+		t.Fatalf("SubsetFont failed: %v", err)
+	}
+	if len(subset) >= len(data) {
+		t.Errorf("Expected the subset to be smaller: %d >= %d", len(subset), len(data))
+	}
+	if checksum(subset) != checksumMagic {
+		t.Errorf("Expected the font checksum to be adjusted")
+	}
+
+	font, err := parseSFNT(subset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets, err := readLoca(font.tables["loca"], 5, false, len(font.tables["glyf"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// .notdef, B as a component of C, C and the unmapped glyph stay
+	for glyph, kept := range []bool{true, false, true, true, true} {
+		if empty := offsets[glyph] == offsets[glyph+1]; empty == kept {
+			t.Errorf("Expected glyph %d kept=%v", glyph, kept)
+		}
+	}
+
+	if _, err := SubsetFont(testFont(0x0100), map[rune]bool{'C': true}); err == nil {
+		t.Errorf("Expected fonts that forbid subsetting to be refused")
+	}
+}
@@ -0,0 +1,111 @@
+package pdfops
+
+import (
+	"golang.org/x/text/encoding/charmap"
+)
+
+// fontID identifies one of the standard PDF fonts used by the native renderer.
+// Standard fonts need no embedding, which keeps rendered files small.
+type fontID int
+
+const (
+	fontRegular fontID = iota
+	fontBold
+	fontItalic
+	fontBoldItalic
+	fontMono
+	fontMonoBold
+)
+
+// baseFonts are the PostScript names of the fonts, indexed by fontID
+var baseFonts = [...]string{
+	"Helvetica",
+	"Helvetica-Bold",
+	"Helvetica-Oblique",
+	"Helvetica-BoldOblique",
+	"Courier",
+	"Courier-Bold",
+}
+
+// helveticaWidths are the Adobe font metrics of Helvetica for the printable ASCII
+// range, in thousandths of the font size. Oblique shares the upright widths.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// helveticaBoldWidths are the Adobe font metrics of Helvetica-Bold for the
+// printable ASCII range
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// charWidth returns the width of a WinAnsi-encoded character in thousandths of
+// the font size
+func charWidth(font fontID, c byte) int {
+	if font == fontMono || font == fontMonoBold {
+		return 600
+	}
+
+	bold := font == fontBold || font == fontBoldItalic
+	if c >= 32 && c <= 126 {
+		if bold {
+			return helveticaBoldWidths[c-32]
+		}
+		return helveticaWidths[c-32]
+	}
+
+	switch c {
+	case 0x85, 0x97: // ellipsis, em dash
+		return 1000
+	case 0x95: // bullet
+		return 350
+	case 0x91, 0x92: // single quotes
+		if bold {
+			return 278
+		}
+		return 222
+	case 0x93, 0x94: // double quotes
+		if bold {
+			return 500
+		}
+		return 333
+	case 0xA0: // no-break space
+		return 278
+	}
+	if bold {
+		return 611
+	}
+	return 556
+}
+
+// encodeWinAnsi converts text to the WinAnsi encoding of the standard fonts.
+// Characters outside the encoding are replaced with a question mark.
+func encodeWinAnsi(text string) string {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch r {
+		case '\t':
+			encoded = append(encoded, ' ')
+			continue
+		case '‐', '‑', '−': // hyphen variants and minus
+			encoded = append(encoded, '-')
+			continue
+		}
+		if b, ok := charmap.Windows1252.EncodeRune(r); ok && b >= 32 {
+			encoded = append(encoded, b)
+		} else {
+			encoded = append(encoded, '?')
+		}
+	}
+	return string(encoded)
+}
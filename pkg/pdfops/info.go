@@ -0,0 +1,132 @@
+package pdfops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+var (
+	startXrefPattern = regexp.MustCompile(`startxref\s+(\d+)`)
+	rootPattern      = regexp.MustCompile(`/Root\s+(\d+\s+\d+\s+R)`)
+	sizePattern      = regexp.MustCompile(`/Size\s+(\d+)`)
+	idPattern        = regexp.MustCompile(`/ID\s*\[[^\]]*\]`)
+	infoKeyPattern   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+)
+
+// AppendDocumentInfo writes a new document information dictionary to a PDF using an
+// incremental update. The original bytes are left untouched, so the update works on
+// files produced by any writer and without re-encoding pages. Keys are used verbatim
+// as PDF names (for example "Title" or "License").
+func AppendDocumentInfo(path string, info map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	matches := startXrefPattern.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return fmt.Errorf("PDF has no cross-reference offset")
+	}
+	prevXref, err := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if err != nil || prevXref >= len(data) {
+		return fmt.Errorf("PDF has an invalid cross-reference offset")
+	}
+
+	// The trailer is either a classic trailer dictionary or the dictionary of a
+	// cross-reference stream at the last xref offset
+	trailer := data[prevXref:]
+	if idx := bytes.LastIndex(data, []byte("trailer")); idx > prevXref {
+		trailer = data[idx:]
+	}
+	if end := bytes.Index(trailer, []byte("startxref")); end != -1 {
+		trailer = trailer[:end]
+	}
+
+	root := rootPattern.FindSubmatch(trailer)
+	size := sizePattern.FindSubmatch(trailer)
+	if root == nil || size == nil {
+		return fmt.Errorf("PDF trailer is missing /Root or /Size")
+	}
+	objectNumber, err := strconv.Atoi(string(size[1]))
+	if err != nil {
+		return fmt.Errorf("PDF trailer has an invalid /Size: %w", err)
+	}
+
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		if !infoKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid document info key: %s", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var update bytes.Buffer
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		update.WriteByte('\n')
+	}
+
+	objectOffset := len(data) + update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n<<", objectNumber)
+	for _, key := range keys {
+		fmt.Fprintf(&update, " /%s %s", key, encodeTextString(info[key]))
+	}
+	update.WriteString(" >>\nendobj\n")
+
+	xrefOffset := len(data) + update.Len()
+	fmt.Fprintf(&update, "xref\n%d 1\n%010d 00000 n \n", objectNumber, objectOffset)
+	fmt.Fprintf(&update, "trailer\n<< /Size %d /Root %s /Info %d 0 R /Prev %d", objectNumber+1, root[1], objectNumber, prevXref)
+	if id := idPattern.Find(trailer); id != nil {
+		update.WriteString(" ")
+		update.Write(id)
+	}
+	fmt.Fprintf(&update, " >>\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open PDF for update: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(update.Bytes()); err != nil {
+		return fmt.Errorf("failed to write document info: %w", err)
+	}
+	return nil
+}
+
+// encodeTextString encodes a PDF text string, using UTF-16BE for non-ASCII text
+func encodeTextString(value string) string {
+	ascii := true
+	for _, r := range value {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		var b bytes.Buffer
+		b.WriteByte('(')
+		for i := 0; i < len(value); i++ {
+			if c := value[i]; c == '(' || c == ')' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(value[i])
+		}
+		b.WriteByte(')')
+		return b.String()
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(value)) {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package pdfops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rsc.io/pdf"
+)
+
+// writeMinimalPDF writes a single-page PDF with a classic cross-reference table
+func writeMinimalPDF(t *testing.T, path string) {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+		"<< /Producer (Test) >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write test PDF: %v", err)
+	}
+}
+
+func TestAppendDocumentInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pdf")
+	writeMinimalPDF(t, path)
+
+	info := map[string]string{
+		"Title":   "Quarterly (Draft)",
+		"Author":  "Zoë",
+		"License": "CC-BY-4.0",
+	}
+	if err := AppendDocumentInfo(path, info); err != nil {
+		t.Fatalf("Failed to append document info: %v", err)
+	}
+
+	reader, err := pdf.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open updated PDF: %v", err)
+	}
+
+	if reader.NumPage() != 1 {
+		t.Errorf("Expected 1 page, got %d", reader.NumPage())
+	}
+
+	docInfo := reader.Trailer().Key("Info")
+	for key, want := range info {
+		if got := docInfo.Key(key).Text(); got != want {
+			t.Errorf("Info /%s = %q, want %q", key, got, want)
+		}
+	}
+	if docInfo.Key("Producer").Kind() != pdf.Null {
+		t.Error("Expected the previous info dictionary to be replaced")
+	}
+
+	if err := AppendDocumentInfo(path, map[string]string{"Bad Key": "x"}); err == nil {
+		t.Error("Expected invalid key to be rejected")
+	}
+}
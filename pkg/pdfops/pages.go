@@ -0,0 +1,331 @@
+package pdfops
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cover is the cover page of a rendered PDF
+type Cover struct {
+	Title       string
+	Author      string
+	Date        string
+	Description string
+	// Image is a PNG, JPEG or GIF shown above the title
+	Image []byte
+}
+
+// contentsLevels are the heading levels listed in the table of contents and
+// the document outline
+const contentsLevels = 3
+
+var (
+	runningStyle  = textStyle{size: 9, color: [3]float64{0.4, 0.4, 0.4}}
+	contentsEntry = 18.0
+	contentsLevel = 14.0
+	coverImage    = "\x00cover"
+)
+
+// heading is a heading laid out in the document, for the table of contents
+// and the outline
+type heading struct {
+	level int
+	text  string
+	// page is the index of the page it starts on and y its top
+	page int
+	y    float64
+}
+
+// outlineItem is a bookmark of the document outline
+type outlineItem struct {
+	heading  *heading
+	parent   *outlineItem
+	children []*outlineItem
+}
+
+// addHeading records a heading about to be drawn at the current position
+func (r *renderer) addHeading(level int, text string) {
+	text = strings.TrimSpace(whitespaceRun.ReplaceAllString(text, " "))
+	if text == "" || level > contentsLevels {
+		return
+	}
+	r.headings = append(r.headings, &heading{level: level, text: text, page: len(r.pages) - 1, y: r.y})
+}
+
+// frontMatter puts the cover and table of contents in front of the pages laid
+// out, then draws the running headers and footers
+func (r *renderer) frontMatter() {
+	content := r.pages
+	var front []*page
+	if r.opts.Cover != nil {
+		front = append(front, r.cover(r.opts.Cover))
+	}
+	contents := r.opts.TableOfContents && len(r.headings) > 0
+	if contents {
+		placed := r.placeContents()
+		offset := len(front) + placed[len(placed)-1].page + 1
+		for _, h := range r.headings {
+			h.page += offset
+		}
+		front = append(front, r.contents(placed, len(front))...)
+		r.outline = buildOutline(r.headings)
+	}
+	r.pages = append(front, content...)
+
+	for i, p := range r.pages {
+		if i == 0 && r.opts.Cover != nil {
+			continue
+		}
+		r.page = p
+		r.running(r.opts.Header, i+1, r.opts.PageHeight-r.opts.MarginTop/2+runningStyle.size/3)
+		r.running(r.opts.Footer, i+1, r.opts.MarginBottom/2-runningStyle.size/3)
+	}
+}
+
+// cover lays out the cover page: the image, then the title, author, date and
+// description centred on the page
+func (r *renderer) cover(c *Cover) *page {
+	p := &page{}
+	r.page = p
+	r.y = r.top()
+	width := r.right() - r.left()
+
+	if len(c.Image) > 0 {
+		if img, err := r.embedImage(coverImage, c.Image); err == nil {
+			w, h := r.imageSize(img, blockContext{})
+			if limit := (r.top() - r.bottom()) * 0.45; h > limit {
+				w, h = w*limit/h, limit
+			}
+			r.checkResolution(img, w, h)
+			fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", w, h, r.left()+(width-w)/2, r.y-h, img.name)
+			r.y -= h + 36
+		}
+	}
+	if len(c.Image) == 0 {
+		// Without an image the title sits a third of the way down
+		r.y -= (r.top() - r.bottom()) / 3
+	}
+
+	title := textStyle{bold: true, size: 28}
+	r.centred(c.Title, title, width)
+	r.y -= 12
+	r.centred(c.Author, textStyle{size: 14}, width)
+	r.centred(c.Date, textStyle{size: 11, color: quoteColor}, width)
+	r.y -= 24
+	r.centred(c.Description, textStyle{size: 11, italic: true, color: quoteColor}, width*0.8)
+	return p
+}
+
+// centred draws text wrapped to width and centred on the page
+func (r *renderer) centred(text string, style textStyle, width float64) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	for _, l := range wrap([]run{{text: text, style: style}}, width) {
+		height := l.size * lineSpacing
+		if r.y-height < r.bottom() {
+			return
+		}
+		r.drawWords(l.words, r.left()+(r.right()-r.left()-wordsWidth(l.words))/2, r.y-l.size*1.05)
+		r.y -= height
+	}
+}
+
+func wordsWidth(words []word) float64 {
+	width := 0.0
+	for i, w := range words {
+		if w.space && i > 0 {
+			width += w.style.width(" ")
+		}
+		width += w.width
+	}
+	return width
+}
+
+// placedEntry is an entry of the table of contents and where it is drawn:
+// the index of its page among the contents pages and its baseline
+type placedEntry struct {
+	heading  *heading
+	page     int
+	baseline float64
+}
+
+// placeContents lays out the table of contents without drawing it, so the
+// pages it takes are known before the page numbers are written
+func (r *renderer) placeContents() []placedEntry {
+	title := headingSizes[0] * lineSpacing * 1.5
+	page, y := 0, r.top()-title
+	placed := make([]placedEntry, 0, len(r.headings))
+	for _, h := range r.headings {
+		if y-contentsEntry < r.bottom() {
+			page, y = page+1, r.top()
+		}
+		placed = append(placed, placedEntry{heading: h, page: page, baseline: y - bodyStyle.size*1.05})
+		y -= contentsEntry
+	}
+	return placed
+}
+
+// contents draws the table of contents pages, linking each entry to its
+// heading. first is the index of the first contents page in the document.
+func (r *renderer) contents(placed []placedEntry, first int) []*page {
+	pages := make([]*page, placed[len(placed)-1].page+1)
+	for i := range pages {
+		pages[i] = &page{}
+	}
+	r.page = pages[0]
+	titleStyle := textStyle{bold: true, size: headingSizes[0]}
+	r.drawText("Contents", titleStyle, r.left(), r.top()-titleStyle.size*1.05)
+
+	numberWidth := bodyStyle.width("0000")
+	dots := encodeWinAnsi(" .")
+	for _, entry := range placed {
+		r.page = pages[entry.page]
+		style := bodyStyle
+		style.bold = entry.heading.level == 1
+		x := r.left() + float64(entry.heading.level-1)*contentsLevel
+		text := fitText(encodeWinAnsi(entry.heading.text), style, r.right()-numberWidth-x-style.width(dots))
+		number := strconv.Itoa(entry.heading.page + 1)
+
+		r.drawText(text, style, x, entry.baseline)
+		end := x + style.width(text)
+		numberX := r.right() - bodyStyle.width(number)
+		leader := textStyle{size: bodyStyle.size, color: quoteColor}
+		if count := int((numberX - end - 4) / leader.width(dots)); count > 0 {
+			leaders := strings.Repeat(dots, count)
+			r.drawText(leaders, leader, numberX-4-leader.width(leaders), entry.baseline)
+		}
+		r.drawText(number, bodyStyle, numberX, entry.baseline)
+		r.page.annots = append(r.page.annots, annotation{
+			rect: [4]float64{x, entry.baseline - bodyStyle.size*0.25, r.right(), entry.baseline + bodyStyle.size*0.8},
+			dest: entry.heading,
+		})
+	}
+	return pages
+}
+
+// fitText shortens WinAnsi text with an ellipsis to fit width
+func fitText(text string, style textStyle, width float64) string {
+	if style.width(text) <= width {
+		return text
+	}
+	ellipsis := encodeWinAnsi("…")
+	for len(text) > 0 && style.width(text)+style.width(ellipsis) > width {
+		text = text[:len(text)-1]
+	}
+	return strings.TrimRight(text, " ") + ellipsis
+}
+
+// running draws a running header or footer with its baseline at y. The
+// template's {title}, {author}, {page} and {pages} are replaced, and | splits
+// it into text aligned left and right, or left, centre and right.
+func (r *renderer) running(template string, number int, y float64) {
+	if template == "" {
+		return
+	}
+	text := strings.NewReplacer(
+		"{title}", r.opts.Title,
+		"{author}", r.opts.Author,
+		"{page}", strconv.Itoa(number),
+		"{pages}", strconv.Itoa(len(r.pages)),
+	).Replace(template)
+
+	parts := strings.Split(text, "|")
+	if len(parts) > 3 {
+		parts = append(parts[:2], strings.Join(parts[2:], "|"))
+	}
+	width := r.right() - r.left()
+	for i, part := range parts {
+		part = fitText(encodeWinAnsi(strings.TrimSpace(part)), runningStyle, width/float64(len(parts)))
+		if part == "" {
+			continue
+		}
+		x := r.left()
+		switch {
+		case len(parts) == 1 || (len(parts) == 3 && i == 1):
+			x += (width - runningStyle.width(part)) / 2
+		case i == len(parts)-1:
+			x = r.right() - runningStyle.width(part)
+		}
+		r.drawText(part, runningStyle, x, y)
+	}
+}
+
+// buildOutline nests headings into bookmarks by level
+func buildOutline(headings []*heading) []*outlineItem {
+	var roots, stack []*outlineItem
+	for _, h := range headings {
+		item := &outlineItem{heading: h}
+		for len(stack) > 0 && stack[len(stack)-1].heading.level >= h.level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, item)
+		} else {
+			item.parent = stack[len(stack)-1]
+			item.parent.children = append(item.parent.children, item)
+		}
+		stack = append(stack, item)
+	}
+	return roots
+}
+
+// outlineObjects returns the outline dictionary at rootID and its bookmarks,
+// numbered from rootID+1 in document order. pageRef returns the object
+// reference of a page.
+func outlineObjects(roots []*outlineItem, rootID int, pageRef func(index int) string) [][]byte {
+	ids := make(map[*outlineItem]int)
+	var order []*outlineItem
+	var number func(items []*outlineItem)
+	number = func(items []*outlineItem) {
+		for _, item := range items {
+			order = append(order, item)
+			ids[item] = rootID + len(order)
+			number(item.children)
+		}
+	}
+	number(roots)
+
+	// Bookmarks are open, so every descendant counts
+	var count func(items []*outlineItem) int
+	count = func(items []*outlineItem) int {
+		total := len(items)
+		for _, item := range items {
+			total += count(item.children)
+		}
+		return total
+	}
+
+	objects := [][]byte{[]byte(fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>",
+		ids[roots[0]], ids[roots[len(roots)-1]], count(roots)))}
+	for _, item := range order {
+		siblings := roots
+		parent := rootID
+		if item.parent != nil {
+			siblings = item.parent.children
+			parent = ids[item.parent]
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "<< /Title %s /Parent %d 0 R /Dest [%s /XYZ null %.2f null]",
+			encodeTextString(item.heading.text), parent, pageRef(item.heading.page), item.heading.y)
+		for i, sibling := range siblings {
+			if sibling != item {
+				continue
+			}
+			if i > 0 {
+				fmt.Fprintf(&b, " /Prev %d 0 R", ids[siblings[i-1]])
+			}
+			if i < len(siblings)-1 {
+				fmt.Fprintf(&b, " /Next %d 0 R", ids[siblings[i+1]])
+			}
+		}
+		if len(item.children) > 0 {
+			fmt.Fprintf(&b, " /First %d 0 R /Last %d 0 R /Count %d",
+				ids[item.children[0]], ids[item.children[len(item.children)-1]], count(item.children))
+		}
+		b.WriteString(" >>")
+		objects = append(objects, []byte(b.String()))
+	}
+	return objects
+}
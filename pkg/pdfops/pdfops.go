@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/liv-format/liv/pkg/atomicfile"
 	"github.com/unidoc/unipdf/v3/common"
 	"github.com/unidoc/unipdf/v3/creator"
 	"github.com/unidoc/unipdf/v3/extractor"
@@ -280,13 +281,7 @@ func (p *PDFOperations) CompressPDF(outputPath string) error {
 	}
 
 	// Optimizer removed in newer versions, just write directly
-	f, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer f.Close()
-
-	return pdfWriter.Write(f)
+	return writePDF(&pdfWriter, outputPath)
 }
 
 // EncryptPDF encrypts the PDF with a password
@@ -318,13 +313,7 @@ func (p *PDFOperations) EncryptPDF(password string, outputPath string) error {
 	ownerPass := []byte(password)
 	pdfWriter.Encrypt(userPass, ownerPass, nil)
 
-	f, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer f.Close()
-
-	return pdfWriter.Write(f)
+	return writePDF(&pdfWriter, outputPath)
 }
 
 // GetDocumentInfo retrieves PDF metadata
@@ -413,13 +402,7 @@ func (p *PDFOperations) SetDocumentInfo(info map[string]string, outputPath strin
 		}
 	*/
 
-	f, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer f.Close()
-
-	return pdfWriter.Write(f)
+	return writePDF(&pdfWriter, outputPath)
 }
 
 // ConvertToLIV converts a PDF to LIV format by extracting text and structure
@@ -468,3 +451,17 @@ func Init() {
 	// Configure logging level
 	common.SetLogger(common.NewConsoleLogger(common.LogLevelInfo))
 }
+
+// writePDF writes a PDF to outputPath, replacing it only once complete
+func writePDF(pdfWriter *model.PdfWriter, outputPath string) error {
+	f, err := atomicfile.Create(outputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	if err := pdfWriter.Write(f); err != nil {
+		return err
+	}
+	return f.Commit()
+}
@@ -0,0 +1,193 @@
+package pdfops
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"unicode/utf16"
+)
+
+// DefaultMinResolution is the effective resolution in pixels per inch below
+// which images are reported as too coarse for print
+const DefaultMinResolution = 300
+
+// PrintProfile is the ICC output profile of the printing condition a PDF is
+// prepared for
+type PrintProfile struct {
+	// ICC is the data of a CMYK output profile
+	ICC []byte
+	// Description is the profile's own description
+	Description string
+	// OutputCondition names the printing condition, such as "FOGRA39" or
+	// "CGATS TR 006"; the description when unset
+	OutputCondition string
+	// MinResolution is the effective resolution in pixels per inch below
+	// which images are reported; DefaultMinResolution when unset
+	MinResolution float64
+}
+
+// ParsePrintProfile reads an ICC profile, which must be a CMYK output profile
+func ParsePrintProfile(data []byte) (*PrintProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("not an ICC profile")
+	}
+	if space := string(data[16:20]); space != "CMYK" {
+		return nil, fmt.Errorf("ICC profile colour space is %s, not CMYK", strings.TrimSpace(space))
+	}
+	if class := string(data[12:16]); class != "prtr" {
+		return nil, fmt.Errorf("ICC profile is a %s profile, not an output profile", strings.TrimSpace(class))
+	}
+	profile := &PrintProfile{ICC: data, Description: profileDescription(data)}
+	return profile, nil
+}
+
+// version returns the major version of the profile
+func (p *PrintProfile) version() int {
+	if len(p.ICC) < 9 {
+		return 0
+	}
+	return int(p.ICC[8])
+}
+
+// condition returns the name of the printing condition
+func (p *PrintProfile) condition() string {
+	switch {
+	case p.OutputCondition != "":
+		return p.OutputCondition
+	case p.Description != "":
+		return p.Description
+	default:
+		return "Custom"
+	}
+}
+
+// profileDescription returns the text of the description tag of an ICC
+// profile, stored as a version 2 textDescription or a version 4
+// multiLocalizedUnicode
+func profileDescription(data []byte) string {
+	count := int(binary.BigEndian.Uint32(data[128:132]))
+	for i := 0; i < count && 132+12*(i+1) <= len(data); i++ {
+		entry := data[132+12*i:]
+		if string(entry[:4]) != "desc" {
+			continue
+		}
+		offset, size := int(binary.BigEndian.Uint32(entry[4:8])), int(binary.BigEndian.Uint32(entry[8:12]))
+		if offset < 0 || size < 12 || offset > len(data)-size {
+			return ""
+		}
+		tag := data[offset : offset+size]
+		switch string(tag[:4]) {
+		case "desc":
+			length := int(binary.BigEndian.Uint32(tag[8:12]))
+			if length < 0 || length > len(tag)-12 {
+				return ""
+			}
+			return strings.TrimRight(string(tag[12:12+length]), "\x00")
+		case "mluc":
+			if len(tag) < 28 {
+				return ""
+			}
+			length, start := int(binary.BigEndian.Uint32(tag[20:24])), int(binary.BigEndian.Uint32(tag[24:28]))
+			if start < 0 || length < 0 || start > len(tag)-length {
+				return ""
+			}
+			units := make([]uint16, length/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(tag[start+2*j:])
+			}
+			return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+		}
+	}
+	return ""
+}
+
+// cmykImage separates an image into CMYK with full grey component
+// replacement and compresses the samples. The output intent tells the
+// printer how the values are reproduced on the press.
+func cmykImage(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	row := make([]byte, 4*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.CMYKModel.Convert(img.At(x, y)).(color.CMYK)
+			i := 4 * (x - bounds.Min.X)
+			row[i], row[i+1], row[i+2], row[i+3] = c.C, c.M, c.Y, c.K
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// colour returns the operator setting the fill colour, or the stroke colour
+// when stroke is set. Colours are given in CMYK when printing to a profile.
+func (r *renderer) colour(c [3]float64, stroke bool) string {
+	if r.opts.PrintProfile == nil {
+		op := "rg"
+		if stroke {
+			op = "RG"
+		}
+		return fmt.Sprintf("%.3f %.3f %.3f %s", c[0], c[1], c[2], op)
+	}
+	op := "k"
+	if stroke {
+		op = "K"
+	}
+	k := 1 - max(c[0], c[1], c[2])
+	if k >= 1 {
+		return "0 0 0 1 " + op
+	}
+	return fmt.Sprintf("%.3f %.3f %.3f %.3f %s", (1-c[0]-k)/(1-k), (1-c[1]-k)/(1-k), (1-c[2]-k)/(1-k), k, op)
+}
+
+// checkResolution reports an image whose effective resolution at the size it
+// is drawn is too low for print. Each image is reported once.
+func (r *renderer) checkResolution(img *pdfImage, width, height float64) {
+	if r.opts.PrintProfile == nil || r.opts.Warn == nil || img.reported || width <= 0 || height <= 0 {
+		return
+	}
+	width, height = width*r.scale, height*r.scale
+	resolution := min(float64(img.width)/(width/72), float64(img.height)/(height/72))
+	if resolution >= r.opts.PrintProfile.MinResolution {
+		return
+	}
+	img.reported = true
+	name := img.src
+	if name == coverImage {
+		name = "cover image"
+	}
+	r.opts.Warn(fmt.Sprintf("%s is %.0f ppi at its printed size of %.1f x %.1f cm (%d x %d pixels); print needs %.0f ppi",
+		name, resolution, width/72*2.54, height/72*2.54, img.width, img.height, r.opts.PrintProfile.MinResolution))
+}
+
+// outputIntent returns the output intent of the catalog and the stream of the
+// profile at profileID
+func (p *PrintProfile) outputIntent(profileID int) (string, []byte, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(p.ICC)
+	if err := zw.Close(); err != nil {
+		return "", nil, fmt.Errorf("failed to compress ICC profile: %w", err)
+	}
+	var stream bytes.Buffer
+	fmt.Fprintf(&stream, "<< /N 4 /Filter /FlateDecode /Length %d >>\nstream\n", compressed.Len())
+	stream.Write(compressed.Bytes())
+	stream.WriteString("\nendstream")
+
+	intent := fmt.Sprintf(" /OutputIntents [<< /Type /OutputIntent /S /GTS_PDFX /OutputConditionIdentifier %s /DestOutputProfile %d 0 R",
+		encodeTextString(p.condition()), profileID)
+	if p.Description != "" {
+		intent += " /Info " + encodeTextString(p.Description)
+	}
+	return intent + " >>]", stream.Bytes(), nil
+}
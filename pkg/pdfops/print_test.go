@@ -0,0 +1,104 @@
+package pdfops
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testICCProfile builds the header and description tag of an ICC profile
+func testICCProfile(class, space, description string) []byte {
+	tag := append([]byte("desc\x00\x00\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(description)+1))...)
+	tag = append(append(tag, description...), 0)
+
+	data := make([]byte, 144)
+	data[8] = 2
+	copy(data[12:], class)
+	copy(data[16:], space)
+	copy(data[20:], "Lab ")
+	copy(data[36:], "acsp")
+	binary.BigEndian.PutUint32(data[128:], 1)
+	copy(data[132:], "desc")
+	binary.BigEndian.PutUint32(data[136:], uint32(len(data)))
+	binary.BigEndian.PutUint32(data[140:], uint32(len(tag)))
+	data = append(data, tag...)
+	binary.BigEndian.PutUint32(data[0:], uint32(len(data)))
+	return data
+}
+
+func TestParsePrintProfile(t *testing.T) {
+	profile, err := ParsePrintProfile(testICCProfile("prtr", "CMYK", "Coated FOGRA39"))
+	if err != nil {
+		t.Fatalf("ParsePrintProfile failed: %v", err)
+	}
+	if profile.Description != "Coated FOGRA39" || profile.condition() != "Coated FOGRA39" {
+		t.Errorf("Unexpected description %q", profile.Description)
+	}
+	if _, err := ParsePrintProfile(testICCProfile("mntr", "RGB ", "sRGB")); err == nil {
+		t.Error("Expected an RGB profile to be rejected")
+	}
+	if _, err := ParsePrintProfile(testICCProfile("scnr", "CMYK", "Scanner")); err == nil {
+		t.Error("Expected an input profile to be rejected")
+	}
+	if _, err := ParsePrintProfile([]byte("not a profile")); err == nil {
+		t.Error("Expected other data to be rejected")
+	}
+}
+
+func TestRenderHTMLPrintProfile(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := ParsePrintProfile(testICCProfile("prtr", "CMYK", "Coated FOGRA39"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.OutputCondition = "FOGRA39"
+
+	var warnings []string
+	reader := renderTestPDF(t, `<h1>Brochure</h1><p><img src="logo.png"></p><p><a href="https://example.com">Link</a></p><p><img src="logo.png"></p>`, RenderOptions{
+		TableOfContents: true,
+		PrintProfile:    profile,
+		LoadImage:       func(src string) ([]byte, error) { return encoded.Bytes(), nil },
+		Warn:            func(message string) { warnings = append(warnings, message) },
+	})
+
+	intents := reader.Trailer().Key("Root").Key("OutputIntents")
+	if intents.Len() != 1 {
+		t.Fatalf("Expected an output intent, got %v", intents)
+	}
+	intent := intents.Index(0)
+	if intent.Key("S").Name() != "GTS_PDFX" || intent.Key("OutputConditionIdentifier").Text() != "FOGRA39" || intent.Key("Info").Text() != "Coated FOGRA39" {
+		t.Errorf("Unexpected output intent %v", intent)
+	}
+	embedded, err := io.ReadAll(intent.Key("DestOutputProfile").Reader())
+	if err != nil || !bytes.Equal(embedded, profile.ICC) || intent.Key("DestOutputProfile").Key("N").Int64() != 4 {
+		t.Errorf("Expected the profile to be embedded, got %d bytes (%v)", len(embedded), err)
+	}
+
+	page := reader.Page(2)
+	xobjects := page.Resources().Key("XObject")
+	image := xobjects.Key(xobjects.Keys()[0])
+	if image.Key("ColorSpace").Name() != "DeviceCMYK" {
+		t.Errorf("Expected a CMYK image, got %v", image.Key("ColorSpace"))
+	}
+	if samples, err := io.ReadAll(image.Reader()); err != nil || len(samples) != 40*20*4 {
+		t.Errorf("Expected four samples a pixel, got %d bytes (%v)", len(samples), err)
+	}
+	content, err := io.ReadAll(page.V.Key("Contents").Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), " rg") || strings.Contains(string(content), " RG") || !strings.Contains(string(content), "0 0 0 1 k") {
+		t.Errorf("Expected colours in CMYK, got %s", content)
+	}
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "logo.png is 96 ppi") {
+		t.Errorf("Expected the low resolution image to be reported once, got %q", warnings)
+	}
+}
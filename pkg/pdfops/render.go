@@ -0,0 +1,1197 @@
+package pdfops
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Page sizes in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// RenderOptions configures the native HTML to PDF renderer
+type RenderOptions struct {
+	Title  string
+	Author string
+	// Subject and Keywords are written to the document information for
+	// search and cataloguing
+	Subject  string
+	Keywords string
+	// PageWidth and PageHeight default to A4 and Margin to one inch
+	PageWidth  float64
+	PageHeight float64
+	Margin     float64
+	// MarginTop, MarginRight, MarginBottom and MarginLeft override Margin
+	// for one side of the page
+	MarginTop    float64
+	MarginRight  float64
+	MarginBottom float64
+	MarginLeft   float64
+	// ImageQuality is the JPEG quality of embedded images (1-100)
+	ImageQuality int
+	// LoadImage returns the bytes of an image referenced by the document.
+	// Images are replaced by their alt text when it is nil or fails.
+	LoadImage func(src string) ([]byte, error)
+	// Interrupt is checked before each block. When it returns an error the
+	// pages laid out so far are written, ending with a note that the document
+	// is incomplete, and RenderHTML returns the error.
+	Interrupt func() error
+	// Header and Footer are drawn in the top and bottom margins of every page
+	// but the cover. {title}, {author}, {page} and {pages} are replaced, and
+	// | separates text aligned left and right, or left, centre and right, as
+	// in "{title}|Page {page} of {pages}".
+	Header string
+	Footer string
+	// TableOfContents adds pages listing the h1 to h3 headings after the
+	// cover, linked to the pages they start on, and bookmarks them in the
+	// document outline
+	TableOfContents bool
+	// Cover adds a cover page in front of the document
+	Cover *Cover
+	// PrintProfile prepares the PDF for a printing condition: images and
+	// colours are given in CMYK, the profile is embedded as the output
+	// intent, and images too coarse for the size they are printed at are
+	// reported to Warn
+	PrintProfile *PrintProfile
+	// Warn receives the problems found that do not stop the export
+	Warn func(message string)
+	// Scale enlarges everything drawn, laying pages out as if they were
+	// smaller by that factor and printing them at full size; margins keep
+	// their size. LargePrintScale sets body text in large print.
+	Scale float64
+	// Plain simplifies the layout for readers with low vision: images give
+	// way to their alt text, italics are set upright in bold and text is
+	// black
+	Plain bool
+}
+
+// LargePrintScale enlarges 11pt body text to 18pt, the least size of large
+// print
+const LargePrintScale = 18.0 / 11
+
+// RenderHTML lays out an HTML document and writes it as a PDF without any
+// external browser. It supports headings, paragraphs, inline emphasis, links,
+// lists, block quotes, preformatted text, tables, rules and raster images using
+// the standard PDF fonts. Figures and tables that fit on a page are not split,
+// and header rows are repeated on each page of a longer table. A cover page,
+// table of contents and running headers and footers may be added, and the PDF
+// may be prepared in CMYK for a print profile. Scripts and
+// styles are ignored, so documents should be rendered from their static
+// fallback.
+func RenderHTML(htmlContent string, w io.Writer, opts RenderOptions) error {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	if opts.PageWidth <= 0 || opts.PageHeight <= 0 {
+		opts.PageWidth, opts.PageHeight = A4Width, A4Height
+	}
+	if opts.Margin <= 0 {
+		opts.Margin = 72
+	}
+	for _, side := range []*float64{&opts.MarginTop, &opts.MarginRight, &opts.MarginBottom, &opts.MarginLeft} {
+		if *side <= 0 {
+			*side = opts.Margin
+		}
+	}
+	scale := 1.0
+	if opts.Scale > 0 {
+		scale = opts.Scale
+		for _, length := range []*float64{&opts.PageWidth, &opts.PageHeight, &opts.MarginTop, &opts.MarginRight, &opts.MarginBottom, &opts.MarginLeft} {
+			*length /= scale
+		}
+	}
+	if opts.ImageQuality < 1 || opts.ImageQuality > 100 {
+		opts.ImageQuality = 90
+	}
+	if opts.PrintProfile != nil && opts.PrintProfile.MinResolution <= 0 {
+		profile := *opts.PrintProfile
+		profile.MinResolution = DefaultMinResolution
+		opts.PrintProfile = &profile
+	}
+	if opts.Title == "" {
+		if title := findElement(doc, atom.Title); title != nil {
+			opts.Title = strings.TrimSpace(textContent(title))
+		}
+	}
+
+	r := &renderer{opts: opts, scale: scale, images: make(map[string]*pdfImage)}
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	r.renderBlocks(root, blockContext{style: bodyStyle})
+	if r.stopped != nil {
+		note := bodyStyle
+		note.italic = true
+		note.color = quoteColor
+		r.gap(paragraphGap)
+		r.paragraph([]run{{text: "Incomplete document: " + r.stopped.Error(), style: note}}, blockContext{style: note})
+	}
+	if len(r.pages) == 0 {
+		r.newPage()
+	}
+	r.frontMatter()
+
+	if err := r.write(w); err != nil {
+		return err
+	}
+	return r.stopped
+}
+
+// textStyle describes how a run of text is drawn
+type textStyle struct {
+	bold   bool
+	italic bool
+	mono   bool
+	strike bool
+	size   float64
+	color  [3]float64
+	link   string
+}
+
+func (s textStyle) font() fontID {
+	switch {
+	case s.mono && s.bold:
+		return fontMonoBold
+	case s.mono:
+		return fontMono
+	case s.bold && s.italic:
+		return fontBoldItalic
+	case s.bold:
+		return fontBold
+	case s.italic:
+		return fontItalic
+	}
+	return fontRegular
+}
+
+// width returns the width in points of WinAnsi-encoded text
+func (s textStyle) width(text string) float64 {
+	font := s.font()
+	total := 0
+	for i := 0; i < len(text); i++ {
+		total += charWidth(font, text[i])
+	}
+	return float64(total) * s.size / 1000
+}
+
+var (
+	bodyStyle     = textStyle{size: 11}
+	headingSizes  = [...]float64{22, 18, 15, 13, 12, 11}
+	linkColor     = [3]float64{0.02, 0.35, 0.75}
+	quoteColor    = [3]float64{0.35, 0.35, 0.35}
+	codeFill      = 0.95
+	tablePadding  = 4.0
+	listIndent    = 20.0
+	quoteIndent   = 16.0
+	paragraphGap  = 7.0
+	listItemGap   = 2.0
+	lineSpacing   = 1.4
+	whitespaceRun = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// run is a piece of inline content: styled text, a line break or an image
+type run struct {
+	text      string
+	style     textStyle
+	lineBreak bool
+	image     string
+	alt       string
+}
+
+// word is a WinAnsi-encoded piece of text that is never split across lines
+// unless it is wider than a whole line
+type word struct {
+	text  string
+	style textStyle
+	width float64
+	space bool
+}
+
+type line struct {
+	words []word
+	size  float64
+}
+
+// blockContext carries the indentation and style of enclosing blocks
+type blockContext struct {
+	indent float64
+	style  textStyle
+	inList bool
+	bars   []float64
+}
+
+// annotation is a link to uri, or to a heading of the document when dest is
+// set
+type annotation struct {
+	rect [4]float64
+	uri  string
+	dest *heading
+}
+
+type page struct {
+	content bytes.Buffer
+	annots  []annotation
+}
+
+type pdfImage struct {
+	src    string
+	name   string
+	data   []byte
+	width  int
+	height int
+	// cmyk images are Flate compressed CMYK samples, others are RGB JPEGs
+	cmyk bool
+	// reported is set once the image was reported as too coarse for print
+	reported bool
+}
+
+type renderer struct {
+	opts RenderOptions
+	// scale is the factor pages are enlarged by when written
+	scale  float64
+	pages  []*page
+	page   *page
+	y      float64
+	images map[string]*pdfImage
+	order  []*pdfImage
+	// marker is a list marker waiting to be drawn beside the next line
+	marker  string
+	markerX float64
+	// stopped is the error of Interrupt that ended the layout
+	stopped error
+	// headings are listed in the table of contents and outline
+	headings []*heading
+	outline  []*outlineItem
+}
+
+func (r *renderer) top() float64    { return r.opts.PageHeight - r.opts.MarginTop }
+func (r *renderer) bottom() float64 { return r.opts.MarginBottom }
+func (r *renderer) left() float64   { return r.opts.MarginLeft }
+func (r *renderer) right() float64  { return r.opts.PageWidth - r.opts.MarginRight }
+
+func (r *renderer) newPage() {
+	r.page = &page{}
+	r.pages = append(r.pages, r.page)
+	r.y = r.top()
+}
+
+// ensure starts a new page unless height points fit above the bottom margin
+func (r *renderer) ensure(height float64) {
+	if r.page == nil || (r.y-height < r.bottom() && r.y < r.top()) {
+		r.newPage()
+	}
+}
+
+// keepTogether starts a new page for a block of height points that would be
+// split by the bottom margin but fits on a page of its own
+func (r *renderer) keepTogether(height float64) {
+	if height <= r.top()-r.bottom() {
+		r.ensure(height)
+	}
+}
+
+// gap adds vertical space between blocks, except at the top of a page
+func (r *renderer) gap(amount float64) {
+	if r.page != nil && r.y < r.top() {
+		r.y -= amount
+	}
+}
+
+// skippedElements carry no printable content
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Title: true, atom.Meta: true, atom.Link: true,
+	atom.Button: true, atom.Select: true, atom.Textarea: true, atom.Iframe: true,
+	atom.Object: true, atom.Embed: true, atom.Canvas: true, atom.Svg: true,
+}
+
+// containerElements are blocks whose children are laid out as separate blocks
+var containerElements = map[atom.Atom]bool{
+	atom.Html: true, atom.Body: true, atom.Div: true, atom.Section: true,
+	atom.Article: true, atom.Main: true, atom.Header: true, atom.Footer: true,
+	atom.Nav: true, atom.Aside: true, atom.Figcaption: true,
+	atom.Details: true, atom.Summary: true, atom.Dl: true, atom.Dt: true,
+	atom.Dd: true, atom.Address: true, atom.Form: true, atom.Fieldset: true,
+	atom.Center: true, atom.Li: true,
+}
+
+// blockElements have their own layout
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Pre: true, atom.Blockquote: true,
+	atom.Ul: true, atom.Ol: true, atom.Hr: true, atom.Table: true,
+	atom.Figure: true,
+}
+
+func isBlockElement(n *html.Node) bool {
+	return n.Type == html.ElementNode && (blockElements[n.DataAtom] || containerElements[n.DataAtom])
+}
+
+// renderBlocks lays out the children of n. Inline content between block
+// elements forms anonymous paragraphs.
+func (r *renderer) renderBlocks(n *html.Node, ctx blockContext) {
+	var runs []run
+	flush := func() {
+		if hasText(runs) {
+			r.paragraph(runs, ctx)
+		}
+		runs = nil
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && skippedElements[child.DataAtom] {
+			continue
+		}
+		if !isBlockElement(child) {
+			runs = r.inline(child, ctx.style, runs)
+			continue
+		}
+		flush()
+		if r.interrupted() {
+			return
+		}
+		if containerElements[child.DataAtom] {
+			r.renderBlocks(child, ctx)
+		} else {
+			r.renderBlock(child, ctx)
+		}
+	}
+	flush()
+}
+
+// interrupted reports whether layout should stop before the next block
+func (r *renderer) interrupted() bool {
+	if r.stopped == nil && r.opts.Interrupt != nil {
+		r.stopped = r.opts.Interrupt()
+	}
+	return r.stopped != nil
+}
+
+func (r *renderer) renderBlock(n *html.Node, ctx blockContext) {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		style := ctx.style
+		style.bold = true
+		style.size = headingSizes[n.Data[1]-'1']
+		r.gap(style.size * 0.6)
+		// Keep a heading on the same page as the start of the following block
+		r.ensure(style.size*lineSpacing + 3*bodyStyle.size*lineSpacing)
+		r.addHeading(int(n.Data[1]-'0'), textContent(n))
+		r.lines(r.inline(n, style, nil), ctx)
+		r.gap(style.size * 0.3)
+	case atom.P:
+		r.paragraph(r.inline(n, ctx.style, nil), ctx)
+	case atom.Pre:
+		r.preformatted(n, ctx)
+	case atom.Blockquote:
+		quoted := ctx
+		quoted.bars = append(append([]float64(nil), ctx.bars...), r.left()+ctx.indent+4)
+		quoted.indent += quoteIndent
+		quoted.style.color = quoteColor
+		quoted.style.italic = true
+		r.renderBlocks(n, quoted)
+	case atom.Ul, atom.Ol:
+		r.list(n, ctx)
+	case atom.Hr:
+		r.gap(paragraphGap)
+		r.ensure(paragraphGap)
+		fmt.Fprintf(&r.page.content, "0.7 G 0.75 w %.2f %.2f m %.2f %.2f l S\n", r.left()+ctx.indent, r.y, r.right(), r.y)
+		r.y -= paragraphGap
+	case atom.Table:
+		r.table(n, ctx)
+	case atom.Figure:
+		// A figure and its caption stay on one page
+		r.keepTogether(r.measure(r.inline(n, ctx.style, nil), ctx))
+		r.renderBlocks(n, ctx)
+	}
+}
+
+func (r *renderer) paragraph(runs []run, ctx blockContext) {
+	r.lines(runs, ctx)
+	if ctx.inList {
+		r.gap(listItemGap)
+	} else {
+		r.gap(paragraphGap)
+	}
+}
+
+// lines lays out inline content, placing images between the lines of text
+func (r *renderer) lines(runs []run, ctx blockContext) {
+	width := r.right() - r.left() - ctx.indent
+	start := 0
+	for i, current := range runs {
+		if current.image == "" {
+			continue
+		}
+		r.drawLines(wrap(runs[start:i], width), ctx)
+		r.image(current, ctx)
+		start = i + 1
+	}
+	r.drawLines(wrap(runs[start:], width), ctx)
+}
+
+// measure returns the height of inline content laid out by lines
+func (r *renderer) measure(runs []run, ctx blockContext) float64 {
+	width := r.right() - r.left() - ctx.indent
+	height := 0.0
+	start := 0
+	for i, current := range runs {
+		if current.image == "" {
+			continue
+		}
+		height += linesHeight(wrap(runs[start:i], width))
+		if img, err := r.loadImage(current.image); err == nil {
+			_, imageHeight := r.imageSize(img, ctx)
+			height += imageHeight + 4
+		} else if current.alt != "" {
+			height += bodyStyle.size * lineSpacing
+		}
+		start = i + 1
+	}
+	return height + linesHeight(wrap(runs[start:], width))
+}
+
+func linesHeight(lines []line) float64 {
+	height := 0.0
+	for _, l := range lines {
+		height += l.size * lineSpacing
+	}
+	return height
+}
+
+func (r *renderer) drawLines(lines []line, ctx blockContext) {
+	for _, l := range lines {
+		height := l.size * lineSpacing
+		r.ensure(height)
+		baseline := r.y - l.size*1.05
+		r.drawBars(ctx, r.y, height)
+		r.drawMarker(baseline, ctx)
+		r.drawWords(l.words, r.left()+ctx.indent, baseline)
+		r.y -= height
+	}
+}
+
+// drawMarker draws a pending list marker beside the first line of an item
+func (r *renderer) drawMarker(baseline float64, ctx blockContext) {
+	if r.marker == "" {
+		return
+	}
+	style := bodyStyle
+	style.color = ctx.style.color
+	text := encodeWinAnsi(r.marker)
+	r.drawText(text, style, r.markerX-style.width(text), baseline)
+	r.marker = ""
+}
+
+func (r *renderer) drawBars(ctx blockContext, top, height float64) {
+	for _, x := range ctx.bars {
+		fmt.Fprintf(&r.page.content, "0.8 G 2 w %.2f %.2f m %.2f %.2f l S\n", x, top, x, top-height)
+	}
+}
+
+// drawWords draws a line of words, merging neighbours with the same style into
+// one text operation
+func (r *renderer) drawWords(words []word, x, baseline float64) {
+	for i := 0; i < len(words); {
+		style := words[i].style
+		if words[i].space && i > 0 {
+			x += style.width(" ")
+		}
+		text := words[i].text
+		j := i + 1
+		for ; j < len(words) && words[j].style == style; j++ {
+			if words[j].space {
+				text += " "
+			}
+			text += words[j].text
+		}
+
+		width := style.width(text)
+		r.drawText(text, style, x, baseline)
+		if style.link != "" {
+			fmt.Fprintf(&r.page.content, "%s 0.5 w %.2f %.2f m %.2f %.2f l S\n",
+				r.colour(style.color, true), x, baseline-1.5, x+width, baseline-1.5)
+			if isExternalLink(style.link) {
+				r.page.annots = append(r.page.annots, annotation{
+					rect: [4]float64{x, baseline - style.size*0.25, x + width, baseline + style.size*0.8},
+					uri:  style.link,
+				})
+			}
+		}
+		if style.strike {
+			fmt.Fprintf(&r.page.content, "%s 0.5 w %.2f %.2f m %.2f %.2f l S\n",
+				r.colour(style.color, true), x, baseline+style.size*0.3, x+width, baseline+style.size*0.3)
+		}
+
+		x += width
+		i = j
+	}
+}
+
+func (r *renderer) drawText(text string, style textStyle, x, baseline float64) {
+	fmt.Fprintf(&r.page.content, "%s BT /F%d %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		r.colour(style.color, false), int(style.font())+1, style.size, x, baseline, escapePDFString(text))
+}
+
+func (r *renderer) preformatted(n *html.Node, ctx blockContext) {
+	style := ctx.style
+	style.mono = true
+	style.italic = false
+	style.size = 9
+
+	left := r.left() + ctx.indent
+	width := r.right() - left
+	perLine := int((width - 2*tablePadding) / (0.6 * style.size))
+	height := style.size * 1.3
+
+	content := strings.TrimSuffix(textContent(n), "\n")
+	for _, source := range strings.Split(content, "\n") {
+		text := encodeWinAnsi(strings.ReplaceAll(source, "\t", "    "))
+		for {
+			chunk := text
+			if len(chunk) > perLine {
+				chunk = text[:perLine]
+			}
+			r.ensure(height)
+			fmt.Fprintf(&r.page.content, "%.2f g %.2f %.2f %.2f %.2f re f\n", codeFill, left, r.y-height, width, height)
+			r.drawBars(ctx, r.y, height)
+			r.drawMarker(r.y-style.size, ctx)
+			r.drawText(chunk, style, left+tablePadding, r.y-style.size)
+			r.y -= height
+			text = text[len(chunk):]
+			if text == "" {
+				break
+			}
+		}
+	}
+	r.gap(paragraphGap)
+}
+
+func (r *renderer) list(n *html.Node, ctx blockContext) {
+	ordered := n.DataAtom == atom.Ol
+	number := 1
+	if start, err := strconv.Atoi(getAttr(n, "start")); err == nil && ordered {
+		number = start
+	}
+
+	item := ctx
+	item.indent += listIndent
+	item.inList = true
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		r.marker = "•"
+		if ordered {
+			r.marker = strconv.Itoa(number) + "."
+			number++
+		}
+		r.markerX = r.left() + item.indent - 6
+		r.renderBlocks(li, item)
+		r.marker = ""
+	}
+	if !ctx.inList {
+		r.gap(paragraphGap - listItemGap)
+	}
+}
+
+// table lays out a table as a grid of equally wide columns. A table that fits
+// on a page is not split; longer tables repeat their header rows, those in
+// thead or made of th cells only, at the top of each page.
+func (r *renderer) table(n *html.Node, ctx blockContext) {
+	var rows [][]*html.Node
+	headerRows := 0
+	collectTableRows(n, false, func(tr *html.Node, header bool) {
+		var cells []*html.Node
+		allHeaders := true
+		for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type == html.ElementNode && (cell.DataAtom == atom.Th || cell.DataAtom == atom.Td) {
+				cells = append(cells, cell)
+				allHeaders = allHeaders && cell.DataAtom == atom.Th
+			}
+		}
+		if len(cells) == 0 {
+			return
+		}
+		if headerRows == len(rows) && (header || allHeaders) {
+			headerRows++
+		}
+		rows = append(rows, cells)
+	})
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return
+	}
+
+	left := r.left() + ctx.indent
+	columnWidth := (r.right() - left) / float64(columns)
+	cellLines := make([][][]line, len(rows))
+	rowHeights := make([]float64, len(rows))
+	tableHeight, headerHeight := 0.0, 0.0
+	for i, row := range rows {
+		cellLines[i] = make([][]line, len(row))
+		for j, cell := range row {
+			runs := imagesAsText(r.inline(cell, ctx.style, nil))
+			cellLines[i][j] = wrap(runs, columnWidth-2*tablePadding)
+			rowHeights[i] = max(rowHeights[i], 2*tablePadding+linesHeight(cellLines[i][j]))
+		}
+		if rowHeights[i] == 2*tablePadding {
+			rowHeights[i] += bodyStyle.size * lineSpacing
+		}
+		tableHeight += rowHeights[i]
+		if i < headerRows {
+			headerHeight += rowHeights[i]
+		}
+	}
+	// Headers that leave no room for a body row are not repeated
+	if headerRows == len(rows) || headerHeight+rowHeights[headerRows] > r.top()-r.bottom() {
+		headerRows = 0
+	}
+
+	r.keepTogether(tableHeight)
+	drawRow := func(i int) {
+		rowHeight := rowHeights[i]
+		for column := 0; column < columns; column++ {
+			x := left + float64(column)*columnWidth
+			fmt.Fprintf(&r.page.content, "0.6 G 0.5 w %.2f %.2f %.2f %.2f re S\n", x, r.y-rowHeight, columnWidth, rowHeight)
+			if column >= len(cellLines[i]) {
+				continue
+			}
+			y := r.y - tablePadding
+			for _, l := range cellLines[i][column] {
+				r.drawWords(l.words, x+tablePadding, y-l.size*1.05)
+				y -= l.size * lineSpacing
+			}
+		}
+		r.y -= rowHeight
+	}
+	for i := range rows {
+		page := r.page
+		switch {
+		case i == 0 && headerRows > 0:
+			// Keep the header with the first body row
+			r.ensure(headerHeight + rowHeights[headerRows])
+		case i >= headerRows:
+			r.ensure(rowHeights[i])
+		}
+		if r.page != page && i > headerRows {
+			for header := 0; header < headerRows; header++ {
+				drawRow(header)
+			}
+		}
+		drawRow(i)
+	}
+	r.gap(paragraphGap)
+}
+
+// image draws an image scaled to fit the content width and page height. Images
+// that cannot be loaded are replaced by their alt text.
+func (r *renderer) image(current run, ctx blockContext) {
+	img, err := r.loadImage(current.image)
+	if err != nil {
+		if current.alt != "" {
+			style := ctx.style
+			style.italic = true
+			r.drawLines(wrap([]run{{text: "[" + current.alt + "]", style: style}}, r.right()-r.left()-ctx.indent), ctx)
+		}
+		return
+	}
+
+	width, height := r.imageSize(img, ctx)
+	r.checkResolution(img, width, height)
+	r.ensure(height)
+	fmt.Fprintf(&r.page.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", width, height, r.left()+ctx.indent, r.y-height, img.name)
+	r.y -= height + 4
+}
+
+// imageSize returns the size an image is drawn at
+func (r *renderer) imageSize(img *pdfImage, ctx blockContext) (width, height float64) {
+	// Treat image pixels as CSS pixels (96 per inch)
+	width = float64(img.width) * 0.75
+	height = float64(img.height) * 0.75
+	maxWidth := r.right() - r.left() - ctx.indent
+	maxHeight := r.top() - r.bottom()
+	if width > maxWidth {
+		height *= maxWidth / width
+		width = maxWidth
+	}
+	if height > maxHeight {
+		width *= maxHeight / height
+		height = maxHeight
+	}
+	return width, height
+}
+
+func (r *renderer) loadImage(src string) (*pdfImage, error) {
+	if img, exists := r.images[src]; exists {
+		if img == nil {
+			return nil, fmt.Errorf("image unavailable: %s", src)
+		}
+		return img, nil
+	}
+	r.images[src] = nil
+
+	if r.opts.LoadImage == nil {
+		return nil, fmt.Errorf("image loading disabled")
+	}
+	data, err := r.opts.LoadImage(src)
+	if err != nil {
+		return nil, err
+	}
+	return r.embedImage(src, data)
+}
+
+// embedImage converts image data for embedding, keyed by src
+func (r *renderer) embedImage(src string, data []byte) (*pdfImage, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %w", src, err)
+	}
+
+	// Flatten transparency onto white and store the image as JPEG, or as
+	// CMYK samples for print
+	bounds := decoded.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), decoded, bounds.Min, draw.Over)
+
+	img := &pdfImage{
+		src:    src,
+		name:   fmt.Sprintf("Im%d", len(r.order)+1),
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		cmyk:   r.opts.PrintProfile != nil,
+	}
+	if img.cmyk {
+		if img.data, err = cmykImage(flat); err != nil {
+			return nil, fmt.Errorf("failed to convert image %s to CMYK: %w", src, err)
+		}
+	} else {
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, flat, &jpeg.Options{Quality: r.opts.ImageQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode image %s: %w", src, err)
+		}
+		img.data = encoded.Bytes()
+	}
+	r.images[src] = img
+	r.order = append(r.order, img)
+	return img, nil
+}
+
+// collectInline appends the inline content of n to runs
+func collectInline(n *html.Node, style textStyle, runs []run) []run {
+	switch n.Type {
+	case html.TextNode:
+		return append(runs, run{text: whitespaceRun.ReplaceAllString(n.Data, " "), style: style})
+	case html.ElementNode:
+	default:
+		return runs
+	}
+	if skippedElements[n.DataAtom] {
+		return runs
+	}
+
+	switch n.DataAtom {
+	case atom.Strong, atom.B, atom.Th:
+		style.bold = true
+	case atom.Em, atom.I, atom.Cite, atom.Var:
+		style.italic = true
+	case atom.Del, atom.S, atom.Strike:
+		style.strike = true
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		style.mono = true
+		style.size *= 0.9
+	case atom.Sub, atom.Sup, atom.Small:
+		style.size *= 0.8
+	case atom.A:
+		if href := getAttr(n, "href"); href != "" {
+			style.link = href
+			style.color = linkColor
+		}
+	case atom.Br:
+		return append(runs, run{lineBreak: true, style: style})
+	case atom.Img:
+		return append(runs, run{image: getAttr(n, "src"), alt: getAttr(n, "alt"), style: style})
+	case atom.Input:
+		if strings.EqualFold(getAttr(n, "type"), "checkbox") {
+			if hasAttr(n, "checked") {
+				return append(runs, run{text: "[x] ", style: style})
+			}
+			return append(runs, run{text: "[ ] ", style: style})
+		}
+		return runs
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if isBlockElement(child) {
+			runs = append(runs, run{text: " ", style: style})
+		}
+		runs = collectInline(child, style, runs)
+	}
+	return runs
+}
+
+// inline appends the inline content of n to runs, simplified for the plain
+// layout
+func (r *renderer) inline(n *html.Node, style textStyle, runs []run) []run {
+	start := len(runs)
+	runs = collectInline(n, style, runs)
+	if !r.opts.Plain {
+		return runs
+	}
+	plain := runs[:start]
+	for _, current := range runs[start:] {
+		if current.image != "" {
+			if current.alt == "" {
+				continue
+			}
+			current = run{text: "[" + current.alt + "]", style: current.style}
+		}
+		if current.style.italic {
+			current.style.italic, current.style.bold = false, true
+		}
+		current.style.color = [3]float64{}
+		plain = append(plain, current)
+	}
+	return plain
+}
+
+// imagesAsText replaces images by their alt text
+func imagesAsText(runs []run) []run {
+	for i := range runs {
+		if runs[i].image != "" {
+			runs[i] = run{text: runs[i].alt, style: runs[i].style}
+		}
+	}
+	return runs
+}
+
+func hasText(runs []run) bool {
+	for _, current := range runs {
+		if current.image != "" || strings.TrimSpace(current.text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap breaks runs into lines no wider than width. Collapsed whitespace between
+// runs becomes a single space and leading spaces on a line are dropped.
+func wrap(runs []run, width float64) []line {
+	var lines []line
+	current := line{}
+	lineWidth := 0.0
+	pendingSpace := false
+
+	finish := func() {
+		if len(current.words) > 0 {
+			lines = append(lines, current)
+		}
+		current = line{}
+		lineWidth = 0
+	}
+
+	for _, piece := range runs {
+		if piece.lineBreak {
+			if len(current.words) == 0 {
+				current.size = piece.style.size
+				lines = append(lines, current)
+			}
+			finish()
+			pendingSpace = false
+			continue
+		}
+
+		text := encodeWinAnsi(piece.text)
+		if strings.HasPrefix(text, " ") {
+			pendingSpace = true
+		}
+		fields := strings.Fields(text)
+		for i, field := range fields {
+			w := word{text: field, style: piece.style, width: piece.style.width(field), space: pendingSpace || i > 0}
+			space := 0.0
+			if w.space && len(current.words) > 0 {
+				space = piece.style.width(" ")
+			}
+
+			if len(current.words) > 0 && lineWidth+space+w.width > width {
+				finish()
+				space = 0
+			}
+			// Split words wider than a whole line
+			for w.width > width && len(w.text) > 1 {
+				cut := len(w.text) - 1
+				for cut > 1 && piece.style.width(w.text[:cut]) > width {
+					cut--
+				}
+				head := word{text: w.text[:cut], style: w.style, width: piece.style.width(w.text[:cut])}
+				current.words = append(current.words, head)
+				current.size = max(current.size, piece.style.size)
+				finish()
+				w.text = w.text[cut:]
+				w.width = piece.style.width(w.text)
+				w.space = false
+			}
+
+			current.words = append(current.words, w)
+			current.size = max(current.size, piece.style.size)
+			lineWidth += space + w.width
+			pendingSpace = false
+		}
+		if len(fields) > 0 {
+			pendingSpace = strings.HasSuffix(text, " ")
+		}
+	}
+	finish()
+
+	return lines
+}
+
+// write serializes the rendered pages as a PDF file
+func (r *renderer) write(w io.Writer) error {
+	const (
+		catalogID   = 1
+		pagesID     = 2
+		fontsID     = 3
+		resourcesID = fontsID + len(baseFonts)
+		infoID      = resourcesID + 1
+	)
+	imageID := infoID + 1
+	pageID := imageID + len(r.order)
+	outlineID := pageID + 2*len(r.pages)
+	pageRef := func(index int) string { return fmt.Sprintf("%d 0 R", pageID+2*index) }
+
+	objects := make(map[int][]byte)
+
+	// Enlarged pages keep their layout; positions are scaled as written
+	if r.scale != 1 {
+		for _, h := range r.headings {
+			h.y *= r.scale
+		}
+		for _, p := range r.pages {
+			for i := range p.annots {
+				for j := range p.annots[i].rect {
+					p.annots[i].rect[j] *= r.scale
+				}
+			}
+		}
+	}
+
+	var kids []string
+	for i := range r.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID+2*i))
+	}
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R", pagesID)
+	profileID := outlineID
+	if len(r.outline) > 0 {
+		catalog += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlineID)
+		for i, object := range outlineObjects(r.outline, outlineID, pageRef) {
+			objects[outlineID+i] = object
+			profileID++
+		}
+	}
+	version := "1.4"
+	if profile := r.opts.PrintProfile; profile != nil {
+		intent, stream, err := profile.outputIntent(profileID)
+		if err != nil {
+			return err
+		}
+		catalog += intent
+		objects[profileID] = stream
+		// Version 4 ICC profiles need PDF 1.6
+		if profile.version() >= 4 {
+			version = "1.6"
+		}
+	}
+	objects[catalogID] = []byte(catalog + " >>")
+	objects[pagesID] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(r.pages)))
+
+	var fonts, images strings.Builder
+	for i, name := range baseFonts {
+		// Widths are optional for standard fonts but let text extractors place glyphs
+		widths := make([]string, 0, 224)
+		for c := 32; c < 256; c++ {
+			widths = append(widths, strconv.Itoa(charWidth(fontID(i), byte(c))))
+		}
+		objects[fontsID+i] = []byte(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding /FirstChar 32 /LastChar 255 /Widths [%s] >>",
+			name, strings.Join(widths, " ")))
+		fmt.Fprintf(&fonts, " /F%d %d 0 R", i+1, fontsID+i)
+	}
+	for i, img := range r.order {
+		var object bytes.Buffer
+		colorSpace, filter := "DeviceRGB", "DCTDecode"
+		if img.cmyk {
+			colorSpace, filter = "DeviceCMYK", "FlateDecode"
+		}
+		fmt.Fprintf(&object, "<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s /Length %d >>\nstream\n",
+			img.width, img.height, colorSpace, filter, len(img.data))
+		object.Write(img.data)
+		object.WriteString("\nendstream")
+		objects[imageID+i] = object.Bytes()
+		fmt.Fprintf(&images, " /%s %d 0 R", img.name, imageID+i)
+	}
+	objects[resourcesID] = []byte(fmt.Sprintf("<< /Font <<%s >> /XObject <<%s >> >>", fonts.String(), images.String()))
+
+	info := fmt.Sprintf("<< /Producer (LIV) /CreationDate (D:%s)", time.Now().UTC().Format("20060102150405Z"))
+	if r.opts.Title != "" {
+		info += " /Title " + encodeTextString(r.opts.Title)
+	}
+	if r.opts.Author != "" {
+		info += " /Author " + encodeTextString(r.opts.Author)
+	}
+	if r.opts.Subject != "" {
+		info += " /Subject " + encodeTextString(r.opts.Subject)
+	}
+	if r.opts.Keywords != "" {
+		info += " /Keywords " + encodeTextString(r.opts.Keywords)
+	}
+	objects[infoID] = []byte(info + " >>")
+
+	for i, p := range r.pages {
+		var annots strings.Builder
+		for _, a := range p.annots {
+			if a.dest != nil {
+				fmt.Fprintf(&annots, " << /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /Dest [%s /XYZ null %.2f null] >>",
+					a.rect[0], a.rect[1], a.rect[2], a.rect[3], pageRef(a.dest.page), a.dest.y)
+				continue
+			}
+			fmt.Fprintf(&annots, " << /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /A << /S /URI /URI (%s) >> >>",
+				a.rect[0], a.rect[1], a.rect[2], a.rect[3], escapePDFString(a.uri))
+		}
+		pageObject := fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources %d 0 R /Contents %d 0 R",
+			pagesID, r.opts.PageWidth*r.scale, r.opts.PageHeight*r.scale, resourcesID, pageID+2*i+1)
+		if annots.Len() > 0 {
+			pageObject += " /Annots [" + annots.String() + " ]"
+		}
+		objects[pageID+2*i] = []byte(pageObject + " >>")
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if r.scale != 1 {
+			fmt.Fprintf(zw, "q %.4f 0 0 %.4f 0 0 cm\n", r.scale, r.scale)
+		}
+		zw.Write(p.content.Bytes())
+		if r.scale != 1 {
+			zw.Write([]byte("Q\n"))
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress page %d: %w", i+1, err)
+		}
+		var stream bytes.Buffer
+		fmt.Fprintf(&stream, "<< /Filter /FlateDecode /Length %d >>\nstream\n", compressed.Len())
+		stream.Write(compressed.Bytes())
+		stream.WriteString("\nendstream")
+		objects[pageID+2*i+1] = stream.Bytes()
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", version)
+	offsets := make([]int, len(objects)+1)
+	for id := 1; id <= len(objects); id++ {
+		offsets[id] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", id)
+		out.Write(objects[id])
+		out.WriteString("\nendobj\n")
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for id := 1; id <= len(objects); id++ {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offsets[id])
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalogID, infoID, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// escapePDFString escapes WinAnsi text for a PDF literal string
+func escapePDFString(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`).Replace(text)
+}
+
+func isExternalLink(href string) bool {
+	lower := strings.ToLower(href)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")
+}
+
+// collectTableRows visits the rows of a table without descending into nested
+// tables, telling those of thead apart
+func collectTableRows(n *html.Node, header bool, visit func(tr *html.Node, header bool)) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		switch child.DataAtom {
+		case atom.Tr:
+			visit(child, header)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			collectTableRows(child, child.DataAtom == atom.Thead, visit)
+		}
+	}
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var buf strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		buf.WriteString(textContent(child))
+	}
+	return buf.String()
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package pdfops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rsc.io/pdf"
+)
+
+// renderTestPDF renders HTML to a file and opens it with an independent reader
+func renderTestPDF(t *testing.T, htmlContent string, opts RenderOptions) *pdf.Reader {
+	var buf bytes.Buffer
+	if err := RenderHTML(htmlContent, &buf, opts); err != nil {
+		t.Fatalf("RenderHTML failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rendered.pdf")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := pdf.Open(path)
+	if err != nil {
+		t.Fatalf("Rendered PDF could not be read: %v", err)
+	}
+	return reader
+}
+
+// pageText concatenates the glyphs drawn on a page. The reader reports drawn
+// glyphs only, so spaces are not included.
+func pageText(p pdf.Page) string {
+	var b strings.Builder
+	for _, text := range p.Content().Text {
+		b.WriteString(text.S)
+	}
+	return b.String()
+}
+
+func TestRenderHTML(t *testing.T) {
+	content := `<html><head><title>Quarterly Report</title><script>ignored()</script></head><body>
+<h1>Results</h1>
+<p>Revenue grew <strong>12%</strong> with <em>strong</em> demand, see <a href="https://example.com">details</a>.</p>
+<ul><li>First item</li><li>Second item<ol><li>Nested</li></ol></li></ul>
+<blockquote><p>Quoted text</p></blockquote>
+<pre><code>func main() {}</code></pre>
+<table><tr><th>Region</th><th>Sales</th></tr><tr><td>North</td><td>42</td></tr></table>
+<hr><p>Café – “quotes”</p>
+</body></html>`
+
+	reader := renderTestPDF(t, content, RenderOptions{Author: "ACME Corp", Subject: "BUSINESS & ECONOMICS / Accounting", Keywords: "revenue, regions"})
+
+	if pages := reader.NumPage(); pages != 1 {
+		t.Fatalf("Expected 1 page, got %d", pages)
+	}
+	text := pageText(reader.Page(1))
+	for _, expected := range []string{"Results", "Revenuegrew12%", "details", "•First", "1.Nested", "Quotedtext", "funcmain(){}", "RegionSales", "North42", "Café–“quotes”"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected rendered text to contain %q, got %q", expected, text)
+		}
+	}
+	if strings.Contains(text, "ignored") {
+		t.Errorf("Scripts should not be rendered")
+	}
+
+	info := reader.Trailer().Key("Info")
+	if title := info.Key("Title").Text(); title != "Quarterly Report" {
+		t.Errorf("Expected title from <title>, got %q", title)
+	}
+	if author := info.Key("Author").Text(); author != "ACME Corp" {
+		t.Errorf("Expected author ACME Corp, got %q", author)
+	}
+	if subject, keywords := info.Key("Subject").Text(), info.Key("Keywords").Text(); subject != "BUSINESS & ECONOMICS / Accounting" || keywords != "revenue, regions" {
+		t.Errorf("Expected the subject and keywords, got %q and %q", subject, keywords)
+	}
+
+	annots := reader.Page(1).V.Key("Annots")
+	if annots.Len() != 1 || annots.Index(0).Key("A").Key("URI").RawString() != "https://example.com" {
+		t.Errorf("Expected a link annotation for the external link")
+	}
+}
+
+func TestRenderHTMLPagination(t *testing.T) {
+	var content strings.Builder
+	for i := 0; i < 120; i++ {
+		fmt.Fprintf(&content, "<p>Paragraph %d with enough words to fill part of a line on the page.</p>", i)
+	}
+
+	reader := renderTestPDF(t, content.String(), RenderOptions{})
+	if reader.NumPage() < 3 {
+		t.Fatalf("Expected content to flow over several pages, got %d", reader.NumPage())
+	}
+
+	// Every paragraph is drawn exactly once, inside the page margins
+	var all strings.Builder
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		for _, text := range page.Content().Text {
+			if text.Y < 72-1 || text.Y > A4Height-72 {
+				t.Errorf("Text %q on page %d is outside the margins (y=%.1f)", text.S, i, text.Y)
+			}
+		}
+		all.WriteString(pageText(page))
+	}
+	for _, expected := range []string{"Paragraph0with", "Paragraph119with"} {
+		if strings.Count(all.String(), expected) != 1 {
+			t.Errorf("Expected %q to be rendered once", expected)
+		}
+	}
+}
+
+func TestRenderHTMLTablePagination(t *testing.T) {
+	var rows strings.Builder
+	for i := 0; i < 80; i++ {
+		fmt.Fprintf(&rows, "<tr><td>Row%d</td><td>value</td></tr>", i)
+	}
+	content := "<table><thead><tr><th>Quarter</th><th>Sales</th></tr></thead><tbody>" + rows.String() + "</tbody></table>"
+
+	reader := renderTestPDF(t, content, RenderOptions{MarginTop: 36, MarginBottom: 100})
+	if reader.NumPage() < 2 {
+		t.Fatalf("Expected the long table to span pages, got %d", reader.NumPage())
+	}
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if !strings.HasPrefix(pageText(page), "QuarterSales") {
+			t.Errorf("Expected the header row at the top of page %d", i)
+		}
+		for _, glyph := range page.Content().Text {
+			if glyph.Y < 100-1 || glyph.Y > A4Height-36 {
+				t.Errorf("Text %q on page %d is outside the margins (y=%.1f)", glyph.S, i, glyph.Y)
+			}
+		}
+	}
+
+	// Short tables move to the next page rather than break, wherever the
+	// page ends
+	for paragraphs := 30; paragraphs < 40; paragraphs++ {
+		content := strings.Repeat("<p>Introductory text</p>", paragraphs) +
+			"<table><tr><td>First</td></tr><tr><td>Second</td></tr><tr><td>Third</td></tr></table>"
+		reader := renderTestPDF(t, content, RenderOptions{})
+		for i := 1; i <= reader.NumPage(); i++ {
+			text := pageText(reader.Page(i))
+			if strings.Contains(text, "First") != strings.Contains(text, "Third") {
+				t.Errorf("Expected the table after %d paragraphs on one page", paragraphs)
+			}
+		}
+	}
+}
+
+func TestRenderHTMLInterrupt(t *testing.T) {
+	var content strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&content, "<p>Paragraph %d</p>", i)
+	}
+
+	// Layout stops before the fourth block and the pages so far are kept
+	blocks := 0
+	stop := errors.New("time budget exceeded")
+	var buf bytes.Buffer
+	err := RenderHTML(content.String(), &buf, RenderOptions{Interrupt: func() error {
+		if blocks++; blocks > 3 {
+			return stop
+		}
+		return nil
+	}})
+	if err != stop {
+		t.Fatalf("Expected the interrupt error, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "partial.pdf")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := pdf.Open(path)
+	if err != nil {
+		t.Fatalf("Partial PDF could not be read: %v", err)
+	}
+	text := pageText(reader.Page(1))
+	if !strings.Contains(text, "Paragraph2") || strings.Contains(text, "Paragraph3") || !strings.Contains(text, "Incompletedocument:timebudgetexceeded") {
+		t.Errorf("Unexpected partial document text %q", text)
+	}
+}
+
+func TestRenderHTMLWrapsLongLines(t *testing.T) {
+	long := strings.Repeat("word ", 200) + strings.Repeat("x", 300)
+	reader := renderTestPDF(t, "<p>"+long+"</p>", RenderOptions{})
+
+	for _, text := range reader.Page(1).Content().Text {
+		if text.X < 72-1 || text.X+text.W > A4Width-72+1 {
+			t.Fatalf("Text %q extends outside the margins (x=%.1f, w=%.1f)", text.S, text.X, text.W)
+		}
+	}
+}
+
+func TestRenderHTMLImages(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			img.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var requested []string
+	opts := RenderOptions{
+		LoadImage: func(src string) ([]byte, error) {
+			requested = append(requested, src)
+			if src == "images/chart.png" {
+				return encoded.Bytes(), nil
+			}
+			return nil, os.ErrNotExist
+		},
+	}
+	content := `<p><img src="images/chart.png" alt="Chart"></p><p><img src="images/chart.png"></p><p><img src="missing.png" alt="Missing diagram"></p>`
+
+	reader := renderTestPDF(t, content, opts)
+
+	xobjects := reader.Page(1).Resources().Key("XObject")
+	if len(xobjects.Keys()) != 1 {
+		t.Errorf("Expected the repeated image to be embedded once, got %v", xobjects.Keys())
+	}
+	image := xobjects.Key(xobjects.Keys()[0])
+	if image.Key("Width").Int64() != 40 || image.Key("Height").Int64() != 20 {
+		t.Errorf("Unexpected image size %dx%d", image.Key("Width").Int64(), image.Key("Height").Int64())
+	}
+	if !strings.Contains(pageText(reader.Page(1)), "[Missingdiagram]") {
+		t.Errorf("Expected alt text for the missing image")
+	}
+	if len(requested) != 2 {
+		t.Errorf("Expected each image source to be loaded once, got %v", requested)
+	}
+}
+
+func TestRenderHTMLFrontMatter(t *testing.T) {
+	var content strings.Builder
+	for _, section := range []string{"Introduction", "Methods", "Results"} {
+		fmt.Fprintf(&content, "<h1>%s</h1><h2>%s detail</h2>", section, section)
+		for i := 0; i < 40; i++ {
+			fmt.Fprintf(&content, "<p>%s paragraph %d with enough words to fill part of a line.</p>", section, i)
+		}
+	}
+	var thumbnail bytes.Buffer
+	if err := png.Encode(&thumbnail, image.NewNRGBA(image.Rect(0, 0, 80, 60))); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := renderTestPDF(t, content.String(), RenderOptions{
+		Title:           "Annual Review",
+		Footer:          "{title}|Page {page} of {pages}",
+		TableOfContents: true,
+		Cover:           &Cover{Title: "Annual Review", Author: "ACME Corp", Description: "The year in numbers", Image: thumbnail.Bytes()},
+	})
+	pages := reader.NumPage()
+	if pages < 5 {
+		t.Fatalf("Expected a cover, contents and several pages of content, got %d pages", pages)
+	}
+
+	cover := pageText(reader.Page(1))
+	if !strings.Contains(cover, "AnnualReview") || !strings.Contains(cover, "ACMECorp") || strings.Contains(cover, "Page1") {
+		t.Errorf("Unexpected cover %q", cover)
+	}
+	if len(reader.Page(1).Resources().Key("XObject").Keys()) != 1 {
+		t.Error("Expected the cover image to be embedded")
+	}
+
+	contents := pageText(reader.Page(2))
+	for _, expected := range []string{"Contents", "Introduction", "Methodsdetail", "Results", fmt.Sprintf("Page2of%d", pages)} {
+		if !strings.Contains(contents, expected) {
+			t.Errorf("Expected %q in the table of contents, got %q", expected, contents)
+		}
+	}
+	// Introduction starts on the page after the contents
+	if !strings.Contains(contents, "Introduction.") || !strings.Contains(pageText(reader.Page(3)), "Introduction") {
+		t.Errorf("Expected the introduction on page 3")
+	}
+	if !strings.Contains(contents, "3") {
+		t.Errorf("Expected the page number of the introduction, got %q", contents)
+	}
+	annots := reader.Page(2).V.Key("Annots")
+	if annots.Len() != 6 || annots.Index(0).Key("Dest").Index(0).Key("Type").Name() != "Page" {
+		t.Errorf("Expected six links to pages, got %v", annots)
+	}
+	if last := pageText(reader.Page(pages)); !strings.Contains(last, fmt.Sprintf("Page%dof%d", pages, pages)) {
+		t.Errorf("Expected the page number in the footer, got %q", last)
+	}
+
+	outline := reader.Trailer().Key("Root").Key("Outlines")
+	if outline.Key("Count").Int64() != 6 {
+		t.Errorf("Expected six bookmarks, got %v", outline)
+	}
+	first := outline.Key("First")
+	if first.Key("Title").Text() != "Introduction" || first.Key("First").Key("Title").Text() != "Introduction detail" {
+		t.Errorf("Expected nested bookmarks, got %v", first)
+	}
+	if first.Key("Next").Key("Title").Text() != "Methods" {
+		t.Errorf("Expected bookmarks in document order")
+	}
+}
+
+func TestRenderHTMLLargePrint(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	content := `<h1>Notice</h1><p>Read <em>carefully</em> and see <a href="https://example.com">details</a>.</p>` +
+		`<p><img src="map.png" alt="Site map"></p><p><img src="logo.png"></p>`
+
+	reader := renderTestPDF(t, content, RenderOptions{
+		Scale:     LargePrintScale,
+		Plain:     true,
+		LoadImage: func(src string) ([]byte, error) { return encoded.Bytes(), nil },
+	})
+
+	page := reader.Page(1)
+	box := page.V.Key("MediaBox")
+	if box.Index(2).Float64() < A4Width-1 || box.Index(3).Float64() < A4Height-1 {
+		t.Errorf("Expected an A4 page, got %v", box)
+	}
+	if xobjects := page.Resources().Key("XObject"); len(xobjects.Keys()) != 0 {
+		t.Errorf("Expected images to be left out, got %v", xobjects.Keys())
+	}
+	text := pageText(page)
+	if !strings.Contains(text, "[Sitemap]") {
+		t.Errorf("Expected the alt text of the image, got %q", text)
+	}
+	for _, glyph := range page.Content().Text {
+		if strings.Contains(glyph.Font, "Oblique") {
+			t.Errorf("Expected no italics, got %q in %s", glyph.S, glyph.Font)
+		}
+		if glyph.FontSize < 18 {
+			t.Errorf("Expected large print, got %q at %.1fpt", glyph.S, glyph.FontSize)
+		}
+		if glyph.X < 72-1 || glyph.X > A4Width-72 {
+			t.Errorf("Text %q is outside the margins (x=%.1f)", glyph.S, glyph.X)
+		}
+	}
+	annots := page.V.Key("Annots")
+	if annots.Len() != 1 || annots.Index(0).Key("Rect").Index(2).Float64() < 72*LargePrintScale {
+		t.Errorf("Expected the link annotation to be enlarged, got %v", annots)
+	}
+}
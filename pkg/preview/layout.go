@@ -0,0 +1,496 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/liv-format/liv/pkg/ogimage"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// pageWidth is the width pages are laid out at before they are scaled
+	// to the thumbnail, in CSS pixels
+	pageWidth  = 800
+	pageMargin = 56
+	listIndent = 28
+	bodySize   = 16.0
+)
+
+var (
+	textColor    = color.RGBA{R: 0x22, G: 0x22, B: 0x22, A: 0xff}
+	linkColor    = color.RGBA{R: 0x00, G: 0x56, B: 0xb3, A: 0xff}
+	mutedColor   = color.RGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
+	headingSizes = map[atom.Atom]float64{
+		atom.H1: 34, atom.H2: 27, atom.H3: 22, atom.H4: 19, atom.H5: 17, atom.H6: 16,
+	}
+)
+
+// skippedElements are never shown on a page
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Template: true,
+	atom.Iframe: true, atom.Object: true, atom.Embed: true, atom.Svg: true,
+	atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+	atom.Audio: true, atom.Video: true, atom.Canvas: true,
+}
+
+// blockElements start on a new line
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Dd: true, atom.Details: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Fieldset: true, atom.Figcaption: true, atom.Figure: true, atom.Footer: true,
+	atom.Form: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Header: true, atom.Hr: true, atom.Li: true,
+	atom.Main: true, atom.Nav: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Summary: true, atom.Table: true, atom.Tr: true, atom.Ul: true,
+	atom.Body: true, atom.Html: true, atom.Noscript: true,
+}
+
+// style is how a run of text is drawn
+type style struct {
+	size  float64
+	bold  bool
+	italy bool
+	mono  bool
+	link  bool
+}
+
+// run is text in one style, or an image
+type run struct {
+	text  string
+	style style
+	image string
+}
+
+// block is what a paragraph is laid out in
+type block struct {
+	indent int
+	marker string
+}
+
+// page lays out a document from the top until it is full
+type page struct {
+	canvas *image.RGBA
+	y      int
+	full   bool
+	fonts  *fontSet
+	faces  map[style]font.Face
+	load   func(src string) ([]byte, error)
+}
+
+// Render lays out content, an HTML page, and returns its top scaled to the
+// thumbnail size. load returns the bytes of an image the page references;
+// images it cannot load are left out.
+func Render(content []byte, load func(src string) ([]byte, error), opts Options) (image.Image, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	fonts, err := loadFonts()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.ParseWithOptions(bytes.NewReader(content), html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %v", err)
+	}
+
+	p := &page{
+		canvas: image.NewRGBA(image.Rect(0, 0, pageWidth, pageWidth*opts.Height/opts.Width)),
+		y:      pageMargin,
+		fonts:  fonts,
+		faces:  make(map[style]font.Face),
+		load:   load,
+	}
+	defer p.close()
+	draw.Draw(p.canvas, p.canvas.Rect, image.White, image.Point{}, draw.Src)
+	p.blocks(doc, block{})
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Rect, p.canvas, p.canvas.Rect, draw.Src, nil)
+	return thumbnail, nil
+}
+
+// blocks lays out the children of n, gathering inline content into
+// paragraphs
+func (p *page) blocks(n *html.Node, b block) {
+	var runs []run
+	flush := func() {
+		p.paragraph(runs, b)
+		runs = nil
+		b.marker = ""
+	}
+	number := 0
+	for child := n.FirstChild; child != nil && !p.full; child = child.NextSibling {
+		if child.Type == html.ElementNode && (skippedElements[child.DataAtom] || hasAttr(child, "hidden")) {
+			continue
+		}
+		if child.Type != html.ElementNode || !blockElements[child.DataAtom] {
+			runs = p.inline(child, style{size: bodySize}, runs)
+			continue
+		}
+		flush()
+
+		inner := block{indent: b.indent}
+		switch child.DataAtom {
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			size := headingSizes[child.DataAtom]
+			p.gap(int(size * 0.6))
+			p.paragraph(p.inline(child, style{size: size, bold: true}, nil), inner)
+			p.gap(int(size * 0.3))
+		case atom.Hr:
+			p.gap(8)
+			if p.fits(1) {
+				draw.Draw(p.canvas, image.Rect(pageMargin+b.indent, p.y, pageWidth-pageMargin, p.y+2), image.NewUniform(mutedColor), image.Point{}, draw.Src)
+			}
+			p.gap(10)
+		case atom.Ul, atom.Ol:
+			p.blocks(child, block{indent: b.indent + listIndent})
+			p.gap(6)
+		case atom.Li:
+			number++
+			inner.marker = "•"
+			if n.DataAtom == atom.Ol {
+				inner.marker = strconv.Itoa(number) + "."
+			}
+			p.blocks(child, inner)
+		case atom.Blockquote, atom.Dd, atom.Figure:
+			inner.indent += listIndent
+			p.blocks(child, inner)
+			p.gap(8)
+		case atom.Pre:
+			p.pre(child, inner)
+			p.gap(10)
+		case atom.Tr:
+			p.paragraph(p.row(child), inner)
+		case atom.P:
+			p.blocks(child, inner)
+			p.gap(10)
+		default:
+			p.blocks(child, inner)
+		}
+	}
+	flush()
+}
+
+// inline gathers the text and images of n
+func (p *page) inline(n *html.Node, s style, runs []run) []run {
+	switch n.Type {
+	case html.TextNode:
+		return append(runs, run{text: n.Data, style: s})
+	case html.ElementNode:
+	default:
+		return runs
+	}
+	if skippedElements[n.DataAtom] || hasAttr(n, "hidden") {
+		return runs
+	}
+	switch n.DataAtom {
+	case atom.Img:
+		if src := getAttr(n, "src"); src != "" {
+			return append(runs, run{image: src, text: getAttr(n, "alt"), style: s})
+		}
+		return runs
+	case atom.Br:
+		return append(runs, run{text: "\n", style: s})
+	case atom.B, atom.Strong, atom.Th:
+		s.bold = true
+	case atom.I, atom.Em, atom.Cite:
+		s.italy = true
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		s.mono = true
+	case atom.A:
+		s.link = true
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		runs = p.inline(child, s, runs)
+	}
+	return runs
+}
+
+// row gathers the cells of a table row into one line
+func (p *page) row(tr *html.Node) []run {
+	var runs []run
+	for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+		if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+			continue
+		}
+		if len(runs) > 0 {
+			runs = append(runs, run{text: "   ", style: style{size: bodySize}})
+		}
+		runs = p.inline(cell, style{size: bodySize}, runs)
+	}
+	return runs
+}
+
+// word is text that is not broken across lines
+type word struct {
+	text  string
+	style style
+	space bool
+}
+
+// paragraph wraps runs to the width of the page and draws them. Images are
+// drawn on lines of their own.
+func (p *page) paragraph(runs []run, b block) {
+	var words []word
+	space := false
+	flushWords := func() {
+		p.lines(words, b)
+		words = nil
+		b.marker = ""
+	}
+	for _, r := range runs {
+		if r.image != "" {
+			flushWords()
+			p.image(r, b)
+			continue
+		}
+		if r.text == "\n" {
+			flushWords()
+			continue
+		}
+		if len(r.text) > 0 && isSpace(r.text[0]) {
+			space = true
+		}
+		for _, field := range strings.Fields(r.text) {
+			words = append(words, word{text: field, style: r.style, space: space && len(words) > 0})
+			space = true
+		}
+		space = len(r.text) > 0 && isSpace(r.text[len(r.text)-1])
+	}
+	flushWords()
+}
+
+// lines wraps words and draws them line by line
+func (p *page) lines(words []word, b block) {
+	if len(words) == 0 {
+		return
+	}
+	left := pageMargin + b.indent
+	width := pageWidth - pageMargin - left
+	for len(words) > 0 && !p.full {
+		lineHeight, ascent, x, n := 0, 0, 0, 0
+		for n < len(words) {
+			face := p.face(words[n].style)
+			advance := font.MeasureString(face, words[n].text).Ceil()
+			if words[n].space {
+				advance += font.MeasureString(face, " ").Ceil()
+			}
+			if n > 0 && x+advance > width {
+				break
+			}
+			x += advance
+			lineHeight = max(lineHeight, int(words[n].style.size*1.4))
+			ascent = max(ascent, face.Metrics().Ascent.Ceil())
+			n++
+		}
+		if !p.fits(lineHeight) {
+			return
+		}
+		baseline := p.y + (lineHeight+ascent)/2 - 2
+		if b.marker != "" {
+			face := p.face(style{size: bodySize})
+			p.text(face, textColor, left-font.MeasureString(face, b.marker+" ").Ceil(), baseline, b.marker)
+			b.marker = ""
+		}
+		x = left
+		for i, w := range words[:n] {
+			face := p.face(w.style)
+			if w.space && i > 0 {
+				x += font.MeasureString(face, " ").Ceil()
+			}
+			c := textColor
+			if w.style.link {
+				c = linkColor
+			}
+			p.text(face, c, x, baseline, w.text)
+			x += font.MeasureString(face, w.text).Ceil()
+		}
+		p.y += lineHeight
+		words = words[n:]
+	}
+}
+
+// pre draws preformatted text line by line without wrapping
+func (p *page) pre(n *html.Node, b block) {
+	face := p.face(style{size: 14, mono: true})
+	for _, line := range strings.Split(strings.Trim(textContent(n), "\n"), "\n") {
+		if !p.fits(20) {
+			return
+		}
+		p.text(face, textColor, pageMargin+b.indent, p.y+15, strings.ReplaceAll(line, "\t", "    "))
+		p.y += 20
+	}
+}
+
+// image draws an image scaled to the width of the page, or its alt text
+// when it cannot be loaded
+func (p *page) image(r run, b block) {
+	data, err := p.load(r.image)
+	var img image.Image
+	if err == nil {
+		img, err = ogimage.DecodeThumbnail(data)
+	}
+	if err != nil {
+		if alt := strings.TrimSpace(r.text); alt != "" {
+			p.lines([]word{{text: "[" + alt + "]", style: style{size: bodySize, italy: true}}}, b)
+		}
+		return
+	}
+
+	left := pageMargin + b.indent
+	bounds := img.Bounds()
+	width := min(bounds.Dx(), pageWidth-pageMargin-left)
+	height := bounds.Dy() * width / max(bounds.Dx(), 1)
+	if height > p.canvas.Rect.Dy()-p.y {
+		// The page ends with as much of the image as fits
+		height = p.canvas.Rect.Dy() - p.y
+		p.full = true
+	}
+	if height <= 0 || width <= 0 {
+		return
+	}
+	frame := image.Rect(left, p.y, left+width, p.y+height)
+	source := bounds
+	if p.full {
+		source.Max.Y = source.Min.Y + height*bounds.Dx()/width
+	}
+	draw.CatmullRom.Scale(p.canvas, frame, img, source, draw.Over, nil)
+	p.y += height + 8
+}
+
+func (p *page) text(face font.Face, c color.Color, x, baseline int, text string) {
+	drawer := &font.Drawer{Dst: p.canvas, Src: image.NewUniform(c), Face: face, Dot: fixed.P(x, baseline)}
+	drawer.DrawString(text)
+}
+
+// fits reports whether height more pixels fit on the page, marking the page
+// full when they do not
+func (p *page) fits(height int) bool {
+	if p.y+height > p.canvas.Rect.Dy()-pageMargin/2 {
+		p.full = true
+	}
+	return !p.full
+}
+
+func (p *page) gap(height int) {
+	if p.y > pageMargin {
+		p.y += height
+	}
+}
+
+// face returns the font face of a style, creating it on first use
+func (p *page) face(s style) font.Face {
+	if face, ok := p.faces[s]; ok {
+		return face
+	}
+	f := p.fonts.regular
+	switch {
+	case s.mono:
+		f = p.fonts.mono
+	case s.bold:
+		f = p.fonts.bold
+	case s.italy:
+		f = p.fonts.italic
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: s.size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		// The embedded fonts always load; fall back to any face made so far
+		for _, made := range p.faces {
+			return made
+		}
+		panic(fmt.Sprintf("failed to create font face: %v", err))
+	}
+	p.faces[s] = face
+	return face
+}
+
+func (p *page) close() {
+	for _, face := range p.faces {
+		face.Close()
+	}
+}
+
+// fontSet holds the parsed Go fonts, which are shared between renders
+type fontSet struct {
+	regular, bold, italic, mono *opentype.Font
+}
+
+var (
+	fontsOnce   sync.Once
+	cachedFonts *fontSet
+	fontsErr    error
+)
+
+func loadFonts() (*fontSet, error) {
+	fontsOnce.Do(func() {
+		parse := func(name string, data []byte) *opentype.Font {
+			if fontsErr != nil {
+				return nil
+			}
+			var f *opentype.Font
+			if f, fontsErr = opentype.Parse(data); fontsErr != nil {
+				fontsErr = fmt.Errorf("failed to load %s font: %v", name, fontsErr)
+			}
+			return f
+		}
+		fonts := &fontSet{
+			regular: parse("regular", goregular.TTF),
+			bold:    parse("bold", gobold.TTF),
+			italic:  parse("italic", goitalic.TTF),
+			mono:    parse("monospace", gomono.TTF),
+		}
+		if fontsErr == nil {
+			cachedFonts = fonts
+		}
+	})
+	return cachedFonts, fontsErr
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(textContent(child))
+	}
+	return text.String()
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
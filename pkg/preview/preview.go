@@ -0,0 +1,155 @@
+// Package preview renders thumbnails of documents for file listings. The
+// static fallback of a document, or its main content when it has none, is
+// laid out as the first page a reader would see and scaled down to PNG or
+// lossless WebP.
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+const (
+	// DefaultWidth is the width of thumbnails when none is given
+	DefaultWidth = 320
+	// MinWidth and MaxWidth bound the width and height of thumbnails
+	MinWidth = 16
+	MaxWidth = 1024
+
+	// FormatPNG and FormatWebP are the thumbnail formats
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+
+	// FallbackEntry is the pre-rendered, script-free version of a document
+	FallbackEntry = "content/static/fallback.html"
+	contentEntry  = "content/index.html"
+)
+
+// Options are the size and format of a thumbnail
+type Options struct {
+	// Width defaults to DefaultWidth
+	Width int
+	// Height defaults to a portrait page, four thirds of the width. A
+	// thumbnail is at most four times taller than it is wide, and the other
+	// way round.
+	Height int
+	// Format is FormatPNG, the default, or FormatWebP
+	Format string
+}
+
+// Normalize fills in the defaults of opts and checks the size and format
+func (opts Options) Normalize() (Options, error) {
+	if opts.Width == 0 {
+		opts.Width = DefaultWidth
+	}
+	if opts.Height == 0 {
+		opts.Height = opts.Width * 4 / 3
+	}
+	for _, size := range []int{opts.Width, opts.Height} {
+		if size < MinWidth || size > MaxWidth {
+			return opts, fmt.Errorf("thumbnail size must be between %d and %d pixels, got %dx%d", MinWidth, MaxWidth, opts.Width, opts.Height)
+		}
+	}
+	if opts.Height > 4*opts.Width || opts.Width > 4*opts.Height {
+		return opts, fmt.Errorf("thumbnail of %dx%d is too narrow", opts.Width, opts.Height)
+	}
+	opts.Format = strings.ToLower(opts.Format)
+	switch opts.Format {
+	case "":
+		opts.Format = FormatPNG
+	case FormatPNG, FormatWebP:
+	default:
+		return opts, fmt.Errorf("unsupported thumbnail format %q (use png or webp)", opts.Format)
+	}
+	return opts, nil
+}
+
+// ContentType returns the media type of a thumbnail format
+func ContentType(format string) string {
+	if format == FormatWebP {
+		return "image/webp"
+	}
+	return "image/png"
+}
+
+// Encode writes a thumbnail in format
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatWebP:
+		return EncodeWebP(w, img)
+	case FormatPNG, "":
+		return png.Encode(w, img)
+	default:
+		return fmt.Errorf("unsupported thumbnail format %q", format)
+	}
+}
+
+// RenderPackage renders the thumbnail of a document package. read returns
+// the contents of a package entry. Encrypted content and images are never
+// rendered, so a thumbnail cannot leak what a document protects; encrypted
+// documents show their title instead.
+func RenderPackage(m *core.Manifest, read func(entry string) ([]byte, error), opts Options) ([]byte, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := FallbackEntry
+	content, err := read(entry)
+	if err != nil {
+		entry = contentEntry
+		content, _ = read(entry)
+	}
+	// Documents with an access policy open only in the viewer, so their
+	// content is not previewed either
+	if isEncrypted(m, entry) || m.Access != nil || content == nil {
+		title := "Untitled document"
+		if m.Metadata != nil && strings.TrimSpace(m.Metadata.Title) != "" {
+			title = m.Metadata.Title
+		}
+		note := "This document has no static content."
+		if isEncrypted(m, entry) {
+			note = "This document is encrypted."
+		} else if m.Access != nil {
+			note = "This document opens only in the viewer."
+		}
+		content = []byte("<h1>" + html.EscapeString(title) + "</h1><p>" + note + "</p>")
+	}
+
+	base := path.Dir(entry)
+	img, err := Render(content, func(src string) ([]byte, error) {
+		if strings.Contains(src, ":") || strings.HasPrefix(src, "/") {
+			return nil, fmt.Errorf("image %s is not in the package", src)
+		}
+		resolved := path.Join(base, strings.SplitN(src, "?", 2)[0])
+		if strings.HasPrefix(resolved, "../") || isEncrypted(m, resolved) {
+			return nil, fmt.Errorf("image %s cannot be shown", src)
+		}
+		return read(resolved)
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, opts.Format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isEncrypted(m *core.Manifest, entry string) bool {
+	if m.Encryption == nil {
+		return false
+	}
+	_, encrypted := m.Encryption.Resources[entry]
+	return encrypted
+}
@@ -0,0 +1,190 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	for _, size := range [][2]int{{1, 1}, {7, 3}, {64, 48}, {300, 200}} {
+		for pattern := 0; pattern < 4; pattern++ {
+			img := image.NewNRGBA(image.Rect(0, 0, size[0], size[1]))
+			rng := rand.New(rand.NewSource(int64(pattern)))
+			for y := 0; y < size[1]; y++ {
+				for x := 0; x < size[0]; x++ {
+					c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+					switch pattern {
+					case 1:
+						c = color.NRGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: uint8(rng.Intn(256))}
+					case 2:
+						if rng.Intn(10) == 0 {
+							v := uint8(rng.Intn(256))
+							c = color.NRGBA{R: v, G: v, B: v, A: 255}
+						}
+					case 3:
+						c = color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 255}
+					}
+					img.SetNRGBA(x, y, c)
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, img); err != nil {
+				t.Fatalf("EncodeWebP failed: %v", err)
+			}
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Failed to decode %dx%d pattern %d: %v", size[0], size[1], pattern, err)
+			}
+			for y := 0; y < size[1]; y++ {
+				for x := 0; x < size[0]; x++ {
+					want := img.NRGBAAt(x, y)
+					if got := color.NRGBAModel.Convert(decoded.At(x, y)); got != want {
+						t.Fatalf("%dx%d pattern %d: pixel %d,%d is %v, expected %v", size[0], size[1], pattern, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOptionsNormalize(t *testing.T) {
+	opts, err := Options{}.Normalize()
+	if err != nil {
+		t.Fatalf("Normalize failed: %v", err)
+	}
+	if opts.Width != DefaultWidth || opts.Height != DefaultWidth*4/3 || opts.Format != FormatPNG {
+		t.Errorf("Unexpected defaults: %+v", opts)
+	}
+	if opts, _ := (Options{Width: 200, Format: "WebP"}).Normalize(); opts.Height != 266 || opts.Format != FormatWebP {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+	for _, bad := range []Options{
+		{Width: 8},
+		{Width: 2048},
+		{Width: 100, Height: 500},
+		{Width: 100, Format: "gif"},
+	} {
+		if _, err := bad.Normalize(); err == nil {
+			t.Errorf("Expected %+v to be refused", bad)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	page := []byte(`<!DOCTYPE html><html><head><title>Hidden</title><style>body{}</style></head><body>
+		<h1>Quarterly report</h1>
+		<p>Revenue grew <strong>twelve percent</strong> on <a href="#">last year</a>.</p>
+		<ul><li>First</li><li>Second</li></ul>
+		<img src="chart.png" alt="Chart">
+		<pre>code block</pre>
+	</body></html>`)
+	var loaded []string
+	img, err := Render(page, func(src string) ([]byte, error) {
+		loaded = append(loaded, src)
+		return nil, fmt.Errorf("not found")
+	}, Options{Width: 120, Height: 160})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if img.Bounds().Dx() != 120 || img.Bounds().Dy() != 160 {
+		t.Errorf("Expected a 120x160 thumbnail, got %v", img.Bounds())
+	}
+	if len(loaded) != 1 || loaded[0] != "chart.png" {
+		t.Errorf("Expected the chart to be loaded, got %v", loaded)
+	}
+	if darkPixels(img) == 0 {
+		t.Error("Expected text to be drawn")
+	}
+
+	blank, err := Render([]byte(`<p hidden>Nothing to see</p>`), nil, Options{Width: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if darkPixels(blank) != 0 {
+		t.Error("Expected hidden content to be left out")
+	}
+}
+
+func TestRenderPackage(t *testing.T) {
+	m := &core.Manifest{Metadata: &core.DocumentMetadata{Title: "Secret plans"}}
+	entries := map[string][]byte{
+		FallbackEntry:            []byte(`<h1>Plans</h1><img src="../../assets/images/logo.png"><img src="/etc/passwd">`),
+		"assets/images/logo.png": solidPNG(t),
+	}
+	var read []string
+	readEntry := func(entry string) ([]byte, error) {
+		read = append(read, entry)
+		if data, ok := entries[entry]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%s not found", entry)
+	}
+
+	data, err := RenderPackage(m, readEntry, Options{Width: 64})
+	if err != nil {
+		t.Fatalf("RenderPackage failed: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		t.Error("Expected a PNG thumbnail")
+	}
+	if fmt.Sprint(read) != fmt.Sprint([]string{FallbackEntry, "assets/images/logo.png"}) {
+		t.Errorf("Expected only the fallback and its image to be read, got %v", read)
+	}
+
+	m.Encryption = &core.EncryptionInfo{Resources: map[string]*core.EncryptedResource{FallbackEntry: {}}}
+	read = nil
+	data, err = RenderPackage(m, readEntry, Options{Width: 64, Format: FormatWebP})
+	if err != nil {
+		t.Fatalf("RenderPackage failed: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("RIFF")) || string(data[8:12]) != "WEBP" {
+		t.Error("Expected a WebP thumbnail")
+	}
+	if len(read) != 1 {
+		t.Errorf("Expected the encrypted fallback not to be rendered, read %v", read)
+	}
+
+	m.Encryption = nil
+	m.Access = &core.AccessPolicy{MaxOpens: 1}
+	read = nil
+	if _, err := RenderPackage(m, readEntry, Options{Width: 64}); err != nil {
+		t.Fatalf("RenderPackage failed: %v", err)
+	}
+	if len(read) != 1 {
+		t.Errorf("Expected the content of a document with an access policy not to be rendered, read %v", read)
+	}
+}
+
+func darkPixels(img image.Image) int {
+	dark := 0
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r+g+b < 3*0xc000 {
+				dark++
+			}
+		}
+	}
+	return dark
+}
+
+func solidPNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for i := range img.Pix {
+		img.Pix[i] = 0x40
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,419 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// WebP lossless (VP8L) bitstream constants, from the WebP Lossless Bitstream
+// Specification (RFC 9649)
+const (
+	vp8lSignature    = 0x2f
+	vp8lMaxDimension = 1 << 14
+
+	transformSubtractGreen = 2
+
+	// Literal and length prefix symbols share the green alphabet
+	numLiterals      = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	maxCopyLength    = 4096
+
+	// Plane codes of the pixel above and the pixel to the left
+	distanceAbove = 1
+	distanceLeft  = 2
+
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+	numCodeLengthCodes      = 19
+)
+
+// codeLengthCodeOrder is the order the lengths of the code length code are
+// written in
+var codeLengthCodeOrder = [numCodeLengthCodes]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes img as a lossless WebP image. Pixels are predicted from
+// the green channel and runs that repeat the pixel to the left or the row
+// above are copied, which suits rendered pages of text.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return fmt.Errorf("cannot encode a %dx%d image as WebP", width, height)
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) || nrgba.Stride != 4*width {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	}
+
+	// Pixels as ARGB with green subtracted from red and blue
+	pixels := make([]uint32, width*height)
+	alpha := false
+	for i := range pixels {
+		p := nrgba.Pix[4*i : 4*i+4]
+		r, g, b, a := p[0], p[1], p[2], p[3]
+		if a != 0xff {
+			alpha = true
+		}
+		pixels[i] = uint32(a)<<24 | uint32(r-g)<<16 | uint32(g)<<8 | uint32(b-g)
+	}
+
+	var bits bitWriter
+	bits.write(vp8lSignature, 8)
+	bits.write(uint32(width-1), 14)
+	bits.write(uint32(height-1), 14)
+	if alpha {
+		bits.write(1, 1)
+	} else {
+		bits.write(0, 1)
+	}
+	bits.write(0, 3) // version
+	bits.write(1, 1) // a transform follows
+	bits.write(transformSubtractGreen, 2)
+	bits.write(0, 1) // no more transforms
+	bits.write(0, 1) // no color cache
+	bits.write(0, 1) // one set of prefix codes for the whole image
+	encodeImageData(&bits, pixels, width)
+
+	data := bits.bytes()
+	var out bytes.Buffer
+	chunk := len(data)
+	padded := chunk + chunk&1
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+8+padded))
+	out.WriteString("WEBPVP8L")
+	binary.Write(&out, binary.LittleEndian, uint32(chunk))
+	out.Write(data)
+	if chunk&1 == 1 {
+		out.WriteByte(0)
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// token is a literal pixel, or a copy of length pixels from distance back
+type token struct {
+	pixel    uint32
+	length   int
+	distance int
+}
+
+// encodeImageData writes the pixels with backward references to the pixel to
+// the left or above, using prefix codes built from their histograms
+func encodeImageData(bits *bitWriter, pixels []uint32, width int) {
+	var tokens []token
+	for i := 0; i < len(pixels); {
+		left, above := 0, 0
+		if i > 0 {
+			for i+left < len(pixels) && left < maxCopyLength && pixels[i+left] == pixels[i-1] {
+				left++
+			}
+		}
+		if i >= width {
+			for i+above < len(pixels) && above < maxCopyLength && pixels[i+above] == pixels[i+above-width] {
+				above++
+			}
+		}
+		switch {
+		case left >= 3 && left >= above:
+			tokens = append(tokens, token{length: left, distance: distanceLeft})
+			i += left
+		case above >= 3:
+			tokens = append(tokens, token{length: above, distance: distanceAbove})
+			i += above
+		default:
+			tokens = append(tokens, token{pixel: pixels[i]})
+			i++
+		}
+	}
+
+	green := make([]int, numLiterals+numLengthCodes)
+	red := make([]int, numLiterals)
+	blue := make([]int, numLiterals)
+	alpha := make([]int, numLiterals)
+	distance := make([]int, numDistanceCodes)
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[t.pixel>>8&0xff]++
+			red[t.pixel>>16&0xff]++
+			blue[t.pixel&0xff]++
+			alpha[t.pixel>>24]++
+			continue
+		}
+		code, _, _ := prefixEncode(t.length)
+		green[numLiterals+code]++
+		code, _, _ = prefixEncode(t.distance)
+		distance[code]++
+	}
+
+	codes := make([]*prefixCode, 5)
+	for i, histogram := range [][]int{green, red, blue, alpha, distance} {
+		codes[i] = newPrefixCode(histogram, maxCodeLength)
+		codes[i].writeDefinition(bits)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].writeSymbol(bits, int(t.pixel>>8&0xff))
+			codes[1].writeSymbol(bits, int(t.pixel>>16&0xff))
+			codes[2].writeSymbol(bits, int(t.pixel&0xff))
+			codes[3].writeSymbol(bits, int(t.pixel>>24))
+			continue
+		}
+		code, extraBits, extra := prefixEncode(t.length)
+		codes[0].writeSymbol(bits, numLiterals+code)
+		bits.write(extra, extraBits)
+		code, extraBits, extra = prefixEncode(t.distance)
+		codes[4].writeSymbol(bits, code)
+		bits.write(extra, extraBits)
+	}
+}
+
+// prefixEncode splits a copy length or distance into its prefix code and
+// the extra bits that follow it
+func prefixEncode(value int) (code int, extraBits uint, extra uint32) {
+	v := value - 1
+	if v < 4 {
+		return v, 0, 0
+	}
+	high := 0
+	for v>>(high+1) != 0 {
+		high++
+	}
+	second := (v >> (high - 1)) & 1
+	extraBits = uint(high - 1)
+	return 2*high + second, extraBits, uint32(v) & (1<<extraBits - 1)
+}
+
+// prefixCode is a canonical Huffman code
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+	// symbols are the symbols that have a code
+	symbols []int
+}
+
+// newPrefixCode builds a code for the symbols that occur in histogram, with
+// codes no longer than limit bits
+func newPrefixCode(histogram []int, limit int) *prefixCode {
+	c := &prefixCode{lengths: make([]uint8, len(histogram)), codes: make([]uint32, len(histogram))}
+	for symbol, count := range histogram {
+		if count > 0 {
+			c.symbols = append(c.symbols, symbol)
+		}
+	}
+	switch len(c.symbols) {
+	case 0:
+		// Unused codes still need a symbol
+		c.symbols = []int{0}
+		c.lengths[0] = 1
+	case 1:
+		c.lengths[c.symbols[0]] = 1
+	default:
+		c.lengths = huffmanLengths(histogram, limit)
+	}
+
+	// Canonical codes, shortest first and in symbol order within a length
+	var count [maxCodeLength + 2]uint32
+	for _, length := range c.lengths {
+		count[length]++
+	}
+	count[0] = 0
+	var next [maxCodeLength + 2]uint32
+	code := uint32(0)
+	for length := 1; length <= maxCodeLength; length++ {
+		code = (code + count[length-1]) << 1
+		next[length] = code
+	}
+	for symbol, length := range c.lengths {
+		if length > 0 {
+			c.codes[symbol] = reverse(next[length], length)
+			next[length]++
+		}
+	}
+	return c
+}
+
+// writeSymbol writes the code of symbol. A code for one symbol takes no bits.
+func (c *prefixCode) writeSymbol(bits *bitWriter, symbol int) {
+	if len(c.symbols) > 1 {
+		bits.write(c.codes[symbol], uint(c.lengths[symbol]))
+	}
+}
+
+// writeDefinition writes the code lengths of the code: as a simple code when
+// it has at most two symbols that fit in eight bits, and otherwise coded with
+// a code length code
+func (c *prefixCode) writeDefinition(bits *bitWriter) {
+	if len(c.symbols) <= 2 && c.symbols[len(c.symbols)-1] < numLiterals {
+		bits.write(1, 1)
+		bits.write(uint32(len(c.symbols)-1), 1)
+		if c.symbols[0] < 2 {
+			bits.write(0, 1)
+			bits.write(uint32(c.symbols[0]), 1)
+		} else {
+			bits.write(1, 1)
+			bits.write(uint32(c.symbols[0]), 8)
+		}
+		if len(c.symbols) == 2 {
+			bits.write(uint32(c.symbols[1]), 8)
+		}
+		return
+	}
+
+	// Runs of unused symbols are written as repeated zeros
+	type lengthToken struct {
+		symbol int
+		extra  uint32
+		bits   uint
+	}
+	var tokens []lengthToken
+	for i := 0; i < len(c.lengths); {
+		if c.lengths[i] != 0 {
+			tokens = append(tokens, lengthToken{symbol: int(c.lengths[i])})
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(c.lengths) && c.lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, lengthToken{symbol: 18, extra: uint32(run - 11), bits: 7})
+		case run >= 3:
+			tokens = append(tokens, lengthToken{symbol: 17, extra: uint32(run - 3), bits: 3})
+		default:
+			for j := 0; j < run; j++ {
+				tokens = append(tokens, lengthToken{symbol: 0})
+			}
+		}
+		i += run
+	}
+
+	histogram := make([]int, numCodeLengthCodes)
+	for _, t := range tokens {
+		histogram[t.symbol]++
+	}
+	lengthCode := newPrefixCode(histogram, maxCodeLengthCodeLength)
+
+	written := 4
+	for i := numCodeLengthCodes - 1; i >= written; i-- {
+		if lengthCode.lengths[codeLengthCodeOrder[i]] != 0 {
+			written = i + 1
+			break
+		}
+	}
+	bits.write(0, 1)
+	bits.write(uint32(written-4), 4)
+	for i := 0; i < written; i++ {
+		bits.write(uint32(lengthCode.lengths[codeLengthCodeOrder[i]]), 3)
+	}
+	bits.write(0, 1) // lengths are given for the whole alphabet
+	for _, t := range tokens {
+		lengthCode.writeSymbol(bits, t.symbol)
+		bits.write(t.extra, t.bits)
+	}
+}
+
+// huffmanLengths returns the code lengths of a Huffman code for histogram.
+// Rare symbols are counted as more frequent until no code is longer than
+// limit bits.
+func huffmanLengths(histogram []int, limit int) []uint8 {
+	floor := 1
+	for {
+		lengths, depth := huffmanTree(histogram, floor)
+		if depth <= limit {
+			return lengths
+		}
+		floor *= 2
+	}
+}
+
+// huffmanTree builds a Huffman tree for the symbols that occur in
+// histogram, counting each at least floor times, and returns the depth of
+// every symbol and of the tree
+func huffmanTree(histogram []int, floor int) ([]uint8, int) {
+	type node struct {
+		count       int
+		symbol      int
+		left, right int
+	}
+	var nodes []node
+	var queue []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			nodes = append(nodes, node{count: max(count, floor), symbol: symbol, left: -1, right: -1})
+			queue = append(queue, len(nodes)-1)
+		}
+	}
+	less := func(a, b int) bool {
+		if nodes[a].count != nodes[b].count {
+			return nodes[a].count < nodes[b].count
+		}
+		return a < b
+	}
+	for len(queue) > 1 {
+		sort.Slice(queue, func(i, j int) bool { return less(queue[i], queue[j]) })
+		a, b := queue[0], queue[1]
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, symbol: -1, left: a, right: b})
+		queue = append(queue[2:], len(nodes)-1)
+	}
+
+	lengths := make([]uint8, len(histogram))
+	depth := 0
+	var walk func(n, level int)
+	walk = func(n, level int) {
+		if nodes[n].symbol >= 0 {
+			lengths[nodes[n].symbol] = uint8(level)
+			depth = max(depth, level)
+			return
+		}
+		walk(nodes[n].left, level+1)
+		walk(nodes[n].right, level+1)
+	}
+	walk(queue[0], 0)
+	return lengths, depth
+}
+
+// reverse reverses the low n bits of code, as prefix codes are read one bit
+// at a time from the least significant end
+func reverse(code uint32, n uint8) uint32 {
+	var reversed uint32
+	for i := uint8(0); i < n; i++ {
+		reversed = reversed<<1 | code>>i&1
+	}
+	return reversed
+}
+
+// bitWriter packs values least significant bit first
+type bitWriter struct {
+	out   []byte
+	acc   uint64
+	count uint
+}
+
+func (b *bitWriter) write(value uint32, n uint) {
+	b.acc |= uint64(value) << b.count
+	b.count += n
+	for b.count >= 8 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc >>= 8
+		b.count -= 8
+	}
+}
+
+func (b *bitWriter) bytes() []byte {
+	if b.count > 0 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc, b.count = 0, 0
+	}
+	return b.out
+}
@@ -0,0 +1,270 @@
+// Package printstyle generates the print stylesheets of documents, with page
+// break rules derived from the structure of their content, and applies the
+// page hints of manifests to PDF export: page size and margins, running
+// headers and footers, the table of contents and the cover page.
+package printstyle
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/ogimage"
+	"github.com/liv-format/liv/pkg/pdfops"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Entry is the package path of a print stylesheet generated at build time
+const Entry = "content/styles/print.css"
+
+// header starts every generated stylesheet
+const header = "/* Print stylesheet generated by the LIV builder from the document\n" +
+	"   structure. It is replaced on every build. */\n"
+
+// LongTableRows is the row count above which a table may break across
+// pages; shorter tables are kept on one page
+const LongTableRows = 25
+
+// Structure is what a page contains that bears on where pages break
+type Structure struct {
+	Headings int
+	Figures  int
+	Images   int
+	Lists    int
+	Code     int
+	Quotes   int
+	Tables   int
+	// LongTables have more than LongTableRows rows
+	LongTables int
+	// HeaderTables have a thead, repeated at the top of each page
+	HeaderTables int
+	// LooseHeaders counts tables that start with a row of th cells outside
+	// a thead, which print once only
+	LooseHeaders int
+}
+
+// Analyze reads the structure of an HTML page
+func Analyze(page []byte) (*Structure, error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	s := &Structure{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				s.Headings++
+			case atom.Figure:
+				s.Figures++
+			case atom.Img, atom.Svg, atom.Canvas, atom.Video:
+				s.Images++
+			case atom.Ul, atom.Ol, atom.Dl:
+				s.Lists++
+			case atom.Pre:
+				s.Code++
+			case atom.Blockquote:
+				s.Quotes++
+			case atom.Table:
+				s.addTable(n)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return s, nil
+}
+
+func (s *Structure) addTable(table *html.Node) {
+	s.Tables++
+	rows := 0
+	var first *html.Node
+	hasHead := false
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Thead:
+				hasHead = true
+				visit(child)
+			case atom.Tbody, atom.Tfoot:
+				visit(child)
+			case atom.Tr:
+				if first == nil {
+					first = child
+				}
+				rows++
+			}
+		}
+	}
+	visit(table)
+	if rows > LongTableRows {
+		s.LongTables++
+	}
+	if hasHead {
+		s.HeaderTables++
+	} else if first != nil && headerRow(first) {
+		s.LooseHeaders++
+	}
+}
+
+// Generated reports whether a stylesheet was written by Generate, rather
+// than by the document's author
+func Generated(css []byte) bool {
+	return bytes.HasPrefix(css, []byte(header))
+}
+
+// headerRow reports whether a row is made of th cells only
+func headerRow(tr *html.Node) bool {
+	cells := 0
+	for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+		if cell.Type != html.ElementNode {
+			continue
+		}
+		if cell.DataAtom != atom.Th {
+			return false
+		}
+		cells++
+	}
+	return cells > 0
+}
+
+// Generate writes a print stylesheet for a page of the given structure. The
+// page size and margins come from settings, A4 with one inch margins when
+// nil. Rules are only written for what the page contains.
+func Generate(s *Structure, settings *core.PrintSettings) ([]byte, error) {
+	if _, _, err := settings.PageDimensions(); err != nil {
+		return nil, err
+	}
+	if _, _, _, _, err := settings.Margins(); err != nil {
+		return nil, err
+	}
+	size, margin := "A4", "1in"
+	if settings != nil {
+		if settings.PageSize != "" {
+			size = settings.PageSize
+		}
+		if settings.Orientation != "" {
+			size += " " + settings.Orientation
+		}
+		if settings.Margin != "" {
+			margin = settings.Margin
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(header + "\n")
+	fmt.Fprintf(&b, "@page {\n  size: %s;\n  margin: %s;\n}\n\n", size, margin)
+	b.WriteString("p {\n  orphans: 3;\n  widows: 3;\n}\n\n")
+	b.WriteString(".page-break {\n  break-before: page;\n}\n\n")
+	b.WriteString(".no-print {\n  display: none !important;\n}\n")
+
+	rule := func(comment, selector, declarations string) {
+		if comment != "" {
+			fmt.Fprintf(&b, "\n/* %s */", comment)
+		}
+		fmt.Fprintf(&b, "\n%s {\n%s}\n", selector, declarations)
+	}
+	if s.Headings > 0 {
+		rule("Headings stay with what follows them", "h1, h2, h3, h4, h5, h6",
+			"  break-after: avoid;\n  break-inside: avoid;\n")
+	}
+	if s.Figures > 0 {
+		rule("Figures are not split from their captions", "figure",
+			"  break-inside: avoid;\n")
+		rule("", "figcaption", "  break-before: avoid;\n")
+	}
+	if s.Images > 0 {
+		rule("Images fit the page", "img, svg, canvas, video",
+			"  max-width: 100%;\n  height: auto;\n  break-inside: avoid;\n")
+	}
+	if s.Tables > 0 {
+		rule("Tables are kept on one page and rows are never split", "table",
+			"  break-inside: avoid;\n")
+		rule("", "tr", "  break-inside: avoid;\n")
+	}
+	if s.LongTables > 0 {
+		fmt.Fprintf(&b, "\n/* Tables of more than %d rows break between rows */\n", LongTableRows)
+		fmt.Fprintf(&b, "table:has(tr:nth-child(%d)) {\n  break-inside: auto;\n}\n", LongTableRows+1)
+	}
+	if s.HeaderTables > 0 {
+		rule("Table headers and footers repeat on each page", "thead", "  display: table-header-group;\n")
+		rule("", "tfoot", "  display: table-footer-group;\n")
+	}
+	if s.Code > 0 || s.Quotes > 0 {
+		rule("Code and quotations are not split", "pre, blockquote",
+			"  break-inside: avoid;\n")
+	}
+	if s.Lists > 0 {
+		rule("List items are not split", "li, dt, dd", "  break-inside: avoid;\n")
+		rule("", "dt", "  break-after: avoid;\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// Configure sets the page size, margins, running headers and footers and
+// table of contents of PDF export from a manifest's print hints. Options are
+// left unchanged when the hints are invalid.
+func Configure(options *pdfops.RenderOptions, settings *core.PrintSettings) error {
+	width, height, err := settings.PageDimensions()
+	if err != nil {
+		return err
+	}
+	top, right, bottom, left, err := settings.Margins()
+	if err != nil {
+		return err
+	}
+	options.PageWidth, options.PageHeight = width, height
+	// A zero margin falls back to the default, so ask for a hairline
+	margin := func(points float64) float64 { return max(points, 0.01) }
+	options.MarginTop, options.MarginRight = margin(top), margin(right)
+	options.MarginBottom, options.MarginLeft = margin(bottom), margin(left)
+	if settings != nil {
+		options.Header, options.Footer = settings.Header, settings.Footer
+		options.TableOfContents = settings.TableOfContents
+	}
+	return nil
+}
+
+// contentEntry is the page searched for a cover image
+const contentEntry = "content/index.html"
+
+// Cover returns the cover page of a document whose print hints ask for one,
+// and nil otherwise. It shows the title, author, date and description, and
+// the thumbnail chosen as for the document's preview card. read returns the
+// contents of a package entry; a thumbnail that fails to load is left out.
+func Cover(m *core.Manifest, read func(entry string) ([]byte, error)) *pdfops.Cover {
+	if m.Print == nil || !m.Print.Cover {
+		return nil
+	}
+	cover := &pdfops.Cover{}
+	if m.Metadata != nil {
+		cover.Title = m.Metadata.Title
+		cover.Author = m.Metadata.Author
+		cover.Description = m.Metadata.Description
+		date := m.Metadata.Modified
+		if date.IsZero() {
+			date = m.Metadata.Created
+		}
+		if !date.IsZero() {
+			cover.Date = date.Format("2 January 2006")
+		}
+	}
+	content, _ := read(contentEntry)
+	if thumbnail := ogimage.FindThumbnail(m, content, contentEntry); thumbnail != "" {
+		if data, err := read(thumbnail); err == nil {
+			if _, err := ogimage.DecodeThumbnail(data); err == nil {
+				cover.Image = data
+			}
+		}
+	}
+	return cover
+}
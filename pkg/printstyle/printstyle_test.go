@@ -0,0 +1,109 @@
+package printstyle
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/pdfops"
+)
+
+func TestAnalyze(t *testing.T) {
+	var rows strings.Builder
+	for i := 0; i <= LongTableRows; i++ {
+		fmt.Fprintf(&rows, "<tr><td>%d</td></tr>", i)
+	}
+	page := `<h1>Report</h1><figure><img src="chart.png"><figcaption>Sales</figcaption></figure>
+		<table><thead><tr><th>Quarter</th></tr></thead><tbody>` + rows.String() + `</tbody></table>
+		<table><tr><th>Region</th></tr><tr><td>North</td></tr></table>
+		<pre>code</pre><ul><li>item</li></ul>`
+
+	s, err := Analyze([]byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Structure{Headings: 1, Figures: 1, Images: 1, Lists: 1, Code: 1, Tables: 2, LongTables: 1, HeaderTables: 1, LooseHeaders: 1}
+	if *s != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *s)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	css, err := Generate(&Structure{Headings: 2, Tables: 1, HeaderTables: 1, LongTables: 1}, &core.PrintSettings{PageSize: "Letter", Orientation: "landscape", Margin: "15mm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range []string{"size: Letter landscape;", "margin: 15mm;", "h1, h2, h3, h4, h5, h6 {", "display: table-header-group;", "table:has(tr:nth-child(26))"} {
+		if !strings.Contains(string(css), rule) {
+			t.Errorf("Expected %q in the stylesheet:\n%s", rule, css)
+		}
+	}
+	for _, rule := range []string{"figure {", "pre, blockquote {", "li, dt, dd {"} {
+		if strings.Contains(string(css), rule) {
+			t.Errorf("Expected no %q rule for content the page lacks", rule)
+		}
+	}
+
+	plain, err := Generate(&Structure{}, nil)
+	if err != nil || !strings.Contains(string(plain), "size: A4;") || !strings.Contains(string(plain), "margin: 1in;") {
+		t.Errorf("Expected A4 with one inch margins by default, got %v:\n%s", err, plain)
+	}
+	if _, err := Generate(&Structure{}, &core.PrintSettings{Margin: "wide"}); err == nil {
+		t.Error("Expected invalid margins to be refused")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	var options pdfops.RenderOptions
+	if err := Configure(&options, &core.PrintSettings{PageSize: "Letter", Margin: "0.5in 0"}); err != nil {
+		t.Fatal(err)
+	}
+	if options.PageWidth != 612 || options.PageHeight != 792 || options.MarginTop != 36 || options.MarginLeft >= 1 {
+		t.Errorf("Unexpected options %+v", options)
+	}
+	if err := Configure(&options, &core.PrintSettings{PageSize: "B7"}); err == nil || options.PageWidth != 612 {
+		t.Errorf("Expected invalid hints to leave the options unchanged, got %v", err)
+	}
+	if err := Configure(&options, &core.PrintSettings{Footer: "Page {page} of {pages}", TableOfContents: true}); err != nil {
+		t.Fatal(err)
+	}
+	if options.Footer != "Page {page} of {pages}" || options.Header != "" || !options.TableOfContents {
+		t.Errorf("Expected the running footer and contents page, got %+v", options)
+	}
+}
+
+func TestCover(t *testing.T) {
+	var thumbnail bytes.Buffer
+	if err := png.Encode(&thumbnail, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		contentEntry:               []byte(`<p><img src="images/chart.png"></p>`),
+		"content/images/chart.png": thumbnail.Bytes(),
+	}
+	read := func(entry string) ([]byte, error) {
+		if data, ok := files[entry]; ok {
+			return data, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	m := &core.Manifest{
+		Metadata:  &core.DocumentMetadata{Title: "Annual Review", Author: "ACME Corp", Created: time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)},
+		Resources: map[string]*core.Resource{"content/images/chart.png": {Type: "image/png", Path: "content/images/chart.png"}},
+	}
+
+	if Cover(m, read) != nil {
+		t.Error("Expected no cover unless the print hints ask for one")
+	}
+	m.Print = &core.PrintSettings{Cover: true}
+	cover := Cover(m, read)
+	if cover == nil || cover.Title != "Annual Review" || cover.Date != "5 March 2026" || !bytes.Equal(cover.Image, thumbnail.Bytes()) {
+		t.Errorf("Unexpected cover %+v", cover)
+	}
+}
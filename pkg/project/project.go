@@ -0,0 +1,397 @@
+// Package project reads liv.yaml and liv.json project files, which keep the
+// build settings of a document next to its sources: metadata, security
+// policy overrides, feature flags, the paths packaged, optimization, signing,
+// the theme and build options. Command line flags override the values of the file.
+package project
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/optimize"
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the project files looked for in an input directory, in order
+var FileNames = []string{"liv.yaml", "liv.yml", "liv.json"}
+
+// Project is a project file. Paths in it are relative to the directory of
+// the file, and environment variables are expanded in them, so keys can live
+// outside the repository.
+//
+//	metadata:
+//	  title: Annual Report
+//	  author: Finance Team
+//	security:
+//	  network:
+//	    allow_outbound: true
+//	    allowed_hosts: [api.example.com]
+//	features:
+//	  audio: true
+//	exclude: [drafts, "*.psd"]
+//	optimize:
+//	  stages: [images, minify]
+//	signing:
+//	  sign: true
+//	  key: $LIV_SIGNING_KEY
+//	theme: corporate
+type Project struct {
+	Metadata *MetadataConfig `json:"metadata,omitempty"`
+	Security *SecurityConfig `json:"security,omitempty"`
+	// Features turns manifest feature flags on or off by name
+	Features map[string]bool `json:"features,omitempty"`
+	// Include lists the paths packaged, all when empty; Exclude leaves paths
+	// out. Entries are paths or path.Match patterns matching a file or one
+	// of its directories; patterns without a slash match names anywhere.
+	Include  []string        `json:"include,omitempty"`
+	Exclude  []string        `json:"exclude,omitempty"`
+	Optimize *OptimizeConfig `json:"optimize,omitempty"`
+	Signing  *SigningConfig  `json:"signing,omitempty"`
+	Build    *BuildConfig    `json:"build,omitempty"`
+	// Theme is a built-in theme, one in the theme library or a theme
+	// directory, applied to the content
+	Theme string `json:"theme,omitempty"`
+
+	// File is the path of the project file
+	File string `json:"-"`
+	// Dir is the directory containing the project file; relative paths
+	// resolve against it
+	Dir string `json:"-"`
+}
+
+// MetadataConfig replaces the generated document metadata field by field
+type MetadataConfig struct {
+	Title       string `json:"title,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Abstract    string `json:"abstract,omitempty"`
+}
+
+// SecurityConfig overrides parts of the security policy the builder picks
+// for the content
+type SecurityConfig struct {
+	ContentSecurityPolicy string         `json:"content_security_policy,omitempty"`
+	TrustedDomains        []string       `json:"trusted_domains,omitempty"`
+	JS                    *JSConfig      `json:"js,omitempty"`
+	WASM                  *WASMConfig    `json:"wasm,omitempty"`
+	Network               *NetworkConfig `json:"network,omitempty"`
+	Storage               *StorageConfig `json:"storage,omitempty"`
+}
+
+// JSConfig overrides the JavaScript permissions
+type JSConfig struct {
+	ExecutionMode string   `json:"execution_mode,omitempty"`
+	AllowedAPIs   []string `json:"allowed_apis,omitempty"`
+	DOMAccess     string   `json:"dom_access,omitempty"`
+}
+
+// WASMConfig overrides the WASM permissions
+type WASMConfig struct {
+	MemoryLimit     uint64   `json:"memory_limit,omitempty"`
+	CPUTimeLimit    uint64   `json:"cpu_time_limit,omitempty"`
+	AllowedImports  []string `json:"allowed_imports,omitempty"`
+	AllowNetworking *bool    `json:"allow_networking,omitempty"`
+	AllowFileSystem *bool    `json:"allow_file_system,omitempty"`
+}
+
+// NetworkConfig overrides the network policy
+type NetworkConfig struct {
+	AllowOutbound *bool    `json:"allow_outbound,omitempty"`
+	AllowedHosts  []string `json:"allowed_hosts,omitempty"`
+	AllowedPorts  []int    `json:"allowed_ports,omitempty"`
+}
+
+// StorageConfig overrides the storage policy
+type StorageConfig struct {
+	AllowLocalStorage   *bool `json:"allow_local_storage,omitempty"`
+	AllowSessionStorage *bool `json:"allow_session_storage,omitempty"`
+	AllowIndexedDB      *bool `json:"allow_indexed_db,omitempty"`
+	AllowCookies        *bool `json:"allow_cookies,omitempty"`
+}
+
+// OptimizeConfig selects asset optimizations. Its quality, exclude and skip
+// settings are those of a build config.
+type OptimizeConfig struct {
+	// Stages are optimization stages, or all
+	Stages StageList `json:"stages,omitempty"`
+	optimize.AssetConfig
+}
+
+// StageList is a list of optimization stages, written as a list or as a
+// comma-separated string
+type StageList []string
+
+// UnmarshalJSON accepts a list or a string
+func (l *StageList) UnmarshalJSON(data []byte) error {
+	var list string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = strings.Split(list, ",")
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// String returns the stages as a comma-separated list
+func (l StageList) String() string {
+	return strings.Join(l, ",")
+}
+
+// SigningConfig signs the document with a key
+type SigningConfig struct {
+	Sign *bool  `json:"sign,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// BuildConfig sets build options otherwise given as flags
+type BuildConfig struct {
+	Compress            *bool  `json:"compress,omitempty"`
+	ImageVariants       *bool  `json:"image_variants,omitempty"`
+	Reproducible        *bool  `json:"reproducible,omitempty"`
+	AssetPolicy         string `json:"asset_policy,omitempty"`
+	SectionKeys         string `json:"section_keys,omitempty"`
+	Advisories          string `json:"advisories,omitempty"`
+	VulnerabilityPolicy string `json:"vulnerability_policy,omitempty"`
+	Attest              *bool  `json:"attest,omitempty"`
+}
+
+// Find returns the project file in dir, or "" when there is none
+func Find(dir string) string {
+	for _, name := range FileNames {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+// Load reads a project file, as YAML unless its name ends in .json. Unknown
+// settings are refused, so misspelled ones are not silently ignored.
+func Load(file string) (*Project, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project file: %v", err)
+	}
+	if !strings.EqualFold(filepath.Ext(file), ".json") {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("invalid project file %s: %v", file, err)
+		}
+	}
+
+	var p Project
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid project file %s: %v", file, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve project directory: %v", err)
+	}
+	p.File = file
+	p.Dir = dir
+
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid project file %s: %v", file, err)
+	}
+	return &p, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so both formats are read
+// into the same types
+func yamlToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(normalizeYAML(value))
+}
+
+// normalizeYAML turns mappings with non-string keys, which JSON cannot
+// represent, into mappings keyed by their string form
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+	}
+	return value
+}
+
+// Validate checks feature names, path patterns and optimization settings
+func (p *Project) Validate() error {
+	for name := range p.Features {
+		if err := (&core.FeatureFlags{}).Set(name, true); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range append(append([]string{}, p.Include...), p.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad path pattern %q", pattern)
+		}
+	}
+	if p.Optimize != nil {
+		if _, err := optimize.ParseStages(p.Optimize.Stages.String()); err != nil {
+			return err
+		}
+		if err := p.Optimize.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Signing != nil && p.Signing.Sign != nil && *p.Signing.Sign && p.Signing.Key == "" {
+		return fmt.Errorf("signing requires a key")
+	}
+	return nil
+}
+
+// ResolvePath expands environment variables in a path of the file and
+// resolves it against the directory of the file
+func (p *Project) ResolvePath(value string) string {
+	value = os.ExpandEnv(value)
+	if value == "" || filepath.IsAbs(value) {
+		return value
+	}
+	return filepath.Join(p.Dir, value)
+}
+
+// Filters reports whether the file limits the paths packaged
+func (p *Project) Filters() bool {
+	return len(p.Include) > 0 || len(p.Exclude) > 0
+}
+
+// Includes reports whether the source file at relPath, relative to the
+// input directory with forward slashes, is packaged
+func (p *Project) Includes(relPath string) bool {
+	if len(p.Include) > 0 && !matchAny(p.Include, relPath) {
+		return false
+	}
+	return !matchAny(p.Exclude, relPath)
+}
+
+// matchAny reports whether a pattern matches relPath, one of its
+// directories or, for patterns without a slash, its name
+func matchAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		if !strings.Contains(pattern, "/") {
+			for _, part := range strings.Split(relPath, "/") {
+				if ok, _ := path.Match(pattern, part); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for prefix := relPath; prefix != "."; prefix = path.Dir(prefix) {
+			if ok, _ := path.Match(pattern, prefix); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ApplyMetadata replaces the fields of metadata the file sets
+func (p *Project) ApplyMetadata(metadata *core.DocumentMetadata) {
+	if p.Metadata == nil {
+		return
+	}
+	set := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	set(&metadata.Title, p.Metadata.Title)
+	set(&metadata.Author, p.Metadata.Author)
+	set(&metadata.Description, p.Metadata.Description)
+	set(&metadata.Version, p.Metadata.Version)
+	set(&metadata.Language, p.Metadata.Language)
+	set(&metadata.Abstract, p.Metadata.Abstract)
+}
+
+// ApplySecurity overrides the parts of policy the file sets
+func (p *Project) ApplySecurity(policy *core.SecurityPolicy) {
+	s := p.Security
+	if s == nil {
+		return
+	}
+	if s.ContentSecurityPolicy != "" {
+		policy.ContentSecurityPolicy = s.ContentSecurityPolicy
+	}
+	if s.TrustedDomains != nil {
+		policy.TrustedDomains = s.TrustedDomains
+	}
+	if s.JS != nil && policy.JSPermissions != nil {
+		if s.JS.ExecutionMode != "" {
+			policy.JSPermissions.ExecutionMode = s.JS.ExecutionMode
+		}
+		if s.JS.AllowedAPIs != nil {
+			policy.JSPermissions.AllowedAPIs = s.JS.AllowedAPIs
+		}
+		if s.JS.DOMAccess != "" {
+			policy.JSPermissions.DOMAccess = s.JS.DOMAccess
+		}
+	}
+	if s.WASM != nil && policy.WASMPermissions != nil {
+		if s.WASM.MemoryLimit != 0 {
+			policy.WASMPermissions.MemoryLimit = s.WASM.MemoryLimit
+		}
+		if s.WASM.CPUTimeLimit != 0 {
+			policy.WASMPermissions.CPUTimeLimit = s.WASM.CPUTimeLimit
+		}
+		if s.WASM.AllowedImports != nil {
+			policy.WASMPermissions.AllowedImports = s.WASM.AllowedImports
+		}
+		setBool(&policy.WASMPermissions.AllowNetworking, s.WASM.AllowNetworking)
+		setBool(&policy.WASMPermissions.AllowFileSystem, s.WASM.AllowFileSystem)
+	}
+	if s.Network != nil && policy.NetworkPolicy != nil {
+		setBool(&policy.NetworkPolicy.AllowOutbound, s.Network.AllowOutbound)
+		if s.Network.AllowedHosts != nil {
+			policy.NetworkPolicy.AllowedHosts = s.Network.AllowedHosts
+		}
+		if s.Network.AllowedPorts != nil {
+			policy.NetworkPolicy.AllowedPorts = s.Network.AllowedPorts
+		}
+	}
+	if s.Storage != nil && policy.StoragePolicy != nil {
+		setBool(&policy.StoragePolicy.AllowLocalStorage, s.Storage.AllowLocalStorage)
+		setBool(&policy.StoragePolicy.AllowSessionStorage, s.Storage.AllowSessionStorage)
+		setBool(&policy.StoragePolicy.AllowIndexedDB, s.Storage.AllowIndexedDB)
+		setBool(&policy.StoragePolicy.AllowCookies, s.Storage.AllowCookies)
+	}
+}
+
+// ApplyFeatures turns the feature flags the file names on or off
+func (p *Project) ApplyFeatures(features *core.FeatureFlags) {
+	for name, enabled := range p.Features {
+		features.Set(name, enabled)
+	}
+}
+
+// setBool sets field when value is given
+func setBool(field *bool, value *bool) {
+	if value != nil {
+		*field = *value
+	}
+}
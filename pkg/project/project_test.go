@@ -0,0 +1,129 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+const testYAML = `metadata:
+  title: Annual Report
+  language: de
+security:
+  content_security_policy: "default-src 'self'"
+  network:
+    allow_outbound: true
+    allowed_hosts: [api.example.com]
+features:
+  audio: true
+  animations: false
+exclude: [drafts, "*.psd", assets/raw/*]
+optimize:
+  stages: images, minify
+  exclude: [logo.png]
+signing:
+  sign: true
+  key: $PROJECT_TEST_KEYS/signing.pem
+build:
+  compress: false
+`
+
+func TestLoadYAML(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "liv.yaml"), []byte(testYAML), 0644)
+	t.Setenv("PROJECT_TEST_KEYS", "/secrets")
+
+	file := Find(dir)
+	if file != filepath.Join(dir, "liv.yaml") {
+		t.Fatalf("Expected liv.yaml to be found, got %q", file)
+	}
+	p, err := Load(file)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p.Build.Compress == nil || *p.Build.Compress || p.Optimize.Stages.String() != "images, minify" || p.Optimize.Exclude[0] != "logo.png" {
+		t.Errorf("Unexpected settings %+v %+v", p.Build, p.Optimize)
+	}
+	if key := p.ResolvePath(p.Signing.Key); key != "/secrets/signing.pem" {
+		t.Errorf("Expected environment variables to be expanded, got %s", key)
+	}
+	if path := p.ResolvePath("advisories.json"); path != filepath.Join(p.Dir, "advisories.json") {
+		t.Errorf("Expected relative paths to resolve against the project directory, got %s", path)
+	}
+
+	metadata := &core.DocumentMetadata{Title: "LIV Document", Author: "LIV Builder", Language: "en"}
+	p.ApplyMetadata(metadata)
+	if metadata.Title != "Annual Report" || metadata.Language != "de" || metadata.Author != "LIV Builder" {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+
+	policy := &core.SecurityPolicy{
+		JSPermissions:  &core.JSPermissions{ExecutionMode: "sandboxed"},
+		NetworkPolicy:  &core.NetworkPolicy{},
+		StoragePolicy:  &core.StoragePolicy{AllowLocalStorage: true},
+		TrustedDomains: []string{},
+	}
+	p.ApplySecurity(policy)
+	if !policy.NetworkPolicy.AllowOutbound || len(policy.NetworkPolicy.AllowedHosts) != 1 || policy.ContentSecurityPolicy != "default-src 'self'" {
+		t.Errorf("Expected the network policy to be overridden: %+v", policy.NetworkPolicy)
+	}
+	if !policy.StoragePolicy.AllowLocalStorage || policy.JSPermissions.ExecutionMode != "sandboxed" {
+		t.Errorf("Expected settings the file leaves out to be kept")
+	}
+
+	features := &core.FeatureFlags{Animations: true}
+	p.ApplyFeatures(features)
+	if features.Animations || !features.Audio {
+		t.Errorf("Unexpected features %+v", features)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	p := &Project{Exclude: []string{"drafts", "*.psd", "assets/raw/*"}}
+	for relPath, expected := range map[string]bool{
+		"content/index.html":        true,
+		"drafts/notes.html":         false,
+		"content/drafts/old.html":   false,
+		"assets/images/cover.psd":   false,
+		"assets/raw/photo.png":      false,
+		"assets/raw/nested/raw.png": false,
+		"assets/images/photo.png":   true,
+	} {
+		if p.Includes(relPath) != expected {
+			t.Errorf("Expected Includes(%s) = %v", relPath, expected)
+		}
+	}
+
+	p = &Project{Include: []string{"content", "assets/images"}, Exclude: []string{"*.psd"}}
+	if !p.Includes("content/index.html") || p.Includes("assets/fonts/body.ttf") || p.Includes("assets/images/cover.psd") {
+		t.Errorf("Expected only included paths that are not excluded")
+	}
+}
+
+func TestLoadRefusesInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"liv.json":          `{"build": {"compres": false}}`,
+		"features.yaml":     "features:\n  holograms: true\n",
+		"stages.yaml":       "optimize:\n  stages: [avif]\n",
+		"pattern.yaml":      "exclude: [\"[a-\"]\n",
+		"signing.yaml":      "signing:\n  sign: true\n",
+		"syntax.yaml":       "metadata: [\n",
+		"quality.json":      `{"optimize": {"quality": 140}}`,
+		"unknownkey.yaml":   "metadata:\n  titel: Report\n",
+		"typemismatch.yaml": "build:\n  compress: maybe\n",
+	} {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte(content), 0644)
+		if _, err := Load(file); err == nil {
+			t.Errorf("Expected %s to be refused", name)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "empty.yaml"), nil, 0644)
+	if _, err := Load(filepath.Join(dir, "empty.yaml")); err != nil {
+		t.Errorf("Expected an empty project file to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+// Package readingstate keeps where readers are in documents: the bookmarks
+// they set and the place they last read. Viewers keep it in a Store by
+// document and reader, so it follows readers who sign in on another device.
+package readingstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/store"
+)
+
+// Limits on what a reading state holds
+const (
+	MaxBookmarks = 500
+	MaxLabel     = 200
+	MaxFragment  = 500
+)
+
+// ErrTooMany is returned for states with more than MaxBookmarks bookmarks
+var ErrTooMany = fmt.Errorf("documents may have at most %d bookmarks", MaxBookmarks)
+
+// Location is a place in a document
+type Location struct {
+	// Page is the package path of the page, as content/index.html
+	Page string `json:"page"`
+	// Fragment is the id of the element jumped to on the page, without #
+	Fragment string `json:"fragment,omitempty"`
+	// Scroll is how far down the page, as a fraction of its height
+	Scroll float64 `json:"scroll"`
+}
+
+// Validate checks that a location is on a page
+func (l *Location) Validate() error {
+	if l.Page == "" {
+		return fmt.Errorf("location has no page")
+	}
+	if len(l.Fragment) > MaxFragment {
+		return fmt.Errorf("fragment is longer than %d bytes", MaxFragment)
+	}
+	if math.IsNaN(l.Scroll) || l.Scroll < 0 || l.Scroll > 1 {
+		return fmt.Errorf("scroll position %v is not between 0 and 1", l.Scroll)
+	}
+	return nil
+}
+
+// Bookmark is a location a reader named to come back to
+type Bookmark struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Location
+	Created time.Time `json:"created"`
+}
+
+// State is where a reader is in a document
+type State struct {
+	Bookmarks []*Bookmark `json:"bookmarks"`
+	// Last is where the reader was when the state was last saved
+	Last     *Location `json:"last,omitempty"`
+	Modified time.Time `json:"modified"`
+}
+
+// Validate checks each bookmark and the last location of a state
+func (s *State) Validate() error {
+	if len(s.Bookmarks) > MaxBookmarks {
+		return ErrTooMany
+	}
+	for i, b := range s.Bookmarks {
+		if b == nil {
+			return fmt.Errorf("bookmark %d is empty", i+1)
+		}
+		if len(b.Label) > MaxLabel {
+			return fmt.Errorf("bookmark %d: label is longer than %d bytes", i+1, MaxLabel)
+		}
+		if err := b.Location.Validate(); err != nil {
+			return fmt.Errorf("bookmark %d: %w", i+1, err)
+		}
+	}
+	if s.Last != nil {
+		if err := s.Last.Validate(); err != nil {
+			return fmt.Errorf("last location: %w", err)
+		}
+	}
+	return nil
+}
+
+// Store keeps the reading states of stored documents in a directory, one
+// <document id>.json file per document holding the state of each reader. It
+// is safe for concurrent use.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore opens the reading states kept in dir
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create reading state directory: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Get returns the state of reader in a document, empty when they have none
+func (s *Store) Get(document, reader string) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states, err := s.read(document)
+	if err != nil {
+		return nil, err
+	}
+	if state, ok := states[reader]; ok {
+		return state, nil
+	}
+	return &State{Bookmarks: []*Bookmark{}}, nil
+}
+
+// Put replaces the state of reader in a document, giving new bookmarks an
+// ID and creation time. The last state put wins.
+func (s *Store) Put(document, reader string, state *State) (*State, error) {
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+	now := core.UTC(time.Now())
+	saved := *state
+	saved.Bookmarks = make([]*Bookmark, 0, len(state.Bookmarks))
+	ids := make(map[string]bool, len(state.Bookmarks))
+	for _, b := range state.Bookmarks {
+		bookmark := *b
+		if bookmark.ID == "" || ids[bookmark.ID] {
+			id, err := store.NewID()
+			if err != nil {
+				return nil, err
+			}
+			bookmark.ID = id
+		}
+		if bookmark.Created.IsZero() {
+			bookmark.Created = now
+		}
+		ids[bookmark.ID] = true
+		saved.Bookmarks = append(saved.Bookmarks, &bookmark)
+	}
+	saved.Modified = now
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states, err := s.read(document)
+	if err != nil {
+		return nil, err
+	}
+	states[reader] = &saved
+	if err := s.write(document, states); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (s *Store) path(document string) string {
+	return filepath.Join(s.dir, document+".json")
+}
+
+func (s *Store) read(document string) (map[string]*State, error) {
+	if !store.ValidID(document) {
+		return nil, store.ErrNotFound
+	}
+	states := make(map[string]*State)
+	data, err := os.ReadFile(s.path(document))
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reading states: %v", err)
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse reading states of %s: %v", document, err)
+	}
+	return states, nil
+}
+
+// write replaces the reading states of a document through a temporary file,
+// so a crash leaves the old or the new states
+func (s *Store) write(document string, states map[string]*State) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize reading states: %v", err)
+	}
+	if err := atomicfile.WriteFile(s.path(document), data, 0600); err != nil {
+		return fmt.Errorf("failed to write reading states: %v", err)
+	}
+	return nil
+}
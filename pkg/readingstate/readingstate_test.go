@@ -0,0 +1,75 @@
+package readingstate
+
+import (
+	"strings"
+	"testing"
+)
+
+const document = "0123456789abcdef0123456789abcdef"
+
+func TestStateValidate(t *testing.T) {
+	valid := &State{
+		Bookmarks: []*Bookmark{{Label: "Results", Location: Location{Page: "content/index.html", Fragment: "results", Scroll: 0.4}}},
+		Last:      &Location{Page: "content/appendix.html"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected %+v to be valid, got %v", valid, err)
+	}
+
+	invalid := map[string]*State{
+		"no page":             {Bookmarks: []*Bookmark{{Label: "x"}}},
+		"between 0 and 1":     {Last: &Location{Page: "content/index.html", Scroll: 1.5}},
+		"label is longer":     {Bookmarks: []*Bookmark{{Label: strings.Repeat("x", MaxLabel+1), Location: Location{Page: "content/index.html"}}}},
+		"bookmark 1 is empty": {Bookmarks: []*Bookmark{nil}},
+	}
+	for want, state := range invalid {
+		if err := state.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error about %q, got %v", want, err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err := s.Get(document, "alice"); err != nil || len(state.Bookmarks) != 0 || state.Last != nil {
+		t.Fatalf("Expected an empty state, got %+v, %v", state, err)
+	}
+
+	put, err := s.Put(document, "alice", &State{
+		Bookmarks: []*Bookmark{
+			{Label: "Results", Location: Location{Page: "content/index.html", Fragment: "results"}},
+			{Label: "Appendix", Location: Location{Page: "content/appendix.html", Scroll: 0.5}},
+		},
+		Last: &Location{Page: "content/index.html", Scroll: 0.25},
+	})
+	if err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	if put.Bookmarks[0].ID == "" || put.Bookmarks[0].ID == put.Bookmarks[1].ID || put.Bookmarks[0].Created.IsZero() || put.Modified.IsZero() {
+		t.Errorf("Expected distinct bookmark IDs and creation times, got %+v", put.Bookmarks)
+	}
+
+	// Bookmarks put again keep their ID and creation time
+	kept := *put.Bookmarks[0]
+	if _, err := s.Put(document, "alice", &State{Bookmarks: []*Bookmark{&kept}}); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	reopened, _ := NewStore(s.dir)
+	state, err := reopened.Get(document, "alice")
+	if err != nil || len(state.Bookmarks) != 1 || state.Bookmarks[0].ID != kept.ID || !state.Bookmarks[0].Created.Equal(kept.Created) || state.Last != nil {
+		t.Errorf("Expected the last state put to persist, got %+v, %v", state, err)
+	}
+
+	if other, err := s.Get(document, "bob"); err != nil || len(other.Bookmarks) != 0 {
+		t.Errorf("Expected readers to have their own state, got %+v, %v", other, err)
+	}
+	if _, err := s.Put(document, "alice", &State{Last: &Location{}}); err == nil {
+		t.Errorf("Expected an invalid state to be refused")
+	}
+	if _, err := s.Get("../secrets", "alice"); err == nil {
+		t.Errorf("Expected an invalid document ID to be refused")
+	}
+}
@@ -0,0 +1,249 @@
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// cgroupRoot is where the cgroup v2 hierarchy is mounted
+	cgroupRoot = "/sys/fs/cgroup"
+	// cgroup2Magic identifies a cgroup v2 filesystem in statfs
+	cgroup2Magic = 0x63677270
+	// cpuPeriod is the cpu.max period workers are given quota within
+	cpuPeriod = 100000
+)
+
+// detectCgroup checks that workers can be given cgroups under parent and
+// returns its path
+func detectCgroup(parent string, limits Limits) (string, error) {
+	if parent == "" {
+		own, err := ownCgroup()
+		if err != nil {
+			return "", err
+		}
+		parent = own
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(parent, &fs); err != nil {
+		return "", fmt.Errorf("cgroup %s is unavailable: %v", parent, err)
+	}
+	if fs.Type != cgroup2Magic {
+		return "", fmt.Errorf("%s is not a cgroup v2 hierarchy", parent)
+	}
+
+	if err := enableControllers(parent, limits); err != nil {
+		return "", err
+	}
+
+	// Creating a cgroup is the only reliable test of delegation
+	probe, err := os.MkdirTemp(parent, "liv-probe-")
+	if err != nil {
+		return "", fmt.Errorf("cgroup %s is not delegated to this process: %v", parent, err)
+	}
+	os.Remove(probe)
+
+	return parent, nil
+}
+
+// ownCgroup returns the cgroup v2 directory of this process
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("failed to read process cgroup: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, found := strings.CutPrefix(line, "0::"); found {
+			return filepath.Join(cgroupRoot, path), nil
+		}
+	}
+	return "", errors.New("this process is not in a cgroup v2 hierarchy")
+}
+
+// enableControllers makes the controllers needed for limits available to the
+// cgroups of workers
+func enableControllers(parent string, limits Limits) error {
+	var needed []string
+	if limits.Memory > 0 {
+		needed = append(needed, "memory")
+	}
+	if limits.CPUTime > 0 || limits.CPUs > 0 {
+		needed = append(needed, "cpu")
+	}
+	if limits.Processes > 0 {
+		needed = append(needed, "pids")
+	}
+
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("failed to read controllers of %s: %v", parent, err)
+	}
+	enabled := make(map[string]bool)
+	for _, controller := range strings.Fields(string(data)) {
+		enabled[controller] = true
+	}
+
+	var missing []string
+	for _, controller := range needed {
+		if !enabled[controller] {
+			missing = append(missing, "+"+controller)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	// Fails with EBUSY when parent itself holds processes, as cgroup v2 only
+	// lets leaf cgroups contain them
+	if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(strings.Join(missing, " ")), 0644); err != nil {
+		return fmt.Errorf("controllers %s cannot be enabled in %s: %v", strings.Join(missing, " "), parent, err)
+	}
+	return nil
+}
+
+// cgroup is the cgroup of one worker
+type cgroup struct {
+	dir string
+}
+
+// createCgroup creates a cgroup under parent and applies limits to it
+func createCgroup(parent string, limits Limits) (*cgroup, error) {
+	dir, err := os.MkdirTemp(parent, "liv-worker-")
+	if err != nil {
+		return nil, err
+	}
+	c := &cgroup{dir: dir}
+
+	settings := make(map[string]string)
+	if limits.Memory > 0 {
+		settings["memory.max"] = strconv.FormatInt(limits.Memory, 10)
+		// Swapping would let a worker exceed its memory limit unnoticed
+		settings["memory.swap.max"] = "0"
+	}
+	if limits.CPUs > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d %d", int64(limits.CPUs*cpuPeriod), cpuPeriod)
+	}
+	if limits.Processes > 0 {
+		settings["pids.max"] = strconv.Itoa(limits.Processes)
+	}
+	for name, value := range settings {
+		if err := c.write(name, value); err != nil {
+			if name == "memory.swap.max" && os.IsNotExist(err) {
+				// Kernels without swap accounting
+				continue
+			}
+			c.remove()
+			return nil, fmt.Errorf("failed to set %s: %v", name, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *cgroup) write(name, value string) error {
+	file, err := os.OpenFile(filepath.Join(c.dir, name), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(value)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// stat reads a key from a flat keyed file such as cpu.stat or memory.events
+func (c *cgroup) stat(name, key string) int64 {
+	file, err := os.Open(filepath.Join(c.dir, name))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			value, _ := strconv.ParseInt(fields[1], 10, 64)
+			return value
+		}
+	}
+	return 0
+}
+
+// cpuTime returns the CPU time used by the processes of the cgroup
+func (c *cgroup) cpuTime() time.Duration {
+	return time.Duration(c.stat("cpu.stat", "usage_usec")) * time.Microsecond
+}
+
+// peakMemory returns the most memory the cgroup used, where the kernel records it
+func (c *cgroup) peakMemory() int64 {
+	data, err := os.ReadFile(filepath.Join(c.dir, "memory.peak"))
+	if err != nil {
+		return 0
+	}
+	peak, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return peak
+}
+
+// oomKills returns how many processes the kernel killed for exceeding memory.max
+func (c *cgroup) oomKills() int64 {
+	return c.stat("memory.events", "oom_kill")
+}
+
+// kill kills every process in the cgroup
+func (c *cgroup) kill() error {
+	if err := c.write("cgroup.kill", "1"); err == nil {
+		return nil
+	}
+	// Kernels before 5.14 have no cgroup.kill
+	data, err := os.ReadFile(filepath.Join(c.dir, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	return nil
+}
+
+// remove deletes the cgroup once its processes are gone
+func (c *cgroup) remove() {
+	for attempt := 0; attempt < 50; attempt++ {
+		err := os.Remove(c.dir)
+		if err == nil || os.IsNotExist(err) {
+			return
+		}
+		// Killed processes leave the cgroup asynchronously
+		c.kill()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// start starts cmd directly inside the cgroup, so the worker cannot allocate
+// or fork before its limits apply
+func start(cmd *exec.Cmd, c *cgroup) error {
+	if c == nil {
+		return cmd.Start()
+	}
+	dir, err := os.Open(c.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return cmd.Start()
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// detectCgroup reports that cgroups are unavailable on this platform
+func detectCgroup(parent string, limits Limits) (string, error) {
+	return "", errors.New("cgroups are only available on Linux")
+}
+
+// cgroup is never created outside Linux
+type cgroup struct{}
+
+func createCgroup(parent string, limits Limits) (*cgroup, error) {
+	return nil, errors.New("cgroups are only available on Linux")
+}
+
+func (c *cgroup) cpuTime() time.Duration { return 0 }
+func (c *cgroup) peakMemory() int64      { return 0 }
+func (c *cgroup) oomKills() int64        { return 0 }
+func (c *cgroup) kill() error            { return errors.New("cgroups are only available on Linux") }
+func (c *cgroup) remove()                {}
+
+func start(cmd *exec.Cmd, c *cgroup) error {
+	return cmd.Start()
+}
@@ -0,0 +1,216 @@
+// Package sandbox runs worker subprocesses that process untrusted documents
+// under resource limits. On Linux each worker is placed in its own cgroup v2
+// with memory, CPU and process limits; elsewhere, or when no cgroup is
+// delegated to this process, workers are only bounded by a timeout and the
+// sandbox reports why in Degraded.
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/liv-format/liv/pkg/security"
+)
+
+// Errors returned when a worker exceeds its limits
+var (
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+	ErrCPULimit    = errors.New("CPU time limit exceeded")
+	ErrTimeout     = errors.New("time limit exceeded")
+)
+
+// cpuPollInterval is how often the CPU time of a worker is checked
+const cpuPollInterval = 50 * time.Millisecond
+
+// Limits bounds the resources of one worker. Zero means unlimited.
+type Limits struct {
+	// Memory is the most memory, in bytes, the worker may use
+	Memory int64
+	// CPUTime is the total CPU time the worker may consume
+	CPUTime time.Duration
+	// CPUs is how many CPUs' worth of time the worker may use at once
+	CPUs float64
+	// Processes caps the processes and threads of the worker
+	Processes int
+	// Timeout is the wall-clock time the worker may run
+	Timeout time.Duration
+}
+
+// DefaultLimits are used when no policy applies
+var DefaultLimits = Limits{
+	Memory:    256 << 20,
+	CPUTime:   30 * time.Second,
+	CPUs:      1,
+	Processes: 64,
+	Timeout:   time.Minute,
+}
+
+// LimitsFromPolicy derives worker limits from a security policy's resource
+// limits: MaxMemoryPerDocument in bytes, MaxCPUTimePerDocument in
+// milliseconds and DocumentTimeoutSeconds. Limits the policy leaves unset keep
+// their defaults.
+func LimitsFromPolicy(resources *security.ResourceLimits) Limits {
+	limits := DefaultLimits
+	if resources == nil {
+		return limits
+	}
+	if resources.MaxMemoryPerDocument > 0 {
+		limits.Memory = resources.MaxMemoryPerDocument
+	}
+	if resources.MaxCPUTimePerDocument > 0 {
+		limits.CPUTime = time.Duration(resources.MaxCPUTimePerDocument) * time.Millisecond
+	}
+	if resources.DocumentTimeoutSeconds > 0 {
+		limits.Timeout = time.Duration(resources.DocumentTimeoutSeconds) * time.Second
+	}
+	return limits
+}
+
+// Usage reports the resources a worker used
+type Usage struct {
+	CPUTime    time.Duration
+	PeakMemory int64
+	// Enforced is false when the worker ran without cgroup limits
+	Enforced bool
+}
+
+// Sandbox runs workers under a fixed set of limits. It is safe for concurrent
+// use.
+type Sandbox struct {
+	limits Limits
+	parent string
+	reason string
+}
+
+// New prepares a sandbox whose workers get cgroups under parent, a cgroup v2
+// directory delegated to this process. An empty parent uses the cgroup of this
+// process. When cgroups cannot be used the sandbox still runs workers.
+func New(limits Limits, parent string) *Sandbox {
+	s := &Sandbox{limits: limits}
+	dir, err := detectCgroup(parent, limits)
+	if err != nil {
+		s.reason = err.Error()
+	} else {
+		s.parent = dir
+	}
+	return s
+}
+
+// Limits returns the limits applied to each worker
+func (s *Sandbox) Limits() Limits {
+	return s.limits
+}
+
+// Tighten returns a sandbox sharing the cgroup of s whose workers get the lower
+// of each limit of s and limits. Zero in limits keeps the limit of s; limits s
+// leaves unlimited stay unlimited, as their cgroup controllers may not be
+// enabled.
+func (s *Sandbox) Tighten(limits Limits) *Sandbox {
+	tight := *s
+	if limits.Memory > 0 && tight.limits.Memory > limits.Memory {
+		tight.limits.Memory = limits.Memory
+	}
+	if limits.CPUTime > 0 && tight.limits.CPUTime > limits.CPUTime {
+		tight.limits.CPUTime = limits.CPUTime
+	}
+	if limits.CPUs > 0 && tight.limits.CPUs > limits.CPUs {
+		tight.limits.CPUs = limits.CPUs
+	}
+	if limits.Processes > 0 && tight.limits.Processes > limits.Processes {
+		tight.limits.Processes = limits.Processes
+	}
+	if limits.Timeout > 0 && tight.limits.Timeout > limits.Timeout {
+		tight.limits.Timeout = limits.Timeout
+	}
+	return &tight
+}
+
+// Enforced reports whether workers run under cgroup limits
+func (s *Sandbox) Enforced() bool {
+	return s.parent != ""
+}
+
+// Degraded explains why workers run without cgroup limits, or returns an empty
+// string when they are enforced
+func (s *Sandbox) Degraded() string {
+	return s.reason
+}
+
+// Run starts cmd as a worker and waits for it. A worker that exceeds its
+// limits is killed and Run returns ErrMemoryLimit, ErrCPULimit or ErrTimeout;
+// other failures are returned as from cmd.Wait.
+func (s *Sandbox) Run(ctx context.Context, cmd *exec.Cmd) (*Usage, error) {
+	if s.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.limits.Timeout)
+		defer cancel()
+	}
+
+	var group *cgroup
+	if s.parent != "" {
+		var err error
+		group, err = createCgroup(s.parent, s.limits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create worker cgroup: %v", err)
+		}
+		defer group.remove()
+	}
+
+	if err := start(cmd, group); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var poll <-chan time.Time
+	if group != nil && s.limits.CPUTime > 0 {
+		ticker := time.NewTicker(cpuPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	var waitErr, limitErr error
+	exited := false
+	for !exited && limitErr == nil {
+		select {
+		case waitErr = <-done:
+			exited = true
+		case <-ctx.Done():
+			limitErr = ctx.Err()
+			if errors.Is(limitErr, context.DeadlineExceeded) {
+				limitErr = ErrTimeout
+			}
+		case <-poll:
+			if group.cpuTime() >= s.limits.CPUTime {
+				limitErr = ErrCPULimit
+			}
+		}
+	}
+	if !exited {
+		if group == nil || group.kill() != nil {
+			cmd.Process.Kill()
+		}
+		<-done
+	}
+
+	usage := &Usage{Enforced: group != nil}
+	if group != nil {
+		usage.CPUTime = group.cpuTime()
+		usage.PeakMemory = group.peakMemory()
+		if limitErr == nil && group.oomKills() > 0 {
+			limitErr = ErrMemoryLimit
+		}
+	} else if cmd.ProcessState != nil {
+		usage.CPUTime = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+
+	if limitErr != nil {
+		return usage, limitErr
+	}
+	return usage, waitErr
+}
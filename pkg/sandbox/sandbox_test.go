@@ -0,0 +1,133 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/security"
+)
+
+// TestHelperProcess is the worker started by the tests, not a test itself
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("LIV_SANDBOX_HELPER") {
+	case "echo":
+		os.Stdout.WriteString("processed")
+		os.Exit(0)
+	case "fail":
+		os.Stderr.WriteString("invalid document")
+		os.Exit(2)
+	case "sleep":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	case "allocate":
+		var chunks [][]byte
+		for i := 0; i < 64; i++ {
+			chunk := make([]byte, 8<<20)
+			for j := range chunk {
+				chunk[j] = byte(j)
+			}
+			chunks = append(chunks, chunk)
+		}
+		os.Exit(len(chunks) - 64)
+	case "spin":
+		for start := time.Now(); time.Since(start) < time.Minute; {
+		}
+		os.Exit(0)
+	}
+}
+
+func helper(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "LIV_SANDBOX_HELPER="+mode)
+	return cmd
+}
+
+func TestRunWithoutCgroups(t *testing.T) {
+	// A plain directory is not a cgroup, so workers run with the timeout only
+	s := New(Limits{Memory: 64 << 20, Timeout: 2 * time.Second}, t.TempDir())
+	if s.Enforced() || s.Degraded() == "" {
+		t.Fatalf("expected the sandbox to degrade, enforced=%v reason=%q", s.Enforced(), s.Degraded())
+	}
+
+	cmd := helper("echo")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	usage, err := s.Run(context.Background(), cmd)
+	if err != nil || stdout.String() != "processed" {
+		t.Fatalf("expected the worker to run, got %q: %v", stdout.String(), err)
+	}
+	if usage.Enforced {
+		t.Error("expected usage to report unenforced limits")
+	}
+
+	cmd = helper("fail")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	_, err = s.Run(context.Background(), cmd)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 || stderr.String() != "invalid document" {
+		t.Errorf("expected the worker's failure, got %v (%q)", err, stderr.String())
+	}
+
+	s = New(Limits{Timeout: 200 * time.Millisecond}, t.TempDir())
+	start := time.Now()
+	if _, err := s.Run(context.Background(), helper("sleep")); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the worker to be killed at the timeout, took %v", elapsed)
+	}
+}
+
+func TestRunWithCgroups(t *testing.T) {
+	limits := Limits{Memory: 64 << 20, CPUTime: 500 * time.Millisecond, Processes: 64, Timeout: 30 * time.Second}
+	s := New(limits, os.Getenv("LIV_SANDBOX_CGROUP"))
+	if !s.Enforced() {
+		t.Skipf("cgroup limits unavailable: %s", s.Degraded())
+	}
+
+	usage, err := s.Run(context.Background(), helper("echo"))
+	if err != nil || !usage.Enforced {
+		t.Fatalf("expected the worker to run under cgroup limits: %v", err)
+	}
+	if _, err := s.Run(context.Background(), helper("allocate")); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("expected the memory limit, got %v", err)
+	}
+	if _, err := s.Run(context.Background(), helper("spin")); !errors.Is(err, ErrCPULimit) {
+		t.Errorf("expected the CPU time limit, got %v", err)
+	}
+}
+
+func TestLimitsFromPolicy(t *testing.T) {
+	limits := LimitsFromPolicy(&security.ResourceLimits{
+		MaxMemoryPerDocument:   32 * 1024 * 1024,
+		MaxCPUTimePerDocument:  10000,
+		DocumentTimeoutSeconds: 120,
+	})
+	if limits.Memory != 32<<20 || limits.CPUTime != 10*time.Second || limits.Timeout != 2*time.Minute {
+		t.Errorf("unexpected limits: %+v", limits)
+	}
+	if limits.CPUs != DefaultLimits.CPUs || limits.Processes != DefaultLimits.Processes {
+		t.Errorf("expected limits outside the policy to keep their defaults: %+v", limits)
+	}
+	if limits := LimitsFromPolicy(nil); limits != DefaultLimits {
+		t.Errorf("expected the defaults without a policy, got %+v", limits)
+	}
+}
+
+func TestTighten(t *testing.T) {
+	s := New(Limits{Memory: 64 << 20, Timeout: time.Minute, CPUs: 2}, t.TempDir())
+	tight := s.Tighten(Limits{Memory: 16 << 20, Timeout: 2 * time.Minute, CPUTime: time.Second, CPUs: 1})
+	expected := Limits{Memory: 16 << 20, Timeout: time.Minute, CPUs: 1}
+	if tight.Limits() != expected {
+		t.Errorf("expected %+v, got %+v", expected, tight.Limits())
+	}
+	if s.Limits().Memory != 64<<20 || tight.Degraded() != s.Degraded() {
+		t.Errorf("expected the original sandbox to be unchanged, got %+v", s.Limits())
+	}
+}
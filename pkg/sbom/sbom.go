@@ -0,0 +1,506 @@
+// Package sbom inventories the contents of LIV documents as CycloneDX
+// software bills of materials, so embedded assets, WASM modules, fonts and the
+// toolchain that built a document can be audited like any software artifact.
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/compliance"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/ogimage"
+	"github.com/liv-format/liv/pkg/printstyle"
+)
+
+const (
+	// Entry is the package path of the SBOM written at build time
+	Entry = "sbom.cdx.json"
+
+	// ContentType is the media type of CycloneDX JSON documents
+	ContentType = "application/vnd.cyclonedx+json"
+
+	// SpecVersion is the CycloneDX specification the SBOM follows
+	SpecVersion = "1.5"
+
+	// DocumentRef is the bom-ref of the document itself
+	DocumentRef = "document"
+
+	// maxLicenseName bounds license names taken from font name tables, which
+	// often hold the full license text
+	maxLicenseName = 200
+)
+
+// BOM is a CycloneDX bill of materials
+type BOM struct {
+	BOMFormat    string        `json:"bomFormat"`
+	SpecVersion  string        `json:"specVersion"`
+	SerialNumber string        `json:"serialNumber"`
+	Version      int           `json:"version"`
+	Metadata     *Metadata     `json:"metadata"`
+	Components   []*Component  `json:"components"`
+	Dependencies []*Dependency `json:"dependencies,omitempty"`
+}
+
+// Metadata describes the document the BOM inventories and how it was built
+type Metadata struct {
+	Timestamp string     `json:"timestamp"`
+	Tools     *Tools     `json:"tools,omitempty"`
+	Component *Component `json:"component"`
+}
+
+// Tools lists the toolchain that built the document
+type Tools struct {
+	Components []*Component `json:"components"`
+}
+
+// Component is one embedded asset or toolchain module
+type Component struct {
+	BOMRef             string               `json:"bom-ref,omitempty"`
+	Type               string               `json:"type"`
+	Name               string               `json:"name"`
+	Version            string               `json:"version,omitempty"`
+	Description        string               `json:"description,omitempty"`
+	MimeType           string               `json:"mime-type,omitempty"`
+	Copyright          string               `json:"copyright,omitempty"`
+	Hashes             []*Hash              `json:"hashes,omitempty"`
+	Licenses           []*LicenseChoice     `json:"licenses,omitempty"`
+	PURL               string               `json:"purl,omitempty"`
+	ExternalReferences []*ExternalReference `json:"externalReferences,omitempty"`
+	Properties         []*Property          `json:"properties,omitempty"`
+}
+
+// Hash is a digest of a component
+type Hash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// LicenseChoice names a license by SPDX expression or by name and URL
+type LicenseChoice struct {
+	License    *License `json:"license,omitempty"`
+	Expression string   `json:"expression,omitempty"`
+}
+
+// License is a license that has no SPDX identifier
+type License struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// ExternalReference points to a resource outside the document
+type ExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Property is a name-value pair under the liv: namespace
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Dependency records the components a component is derived from
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// Options configures SBOM generation
+type Options struct {
+	// Timestamp is recorded as the time the BOM was made
+	Timestamp time.Time
+	// Tools lists the toolchain that built the document
+	Tools []*Component
+}
+
+// Mismatch is a component whose recorded hash no longer matches the package
+type Mismatch struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+var fontExtensions = map[string]bool{".ttf": true, ".otf": true, ".ttc": true, ".woff": true, ".woff2": true}
+
+// libraryBanner matches the comment bundled libraries open with, such as
+// "/*! jQuery v3.4.1 | (c) OpenJS Foundation" or "/** @license React v16.13.1"
+var libraryBanner = regexp.MustCompile(`^\s*(?:/\*[!*]?|//)\s*(?:@license\s+)?([A-Za-z][\w.-]*)\s+v?(\d+\.\d+(?:\.\d+)?(?:-[\w.]+)?)\b`)
+
+// Generate inventories every file of a package. Hashes are taken from the
+// files themselves, so the BOM describes what is shipped even when the
+// manifest is out of date. The same files and options always produce the
+// same BOM.
+func Generate(files map[string][]byte, manifest *core.Manifest, opts Options) (*BOM, error) {
+	if manifest == nil || manifest.Metadata == nil {
+		return nil, fmt.Errorf("manifest metadata is required")
+	}
+
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		if filePath == "manifest.json" || filePath == Entry {
+			continue
+		}
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	origins := resourceOrigins(manifest)
+	modules := wasmModules(manifest)
+
+	bom := &BOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: SpecVersion,
+		Version:     1,
+		Metadata: &Metadata{
+			Timestamp: opts.Timestamp.UTC().Format(time.RFC3339),
+			Component: documentComponent(manifest),
+		},
+		Components: make([]*Component, 0, len(paths)),
+	}
+	if len(opts.Tools) > 0 {
+		bom.Metadata.Tools = &Tools{Components: opts.Tools}
+	}
+
+	var derived []*Dependency
+	for _, filePath := range paths {
+		data := files[filePath]
+		component := &Component{
+			BOMRef: filePath,
+			Type:   "file",
+			Name:   filePath,
+			Hashes: []*Hash{{Alg: "SHA-256", Content: sha256Hex(data)}},
+		}
+		if resource, ok := manifest.Resources[filePath]; ok {
+			component.MimeType = resource.Type
+		} else {
+			component.Properties = append(component.Properties, &Property{Name: "liv:unlisted", Value: "true"})
+		}
+
+		kind := kindOf(filePath, component.MimeType)
+		component.Properties = append(component.Properties, &Property{Name: "liv:kind", Value: kind})
+		if origin, ok := origins[filePath]; ok {
+			component.Properties = append(component.Properties, &Property{Name: "liv:origin", Value: origin.origin})
+			if origin.derivedFrom != "" {
+				component.Properties = append(component.Properties, &Property{Name: "liv:derived-from", Value: origin.derivedFrom})
+				derived = append(derived, &Dependency{Ref: filePath, DependsOn: []string{origin.derivedFrom}})
+			}
+		}
+
+		switch kind {
+		case "wasm":
+			component.Type = "library"
+			if module, ok := modules[filePath]; ok {
+				component.Name = module.Name
+				component.Version = module.Version
+			}
+		case "script":
+			identifyLibrary(component, data)
+		case "font":
+			describeFont(component, data)
+		case "media":
+			describeMedia(component, data)
+		}
+
+		bom.Components = append(bom.Components, component)
+	}
+
+	if len(derived) > 0 {
+		bom.Dependencies = derived
+	}
+
+	serial, err := serialNumber(bom)
+	if err != nil {
+		return nil, err
+	}
+	bom.SerialNumber = serial
+	return bom, nil
+}
+
+// Marshal serializes a BOM as indented JSON
+func Marshal(bom *BOM) ([]byte, error) {
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize SBOM: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Parse reads a BOM written by Marshal
+func Parse(data []byte) (*BOM, error) {
+	var bom BOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		return nil, fmt.Errorf("failed to parse SBOM: %v", err)
+	}
+	if bom.BOMFormat != "CycloneDX" {
+		return nil, fmt.Errorf("not a CycloneDX SBOM: %q", bom.BOMFormat)
+	}
+	return &bom, nil
+}
+
+// Verify compares the file components of a BOM with the files of a package
+// and returns those whose hash differs or that are missing
+func Verify(bom *BOM, files map[string][]byte) []*Mismatch {
+	var mismatches []*Mismatch
+	for _, component := range bom.Components {
+		filePath := component.BOMRef
+		expected := ""
+		for _, hash := range component.Hashes {
+			if hash.Alg == "SHA-256" {
+				expected = hash.Content
+			}
+		}
+		if expected == "" {
+			continue
+		}
+		data, ok := files[filePath]
+		if !ok {
+			mismatches = append(mismatches, &Mismatch{Path: filePath, Expected: expected})
+			continue
+		}
+		if actual := sha256Hex(data); actual != expected {
+			mismatches = append(mismatches, &Mismatch{Path: filePath, Expected: expected, Actual: actual})
+		}
+	}
+	return mismatches
+}
+
+// Toolchain lists the program running this code, the Go toolchain it was built
+// with and the modules it links, as recorded in its build information
+func Toolchain() []*Component {
+	tools := []*Component{}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return append(tools, goComponent(runtime.Version()))
+	}
+
+	if info.Path != "" {
+		program := &Component{
+			Type:    "application",
+			Name:    info.Path,
+			Version: info.Main.Version,
+			PURL:    goPURL(info.Main.Path, info.Main.Version),
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				program.Properties = append(program.Properties, &Property{Name: "liv:" + setting.Key, Value: setting.Value})
+			}
+		}
+		tools = append(tools, program)
+	}
+	tools = append(tools, goComponent(info.GoVersion))
+
+	deps := make([]*debug.Module, 0, len(info.Deps))
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Path < deps[j].Path })
+	for _, dep := range deps {
+		component := &Component{
+			Type:    "library",
+			Name:    dep.Path,
+			Version: dep.Version,
+			PURL:    goPURL(dep.Path, dep.Version),
+		}
+		if dep.Sum != "" {
+			component.Properties = []*Property{{Name: "liv:go-sum", Value: dep.Sum}}
+		}
+		tools = append(tools, component)
+	}
+	return tools
+}
+
+// origin records where a generated or derived resource came from
+type origin struct {
+	origin      string
+	derivedFrom string
+}
+
+// resourceOrigins returns the origin of resources the builder generated or
+// derived from other resources
+func resourceOrigins(manifest *core.Manifest) map[string]origin {
+	origins := map[string]origin{
+		ogimage.Entry:    {origin: "generated: preview card rendered by the builder"},
+		printstyle.Entry: {origin: "generated: print stylesheet written by the builder"},
+	}
+	for resourcePath, resource := range manifest.Resources {
+		for _, variant := range resource.Variants {
+			origins[variant.Path] = origin{origin: "derived: variant rendition", derivedFrom: resourcePath}
+		}
+	}
+	if manifest.Disclosure != nil {
+		for id, section := range manifest.Disclosure.Sections {
+			origins[section.Path] = origin{origin: "sealed: confidential section " + id}
+		}
+	}
+	return origins
+}
+
+// wasmModules maps the package paths of WASM modules to their configuration
+func wasmModules(manifest *core.Manifest) map[string]*core.WASMModule {
+	modules := map[string]*core.WASMModule{}
+	if manifest.WASMConfig == nil {
+		return modules
+	}
+	for _, module := range manifest.WASMConfig.Modules {
+		if modulePath := module.Metadata["path"]; modulePath != "" {
+			modules[modulePath] = module
+		}
+	}
+	return modules
+}
+
+// documentComponent describes the document the BOM inventories
+func documentComponent(manifest *core.Manifest) *Component {
+	metadata := manifest.Metadata
+	component := &Component{
+		BOMRef:      DocumentRef,
+		Type:        "file",
+		Name:        metadata.Title,
+		Version:     metadata.Version,
+		Description: metadata.Description,
+	}
+	if manifest.License != nil {
+		if manifest.License.SPDX != "" {
+			component.Licenses = []*LicenseChoice{{Expression: manifest.License.SPDX}}
+		} else if manifest.License.Terms != "" || manifest.License.URL != "" {
+			component.Licenses = []*LicenseChoice{{License: &License{Name: truncate(manifest.License.Terms), URL: manifest.License.URL}}}
+		}
+		component.Copyright = manifest.License.Holder
+	}
+	return component
+}
+
+// kindOf classifies a package file for auditors
+func kindOf(filePath, mimeType string) string {
+	ext := strings.ToLower(path.Ext(filePath))
+	switch {
+	case ext == ".enc":
+		return "encrypted"
+	case ext == ".wasm" || mimeType == "application/wasm":
+		return "wasm"
+	case fontExtensions[ext] || strings.HasPrefix(mimeType, "font/"):
+		return "font"
+	case ext == ".js" || ext == ".mjs":
+		return "script"
+	case ext == ".css":
+		return "stylesheet"
+	case ext == ".html" || ext == ".htm":
+		return "content"
+	case strings.HasPrefix(mimeType, "image/"), strings.HasPrefix(mimeType, "audio/"), strings.HasPrefix(mimeType, "video/"), ext == ".pdf":
+		return "media"
+	case strings.HasPrefix(filePath, "signatures/"):
+		return "signature"
+	default:
+		return "data"
+	}
+}
+
+// identifyLibrary names a script after the library its banner comment
+// declares, so bundled copies of known libraries can be matched against
+// advisories
+func identifyLibrary(component *Component, data []byte) {
+	if len(data) > 1024 {
+		data = data[:1024]
+	}
+	match := libraryBanner.FindSubmatch(data)
+	if match == nil {
+		return
+	}
+	name := strings.ToLower(string(match[1]))
+	component.Type = "library"
+	component.Name = name
+	component.Version = string(match[2])
+	component.PURL = "pkg:npm/" + name + "@" + component.Version
+}
+
+// describeFont records the copyright, license and embedding permissions
+// stored in a font
+func describeFont(component *Component, data []byte) {
+	font, err := compliance.InspectFont(data)
+	if err != nil {
+		return
+	}
+	component.Copyright = font.Copyright
+	if font.License != "" || font.LicenseURL != "" {
+		component.Licenses = []*LicenseChoice{{License: &License{Name: truncate(font.License), URL: font.LicenseURL}}}
+	}
+	component.Properties = append(component.Properties, &Property{Name: "liv:font-embedding", Value: font.Embedding})
+}
+
+// describeMedia records the rights stored in the XMP packet of a media file
+func describeMedia(component *Component, data []byte) {
+	rights := compliance.ExtractXMP(data)
+	if rights == nil {
+		return
+	}
+	component.Copyright = rights.Rights
+	if component.Copyright == "" && rights.Owner != "" {
+		component.Copyright = rights.Owner
+	}
+	switch {
+	case rights.License != "" && strings.Contains(rights.License, "://"):
+		component.Licenses = []*LicenseChoice{{License: &License{URL: rights.License}}}
+	case rights.License != "":
+		component.Licenses = []*LicenseChoice{{License: &License{Name: truncate(rights.License)}}}
+	case rights.UsageTerms != "":
+		component.Licenses = []*LicenseChoice{{License: &License{Name: truncate(rights.UsageTerms)}}}
+	}
+	if rights.WebStatement != "" {
+		component.ExternalReferences = []*ExternalReference{{Type: "license", URL: rights.WebStatement}}
+	}
+}
+
+// serialNumber derives the serial number from the content of the BOM, so the
+// same document always carries the same serial number
+func serialNumber(bom *BOM) (string, error) {
+	data, err := json.Marshal(bom)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize SBOM: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	uuid := sum[:16]
+	uuid[6] = (uuid[6] & 0x0f) | 0x50
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16]), nil
+}
+
+func goComponent(version string) *Component {
+	return &Component{Type: "application", Name: "go", Version: version, PURL: "pkg:golang/std@" + version}
+}
+
+func goPURL(modulePath, version string) string {
+	if version == "" || version == "(devel)" {
+		return "pkg:golang/" + modulePath
+	}
+	return "pkg:golang/" + modulePath + "@" + version
+}
+
+func truncate(text string) string {
+	text = strings.TrimSpace(text)
+	if line := strings.IndexByte(text, '\n'); line != -1 {
+		text = strings.TrimSpace(text[:line])
+	}
+	if len(text) > maxLicenseName {
+		text = strings.TrimSpace(strings.ToValidUTF8(text[:maxLicenseName], "")) + "..."
+	}
+	return text
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
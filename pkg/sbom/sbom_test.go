@@ -0,0 +1,204 @@
+package sbom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func testDocument() (map[string][]byte, *core.Manifest) {
+	files := map[string][]byte{
+		"manifest.json":            []byte("{}"),
+		"content/index.html":       []byte("<h1>Report</h1>"),
+		"assets/images/chart.png":  []byte("\x89PNG chart"),
+		"assets/images/chart.webp": []byte("RIFF chart"),
+		"assets/images/photo.jpg": []byte("\xff\xd8\xff\xe1" + `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:xmpRights="http://ns.adobe.com/xap/1.0/rights/" xmlns:cc="http://creativecommons.org/ns#" xmpRights:WebStatement="https://example.com/rights" cc:license="https://creativecommons.org/licenses/by/4.0/"/>
+</rdf:RDF></x:xmpmeta>` + "\xff\xd9"),
+		"wasm/engine.wasm":              []byte("\x00asm\x01\x00\x00\x00"),
+		"content/stray.txt":             []byte("not in the manifest"),
+		"content/styles/a.css":          []byte("h1 { color: red }"),
+		"content/scripts/jquery.min.js": []byte("/*! jQuery v3.4.1 | (c) JS Foundation and other contributors | jquery.org/license */\n!function(e,t){}"),
+	}
+	manifest := &core.Manifest{
+		Version: "1.0",
+		Metadata: &core.DocumentMetadata{
+			Title:   "Quarterly report",
+			Version: "2.1.0",
+		},
+		Resources: map[string]*core.Resource{
+			"content/index.html":            {Type: "text/html"},
+			"assets/images/chart.png":       {Type: "image/png", Variants: []*core.ResourceVariant{{Path: "assets/images/chart.webp", Quality: "low"}}},
+			"assets/images/chart.webp":      {Type: "image/webp"},
+			"assets/images/photo.jpg":       {Type: "image/jpeg"},
+			"wasm/engine.wasm":              {Type: "application/wasm"},
+			"content/styles/a.css":          {Type: "text/css"},
+			"content/scripts/jquery.min.js": {Type: "application/javascript"},
+		},
+		WASMConfig: &core.WASMConfiguration{
+			Modules: map[string]*core.WASMModule{
+				"engine": {Name: "engine", Version: "1.4.2", Metadata: map[string]string{"path": "wasm/engine.wasm"}},
+			},
+		},
+		License: &core.LicenseInfo{SPDX: "CC-BY-4.0", Holder: "Example Corp"},
+	}
+	return files, manifest
+}
+
+func findComponent(bom *BOM, ref string) *Component {
+	for _, component := range bom.Components {
+		if component.BOMRef == ref {
+			return component
+		}
+	}
+	return nil
+}
+
+func property(component *Component, name string) string {
+	for _, p := range component.Properties {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+func TestGenerate(t *testing.T) {
+	files, manifest := testDocument()
+	timestamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tools := []*Component{{Type: "application", Name: "liv-builder", Version: "v1.0.0"}}
+
+	bom, err := Generate(files, manifest, Options{Timestamp: timestamp, Tools: tools})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != SpecVersion || !strings.HasPrefix(bom.SerialNumber, "urn:uuid:") {
+		t.Errorf("Unexpected header %+v", bom)
+	}
+	if bom.Metadata.Timestamp != "2024-03-01T12:00:00Z" || bom.Metadata.Tools == nil || bom.Metadata.Tools.Components[0].Name != "liv-builder" {
+		t.Errorf("Unexpected metadata %+v", bom.Metadata)
+	}
+	document := bom.Metadata.Component
+	if document.Name != "Quarterly report" || document.Version != "2.1.0" || document.Licenses[0].Expression != "CC-BY-4.0" || document.Copyright != "Example Corp" {
+		t.Errorf("Unexpected document component %+v", document)
+	}
+
+	if len(bom.Components) != 8 || findComponent(bom, "manifest.json") != nil {
+		t.Fatalf("Expected every file but the manifest to be listed, got %d components", len(bom.Components))
+	}
+	for i := 1; i < len(bom.Components); i++ {
+		if bom.Components[i-1].BOMRef >= bom.Components[i].BOMRef {
+			t.Errorf("Expected components in path order")
+		}
+	}
+
+	wasm := findComponent(bom, "wasm/engine.wasm")
+	if wasm.Type != "library" || wasm.Name != "engine" || wasm.Version != "1.4.2" || property(wasm, "liv:kind") != "wasm" {
+		t.Errorf("Unexpected WASM component %+v", wasm)
+	}
+	if hash := wasm.Hashes[0]; hash.Alg != "SHA-256" || hash.Content != sha256Hex(files["wasm/engine.wasm"]) {
+		t.Errorf("Unexpected hash %+v", hash)
+	}
+
+	variant := findComponent(bom, "assets/images/chart.webp")
+	if property(variant, "liv:derived-from") != "assets/images/chart.png" {
+		t.Errorf("Expected the variant origin to be recorded: %+v", variant.Properties)
+	}
+	if len(bom.Dependencies) != 1 || bom.Dependencies[0].Ref != "assets/images/chart.webp" {
+		t.Errorf("Unexpected dependencies %+v", bom.Dependencies)
+	}
+
+	photo := findComponent(bom, "assets/images/photo.jpg")
+	if len(photo.Licenses) != 1 || photo.Licenses[0].License.URL != "https://creativecommons.org/licenses/by/4.0/" {
+		t.Errorf("Expected the XMP license to be recorded: %+v", photo.Licenses)
+	}
+	if len(photo.ExternalReferences) != 1 || photo.ExternalReferences[0].URL != "https://example.com/rights" {
+		t.Errorf("Expected the XMP web statement to be recorded: %+v", photo.ExternalReferences)
+	}
+
+	if property(findComponent(bom, "content/stray.txt"), "liv:unlisted") != "true" {
+		t.Errorf("Expected files missing from the manifest to be flagged")
+	}
+	if property(findComponent(bom, "content/styles/a.css"), "liv:kind") != "stylesheet" {
+		t.Errorf("Expected stylesheets to be classified")
+	}
+	if library := findComponent(bom, "content/scripts/jquery.min.js"); library.Type != "library" || library.Name != "jquery" || library.Version != "3.4.1" || library.PURL != "pkg:npm/jquery@3.4.1" {
+		t.Errorf("Expected the bundled library to be identified: %+v", library)
+	}
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	files, manifest := testDocument()
+	opts := Options{Timestamp: time.Unix(0, 0), Tools: Toolchain()}
+
+	first, err := Generate(files, manifest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Generate(files, manifest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstData, _ := Marshal(first)
+	secondData, _ := Marshal(second)
+	if !bytes.Equal(firstData, secondData) {
+		t.Errorf("Expected the same document to produce the same SBOM")
+	}
+
+	files["content/index.html"] = []byte("<h1>Changed</h1>")
+	changed, err := Generate(files, manifest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.SerialNumber == first.SerialNumber {
+		t.Errorf("Expected a changed document to get a new serial number")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	files, manifest := testDocument()
+	bom, err := Generate(files, manifest, Options{Timestamp: time.Unix(0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(bom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if mismatches := Verify(parsed, files); len(mismatches) != 0 {
+		t.Errorf("Expected no mismatches, got %+v", mismatches[0])
+	}
+
+	files["wasm/engine.wasm"] = []byte("\x00asm tampered")
+	delete(files, "content/stray.txt")
+	mismatches := Verify(parsed, files)
+	if len(mismatches) != 2 || mismatches[0].Path != "content/stray.txt" || mismatches[0].Actual != "" || mismatches[1].Path != "wasm/engine.wasm" {
+		t.Errorf("Unexpected mismatches %+v", mismatches)
+	}
+
+	if _, err := Parse([]byte(`{"bomFormat": "SPDX"}`)); err == nil {
+		t.Errorf("Expected other formats to be refused")
+	}
+}
+
+func TestToolchain(t *testing.T) {
+	tools := Toolchain()
+	found := false
+	for _, tool := range tools {
+		if tool.Name == "go" && strings.HasPrefix(tool.Version, "go") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the Go toolchain to be listed: %+v", tools)
+	}
+}
@@ -0,0 +1,241 @@
+// Package scaffold creates the source tree of a new document: content, a
+// stylesheet, a static fallback for viewers without scripting and a liv.yaml
+// project file, from a built-in template or one installed in the template
+// library. The result builds with liv build as it is.
+package scaffold
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/liv-format/liv/pkg/project"
+	"github.com/liv-format/liv/pkg/templates"
+)
+
+// DefaultTemplate is the template used when none is given
+const DefaultTemplate = "static"
+
+// WASMExample is the path of the example WebAssembly module
+const WASMExample = "wasm/example.wasm"
+
+// Options configures a new source tree
+type Options struct {
+	// Template is a built-in template or the name of one installed in the
+	// template library, DefaultTemplate when empty
+	Template string
+	Title    string
+	Author   string
+	// Language is the two letter code of the document language
+	Language string
+	// WASM adds an example WebAssembly module and the script calling it
+	WASM bool
+	// Force writes into a directory that is not empty, replacing files of
+	// the same name
+	Force bool
+	// LibraryDir is the template library, templates.DefaultDir() when empty
+	LibraryDir string
+}
+
+// builtin is a built-in template
+type builtin struct {
+	description string
+	files       map[string]string
+	features    []string
+}
+
+// Templates returns the names of the built-in templates in order
+func Templates() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the description of a built-in template
+func Describe(name string) string {
+	if t, ok := builtins[name]; ok {
+		return t.description
+	}
+	return ""
+}
+
+// Scaffold writes the source tree of a new document to dir and returns the
+// paths written, relative to dir
+func Scaffold(dir string, opts Options) ([]string, error) {
+	if opts.Template == "" {
+		opts.Template = DefaultTemplate
+	}
+	if opts.Title == "" {
+		opts.Title = titleFromDir(dir)
+	}
+	if opts.Author == "" {
+		opts.Author = "Unknown Author"
+	}
+	if opts.Language == "" {
+		opts.Language = "en"
+	}
+	if len(opts.Language) != 2 {
+		return nil, fmt.Errorf("language must be a two letter code, got %q", opts.Language)
+	}
+	if !opts.Force {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return nil, fmt.Errorf("%s is not empty", dir)
+		}
+	}
+
+	files, err := render(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for path, data := range files {
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %v", path, err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		written = append(written, path)
+	}
+	sort.Strings(written)
+	return written, nil
+}
+
+// render returns the files of the template named in opts
+func render(opts Options) (map[string][]byte, error) {
+	t, ok := builtins[opts.Template]
+	if !ok {
+		return installed(opts)
+	}
+
+	features := append([]string(nil), t.features...)
+	if opts.WASM {
+		features = append(features, "webassembly")
+	}
+	data := map[string]interface{}{
+		"Title":    opts.Title,
+		"Author":   opts.Author,
+		"Language": opts.Language,
+		"WASM":     opts.WASM,
+		"Features": features,
+	}
+
+	files := make(map[string][]byte)
+	for path, text := range t.files {
+		rendered, err := execute(path, text, data)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = rendered
+	}
+	if opts.WASM {
+		files[WASMExample] = exampleModule
+		if _, exists := files["content/scripts/main.js"]; !exists {
+			files["content/scripts/main.js"] = nil
+		}
+		script, err := execute("wasm.js", wasmScript, data)
+		if err != nil {
+			return nil, err
+		}
+		files["content/scripts/main.js"] = append(files["content/scripts/main.js"], script...)
+	}
+	projectFile, err := execute(project.FileNames[0], projectTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	files[project.FileNames[0]] = projectFile
+	return files, nil
+}
+
+// installed returns the files of a template from the template library, the
+// latest version when several are installed. A liv.yaml is added unless the
+// template has a project file.
+func installed(opts Options) (map[string][]byte, error) {
+	library, err := templates.List(opts.LibraryDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template library: %v", err)
+	}
+	var match *templates.InstalledTemplate
+	for _, t := range library {
+		if t.Descriptor.Name == opts.Template {
+			match = t
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("unknown template %q (built-in templates are %s)", opts.Template, strings.Join(Templates(), ", "))
+	}
+	if opts.WASM {
+		return nil, fmt.Errorf("the WASM example is only available for built-in templates")
+	}
+
+	files := make(map[string][]byte)
+	for path := range match.Descriptor.Files {
+		data, err := os.ReadFile(filepath.Join(match.Path, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file %s: %v", path, err)
+		}
+		files[path] = data
+	}
+	for _, name := range project.FileNames {
+		if _, exists := files[name]; exists {
+			return files, nil
+		}
+	}
+	projectFile, err := execute(project.FileNames[0], projectTemplate, map[string]interface{}{
+		"Title":    opts.Title,
+		"Author":   opts.Author,
+		"Language": opts.Language,
+		"Features": match.Descriptor.RequiredFeatures,
+	})
+	if err != nil {
+		return nil, err
+	}
+	files[project.FileNames[0]] = projectFile
+	return files, nil
+}
+
+// execute renders a template file
+func execute(name, text string, data map[string]interface{}) ([]byte, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{"yaml": yamlString}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %v", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlString quotes a string for YAML; JSON strings are YAML strings
+func yamlString(s string) string {
+	// Marshalling a string cannot fail
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// titleFromDir derives a title from the name of dir
+func titleFromDir(dir string) string {
+	name := filepath.Base(filepath.Clean(dir))
+	if abs, err := filepath.Abs(dir); err == nil {
+		name = filepath.Base(abs)
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == ' ' })
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	if len(words) == 0 {
+		return "Untitled Document"
+	}
+	return strings.Join(words, " ")
+}
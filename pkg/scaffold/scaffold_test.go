@@ -0,0 +1,130 @@
+package scaffold
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/project"
+	"github.com/liv-format/liv/pkg/templates"
+	"github.com/liv-format/liv/pkg/wasmruntime"
+)
+
+func TestScaffoldBuiltins(t *testing.T) {
+	for _, name := range Templates() {
+		dir := filepath.Join(t.TempDir(), "annual-report")
+		written, err := Scaffold(dir, Options{Template: name, Author: "Jane <Doe> & Co", Language: "de"})
+		if err != nil {
+			t.Fatalf("%s: Scaffold failed: %v", name, err)
+		}
+		for _, required := range []string{"content/index.html", "content/styles/main.css", "content/static/fallback.html", "liv.yaml"} {
+			if _, err := os.Stat(filepath.Join(dir, required)); err != nil {
+				t.Errorf("%s: expected %s in %v", name, required, written)
+			}
+		}
+
+		page, _ := os.ReadFile(filepath.Join(dir, "content", "index.html"))
+		if !strings.Contains(string(page), "<title>Annual Report</title>") || !strings.Contains(string(page), "Jane &lt;Doe&gt; &amp; Co") || !strings.Contains(string(page), `lang="de"`) {
+			t.Errorf("%s: expected the title, escaped author and language in the page", name)
+		}
+
+		p, err := project.Load(filepath.Join(dir, "liv.yaml"))
+		if err != nil {
+			t.Fatalf("%s: expected a valid project file: %v", name, err)
+		}
+		if p.Metadata.Title != "Annual Report" || p.Metadata.Author != "Jane <Doe> & Co" || p.Metadata.Language != "de" {
+			t.Errorf("%s: unexpected metadata %+v", name, p.Metadata)
+		}
+	}
+}
+
+func TestScaffoldWASM(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Scaffold(dir, Options{Template: "static", WASM: true}); err != nil {
+		t.Fatalf("Scaffold failed: %v", err)
+	}
+	module, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(WASMExample)))
+	if err != nil {
+		t.Fatalf("Expected the example module: %v", err)
+	}
+	instance, err := wasmruntime.NewRuntime().Load(context.Background(), "example", module, wasmruntime.Limits{})
+	if err != nil {
+		t.Fatalf("Expected the example module to load: %v", err)
+	}
+	if results, err := instance.Call(context.Background(), "add", 2, 3); err != nil || results[0] != 5 {
+		t.Errorf("Expected add(2, 3) = 5, got %v %v", results, err)
+	}
+	if results, err := instance.Call(context.Background(), "main"); err != nil || results[0] != 42 {
+		t.Errorf("Expected main() = 42, got %v %v", results, err)
+	}
+
+	page, _ := os.ReadFile(filepath.Join(dir, "content", "index.html"))
+	script, _ := os.ReadFile(filepath.Join(dir, "content", "scripts", "main.js"))
+	if !strings.Contains(string(page), "scripts/main.js") || !strings.Contains(string(script), "example.wasm") {
+		t.Errorf("Expected the page to load the script calling the module")
+	}
+	p, err := project.Load(filepath.Join(dir, "liv.yaml"))
+	if err != nil || !p.Features["webassembly"] {
+		t.Errorf("Expected the webassembly feature in the project file: %v", err)
+	}
+}
+
+func TestScaffoldRefusesNonEmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0644)
+	if _, err := Scaffold(dir, Options{}); err == nil {
+		t.Fatal("Expected a non-empty directory to be refused")
+	}
+	if _, err := Scaffold(dir, Options{Force: true}); err != nil {
+		t.Fatalf("Expected --force to write into the directory: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != "keep" {
+		t.Errorf("Expected other files to be kept")
+	}
+
+	if _, err := Scaffold(t.TempDir(), Options{Template: "newsletter", LibraryDir: t.TempDir()}); err == nil {
+		t.Errorf("Expected an unknown template to be refused")
+	}
+	if _, err := Scaffold(t.TempDir(), Options{Language: "eng"}); err == nil {
+		t.Errorf("Expected an invalid language to be refused")
+	}
+}
+
+func TestScaffoldInstalledTemplate(t *testing.T) {
+	sourceDir := t.TempDir()
+	descriptor, _ := json.Marshal(templates.Descriptor{
+		Name:             "newsletter",
+		Version:          "1.0.0",
+		Title:            "Newsletter",
+		Author:           "LIV Templates",
+		RequiredFeatures: []string{"forms"},
+	})
+	os.MkdirAll(filepath.Join(sourceDir, "content"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, templates.DescriptorFile), descriptor, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "content", "index.html"), []byte("<h1>Newsletter</h1>"), 0644)
+
+	packagePath := filepath.Join(t.TempDir(), "newsletter"+templates.PackageExtension)
+	if _, err := templates.Pack(sourceDir, packagePath, nil); err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+	libraryDir := t.TempDir()
+	if _, err := templates.Install(packagePath, templates.InstallOptions{Dir: libraryDir, AllowUnsigned: true}); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	written, err := Scaffold(dir, Options{Template: "newsletter", Title: "May Issue", LibraryDir: libraryDir})
+	if err != nil {
+		t.Fatalf("Scaffold failed: %v", err)
+	}
+	if page, _ := os.ReadFile(filepath.Join(dir, "content", "index.html")); string(page) != "<h1>Newsletter</h1>" {
+		t.Errorf("Expected the installed template's page, got %q (%v)", page, written)
+	}
+	p, err := project.Load(filepath.Join(dir, "liv.yaml"))
+	if err != nil || p.Metadata.Title != "May Issue" || !p.Features["forms"] {
+		t.Errorf("Expected a project file with the template's features: %v", err)
+	}
+}
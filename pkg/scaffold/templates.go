@@ -0,0 +1,442 @@
+package scaffold
+
+// builtins are the built-in templates by name
+var builtins = map[string]*builtin{
+	"static": {
+		description: "A single page of text and images, without scripts",
+		files: map[string]string{
+			"content/index.html":           staticPage,
+			"content/styles/main.css":      baseStyles,
+			"content/static/fallback.html": fallbackPage,
+		},
+	},
+	"interactive": {
+		description: "A page with scripted, animated sections",
+		files: map[string]string{
+			"content/index.html":           interactivePage,
+			"content/styles/main.css":      baseStyles + interactiveStyles,
+			"content/scripts/main.js":      interactiveScript,
+			"content/static/fallback.html": fallbackPage,
+		},
+		features: []string{"animations", "interactivity"},
+	},
+	"presentation": {
+		description: "Full-screen slides navigated with the arrow keys",
+		files: map[string]string{
+			"content/index.html":           presentationPage,
+			"content/styles/main.css":      presentationStyles,
+			"content/scripts/main.js":      presentationScript,
+			"content/static/fallback.html": fallbackPage,
+		},
+		features: []string{"animations", "interactivity"},
+	},
+	"report": {
+		description: "A structured report with a summary, sections, a table and references, styled for print",
+		files: map[string]string{
+			"content/index.html":           reportPage,
+			"content/styles/main.css":      baseStyles + reportStyles,
+			"content/static/fallback.html": fallbackPage,
+		},
+	},
+}
+
+// projectTemplate is the liv.yaml of a new document
+const projectTemplate = `# Build settings for liv build; flags given on the command line override them
+metadata:
+  title: {{yaml .Title}}
+  author: {{yaml .Author}}
+  language: {{.Language}}
+{{- if .Features}}
+features:
+{{- range .Features}}
+  {{.}}: true
+{{- end}}
+{{- end}}
+# Paths left out of the package
+exclude: [drafts]
+build:
+  compress: true
+`
+
+const head = `<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="{{html .Author}}">
+    <title>{{html .Title}}</title>
+    <link rel="stylesheet" href="styles/main.css">
+</head>
+`
+
+const staticPage = head + `<body>
+    <header>
+        <h1>{{html .Title}}</h1>
+        <p class="byline">{{html .Author}}</p>
+    </header>
+
+    <main>
+        <section>
+            <h2>Introduction</h2>
+            <p>Replace this text with the content of your document. Images and other
+            files go in assets/ and are referenced relative to this page, for example
+            <code>../assets/images/figure.png</code>.</p>
+        </section>
+    </main>
+{{- if .WASM}}
+
+    <script src="scripts/main.js"></script>
+{{- end}}
+</body>
+</html>
+`
+
+const interactivePage = head + `<body>
+    <header>
+        <h1>{{html .Title}}</h1>
+        <p class="byline">{{html .Author}}</p>
+    </header>
+
+    <main>
+        <section class="reveal">
+            <h2>Introduction</h2>
+            <p>Sections fade in as they scroll into view.</p>
+        </section>
+
+        <section class="reveal">
+            <h2>Try it</h2>
+            <p>Clicked <span id="count">0</span> times.</p>
+            <button id="counter" type="button">Click me</button>
+        </section>
+    </main>
+
+    <script src="scripts/main.js"></script>
+</body>
+</html>
+`
+
+const presentationPage = head + `<body>
+    <main class="deck">
+        <section class="slide active">
+            <h1>{{html .Title}}</h1>
+            <p class="byline">{{html .Author}}</p>
+        </section>
+
+        <section class="slide">
+            <h2>Agenda</h2>
+            <ul>
+                <li>First point</li>
+                <li>Second point</li>
+                <li>Third point</li>
+            </ul>
+        </section>
+
+        <section class="slide">
+            <h2>Thank you</h2>
+            <p>Questions?</p>
+        </section>
+    </main>
+
+    <nav class="controls">
+        <button id="previous" type="button" aria-label="Previous slide">&larr;</button>
+        <span id="position">1 / 3</span>
+        <button id="next" type="button" aria-label="Next slide">&rarr;</button>
+    </nav>
+
+    <script src="scripts/main.js"></script>
+</body>
+</html>
+`
+
+const reportPage = head + `<body>
+    <header>
+        <h1>{{html .Title}}</h1>
+        <p class="byline">{{html .Author}}</p>
+    </header>
+
+    <main>
+        <section class="summary">
+            <h2>Summary</h2>
+            <p>State the purpose and the main findings of the report.</p>
+        </section>
+
+        <section>
+            <h2>1. Background</h2>
+            <p>Describe the context of the report.</p>
+        </section>
+
+        <section>
+            <h2>2. Findings</h2>
+            <table>
+                <caption>Table 1. Results</caption>
+                <thead>
+                    <tr><th scope="col">Measure</th><th scope="col">Value</th></tr>
+                </thead>
+                <tbody>
+                    <tr><td>First measure</td><td>0</td></tr>
+                    <tr><td>Second measure</td><td>0</td></tr>
+                </tbody>
+            </table>
+        </section>
+
+        <section>
+            <h2>3. Conclusions</h2>
+            <p>Summarize what follows from the findings.</p>
+        </section>
+
+        <section class="references">
+            <h2>References</h2>
+            <ol>
+                <li>Author, A. (Year). <cite>Title of the work</cite>. Publisher.</li>
+            </ol>
+        </section>
+    </main>
+{{- if .WASM}}
+
+    <script src="scripts/main.js"></script>
+{{- end}}
+</body>
+</html>
+`
+
+const fallbackPage = `<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+    <meta charset="UTF-8">
+    <title>{{html .Title}}</title>
+    <link rel="stylesheet" href="../styles/main.css">
+</head>
+<body>
+    <header>
+        <h1>{{html .Title}}</h1>
+        <p class="byline">{{html .Author}}</p>
+    </header>
+    <main>
+        <p>This is the static version of the document, shown by viewers that do not
+        run scripts. Keep it in step with content/index.html.</p>
+    </main>
+</body>
+</html>
+`
+
+const baseStyles = `body {
+    font-family: Georgia, "Times New Roman", serif;
+    line-height: 1.6;
+    color: #222;
+    max-width: 42rem;
+    margin: 0 auto;
+    padding: 2rem 1rem;
+}
+
+h1, h2, h3 {
+    font-family: Helvetica, Arial, sans-serif;
+    line-height: 1.2;
+}
+
+.byline {
+    color: #666;
+}
+
+img {
+    max-width: 100%;
+}
+`
+
+const interactiveStyles = `
+.reveal {
+    opacity: 0;
+    transform: translateY(1rem);
+    transition: opacity 0.6s, transform 0.6s;
+}
+
+.reveal.visible {
+    opacity: 1;
+    transform: none;
+}
+
+button {
+    font: inherit;
+    padding: 0.4rem 1rem;
+}
+`
+
+const reportStyles = `
+table {
+    border-collapse: collapse;
+    width: 100%;
+}
+
+th, td {
+    border: 1px solid #ccc;
+    padding: 0.4rem 0.6rem;
+    text-align: left;
+}
+
+caption {
+    caption-side: bottom;
+    color: #666;
+    padding-top: 0.4rem;
+}
+
+.summary {
+    border-left: 4px solid #456;
+    padding-left: 1rem;
+}
+
+@media print {
+    body {
+        max-width: none;
+        padding: 0;
+    }
+
+    section {
+        break-inside: avoid;
+    }
+}
+`
+
+const presentationStyles = `html, body {
+    margin: 0;
+    height: 100%;
+    font-family: Helvetica, Arial, sans-serif;
+    background: #1d2230;
+    color: #f5f5f5;
+}
+
+.slide {
+    display: none;
+    box-sizing: border-box;
+    height: 100vh;
+    padding: 10vh 10vw;
+    flex-direction: column;
+    justify-content: center;
+}
+
+.slide.active {
+    display: flex;
+}
+
+.slide h1 {
+    font-size: 3.5rem;
+}
+
+.slide h2 {
+    font-size: 2.5rem;
+}
+
+.slide li, .slide p {
+    font-size: 1.6rem;
+}
+
+.byline {
+    color: #aab;
+}
+
+.controls {
+    position: fixed;
+    right: 1.5rem;
+    bottom: 1rem;
+    display: flex;
+    gap: 0.8rem;
+    align-items: center;
+}
+
+.controls button {
+    font-size: 1.2rem;
+    background: none;
+    color: inherit;
+    border: 1px solid #aab;
+    border-radius: 4px;
+    padding: 0.2rem 0.8rem;
+}
+
+@media print {
+    .slide {
+        display: flex;
+        break-after: page;
+    }
+
+    .controls {
+        display: none;
+    }
+}
+`
+
+const interactiveScript = `// Fade sections in as they scroll into view
+document.addEventListener('DOMContentLoaded', function() {
+    const observer = new IntersectionObserver(function(entries) {
+        entries.forEach(function(entry) {
+            if (entry.isIntersecting) {
+                entry.target.classList.add('visible');
+            }
+        });
+    });
+    document.querySelectorAll('.reveal').forEach(function(section) {
+        observer.observe(section);
+    });
+
+    let count = 0;
+    document.getElementById('counter').addEventListener('click', function() {
+        count++;
+        document.getElementById('count').textContent = count;
+    });
+});
+`
+
+const presentationScript = `// Show one slide at a time; arrow keys, space and the buttons move between them
+document.addEventListener('DOMContentLoaded', function() {
+    const slides = document.querySelectorAll('.slide');
+    let current = 0;
+
+    function show(index) {
+        current = Math.max(0, Math.min(slides.length - 1, index));
+        slides.forEach(function(slide, i) {
+            slide.classList.toggle('active', i === current);
+        });
+        document.getElementById('position').textContent = (current + 1) + ' / ' + slides.length;
+    }
+
+    document.getElementById('previous').addEventListener('click', function() { show(current - 1); });
+    document.getElementById('next').addEventListener('click', function() { show(current + 1); });
+    document.addEventListener('keydown', function(event) {
+        if (event.key === 'ArrowRight' || event.key === 'PageDown' || event.key === ' ') {
+            show(current + 1);
+        } else if (event.key === 'ArrowLeft' || event.key === 'PageUp') {
+            show(current - 1);
+        }
+    });
+
+    show(0);
+});
+`
+
+// wasmScript is appended to the script of documents with the WASM example
+const wasmScript = `
+// Call the example WebAssembly module, which exports add(a, b)
+(async function() {
+    const response = await fetch('../wasm/example.wasm');
+    const { instance } = await WebAssembly.instantiate(await response.arrayBuffer());
+    console.log('2 + 3 =', instance.exports.add(2, 3));
+})();
+`
+
+// exampleModule is a WebAssembly module exporting its memory, main, which
+// returns 42, and add, which adds two i32s
+var exampleModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic and version
+	// type section: () -> i32 and (i32, i32) -> i32
+	0x01, 0x0b, 0x02, 0x60, 0x00, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	// function section: main and add
+	0x03, 0x03, 0x02, 0x00, 0x01,
+	// memory section: one page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// export section: memory, main and add
+	0x07, 0x17, 0x03,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x04, 'm', 'a', 'i', 'n', 0x00, 0x00,
+	0x03, 'a', 'd', 'd', 0x00, 0x01,
+	// code section: i32.const 42, and local.get 0, local.get 1, i32.add
+	0x0a, 0x0e, 0x02,
+	0x04, 0x00, 0x41, 0x2a, 0x0b,
+	0x07, 0x00, 0x20, 0x00, 0x20, 0x01, 0x6a, 0x0b,
+}
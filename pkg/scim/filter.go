@@ -0,0 +1,219 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// matcher reports whether a resource in its generic JSON form matches a filter
+type matcher func(resource map[string]interface{}) bool
+
+// compileFilter parses the subset of SCIM filter expressions identity providers
+// send: comparisons joined by "and" and "or", evaluated left to right, such as
+// userName eq "jdoe" or emails.value co "@example.com". Comparisons of strings
+// ignore case.
+func compileFilter(filter string) (matcher, error) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return func(map[string]interface{}) bool { return true }, nil
+	}
+
+	var result matcher
+	var join string
+	for len(tokens) > 0 {
+		if result != nil {
+			join = strings.ToLower(tokens[0])
+			if join != "and" && join != "or" {
+				return nil, errInvalid("invalidFilter", "unexpected %q in filter", tokens[0])
+			}
+			tokens = tokens[1:]
+		}
+		var comparison matcher
+		comparison, tokens, err = parseComparison(tokens)
+		if err != nil {
+			return nil, err
+		}
+		switch left := result; {
+		case left == nil:
+			result = comparison
+		case join == "and":
+			result = func(r map[string]interface{}) bool { return left(r) && comparison(r) }
+		default:
+			result = func(r map[string]interface{}) bool { return left(r) || comparison(r) }
+		}
+	}
+	return result, nil
+}
+
+func parseComparison(tokens []string) (matcher, []string, error) {
+	if len(tokens) < 2 {
+		return nil, nil, errInvalid("invalidFilter", "incomplete filter")
+	}
+	path, op := tokens[0], strings.ToLower(tokens[1])
+	if op == "pr" {
+		return func(r map[string]interface{}) bool {
+			for _, value := range lookupValues(r, path) {
+				if value != nil && value != "" {
+					return true
+				}
+			}
+			return false
+		}, tokens[2:], nil
+	}
+	if len(tokens) < 3 {
+		return nil, nil, errInvalid("invalidFilter", "missing value for %s %s", path, op)
+	}
+	want, err := parseLiteral(tokens[2])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var compare func(got, want string) bool
+	switch op {
+	case "eq":
+		compare = strings.EqualFold
+	case "ne":
+		compare = func(got, want string) bool { return !strings.EqualFold(got, want) }
+	case "co":
+		compare = func(got, want string) bool { return strings.Contains(strings.ToLower(got), strings.ToLower(want)) }
+	case "sw":
+		compare = func(got, want string) bool { return strings.HasPrefix(strings.ToLower(got), strings.ToLower(want)) }
+	case "ew":
+		compare = func(got, want string) bool { return strings.HasSuffix(strings.ToLower(got), strings.ToLower(want)) }
+	case "gt", "ge", "lt", "le":
+		compare = func(got, want string) bool {
+			c := strings.Compare(got, want)
+			return op == "gt" && c > 0 || op == "ge" && c >= 0 || op == "lt" && c < 0 || op == "le" && c <= 0
+		}
+	default:
+		return nil, nil, errInvalid("invalidFilter", "unsupported filter operator %q", tokens[1])
+	}
+
+	return func(r map[string]interface{}) bool {
+		values := lookupValues(r, path)
+		if len(values) == 0 {
+			return op == "ne"
+		}
+		for _, value := range values {
+			if compare(fmt.Sprint(value), want) {
+				return true
+			}
+		}
+		return false
+	}, tokens[3:], nil
+}
+
+// parseLiteral decodes a quoted string, number, boolean or null
+func parseLiteral(token string) (string, error) {
+	if strings.HasPrefix(token, `"`) {
+		value, err := strconv.Unquote(token)
+		if err != nil {
+			return "", errInvalid("invalidFilter", "invalid string %s in filter", token)
+		}
+		return value, nil
+	}
+	switch strings.ToLower(token) {
+	case "true", "false", "null":
+		return strings.ToLower(token), nil
+	}
+	if _, err := strconv.ParseFloat(token, 64); err != nil {
+		return "", errInvalid("invalidFilter", "invalid value %s in filter", token)
+	}
+	return token, nil
+}
+
+// tokenizeFilter splits a filter on whitespace, keeping quoted strings whole
+func tokenizeFilter(filter string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			return nil, errInvalid("invalidFilter", "grouping is not supported in filters")
+		case c == '"':
+			end := i + 1
+			for ; end < len(filter) && filter[end] != '"'; end++ {
+				if filter[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(filter) {
+				return nil, errInvalid("invalidFilter", "unterminated string in filter")
+			}
+			tokens = append(tokens, filter[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(filter) && filter[end] != ' ' && filter[end] != '\t' {
+				end++
+			}
+			tokens = append(tokens, filter[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// lookupValues resolves an attribute path such as emails.value against a
+// resource, flattening multi-valued attributes. Attribute names ignore case and
+// may carry the core schema URN.
+func lookupValues(resource map[string]interface{}, path string) []interface{} {
+	path = stripSchema(path)
+	name, sub, _ := strings.Cut(path, ".")
+	value, found := getField(resource, name)
+	if !found {
+		return nil
+	}
+	var values []interface{}
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]interface{}:
+			if sub == "" {
+				// A complex value compares by its value sub-attribute
+				sub = "value"
+			}
+			if item, found := getField(v, sub); found {
+				values = append(values, item)
+			}
+		default:
+			if sub == "" {
+				values = append(values, v)
+			}
+		}
+	}
+	collect(value)
+	return values
+}
+
+// getField looks up an attribute without regard to case
+func getField(m map[string]interface{}, name string) (interface{}, bool) {
+	if value, found := m[name]; found {
+		return value, true
+	}
+	for key, value := range m {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// stripSchema removes a core schema URN from an attribute path
+func stripSchema(path string) string {
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if len(path) > len(schema) && strings.EqualFold(path[:len(schema)], schema) && path[len(schema)] == ':' {
+			return path[len(schema)+1:]
+		}
+	}
+	return path
+}
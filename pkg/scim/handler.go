@@ -0,0 +1,317 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PathPrefix is where the SCIM endpoint is mounted
+const PathPrefix = "/scim/v2/"
+
+// ContentType is the media type of SCIM messages
+const ContentType = "application/scim+json"
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	maxBodySize     = 1 << 20
+)
+
+// Handler serves the SCIM 2.0 protocol for a directory. Identity providers
+// authenticate with a static bearer token.
+type Handler struct {
+	Directory *Directory
+	Token     string
+}
+
+// NewHandler returns a SCIM endpoint for a directory
+func NewHandler(directory *Directory, token string) *Handler {
+	return &Handler{Directory: directory, Token: token}
+}
+
+// ServeHTTP routes SCIM requests
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+		writeError(w, &Error{Status: http.StatusUnauthorized, Detail: "invalid or missing bearer token"})
+		return
+	}
+
+	route := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(PathPrefix, "/")), "/")
+	resource, id, _ := strings.Cut(route, "/")
+	switch resource {
+	case "ServiceProviderConfig":
+		h.serveStatic(w, r, serviceProviderConfig())
+	case "ResourceTypes":
+		h.serveStatic(w, r, listResponse(resourceTypes(), 1, 2))
+	case "Schemas":
+		h.serveStatic(w, r, listResponse([]interface{}{
+			map[string]interface{}{"id": SchemaUser, "name": "User"},
+			map[string]interface{}{"id": SchemaGroup, "name": "Group"},
+		}, 1, 2))
+	case "Users":
+		h.serveUsers(w, r, id)
+	case "Groups":
+		h.serveGroups(w, r, id)
+	default:
+		writeError(w, &Error{Status: http.StatusNotFound, Detail: "unknown endpoint"})
+	}
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.Token == "" {
+		return false
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(h.Token)) == 1
+}
+
+func (h *Handler) serveStatic(w http.ResponseWriter, r *http.Request, body interface{}) {
+	if r.Method != http.MethodGet {
+		writeError(w, &Error{Status: http.StatusMethodNotAllowed, Detail: "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (h *Handler) serveUsers(w http.ResponseWriter, r *http.Request, id string) {
+	d := h.Directory
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		users, err := d.ListUsers(r.URL.Query().Get("filter"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resources := make([]interface{}, len(users))
+		for i, user := range users {
+			user.Meta.Location = location(r, "Users", user.ID)
+			resources[i] = user
+		}
+		h.writeList(w, r, resources)
+	case id == "" && r.Method == http.MethodPost:
+		var user User
+		if !decode(w, r, &user) {
+			return
+		}
+		created, err := d.CreateUser(&user)
+		h.writeUser(w, r, created, err, http.StatusCreated)
+	case id == "":
+		writeError(w, &Error{Status: http.StatusMethodNotAllowed, Detail: "method not allowed"})
+	case r.Method == http.MethodGet:
+		user, err := d.GetUser(id)
+		h.writeUser(w, r, user, err, http.StatusOK)
+	case r.Method == http.MethodPut:
+		var user User
+		if !decode(w, r, &user) {
+			return
+		}
+		replaced, err := d.ReplaceUser(id, &user)
+		h.writeUser(w, r, replaced, err, http.StatusOK)
+	case r.Method == http.MethodPatch:
+		var patch PatchRequest
+		if !decode(w, r, &patch) {
+			return
+		}
+		patched, err := d.PatchUser(id, patch.Operations)
+		h.writeUser(w, r, patched, err, http.StatusOK)
+	case r.Method == http.MethodDelete:
+		if err := d.DeleteUser(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, &Error{Status: http.StatusMethodNotAllowed, Detail: "method not allowed"})
+	}
+}
+
+func (h *Handler) writeUser(w http.ResponseWriter, r *http.Request, user *User, err error, status int) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	user.Meta.Location = location(r, "Users", user.ID)
+	w.Header().Set("Location", user.Meta.Location)
+	w.Header().Set("ETag", user.Meta.Version)
+	writeJSON(w, status, user)
+}
+
+func (h *Handler) serveGroups(w http.ResponseWriter, r *http.Request, id string) {
+	d := h.Directory
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		groups, err := d.ListGroups(r.URL.Query().Get("filter"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		excludeMembers := strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+		resources := make([]interface{}, len(groups))
+		for i, group := range groups {
+			group.Meta.Location = location(r, "Groups", group.ID)
+			if excludeMembers {
+				group.Members = nil
+			}
+			resources[i] = group
+		}
+		h.writeList(w, r, resources)
+	case id == "" && r.Method == http.MethodPost:
+		var group Group
+		if !decode(w, r, &group) {
+			return
+		}
+		created, err := d.CreateGroup(&group)
+		h.writeGroup(w, r, created, err, http.StatusCreated)
+	case id == "":
+		writeError(w, &Error{Status: http.StatusMethodNotAllowed, Detail: "method not allowed"})
+	case r.Method == http.MethodGet:
+		group, err := d.GetGroup(id)
+		h.writeGroup(w, r, group, err, http.StatusOK)
+	case r.Method == http.MethodPut:
+		var group Group
+		if !decode(w, r, &group) {
+			return
+		}
+		replaced, err := d.ReplaceGroup(id, &group)
+		h.writeGroup(w, r, replaced, err, http.StatusOK)
+	case r.Method == http.MethodPatch:
+		var patch PatchRequest
+		if !decode(w, r, &patch) {
+			return
+		}
+		patched, err := d.PatchGroup(id, patch.Operations)
+		h.writeGroup(w, r, patched, err, http.StatusOK)
+	case r.Method == http.MethodDelete:
+		if err := d.DeleteGroup(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, &Error{Status: http.StatusMethodNotAllowed, Detail: "method not allowed"})
+	}
+}
+
+func (h *Handler) writeGroup(w http.ResponseWriter, r *http.Request, group *Group, err error, status int) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	group.Meta.Location = location(r, "Groups", group.ID)
+	w.Header().Set("Location", group.Meta.Location)
+	w.Header().Set("ETag", group.Meta.Version)
+	writeJSON(w, status, group)
+}
+
+// writeList writes a page of resources selected by startIndex and count
+func (h *Handler) writeList(w http.ResponseWriter, r *http.Request, resources []interface{}) {
+	query := r.URL.Query()
+	start, count := 1, defaultPageSize
+	if value := query.Get("startIndex"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, errInvalid("invalidValue", "invalid startIndex %q", value))
+			return
+		}
+		if n > 1 {
+			start = n
+		}
+	}
+	if value := query.Get("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, errInvalid("invalidValue", "invalid count %q", value))
+			return
+		}
+		count = n
+		if count < 0 {
+			count = 0
+		}
+		if count > maxPageSize {
+			count = maxPageSize
+		}
+	}
+
+	total := len(resources)
+	page := []interface{}{}
+	if start <= total {
+		end := start - 1 + count
+		if end > total {
+			end = total
+		}
+		page = resources[start-1 : end]
+	}
+	writeJSON(w, http.StatusOK, listResponse(page, start, total))
+}
+
+func listResponse(resources []interface{}, start, total int) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":      []string{SchemaListResponse},
+		"totalResults": total,
+		"startIndex":   start,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	}
+}
+
+func serviceProviderConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":        []string{SchemaServiceProvider},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": maxPageSize},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Authentication with a static bearer token",
+			"primary":     true,
+		}},
+	}
+}
+
+func resourceTypes() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"schemas": []string{SchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": SchemaUser},
+		map[string]interface{}{"schemas": []string{SchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": SchemaGroup},
+	}
+}
+
+// location returns the absolute URL of a resource
+func location(r *http.Request, resourceType, id string) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + PathPrefix + resourceType + "/" + id
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		writeError(w, errInvalid("invalidSyntax", "invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var scimErr *Error
+	if !errors.As(err, &scimErr) {
+		scimErr = &Error{Status: http.StatusInternalServerError, Detail: err.Error()}
+	}
+	writeJSON(w, scimErr.Status, scimErr)
+}
@@ -0,0 +1,284 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Operation is a single SCIM PATCH operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PatchRequest is the body of a SCIM PATCH request
+type PatchRequest struct {
+	Schemas    []string    `json:"schemas"`
+	Operations []Operation `json:"Operations"`
+}
+
+// readOnly lists the attributes clients cannot change
+var readOnly = map[string]bool{"id": true, "meta": true, "groups": true, "schemas": true}
+
+// applyPatch applies operations to the generic JSON form of resource and
+// decodes the result into patched. Operation names ignore case and string
+// booleans are accepted, as Azure AD sends "active": "False". Attributes the
+// directory does not model, such as enterprise extension attributes, are kept
+// out of the result rather than rejected so that provisioning does not stall.
+func applyPatch(resource interface{}, ops []Operation, patched interface{}) error {
+	doc := toMap(resource)
+	for _, op := range ops {
+		var value interface{}
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return errInvalid("invalidValue", "invalid value for %s: %v", op.Path, err)
+			}
+		}
+		path := stripSchema(strings.TrimSpace(op.Path))
+
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			replace := strings.EqualFold(op.Op, "replace")
+			if path == "" {
+				fields, ok := value.(map[string]interface{})
+				if !ok {
+					return errInvalid("invalidValue", "%s without a path requires an object value", op.Op)
+				}
+				for name, fieldValue := range fields {
+					if err := setPath(doc, stripSchema(name), fieldValue, replace); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if value == nil {
+				return errInvalid("invalidValue", "%s %s requires a value", op.Op, op.Path)
+			}
+			if err := setPath(doc, path, value, replace); err != nil {
+				return err
+			}
+		case "remove":
+			if path == "" {
+				return errInvalid("noTarget", "remove requires a path")
+			}
+			if err := removePath(doc, path, value); err != nil {
+				return err
+			}
+		default:
+			return errInvalid("invalidSyntax", "unsupported patch operation %q", op.Op)
+		}
+	}
+
+	if active, ok := doc["active"].(string); ok {
+		parsed, err := strconv.ParseBool(strings.ToLower(active))
+		if err != nil {
+			return errInvalid("invalidValue", "invalid active value %q", active)
+		}
+		doc["active"] = parsed
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, patched); err != nil {
+		return errInvalid("invalidValue", "patched resource is invalid: %v", err)
+	}
+	return nil
+}
+
+// parsePath splits attr[filter].sub into its parts
+func parsePath(path string) (name, filter, sub string, err error) {
+	name = path
+	if open := strings.Index(path, "["); open >= 0 {
+		close := strings.LastIndex(path, "]")
+		if close < open {
+			return "", "", "", errInvalid("invalidPath", "invalid path %q", path)
+		}
+		name, filter = path[:open], path[open+1:close]
+		sub = strings.TrimPrefix(path[close+1:], ".")
+	} else {
+		name, sub, _ = strings.Cut(path, ".")
+	}
+	if name == "" {
+		return "", "", "", errInvalid("invalidPath", "invalid path %q", path)
+	}
+	if readOnly[strings.ToLower(name)] {
+		return "", "", "", errInvalid("mutability", "%s is read-only", name)
+	}
+	return name, filter, sub, nil
+}
+
+// fieldKey returns the existing key for an attribute, or name if it is absent
+func fieldKey(m map[string]interface{}, name string) string {
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+func setPath(doc map[string]interface{}, path string, value interface{}, replace bool) error {
+	name, filter, sub, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	key := fieldKey(doc, name)
+
+	if filter != "" {
+		match, err := compileFilter(filter)
+		if err != nil {
+			return err
+		}
+		items, _ := doc[key].([]interface{})
+		matched := false
+		for i, item := range items {
+			element, ok := item.(map[string]interface{})
+			if !ok || !match(element) {
+				continue
+			}
+			matched = true
+			if sub != "" {
+				element[fieldKey(element, sub)] = value
+			} else {
+				items[i] = value
+			}
+		}
+		if !matched {
+			if sub == "" {
+				return errInvalid("noTarget", "no values match %s", path)
+			}
+			// Adding emails[type eq "work"].value creates the entry
+			element := map[string]interface{}{sub: value}
+			if field, want, ok := equalityFilter(filter); ok {
+				element[field] = want
+			}
+			doc[key] = append(items, element)
+		}
+		return nil
+	}
+
+	if sub != "" {
+		complex, _ := doc[key].(map[string]interface{})
+		if complex == nil {
+			complex = make(map[string]interface{})
+		}
+		complex[fieldKey(complex, sub)] = value
+		doc[key] = complex
+		return nil
+	}
+
+	existing, isList := doc[key].([]interface{})
+	values, valueIsList := value.([]interface{})
+	if isList && valueIsList && !replace {
+		// Adding to a multi-valued attribute appends new values
+		for _, v := range values {
+			if !containsValue(existing, v) {
+				existing = append(existing, v)
+			}
+		}
+		doc[key] = existing
+		return nil
+	}
+	if complex, ok := value.(map[string]interface{}); ok && !replace {
+		if current, ok := doc[key].(map[string]interface{}); ok {
+			for k, v := range complex {
+				current[fieldKey(current, k)] = v
+			}
+			return nil
+		}
+	}
+	doc[key] = value
+	return nil
+}
+
+func removePath(doc map[string]interface{}, path string, value interface{}) error {
+	name, filter, sub, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	key := fieldKey(doc, name)
+
+	if filter != "" {
+		match, err := compileFilter(filter)
+		if err != nil {
+			return err
+		}
+		items, _ := doc[key].([]interface{})
+		kept := items[:0]
+		for _, item := range items {
+			element, ok := item.(map[string]interface{})
+			if ok && match(element) {
+				if sub != "" {
+					delete(element, fieldKey(element, sub))
+					kept = append(kept, element)
+				}
+				continue
+			}
+			kept = append(kept, item)
+		}
+		doc[key] = kept
+		return nil
+	}
+
+	if sub != "" {
+		if complex, ok := doc[key].(map[string]interface{}); ok {
+			delete(complex, fieldKey(complex, sub))
+		}
+		return nil
+	}
+
+	// Azure AD removes members by listing them in the value
+	if values, ok := value.([]interface{}); ok {
+		items, _ := doc[key].([]interface{})
+		kept := items[:0]
+		for _, item := range items {
+			if !containsValue(values, item) {
+				kept = append(kept, item)
+			}
+		}
+		doc[key] = kept
+		return nil
+	}
+	delete(doc, key)
+	return nil
+}
+
+// containsValue reports whether a multi-valued attribute holds v, comparing
+// complex values by their value sub-attribute
+func containsValue(items []interface{}, v interface{}) bool {
+	want := identity(v)
+	for _, item := range items {
+		if identity(item) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func identity(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		if value, found := getField(m, "value"); found {
+			return value
+		}
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return v
+}
+
+// equalityFilter extracts attr and value from a filter of the form attr eq "value"
+func equalityFilter(filter string) (string, string, bool) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil || len(tokens) != 3 || !strings.EqualFold(tokens[1], "eq") {
+		return "", "", false
+	}
+	value, err := parseLiteral(tokens[2])
+	if err != nil {
+		return "", "", false
+	}
+	return tokens[0], value, true
+}
@@ -0,0 +1,611 @@
+// Package scim provisions users and groups from an enterprise identity
+// provider with SCIM 2.0 (RFC 7643 and RFC 7644). Identity providers such as
+// Azure AD, Okta and OneLogin create, update and deactivate users and group
+// memberships as they change in the HR or identity system; the Directory keeps
+// them and the auth package consults it on every request, so deprovisioned
+// users lose access immediately.
+package scim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+// Schema URNs
+const (
+	SchemaUser            = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup           = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp         = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError           = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProvider = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType    = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// Error is a SCIM error response
+type Error struct {
+	Status int    `json:"-"`
+	Type   string `json:"scimType,omitempty"`
+	Detail string `json:"detail"`
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// MarshalJSON encodes the error in the SCIM error format, where the status is
+// a string
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Schemas []string `json:"schemas"`
+		Status  string   `json:"status"`
+		Type    string   `json:"scimType,omitempty"`
+		Detail  string   `json:"detail"`
+	}{[]string{SchemaError}, strconv.Itoa(e.Status), e.Type, e.Detail})
+}
+
+// ErrNotFound is returned for unknown resource IDs
+var ErrNotFound = &Error{Status: http.StatusNotFound, Detail: "resource not found"}
+
+func errConflict(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusConflict, Type: "uniqueness", Detail: fmt.Sprintf(format, args...)}
+}
+
+func errInvalid(scimType, format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, Type: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Meta is the metadata of a resource
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+	Version      string    `json:"version,omitempty"`
+}
+
+// Name is the components of a user's name
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+}
+
+// MultiValue is an entry of a multi-valued attribute such as emails
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is a provisioned user
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	// Active is nil until set; users are active unless deactivated
+	Active *bool `json:"active,omitempty"`
+	// Groups is read-only and derived from group membership
+	Groups []MultiValue `json:"groups,omitempty"`
+	Meta   *Meta        `json:"meta"`
+}
+
+// IsActive reports whether the user may sign in
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+// Group is a provisioned group
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta"`
+}
+
+// Directory stores provisioned users and groups in a JSON file. It is safe for
+// concurrent use.
+type Directory struct {
+	path string
+	Now  func() time.Time
+
+	mu     sync.RWMutex
+	users  map[string]*User
+	groups map[string]*Group
+}
+
+// directoryFile is the on-disk form of a directory
+type directoryFile struct {
+	Users  []*User  `json:"users"`
+	Groups []*Group `json:"groups"`
+}
+
+// Open loads the directory stored at path, creating it on the first change
+func Open(path string) (*Directory, error) {
+	d := &Directory{
+		path:   path,
+		Now:    time.Now,
+		users:  make(map[string]*User),
+		groups: make(map[string]*Group),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SCIM directory: %v", err)
+	}
+	var file directoryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid SCIM directory %s: %v", path, err)
+	}
+	for _, user := range file.Users {
+		d.users[user.ID] = user
+	}
+	for _, group := range file.Groups {
+		d.groups[group.ID] = group
+	}
+	return d, nil
+}
+
+// save writes the directory atomically; the caller holds the write lock
+func (d *Directory) save() error {
+	file := directoryFile{Users: make([]*User, 0, len(d.users)), Groups: make([]*Group, 0, len(d.groups))}
+	for _, user := range d.users {
+		file.Users = append(file.Users, user)
+	}
+	for _, group := range d.groups {
+		file.Groups = append(file.Groups, group)
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i].ID < file.Users[j].ID })
+	sort.Slice(file.Groups, func(i, j int) bool { return file.Groups[i].ID < file.Groups[j].ID })
+
+	data, err := json.MarshalIndent(&file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return fmt.Errorf("failed to save SCIM directory: %v", err)
+	}
+	if err := atomicfile.WriteFile(d.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save SCIM directory: %v", err)
+	}
+	return nil
+}
+
+// Lookup returns the groups of a user and whether the user may sign in. known
+// is false for users the directory does not hold. User names are matched
+// without regard to case.
+func (d *Directory) Lookup(username string) (groups []string, active, known bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	user := d.findUser(username)
+	if user == nil {
+		return nil, false, false
+	}
+	for _, group := range d.groups {
+		for _, member := range group.Members {
+			if member.Value == user.ID {
+				groups = append(groups, group.DisplayName)
+				break
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups, user.IsActive(), true
+}
+
+func (d *Directory) findUser(username string) *User {
+	for _, user := range d.users {
+		if strings.EqualFold(user.UserName, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (d *Directory) newMeta(resourceType string) *Meta {
+	now := d.Now().UTC()
+	return &Meta{ResourceType: resourceType, Created: now, LastModified: now, Version: version(now)}
+}
+
+func (d *Directory) touch(meta *Meta) {
+	now := d.Now().UTC()
+	if !now.After(meta.LastModified) {
+		// Keep versions distinct for changes within the clock resolution
+		now = meta.LastModified.Add(time.Nanosecond)
+	}
+	meta.LastModified = now
+	meta.Version = version(now)
+}
+
+func version(t time.Time) string {
+	return `W/"` + strconv.FormatInt(t.UnixNano(), 36) + `"`
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// Format as a UUID, which some identity providers expect
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// CreateUser provisions a user
+func (d *Directory) CreateUser(user *User) (*User, error) {
+	if err := validateUser(user); err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.findUser(user.UserName) != nil {
+		return nil, errConflict("user %q already exists", user.UserName)
+	}
+	created := *user
+	created.Schemas = []string{SchemaUser}
+	created.ID = id
+	created.Groups = nil
+	created.Meta = d.newMeta("User")
+	d.users[id] = &created
+	if err := d.save(); err != nil {
+		delete(d.users, id)
+		return nil, err
+	}
+	return d.userView(&created), nil
+}
+
+// GetUser returns a user by ID
+func (d *Directory) GetUser(id string) (*User, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	user, exists := d.users[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return d.userView(user), nil
+}
+
+// ReplaceUser replaces every attribute of a user
+func (d *Directory) ReplaceUser(id string, user *User) (*User, error) {
+	if err := validateUser(user); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	existing, exists := d.users[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if other := d.findUser(user.UserName); other != nil && other.ID != id {
+		return nil, errConflict("user %q already exists", user.UserName)
+	}
+	replaced := *user
+	replaced.Schemas = []string{SchemaUser}
+	replaced.ID = id
+	replaced.Groups = nil
+	meta := *existing.Meta
+	replaced.Meta = &meta
+	d.touch(replaced.Meta)
+	d.users[id] = &replaced
+	if err := d.save(); err != nil {
+		d.users[id] = existing
+		return nil, err
+	}
+	return d.userView(&replaced), nil
+}
+
+// PatchUser applies PATCH operations to a user
+func (d *Directory) PatchUser(id string, ops []Operation) (*User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	existing, exists := d.users[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	var patched User
+	if err := applyPatch(existing, ops, &patched); err != nil {
+		return nil, err
+	}
+	if err := validateUser(&patched); err != nil {
+		return nil, err
+	}
+	if other := d.findUser(patched.UserName); other != nil && other.ID != id {
+		return nil, errConflict("user %q already exists", patched.UserName)
+	}
+	patched.Schemas = []string{SchemaUser}
+	patched.ID = id
+	patched.Groups = nil
+	meta := *existing.Meta
+	patched.Meta = &meta
+	d.touch(patched.Meta)
+	d.users[id] = &patched
+	if err := d.save(); err != nil {
+		d.users[id] = existing
+		return nil, err
+	}
+	return d.userView(&patched), nil
+}
+
+// DeleteUser deprovisions a user and removes it from every group
+func (d *Directory) DeleteUser(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.users[id]; !exists {
+		return ErrNotFound
+	}
+	delete(d.users, id)
+	for _, group := range d.groups {
+		members := group.Members[:0]
+		for _, member := range group.Members {
+			if member.Value != id {
+				members = append(members, member)
+			}
+		}
+		group.Members = members
+	}
+	return d.save()
+}
+
+// ListUsers returns the users matching a SCIM filter, or every user when the
+// filter is empty
+func (d *Directory) ListUsers(filter string) ([]*User, error) {
+	match, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var users []*User
+	for _, user := range d.users {
+		view := d.userView(user)
+		if match(toMap(view)) {
+			users = append(users, view)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].Meta.Created.Equal(users[j].Meta.Created) {
+			return users[i].Meta.Created.Before(users[j].Meta.Created)
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+// userView returns a copy of a user with its groups filled in
+func (d *Directory) userView(user *User) *User {
+	view := *user
+	meta := *user.Meta
+	view.Meta = &meta
+	view.Groups = nil
+	for _, group := range d.groups {
+		for _, member := range group.Members {
+			if member.Value == user.ID {
+				view.Groups = append(view.Groups, MultiValue{Value: group.ID, Display: group.DisplayName})
+				break
+			}
+		}
+	}
+	sort.Slice(view.Groups, func(i, j int) bool { return view.Groups[i].Display < view.Groups[j].Display })
+	return &view
+}
+
+func validateUser(user *User) error {
+	if strings.TrimSpace(user.UserName) == "" {
+		return errInvalid("invalidValue", "userName is required")
+	}
+	return nil
+}
+
+// CreateGroup provisions a group
+func (d *Directory) CreateGroup(group *Group) (*Group, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.validateGroup(group, ""); err != nil {
+		return nil, err
+	}
+	created := *group
+	created.Schemas = []string{SchemaGroup}
+	created.ID = id
+	created.Members = d.members(group.Members)
+	created.Meta = d.newMeta("Group")
+	d.groups[id] = &created
+	if err := d.save(); err != nil {
+		delete(d.groups, id)
+		return nil, err
+	}
+	return copyGroup(&created), nil
+}
+
+// GetGroup returns a group by ID
+func (d *Directory) GetGroup(id string) (*Group, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	group, exists := d.groups[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return copyGroup(group), nil
+}
+
+// ReplaceGroup replaces every attribute of a group
+func (d *Directory) ReplaceGroup(id string, group *Group) (*Group, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	existing, exists := d.groups[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if err := d.validateGroup(group, id); err != nil {
+		return nil, err
+	}
+	replaced := *group
+	replaced.Schemas = []string{SchemaGroup}
+	replaced.ID = id
+	replaced.Members = d.members(group.Members)
+	meta := *existing.Meta
+	replaced.Meta = &meta
+	d.touch(replaced.Meta)
+	d.groups[id] = &replaced
+	if err := d.save(); err != nil {
+		d.groups[id] = existing
+		return nil, err
+	}
+	return copyGroup(&replaced), nil
+}
+
+// PatchGroup applies PATCH operations to a group, typically adding or removing
+// members
+func (d *Directory) PatchGroup(id string, ops []Operation) (*Group, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	existing, exists := d.groups[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	var patched Group
+	if err := applyPatch(existing, ops, &patched); err != nil {
+		return nil, err
+	}
+	if err := d.validateGroup(&patched, id); err != nil {
+		return nil, err
+	}
+	patched.Schemas = []string{SchemaGroup}
+	patched.ID = id
+	patched.Members = d.members(patched.Members)
+	meta := *existing.Meta
+	patched.Meta = &meta
+	d.touch(patched.Meta)
+	d.groups[id] = &patched
+	if err := d.save(); err != nil {
+		d.groups[id] = existing
+		return nil, err
+	}
+	return copyGroup(&patched), nil
+}
+
+// DeleteGroup removes a group
+func (d *Directory) DeleteGroup(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.groups[id]; !exists {
+		return ErrNotFound
+	}
+	delete(d.groups, id)
+	return d.save()
+}
+
+// ListGroups returns the groups matching a SCIM filter
+func (d *Directory) ListGroups(filter string) ([]*Group, error) {
+	match, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var groups []*Group
+	for _, group := range d.groups {
+		if match(toMap(group)) {
+			groups = append(groups, copyGroup(group))
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].Meta.Created.Equal(groups[j].Meta.Created) {
+			return groups[i].Meta.Created.Before(groups[j].Meta.Created)
+		}
+		return groups[i].ID < groups[j].ID
+	})
+	return groups, nil
+}
+
+func (d *Directory) validateGroup(group *Group, id string) error {
+	if strings.TrimSpace(group.DisplayName) == "" {
+		return errInvalid("invalidValue", "displayName is required")
+	}
+	for _, other := range d.groups {
+		if other.ID != id && strings.EqualFold(other.DisplayName, group.DisplayName) {
+			return errConflict("group %q already exists", group.DisplayName)
+		}
+	}
+	for _, member := range group.Members {
+		if _, exists := d.users[member.Value]; !exists {
+			if _, nested := d.groups[member.Value]; !nested {
+				return errInvalid("invalidValue", "member %q does not exist", member.Value)
+			}
+			return errInvalid("invalidValue", "nested group %q is not supported", member.Value)
+		}
+	}
+	return nil
+}
+
+// members removes duplicate members and fills in their display names
+func (d *Directory) members(members []MultiValue) []MultiValue {
+	seen := make(map[string]bool)
+	var result []MultiValue
+	for _, member := range members {
+		if seen[member.Value] {
+			continue
+		}
+		seen[member.Value] = true
+		user := d.users[member.Value]
+		result = append(result, MultiValue{Value: member.Value, Display: user.UserName, Type: "User"})
+	}
+	return result
+}
+
+func copyGroup(group *Group) *Group {
+	c := *group
+	c.Members = append([]MultiValue(nil), group.Members...)
+	meta := *group.Meta
+	c.Meta = &meta
+	return &c
+}
+
+// toMap converts a resource to its generic JSON form
+func toMap(resource interface{}) map[string]interface{} {
+	data, _ := json.Marshal(resource)
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	return m
+}
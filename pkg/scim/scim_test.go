@@ -0,0 +1,260 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testToken = "0123456789abcdef"
+
+func newTestHandler(t *testing.T) (*Handler, string) {
+	path := filepath.Join(t.TempDir(), "scim.json")
+	directory, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	return NewHandler(directory, testToken), path
+}
+
+// do sends a SCIM request and decodes the response into out
+func do(t *testing.T, h http.Handler, method, path, body string, out interface{}) int {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	request.Header.Set("Content-Type", ContentType)
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, request)
+	if out != nil && recorder.Body.Len() > 0 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s returned invalid JSON %q: %v", method, path, recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+func TestUserLifecycle(t *testing.T) {
+	h, path := newTestHandler(t)
+
+	var user User
+	if code := do(t, h, http.MethodPost, "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "jdoe@example.com",
+		"externalId": "00u1",
+		"name": {"givenName": "Jane", "familyName": "Doe"},
+		"emails": [{"value": "jdoe@example.com", "type": "work", "primary": true}],
+		"active": true
+	}`, &user); code != http.StatusCreated {
+		t.Fatalf("create user got %d", code)
+	}
+	if user.ID == "" || user.Meta == nil || user.Meta.ResourceType != "User" || !strings.HasSuffix(user.Meta.Location, "/scim/v2/Users/"+user.ID) {
+		t.Errorf("unexpected created user %+v", user)
+	}
+
+	var scimErr map[string]interface{}
+	if code := do(t, h, http.MethodPost, "/scim/v2/Users", `{"userName": "JDOE@example.com"}`, &scimErr); code != http.StatusConflict || scimErr["scimType"] != "uniqueness" || scimErr["status"] != "409" {
+		t.Errorf("duplicate user got %d %v", code, scimErr)
+	}
+
+	// Identity providers look users up by userName before creating them
+	var list struct {
+		TotalResults int
+		Resources    []User
+	}
+	if code := do(t, h, http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22JDoe@Example.com%22`, "", &list); code != http.StatusOK || list.TotalResults != 1 || list.Resources[0].ID != user.ID {
+		t.Errorf("filter by userName got %d %+v", code, list)
+	}
+	if do(t, h, http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22nobody%22`, "", &list); list.TotalResults != 0 {
+		t.Errorf("filter for unknown user returned %d results", list.TotalResults)
+	}
+
+	// Azure AD deactivates users with a string boolean
+	var patched User
+	if code := do(t, h, http.MethodPatch, "/scim/v2/Users/"+user.ID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": "False"},
+			{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "jane.doe@example.com"},
+			{"op": "Add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "R&D"}
+		]
+	}`, &patched); code != http.StatusOK {
+		t.Fatalf("patch user got %d", code)
+	}
+	if patched.IsActive() || patched.Emails[0].Value != "jane.doe@example.com" || patched.Meta.Version == user.Meta.Version {
+		t.Errorf("unexpected patched user %+v", patched)
+	}
+
+	// Okta sends replacements without a path
+	if do(t, h, http.MethodPatch, "/scim/v2/Users/"+user.ID, `{"Operations": [{"op": "replace", "value": {"active": true, "displayName": "Jane"}}]}`, &patched); !patched.IsActive() || patched.DisplayName != "Jane" {
+		t.Errorf("pathless patch got %+v", patched)
+	}
+	if code := do(t, h, http.MethodPatch, "/scim/v2/Users/"+user.ID, `{"Operations": [{"op": "replace", "path": "id", "value": "x"}]}`, &scimErr); code != http.StatusBadRequest || scimErr["scimType"] != "mutability" {
+		t.Errorf("patching id got %d %v", code, scimErr)
+	}
+
+	// Changes persist across restarts
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if groups, active, known := reopened.Lookup("jdoe@EXAMPLE.com"); !known || !active || len(groups) != 0 {
+		t.Errorf("Lookup() = %v, %v, %v", groups, active, known)
+	}
+
+	if code := do(t, h, http.MethodDelete, "/scim/v2/Users/"+user.ID, "", nil); code != http.StatusNoContent {
+		t.Errorf("delete user got %d", code)
+	}
+	if code := do(t, h, http.MethodGet, "/scim/v2/Users/"+user.ID, "", &scimErr); code != http.StatusNotFound {
+		t.Errorf("deleted user got %d", code)
+	}
+	if _, _, known := h.Directory.Lookup("jdoe@example.com"); known {
+		t.Error("deleted user is still known")
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	var alice, bob User
+	do(t, h, http.MethodPost, "/scim/v2/Users", `{"userName": "alice"}`, &alice)
+	do(t, h, http.MethodPost, "/scim/v2/Users", `{"userName": "bob"}`, &bob)
+
+	var group Group
+	if code := do(t, h, http.MethodPost, "/scim/v2/Groups", `{"displayName": "Engineering", "members": [{"value": "`+alice.ID+`"}]}`, &group); code != http.StatusCreated {
+		t.Fatalf("create group got %d", code)
+	}
+	if len(group.Members) != 1 || group.Members[0].Display != "alice" {
+		t.Errorf("unexpected members %+v", group.Members)
+	}
+
+	if code := do(t, h, http.MethodPatch, "/scim/v2/Groups/"+group.ID, `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "`+bob.ID+`"}, {"value": "`+alice.ID+`"}]}]}`, &group); code != http.StatusOK || len(group.Members) != 2 {
+		t.Errorf("add members got %d %+v", code, group.Members)
+	}
+	if groups, _, _ := h.Directory.Lookup("bob"); len(groups) != 1 || groups[0] != "Engineering" {
+		t.Errorf("Lookup(bob) groups = %v", groups)
+	}
+	var user User
+	if do(t, h, http.MethodGet, "/scim/v2/Users/"+bob.ID, "", &user); len(user.Groups) != 1 || user.Groups[0].Value != group.ID {
+		t.Errorf("user groups = %+v", user.Groups)
+	}
+
+	// Okta removes members with a filter, Azure AD with a value list
+	do(t, h, http.MethodPatch, "/scim/v2/Groups/"+group.ID, `{"Operations": [{"op": "remove", "path": "members[value eq \"`+bob.ID+`\"]"}]}`, &group)
+	if len(group.Members) != 1 || group.Members[0].Value != alice.ID {
+		t.Errorf("remove member by filter left %+v", group.Members)
+	}
+	group = Group{ID: group.ID}
+	do(t, h, http.MethodPatch, "/scim/v2/Groups/"+group.ID, `{"Operations": [{"op": "Remove", "path": "members", "value": [{"value": "`+alice.ID+`"}]}]}`, &group)
+	if len(group.Members) != 0 {
+		t.Errorf("remove member by value left %+v", group.Members)
+	}
+
+	var scimErr map[string]interface{}
+	if code := do(t, h, http.MethodPatch, "/scim/v2/Groups/"+group.ID, `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "missing"}]}]}`, &scimErr); code != http.StatusBadRequest {
+		t.Errorf("adding an unknown member got %d", code)
+	}
+	if code := do(t, h, http.MethodPatch, "/scim/v2/Groups/"+group.ID, `{"Operations": [{"op": "replace", "path": "displayName", "value": "Platform"}]}`, &group); code != http.StatusOK || group.DisplayName != "Platform" {
+		t.Errorf("rename group got %d %+v", code, group)
+	}
+
+	// Deleting a user removes it from its groups
+	do(t, h, http.MethodPatch, "/scim/v2/Groups/"+group.ID, `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "`+alice.ID+`"}]}]}`, nil)
+	do(t, h, http.MethodDelete, "/scim/v2/Users/"+alice.ID, "", nil)
+	group = Group{ID: group.ID}
+	if do(t, h, http.MethodGet, "/scim/v2/Groups/"+group.ID, "", &group); len(group.Members) != 0 {
+		t.Errorf("deleted user is still a member: %+v", group.Members)
+	}
+}
+
+func TestHandlerProtocol(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	for _, header := range []string{"", "Bearer wrong", "Basic " + testToken} {
+		request := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q got %d", header, recorder.Code)
+		}
+	}
+
+	var config map[string]interface{}
+	if code := do(t, h, http.MethodGet, "/scim/v2/ServiceProviderConfig", "", &config); code != http.StatusOK || config["patch"].(map[string]interface{})["supported"] != true {
+		t.Errorf("ServiceProviderConfig got %d %v", code, config)
+	}
+
+	for i := 0; i < 5; i++ {
+		do(t, h, http.MethodPost, "/scim/v2/Users", `{"userName": "user`+string(rune('a'+i))+`"}`, nil)
+	}
+	var page struct {
+		TotalResults int
+		StartIndex   int
+		ItemsPerPage int
+		Resources    []User
+	}
+	if do(t, h, http.MethodGet, "/scim/v2/Users?startIndex=2&count=2", "", &page); page.TotalResults != 5 || page.ItemsPerPage != 2 || page.Resources[0].UserName != "userb" {
+		t.Errorf("paging got %+v", page)
+	}
+	if do(t, h, http.MethodGet, "/scim/v2/Users?startIndex=9", "", &page); page.ItemsPerPage != 0 || page.Resources == nil {
+		t.Errorf("paging past the end got %+v", page)
+	}
+
+	var scimErr map[string]interface{}
+	if code := do(t, h, http.MethodGet, `/scim/v2/Users?filter=(userName+eq+%22a%22)`, "", &scimErr); code != http.StatusBadRequest || scimErr["scimType"] != "invalidFilter" {
+		t.Errorf("unsupported filter got %d %v", code, scimErr)
+	}
+	if code := do(t, h, http.MethodPost, "/scim/v2/Users", `{"userName": `, &scimErr); code != http.StatusBadRequest {
+		t.Errorf("invalid body got %d", code)
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	resource := toMap(&User{
+		UserName:   "jdoe",
+		ExternalID: "00u1",
+		Emails:     []MultiValue{{Value: "jdoe@example.com", Type: "work"}},
+		Meta:       &Meta{},
+	})
+	tests := map[string]bool{
+		`userName eq "JDOE"`:                                            true,
+		`userName ne "jdoe"`:                                            false,
+		`emails.value ew "@example.com"`:                                true,
+		`emails co "example"`:                                           true,
+		`externalId eq "00u1" and userName sw "j"`:                      true,
+		`externalId eq "00u2" or userName eq "jdoe"`:                    true,
+		`displayName pr`:                                                false,
+		`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jdoe"`: true,
+	}
+	for filter, want := range tests {
+		match, err := compileFilter(filter)
+		if err != nil {
+			t.Errorf("compileFilter(%q) failed: %v", filter, err)
+			continue
+		}
+		if got := match(resource); got != want {
+			t.Errorf("filter %q = %v, want %v", filter, got, want)
+		}
+	}
+	for _, invalid := range []string{`userName eq`, `userName like "x"`, `userName eq "x`, `userName eq "x" xor id pr`} {
+		if _, err := compileFilter(invalid); err == nil {
+			t.Errorf("compileFilter(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	data, err := json.Marshal(errConflict("user %q already exists", "jdoe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"status":"409"`)) || !bytes.Contains(data, []byte(SchemaError)) {
+		t.Errorf("error JSON = %s", data)
+	}
+}
@@ -0,0 +1,211 @@
+// Package sections gives the headings and sections of document pages stable
+// anchors, so links can point at a section of a document. Anchors are made
+// from the heading text at build time, and stay the same across builds as
+// long as the text does.
+package sections
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MaxAnchor is the longest anchor made from a heading, in bytes
+const MaxAnchor = 64
+
+// Section is a heading of a page and the anchor linking to it
+type Section struct {
+	// ID is the anchor: the id of the heading, or of the section element
+	// the heading starts
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Level is 1 to 6, as the heading element
+	Level int `json:"level"`
+}
+
+// Slug turns heading text into an anchor: lower case letters and digits,
+// with dashes between words
+func Slug(text string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			next := string(r)
+			if dash && slug.Len() > 0 {
+				next = "-" + next
+			}
+			dash = false
+			if slug.Len()+len(next) > MaxAnchor {
+				return slug.String()
+			}
+			slug.WriteString(next)
+		default:
+			dash = true
+		}
+	}
+	return slug.String()
+}
+
+// heading is a heading found in a page, and where the anchor made for it
+// goes when it has none
+type heading struct {
+	Section
+	// insert is the offset after the tag name of the element the anchor is
+	// added to, or -1 when the heading has an anchor
+	insert int
+}
+
+// scan finds the headings of a page and every id it uses. Offsets are into
+// page, so anchors can be added without rewriting the rest of the markup.
+func scan(page []byte) ([]*heading, map[string]bool) {
+	var (
+		headings []*heading
+		current  *heading
+		text     strings.Builder
+		ids      = make(map[string]bool)
+		offset   int
+		// section is the offset of a section element without an id that
+		// no heading has started yet, or -1; sectionID is the id of such a
+		// section that has one
+		section       = -1
+		sectionLength int
+		sectionID     string
+	)
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := len(z.Raw())
+		token := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			id := ""
+			for _, attr := range token.Attr {
+				if attr.Key == "id" {
+					id = attr.Val
+				}
+			}
+			if id != "" {
+				ids[id] = true
+			}
+			switch token.DataAtom {
+			case atom.Section:
+				section, sectionID = -1, id
+				if id == "" {
+					section, sectionLength = offset, len(token.Data)
+				}
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				current = &heading{Section: Section{ID: id, Level: int(token.Data[1] - '0')}, insert: -1}
+				if id == "" && sectionID != "" {
+					current.ID = sectionID
+				} else if id == "" {
+					current.insert = offset + 1 + len(token.Data)
+					if section >= 0 {
+						// The section is the better target, taking the
+						// heading and the text below it
+						current.insert = section + 1 + sectionLength
+					}
+				}
+				section, sectionID = -1, ""
+				text.Reset()
+			}
+		case html.TextToken:
+			if current != nil {
+				text.WriteString(token.Data)
+			}
+		case html.EndTagToken:
+			if current != nil && token.Data == "h"+strconv.Itoa(current.Level) {
+				current.Title = strings.Join(strings.Fields(text.String()), " ")
+				headings = append(headings, current)
+				current = nil
+			}
+		}
+		offset += raw
+	}
+	return headings, ids
+}
+
+// Anchor gives the headings of a page that have no id, and are not the
+// first heading of a section with one, an anchor made from their text. The
+// anchor goes on the section element a heading starts when the section has
+// no id. It returns the page and the number of anchors added; the rest of
+// the markup is left as it is.
+func Anchor(page []byte) ([]byte, int) {
+	headings, ids := scan(page)
+	var added []*heading
+	for _, h := range headings {
+		if h.insert < 0 {
+			continue
+		}
+		base := Slug(h.Title)
+		if base == "" {
+			base = "section"
+		}
+		h.ID = base
+		for n := 2; ids[h.ID]; n++ {
+			h.ID = fmt.Sprintf("%s-%d", base, n)
+		}
+		ids[h.ID] = true
+		added = append(added, h)
+	}
+	if len(added) == 0 {
+		return page, 0
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(page) + len(added)*24)
+	last := 0
+	for _, h := range added {
+		out.Write(page[last:h.insert])
+		out.WriteString(` id="` + html.EscapeString(h.ID) + `"`)
+		last = h.insert
+	}
+	out.Write(page[last:])
+	return out.Bytes(), len(added)
+}
+
+// List returns the sections of a page with an anchor, in page order
+func List(page []byte) []Section {
+	headings, _ := scan(page)
+	list := []Section{}
+	for _, h := range headings {
+		if h.insert < 0 {
+			list = append(list, h.Section)
+		}
+	}
+	return list
+}
+
+// Match finds the section of a page a link's anchor points at: the section
+// with that id, any other element with it, or else the section whose
+// anchor or heading the anchor is the slug of, so links written by hand and
+// links to headings whose anchor changed with their text still resolve
+func Match(page []byte, anchor string) (Section, bool) {
+	if anchor == "" {
+		return Section{}, false
+	}
+	headings, ids := scan(page)
+	for _, h := range headings {
+		if h.insert < 0 && h.ID == anchor {
+			return h.Section, true
+		}
+	}
+	if ids[anchor] {
+		return Section{ID: anchor}, true
+	}
+	slug := Slug(anchor)
+	for _, h := range headings {
+		if h.insert < 0 && slug != "" && (Slug(h.ID) == slug || Slug(h.Title) == slug) {
+			return h.Section, true
+		}
+	}
+	return Section{}, false
+}
@@ -0,0 +1,89 @@
+package sections
+
+import (
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html><head><title>Report</title></head>
+<body>
+<H1 class="title">Annual Report</H1>
+<section>
+  <h2>Results &amp; <em>Outlook</em></h2>
+  <p>Revenue grew.</p>
+</section>
+<h2 id="method">Method</h2>
+<h3>Results</h3>
+<h3>  </h3>
+</body></html>`
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Results & Outlook":      "results-outlook",
+		"  2024: Year in Review": "2024-year-in-review",
+		"Über uns":               "über-uns",
+		"---":                    "",
+	}
+	for text, want := range tests {
+		if got := Slug(text); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", text, got, want)
+		}
+	}
+	if got := Slug(strings.Repeat("word ", 40)); len(got) > MaxAnchor || strings.HasSuffix(got, "-") {
+		t.Errorf("Expected long anchors to be cut at a word, got %q", got)
+	}
+}
+
+func TestAnchor(t *testing.T) {
+	anchored, added := Anchor([]byte(page))
+	if added != 4 {
+		t.Fatalf("Expected 4 anchors added, got %d:\n%s", added, anchored)
+	}
+	for _, want := range []string{
+		`<H1 id="annual-report" class="title">`,
+		`<section id="results-outlook">`,
+		`<h2>Results &amp; <em>Outlook</em></h2>`,
+		`<h2 id="method">`,
+		`<h3 id="results">`,
+		`<h3 id="section">`,
+	} {
+		if !strings.Contains(string(anchored), want) {
+			t.Errorf("Expected %s in:\n%s", want, anchored)
+		}
+	}
+
+	again, added := Anchor(anchored)
+	if added != 0 || string(again) != string(anchored) {
+		t.Errorf("Expected anchoring to be idempotent, added %d", added)
+	}
+
+	list := List(anchored)
+	want := []Section{{"annual-report", "Annual Report", 1}, {"results-outlook", "Results & Outlook", 2}, {"method", "Method", 2}, {"results", "Results", 3}, {"section", "", 3}}
+	if len(list) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, list)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("Section %d: expected %v, got %v", i, want[i], list[i])
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	anchored, _ := Anchor([]byte(page))
+	tests := map[string]string{
+		"method":            "method",
+		"results":           "results",
+		"Results & Outlook": "results-outlook",
+		"Method":            "method",
+	}
+	for anchor, want := range tests {
+		if section, ok := Match(anchored, anchor); !ok || section.ID != want {
+			t.Errorf("Match(%q) = %v, %v, want %s", anchor, section, ok, want)
+		}
+	}
+	if _, ok := Match(anchored, "missing"); ok {
+		t.Errorf("Expected unknown anchors not to match")
+	}
+}
@@ -0,0 +1,223 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditAPIPathPrefix is where AuditAPI is served
+//
+//	GET /api/v1/audit          audit trail; filters: since, until (RFC 3339),
+//	                           user, action (repeatable), resource, success,
+//	                           limit, offset
+//	GET /api/v1/audit/events   security events; filters: since, until, user,
+//	                           type and severity (repeatable), policy,
+//	                           source, limit, offset
+//	GET /api/v1/audit/events/stream
+//	                           security events as server-sent events as they
+//	                           are logged, filtered as above; since replays
+//	                           the events logged from then first
+//	GET /api/v1/audit/export   the audit log as ?format=json or csv between
+//	                           since and until
+const AuditAPIPathPrefix = "/api/v1/audit"
+
+// defaultAuditLimit caps the entries returned when a request sets no limit
+const defaultAuditLimit = 1000
+
+// AuditAPI serves the audit trail and security events as JSON over HTTP for
+// review. It only reads. Authenticate requests before they reach it.
+type AuditAPI struct {
+	events SecurityEventLogger
+	audit  AuditLogger
+}
+
+// NewAuditAPI creates an audit API reading from the given loggers
+func NewAuditAPI(events SecurityEventLogger, audit AuditLogger) *AuditAPI {
+	return &AuditAPI{events: events, audit: audit}
+}
+
+// ServeHTTP serves the routes under AuditAPIPathPrefix
+func (api *AuditAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writePolicyAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	start, end, err := auditTimeRange(query.Get("since"), query.Get("until"))
+	if err != nil {
+		writePolicyAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, offset, err := auditPage(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		writePolicyAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, AuditAPIPathPrefix), "/") {
+	case "":
+		if api.audit == nil {
+			writePolicyAPIError(w, http.StatusNotFound, "audit logging is not enabled")
+			return
+		}
+		filter := &AuditFilter{
+			StartTime: start,
+			EndTime:   end,
+			Actions:   query["action"],
+			UserID:    query.Get("user"),
+			Resource:  query.Get("resource"),
+			Limit:     limit,
+			Offset:    offset,
+		}
+		if value := query.Get("success"); value != "" {
+			success, err := strconv.ParseBool(value)
+			if err != nil {
+				writePolicyAPIError(w, http.StatusBadRequest, "success must be true or false")
+				return
+			}
+			filter.Success = &success
+		}
+		events, err := api.audit.GetAuditTrail(filter)
+		if err != nil {
+			writePolicyAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if events == nil {
+			events = []*AuditEvent{}
+		}
+		writePolicyAPIJSON(w, http.StatusOK, events)
+	case "events":
+		if api.events == nil {
+			writePolicyAPIError(w, http.StatusNotFound, "security event logging is not enabled")
+			return
+		}
+		filter := &EventFilter{
+			StartTime: start,
+			EndTime:   end,
+			UserID:    query.Get("user"),
+			PolicyID:  query.Get("policy"),
+			Source:    query.Get("source"),
+			Limit:     limit,
+			Offset:    offset,
+		}
+		filter.EventTypes = eventTypes(query["type"])
+		filter.Severities = eventSeverities(query["severity"])
+		events, err := api.events.GetSecurityEvents(filter)
+		if err != nil {
+			writePolicyAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if events == nil {
+			events = []*SecurityEvent{}
+		}
+		writePolicyAPIJSON(w, http.StatusOK, events)
+	case "events/stream":
+		stream, ok := api.events.(*EventStream)
+		if !ok {
+			writePolicyAPIError(w, http.StatusNotFound, "security event streaming is not enabled")
+			return
+		}
+		filter := &EventFilter{
+			StartTime:  start,
+			UserID:     query.Get("user"),
+			PolicyID:   query.Get("policy"),
+			Source:     query.Get("source"),
+			EventTypes: eventTypes(query["type"]),
+			Severities: eventSeverities(query["severity"]),
+			Limit:      limit,
+		}
+		stream.serveEvents(w, r, filter)
+	case "export":
+		if api.audit == nil {
+			writePolicyAPIError(w, http.StatusNotFound, "audit logging is not enabled")
+			return
+		}
+		format := query.Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			writePolicyAPIError(w, http.StatusBadRequest, "format must be json or csv")
+			return
+		}
+		timeRange := &TimeRange{Start: time.Unix(0, 0), End: time.Now()}
+		if start != nil {
+			timeRange.Start = *start
+		}
+		if end != nil {
+			timeRange.End = *end
+		}
+		data, err := api.audit.ExportAuditLog(format, timeRange)
+		if err != nil {
+			writePolicyAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		contentType := "application/json"
+		if format == "csv" {
+			contentType = "text/csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.`+format+`"`)
+		w.Write(data)
+	default:
+		writePolicyAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// auditTimeRange parses the since and until parameters
+func auditTimeRange(since, until string) (start, end *time.Time, err error) {
+	parse := func(name, value string) (*time.Time, error) {
+		if value == "" {
+			return nil, nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 time", name)
+		}
+		return &t, nil
+	}
+	if start, err = parse("since", since); err != nil {
+		return nil, nil, err
+	}
+	if end, err = parse("until", until); err != nil {
+		return nil, nil, err
+	}
+	return start, end, nil
+}
+
+// auditPage parses the limit and offset parameters
+func auditPage(limitValue, offsetValue string) (limit, offset int, err error) {
+	limit = defaultAuditLimit
+	if limitValue != "" {
+		if limit, err = strconv.Atoi(limitValue); err != nil || limit <= 0 || limit > defaultAuditLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", defaultAuditLimit)
+		}
+	}
+	if offsetValue != "" {
+		if offset, err = strconv.Atoi(offsetValue); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+func eventTypes(values []string) []SecurityEventType {
+	var types []SecurityEventType
+	for _, value := range values {
+		types = append(types, SecurityEventType(value))
+	}
+	return types
+}
+
+func eventSeverities(values []string) []SecurityEventSeverity {
+	var severities []SecurityEventSeverity
+	for _, value := range values {
+		severities = append(severities, SecurityEventSeverity(value))
+	}
+	return severities
+}
@@ -0,0 +1,135 @@
+package security
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditAPI(t *testing.T) {
+	dir := t.TempDir()
+	auditLogger := NewFileAuditLogger(filepath.Join(dir, "audit.log"))
+	eventLogger := NewFileSecurityEventLogger(filepath.Join(dir, "security-events.log"))
+	for _, event := range []*AuditEvent{
+		{ID: "1", Timestamp: time.Now().Add(-2 * time.Hour), Action: "create_policy", Resource: "strict", UserID: "alice", Success: true},
+		{ID: "2", Timestamp: time.Now(), Action: "delete_policy", Resource: "strict", UserID: "bob", Success: false},
+	} {
+		if err := auditLogger.LogAuditEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := eventLogger.LogSecurityEvent(&SecurityEvent{ID: "e1", Timestamp: time.Now(), EventType: EventPolicyViolation, Severity: SeverityHigh}); err != nil {
+		t.Fatal(err)
+	}
+	api := NewAuditAPI(eventLogger, auditLogger)
+
+	request := func(method, target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+		return recorder
+	}
+	trail := func(target string) []*AuditEvent {
+		recorder := request(http.MethodGet, target)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET %s got %d: %s", target, recorder.Code, recorder.Body.String())
+		}
+		var events []*AuditEvent
+		json.NewDecoder(recorder.Body).Decode(&events)
+		return events
+	}
+
+	if events := trail(AuditAPIPathPrefix); len(events) != 2 {
+		t.Errorf("Expected the whole audit trail, got %d events", len(events))
+	}
+	if events := trail(AuditAPIPathPrefix + "?user=alice"); len(events) != 1 || events[0].Action != "create_policy" {
+		t.Errorf("Expected alice's change, got %+v", events)
+	}
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if events := trail(AuditAPIPathPrefix + "?success=false&since=" + since); len(events) != 1 || events[0].UserID != "bob" {
+		t.Errorf("Expected bob's failed change, got %+v", events)
+	}
+	if recorder := request(http.MethodGet, AuditAPIPathPrefix+"/events"); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"e1"`) {
+		t.Errorf("Expected the security events, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := request(http.MethodGet, AuditAPIPathPrefix+"/export?format=csv"); recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("Expected a CSV export, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	for target, status := range map[string]int{
+		AuditAPIPathPrefix + "?since=yesterday":   http.StatusBadRequest,
+		AuditAPIPathPrefix + "?limit=0":           http.StatusBadRequest,
+		AuditAPIPathPrefix + "/export?format=xml": http.StatusBadRequest,
+		AuditAPIPathPrefix + "/unknown":           http.StatusNotFound,
+	} {
+		if recorder := request(http.MethodGet, target); recorder.Code != status {
+			t.Errorf("GET %s got %d, want %d", target, recorder.Code, status)
+		}
+	}
+	if recorder := request(http.MethodDelete, AuditAPIPathPrefix); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected the audit trail to be read-only, got %d", recorder.Code)
+	}
+}
+
+func TestAuditAPIEventStream(t *testing.T) {
+	stream := NewEventStream(NewFileSecurityEventLogger(filepath.Join(t.TempDir(), "security-events.log")))
+	if err := stream.LogSecurityEvent(&SecurityEvent{ID: "e1", Timestamp: time.Now().Add(-time.Minute), EventType: EventPolicyViolation, Severity: SeverityHigh}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewAuditAPI(stream, nil))
+	defer server.Close()
+
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	resp, err := http.Get(server.URL + AuditAPIPathPrefix + "/events/stream?severity=high&since=" + since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events <- data
+			}
+		}
+		close(events)
+	}()
+	next := func() *SecurityEvent {
+		select {
+		case data := <-events:
+			var event SecurityEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("Unreadable event %q: %v", data, err)
+			}
+			return &event
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an event")
+			return nil
+		}
+	}
+
+	if event := next(); event.ID != "e1" {
+		t.Errorf("Expected the logged event to be replayed first, got %+v", event)
+	}
+	stream.LogSecurityEvent(&SecurityEvent{ID: "e2", Timestamp: time.Now(), EventType: EventResourceExceeded, Severity: SeverityLow})
+	stream.LogSecurityEvent(&SecurityEvent{ID: "e3", Timestamp: time.Now(), EventType: EventPolicyViolation, Severity: SeverityHigh, Description: "live"})
+	if event := next(); event.ID != "e3" || event.Description != "live" {
+		t.Errorf("Expected the high severity event as it was logged, got %+v", event)
+	}
+
+	recorder := httptest.NewRecorder()
+	api := NewAuditAPI(NewFileSecurityEventLogger(filepath.Join(t.TempDir(), "events.log")), nil)
+	api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, AuditAPIPathPrefix+"/events/stream", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected no stream without an event stream, got %d", recorder.Code)
+	}
+}
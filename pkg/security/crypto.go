@@ -0,0 +1,66 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Ed25519CryptoProvider implements core.CryptoProvider with Ed25519
+// signatures and SHA-256 hashes
+type Ed25519CryptoProvider struct{}
+
+// NewEd25519CryptoProvider creates an Ed25519 crypto provider
+func NewEd25519CryptoProvider() *Ed25519CryptoProvider {
+	return &Ed25519CryptoProvider{}
+}
+
+// GenerateKeyPair generates an Ed25519 key pair
+func (cp *Ed25519CryptoProvider) GenerateKeyPair() (publicKey, privateKey []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return pub, priv, nil
+}
+
+// Sign signs data with an Ed25519 private key, or the 32 byte seed it is
+// derived from
+func (cp *Ed25519CryptoProvider) Sign(data []byte, privateKey []byte) ([]byte, error) {
+	switch len(privateKey) {
+	case ed25519.PrivateKeySize:
+		return ed25519.Sign(ed25519.PrivateKey(privateKey), data), nil
+	case ed25519.SeedSize:
+		return ed25519.Sign(ed25519.NewKeyFromSeed(privateKey), data), nil
+	default:
+		return nil, fmt.Errorf("invalid Ed25519 private key length %d", len(privateKey))
+	}
+}
+
+// Verify reports whether signature is a valid Ed25519 signature of data
+func (cp *Ed25519CryptoProvider) Verify(data []byte, signature []byte, publicKey []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(publicKey), data, signature)
+}
+
+// Hash returns the SHA-256 digest of data
+func (cp *Ed25519CryptoProvider) Hash(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// GenerateRandomBytes returns length bytes from the system's secure random
+// source
+func (cp *Ed25519CryptoProvider) GenerateRandomBytes(length int) ([]byte, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("invalid length %d", length)
+	}
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,118 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEd25519CryptoProvider(t *testing.T) {
+	cp := NewEd25519CryptoProvider()
+	pub, priv, err := cp.GenerateKeyPair()
+	require.NoError(t, err)
+
+	data := []byte("document content")
+	sig, err := cp.Sign(data, priv)
+	require.NoError(t, err)
+	assert.True(t, cp.Verify(data, sig, pub))
+	assert.False(t, cp.Verify([]byte("tampered content"), sig, pub))
+	assert.False(t, cp.Verify(data, []byte("mock-signature"), pub))
+
+	seeded, err := cp.Sign(data, priv[:32])
+	require.NoError(t, err)
+	assert.Equal(t, sig, seeded, "Signing with the seed should match the private key")
+	_, err = cp.Sign(data, []byte("mock-private-key"))
+	assert.Error(t, err)
+
+	assert.Len(t, cp.Hash(data), 32)
+	assert.NotEqual(t, cp.Hash(data), cp.Hash([]byte("other")))
+	random, err := cp.GenerateRandomBytes(16)
+	require.NoError(t, err)
+	other, _ := cp.GenerateRandomBytes(16)
+	assert.NotEqual(t, random, other)
+
+	sm := NewSecurityManager(cp, nil, nil)
+	signature, err := sm.CreateSignature(data, priv)
+	require.NoError(t, err)
+	assert.True(t, sm.ValidateSignature(data, signature, pub))
+	assert.False(t, sm.ValidateSignature(data, "not hex", pub))
+}
+
+func TestValidateTrustChain(t *testing.T) {
+	cp := NewEd25519CryptoProvider()
+	pm := NewPermissionManager(nil, nil, cp, nil)
+
+	rootPub, rootPriv, _ := cp.GenerateKeyPair()
+	require.NoError(t, pm.AddTrustedSigner(&TrustedSigner{ID: "root", Name: "Root", PublicKey: rootPub, TrustLevel: TrustLevelSystem}))
+
+	orgPub, orgPriv, _ := cp.GenerateKeyPair()
+	org := &TrustedSigner{ID: "org", Name: "Org", PublicKey: orgPub, TrustLevel: TrustLevelOrganization, IssuerID: "root",
+		ValidFrom: time.Now().Add(-time.Hour), ValidUntil: time.Now().Add(time.Hour)}
+	org.Certificate, _ = cp.Sign(org.CertificateData(), rootPriv)
+	require.NoError(t, pm.AddTrustedSigner(org))
+	assert.Error(t, pm.AddTrustedSigner(&TrustedSigner{ID: "orphan", PublicKey: orgPub, TrustLevel: TrustLevelUser}), "Non-system signers need an issuer")
+
+	content := []byte(`{"title":"Report"}`)
+	sig, _ := cp.Sign(content, orgPriv)
+	signature := &DocumentSignature{SignerID: "org", Content: content, Signature: sig}
+
+	chain, err := pm.validateTrustChain(context.Background(), signature)
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, "org", chain[0].ID)
+	assert.Equal(t, "root", chain[1].ID)
+	assert.NoError(t, checkTrustAnchors(chain, []string{"root"}))
+	assert.Error(t, checkTrustAnchors(chain, []string{"other-ca"}))
+
+	_, err = pm.validateTrustChain(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrUnsignedDocument)
+	_, err = pm.validateTrustChain(context.Background(), &DocumentSignature{SignerID: "org", Content: []byte("tampered"), Signature: sig})
+	assert.Error(t, err, "A signature of other content should not verify")
+
+	// A certificate issued by another key does not chain to the root
+	forged := *org
+	forged.ID = "forged"
+	forged.Certificate, _ = cp.Sign(forged.CertificateData(), orgPriv)
+	require.NoError(t, pm.AddTrustedSigner(&forged))
+	forgedSig, _ := cp.Sign(content, orgPriv)
+	_, err = pm.validateTrustChain(context.Background(), &DocumentSignature{SignerID: "forged", Content: content, Signature: forgedSig})
+	assert.Error(t, err)
+
+	// Revoking the issuer breaks the chains through it
+	require.NoError(t, pm.RevokeTrustedSigner("root"))
+	_, err = pm.validateTrustChain(context.Background(), signature)
+	assert.Error(t, err)
+}
+
+func TestHandleTrustChain(t *testing.T) {
+	cp := NewEd25519CryptoProvider()
+	pm := NewPermissionManager(nil, nil, cp, nil)
+	pub, priv, _ := cp.GenerateKeyPair()
+	require.NoError(t, pm.AddTrustedSigner(&TrustedSigner{ID: "system-ca", PublicKey: pub, TrustLevel: TrustLevelSystem}))
+
+	content := []byte("manifest")
+	sig, _ := cp.Sign(content, priv)
+	body, _ := json.Marshal(&DocumentSignature{SignerID: "system-ca", Content: content, Signature: sig})
+	w := httptest.NewRecorder()
+	pm.handleTrustChain(w, httptest.NewRequest(http.MethodPost, "/api/permissions/trust-chain", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var chain []*TrustedSigner
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &chain))
+	assert.Len(t, chain, 1)
+
+	body, _ = json.Marshal(&DocumentSignature{SignerID: "system-ca", Content: []byte("other"), Signature: sig})
+	w = httptest.NewRecorder()
+	pm.handleTrustChain(w, httptest.NewRequest(http.MethodPost, "/api/permissions/trust-chain", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = httptest.NewRecorder()
+	pm.handleTrustChain(w, httptest.NewRequest(http.MethodGet, "/api/permissions/trust-chain?document_id=doc", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -127,6 +127,12 @@ func (fsel *FileSecurityEventLogger) GetEventStatistics(timeRange *TimeRange) (*
 		return nil, fmt.Errorf("failed to get events for statistics: %w", err)
 	}
 	
+	return SummarizeEvents(events), nil
+}
+
+// SummarizeEvents counts security events by type, severity, hour, source
+// and user
+func SummarizeEvents(events []*SecurityEvent) *EventStatistics {
 	stats := &EventStatistics{
 		TotalEvents:      len(events),
 		EventsByType:     make(map[SecurityEventType]int),
@@ -166,7 +172,7 @@ func (fsel *FileSecurityEventLogger) GetEventStatistics(timeRange *TimeRange) (*
 		stats.TopUsers = append(stats.TopUsers, EventUserStat{UserID: user, Count: count})
 	}
 	
-	return stats, nil
+	return stats
 }
 
 // LogAuditEvent logs an audit event to file
@@ -249,11 +255,16 @@ func (fal *FileAuditLogger) ExportAuditLog(format string, timeRange *TimeRange)
 		return nil, fmt.Errorf("failed to get audit events: %w", err)
 	}
 	
+	return ExportAuditEvents(events, format)
+}
+
+// ExportAuditEvents encodes audit events as json or csv
+func ExportAuditEvents(events []*AuditEvent, format string) ([]byte, error) {
 	switch format {
 	case "json":
 		return json.MarshalIndent(events, "", "  ")
 	case "csv":
-		return fal.exportToCSV(events)
+		return exportAuditCSV(events)
 	default:
 		return nil, fmt.Errorf("unsupported export format: %s", format)
 	}
@@ -262,6 +273,11 @@ func (fal *FileAuditLogger) ExportAuditLog(format string, timeRange *TimeRange)
 // Helper functions
 
 func (fsel *FileSecurityEventLogger) matchesFilter(event *SecurityEvent, filter *EventFilter) bool {
+	return eventMatches(event, filter)
+}
+
+// eventMatches reports whether a security event passes a filter
+func eventMatches(event *SecurityEvent, filter *EventFilter) bool {
 	if filter == nil {
 		return true
 	}
@@ -365,7 +381,7 @@ func (fal *FileAuditLogger) matchesAuditFilter(event *AuditEvent, filter *AuditF
 	return true
 }
 
-func (fal *FileAuditLogger) exportToCSV(events []*AuditEvent) ([]byte, error) {
+func exportAuditCSV(events []*AuditEvent) ([]byte, error) {
 	if len(events) == 0 {
 		return []byte("timestamp,action,resource,user_id,success,details\n"), nil
 	}
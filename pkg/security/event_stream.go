@@ -0,0 +1,184 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventStreamBuffer is how many events a subscriber may fall behind before
+// events are dropped for it
+const eventStreamBuffer = 256
+
+// eventStreamKeepAlive is how often an idle stream sends a comment, so
+// proxies keep the connection open and clients notice when it breaks
+var eventStreamKeepAlive = 15 * time.Second
+
+// EventStream is a SecurityEventLogger that publishes the events it logs to
+// subscribers as they happen. Events are logged by the logger it wraps, which
+// also answers queries.
+type EventStream struct {
+	SecurityEventLogger
+	mutex       sync.Mutex
+	subscribers map[*eventSubscription]struct{}
+}
+
+// eventSubscription is a subscriber's queue of events and its filter
+type eventSubscription struct {
+	events  chan *SecurityEvent
+	filter  *EventFilter
+	dropped int
+}
+
+// NewEventStream creates an event stream publishing the events logged to
+// events
+func NewEventStream(events SecurityEventLogger) *EventStream {
+	return &EventStream{SecurityEventLogger: events, subscribers: make(map[*eventSubscription]struct{})}
+}
+
+// LogSecurityEvent logs an event, then publishes it to the subscribers whose
+// filters it passes. Subscribers that fall behind miss events rather than
+// holding up logging.
+func (es *EventStream) LogSecurityEvent(event *SecurityEvent) error {
+	if err := es.SecurityEventLogger.LogSecurityEvent(event); err != nil {
+		return err
+	}
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	for sub := range es.subscribers {
+		if !eventMatches(event, sub.filter) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped++
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the events logged from now on that pass filter, and a
+// function ending the subscription, which closes the channel
+func (es *EventStream) Subscribe(filter *EventFilter) (<-chan *SecurityEvent, func()) {
+	sub := es.subscribe(filter)
+	var once sync.Once
+	return sub.events, func() { once.Do(func() { es.unsubscribe(sub) }) }
+}
+
+func (es *EventStream) subscribe(filter *EventFilter) *eventSubscription {
+	sub := &eventSubscription{events: make(chan *SecurityEvent, eventStreamBuffer), filter: filter}
+	es.mutex.Lock()
+	es.subscribers[sub] = struct{}{}
+	es.mutex.Unlock()
+	return sub
+}
+
+func (es *EventStream) unsubscribe(sub *eventSubscription) {
+	es.mutex.Lock()
+	delete(es.subscribers, sub)
+	es.mutex.Unlock()
+	close(sub.events)
+}
+
+// takeDropped returns and resets the count of events a subscriber missed
+func (es *EventStream) takeDropped(sub *eventSubscription) int {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	dropped := sub.dropped
+	sub.dropped = 0
+	return dropped
+}
+
+// serveEvents streams the events passing filter as server-sent events: each
+// is a "security" event whose data is the event as JSON and whose id is the
+// event ID. With since set, the events logged from then are sent first, so a
+// client that reconnects with the time of the last event it saw misses none.
+// Events missed by a client that fell behind are reported as a "dropped"
+// event with their count.
+func (es *EventStream) serveEvents(w http.ResponseWriter, r *http.Request, filter *EventFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writePolicyAPIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Subscribe before reading the backlog, so no event falls between them
+	live := *filter
+	live.StartTime, live.EndTime, live.Limit, live.Offset = nil, nil, 0, 0
+	sub := es.subscribe(&live)
+	defer es.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprintf(w, "retry: %d\n\n", 5000)
+
+	sent := make(map[string]bool)
+	if filter.StartTime != nil {
+		backlog, err := es.GetSecurityEvents(filter)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", jsonString(err.Error()))
+		}
+		for _, event := range backlog {
+			if writeStreamEvent(w, event) != nil {
+				return
+			}
+			if event.ID != "" {
+				sent[event.ID] = true
+			}
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.events:
+			if event.ID != "" && sent[event.ID] {
+				delete(sent, event.ID)
+				continue
+			}
+			if dropped := es.takeDropped(sub); dropped > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped)
+			}
+			if writeStreamEvent(w, event) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, event *SecurityEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// An ID that would break the framing is left out
+	if event.ID != "" && !strings.ContainsAny(event.ID, "\r\n") {
+		fmt.Fprintf(w, "id: %s\n", event.ID)
+	}
+	_, err = fmt.Fprintf(w, "event: security\ndata: %s\n\n", data)
+	return err
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
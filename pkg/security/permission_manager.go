@@ -6,8 +6,12 @@ package security
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/liv-format/liv/pkg/core"
@@ -19,10 +23,25 @@ type PermissionManager struct {
 	securityManager core.SecurityManager
 	cryptoProvider  core.CryptoProvider
 	logger          core.Logger
+	signersMu       sync.RWMutex
 	trustedSigners  map[string]*TrustedSigner
+	// signatures holds the last verified signature of each document
+	signatures      map[string]*DocumentSignature
 	permissionCache map[string]*PermissionEvaluation
 }
 
+// ErrUnsignedDocument is returned when a trust chain is asked for a document
+// without a signature
+var ErrUnsignedDocument = errors.New("document is not signed")
+
+// Trust levels of signers. System signers are trust anchors; the others are
+// certified by the signer named by their IssuerID.
+const (
+	TrustLevelSystem       = "system"
+	TrustLevelOrganization = "organization"
+	TrustLevelUser         = "user"
+)
+
 // TrustedSigner represents a trusted certificate authority or signer
 type TrustedSigner struct {
 	ID          string    `json:"id"`
@@ -33,6 +52,45 @@ type TrustedSigner struct {
 	ValidUntil  time.Time `json:"valid_until"`
 	Revoked     bool      `json:"revoked"`
 	TrustLevel  string    `json:"trust_level"` // "system", "organization", "user"
+	// IssuerID names the signer whose signature of CertificateData is
+	// Certificate; system signers have none
+	IssuerID string `json:"issuer_id,omitempty"`
+}
+
+// CertificateData returns what an issuer signs to certify a signer: its ID,
+// public key and validity period
+func (s *TrustedSigner) CertificateData() []byte {
+	return []byte(fmt.Sprintf("liv-signer-certificate\n%s\n%s\n%x\n%s\n%s\n",
+		s.ID, s.IssuerID, s.PublicKey, formatValidity(s.ValidFrom), formatValidity(s.ValidUntil)))
+}
+
+func formatValidity(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// validAt reports whether a signer may be trusted at a time
+func (s *TrustedSigner) validAt(t time.Time) error {
+	if s.Revoked {
+		return fmt.Errorf("signer %s is revoked", s.ID)
+	}
+	if !s.ValidFrom.IsZero() && t.Before(s.ValidFrom) {
+		return fmt.Errorf("signer %s is not valid until %s", s.ID, s.ValidFrom.Format(time.RFC3339))
+	}
+	if !s.ValidUntil.IsZero() && t.After(s.ValidUntil) {
+		return fmt.Errorf("signer %s expired at %s", s.ID, s.ValidUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// DocumentSignature is a document's signature: the signed content and the
+// signature of it by a trusted signer
+type DocumentSignature struct {
+	SignerID  string `json:"signer_id"`
+	Content   []byte `json:"content"`
+	Signature []byte `json:"signature"`
 }
 
 // PermissionEvaluation represents the result of permission evaluation
@@ -74,6 +132,7 @@ func NewPermissionManager(pm *PolicyManager, sm core.SecurityManager, cp core.Cr
 		cryptoProvider:  cp,
 		logger:          logger,
 		trustedSigners:  make(map[string]*TrustedSigner),
+		signatures:      make(map[string]*DocumentSignature),
 		permissionCache: make(map[string]*PermissionEvaluation),
 	}
 }
@@ -109,7 +168,10 @@ func (pm *PermissionManager) EvaluatePermissionRequest(ctx context.Context, requ
 
 	// Validate trust chain if signature verification is required
 	if policy.AdminControls != nil && policy.AdminControls.RequireSignature {
-		trustChain, err := pm.validateTrustChain(ctx, request.DocumentID)
+		trustChain, err := pm.validateTrustChain(ctx, request.Signature)
+		if err == nil {
+			err = checkTrustAnchors(trustChain, policy.AdminControls.TrustedSigners)
+		}
 		if err != nil {
 			evaluation.Granted = false
 			evaluation.Warnings = append(evaluation.Warnings, SecurityWarning{
@@ -120,6 +182,9 @@ func (pm *PermissionManager) EvaluatePermissionRequest(ctx context.Context, requ
 			})
 		} else {
 			evaluation.TrustChain = trustChain
+			pm.signersMu.Lock()
+			pm.signatures[request.DocumentID] = request.Signature
+			pm.signersMu.Unlock()
 		}
 	}
 
@@ -197,30 +262,137 @@ func (pm *PermissionManager) checkPermissionInheritance(ctx context.Context, req
 		UserContext:    request.UserContext,
 		Justification:  request.Justification,
 		RequestedAt:    request.RequestedAt,
+		Signature:      request.Signature,
 	}, parentPolicy)
 }
 
-// validateTrustChain validates the signature trust chain
-func (pm *PermissionManager) validateTrustChain(ctx context.Context, documentID string) ([]*TrustedSigner, error) {
-	// In a real implementation, this would:
-	// 1. Extract signatures from the document
-	// 2. Validate each signature in the chain
-	// 3. Check certificate validity and revocation status
-	// 4. Build the complete trust chain
+// AddTrustedSigner adds a signer to those trusted to sign documents, or
+// replaces the signer with the same ID. Signers other than system ones must
+// name their issuer, which is checked when trust chains are validated.
+func (pm *PermissionManager) AddTrustedSigner(signer *TrustedSigner) error {
+	if signer == nil || signer.ID == "" {
+		return fmt.Errorf("signer ID is required")
+	}
+	if len(signer.PublicKey) == 0 {
+		return fmt.Errorf("signer %s has no public key", signer.ID)
+	}
+	switch signer.TrustLevel {
+	case TrustLevelSystem:
+	case TrustLevelOrganization, TrustLevelUser:
+		if signer.IssuerID == "" || len(signer.Certificate) == 0 {
+			return fmt.Errorf("signer %s needs an issuer and certificate", signer.ID)
+		}
+	default:
+		return fmt.Errorf("signer %s has unknown trust level %q", signer.ID, signer.TrustLevel)
+	}
+	copied := *signer
+	pm.signersMu.Lock()
+	pm.trustedSigners[signer.ID] = &copied
+	pm.signersMu.Unlock()
+	return nil
+}
 
-	// For demonstration, return a mock trust chain
-	trustChain := []*TrustedSigner{
-		{
-			ID:         "system-ca",
-			Name:       "System Certificate Authority",
-			TrustLevel: "system",
-			ValidFrom:  time.Now().Add(-365 * 24 * time.Hour),
-			ValidUntil: time.Now().Add(365 * 24 * time.Hour),
-			Revoked:    false,
-		},
+// RevokeTrustedSigner revokes a signer, and with it the trust chains that
+// pass through it
+func (pm *PermissionManager) RevokeTrustedSigner(id string) error {
+	pm.signersMu.Lock()
+	defer pm.signersMu.Unlock()
+	signer, ok := pm.trustedSigners[id]
+	if !ok {
+		return fmt.Errorf("unknown signer %s", id)
 	}
+	revoked := *signer
+	revoked.Revoked = true
+	pm.trustedSigners[id] = &revoked
+	return nil
+}
 
-	return trustChain, nil
+// TrustedSigners returns the trusted signers in ID order
+func (pm *PermissionManager) TrustedSigners() []*TrustedSigner {
+	pm.signersMu.RLock()
+	defer pm.signersMu.RUnlock()
+	signers := make([]*TrustedSigner, 0, len(pm.trustedSigners))
+	for _, signer := range pm.trustedSigners {
+		signers = append(signers, signer)
+	}
+	sort.Slice(signers, func(i, j int) bool { return signers[i].ID < signers[j].ID })
+	return signers
+}
+
+// LoadTrustedSigners reads a JSON array of trusted signers, with public keys
+// and certificates in base64
+func LoadTrustedSigners(path string) ([]*TrustedSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted signers: %w", err)
+	}
+	var signers []*TrustedSigner
+	if err := json.Unmarshal(data, &signers); err != nil {
+		return nil, fmt.Errorf("failed to parse trusted signers: %w", err)
+	}
+	return signers, nil
+}
+
+// validateTrustChain verifies a document's signature and builds the chain
+// of trusted signers from the document's signer up to a system signer,
+// checking each certificate, validity period and revocation on the way
+func (pm *PermissionManager) validateTrustChain(ctx context.Context, signature *DocumentSignature) ([]*TrustedSigner, error) {
+	if signature == nil || len(signature.Signature) == 0 {
+		return nil, ErrUnsignedDocument
+	}
+	if pm.cryptoProvider == nil {
+		return nil, fmt.Errorf("crypto provider not available")
+	}
+
+	pm.signersMu.RLock()
+	defer pm.signersMu.RUnlock()
+	signer, ok := pm.trustedSigners[signature.SignerID]
+	if !ok {
+		return nil, fmt.Errorf("signer %s is not trusted", signature.SignerID)
+	}
+	if !pm.cryptoProvider.Verify(signature.Content, signature.Signature, signer.PublicKey) {
+		return nil, fmt.Errorf("document signature does not verify with signer %s", signer.ID)
+	}
+
+	now := time.Now()
+	trustChain := []*TrustedSigner{}
+	for {
+		if err := signer.validAt(now); err != nil {
+			return nil, err
+		}
+		trustChain = append(trustChain, signer)
+		if signer.TrustLevel == TrustLevelSystem {
+			return trustChain, nil
+		}
+		// Every signer appears once in a chain, which ends cycles
+		if len(trustChain) > len(pm.trustedSigners) {
+			return nil, fmt.Errorf("trust chain of signer %s does not reach a system signer", signature.SignerID)
+		}
+		issuer, ok := pm.trustedSigners[signer.IssuerID]
+		if !ok {
+			return nil, fmt.Errorf("issuer %s of signer %s is not trusted", signer.IssuerID, signer.ID)
+		}
+		if !pm.cryptoProvider.Verify(signer.CertificateData(), signer.Certificate, issuer.PublicKey) {
+			return nil, fmt.Errorf("certificate of signer %s does not verify with issuer %s", signer.ID, issuer.ID)
+		}
+		signer = issuer
+	}
+}
+
+// checkTrustAnchors requires a trust chain to pass through one of a policy's
+// trusted signers, when it names any
+func checkTrustAnchors(trustChain []*TrustedSigner, anchors []string) error {
+	if len(anchors) == 0 {
+		return nil
+	}
+	for _, signer := range trustChain {
+		for _, anchor := range anchors {
+			if signer.ID == anchor {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("trust chain does not include a signer trusted by the policy")
 }
 
 // calculateRestrictions calculates additional restrictions based on permissions and policy
@@ -498,21 +670,37 @@ func (pm *PermissionManager) handlePolicies(w http.ResponseWriter, r *http.Reque
 }
 
 // handleTrustChain handles trust chain validation requests
+// GET revalidates the signature last verified for a document, and POST
+// validates the signature in the request body
 func (pm *PermissionManager) handleTrustChain(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	var signature *DocumentSignature
+	switch r.Method {
+	case http.MethodGet:
+		documentID := r.URL.Query().Get("document_id")
+		if documentID == "" {
+			http.Error(w, "document_id parameter required", http.StatusBadRequest)
+			return
+		}
+		pm.signersMu.RLock()
+		signature = pm.signatures[documentID]
+		pm.signersMu.RUnlock()
+		if signature == nil {
+			http.Error(w, "No verified signature for document", http.StatusNotFound)
+			return
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&signature); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	documentID := r.URL.Query().Get("document_id")
-	if documentID == "" {
-		http.Error(w, "document_id parameter required", http.StatusBadRequest)
-		return
-	}
-
-	trustChain, err := pm.validateTrustChain(r.Context(), documentID)
+	trustChain, err := pm.validateTrustChain(r.Context(), signature)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Trust chain validation failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Trust chain validation failed: %v", err), http.StatusUnprocessableEntity)
 		return
 	}
 
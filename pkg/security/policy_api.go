@@ -0,0 +1,252 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PolicyAPIPathPrefix is where PolicyAPI is served. The API is versioned by
+// its path; incompatible changes get a new prefix.
+//
+//	GET    /api/v1/policies                       all policies
+//	POST   /api/v1/policies                       create a policy
+//	GET    /api/v1/policies/{id}                  a policy as stored
+//	PUT    /api/v1/policies/{id}                  replace a policy's settings
+//	DELETE /api/v1/policies/{id}                  delete a policy
+//	GET    /api/v1/policies/{id}/versions         saved versions, oldest first
+//	GET    /api/v1/policies/{id}/versions/{n}     one saved version
+//	POST   /api/v1/policies/{id}/rollback         restore {"version": n}
+//	GET    /api/v1/policies/{id}/diff?from=n&to=m settings changed between
+//	                                              versions; to defaults to
+//	                                              the current policy
+const PolicyAPIPathPrefix = "/api/v1/policies"
+
+// PolicyAPI serves policy administration as JSON over HTTP. Authenticate
+// requests before they reach it.
+type PolicyAPI struct {
+	manager *PolicyManager
+	// User names who makes a request, for the audit log; "api" when unset
+	User func(r *http.Request) string
+}
+
+// NewPolicyAPI creates a policy API administering manager's policies
+func NewPolicyAPI(manager *PolicyManager) *PolicyAPI {
+	return &PolicyAPI{manager: manager}
+}
+
+// policyRollback is the body of a rollback request
+type policyRollback struct {
+	Version int `json:"version"`
+}
+
+// policyDiff is the response to a diff request
+type policyDiff struct {
+	PolicyID string         `json:"policy_id"`
+	From     int            `json:"from"`
+	To       int            `json:"to,omitempty"`
+	Changes  []PolicyChange `json:"changes"`
+}
+
+// ServeHTTP serves the routes under PolicyAPIPathPrefix
+func (api *PolicyAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	route := strings.Trim(strings.TrimPrefix(r.URL.Path, PolicyAPIPathPrefix), "/")
+	if route == "" {
+		switch r.Method {
+		case http.MethodGet:
+			api.listPolicies(w, r)
+		case http.MethodPost:
+			api.createPolicy(w, r)
+		default:
+			writePolicyAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	parts := strings.Split(route, "/")
+	id := parts[0]
+	switch {
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			policy, err := api.manager.storedPolicy(r.Context(), id)
+			if err != nil {
+				writePolicyError(w, err)
+				return
+			}
+			writePolicyAPIJSON(w, http.StatusOK, policy)
+		case http.MethodPut:
+			api.updatePolicy(w, r, id)
+		case http.MethodDelete:
+			if err := api.manager.DeletePolicy(r.Context(), id, api.user(r)); err != nil {
+				writePolicyError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writePolicyAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case parts[1] == "versions" && len(parts) <= 3:
+		if r.Method != http.MethodGet {
+			writePolicyAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if len(parts) == 2 {
+			versions, err := api.manager.PolicyVersions(r.Context(), id)
+			if err != nil {
+				writePolicyError(w, err)
+				return
+			}
+			writePolicyAPIJSON(w, http.StatusOK, versions)
+			return
+		}
+		number, err := strconv.Atoi(parts[2])
+		if err != nil {
+			writePolicyAPIError(w, http.StatusBadRequest, "invalid version number")
+			return
+		}
+		version, err := api.manager.PolicyVersion(r.Context(), id, number)
+		if err != nil {
+			writePolicyError(w, err)
+			return
+		}
+		writePolicyAPIJSON(w, http.StatusOK, version)
+	case parts[1] == "rollback" && len(parts) == 2:
+		if r.Method != http.MethodPost {
+			writePolicyAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var rollback policyRollback
+		if err := json.NewDecoder(r.Body).Decode(&rollback); err != nil || rollback.Version <= 0 {
+			writePolicyAPIError(w, http.StatusBadRequest, "request body must name a version")
+			return
+		}
+		policy, err := api.manager.RollbackPolicy(r.Context(), id, rollback.Version, api.user(r))
+		if err != nil {
+			writePolicyError(w, err)
+			return
+		}
+		writePolicyAPIJSON(w, http.StatusOK, policy)
+	case parts[1] == "diff" && len(parts) == 2:
+		if r.Method != http.MethodGet {
+			writePolicyAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		api.diffPolicy(w, r, id)
+	default:
+		writePolicyAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (api *PolicyAPI) listPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := api.manager.ListPolicies(r.Context())
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].ID < policies[j].ID })
+	writePolicyAPIJSON(w, http.StatusOK, policies)
+}
+
+func (api *PolicyAPI) createPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy SystemSecurityPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writePolicyAPIError(w, http.StatusBadRequest, "invalid policy: "+err.Error())
+		return
+	}
+	// Children attach themselves by naming their parent
+	policy.ChildPolicies = nil
+	if err := api.manager.CreatePolicy(r.Context(), &policy, api.user(r)); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	w.Header().Set("Location", PolicyAPIPathPrefix+"/"+policy.ID)
+	writePolicyAPIJSON(w, http.StatusCreated, &policy)
+}
+
+func (api *PolicyAPI) updatePolicy(w http.ResponseWriter, r *http.Request, id string) {
+	var policy SystemSecurityPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writePolicyAPIError(w, http.StatusBadRequest, "invalid policy: "+err.Error())
+		return
+	}
+	if policy.ID != "" && policy.ID != id {
+		writePolicyAPIError(w, http.StatusBadRequest, "policy ID does not match the URL")
+		return
+	}
+	current, err := api.manager.storedPolicy(r.Context(), id)
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	// The hierarchy changes when policies are created and deleted only
+	if policy.ParentPolicy != current.ParentPolicy {
+		writePolicyAPIError(w, http.StatusBadRequest, "the parent of a policy cannot be changed")
+		return
+	}
+	policy.ID = id
+	policy.ChildPolicies = current.ChildPolicies
+	if err := api.manager.UpdatePolicy(r.Context(), id, &policy, api.user(r)); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	writePolicyAPIJSON(w, http.StatusOK, &policy)
+}
+
+func (api *PolicyAPI) diffPolicy(w http.ResponseWriter, r *http.Request, id string) {
+	query := r.URL.Query()
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil || from <= 0 {
+		writePolicyAPIError(w, http.StatusBadRequest, "from must be a version number")
+		return
+	}
+	to := 0
+	if value := query.Get("to"); value != "" {
+		if to, err = strconv.Atoi(value); err != nil || to <= 0 {
+			writePolicyAPIError(w, http.StatusBadRequest, "to must be a version number")
+			return
+		}
+	}
+	changes, err := api.manager.DiffPolicyVersions(r.Context(), id, from, to)
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	writePolicyAPIJSON(w, http.StatusOK, &policyDiff{PolicyID: id, From: from, To: to, Changes: changes})
+}
+
+func (api *PolicyAPI) user(r *http.Request) string {
+	if api.User != nil {
+		if user := api.User(r); user != "" {
+			return user
+		}
+	}
+	return "api"
+}
+
+func writePolicyAPIJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writePolicyAPIError(w http.ResponseWriter, status int, message string) {
+	writePolicyAPIJSON(w, status, map[string]string{"error": message})
+}
+
+func writePolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPolicyNotFound):
+		writePolicyAPIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrPolicyExists), errors.Is(err, ErrPolicyInUse):
+		writePolicyAPIError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidPolicy):
+		writePolicyAPIError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		writePolicyAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,118 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPolicyAPI(t *testing.T) {
+	pm := NewPolicyManager(&PolicyManagerConfig{
+		DefaultPolicyID:         "default",
+		EnablePolicyInheritance: true,
+		MaxPolicyDepth:          3,
+		EnableVersioning:        true,
+	}, nil, nil)
+	api := NewPolicyAPI(pm)
+	api.User = func(r *http.Request) string { return "alice" }
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	request := func(method, path string, body interface{}, result interface{}) int {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		req, err := http.NewRequest(method, server.URL+PolicyAPIPathPrefix+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if result != nil {
+			json.NewDecoder(response.Body).Decode(result)
+		}
+		return response.StatusCode
+	}
+
+	var base SystemSecurityPolicy
+	if status := request("GET", "/default", nil, &base); status != http.StatusOK || base.ID != "default" {
+		t.Fatalf("Expected the default policy, got %d", status)
+	}
+	strict := base
+	strict.ID, strict.Name, strict.ParentPolicy = "strict", "Strict", "default"
+	var created SystemSecurityPolicy
+	if status := request("POST", "", &strict, &created); status != http.StatusCreated || created.CreatedBy != "alice" {
+		t.Fatalf("Expected the policy to be created, got %d %+v", status, created)
+	}
+	if status := request("POST", "", &strict, nil); status != http.StatusConflict {
+		t.Errorf("Expected a duplicate policy to be refused, got %d", status)
+	}
+	invalid := strict
+	invalid.ID = "bad id!"
+	if status := request("POST", "", &invalid, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected an invalid policy to be refused, got %d", status)
+	}
+
+	update := created
+	update.Description = "Tighter limits"
+	update.WASMPermissions.MemoryLimit = 4 << 20
+	if status := request("PUT", "/strict", &update, nil); status != http.StatusOK {
+		t.Fatalf("Expected the policy to be updated, got %d", status)
+	}
+	reparented := update
+	reparented.ParentPolicy = ""
+	if status := request("PUT", "/strict", &reparented, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected a change of parent to be refused, got %d", status)
+	}
+
+	var versions []*PolicyVersion
+	if status := request("GET", "/strict/versions", nil, &versions); status != http.StatusOK || len(versions) != 2 {
+		t.Fatalf("Expected two versions, got %d %d", status, len(versions))
+	}
+	if versions[0].Policy.Description == "Tighter limits" || versions[1].Policy.UpdatedBy != "alice" {
+		t.Errorf("Unexpected versions: %+v %+v", versions[0].Policy, versions[1].Policy)
+	}
+	var diff policyDiff
+	if status := request("GET", "/strict/diff?from=1", nil, &diff); status != http.StatusOK || len(diff.Changes) != 2 ||
+		diff.Changes[0].Path != "description" || diff.Changes[1].Path != "wasm_permissions.memory_limit" {
+		t.Errorf("Expected the description and memory limit to differ, got %d %+v", status, diff.Changes)
+	}
+
+	var restored SystemSecurityPolicy
+	if status := request("POST", "/strict/rollback", map[string]int{"version": 1}, &restored); status != http.StatusOK {
+		t.Fatalf("Expected the policy to be rolled back, got %d", status)
+	}
+	if restored.Description != base.Description || restored.WASMPermissions.MemoryLimit != base.WASMPermissions.MemoryLimit || restored.ParentPolicy != "default" {
+		t.Errorf("Expected the first version's settings, got %+v", restored)
+	}
+	if status := request("GET", "/strict/diff?from=1&to=3", nil, &diff); status != http.StatusOK || len(diff.Changes) != 0 {
+		t.Errorf("Expected the rollback to match the first version, got %+v", diff.Changes)
+	}
+	if status := request("POST", "/strict/rollback", map[string]int{"version": 9}, nil); status != http.StatusNotFound {
+		t.Errorf("Expected an unknown version to be refused, got %d", status)
+	}
+
+	if status := request("DELETE", "/default", nil, nil); status != http.StatusConflict {
+		t.Errorf("Expected the default policy to be kept, got %d", status)
+	}
+	if status := request("DELETE", "/strict", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("Expected the policy to be deleted, got %d", status)
+	}
+	if status := request("GET", "/strict", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected the deleted policy to be gone, got %d", status)
+	}
+	var policies []*SystemSecurityPolicy
+	if status := request("GET", "", nil, &policies); status != http.StatusOK || len(policies) != 1 || len(policies[0].ChildPolicies) != 0 {
+		t.Errorf("Expected only the default policy without children, got %d %d", status, len(policies))
+	}
+	if _, err := pm.PolicyVersion(context.Background(), "strict", 3); err != nil {
+		t.Errorf("Expected the versions to outlive the policy: %v", err)
+	}
+}
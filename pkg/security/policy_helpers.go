@@ -3,6 +3,7 @@
 package security
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -426,10 +427,23 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-// storeQuarantineRecord stores a quarantine record (placeholder implementation)
-func (pm *PolicyManager) storeQuarantineRecord(record *QuarantineRecord) error {
-	// In a real implementation, this would store to a database
-	// For now, we'll just log it
+// storeQuarantineRecord stores a quarantine record in the quarantine
+// manager, or only logs it when none is configured
+func (pm *PolicyManager) storeQuarantineRecord(ctx context.Context, record *QuarantineRecord) error {
+	if pm.quarantine != nil {
+		stored, err := pm.quarantine.Quarantine(ctx, &QuarantineRequest{
+			DocumentID: record.DocumentID,
+			PolicyID:   record.PolicyID,
+			Reason:     record.Reason,
+			Duration:   record.ExpiresAt.Sub(record.QuarantinedAt),
+		}, nil)
+		if err != nil {
+			return err
+		}
+		*record = *stored
+		return nil
+	}
+
 	pm.logAuditEvent("quarantine_document", record.DocumentID, "system", true, map[string]interface{}{
 		"reason":     record.Reason,
 		"expires_at": record.ExpiresAt,
@@ -437,6 +451,11 @@ func (pm *PolicyManager) storeQuarantineRecord(record *QuarantineRecord) error {
 	return nil
 }
 
+// quarantineDuration returns how long a policy holds quarantined documents
+func quarantineDuration(policy *SystemSecurityPolicy) time.Duration {
+	return time.Duration(policy.AdminControls.QuarantineDuration) * time.Second
+}
+
 // getPolicyTemplate retrieves a policy template by ID
 func (pm *PolicyManager) getPolicyTemplate(templateID string) *PolicyTemplate {
 	// In a real implementation, this would load from a template store
@@ -5,7 +5,9 @@ package security
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -20,8 +22,27 @@ type PolicyManager struct {
 	policyMutex   sync.RWMutex
 	auditLogger   AuditLogger
 	config        *PolicyManagerConfig
+	quarantine    *QuarantineManager
+
+	// storage persists policies when set; revision is the stored policy
+	// revision the policies in memory were loaded at
+	storage  Storage
+	revision int64
+
+	// versions holds the saved versions of each policy, oldest first, when
+	// versioning is enabled and there is no storage to keep them
+	versions map[string][]*PolicyVersion
 }
 
+// Errors policy operations wrap, so callers such as the policy API can tell
+// failures apart
+var (
+	ErrPolicyNotFound = errors.New("not found")
+	ErrPolicyExists   = errors.New("already exists")
+	ErrInvalidPolicy  = errors.New("policy validation failed")
+	ErrPolicyInUse    = errors.New("cannot delete")
+)
+
 // SystemSecurityPolicy extends core.SecurityPolicy with administrative controls
 type SystemSecurityPolicy struct {
 	*core.SecurityPolicy
@@ -34,6 +55,7 @@ type SystemSecurityPolicy struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	CreatedBy   string    `json:"created_by"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
 
 	// Policy inheritance and hierarchy
 	ParentPolicy  string   `json:"parent_policy,omitempty"`
@@ -149,6 +171,10 @@ const (
 	EventSuspiciousActivity  SecurityEventType = "suspicious_activity"
 	EventComplianceViolation SecurityEventType = "compliance_violation"
 	EventSystemBreach        SecurityEventType = "system_breach"
+	EventDocumentQuarantined SecurityEventType = "document_quarantined"
+	EventQuarantineReleased  SecurityEventType = "quarantine_released"
+	EventQuarantineRejected  SecurityEventType = "quarantine_rejected"
+	EventQuarantineExpired   SecurityEventType = "quarantine_expired"
 )
 
 // SecurityEventSeverity defines severity levels for security events
@@ -188,6 +214,7 @@ func NewPolicyManager(config *PolicyManagerConfig, eventLogger SecurityEventLogg
 	if config.DefaultPolicyID != "" {
 		pm.defaultPolicy = pm.createDefaultPolicy(config.DefaultPolicyID)
 		pm.policies[config.DefaultPolicyID] = pm.defaultPolicy
+		pm.recordVersions(pm.defaultPolicy)
 	}
 
 	return pm
@@ -206,12 +233,16 @@ func (pm *PolicyManager) CreatePolicy(ctx context.Context, policy *SystemSecurit
 				"policy_id":  policy.ID,
 				"created_by": createdBy,
 			})
-		return fmt.Errorf("policy validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+
+	if err := pm.syncPolicies(ctx); err != nil {
+		return err
 	}
 
 	// Check if policy already exists
 	if _, exists := pm.policies[policy.ID]; exists {
-		return fmt.Errorf("policy with ID %s already exists", policy.ID)
+		return fmt.Errorf("policy with ID %s %w", policy.ID, ErrPolicyExists)
 	}
 
 	// Set metadata
@@ -219,15 +250,23 @@ func (pm *PolicyManager) CreatePolicy(ctx context.Context, policy *SystemSecurit
 	policy.CreatedAt = now
 	policy.UpdatedAt = now
 	policy.CreatedBy = createdBy
+	policy.UpdatedBy = createdBy
 
 	// Handle policy inheritance
 	if policy.ParentPolicy != "" && pm.config.EnablePolicyInheritance {
 		if err := pm.setupPolicyInheritance(policy); err != nil {
-			return fmt.Errorf("failed to setup policy inheritance: %w", err)
+			return fmt.Errorf("%w: failed to setup policy inheritance: %w", ErrInvalidPolicy, err)
 		}
 	}
 
-	// Store policy
+	// Store policy, with the parent that now lists it as a child
+	changed := []*SystemSecurityPolicy{policy}
+	if parent, exists := pm.policies[policy.ParentPolicy]; exists && pm.config.EnablePolicyInheritance {
+		changed = append(changed, parent)
+	}
+	if err := pm.persistPolicies(ctx, changed...); err != nil {
+		return err
+	}
 	pm.policies[policy.ID] = policy
 
 	// Log audit event
@@ -241,12 +280,16 @@ func (pm *PolicyManager) CreatePolicy(ctx context.Context, policy *SystemSecurit
 
 // GetPolicy retrieves a security policy by ID
 func (pm *PolicyManager) GetPolicy(ctx context.Context, policyID string) (*SystemSecurityPolicy, error) {
+	if err := pm.refreshPolicies(ctx); err != nil {
+		return nil, err
+	}
+
 	pm.policyMutex.RLock()
 	defer pm.policyMutex.RUnlock()
 
 	policy, exists := pm.policies[policyID]
 	if !exists {
-		return nil, fmt.Errorf("policy with ID %s not found", policyID)
+		return nil, fmt.Errorf("policy with ID %s %w", policyID, ErrPolicyNotFound)
 	}
 
 	// Apply inheritance if enabled
@@ -262,9 +305,13 @@ func (pm *PolicyManager) UpdatePolicy(ctx context.Context, policyID string, upda
 	pm.policyMutex.Lock()
 	defer pm.policyMutex.Unlock()
 
+	if err := pm.syncPolicies(ctx); err != nil {
+		return err
+	}
+
 	existingPolicy, exists := pm.policies[policyID]
 	if !exists {
-		return fmt.Errorf("policy with ID %s not found", policyID)
+		return fmt.Errorf("policy with ID %s %w", policyID, ErrPolicyNotFound)
 	}
 
 	// Validate updates
@@ -275,7 +322,7 @@ func (pm *PolicyManager) UpdatePolicy(ctx context.Context, policyID string, upda
 				"policy_id":  policyID,
 				"updated_by": updatedBy,
 			})
-		return fmt.Errorf("policy validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
 	}
 
 	// Preserve metadata
@@ -283,8 +330,12 @@ func (pm *PolicyManager) UpdatePolicy(ctx context.Context, policyID string, upda
 	updates.CreatedAt = existingPolicy.CreatedAt
 	updates.CreatedBy = existingPolicy.CreatedBy
 	updates.UpdatedAt = time.Now()
+	updates.UpdatedBy = updatedBy
 
 	// Update policy
+	if err := pm.persistPolicies(ctx, updates); err != nil {
+		return err
+	}
 	pm.policies[policyID] = updates
 
 	// Log audit event
@@ -301,27 +352,42 @@ func (pm *PolicyManager) DeletePolicy(ctx context.Context, policyID string, dele
 	pm.policyMutex.Lock()
 	defer pm.policyMutex.Unlock()
 
+	if err := pm.syncPolicies(ctx); err != nil {
+		return err
+	}
+
 	policy, exists := pm.policies[policyID]
 	if !exists {
-		return fmt.Errorf("policy with ID %s not found", policyID)
+		return fmt.Errorf("policy with ID %s %w", policyID, ErrPolicyNotFound)
 	}
 
 	// Check if policy is the default policy
 	if policyID == pm.config.DefaultPolicyID {
-		return fmt.Errorf("cannot delete default policy")
+		return fmt.Errorf("%w default policy", ErrPolicyInUse)
 	}
 
 	// Check if policy has child policies
 	if len(policy.ChildPolicies) > 0 {
-		return fmt.Errorf("cannot delete policy with child policies")
+		return fmt.Errorf("%w policy with child policies", ErrPolicyInUse)
 	}
 
 	// Remove from parent policy's children
+	var changed []*SystemSecurityPolicy
 	if policy.ParentPolicy != "" {
 		pm.removeFromParentPolicy(policy.ParentPolicy, policyID)
+		if parent, exists := pm.policies[policy.ParentPolicy]; exists {
+			changed = append(changed, parent)
+		}
 	}
 
 	// Delete policy
+	if pm.storage != nil {
+		if err := pm.storage.DeletePolicy(ctx, policyID, changed...); err != nil {
+			pm.revision = -1
+			return fmt.Errorf("failed to delete stored policy: %w", err)
+		}
+	}
+	pm.recordVersions(changed...)
 	delete(pm.policies, policyID)
 
 	// Log audit event
@@ -334,6 +400,10 @@ func (pm *PolicyManager) DeletePolicy(ctx context.Context, policyID string, dele
 
 // ListPolicies returns all security policies
 func (pm *PolicyManager) ListPolicies(ctx context.Context) ([]*SystemSecurityPolicy, error) {
+	if err := pm.refreshPolicies(ctx); err != nil {
+		return nil, err
+	}
+
 	pm.policyMutex.RLock()
 	defer pm.policyMutex.RUnlock()
 
@@ -414,12 +484,12 @@ func (pm *PolicyManager) EnforceQuarantine(ctx context.Context, doc *core.LIVDoc
 		PolicyID:      policyID,
 		Reason:        reason,
 		QuarantinedAt: time.Now(),
-		ExpiresAt:     time.Now().Add(time.Duration(policy.AdminControls.QuarantineDuration) * time.Second),
+		ExpiresAt:     time.Now().Add(quarantineDuration(policy)),
 		Status:        QuarantineStatusActive,
 	}
 
-	// Store quarantine record (implementation would use persistent storage)
-	if err := pm.storeQuarantineRecord(quarantine); err != nil {
+	// Store quarantine record
+	if err := pm.storeQuarantineRecord(ctx, quarantine); err != nil {
 		return fmt.Errorf("failed to store quarantine record: %w", err)
 	}
 
@@ -436,6 +506,41 @@ func (pm *PolicyManager) EnforceQuarantine(ctx context.Context, doc *core.LIVDoc
 	return nil
 }
 
+// SetEventLogger makes the policy manager log security events to events, such
+// as an EventStream wrapping its storage
+func (pm *PolicyManager) SetEventLogger(events SecurityEventLogger) {
+	pm.eventLogger = events
+}
+
+// SetQuarantineManager makes quarantined documents and records persist in
+// qm, where administrators review them
+func (pm *PolicyManager) SetQuarantineManager(qm *QuarantineManager) {
+	pm.quarantine = qm
+}
+
+// QuarantineUpload holds a suspect upload in quarantine when the policy
+// enforces quarantine. It returns a nil record when it does not, and the
+// upload may be stored as usual.
+func (pm *PolicyManager) QuarantineUpload(ctx context.Context, policyID, filename, reason string, document io.Reader) (*QuarantineRecord, error) {
+	policy, err := pm.GetPolicy(ctx, policyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	if policy.AdminControls == nil || !policy.AdminControls.EnforceQuarantine {
+		return nil, nil
+	}
+	if pm.quarantine == nil {
+		return nil, fmt.Errorf("policy %s enforces quarantine but no quarantine is configured", policyID)
+	}
+
+	return pm.quarantine.Quarantine(ctx, &QuarantineRequest{
+		PolicyID: policyID,
+		Filename: filename,
+		Reason:   reason,
+		Duration: quarantineDuration(policy),
+	}, document)
+}
+
 // GetEventStatistics returns statistics about security events
 func (pm *PolicyManager) GetEventStatistics(ctx context.Context, timeRange *TimeRange) (*EventStatistics, error) {
 	if pm.eventLogger == nil {
@@ -447,6 +552,10 @@ func (pm *PolicyManager) GetEventStatistics(ctx context.Context, timeRange *Time
 
 // GetSecurityMetrics returns comprehensive security metrics
 func (pm *PolicyManager) GetSecurityMetrics(ctx context.Context) (*SecurityMetrics, error) {
+	if err := pm.refreshPolicies(ctx); err != nil {
+		return nil, err
+	}
+
 	pm.policyMutex.RLock()
 	defer pm.policyMutex.RUnlock()
 
@@ -546,6 +655,10 @@ func (pm *PolicyManager) CreatePolicyFromTemplate(ctx context.Context, templateI
 
 // ValidateSystemConfiguration validates the overall system security configuration
 func (pm *PolicyManager) ValidateSystemConfiguration(ctx context.Context) (*SystemValidationReport, error) {
+	if err := pm.refreshPolicies(ctx); err != nil {
+		return nil, err
+	}
+
 	pm.policyMutex.RLock()
 	defer pm.policyMutex.RUnlock()
 
@@ -608,6 +721,10 @@ func (pm *PolicyManager) ValidateSystemConfiguration(ctx context.Context) (*Syst
 
 // MonitorResourceUsage monitors system resource usage against policies
 func (pm *PolicyManager) MonitorResourceUsage(ctx context.Context, resourceMetrics *ResourceMetrics) (*ResourceMonitoringReport, error) {
+	if err := pm.refreshPolicies(ctx); err != nil {
+		return nil, err
+	}
+
 	pm.policyMutex.RLock()
 	defer pm.policyMutex.RUnlock()
 
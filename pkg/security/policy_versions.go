@@ -0,0 +1,229 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// PolicyVersion is a policy as it was saved. Versions are numbered from 1 in
+// the order a policy was saved.
+type PolicyVersion struct {
+	PolicyID string                `json:"policy_id"`
+	Version  int                   `json:"version"`
+	SavedAt  time.Time             `json:"saved_at"`
+	Policy   *SystemSecurityPolicy `json:"policy"`
+}
+
+// PolicyChange is a setting that differs between two versions of a policy,
+// named by its JSON path such as wasm_permissions.memory_limit
+type PolicyChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// diffIgnored are the fields every save changes, left out of diffs
+var diffIgnored = map[string]bool{"updated_at": true, "updated_by": true}
+
+// recordVersions keeps versions of saved policies in memory, when versioning
+// is enabled and no storage keeps them. The caller holds the policy lock.
+func (pm *PolicyManager) recordVersions(policies ...*SystemSecurityPolicy) {
+	if pm.storage != nil || !pm.config.EnableVersioning {
+		return
+	}
+	if pm.versions == nil {
+		pm.versions = make(map[string][]*PolicyVersion)
+	}
+	for _, policy := range policies {
+		// Policies are changed in place, so versions keep copies
+		saved, err := clonePolicy(policy)
+		if err != nil {
+			continue
+		}
+		pm.versions[policy.ID] = append(pm.versions[policy.ID], &PolicyVersion{
+			PolicyID: policy.ID,
+			Version:  len(pm.versions[policy.ID]) + 1,
+			SavedAt:  time.Now(),
+			Policy:   saved,
+		})
+	}
+}
+
+// PolicyVersions returns the saved versions of a policy, oldest first
+func (pm *PolicyManager) PolicyVersions(ctx context.Context, policyID string) ([]*PolicyVersion, error) {
+	var versions []*PolicyVersion
+	if pm.storage != nil {
+		stored, err := pm.storage.PolicyVersions(ctx, policyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load policy versions: %w", err)
+		}
+		versions = stored
+	} else {
+		pm.policyMutex.RLock()
+		for _, version := range pm.versions[policyID] {
+			copied := *version
+			if policy, err := clonePolicy(version.Policy); err == nil {
+				copied.Policy = policy
+			}
+			versions = append(versions, &copied)
+		}
+		pm.policyMutex.RUnlock()
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("versions of policy %s %w", policyID, ErrPolicyNotFound)
+	}
+	return versions, nil
+}
+
+// PolicyVersion returns one saved version of a policy
+func (pm *PolicyManager) PolicyVersion(ctx context.Context, policyID string, version int) (*PolicyVersion, error) {
+	versions, err := pm.PolicyVersions(ctx, policyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, saved := range versions {
+		if saved.Version == version {
+			return saved, nil
+		}
+	}
+	return nil, fmt.Errorf("version %d of policy %s %w", version, policyID, ErrPolicyNotFound)
+}
+
+// RollbackPolicy restores the settings of a saved version as the policy's
+// next version. The policy keeps its place in the hierarchy.
+func (pm *PolicyManager) RollbackPolicy(ctx context.Context, policyID string, version int, rolledBackBy string) (*SystemSecurityPolicy, error) {
+	saved, err := pm.PolicyVersion(ctx, policyID, version)
+	if err != nil {
+		return nil, err
+	}
+	current, err := pm.storedPolicy(ctx, policyID)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := saved.Policy
+	restored.ParentPolicy = current.ParentPolicy
+	restored.ChildPolicies = current.ChildPolicies
+	if err := pm.UpdatePolicy(ctx, policyID, restored, rolledBackBy); err != nil {
+		return nil, err
+	}
+
+	pm.logAuditEvent("rollback_policy", policyID, rolledBackBy, true, map[string]interface{}{
+		"version": version,
+	})
+	return restored, nil
+}
+
+// DiffPolicyVersions lists the settings that differ between two saved
+// versions of a policy. A to version of 0 compares with the current policy.
+func (pm *PolicyManager) DiffPolicyVersions(ctx context.Context, policyID string, from, to int) ([]PolicyChange, error) {
+	old, err := pm.PolicyVersion(ctx, policyID, from)
+	if err != nil {
+		return nil, err
+	}
+	var current *SystemSecurityPolicy
+	if to == 0 {
+		if current, err = pm.storedPolicy(ctx, policyID); err != nil {
+			return nil, err
+		}
+	} else {
+		saved, err := pm.PolicyVersion(ctx, policyID, to)
+		if err != nil {
+			return nil, err
+		}
+		current = saved.Policy
+	}
+	return DiffPolicies(old.Policy, current)
+}
+
+// DiffPolicies lists the settings that differ between two policies
+func DiffPolicies(old, new *SystemSecurityPolicy) ([]PolicyChange, error) {
+	oldValues, err := policyValues(old)
+	if err != nil {
+		return nil, err
+	}
+	newValues, err := policyValues(new)
+	if err != nil {
+		return nil, err
+	}
+	changes := []PolicyChange{}
+	diffValues("", oldValues, newValues, &changes)
+	return changes, nil
+}
+
+// diffValues compares JSON objects key by key and other values whole
+func diffValues(path string, old, new interface{}, changes *[]PolicyChange) {
+	oldObject, oldIsObject := old.(map[string]interface{})
+	newObject, newIsObject := new.(map[string]interface{})
+	if !oldIsObject || !newIsObject {
+		if !reflect.DeepEqual(old, new) {
+			*changes = append(*changes, PolicyChange{Path: path, Old: old, New: new})
+		}
+		return
+	}
+
+	keys := make(map[string]bool)
+	for key := range oldObject {
+		keys[key] = true
+	}
+	for key := range newObject {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		if path == "" && diffIgnored[key] {
+			continue
+		}
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		diffValues(child, oldObject[key], newObject[key], changes)
+	}
+}
+
+// storedPolicy returns a policy as stored, without inherited settings
+func (pm *PolicyManager) storedPolicy(ctx context.Context, policyID string) (*SystemSecurityPolicy, error) {
+	if err := pm.refreshPolicies(ctx); err != nil {
+		return nil, err
+	}
+	pm.policyMutex.RLock()
+	defer pm.policyMutex.RUnlock()
+	policy, exists := pm.policies[policyID]
+	if !exists {
+		return nil, fmt.Errorf("policy with ID %s %w", policyID, ErrPolicyNotFound)
+	}
+	return clonePolicy(policy)
+}
+
+func policyValues(policy *SystemSecurityPolicy) (interface{}, error) {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy: %w", err)
+	}
+	var values interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	return values, nil
+}
+
+func clonePolicy(policy *SystemSecurityPolicy) (*SystemSecurityPolicy, error) {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy: %w", err)
+	}
+	var clone SystemSecurityPolicy
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	return &clone, nil
+}
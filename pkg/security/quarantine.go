@@ -0,0 +1,521 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+// QuarantinePathPrefix is where QuarantineManager serves its admin API
+const QuarantinePathPrefix = "/api/quarantine/"
+
+var (
+	// ErrQuarantineNotFound is returned for unknown quarantine records
+	ErrQuarantineNotFound = errors.New("quarantine record not found")
+	// ErrQuarantineClosed is returned when a record was already released,
+	// rejected or expired
+	ErrQuarantineClosed = errors.New("quarantine already closed")
+)
+
+// QuarantineRequest describes a document to quarantine
+type QuarantineRequest struct {
+	DocumentID string
+	PolicyID   string
+	Filename   string
+	Reason     string
+	// Duration is how long the document is held before it expires
+	Duration time.Duration
+}
+
+// QuarantineManager holds suspect uploads apart from stored documents until
+// an administrator releases or rejects them. Held documents and their
+// records live in a holding directory, so quarantines survive restarts.
+//
+// A record starts active and ends released, rejected or expired. Rejected
+// and expired documents are deleted: a document nobody reviewed in time is
+// not trusted by default.
+type QuarantineManager struct {
+	dir         string
+	eventLogger SecurityEventLogger
+	auditLogger AuditLogger
+
+	// OnRelease receives released documents, for example to store them. A
+	// document stays quarantined when it fails.
+	OnRelease func(record *QuarantineRecord, document io.Reader) error
+	// Reviewer names the administrator making an admin API request. Reviews
+	// are refused when it is unset or names nobody, so every release and
+	// rejection records who made it.
+	Reviewer func(r *http.Request) string
+
+	mutex   sync.Mutex
+	records map[string]*QuarantineRecord
+	now     func() time.Time
+}
+
+// NewQuarantineManager creates a quarantine holding documents in dir and
+// loads the records already there
+func NewQuarantineManager(dir string, eventLogger SecurityEventLogger, auditLogger AuditLogger) (*QuarantineManager, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %v", err)
+	}
+
+	qm := &QuarantineManager{
+		dir:         dir,
+		eventLogger: eventLogger,
+		auditLogger: auditLogger,
+		records:     make(map[string]*QuarantineRecord),
+		now:         time.Now,
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantine records: %v", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read quarantine record: %v", err)
+		}
+		var record QuarantineRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("invalid quarantine record %s: %v", filepath.Base(path), err)
+		}
+		qm.records[record.ID] = &record
+	}
+
+	return qm, nil
+}
+
+// Quarantine holds a document. Without a document only the record is kept,
+// for documents that were never uploaded.
+func (qm *QuarantineManager) Quarantine(ctx context.Context, request *QuarantineRequest, document io.Reader) (*QuarantineRecord, error) {
+	id, err := newQuarantineID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := qm.now()
+	record := &QuarantineRecord{
+		ID:            id,
+		DocumentID:    request.DocumentID,
+		PolicyID:      request.PolicyID,
+		Reason:        request.Reason,
+		QuarantinedAt: now,
+		ExpiresAt:     now.Add(request.Duration),
+		Status:        QuarantineStatusActive,
+	}
+	if request.Filename != "" {
+		record.Filename = filepath.Base(request.Filename)
+	}
+
+	if document != nil {
+		if err := qm.hold(record, document); err != nil {
+			return nil, err
+		}
+	}
+
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	if err := qm.save(record); err != nil {
+		os.Remove(qm.documentPath(id))
+		return nil, err
+	}
+	qm.records[id] = record
+
+	qm.logSecurityEvent(EventDocumentQuarantined, SeverityHigh, fmt.Sprintf("Document quarantined: %s", record.Reason), record)
+	qm.logAuditEvent("quarantine_document", record, "system")
+
+	return copyQuarantineRecord(record), nil
+}
+
+// QuarantineFile moves an uploaded file into quarantine
+func (qm *QuarantineManager) QuarantineFile(ctx context.Context, request *QuarantineRequest, path string) (*QuarantineRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %v", err)
+	}
+	record, err := qm.Quarantine(ctx, request, file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return record, fmt.Errorf("failed to remove quarantined upload: %v", err)
+	}
+	return record, nil
+}
+
+// Get returns a quarantine record
+func (qm *QuarantineManager) Get(id string) (*QuarantineRecord, error) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.expire()
+
+	record, ok := qm.records[id]
+	if !ok {
+		return nil, ErrQuarantineNotFound
+	}
+	return copyQuarantineRecord(record), nil
+}
+
+// List returns the records with status, or all records when status is
+// empty, newest first
+func (qm *QuarantineManager) List(status QuarantineStatus) []*QuarantineRecord {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.expire()
+
+	records := make([]*QuarantineRecord, 0, len(qm.records))
+	for _, record := range qm.records {
+		if status == "" || record.Status == status {
+			records = append(records, copyQuarantineRecord(record))
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].QuarantinedAt.After(records[j].QuarantinedAt)
+	})
+	return records
+}
+
+// Open returns a held document for inspection
+func (qm *QuarantineManager) Open(id string) (io.ReadCloser, *QuarantineRecord, error) {
+	record, err := qm.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record.Status != QuarantineStatusActive {
+		return nil, nil, ErrQuarantineClosed
+	}
+	if record.SHA256 == "" {
+		return nil, nil, fmt.Errorf("quarantine %s holds no document", id)
+	}
+	file, err := os.Open(qm.documentPath(id))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open quarantined document: %v", err)
+	}
+	return file, record, nil
+}
+
+// Release ends a quarantine, handing the held document to OnRelease
+func (qm *QuarantineManager) Release(ctx context.Context, id, reviewer, notes string) (*QuarantineRecord, error) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	record, err := qm.active(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.SHA256 != "" && qm.OnRelease != nil {
+		file, err := os.Open(qm.documentPath(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open quarantined document: %v", err)
+		}
+		err = qm.OnRelease(copyQuarantineRecord(record), file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to release document: %v", err)
+		}
+	}
+
+	if err := qm.close(record, QuarantineStatusReleased, reviewer, notes); err != nil {
+		return nil, err
+	}
+	qm.logSecurityEvent(EventQuarantineReleased, SeverityMedium, fmt.Sprintf("Quarantined document released by %s", reviewer), record)
+	qm.logAuditEvent("release_quarantine", record, reviewer)
+
+	return copyQuarantineRecord(record), nil
+}
+
+// Reject ends a quarantine and deletes the held document
+func (qm *QuarantineManager) Reject(ctx context.Context, id, reviewer, notes string) (*QuarantineRecord, error) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	record, err := qm.active(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := qm.close(record, QuarantineStatusRejected, reviewer, notes); err != nil {
+		return nil, err
+	}
+	qm.logSecurityEvent(EventQuarantineRejected, SeverityHigh, fmt.Sprintf("Quarantined document rejected by %s", reviewer), record)
+	qm.logAuditEvent("reject_quarantine", record, reviewer)
+
+	return copyQuarantineRecord(record), nil
+}
+
+// active returns an active record, expiring it first when it is overdue
+func (qm *QuarantineManager) active(id string) (*QuarantineRecord, error) {
+	qm.expire()
+	record, ok := qm.records[id]
+	if !ok {
+		return nil, ErrQuarantineNotFound
+	}
+	if record.Status != QuarantineStatusActive {
+		return nil, ErrQuarantineClosed
+	}
+	return record, nil
+}
+
+// expire closes overdue active records
+func (qm *QuarantineManager) expire() {
+	now := qm.now()
+	for _, record := range qm.records {
+		if record.Status != QuarantineStatusActive || now.Before(record.ExpiresAt) {
+			continue
+		}
+		if err := qm.close(record, QuarantineStatusExpired, "", ""); err != nil {
+			continue
+		}
+		qm.logSecurityEvent(EventQuarantineExpired, SeverityMedium, "Quarantined document expired without review", record)
+		qm.logAuditEvent("expire_quarantine", record, "system")
+	}
+}
+
+// close moves a record to its final status and deletes the held document
+func (qm *QuarantineManager) close(record *QuarantineRecord, status QuarantineStatus, reviewer, notes string) error {
+	closed := *record
+	closed.Status = status
+	if reviewer != "" {
+		reviewedAt := qm.now()
+		closed.ReviewedBy = reviewer
+		closed.ReviewedAt = &reviewedAt
+		closed.ReviewNotes = notes
+	}
+	if err := qm.save(&closed); err != nil {
+		return err
+	}
+	*record = closed
+
+	if err := os.Remove(qm.documentPath(record.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete quarantined document: %v", err)
+	}
+	return nil
+}
+
+// hold copies a document into the holding directory, recording its size
+// and hash
+func (qm *QuarantineManager) hold(record *QuarantineRecord, document io.Reader) error {
+	file, err := atomicfile.Create(qm.documentPath(record.ID), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create quarantined document: %v", err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hasher), document)
+	if err == nil {
+		err = file.Commit()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write quarantined document: %v", err)
+	}
+
+	record.Size = size
+	record.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return nil
+}
+
+// save writes a record next to its document
+func (qm *QuarantineManager) save(record *QuarantineRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantine record: %v", err)
+	}
+	if err := atomicfile.WriteFile(qm.recordPath(record.ID), data, 0600); err != nil {
+		return fmt.Errorf("failed to write quarantine record: %v", err)
+	}
+	return nil
+}
+
+func (qm *QuarantineManager) documentPath(id string) string {
+	return filepath.Join(qm.dir, id+".liv")
+}
+
+func (qm *QuarantineManager) recordPath(id string) string {
+	return filepath.Join(qm.dir, id+".json")
+}
+
+func (qm *QuarantineManager) logSecurityEvent(eventType SecurityEventType, severity SecurityEventSeverity, description string, record *QuarantineRecord) {
+	if qm.eventLogger == nil {
+		return
+	}
+	qm.eventLogger.LogSecurityEvent(&SecurityEvent{
+		ID:          generateEventID(),
+		Timestamp:   qm.now(),
+		EventType:   eventType,
+		Severity:    severity,
+		Source:      "quarantine_manager",
+		PolicyID:    record.PolicyID,
+		Description: description,
+		Details:     quarantineDetails(record),
+	})
+}
+
+func (qm *QuarantineManager) logAuditEvent(action string, record *QuarantineRecord, userID string) {
+	if qm.auditLogger == nil {
+		return
+	}
+	qm.auditLogger.LogAuditEvent(&AuditEvent{
+		ID:        generateEventID(),
+		Timestamp: qm.now(),
+		Action:    action,
+		Resource:  record.DocumentID,
+		UserID:    userID,
+		Success:   true,
+		Details:   quarantineDetails(record),
+	})
+}
+
+func quarantineDetails(record *QuarantineRecord) map[string]interface{} {
+	details := map[string]interface{}{
+		"quarantine_id": record.ID,
+		"document_id":   record.DocumentID,
+		"status":        record.Status,
+		"reason":        record.Reason,
+		"expires_at":    record.ExpiresAt,
+	}
+	if record.SHA256 != "" {
+		details["sha256"] = record.SHA256
+	}
+	if record.ReviewNotes != "" {
+		details["review_notes"] = record.ReviewNotes
+	}
+	return details
+}
+
+func copyQuarantineRecord(record *QuarantineRecord) *QuarantineRecord {
+	copied := *record
+	return &copied
+}
+
+func newQuarantineID() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate quarantine id: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// quarantineReview is the body of release and reject requests
+type quarantineReview struct {
+	Notes string `json:"notes"`
+}
+
+// ServeHTTP serves the admin API under QuarantinePathPrefix:
+//
+//	GET  /api/quarantine/?status=active  lists records
+//	GET  /api/quarantine/{id}            returns a record
+//	GET  /api/quarantine/{id}/document   downloads the held document
+//	POST /api/quarantine/{id}/release    releases the document
+//	POST /api/quarantine/{id}/reject     rejects the document
+//
+// The API must only be mounted behind administrator sign-in.
+func (qm *QuarantineManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	route := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(QuarantinePathPrefix, "/")), "/")
+	if route == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeQuarantineJSON(w, http.StatusOK, qm.List(QuarantineStatus(r.URL.Query().Get("status"))))
+		return
+	}
+
+	id, action, _ := strings.Cut(route, "/")
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		record, err := qm.Get(id)
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		writeQuarantineJSON(w, http.StatusOK, record)
+	case "document":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		document, record, err := qm.Open(id)
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		defer document.Close()
+		// Held documents are suspect: never let the browser render them
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", record.ID+".liv"))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		io.Copy(w, document)
+	case "release", "reject":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var review quarantineReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var reviewer string
+		if qm.Reviewer != nil {
+			reviewer = qm.Reviewer(r)
+		}
+		if reviewer == "" {
+			http.Error(w, "Reviews must be made by a signed-in administrator", http.StatusForbidden)
+			return
+		}
+
+		var record *QuarantineRecord
+		var err error
+		if action == "release" {
+			record, err = qm.Release(r.Context(), id, reviewer, review.Notes)
+		} else {
+			record, err = qm.Reject(r.Context(), id, reviewer, review.Notes)
+		}
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		writeQuarantineJSON(w, http.StatusOK, record)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeQuarantineJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeQuarantineError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrQuarantineNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrQuarantineClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,175 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuarantineManager(t *testing.T) {
+	dir := t.TempDir()
+	eventLogger := NewFileSecurityEventLogger(filepath.Join(dir, "security.log"))
+	auditLogger := NewFileAuditLogger(filepath.Join(dir, "audit.log"))
+	qm, err := NewQuarantineManager(filepath.Join(dir, "quarantine"), eventLogger, auditLogger)
+	if err != nil {
+		t.Fatalf("Failed to create quarantine: %v", err)
+	}
+
+	upload := filepath.Join(dir, "upload.liv")
+	data := []byte("suspect document")
+	if err := os.WriteFile(upload, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	held, err := qm.QuarantineFile(context.Background(), &QuarantineRequest{PolicyID: "default", Filename: upload, Reason: "signature mismatch", Duration: time.Hour}, upload)
+	if err != nil {
+		t.Fatalf("Failed to quarantine upload: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if held.Status != QuarantineStatusActive || held.SHA256 != hex.EncodeToString(sum[:]) || held.Size != int64(len(data)) || held.Filename != "upload.liv" {
+		t.Errorf("Unexpected record: %+v", held)
+	}
+	if _, err := os.Stat(upload); !os.IsNotExist(err) {
+		t.Error("Expected the upload to be moved into quarantine")
+	}
+	rejected, err := qm.Quarantine(context.Background(), &QuarantineRequest{Reason: "malware", Duration: time.Hour}, strings.NewReader("malware"))
+	if err != nil {
+		t.Fatalf("Failed to quarantine document: %v", err)
+	}
+	expiring, err := qm.Quarantine(context.Background(), &QuarantineRequest{Reason: "unreviewed", Duration: time.Minute}, strings.NewReader("unreviewed"))
+	if err != nil {
+		t.Fatalf("Failed to quarantine document: %v", err)
+	}
+	if records := qm.List(QuarantineStatusActive); len(records) != 3 {
+		t.Fatalf("Expected three active records, got %d", len(records))
+	}
+
+	var released []byte
+	qm.OnRelease = func(record *QuarantineRecord, document io.Reader) error {
+		released, err = io.ReadAll(document)
+		return err
+	}
+	qm.Reviewer = func(r *http.Request) string { return "alice" }
+	server := httptest.NewServer(qm)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + QuarantinePathPrefix + held.ID + "/document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || !bytes.Equal(body, data) || response.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Expected the held document as a download, got %d %q", response.StatusCode, body)
+	}
+
+	review := func(id, action string) int {
+		response, err := http.Post(server.URL+QuarantinePathPrefix+id+"/"+action, "application/json", strings.NewReader(`{"notes":"checked"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	// Reviews that do not name their reviewer are refused
+	qm.Reviewer = func(r *http.Request) string { return "" }
+	if status := review(held.ID, "release"); status != http.StatusForbidden || released != nil {
+		t.Fatalf("Expected an anonymous release to be refused, got %d", status)
+	}
+	qm.Reviewer = func(r *http.Request) string { return "alice" }
+	if status := review(held.ID, "release"); status != http.StatusOK || !bytes.Equal(released, data) {
+		t.Fatalf("Expected the document to be released, got %d %q", status, released)
+	}
+	if status := review(held.ID, "reject"); status != http.StatusConflict {
+		t.Errorf("Expected a released document to stay released, got %d", status)
+	}
+	if status := review("unknown", "release"); status != http.StatusNotFound {
+		t.Errorf("Expected an unknown record to be refused, got %d", status)
+	}
+	if status := review(rejected.ID, "reject"); status != http.StatusOK {
+		t.Fatalf("Expected the document to be rejected, got %d", status)
+	}
+
+	// Documents nobody reviewed in time are discarded
+	qm.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if record, err := qm.Get(expiring.ID); err != nil || record.Status != QuarantineStatusExpired {
+		t.Errorf("Expected the record to expire, got %+v: %v", record, err)
+	}
+	if _, _, err := qm.Open(expiring.ID); !errors.Is(err, ErrQuarantineClosed) {
+		t.Errorf("Expected an expired document to be closed, got %v", err)
+	}
+	for _, record := range []*QuarantineRecord{held, rejected, expiring} {
+		if _, err := os.Stat(qm.documentPath(record.ID)); !os.IsNotExist(err) {
+			t.Errorf("Expected the document of %s to be deleted", record.ID)
+		}
+	}
+
+	// Records survive restarts
+	reopened, err := NewQuarantineManager(filepath.Join(dir, "quarantine"), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen quarantine: %v", err)
+	}
+	record, err := reopened.Get(held.ID)
+	if err != nil || record.Status != QuarantineStatusReleased || record.ReviewedBy != "alice" || record.ReviewNotes != "checked" {
+		t.Errorf("Expected the released record to be kept, got %+v: %v", record, err)
+	}
+	if record, _ := reopened.Get(rejected.ID); record == nil || record.Status != QuarantineStatusRejected {
+		t.Errorf("Expected the rejected record to be kept, got %+v", record)
+	}
+
+	events, err := eventLogger.GetSecurityEvents(&EventFilter{Source: "quarantine_manager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[SecurityEventType]int)
+	for _, event := range events {
+		counts[event.EventType]++
+	}
+	if counts[EventDocumentQuarantined] != 3 || counts[EventQuarantineReleased] != 1 || counts[EventQuarantineRejected] != 1 || counts[EventQuarantineExpired] != 1 {
+		t.Errorf("Unexpected security events: %v", counts)
+	}
+}
+
+func TestPolicyManager_QuarantineUpload(t *testing.T) {
+	pm := NewPolicyManager(&PolicyManagerConfig{DefaultPolicyID: "default"}, nil, nil)
+	qm, err := NewQuarantineManager(t.TempDir(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.SetQuarantineManager(qm)
+
+	record, err := pm.QuarantineUpload(context.Background(), "default", "report.liv", "suspect", strings.NewReader("document"))
+	if err != nil || record != nil {
+		t.Fatalf("Expected no quarantine without enforcement, got %+v: %v", record, err)
+	}
+
+	policy, err := pm.GetPolicy(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.AdminControls.EnforceQuarantine = true
+	policy.AdminControls.QuarantineDuration = 600
+	if err := pm.UpdatePolicy(context.Background(), "default", policy, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err = pm.QuarantineUpload(context.Background(), "default", "report.liv", "suspect", strings.NewReader("document"))
+	if err != nil || record == nil || record.ExpiresAt.Sub(record.QuarantinedAt) != 10*time.Minute {
+		t.Fatalf("Expected the upload to be quarantined for ten minutes, got %+v: %v", record, err)
+	}
+	if err := pm.EnforceQuarantine(context.Background(), createTestDocument(), "default", "suspect"); err != nil {
+		t.Fatalf("Failed to enforce quarantine: %v", err)
+	}
+	if records := qm.List(QuarantineStatusActive); len(records) != 2 {
+		t.Errorf("Expected both quarantines to be recorded, got %d", len(records))
+	}
+}
@@ -2,10 +2,13 @@ package security
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/wasmruntime"
+	"github.com/tetratelabs/wazero/api"
 )
 
 // Sandbox implements the core.Sandbox interface
@@ -16,6 +19,7 @@ type Sandbox struct {
 	loadedModules       map[string]core.WASMInstance
 	logger              core.Logger
 	metrics             core.MetricsCollector
+	wasmRuntime         *wasmruntime.Runtime
 	destroyed           bool
 }
 
@@ -27,7 +31,7 @@ func (s *Sandbox) Execute(ctx context.Context, code string, permissions *core.WA
 
 	// Validate permissions against security policy
 	if !s.validateExecutionPermissions(permissions) {
-		return nil, fmt.Errorf("execution permissions denied by security policy")
+		return nil, fmt.Errorf("execution permissions %w", core.ErrPolicyDenied)
 	}
 
 	// For now, this is a placeholder implementation
@@ -78,8 +82,24 @@ func (s *Sandbox) LoadWASM(ctx context.Context, module []byte, config *core.WASM
 		}
 	}
 
+	// Execute the module for real when a runtime is configured
+	var engine *wasmruntime.Instance
+	if s.wasmRuntime != nil {
+		permissions := config.Permissions
+		if permissions == nil && s.securityContext.Policy != nil {
+			permissions = s.securityContext.Policy.WASMPermissions
+		}
+		var err error
+		if engine, err = s.wasmRuntime.Load(ctx, config.Name, module, wasmruntime.LimitsFromPermissions(permissions)); err != nil {
+			return nil, fmt.Errorf("failed to load WASM module: %w", err)
+		}
+	}
+
 	err := s.resourceMonitor.RegisterModule(s.securityContext.SessionID, config.Name, constraints)
 	if err != nil {
+		if engine != nil {
+			engine.Close(ctx)
+		}
 		return nil, fmt.Errorf("failed to register module for monitoring: %w", err)
 	}
 
@@ -93,6 +113,7 @@ func (s *Sandbox) LoadWASM(ctx context.Context, module []byte, config *core.WASM
 		resourceMonitor:     s.resourceMonitor,
 		logger:              s.logger,
 		metrics:             s.metrics,
+		engine:              engine,
 		startTime:           time.Now(),
 	}
 
@@ -247,6 +268,7 @@ type WASMInstance struct {
 	resourceMonitor     *ResourceMonitor
 	logger              core.Logger
 	metrics             core.MetricsCollector
+	engine              *wasmruntime.Instance
 	startTime           time.Time
 	terminated          bool
 }
@@ -285,6 +307,20 @@ func (wi *WASMInstance) Call(ctx context.Context, function string, args ...inter
 		})
 	}
 
+	if wi.engine != nil {
+		params, err := wasmParams(args)
+		if err != nil {
+			return nil, err
+		}
+		results, err := wi.engine.Call(ctx, function, params...)
+		memory := wi.engine.MemoryUsage()
+		wi.resourceMonitor.UpdateMemoryUsage(wi.sessionID, wi.name, memory, memory)
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+
 	// Return simulated result
 	return map[string]interface{}{
 		"result":      "function_executed",
@@ -308,8 +344,11 @@ func (wi *WASMInstance) GetMemoryUsage() uint64 {
 		return 0
 	}
 
-	// In a real implementation, this would query the actual WASM runtime
-	// For now, return a simulated value
+	if wi.engine != nil {
+		return wi.engine.MemoryUsage()
+	}
+
+	// Without a runtime, return a simulated value
 	return 1024 * 1024 // 1MB
 }
 
@@ -341,6 +380,14 @@ func (wi *WASMInstance) Terminate() error {
 	}
 
 	wi.terminated = true
+	if wi.engine != nil {
+		if err := wi.engine.Close(context.Background()); err != nil && !errors.Is(err, wasmruntime.ErrTerminated) {
+			wi.logger.Warn("failed to close WASM runtime",
+				"module_name", wi.name,
+				"error", err,
+			)
+		}
+	}
 
 	wi.logger.Info("WASM instance terminated",
 		"session_id", wi.sessionID,
@@ -368,3 +415,34 @@ func (wi *WASMInstance) isFunctionAllowed(function string) bool {
 	}
 	return false
 }
+
+// wasmParams encodes call arguments as WASM values. Only numbers and booleans
+// can be passed to a module.
+func wasmParams(args []interface{}) ([]uint64, error) {
+	params := make([]uint64, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case int:
+			params[i] = api.EncodeI64(int64(v))
+		case int32:
+			params[i] = api.EncodeI32(v)
+		case int64:
+			params[i] = api.EncodeI64(v)
+		case uint32:
+			params[i] = api.EncodeU32(v)
+		case uint64:
+			params[i] = v
+		case float32:
+			params[i] = api.EncodeF32(v)
+		case float64:
+			params[i] = api.EncodeF64(v)
+		case bool:
+			if v {
+				params[i] = 1
+			}
+		default:
+			return nil, fmt.Errorf("argument %d of type %T cannot be passed to WASM", i+1, arg)
+		}
+	}
+	return params, nil
+}
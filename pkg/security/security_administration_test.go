@@ -140,7 +140,7 @@ func (suite *SecurityAdministrationTestSuite) TestSecurityPolicyEnforcement() {
 		"document_id", "test-doc-strict",
 		"policy_id", "strict-policy",
 		"granted", false,
-		"warnings", 0,
+		"warnings", 1, // Unsigned documents fail trust chain validation
 	).Return()
 
 	evaluation, err := suite.permissionManager.EvaluatePermissionRequest(ctx, strictRequest)
@@ -256,7 +256,7 @@ func (suite *SecurityAdministrationTestSuite) TestSecurityEventHandling() {
 		"document_id", "test-doc-violation",
 		"policy_id", "strict-policy",
 		"granted", false,
-		"warnings", 0,
+		"warnings", 1, // Unsigned documents fail trust chain validation
 	).Return()
 
 	evaluation, err := suite.permissionManager.EvaluatePermissionRequest(ctx, violationRequest)
@@ -445,11 +445,7 @@ func (suite *SecurityAdministrationTestSuite) TestPermissionManagementIntegratio
 	w = httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
-	suite.Equal(http.StatusOK, w.Code, "Should return OK for trust chain")
-
-	var trustChain []*TrustedSigner
-	err = json.Unmarshal(w.Body.Bytes(), &trustChain)
-	suite.NoError(err, "Should parse trust chain response")
+	suite.Equal(http.StatusNotFound, w.Code, "Should find no trust chain for an unsigned document")
 }
 
 // TestSecurityIntegrationWithWASMContext tests integration with WASM security context
@@ -507,7 +503,7 @@ func (suite *SecurityAdministrationTestSuite) TestSecurityIntegrationWithWASMCon
 		"document_id", generateDocumentID(violatingDoc),
 		"policy_id", "strict-policy",
 		"granted", false,
-		"warnings", 0,
+		"warnings", 1, // Unsigned documents fail trust chain validation
 	).Return()
 
 	err = orchestrator.ProcessDocument(ctx, violatingDoc, "strict-policy", userContext)
@@ -2,10 +2,12 @@ package security
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/wasmruntime"
 )
 
 // SecurityManager implements the core.SecurityManager interface
@@ -17,6 +19,7 @@ type SecurityManager struct {
 	logger              core.Logger
 	metrics             core.MetricsCollector
 	config              *SecurityConfiguration
+	wasmRuntime         *wasmruntime.Runtime
 }
 
 // NewSecurityManager creates a new security manager with all components
@@ -52,8 +55,11 @@ func (sm *SecurityManager) ValidateSignature(content []byte, signature string, p
 		return false
 	}
 
-	// Convert signature from string to bytes (assuming hex encoding)
-	sigBytes := []byte(signature)
+	// Signatures are hex encoded
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
 
 	result := sm.cryptoProvider.Verify(content, sigBytes, publicKey)
 
@@ -78,7 +84,7 @@ func (sm *SecurityManager) CreateSignature(content []byte, privateKey []byte) (s
 	}
 
 	// Convert signature bytes to string (hex encoding)
-	signature := string(sigBytes)
+	signature := hex.EncodeToString(sigBytes)
 
 	if sm.metrics != nil {
 		sm.metrics.RecordSecurityEvent("signature_creation", map[string]interface{}{
@@ -119,6 +125,7 @@ func (sm *SecurityManager) CreateSandbox(policy *core.SecurityPolicy) (core.Sand
 		resourceMonitor:     sm.resourceMonitor,
 		logger:              sm.logger,
 		metrics:             sm.metrics,
+		wasmRuntime:         sm.wasmRuntime,
 	}
 
 	sm.logger.Info("sandbox created", "session_id", securityCtx.SessionID)
@@ -126,6 +133,13 @@ func (sm *SecurityManager) CreateSandbox(policy *core.SecurityPolicy) (core.Sand
 	return sandbox, nil
 }
 
+// SetWASMRuntime makes sandboxes created afterwards execute WASM modules in
+// runtime, under the memory, CPU time and import limits of their
+// permissions. Without a runtime modules are validated and monitored only.
+func (sm *SecurityManager) SetWASMRuntime(runtime *wasmruntime.Runtime) {
+	sm.wasmRuntime = runtime
+}
+
 // EvaluatePermissions evaluates permission requests against policies
 func (sm *SecurityManager) EvaluatePermissions(requested *core.WASMPermissions, policy *core.SecurityPolicy) bool {
 	result := sm.policyEngine.EvaluateWASMPermissions(requested, policy)
@@ -0,0 +1,462 @@
+// Package sqlstore keeps security policies, audit events and security events
+// in SQLite or PostgreSQL, so permission servers sharing a database share
+// their policies and logs.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/liv-format/liv/pkg/security"
+	_ "modernc.org/sqlite"
+)
+
+// Store implements security.Storage on a SQL database
+type Store struct {
+	db      *sql.DB
+	dialect *dialect
+}
+
+var _ security.Storage = (*Store)(nil)
+
+// dialect holds what differs between the supported databases
+type dialect struct {
+	name string
+	// serial is the column definition of an auto-incrementing key
+	serial string
+	// numbered placeholders are written $1, $2... instead of ?
+	numbered bool
+	// noLimit is the LIMIT allowing any number of rows
+	noLimit string
+}
+
+var (
+	sqliteDialect   = &dialect{name: "sqlite", serial: "INTEGER PRIMARY KEY AUTOINCREMENT", noLimit: "-1"}
+	postgresDialect = &dialect{name: "postgres", serial: "BIGSERIAL PRIMARY KEY", numbered: true, noLimit: "ALL"}
+)
+
+// rebind rewrites ? placeholders for the dialect
+func (d *dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Open connects to the database named by dsn and creates its tables. SQLite
+// databases are named sqlite:<path>, PostgreSQL ones by their postgres://
+// connection URL.
+func Open(dsn string) (*Store, error) {
+	var db *sql.DB
+	var d *dialect
+	var err error
+	switch {
+	case strings.HasPrefix(dsn, "sqlite:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite:"), "//")
+		if path == "" {
+			return nil, fmt.Errorf("missing SQLite database path in %q", dsn)
+		}
+		// Several servers on one host may share the file: wait for their
+		// writes rather than failing
+		db, err = sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+		d = sqliteDialect
+	case strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://"):
+		db, err = sql.Open("postgres", dsn)
+		d = postgresDialect
+	default:
+		return nil, fmt.Errorf("unsupported storage %q: use sqlite:<path> or postgres://", dsn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %v", d.name, err)
+	}
+
+	store := &Store{db: db, dialect: d}
+	if err := store.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate creates the tables the store uses
+func (s *Store) migrate(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS liv_policies (
+			id TEXT PRIMARY KEY,
+			data TEXT NOT NULL,
+			updated_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS liv_policy_revision (
+			id INTEGER PRIMARY KEY,
+			revision BIGINT NOT NULL
+		)`,
+		`INSERT INTO liv_policy_revision (id, revision) VALUES (1, 0) ON CONFLICT (id) DO NOTHING`,
+		`CREATE TABLE IF NOT EXISTS liv_policy_versions (
+			policy_id TEXT NOT NULL,
+			version BIGINT NOT NULL,
+			data TEXT NOT NULL,
+			saved_at BIGINT NOT NULL,
+			PRIMARY KEY (policy_id, version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS liv_security_events (
+			seq ` + s.dialect.serial + `,
+			id TEXT NOT NULL,
+			occurred_at BIGINT NOT NULL,
+			event_type TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			source TEXT NOT NULL,
+			policy_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS liv_security_events_time ON liv_security_events (occurred_at)`,
+		`CREATE TABLE IF NOT EXISTS liv_audit_events (
+			seq ` + s.dialect.serial + `,
+			id TEXT NOT NULL,
+			occurred_at BIGINT NOT NULL,
+			action TEXT NOT NULL,
+			resource TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			success BOOLEAN NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS liv_audit_events_time ON liv_audit_events (occurred_at)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create %s tables: %v", s.dialect.name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// LoadPolicies returns all stored policies
+func (s *Store) LoadPolicies(ctx context.Context) ([]*security.SystemSecurityPolicy, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM liv_policies ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policies: %v", err)
+	}
+	defer rows.Close()
+
+	var policies []*security.SystemSecurityPolicy
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read policy: %v", err)
+		}
+		var policy security.SystemSecurityPolicy
+		if err := json.Unmarshal([]byte(data), &policy); err != nil {
+			return nil, fmt.Errorf("failed to decode policy: %v", err)
+		}
+		policies = append(policies, &policy)
+	}
+	return policies, rows.Err()
+}
+
+// SavePolicies creates or replaces policies in one transaction
+func (s *Store) SavePolicies(ctx context.Context, policies ...*security.SystemSecurityPolicy) error {
+	return s.changePolicies(ctx, "", policies)
+}
+
+// DeletePolicy removes a policy and saves the policies its removal changed in
+// one transaction
+func (s *Store) DeletePolicy(ctx context.Context, policyID string, changed ...*security.SystemSecurityPolicy) error {
+	return s.changePolicies(ctx, policyID, changed)
+}
+
+// changePolicies deletes and saves policies and moves the revision on, so
+// other servers reload them
+func (s *Store) changePolicies(ctx context.Context, deleteID string, policies []*security.SystemSecurityPolicy) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Bumping the revision first locks out concurrent writers
+	if _, err := tx.ExecContext(ctx, `UPDATE liv_policy_revision SET revision = revision + 1 WHERE id = 1`); err != nil {
+		return fmt.Errorf("failed to update policy revision: %v", err)
+	}
+	if deleteID != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM liv_policies WHERE id = ?`), deleteID); err != nil {
+			return fmt.Errorf("failed to delete policy %s: %v", deleteID, err)
+		}
+	}
+	now := time.Now().UnixNano()
+	for _, policy := range policies {
+		data, err := json.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("failed to encode policy %s: %v", policy.ID, err)
+		}
+		_, err = tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO liv_policies (id, data, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`), policy.ID, string(data), now)
+		if err != nil {
+			return fmt.Errorf("failed to save policy %s: %v", policy.ID, err)
+		}
+		_, err = tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO liv_policy_versions (policy_id, version, data, saved_at)
+			SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ? FROM liv_policy_versions WHERE policy_id = ?`), policy.ID, string(data), now, policy.ID)
+		if err != nil {
+			return fmt.Errorf("failed to save version of policy %s: %v", policy.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit policies: %v", err)
+	}
+	return nil
+}
+
+// PolicyRevision returns a counter moved on by every policy change
+func (s *Store) PolicyRevision(ctx context.Context) (int64, error) {
+	var revision int64
+	if err := s.db.QueryRowContext(ctx, `SELECT revision FROM liv_policy_revision WHERE id = 1`).Scan(&revision); err != nil {
+		return 0, fmt.Errorf("failed to read policy revision: %v", err)
+	}
+	return revision, nil
+}
+
+// PolicyVersions returns the saved versions of a policy, oldest first
+func (s *Store) PolicyVersions(ctx context.Context, policyID string) ([]*security.PolicyVersion, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`SELECT version, data, saved_at FROM liv_policy_versions
+		WHERE policy_id = ? ORDER BY version`), policyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policy versions: %v", err)
+	}
+	defer rows.Close()
+
+	var versions []*security.PolicyVersion
+	for rows.Next() {
+		var version, savedAt int64
+		var data string
+		if err := rows.Scan(&version, &data, &savedAt); err != nil {
+			return nil, fmt.Errorf("failed to read policy version: %v", err)
+		}
+		var policy security.SystemSecurityPolicy
+		if err := json.Unmarshal([]byte(data), &policy); err != nil {
+			return nil, fmt.Errorf("failed to decode policy version: %v", err)
+		}
+		versions = append(versions, &security.PolicyVersion{
+			PolicyID: policyID,
+			Version:  int(version),
+			SavedAt:  time.Unix(0, savedAt),
+			Policy:   &policy,
+		})
+	}
+	return versions, rows.Err()
+}
+
+// LogSecurityEvent stores a security event
+func (s *Store) LogSecurityEvent(event *security.SecurityEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal security event: %w", err)
+	}
+	_, err = s.db.Exec(s.dialect.rebind(`INSERT INTO liv_security_events
+		(id, occurred_at, event_type, severity, source, policy_id, user_id, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		event.ID, event.Timestamp.UnixNano(), string(event.EventType), string(event.Severity),
+		event.Source, event.PolicyID, event.UserID, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to write security event: %w", err)
+	}
+	return nil
+}
+
+// GetSecurityEvents retrieves security events based on filter, oldest first
+func (s *Store) GetSecurityEvents(filter *security.EventFilter) ([]*security.SecurityEvent, error) {
+	var where conditions
+	limit, offset := 0, 0
+	if filter != nil {
+		where.timeRange(filter.StartTime, filter.EndTime)
+		types := make([]string, len(filter.EventTypes))
+		for i, eventType := range filter.EventTypes {
+			types[i] = string(eventType)
+		}
+		where.in("event_type", types)
+		severities := make([]string, len(filter.Severities))
+		for i, severity := range filter.Severities {
+			severities[i] = string(severity)
+		}
+		where.in("severity", severities)
+		where.equal("user_id", filter.UserID)
+		where.equal("policy_id", filter.PolicyID)
+		where.equal("source", filter.Source)
+		limit, offset = filter.Limit, filter.Offset
+	}
+
+	rows, err := s.db.Query(s.dialect.rebind(`SELECT data FROM liv_security_events`+where.sql()+
+		` ORDER BY occurred_at, seq`+s.dialect.page(limit, offset)), where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query security events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*security.SecurityEvent
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read security event: %w", err)
+		}
+		var event security.SecurityEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue // Skip malformed entries
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// GetEventStatistics summarizes the security events in timeRange
+func (s *Store) GetEventStatistics(timeRange *security.TimeRange) (*security.EventStatistics, error) {
+	filter := &security.EventFilter{}
+	if timeRange != nil {
+		filter.StartTime, filter.EndTime = &timeRange.Start, &timeRange.End
+	}
+	events, err := s.GetSecurityEvents(filter)
+	if err != nil {
+		return nil, err
+	}
+	return security.SummarizeEvents(events), nil
+}
+
+// LogAuditEvent stores an audit event
+func (s *Store) LogAuditEvent(event *security.AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	_, err = s.db.Exec(s.dialect.rebind(`INSERT INTO liv_audit_events
+		(id, occurred_at, action, resource, user_id, success, data) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		event.ID, event.Timestamp.UnixNano(), event.Action, event.Resource, event.UserID, event.Success, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// GetAuditTrail retrieves audit events based on filter, oldest first
+func (s *Store) GetAuditTrail(filter *security.AuditFilter) ([]*security.AuditEvent, error) {
+	var where conditions
+	limit, offset := 0, 0
+	if filter != nil {
+		where.timeRange(filter.StartTime, filter.EndTime)
+		where.in("action", filter.Actions)
+		where.equal("user_id", filter.UserID)
+		where.equal("resource", filter.Resource)
+		if filter.Success != nil {
+			where.add("success = ?", *filter.Success)
+		}
+		limit, offset = filter.Limit, filter.Offset
+	}
+
+	rows, err := s.db.Query(s.dialect.rebind(`SELECT data FROM liv_audit_events`+where.sql()+
+		` ORDER BY occurred_at, seq`+s.dialect.page(limit, offset)), where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*security.AuditEvent
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read audit event: %w", err)
+		}
+		var event security.AuditEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue // Skip malformed entries
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// ExportAuditLog exports the audit events in timeRange as json or csv
+func (s *Store) ExportAuditLog(format string, timeRange *security.TimeRange) ([]byte, error) {
+	filter := &security.AuditFilter{}
+	if timeRange != nil {
+		filter.StartTime, filter.EndTime = &timeRange.Start, &timeRange.End
+	}
+	events, err := s.GetAuditTrail(filter)
+	if err != nil {
+		return nil, err
+	}
+	return security.ExportAuditEvents(events, format)
+}
+
+// page returns the LIMIT and OFFSET clauses of a query
+func (d *dialect) page(limit, offset int) string {
+	var clause string
+	if limit > 0 {
+		clause = " LIMIT " + strconv.Itoa(limit)
+	} else if offset > 0 {
+		clause = " LIMIT " + d.noLimit
+	}
+	if offset > 0 {
+		clause += " OFFSET " + strconv.Itoa(offset)
+	}
+	return clause
+}
+
+// conditions builds the WHERE clause of an event query
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+func (c *conditions) add(clause string, args ...interface{}) {
+	c.clauses = append(c.clauses, clause)
+	c.args = append(c.args, args...)
+}
+
+func (c *conditions) equal(column, value string) {
+	if value != "" {
+		c.add(column+" = ?", value)
+	}
+}
+
+func (c *conditions) in(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	c.add(column+" IN (?"+strings.Repeat(", ?", len(values)-1)+")", args...)
+}
+
+func (c *conditions) timeRange(start, end *time.Time) {
+	if start != nil {
+		c.add("occurred_at >= ?", start.UnixNano())
+	}
+	if end != nil {
+		c.add("occurred_at <= ?", end.UnixNano())
+	}
+}
+
+func (c *conditions) sql() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.clauses, " AND ")
+}
@@ -0,0 +1,186 @@
+package sqlstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/security"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	dsn := "sqlite:" + filepath.Join(t.TempDir(), "liv.db")
+	testStore(t, func() *Store {
+		store, err := Open(dsn)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		return store
+	})
+}
+
+// TestPostgresStore runs against the database in LIV_TEST_POSTGRES_DSN,
+// which it fills with test policies and events
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("LIV_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LIV_TEST_POSTGRES_DSN is not set")
+	}
+	store, err := Open(dsn)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	for _, table := range []string{"liv_policies", "liv_policy_versions", "liv_security_events", "liv_audit_events"} {
+		if _, err := store.db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	testStore(t, func() *Store {
+		store, err := Open(dsn)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		return store
+	})
+}
+
+func TestOpen_Unsupported(t *testing.T) {
+	for _, dsn := range []string{"", "sqlite:", "mysql://localhost/liv"} {
+		if _, err := Open(dsn); err == nil {
+			t.Errorf("Expected %q to be refused", dsn)
+		}
+	}
+}
+
+func TestDialect(t *testing.T) {
+	if got := postgresDialect.rebind("a = ? AND b IN (?, ?)"); got != "a = $1 AND b IN ($2, $3)" {
+		t.Errorf("Unexpected rebound query: %s", got)
+	}
+	if got := sqliteDialect.page(0, 5); got != " LIMIT -1 OFFSET 5" {
+		t.Errorf("Unexpected page clause: %s", got)
+	}
+	if got := postgresDialect.page(10, 0); got != " LIMIT 10" {
+		t.Errorf("Unexpected page clause: %s", got)
+	}
+}
+
+// testStore checks two policy managers sharing a database see each other's
+// changes, and that policies and events outlive them
+func testStore(t *testing.T, open func() *Store) {
+	ctx := context.Background()
+	config := &security.PolicyManagerConfig{DefaultPolicyID: "default", EnablePolicyInheritance: true, MaxPolicyDepth: 3}
+
+	storeA, storeB := open(), open()
+	first, err := security.NewPolicyManagerWithStorage(ctx, config, storeA)
+	if err != nil {
+		t.Fatalf("Failed to create policy manager: %v", err)
+	}
+	second, err := security.NewPolicyManagerWithStorage(ctx, config, storeB)
+	if err != nil {
+		t.Fatalf("Failed to create policy manager: %v", err)
+	}
+
+	base, err := first.GetPolicy(ctx, "default")
+	if err != nil {
+		t.Fatalf("Expected the default policy to be stored: %v", err)
+	}
+	policy := *base
+	policy.ID = "strict"
+	policy.Name = "Strict"
+	policy.ParentPolicy = "default"
+	policy.ChildPolicies = nil
+	if err := first.CreatePolicy(ctx, &policy, "alice"); err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	shared, err := second.GetPolicy(ctx, "strict")
+	if err != nil || shared.Name != "Strict" {
+		t.Fatalf("Expected the policy on the second server, got %+v: %v", shared, err)
+	}
+	if parent, _ := second.GetPolicy(ctx, "default"); parent == nil || len(parent.ChildPolicies) != 1 {
+		t.Errorf("Expected the parent to list its child, got %+v", parent)
+	}
+
+	update := *shared
+	update.Description = "Updated elsewhere"
+	if err := second.UpdatePolicy(ctx, "strict", &update, "bob"); err != nil {
+		t.Fatalf("Failed to update policy: %v", err)
+	}
+	if updated, err := first.GetPolicy(ctx, "strict"); err != nil || updated.Description != "Updated elsewhere" {
+		t.Errorf("Expected the update on the first server, got %+v: %v", updated, err)
+	}
+	versions, err := first.PolicyVersions(ctx, "strict")
+	if err != nil || len(versions) != 2 || versions[0].Policy.Description == "Updated elsewhere" || versions[1].Policy.UpdatedBy != "bob" {
+		t.Errorf("Expected both versions of the policy, got %d: %v", len(versions), err)
+	}
+
+	if err := first.DeletePolicy(ctx, "strict", "alice"); err != nil {
+		t.Fatalf("Failed to delete policy: %v", err)
+	}
+	if _, err := second.GetPolicy(ctx, "strict"); err == nil {
+		t.Error("Expected the deletion on the second server")
+	}
+	if err := second.CreatePolicy(ctx, &policy, "bob"); err != nil {
+		t.Fatalf("Expected the deleted policy ID to be free again: %v", err)
+	}
+	storeA.Close()
+	storeB.Close()
+
+	// Policies and events outlive the servers
+	store := open()
+	defer store.Close()
+	restarted, err := security.NewPolicyManagerWithStorage(ctx, config, store)
+	if err != nil {
+		t.Fatalf("Failed to reopen policy manager: %v", err)
+	}
+	policies, err := restarted.ListPolicies(ctx)
+	if err != nil || len(policies) != 2 {
+		t.Errorf("Expected the default and strict policies, got %d: %v", len(policies), err)
+	}
+
+	trail, err := store.GetAuditTrail(&security.AuditFilter{UserID: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 2 || trail[0].Action != "create_policy" || trail[1].Action != "delete_policy" {
+		t.Errorf("Expected alice's create and delete, got %d events", len(trail))
+	}
+	success := true
+	all, err := store.GetAuditTrail(&security.AuditFilter{Actions: []string{"create_policy", "update_policy"}, Success: &success})
+	if err != nil || len(all) != 3 {
+		t.Errorf("Expected three creations and updates, got %d: %v", len(all), err)
+	}
+	if page, _ := store.GetAuditTrail(&security.AuditFilter{Offset: 1, Limit: 2}); len(page) != 2 || page[0].UserID != "bob" {
+		t.Errorf("Unexpected page of the audit trail: %d events", len(page))
+	}
+
+	export, err := store.ExportAuditLog("csv", &security.TimeRange{Start: time.Now().Add(-time.Hour), End: time.Now()})
+	if err != nil || strings.Count(string(export), "create_policy") != 2 {
+		t.Errorf("Unexpected audit export: %s: %v", export, err)
+	}
+
+	event := &security.SecurityEvent{
+		ID: "event-1", Timestamp: time.Now(), EventType: security.EventPolicyViolation,
+		Severity: security.SeverityHigh, Source: "viewer", UserID: "carol",
+		Details: map[string]interface{}{"document": "report.liv"},
+	}
+	if err := store.LogSecurityEvent(event); err != nil {
+		t.Fatalf("Failed to log security event: %v", err)
+	}
+	events, err := store.GetSecurityEvents(&security.EventFilter{
+		Severities: []security.SecurityEventSeverity{security.SeverityHigh, security.SeverityCritical},
+		Source:     "viewer",
+	})
+	if err != nil || len(events) != 1 || events[0].Details["document"] != "report.liv" {
+		t.Errorf("Expected the logged event, got %v: %v", events, err)
+	}
+	stats, err := store.GetEventStatistics(&security.TimeRange{Start: time.Now().Add(-time.Hour), End: time.Now()})
+	if err != nil || stats.EventsByType[security.EventPolicyViolation] != 1 {
+		t.Errorf("Unexpected statistics: %+v: %v", stats, err)
+	}
+}
@@ -0,0 +1,111 @@
+package security
+
+import (
+	"context"
+	"fmt"
+)
+
+// Storage persists policies, audit events and security events, so they
+// survive restarts and can be shared by several permission servers. Without
+// a storage, policies live in memory and events in local log files.
+type Storage interface {
+	SecurityEventLogger
+	AuditLogger
+
+	// LoadPolicies returns all stored policies
+	LoadPolicies(ctx context.Context) ([]*SystemSecurityPolicy, error)
+	// SavePolicies creates or replaces policies in one transaction, keeping
+	// each saved policy as its next version
+	SavePolicies(ctx context.Context, policies ...*SystemSecurityPolicy) error
+	// DeletePolicy removes a policy and saves the policies its removal
+	// changed in one transaction
+	DeletePolicy(ctx context.Context, policyID string, changed ...*SystemSecurityPolicy) error
+	// PolicyRevision changes whenever a policy is saved or deleted
+	PolicyRevision(ctx context.Context) (int64, error)
+	// PolicyVersions returns the saved versions of a policy, oldest first.
+	// Versions outlive the deletion of their policy.
+	PolicyVersions(ctx context.Context, policyID string) ([]*PolicyVersion, error)
+
+	Close() error
+}
+
+// NewPolicyManagerWithStorage creates a policy manager keeping its policies
+// and events in storage. Policies changed by other managers sharing the
+// storage are picked up before they are next read.
+func NewPolicyManagerWithStorage(ctx context.Context, config *PolicyManagerConfig, storage Storage) (*PolicyManager, error) {
+	pm := NewPolicyManager(config, storage, storage)
+	pm.storage = storage
+	pm.revision = -1
+
+	pm.policyMutex.Lock()
+	defer pm.policyMutex.Unlock()
+
+	defaultPolicy := pm.defaultPolicy
+	if err := pm.syncPolicies(ctx); err != nil {
+		return nil, err
+	}
+	if defaultPolicy != nil && pm.policies[defaultPolicy.ID] == nil {
+		if err := pm.persistPolicies(ctx, defaultPolicy); err != nil {
+			return nil, err
+		}
+		pm.policies[defaultPolicy.ID] = defaultPolicy
+		pm.defaultPolicy = defaultPolicy
+	}
+
+	return pm, nil
+}
+
+// refreshPolicies reloads the policies when another manager changed them
+func (pm *PolicyManager) refreshPolicies(ctx context.Context) error {
+	if pm.storage == nil {
+		return nil
+	}
+	pm.policyMutex.Lock()
+	defer pm.policyMutex.Unlock()
+	return pm.syncPolicies(ctx)
+}
+
+// syncPolicies reloads the policies when the stored revision moved on. The
+// caller holds the policy lock.
+func (pm *PolicyManager) syncPolicies(ctx context.Context) error {
+	if pm.storage == nil {
+		return nil
+	}
+
+	revision, err := pm.storage.PolicyRevision(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check stored policies: %w", err)
+	}
+	if revision == pm.revision {
+		return nil
+	}
+
+	stored, err := pm.storage.LoadPolicies(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load policies: %w", err)
+	}
+	policies := make(map[string]*SystemSecurityPolicy, len(stored))
+	for _, policy := range stored {
+		policies[policy.ID] = policy
+	}
+	pm.policies = policies
+	if defaultPolicy, exists := policies[pm.config.DefaultPolicyID]; exists {
+		pm.defaultPolicy = defaultPolicy
+	}
+	pm.revision = revision
+	return nil
+}
+
+// persistPolicies saves changed policies. A failure leaves the policies in
+// memory ahead of storage, so they are reloaded before the next use.
+func (pm *PolicyManager) persistPolicies(ctx context.Context, policies ...*SystemSecurityPolicy) error {
+	if pm.storage == nil {
+		pm.recordVersions(policies...)
+		return nil
+	}
+	if err := pm.storage.SavePolicies(ctx, policies...); err != nil {
+		pm.revision = -1
+		return fmt.Errorf("failed to store policy: %w", err)
+	}
+	return nil
+}
@@ -50,6 +50,7 @@ type SecurityWarning struct {
 
 // QuarantineRecord represents a quarantined document
 type QuarantineRecord struct {
+	ID            string           `json:"id,omitempty"`
 	DocumentID    string           `json:"document_id"`
 	PolicyID      string           `json:"policy_id"`
 	Reason        string           `json:"reason"`
@@ -59,6 +60,11 @@ type QuarantineRecord struct {
 	ReviewedBy    string           `json:"reviewed_by,omitempty"`
 	ReviewedAt    *time.Time       `json:"reviewed_at,omitempty"`
 	ReviewNotes   string           `json:"review_notes,omitempty"`
+
+	// Held document, when the quarantine holds the upload itself
+	Filename string `json:"filename,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Size     int64  `json:"size,omitempty"`
 }
 
 // QuarantineStatus defines quarantine status values
@@ -69,6 +75,7 @@ const (
 	QuarantineStatusReleased QuarantineStatus = "released"
 	QuarantineStatusExpired  QuarantineStatus = "expired"
 	QuarantineStatusReviewed QuarantineStatus = "reviewed"
+	QuarantineStatusRejected QuarantineStatus = "rejected"
 )
 
 // EventFilter defines filters for security event queries
@@ -351,6 +358,9 @@ type PermissionRequest struct {
 	UserContext    *UserContext
 	Justification  string
 	RequestedAt    time.Time
+	// Signature is the document's signature, checked against the trusted
+	// signers when the policy requires signed documents
+	Signature *DocumentSignature
 }
 
 // PolicyViolation represents a policy violation
@@ -2,11 +2,13 @@ package security
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/wasmruntime"
 )
 
 // MockWASMLoader for testing integration with WASM system
@@ -670,3 +672,50 @@ func TestSecurityAuditingAndLogging(t *testing.T) {
 	// Clean up
 	sandbox.Destroy()
 }
+
+func TestSandboxWASMExecution(t *testing.T) {
+	sm := NewSecurityManager(&MockCryptoProvider{}, &SimpleMockLogger{}, &SimpleMockMetricsCollector{})
+	sm.SetWASMRuntime(wasmruntime.NewRuntime())
+
+	// Exports add(i32, i32) i32 and spin(), which loops forever
+	module := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x01, 0x0a, 0x02, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x60, 0x00, 0x00,
+		0x03, 0x03, 0x02, 0x00, 0x01,
+		0x07, 0x0e, 0x02, 0x03, 'a', 'd', 'd', 0x00, 0x00, 0x04, 's', 'p', 'i', 'n', 0x00, 0x01,
+		0x0a, 0x11, 0x02,
+		0x07, 0x00, 0x20, 0x00, 0x20, 0x01, 0x6a, 0x0b,
+		0x07, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b,
+	}
+	permissions := &core.WASMPermissions{MemoryLimit: 4 * 1024 * 1024, CPUTimeLimit: 100}
+	sandbox, err := sm.CreateSandbox(&core.SecurityPolicy{WASMPermissions: permissions})
+	if err != nil {
+		t.Fatalf("failed to create sandbox: %v", err)
+	}
+	defer sandbox.Destroy()
+
+	ctx := context.Background()
+	instance, err := sandbox.LoadWASM(ctx, module, &core.WASMModule{
+		Name:        "executed-module",
+		Exports:     []string{"add", "spin"},
+		Permissions: permissions,
+	})
+	if err != nil {
+		t.Fatalf("failed to load WASM in sandbox: %v", err)
+	}
+
+	result, err := instance.Call(ctx, "add", 40, 2)
+	if results, ok := result.([]uint64); err != nil || !ok || len(results) != 1 || results[0] != 42 {
+		t.Errorf("expected add(40, 2) to return 42, got %v: %v", result, err)
+	}
+	if _, err := instance.Call(ctx, "add", "forty", 2); err == nil {
+		t.Error("expected string arguments to be refused")
+	}
+	if _, err := instance.Call(ctx, "spin"); !errors.Is(err, wasmruntime.ErrCPUTimeExceeded) {
+		t.Errorf("expected spin to be preempted after its CPU time, got %v", err)
+	}
+
+	if _, err := sandbox.LoadWASM(ctx, []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0xff}, &core.WASMModule{Name: "corrupt", Permissions: permissions}); err == nil {
+		t.Error("expected a corrupt module to be refused")
+	}
+}
@@ -0,0 +1,604 @@
+// Package soak exercises a running LIV server for hours, uploading,
+// validating, viewing and converting documents, while sampling the server's
+// goroutines, heap, resident memory and open file descriptors from its
+// Prometheus metrics. Resources that keep growing after warm-up are reported
+// as leaks and operations that slow down as latency drift: the failures unit
+// tests running for seconds cannot show.
+package soak
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations exercised in every cycle, in order
+const (
+	OpUpload   = "upload"
+	OpValidate = "validate"
+	OpView     = "view"
+	OpConvert  = "convert"
+)
+
+// Operations lists the operations in the order of a cycle
+var Operations = []string{OpUpload, OpValidate, OpView, OpConvert}
+
+// Resource is a server resource sampled from its metrics
+type Resource struct {
+	Name   string
+	Metric string
+	// Memory resources are allowed to grow by a fraction of their level,
+	// counts by a number
+	Memory bool
+}
+
+// Resources are the resources sampled; servers not reporting one, such as
+// file descriptors outside Linux, are not checked for it
+var Resources = []Resource{
+	{Name: "goroutines", Metric: "go_goroutines"},
+	{Name: "heap", Metric: "go_memstats_heap_alloc_bytes", Memory: true},
+	{Name: "resident memory", Metric: "process_resident_memory_bytes", Memory: true},
+	{Name: "open files", Metric: "process_open_fds"},
+}
+
+// Thresholds are the growth tolerated before a finding is reported
+type Thresholds struct {
+	// Goroutines and OpenFiles are the growth allowed over the run
+	Goroutines float64
+	OpenFiles  float64
+	// Memory is the growth of heap and resident memory allowed, as a
+	// fraction of their level after warm-up
+	Memory float64
+	// Latency is the growth of an operation's 95th percentile latency
+	// allowed, as a factor of its level after warm-up
+	Latency float64
+	// Errors is the fraction of operations allowed to fail
+	Errors float64
+}
+
+// DefaultThresholds tolerate the noise of a healthy server
+var DefaultThresholds = Thresholds{
+	Goroutines: 25,
+	OpenFiles:  25,
+	Memory:     0.5,
+	Latency:    2,
+	Errors:     0.01,
+}
+
+// latencyNoise is the latency growth always tolerated, so that operations
+// taking a few milliseconds do not drift on scheduling noise
+const latencyNoise = 25 * time.Millisecond
+
+// minSamples is the number of samples after warm-up leak detection needs
+const minSamples = 8
+
+// Config configures a soak test
+type Config struct {
+	// URL is the base URL of the server, e.g. http://localhost:8080
+	URL string
+	// Token is the bearer token for the metrics, the health token of the
+	// viewer; loopback clients need none
+	Token string
+	// Document is the LIV package uploaded in every cycle
+	Document []byte
+	// Format is the conversion format, "html" when empty
+	Format string
+	// Duration is how long to run; zero runs until the context is canceled
+	Duration time.Duration
+	// Warmup is left out of the baselines, while caches fill and pools grow
+	Warmup time.Duration
+	// Interval is how often the server is sampled, 10s when zero
+	Interval time.Duration
+	// Workers is the number of clients running cycles at once, 1 when zero
+	Workers    int
+	Thresholds Thresholds
+	// Client makes the requests, a client with a two minute timeout when nil
+	Client *http.Client
+	// Progress, when set, is called with every sample
+	Progress func(Sample)
+}
+
+// Sample is the state of the server at one time
+type Sample struct {
+	Elapsed time.Duration
+	// Values are the resources by name; those the server does not report
+	// are missing
+	Values map[string]float64
+	// Operations and Errors are the totals so far
+	Operations int
+	Errors     int
+}
+
+// OperationStats summarizes the runs of an operation
+type OperationStats struct {
+	Count     int
+	Errors    int
+	LastError string
+	// Baseline and Final are the 95th percentile latency in the first and
+	// last quarter of the run after warm-up
+	Baseline time.Duration
+	Final    time.Duration
+}
+
+// Finding is a leak, latency drift or error rate beyond its threshold
+type Finding struct {
+	// Kind is leak, latency or errors
+	Kind string
+	// Subject is the resource or operation
+	Subject string
+	Message string
+}
+
+// Report is the outcome of a soak test
+type Report struct {
+	Duration   time.Duration
+	Samples    []Sample
+	Operations map[string]*OperationStats
+	Findings   []*Finding
+}
+
+// Passed reports whether nothing exceeded its threshold
+func (r *Report) Passed() bool {
+	return len(r.Findings) == 0
+}
+
+// timing is one run of an operation
+type timing struct {
+	elapsed time.Duration
+	latency time.Duration
+}
+
+// run is the state of a soak test in progress
+type run struct {
+	config  Config
+	client  *http.Client
+	started time.Time
+
+	mu      sync.Mutex
+	timings map[string][]timing
+	stats   map[string]*OperationStats
+	total   int
+	errors  int
+}
+
+// Run exercises the server until the duration elapses or ctx is canceled and
+// reports what grew. It fails when the server stops answering.
+func Run(ctx context.Context, config Config) (*Report, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("server URL is required")
+	}
+	if len(config.Document) == 0 {
+		return nil, fmt.Errorf("a document to upload is required")
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+	if config.Format == "" {
+		config.Format = "html"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.Thresholds == (Thresholds{}) {
+		config.Thresholds = DefaultThresholds
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Minute}
+	}
+
+	r := &run{
+		config:  config,
+		client:  client,
+		started: time.Now(),
+		timings: make(map[string][]timing),
+		stats:   make(map[string]*OperationStats),
+	}
+	for _, op := range Operations {
+		r.stats[op] = &OperationStats{}
+	}
+
+	// The first sample fails fast on a wrong URL or token
+	first, err := r.sample(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server metrics: %v", err)
+	}
+	samples := []Sample{first}
+	if config.Progress != nil {
+		config.Progress(first)
+	}
+
+	if config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+	workCtx, stopWork := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for workCtx.Err() == nil {
+				r.cycle(workCtx)
+			}
+		}()
+	}
+
+	var runErr error
+	failures := 0
+	ticker := time.NewTicker(config.Interval)
+	for ctx.Err() == nil && runErr == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			s, err := r.sample(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				// A server busy with a burst may miss a scrape; one that
+				// misses several has stopped
+				if failures++; failures >= 3 {
+					runErr = fmt.Errorf("server stopped responding: %v", err)
+				}
+				break
+			}
+			failures = 0
+			samples = append(samples, s)
+			if config.Progress != nil {
+				config.Progress(s)
+			}
+		}
+	}
+	ticker.Stop()
+	stopWork()
+	wg.Wait()
+
+	report := r.report(samples)
+	return report, runErr
+}
+
+// cycle uploads, validates, views and converts the document once
+func (r *run) cycle(ctx context.Context) {
+	var id string
+	ok := r.timed(ctx, OpUpload, func() (err error) {
+		id, err = r.upload(ctx)
+		return err
+	})
+	ok = r.timed(ctx, OpValidate, func() error { return r.validate(ctx) }) && ok
+	if id == "" {
+		r.pause(ctx, ok)
+		return
+	}
+	ok = r.timed(ctx, OpView, func() error { return r.view(ctx, id) }) && ok
+	ok = r.timed(ctx, OpConvert, func() error { return r.convert(ctx, id) }) && ok
+	r.pause(ctx, ok)
+}
+
+// pause slows down cycles that failed, so that a failing server is not
+// flooded with requests
+func (r *run) pause(ctx context.Context, ok bool) {
+	if ok {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+}
+
+// timed runs and records an operation. Operations interrupted by the end of
+// the run are not recorded.
+func (r *run) timed(ctx context.Context, op string, fn func() error) bool {
+	start := time.Now()
+	err := fn()
+	if ctx.Err() != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats[op]
+	stats.Count++
+	r.total++
+	if err != nil {
+		stats.Errors++
+		stats.LastError = err.Error()
+		r.errors++
+		return false
+	}
+	r.timings[op] = append(r.timings[op], timing{elapsed: start.Sub(r.started), latency: time.Since(start)})
+	return true
+}
+
+func (r *run) upload(ctx context.Context) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("document", "soak.liv")
+	if err != nil {
+		return "", err
+	}
+	part.Write(r.config.Document)
+	form.Close()
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/api/upload", form.FormDataContentType(), &body, &response); err != nil {
+		return "", err
+	}
+	if response.ID == "" {
+		return "", fmt.Errorf("upload response has no document ID")
+	}
+	return response.ID, nil
+}
+
+func (r *run) validate(ctx context.Context) error {
+	return r.do(ctx, http.MethodPost, "/api/validate", "application/octet-stream", bytes.NewReader(r.config.Document), nil)
+}
+
+// view opens the document as the viewer does: its metadata, then its content
+func (r *run) view(ctx context.Context, id string) error {
+	var metadata struct {
+		ContentURL string `json:"content_url"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/api/document?id="+url.QueryEscape(id), "", nil, &metadata); err != nil {
+		return err
+	}
+	if metadata.ContentURL == "" {
+		return nil
+	}
+	return r.do(ctx, http.MethodGet, metadata.ContentURL, "", nil, nil)
+}
+
+// jobStatus is the part of a conversion job's state the test reads
+type jobStatus struct {
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	Error     string `json:"error"`
+	ResultURL string `json:"result_url"`
+}
+
+// convert runs a conversion job to the end and downloads its result
+func (r *run) convert(ctx context.Context, id string) error {
+	request, _ := json.Marshal(map[string]string{"document": id, "format": r.config.Format})
+	var status jobStatus
+	if err := r.do(ctx, http.MethodPost, "/api/jobs", "application/json", bytes.NewReader(request), &status); err != nil {
+		return err
+	}
+	for status.State != "succeeded" {
+		switch status.State {
+		case "failed", "canceled":
+			return fmt.Errorf("conversion %s: %s", status.State, status.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+		if err := r.do(ctx, http.MethodGet, "/api/jobs/"+status.ID, "", nil, &status); err != nil {
+			return err
+		}
+	}
+	if status.ResultURL == "" {
+		return fmt.Errorf("conversion succeeded without a result")
+	}
+	return r.do(ctx, http.MethodGet, status.ResultURL, "", nil, nil)
+}
+
+// do sends a request and decodes its JSON response into out, or discards the
+// response when out is nil
+func (r *run) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, r.config.URL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, strings.SplitN(path, "?", 2)[0], resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+// sample reads the resources from the server's metrics
+func (r *run) sample(ctx context.Context) (Sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.config.URL+"/metrics", nil)
+	if err != nil {
+		return Sample{}, err
+	}
+	if r.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.Token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return Sample{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Sample{}, fmt.Errorf("metrics returned %s", resp.Status)
+	}
+	metrics, err := ParseMetrics(resp.Body)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	s := Sample{Elapsed: time.Since(r.started), Values: make(map[string]float64)}
+	for _, resource := range Resources {
+		if value, ok := metrics[resource.Metric]; ok {
+			s.Values[resource.Name] = value
+		}
+	}
+	r.mu.Lock()
+	s.Operations, s.Errors = r.total, r.errors
+	r.mu.Unlock()
+	return s, nil
+}
+
+// ParseMetrics reads the metrics without labels from the Prometheus text
+// format
+func ParseMetrics(rd io.Reader) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.Contains(line, "{") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		metrics[fields[0]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %v", err)
+	}
+	return metrics, nil
+}
+
+// report analyzes the samples and timings of a finished run
+func (r *run) report(samples []Sample) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{
+		Duration:   time.Since(r.started),
+		Samples:    samples,
+		Operations: r.stats,
+	}
+	thresholds := r.config.Thresholds
+
+	var settled []Sample
+	for _, s := range samples {
+		if s.Elapsed >= r.config.Warmup {
+			settled = append(settled, s)
+		}
+	}
+	for _, resource := range Resources {
+		var values []float64
+		for _, s := range settled {
+			if value, ok := s.Values[resource.Name]; ok {
+				values = append(values, value)
+			}
+		}
+		start, end, growing := growth(values)
+		allowed := thresholds.Goroutines
+		if resource.Metric == "process_open_fds" {
+			allowed = thresholds.OpenFiles
+		}
+		if resource.Memory {
+			allowed = start * thresholds.Memory
+		}
+		if growing && end-start > allowed {
+			report.Findings = append(report.Findings, &Finding{
+				Kind:    "leak",
+				Subject: resource.Name,
+				Message: fmt.Sprintf("%s grew from %s to %s and kept growing", resource.Name, formatValue(resource, start), formatValue(resource, end)),
+			})
+		}
+	}
+
+	for _, op := range Operations {
+		stats := r.stats[op]
+		var latencies []timing
+		for _, t := range r.timings[op] {
+			if t.elapsed >= r.config.Warmup {
+				latencies = append(latencies, t)
+			}
+		}
+		stats.Baseline, stats.Final = drift(latencies)
+		if stats.Final > time.Duration(float64(stats.Baseline)*thresholds.Latency) && stats.Final-stats.Baseline > latencyNoise {
+			report.Findings = append(report.Findings, &Finding{
+				Kind:    "latency",
+				Subject: op,
+				Message: fmt.Sprintf("%s slowed down: 95th percentile %v after warm-up, %v at the end", op, stats.Baseline.Round(time.Millisecond), stats.Final.Round(time.Millisecond)),
+			})
+		}
+		if stats.Count > 0 && float64(stats.Errors) > float64(stats.Count)*thresholds.Errors {
+			report.Findings = append(report.Findings, &Finding{
+				Kind:    "errors",
+				Subject: op,
+				Message: fmt.Sprintf("%d of %d %s operations failed, last: %s", stats.Errors, stats.Count, op, stats.LastError),
+			})
+		}
+	}
+	return report
+}
+
+// growth compares the median of the first and last quarter of values. They
+// are growing when even the lowest value of the last quarter is above the
+// highest of the first, which garbage collection and idle pools cannot cause.
+func growth(values []float64) (start, end float64, growing bool) {
+	if len(values) < minSamples {
+		return 0, 0, false
+	}
+	quarter := len(values) / 4
+	first := append([]float64(nil), values[:quarter]...)
+	last := append([]float64(nil), values[len(values)-quarter:]...)
+	sort.Float64s(first)
+	sort.Float64s(last)
+	start, end = first[len(first)/2], last[len(last)/2]
+	return start, end, last[0] > first[len(first)-1]
+}
+
+// drift returns the 95th percentile latency of the first and last quarter of
+// the timings
+func drift(timings []timing) (baseline, final time.Duration) {
+	if len(timings) < minSamples {
+		return 0, 0
+	}
+	// Workers finish operations out of order
+	timings = append([]timing(nil), timings...)
+	sort.Slice(timings, func(i, j int) bool { return timings[i].elapsed < timings[j].elapsed })
+	quarter := len(timings) / 4
+	return percentile(timings[:quarter], 0.95), percentile(timings[len(timings)-quarter:], 0.95)
+}
+
+func percentile(timings []timing, p float64) time.Duration {
+	latencies := make([]time.Duration, len(timings))
+	for i, t := range timings {
+		latencies[i] = t.latency
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[int(float64(len(latencies)-1)*p)]
+}
+
+// formatValue shows memory in MiB and counts as integers
+func formatValue(resource Resource, value float64) string {
+	if resource.Memory {
+		return fmt.Sprintf("%.1f MiB", value/(1<<20))
+	}
+	return strconv.FormatFloat(value, 'f', 0, 64)
+}
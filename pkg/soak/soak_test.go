@@ -0,0 +1,143 @@
+package soak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers the requests of a soak test like the viewer. A leaking
+// server gains a goroutine with every upload.
+type fakeServer struct {
+	mu         sync.Mutex
+	leaking    bool
+	goroutines int
+	documents  int
+	jobs       map[string]int
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/metrics":
+		fmt.Fprintf(w, "# TYPE go_goroutines gauge\ngo_goroutines %d\n", 10+s.goroutines)
+		fmt.Fprintf(w, "go_memstats_heap_alloc_bytes 4.194304e+06\n")
+		fmt.Fprintf(w, "liv_documents_served_total{mode=\"view\"} %d\n", s.documents)
+	case r.URL.Path == "/api/upload":
+		if _, _, err := r.FormFile("document"); err != nil {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		s.documents++
+		if s.leaking {
+			s.goroutines++
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": fmt.Sprintf("doc-%d", s.documents)})
+	case r.URL.Path == "/api/validate":
+		w.Write([]byte(`{"valid": true}`))
+	case r.URL.Path == "/api/document":
+		json.NewEncoder(w).Encode(map[string]string{"content_url": "/api/content/" + r.URL.Query().Get("id") + "/content/index.html"})
+	case strings.HasPrefix(r.URL.Path, "/api/content/"):
+		w.Write([]byte("<h1>Document</h1>"))
+	case r.URL.Path == "/api/jobs":
+		id := fmt.Sprintf("job-%d", len(s.jobs))
+		s.jobs[id] = 0
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "state": "queued"})
+	case strings.HasSuffix(r.URL.Path, "/result"):
+		w.Write([]byte("<html></html>"))
+	case strings.HasPrefix(r.URL.Path, "/api/jobs/"):
+		// Jobs succeed on the first poll
+		id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "state": "succeeded", "result_url": "/api/jobs/" + id + "/result"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func soak(t *testing.T, server *fakeServer) *Report {
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	report, err := Run(context.Background(), Config{
+		URL:      ts.URL,
+		Document: []byte("PK"),
+		Duration: 1500 * time.Millisecond,
+		Warmup:   100 * time.Millisecond,
+		Interval: 25 * time.Millisecond,
+		Workers:  2,
+		// A cycle waits for its conversion, so few run in a short test
+		Thresholds: Thresholds{Goroutines: 5, OpenFiles: 5, Memory: 0.5, Latency: 2, Errors: 0.01},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	return report
+}
+
+func TestRunStableServer(t *testing.T) {
+	report := soak(t, &fakeServer{jobs: make(map[string]int)})
+	if !report.Passed() {
+		t.Errorf("Expected a stable server to pass, got %+v", report.Findings[0])
+	}
+	for _, op := range Operations {
+		if stats := report.Operations[op]; stats.Count == 0 || stats.Errors != 0 {
+			t.Errorf("Expected %s to run without errors, got %+v", op, stats)
+		}
+	}
+	if len(report.Samples) < minSamples {
+		t.Errorf("Expected regular samples, got %d", len(report.Samples))
+	}
+}
+
+func TestRunLeakingServer(t *testing.T) {
+	report := soak(t, &fakeServer{leaking: true, jobs: make(map[string]int)})
+	if report.Passed() || report.Findings[0].Kind != "leak" || report.Findings[0].Subject != "goroutines" {
+		t.Fatalf("Expected the goroutine leak to be found, got %+v", report.Findings)
+	}
+}
+
+func TestRunRefusesUnreachableServer(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	if _, err := Run(context.Background(), Config{URL: ts.URL, Document: []byte("PK")}); err == nil {
+		t.Errorf("Expected a server without metrics to be refused")
+	}
+}
+
+func TestGrowthAndDrift(t *testing.T) {
+	// Garbage collection saws up and down without a trend
+	sawtooth := []float64{10, 40, 12, 38, 11, 41, 10, 39, 12, 40, 11, 38}
+	if _, _, growing := growth(sawtooth); growing {
+		t.Errorf("Expected a sawtooth not to be growing")
+	}
+	if start, end, growing := growth([]float64{10, 12, 11, 14, 16, 15, 18, 20, 19, 22, 24, 23}); !growing || start >= end {
+		t.Errorf("Expected a rising series to be growing, got %v to %v", start, end)
+	}
+
+	var timings []timing
+	for i := 0; i < 40; i++ {
+		timings = append(timings, timing{elapsed: time.Duration(i) * time.Second, latency: time.Duration(10+i*5) * time.Millisecond})
+	}
+	baseline, final := drift(timings)
+	if baseline >= final || final < 150*time.Millisecond {
+		t.Errorf("Expected the latency to drift, got %v to %v", baseline, final)
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	metrics, err := ParseMetrics(strings.NewReader("# HELP go_goroutines Goroutines.\ngo_goroutines 12\nliv_total{mode=\"view\"} 3\nprocess_open_fds 9\n"))
+	if err != nil {
+		t.Fatalf("ParseMetrics failed: %v", err)
+	}
+	if len(metrics) != 2 || metrics["go_goroutines"] != 12 || metrics["process_open_fds"] != 9 {
+		t.Errorf("Unexpected metrics %v", metrics)
+	}
+}
@@ -0,0 +1,317 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+const (
+	documentExtension = ".liv"
+	metadataExtension = ".json"
+)
+
+// FileStore keeps documents on the local filesystem. Each document is stored as
+// <id>.liv next to an <id>.json metadata file. Documents are added and removed
+// under an advisory lock on the directory, so several servers or CLI
+// invocations can share one store.
+type FileStore struct {
+	dir         string
+	ttl         time.Duration
+	maxSize     int64
+	lockTimeout time.Duration
+}
+
+// NewFileStore creates a filesystem store rooted at dir. Documents expire ttl after
+// upload; a ttl of zero keeps them until deleted.
+func NewFileStore(dir string, ttl time.Duration) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("store directory is required")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %v", err)
+	}
+
+	return &FileStore{dir: dir, ttl: ttl, lockTimeout: DefaultLockTimeout}, nil
+}
+
+// SetMaxSize limits the size of stored documents; zero means unlimited
+func (s *FileStore) SetMaxSize(maxSize int64) *FileStore {
+	s.maxSize = maxSize
+	return s
+}
+
+// SetLockTimeout sets how long changes wait for another process holding the
+// store lock before failing with ErrLockTimeout
+func (s *FileStore) SetLockTimeout(timeout time.Duration) *FileStore {
+	s.lockTimeout = timeout
+	return s
+}
+
+// Put stores a document. The data is written to a temporary file and renamed into
+// place, so readers never observe a partially written document.
+func (s *FileStore) Put(filename string, r io.Reader) (*DocumentInfo, error) {
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create document file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if s.maxSize > 0 {
+		r = io.LimitReader(r, s.maxSize+1)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write document: %v", err)
+	}
+	if s.maxSize > 0 && size > s.maxSize {
+		return nil, fmt.Errorf("document exceeds maximum size of %d bytes", s.maxSize)
+	}
+
+	info := &DocumentInfo{
+		ID:       id,
+		Filename: filepath.Base(filename),
+		Size:     size,
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+		Uploaded: time.Now().UTC(),
+	}
+	if s.ttl > 0 {
+		info.Expires = info.Uploaded.Add(s.ttl)
+	}
+
+	metadata, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document metadata: %v", err)
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := atomicfile.WriteFile(s.metadataPath(id), metadata, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write document metadata: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.documentPath(id)); err != nil {
+		os.Remove(s.metadataPath(id))
+		return nil, fmt.Errorf("failed to store document: %v", err)
+	}
+
+	return info, nil
+}
+
+// Stat returns the metadata of a stored document. Expired documents are reported
+// as not found even before the collector has removed them.
+func (s *FileStore) Stat(id string) (*DocumentInfo, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.metadataPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read document metadata: %v", err)
+	}
+
+	var info DocumentInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid document metadata: %v", err)
+	}
+	if info.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	return &info, nil
+}
+
+// Open opens a stored document for reading
+func (s *FileStore) Open(id string) (Document, error) {
+	info, err := s.Stat(id)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(s.documentPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open document: %v", err)
+	}
+
+	return &fileDocument{File: file, info: info}, nil
+}
+
+// Delete removes a stored document
+func (s *FileStore) Delete(id string) error {
+	if !ValidID(id) {
+		return ErrNotFound
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.remove(id)
+}
+
+// remove deletes the files of a document; the caller holds the store lock
+func (s *FileStore) remove(id string) error {
+	docErr := os.Remove(s.documentPath(id))
+	metaErr := os.Remove(s.metadataPath(id))
+	if errors.Is(docErr, os.ErrNotExist) && errors.Is(metaErr, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	for _, err := range []error{docErr, metaErr} {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete document: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// List returns all unexpired documents, oldest first
+func (s *FileStore) List() ([]*DocumentInfo, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []*DocumentInfo
+	for _, id := range ids {
+		info, err := s.Stat(id)
+		if err != nil {
+			continue
+		}
+		documents = append(documents, info)
+	}
+
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].Uploaded.Before(documents[j].Uploaded)
+	})
+
+	return documents, nil
+}
+
+// PurgeExpired removes expired documents along with any document whose metadata
+// is missing or unreadable
+func (s *FileStore) PurgeExpired(now time.Time) (int, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		purged, err := s.purge(id, now)
+		if err != nil {
+			return removed, err
+		}
+		if purged {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// purge removes a document if it has expired or lost its metadata. The
+// metadata is read under the store lock, so a document another process is
+// still adding or removing is not mistaken for one with unreadable metadata.
+func (s *FileStore) purge(id string, now time.Time) (bool, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(s.metadataPath(id))
+	if err == nil {
+		var info DocumentInfo
+		if json.Unmarshal(data, &info) == nil && !info.Expired(now) {
+			return false, nil
+		}
+	}
+	if err := s.remove(id); err != nil && err != ErrNotFound {
+		return false, err
+	}
+	return true, nil
+}
+
+// lock takes the store lock, returning the function that releases it
+func (s *FileStore) lock() (func(), error) {
+	return lockDir(s.dir, s.lockTimeout)
+}
+
+// ids returns the IDs of every document or metadata file in the store directory
+func (s *FileStore) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store directory: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		id := strings.TrimSuffix(strings.TrimSuffix(name, documentExtension), metadataExtension)
+		if entry.IsDir() || !ValidID(id) || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (s *FileStore) documentPath(id string) string {
+	return filepath.Join(s.dir, id+documentExtension)
+}
+
+func (s *FileStore) metadataPath(id string) string {
+	return filepath.Join(s.dir, id+metadataExtension)
+}
+
+type fileDocument struct {
+	*os.File
+	info *DocumentInfo
+}
+
+func (d *fileDocument) Info() *DocumentInfo {
+	return d.info
+}
+
+// File returns the file backing an open document, or nil when the store does
+// not keep documents in files. Worker processes read documents through it
+// without copying them.
+func File(doc Document) *os.File {
+	if d, ok := doc.(*fileDocument); ok {
+		return d.File
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLockTimeout is how long a store waits for another process to
+// release the store lock before giving up
+const DefaultLockTimeout = 10 * time.Second
+
+// lockFileName is the advisory lock file every process sharing a store
+// directory locks while it adds or removes documents
+const lockFileName = ".lock"
+
+// lockRetryInterval is how often a busy store lock is retried
+const lockRetryInterval = 20 * time.Millisecond
+
+// ErrLockTimeout is returned when the store stays locked by another process
+// or request for longer than the lock timeout
+var ErrLockTimeout = errors.New("timed out waiting for the document store lock")
+
+// lockDir takes the exclusive advisory lock of a store directory, waiting up
+// to timeout for it, and returns the function that releases it. The lock is
+// held through an open file, so it is released if the process dies.
+func lockDir(dir string, timeout time.Duration) (func(), error) {
+	file, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store lock: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock store: %v", err)
+		}
+		if locked {
+			return func() {
+				unlock(file)
+				file.Close()
+			}, nil
+		}
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(min(lockRetryInterval, time.Until(deadline)))
+	}
+}
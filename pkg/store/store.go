@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"time"
+)
+
+// ErrNotFound is returned when a document does not exist or has expired
+var ErrNotFound = errors.New("document not found")
+
+// DocumentInfo describes a stored document
+type DocumentInfo struct {
+	ID       string    `json:"id"`
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Uploaded time.Time `json:"uploaded"`
+	Expires  time.Time `json:"expires,omitempty"`
+}
+
+// Expired reports whether the document has passed its expiry time
+func (i *DocumentInfo) Expired(now time.Time) bool {
+	return !i.Expires.IsZero() && now.After(i.Expires)
+}
+
+// Document is an open stored document. It supports random access so packages
+// can be read as ZIP archives without copying them into memory.
+type Document interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+	Info() *DocumentInfo
+}
+
+// DocumentStore persists uploaded documents by ID. Implementations must be safe
+// for concurrent use.
+type DocumentStore interface {
+	// Put stores a document and returns its assigned ID
+	Put(filename string, r io.Reader) (*DocumentInfo, error)
+	// Stat returns the metadata of a stored document
+	Stat(id string) (*DocumentInfo, error)
+	// Open opens a stored document for reading
+	Open(id string) (Document, error)
+	// Delete removes a stored document
+	Delete(id string) error
+	// List returns all stored documents
+	List() ([]*DocumentInfo, error)
+	// PurgeExpired removes documents whose TTL has passed and returns how many were removed
+	PurgeExpired(now time.Time) (int, error)
+}
+
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// NewID generates a random document ID
+func NewID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate document ID: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ValidID reports whether id has the form produced by NewID
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// RunCollector purges expired documents from s every interval until ctx is cancelled
+func RunCollector(ctx context.Context, s DocumentStore, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			removed, err := s.PurgeExpired(now)
+			if err != nil {
+				log.Printf("document store: garbage collection failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("document store: removed %d expired documents", removed)
+			}
+		}
+	}
+}
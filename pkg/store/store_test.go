@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileStore_PutOpenDelete(t *testing.T) {
+	s, err := NewFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	info, err := s.Put("../../report.liv", strings.NewReader("package bytes"))
+	if err != nil {
+		t.Fatalf("Failed to store document: %v", err)
+	}
+	if !ValidID(info.ID) || info.Filename != "report.liv" || info.Size != 13 || info.SHA256 == "" {
+		t.Errorf("Unexpected document info: %+v", info)
+	}
+	if info.Expires.Sub(info.Uploaded) != time.Hour {
+		t.Errorf("Expected expiry one hour after upload, got %v", info.Expires.Sub(info.Uploaded))
+	}
+
+	doc, err := s.Open(info.ID)
+	if err != nil {
+		t.Fatalf("Failed to open document: %v", err)
+	}
+	data, _ := io.ReadAll(doc)
+	doc.Close()
+	if string(data) != "package bytes" {
+		t.Errorf("Unexpected document content: %q", data)
+	}
+
+	list, err := s.List()
+	if err != nil || len(list) != 1 || list[0].ID != info.ID {
+		t.Errorf("Unexpected document list: %v (%v)", list, err)
+	}
+
+	if err := s.Delete(info.ID); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if _, err := s.Open(info.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.Delete(info.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestFileStore_RejectsInvalidIDs(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStore(dir, 0)
+
+	os.WriteFile(filepath.Join(dir, "secret.json"), []byte(`{}`), 0600)
+
+	for _, id := range []string{"", "secret", "../secret", strings.Repeat("g", 32)} {
+		if _, err := s.Stat(id); err != ErrNotFound {
+			t.Errorf("Expected %q to be rejected, got %v", id, err)
+		}
+	}
+}
+
+func TestFileStore_MaxSize(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStore(dir, 0)
+	s.SetMaxSize(4)
+
+	if _, err := s.Put("big.liv", strings.NewReader("too large")); err == nil {
+		t.Error("Expected oversized document to be rejected")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected no files left behind, found %d", len(entries))
+	}
+}
+
+func TestFileStore_PurgeExpired(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStore(dir, time.Minute)
+	expiring, _ := s.Put("old.liv", strings.NewReader("old"))
+
+	s.ttl = 0
+	permanent, _ := s.Put("kept.liv", strings.NewReader("kept"))
+
+	// A document whose metadata was lost is collected regardless of age
+	orphan, _ := NewID()
+	os.WriteFile(filepath.Join(dir, orphan+documentExtension), []byte("orphan"), 0600)
+
+	removed, err := s.PurgeExpired(expiring.Expires.Add(-time.Second))
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected only the orphan to be removed, got %d (%v)", removed, err)
+	}
+
+	removed, err = s.PurgeExpired(expiring.Expires.Add(time.Second))
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected the expired document to be removed, got %d (%v)", removed, err)
+	}
+	if _, err := os.Stat(s.documentPath(expiring.ID)); !os.IsNotExist(err) {
+		t.Error("Expected expired document file to be deleted")
+	}
+	if _, err := s.Stat(permanent.ID); err != nil {
+		t.Errorf("Expected document without TTL to survive, got %v", err)
+	}
+}
+
+func TestFileStore_LockTimeout(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStore(dir, 0)
+	s.SetLockTimeout(50 * time.Millisecond)
+	kept, _ := s.Put("kept.liv", strings.NewReader("kept"))
+
+	// Another process holding the lock, here through its own open file
+	unlock, err := lockDir(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to lock store: %v", err)
+	}
+	if _, err := s.Put("new.liv", strings.NewReader("new")); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("Expected Put to time out, got %v", err)
+	}
+	if err := s.Delete(kept.ID); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("Expected Delete to time out, got %v", err)
+	}
+	if _, err := s.Stat(kept.ID); err != nil {
+		t.Errorf("Expected reads not to wait for the lock, got %v", err)
+	}
+	unlock()
+
+	if err := s.Delete(kept.ID); err != nil {
+		t.Errorf("Expected Delete to succeed once the lock is released, got %v", err)
+	}
+	list, _ := s.List()
+	if len(list) != 0 {
+		t.Errorf("Expected the timed out Put to leave nothing behind, got %d documents", len(list))
+	}
+}
+
+func TestFileStore_SharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	first, _ := NewFileStore(dir, 0)
+	second, _ := NewFileStore(dir, 0)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		for _, s := range []*FileStore{first, second} {
+			wg.Add(1)
+			go func(s *FileStore) {
+				defer wg.Done()
+				// The collector must not take a document still being added
+				// for one with unreadable metadata
+				_, err := s.Put("doc.liv", strings.NewReader("content"))
+				if err == nil {
+					_, err = s.PurgeExpired(time.Now())
+				}
+				errs <- err
+			}(s)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Concurrent change failed: %v", err)
+		}
+	}
+
+	list, err := second.List()
+	if err != nil || len(list) != 40 {
+		t.Errorf("Expected every document kept, got %d (%v)", len(list), err)
+	}
+}
+
+func TestRunCollector(t *testing.T) {
+	s, _ := NewFileStore(t.TempDir(), time.Nanosecond)
+	info, _ := s.Put("short.liv", strings.NewReader("x"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunCollector(ctx, s, 5*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(s.documentPath(info.ID)); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if _, err := os.Stat(s.documentPath(info.ID)); !os.IsNotExist(err) {
+		t.Error("Expected collector to remove expired document")
+	}
+}
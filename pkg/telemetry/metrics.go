@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"runtime"
+	"time"
+)
+
+// Metrics are the metrics exported by the LIV servers. Each server counts
+// what it does and leaves the rest at zero, so dashboards and alerts work
+// across both.
+type Metrics struct {
+	*Registry
+	// DocumentsServed counts documents sent to readers, by mode: view for
+	// metadata opened in the viewer, download for whole packages and chunks
+	// for chunk manifests of resumable downloads
+	DocumentsServed *Counter
+	// UploadSize is the size in bytes of accepted uploads
+	UploadSize *Histogram
+	// ValidationFailures counts documents and signatures rejected, by reason
+	ValidationFailures *Counter
+	// SignatureVerification is how long verifying signatures takes, by
+	// result
+	SignatureVerification *Histogram
+	// PolicyViolations counts security events reporting policy and
+	// compliance violations, by event type and severity
+	PolicyViolations *Counter
+}
+
+// NewMetrics creates the metrics of a server with a registry of their own,
+// which also reports the process's uptime, goroutines and heap and, on Linux,
+// its open file descriptors and resident memory
+func NewMetrics() *Metrics {
+	r := NewRegistry()
+	m := &Metrics{
+		Registry:              r,
+		DocumentsServed:       r.NewCounter("liv_documents_served_total", "Documents served to readers.", "mode"),
+		UploadSize:            r.NewHistogram("liv_upload_size_bytes", "Size of accepted document uploads.", SizeBuckets),
+		ValidationFailures:    r.NewCounter("liv_validation_failures_total", "Documents and signatures that failed validation.", "reason"),
+		SignatureVerification: r.NewHistogram("liv_signature_verification_duration_seconds", "Time taken to verify signatures.", DurationBuckets, "result"),
+		PolicyViolations:      r.NewCounter("liv_policy_violations_total", "Security policy violations reported.", "type", "severity"),
+	}
+
+	started := time.Now()
+	r.NewGaugeFunc("process_start_time_seconds", "Start time of the process since the Unix epoch in seconds.", func() float64 {
+		return float64(started.UnixNano()) / 1e9
+	})
+	r.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	r.NewGaugeFunc("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", func() float64 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return float64(stats.HeapAlloc)
+	})
+	registerProcessGauges(r)
+	return m
+}
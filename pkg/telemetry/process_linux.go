@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// registerProcessGauges reports the open file descriptors and resident memory
+// of the process, read from /proc
+func registerProcessGauges(r *Registry) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		return
+	}
+	r.NewGaugeFunc("process_open_fds", "Number of open file descriptors.", func() float64 {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			return 0
+		}
+		// The descriptor reading the directory is listed too
+		return float64(len(entries) - 1)
+	})
+	r.NewGaugeFunc("process_resident_memory_bytes", "Resident memory size in bytes.", func() float64 {
+		// statm lists sizes in pages: total, resident, ...
+		data, err := os.ReadFile("/proc/self/statm")
+		if err != nil {
+			return 0
+		}
+		fields := bytes.Fields(data)
+		if len(fields) < 2 {
+			return 0
+		}
+		pages, err := strconv.ParseFloat(string(fields[1]), 64)
+		if err != nil {
+			return 0
+		}
+		return pages * float64(os.Getpagesize())
+	})
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package telemetry
+
+// registerProcessGauges reports nothing: file descriptors and resident memory
+// are read from /proc, which only Linux has
+func registerProcessGauges(r *Registry) {}
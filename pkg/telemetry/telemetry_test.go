@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Requests\nhandled.", "method", "path")
+	errors := r.NewCounter("test_errors_total", "Errors.")
+	sizes := r.NewHistogram("test_size_bytes", "Sizes.", []float64{100, 10})
+	r.NewGaugeFunc("test_temperature", "Temperature.", func() float64 { return 21.5 })
+
+	requests.Inc("GET", "/")
+	requests.Add(2, "POST", `/a"b`)
+	requests.Inc("GET", "/")
+	sizes.Observe(5)
+	sizes.Observe(50)
+	sizes.Observe(500)
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_requests_total Requests\nhandled.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/"} 2
+test_requests_total{method="POST",path="/a\"b"} 2
+# HELP test_size_bytes Sizes.
+# TYPE test_size_bytes histogram
+test_size_bytes_bucket{le="10"} 1
+test_size_bytes_bucket{le="100"} 2
+test_size_bytes_bucket{le="+Inf"} 3
+test_size_bytes_sum 555
+test_size_bytes_count 3
+# HELP test_temperature Temperature.
+# TYPE test_temperature gauge
+test_temperature 21.5
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s", buf.String())
+	}
+	if requests.Value("GET", "/") != 2 || errors.Value() != 0 || sizes.Count() != 3 {
+		t.Error("Unexpected values")
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	expectPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected %s to panic", name)
+			}
+		}()
+		f()
+	}
+	r := NewRegistry()
+	counter := r.NewCounter("test_total", "Test.", "kind")
+	expectPanic("a repeated name", func() { r.NewCounter("test_total", "Test.") })
+	expectPanic("an invalid name", func() { r.NewCounter("test-total", "Test.") })
+	expectPanic("a reserved label", func() { r.NewHistogram("test_seconds", "Test.", DurationBuckets, "le") })
+	expectPanic("missing label values", func() { counter.Inc() })
+	expectPanic("a decrease", func() { counter.Add(-1, "a") })
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m := NewMetrics()
+	m.DocumentsServed.Inc("download")
+	m.UploadSize.Observe(2048)
+	m.PolicyViolations.Inc("policy_violation", "high")
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("Unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, expected := range []string{
+		`liv_documents_served_total{mode="download"} 1`,
+		`liv_upload_size_bytes_bucket{le="4096"} 1`,
+		"liv_validation_failures_total",
+		`liv_policy_violations_total{type="policy_violation",severity="high"} 1`,
+		"# TYPE liv_signature_verification_duration_seconds histogram",
+		"go_goroutines ",
+		"process_start_time_seconds ",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, w.Body.String())
+		}
+	}
+
+	if runtime.GOOS == "linux" {
+		for _, expected := range []string{"process_open_fds ", "process_resident_memory_bytes "} {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("Expected %q on Linux", expected)
+			}
+		}
+	}
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to be refused, got %d", w.Code)
+	}
+}
@@ -0,0 +1,372 @@
+package templates
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+const (
+	// DescriptorFile is the template descriptor at the root of a template package
+	DescriptorFile = "template.json"
+
+	// SignatureFile holds the publisher's signature over the descriptor
+	SignatureFile = "template.sig"
+
+	// PackageExtension is the file extension of template packages
+	PackageExtension = ".livt"
+
+	// MaxPackageSize limits the size of downloaded template packages
+	MaxPackageSize = 100 * 1024 * 1024
+)
+
+var (
+	nameRegex   = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+	semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?$`)
+)
+
+// Descriptor describes a template package. The descriptor lists the hash of every
+// file in the package, so signing the descriptor covers the whole template.
+type Descriptor struct {
+	Name             string            `json:"name" validate:"required,templatename"`
+	Version          string            `json:"version" validate:"required,semver"`
+	Title            string            `json:"title" validate:"required,max=200"`
+	Description      string            `json:"description" validate:"max=1000"`
+	Author           string            `json:"author" validate:"required,max=100"`
+	Preview          string            `json:"preview,omitempty"`
+	RequiredFeatures []string          `json:"required_features,omitempty" validate:"dive,oneof=animations interactivity charts forms audio video webgl webassembly"`
+	License          *core.LicenseInfo `json:"license,omitempty"`
+	Files            map[string]string `json:"files" validate:"required,min=1"`
+}
+
+// InstallOptions controls how template packages are installed
+type InstallOptions struct {
+	// Dir is the template library directory
+	Dir string
+	// TrustedKeys are the publisher keys accepted for template signatures
+	TrustedKeys []*rsa.PublicKey
+	// AllowUnsigned installs templates without a trusted signature
+	AllowUnsigned bool
+	// Client downloads templates given by URL
+	Client *http.Client
+}
+
+// InstalledTemplate describes a template in the local library
+type InstalledTemplate struct {
+	Descriptor *Descriptor
+	Path       string
+	Signed     bool
+}
+
+// DefaultDir returns the default template library directory
+func DefaultDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".liv", "templates")
+	}
+	return filepath.Join(os.TempDir(), "liv-templates")
+}
+
+// ValidateDescriptor validates descriptor fields and file references
+func ValidateDescriptor(descriptor *Descriptor) error {
+	v := validator.New()
+	v.RegisterValidation("semver", func(fl validator.FieldLevel) bool {
+		return semverRegex.MatchString(fl.Field().String())
+	})
+	v.RegisterValidation("templatename", func(fl validator.FieldLevel) bool {
+		return nameRegex.MatchString(fl.Field().String())
+	})
+
+	if err := v.Struct(descriptor); err != nil {
+		return fmt.Errorf("invalid template descriptor: %v", err)
+	}
+
+	if _, exists := descriptor.Files["content/index.html"]; !exists {
+		return fmt.Errorf("template must include content/index.html")
+	}
+	if descriptor.Preview != "" {
+		if _, exists := descriptor.Files[descriptor.Preview]; !exists {
+			return fmt.Errorf("preview image %s is not part of the template", descriptor.Preview)
+		}
+	}
+
+	return nil
+}
+
+// Pack creates a template package from a directory containing template.json and the
+// template files. The file list in the descriptor is regenerated from the directory,
+// and the descriptor is signed when a private key is given.
+func Pack(sourceDir, outputPath string, privateKey *rsa.PrivateKey) (*Descriptor, error) {
+	descriptorData, err := os.ReadFile(filepath.Join(sourceDir, DescriptorFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template descriptor: %v", err)
+	}
+
+	var descriptor Descriptor
+	if err := json.Unmarshal(descriptorData, &descriptor); err != nil {
+		return nil, fmt.Errorf("invalid template descriptor: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	descriptor.Files = make(map[string]string)
+	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == DescriptorFile || relPath == SignatureFile {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", relPath, err)
+		}
+		files[relPath] = content
+		descriptor.Files[relPath] = hashBytes(content)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan template: %v", err)
+	}
+
+	if err := ValidateDescriptor(&descriptor); err != nil {
+		return nil, err
+	}
+
+	descriptorData, err = json.MarshalIndent(&descriptor, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize descriptor: %v", err)
+	}
+	files[DescriptorFile] = descriptorData
+
+	if privateKey != nil {
+		signature, err := integrity.NewSignatureManager().SignData(descriptorData, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		files[SignatureFile] = []byte(signature)
+	}
+
+	zipContainer := container.NewZIPContainer().SetValidateStructure(false)
+	if err := zipContainer.CreateFromFiles(files, outputPath); err != nil {
+		return nil, fmt.Errorf("failed to write template package: %v", err)
+	}
+
+	return &descriptor, nil
+}
+
+// Install verifies a template package from a file path or URL and installs it into
+// the template library. Templates are only installed when the descriptor carries a
+// signature from a trusted key (unless unsigned templates are allowed) and every
+// file matches the hash recorded in the descriptor.
+func Install(source string, opts InstallOptions) (*InstalledTemplate, error) {
+	data, err := readSource(source, opts.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	zipContainer := container.NewZIPContainer()
+	files, err := zipContainer.ExtractFromReaderToMemory(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template package: %v", err)
+	}
+
+	descriptor, signed, err := Verify(files, opts.TrustedKeys)
+	if err != nil {
+		return nil, err
+	}
+	if !signed && !opts.AllowUnsigned {
+		return nil, fmt.Errorf("template %s is not signed by a trusted key", descriptor.Name)
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	targetDir := filepath.Join(dir, descriptor.Name, descriptor.Version)
+
+	// Stage the template next to its final location so a failed install leaves nothing behind
+	stagingDir := targetDir + fmt.Sprintf(".staging-%d", time.Now().UnixNano())
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create template directory: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	for path, content := range files {
+		target := filepath.Join(stagingDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %v", path, err)
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+	}
+
+	if err := os.RemoveAll(targetDir); err != nil {
+		return nil, fmt.Errorf("failed to replace installed template: %v", err)
+	}
+	if err := os.Rename(stagingDir, targetDir); err != nil {
+		return nil, fmt.Errorf("failed to install template: %v", err)
+	}
+
+	return &InstalledTemplate{Descriptor: descriptor, Path: targetDir, Signed: signed}, nil
+}
+
+// Verify checks the descriptor, its signature and the file hashes of an extracted
+// template package. It reports whether the descriptor is signed by one of the trusted keys.
+func Verify(files map[string][]byte, trustedKeys []*rsa.PublicKey) (*Descriptor, bool, error) {
+	descriptorData, exists := files[DescriptorFile]
+	if !exists {
+		return nil, false, fmt.Errorf("template package has no %s", DescriptorFile)
+	}
+
+	var descriptor Descriptor
+	if err := json.Unmarshal(descriptorData, &descriptor); err != nil {
+		return nil, false, fmt.Errorf("invalid template descriptor: %v", err)
+	}
+	if err := ValidateDescriptor(&descriptor); err != nil {
+		return nil, false, err
+	}
+
+	for path, content := range files {
+		if path == DescriptorFile || path == SignatureFile {
+			continue
+		}
+		if path != filepath.ToSlash(filepath.Clean(path)) || strings.HasPrefix(path, "../") || filepath.IsAbs(path) || strings.Contains(path, "\\") {
+			return nil, false, fmt.Errorf("template package contains an invalid path: %s", path)
+		}
+		expected, listed := descriptor.Files[path]
+		if !listed {
+			return nil, false, fmt.Errorf("file %s is not listed in the template descriptor", path)
+		}
+		if hashBytes(content) != expected {
+			return nil, false, fmt.Errorf("file %s does not match the template descriptor", path)
+		}
+	}
+	for path := range descriptor.Files {
+		if _, exists := files[path]; !exists {
+			return nil, false, fmt.Errorf("file %s listed in the template descriptor is missing", path)
+		}
+	}
+
+	signature, hasSignature := files[SignatureFile]
+	if !hasSignature {
+		return &descriptor, false, nil
+	}
+
+	sigManager := integrity.NewSignatureManager()
+	for _, key := range trustedKeys {
+		if valid, err := sigManager.VerifySignature(descriptorData, strings.TrimSpace(string(signature)), key); err == nil && valid {
+			return &descriptor, true, nil
+		}
+	}
+
+	if len(trustedKeys) == 0 {
+		return &descriptor, false, nil
+	}
+	return nil, false, fmt.Errorf("template signature is not from a trusted key")
+}
+
+// List returns the templates installed in a template library
+func List(dir string) ([]*InstalledTemplate, error) {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*", "*", DescriptorFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []*InstalledTemplate
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		var descriptor Descriptor
+		if err := json.Unmarshal(data, &descriptor); err != nil {
+			continue
+		}
+		templateDir := filepath.Dir(match)
+		_, signErr := os.Stat(filepath.Join(templateDir, SignatureFile))
+		installed = append(installed, &InstalledTemplate{
+			Descriptor: &descriptor,
+			Path:       templateDir,
+			Signed:     signErr == nil,
+		})
+	}
+
+	sort.Slice(installed, func(i, j int) bool {
+		if installed[i].Descriptor.Name != installed[j].Descriptor.Name {
+			return installed[i].Descriptor.Name < installed[j].Descriptor.Name
+		}
+		return installed[i].Descriptor.Version < installed[j].Descriptor.Version
+	})
+
+	return installed, nil
+}
+
+// readSource reads a template package from a local path or an http(s) URL
+func readSource(source string, client *http.Client) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template package: %v", err)
+		}
+		return data, nil
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download template: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download template: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxPackageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download template: %v", err)
+	}
+	if len(data) > MaxPackageSize {
+		return nil, fmt.Errorf("template package exceeds %d bytes", MaxPackageSize)
+	}
+
+	return data, nil
+}
+
+func hashBytes(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
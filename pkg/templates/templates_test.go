@@ -0,0 +1,173 @@
+package templates
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/container"
+)
+
+func setupTemplateDir(t *testing.T) string {
+	dir := t.TempDir()
+
+	descriptor := Descriptor{
+		Name:             "quarterly-report",
+		Version:          "1.2.0",
+		Title:            "Quarterly Report",
+		Author:           "LIV Templates",
+		Preview:          "preview.png",
+		RequiredFeatures: []string{"charts"},
+	}
+	data, _ := json.Marshal(descriptor)
+
+	files := map[string]string{
+		DescriptorFile:            string(data),
+		"content/index.html":      "<html><body><h1>{{title}}</h1></body></html>",
+		"content/styles/main.css": "body { margin: 0; }",
+		"preview.png":             "\x89PNG\r\n\x1a\n",
+	}
+	for path, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	return dir
+}
+
+func TestPackAndInstall(t *testing.T) {
+	sourceDir := setupTemplateDir(t)
+	libraryDir := t.TempDir()
+	packagePath := filepath.Join(t.TempDir(), "quarterly"+PackageExtension)
+
+	publisher, _ := rsa.GenerateKey(rand.Reader, 2048)
+	stranger, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	descriptor, err := Pack(sourceDir, packagePath, publisher)
+	if err != nil {
+		t.Fatalf("Failed to pack template: %v", err)
+	}
+	if len(descriptor.Files) != 3 {
+		t.Errorf("Expected 3 files in descriptor, got %d", len(descriptor.Files))
+	}
+
+	// Untrusted publisher
+	_, err = Install(packagePath, InstallOptions{Dir: libraryDir, TrustedKeys: []*rsa.PublicKey{&stranger.PublicKey}})
+	if err == nil {
+		t.Error("Expected install with untrusted key to fail")
+	}
+
+	// No trusted keys and unsigned installs not allowed
+	if _, err := Install(packagePath, InstallOptions{Dir: libraryDir}); err == nil {
+		t.Error("Expected install without trusted keys to fail")
+	}
+
+	installed, err := Install(packagePath, InstallOptions{Dir: libraryDir, TrustedKeys: []*rsa.PublicKey{&publisher.PublicKey}})
+	if err != nil {
+		t.Fatalf("Failed to install template: %v", err)
+	}
+	if !installed.Signed {
+		t.Error("Expected installed template to be reported as signed")
+	}
+	if _, err := os.Stat(filepath.Join(installed.Path, "content", "index.html")); err != nil {
+		t.Errorf("Expected template content to be installed: %v", err)
+	}
+
+	list, err := List(libraryDir)
+	if err != nil || len(list) != 1 || list[0].Descriptor.Version != "1.2.0" {
+		t.Errorf("Unexpected template list: %v (%v)", list, err)
+	}
+}
+
+func TestInstall_RejectsTamperedPackage(t *testing.T) {
+	sourceDir := setupTemplateDir(t)
+	packagePath := filepath.Join(t.TempDir(), "quarterly"+PackageExtension)
+
+	publisher, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := Pack(sourceDir, packagePath, publisher); err != nil {
+		t.Fatalf("Failed to pack template: %v", err)
+	}
+
+	zipContainer := container.NewZIPContainer().SetValidateStructure(false)
+	files, err := zipContainer.ExtractToMemory(packagePath)
+	if err != nil {
+		t.Fatalf("Failed to extract package: %v", err)
+	}
+	files["content/index.html"] = []byte("<script>alert(1)</script>")
+
+	if _, _, err := Verify(files, []*rsa.PublicKey{&publisher.PublicKey}); err == nil {
+		t.Error("Expected modified file to fail verification")
+	}
+
+	delete(files, "content/index.html")
+	files["../escape.html"] = []byte("x")
+	if _, _, err := Verify(files, nil); err == nil {
+		t.Error("Expected path traversal to fail verification")
+	}
+}
+
+func TestInstall_FromURL(t *testing.T) {
+	sourceDir := setupTemplateDir(t)
+	packagePath := filepath.Join(t.TempDir(), "quarterly"+PackageExtension)
+	if _, err := Pack(sourceDir, packagePath, nil); err != nil {
+		t.Fatalf("Failed to pack template: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, packagePath)
+	}))
+	defer server.Close()
+
+	libraryDir := t.TempDir()
+	if _, err := Install(server.URL+"/quarterly.livt", InstallOptions{Dir: libraryDir}); err == nil {
+		t.Error("Expected unsigned template to be rejected by default")
+	}
+
+	installed, err := Install(server.URL+"/quarterly.livt", InstallOptions{Dir: libraryDir, AllowUnsigned: true})
+	if err != nil {
+		t.Fatalf("Failed to install from URL: %v", err)
+	}
+	if installed.Signed || installed.Descriptor.Name != "quarterly-report" {
+		t.Errorf("Unexpected installed template: %+v", installed)
+	}
+}
+
+func TestValidateDescriptor(t *testing.T) {
+	descriptor := &Descriptor{
+		Name:    "Bad Name",
+		Version: "1.0.0",
+		Title:   "Test",
+		Author:  "Author",
+		Files:   map[string]string{"content/index.html": "abc"},
+	}
+	if err := ValidateDescriptor(descriptor); err == nil {
+		t.Error("Expected invalid name to fail")
+	}
+
+	descriptor.Name = "valid-name"
+	descriptor.RequiredFeatures = []string{"teleportation"}
+	if err := ValidateDescriptor(descriptor); err == nil {
+		t.Error("Expected unknown feature to fail")
+	}
+
+	descriptor.RequiredFeatures = []string{"forms"}
+	descriptor.Preview = "missing.png"
+	if err := ValidateDescriptor(descriptor); err == nil {
+		t.Error("Expected missing preview to fail")
+	}
+
+	descriptor.Preview = ""
+	if err := ValidateDescriptor(descriptor); err != nil {
+		t.Errorf("Expected valid descriptor: %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+const (
+	// ThemeFile is the theme descriptor at the root of a theme directory
+	ThemeFile = "theme.json"
+
+	// LayoutFile is the layout wrapped around each content page. Themes
+	// without one only add their stylesheets to the pages.
+	LayoutFile = "layout.html"
+
+	// ThemePrefix is where the assets of a theme are packaged, under the
+	// theme's name
+	ThemePrefix = "assets/themes/"
+)
+
+// ThemeDescriptor describes a theme: a layout, stylesheets and fonts applied
+// to a document's content when it is built
+type ThemeDescriptor struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Title       string            `json:"title"`
+	Description string            `json:"description,omitempty"`
+	Author      string            `json:"author,omitempty"`
+	License     *core.LicenseInfo `json:"license,omitempty"`
+	// Stylesheets are linked from every page in order, all stylesheets of
+	// the theme in path order when empty
+	Stylesheets []string `json:"stylesheets,omitempty"`
+}
+
+// Theme is a loaded theme
+type Theme struct {
+	Descriptor *ThemeDescriptor
+	// Layout is the html/template wrapped around each page, empty for
+	// themes that only add stylesheets
+	Layout string
+	// Files are the assets of the theme by slash-separated path: its
+	// stylesheets, fonts and images
+	Files map[string][]byte
+}
+
+// LayoutData is what a layout is rendered with. A layout places .Body, and
+// .Head and .Styles in its head; theme assets are referenced relative to
+// .Base, e.g. {{.Base}}fonts/inter.woff2.
+type LayoutData struct {
+	Title    string
+	Author   string
+	Language string
+	// Head and Body are the contents of the page's head and body elements
+	Head template.HTML
+	Body template.HTML
+	// Styles links the theme's stylesheets
+	Styles template.HTML
+	// Base is the path of the theme's assets relative to the page, ending in
+	// a slash
+	Base string
+}
+
+// DefaultThemeDir returns the default theme library directory, where themes
+// are looked up by name
+func DefaultThemeDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".liv", "themes")
+	}
+	return filepath.Join(os.TempDir(), "liv-themes")
+}
+
+// Themes returns the names of the built-in themes in order
+func Themes() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme loads a theme from a directory containing theme.json or, given a
+// name, from the theme library or the built-in themes, in that order
+func LoadTheme(ref, libraryDir string) (*Theme, error) {
+	if _, err := os.Stat(filepath.Join(ref, ThemeFile)); err == nil {
+		return loadThemeDir(ref)
+	}
+	if strings.ContainsAny(ref, `/\`) || strings.HasPrefix(ref, ".") {
+		return nil, fmt.Errorf("theme directory %s has no %s", ref, ThemeFile)
+	}
+	if !nameRegex.MatchString(ref) {
+		return nil, fmt.Errorf("invalid theme name %q", ref)
+	}
+
+	if libraryDir == "" {
+		libraryDir = DefaultThemeDir()
+	}
+	if dir := filepath.Join(libraryDir, ref); fileExists(filepath.Join(dir, ThemeFile)) {
+		return loadThemeDir(dir)
+	}
+	if builtin, ok := builtinThemes[ref]; ok {
+		return builtin(), nil
+	}
+	return nil, fmt.Errorf("unknown theme %q (built-in themes are %s)", ref, strings.Join(Themes(), ", "))
+}
+
+// loadThemeDir reads a theme directory. Hidden files are left out.
+func loadThemeDir(dir string) (*Theme, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ThemeFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read theme descriptor: %v", err)
+	}
+	var descriptor ThemeDescriptor
+	if err := json.Unmarshal(data, &descriptor); err != nil {
+		return nil, fmt.Errorf("invalid theme descriptor: %v", err)
+	}
+
+	theme := &Theme{Descriptor: &descriptor, Files: make(map[string][]byte)}
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && p != dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		switch rel {
+		case ThemeFile:
+		case LayoutFile:
+			theme.Layout = string(data)
+		default:
+			theme.Files[rel] = data
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read theme: %v", err)
+	}
+	if err := theme.Validate(); err != nil {
+		return nil, err
+	}
+	return theme, nil
+}
+
+// Validate checks the descriptor, the stylesheets it lists and the layout
+func (t *Theme) Validate() error {
+	d := t.Descriptor
+	if !nameRegex.MatchString(d.Name) {
+		return fmt.Errorf("invalid theme name %q", d.Name)
+	}
+	if !semverRegex.MatchString(d.Version) {
+		return fmt.Errorf("invalid theme version %q", d.Version)
+	}
+	if d.Title == "" {
+		return fmt.Errorf("theme title is required")
+	}
+	for _, stylesheet := range d.Stylesheets {
+		if _, exists := t.Files[stylesheet]; !exists {
+			return fmt.Errorf("stylesheet %s is not part of the theme", stylesheet)
+		}
+	}
+	if t.Layout != "" {
+		if _, err := t.layout(); err != nil {
+			return err
+		}
+		if !strings.Contains(t.Layout, ".Body") {
+			return fmt.Errorf("theme layout does not place the page body (.Body)")
+		}
+	}
+	return nil
+}
+
+// layout parses the layout, or the default one linking the stylesheets
+func (t *Theme) layout() (*template.Template, error) {
+	text := t.Layout
+	if text == "" {
+		text = defaultLayout
+	}
+	layout, err := template.New(LayoutFile).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid theme layout: %v", err)
+	}
+	return layout, nil
+}
+
+// stylesheets returns the stylesheets linked from each page
+func (t *Theme) stylesheets() []string {
+	if len(t.Descriptor.Stylesheets) > 0 {
+		return t.Descriptor.Stylesheets
+	}
+	var stylesheets []string
+	for p := range t.Files {
+		if strings.EqualFold(path.Ext(p), ".css") {
+			stylesheets = append(stylesheets, p)
+		}
+	}
+	sort.Strings(stylesheets)
+	return stylesheets
+}
+
+// Apply adds the theme's assets to the files of a package and wraps its
+// content pages, all HTML under content/ except the static fallback, in the
+// layout. The manifest's resources are updated to match. It returns the
+// pages wrapped.
+func (t *Theme) Apply(files map[string][]byte, manifest *core.Manifest) ([]string, error) {
+	layout, err := t.layout()
+	if err != nil {
+		return nil, err
+	}
+	hasher := integrity.NewResourceHasher(integrity.SHA256)
+	base := ThemePrefix + t.Descriptor.Name + "/"
+
+	for p, data := range t.Files {
+		files[base+p] = data
+		manifest.Resources[base+p] = &core.Resource{
+			Hash: hasher.HashBytes(data),
+			Size: int64(len(data)),
+			Type: themeMimeType(p),
+			Path: base + p,
+		}
+	}
+
+	var pages []string
+	for p := range manifest.Resources {
+		if strings.HasPrefix(p, "content/") && !strings.HasPrefix(p, "content/static/") && isHTML(p) && files[p] != nil {
+			pages = append(pages, p)
+		}
+	}
+	sort.Strings(pages)
+
+	for _, page := range pages {
+		head, body := splitPage(string(files[page]))
+		data := LayoutData{
+			Head: template.HTML(head),
+			Body: template.HTML(body),
+			Base: relativeBase(page) + base,
+		}
+		if metadata := manifest.Metadata; metadata != nil {
+			data.Title, data.Author, data.Language = metadata.Title, metadata.Author, metadata.Language
+		}
+		var styles strings.Builder
+		for _, stylesheet := range t.stylesheets() {
+			fmt.Fprintf(&styles, "<link rel=\"stylesheet\" href=\"%s\">\n", template.HTMLEscapeString(data.Base+stylesheet))
+		}
+		data.Styles = template.HTML(styles.String())
+
+		var out bytes.Buffer
+		if err := layout.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("failed to apply theme to %s: %v", page, err)
+		}
+		files[page] = out.Bytes()
+		resource := manifest.Resources[page]
+		resource.Hash = hasher.HashBytes(out.Bytes())
+		resource.Size = int64(out.Len())
+	}
+	return pages, nil
+}
+
+// splitPage returns the contents of a page's head and body elements. A page
+// without a body element is all body.
+func splitPage(page string) (head, body string) {
+	lower := strings.ToLower(page)
+	head = inner(page, lower, "head")
+	if start := openingTagEnd(lower, "body"); start >= 0 {
+		end := strings.LastIndex(lower, "</body>")
+		if end < start {
+			end = len(page)
+		}
+		return head, strings.TrimSpace(page[start:end])
+	}
+	// Without a body element, what follows the head is the body
+	if end := strings.Index(lower, "</head>"); end >= 0 {
+		page, lower = page[end+len("</head>"):], lower[end+len("</head>"):]
+	}
+	page = strings.TrimSpace(page)
+	if strings.HasPrefix(strings.ToLower(page), "<!doctype") {
+		if end := strings.Index(page, ">"); end >= 0 {
+			page = page[end+1:]
+		}
+	}
+	page = strings.TrimSuffix(strings.TrimSpace(page), "</html>")
+	return head, strings.TrimSpace(page)
+}
+
+// inner returns the contents of the first element named tag
+func inner(page, lower, tag string) string {
+	start := openingTagEnd(lower, tag)
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(lower[start:], "</"+tag+">")
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(page[start : start+end])
+}
+
+// openingTagEnd returns the offset just past the opening tag of the first
+// element named tag, or -1
+func openingTagEnd(lower, tag string) int {
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], "<"+tag)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		next := i + len(tag) + 1
+		// <header> is not <head>
+		if next < len(lower) && (lower[next] == '>' || lower[next] == ' ' || lower[next] == '\t' || lower[next] == '\n' || lower[next] == '\r') {
+			if end := strings.Index(lower[next:], ">"); end >= 0 {
+				return next + end + 1
+			}
+			return -1
+		}
+		offset = next
+	}
+}
+
+// relativeBase returns the path from the directory of a page back to the
+// package root
+func relativeBase(page string) string {
+	return strings.Repeat("../", strings.Count(page, "/"))
+}
+
+func isHTML(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".html" || ext == ".htm"
+}
+
+// themeMimeType returns the MIME type of a theme asset
+func themeMimeType(p string) string {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".css":
+		return "text/css"
+	case ".woff":
+		return "font/woff"
+	case ".woff2":
+		return "font/woff2"
+	case ".ttf":
+		return "font/ttf"
+	case ".otf":
+		return "font/otf"
+	case ".svg":
+		return "image/svg+xml"
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".txt":
+		return "text/plain"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// defaultLayout keeps the page as it is and links the theme's stylesheets
+// before the page's own, so the page's styles win
+const defaultLayout = `<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+{{.Styles}}{{.Head}}
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`
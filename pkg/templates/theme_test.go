@@ -0,0 +1,129 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func writeTheme(t *testing.T, dir, layout string) {
+	t.Helper()
+	os.MkdirAll(filepath.Join(dir, "styles"), 0755)
+	os.MkdirAll(filepath.Join(dir, "fonts"), 0755)
+	os.WriteFile(filepath.Join(dir, ThemeFile), []byte(`{"name": "brand", "version": "2.1.0", "title": "Brand", "stylesheets": ["styles/brand.css"]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "styles", "brand.css"), []byte("@font-face { font-family: Brand; src: url(../fonts/brand.woff2); }"), 0644)
+	os.WriteFile(filepath.Join(dir, "styles", "print.css"), []byte("@page { margin: 2cm; }"), 0644)
+	os.WriteFile(filepath.Join(dir, "fonts", "brand.woff2"), []byte("wOF2"), 0644)
+	os.WriteFile(filepath.Join(dir, ".DS_Store"), []byte("junk"), 0644)
+	if layout != "" {
+		os.WriteFile(filepath.Join(dir, LayoutFile), []byte(layout), 0644)
+	}
+}
+
+func TestThemeApply(t *testing.T) {
+	dir := t.TempDir()
+	writeTheme(t, dir, `<html lang="{{.Language}}"><head>{{.Styles}}{{.Head}}</head><body><nav>{{.Title}}</nav><main>{{.Body}}</main><img src="{{.Base}}logo.png"></body></html>`)
+
+	theme, err := LoadTheme(dir, "")
+	if err != nil {
+		t.Fatalf("LoadTheme failed: %v", err)
+	}
+	if len(theme.Files) != 3 || theme.Files[".DS_Store"] != nil {
+		t.Errorf("Expected the theme's assets without hidden files, got %d files", len(theme.Files))
+	}
+
+	files := map[string][]byte{
+		"content/index.html":           []byte("<!DOCTYPE html>\n<html><head><title>Report</title></head>\n<body class=\"x\"><header>Q3</header><p>Results</p></body></html>"),
+		"content/chapters/one.html":    []byte("<h2>One</h2>"),
+		"content/static/fallback.html": []byte("<p>Static</p>"),
+	}
+	manifest := &core.Manifest{
+		Metadata:  &core.DocumentMetadata{Title: "Q3 <Report>", Language: "de"},
+		Resources: make(map[string]*core.Resource),
+	}
+	for path, data := range files {
+		manifest.Resources[path] = &core.Resource{Path: path, Size: int64(len(data)), Type: "text/html"}
+	}
+
+	pages, err := theme.Apply(files, manifest)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if strings.Join(pages, ",") != "content/chapters/one.html,content/index.html" {
+		t.Errorf("Expected the content pages but not the fallback to be themed, got %v", pages)
+	}
+
+	index := string(files["content/index.html"])
+	for _, expected := range []string{
+		`<html lang="de">`,
+		`<link rel="stylesheet" href="../assets/themes/brand/styles/brand.css">`,
+		"<title>Report</title>",
+		"<nav>Q3 &lt;Report&gt;</nav>",
+		"<main><header>Q3</header><p>Results</p></main>",
+		`src="../assets/themes/brand/logo.png"`,
+	} {
+		if !strings.Contains(index, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, index)
+		}
+	}
+	if strings.Contains(index, "print.css") {
+		t.Errorf("Expected only the listed stylesheets to be linked")
+	}
+	if chapter := string(files["content/chapters/one.html"]); !strings.Contains(chapter, `href="../../assets/themes/brand/styles/brand.css"`) || !strings.Contains(chapter, "<main><h2>One</h2></main>") {
+		t.Errorf("Expected a page without head or body to be wrapped, got:\n%s", chapter)
+	}
+	if string(files["content/static/fallback.html"]) != "<p>Static</p>" {
+		t.Errorf("Expected the static fallback to be left alone")
+	}
+	if resource := manifest.Resources["assets/themes/brand/fonts/brand.woff2"]; resource == nil || resource.Type != "font/woff2" {
+		t.Errorf("Expected the theme's font in the manifest, got %+v", resource)
+	}
+	if resource := manifest.Resources["content/index.html"]; resource.Size != int64(len(index)) || resource.Hash == "" {
+		t.Errorf("Expected the themed page's size and hash in the manifest")
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	for _, name := range Themes() {
+		theme, err := LoadTheme(name, t.TempDir())
+		if err != nil {
+			t.Fatalf("Expected built-in theme %s to load: %v", name, err)
+		}
+		if err := theme.Validate(); err != nil {
+			t.Errorf("Expected built-in theme %s to be valid: %v", name, err)
+		}
+	}
+
+	// A theme in the library takes the place of the built-in one
+	library := t.TempDir()
+	writeTheme(t, filepath.Join(library, "corporate"), "")
+	if theme, err := LoadTheme("corporate", library); err != nil || theme.Descriptor.Name != "brand" {
+		t.Errorf("Expected the library's theme, got %v", err)
+	}
+
+	if _, err := LoadTheme("no-such-theme", library); err == nil {
+		t.Errorf("Expected an unknown theme to be refused")
+	}
+	if _, err := LoadTheme(filepath.Join(library, "missing"), library); err == nil {
+		t.Errorf("Expected a directory without a descriptor to be refused")
+	}
+	dir := t.TempDir()
+	writeTheme(t, dir, "<main>{{.Head}}</main>")
+	if _, err := LoadTheme(dir, ""); err == nil {
+		t.Errorf("Expected a layout without the body to be refused")
+	}
+}
+
+func TestSplitPage(t *testing.T) {
+	head, body := splitPage("<html><head><meta charset=\"utf-8\"></head><body>\n<header><h1>Title</h1></header>\n</body></html>")
+	if head != `<meta charset="utf-8">` || body != "<header><h1>Title</h1></header>" {
+		t.Errorf("Unexpected split %q %q", head, body)
+	}
+	// <header> is not mistaken for <head>
+	if head, body := splitPage("<header>Top</header><p>Text</p>"); head != "" || body != "<header>Top</header><p>Text</p>" {
+		t.Errorf("Unexpected split %q %q", head, body)
+	}
+}
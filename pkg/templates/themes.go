@@ -0,0 +1,196 @@
+package templates
+
+// builtinThemes are the themes available without a theme library, by name.
+// They use the fonts of the reader's system, so they carry no font files.
+var builtinThemes = map[string]func() *Theme{
+	"corporate": func() *Theme {
+		return &Theme{
+			Descriptor: &ThemeDescriptor{
+				Name:        "corporate",
+				Version:     "1.0.0",
+				Title:       "Corporate",
+				Description: "A title band with the author, sans-serif text and a footer",
+				Author:      "LIV Project",
+			},
+			Layout: corporateLayout,
+			Files:  map[string][]byte{"styles/theme.css": []byte(corporateStyles)},
+		}
+	},
+	"academic": func() *Theme {
+		return &Theme{
+			Descriptor: &ThemeDescriptor{
+				Name:        "academic",
+				Version:     "1.0.0",
+				Title:       "Academic",
+				Description: "A narrow serif column with numbered headings, styled for print",
+				Author:      "LIV Project",
+			},
+			Layout: academicLayout,
+			Files:  map[string][]byte{"styles/theme.css": []byte(academicStyles)},
+		}
+	},
+	"minimal": func() *Theme {
+		return &Theme{
+			Descriptor: &ThemeDescriptor{
+				Name:        "minimal",
+				Version:     "1.0.0",
+				Title:       "Minimal",
+				Description: "Readable defaults for type and spacing, leaving the page as it is",
+				Author:      "LIV Project",
+			},
+			Files: map[string][]byte{"styles/theme.css": []byte(minimalStyles)},
+		}
+	},
+}
+
+const corporateLayout = `<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+{{.Styles}}{{.Head}}
+</head>
+<body class="theme-corporate">
+<header class="theme-band">
+    <span class="theme-title">{{.Title}}</span>
+    <span class="theme-author">{{.Author}}</span>
+</header>
+<div class="theme-page">
+{{.Body}}
+</div>
+<footer class="theme-footer">{{.Author}}</footer>
+</body>
+</html>
+`
+
+const corporateStyles = `body.theme-corporate {
+    margin: 0;
+    font-family: "Segoe UI", Helvetica, Arial, sans-serif;
+    line-height: 1.5;
+    color: #1f2933;
+}
+
+.theme-band {
+    display: flex;
+    justify-content: space-between;
+    align-items: baseline;
+    padding: 0.8rem 2rem;
+    background: #12355b;
+    color: #fff;
+}
+
+.theme-title {
+    font-weight: 600;
+}
+
+.theme-author {
+    font-size: 0.9rem;
+    opacity: 0.8;
+}
+
+.theme-page {
+    max-width: 48rem;
+    margin: 0 auto;
+    padding: 2rem 1rem;
+}
+
+.theme-page h1, .theme-page h2, .theme-page h3 {
+    color: #12355b;
+}
+
+.theme-footer {
+    border-top: 1px solid #d9e2ec;
+    padding: 1rem 2rem;
+    font-size: 0.8rem;
+    color: #627d98;
+}
+
+@media print {
+    .theme-band {
+        background: none;
+        color: inherit;
+        border-bottom: 2px solid #12355b;
+    }
+}
+`
+
+const academicLayout = `<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+{{.Styles}}{{.Head}}
+</head>
+<body class="theme-academic">
+<article class="theme-article">
+{{.Body}}
+</article>
+</body>
+</html>
+`
+
+const academicStyles = `body.theme-academic {
+    margin: 0;
+    font-family: "Iowan Old Style", Palatino, Georgia, "Times New Roman", serif;
+    line-height: 1.65;
+    color: #111;
+    background: #fdfdfb;
+}
+
+.theme-article {
+    max-width: 38rem;
+    margin: 0 auto;
+    padding: 3rem 1rem;
+    counter-reset: section;
+    hyphens: auto;
+}
+
+.theme-article h1 {
+    text-align: center;
+    font-weight: normal;
+}
+
+.theme-article h2 {
+    counter-increment: section;
+}
+
+.theme-article h2::before {
+    content: counter(section) ". ";
+}
+
+.theme-article table {
+    border-collapse: collapse;
+    margin: 1rem auto;
+}
+
+.theme-article th, .theme-article td {
+    border-top: 1px solid #999;
+    border-bottom: 1px solid #999;
+    padding: 0.3rem 0.6rem;
+}
+
+@media print {
+    body.theme-academic {
+        background: none;
+    }
+
+    .theme-article {
+        max-width: none;
+        padding: 0;
+    }
+}
+`
+
+const minimalStyles = `body {
+    font-family: system-ui, -apple-system, "Segoe UI", Roboto, sans-serif;
+    line-height: 1.6;
+    max-width: 44rem;
+    margin: 0 auto;
+    padding: 2rem 1rem;
+    color: #222;
+}
+
+img, video, canvas {
+    max-width: 100%;
+}
+
+pre, code {
+    font-family: ui-monospace, Menlo, Consolas, monospace;
+}
+`
@@ -0,0 +1,106 @@
+// Package transfer moves documents over HTTP in verifiable pieces. Servers
+// describe a document with a ChunkManifest listing the SHA-256 of each
+// fixed-size chunk; a Fetcher downloads the document with range requests,
+// checks every chunk as it arrives and resumes interrupted downloads from the
+// last verified chunk.
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Chunk sizes a manifest may use
+const (
+	DefaultChunkSize = 1 << 20
+	MinChunkSize     = 64 << 10
+	MaxChunkSize     = 64 << 20
+)
+
+// ManifestHeader is the response header of a download linking to the chunk
+// manifest of the document
+const ManifestHeader = "X-Chunk-Manifest"
+
+// Chunk is one piece of a document
+type Chunk struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ChunkManifest lists the chunks of a document. The ETag is the entity tag of
+// the download it describes, so clients can tell when it no longer applies.
+type ChunkManifest struct {
+	Size      int64   `json:"size"`
+	SHA256    string  `json:"sha256"`
+	ETag      string  `json:"etag,omitempty"`
+	ChunkSize int64   `json:"chunk_size"`
+	Chunks    []Chunk `json:"chunks"`
+}
+
+// ComputeChunks reads a document and returns its chunk manifest
+func ComputeChunks(r io.Reader, chunkSize int64) (*ChunkManifest, error) {
+	if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("chunk size must be between %d and %d bytes", MinChunkSize, MaxChunkSize)
+	}
+
+	m := &ChunkManifest{ChunkSize: chunkSize, Chunks: []Chunk{}}
+	whole := sha256.New()
+	for {
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(h, whole), io.LimitReader(r, chunkSize))
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		m.Chunks = append(m.Chunks, Chunk{Offset: m.Size, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))})
+		m.Size += n
+		if n < chunkSize {
+			break
+		}
+	}
+	m.SHA256 = hex.EncodeToString(whole.Sum(nil))
+	return m, nil
+}
+
+// Validate checks that the chunks cover the document exactly, in order
+func (m *ChunkManifest) Validate() error {
+	if m.ChunkSize < MinChunkSize || m.ChunkSize > MaxChunkSize {
+		return fmt.Errorf("invalid chunk size %d", m.ChunkSize)
+	}
+	if !isSHA256(m.SHA256) {
+		return errors.New("invalid document hash")
+	}
+	var offset int64
+	for i, chunk := range m.Chunks {
+		last := i == len(m.Chunks)-1
+		switch {
+		case chunk.Offset != offset:
+			return fmt.Errorf("chunk %d starts at %d, expected %d", i, chunk.Offset, offset)
+		case chunk.Size <= 0 || chunk.Size > m.ChunkSize || (!last && chunk.Size != m.ChunkSize):
+			return fmt.Errorf("chunk %d has invalid size %d", i, chunk.Size)
+		case !isSHA256(chunk.SHA256):
+			return fmt.Errorf("chunk %d has an invalid hash", i)
+		}
+		offset += chunk.Size
+	}
+	if offset != m.Size {
+		return fmt.Errorf("chunks cover %d bytes of %d", offset, m.Size)
+	}
+	return nil
+}
+
+// chunkAt returns the index of the chunk containing offset
+func (m *ChunkManifest) chunkAt(offset int64) int {
+	return int(offset / m.ChunkSize)
+}
+
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
@@ -0,0 +1,146 @@
+package transfer
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DescriptorContentType is the media type of publishing descriptors
+const DescriptorContentType = "application/vnd.liv.publication+json"
+
+// maxDescriptorSize caps the publishing descriptors read from servers
+const maxDescriptorSize = 1 << 20
+
+// Descriptor is a publishing descriptor: the versions of a document a
+// publisher has released, each pinned by its hash. Clients fetch a version
+// by name, so the bytes they get cannot change under them.
+type Descriptor struct {
+	Name string `json:"name"`
+	// Latest is the version fetched when none is asked for
+	Latest   string              `json:"latest,omitempty"`
+	Versions []*PublishedVersion `json:"versions"`
+}
+
+// PublishedVersion is one released version of a document
+type PublishedVersion struct {
+	Version string `json:"version"`
+	// URL of the document, relative to the descriptor
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// KeyID, when set, is the fingerprint of the key the first signer of the
+	// version signed with
+	KeyID     string    `json:"key_id,omitempty"`
+	Published time.Time `json:"published"`
+}
+
+// IsDescriptor reports whether a probed URL is a publishing descriptor rather
+// than a document, by its media type or a .json path
+func IsDescriptor(remote *Remote) bool {
+	if remote.ContentType == DescriptorContentType {
+		return true
+	}
+	u, err := url.Parse(remote.URL)
+	return err == nil && path.Ext(u.Path) == ".json"
+}
+
+// Validate checks that the descriptor pins every version it lists
+func (d *Descriptor) Validate() error {
+	if len(d.Versions) == 0 {
+		return fmt.Errorf("no versions published")
+	}
+	seen := make(map[string]bool)
+	for _, v := range d.Versions {
+		switch {
+		case v == nil || v.Version == "":
+			return fmt.Errorf("version without a name")
+		case seen[v.Version]:
+			return fmt.Errorf("version %s is listed twice", v.Version)
+		case v.URL == "":
+			return fmt.Errorf("version %s has no url", v.Version)
+		case v.Size < 0:
+			return fmt.Errorf("version %s has a negative size", v.Version)
+		}
+		if sum, err := hex.DecodeString(v.SHA256); err != nil || len(sum) != 32 {
+			return fmt.Errorf("version %s has an invalid sha256 %q", v.Version, v.SHA256)
+		}
+		seen[v.Version] = true
+	}
+	if d.Latest != "" && !seen[d.Latest] {
+		return fmt.Errorf("latest version %s is not listed", d.Latest)
+	}
+	return nil
+}
+
+// Resolve returns a published version, or the latest version when version is
+// empty. Without a latest version the last one listed is the latest.
+func (d *Descriptor) Resolve(version string) (*PublishedVersion, error) {
+	if version == "" {
+		version = d.Latest
+		if version == "" {
+			return d.Versions[len(d.Versions)-1], nil
+		}
+	}
+	var available []string
+	for _, v := range d.Versions {
+		if v.Version == version {
+			return v, nil
+		}
+		available = append(available, v.Version)
+	}
+	sort.Strings(available)
+	return nil, fmt.Errorf("version %s of %s is not published (available: %s)", version, d.Name, strings.Join(available, ", "))
+}
+
+// FetchDescriptor downloads a publishing descriptor. Version URLs are
+// resolved against the descriptor URL.
+func (f *Fetcher) FetchDescriptor(ctx context.Context, rawURL string) (*Descriptor, error) {
+	resp, err := f.do(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: rawURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var d Descriptor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDescriptorSize)).Decode(&d); err != nil {
+		return nil, fmt.Errorf("invalid publishing descriptor: %v", err)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid publishing descriptor: %v", err)
+	}
+	for _, v := range d.Versions {
+		if v.URL, err = resolveURL(rawURL, v.URL); err != nil {
+			return nil, fmt.Errorf("invalid url of version %s: %v", v.Version, err)
+		}
+	}
+	return &d, nil
+}
+
+// ProbeVersion probes a published version and pins the download to the hash
+// the descriptor lists for it
+func (f *Fetcher) ProbeVersion(ctx context.Context, v *PublishedVersion) (*Remote, error) {
+	remote, err := f.Probe(ctx, v.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case remote.Size >= 0 && remote.Size != v.Size:
+		return nil, fmt.Errorf("version %s is published with %d bytes, but the server has %d", v.Version, v.Size, remote.Size)
+	case remote.Manifest != nil && !strings.EqualFold(remote.Manifest.SHA256, v.SHA256):
+		return nil, fmt.Errorf("version %s is published with sha256 %s, but the server has %s", v.Version, v.SHA256, remote.Manifest.SHA256)
+	}
+	remote.SHA256 = strings.ToLower(v.SHA256)
+	return remote, nil
+}
@@ -0,0 +1,524 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+// maxManifestSize caps the chunk manifests read from servers
+const maxManifestSize = 8 << 20
+
+// ErrChanged is returned when the document on the server changes during a
+// download. Fetching again starts over with the new version.
+var ErrChanged = errors.New("document changed on the server during the download")
+
+// StatusError is an unexpected HTTP response
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.URL, e.Status)
+}
+
+// ChunkError is a downloaded chunk that does not match the manifest
+type ChunkError struct {
+	Index  int
+	Offset int64
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d at offset %d does not match its manifest hash", e.Index, e.Offset)
+}
+
+// Remote describes a document on a server, as announced by a HEAD request
+type Remote struct {
+	URL string
+	// Size is the length of the document, or -1 when unknown
+	Size int64
+	// ETag is the strong entity tag of the document; downloads without one
+	// cannot be resumed
+	ETag string
+	// Filename is the name the server suggests for the document
+	Filename string
+	// Manifest lists the chunk hashes of the document, when the server has one
+	Manifest *ChunkManifest
+	// ContentType is the media type the server gives the document
+	ContentType string
+	// SHA256, when set, pins the hash the document must have, e.g. from a
+	// publishing descriptor
+	SHA256 string
+}
+
+// Result describes a completed download
+type Result struct {
+	Path   string
+	Size   int64
+	SHA256 string
+	// Resumed is the number of bytes kept from an earlier interrupted download
+	Resumed int64
+	// Verified reports whether every chunk was checked against the manifest
+	Verified bool
+}
+
+// Fetcher downloads documents, resuming interrupted downloads. Data is written
+// to <dest>.part next to the destination and only put in place once
+// complete and verified; <dest>.part.json records what the partial file is a
+// download of.
+type Fetcher struct {
+	Client *http.Client
+	// Header is sent with every request, e.g. for authentication
+	Header http.Header
+	// Retries is how many times an interrupted download is resumed
+	Retries int
+	// RetryDelay is the pause before resuming
+	RetryDelay time.Duration
+	// Progress, when set, is called as data is written
+	Progress func(written, total int64)
+	// Verify, when set, checks a complete download before it is moved into
+	// place. Downloads that fail are discarded.
+	Verify func(path string) error
+	// Backup keeps the file a download replaces, with atomicfile.BackupSuffix
+	Backup bool
+}
+
+// NewFetcher creates a fetcher that resumes up to 5 times
+func NewFetcher() *Fetcher {
+	return &Fetcher{Client: &http.Client{}, Retries: 5, RetryDelay: time.Second}
+}
+
+// partState is the record of a partial download
+type partState struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// Probe asks the server about a document and fetches its chunk manifest
+func (f *Fetcher) Probe(ctx context.Context, rawURL string) (*Remote, error) {
+	resp, err := f.do(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: rawURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	remote := &Remote{URL: rawURL, Size: resp.ContentLength, Filename: suggestedFilename(resp)}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		remote.ContentType = mediaType
+	}
+	if etag := resp.Header.Get("ETag"); !strings.HasPrefix(etag, "W/") {
+		remote.ETag = etag
+	}
+	if link := resp.Header.Get(ManifestHeader); link != "" {
+		manifestURL, err := resolveURL(rawURL, link)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk manifest link: %v", err)
+		}
+		if remote.Manifest, err = f.fetchManifest(ctx, manifestURL); err != nil {
+			return nil, err
+		}
+		switch {
+		case remote.Size >= 0 && remote.Manifest.Size != remote.Size:
+			return nil, fmt.Errorf("chunk manifest describes %d bytes, but the document has %d", remote.Manifest.Size, remote.Size)
+		case remote.Manifest.ETag != "" && remote.Manifest.ETag != remote.ETag:
+			return nil, ErrChanged
+		}
+		remote.Size = remote.Manifest.Size
+	}
+	return remote, nil
+}
+
+func (f *Fetcher) fetchManifest(ctx context.Context, manifestURL string) (*ChunkManifest, error) {
+	resp, err := f.do(ctx, http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: manifestURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var m ChunkManifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid chunk manifest: %v", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid chunk manifest: %v", err)
+	}
+	return &m, nil
+}
+
+// Fetch downloads a probed document to dest. A partial download of the same
+// document version left by an earlier call is resumed after its verified
+// chunks; on failure the partial download is kept for the next call.
+func (f *Fetcher) Fetch(ctx context.Context, remote *Remote, dest string) (*Result, error) {
+	partPath := dest + ".part"
+	statePath := partPath + ".json"
+	state := partState{URL: remote.URL, ETag: remote.ETag, Size: remote.Size}
+
+	file, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var offset int64
+	if previous, err := readPartState(statePath); err == nil && remote.ETag != "" && *previous == state {
+		if offset, err = verifiedPrefix(file, remote); err != nil {
+			return nil, err
+		}
+	}
+	if err := file.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if err := writePartState(statePath, state); err != nil {
+		return nil, err
+	}
+	result := &Result{Path: dest, Resumed: offset, Verified: remote.Manifest != nil}
+
+	for attempt := 0; remote.Size < 0 || offset < remote.Size; attempt++ {
+		err := f.download(ctx, remote, file, &offset)
+		if err == nil {
+			break
+		}
+		if attempt >= f.Retries || !retryable(ctx, err) {
+			if errors.Is(err, ErrChanged) {
+				discardPart(partPath, statePath)
+			}
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(f.RetryDelay):
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if result.Size, err = io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	result.SHA256 = hex.EncodeToString(h.Sum(nil))
+	for _, expected := range []string{remote.SHA256, manifestSHA256(remote)} {
+		if expected != "" && !strings.EqualFold(result.SHA256, expected) {
+			discardPart(partPath, statePath)
+			return nil, fmt.Errorf("downloaded document has sha256 %s, expected %s", result.SHA256, expected)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if f.Verify != nil {
+		if err := f.Verify(partPath); err != nil {
+			discardPart(partPath, statePath)
+			return nil, err
+		}
+	}
+	if err := f.install(partPath, dest); err != nil {
+		return nil, err
+	}
+	os.Remove(partPath)
+	os.Remove(statePath)
+	return result, nil
+}
+
+// install puts a complete download in place of dest in one step
+func (f *Fetcher) install(partPath, dest string) error {
+	part, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	out, err := atomicfile.Create(dest, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	out.Backup = f.Backup
+	if _, err := io.Copy(out, part); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// download requests the document from offset on and writes it to file,
+// verifying chunks as they complete. On return offset is the end of the data
+// that can be kept: with a manifest, the end of the last verified chunk.
+func (f *Fetcher) download(ctx context.Context, remote *Remote, file *os.File, offset *int64) error {
+	if *offset > 0 && remote.ETag == "" && remote.Manifest == nil {
+		// Nothing tells whether the rest would be of the same document
+		*offset = 0
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+	}
+	header := make(http.Header)
+	if *offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", *offset))
+		if remote.ETag != "" {
+			header.Set("If-Range", remote.ETag)
+		}
+	}
+	resp, err := f.do(ctx, http.MethodGet, remote.URL, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if etag := resp.Header.Get("ETag"); remote.ETag != "" && etag != remote.ETag {
+		return ErrChanged
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != *offset {
+			return fmt.Errorf("server resumed at %d instead of %d", start, *offset)
+		}
+	case http.StatusOK:
+		// The server ignored the range and sends the whole document
+		*offset = 0
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+	default:
+		return &StatusError{URL: remote.URL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	w := &chunkWriter{
+		file:     file,
+		manifest: remote.Manifest,
+		offset:   *offset,
+		verified: *offset,
+		hash:     sha256.New(),
+		progress: f.Progress,
+		total:    remote.Size,
+	}
+	_, err = io.Copy(w, resp.Body)
+	if err == nil && remote.Size >= 0 && w.offset != remote.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && w.manifest != nil && w.verified != w.offset {
+		err = io.ErrUnexpectedEOF
+	}
+	*offset = w.verified
+	if err != nil {
+		// Drop the unverified tail so the next attempt starts on a chunk boundary
+		if truncErr := file.Truncate(*offset); truncErr != nil {
+			return truncErr
+		}
+	}
+	return err
+}
+
+func (f *Fetcher) do(ctx context.Context, method, rawURL string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range f.Header {
+		req.Header[name] = values
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// chunkWriter writes a download to a file, hashing each chunk of the manifest
+// as it completes. Without a manifest every byte written counts as verified.
+type chunkWriter struct {
+	file     *os.File
+	manifest *ChunkManifest
+	offset   int64
+	verified int64
+	hash     hash.Hash
+	progress func(written, total int64)
+	total    int64
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		var chunk *Chunk
+		if w.manifest != nil {
+			index := w.manifest.chunkAt(w.offset)
+			if index >= len(w.manifest.Chunks) {
+				return written, fmt.Errorf("server sent more than the %d bytes in the chunk manifest", w.manifest.Size)
+			}
+			chunk = &w.manifest.Chunks[index]
+			n = int(min(int64(n), chunk.Offset+chunk.Size-w.offset))
+		}
+		if _, err := w.file.WriteAt(p[:n], w.offset); err != nil {
+			return written, err
+		}
+		w.offset += int64(n)
+		written += n
+
+		if chunk == nil {
+			w.verified = w.offset
+		} else {
+			w.hash.Write(p[:n])
+			if w.offset == chunk.Offset+chunk.Size {
+				if hex.EncodeToString(w.hash.Sum(nil)) != chunk.SHA256 {
+					return written, &ChunkError{Index: w.manifest.chunkAt(chunk.Offset), Offset: chunk.Offset}
+				}
+				w.hash.Reset()
+				w.verified = w.offset
+			}
+		}
+		p = p[n:]
+	}
+	if w.progress != nil {
+		w.progress(w.offset, w.total)
+	}
+	return written, nil
+}
+
+// verifiedPrefix returns the length of the partial download that can be kept:
+// all of it without a manifest, else up to the first chunk that is incomplete
+// or does not match
+func verifiedPrefix(file *os.File, remote *Remote) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if remote.Size >= 0 {
+		size = min(size, remote.Size)
+	}
+	if remote.Manifest == nil {
+		return size, nil
+	}
+
+	var verified int64
+	buf := make([]byte, remote.Manifest.ChunkSize)
+	for _, chunk := range remote.Manifest.Chunks {
+		if chunk.Offset+chunk.Size > size {
+			break
+		}
+		if _, err := file.ReadAt(buf[:chunk.Size], chunk.Offset); err != nil {
+			return 0, err
+		}
+		sum := sha256.Sum256(buf[:chunk.Size])
+		if hex.EncodeToString(sum[:]) != chunk.SHA256 {
+			break
+		}
+		verified = chunk.Offset + chunk.Size
+	}
+	return verified, nil
+}
+
+func manifestSHA256(remote *Remote) string {
+	if remote.Manifest == nil {
+		return ""
+	}
+	return remote.Manifest.SHA256
+}
+
+// retryable reports whether resuming may get past err
+func retryable(ctx context.Context, err error) bool {
+	var statusErr *StatusError
+	switch {
+	case ctx.Err() != nil, errors.Is(err, ErrChanged):
+		return false
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+func contentRangeStart(value string) (int64, error) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
+
+// suggestedFilename returns the base name of the attachment filename of a
+// response, or of the URL path
+func suggestedFilename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := filepath.Base(filepath.Clean("/" + params["filename"])); name != "/" && name != "." {
+			return name
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "/" && name != "." {
+		return name
+	}
+	return ""
+}
+
+func resolveURL(base, ref string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+func readPartState(statePath string) (*partState, error) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, err
+	}
+	var state partState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func writePartState(statePath string, state partState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath, data, 0o644)
+}
+
+func discardPart(partPath, statePath string) {
+	os.Remove(partPath)
+	os.Remove(statePath)
+}
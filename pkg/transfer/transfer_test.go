@@ -0,0 +1,419 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestComputeChunks(t *testing.T) {
+	data := make([]byte, 3*MinChunkSize+100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	m, err := ComputeChunks(bytes.NewReader(data), MinChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != int64(len(data)) || len(m.Chunks) != 4 || m.Chunks[3].Size != 100 {
+		t.Fatalf("Unexpected manifest: size %d, %d chunks", m.Size, len(m.Chunks))
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+
+	m.Chunks[1].Offset++
+	if err := m.Validate(); err == nil {
+		t.Error("Validate accepted a gap between chunks")
+	}
+	m.Chunks[1].Offset--
+	m.Chunks = m.Chunks[:3]
+	if err := m.Validate(); err == nil {
+		t.Error("Validate accepted chunks that do not cover the document")
+	}
+
+	if _, err := ComputeChunks(bytes.NewReader(data), 1024); err == nil {
+		t.Error("ComputeChunks accepted a chunk size below the minimum")
+	}
+	empty, err := ComputeChunks(bytes.NewReader(nil), MinChunkSize)
+	if err != nil || empty.Size != 0 || len(empty.Chunks) != 0 || empty.Validate() != nil {
+		t.Errorf("Unexpected manifest of an empty document: %+v, %v", empty, err)
+	}
+}
+
+// testServer serves a document with a chunk manifest. Responses can be cut
+// short or corrupted to simulate failing connections.
+type testServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	data    []byte
+	etag    string
+	cutAt   int64 // abort the next download after this many bytes
+	corrupt int64 // flip a byte at this offset in the next download
+	ranges  []string
+	// descriptor is served as /publication.json
+	descriptor *Descriptor
+}
+
+func newTestServer(t *testing.T, data []byte, etag string) *testServer {
+	s := &testServer{data: data, etag: etag, cutAt: -1, corrupt: -1}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, etag := s.data, s.etag
+	cutAt, corrupt := s.cutAt, s.corrupt
+	if r.Method == http.MethodGet && r.URL.Path == "/doc.liv" {
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.cutAt, s.corrupt = -1, -1
+	}
+	s.mu.Unlock()
+
+	if r.URL.Path == "/publication.json" {
+		w.Header().Set("Content-Type", DescriptorContentType)
+		json.NewEncoder(w).Encode(s.descriptor)
+		return
+	}
+	if r.URL.Path == "/doc.liv.chunks" {
+		m, _ := ComputeChunks(bytes.NewReader(data), MinChunkSize)
+		m.ETag = etag
+		json.NewEncoder(w).Encode(m)
+		return
+	}
+
+	if corrupt >= 0 {
+		data = append([]byte(nil), data...)
+		data[corrupt] ^= 0xff
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set(ManifestHeader, "doc.liv.chunks")
+	var rw http.ResponseWriter = w
+	if cutAt >= 0 {
+		rw = &cutWriter{ResponseWriter: w, left: cutAt}
+	}
+	http.ServeContent(rw, r, "doc.liv", time.Time{}, bytes.NewReader(data))
+}
+
+// cutWriter aborts the response after writing a number of bytes
+type cutWriter struct {
+	http.ResponseWriter
+	left int64
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.left {
+		w.ResponseWriter.Write(p[:w.left])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.left -= int64(len(p))
+	return w.ResponseWriter.Write(p)
+}
+
+func testDocument(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func fetch(t *testing.T, f *Fetcher, url, dest string) (*Result, error) {
+	remote, err := f.Probe(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	return f.Fetch(context.Background(), remote, dest)
+}
+
+func TestFetchResumesAfterVerifiedChunks(t *testing.T) {
+	data := testDocument(4*MinChunkSize + 1000)
+	server := newTestServer(t, data, `"v1"`)
+	dest := filepath.Join(t.TempDir(), "doc.liv")
+	f := &Fetcher{Client: server.Client()}
+
+	// The connection drops in the middle of the third chunk
+	server.cutAt = 2*MinChunkSize + 500
+	if _, err := fetch(t, f, server.URL+"/doc.liv", dest); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+	if info, err := os.Stat(dest + ".part"); err != nil || info.Size() != 2*MinChunkSize {
+		t.Fatalf("Expected the verified chunks to be kept, got %v, %v", info, err)
+	}
+
+	result, err := fetch(t, f, server.URL+"/doc.liv", dest)
+	if err != nil {
+		t.Fatalf("Resumed download failed: %v", err)
+	}
+	if result.Resumed != 2*MinChunkSize || !result.Verified || result.Size != int64(len(data)) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, data) {
+		t.Error("Downloaded document does not match")
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Error("Expected the partial download to be removed")
+	}
+	if last := server.ranges[len(server.ranges)-1]; last != "bytes=131072-" {
+		t.Errorf("Resumed with Range %q", last)
+	}
+}
+
+func TestFetchRetriesCorruptChunk(t *testing.T) {
+	data := testDocument(3 * MinChunkSize)
+	server := newTestServer(t, data, `"v1"`)
+	dest := filepath.Join(t.TempDir(), "doc.liv")
+
+	server.corrupt = MinChunkSize + 10
+	result, err := fetch(t, &Fetcher{Client: server.Client(), Retries: 1}, server.URL+"/doc.liv", dest)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, data) || result.SHA256 == "" {
+		t.Error("Downloaded document does not match")
+	}
+	// The retry starts at the corrupt chunk
+	if strings.Join(server.ranges, ",") != ",bytes=65536-" {
+		t.Errorf("Unexpected requests %q", server.ranges)
+	}
+
+	server.corrupt = 10
+	os.Remove(dest)
+	_, err = fetch(t, &Fetcher{Client: server.Client()}, server.URL+"/doc.liv", dest)
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) || chunkErr.Index != 0 {
+		t.Errorf("Expected a chunk error, got %v", err)
+	}
+}
+
+func TestFetchRestartsChangedDocument(t *testing.T) {
+	server := newTestServer(t, testDocument(2*MinChunkSize), `"v1"`)
+	dest := filepath.Join(t.TempDir(), "doc.liv")
+	f := &Fetcher{Client: server.Client()}
+
+	server.cutAt = MinChunkSize + 10
+	if _, err := fetch(t, f, server.URL+"/doc.liv", dest); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+
+	// A new version replaces the document before the download is resumed
+	updated := testDocument(2*MinChunkSize + 1)
+	server.data, server.etag = updated, `"v2"`
+	result, err := fetch(t, f, server.URL+"/doc.liv", dest)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if result.Resumed != 0 {
+		t.Errorf("Resumed %d bytes of another version", result.Resumed)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, updated) {
+		t.Error("Downloaded document does not match the new version")
+	}
+}
+
+func TestFetchPublishedVersion(t *testing.T) {
+	data := testDocument(2 * MinChunkSize)
+	server := newTestServer(t, data, `"v2"`)
+	sum := sha256.Sum256(data)
+	server.descriptor = &Descriptor{
+		Name:   "report",
+		Latest: "2.0.0",
+		Versions: []*PublishedVersion{
+			{Version: "1.0.0", URL: "doc.liv", SHA256: strings.Repeat("ab", 32), Size: int64(len(data))},
+			{Version: "2.0.0", URL: "doc.liv", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data))},
+		},
+	}
+	f := &Fetcher{Client: server.Client()}
+	ctx := context.Background()
+
+	remote, err := f.Probe(ctx, server.URL+"/publication.json")
+	if err != nil || !IsDescriptor(remote) {
+		t.Fatalf("Expected a publishing descriptor, got %+v, %v", remote, err)
+	}
+	d, err := f.FetchDescriptor(ctx, remote.URL)
+	if err != nil {
+		t.Fatalf("FetchDescriptor failed: %v", err)
+	}
+	if _, err := d.Resolve("3.0.0"); err == nil {
+		t.Error("Resolved a version that is not published")
+	}
+	latest, err := d.Resolve("")
+	if err != nil || latest.Version != "2.0.0" || latest.URL != server.URL+"/doc.liv" {
+		t.Fatalf("Unexpected latest version %+v, %v", latest, err)
+	}
+
+	// The download is checked by Verify before it is moved into place
+	dest := filepath.Join(t.TempDir(), "doc.liv")
+	if remote, err = f.ProbeVersion(ctx, latest); err != nil {
+		t.Fatalf("ProbeVersion failed: %v", err)
+	}
+	f.Verify = func(path string) error { return errors.New("untrusted signer") }
+	if _, err := f.Fetch(ctx, remote, dest); err == nil || err.Error() != "untrusted signer" {
+		t.Errorf("Expected verification to fail, got %v", err)
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Error("Expected the rejected download to be discarded")
+	}
+	f.Verify = nil
+	if _, err := f.Fetch(ctx, remote, dest); err != nil {
+		t.Fatalf("Download of the pinned version failed: %v", err)
+	}
+
+	// A version pinned to other bytes than the server has is refused
+	pinned, _ := d.Resolve("1.0.0")
+	remote, err = f.Probe(ctx, pinned.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.SHA256 = pinned.SHA256
+	remote.Manifest = nil
+	if _, err := f.Fetch(ctx, remote, filepath.Join(t.TempDir(), "doc.liv")); err == nil {
+		t.Error("Expected the download to fail the pinned hash")
+	}
+	if _, err := f.ProbeVersion(ctx, pinned); err == nil {
+		t.Error("Expected the chunk manifest to contradict the pinned hash")
+	}
+}
+
+// chunkChecksum is the Upload-Checksum header of a chunk
+func chunkChecksum(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// failingReader returns data and then an error, like a dropped connection
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestUploadStoreResumes(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 2*MinChunkSize+10)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	s, err := NewUploadStore(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, err := s.Create("report.liv", int64(len(data)), "alice")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	first := data[:MinChunkSize]
+	if upload, err = s.Append(upload.ID, "alice", 0, bytes.NewReader(first), chunkChecksum(first)); err != nil || upload.Offset != MinChunkSize {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// A chunk cut short, a corrupt chunk, a chunk at the wrong offset and
+	// someone else's chunk are all refused without moving the offset
+	second := data[MinChunkSize : 2*MinChunkSize]
+	if _, err := s.Append(upload.ID, "alice", MinChunkSize, &failingReader{data: second[:100]}, ""); err == nil {
+		t.Error("Expected an interrupted chunk to fail")
+	}
+	corrupt := append([]byte{}, second...)
+	corrupt[5] ^= 0xff
+	if _, err := s.Append(upload.ID, "alice", MinChunkSize, bytes.NewReader(corrupt), chunkChecksum(second)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+	var offsetErr *OffsetError
+	if _, err := s.Append(upload.ID, "alice", 0, bytes.NewReader(second), ""); !errors.As(err, &offsetErr) || offsetErr.Expected != MinChunkSize {
+		t.Errorf("Expected an offset conflict, got %v", err)
+	}
+	if _, err := s.Append(upload.ID, "mallory", MinChunkSize, bytes.NewReader(second), ""); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Expected another owner's upload to be hidden, got %v", err)
+	}
+	if _, err := s.Open(upload.ID, "alice"); err == nil {
+		t.Error("Expected an incomplete upload not to open")
+	}
+
+	// The upload survives a restart
+	s, err = NewUploadStore(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload, err = s.Get(upload.ID, "alice"); err != nil || upload.Offset != MinChunkSize || len(upload.Chunks) != 1 {
+		t.Fatalf("Upload not resumed: %+v, %v", upload, err)
+	}
+	if _, err := s.Append(upload.ID, "alice", MinChunkSize, bytes.NewReader(data[MinChunkSize:]), ""); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if _, err := s.Append(upload.ID, "alice", int64(len(data)), bytes.NewReader([]byte("x")), ""); err == nil {
+		t.Error("Expected bytes past the upload length to be refused")
+	}
+
+	upload, _ = s.Get(upload.ID, "alice")
+	if !upload.Complete() || len(upload.Chunks) != 2 || upload.Chunks[1].Size != MinChunkSize+10 {
+		t.Fatalf("Unexpected upload %+v", upload)
+	}
+	file, err := s.Open(upload.ID, "alice")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	assembled, _ := io.ReadAll(file)
+	file.Close()
+	if !bytes.Equal(assembled, data) {
+		t.Error("Assembled upload differs from the data sent")
+	}
+
+	if err := s.Delete(upload.ID, "alice"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the upload's files to be removed, found %d", len(entries))
+	}
+}
+
+func TestUploadStoreLimits(t *testing.T) {
+	s, err := NewUploadStore(t.TempDir(), 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create("big.liv", 1001, ""); err == nil {
+		t.Error("Expected an upload over the maximum size to be refused")
+	}
+	if _, err := s.Create("empty.liv", 0, ""); err == nil {
+		t.Error("Expected an empty upload to be refused")
+	}
+	upload, err := s.Create("small.liv", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Append(upload.ID, "", 0, strings.NewReader("0123456789"), "md5 abc"); err == nil {
+		t.Error("Expected an unsupported checksum to be refused")
+	}
+	if removed, err := s.PurgeExpired(time.Now().Add(2 * time.Minute)); err != nil || removed != 1 {
+		t.Errorf("Expected the stale upload to be purged, got %d, %v", removed, err)
+	}
+	if _, err := s.Get(upload.ID, ""); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Expected the purged upload to be gone, got %v", err)
+	}
+
+	metadata, err := ParseUploadMetadata("filename " + base64.StdEncoding.EncodeToString([]byte("Q3 report.liv")) + ",is_draft")
+	if err != nil || metadata["filename"] != "Q3 report.liv" || len(metadata) != 2 {
+		t.Errorf("Unexpected metadata %v, %v", metadata, err)
+	}
+}
@@ -0,0 +1,394 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+// Headers and status codes of resumable uploads, which follow the tus 1.0
+// protocol with its creation, checksum, termination and expiration extensions
+const (
+	ResumableHeader        = "Tus-Resumable"
+	ResumableVersion       = "1.0.0"
+	UploadOffsetHeader     = "Upload-Offset"
+	UploadLengthHeader     = "Upload-Length"
+	UploadMetadataHeader   = "Upload-Metadata"
+	UploadChecksumHeader   = "Upload-Checksum"
+	UploadExpiresHeader    = "Upload-Expires"
+	UploadContentType      = "application/offset+octet-stream"
+	StatusChecksumMismatch = 460
+)
+
+// DefaultUploadTTL is how long an unfinished upload is kept after its last
+// chunk
+const DefaultUploadTTL = 24 * time.Hour
+
+// ErrUploadNotFound is returned for uploads that do not exist, have expired
+// or belong to someone else
+var ErrUploadNotFound = errors.New("upload not found")
+
+// ErrUploadBusy is returned when a chunk is sent while another chunk of the
+// same upload is still being received
+var ErrUploadBusy = errors.New("another chunk of the upload is in progress")
+
+// ErrChecksumMismatch is returned for a chunk that does not match the
+// checksum sent with it. The chunk is discarded.
+var ErrChecksumMismatch = errors.New("chunk does not match its checksum")
+
+// OffsetError is a chunk sent for another offset than the one the upload
+// has reached
+type OffsetError struct {
+	Offset   int64
+	Expected int64
+}
+
+func (e *OffsetError) Error() string {
+	return fmt.Sprintf("chunk starts at offset %d but the upload is at offset %d", e.Offset, e.Expected)
+}
+
+// Upload is a resumable upload. Chunks lists the SHA-256 of each chunk
+// received, so a client can check what the server holds.
+type Upload struct {
+	ID       string    `json:"id"`
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size"`
+	Offset   int64     `json:"offset"`
+	Owner    string    `json:"owner,omitempty"`
+	Chunks   []Chunk   `json:"chunks"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Complete reports whether every byte of the upload has been received
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Size
+}
+
+var uploadID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// UploadStore keeps the data of resumable uploads in a directory until they
+// complete or expire. Each upload is an <id>.part file of the bytes received
+// so far next to an <id>.json description, so uploads resume after a
+// restart. It is safe for concurrent use.
+type UploadStore struct {
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	uploads map[string]*Upload
+	busy    map[string]bool
+}
+
+// NewUploadStore opens the uploads kept in dir, discarding expired ones and
+// any bytes received after the last complete chunk. Uploads may be up to
+// maxSize bytes, or any size when it is zero, and expire ttl after their last
+// chunk, DefaultUploadTTL when it is zero.
+func NewUploadStore(dir string, maxSize int64, ttl time.Duration) (*UploadStore, error) {
+	if ttl <= 0 {
+		ttl = DefaultUploadTTL
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %v", err)
+	}
+	s := &UploadStore{dir: dir, maxSize: maxSize, ttl: ttl, uploads: make(map[string]*Upload), busy: make(map[string]bool)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload directory: %v", err)
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		id, isMetadata := strings.CutSuffix(entry.Name(), ".json")
+		if !isMetadata || !uploadID.MatchString(id) {
+			continue
+		}
+		var upload Upload
+		data, err := os.ReadFile(s.metadataPath(id))
+		if err != nil || json.Unmarshal(data, &upload) != nil || upload.ID != id || now.After(upload.Expires) ||
+			os.Truncate(s.dataPath(id), upload.Offset) != nil {
+			s.remove(id)
+			continue
+		}
+		s.uploads[id] = &upload
+	}
+	return s, nil
+}
+
+// Create starts an upload of size bytes for owner, who alone may send its
+// chunks
+func (s *UploadStore) Create(filename string, size int64, owner string) (*Upload, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("upload length must be positive")
+	}
+	if s.maxSize > 0 && size > s.maxSize {
+		return nil, fmt.Errorf("document exceeds maximum size of %d bytes", s.maxSize)
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate upload ID: %v", err)
+	}
+
+	now := time.Now().UTC()
+	upload := &Upload{
+		ID:       hex.EncodeToString(buf),
+		Filename: filepath.Base(filename),
+		Size:     size,
+		Owner:    owner,
+		Chunks:   []Chunk{},
+		Created:  now,
+		Expires:  now.Add(s.ttl),
+	}
+	file, err := os.OpenFile(s.dataPath(upload.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %v", err)
+	}
+	file.Close()
+	if err := s.save(upload); err != nil {
+		os.Remove(s.dataPath(upload.ID))
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.uploads[upload.ID] = upload
+	s.mu.Unlock()
+	return copyUpload(upload), nil
+}
+
+// Get returns an upload of owner
+func (s *UploadStore) Get(id, owner string) (*Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, err := s.lookup(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	return copyUpload(upload), nil
+}
+
+// Append receives the chunk of an upload starting at offset from r. A
+// checksum, when given as "sha256 <base64 digest>", must match the chunk.
+// Chunks are kept only once received whole: a chunk cut short or failing
+// its checksum is discarded, and the client resends it.
+func (s *UploadStore) Append(id, owner string, offset int64, r io.Reader, checksum string) (*Upload, error) {
+	var expected []byte
+	if checksum != "" {
+		var err error
+		if expected, err = ParseChecksum(checksum); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	upload, err := s.lookup(id, owner)
+	switch {
+	case err != nil:
+	case s.busy[id]:
+		err = ErrUploadBusy
+	case offset != upload.Offset:
+		err = &OffsetError{Offset: offset, Expected: upload.Offset}
+	default:
+		s.busy[id] = true
+		upload = copyUpload(upload)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.busy, id)
+		s.mu.Unlock()
+	}()
+
+	file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+
+	// Read one byte past the end to notice chunks longer than the upload
+	remaining := upload.Size - offset
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, h), io.LimitReader(r, min(remaining, MaxChunkSize)+1))
+	discard := func(cause error) (*Upload, error) {
+		if err := file.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("failed to discard chunk: %v", err)
+		}
+		return nil, cause
+	}
+	switch {
+	case err != nil:
+		return discard(fmt.Errorf("chunk interrupted after %d bytes: %w", n, err))
+	case n > remaining:
+		return discard(fmt.Errorf("chunk runs past the upload length of %d bytes", upload.Size))
+	case n > MaxChunkSize:
+		return discard(fmt.Errorf("chunk exceeds the maximum of %d bytes", MaxChunkSize))
+	case expected != nil && !bytes.Equal(h.Sum(nil), expected):
+		return discard(ErrChecksumMismatch)
+	case n == 0:
+		return upload, nil
+	}
+	if err := file.Sync(); err != nil {
+		return discard(fmt.Errorf("failed to write chunk: %v", err))
+	}
+
+	upload.Chunks = append(upload.Chunks, Chunk{Offset: offset, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))})
+	upload.Offset += n
+	upload.Expires = time.Now().UTC().Add(s.ttl)
+	if err := s.save(upload); err != nil {
+		return discard(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.uploads[id]; !exists {
+		// Deleted while the chunk was arriving
+		s.remove(id)
+		return nil, ErrUploadNotFound
+	}
+	s.uploads[id] = upload
+	return copyUpload(upload), nil
+}
+
+// Open opens the data of a complete upload of owner
+func (s *UploadStore) Open(id, owner string) (*os.File, error) {
+	upload, err := s.Get(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.Complete() {
+		return nil, fmt.Errorf("upload is incomplete: %d of %d bytes received", upload.Offset, upload.Size)
+	}
+	file, err := os.Open(s.dataPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	return file, nil
+}
+
+// Delete removes an upload of owner and its data
+func (s *UploadStore) Delete(id, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.lookup(id, owner); err != nil {
+		return err
+	}
+	delete(s.uploads, id)
+	return s.remove(id)
+}
+
+// PurgeExpired removes uploads not continued in time and returns how many
+// were removed
+func (s *UploadStore) PurgeExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for id, upload := range s.uploads {
+		if s.busy[id] || !now.After(upload.Expires) {
+			continue
+		}
+		delete(s.uploads, id)
+		if err := s.remove(id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// lookup returns the upload of owner; the caller holds the lock
+func (s *UploadStore) lookup(id, owner string) (*Upload, error) {
+	upload, exists := s.uploads[id]
+	if !exists || upload.Owner != owner || time.Now().After(upload.Expires) {
+		return nil, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// save writes the description of an upload
+func (s *UploadStore) save(upload *Upload) error {
+	data, err := json.MarshalIndent(upload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode upload: %v", err)
+	}
+	if err := atomicfile.WriteFile(s.metadataPath(upload.ID), data, 0600); err != nil {
+		return fmt.Errorf("failed to write upload: %v", err)
+	}
+	return nil
+}
+
+// remove deletes the files of an upload
+func (s *UploadStore) remove(id string) error {
+	for _, path := range []string{s.dataPath(id), s.metadataPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove upload: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *UploadStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+func (s *UploadStore) metadataPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func copyUpload(upload *Upload) *Upload {
+	c := *upload
+	c.Chunks = append([]Chunk{}, upload.Chunks...)
+	return &c
+}
+
+// ParseChecksum reads an Upload-Checksum header, "sha256 <base64 digest>",
+// and returns the digest
+func ParseChecksum(header string) ([]byte, error) {
+	algorithm, encoded, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported checksum %q: expected sha256 <base64 digest>", header)
+	}
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("invalid sha256 checksum %q", encoded)
+	}
+	return digest, nil
+}
+
+// ParseUploadMetadata reads an Upload-Metadata header: comma-separated keys,
+// each followed by a space and its base64 value, if any
+func ParseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload metadata %q: %v", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,233 @@
+// Package tsa obtains and verifies RFC 3161 timestamp tokens. A token from a
+// timestamping authority (TSA) proves that data, such as the signatures of a
+// document, existed at the time in the token, so the signatures can be trusted
+// after the signing certificate has expired.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/unidoc/pkcs7"
+	"github.com/unidoc/timestamp"
+)
+
+// Media types of timestamp requests and replies over HTTP (RFC 3161 section 3.4)
+const (
+	QueryContentType = "application/timestamp-query"
+	ReplyContentType = "application/timestamp-reply"
+)
+
+// DefaultTimeout bounds a request to a TSA
+const DefaultTimeout = 30 * time.Second
+
+// maxReplySize caps the replies read from a TSA
+const maxReplySize = 1 << 20
+
+// Token is a verified timestamp token
+type Token struct {
+	// Time is when the TSA timestamped the data, give or take Accuracy
+	Time         time.Time
+	Accuracy     time.Duration
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+	// Authority is the certificate the TSA signed the token with
+	Authority *x509.Certificate
+	// Trusted reports whether Authority chains to the roots the token was
+	// verified with. Without them anyone can make a timestamping certificate,
+	// so Time is only what the token claims.
+	Trusted bool
+
+	nonce *big.Int
+}
+
+// Client requests timestamp tokens from a TSA over HTTP
+type Client struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client for the TSA at url
+func NewClient(url string) *Client {
+	return &Client{URL: url, HTTPClient: &http.Client{Timeout: DefaultTimeout}}
+}
+
+// Timestamp asks the TSA to timestamp data and returns the DER-encoded token.
+// The token is verified to cover data and to answer this request.
+func (c *Client) Timestamp(ctx context.Context, data []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	query, err := (&timestamp.Request{
+		HashAlgorithm: crypto.SHA256,
+		HashedMessage: digest[:],
+		Certificates:  true,
+		Nonce:         nonce,
+	}).Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create timestamp request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", QueryContentType)
+	req.Header.Set("Accept", ReplyContentType)
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach timestamping authority: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamping authority returned %s", resp.Status)
+	}
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, maxReplySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timestamp reply: %v", err)
+	}
+
+	token, err := ParseReply(reply)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := Verify(token, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if verified.nonce == nil || verified.nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp does not answer the request: nonce mismatch")
+	}
+	return token, nil
+}
+
+// pkiStatusInfo and reply are the TimeStampResp of RFC 3161 section 2.4.2
+type pkiStatusInfo struct {
+	Status       int
+	StatusString asn1.RawValue  `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type reply struct {
+	Status pkiStatusInfo
+	Token  asn1.RawValue `asn1:"optional"`
+}
+
+// statusNames describe the statuses of refused requests
+var statusNames = map[int]string{
+	2: "rejected",
+	3: "waiting",
+	4: "revocation warning",
+	5: "revocation notification",
+}
+
+// ParseReply returns the token of a DER-encoded timestamp reply, or why the
+// TSA refused the request
+func ParseReply(data []byte) ([]byte, error) {
+	var r reply
+	rest, err := asn1.Unmarshal(data, &r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp reply: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("invalid timestamp reply: trailing data")
+	}
+	// 0 is granted and 1 granted with modifications
+	if r.Status.Status > 1 {
+		name := statusNames[r.Status.Status]
+		if name == "" {
+			name = fmt.Sprintf("status %d", r.Status.Status)
+		}
+		return nil, fmt.Errorf("timestamping authority refused the request: %s", name)
+	}
+	if len(r.Token.FullBytes) == 0 {
+		return nil, errors.New("timestamp reply has no token")
+	}
+	return r.Token.FullBytes, nil
+}
+
+// Verify checks that token is a timestamp of data signed by a TSA and returns
+// it. The token must include the TSA certificate, which must be for
+// timestamping. With roots, the certificate must also chain to one of them at
+// the time of the timestamp, so tokens stay valid after it expires, and the
+// token is Trusted.
+func Verify(token, data []byte, roots *x509.CertPool) (*Token, error) {
+	ts, err := timestamp.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %v", err)
+	}
+	if !ts.AddTSACertificate {
+		return nil, errors.New("timestamp token does not include the certificate of the timestamping authority")
+	}
+	if !ts.HashAlgorithm.Available() {
+		return nil, fmt.Errorf("timestamp uses an unsupported hash algorithm")
+	}
+	h := ts.HashAlgorithm.New()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), ts.HashedMessage) {
+		return nil, errors.New("timestamp does not cover this data")
+	}
+
+	p7, err := pkcs7.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %v", err)
+	}
+	authority := p7.GetOnlySigner()
+	if authority == nil {
+		return nil, errors.New("timestamp token must have exactly one signer")
+	}
+	if !forTimestamping(authority) {
+		return nil, fmt.Errorf("certificate of %s is not for timestamping", authority.Subject)
+	}
+	if roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range p7.Certificates {
+			intermediates.AddCert(cert)
+		}
+		_, err := authority.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+			CurrentTime:   ts.Time,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("timestamping authority %s is not trusted: %v", authority.Subject, err)
+		}
+	}
+
+	return &Token{
+		Time:         ts.Time,
+		Accuracy:     ts.Accuracy,
+		SerialNumber: ts.SerialNumber,
+		Policy:       ts.Policy,
+		Authority:    authority,
+		Trusted:      roots != nil,
+		nonce:        ts.Nonce,
+	}, nil
+}
+
+func forTimestamping(cert *x509.Certificate) bool {
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageTimeStamping {
+			return true
+		}
+	}
+	return false
+}
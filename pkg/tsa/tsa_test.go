@@ -0,0 +1,85 @@
+package tsa_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/tsa"
+	"github.com/liv-format/liv/pkg/tsa/tsatest"
+	"github.com/unidoc/timestamp"
+)
+
+func TestTimestamp(t *testing.T) {
+	server, err := tsatest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	signedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(signedAt)
+	data := []byte("signatures")
+	token, err := server.Client().Timestamp(context.Background(), data)
+	if err != nil {
+		t.Fatalf("Timestamp failed: %v", err)
+	}
+
+	verified, err := tsa.Verify(token, data, server.Roots())
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !verified.Time.Equal(signedAt) {
+		t.Errorf("Time = %s, want %s", verified.Time, signedAt)
+	}
+	if !verified.Policy.Equal(tsatest.Policy) {
+		t.Errorf("Policy = %s, want %s", verified.Policy, tsatest.Policy)
+	}
+	if !verified.Authority.Equal(server.Certificate) {
+		t.Errorf("Authority = %s, want the test authority", verified.Authority.Subject)
+	}
+	if !verified.Trusted {
+		t.Error("Trusted = false for an authority chaining to the roots")
+	}
+	if unchecked, err := tsa.Verify(token, data, nil); err != nil || unchecked.Trusted {
+		t.Errorf("Verify without roots: err = %v, want an untrusted token", err)
+	}
+
+	if _, err := tsa.Verify(token, []byte("other signatures"), nil); err == nil || !strings.Contains(err.Error(), "does not cover") {
+		t.Errorf("Verify of other data: err = %v, want a mismatch", err)
+	}
+	if _, err := tsa.Verify(token, data, x509.NewCertPool()); err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("Verify with other roots: err = %v, want an untrusted authority", err)
+	}
+	corrupt := append([]byte(nil), token...)
+	corrupt[len(corrupt)-10] ^= 0xff
+	if _, err := tsa.Verify(corrupt, data, nil); err == nil {
+		t.Error("Verify of a corrupt token succeeded")
+	}
+}
+
+func TestTimestampRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply, err := timestamp.CreateErrorResponse(2, timestamp.BadAlgorithm)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", tsa.ReplyContentType)
+		w.Write(reply)
+	}))
+	defer server.Close()
+
+	_, err := tsa.NewClient(server.URL).Timestamp(context.Background(), []byte("signatures"))
+	if err == nil || !strings.Contains(err.Error(), "refused the request: rejected") {
+		t.Errorf("err = %v, want a rejected request", err)
+	}
+
+	server.Config.Handler = http.NotFoundHandler()
+	if _, err := tsa.NewClient(server.URL).Timestamp(context.Background(), []byte("signatures")); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want the HTTP status", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package tsatest provides an RFC 3161 timestamping authority for tests.
+package tsatest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/tsa"
+	"github.com/unidoc/timestamp"
+)
+
+// Policy is the TSA policy of the tokens the server issues
+var Policy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+// Server is a timestamping authority listening on a local HTTP server. Its
+// certificate is issued by a test root.
+type Server struct {
+	*httptest.Server
+	// Root is the certificate of the root the authority chains to
+	Root *x509.Certificate
+	// Certificate is the certificate the authority signs tokens with
+	Certificate *x509.Certificate
+
+	key *ecdsa.PrivateKey
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewServer starts a timestamping authority. Call Close when done.
+func NewServer() (*Server, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().AddDate(-10, 0, 0)
+	notAfter := time.Now().AddDate(10, 0, 0)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Timestamping Root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Timestamping Authority"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return start(root, cert, key), nil
+}
+
+// NewSelfSignedServer starts a timestamping authority whose certificate is
+// its own root, as anyone can make one. Call Close when done.
+func NewSelfSignedServer() (*Server, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Self-Signed Timestamping Authority"},
+		NotBefore:    time.Now().AddDate(-10, 0, 0),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return start(cert, cert, key), nil
+}
+
+func start(root, cert *x509.Certificate, key *ecdsa.PrivateKey) *Server {
+	s := &Server{Root: root, Certificate: cert, key: key, now: time.Now}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Roots returns a pool holding the root of the authority
+func (s *Server) Roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Root)
+	return roots
+}
+
+// Client returns a client for the authority
+func (s *Server) Client() *tsa.Client {
+	return tsa.NewClient(s.URL)
+}
+
+// SetTime makes the authority timestamp data at t instead of the current time
+func (s *Server) SetTime(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = func() time.Time { return t }
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != tsa.QueryContentType {
+		http.Error(w, "expected a timestamp query", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, err := timestamp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	s.mu.Unlock()
+
+	reply, err := (&timestamp.Timestamp{
+		HashAlgorithm:     req.HashAlgorithm,
+		HashedMessage:     req.HashedMessage,
+		Time:              now.UTC().Truncate(time.Second),
+		Nonce:             req.Nonce,
+		Policy:            Policy,
+		AddTSACertificate: req.Certificates,
+	}).CreateResponse(s.Certificate, s.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", tsa.ReplyContentType)
+	w.Write(reply)
+}
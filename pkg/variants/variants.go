@@ -0,0 +1,330 @@
+// Package variants picks and generates responsive variants of document
+// assets: images at several widths or pixel densities, and data at a low and
+// a high resolution, so viewers on small screens and slow connections load
+// less.
+package variants
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/core"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// QualityLow and QualityHigh describe data variants
+	QualityLow  = "low"
+	QualityHigh = "high"
+
+	// MaxPixels bounds the size of images decoded to generate variants
+	MaxPixels = 40 << 20
+)
+
+// DefaultWidths are the widths images are scaled down to, where they are
+// wider
+var DefaultWidths = []int{480, 960, 1440, 1920}
+
+// Variant names, relative to the resource they are a variant of:
+// photo@2x.png, photo-960w.png and chart.low.json
+var (
+	densityName = regexp.MustCompile(`^(.+)@(\d+(?:\.\d+)?)x(\.[^.]+)$`)
+	widthName   = regexp.MustCompile(`^(.+)-(\d+)w(\.[^.]+)$`)
+	qualityName = regexp.MustCompile(`^(.+)\.(low|high)(\.[^.]+)$`)
+)
+
+// Profile describes the device and connection a document is shown on
+type Profile struct {
+	// DPR is the device pixel ratio
+	DPR float64
+	// ViewportWidth is the viewport width in CSS pixels
+	ViewportWidth int
+	// Network is the effective connection type, slow-2g, 2g, 3g or 4g, or
+	// empty when the browser does not report it
+	Network string
+	// SaveData is set when the reader asked for reduced data usage
+	SaveData bool
+	// Accept is the browser's Accept header, naming the image formats it
+	// displays. It is not part of the encoded profile.
+	Accept string
+}
+
+// ParseProfile parses a profile written by Profile.String
+func ParseProfile(s string) (Profile, error) {
+	var profile Profile
+	if s == "" {
+		return profile, nil
+	}
+	for _, token := range strings.Split(s, "_") {
+		switch {
+		case token == "save":
+			profile.SaveData = true
+		case token == "slow-2g" || token == "2g" || token == "3g" || token == "4g":
+			profile.Network = token
+		case strings.HasSuffix(token, "x"):
+			dpr, err := strconv.ParseFloat(strings.TrimSuffix(token, "x"), 64)
+			if err != nil || dpr <= 0 || dpr > 8 {
+				return Profile{}, fmt.Errorf("invalid device pixel ratio %q", token)
+			}
+			profile.DPR = dpr
+		case strings.HasSuffix(token, "w"):
+			width, err := strconv.Atoi(strings.TrimSuffix(token, "w"))
+			if err != nil || width <= 0 {
+				return Profile{}, fmt.Errorf("invalid viewport width %q", token)
+			}
+			profile.ViewportWidth = width
+		default:
+			return Profile{}, fmt.Errorf("unknown profile token %q", token)
+		}
+	}
+	return profile, nil
+}
+
+// String encodes the profile for a URL path segment, as in 2x_1280w_4g
+func (p Profile) String() string {
+	var tokens []string
+	if p.DPR > 0 {
+		tokens = append(tokens, strconv.FormatFloat(p.DPR, 'f', -1, 64)+"x")
+	}
+	if p.ViewportWidth > 0 {
+		tokens = append(tokens, strconv.Itoa(p.ViewportWidth)+"w")
+	}
+	if p.Network != "" {
+		tokens = append(tokens, p.Network)
+	}
+	if p.SaveData {
+		tokens = append(tokens, "save")
+	}
+	return strings.Join(tokens, "_")
+}
+
+// constrained reports whether the reader should get the smallest usable
+// variants
+func (p Profile) constrained() bool {
+	return p.SaveData || p.Network == "slow-2g" || p.Network == "2g"
+}
+
+// Select returns the path of the rendition of resource to load for profile:
+// the narrowest image at least as wide as the viewport in device pixels, the
+// lowest density at least the device's, and low resolution data on slow
+// connections. High resolution data is only chosen on fast connections, and
+// the resource itself whenever nothing fits better, or its rendition in a
+// format the browser accepts.
+func Select(resource *core.Resource, profile Profile) string {
+	chosen := selectSize(resource, profile)
+	if chosen != resource.Path {
+		return chosen
+	}
+	for _, variant := range resource.Variants {
+		if variant.Type != "" && profile.accepts(variant.Type) {
+			return variant.Path
+		}
+	}
+	return chosen
+}
+
+// accepts reports whether the Accept header names a media type. Wildcards
+// do not count, since browsers send image/* whatever they can display.
+func (p Profile) accepts(mediaType string) bool {
+	for _, accepted := range strings.Split(p.Accept, ",") {
+		name, params, _ := strings.Cut(accepted, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), mediaType) {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if key, value, ok := strings.Cut(param, "="); ok && strings.TrimSpace(key) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// selectSize picks among the width, density and quality variants
+func selectSize(resource *core.Resource, profile Profile) string {
+	var widths, densities []*core.ResourceVariant
+	qualities := make(map[string]string)
+	for _, variant := range resource.Variants {
+		switch {
+		case variant.Width > 0:
+			widths = append(widths, variant)
+		case variant.Density > 0:
+			densities = append(densities, variant)
+		case variant.Quality != "":
+			qualities[variant.Quality] = variant.Path
+		}
+	}
+
+	// Slow connections make do with images for standard displays
+	dpr := profile.DPR
+	if dpr <= 0 || profile.constrained() {
+		dpr = 1
+	}
+
+	if len(widths) > 0 {
+		if profile.ViewportWidth <= 0 {
+			return resource.Path
+		}
+		target := int(math.Ceil(float64(profile.ViewportWidth) * dpr))
+		var chosen *core.ResourceVariant
+		for _, variant := range widths {
+			if variant.Width >= target && (chosen == nil || variant.Width < chosen.Width) {
+				chosen = variant
+			}
+		}
+		if chosen == nil {
+			return resource.Path
+		}
+		return chosen.Path
+	}
+
+	if len(densities) > 0 {
+		// The resource itself is the standard density rendition
+		chosen, chosenDensity := resource.Path, 1.0
+		best, bestDensity := resource.Path, 1.0
+		for _, variant := range densities {
+			if variant.Density > bestDensity {
+				best, bestDensity = variant.Path, variant.Density
+			}
+			if variant.Density >= dpr && (chosenDensity < dpr || variant.Density < chosenDensity) {
+				chosen, chosenDensity = variant.Path, variant.Density
+			}
+		}
+		if chosenDensity < dpr {
+			return best
+		}
+		return chosen
+	}
+
+	switch {
+	case profile.constrained() || profile.Network == "3g":
+		if low, ok := qualities[QualityLow]; ok {
+			return low
+		}
+	case profile.Network == "4g":
+		if high, ok := qualities[QualityHigh]; ok {
+			return high
+		}
+	}
+	return resource.Path
+}
+
+// Discover finds the variants among a package's resource paths by their
+// names, keyed by the path of the resource they are a variant of. Names
+// without their resource are not variants.
+func Discover(paths []string) map[string][]*core.ResourceVariant {
+	exists := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		exists[p] = true
+	}
+
+	found := make(map[string][]*core.ResourceVariant)
+	for _, p := range paths {
+		base, variant, ok := parseName(p)
+		if !ok || !exists[base] {
+			continue
+		}
+		found[base] = append(found[base], variant)
+	}
+	for _, list := range found {
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	}
+	return found
+}
+
+// IsVariant reports whether a path is named like a variant
+func IsVariant(p string) bool {
+	_, _, ok := parseName(p)
+	return ok
+}
+
+// parseName returns the resource a variant name belongs to
+func parseName(p string) (string, *core.ResourceVariant, bool) {
+	dir, name := path.Split(p)
+	if m := densityName.FindStringSubmatch(name); m != nil {
+		density, err := strconv.ParseFloat(m[2], 64)
+		if err != nil || density <= 0 {
+			return "", nil, false
+		}
+		return dir + m[1] + m[3], &core.ResourceVariant{Path: p, Density: density}, true
+	}
+	if m := widthName.FindStringSubmatch(name); m != nil {
+		width, err := strconv.Atoi(m[2])
+		if err != nil || width <= 0 {
+			return "", nil, false
+		}
+		return dir + m[1] + m[3], &core.ResourceVariant{Path: p, Width: width}, true
+	}
+	if m := qualityName.FindStringSubmatch(name); m != nil {
+		return dir + m[1] + m[3], &core.ResourceVariant{Path: p, Quality: m[2]}, true
+	}
+	return "", nil, false
+}
+
+// WidthPath returns the path of the variant of an image at width
+func WidthPath(p string, width int) string {
+	ext := path.Ext(p)
+	return fmt.Sprintf("%s-%dw%s", strings.TrimSuffix(p, ext), width, ext)
+}
+
+// Rendition is an image scaled down to Width
+type Rendition struct {
+	Width int
+	Data  []byte
+}
+
+// Generate scales a PNG or JPEG image down to each of widths narrower than
+// it, keeping its aspect ratio and format
+func Generate(data []byte, widths []int) ([]*Rendition, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %v", err)
+	}
+	if format != "png" && format != "jpeg" {
+		return nil, fmt.Errorf("unsupported image format: %s", format)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("image is too large: %dx%d", config.Width, config.Height)
+	}
+
+	var img image.Image
+	var renditions []*Rendition
+	for _, width := range widths {
+		if width <= 0 || width >= config.Width {
+			continue
+		}
+		if img == nil {
+			if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+				return nil, fmt.Errorf("failed to decode image: %v", err)
+			}
+		}
+
+		height := max(1, int(math.Round(float64(config.Height)*float64(width)/float64(config.Width))))
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+		var buf bytes.Buffer
+		if format == "png" {
+			err = png.Encode(&buf, scaled)
+		} else {
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode image variant: %v", err)
+		}
+		renditions = append(renditions, &Rendition{Width: width, Data: buf.Bytes()})
+	}
+	return renditions, nil
+}
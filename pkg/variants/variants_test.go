@@ -0,0 +1,124 @@
+package variants
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func TestParseProfile(t *testing.T) {
+	profile := Profile{DPR: 1.5, ViewportWidth: 1280, Network: "slow-2g", SaveData: true}
+	if profile.String() != "1.5x_1280w_slow-2g_save" {
+		t.Errorf("Unexpected encoding: %s", profile.String())
+	}
+	parsed, err := ParseProfile(profile.String())
+	if err != nil || parsed != profile {
+		t.Errorf("Expected %+v, got %+v: %v", profile, parsed, err)
+	}
+	for _, invalid := range []string{"0x", "-3w", "5g", "2x_huge"} {
+		if _, err := ParseProfile(invalid); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	found := Discover([]string{
+		"assets/images/photo.png", "assets/images/photo-960w.png", "assets/images/photo-480w.png",
+		"assets/images/logo.png", "assets/images/logo@2x.png",
+		"assets/data/sales.json", "assets/data/sales.low.json",
+		"assets/images/orphan@2x.png", "content/index.html",
+	})
+	if len(found) != 3 {
+		t.Fatalf("Expected variants of three resources, got %v", found)
+	}
+	if photo := found["assets/images/photo.png"]; len(photo) != 2 || photo[0].Width != 480 || photo[1].Width != 960 {
+		t.Errorf("Unexpected photo variants: %+v %+v", photo[0], photo[1])
+	}
+	if logo := found["assets/images/logo.png"]; len(logo) != 1 || logo[0].Density != 2 {
+		t.Errorf("Unexpected logo variants: %+v", logo)
+	}
+	if sales := found["assets/data/sales.json"]; len(sales) != 1 || sales[0].Quality != QualityLow {
+		t.Errorf("Unexpected data variants: %+v", sales)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	photo := &core.Resource{Path: "photo.png", Variants: []*core.ResourceVariant{
+		{Path: "photo-480w.png", Width: 480}, {Path: "photo-960w.png", Width: 960}, {Path: "photo-1920w.png", Width: 1920},
+	}}
+	logo := &core.Resource{Path: "logo.png", Variants: []*core.ResourceVariant{
+		{Path: "logo@2x.png", Density: 2}, {Path: "logo@3x.png", Density: 3},
+	}}
+	sales := &core.Resource{Path: "sales.json", Variants: []*core.ResourceVariant{
+		{Path: "sales.low.json", Quality: QualityLow}, {Path: "sales.high.json", Quality: QualityHigh},
+	}}
+	chart := &core.Resource{Path: "chart.png", Variants: []*core.ResourceVariant{
+		{Path: "chart-480w.png", Width: 480}, {Path: "chart.png.webp", Type: "image/webp"},
+	}}
+
+	tests := []struct {
+		resource *core.Resource
+		profile  Profile
+		want     string
+	}{
+		{photo, Profile{DPR: 1, ViewportWidth: 400}, "photo-480w.png"},
+		{photo, Profile{DPR: 2, ViewportWidth: 400}, "photo-960w.png"},
+		{photo, Profile{DPR: 2, ViewportWidth: 400, Network: "2g"}, "photo-480w.png"},
+		{photo, Profile{DPR: 2, ViewportWidth: 1440}, "photo.png"},
+		{photo, Profile{}, "photo.png"},
+		{logo, Profile{DPR: 1}, "logo.png"},
+		{logo, Profile{DPR: 1.5}, "logo@2x.png"},
+		{logo, Profile{DPR: 4}, "logo@3x.png"},
+		{logo, Profile{DPR: 3, SaveData: true}, "logo.png"},
+		{sales, Profile{Network: "3g"}, "sales.low.json"},
+		{sales, Profile{Network: "4g"}, "sales.high.json"},
+		{sales, Profile{Network: "4g", SaveData: true}, "sales.low.json"},
+		{sales, Profile{}, "sales.json"},
+		{chart, Profile{Accept: "image/avif,image/webp,*/*;q=0.8"}, "chart.png.webp"},
+		{chart, Profile{Accept: "image/webp;q=0, image/png"}, "chart.png"},
+		{chart, Profile{Accept: "image/*"}, "chart.png"},
+		{chart, Profile{ViewportWidth: 400, Accept: "image/webp"}, "chart-480w.png"},
+	}
+	for _, test := range tests {
+		if got := Select(test.resource, test.profile); got != test.want {
+			t.Errorf("Select(%s, %+v) = %s, want %s", test.resource.Path, test.profile, got, test.want)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for x := 0; x < 1000; x++ {
+		for y := 0; y < 500; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	renditions, err := Generate(buf.Bytes(), DefaultWidths)
+	if err != nil {
+		t.Fatalf("Failed to generate variants: %v", err)
+	}
+	if len(renditions) != 2 || renditions[0].Width != 480 || renditions[1].Width != 960 {
+		t.Fatalf("Expected 480 and 960 pixel variants, got %d", len(renditions))
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(renditions[0].Data))
+	if err != nil || format != "png" || config.Width != 480 || config.Height != 240 {
+		t.Errorf("Expected a 480x240 PNG, got %s %dx%d: %v", format, config.Width, config.Height, err)
+	}
+	if WidthPath("assets/images/photo.png", 480) != "assets/images/photo-480w.png" {
+		t.Errorf("Unexpected variant path: %s", WidthPath("assets/images/photo.png", 480))
+	}
+
+	if _, err := Generate([]byte("<svg/>"), DefaultWidths); err == nil {
+		t.Error("Expected unsupported images to be refused")
+	}
+}
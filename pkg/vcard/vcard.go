@@ -0,0 +1,58 @@
+// Package vcard exports the authors of a document as vCard (RFC 6350)
+// contact cards, so readers can keep the contact details and ORCID iDs of
+// the people behind a paper.
+package vcard
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/liv-format/liv/internal/contentline"
+	"github.com/liv-format/liv/pkg/core"
+)
+
+// ContentType is the media type of vCard files
+const ContentType = "text/vcard; charset=utf-8"
+
+// productID identifies the application that made a card
+const productID = "-//LIV//LIV Document Viewer//EN"
+
+// Encode writes a vCard 4.0 card for each author. Authors with an ORCID iD
+// are identified by it, so contact applications merge cards from different
+// documents by the same author.
+func Encode(authors []*core.AuthorInfo) ([]byte, error) {
+	if len(authors) == 0 {
+		return nil, fmt.Errorf("no authors to export")
+	}
+
+	var w contentline.Writer
+	for _, author := range authors {
+		if strings.TrimSpace(author.Name) == "" {
+			return nil, fmt.Errorf("author has no name")
+		}
+		w.Line("BEGIN:VCARD")
+		w.Line("VERSION:4.0")
+		w.Line("PRODID:" + productID)
+		w.Line("KIND:individual")
+		w.Line("FN:" + contentline.EscapeText(author.Name))
+		if orcid := author.ORCIDURL(); orcid != "" {
+			w.Line("UID:" + orcid)
+			w.Line("URL;TYPE=orcid:" + orcid)
+		}
+		if author.Affiliation != "" {
+			// The affiliation is a single organization name component
+			w.Line("ORG:" + contentline.EscapeText(author.Affiliation))
+		}
+		if author.Email != "" {
+			w.Line("EMAIL;TYPE=work:" + contentline.EscapeText(author.Email))
+		}
+		if author.URL != "" {
+			w.Line("URL:" + contentline.URI(author.URL))
+		}
+		if author.Role != "" {
+			w.Line("ROLE:" + contentline.EscapeText(author.Role))
+		}
+		w.Line("END:VCARD")
+	}
+	return w.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package vcard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/liv-format/liv/internal/contentline"
+	"github.com/liv-format/liv/pkg/core"
+)
+
+func TestEncode(t *testing.T) {
+	data, err := Encode([]*core.AuthorInfo{
+		{Name: "Josiah Carberry", Affiliation: "Brown University, Providence", Email: "josiah@example.edu",
+			ORCID: "0000-0002-1825-0097", URL: "https://example.edu/~josiah", Role: "editor"},
+		{Name: "Ada Author"},
+	})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	cards := string(data)
+	if strings.Count(cards, "BEGIN:VCARD\r\nVERSION:4.0\r\n") != 2 || !strings.HasSuffix(cards, "END:VCARD\r\n") {
+		t.Errorf("Expected two vCard 4.0 cards:\n%s", cards)
+	}
+	for _, line := range []string{
+		"FN:Josiah Carberry",
+		"UID:https://orcid.org/0000-0002-1825-0097",
+		"URL;TYPE=orcid:https://orcid.org/0000-0002-1825-0097",
+		`ORG:Brown University\, Providence`,
+		"EMAIL;TYPE=work:josiah@example.edu",
+		"URL:https://example.edu/~josiah",
+		"ROLE:editor",
+		"FN:Ada Author",
+	} {
+		if !strings.Contains(cards, "\r\n"+line+"\r\n") {
+			t.Errorf("Expected line %q in:\n%s", line, cards)
+		}
+	}
+	if strings.Count(cards, "UID:") != 1 {
+		t.Errorf("Expected only the author with an ORCID iD to have a UID:\n%s", cards)
+	}
+
+	long, err := Encode([]*core.AuthorInfo{{Name: strings.Repeat("ü", 60)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(long), "\r\n"), "\r\n") {
+		if len(line) > contentline.MaxLineOctets {
+			t.Errorf("Line of %d octets: %q", len(line), line)
+		}
+	}
+
+	if _, err := Encode(nil); err == nil {
+		t.Error("Expected no authors to be refused")
+	}
+	if _, err := Encode([]*core.AuthorInfo{{Name: " "}}); err == nil {
+		t.Error("Expected an author without a name to be refused")
+	}
+}
@@ -0,0 +1,202 @@
+package verification
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+// Suite is the conformance test vector suite for implementations of the
+// descriptor format
+type Suite struct {
+	Format  string    `json:"format"`
+	Vectors []*Vector `json:"vectors"`
+}
+
+// Vector is a package with a descriptor and whether an implementation must
+// accept it. Files are base64 encoded; the descriptor is stored under Entry
+// as the given JSON.
+type Vector struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Files       map[string][]byte `json:"files"`
+	Descriptor  json.RawMessage   `json:"descriptor"`
+	// RootHash is the root hash of the files, as an implementation should
+	// compute it
+	RootHash string `json:"root_hash"`
+	Valid    bool   `json:"valid"`
+}
+
+// vectorKey returns a fixed Ed25519 key, so the vectors are the same on
+// every run
+func vectorKey(name string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("liv verification conformance key " + name))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// Vectors returns the conformance suite. It is deterministic.
+func Vectors() (*Suite, error) {
+	signer, other := vectorKey("signer"), vectorKey("other")
+	document := func() map[string][]byte {
+		return map[string][]byte{
+			"manifest.json":         []byte(`{"metadata":{"title":"Conformance"}}`),
+			"content/index.html":    []byte("<!DOCTYPE html>\n<p>Hello, world</p>\n"),
+			"assets/images/dot.png": {0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0xff},
+		}
+	}
+	signed := func(files map[string][]byte) (*Descriptor, error) {
+		d := Describe(files)
+		return d, d.Sign(signer)
+	}
+
+	suite := &Suite{Format: Format}
+	add := func(name, description string, files map[string][]byte, d interface{}, valid bool) error {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("failed to serialize vector %s: %v", name, err)
+		}
+		hashes := make(map[string]string, len(files))
+		for path, content := range files {
+			hashes[path] = hashHex(content)
+		}
+		suite.Vectors = append(suite.Vectors, &Vector{
+			Name:        name,
+			Description: description,
+			Files:       files,
+			Descriptor:  data,
+			RootHash:    RootHash(hashes),
+			Valid:       valid,
+		})
+		return nil
+	}
+
+	files := document()
+	if err := add("unsigned", "A descriptor without signatures matching the files", files, Describe(files), true); err != nil {
+		return nil, err
+	}
+
+	d, err := signed(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := add("signed", "A descriptor matching the files with an Ed25519 signature of the root hash", files, d, true); err != nil {
+		return nil, err
+	}
+
+	ordered := map[string][]byte{
+		"a.txt":   []byte("dot\n"),
+		"a/b.txt": []byte("slash\n"),
+		"B.txt":   []byte("upper case\n"),
+		"é.txt":   []byte("non-ASCII\n"),
+		"empty":   {},
+	}
+	if d, err = signed(ordered); err != nil {
+		return nil, err
+	}
+	if err := add("path-order", "Paths sort by their UTF-8 bytes, so B.txt precedes a.txt and a.txt precedes a/b.txt; empty files are listed", ordered, d, true); err != nil {
+		return nil, err
+	}
+
+	if d, err = signed(document()); err != nil {
+		return nil, err
+	}
+	modified := document()
+	modified["content/index.html"] = []byte("<!DOCTYPE html>\n<p>Goodbye, world</p>\n")
+	if err := add("modified-file", "A file differs from its listed hash", modified, d, false); err != nil {
+		return nil, err
+	}
+
+	missing := document()
+	delete(missing, "assets/images/dot.png")
+	if err := add("missing-file", "A listed file is not in the package", missing, d, false); err != nil {
+		return nil, err
+	}
+
+	unlisted := document()
+	unlisted["content/extra.js"] = []byte("alert(1)\n")
+	if err := add("unlisted-file", "The package holds a file the descriptor does not list", unlisted, d, false); err != nil {
+		return nil, err
+	}
+
+	// The listed hash is updated to the modified file but the root hash and
+	// its signature are not
+	stale, err := signed(document())
+	if err != nil {
+		return nil, err
+	}
+	stale.Files["content/index.html"] = hashHex(modified["content/index.html"])
+	if err := add("stale-root-hash", "The listed hashes match the files but not the root hash", modified, stale, false); err != nil {
+		return nil, err
+	}
+
+	// The root hash is updated too, keeping the signature of the original
+	resigned := Describe(modified)
+	resigned.Signatures = d.Signatures
+	if err := add("signature-mismatch", "The signature is of a different root hash", modified, resigned, false); err != nil {
+		return nil, err
+	}
+
+	if d, err = signed(document()); err != nil {
+		return nil, err
+	}
+	wrongKey := Describe(document())
+	if err := wrongKey.Sign(other); err != nil {
+		return nil, err
+	}
+	wrongKey.Signatures[0].PublicKey = d.Signatures[0].PublicKey
+	wrongKey.Signatures[0].KeyID = d.Signatures[0].KeyID
+	if err := add("wrong-key", "The signature was made with a key other than the listed public key", document(), wrongKey, false); err != nil {
+		return nil, err
+	}
+
+	keyID := Describe(document())
+	if err := keyID.Sign(signer); err != nil {
+		return nil, err
+	}
+	keyID.Signatures[0].KeyID = integrity.NewSignatureManager().KeyID(other.Public())
+	if err := add("key-id-mismatch", "The key ID is not the fingerprint of the listed public key", document(), keyID, false); err != nil {
+		return nil, err
+	}
+
+	algorithm := Describe(document())
+	if err := algorithm.Sign(signer); err != nil {
+		return nil, err
+	}
+	algorithm.Signatures[0].Algorithm = "ECDSA-P256-SHA256"
+	if err := add("algorithm-mismatch", "The algorithm is not that of the listed public key", document(), algorithm, false); err != nil {
+		return nil, err
+	}
+
+	unknown := Describe(document())
+	unknown.Format = "liv-verification/99"
+	if err := add("unknown-format", "Descriptors of an unknown format are refused", document(), unknown, false); err != nil {
+		return nil, err
+	}
+
+	return suite, nil
+}
+
+// Check runs the vector, returning an error when the outcome is not the
+// expected one
+func (v *Vector) Check() error {
+	files := make(map[string][]byte, len(v.Files)+1)
+	for path, data := range v.Files {
+		files[path] = data
+	}
+	files[Entry] = v.Descriptor
+
+	_, problems, err := Verify(files)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if valid := len(problems) == 0; valid != v.Valid {
+		if v.Valid {
+			return fmt.Errorf("%s: expected the descriptor to be accepted: %v", v.Name, problems)
+		}
+		return fmt.Errorf("%s: expected the descriptor to be refused", v.Name)
+	}
+	return nil
+}
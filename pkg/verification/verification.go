@@ -0,0 +1,284 @@
+// Package verification writes and checks the verification descriptor stored
+// in LIV packages: a small JSON file at a fixed path listing the SHA-256 hash
+// of every other file in the package, a root hash over that list and
+// signatures of the root hash. It only needs SHA-256, base64 and the
+// signature algorithm to check, so tools in any language can verify a
+// document without the Go codebase; Vectors gives a conformance suite for
+// such implementations.
+//
+// The root hash is the SHA-256 of one line per file, sorted by the bytes of
+// the path, each the lowercase hex hash, two spaces, the path and a newline:
+// the output of sha256sum. A signature is made over SignedPrefix followed
+// by the root hash in hex, using the signature algorithms of package
+// integrity: RSA PKCS #1 v1.5 and ECDSA P-256 (ASN.1) sign the SHA-256 of
+// the message, Ed25519 signs the message itself. The key ID is the first 16
+// hex characters of the SHA-256 of the DER SubjectPublicKeyInfo of the key.
+package verification
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/liv-format/liv/pkg/integrity"
+)
+
+const (
+	// Entry is the package path of the descriptor
+	Entry = "verification.json"
+	// Format is the descriptor version written
+	Format = "liv-verification/1"
+	// HashAlgorithm is the hash of files and of the root
+	HashAlgorithm = "sha256"
+	// SignedPrefix is prepended to the root hash to form the signed message
+	SignedPrefix = "LIV-VERIFICATION-V1\n"
+)
+
+// Descriptor describes how to verify the files of a package
+type Descriptor struct {
+	Format        string `json:"format"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	// Files are the hex hashes of the package files by path, other than
+	// the descriptor itself
+	Files      map[string]string `json:"files"`
+	RootHash   string            `json:"root_hash"`
+	Signatures []*Signature      `json:"signatures,omitempty"`
+}
+
+// Signature is a signature of the root hash
+type Signature struct {
+	// Algorithm is an integrity.SignatureAlgorithm name
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	// PublicKey is the base64 DER SubjectPublicKeyInfo of the signing key
+	PublicKey string `json:"public_key"`
+	Value     string `json:"value"`
+}
+
+// Describe returns an unsigned descriptor of files
+func Describe(files map[string][]byte) *Descriptor {
+	hashes := make(map[string]string, len(files))
+	for path, data := range files {
+		if path == Entry {
+			continue
+		}
+		hashes[path] = hashHex(data)
+	}
+	return &Descriptor{
+		Format:        Format,
+		HashAlgorithm: HashAlgorithm,
+		Files:         hashes,
+		RootHash:      RootHash(hashes),
+	}
+}
+
+// Refresh brings the descriptor stored in files, if there is one, up to date
+// with the files, for tools that rewrite packages. Its signatures are kept
+// while the root hash is unchanged and dropped once it changes, since they
+// no longer sign the package; packages without a descriptor are left as
+// they are.
+func Refresh(files map[string][]byte) error {
+	data, exists := files[Entry]
+	if !exists {
+		return nil
+	}
+	fresh := Describe(files)
+	if d, err := Parse(data); err == nil && d.RootHash == fresh.RootHash && RootHash(d.Files) == d.RootHash {
+		return nil
+	}
+	data, err := Marshal(fresh)
+	if err != nil {
+		return err
+	}
+	files[Entry] = data
+	return nil
+}
+
+// RootHash returns the root hash of file hashes by path
+func RootHash(hashes map[string]string) string {
+	paths := make([]string, 0, len(hashes))
+	for path := range hashes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var list strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&list, "%s  %s\n", hashes[path], path)
+	}
+	return hashHex([]byte(list.String()))
+}
+
+// SignedMessage returns the message signatures of a root hash are made over
+func SignedMessage(rootHash string) []byte {
+	return []byte(SignedPrefix + rootHash)
+}
+
+// Sign adds a signature of the root hash made with privateKey
+func (d *Descriptor) Sign(privateKey crypto.Signer) error {
+	sm := integrity.NewSignatureManager()
+	algorithm, err := integrity.AlgorithmForKey(privateKey.Public())
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %v", err)
+	}
+	value, err := sm.SignData(SignedMessage(d.RootHash), privateKey)
+	if err != nil {
+		return err
+	}
+	d.Signatures = append(d.Signatures, &Signature{
+		Algorithm: string(algorithm),
+		KeyID:     sm.KeyID(privateKey.Public()),
+		PublicKey: base64.StdEncoding.EncodeToString(der),
+		Value:     value,
+	})
+	return nil
+}
+
+// Check returns the problems found comparing the descriptor with the files
+// of a package: files that are missing, modified or not listed, and a root
+// hash that does not match the listed hashes. It is empty when the
+// descriptor matches.
+func (d *Descriptor) Check(files map[string][]byte) []string {
+	var problems []string
+	if root := RootHash(d.Files); root != d.RootHash {
+		problems = append(problems, fmt.Sprintf("root hash %s does not match the listed files (%s)", d.RootHash, root))
+	}
+	for _, path := range sortedPaths(d.Files) {
+		data, exists := files[path]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("%s is missing", path))
+		} else if hash := hashHex(data); hash != d.Files[path] {
+			problems = append(problems, fmt.Sprintf("%s was modified: expected %s, got %s", path, d.Files[path], hash))
+		}
+	}
+	for _, path := range sortedPaths(files) {
+		if _, listed := d.Files[path]; !listed && path != Entry {
+			problems = append(problems, fmt.Sprintf("%s is not listed", path))
+		}
+	}
+	return problems
+}
+
+// Key returns the public key of the signature, checking that its key ID
+// and algorithm match it
+func (s *Signature) Key() (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(s.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %v", err)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	if keyID := integrity.NewSignatureManager().KeyID(publicKey); keyID != s.KeyID {
+		return nil, fmt.Errorf("key ID %s does not match the public key (%s)", s.KeyID, keyID)
+	}
+	algorithm, err := integrity.AlgorithmForKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if string(algorithm) != s.Algorithm {
+		return nil, fmt.Errorf("algorithm %s does not match the %s public key", s.Algorithm, algorithm)
+	}
+	return publicKey, nil
+}
+
+// Verify checks that the signature is a valid signature of rootHash by its
+// public key. Whether that key is trusted is up to the caller, by its key
+// ID.
+func (s *Signature) Verify(rootHash string) error {
+	publicKey, err := s.Key()
+	if err != nil {
+		return err
+	}
+	valid, err := integrity.NewSignatureManager().VerifySignature(SignedMessage(rootHash), s.Value, publicKey)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("signature by %s does not match the root hash", s.KeyID)
+	}
+	return nil
+}
+
+// Verify reads the descriptor stored in files and returns it with the
+// problems found checking it against the files and verifying its
+// signatures. It returns an error when there is no readable descriptor.
+func Verify(files map[string][]byte) (*Descriptor, []string, error) {
+	data, exists := files[Entry]
+	if !exists {
+		return nil, nil, fmt.Errorf("%s not found in document", Entry)
+	}
+	d, err := Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	problems := d.Check(files)
+	for _, signature := range d.Signatures {
+		if err := signature.Verify(d.RootHash); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return d, problems, nil
+}
+
+// Marshal encodes a descriptor as stored in packages
+func Marshal(d *Descriptor) ([]byte, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize verification descriptor: %v", err)
+	}
+	return data, nil
+}
+
+// Parse decodes a descriptor, refusing formats and hash algorithms it does
+// not know
+func Parse(data []byte) (*Descriptor, error) {
+	var d Descriptor
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("invalid verification descriptor: %v", err)
+	}
+	if d.Format != Format {
+		return nil, fmt.Errorf("unsupported verification descriptor format %q", d.Format)
+	}
+	if d.HashAlgorithm != HashAlgorithm {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", d.HashAlgorithm)
+	}
+	if d.Files == nil {
+		d.Files = make(map[string]string)
+	}
+	return &d, nil
+}
+
+// hashHex returns the lowercase hex SHA-256 of data
+func hashHex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// sortedPaths returns the keys of m in order
+func sortedPaths(m interface{}) []string {
+	var paths []string
+	switch m := m.(type) {
+	case map[string]string:
+		for path := range m {
+			paths = append(paths, path)
+		}
+	case map[string][]byte:
+		for path := range m {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,118 @@
+package verification
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestRootHash(t *testing.T) {
+	hashes := map[string]string{"b.txt": hashHex([]byte("b")), "a.txt": hashHex([]byte("a"))}
+	list := hashes["a.txt"] + "  a.txt\n" + hashes["b.txt"] + "  b.txt\n"
+	expected := sha256.Sum256([]byte(list))
+	if root := RootHash(hashes); root != hex.EncodeToString(expected[:]) {
+		t.Errorf("Expected the root hash of the sha256sum listing, got %s", root)
+	}
+}
+
+func TestDescribeAndVerify(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	files := map[string][]byte{
+		"manifest.json":      []byte(`{}`),
+		"content/index.html": []byte("<p>Report</p>"),
+	}
+	d := Describe(files)
+	if err := d.Sign(privateKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if d.Signatures[0].Algorithm != "ECDSA-P256-SHA256" || len(d.Signatures[0].KeyID) != 16 {
+		t.Errorf("Unexpected signature %+v", d.Signatures[0])
+	}
+	data, err := Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	files[Entry] = data
+
+	if _, problems, err := Verify(files); err != nil || len(problems) != 0 {
+		t.Fatalf("Expected the descriptor to verify: %v %v", err, problems)
+	}
+
+	files["content/index.html"] = []byte("<p>Forged</p>")
+	files["content/extra.js"] = []byte("alert(1)")
+	_, problems, err := Verify(files)
+	if err != nil || len(problems) != 2 {
+		t.Errorf("Expected the modified and the unlisted file to be reported: %v %v", err, problems)
+	}
+
+	delete(files, Entry)
+	if _, _, err := Verify(files); err == nil {
+		t.Errorf("Expected an error for a package without a descriptor")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	files := map[string][]byte{"manifest.json": []byte(`{}`)}
+	if err := Refresh(files); err != nil || files[Entry] != nil {
+		t.Fatalf("Expected a package without a descriptor to be left alone: %v", err)
+	}
+
+	d := Describe(files)
+	if err := d.Sign(privateKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if files[Entry], err = Marshal(d); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	signed := files[Entry]
+	if err := Refresh(files); err != nil || !bytes.Equal(files[Entry], signed) {
+		t.Errorf("Expected the descriptor of an unchanged package to be kept: %v", err)
+	}
+
+	files["manifest.json"] = []byte(`{"metadata": {}}`)
+	if err := Refresh(files); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	refreshed, problems, err := Verify(files)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("Expected the refreshed descriptor to verify: %v %v", err, problems)
+	}
+	if len(refreshed.Signatures) != 0 {
+		t.Errorf("Expected the signatures of the old root hash to be dropped")
+	}
+}
+
+func TestVectors(t *testing.T) {
+	suite, err := Vectors()
+	if err != nil {
+		t.Fatalf("Vectors failed: %v", err)
+	}
+	for _, vector := range suite.Vectors {
+		if err := vector.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Published vectors must not change from run to run
+	again, err := Vectors()
+	if err != nil {
+		t.Fatalf("Vectors failed: %v", err)
+	}
+	first, _ := json.Marshal(suite)
+	second, _ := json.Marshal(again)
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected the vectors to be deterministic")
+	}
+}
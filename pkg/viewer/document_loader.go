@@ -202,11 +202,9 @@ func (dl *DocumentLoader) LoadDocumentFromFile(ctx context.Context, filePath str
 // ValidateDocument validates a loaded document
 func (dl *DocumentLoader) ValidateDocument(document *core.LIVDocument) (*core.ValidationResult, error) {
 	if dl.validator == nil {
-		return &core.ValidationResult{
-			IsValid:  true,
-			Errors:   []string{},
-			Warnings: []string{"validation skipped: no validator configured"},
-		}, nil
+		result := core.NewValidationResult()
+		result.AddWarning("validation.skipped", "", "validation skipped: no validator configured")
+		return result, nil
 	}
 
 	return dl.validator.ValidateDocument(document), nil
@@ -51,77 +51,45 @@ func NewDocumentValidator(logger core.Logger) *DocumentValidator {
 
 // ValidateDocument performs comprehensive document validation
 func (dv *DocumentValidator) ValidateDocument(doc *core.LIVDocument) *core.ValidationResult {
-	result := &core.ValidationResult{
-		IsValid:  true,
-		Errors:   []string{},
-		Warnings: []string{},
-	}
+	result := core.NewValidationResult()
 
 	if doc == nil {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "document is nil")
+		result.AddError("document.missing", "", "document is nil")
 		return result
 	}
 
 	// Validate manifest
-	if manifestResult := dv.ValidateManifest(doc.Manifest); manifestResult != nil {
-		result.Errors = append(result.Errors, manifestResult.Errors...)
-		result.Warnings = append(result.Warnings, manifestResult.Warnings...)
-		if !manifestResult.IsValid {
-			result.IsValid = false
-		}
-	}
+	result.Merge(dv.ValidateManifest(doc.Manifest))
 
 	// Validate content
 	if dv.config.ValidateContent {
-		if contentResult := dv.ValidateContent(doc.Content); contentResult != nil {
-			result.Errors = append(result.Errors, contentResult.Errors...)
-			result.Warnings = append(result.Warnings, contentResult.Warnings...)
-			if !contentResult.IsValid {
-				result.IsValid = false
-			}
-		}
+		result.Merge(dv.ValidateContent(doc.Content))
 	}
 
 	// Validate assets
 	if dv.config.ValidateAssets {
-		if assetResult := dv.ValidateAssets(doc.Assets); assetResult != nil {
-			result.Errors = append(result.Errors, assetResult.Errors...)
-			result.Warnings = append(result.Warnings, assetResult.Warnings...)
-			if !assetResult.IsValid {
-				result.IsValid = false
-			}
-		}
+		result.Merge(dv.ValidateAssets(doc.Assets))
 	}
 
 	// Validate signatures
 	if dv.config.ValidateSignatures {
-		if sigResult := dv.ValidateSignatures(doc); sigResult != nil {
-			result.Errors = append(result.Errors, sigResult.Errors...)
-			result.Warnings = append(result.Warnings, sigResult.Warnings...)
-			if !sigResult.IsValid {
-				result.IsValid = false
-			}
-		}
+		result.Merge(dv.ValidateSignatures(doc))
 	}
 
-	// Validate WASM modules
+	// Validate WASM modules; their errors only make the document invalid in
+	// strict mode
 	if dv.config.ValidateWASM && doc.WASMModules != nil {
 		wasmErrors, wasmWarnings := dv.validateWASMModules(doc.WASMModules)
-		result.Errors = append(result.Errors, wasmErrors...)
-		result.Warnings = append(result.Warnings, wasmWarnings...)
-		if len(wasmErrors) > 0 && dv.config.StrictMode {
-			result.IsValid = false
+		valid := result.IsValid
+		addFindings(result, "wasm.module", "", wasmErrors, wasmWarnings)
+		if !dv.config.StrictMode {
+			result.IsValid = valid
 		}
 	}
 
 	// Validate resource consistency
 	resourceErrors, resourceWarnings := dv.validateResourceConsistency(doc)
-	result.Errors = append(result.Errors, resourceErrors...)
-	result.Warnings = append(result.Warnings, resourceWarnings...)
-	if len(resourceErrors) > 0 {
-		result.IsValid = false
-	}
+	addFindings(result, "resource.missing", "", resourceErrors, resourceWarnings)
 
 	dv.logger.Debug("document validation completed",
 		"valid", result.IsValid,
@@ -134,63 +102,42 @@ func (dv *DocumentValidator) ValidateDocument(doc *core.LIVDocument) *core.Valid
 
 // ValidateManifest validates manifest structure and content
 func (dv *DocumentValidator) ValidateManifest(manifest *core.Manifest) *core.ValidationResult {
-	result := &core.ValidationResult{
-		IsValid:  true,
-		Errors:   []string{},
-		Warnings: []string{},
-	}
+	result := core.NewValidationResult()
 
 	if manifest == nil {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "manifest is nil")
+		result.AddError("manifest.missing", "", "manifest is nil")
 		return result
 	}
 
 	// Validate version
 	if manifest.Version == "" {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "manifest version is required")
+		result.AddError("manifest.required", "/version", "manifest version is required")
 	} else if manifest.Version != "1.0" {
-		result.Warnings = append(result.Warnings, fmt.Sprintf("manifest version '%s' may not be fully supported", manifest.Version))
+		result.AddWarning("manifest.version", "/version", fmt.Sprintf("manifest version '%s' may not be fully supported", manifest.Version))
 	}
 
 	// Validate metadata
 	if manifest.Metadata == nil {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "manifest metadata is required")
+		result.AddError("manifest.required", "/metadata", "manifest metadata is required")
 	} else {
 		metadataErrors, metadataWarnings := dv.validateMetadata(manifest.Metadata)
-		result.Errors = append(result.Errors, metadataErrors...)
-		result.Warnings = append(result.Warnings, metadataWarnings...)
-		if len(metadataErrors) > 0 {
-			result.IsValid = false
-		}
+		addFindings(result, "metadata.invalid", "/metadata", metadataErrors, metadataWarnings)
 	}
 
 	// Validate security policy
 	if manifest.Security == nil {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "security policy is required")
+		result.AddError("manifest.required", "/security", "security policy is required")
 	} else {
 		securityErrors, securityWarnings := dv.validateSecurityPolicy(manifest.Security)
-		result.Errors = append(result.Errors, securityErrors...)
-		result.Warnings = append(result.Warnings, securityWarnings...)
-		if len(securityErrors) > 0 {
-			result.IsValid = false
-		}
+		addFindings(result, "security.policy", "/security", securityErrors, securityWarnings)
 	}
 
 	// Validate resources
 	if manifest.Resources == nil {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "resource manifest is required")
+		result.AddError("manifest.required", "/resources", "resource manifest is required")
 	} else {
 		resourceErrors, resourceWarnings := dv.validateResourceManifest(manifest.Resources)
-		result.Errors = append(result.Errors, resourceErrors...)
-		result.Warnings = append(result.Warnings, resourceWarnings...)
-		if len(resourceErrors) > 0 {
-			result.IsValid = false
-		}
+		addFindings(result, "resource.invalid", "/resources", resourceErrors, resourceWarnings)
 	}
 
 	return result
@@ -198,54 +145,47 @@ func (dv *DocumentValidator) ValidateManifest(manifest *core.Manifest) *core.Val
 
 // ValidateContent validates document content
 func (dv *DocumentValidator) ValidateContent(content *core.DocumentContent) *core.ValidationResult {
-	result := &core.ValidationResult{
-		IsValid:  true,
-		Errors:   []string{},
-		Warnings: []string{},
-	}
+	result := core.NewValidationResult()
 
 	if content == nil {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "document content is nil")
+		result.AddError("content.missing", "", "document content is nil")
 		return result
 	}
 
 	// Validate HTML content
 	if content.HTML == "" {
-		result.IsValid = false
-		result.Errors = append(result.Errors, "HTML content is required")
+		result.AddError("content.required", "content/index.html", "HTML content is required")
 	} else {
 		if len(content.HTML) > dv.config.MaxContentSize {
-			result.IsValid = false
-			result.Errors = append(result.Errors, fmt.Sprintf("HTML content size %d exceeds limit %d", len(content.HTML), dv.config.MaxContentSize))
+			result.AddError("content.size", "content/index.html", fmt.Sprintf("HTML content size %d exceeds limit %d", len(content.HTML), dv.config.MaxContentSize))
 		}
 
 		// Basic HTML validation
 		if !strings.Contains(content.HTML, "<html") && !strings.Contains(content.HTML, "<!DOCTYPE") {
-			result.Warnings = append(result.Warnings, "HTML content may be missing DOCTYPE or html tag")
+			result.AddWarning("content.html", "content/index.html", "HTML content may be missing DOCTYPE or html tag")
 		}
 	}
 
 	// Validate CSS content
 	if content.CSS != "" {
 		if len(content.CSS) > dv.config.MaxContentSize {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("CSS content size %d is large", len(content.CSS)))
+			result.AddWarning("content.large", "content/styles/main.css", fmt.Sprintf("CSS content size %d is large", len(content.CSS)))
 		}
 	}
 
 	// Validate static fallback
 	if content.StaticFallback == "" {
-		result.Warnings = append(result.Warnings, "static fallback content is missing")
+		result.AddWarning("content.fallback_missing", "content/static/fallback.html", "static fallback content is missing")
 	} else {
 		if len(content.StaticFallback) > dv.config.MaxContentSize {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("static fallback size %d is large", len(content.StaticFallback)))
+			result.AddWarning("content.large", "content/static/fallback.html", fmt.Sprintf("static fallback size %d is large", len(content.StaticFallback)))
 		}
 	}
 
 	// Validate interactive spec
 	if content.InteractiveSpec != "" {
 		if len(content.InteractiveSpec) > dv.config.MaxContentSize {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("interactive spec size %d is large", len(content.InteractiveSpec)))
+			result.AddWarning("content.large", "content/scripts/interactive.js", fmt.Sprintf("interactive spec size %d is large", len(content.InteractiveSpec)))
 		}
 	}
 
@@ -254,14 +194,10 @@ func (dv *DocumentValidator) ValidateContent(content *core.DocumentContent) *cor
 
 // ValidateAssets validates asset bundle
 func (dv *DocumentValidator) ValidateAssets(assets *core.AssetBundle) *core.ValidationResult {
-	result := &core.ValidationResult{
-		IsValid:  true,
-		Errors:   []string{},
-		Warnings: []string{},
-	}
+	result := core.NewValidationResult()
 
 	if assets == nil {
-		result.Warnings = append(result.Warnings, "no assets found in document")
+		result.AddWarning("assets.none", "", "no assets found in document")
 		return result
 	}
 
@@ -273,12 +209,11 @@ func (dv *DocumentValidator) ValidateAssets(assets *core.AssetBundle) *core.Vali
 		totalSize += size
 
 		if size > int64(dv.config.MaxAssetSize) {
-			result.Errors = append(result.Errors, fmt.Sprintf("image asset '%s' size %d exceeds limit %d", name, size, dv.config.MaxAssetSize))
-			result.IsValid = false
+			result.AddError("assets.size", "assets/images/"+name, fmt.Sprintf("image asset '%s' size %d exceeds limit %d", name, size, dv.config.MaxAssetSize))
 		}
 
 		if size == 0 {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("image asset '%s' is empty", name))
+			result.AddWarning("assets.empty", "assets/images/"+name, fmt.Sprintf("image asset '%s' is empty", name))
 		}
 	}
 
@@ -288,12 +223,11 @@ func (dv *DocumentValidator) ValidateAssets(assets *core.AssetBundle) *core.Vali
 		totalSize += size
 
 		if size > int64(dv.config.MaxAssetSize) {
-			result.Errors = append(result.Errors, fmt.Sprintf("font asset '%s' size %d exceeds limit %d", name, size, dv.config.MaxAssetSize))
-			result.IsValid = false
+			result.AddError("assets.size", "assets/fonts/"+name, fmt.Sprintf("font asset '%s' size %d exceeds limit %d", name, size, dv.config.MaxAssetSize))
 		}
 
 		if size == 0 {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("font asset '%s' is empty", name))
+			result.AddWarning("assets.empty", "assets/fonts/"+name, fmt.Sprintf("font asset '%s' is empty", name))
 		}
 	}
 
@@ -303,18 +237,17 @@ func (dv *DocumentValidator) ValidateAssets(assets *core.AssetBundle) *core.Vali
 		totalSize += size
 
 		if size > int64(dv.config.MaxAssetSize) {
-			result.Errors = append(result.Errors, fmt.Sprintf("data asset '%s' size %d exceeds limit %d", name, size, dv.config.MaxAssetSize))
-			result.IsValid = false
+			result.AddError("assets.size", "assets/data/"+name, fmt.Sprintf("data asset '%s' size %d exceeds limit %d", name, size, dv.config.MaxAssetSize))
 		}
 
 		if size == 0 {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("data asset '%s' is empty", name))
+			result.AddWarning("assets.empty", "assets/data/"+name, fmt.Sprintf("data asset '%s' is empty", name))
 		}
 	}
 
 	// Check total asset size
 	if totalSize > 100*1024*1024 { // 100MB
-		result.Warnings = append(result.Warnings, fmt.Sprintf("total asset size %d is very large", totalSize))
+		result.AddWarning("assets.large", "", fmt.Sprintf("total asset size %d is very large", totalSize))
 	}
 
 	return result
@@ -322,35 +255,31 @@ func (dv *DocumentValidator) ValidateAssets(assets *core.AssetBundle) *core.Vali
 
 // ValidateSignatures validates all signatures
 func (dv *DocumentValidator) ValidateSignatures(doc *core.LIVDocument) *core.ValidationResult {
-	result := &core.ValidationResult{
-		IsValid:  true,
-		Errors:   []string{},
-		Warnings: []string{},
-	}
+	result := core.NewValidationResult()
 
 	if doc.Signatures == nil {
-		result.Warnings = append(result.Warnings, "no signatures found in document")
+		result.AddWarning("signature.none", "", "no signatures found in document")
 		return result
 	}
 
 	// Validate content signature
 	if doc.Signatures.ContentSignature == "" {
-		result.Warnings = append(result.Warnings, "content signature is missing")
+		result.AddWarning("signature.missing", "", "content signature is missing")
 	}
 
 	// Validate manifest signature
 	if doc.Signatures.ManifestSignature == "" {
-		result.Warnings = append(result.Warnings, "manifest signature is missing")
+		result.AddWarning("signature.missing", "", "manifest signature is missing")
 	}
 
 	// Validate WASM signatures
 	if len(doc.WASMModules) > 0 {
 		if len(doc.Signatures.WASMSignatures) == 0 {
-			result.Warnings = append(result.Warnings, "WASM modules present but no WASM signatures found")
+			result.AddWarning("signature.missing", "", "WASM modules present but no WASM signatures found")
 		} else {
 			for moduleName := range doc.WASMModules {
 				if _, exists := doc.Signatures.WASMSignatures[moduleName]; !exists {
-					result.Warnings = append(result.Warnings, fmt.Sprintf("WASM module '%s' has no signature", moduleName))
+					result.AddWarning("signature.missing", "", fmt.Sprintf("WASM module '%s' has no signature", moduleName))
 				}
 			}
 		}
@@ -361,6 +290,16 @@ func (dv *DocumentValidator) ValidateSignatures(doc *core.LIVDocument) *core.Val
 
 // Helper methods
 
+// addFindings records the errors and warnings of a check as findings
+func addFindings(result *core.ValidationResult, code, path string, errors, warnings []string) {
+	for _, message := range errors {
+		result.AddError(code, path, message)
+	}
+	for _, message := range warnings {
+		result.AddWarning(code, path, message)
+	}
+}
+
 func (dv *DocumentValidator) validateMetadata(metadata *core.DocumentMetadata) ([]string, []string) {
 	var errors []string
 	var warnings []string
@@ -392,13 +331,13 @@ func (dv *DocumentValidator) validateMetadata(metadata *core.DocumentMetadata) (
 	}
 
 	if !metadata.Created.IsZero() && !metadata.Modified.IsZero() {
-		if metadata.Created.After(metadata.Modified) {
+		if core.UTC(metadata.Created).After(core.UTC(metadata.Modified)) {
 			errors = append(errors, "creation date cannot be after modification date")
 		}
 	}
 
-	if !metadata.Modified.IsZero() && metadata.Modified.After(time.Now().Add(time.Hour)) {
-		warnings = append(warnings, "modification date is in the future")
+	if message := core.FutureTime("modification date", metadata.Modified, time.Now(), core.DefaultClockSkew); message != "" {
+		warnings = append(warnings, message)
 	}
 
 	// Validate field lengths
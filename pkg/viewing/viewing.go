@@ -0,0 +1,289 @@
+// Package viewing tracks the documents open in web viewers and enforces how
+// many a single viewer may hold open at once. A viewer takes a lease when it
+// opens a document and renews it while the document stays open; leases that
+// are not renewed expire, so crashed or closed tabs free their slot.
+package viewing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/security"
+)
+
+// DefaultLeaseTTL is how long a lease lasts without being renewed
+const DefaultLeaseTTL = 90 * time.Second
+
+// Scopes a limit applies to
+const (
+	ScopeUser = "user"
+	ScopeIP   = "ip"
+)
+
+// ErrUnknownLease is returned for leases that expired, were closed or belong
+// to another viewer
+var ErrUnknownLease = errors.New("viewing session not found")
+
+// Limits caps the documents a viewer may have open at once. Signed-in users
+// are counted by user name, anonymous viewers by IP address. Zero means
+// unlimited.
+type Limits struct {
+	PerUser  int
+	PerIP    int
+	LeaseTTL time.Duration
+}
+
+// LimitsFromPolicy derives limits from a security policy's resource limits.
+// MaxConcurrentDocuments applies to each user, and to each IP address unless
+// perIP is positive.
+func LimitsFromPolicy(policy *security.SystemSecurityPolicy, perIP int) Limits {
+	var limits Limits
+	if policy != nil && policy.ResourceLimits != nil {
+		limits.PerUser = policy.ResourceLimits.MaxConcurrentDocuments
+		limits.PerIP = policy.ResourceLimits.MaxConcurrentDocuments
+	}
+	if perIP > 0 {
+		limits.PerIP = perIP
+	}
+	return limits
+}
+
+// Lease is a document held open by a viewer
+type Lease struct {
+	ID       string    `json:"id"`
+	Document string    `json:"document"`
+	User     string    `json:"user,omitempty"`
+	IP       string    `json:"-"`
+	Opened   time.Time `json:"opened"`
+	Expires  time.Time `json:"expires"`
+}
+
+// LimitError is returned when opening a document would exceed a limit. Open
+// lists the documents the viewer already holds, oldest first.
+type LimitError struct {
+	Scope string
+	Limit int
+	Open  []Lease
+}
+
+func (e *LimitError) Error() string {
+	if e.Scope == ScopeUser {
+		return fmt.Sprintf("you already have %d documents open (limit %d); close one to open another", len(e.Open), e.Limit)
+	}
+	return fmt.Sprintf("%d documents are already open from your network address (limit %d); close one or sign in to open another", len(e.Open), e.Limit)
+}
+
+// RetryAfter estimates when a slot frees up if the viewer does nothing
+func (e *LimitError) RetryAfter(now time.Time) time.Duration {
+	wait := time.Duration(0)
+	for i, lease := range e.Open {
+		if d := lease.Expires.Sub(now); i == 0 || d < wait {
+			wait = d
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// Metrics describes current and cumulative viewing activity
+type Metrics struct {
+	Open         int               `json:"open"`
+	Users        int               `json:"users"`
+	Addresses    int               `json:"addresses"`
+	PeakOpen     int               `json:"peak_open"`
+	Opened       uint64            `json:"opened"`
+	Closed       uint64            `json:"closed"`
+	Expired      uint64            `json:"expired"`
+	Rejected     map[string]uint64 `json:"rejected"`
+	LimitPerUser int               `json:"limit_per_user"`
+	LimitPerIP   int               `json:"limit_per_ip"`
+}
+
+// Tracker holds the open leases. It is safe for concurrent use.
+type Tracker struct {
+	limits Limits
+	Now    func() time.Time
+
+	mu       sync.Mutex
+	leases   map[string]*Lease
+	peak     int
+	opened   uint64
+	closed   uint64
+	expired  uint64
+	rejected map[string]uint64
+}
+
+// NewTracker creates a tracker enforcing limits
+func NewTracker(limits Limits) *Tracker {
+	if limits.LeaseTTL <= 0 {
+		limits.LeaseTTL = DefaultLeaseTTL
+	}
+	return &Tracker{
+		limits:   limits,
+		Now:      time.Now,
+		leases:   make(map[string]*Lease),
+		rejected: make(map[string]uint64),
+	}
+}
+
+// Limits returns the limits the tracker enforces
+func (t *Tracker) Limits() Limits {
+	return t.limits
+}
+
+// limit returns the limit that applies to a viewer and what it counts by
+func (t *Tracker) limit(user string) (scope string, limit int) {
+	if user != "" {
+		return ScopeUser, t.limits.PerUser
+	}
+	return ScopeIP, t.limits.PerIP
+}
+
+// holder reports whether a lease belongs to the viewer
+func (l *Lease) holder(user, ip string) bool {
+	if user != "" || l.User != "" {
+		return l.User == user
+	}
+	return l.IP == ip
+}
+
+// Open takes a lease on a document for a viewer, or returns a *LimitError
+// when the viewer already holds as many documents as it may
+func (t *Tracker) Open(user, ip, document string) (*Lease, error) {
+	id, err := newLeaseID()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.Now()
+	t.expire(now)
+
+	scope, limit := t.limit(user)
+	if limit > 0 {
+		held := t.held(user, ip)
+		if len(held) >= limit {
+			t.rejected[scope]++
+			return nil, &LimitError{Scope: scope, Limit: limit, Open: held}
+		}
+	}
+
+	lease := &Lease{ID: id, Document: document, User: user, IP: ip, Opened: now, Expires: now.Add(t.limits.LeaseTTL)}
+	t.leases[id] = lease
+	t.opened++
+	if len(t.leases) > t.peak {
+		t.peak = len(t.leases)
+	}
+	copied := *lease
+	return &copied, nil
+}
+
+// Renew extends a lease held by the viewer
+func (t *Tracker) Renew(id, user, ip string) (*Lease, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.Now()
+	t.expire(now)
+
+	lease, exists := t.leases[id]
+	if !exists || !lease.holder(user, ip) {
+		return nil, ErrUnknownLease
+	}
+	lease.Expires = now.Add(t.limits.LeaseTTL)
+	copied := *lease
+	return &copied, nil
+}
+
+// Close releases a lease held by the viewer
+func (t *Tracker) Close(id, user, ip string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(t.Now())
+
+	lease, exists := t.leases[id]
+	if !exists || !lease.holder(user, ip) {
+		return ErrUnknownLease
+	}
+	delete(t.leases, id)
+	t.closed++
+	return nil
+}
+
+// Held returns the leases of a viewer, oldest first
+func (t *Tracker) Held(user, ip string) []Lease {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(t.Now())
+	return t.held(user, ip)
+}
+
+// Metrics returns current and cumulative viewing activity
+func (t *Tracker) Metrics() Metrics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(t.Now())
+
+	users := make(map[string]bool)
+	addresses := make(map[string]bool)
+	for _, lease := range t.leases {
+		if lease.User != "" {
+			users[lease.User] = true
+		} else {
+			addresses[lease.IP] = true
+		}
+	}
+	rejected := make(map[string]uint64, len(t.rejected))
+	for scope, n := range t.rejected {
+		rejected[scope] = n
+	}
+	return Metrics{
+		Open:         len(t.leases),
+		Users:        len(users),
+		Addresses:    len(addresses),
+		PeakOpen:     t.peak,
+		Opened:       t.opened,
+		Closed:       t.closed,
+		Expired:      t.expired,
+		Rejected:     rejected,
+		LimitPerUser: t.limits.PerUser,
+		LimitPerIP:   t.limits.PerIP,
+	}
+}
+
+// held lists a viewer's leases; the caller holds the lock
+func (t *Tracker) held(user, ip string) []Lease {
+	var held []Lease
+	for _, lease := range t.leases {
+		if lease.holder(user, ip) {
+			held = append(held, *lease)
+		}
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].Opened.Before(held[j].Opened) })
+	return held
+}
+
+// expire drops leases that were not renewed in time; the caller holds the lock
+func (t *Tracker) expire(now time.Time) {
+	for id, lease := range t.leases {
+		if !now.Before(lease.Expires) {
+			delete(t.leases, id)
+			t.expired++
+		}
+	}
+}
+
+func newLeaseID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,110 @@
+package viewing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/security"
+)
+
+func TestTrackerLimits(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(Limits{PerUser: 2, PerIP: 1, LeaseTTL: time.Minute})
+	tracker.Now = func() time.Time { return now }
+
+	first, err := tracker.Open("alice", "198.51.100.1", "report.liv")
+	if err != nil {
+		t.Fatalf("expected the first document to open: %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := tracker.Open("alice", "198.51.100.2", "notes.liv"); err != nil {
+		t.Fatalf("expected users to be limited by user, not address: %v", err)
+	}
+
+	_, err = tracker.Open("alice", "198.51.100.1", "third.liv")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a limit error, got %v", err)
+	}
+	if limitErr.Scope != ScopeUser || limitErr.Limit != 2 || len(limitErr.Open) != 2 || limitErr.Open[0].Document != "report.liv" {
+		t.Errorf("unexpected limit error: %+v", limitErr)
+	}
+	if retry := limitErr.RetryAfter(now); retry != 59*time.Second {
+		t.Errorf("expected a slot to free up within the lease TTL, got %v", retry)
+	}
+
+	// Anonymous viewers sharing alice's address are counted separately
+	if _, err := tracker.Open("", "198.51.100.1", "public.liv"); err != nil {
+		t.Fatalf("expected an anonymous viewer to open a document: %v", err)
+	}
+	if _, err := tracker.Open("", "198.51.100.1", "other.liv"); !errors.As(err, &limitErr) || limitErr.Scope != ScopeIP {
+		t.Errorf("expected the address limit, got %v", err)
+	}
+
+	// Leases can only be released by their holder
+	if err := tracker.Close(first.ID, "bob", "198.51.100.1"); !errors.Is(err, ErrUnknownLease) {
+		t.Errorf("expected other users not to close the lease, got %v", err)
+	}
+	if err := tracker.Close(first.ID, "", "198.51.100.1"); !errors.Is(err, ErrUnknownLease) {
+		t.Errorf("expected anonymous viewers not to close a user's lease, got %v", err)
+	}
+	if err := tracker.Close(first.ID, "alice", "203.0.113.9"); err != nil {
+		t.Fatalf("expected alice to close her lease: %v", err)
+	}
+	if _, err := tracker.Open("alice", "198.51.100.1", "third.liv"); err != nil {
+		t.Errorf("expected a closed document to free a slot: %v", err)
+	}
+
+	metrics := tracker.Metrics()
+	if metrics.Open != 3 || metrics.Users != 1 || metrics.Addresses != 1 || metrics.PeakOpen != 3 ||
+		metrics.Opened != 4 || metrics.Closed != 1 || metrics.Rejected[ScopeUser] != 1 || metrics.Rejected[ScopeIP] != 1 {
+		t.Errorf("unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestTrackerExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(Limits{PerIP: 1, LeaseTTL: time.Minute})
+	tracker.Now = func() time.Time { return now }
+
+	lease, err := tracker.Open("", "198.51.100.1", "report.liv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(50 * time.Second)
+	if _, err := tracker.Renew(lease.ID, "", "198.51.100.1"); err != nil {
+		t.Fatalf("expected the lease to renew: %v", err)
+	}
+	now = now.Add(50 * time.Second)
+	if len(tracker.Held("", "198.51.100.1")) != 1 {
+		t.Fatal("expected a renewed lease to outlive its first TTL")
+	}
+
+	// A tab that stops renewing frees its slot
+	now = now.Add(time.Minute)
+	if _, err := tracker.Renew(lease.ID, "", "198.51.100.1"); !errors.Is(err, ErrUnknownLease) {
+		t.Errorf("expected an expired lease to be gone, got %v", err)
+	}
+	if _, err := tracker.Open("", "198.51.100.1", "notes.liv"); err != nil {
+		t.Errorf("expected an expired lease to free its slot: %v", err)
+	}
+	if metrics := tracker.Metrics(); metrics.Expired != 1 {
+		t.Errorf("expected one expired lease, got %d", metrics.Expired)
+	}
+}
+
+func TestLimitsFromPolicy(t *testing.T) {
+	policy := &security.SystemSecurityPolicy{ResourceLimits: &security.ResourceLimits{MaxConcurrentDocuments: 5}}
+
+	if limits := LimitsFromPolicy(policy, 0); limits.PerUser != 5 || limits.PerIP != 5 {
+		t.Errorf("expected the policy limit for users and addresses, got %+v", limits)
+	}
+	if limits := LimitsFromPolicy(policy, 20); limits.PerUser != 5 || limits.PerIP != 20 {
+		t.Errorf("expected a separate address limit, got %+v", limits)
+	}
+	if limits := LimitsFromPolicy(nil, 0); limits.PerUser != 0 || limits.PerIP != 0 {
+		t.Errorf("expected no limits without a policy, got %+v", limits)
+	}
+}
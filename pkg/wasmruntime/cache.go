@@ -0,0 +1,51 @@
+package wasmruntime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// Cache holds compiled modules, keyed by a hash of the module, so opening a
+// document again does not compile its modules again. A cache may be shared
+// by several runtimes.
+type Cache struct {
+	compilationCache wazero.CompilationCache
+}
+
+// NewCache creates a cache that keeps compiled modules in memory for the
+// life of the process
+func NewCache() *Cache {
+	return &Cache{compilationCache: wazero.NewCompilationCache()}
+}
+
+// NewDiskCache creates a cache that also keeps compiled modules in dir, so
+// they survive restarts. Entries compiled by another wazero version or for
+// another CPU are ignored and replaced.
+func NewDiskCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create module cache: %v", err)
+	}
+	compilationCache, err := wazero.NewCompilationCacheWithDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open module cache: %v", err)
+	}
+	return &Cache{compilationCache: compilationCache}, nil
+}
+
+// DefaultCacheDir returns the per-user directory for compiled modules
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "liv", "wasm"), nil
+}
+
+// Close releases the compiled modules held in memory. Modules stay on disk.
+func (c *Cache) Close(ctx context.Context) error {
+	return c.compilationCache.Close(ctx)
+}
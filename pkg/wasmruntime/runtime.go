@@ -0,0 +1,399 @@
+// Package wasmruntime executes the WASM modules of documents on the server
+// with wazero. Every module runs in its own wazero runtime, so modules share
+// no memory, tables or host state. A module may only import the host
+// functions its permissions allow, its linear memory is capped, and each call
+// is preempted when it runs out of fuel or CPU time. Compiled modules can be
+// cached, in memory or on disk, so documents open faster the next time.
+package wasmruntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Errors returned when a call exceeds its limits. The module is terminated
+// and cannot be called again.
+var (
+	ErrFuelExhausted   = errors.New("fuel exhausted")
+	ErrCPUTimeExceeded = errors.New("CPU time limit exceeded")
+	ErrTerminated      = errors.New("module has been terminated")
+)
+
+// wasmPageSize is the size of a page of WASM linear memory
+const wasmPageSize = 64 << 10
+
+// FuelPerMillisecond is the fuel granted per millisecond of CPU time when
+// limits are derived from permissions
+const FuelPerMillisecond = 100000
+
+// Limits bounds what a module may use. Zero means unlimited.
+type Limits struct {
+	// MemoryLimit is the most linear memory, in bytes, the module may have;
+	// it is rounded down to whole pages
+	MemoryLimit uint64
+	// CPUTimeLimit is how long a single call may run
+	CPUTimeLimit time.Duration
+	// Fuel is how many function calls, including calls made by the module to
+	// its own functions, a single call may make. Loops without calls are
+	// preempted by CPUTimeLimit instead.
+	Fuel uint64
+	// AllowedImports lists the imports the module may use, as "module.name",
+	// or "module.*" for every function of a host module
+	AllowedImports []string
+}
+
+// LimitsFromPermissions derives limits from the WASM permissions of a
+// security policy: MemoryLimit in bytes and CPUTimeLimit in milliseconds,
+// which also sets the fuel.
+func LimitsFromPermissions(permissions *core.WASMPermissions) Limits {
+	if permissions == nil {
+		return Limits{}
+	}
+	return Limits{
+		MemoryLimit:    permissions.MemoryLimit,
+		CPUTimeLimit:   time.Duration(permissions.CPUTimeLimit) * time.Millisecond,
+		Fuel:           permissions.CPUTimeLimit * FuelPerMillisecond,
+		AllowedImports: permissions.AllowedImports,
+	}
+}
+
+// allows reports whether an import is allowed
+func (l Limits) allows(module, name string) bool {
+	for _, allowed := range l.AllowedImports {
+		if allowed == module+"."+name || allowed == module+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// HostFunction is a function the host offers to modules
+type HostFunction struct {
+	Module  string
+	Name    string
+	Params  []api.ValueType
+	Results []api.ValueType
+	Func    api.GoModuleFunc
+}
+
+// Runtime loads modules with the host functions it offers. It is safe for
+// concurrent use.
+type Runtime struct {
+	hostFunctions map[string]map[string]HostFunction
+	cache         *Cache
+}
+
+// NewRuntime creates a runtime offering the given host functions. Modules
+// may also import WASI (wasi_snapshot_preview1) when allowed; it gives them
+// no file system or network access.
+func NewRuntime(hostFunctions ...HostFunction) *Runtime {
+	r := &Runtime{hostFunctions: make(map[string]map[string]HostFunction)}
+	for _, fn := range hostFunctions {
+		if r.hostFunctions[fn.Module] == nil {
+			r.hostFunctions[fn.Module] = make(map[string]HostFunction)
+		}
+		r.hostFunctions[fn.Module][fn.Name] = fn
+	}
+	return r
+}
+
+// SetCache makes the runtime reuse the modules compiled into cache, so
+// modules loaded again are not compiled again
+func (r *Runtime) SetCache(cache *Cache) {
+	r.cache = cache
+}
+
+// config returns the wazero configuration for a module under limits
+func (r *Runtime) config(limits Limits) (wazero.RuntimeConfig, error) {
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if r.cache != nil {
+		config = config.WithCompilationCache(r.cache.compilationCache)
+	}
+	if limits.MemoryLimit > 0 {
+		pages := limits.MemoryLimit / wasmPageSize
+		if pages == 0 {
+			return nil, fmt.Errorf("memory limit of %d bytes is less than one page", limits.MemoryLimit)
+		}
+		if pages > 65536 {
+			pages = 65536
+		}
+		config = config.WithMemoryLimitPages(uint32(pages))
+	}
+	return config, nil
+}
+
+// compile compiles a module with the fuel meter. Compiled code does not
+// depend on the instance it is compiled for, so a cache can share it.
+func compile(ctx context.Context, runtime wazero.Runtime, module []byte) (wazero.CompiledModule, error) {
+	compiled, err := runtime.CompileModule(experimental.WithFunctionListenerFactory(ctx, fuelMeter{}), module)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WASM module: %v", err)
+	}
+	return compiled, nil
+}
+
+// Precompile compiles modules into the runtime's cache ahead of loading
+// them, for example while a document is opening. Without a cache it only
+// checks that the modules compile.
+func (r *Runtime) Precompile(ctx context.Context, modules ...[]byte) error {
+	config, err := r.config(Limits{})
+	if err != nil {
+		return err
+	}
+	for _, module := range modules {
+		runtime := wazero.NewRuntimeWithConfig(ctx, config)
+		_, err := compile(ctx, runtime, module)
+		runtime.Close(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load compiles and instantiates a module under limits. Imports that are not
+// allowed, or not offered by the host, are refused before any code runs.
+func (r *Runtime) Load(ctx context.Context, name string, module []byte, limits Limits) (*Instance, error) {
+	config, err := r.config(limits)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := &Instance{name: name, limits: limits, runtime: wazero.NewRuntimeWithConfig(ctx, config)}
+	compiled, err := compile(ctx, instance.runtime, module)
+	if err != nil {
+		instance.runtime.Close(ctx)
+		return nil, err
+	}
+
+	if err := r.instantiateImports(ctx, instance, compiled); err != nil {
+		instance.runtime.Close(ctx)
+		return nil, err
+	}
+
+	// Start functions run under the same limits as calls
+	err = instance.metered(ctx, func(ctx context.Context) error {
+		var err error
+		instance.module, err = instance.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName(name).WithStartFunctions())
+		return err
+	})
+	if err != nil {
+		instance.runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate module %s: %w", name, err)
+	}
+	return instance, nil
+}
+
+// instantiateImports checks the imports of a module against its limits and
+// instantiates the host modules it imports from, with only the functions it
+// imports
+func (r *Runtime) instantiateImports(ctx context.Context, instance *Instance, compiled wazero.CompiledModule) error {
+	imported := make(map[string][]string)
+	for _, def := range compiled.ImportedFunctions() {
+		module, name, _ := def.Import()
+		if !instance.limits.allows(module, name) {
+			return fmt.Errorf("import %s.%s is not allowed", module, name)
+		}
+		imported[module] = append(imported[module], name)
+		instance.imports = append(instance.imports, module+"."+name)
+	}
+	for _, def := range compiled.ImportedMemories() {
+		module, name, _ := def.Import()
+		return fmt.Errorf("imported memory %s.%s is not provided by the host", module, name)
+	}
+	sort.Strings(instance.imports)
+
+	for module, names := range imported {
+		if module == wasi_snapshot_preview1.ModuleName {
+			if _, err := wasi_snapshot_preview1.Instantiate(ctx, instance.runtime); err != nil {
+				return fmt.Errorf("failed to instantiate WASI: %v", err)
+			}
+			continue
+		}
+		builder := instance.runtime.NewHostModuleBuilder(module)
+		for _, name := range names {
+			fn, exists := r.hostFunctions[module][name]
+			if !exists {
+				return fmt.Errorf("import %s.%s is not provided by the host", module, name)
+			}
+			builder.NewFunctionBuilder().WithGoModuleFunction(fn.Func, fn.Params, fn.Results).Export(name)
+		}
+		if _, err := builder.Instantiate(ctx); err != nil {
+			return fmt.Errorf("failed to instantiate host module %s: %v", module, err)
+		}
+	}
+	return nil
+}
+
+// Instance is a loaded module. Calls are serialized.
+type Instance struct {
+	name    string
+	limits  Limits
+	runtime wazero.Runtime
+	module  api.Module
+	imports []string
+
+	mu sync.Mutex
+	// fuel left in the running call, and the call's cancel function
+	fuel      uint64
+	exhausted bool
+	cancel    context.CancelFunc
+	fuelUsed  uint64
+	closed    bool
+}
+
+// Name returns the name the module was loaded with
+func (i *Instance) Name() string {
+	return i.name
+}
+
+// Imports returns the imports of the module, as "module.name"
+func (i *Instance) Imports() []string {
+	return i.imports
+}
+
+// Exports returns the names of the functions the module exports
+func (i *Instance) Exports() []string {
+	var exports []string
+	for name := range i.module.ExportedFunctionDefinitions() {
+		exports = append(exports, name)
+	}
+	sort.Strings(exports)
+	return exports
+}
+
+// Call calls an exported function with WASM-encoded parameters and returns
+// its results. A call that exceeds its fuel or CPU time terminates the module.
+func (i *Instance) Call(ctx context.Context, function string, params ...uint64) ([]uint64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed || i.module.IsClosed() {
+		return nil, ErrTerminated
+	}
+
+	fn := i.module.ExportedFunction(function)
+	if fn == nil {
+		return nil, fmt.Errorf("function %s is not exported by module %s", function, i.name)
+	}
+
+	var results []uint64
+	err := i.metered(ctx, func(ctx context.Context) error {
+		var err error
+		results, err = fn.Call(ctx, params...)
+		return err
+	})
+	if err != nil {
+		// Preempted modules may have been stopped in an inconsistent state
+		if errors.Is(err, ErrFuelExhausted) || errors.Is(err, ErrCPUTimeExceeded) || i.module.IsClosed() {
+			i.closed = true
+		}
+		return nil, fmt.Errorf("call to %s.%s failed: %w", i.name, function, err)
+	}
+	return results, nil
+}
+
+// metered runs guest code with fresh fuel under the CPU time limit, and
+// translates preemption into ErrFuelExhausted and ErrCPUTimeExceeded
+func (i *Instance) metered(ctx context.Context, run func(ctx context.Context) error) error {
+	var callCtx context.Context
+	var cancel context.CancelFunc
+	if i.limits.CPUTimeLimit > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, i.limits.CPUTimeLimit)
+	} else {
+		callCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	i.fuel, i.exhausted, i.cancel = i.limits.Fuel, false, cancel
+
+	// The fuel meter finds the instance it meters through the context
+	err := run(context.WithValue(callCtx, meteredInstance{}, i))
+	i.cancel = nil
+	switch {
+	case i.exhausted:
+		return ErrFuelExhausted
+	case err == nil:
+		return nil
+	case ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded):
+		return ErrCPUTimeExceeded
+	}
+	return err
+}
+
+// meteredInstance is the context key of the instance running a call
+type meteredInstance struct{}
+
+// fuelMeter burns one unit of fuel of the calling instance per function
+// call, and cancels the call when none is left. Cancellation stops the
+// module at its next function call or loop iteration.
+type fuelMeter struct{}
+
+// NewFunctionListener meters every function of a module; it implements
+// experimental.FunctionListenerFactory
+func (fuelMeter) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return fuelMeter{}
+}
+
+func (fuelMeter) Before(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	i, ok := ctx.Value(meteredInstance{}).(*Instance)
+	if !ok {
+		return
+	}
+	i.fuelUsed++
+	if i.limits.Fuel == 0 || i.exhausted {
+		return
+	}
+	if i.fuel == 0 {
+		i.exhausted = true
+		if i.cancel != nil {
+			i.cancel()
+		}
+		return
+	}
+	i.fuel--
+}
+
+func (fuelMeter) After(context.Context, api.Module, api.FunctionDefinition, []uint64) {}
+
+func (fuelMeter) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
+
+// FuelUsed returns the fuel the module burnt across all calls
+func (i *Instance) FuelUsed() uint64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.fuelUsed
+}
+
+// MemoryUsage returns the size of the module's linear memory in bytes
+func (i *Instance) MemoryUsage() uint64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	memory := i.module.Memory()
+	// Modules without memory have a typed nil one
+	if i.closed || memory == nil || reflect.ValueOf(memory).IsNil() {
+		return 0
+	}
+	return uint64(memory.Size())
+}
+
+// Close terminates the module and releases its runtime
+func (i *Instance) Close(ctx context.Context) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.runtime == nil {
+		return ErrTerminated
+	}
+	runtime := i.runtime
+	i.closed, i.runtime = true, nil
+	return runtime.Close(ctx)
+}
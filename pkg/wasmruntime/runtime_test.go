@@ -0,0 +1,279 @@
+package wasmruntime
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liv-format/liv/pkg/core"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// The test modules are assembled by hand, so the tests need no toolchain
+
+func leb(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func wasmName(s string) []byte {
+	return append(leb(len(s)), s...)
+}
+
+// section encodes a section holding a vector of entries
+func section(id byte, entries ...[]byte) []byte {
+	payload := leb(len(entries))
+	for _, entry := range entries {
+		payload = append(payload, entry...)
+	}
+	return append(append([]byte{id}, leb(len(payload))...), payload...)
+}
+
+// body encodes a function body without locals
+func body(instructions ...byte) []byte {
+	code := append([]byte{0x00}, instructions...)
+	code = append(code, 0x0b)
+	return append(leb(len(code)), code...)
+}
+
+func export(name string, kind, index byte) []byte {
+	return append(wasmName(name), kind, index)
+}
+
+func wasmModule(sections ...[]byte) []byte {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	for _, s := range sections {
+		module = append(module, s...)
+	}
+	return module
+}
+
+var (
+	i32 = byte(0x7f)
+	// limitsModule exports add(a, b), spin() looping forever, burn() calling
+	// nop forever and grow(pages) growing its one page of memory
+	limitsModule = wasmModule(
+		section(1,
+			[]byte{0x60, 0x00, 0x00},
+			[]byte{0x60, 0x02, i32, i32, 0x01, i32},
+			[]byte{0x60, 0x01, i32, 0x01, i32}),
+		section(3, []byte{0}, []byte{1}, []byte{0}, []byte{0}, []byte{2}),
+		section(5, []byte{0x00, 0x01}),
+		section(7, export("add", 0, 1), export("spin", 0, 2), export("burn", 0, 3), export("grow", 0, 4), export("memory", 2, 0)),
+		section(10,
+			body(),
+			body(0x20, 0x00, 0x20, 0x01, 0x6a),
+			body(0x03, 0x40, 0x0c, 0x00, 0x0b),
+			body(0x03, 0x40, 0x10, 0x00, 0x0c, 0x00, 0x0b),
+			body(0x20, 0x00, 0x40, 0x00)),
+	)
+	// importModule exports run(), which calls env.log(42)
+	importModule = wasmModule(
+		section(1, []byte{0x60, 0x01, i32, 0x00}, []byte{0x60, 0x00, 0x00}),
+		section(2, append(append(wasmName("env"), wasmName("log")...), 0x00, 0x00)),
+		section(3, []byte{1}),
+		section(7, export("run", 0, 1)),
+		section(10, body(0x41, 0x2a, 0x10, 0x00)),
+	)
+)
+
+var testLimits = Limits{MemoryLimit: 2 * wasmPageSize, CPUTimeLimit: 5 * time.Second, Fuel: 1000}
+
+func TestCall(t *testing.T) {
+	ctx := context.Background()
+	instance, err := NewRuntime().Load(ctx, "limits", limitsModule, testLimits)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer instance.Close(ctx)
+
+	if exports := strings.Join(instance.Exports(), ","); exports != "add,burn,grow,spin" {
+		t.Errorf("Unexpected exports: %s", exports)
+	}
+	results, err := instance.Call(ctx, "add", 2, 3)
+	if err != nil || len(results) != 1 || results[0] != 5 {
+		t.Fatalf("Expected add(2, 3) = 5, got %v: %v", results, err)
+	}
+	if _, err := instance.Call(ctx, "missing"); err == nil {
+		t.Error("Expected a call to a missing function to fail")
+	}
+
+	// Memory grows up to the limit, and no further
+	if results, err := instance.Call(ctx, "grow", 1); err != nil || results[0] != 1 {
+		t.Errorf("Expected memory to grow from 1 page, got %v: %v", results, err)
+	}
+	if results, err := instance.Call(ctx, "grow", 1); err != nil || int32(results[0]) != -1 {
+		t.Errorf("Expected memory growth past the limit to fail, got %v: %v", results, err)
+	}
+	if usage := instance.MemoryUsage(); usage != 2*wasmPageSize {
+		t.Errorf("Expected 2 pages of memory, got %d bytes", usage)
+	}
+	if instance.FuelUsed() == 0 {
+		t.Error("Expected calls to burn fuel")
+	}
+
+	if _, err := NewRuntime().Load(ctx, "small", limitsModule, Limits{MemoryLimit: 1024}); err == nil {
+		t.Error("Expected a memory limit below one page to be refused")
+	}
+	if _, err := NewRuntime().Load(ctx, "invalid", []byte("\x00asm\x01\x00\x00\x00garbage"), testLimits); err == nil {
+		t.Error("Expected an invalid module to be refused")
+	}
+}
+
+func TestPreemption(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewRuntime()
+
+	burning, err := runtime.Load(ctx, "burning", limitsModule, testLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer burning.Close(ctx)
+	other, err := runtime.Load(ctx, "other", limitsModule, testLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(ctx)
+
+	if _, err := burning.Call(ctx, "burn"); !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("Expected burn to run out of fuel, got %v", err)
+	}
+	if _, err := burning.Call(ctx, "add", 1, 1); !errors.Is(err, ErrTerminated) {
+		t.Errorf("Expected a preempted module to be terminated, got %v", err)
+	}
+	// Modules are isolated from each other
+	if results, err := other.Call(ctx, "add", 1, 1); err != nil || results[0] != 2 {
+		t.Errorf("Expected the other module to keep working, got %v: %v", results, err)
+	}
+
+	spinning, err := runtime.Load(ctx, "spinning", limitsModule, Limits{CPUTimeLimit: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spinning.Close(ctx)
+	start := time.Now()
+	if _, err := spinning.Call(ctx, "spin"); !errors.Is(err, ErrCPUTimeExceeded) {
+		t.Fatalf("Expected spin to exceed its CPU time, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected spin to be preempted promptly, took %v", elapsed)
+	}
+}
+
+func TestImports(t *testing.T) {
+	ctx := context.Background()
+	var logged []uint64
+	host := NewRuntime(HostFunction{
+		Module: "env",
+		Name:   "log",
+		Params: []api.ValueType{api.ValueTypeI32},
+		Func: func(ctx context.Context, mod api.Module, stack []uint64) {
+			logged = append(logged, stack[0])
+		},
+	})
+
+	if _, err := host.Load(ctx, "denied", importModule, testLimits); err == nil || !strings.Contains(err.Error(), "env.log is not allowed") {
+		t.Errorf("Expected an import that is not allowed to be refused, got %v", err)
+	}
+	allowed := testLimits
+	allowed.AllowedImports = []string{"env.*"}
+	if _, err := NewRuntime().Load(ctx, "missing", importModule, allowed); err == nil || !strings.Contains(err.Error(), "not provided") {
+		t.Errorf("Expected an import the host does not offer to be refused, got %v", err)
+	}
+
+	allowed.AllowedImports = []string{"env.log"}
+	instance, err := host.Load(ctx, "logging", importModule, allowed)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer instance.Close(ctx)
+	if imports := instance.Imports(); len(imports) != 1 || imports[0] != "env.log" {
+		t.Errorf("Unexpected imports: %v", imports)
+	}
+	if _, err := instance.Call(ctx, "run"); err != nil || len(logged) != 1 || logged[0] != 42 {
+		t.Errorf("Expected run to log 42, got %v: %v", logged, err)
+	}
+	if usage := instance.MemoryUsage(); usage != 0 {
+		t.Errorf("Expected a module without memory to use none, got %d bytes", usage)
+	}
+}
+
+func TestLimitsFromPermissions(t *testing.T) {
+	limits := LimitsFromPermissions(&core.WASMPermissions{MemoryLimit: 1 << 20, CPUTimeLimit: 200, AllowedImports: []string{"env.log"}})
+	if limits.MemoryLimit != 1<<20 || limits.CPUTimeLimit != 200*time.Millisecond || limits.Fuel != 200*FuelPerMillisecond {
+		t.Errorf("Unexpected limits: %+v", limits)
+	}
+	if !limits.allows("env", "log") || limits.allows("env", "exit") {
+		t.Error("Expected only env.log to be allowed")
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close(ctx)
+	runtime := NewRuntime()
+	runtime.SetCache(cache)
+
+	if err := runtime.Precompile(ctx, limitsModule); err != nil {
+		t.Fatalf("Precompile failed: %v", err)
+	}
+	if err := runtime.Precompile(ctx, []byte("\x00asm\x01\x00\x00\x00garbage")); err == nil {
+		t.Error("Expected an invalid module to fail to precompile")
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) == 0 {
+		t.Errorf("Expected compiled modules on disk, got %v: %v", entries, err)
+	}
+
+	// Instances sharing compiled code keep their own fuel and memory limits
+	burning, err := runtime.Load(ctx, "burning", limitsModule, testLimits)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer burning.Close(ctx)
+	small, err := runtime.Load(ctx, "small", limitsModule, Limits{MemoryLimit: wasmPageSize, Fuel: 1000})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer small.Close(ctx)
+	if _, err := burning.Call(ctx, "burn"); !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("Expected burn to run out of fuel, got %v", err)
+	}
+	if results, err := small.Call(ctx, "add", 1, 1); err != nil || results[0] != 2 || small.FuelUsed() != 1 {
+		t.Errorf("Expected the other instance to have its own fuel, got %v after %d: %v", results, small.FuelUsed(), err)
+	}
+	if results, err := small.Call(ctx, "grow", 1); err != nil || int32(results[0]) != -1 {
+		t.Errorf("Expected the other instance to keep its memory limit, got %v: %v", results, err)
+	}
+
+	// A new cache on the same directory reuses the compiled modules
+	reopened, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close(ctx)
+	runtime = NewRuntime()
+	runtime.SetCache(reopened)
+	instance, err := runtime.Load(ctx, "cached", limitsModule, testLimits)
+	if err != nil {
+		t.Fatalf("Load from the disk cache failed: %v", err)
+	}
+	defer instance.Close(ctx)
+	if results, err := instance.Call(ctx, "add", 2, 3); err != nil || results[0] != 5 {
+		t.Errorf("Expected add(2, 3) = 5, got %v: %v", results, err)
+	}
+}
@@ -0,0 +1,344 @@
+package workspace
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// AssetModeCopy copies shared assets into each document
+	AssetModeCopy = "copy"
+	// AssetModeLink hard-links shared assets into each staged document instead of
+	// copying them, falling back to a copy across filesystems
+	AssetModeLink = "link"
+
+	// DefaultAssetTarget is where shared assets are placed inside a document
+	DefaultAssetTarget = "assets/shared"
+
+	// SumFile records the shared asset hashes of the last successful workspace build
+	SumFile = "liv.work.sum"
+)
+
+// SharedAssetsConfig describes the shared asset library of a workspace
+type SharedAssetsConfig struct {
+	Dir    string `json:"dir"`
+	Mode   string `json:"mode,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// AssetLibrary maps the slash-separated paths of shared assets to their SHA-256 hashes
+type AssetLibrary map[string]string
+
+// AssetStatus describes how a shared asset changed since the last recorded build
+type AssetStatus string
+
+const (
+	// AssetUnchanged marks an asset whose hash matches the last build
+	AssetUnchanged AssetStatus = "unchanged"
+	// AssetChanged marks an asset modified since the last build
+	AssetChanged AssetStatus = "changed"
+	// AssetAdded marks an asset not yet used by a successful build
+	AssetAdded AssetStatus = "added"
+	// AssetRemoved marks an asset deleted from the library since the last build
+	AssetRemoved AssetStatus = "removed"
+)
+
+// AssetImpact lists the documents affected by a shared asset
+type AssetImpact struct {
+	Path       string      `json:"path"`
+	Hash       string      `json:"hash,omitempty"`
+	LockedHash string      `json:"locked_hash,omitempty"`
+	Status     AssetStatus `json:"status"`
+	Documents  []string    `json:"documents"`
+}
+
+// SharedAssetDir returns the resolved shared asset library directory
+func (w *Workspace) SharedAssetDir() string {
+	if w.SharedAssets == nil {
+		return ""
+	}
+	return w.Resolve(w.SharedAssets.Dir)
+}
+
+// assetTarget returns the package path of a shared asset
+func (w *Workspace) assetTarget(asset string) string {
+	target := DefaultAssetTarget
+	if w.SharedAssets != nil && w.SharedAssets.Target != "" {
+		target = strings.Trim(w.SharedAssets.Target, "/")
+	}
+	return target + "/" + asset
+}
+
+// validateSharedAssets checks the shared asset configuration and document references
+func (w *Workspace) validateSharedAssets() error {
+	if w.SharedAssets == nil {
+		for _, doc := range w.Documents {
+			if len(doc.Assets) > 0 {
+				return fmt.Errorf("document %s uses shared assets but the workspace has no shared_assets library", doc.Name)
+			}
+		}
+		return nil
+	}
+
+	if info, err := os.Stat(w.SharedAssetDir()); err != nil || !info.IsDir() {
+		return fmt.Errorf("shared asset directory not found: %s", w.SharedAssets.Dir)
+	}
+	switch w.SharedAssets.Mode {
+	case "", AssetModeCopy, AssetModeLink:
+	default:
+		return fmt.Errorf("unknown shared asset mode: %s (expected copy or link)", w.SharedAssets.Mode)
+	}
+	if target := w.SharedAssets.Target; target != "" && (strings.Contains(target, "..") || path.IsAbs(target) || strings.HasPrefix(target, "content/")) {
+		return fmt.Errorf("invalid shared asset target: %s", target)
+	}
+
+	for _, doc := range w.Documents {
+		for _, pattern := range doc.Assets {
+			if _, err := path.Match(pattern, ""); err != nil || strings.Contains(pattern, "..") || path.IsAbs(pattern) {
+				return fmt.Errorf("document %s: invalid shared asset pattern: %s", doc.Name, pattern)
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadAssetLibrary hashes every file in the shared asset library
+func (w *Workspace) LoadAssetLibrary() (AssetLibrary, error) {
+	library := make(AssetLibrary)
+	if w.SharedAssets == nil {
+		return library, nil
+	}
+
+	dir := w.SharedAssetDir()
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil || relPath == "." {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if isHidden(relPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		hash, err := hashFile(filePath)
+		if err != nil {
+			return err
+		}
+		library[relPath] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared assets: %v", err)
+	}
+
+	return library, nil
+}
+
+// DocumentAssets returns the shared assets a document references. Every pattern
+// must match at least one asset so that typos do not silently drop files.
+func (w *Workspace) DocumentAssets(doc *Document, library AssetLibrary) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, pattern := range doc.Assets {
+		matched := false
+		for asset := range library {
+			if ok, _ := path.Match(pattern, asset); ok {
+				selected[asset] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("document %s: shared asset not found: %s", doc.Name, pattern)
+		}
+	}
+
+	assets := make([]string, 0, len(selected))
+	for asset := range selected {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	return assets, nil
+}
+
+// stageSharedAssets places a document's shared assets into its staged directory.
+// A document may not carry its own file at a shared asset's location.
+func stageSharedAssets(ws *Workspace, assets []string, dir string) error {
+	for _, asset := range assets {
+		target := filepath.Join(dir, filepath.FromSlash(ws.assetTarget(asset)))
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%s conflicts with shared asset %s", ws.assetTarget(asset), asset)
+		}
+
+		source := filepath.Join(ws.SharedAssetDir(), filepath.FromSlash(asset))
+		if ws.SharedAssets.Mode == AssetModeLink {
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err == nil {
+				continue
+			}
+		}
+		if err := copyFile(source, target); err != nil {
+			return fmt.Errorf("failed to stage shared asset %s: %v", asset, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyPackageAssets checks that a built package carries every shared asset
+// with exactly the bytes of the library
+func verifyPackageAssets(ws *Workspace, packagePath string, assets []string, library AssetLibrary) error {
+	if len(assets) == 0 {
+		return nil
+	}
+
+	reader, err := zip.OpenReader(packagePath)
+	if err != nil {
+		return fmt.Errorf("failed to open package for shared asset verification: %v", err)
+	}
+	defer reader.Close()
+
+	for _, asset := range assets {
+		entry, err := reader.Open(ws.assetTarget(asset))
+		if err != nil {
+			return fmt.Errorf("shared asset %s missing from package", asset)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, entry)
+		entry.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read shared asset %s: %v", asset, err)
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != library[asset] {
+			return fmt.Errorf("shared asset %s in package does not match the library", asset)
+		}
+	}
+
+	return nil
+}
+
+// LoadAssetSums reads the shared asset hashes recorded by the last successful build
+func (w *Workspace) LoadAssetSums() (AssetLibrary, error) {
+	sums := make(AssetLibrary)
+
+	data, err := os.ReadFile(filepath.Join(w.Dir, SumFile))
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", SumFile, err)
+	}
+	if err := json.Unmarshal(data, &sums); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", SumFile, err)
+	}
+
+	return sums, nil
+}
+
+// SaveAssetSums records the hashes of the shared assets used by the workspace
+func (w *Workspace) SaveAssetSums(sums AssetLibrary) error {
+	data, err := json.MarshalIndent(sums, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", SumFile, err)
+	}
+	return os.WriteFile(filepath.Join(w.Dir, SumFile), append(data, '\n'), 0644)
+}
+
+// AssetImpacts compares the shared asset library against the hashes recorded by
+// the last build and lists, for every asset, the documents that reference it.
+// Documents listed under a changed or removed asset will change on the next build.
+func (w *Workspace) AssetImpacts() ([]*AssetImpact, error) {
+	library, err := w.LoadAssetLibrary()
+	if err != nil {
+		return nil, err
+	}
+	sums, err := w.LoadAssetSums()
+	if err != nil {
+		return nil, err
+	}
+
+	impacts := make(map[string]*AssetImpact)
+	for asset, hash := range library {
+		impacts[asset] = &AssetImpact{Path: asset, Hash: hash, Status: AssetAdded, Documents: []string{}}
+	}
+	for asset, locked := range sums {
+		impact, exists := impacts[asset]
+		if !exists {
+			impact = &AssetImpact{Path: asset, Status: AssetRemoved, Documents: []string{}}
+			impacts[asset] = impact
+		} else if impact.Hash == locked {
+			impact.Status = AssetUnchanged
+		} else {
+			impact.Status = AssetChanged
+		}
+		impact.LockedHash = locked
+	}
+
+	// Match patterns against removed assets too, so their dependents are reported
+	known := make(AssetLibrary)
+	for asset, impact := range impacts {
+		known[asset] = impact.Hash
+	}
+	for _, doc := range w.Documents {
+		for _, pattern := range doc.Assets {
+			for asset := range known {
+				if ok, _ := path.Match(pattern, asset); ok {
+					impacts[asset].Documents = append(impacts[asset].Documents, doc.Name)
+				}
+			}
+		}
+	}
+
+	result := make([]*AssetImpact, 0, len(impacts))
+	for _, impact := range impacts {
+		sort.Strings(impact.Documents)
+		impact.Documents = dedupe(impact.Documents)
+		result = append(result, impact)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+
+	return result, nil
+}
+
+// AffectedDocuments returns the documents that reference a changed or removed shared asset
+func AffectedDocuments(impacts []*AssetImpact) []string {
+	var affected []string
+	for _, impact := range impacts {
+		if impact.Status == AssetChanged || impact.Status == AssetRemoved {
+			affected = append(affected, impact.Documents...)
+		}
+	}
+	sort.Strings(affected)
+	return dedupe(affected)
+}
+
+// dedupe removes adjacent duplicates from a sorted slice
+func dedupe(values []string) []string {
+	out := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,513 @@
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/atomicfile"
+)
+
+// ThemeStylesheet is where the shared theme is placed inside each document
+const ThemeStylesheet = "content/styles/theme.css"
+
+// Job is a single document build handed to a BuildFunc
+type Job struct {
+	Document     *Document
+	InputDir     string
+	OutputFile   string
+	ManifestFile string
+	Sign         bool
+	KeyFile      string
+	SectionKeys  string
+	AssetPolicy  string
+	Compress     bool
+}
+
+// BuildFunc builds one document from a prepared input directory
+type BuildFunc func(job *Job) error
+
+// BuildOptions controls a workspace build
+type BuildOptions struct {
+	// NoCache rebuilds every document even if its inputs are unchanged
+	NoCache bool
+	// Update accepts remote inputs that drifted from the lockfile and rewrites it
+	Update bool
+	// Client fetches remote inputs; nil uses a default client
+	Client *http.Client
+}
+
+// Status is the outcome of building one document
+type Status string
+
+const (
+	// StatusBuilt marks a document that was rebuilt
+	StatusBuilt Status = "built"
+	// StatusCached marks a document whose inputs were unchanged since the last build
+	StatusCached Status = "cached"
+	// StatusFailed marks a document that failed to build
+	StatusFailed Status = "failed"
+)
+
+// Result records the outcome of building one document
+type Result struct {
+	Name    string  `json:"name"`
+	Output  string  `json:"output"`
+	Status  Status  `json:"status"`
+	Size    int64   `json:"size,omitempty"`
+	Assets  int     `json:"shared_assets,omitempty"`
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Report is the combined report of a workspace build
+type Report struct {
+	Workspace string    `json:"workspace"`
+	Started   time.Time `json:"started"`
+	Seconds   float64   `json:"seconds"`
+	Documents []*Result `json:"documents"`
+	// LockChanges lists the remote inputs added to, updated in or removed from the lockfile
+	LockChanges []string `json:"lock_changes,omitempty"`
+}
+
+// Count returns the number of documents with the given status
+func (r *Report) Count(status Status) int {
+	count := 0
+	for _, result := range r.Documents {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// WriteFile saves the report as JSON
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode build report: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %v", err)
+	}
+	return atomicfile.WriteFile(path, data, 0644)
+}
+
+// cacheEntry remembers the inputs and output of a document's last successful build
+type cacheEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	OutputHash  string    `json:"output_hash"`
+	Built       time.Time `json:"built"`
+}
+
+// buildCache is shared by every document in a workspace
+type buildCache struct {
+	Entries map[string]*cacheEntry `json:"entries"`
+	path    string
+}
+
+func loadBuildCache(ws *Workspace) *buildCache {
+	cache := &buildCache{
+		Entries: make(map[string]*cacheEntry),
+		path:    filepath.Join(ws.Dir, CacheDir, "build.json"),
+	}
+	if data, err := os.ReadFile(cache.path); err == nil {
+		if json.Unmarshal(data, cache) != nil || cache.Entries == nil {
+			cache.Entries = make(map[string]*cacheEntry)
+		}
+	}
+	return cache
+}
+
+func (c *buildCache) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode build cache: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return atomicfile.WriteFile(c.path, data, 0644)
+}
+
+// upToDate reports whether the output still matches the recorded build
+func (c *buildCache) upToDate(name, fingerprint, output string) bool {
+	entry, exists := c.Entries[name]
+	if !exists || entry.Fingerprint != fingerprint {
+		return false
+	}
+	hash, err := hashFile(output)
+	return err == nil && hash == entry.OutputHash
+}
+
+// Build builds every document in the workspace. A failing document does not stop
+// the others; the returned report records the outcome of each.
+func Build(ws *Workspace, build BuildFunc, opts BuildOptions) (*Report, error) {
+	report := &Report{Workspace: ws.Dir, Started: time.Now().UTC()}
+	cache := loadBuildCache(ws)
+
+	// Hash shared inputs once for all documents
+	shared, err := sharedFingerprint(ws)
+	if err != nil {
+		return nil, err
+	}
+	library, err := ws.LoadAssetLibrary()
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := ws.LoadLock()
+	if err != nil {
+		return nil, err
+	}
+	remote := newFetcher(lock, opts.Client, opts.Update)
+
+	theme, err := loadTheme(ws, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range ws.Documents {
+		report.Documents = append(report.Documents, buildDocument(ws, doc, build, cache, shared, library, remote, theme, opts))
+	}
+
+	report.Seconds = time.Since(report.Started).Seconds()
+
+	if err := cache.save(); err != nil {
+		return report, err
+	}
+
+	// Only a fully successful build has fetched every remote input, so only then
+	// does the lockfile reflect the workspace
+	if report.Count(StatusFailed) == 0 {
+		report.LockChanges = remote.changes()
+		if len(report.LockChanges) > 0 {
+			if err := ws.SaveLock(remote.next); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	// Record the shared assets every document now carries, so the next change can
+	// be traced to the documents it affects
+	if ws.SharedAssets != nil && report.Count(StatusFailed) == 0 {
+		if err := ws.SaveAssetSums(usedAssets(ws, library)); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// usedAssets returns the library entries referenced by at least one document
+func usedAssets(ws *Workspace, library AssetLibrary) AssetLibrary {
+	used := make(AssetLibrary)
+	for _, doc := range ws.Documents {
+		assets, _ := ws.DocumentAssets(doc, library)
+		for _, asset := range assets {
+			used[asset] = library[asset]
+		}
+	}
+	return used
+}
+
+func buildDocument(ws *Workspace, doc *Document, build BuildFunc, cache *buildCache, shared string, library AssetLibrary, remote *fetcher, theme []byte, opts BuildOptions) *Result {
+	start := time.Now()
+	job := &Job{
+		Document:     doc,
+		OutputFile:   ws.OutputFile(doc),
+		ManifestFile: ws.Resolve(doc.Manifest),
+		Sign:         ws.ShouldSign(doc),
+		SectionKeys:  ws.Resolve(doc.SectionKeys),
+		AssetPolicy:  ws.AssetPolicy,
+		Compress:     ws.ShouldCompress(),
+	}
+	if job.Sign {
+		job.KeyFile = ws.KeyFile()
+	}
+
+	result := &Result{Name: doc.Name, Output: job.OutputFile}
+	fail := func(err error) *Result {
+		delete(cache.Entries, doc.Name)
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		result.Seconds = time.Since(start).Seconds()
+		return result
+	}
+
+	stageDir, err := os.MkdirTemp("", "liv-workspace-"+doc.Name+"-")
+	if err != nil {
+		return fail(fmt.Errorf("failed to create staging directory: %v", err))
+	}
+	defer os.RemoveAll(stageDir)
+	job.InputDir = stageDir
+
+	if err := stageDocument(ws, doc, stageDir, remote, theme); err != nil {
+		return fail(err)
+	}
+
+	assets, err := ws.DocumentAssets(doc, library)
+	if err != nil {
+		return fail(err)
+	}
+	if err := stageSharedAssets(ws, assets, stageDir); err != nil {
+		return fail(fmt.Errorf("document %s: %v", doc.Name, err))
+	}
+	result.Assets = len(assets)
+
+	fingerprint, err := jobFingerprint(job, shared)
+	if err != nil {
+		return fail(err)
+	}
+
+	if !opts.NoCache && cache.upToDate(doc.Name, fingerprint, job.OutputFile) {
+		result.Status = StatusCached
+	} else {
+		if err := os.MkdirAll(filepath.Dir(job.OutputFile), 0755); err != nil {
+			return fail(fmt.Errorf("failed to create output directory: %v", err))
+		}
+		if err := build(job); err != nil {
+			return fail(err)
+		}
+		if err := verifyPackageAssets(ws, job.OutputFile, assets, library); err != nil {
+			return fail(err)
+		}
+
+		outputHash, err := hashFile(job.OutputFile)
+		if err != nil {
+			return fail(fmt.Errorf("build produced no output: %v", err))
+		}
+		cache.Entries[doc.Name] = &cacheEntry{
+			Fingerprint: fingerprint,
+			OutputHash:  outputHash,
+			Built:       time.Now().UTC(),
+		}
+		result.Status = StatusBuilt
+	}
+
+	if info, err := os.Stat(job.OutputFile); err == nil {
+		result.Size = info.Size()
+	}
+	result.Seconds = time.Since(start).Seconds()
+	return result
+}
+
+// stageDocument assembles a document in dir: the remote template if any, then the
+// document's sources, remote data and the shared theme. The source directory is
+// left untouched.
+func stageDocument(ws *Workspace, doc *Document, dir string, remote *fetcher, theme []byte) error {
+	if doc.Template != nil {
+		data, err := remote.fetch(InputTemplate, doc.Template)
+		if err != nil {
+			return err
+		}
+		if err := stageTemplate(data, dir); err != nil {
+			return fmt.Errorf("failed to apply template %s to %s: %v", doc.Template.URL, doc.Name, err)
+		}
+	}
+
+	sourceDir := ws.SourceDir(doc)
+
+	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		if isHidden(filepath.ToSlash(relPath)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		target := filepath.Join(dir, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stage %s: %v", doc.Name, err)
+	}
+
+	for _, input := range doc.Remote {
+		data, err := remote.fetch(InputData, input)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(input.Path))
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("document %s: remote input %s conflicts with %s", doc.Name, input.URL, input.Path)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if theme != nil {
+		if err := applyTheme(theme, dir); err != nil {
+			return fmt.Errorf("failed to apply theme to %s: %v", doc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// loadTheme reads the shared theme from disk or fetches it when it is a URL
+func loadTheme(ws *Workspace, remote *fetcher) ([]byte, error) {
+	switch {
+	case ws.Theme == "":
+		return nil, nil
+	case IsRemote(ws.Theme):
+		return remote.fetch(InputTheme, &RemoteInput{URL: ws.Theme})
+	default:
+		data, err := os.ReadFile(ws.ThemeFile())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read theme: %v", err)
+		}
+		return data, nil
+	}
+}
+
+var headClose = regexp.MustCompile(`(?i)</head\s*>`)
+
+// applyTheme adds the theme stylesheet to a staged document and links it from
+// content/index.html after the document's own styles
+func applyTheme(theme []byte, dir string) error {
+	themePath := filepath.Join(dir, filepath.FromSlash(ThemeStylesheet))
+	if err := os.MkdirAll(filepath.Dir(themePath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(themePath, theme, 0644); err != nil {
+		return err
+	}
+
+	indexPath := filepath.Join(dir, "content", "index.html")
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return err
+	}
+
+	href := strings.TrimPrefix(ThemeStylesheet, "content/")
+	html := string(data)
+	if strings.Contains(html, href) {
+		return nil
+	}
+
+	link := fmt.Sprintf(`<link rel="stylesheet" href="%s">`, href)
+	if loc := headClose.FindStringIndex(html); loc != nil {
+		html = html[:loc[0]] + link + "\n" + html[loc[0]:]
+	} else {
+		html = link + "\n" + html
+	}
+
+	return os.WriteFile(indexPath, []byte(html), 0644)
+}
+
+// sharedFingerprint hashes the workspace-wide inputs that affect every document
+func sharedFingerprint(ws *Workspace) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "version=%d\n", ws.Version)
+
+	if keyFile := ws.KeyFile(); keyFile != "" {
+		keyHash, err := hashFile(keyFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read signing key: %v", err)
+		}
+		fmt.Fprintf(hash, "key=%s\n", keyHash)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// jobFingerprint hashes the staged input and build settings of a document
+func jobFingerprint(job *Job, shared string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "shared=%s\nsign=%v\ncompress=%v\npolicy=%s\n", shared, job.Sign, job.Compress, job.AssetPolicy)
+
+	for _, extra := range []string{job.ManifestFile, job.SectionKeys} {
+		if extra == "" {
+			continue
+		}
+		extraHash, err := hashFile(extra)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "extra=%s\n", extraHash)
+	}
+
+	var paths []string
+	err := filepath.Walk(job.InputDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		relPath, _ := filepath.Rel(job.InputDir, path)
+		fileHash, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s=%s\n", filepath.ToSlash(relPath), fileHash)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,244 @@
+package workspace
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liv-format/liv/pkg/container"
+	"github.com/liv-format/liv/pkg/templates"
+)
+
+const (
+	// LockFile pins the remote inputs of a workspace build
+	LockFile = "liv.lock"
+	// MaxRemoteInputSize limits the size of a single remote input
+	MaxRemoteInputSize = 100 * 1024 * 1024
+)
+
+const (
+	// InputTheme is a remote theme stylesheet
+	InputTheme = "theme"
+	// InputData is a remote data file placed into a document
+	InputData = "data"
+	// InputTemplate is a remote template package used as a document's base layer
+	InputTemplate = "template"
+)
+
+// RemoteInput is a build input fetched over HTTP(S)
+type RemoteInput struct {
+	URL     string `json:"url"`
+	Version string `json:"version,omitempty"`
+	// Path is where a data input is placed inside the document
+	Path string `json:"path,omitempty"`
+}
+
+// Lock records the exact content of every remote input used by a build
+type Lock struct {
+	Version      int                          `json:"version"`
+	Dependencies map[string]*LockedDependency `json:"dependencies"`
+}
+
+// LockedDependency pins a single remote input
+type LockedDependency struct {
+	URL     string `json:"url"`
+	Kind    string `json:"kind"`
+	Version string `json:"version,omitempty"`
+	SHA256  string `json:"sha256"`
+	Size    int64  `json:"size"`
+}
+
+// DriftError reports a remote input whose content or version no longer matches the lockfile
+type DriftError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("remote input %s has drifted from %s (locked %s, found %s); rerun with --update to accept the change",
+		e.URL, LockFile, e.Expected, e.Actual)
+}
+
+// IsRemote reports whether a workspace reference is an http(s) URL
+func IsRemote(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+// LoadLock reads the workspace lockfile; a missing lockfile yields an empty lock
+func (w *Workspace) LoadLock() (*Lock, error) {
+	lock := &Lock{Version: CurrentVersion, Dependencies: make(map[string]*LockedDependency)}
+
+	data, err := os.ReadFile(filepath.Join(w.Dir, LockFile))
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", LockFile, err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", LockFile, err)
+	}
+	if lock.Dependencies == nil {
+		lock.Dependencies = make(map[string]*LockedDependency)
+	}
+
+	return lock, nil
+}
+
+// SaveLock writes the workspace lockfile
+func (w *Workspace) SaveLock(lock *Lock) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", LockFile, err)
+	}
+	return os.WriteFile(filepath.Join(w.Dir, LockFile), append(data, '\n'), 0644)
+}
+
+// validateRemoteInputs checks the remote inputs referenced by the workspace
+func (w *Workspace) validateRemoteInputs() error {
+	for _, doc := range w.Documents {
+		if doc.Template != nil && !IsRemote(doc.Template.URL) {
+			return fmt.Errorf("document %s: template must be an http(s) URL: %s", doc.Name, doc.Template.URL)
+		}
+		for _, input := range doc.Remote {
+			if input == nil || !IsRemote(input.URL) {
+				return fmt.Errorf("document %s: remote input must be an http(s) URL", doc.Name)
+			}
+			if input.Path == "" || input.Path != path.Clean(input.Path) || strings.HasPrefix(input.Path, "../") || path.IsAbs(input.Path) {
+				return fmt.Errorf("document %s: invalid path for remote input %s: %q", doc.Name, input.URL, input.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// fetcher downloads remote inputs once per build and checks them against the lockfile
+type fetcher struct {
+	client  *http.Client
+	locked  *Lock
+	next    *Lock
+	update  bool
+	fetched map[string][]byte
+}
+
+func newFetcher(locked *Lock, client *http.Client, update bool) *fetcher {
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &fetcher{
+		client:  client,
+		locked:  locked,
+		next:    &Lock{Version: CurrentVersion, Dependencies: make(map[string]*LockedDependency)},
+		update:  update,
+		fetched: make(map[string][]byte),
+	}
+}
+
+// fetch downloads a remote input and verifies it against the lockfile. Inputs not
+// yet in the lockfile are added; locked inputs must match unless updating.
+func (f *fetcher) fetch(kind string, input *RemoteInput) ([]byte, error) {
+	if data, exists := f.fetched[input.URL]; exists {
+		return data, nil
+	}
+
+	resp, err := f.client.Get(input.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", input.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", input.URL, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxRemoteInputSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", input.URL, err)
+	}
+	if len(data) > MaxRemoteInputSize {
+		return nil, fmt.Errorf("remote input %s exceeds %d bytes", input.URL, MaxRemoteInputSize)
+	}
+
+	hash := sha256.Sum256(data)
+	dependency := &LockedDependency{
+		URL:     input.URL,
+		Kind:    kind,
+		Version: input.Version,
+		SHA256:  hex.EncodeToString(hash[:]),
+		Size:    int64(len(data)),
+	}
+
+	if locked, exists := f.locked.Dependencies[input.URL]; exists && !f.update {
+		if locked.Version != dependency.Version {
+			return nil, &DriftError{URL: input.URL, Expected: "version " + locked.Version, Actual: "version " + dependency.Version}
+		}
+		if locked.SHA256 != dependency.SHA256 {
+			return nil, &DriftError{URL: input.URL, Expected: "sha256 " + locked.SHA256, Actual: "sha256 " + dependency.SHA256}
+		}
+	}
+
+	f.fetched[input.URL] = data
+	f.next.Dependencies[input.URL] = dependency
+	return data, nil
+}
+
+// changes describes how the lockfile differs after this build
+func (f *fetcher) changes() []string {
+	var changes []string
+	for url, dependency := range f.next.Dependencies {
+		locked, exists := f.locked.Dependencies[url]
+		switch {
+		case !exists:
+			changes = append(changes, fmt.Sprintf("added %s %s", dependency.Kind, url))
+		case locked.SHA256 != dependency.SHA256 || locked.Version != dependency.Version:
+			changes = append(changes, fmt.Sprintf("updated %s %s", dependency.Kind, url))
+		}
+	}
+	for url, locked := range f.locked.Dependencies {
+		if _, exists := f.next.Dependencies[url]; !exists {
+			changes = append(changes, fmt.Sprintf("removed %s %s", locked.Kind, url))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// stageTemplate extracts a remote template into dir as the base layer of a document
+func stageTemplate(data []byte, dir string) error {
+	files, err := container.NewZIPContainer().ExtractFromReaderToMemory(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("invalid template package: %v", err)
+	}
+
+	// The lockfile pins the package contents, so the publisher signature is not required here
+	descriptor, _, err := templates.Verify(files, nil)
+	if err != nil {
+		return err
+	}
+
+	for filePath, content := range files {
+		if filePath == templates.DescriptorFile || filePath == templates.SignatureFile || filePath == descriptor.Preview {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(filePath))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package workspace
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/liv-format/liv/pkg/templates"
+)
+
+// remoteServer serves mutable content for remote input tests
+type remoteServer struct {
+	mu      sync.Mutex
+	content map[string][]byte
+}
+
+func (s *remoteServer) set(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content[path] = data
+}
+
+func (s *remoteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, exists := s.content[r.URL.Path]
+	s.mu.Unlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func setupRemoteWorkspace(t *testing.T) (*Workspace, *remoteServer) {
+	templateDir := t.TempDir()
+	writeFiles(t, templateDir, map[string]string{
+		templates.DescriptorFile:  `{"name": "report", "version": "1.0.0", "title": "Report", "author": "Templates"}`,
+		"content/styles/base.css": "body { margin: 0; }",
+		"content/index.html":      "<html><head></head><body>template</body></html>",
+	})
+	packagePath := filepath.Join(t.TempDir(), "report"+templates.PackageExtension)
+	if _, err := templates.Pack(templateDir, packagePath, nil); err != nil {
+		t.Fatalf("Failed to pack template: %v", err)
+	}
+	templateData, _ := os.ReadFile(packagePath)
+
+	remote := &remoteServer{content: map[string][]byte{
+		"/theme.css":   []byte("body { color: navy; }"),
+		"/sales.json":  []byte(`{"q1": 10}`),
+		"/report.livt": templateData,
+	}}
+	server := httptest.NewServer(remote)
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		FileName: `{
+  "version": 1,
+  "theme": "` + server.URL + `/theme.css",
+  "documents": [
+    {
+      "path": "docs/sales",
+      "template": {"url": "` + server.URL + `/report.livt", "version": "1.0.0"},
+      "remote": [{"url": "` + server.URL + `/sales.json", "version": "2024-q1", "path": "assets/data/sales.json"}]
+    }
+  ]
+}`,
+		"docs/sales/content/index.html": "<html><head><title>Sales</title></head><body></body></html>",
+	})
+
+	ws, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Failed to load workspace: %v", err)
+	}
+	return ws, remote
+}
+
+func TestBuild_LockfilePinsRemoteInputs(t *testing.T) {
+	ws, remote := setupRemoteWorkspace(t)
+
+	var staged map[string]string
+	build := func(job *Job) error {
+		staged = make(map[string]string)
+		filepath.Walk(job.InputDir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				relPath, _ := filepath.Rel(job.InputDir, path)
+				data, _ := os.ReadFile(path)
+				staged[filepath.ToSlash(relPath)] = string(data)
+			}
+			return err
+		})
+		return os.WriteFile(job.OutputFile, []byte(staged["content/index.html"]), 0644)
+	}
+
+	report, err := Build(ws, build, BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.Count(StatusBuilt) != 1 || len(report.LockChanges) != 3 {
+		t.Fatalf("Expected one build adding 3 lock entries, got %+v / %v", report.Documents, report.LockChanges)
+	}
+	if staged["content/styles/base.css"] == "" || staged["assets/data/sales.json"] != `{"q1": 10}` || staged[ThemeStylesheet] == "" {
+		t.Errorf("Expected template, data and theme to be staged, got %v", staged)
+	}
+	if !strings.Contains(staged["content/index.html"], "Sales") {
+		t.Error("Expected document sources to override template files")
+	}
+
+	lock, err := ws.LoadLock()
+	if err != nil || len(lock.Dependencies) != 3 {
+		t.Fatalf("Expected 3 locked dependencies, got %v (%v)", lock, err)
+	}
+
+	// An unchanged rebuild leaves the lockfile alone
+	report, _ = Build(ws, build, BuildOptions{})
+	if len(report.LockChanges) != 0 || report.Count(StatusCached) != 1 {
+		t.Errorf("Expected a cached build without lock changes, got %+v / %v", report.Documents, report.LockChanges)
+	}
+
+	// Drift in a document input fails that document
+	remote.set("/sales.json", []byte(`{"q1": 11}`))
+	report, _ = Build(ws, build, BuildOptions{})
+	if report.Count(StatusFailed) != 1 || !strings.Contains(report.Documents[0].Error, "drifted") {
+		t.Errorf("Expected drift to fail the build, got %+v", report.Documents[0])
+	}
+
+	// Drift in the shared theme fails the whole build
+	remote.set("/theme.css", []byte("body { color: red; }"))
+	_, err = Build(ws, build, BuildOptions{})
+	var drift *DriftError
+	if !errors.As(err, &drift) {
+		t.Errorf("Expected theme drift error, got %v", err)
+	}
+
+	// --update accepts the new content and rewrites the lockfile
+	report, err = Build(ws, build, BuildOptions{Update: true})
+	if err != nil || report.Count(StatusBuilt) != 1 || len(report.LockChanges) != 2 {
+		t.Fatalf("Expected update to rebuild with 2 lock changes, got %+v / %v (%v)", report.Documents, report.LockChanges, err)
+	}
+	if _, err := Build(ws, build, BuildOptions{}); err != nil {
+		t.Errorf("Expected build to pass against the updated lockfile: %v", err)
+	}
+}
+
+func TestBuild_LockfileVersionDrift(t *testing.T) {
+	ws, _ := setupRemoteWorkspace(t)
+	build := func(job *Job) error { return os.WriteFile(job.OutputFile, []byte("x"), 0644) }
+
+	if _, err := Build(ws, build, BuildOptions{}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	ws.Documents[0].Template.Version = "1.1.0"
+	report, _ := Build(ws, build, BuildOptions{})
+	if report.Count(StatusFailed) != 1 || !strings.Contains(report.Documents[0].Error, "version 1.0.0") {
+		t.Errorf("Expected version change to be reported as drift, got %+v", report.Documents[0])
+	}
+}
+
+func TestLoad_RejectsInvalidRemoteInputs(t *testing.T) {
+	dir := setupWorkspace(t)
+	invalid := map[string]string{
+		"local-template": `{"version": 1, "documents": [{"path": "docs/handbook", "template": {"url": "templates/report.livt"}}]}`,
+		"no-path":        `{"version": 1, "documents": [{"path": "docs/handbook", "remote": [{"url": "https://example.com/data.json"}]}]}`,
+		"escape":         `{"version": 1, "documents": [{"path": "docs/handbook", "remote": [{"url": "https://example.com/data.json", "path": "../x.json"}]}]}`,
+	}
+	for name, content := range invalid {
+		writeFiles(t, dir, map[string]string{name + ".work": content})
+		if _, err := Load(filepath.Join(dir, name+".work")); err == nil {
+			t.Errorf("%s: expected invalid remote input to fail", name)
+		}
+	}
+}
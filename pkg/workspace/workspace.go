@@ -0,0 +1,228 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// FileName is the name of a workspace file
+	FileName = "liv.work"
+	// CurrentVersion is the workspace file format version
+	CurrentVersion = 1
+	// DefaultOutputDir is where documents are written when no output directory is configured
+	DefaultOutputDir = "dist"
+	// CacheDir holds the shared build cache, relative to the workspace root
+	CacheDir = ".liv-cache"
+)
+
+var documentNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Workspace describes a suite of documents built together with shared settings
+type Workspace struct {
+	Version   int    `json:"version"`
+	OutputDir string `json:"output_dir,omitempty"`
+	// Theme is a stylesheet path or http(s) URL applied to every document
+	Theme       string         `json:"theme,omitempty"`
+	Signing     *SigningConfig `json:"signing,omitempty"`
+	AssetPolicy string         `json:"asset_policy,omitempty"`
+	Compress    *bool          `json:"compress,omitempty"`
+	Documents   []*Document    `json:"documents"`
+
+	SharedAssets *SharedAssetsConfig `json:"shared_assets,omitempty"`
+
+	// Dir is the directory containing the workspace file; relative paths resolve against it
+	Dir string `json:"-"`
+}
+
+// SigningConfig references the key used to sign workspace documents
+type SigningConfig struct {
+	// Key is a path to a PEM private key. Environment variables are expanded, so
+	// the key can live outside the repository.
+	Key string `json:"key"`
+}
+
+// Document is a single document source directory within a workspace
+type Document struct {
+	Name        string `json:"name,omitempty"`
+	Path        string `json:"path"`
+	Output      string `json:"output,omitempty"`
+	Manifest    string `json:"manifest,omitempty"`
+	Sign        *bool  `json:"sign,omitempty"`
+	SectionKeys string `json:"section_keys,omitempty"`
+
+	// Assets lists the shared assets used by the document; patterns use path.Match syntax
+	Assets []string `json:"shared_assets,omitempty"`
+
+	// Template is a remote template package whose files the document sources are layered over
+	Template *RemoteInput `json:"template,omitempty"`
+	// Remote lists remote data files placed into the document at build time
+	Remote []*RemoteInput `json:"remote,omitempty"`
+}
+
+// Load reads a workspace file. path may name the file itself or the directory containing liv.work.
+func Load(path string) (*Workspace, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, FileName)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace file: %v", err)
+	}
+
+	var ws Workspace
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("invalid workspace file %s: %v", path, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace directory: %v", err)
+	}
+	ws.Dir = dir
+
+	for _, doc := range ws.Documents {
+		if doc != nil && doc.Name == "" {
+			doc.Name = filepath.Base(filepath.Clean(doc.Path))
+		}
+	}
+
+	if err := ws.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &ws, nil
+}
+
+// Validate checks the workspace for missing sources and conflicting outputs
+func (w *Workspace) Validate() error {
+	if w.Version != CurrentVersion {
+		return fmt.Errorf("unsupported workspace version %d (expected %d)", w.Version, CurrentVersion)
+	}
+	if len(w.Documents) == 0 {
+		return fmt.Errorf("workspace lists no documents")
+	}
+
+	if w.Theme != "" && !IsRemote(w.Theme) && !fileExists(w.ThemeFile()) {
+		return fmt.Errorf("theme not found: %s", w.Theme)
+	}
+	if w.Signing != nil && w.Signing.Key == "" {
+		return fmt.Errorf("signing configuration requires a key")
+	}
+
+	names := make(map[string]bool)
+	outputs := make(map[string]string)
+	for i, doc := range w.Documents {
+		if doc == nil || doc.Path == "" {
+			return fmt.Errorf("document %d has no path", i+1)
+		}
+		if !documentNamePattern.MatchString(doc.Name) {
+			return fmt.Errorf("invalid document name: %q", doc.Name)
+		}
+		if names[doc.Name] {
+			return fmt.Errorf("duplicate document name: %s", doc.Name)
+		}
+		names[doc.Name] = true
+
+		if info, err := os.Stat(w.SourceDir(doc)); err != nil || !info.IsDir() {
+			return fmt.Errorf("document %s: source directory not found: %s", doc.Name, doc.Path)
+		}
+
+		output := w.OutputFile(doc)
+		if other, exists := outputs[output]; exists {
+			return fmt.Errorf("documents %s and %s write to the same output: %s", other, doc.Name, output)
+		}
+		outputs[output] = doc.Name
+
+		if w.ShouldSign(doc) && w.Signing == nil {
+			return fmt.Errorf("document %s requests signing but the workspace has no signing key", doc.Name)
+		}
+	}
+
+	if err := w.validateRemoteInputs(); err != nil {
+		return err
+	}
+
+	return w.validateSharedAssets()
+}
+
+// Resolve returns path relative to the workspace directory unless it is absolute
+func (w *Workspace) Resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(w.Dir, filepath.FromSlash(path))
+}
+
+// SourceDir returns the source directory of a document
+func (w *Workspace) SourceDir(doc *Document) string {
+	return w.Resolve(doc.Path)
+}
+
+// OutputFile returns the package a document is built to
+func (w *Workspace) OutputFile(doc *Document) string {
+	output := doc.Output
+	if output == "" {
+		output = doc.Name + ".liv"
+	}
+	if filepath.IsAbs(output) {
+		return output
+	}
+
+	return filepath.Join(w.OutputPath(), filepath.FromSlash(output))
+}
+
+// OutputPath returns the resolved output directory
+func (w *Workspace) OutputPath() string {
+	if w.OutputDir == "" {
+		return w.Resolve(DefaultOutputDir)
+	}
+	return w.Resolve(w.OutputDir)
+}
+
+// ThemeFile returns the resolved path of the shared theme stylesheet
+func (w *Workspace) ThemeFile() string {
+	return w.Resolve(w.Theme)
+}
+
+// KeyFile returns the resolved path of the shared signing key
+func (w *Workspace) KeyFile() string {
+	if w.Signing == nil {
+		return ""
+	}
+	return w.Resolve(os.ExpandEnv(w.Signing.Key))
+}
+
+// ShouldSign reports whether a document is signed. Documents are signed whenever
+// the workspace has a signing key unless they opt out.
+func (w *Workspace) ShouldSign(doc *Document) bool {
+	if doc.Sign != nil {
+		return *doc.Sign
+	}
+	return w.Signing != nil
+}
+
+// ShouldCompress reports whether assets are compressed
+func (w *Workspace) ShouldCompress() bool {
+	return w.Compress == nil || *w.Compress
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// isHidden reports whether any element of a slash-separated path starts with a dot
+func isHidden(relPath string) bool {
+	for _, part := range strings.Split(relPath, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package workspace
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func setupWorkspace(t *testing.T) string {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		FileName: `{
+  "version": 1,
+  "output_dir": "out",
+  "theme": "shared/theme.css",
+  "documents": [
+    {"path": "docs/handbook"},
+    {"name": "report", "path": "docs/annual-report", "output": "annual.liv"}
+  ]
+}`,
+		"shared/theme.css":                      "body { font-family: serif; }",
+		"docs/handbook/content/index.html":      "<html><head><title>Handbook</title></head><body></body></html>",
+		"docs/handbook/.git/config":             "ignored",
+		"docs/annual-report/content/index.html": "<html><head><title>Report</title></head><body></body></html>",
+	})
+	return dir
+}
+
+// recordingBuild writes the staged index.html as the output and records the jobs it ran
+func recordingBuild(jobs *[]*Job) BuildFunc {
+	return func(job *Job) error {
+		*jobs = append(*jobs, job)
+		if _, err := os.Stat(filepath.Join(job.InputDir, ".git")); err == nil {
+			return fmt.Errorf("hidden files were staged")
+		}
+		data, err := os.ReadFile(filepath.Join(job.InputDir, "content", "index.html"))
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(job.OutputFile, data, 0644)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := setupWorkspace(t)
+
+	ws, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Failed to load workspace: %v", err)
+	}
+	if len(ws.Documents) != 2 || ws.Documents[0].Name != "handbook" {
+		t.Errorf("Unexpected documents: %+v", ws.Documents)
+	}
+	if got, want := ws.OutputFile(ws.Documents[1]), filepath.Join(ws.Dir, "out", "annual.liv"); got != want {
+		t.Errorf("Expected output %s, got %s", want, got)
+	}
+	if ws.ShouldSign(ws.Documents[0]) || !ws.ShouldCompress() {
+		t.Error("Expected unsigned, compressed builds by default")
+	}
+
+	invalid := map[string]string{
+		"version":   `{"version": 2, "documents": [{"path": "docs/handbook"}]}`,
+		"empty":     `{"version": 1, "documents": []}`,
+		"missing":   `{"version": 1, "documents": [{"path": "docs/missing"}]}`,
+		"duplicate": `{"version": 1, "documents": [{"path": "docs/handbook"}, {"path": "docs/handbook"}]}`,
+		"output":    `{"version": 1, "documents": [{"path": "docs/handbook", "output": "x.liv"}, {"path": "docs/annual-report", "output": "x.liv"}]}`,
+		"signing":   `{"version": 1, "documents": [{"path": "docs/handbook", "sign": true}]}`,
+	}
+	for name, content := range invalid {
+		path := filepath.Join(dir, name+".work")
+		writeFiles(t, dir, map[string]string{name + ".work": content})
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected invalid workspace to fail", name)
+		}
+	}
+}
+
+func TestBuild_ThemeAndCache(t *testing.T) {
+	dir := setupWorkspace(t)
+	ws, err := Load(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatalf("Failed to load workspace: %v", err)
+	}
+
+	var jobs []*Job
+	report, err := Build(ws, recordingBuild(&jobs), BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.Count(StatusBuilt) != 2 || len(jobs) != 2 {
+		t.Fatalf("Expected 2 documents built, got report %+v", report.Documents)
+	}
+
+	output, _ := os.ReadFile(ws.OutputFile(ws.Documents[0]))
+	if !strings.Contains(string(output), `<link rel="stylesheet" href="styles/theme.css">`+"\n</head>") {
+		t.Errorf("Expected theme to be linked in staged document, got %s", output)
+	}
+	source, _ := os.ReadFile(filepath.Join(dir, "docs", "handbook", "content", "index.html"))
+	if strings.Contains(string(source), "theme.css") {
+		t.Error("Expected source directory to be left untouched")
+	}
+
+	// Unchanged inputs are served from the cache
+	jobs = nil
+	report, _ = Build(ws, recordingBuild(&jobs), BuildOptions{})
+	if report.Count(StatusCached) != 2 || len(jobs) != 0 {
+		t.Errorf("Expected all documents cached, got %+v", report.Documents)
+	}
+
+	// Changing the shared theme rebuilds every document
+	writeFiles(t, dir, map[string]string{"shared/theme.css": "body { font-family: sans-serif; }"})
+	jobs = nil
+	report, _ = Build(ws, recordingBuild(&jobs), BuildOptions{})
+	if report.Count(StatusBuilt) != 2 {
+		t.Errorf("Expected theme change to rebuild all documents, got %+v", report.Documents)
+	}
+
+	// Changing one document only rebuilds that document
+	writeFiles(t, dir, map[string]string{"docs/handbook/content/extra.css": "p {}"})
+	jobs = nil
+	report, _ = Build(ws, recordingBuild(&jobs), BuildOptions{})
+	if report.Count(StatusBuilt) != 1 || report.Count(StatusCached) != 1 {
+		t.Errorf("Expected one rebuild, got %+v", report.Documents)
+	}
+
+	// A modified output is rebuilt even if inputs are unchanged
+	os.WriteFile(ws.OutputFile(ws.Documents[1]), []byte("tampered"), 0644)
+	report, _ = Build(ws, recordingBuild(&jobs), BuildOptions{})
+	if report.Documents[1].Status != StatusBuilt {
+		t.Errorf("Expected modified output to be rebuilt, got %s", report.Documents[1].Status)
+	}
+}
+
+func TestBuild_ReportsFailures(t *testing.T) {
+	dir := setupWorkspace(t)
+	ws, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Failed to load workspace: %v", err)
+	}
+
+	var jobs []*Job
+	build := func(job *Job) error {
+		if job.Document.Name == "handbook" {
+			return fmt.Errorf("broken document")
+		}
+		return recordingBuild(&jobs)(job)
+	}
+
+	report, err := Build(ws, build, BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.Count(StatusFailed) != 1 || report.Count(StatusBuilt) != 1 {
+		t.Errorf("Expected one failure and one success, got %+v", report.Documents)
+	}
+	if report.Documents[0].Error != "broken document" {
+		t.Errorf("Expected failure to be reported, got %q", report.Documents[0].Error)
+	}
+
+	reportPath := filepath.Join(dir, "out", "build-report.json")
+	if err := report.WriteFile(reportPath); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	if data, err := os.ReadFile(reportPath); err != nil || !strings.Contains(string(data), `"status": "failed"`) {
+		t.Errorf("Unexpected report file: %s (%v)", data, err)
+	}
+}
+
+// zipBuild packages the staged directory as a ZIP archive
+func zipBuild(job *Job) error {
+	out, err := os.Create(job.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := zip.NewWriter(out)
+	err = filepath.Walk(job.InputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, _ := filepath.Rel(job.InputDir, path)
+		entry, err := writer.Create(filepath.ToSlash(relPath))
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = entry.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func setupSharedAssetWorkspace(t *testing.T, mode string) *Workspace {
+	dir := setupWorkspace(t)
+	writeFiles(t, dir, map[string]string{
+		FileName: `{
+  "version": 1,
+  "shared_assets": {"dir": "shared/assets", "mode": "` + mode + `"},
+  "documents": [
+    {"path": "docs/handbook", "shared_assets": ["fonts/*.woff", "images/logo.png"]},
+    {"name": "report", "path": "docs/annual-report", "shared_assets": ["images/logo.png"]}
+  ]
+}`,
+		"shared/assets/fonts/body.woff":   "font bytes",
+		"shared/assets/images/logo.png":   "logo v1",
+		"shared/assets/images/unused.png": "unused",
+	})
+
+	ws, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Failed to load workspace: %v", err)
+	}
+	return ws
+}
+
+func TestBuild_SharedAssets(t *testing.T) {
+	for _, mode := range []string{AssetModeCopy, AssetModeLink} {
+		ws := setupSharedAssetWorkspace(t, mode)
+
+		report, err := Build(ws, zipBuild, BuildOptions{})
+		if err != nil {
+			t.Fatalf("%s: build failed: %v", mode, err)
+		}
+		if report.Count(StatusBuilt) != 2 || report.Documents[0].Assets != 2 || report.Documents[1].Assets != 1 {
+			t.Fatalf("%s: unexpected report: %+v", mode, report.Documents)
+		}
+
+		reader, err := zip.OpenReader(ws.OutputFile(ws.Documents[1]))
+		if err != nil {
+			t.Fatalf("%s: failed to open output: %v", mode, err)
+		}
+		if _, err := reader.Open("assets/shared/images/logo.png"); err != nil {
+			t.Errorf("%s: expected shared logo in report package", mode)
+		}
+		if _, err := reader.Open("assets/shared/fonts/body.woff"); err == nil {
+			t.Errorf("%s: expected unreferenced font to be left out", mode)
+		}
+		reader.Close()
+
+		sums, _ := ws.LoadAssetSums()
+		if len(sums) != 2 {
+			t.Errorf("%s: expected 2 recorded shared assets, got %v", mode, sums)
+		}
+	}
+}
+
+func TestAssetImpacts(t *testing.T) {
+	ws := setupSharedAssetWorkspace(t, AssetModeCopy)
+	if _, err := Build(ws, zipBuild, BuildOptions{}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	impacts, err := ws.AssetImpacts()
+	if err != nil {
+		t.Fatalf("Failed to compute impacts: %v", err)
+	}
+	if len(AffectedDocuments(impacts)) != 0 {
+		t.Errorf("Expected no affected documents right after a build")
+	}
+
+	writeFiles(t, ws.Dir, map[string]string{"shared/assets/images/logo.png": "logo v2"})
+	impacts, _ = ws.AssetImpacts()
+	affected := AffectedDocuments(impacts)
+	if strings.Join(affected, ",") != "handbook,report" {
+		t.Errorf("Expected logo change to affect both documents, got %v", affected)
+	}
+
+	os.Remove(filepath.Join(ws.Dir, "shared", "assets", "fonts", "body.woff"))
+	impacts, _ = ws.AssetImpacts()
+	for _, impact := range impacts {
+		if impact.Path == "fonts/body.woff" && (impact.Status != AssetRemoved || strings.Join(impact.Documents, ",") != "handbook") {
+			t.Errorf("Unexpected impact for removed font: %+v", impact)
+		}
+		if impact.Path == "images/unused.png" && (impact.Status != AssetAdded || len(impact.Documents) != 0) {
+			t.Errorf("Unexpected impact for unused image: %+v", impact)
+		}
+	}
+}
+
+func TestBuild_SharedAssetConflicts(t *testing.T) {
+	ws := setupSharedAssetWorkspace(t, AssetModeCopy)
+	writeFiles(t, ws.Dir, map[string]string{"docs/annual-report/assets/shared/images/logo.png": "local copy"})
+
+	report, err := Build(ws, zipBuild, BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.Documents[1].Status != StatusFailed || !strings.Contains(report.Documents[1].Error, "conflicts") {
+		t.Errorf("Expected conflicting local asset to fail, got %+v", report.Documents[1])
+	}
+	if _, err := os.Stat(filepath.Join(ws.Dir, SumFile)); err == nil {
+		t.Error("Expected shared asset sums not to be recorded after a failed build")
+	}
+
+	// A build step that alters a shared asset is caught by verification
+	alter := func(job *Job) error {
+		os.WriteFile(filepath.Join(job.InputDir, "assets", "shared", "images", "logo.png"), []byte("altered"), 0644)
+		return zipBuild(job)
+	}
+	os.RemoveAll(filepath.Join(ws.Dir, "docs", "annual-report", "assets"))
+	report, _ = Build(ws, alter, BuildOptions{NoCache: true})
+	if report.Count(StatusFailed) != 2 {
+		t.Errorf("Expected altered shared assets to fail verification, got %+v", report.Documents)
+	}
+}